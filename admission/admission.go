@@ -0,0 +1,270 @@
+package admission
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/randx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+// InvitationQueryParameter is the query parameter of the registration flow's URL which carries the invitation token.
+const InvitationQueryParameter = "invitation"
+
+var (
+	ErrRegistrationDisabled = herodot.ErrForbidden.
+				WithError("registration is disabled").
+				WithReason("Registration is disabled. Please sign in if you already have an account.").
+				WithDetail(errorx.DetailErrorID, form.ErrorIDRegistrationDisabled)
+
+	ErrInvitationRequired = herodot.ErrBadRequest.
+				WithError("a valid invitation is required").
+				WithReason("You can only register using an invitation. Please use the link from your invitation, it might have expired or been used already.").
+				WithDetail(errorx.DetailErrorID, form.ErrorIDInvitationRequired)
+
+	ErrApprovalPending = herodot.ErrBadRequest.
+				WithError("the identity has not been approved yet").
+				WithReason("Your account has to be approved by an administrator before you can sign in. You will receive an email once it was approved.").
+				WithDetail(errorx.DetailErrorID, form.ErrorIDApprovalPending)
+)
+
+type (
+	// Invitation allows someone to register while registration is invite-only. The identity must use the invited
+	// identifier, for example as its email address.
+	//
+	// swagger:model registrationInvitation
+	Invitation struct {
+		// required: true
+		ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+		// Identifier is the email address or username of the invited person.
+		//
+		// required: true
+		Identifier string `json:"identifier" db:"identifier"`
+
+		// Token is the secret part of the invitation link.
+		Token string `json:"-" faker:"-" db:"token"`
+
+		// URL is the link which starts the registration flow using this invitation. It is only returned when the
+		// invitation is created.
+		URL string `json:"url,omitempty" faker:"-" db:"-"`
+
+		// ExpiresAt is the time (UTC) until the invitation can be used.
+		//
+		// required: true
+		ExpiresAt time.Time `json:"expires_at" faker:"time_type" db:"expires_at"`
+
+		// UsedAt is the time (UTC) the invitation was used to register.
+		UsedAt *time.Time `json:"used_at,omitempty" faker:"-" db:"used_at"`
+
+		// IdentityID is the ID of the identity which registered using this invitation.
+		IdentityID uuid.NullUUID `json:"identity_id" faker:"-" db:"identity_id"`
+
+		// CreatedAt is the time (UTC) the invitation was created.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+
+	// Approval is an identity which registered while registration requires approval and which has not been
+	// approved or rejected yet.
+	//
+	// swagger:model registrationApproval
+	Approval struct {
+		// required: true
+		IdentityID uuid.UUID `json:"identity_id" faker:"uuid" db:"identity_id"`
+
+		// Identity is the identity which awaits approval.
+		Identity *identity.Identity `json:"identity,omitempty" faker:"-" db:"-"`
+
+		// CreatedAt is the time (UTC) the identity registered.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+	}
+
+	admitterDependencies interface {
+		PersistenceProvider
+		identity.PrivilegedPoolProvider
+		x.LoggingProvider
+	}
+	AdmitterProvider interface {
+		RegistrationAdmitter() *Admitter
+	}
+	// Admitter enforces the registration modes: it decides who may start a registration flow and register, and
+	// keeps identities which need approval from signing in.
+	Admitter struct {
+		r admitterDependencies
+		c configuration.Provider
+	}
+)
+
+func (i Invitation) TableName() string {
+	return "identity_invitations"
+}
+
+func (a Approval) TableName() string {
+	return "identity_registration_approvals"
+}
+
+// NewInvitation returns an invitation for the identifier which expires after the given lifespan.
+func NewInvitation(identifier string, lifespan time.Duration) (*Invitation, error) {
+	token, err := randx.RuneSequence(32, randx.AlphaNum)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &Invitation{
+		ID:         x.NewUUID(),
+		Identifier: strings.ToLower(strings.TrimSpace(identifier)),
+		Token:      string(token),
+		ExpiresAt:  time.Now().UTC().Add(lifespan),
+	}, nil
+}
+
+// IsUsable returns true if the invitation was not used yet and did not expire.
+func (i *Invitation) IsUsable() bool {
+	return i.UsedAt == nil && i.ExpiresAt.After(time.Now().UTC())
+}
+
+func NewAdmitter(r admitterDependencies, c configuration.Provider) *Admitter {
+	return &Admitter{r: r, c: c}
+}
+
+// CheckRegistrationRequest returns an error if the registration flow may not be started. Self-service registration
+// creates identities using the default traits schema, so its registration mode applies.
+func (a *Admitter) CheckRegistrationRequest(ctx context.Context, r *http.Request) error {
+	switch a.c.SelfServiceRegistrationMode(configuration.DefaultIdentityTraitsSchemaID) {
+	case configuration.RegistrationModeDisabled:
+		return errors.WithStack(ErrRegistrationDisabled)
+	case configuration.RegistrationModeInviteOnly:
+		_, err := a.usableInvitation(ctx, r.URL.Query().Get(InvitationQueryParameter))
+		return err
+	}
+	return nil
+}
+
+// CheckRegistration returns an error if the identity may not register. It must be called before the identity is
+// created. requestURL is the URL the registration flow was started with, which carries the invitation token.
+func (a *Admitter) CheckRegistration(ctx context.Context, requestURL string, i *identity.Identity) error {
+	switch a.c.SelfServiceRegistrationMode(i.TraitsSchemaID) {
+	case configuration.RegistrationModeDisabled:
+		return errors.WithStack(ErrRegistrationDisabled)
+	case configuration.RegistrationModeInviteOnly:
+		inv, err := a.usableInvitation(ctx, invitationToken(requestURL))
+		if err != nil {
+			return err
+		}
+
+		if !usesIdentifier(i, inv.Identifier) {
+			return errors.WithStack(ErrInvitationRequired.WithDebugf("The identity does not use the invited identifier."))
+		}
+	}
+	return nil
+}
+
+// Admit records the registration of the identity after it was created. It uses up the invitation if registration is
+// invite-only and returns true if the identity awaits approval. If an error is returned, the identity has not been
+// admitted and must be deleted.
+func (a *Admitter) Admit(ctx context.Context, requestURL string, i *identity.Identity) (pending bool, err error) {
+	switch a.c.SelfServiceRegistrationMode(i.TraitsSchemaID) {
+	case configuration.RegistrationModeInviteOnly:
+		inv, err := a.usableInvitation(ctx, invitationToken(requestURL))
+		if err != nil {
+			return false, err
+		}
+
+		// Two registrations might have passed CheckRegistration using the same invitation, only one may use it.
+		if err := a.r.AdmissionPersister().UseInvitation(ctx, inv.ID, i.ID); err != nil {
+			if errorsx.Cause(err) == sqlcon.ErrNoRows {
+				return false, errors.WithStack(ErrInvitationRequired.WithDebug("The invitation was used concurrently."))
+			}
+			return false, err
+		}
+	case configuration.RegistrationModeApproval:
+		if err := a.r.AdmissionPersister().CreateApproval(ctx, &Approval{IdentityID: i.ID, CreatedAt: time.Now().UTC()}); err != nil {
+			return false, err
+		}
+
+		x.ContextLogger(ctx, a.r.Logger()).WithField("identity_id", i.ID).Info("A new identity registered and awaits approval.")
+		return true, nil
+	}
+	return false, nil
+}
+
+// CheckLogin returns ErrApprovalPending if the identity has not been approved yet.
+func (a *Admitter) CheckLogin(ctx context.Context, i *identity.Identity) error {
+	pending, err := a.r.AdmissionPersister().IsApprovalPending(ctx, i.ID)
+	if err != nil {
+		return err
+	}
+
+	if pending {
+		return errors.WithStack(ErrApprovalPending)
+	}
+	return nil
+}
+
+func (a *Admitter) usableInvitation(ctx context.Context, token string) (*Invitation, error) {
+	if len(token) == 0 {
+		return nil, errors.WithStack(ErrInvitationRequired.WithDebug("The invitation token is missing."))
+	}
+
+	inv, err := a.r.AdmissionPersister().GetInvitationByToken(ctx, token)
+	if err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			return nil, errors.WithStack(ErrInvitationRequired.WithDebug("The invitation does not exist."))
+		}
+		return nil, err
+	}
+
+	if !inv.IsUsable() {
+		return nil, errors.WithStack(ErrInvitationRequired.WithDebug("The invitation was used already or has expired."))
+	}
+	return inv, nil
+}
+
+// invitationToken returns the invitation token of the URL the registration flow was started with.
+func invitationToken(requestURL string) string {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get(InvitationQueryParameter)
+}
+
+// usesIdentifier returns true if the identity uses the identifier as a verifiable address or as the identifier of
+// its credentials.
+func usesIdentifier(i *identity.Identity, identifier string) bool {
+	for _, a := range i.Addresses {
+		if strings.EqualFold(a.Value, identifier) {
+			return true
+		}
+	}
+
+	for _, c := range i.Credentials {
+		for _, id := range c.Identifiers {
+			if strings.EqualFold(id, identifier) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package admission_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	. "github.com/ory/kratos/admission"
+	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+)
+
+func TestAdmitter(t *testing.T) {
+	setup := func(t *testing.T, mode string) *driver.RegistryDefault {
+		_, reg := internal.NewRegistryDefault(t)
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+		viper.Set(configuration.ViperKeySelfServiceRegistrationMode, mode)
+		return reg
+	}
+
+	newIdentity := func(t *testing.T, reg *driver.RegistryDefault, email string) *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		a, err := identity.NewVerifiableEmailAddress(email, i.ID, time.Hour)
+		require.NoError(t, err)
+		i.Addresses = []identity.VerifiableAddress{*a}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i
+	}
+
+	invite := func(t *testing.T, reg *driver.RegistryDefault, identifier string) string {
+		inv, err := NewInvitation(identifier, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, reg.AdmissionPersister().CreateInvitation(context.Background(), inv))
+		return "http://kratos.ory.sh/self-service/browser/flows/registration?" + url.Values{InvitationQueryParameter: {inv.Token}}.Encode()
+	}
+
+	t.Run("mode=open", func(t *testing.T) {
+		reg := setup(t, configuration.RegistrationModeOpen)
+		require.NoError(t, reg.RegistrationAdmitter().CheckRegistrationRequest(context.Background(), httptest.NewRequest("GET", "/", nil)))
+
+		i := newIdentity(t, reg, "open@ory.sh")
+		require.NoError(t, reg.RegistrationAdmitter().CheckRegistration(context.Background(), "", i))
+		pending, err := reg.RegistrationAdmitter().Admit(context.Background(), "", i)
+		require.NoError(t, err)
+		assert.False(t, pending)
+		require.NoError(t, reg.RegistrationAdmitter().CheckLogin(context.Background(), i))
+	})
+
+	t.Run("mode=disabled", func(t *testing.T) {
+		reg := setup(t, configuration.RegistrationModeDisabled)
+		err := reg.RegistrationAdmitter().CheckRegistrationRequest(context.Background(), httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, ErrRegistrationDisabled, errors.Cause(err))
+
+		err = reg.RegistrationAdmitter().CheckRegistration(context.Background(), "", identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID))
+		assert.Equal(t, ErrRegistrationDisabled, errors.Cause(err))
+
+		viper.Set(configuration.ViperKeySelfServiceRegistrationSchemaModes, map[string]interface{}{"customer": configuration.RegistrationModeOpen})
+		defer viper.Set(configuration.ViperKeySelfServiceRegistrationSchemaModes, nil)
+		require.NoError(t, reg.RegistrationAdmitter().CheckRegistration(context.Background(), "", identity.NewIdentity("customer")),
+			"the mode of a schema overrides the global mode")
+	})
+
+	t.Run("mode=invite_only", func(t *testing.T) {
+		reg := setup(t, configuration.RegistrationModeInviteOnly)
+
+		t.Run("case=without invitation", func(t *testing.T) {
+			err := reg.RegistrationAdmitter().CheckRegistrationRequest(context.Background(), httptest.NewRequest("GET", "/", nil))
+			assert.Contains(t, errors.Cause(err).Error(), ErrInvitationRequired.Error())
+
+			err = reg.RegistrationAdmitter().CheckRegistrationRequest(context.Background(), httptest.NewRequest("GET", "/?invitation=does-not-exist", nil))
+			assert.Contains(t, errors.Cause(err).Error(), ErrInvitationRequired.Error())
+		})
+
+		t.Run("case=with invitation", func(t *testing.T) {
+			requestURL := invite(t, reg, "invited@ory.sh")
+			require.NoError(t, reg.RegistrationAdmitter().CheckRegistrationRequest(context.Background(), httptest.NewRequest("GET", requestURL, nil)))
+
+			other := newIdentity(t, reg, "other@ory.sh")
+			err := reg.RegistrationAdmitter().CheckRegistration(context.Background(), requestURL, other)
+			assert.Contains(t, errors.Cause(err).Error(), ErrInvitationRequired.Error(), "the invited identifier must be used")
+
+			i := newIdentity(t, reg, "Invited@ory.sh")
+			require.NoError(t, reg.RegistrationAdmitter().CheckRegistration(context.Background(), requestURL, i))
+			pending, err := reg.RegistrationAdmitter().Admit(context.Background(), requestURL, i)
+			require.NoError(t, err)
+			assert.False(t, pending)
+
+			_, err = reg.RegistrationAdmitter().Admit(context.Background(), requestURL, newIdentity(t, reg, "again@ory.sh"))
+			assert.Contains(t, errors.Cause(err).Error(), ErrInvitationRequired.Error(), "an invitation can only be used once")
+		})
+	})
+
+	t.Run("mode=approval", func(t *testing.T) {
+		reg := setup(t, configuration.RegistrationModeApproval)
+		require.NoError(t, reg.RegistrationAdmitter().CheckRegistrationRequest(context.Background(), httptest.NewRequest("GET", "/", nil)))
+
+		i := newIdentity(t, reg, "approval@ory.sh")
+		require.NoError(t, reg.RegistrationAdmitter().CheckRegistration(context.Background(), "", i))
+		pending, err := reg.RegistrationAdmitter().Admit(context.Background(), "", i)
+		require.NoError(t, err)
+		assert.True(t, pending)
+
+		assert.Equal(t, ErrApprovalPending, errors.Cause(reg.RegistrationAdmitter().CheckLogin(context.Background(), i)))
+
+		require.NoError(t, reg.AdmissionPersister().DeleteApproval(context.Background(), i.ID))
+		require.NoError(t, reg.RegistrationAdmitter().CheckLogin(context.Background(), i))
+	})
+}
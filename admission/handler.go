@@ -0,0 +1,340 @@
+package admission
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/pagination"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	InvitationsPath = "/registration/invitations"
+	ApprovalsPath   = "/registration/approvals"
+
+	// BrowserRegistrationPath is the path which starts the registration flow, see registration.BrowserRegistrationPath.
+	// It is repeated here because the registration package depends on this one.
+	BrowserRegistrationPath = "/self-service/browser/flows/registration"
+)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		identity.PrivilegedPoolProvider
+		identity.ManagementProvider
+		notification.SenderProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		AdmissionHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(InvitationsPath, h.listInvitations)
+	admin.POST(InvitationsPath, h.createInvitation)
+	admin.DELETE(InvitationsPath+"/:id", h.deleteInvitation)
+
+	admin.GET(ApprovalsPath, h.listApprovals)
+	admin.POST(ApprovalsPath+"/:id/approve", h.approve)
+	admin.POST(ApprovalsPath+"/:id/reject", h.reject)
+}
+
+// A single invitation.
+//
+// swagger:response registrationInvitation
+// nolint:deadcode,unused
+type invitationResponse struct {
+	// in: body
+	Body *Invitation
+}
+
+// A list of invitations.
+//
+// swagger:response registrationInvitations
+// nolint:deadcode,unused
+type invitationsResponse struct {
+	// in: body
+	Body []Invitation
+}
+
+// A list of identities which await approval.
+//
+// swagger:response registrationApprovals
+// nolint:deadcode,unused
+type approvalsResponse struct {
+	// in: body
+	Body []Approval
+}
+
+// swagger:model createRegistrationInvitation
+type CreateInvitation struct {
+	// Identifier is the email address or username of the person to invite. If it is an email address, the
+	// invitation link is sent to it.
+	//
+	// required: true
+	Identifier string `json:"identifier"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters createRegistrationInvitation
+type createInvitationParameters struct {
+	// in: body
+	Body CreateInvitation
+}
+
+// nolint:deadcode,unused
+// swagger:parameters deleteRegistrationInvitation approveRegistration rejectRegistration
+type idParameters struct {
+	// ID is the ID of the invitation or identity.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /registration/invitations admin listRegistrationInvitations
+//
+// List invitations
+//
+// Returns the invitations, newest first, including those which were used or have expired.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: registrationInvitations
+//       500: genericError
+func (h *Handler) listInvitations(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	is, err := h.r.AdmissionPersister().ListInvitations(r.Context(), limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, is)
+}
+
+// swagger:route POST /registration/invitations admin createRegistrationInvitation
+//
+// Invite someone to register
+//
+// Creates an invitation which allows registering while `selfservice.registration.mode` is `invite_only`. The
+// identity has to use the invited identifier, for example as its email address. If the identifier is an email
+// address, the invitation link is sent to it. The link is also returned in the `url` field.
+//
+// Invitations expire after `selfservice.registration.invitation_lifespan` and can only be used once.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: registrationInvitation
+//       400: genericError
+//       500: genericError
+func (h *Handler) createInvitation(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var body CreateInvitation
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&body)); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	if len(strings.TrimSpace(body.Identifier)) == 0 {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The identifier must be set.")))
+		return
+	}
+
+	inv, err := NewInvitation(body.Identifier, h.c.SelfServiceRegistrationInvitationLifespan())
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.AdmissionPersister().CreateInvitation(r.Context(), inv); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	inv.URL = urlx.CopyWithQuery(
+		urlx.AppendPaths(h.c.SelfPublicURL(), BrowserRegistrationPath),
+		url.Values{InvitationQueryParameter: {inv.Token}},
+	).String()
+
+	if strings.Contains(inv.Identifier, "@") {
+		if err := h.r.NotificationSender().NotifyInvitation(r.Context(), inv.Identifier, inv.URL, inv.ExpiresAt); err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+	}
+
+	h.r.Writer().WriteCreated(w, r, urlx.AppendPaths(h.c.SelfAdminURL(), InvitationsPath).String(), inv)
+}
+
+// swagger:route DELETE /registration/invitations/{id} admin deleteRegistrationInvitation
+//
+// Revoke an invitation
+//
+// Deletes the invitation, so that it can no longer be used to register.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) deleteInvitation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := h.r.AdmissionPersister().DeleteInvitation(r.Context(), x.ParseUUID(ps.ByName("id"))); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route GET /registration/approvals admin listRegistrationApprovals
+//
+// List identities which await approval
+//
+// Returns the identities which registered while `selfservice.registration.mode` is `approval` and which have
+// neither been approved nor rejected yet, oldest first. These identities can not sign in.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: registrationApprovals
+//       500: genericError
+func (h *Handler) listApprovals(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	as, err := h.r.AdmissionPersister().ListApprovals(r.Context(), limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	for k := range as {
+		if as[k].Identity, err = h.r.PrivilegedIdentityPool().GetIdentity(r.Context(), as[k].IdentityID); err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+	}
+
+	h.r.Writer().Write(w, r, as)
+}
+
+// swagger:route POST /registration/approvals/{id}/approve admin approveRegistration
+//
+// Approve an identity
+//
+// Allows the identity to sign in and notifies it by email.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) approve(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := x.ParseUUID(ps.ByName("id"))
+	i, err := h.r.PrivilegedIdentityPool().GetIdentity(r.Context(), id)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.AdmissionPersister().DeleteApproval(r.Context(), id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).WithField("identity_id", id).Info("An identity was approved.")
+	if err := h.r.NotificationSender().NotifyRegistrationApproved(r.Context(), i); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route POST /registration/approvals/{id}/reject admin rejectRegistration
+//
+// Reject an identity
+//
+// Notifies the identity by email and deletes it. This can not be undone.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := x.ParseUUID(ps.ByName("id"))
+	pending, err := h.r.AdmissionPersister().IsApprovalPending(r.Context(), id)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	} else if !pending {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("The identity does not await approval.")))
+		return
+	}
+
+	i, err := h.r.PrivilegedIdentityPool().GetIdentity(r.Context(), id)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	// The email is queued before the identity is deleted because its addresses are deleted with it.
+	if err := h.r.NotificationSender().NotifyRegistrationRejected(r.Context(), i); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.IdentityManager().Delete(r.Context(), id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).WithField("identity_id", id).Info("An identity was rejected and deleted.")
+	w.WriteHeader(http.StatusNoContent)
+}
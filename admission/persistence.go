@@ -0,0 +1,134 @@
+package admission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		AdmissionPersister() Persister
+	}
+	Persister interface {
+		CreateInvitation(ctx context.Context, i *Invitation) error
+
+		// GetInvitationByToken returns the invitation with the token, whether it can still be used or not.
+		GetInvitationByToken(ctx context.Context, token string) (*Invitation, error)
+
+		// ListInvitations returns the invitations, newest first.
+		ListInvitations(ctx context.Context, limit, offset int) ([]Invitation, error)
+
+		DeleteInvitation(ctx context.Context, id uuid.UUID) error
+
+		// UseInvitation marks the invitation as used by the identity. It returns sqlcon.ErrNoRows if the invitation
+		// does not exist, was used already, or has expired.
+		UseInvitation(ctx context.Context, id, identityID uuid.UUID) error
+
+		CreateApproval(ctx context.Context, a *Approval) error
+
+		// ListApprovals returns the identities which await approval, oldest first.
+		ListApprovals(ctx context.Context, limit, offset int) ([]Approval, error)
+
+		// IsApprovalPending returns true if the identity awaits approval.
+		IsApprovalPending(ctx context.Context, identityID uuid.UUID) (bool, error)
+
+		// DeleteApproval removes the identity from the list of identities which await approval. It returns
+		// sqlcon.ErrNoRows if the identity does not await approval.
+		DeleteApproval(ctx context.Context, identityID uuid.UUID) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		t.Run("case=invitations", func(t *testing.T) {
+			_, err := p.GetInvitationByToken(context.Background(), "does-not-exist")
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+
+			expected, err := NewInvitation("Invited@ory.sh", time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateInvitation(context.Background(), expected))
+			assert.Equal(t, "invited@ory.sh", expected.Identifier)
+
+			actual, err := p.GetInvitationByToken(context.Background(), expected.Token)
+			require.NoError(t, err)
+			assert.Equal(t, expected.ID, actual.ID)
+			assert.True(t, actual.IsUsable())
+
+			is, err := p.ListInvitations(context.Background(), 100, 0)
+			require.NoError(t, err)
+			var found bool
+			for _, i := range is {
+				found = found || i.ID == expected.ID
+			}
+			assert.True(t, found)
+
+			identityID := x.NewUUID()
+			require.NoError(t, p.UseInvitation(context.Background(), expected.ID, identityID))
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.UseInvitation(context.Background(), expected.ID, x.NewUUID())),
+				"an invitation can only be used once")
+
+			actual, err = p.GetInvitationByToken(context.Background(), expected.Token)
+			require.NoError(t, err)
+			assert.False(t, actual.IsUsable())
+			assert.Equal(t, identityID, actual.IdentityID.UUID)
+
+			expired, err := NewInvitation("expired@ory.sh", -time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateInvitation(context.Background(), expired))
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.UseInvitation(context.Background(), expired.ID, identityID)),
+				"an expired invitation can not be used")
+
+			require.NoError(t, p.DeleteInvitation(context.Background(), expected.ID))
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteInvitation(context.Background(), expected.ID)))
+		})
+
+		t.Run("case=approvals", func(t *testing.T) {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+			pending, err := p.IsApprovalPending(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.False(t, pending)
+
+			require.NoError(t, p.CreateApproval(context.Background(), &Approval{IdentityID: i.ID, CreatedAt: time.Now().UTC()}))
+			pending, err = p.IsApprovalPending(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.True(t, pending)
+
+			as, err := p.ListApprovals(context.Background(), 100, 0)
+			require.NoError(t, err)
+			var found bool
+			for _, a := range as {
+				found = found || a.IdentityID == i.ID
+			}
+			assert.True(t, found)
+
+			require.NoError(t, p.DeleteApproval(context.Background(), i.ID))
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteApproval(context.Background(), i.ID)))
+
+			pending, err = p.IsApprovalPending(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.False(t, pending)
+		})
+	}
+}
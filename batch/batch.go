@@ -0,0 +1,385 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/idempotency"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/persistence"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	OperationCreate OperationType = "create"
+	OperationUpdate OperationType = "update"
+	OperationPatch  OperationType = "patch"
+	OperationDelete OperationType = "delete"
+
+	// MaxOperations is the maximum number of operations of a batch.
+	MaxOperations = 1000
+
+	// chunkSize is the number of operations which are executed in one transaction.
+	chunkSize = 100
+
+	// idempotencyScope is the scope of the idempotency keys of batch operations.
+	idempotencyScope = "batch"
+)
+
+var (
+	errOperationFailed = errors.New("the operation failed")
+
+	// ErrRolledBack is the error of the operations of a transactional batch which were not applied because another
+	// operation failed.
+	ErrRolledBack = herodot.DefaultError{
+		CodeField:   http.StatusFailedDependency,
+		StatusField: http.StatusText(http.StatusFailedDependency),
+		ErrorField:  "the operation was rolled back",
+	}
+)
+
+type (
+	// OperationType is what an operation does with an identity.
+	OperationType string
+
+	// Operation creates, updates, patches, or deletes an identity.
+	//
+	// swagger:model batchOperation
+	Operation struct {
+		// Type is one of "create", "update", "patch", and "delete".
+		//
+		// required: true
+		Type OperationType `json:"op"`
+
+		// ID is the ID of the identity which is updated, patched, or deleted.
+		ID uuid.UUID `json:"id"`
+
+		// Identity is the identity which is created. When updating an identity, its traits and its traits schema
+		// are replaced by the ones of this identity.
+		Identity *identity.Identity `json:"identity"`
+
+		// Traits is a JSON merge patch (RFC 7396) which is applied to the traits of the identity which is patched.
+		Traits json.RawMessage `json:"traits"`
+
+		// IdempotencyKey identifies the operation. If an operation with the same key was applied before, its result
+		// is returned and the operation is not applied again. This allows to retry batches which failed partially.
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+
+	// Result is the outcome of an operation.
+	//
+	// swagger:model batchResult
+	Result struct {
+		// Index is the position of the operation in the batch.
+		//
+		// required: true
+		Index int `json:"index"`
+
+		// StatusCode is the HTTP status code the operation would have had if it was sent on its own, for example
+		// 201 for a created identity.
+		//
+		// required: true
+		StatusCode int `json:"status_code"`
+
+		// Identity is the created, updated, or patched identity.
+		Identity *identity.Identity `json:"identity,omitempty"`
+
+		// Error is set if the operation failed.
+		Error *herodot.DefaultError `json:"error,omitempty"`
+
+		// Replayed is true if the operation was not applied because it was applied with the same idempotency key
+		// before. The result is the result of that operation.
+		Replayed bool `json:"replayed,omitempty"`
+	}
+
+	executorDependencies interface {
+		persistence.Provider
+		identity.ManagementProvider
+		identity.PrivilegedPoolProvider
+		idempotency.PersistenceProvider
+		x.LoggingProvider
+	}
+	ExecutorProvider interface {
+		BatchExecutor() *Executor
+	}
+	// Executor applies batches of identity operations.
+	Executor struct {
+		r executorDependencies
+		c configuration.Provider
+	}
+)
+
+func NewExecutor(r executorDependencies, c configuration.Provider) *Executor {
+	return &Executor{r: r, c: c}
+}
+
+// Execute applies the operations and returns a result for each of them. The operations are applied in chunks, each
+// in a transaction. If an operation of a chunk fails, the operations of the chunk are applied one by one, so that
+// only the operations which fail are not applied.
+//
+// If transactional is true, all operations are applied in one transaction. If one of them fails, none is applied.
+func (e *Executor) Execute(ctx context.Context, ops []Operation, transactional bool) ([]Result, error) {
+	if len(ops) == 0 || len(ops) > MaxOperations {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("A batch must contain between 1 and %d operations.", MaxOperations))
+	}
+
+	for _, op := range ops {
+		if err := idempotency.ValidateKey(op.IdempotencyKey); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]Result, len(ops))
+	if transactional {
+		if err := e.executeAll(ctx, ops, results); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+
+	for start := 0; start < len(ops); start += chunkSize {
+		end := start + chunkSize
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		if err := e.executeChunk(ctx, ops, results, start, end); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (e *Executor) executeAll(ctx context.Context, ops []Operation, results []Result) error {
+	failed := -1
+	err := e.r.Persister().InTransaction(ctx, func(ctx context.Context) error {
+		for k := range ops {
+			results[k] = e.execute(ctx, k, ops[k])
+			if results[k].Error != nil {
+				failed = k
+				return errOperationFailed
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	} else if failed < 0 {
+		return err
+	}
+
+	for k := range results {
+		if k != failed {
+			results[k] = rolledBack(k, failed)
+		}
+	}
+	return nil
+}
+
+func (e *Executor) executeChunk(ctx context.Context, ops []Operation, results []Result, start, end int) error {
+	if err := e.r.Persister().InTransaction(ctx, func(ctx context.Context) error {
+		for k := start; k < end; k++ {
+			results[k] = e.execute(ctx, k, ops[k])
+			if results[k].Error != nil {
+				return errOperationFailed
+			}
+		}
+		return nil
+	}); err == nil {
+		return nil
+	} else if errorsx.Cause(err) != errOperationFailed {
+		return err
+	}
+
+	// The chunk was rolled back. Some databases abort a transaction once a statement failed, so the operations
+	// are applied one by one.
+	for k := start; k < end; k++ {
+		if err := e.r.Persister().InTransaction(ctx, func(ctx context.Context) error {
+			results[k] = e.execute(ctx, k, ops[k])
+			if results[k].Error != nil {
+				return errOperationFailed
+			}
+			return nil
+		}); err != nil && errorsx.Cause(err) != errOperationFailed {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute applies the operation unless it was applied with the same idempotency key before. The result of an
+// operation which succeeded is stored for its idempotency key in the same transaction.
+func (e *Executor) execute(ctx context.Context, k int, op Operation) Result {
+	if len(op.IdempotencyKey) > 0 {
+		record, err := e.r.IdempotencyPersister().GetIdempotencyRecord(ctx, idempotencyScope, op.IdempotencyKey)
+		if err == nil {
+			var res Result
+			if err := json.Unmarshal([]byte(record.Body), &res); err != nil {
+				return failure(k, errors.WithStack(err))
+			}
+			res.Index = k
+			res.Replayed = true
+			return res
+		} else if errorsx.Cause(err) != sqlcon.ErrNoRows {
+			return failure(k, err)
+		}
+	}
+
+	res, err := e.apply(ctx, op)
+	if err != nil {
+		return failure(k, err)
+	}
+	res.Index = k
+
+	if len(op.IdempotencyKey) > 0 {
+		body, err := json.Marshal(res)
+		if err != nil {
+			return failure(k, errors.WithStack(err))
+		}
+
+		if err := e.r.IdempotencyPersister().CreateIdempotencyRecord(ctx, idempotency.NewRecord(idempotencyScope, op.IdempotencyKey, res.StatusCode, body)); err != nil {
+			return failure(k, err)
+		}
+	}
+	return res
+}
+
+func (e *Executor) apply(ctx context.Context, op Operation) (Result, error) {
+	switch op.Type {
+	case OperationCreate:
+		if op.Identity == nil {
+			return Result{}, errors.WithStack(herodot.ErrBadRequest.WithReason("Operations of type create must contain the identity."))
+		}
+
+		i := op.Identity
+		if i.TraitsSchemaURL != "" {
+			return Result{}, errors.WithStack(herodot.ErrBadRequest.WithReason("Use the traits_schema_id to set a traits schema."))
+		}
+		// Neither the credentials nor the ID can be set, like when creating a single identity.
+		i.Credentials = nil
+		i.ID = uuid.Nil
+
+		if err := e.r.IdentityManager().Create(ctx, i); err != nil {
+			return Result{}, err
+		}
+		return Result{StatusCode: http.StatusCreated, Identity: i}, nil
+	case OperationUpdate, OperationPatch:
+		if x.IsZeroUUID(op.ID) {
+			return Result{}, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Operations of type %s must contain the ID of the identity.", op.Type))
+		}
+
+		i, err := e.r.PrivilegedIdentityPool().GetIdentityConfidential(ctx, op.ID)
+		if err != nil {
+			return Result{}, err
+		}
+
+		if op.Type == OperationUpdate {
+			if op.Identity == nil {
+				return Result{}, errors.WithStack(herodot.ErrBadRequest.WithReason("Operations of type update must contain the identity."))
+			}
+			if len(op.Identity.TraitsSchemaID) > 0 {
+				i.TraitsSchemaID = op.Identity.TraitsSchemaID
+			}
+			i.Traits = op.Identity.Traits
+		} else {
+			if len(op.Traits) == 0 {
+				return Result{}, errors.WithStack(herodot.ErrBadRequest.WithReason("Operations of type patch must contain the traits patch."))
+			}
+			traits, err := mergePatch(json.RawMessage(i.Traits), op.Traits)
+			if err != nil {
+				return Result{}, err
+			}
+			i.Traits = identity.Traits(traits)
+		}
+
+		if err := e.r.IdentityManager().Update(ctx, i, identity.ManagerSkipWriteGuard); err != nil {
+			return Result{}, err
+		}
+		return Result{StatusCode: http.StatusOK, Identity: i.CopyWithoutCredentials()}, nil
+	case OperationDelete:
+		if x.IsZeroUUID(op.ID) {
+			return Result{}, errors.WithStack(herodot.ErrBadRequest.WithReason("Operations of type delete must contain the ID of the identity."))
+		}
+
+		if err := e.r.IdentityManager().Delete(ctx, op.ID); err != nil {
+			return Result{}, err
+		}
+		return Result{StatusCode: http.StatusNoContent}, nil
+	}
+	return Result{}, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The operation type "%s" is unknown, it must be one of "create", "update", "patch", and "delete".`, op.Type))
+}
+
+func failure(k int, err error) Result {
+	var e *herodot.DefaultError
+	switch cause := errorsx.Cause(err).(type) {
+	case *herodot.DefaultError:
+		e = cause
+	case *jsonschema.ValidationError:
+		e = herodot.ErrBadRequest.WithReasonf("The traits are invalid: %s", cause.Error())
+	default:
+		e = herodot.ToDefaultError(err, "")
+	}
+	return Result{Index: k, StatusCode: e.StatusCode(), Error: e}
+}
+
+func rolledBack(k, failed int) Result {
+	e := ErrRolledBack.WithReasonf("The operation was not applied because operation %d failed.", failed)
+	return Result{Index: k, StatusCode: e.StatusCode(), Error: e}
+}
+
+// mergePatch applies a JSON merge patch (RFC 7396) to the document.
+func mergePatch(document, patch json.RawMessage) (json.RawMessage, error) {
+	var d, p interface{}
+	for _, v := range []struct {
+		raw json.RawMessage
+		dst *interface{}
+	}{{raw: document, dst: &d}, {raw: patch, dst: &p}} {
+		if len(v.raw) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(v.raw))
+		dec.UseNumber()
+		if err := dec.Decode(v.dst); err != nil {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the traits: %s", err))
+		}
+	}
+
+	out, err := json.Marshal(merge(d, p))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+func merge(document, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	d, ok := document.(map[string]interface{})
+	if !ok {
+		d = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+		} else {
+			d[k] = merge(d[k], v)
+		}
+	}
+	return d
+}
@@ -0,0 +1,128 @@
+package batch
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/x"
+)
+
+const BatchPath = "/batch"
+
+type (
+	handlerDependencies interface {
+		ExecutorProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		BatchHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.POST(BatchPath, h.execute)
+}
+
+// swagger:model batchRequest
+type Request struct {
+	// Transactional applies all operations in one transaction. If one of them fails, none is applied and the others
+	// fail with status code 424.
+	Transactional bool `json:"transactional"`
+
+	// Operations are applied in order. A batch must not contain more than 1000 operations.
+	//
+	// required: true
+	Operations []Operation `json:"operations"`
+}
+
+// swagger:model batchResponse
+type Response struct {
+	// Results contains the result of each operation, in the order of the operations.
+	//
+	// required: true
+	Results []Result `json:"results"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters executeIdentityBatch
+type executeParameters struct {
+	// in: body
+	Body Request
+}
+
+// The results of a batch.
+//
+// swagger:response batchResponse
+// nolint:deadcode,unused
+type executeResponse struct {
+	// in: body
+	Body Response
+}
+
+// swagger:route POST /batch admin executeIdentityBatch
+//
+// Create, update, patch, and delete identities in bulk
+//
+// Applies up to 1000 operations. Unless the batch is transactional, operations which fail do not prevent the
+// others from being applied. The response contains the result of every operation, including the status code it
+// would have had if it was sent on its own.
+//
+// Operations which carry an idempotency key are applied only once. Sending a batch again after it failed
+// partially returns the stored results of the operations which were applied before.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: batchResponse
+//       400: genericError
+//       500: genericError
+func (h *Handler) execute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var body Request
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&body)); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	results, err := h.r.BatchExecutor().Execute(r.Context(), body.Operations, body.Transactional)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	var failed int
+	for _, res := range results {
+		if res.Error != nil {
+			failed++
+		}
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "identity_batch").
+		WithField("operations", len(results)).
+		WithField("failed", failed).
+		WithField("transactional", body.Transactional).
+		Info("An identity batch was executed.")
+
+	h.r.Writer().Write(w, r, &Response{Results: results})
+}
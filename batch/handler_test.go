@@ -0,0 +1,138 @@
+package batch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	. "github.com/ory/kratos/batch"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	router := x.NewRouterAdmin()
+	reg.BatchHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfAdmin, ts.URL)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	send := func(t *testing.T, expectCode int, body interface{}) gjson.Result {
+		var b bytes.Buffer
+		require.NoError(t, json.NewEncoder(&b).Encode(body))
+
+		res, err := ts.Client().Post(ts.URL+BatchPath, "application/json", &b)
+		require.NoError(t, err)
+		result, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		require.EqualValues(t, expectCode, res.StatusCode, "%s", result)
+		return gjson.ParseBytes(result)
+	}
+
+	newIdentity := func(t *testing.T, traits string) uuid.UUID {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(traits)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i.ID
+	}
+
+	newIdentityOp := func(traits string) *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(traits)
+		return i
+	}
+
+	getTraits := func(t *testing.T, id uuid.UUID) string {
+		i, err := reg.IdentityPool().GetIdentity(context.Background(), id)
+		require.NoError(t, err)
+		return string(i.Traits)
+	}
+
+	t.Run("case=applies operations which do not fail", func(t *testing.T) {
+		patched := newIdentity(t, `{"email":"patch@ory.sh","name":{"first":"Jane","last":"Doe"}}`)
+		updated := newIdentity(t, `{"email":"update@ory.sh"}`)
+		deleted := newIdentity(t, `{"email":"delete@ory.sh"}`)
+
+		res := send(t, http.StatusOK, &Request{Operations: []Operation{
+			{Type: OperationCreate, Identity: newIdentityOp(`{"email":"create@ory.sh"}`)},
+			{Type: OperationCreate, Identity: newIdentityOp(`{"name":{"first":"Jane"}}`)},
+			{Type: OperationPatch, ID: patched, Traits: json.RawMessage(`{"name":{"first":"John","last":null}}`)},
+			{Type: OperationUpdate, ID: updated, Identity: newIdentityOp(`{"email":"updated@ory.sh"}`)},
+			{Type: OperationDelete, ID: deleted},
+			{Type: OperationDelete, ID: x.NewUUID()},
+			{Type: "suspend", ID: patched},
+		}})
+
+		assert.EqualValues(t, http.StatusCreated, res.Get("results.0.status_code").Int(), "%s", res)
+		assert.Equal(t, "create@ory.sh", res.Get("results.0.identity.traits.email").String(), "%s", res)
+		assert.EqualValues(t, http.StatusBadRequest, res.Get("results.1.status_code").Int(), "%s", res)
+		assert.True(t, res.Get("results.1.error").Exists(), "%s", res)
+		assert.EqualValues(t, http.StatusOK, res.Get("results.2.status_code").Int(), "%s", res)
+		assert.EqualValues(t, http.StatusOK, res.Get("results.3.status_code").Int(), "%s", res)
+		assert.EqualValues(t, http.StatusNoContent, res.Get("results.4.status_code").Int(), "%s", res)
+		assert.EqualValues(t, http.StatusNotFound, res.Get("results.5.status_code").Int(), "%s", res)
+		assert.EqualValues(t, http.StatusBadRequest, res.Get("results.6.status_code").Int(), "%s", res)
+
+		_, err := reg.IdentityPool().GetIdentity(context.Background(), x.ParseUUID(res.Get("results.0.identity.id").String()))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"email":"patch@ory.sh","name":{"first":"John"}}`, getTraits(t, patched))
+		assert.JSONEq(t, `{"email":"updated@ory.sh"}`, getTraits(t, updated))
+		_, err = reg.IdentityPool().GetIdentity(context.Background(), deleted)
+		require.Error(t, err)
+	})
+
+	t.Run("case=rolls back transactional batches", func(t *testing.T) {
+		id := newIdentity(t, `{"email":"transactional@ory.sh"}`)
+
+		res := send(t, http.StatusOK, &Request{Transactional: true, Operations: []Operation{
+			{Type: OperationPatch, ID: id, Traits: json.RawMessage(`{"email":"rolled-back@ory.sh"}`)},
+			{Type: OperationDelete, ID: x.NewUUID()},
+			{Type: OperationDelete, ID: id},
+		}})
+
+		assert.EqualValues(t, http.StatusFailedDependency, res.Get("results.0.status_code").Int(), "%s", res)
+		assert.EqualValues(t, http.StatusNotFound, res.Get("results.1.status_code").Int(), "%s", res)
+		assert.EqualValues(t, http.StatusFailedDependency, res.Get("results.2.status_code").Int(), "%s", res)
+		assert.JSONEq(t, `{"email":"transactional@ory.sh"}`, getTraits(t, id))
+	})
+
+	t.Run("case=applies operations with the same idempotency key once", func(t *testing.T) {
+		body := &Request{Operations: []Operation{
+			{Type: OperationCreate, Identity: newIdentityOp(`{"email":"idempotent@ory.sh"}`), IdempotencyKey: "create-idempotent"},
+		}}
+
+		first := send(t, http.StatusOK, body)
+		assert.EqualValues(t, http.StatusCreated, first.Get("results.0.status_code").Int(), "%s", first)
+		assert.False(t, first.Get("results.0.replayed").Bool(), "%s", first)
+
+		body.Operations[0].Identity = newIdentityOp(`{"email":"idempotent@ory.sh"}`)
+		second := send(t, http.StatusOK, body)
+		assert.EqualValues(t, http.StatusCreated, second.Get("results.0.status_code").Int(), "%s", second)
+		assert.True(t, second.Get("results.0.replayed").Bool(), "%s", second)
+		assert.Equal(t, first.Get("results.0.identity.id").String(), second.Get("results.0.identity.id").String())
+	})
+
+	t.Run("case=rejects invalid batches", func(t *testing.T) {
+		send(t, http.StatusBadRequest, &Request{})
+		send(t, http.StatusBadRequest, &Request{Operations: make([]Operation, MaxOperations+1)})
+		send(t, http.StatusBadRequest, map[string]interface{}{"operations": []interface{}{}, "unknown": true})
+	})
+}
@@ -0,0 +1,363 @@
+// Package bench drives synthetic load against the self-service flows of ORY Kratos. It reports latency
+// percentiles per scenario and, if the database connection pool can be observed, how saturated the pool was. It
+// is used by the kratos bench command to plan capacity and to compare persister changes.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/randx"
+
+	"github.com/ory/kratos/sdk"
+	"github.com/ory/kratos/stats"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// ScenarioLogin runs the browser login flow of the password strategy.
+	ScenarioLogin = "login"
+
+	// ScenarioRegistration runs the browser registration flow of the password strategy, creating a new identity
+	// every time.
+	ScenarioRegistration = "registration"
+
+	// ScenarioWhoami checks a session using the whoami endpoint.
+	ScenarioWhoami = "whoami"
+)
+
+// poolSampleInterval is how often the database connection pool is sampled while the benchmark runs.
+const poolSampleInterval = time.Millisecond * 100
+
+// Scenarios are all scenarios in the order they are reported.
+var Scenarios = []string{ScenarioLogin, ScenarioRegistration, ScenarioWhoami}
+
+type (
+	// Config configures a benchmark.
+	Config struct {
+		// PublicURL is the URL of the public API of the instance under test. It is required.
+		PublicURL string
+
+		// HTTPClient is used for all requests. It defaults to http.DefaultClient.
+		HTTPClient *http.Client
+
+		// Scenarios are run in turns by every worker. They default to all Scenarios.
+		Scenarios []string
+
+		// Concurrency is the number of workers. It defaults to 1.
+		Concurrency int
+
+		// Duration is how long load is generated, not including the setup of the workers.
+		Duration time.Duration
+
+		// IdentifierTrait is the trait which the password strategy uses as identifier, for example email. Its
+		// value is a unique email address.
+		IdentifierTrait string
+
+		// Traits are added to the traits of every registered identity, for example to satisfy required traits
+		// of the identity schema.
+		Traits map[string]interface{}
+
+		// Pool returns the statistics of the database connection pool of the instance under test. It is
+		// optional, the report does not cover the database without it.
+		Pool func(ctx context.Context) (*stats.Pool, error)
+	}
+
+	// Report is the result of a benchmark.
+	Report struct {
+		Duration    time.Duration     `json:"duration"`
+		Concurrency int               `json:"concurrency"`
+		Scenarios   []*ScenarioReport `json:"scenarios"`
+		Database    *DatabaseReport   `json:"database,omitempty"`
+	}
+
+	// ScenarioReport describes the latency of a scenario. Failed runs are counted as errors and not included
+	// in the latencies.
+	ScenarioReport struct {
+		Name       string        `json:"name"`
+		Runs       int           `json:"runs"`
+		Errors     int           `json:"errors"`
+		Throughput float64       `json:"throughput"`
+		P50        time.Duration `json:"p50"`
+		P90        time.Duration `json:"p90"`
+		P99        time.Duration `json:"p99"`
+		Max        time.Duration `json:"max"`
+
+		// FirstError is the first error which occurred, to give a hint why runs failed.
+		FirstError string `json:"first_error,omitempty"`
+
+		latencies []time.Duration
+	}
+
+	// DatabaseReport describes the database connection pool while the benchmark was running.
+	DatabaseReport struct {
+		MaxOpenConnections int `json:"max_open_connections"`
+		PeakInUse          int `json:"peak_in_use"`
+
+		// Saturation is the peak of connections in use relative to the maximum of open connections, from 0 to
+		// 1. It is 0 if the number of open connections is unlimited.
+		Saturation float64 `json:"saturation"`
+
+		// WaitCount and WaitDuration are how often and how long operations waited for a connection while the
+		// benchmark was running.
+		WaitCount    int64         `json:"wait_count"`
+		WaitDuration time.Duration `json:"wait_duration"`
+	}
+
+	// worker holds the identity and the session a worker logs in with and checks.
+	worker struct {
+		identifier string
+		password   string
+		session    *sdk.Client
+	}
+)
+
+// Run sets up one identity and session per worker and then runs the scenarios until the duration is over or
+// the context is done.
+func Run(ctx context.Context, c Config) (*Report, error) {
+	if c.Concurrency < 1 {
+		c.Concurrency = 1
+	}
+	if len(c.Scenarios) == 0 {
+		c.Scenarios = Scenarios
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	for _, s := range c.Scenarios {
+		if !isScenario(s) {
+			return nil, errors.Errorf("unknown scenario %s, expected one of %v", s, Scenarios)
+		}
+	}
+
+	client, err := sdk.New(sdk.Config{PublicURL: c.PublicURL, HTTPClient: c.HTTPClient})
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]*worker, c.Concurrency)
+	for k := range workers {
+		if workers[k], err = newWorker(ctx, c, client); err != nil {
+			return nil, errors.WithMessage(err, "unable to set up the benchmark")
+		}
+	}
+
+	var before *stats.Pool
+	if c.Pool != nil {
+		if before, err = c.Pool(ctx); err != nil {
+			return nil, errors.WithMessage(err, "unable to fetch the database connection pool statistics")
+		}
+	}
+
+	reports := map[string]*ScenarioReport{}
+	for _, s := range c.Scenarios {
+		reports[s] = &ScenarioReport{Name: s}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Duration)
+	defer cancel()
+
+	var peak int
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		if c.Pool == nil {
+			return
+		}
+		ticker := time.NewTicker(poolSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if p, err := c.Pool(ctx); err == nil && p.InUse > peak {
+					peak = p.InUse
+				}
+			}
+		}
+	}()
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	start := time.Now()
+	for k, w := range workers {
+		wg.Add(1)
+		go func(k int, w *worker) {
+			defer wg.Done()
+			// Workers start with different scenarios so that all scenarios run at the same time.
+			for i := k; ctx.Err() == nil; i++ {
+				s := c.Scenarios[i%len(c.Scenarios)]
+				began := time.Now()
+				err := w.run(ctx, c, client, s)
+				took := time.Since(began)
+
+				// Runs which were cut short by the end of the benchmark are not counted.
+				if ctx.Err() != nil {
+					return
+				}
+
+				mu.Lock()
+				reports[s].add(took, err)
+				mu.Unlock()
+			}
+		}(k, w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	<-sampled
+
+	r := &Report{Duration: elapsed, Concurrency: c.Concurrency}
+	for _, s := range Scenarios {
+		if sr, ok := reports[s]; ok {
+			sr.finish(elapsed)
+			r.Scenarios = append(r.Scenarios, sr)
+		}
+	}
+
+	if c.Pool != nil {
+		// The benchmark context is done, the pool is fetched once more using a fresh one.
+		after, err := c.Pool(context.Background())
+		if err != nil {
+			return nil, errors.WithMessage(err, "unable to fetch the database connection pool statistics")
+		}
+		r.Database = newDatabaseReport(before, after, peak)
+	}
+
+	return r, nil
+}
+
+func isScenario(s string) bool {
+	for _, known := range Scenarios {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// newWorker registers an identity and logs it in. The setup is not measured.
+func newWorker(ctx context.Context, c Config, client *sdk.Client) (*worker, error) {
+	w := &worker{password: randx.MustString(32, randx.AlphaNum)}
+
+	var err error
+	if w.identifier, err = register(ctx, c, client, w.password); err != nil {
+		return nil, err
+	}
+
+	_, cookies, err := client.LoginWithPassword(ctx, w.identifier, w.password)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to log in the benchmark identity")
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	u, err := url.ParseRequestURI(c.PublicURL)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	jar.SetCookies(u, cookies)
+
+	w.session, err = sdk.New(sdk.Config{
+		PublicURL:  c.PublicURL,
+		HTTPClient: &http.Client{Jar: jar, Transport: c.HTTPClient.Transport},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// register registers a new identity with a unique identifier and returns the identifier.
+func register(ctx context.Context, c Config, client *sdk.Client, password string) (string, error) {
+	identifier := fmt.Sprintf("bench-%s@example.org", x.NewUUID())
+	traits := map[string]interface{}{c.IdentifierTrait: identifier}
+	for key, value := range c.Traits {
+		if key != c.IdentifierTrait {
+			traits[key] = value
+		}
+	}
+
+	if _, _, err := client.RegisterWithPassword(ctx, traits, password); err != nil {
+		return "", errors.WithMessage(err, "unable to register the benchmark identity")
+	}
+	return identifier, nil
+}
+
+func (w *worker) run(ctx context.Context, c Config, client *sdk.Client, scenario string) error {
+	switch scenario {
+	case ScenarioLogin:
+		_, _, err := client.LoginWithPassword(ctx, w.identifier, w.password)
+		return err
+	case ScenarioRegistration:
+		_, err := register(ctx, c, client, randx.MustString(32, randx.AlphaNum))
+		return err
+	case ScenarioWhoami:
+		_, err := w.session.Whoami(ctx)
+		return err
+	}
+	return errors.Errorf("unknown scenario %s", scenario)
+}
+
+func (r *ScenarioReport) add(took time.Duration, err error) {
+	r.Runs++
+	if err != nil {
+		r.Errors++
+		if len(r.FirstError) == 0 {
+			r.FirstError = err.Error()
+		}
+		return
+	}
+	r.latencies = append(r.latencies, took)
+}
+
+func (r *ScenarioReport) finish(elapsed time.Duration) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	r.P50 = Percentile(r.latencies, 0.5)
+	r.P90 = Percentile(r.latencies, 0.9)
+	r.P99 = Percentile(r.latencies, 0.99)
+	r.Max = Percentile(r.latencies, 1)
+	if elapsed > 0 {
+		r.Throughput = float64(r.Runs-r.Errors) / elapsed.Seconds()
+	}
+}
+
+// Percentile returns the q-th quantile (from 0 to 1) of the sorted latencies using the nearest-rank method. It
+// returns 0 if there are no latencies.
+func Percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func newDatabaseReport(before, after *stats.Pool, peak int) *DatabaseReport {
+	r := &DatabaseReport{
+		MaxOpenConnections: after.MaxOpenConnections,
+		PeakInUse:          peak,
+		WaitCount:          after.WaitCount - before.WaitCount,
+		WaitDuration:       after.WaitDuration - before.WaitDuration,
+	}
+	if after.MaxOpenConnections > 0 {
+		r.Saturation = float64(peak) / float64(after.MaxOpenConnections)
+	}
+	return r
+}
@@ -0,0 +1,80 @@
+package bench_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/bench"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/x"
+)
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for k := range latencies {
+		latencies[k] = time.Duration(k+1) * time.Millisecond
+	}
+
+	assert.Equal(t, time.Duration(0), bench.Percentile(nil, 0.5))
+	assert.Equal(t, time.Millisecond, bench.Percentile(latencies, 0))
+	assert.Equal(t, 50*time.Millisecond, bench.Percentile(latencies, 0.5))
+	assert.Equal(t, 99*time.Millisecond, bench.Percentile(latencies, 0.99))
+	assert.Equal(t, 100*time.Millisecond, bench.Percentile(latencies, 1))
+}
+
+func TestRun(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	public := x.NewRouterPublic()
+	reg.LoginHandler().RegisterPublicRoutes(public)
+	reg.LoginStrategies().RegisterPublicRoutes(public)
+	reg.RegistrationHandler().RegisterPublicRoutes(public)
+	reg.RegistrationStrategies().RegisterPublicRoutes(public)
+	reg.SessionHandler().RegisterPublicRoutes(public)
+	ts := httptest.NewServer(public)
+	defer ts.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyURLsLogin, "http://ui.kratos.test/login")
+	viper.Set(configuration.ViperKeyURLsRegistration, "http://ui.kratos.test/registration")
+	viper.Set(configuration.ViperKeyURLsDefaultReturnTo, "http://ui.kratos.test/dashboard")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://../stub/test-identity.schema.json")
+	viper.Set(configuration.ViperKeySecretsSession, []string{"not-a-secure-session-key"})
+	viper.Set(configuration.ViperKeySelfServiceLoginAfterConfig+"."+string(identity.CredentialsTypePassword), []map[string]interface{}{{"job": "session"}})
+
+	t.Run("case=runs all scenarios", func(t *testing.T) {
+		r, err := bench.Run(context.Background(), bench.Config{
+			PublicURL:       ts.URL,
+			Concurrency:     2,
+			Duration:        time.Second,
+			IdentifierTrait: "username",
+			Traits:          map[string]interface{}{"foobar": "bar"},
+			Pool:            reg.StatsPersister().PoolStatistics,
+		})
+		require.NoError(t, err)
+
+		require.Len(t, r.Scenarios, len(bench.Scenarios))
+		for k, s := range r.Scenarios {
+			assert.Equal(t, bench.Scenarios[k], s.Name)
+			assert.True(t, s.Runs > 0, "%+v", s)
+			assert.Zero(t, s.Errors, "%+v", s)
+			assert.True(t, s.P50 > 0 && s.P50 <= s.P99 && s.P99 <= s.Max, "%+v", s)
+		}
+		require.NotNil(t, r.Database)
+		assert.True(t, r.Database.Saturation >= 0 && r.Database.Saturation <= 1, "%+v", r.Database)
+	})
+
+	t.Run("case=rejects unknown scenarios", func(t *testing.T) {
+		_, err := bench.Run(context.Background(), bench.Config{PublicURL: ts.URL, Scenarios: []string{"logout"}})
+		require.Error(t, err)
+	})
+}
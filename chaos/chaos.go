@@ -0,0 +1,39 @@
+// Package chaos injects latency and failures into persister calls and courier deliveries, so that operators can
+// verify in staging that their UIs and retries handle a degraded ORY Kratos gracefully. Faults are only injected
+// in development mode (--dev), see configuration key chaos.
+package chaos
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+// ErrInjected is returned by operations which failed on purpose.
+var ErrInjected = herodot.ErrInternalServerError.
+	WithReason("This failure was injected on purpose because chaos mode is enabled, see configuration key chaos.")
+
+// Inject delays the operation and fails it with the probabilities configured for the target. It returns
+// ErrInjected if the operation must fail, or the context's error if the context is done during the delay.
+func Inject(ctx context.Context, t configuration.ChaosTarget) error {
+	// #nosec G404 - fault injection does not need cryptographically secure random numbers
+	if t.Latency > 0 && rand.Float64() < t.LatencyProbability {
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(t.Latency):
+		}
+	}
+
+	// #nosec G404 - fault injection does not need cryptographically secure random numbers
+	if rand.Float64() < t.FailureProbability {
+		return errors.WithStack(ErrInjected)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package chaos_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/errorsx"
+
+	. "github.com/ory/kratos/chaos"
+	"github.com/ory/kratos/driver/configuration"
+)
+
+func TestInject(t *testing.T) {
+	t.Run("case=does nothing by default", func(t *testing.T) {
+		start := time.Now()
+		require.NoError(t, Inject(context.Background(), configuration.ChaosTarget{}))
+		assert.True(t, time.Since(start) < time.Millisecond*50)
+	})
+
+	t.Run("case=fails", func(t *testing.T) {
+		err := Inject(context.Background(), configuration.ChaosTarget{FailureProbability: 1})
+		assert.Equal(t, ErrInjected, errorsx.Cause(err))
+	})
+
+	t.Run("case=delays", func(t *testing.T) {
+		start := time.Now()
+		require.NoError(t, Inject(context.Background(), configuration.ChaosTarget{Latency: time.Millisecond * 100, LatencyProbability: 1}))
+		assert.True(t, time.Since(start) >= time.Millisecond*100)
+	})
+
+	t.Run("case=stops delaying when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		start := time.Now()
+		err := Inject(ctx, configuration.ChaosTarget{Latency: time.Minute, LatencyProbability: 1})
+		assert.Equal(t, context.DeadlineExceeded, errorsx.Cause(err))
+		assert.True(t, time.Since(start) < time.Second)
+	})
+}
@@ -0,0 +1,101 @@
+package cipher
+
+import (
+	"crypto/aes"
+	cryptocipher "crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	// Cipher encrypts and decrypts data which is stored in the database, for example the tokens of OpenID Connect
+	// providers.
+	Cipher interface {
+		// Encrypt returns the encrypted message, encoded as a hex string.
+		Encrypt(message []byte) (string, error)
+
+		// Decrypt returns the plaintext of a message which was encrypted by Encrypt.
+		Decrypt(ciphertext string) ([]byte, error)
+	}
+
+	Provider interface {
+		Cipher() Cipher
+	}
+
+	// AES encrypts data with AES-256 in GCM mode. The keys are derived from the configured cipher secrets.
+	AES struct {
+		c configuration.Provider
+	}
+)
+
+var _ Cipher = new(AES)
+
+func NewAES(c configuration.Provider) *AES {
+	return &AES{c: c}
+}
+
+func (a *AES) aead(secret []byte) (cryptocipher.AEAD, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := cryptocipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return aead, nil
+}
+
+func (a *AES) Encrypt(message []byte) (string, error) {
+	secrets := a.c.CipherSecrets()
+	if len(secrets) == 0 {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to encrypt data because no cipher secrets are configured."))
+	}
+
+	aead, err := a.aead(secrets[0])
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return hex.EncodeToString(aead.Seal(nonce, nonce, message, nil)), nil
+}
+
+func (a *AES) Decrypt(ciphertext string) ([]byte, error) {
+	raw, err := hex.DecodeString(ciphertext)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to decrypt data because it is not hex encoded.").WithDebug(err.Error()))
+	}
+
+	// Secrets are tried in order so that data encrypted before a secret was rotated can still be decrypted.
+	for _, secret := range a.c.CipherSecrets() {
+		aead, err := a.aead(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(raw) < aead.NonceSize() {
+			break
+		}
+
+		if plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to decrypt data with any of the configured cipher secrets."))
+}
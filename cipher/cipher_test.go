@@ -0,0 +1,58 @@
+package cipher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+)
+
+func TestAES(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	c := cipher.NewAES(conf)
+
+	t.Run("case=encrypt and decrypt", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySecretsCipher, []string{"secret-thirty-two-characters-abc"})
+
+		encrypted, err := c.Encrypt([]byte("access-token"))
+		require.NoError(t, err)
+		assert.NotContains(t, encrypted, "access-token")
+
+		other, err := c.Encrypt([]byte("access-token"))
+		require.NoError(t, err)
+		assert.NotEqual(t, encrypted, other, "the nonce must be random")
+
+		decrypted, err := c.Decrypt(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "access-token", string(decrypted))
+	})
+
+	t.Run("case=decrypt after rotating the secret", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySecretsCipher, []string{"old-secret-0123456789"})
+		encrypted, err := c.Encrypt([]byte("access-token"))
+		require.NoError(t, err)
+
+		viper.Set(configuration.ViperKeySecretsCipher, []string{"new-secret-0123456789", "old-secret-0123456789"})
+		decrypted, err := c.Decrypt(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "access-token", string(decrypted))
+
+		viper.Set(configuration.ViperKeySecretsCipher, []string{"new-secret-0123456789"})
+		_, err = c.Decrypt(encrypted)
+		require.Error(t, err)
+	})
+
+	t.Run("case=fail on malformed ciphertext", func(t *testing.T) {
+		_, err := c.Decrypt("not-hex")
+		require.Error(t, err)
+
+		_, err = c.Decrypt("abcd")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/ory/kratos/x"
+)
+
+// MetricsPath serves the leadership metrics of the background jobs on the admin API.
+const MetricsPath = "/metrics/cluster"
+
+var (
+	// LeadershipChanges counts per background job how often this instance started or stopped running it.
+	LeadershipChanges = expvar.NewMap("kratos_cluster_leadership_changes_total")
+
+	// Leading is 1 for the background jobs this instance runs and 0 for all others.
+	Leading = expvar.NewMap("kratos_cluster_leading")
+)
+
+type (
+	electorDependencies interface {
+		PersistenceProvider
+		x.LoggingProvider
+	}
+	ElectorProvider interface {
+		ClusterElector() *Elector
+	}
+
+	// Elector makes sure that each background job runs on one instance at a time when several instances share
+	// the database. The instance which holds the lock of a job in the database leads the job. The lock expires
+	// unless it is renewed, so another instance takes over if the leader stops.
+	Elector struct {
+		r      electorDependencies
+		holder string
+
+		mu      sync.Mutex
+		leading map[string]bool
+	}
+)
+
+func NewElector(r electorDependencies) *Elector {
+	hostname, _ := os.Hostname()
+	return &Elector{
+		r:       r,
+		holder:  fmt.Sprintf("%s/%s", hostname, x.NewUUID()),
+		leading: map[string]bool{},
+	}
+}
+
+// Lead acquires or renews the lock of the job and returns true if this instance runs the job. It must be
+// called again before ttl has passed, otherwise another instance may take over.
+func (e *Elector) Lead(ctx context.Context, job string, ttl time.Duration) bool {
+	leading, err := e.r.ClusterPersister().AcquireLock(ctx, job, e.holder, ttl)
+	if err != nil {
+		e.r.Logger().WithError(err).WithField("job", job).Error("Unable to acquire the lock of the background job.")
+		leading = false
+	}
+
+	e.set(job, leading)
+	return leading
+}
+
+// Resign releases the lock of the job, so that another instance takes over without waiting for the lock to
+// expire.
+func (e *Elector) Resign(ctx context.Context, job string) error {
+	e.set(job, false)
+	return e.r.ClusterPersister().ReleaseLock(ctx, job, e.holder)
+}
+
+func (e *Elector) set(job string, leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	value := new(expvar.Int)
+	if leading {
+		value.Set(1)
+	}
+	Leading.Set(job, value)
+
+	if e.leading[job] == leading {
+		return
+	}
+	e.leading[job] = leading
+	LeadershipChanges.Add(job, 1)
+
+	l := e.r.Logger().WithField("job", job).WithField("holder", e.holder)
+	if leading {
+		l.Info("This instance now runs the background job.")
+	} else {
+		l.Info("This instance no longer runs the background job.")
+	}
+}
+
+// ServeMetrics writes the leadership metrics of the background jobs.
+func ServeMetrics(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprintf(w, `{"leadership_changes_total":%s,"leading":%s}`, LeadershipChanges.String(), Leading.String())
+}
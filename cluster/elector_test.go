@@ -0,0 +1,38 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/kratos/cluster"
+	"github.com/ory/kratos/internal"
+)
+
+func TestElector(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	first := NewElector(reg)
+	second := NewElector(reg)
+
+	changes := func() int64 {
+		if v, ok := LeadershipChanges.Get("test-job").(interface{ Value() int64 }); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := changes()
+
+	assert.True(t, first.Lead(context.Background(), "test-job", time.Minute))
+	assert.False(t, second.Lead(context.Background(), "test-job", time.Minute))
+	assert.True(t, first.Lead(context.Background(), "test-job", time.Minute))
+
+	require.NoError(t, first.Resign(context.Background(), "test-job"))
+	assert.True(t, second.Lead(context.Background(), "test-job", time.Minute))
+	assert.False(t, first.Lead(context.Background(), "test-job", time.Minute))
+
+	// The first instance started and stopped leading, the second started leading.
+	assert.EqualValues(t, before+3, changes())
+}
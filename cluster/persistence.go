@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	PersistenceProvider interface {
+		ClusterPersister() Persister
+	}
+	Persister interface {
+		// AcquireLock acquires the lock with the given name for the holder, or renews it if the holder has it
+		// already. The lock expires after ttl unless it is renewed. It returns false if another holder has the lock.
+		AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+
+		// ReleaseLock releases the lock with the given name if the holder has it.
+		ReleaseLock(ctx context.Context, name, holder string) error
+	}
+)
+
+func TestPersister(p Persister) func(t *testing.T) {
+	acquire := func(t *testing.T, name, holder string, ttl time.Duration) bool {
+		acquired, err := p.AcquireLock(context.Background(), name, holder, ttl)
+		require.NoError(t, err)
+		return acquired
+	}
+
+	return func(t *testing.T) {
+		t.Run("case=grants a lock to one holder at a time", func(t *testing.T) {
+			assert.True(t, acquire(t, "courier", "instance-1", time.Minute))
+			assert.False(t, acquire(t, "courier", "instance-2", time.Minute))
+			assert.True(t, acquire(t, "courier", "instance-1", time.Minute), "the holder renews the lock")
+			assert.True(t, acquire(t, "cleanup", "instance-2", time.Minute), "locks are per name")
+		})
+
+		t.Run("case=takes over expired locks", func(t *testing.T) {
+			assert.True(t, acquire(t, "scheduler", "instance-1", -time.Second))
+			assert.True(t, acquire(t, "scheduler", "instance-2", time.Minute))
+			assert.False(t, acquire(t, "scheduler", "instance-1", time.Minute))
+		})
+
+		t.Run("case=releases locks", func(t *testing.T) {
+			require.NoError(t, p.ReleaseLock(context.Background(), "courier", "instance-2"))
+			assert.False(t, acquire(t, "courier", "instance-2", time.Minute), "only the holder releases the lock")
+
+			require.NoError(t, p.ReleaseLock(context.Background(), "courier", "instance-1"))
+			assert.True(t, acquire(t, "courier", "instance-2", time.Minute))
+		})
+	}
+}
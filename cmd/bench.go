@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ory/x/viperx"
+
+	"github.com/ory/kratos/bench"
+	"github.com/ory/kratos/cmd/client"
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Generate login, registration, and whoami load and report latencies",
+	Long: `Generates synthetic load using the browser flows of the password strategy and reports the latency
+percentiles of every scenario. Every worker registers and logs in an identity first, which is not measured, and
+then runs the scenarios in turns. The login flow must issue sessions, so the session hook must be configured
+as login hook of the password strategy.
+
+The load is generated against the public URL set with --endpoint. If --admin-endpoint is set, the database
+connection pool is observed using the admin API as well, to see whether the pool is saturated. Alternatively,
+--in-process starts an instance using the configuration file and environment of this command and observes its
+pool directly.
+
+Every run creates identities, don't run this command against a production instance.`,
+	Example: `kratos bench --endpoint http://127.0.0.1:4433/ --admin-endpoint http://127.0.0.1:4434/ --concurrency 16 --duration 1m
+kratos bench --in-process --apply-migrations --config kratos.yml --scenarios login,whoami --format json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger = viperx.InitializeConfig("kratos", "", logger)
+		client.NewBenchHandler().Run(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().String("endpoint", "", "The public URL of ORY Kratos. Defaults to KRATOS_URLS_PUBLIC")
+	benchCmd.Flags().String("admin-endpoint", "", "The admin URL of ORY Kratos, used to observe the database connection pool")
+	benchCmd.Flags().Bool("in-process", false, "Start an instance in this process instead of using --endpoint")
+	benchCmd.Flags().Bool("apply-migrations", false, "Apply the SQL migrations before starting the instance, requires --in-process")
+	benchCmd.Flags().Bool("dev", false, "Start the instance in dev mode, requires --in-process")
+	benchCmd.Flags().StringSlice("scenarios", bench.Scenarios, "The scenarios which are run in turns")
+	benchCmd.Flags().Int("concurrency", 4, "The number of workers")
+	benchCmd.Flags().Duration("duration", 30*time.Second, "How long to generate load")
+	benchCmd.Flags().String("identifier-trait", "email", "The trait the password strategy uses as identifier, it is set to a unique email address")
+	benchCmd.Flags().String("traits", "", "Further traits of the registered identities as JSON object, for example to set required traits")
+	benchCmd.Flags().String("format", client.FormatTable, "Set the output format to \"table\" or \"json\"")
+}
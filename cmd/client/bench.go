@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/cmdx"
+	"github.com/ory/x/flagx"
+	"github.com/ory/x/logrusx"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/bench"
+	"github.com/ory/kratos/cmd/daemon"
+	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/stats"
+)
+
+const envKeyPublicEndpoint = "KRATOS_URLS_PUBLIC"
+
+type BenchHandler struct{}
+
+func NewBenchHandler() *BenchHandler {
+	return &BenchHandler{}
+}
+
+// Run generates load against the instance at --endpoint, or against an instance started in this process if
+// --in-process is set, and prints the report.
+func (h *BenchHandler) Run(cmd *cobra.Command, args []string) {
+	cmdx.ExactArgs(cmd, args, 0)
+	format := outputFormat(cmd)
+
+	var traits map[string]interface{}
+	if t := flagx.MustGetString(cmd, "traits"); len(t) > 0 {
+		err := json.Unmarshal([]byte(t), &traits)
+		cmdx.Must(err, "Unable to decode the traits set with --traits: %s", err)
+	}
+
+	scenarios, err := cmd.Flags().GetStringSlice("scenarios")
+	cmdx.Must(err, "Unable to read flag --scenarios: %s", err)
+	duration, err := cmd.Flags().GetDuration("duration")
+	cmdx.Must(err, "Unable to read flag --duration: %s", err)
+
+	c := bench.Config{
+		Scenarios:       scenarios,
+		Concurrency:     flagx.MustGetInt(cmd, "concurrency"),
+		Duration:        duration,
+		IdentifierTrait: flagx.MustGetString(cmd, "identifier-trait"),
+		Traits:          traits,
+	}
+
+	if flagx.MustGetBool(cmd, "in-process") {
+		d, stop := h.serve(cmd)
+		defer stop()
+		c.PublicURL = d.Configuration().SelfPublicURL().String()
+		c.Pool = d.Registry().StatsPersister().PoolStatistics
+	} else {
+		c.PublicURL = flagx.MustGetString(cmd, "endpoint")
+		if c.PublicURL == "" {
+			c.PublicURL = os.Getenv(envKeyPublicEndpoint)
+		}
+		if c.PublicURL == "" {
+			fmt.Fprintf(os.Stderr, "Set the public URL of ORY Kratos using flag --endpoint or environment variable %s, or use --in-process.\n", envKeyPublicEndpoint)
+			os.Exit(1)
+		}
+		if admin := flagx.MustGetString(cmd, "admin-endpoint"); len(admin) > 0 {
+			c.Pool = remotePool(urlx.AppendPaths(urlx.ParseOrPanic(admin), stats.DatabaseMetricsPath).String())
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Running %v with %d workers for %s against %s.\n", c.Scenarios, c.Concurrency, c.Duration, c.PublicURL)
+	r, err := bench.Run(context.Background(), c)
+	cmdx.Must(err, "Unable to run the benchmark: %s", err)
+
+	printBenchReport(cmd.OutOrStdout(), format, r)
+}
+
+// serve starts an instance using the configuration of this process. The public and admin API listen on random
+// local ports.
+func (h *BenchHandler) serve(cmd *cobra.Command) (driver.Driver, func()) {
+	public, err := net.Listen("tcp", "127.0.0.1:0")
+	cmdx.Must(err, "Unable to listen for the public API: %s", err)
+	admin, err := net.Listen("tcp", "127.0.0.1:0")
+	cmdx.Must(err, "Unable to listen for the admin API: %s", err)
+
+	viper.Set(configuration.ViperKeyURLsSelfPublic, "http://"+public.Addr().String()+"/")
+	viper.Set(configuration.ViperKeyURLsSelfAdmin, "http://"+admin.Addr().String()+"/")
+
+	d := driver.MustNewDefaultDriver(logrusx.New(), "", "", "", flagx.MustGetBool(cmd, "dev"))
+	if flagx.MustGetBool(cmd, "apply-migrations") {
+		err := d.Registry().Persister().MigrateUp(context.Background())
+		cmdx.Must(err, "Unable to apply the SQL migrations: %s", err)
+	}
+
+	servers := []*http.Server{{Handler: daemon.NewPublicHandler(d)}, {Handler: daemon.NewAdminHandler(d)}}
+	for k, l := range []net.Listener{public, admin} {
+		go func(s *http.Server, l net.Listener) {
+			if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+				d.Logger().WithError(err).Fatal("Unable to serve the in-process instance.")
+			}
+		}(servers[k], l)
+	}
+
+	return d, func() {
+		for _, s := range servers {
+			_ = s.Shutdown(context.Background())
+		}
+		_ = d.Registry().Persister().Close(context.Background())
+	}
+}
+
+// remotePool fetches the database connection pool statistics from the admin API.
+func remotePool(endpoint string) func(ctx context.Context) (*stats.Pool, error) {
+	return func(ctx context.Context) (*stats.Pool, error) {
+		req, err := http.NewRequest("GET", endpoint, nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("expected status code %d from %s but got %d", http.StatusOK, endpoint, res.StatusCode)
+		}
+
+		var p stats.Pool
+		if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &p, nil
+	}
+}
+
+func printBenchReport(w io.Writer, format string, r *bench.Report) {
+	if format == FormatJSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		err := e.Encode(r)
+		cmdx.Must(err, "Unable to encode the report: %s", err)
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCENARIO\tRUNS\tERRORS\tRUNS/S\tP50\tP90\tP99\tMAX")
+	for _, s := range r.Scenarios {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\n", s.Name, s.Runs, s.Errors, s.Throughput, s.P50, s.P90, s.P99, s.Max)
+	}
+	_ = tw.Flush()
+
+	for _, s := range r.Scenarios {
+		if len(s.FirstError) > 0 {
+			fmt.Fprintf(w, "\nFirst error of %s: %s\n", s.Name, s.FirstError)
+		}
+	}
+
+	if db := r.Database; db != nil {
+		maxOpen := "unlimited"
+		if db.MaxOpenConnections > 0 {
+			maxOpen = fmt.Sprintf("%d", db.MaxOpenConnections)
+		}
+		fmt.Fprintf(w, "\nDatabase connections: %d in use at peak, %s at most (%.0f%% saturated)\n", db.PeakInUse, maxOpen, db.Saturation*100)
+		fmt.Fprintf(w, "Waited for a connection: %d times, %s in total\n", db.WaitCount, db.WaitDuration)
+	}
+}
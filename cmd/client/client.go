@@ -1,28 +1,70 @@
 package client
 
-// import (
-// 	"net/url"
-//
-// 	"github.com/spf13/cobra"
-//
-// 	"github.com/ory/viper"
-//
-// 	"github.com/ory/kratos/internal/httpclient/client"
-// 	"github.com/ory/x/cmdx"
-// 	"github.com/ory/x/flagx"
-// )
-//
-// func c(cmd *cobra.Command, key string) *client.OryKratos {
-// 	e := flagx.MustGetString(cmd, key)
-// 	if e == "" {
-// 		e = viper.GetString("kratos.urls.admin")
-// 	}
-// 	u, err := url.ParseRequestURI(e)
-// 	cmdx.Must(err, `Unable to parse endpoint URL "%s": %s`, e, err)
-//
-// 	return client.NewHTTPClientWithConfig(nil, &client.TransportConfig{
-// 		Host:     u.Host,
-// 		BasePath: u.Path,
-// 		Schemes:  []string{u.Scheme},
-// 	})
-// }
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ory/x/cmdx"
+	"github.com/ory/x/flagx"
+
+	"github.com/ory/kratos/internal/httpclient/client"
+	"github.com/ory/kratos/internal/httpclient/models"
+)
+
+const envKeyEndpoint = "KRATOS_URLS_ADMIN"
+
+// endpoint returns the admin URL set using the flag named key or the environment variable KRATOS_URLS_ADMIN.
+func endpoint(cmd *cobra.Command, key string) *url.URL {
+	e := flagx.MustGetString(cmd, key)
+	if e == "" {
+		e = os.Getenv(envKeyEndpoint)
+	}
+	if e == "" {
+		fmt.Fprintf(os.Stderr, "Set the admin URL of ORY Kratos using flag --%s or environment variable %s.\n", key, envKeyEndpoint)
+		os.Exit(1)
+	}
+
+	u, err := url.ParseRequestURI(e)
+	cmdx.Must(err, `Unable to parse endpoint URL "%s": %s`, e, err)
+	return u
+}
+
+func c(cmd *cobra.Command, key string) *client.OryKratos {
+	u := endpoint(cmd, key)
+
+	basePath := u.Path
+	if len(basePath) == 0 {
+		basePath = "/"
+	}
+	return client.NewHTTPClientWithConfig(nil, &client.TransportConfig{
+		Host:     u.Host,
+		BasePath: basePath,
+		Schemes:  []string{u.Scheme},
+	})
+}
+
+// errorMessage returns the error message of the API error response if err contains one.
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	if e, ok := err.(interface{ GetPayload() *models.GenericError }); ok {
+		if m := genericErrorMessage(e.GetPayload()); len(m) > 0 {
+			return m
+		}
+	}
+	return err.Error()
+}
+
+func genericErrorMessage(e *models.GenericError) string {
+	if e == nil || e.Error == nil {
+		return ""
+	}
+	if len(e.Error.Reason) > 0 {
+		return fmt.Sprintf("%s: %s", e.Error.Message, e.Error.Reason)
+	}
+	return e.Error.Message
+}
@@ -1,9 +1,33 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gofrs/uuid"
 	"github.com/spf13/cobra"
 
 	"github.com/ory/x/cmdx"
+	"github.com/ory/x/flagx"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal/httpclient/client/admin"
+	"github.com/ory/kratos/internal/httpclient/models"
+	"github.com/ory/kratos/selfservice/flow/recovery"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatTable = "table"
 )
 
 type IdentityClient struct{}
@@ -12,33 +36,353 @@ func NewIdentityClient() *IdentityClient {
 	return new(IdentityClient)
 }
 
+// Import creates the identities read from the files in args. A file contains a JSON array of identities, a single
+// identity, or a stream of identities, and "-" reads from stdin. The output of `kratos identities list --format json`
+// can be imported as-is, IDs and traits schema URLs are assigned by ORY Kratos.
 func (ic *IdentityClient) Import(cmd *cobra.Command, args []string) {
 	cmdx.MinArgs(cmd, args, 1)
-	//
-	// for _, p := range args {
-	// 	var is []models.Identity
-	// 	f, err := os.Open(p)
-	// 	cmdx.Must(err, "Unable to open file %s: %s", p, err)
-	// 	d := json.NewDecoder(f)
-	// 	d.DisallowUnknownFields()
-	// 	err = d.Decode(&is)
-	// 	cmdx.Must(err, "Unable to decode file %s to JSON: %s", p, err)
-	//
-	// 	for _, i := range is {
-	// 		_, err := c(cmd, "endpoint").Admin.UpsertIdentity(
-	// 			admin.NewUpsertIdentityParams().WithBody(&i),
-	// 		)
-	// 		cmdx.Must(err, "Unable to import identity: %s", err)
-	// 	}
-	// }
+	format := outputFormat(cmd)
+
+	var imported []*models.Identity
+	var failed int
+	for _, p := range args {
+		is, err := readIdentities(cmd, p)
+		cmdx.Must(err, "Unable to read identities from %s: %s", p, err)
+
+		for k, i := range is {
+			res, err := c(cmd, "endpoint").Admin.CreateIdentity(admin.NewCreateIdentityParams().WithBody(&models.Identity{
+				Traits:         i.Traits,
+				TraitsSchemaID: i.TraitsSchemaID,
+			}))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to import identity #%d from %s: %s\n", k+1, p, errorMessage(err))
+				failed++
+				continue
+			}
+			imported = append(imported, res.Payload)
+		}
+	}
+
+	printIdentities(cmd.OutOrStdout(), format, imported, false)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Imported %d identities, %d failed.\n", len(imported), failed)
+		os.Exit(1)
+	}
 }
 
+// List prints a page of identities, or the identity using the identifier set with --identifier.
 func (ic *IdentityClient) List(cmd *cobra.Command, args []string) {
-	cmdx.ExactArgs(cmd, args, 2)
-	//ic.c.Admin
+	cmdx.ExactArgs(cmd, args, 0)
+	format := outputFormat(cmd)
+
+	limit, offset := int64(flagx.MustGetInt(cmd, "limit")), int64(flagx.MustGetInt(cmd, "offset"))
+	params := admin.NewListIdentitiesParams().WithLimit(&limit).WithOffset(&offset)
+	if identifier := flagx.MustGetString(cmd, "identifier"); len(identifier) > 0 {
+		params = params.WithIdentifier(&identifier)
+	}
 
+	res, err := c(cmd, "endpoint").Admin.ListIdentities(params)
+	cmdx.Must(err, "Unable to list identities: %s", errorMessage(err))
+
+	printIdentities(cmd.OutOrStdout(), format, res.Payload, false)
 }
 
+// Get prints the identities with the IDs in args.
 func (ic *IdentityClient) Get(cmd *cobra.Command, args []string) {
+	cmdx.MinArgs(cmd, args, 1)
+	format := outputFormat(cmd)
+
+	is := make([]*models.Identity, 0, len(args))
+	for _, id := range args {
+		res, err := c(cmd, "endpoint").Admin.GetIdentity(admin.NewGetIdentityParams().WithID(id))
+		cmdx.Must(err, "Unable to get identity %s: %s", id, errorMessage(err))
+		is = append(is, res.Payload)
+	}
+
+	printIdentities(cmd.OutOrStdout(), format, is, len(args) == 1)
+}
+
+// Delete deletes the identities with the IDs in args and prints the IDs of the deleted identities.
+func (ic *IdentityClient) Delete(cmd *cobra.Command, args []string) {
+	cmdx.MinArgs(cmd, args, 1)
+
+	var failed int
+	for _, id := range args {
+		if _, err := c(cmd, "endpoint").Admin.DeleteIdentity(admin.NewDeleteIdentityParams().WithID(id)); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to delete identity %s: %s\n", id, errorMessage(err))
+			failed++
+			continue
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), id)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// Patch applies the JSON merge patch (RFC 7386) read from the file in args[1], or stdin if it is "-", to the
+// identity with the ID in args[0] and prints the updated identity.
+func (ic *IdentityClient) Patch(cmd *cobra.Command, args []string) {
+	cmdx.ExactArgs(cmd, args, 2)
+	format := outputFormat(cmd)
+	id, source := args[0], args[1]
+
+	raw, err := readAll(cmd, source)
+	cmdx.Must(err, "Unable to read patch from %s: %s", source, err)
+
+	var patch interface{}
+	err = json.Unmarshal(raw, &patch)
+	cmdx.Must(err, "Unable to decode patch from %s to JSON: %s", source, err)
+
+	res, err := c(cmd, "endpoint").Admin.GetIdentity(admin.NewGetIdentityParams().WithID(id))
+	cmdx.Must(err, "Unable to get identity %s: %s", id, errorMessage(err))
+
+	i, err := patchIdentity(res.Payload, patch)
+	cmdx.Must(err, "Unable to apply patch to identity %s: %s", id, err)
+
+	updated, err := c(cmd, "endpoint").Admin.UpdateIdentity(admin.NewUpdateIdentityParams().WithID(id).WithBody(i))
+	cmdx.Must(err, "Unable to update identity %s: %s", id, errorMessage(err))
+
+	printIdentities(cmd.OutOrStdout(), format, []*models.Identity{updated.Payload}, true)
+}
+
+// VerifyAddress marks the address set with --address of the identity with the ID in args[0] as verified and prints
+// the identity.
+func (ic *IdentityClient) VerifyAddress(cmd *cobra.Command, args []string) {
+	cmdx.ExactArgs(cmd, args, 1)
+	format := outputFormat(cmd)
+	id, address := args[0], flagx.MustGetString(cmd, "address")
+	if len(address) == 0 {
+		fmt.Fprintln(os.Stderr, "Flag --address must be set.")
+		os.Exit(1)
+	}
+
+	body, err := json.Marshal(&identity.VerifyAddressPayload{
+		Via:   identity.VerifiableAddressType(flagx.MustGetString(cmd, "via")),
+		Value: address,
+	})
+	cmdx.Must(err, "Unable to encode request to JSON: %s", err)
+
+	req, err := http.NewRequest("PUT", urlx.AppendPaths(endpoint(cmd, "endpoint"), identity.IdentitiesPath, id, "addresses", "verify").String(), bytes.NewReader(body))
+	cmdx.Must(err, "Unable to create request: %s", err)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	cmdx.Must(err, "Unable to verify address %s of identity %s: %s", address, id, err)
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var e models.GenericError
+		message := fmt.Sprintf("the server responded with status code %d", res.StatusCode)
+		if err := json.NewDecoder(res.Body).Decode(&e); err == nil && e.Error != nil {
+			message = genericErrorMessage(&e)
+		}
+		fmt.Fprintf(os.Stderr, "Unable to verify address %s of identity %s: %s\n", address, id, message)
+		os.Exit(1)
+	}
+
+	var i models.Identity
+	err = json.NewDecoder(res.Body).Decode(&i)
+	cmdx.Must(err, "Unable to decode response to JSON: %s", err)
+
+	printIdentities(cmd.OutOrStdout(), format, []*models.Identity{&i}, true)
+}
+
+// Recover issues a recovery link for the identity with the ID in args[0] and prints it. The link is not sent to the
+// identity.
+func (ic *IdentityClient) Recover(cmd *cobra.Command, args []string) {
+	cmdx.ExactArgs(cmd, args, 1)
+	format := outputFormat(cmd)
+	id, err := uuid.FromString(args[0])
+	cmdx.Must(err, "Unable to parse identity ID %s: %s", args[0], err)
+
+	body, err := json.Marshal(&recovery.CreateRecoveryLink{IdentityID: id})
+	cmdx.Must(err, "Unable to encode request to JSON: %s", err)
+
+	res, err := http.Post(urlx.AppendPaths(endpoint(cmd, "endpoint"), recovery.AdminRecoveryLinksPath).String(), "application/json", bytes.NewReader(body))
+	cmdx.Must(err, "Unable to create a recovery link for identity %s: %s", id, err)
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var e models.GenericError
+		message := fmt.Sprintf("the server responded with status code %d", res.StatusCode)
+		if err := json.NewDecoder(res.Body).Decode(&e); err == nil && e.Error != nil {
+			message = genericErrorMessage(&e)
+		}
+		fmt.Fprintf(os.Stderr, "Unable to create a recovery link for identity %s: %s\n", id, message)
+		os.Exit(1)
+	}
+
+	var l recovery.RecoveryLink
+	err = json.NewDecoder(res.Body).Decode(&l)
+	cmdx.Must(err, "Unable to decode response to JSON: %s", err)
+
+	printRecoveryLink(cmd.OutOrStdout(), format, &l)
+}
+
+func outputFormat(cmd *cobra.Command) string {
+	format := flagx.MustGetString(cmd, "format")
+	if format != FormatJSON && format != FormatTable {
+		fmt.Fprintf(os.Stderr, "Flag --format must be one of %s or %s but got: %s\n", FormatJSON, FormatTable, format)
+		os.Exit(1)
+	}
+	return format
+}
+
+func readAll(cmd *cobra.Command, source string) ([]byte, error) {
+	if source == "-" {
+		return ioutil.ReadAll(cmd.InOrStdin())
+	}
+	return ioutil.ReadFile(source)
+}
+
+func readIdentities(cmd *cobra.Command, source string) ([]*models.Identity, error) {
+	raw, err := readAll(cmd, source)
+	if err != nil {
+		return nil, err
+	}
+	return decodeIdentities(bytes.NewReader(raw))
+}
+
+// decodeIdentities decodes a stream of JSON values which are either a single identity or an array of identities.
+func decodeIdentities(r io.Reader) ([]*models.Identity, error) {
+	var is []*models.Identity
+	d := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := d.Decode(&raw); err == io.EOF {
+			return is, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if raw[0] == '[' {
+			var page []*models.Identity
+			if err := decodeStrict(raw, &page); err != nil {
+				return nil, err
+			}
+			is = append(is, page...)
+			continue
+		}
+
+		var i models.Identity
+		if err := decodeStrict(raw, &i); err != nil {
+			return nil, err
+		}
+		is = append(is, &i)
+	}
+}
+
+func decodeStrict(raw []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+func patchIdentity(i *models.Identity, patch interface{}) (*models.Identity, error) {
+	raw, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	raw, err = json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return nil, err
+	}
+
+	var patched models.Identity
+	if err := decodeStrict(raw, &patched); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// mergePatch applies a JSON merge patch as defined in RFC 7386 to target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// printIdentities prints the identities as a table or as JSON. If single is true, JSON output is an object instead
+// of an array.
+func printIdentities(w io.Writer, format string, is []*models.Identity, single bool) {
+	if format == FormatJSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+
+		var err error
+		if single && len(is) == 1 {
+			err = e.Encode(is[0])
+		} else {
+			if is == nil {
+				is = []*models.Identity{}
+			}
+			err = e.Encode(is)
+		}
+		cmdx.Must(err, "Unable to encode identities to JSON: %s", err)
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTRAITS SCHEMA\tADDRESSES")
+	for _, i := range is {
+		var schema string
+		if i.TraitsSchemaID != nil {
+			schema = *i.TraitsSchemaID
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", i.ID, schema, formatAddresses(i.Addresses))
+	}
+	_ = tw.Flush()
+}
+
+// printRecoveryLink prints the recovery link and its expiry, or the link as JSON.
+func printRecoveryLink(w io.Writer, format string, l *recovery.RecoveryLink) {
+	if format == FormatJSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		err := e.Encode(l)
+		cmdx.Must(err, "Unable to encode recovery link to JSON: %s", err)
+		return
+	}
+
+	fmt.Fprintln(w, l.RecoveryURL)
+	fmt.Fprintf(w, "Expires at %s\n", l.ExpiresAt.Format(time.RFC3339))
+}
+
+func formatAddresses(as []*models.VerifiableAddress) string {
+	vs := make([]string, 0, len(as))
+	for _, a := range as {
+		if a == nil || a.Value == nil {
+			continue
+		}
 
+		v := *a.Value
+		if a.Verified == nil || !*a.Verified {
+			v += " (unverified)"
+		}
+		vs = append(vs, v)
+	}
+	return strings.Join(vs, ", ")
 }
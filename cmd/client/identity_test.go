@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/kratos/internal/httpclient/models"
+	"github.com/ory/kratos/selfservice/flow/recovery"
+	"github.com/ory/kratos/x"
+)
+
+func TestDecodeIdentities(t *testing.T) {
+	is, err := decodeIdentities(strings.NewReader(`[{"traits":{"email":"foo@ory.sh"}},{"traits":{"email":"bar@ory.sh"}}]
+{"traits":{"email":"baz@ory.sh"},"traits_schema_id":"customer"}`))
+	require.NoError(t, err)
+	require.Len(t, is, 3)
+	assert.Equal(t, "customer", *is[2].TraitsSchemaID)
+	assert.Equal(t, map[string]interface{}{"email": "bar@ory.sh"}, is[1].Traits)
+
+	_, err = decodeIdentities(strings.NewReader(`{"traits":{},"credentials":{}}`))
+	require.Error(t, err)
+
+	is, err = decodeIdentities(strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Empty(t, is)
+}
+
+func TestPatchIdentity(t *testing.T) {
+	schema := "default"
+	i := &models.Identity{
+		TraitsSchemaID: &schema,
+		Traits:         map[string]interface{}{"email": "foo@ory.sh", "name": map[string]interface{}{"first": "Foo", "last": "Bar"}},
+	}
+
+	var patch interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"traits":{"email":null,"name":{"last":"Baz"}},"traits_schema_id":"customer"}`), &patch))
+
+	patched, err := patchIdentity(i, patch)
+	require.NoError(t, err)
+	assert.Equal(t, "customer", *patched.TraitsSchemaID)
+	assert.Equal(t, map[string]interface{}{"name": map[string]interface{}{"first": "Foo", "last": "Baz"}}, patched.Traits)
+}
+
+func TestPrintIdentities(t *testing.T) {
+	schema, value, verified := "customer", "foo@ory.sh", false
+	is := []*models.Identity{{TraitsSchemaID: &schema, Addresses: []*models.VerifiableAddress{{Value: &value, Verified: &verified}}}}
+
+	var b bytes.Buffer
+	printIdentities(&b, FormatTable, is, false)
+	assert.Contains(t, b.String(), "customer")
+	assert.Contains(t, b.String(), "foo@ory.sh (unverified)")
+
+	b.Reset()
+	printIdentities(&b, FormatJSON, nil, false)
+	assert.Equal(t, "[]\n", b.String())
+
+	b.Reset()
+	printIdentities(&b, FormatJSON, is, true)
+	assert.True(t, strings.HasPrefix(b.String(), "{"), b.String())
+}
+
+func TestRecover(t *testing.T) {
+	id := x.NewUUID()
+	expiresAt := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, recovery.AdminRecoveryLinksPath, r.URL.Path)
+
+		var body recovery.CreateRecoveryLink
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, id, body.IdentityID)
+
+		require.NoError(t, json.NewEncoder(w).Encode(&recovery.RecoveryLink{
+			RecoveryURL: "https://kratos.ory.sh/self-service/browser/flows/recovery/manual/confirm/token",
+			ExpiresAt:   expiresAt,
+		}))
+	}))
+	defer ts.Close()
+
+	for _, format := range []string{FormatTable, FormatJSON} {
+		t.Run("format="+format, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("endpoint", ts.URL, "")
+			cmd.Flags().String("format", format, "")
+
+			var b bytes.Buffer
+			cmd.SetOut(&b)
+			NewIdentityClient().Recover(cmd, []string{id.String()})
+
+			if format == FormatJSON {
+				assert.Equal(t, "https://kratos.ory.sh/self-service/browser/flows/recovery/manual/confirm/token", gjson.Get(b.String(), "recovery_url").String())
+				assert.Equal(t, expiresAt, gjson.Get(b.String(), "expires_at").Time().UTC())
+			} else {
+				assert.Equal(t, "https://kratos.ory.sh/self-service/browser/flows/recovery/manual/confirm/token\nExpires at 2020-06-01T12:00:00Z\n", b.String())
+			}
+		})
+	}
+}
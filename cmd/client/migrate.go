@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/ory/kratos/driver"
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/persistence"
 )
 
 type MigrateHandler struct{}
@@ -25,26 +27,50 @@ func NewMigrateHandler() *MigrateHandler {
 	return &MigrateHandler{}
 }
 
-func (h *MigrateHandler) MigrateSQL(cmd *cobra.Command, args []string) {
-	var d driver.Driver
-
+func (h *MigrateHandler) driver(cmd *cobra.Command, args []string) driver.Driver {
 	if flagx.MustGetBool(cmd, "read-from-env") {
-		d = driver.MustNewDefaultDriver(logrusx.New(), "", "", "", true)
+		d := driver.MustNewDefaultDriver(logrusx.New(), "", "", "", true)
 		if len(d.Configuration().DSN()) == 0 {
 			fmt.Println(cmd.UsageString())
 			fmt.Println("")
 			fmt.Println("When using flag -e, environment variable DSN must be set")
 			os.Exit(1)
-			return
-		}
-	} else {
-		if len(args) != 1 {
-			fmt.Println(cmd.UsageString())
-			os.Exit(1)
-			return
 		}
-		viper.Set(configuration.ViperKeyDSN, args[0])
-		d = driver.MustNewDefaultDriver(logrusx.New(), "", "", "", true)
+		return d
+	}
+
+	if len(args) != 1 {
+		fmt.Println(cmd.UsageString())
+		os.Exit(1)
+	}
+	viper.Set(configuration.ViperKeyDSN, args[0])
+	return driver.MustNewDefaultDriver(logrusx.New(), "", "", "", true)
+}
+
+// backup runs the command set with --backup-command before the database schema is changed.
+func (h *MigrateHandler) backup(cmd *cobra.Command, d driver.Driver, direction string) {
+	command := flagx.MustGetString(cmd, "backup-command")
+	if len(command) == 0 {
+		return
+	}
+
+	fmt.Printf("Running backup command: %s\n", command)
+	c := exec.Command("sh", "-c", command)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(), "DSN="+d.Configuration().DSN(), "KRATOS_MIGRATION_DIRECTION="+direction)
+	err := c.Run()
+	cmdx.Must(err, "The backup command failed, no migrations were applied: %s", err)
+}
+
+func (h *MigrateHandler) MigrateSQL(cmd *cobra.Command, args []string) {
+	d := h.driver(cmd, args)
+
+	if flagx.MustGetBool(cmd, "plan") {
+		planned, err := d.Registry().Persister().MigrationPlan(context.Background())
+		cmdx.Must(err, "An error occurred planning migrations: %s", err)
+		printMigrationPlan(planned)
+		return
 	}
 
 	var plan bytes.Buffer
@@ -64,6 +90,8 @@ func (h *MigrateHandler) MigrateSQL(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	h.backup(cmd, d, "up")
+
 	err = d.Registry().Persister().MigrateUp(context.Background())
 	cmdx.Must(err, "An error occurred while connecting to SQL: %s", err)
 	fmt.Println("Successfully applied SQL migrations!")
@@ -98,6 +126,73 @@ func (h *MigrateHandler) MigrateSQL(cmd *cobra.Command, args []string) {
 	// fmt.Printf("Successfully applied %d SQL migrations!\n", n)
 }
 
+func (h *MigrateHandler) MigrateSQLDown(cmd *cobra.Command, args []string) {
+	d := h.driver(cmd, args)
+	steps := flagx.MustGetInt(cmd, "steps")
+
+	planned, err := d.Registry().Persister().MigrationDownPlan(context.Background(), steps)
+	cmdx.Must(err, "An error occurred planning the rollback: %s", err)
+	if len(planned) == 0 {
+		fmt.Println("There are no migrations to roll back.")
+		return
+	}
+
+	fmt.Println("The following migrations will be rolled back:")
+	fmt.Println("")
+	printMigrationPlan(planned)
+
+	var destructive int
+	for _, m := range planned {
+		for _, s := range m.Statements {
+			if s.Destructive {
+				destructive++
+			}
+		}
+	}
+	if destructive > 0 {
+		fmt.Printf("### WARNING ###\n\n%d statements marked as destructive above remove data or may lose data while converting it.\n", destructive)
+		fmt.Println("This data can only be restored from a backup. Use --backup-command to create one automatically.")
+		fmt.Println("")
+	}
+
+	if !flagx.MustGetBool(cmd, "yes") {
+		fmt.Println("To skip the next question use flag --yes (at your own risk).")
+		if !askForConfirmation("Do you wish to roll back these migrations?") {
+			fmt.Println("Rollback aborted.")
+			return
+		}
+	}
+
+	h.backup(cmd, d, "down")
+
+	err = d.Registry().Persister().MigrateDown(context.Background(), steps)
+	cmdx.Must(err, "An error occurred while rolling back SQL migrations: %s", err)
+	fmt.Printf("Successfully rolled back %d SQL migrations!\n", len(planned))
+}
+
+func printMigrationPlan(planned []persistence.PlannedMigration) {
+	if len(planned) == 0 {
+		fmt.Println("-- The database schema is up to date.")
+		return
+	}
+
+	for _, m := range planned {
+		compatibility := "required by this release"
+		if !m.Required {
+			compatibility = "optional, this release runs without it"
+		}
+
+		fmt.Printf("-- Migration %s %s (%s)\n", m.Version, m.Name, compatibility)
+		for _, s := range m.Statements {
+			if s.Destructive {
+				fmt.Println("-- DESTRUCTIVE: this statement removes data or may lose data while converting it")
+			}
+			fmt.Printf("-- Lock impact: %s\n%s\n", s.LockImpact, s.SQL)
+		}
+		fmt.Println("")
+	}
+}
+
 func askForConfirmation(s string) bool {
 	reader := bufio.NewReader(os.Stdin)
 
@@ -0,0 +1,261 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/healthx"
+
+	"github.com/ory/kratos/admission"
+	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/flow/inspect"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/flow/recovery"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/selfservice/strategy/oidc"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/token"
+	"github.com/ory/kratos/webhook"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// AdminScopeRead allows all safe (GET, HEAD, OPTIONS) requests to the admin API which do not return secrets.
+	AdminScopeRead = "read"
+	// AdminScopeSecretsRead allows reading data which lets the caller act as a user, such as the tokens of OpenID
+	// Connect providers, the anti-CSRF tokens of self-service flows, and the messages sent by the courier.
+	AdminScopeSecretsRead = "secrets:read"
+	// AdminScopeIdentitiesWrite allows creating, updating, and deleting identities and their relationships and
+	// scheduled actions.
+	AdminScopeIdentitiesWrite = "identities:write"
+	// AdminScopeSessionsRevoke allows revoking sessions.
+	AdminScopeSessionsRevoke = "sessions:revoke"
+	// AdminScopeTokensWrite allows issuing and revoking action tokens.
+	AdminScopeTokensWrite = "tokens:write"
+	// AdminScopeAdmissionWrite allows managing registration invitations and approvals.
+	AdminScopeAdmissionWrite = "admission:write"
+	// AdminScopeSchemasWrite allows storing identity schemas and changing the default one.
+	AdminScopeSchemasWrite = "schemas:write"
+	// AdminScopeFlowsWrite allows expiring self-service flows.
+	AdminScopeFlowsWrite = "flows:write"
+	// AdminScopeCourierSend allows rendering and sending courier templates.
+	AdminScopeCourierSend = "courier:send"
+	// AdminScopeWebhooksWrite allows managing webhook subscriptions and redelivering events.
+	AdminScopeWebhooksWrite = "webhooks:write"
+	// AdminScopeMaintenance allows enabling the maintenance mode and locking identities.
+	AdminScopeMaintenance = "maintenance"
+	// AdminScopeRecovery allows reviewing manual recovery tickets, which contain personal data, and issuing links
+	// that recover accounts.
+	AdminScopeRecovery = "recovery"
+)
+
+// adminRoute lists the scope a route of the admin API requires. Segments of the path starting with a colon match
+// any value. Routes which are not listed require AdminScopeRead for safe methods and AdminScopeIdentitiesWrite
+// otherwise.
+type adminRoute struct {
+	method string
+	path   string
+	scope  string
+}
+
+var adminRoutes = []adminRoute{
+	{method: http.MethodGet, path: oidc.TokensPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: login.BrowserLoginRequestsPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: registration.BrowserRegistrationRequestsPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: profile.AdminBrowserProfileRequestPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: verify.PublicVerificationRequestPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: recovery.PublicRecoveryRequestPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: inspect.FlowsPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: inspect.FlowPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: courier.MessagesPath, scope: AdminScopeSecretsRead},
+	{method: http.MethodGet, path: courier.MessagesUIPath, scope: AdminScopeSecretsRead},
+
+	{method: http.MethodDelete, path: session.IdentitySessionsPath, scope: AdminScopeSessionsRevoke},
+
+	{method: http.MethodPost, path: token.TokensPath, scope: AdminScopeTokensWrite},
+	{method: http.MethodDelete, path: token.TokensPath + "/:id", scope: AdminScopeTokensWrite},
+
+	{method: http.MethodPost, path: admission.InvitationsPath, scope: AdminScopeAdmissionWrite},
+	{method: http.MethodDelete, path: admission.InvitationsPath + "/:id", scope: AdminScopeAdmissionWrite},
+	{method: http.MethodPost, path: admission.ApprovalsPath + "/:id/approve", scope: AdminScopeAdmissionWrite},
+	{method: http.MethodPost, path: admission.ApprovalsPath + "/:id/reject", scope: AdminScopeAdmissionWrite},
+
+	{method: http.MethodPost, path: schema.StoredSchemasPath, scope: AdminScopeSchemasWrite},
+	{method: http.MethodPut, path: schema.StoredSchemasPath + "/:id/default", scope: AdminScopeSchemasWrite},
+	{method: http.MethodDelete, path: schema.StoredSchemasPath + "/:id/default", scope: AdminScopeSchemasWrite},
+
+	{method: http.MethodPut, path: inspect.FlowExpirePath, scope: AdminScopeFlowsWrite},
+
+	{method: http.MethodPost, path: courier.TemplatesPath + "/:type/preview", scope: AdminScopeCourierSend},
+	{method: http.MethodPost, path: courier.TemplatesPath + "/:type/send", scope: AdminScopeCourierSend},
+
+	{method: http.MethodPost, path: webhook.SubscriptionsPath, scope: AdminScopeWebhooksWrite},
+	{method: http.MethodPut, path: webhook.SubscriptionsPath + "/:id", scope: AdminScopeWebhooksWrite},
+	{method: http.MethodDelete, path: webhook.SubscriptionsPath + "/:id", scope: AdminScopeWebhooksWrite},
+	{method: http.MethodPost, path: webhook.SubscriptionsPath + "/:id/" + webhook.DeliveriesPath + "/:delivery_id/redeliver", scope: AdminScopeWebhooksWrite},
+
+	{method: http.MethodGet, path: recovery.AdminRecoveryTicketsPath, scope: AdminScopeRecovery},
+	{method: http.MethodGet, path: recovery.AdminRecoveryTicketsPath + "/:id", scope: AdminScopeRecovery},
+	{method: http.MethodPost, path: recovery.AdminRecoveryTicketsPath + "/:id/approve", scope: AdminScopeRecovery},
+	{method: http.MethodPost, path: recovery.AdminRecoveryTicketsPath + "/:id/reject", scope: AdminScopeRecovery},
+	{method: http.MethodPost, path: recovery.AdminRecoveryLinksPath, scope: AdminScopeRecovery},
+
+	{method: http.MethodPut, path: maintenance.MaintenancePath, scope: AdminScopeMaintenance},
+	{method: http.MethodDelete, path: maintenance.MaintenancePath, scope: AdminScopeMaintenance},
+	{method: http.MethodPut, path: identity.IdentitiesPath + "/:id/" + maintenance.WriteLockPath, scope: AdminScopeMaintenance},
+	{method: http.MethodDelete, path: identity.IdentitiesPath + "/:id/" + maintenance.WriteLockPath, scope: AdminScopeMaintenance},
+}
+
+// matches returns true if the request is sent to the route.
+func (a adminRoute) matches(method string, segments []string) bool {
+	if a.method != method && !(a.method == http.MethodGet && method == http.MethodHead) {
+		return false
+	}
+
+	expected := strings.Split(strings.Trim(a.path, "/"), "/")
+	if len(expected) != len(segments) {
+		return false
+	}
+	for k, s := range expected {
+		if !strings.HasPrefix(s, ":") && s != segments[k] {
+			return false
+		}
+	}
+	return true
+}
+
+type adminAuthConfiguration interface {
+	AdminAPIKeys() []configuration.AdminAPIKey
+	AdminClientCAPath() string
+	AdminClientCertificates() []configuration.AdminClientCertificate
+}
+
+// AdminAuth is a middleware which authenticates and authorizes requests to the admin API using API keys
+// or client certificates. It lets every request pass if neither is configured.
+type AdminAuth struct {
+	c adminAuthConfiguration
+	w herodot.Writer
+	l logrus.FieldLogger
+}
+
+func NewAdminAuth(c adminAuthConfiguration, w herodot.Writer, l logrus.FieldLogger) *AdminAuth {
+	return &AdminAuth{c: c, w: w, l: l}
+}
+
+func (a *AdminAuth) enabled() bool {
+	return len(a.c.AdminAPIKeys()) > 0 || len(a.c.AdminClientCAPath()) > 0
+}
+
+// requiredScope returns the scope needed to perform the request.
+func requiredScope(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for _, route := range adminRoutes {
+		if route.matches(r.Method, segments) {
+			return route.scope
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return AdminScopeRead
+	}
+	return AdminScopeIdentitiesWrite
+}
+
+// authenticate returns the principal and its scopes or false if the request carries no valid credentials.
+func (a *AdminAuth) authenticate(r *http.Request) (string, []string, bool) {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+		for _, k := range a.c.AdminAPIKeys() {
+			if subtle.ConstantTimeCompare([]byte(k.Key), []byte(token)) == 1 {
+				return "api_key:" + k.ID, k.Scopes, true
+			}
+		}
+		return "", nil, false
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, c := range a.c.AdminClientCertificates() {
+			if c.CommonName == cn {
+				return "client_certificate:" + cn, c.Scopes, true
+			}
+		}
+	}
+
+	return "", nil, false
+}
+
+func (a *AdminAuth) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !a.enabled() || r.URL.Path == healthx.AliveCheckPath || r.URL.Path == healthx.ReadyCheckPath {
+		next(w, r)
+		return
+	}
+
+	scope := requiredScope(r)
+	l := a.l.
+		WithField("audit", "admin_api").
+		WithField("method", r.Method).
+		WithField("path", r.URL.Path).
+		WithField("required_scope", scope)
+
+	principal, scopes, ok := a.authenticate(r)
+	if !ok {
+		l.Warn("Rejected unauthenticated request to the admin API.")
+		a.w.WriteError(w, r, errors.WithStack(herodot.ErrUnauthorized.WithReason("The request could not be authenticated. Provide a valid API key as a bearer token or a trusted client certificate.")))
+		return
+	}
+
+	l = l.WithField("principal", principal)
+	for _, s := range scopes {
+		if s == scope {
+			l.Info("Authorized request to the admin API.")
+			next(w, r.WithContext(x.WithAdminPrincipal(r.Context(), principal)))
+			return
+		}
+	}
+
+	l.Warn("Rejected request to the admin API because of missing scope.")
+	a.w.WriteError(w, r, errors.WithStack(herodot.ErrForbidden.WithReasonf("This request requires the %s scope.", scope)))
+}
+
+// withClientCA enables verification of client certificates issued by the configured CA.
+func withClientCA(tc *tls.Config, c adminAuthConfiguration) (*tls.Config, error) {
+	path := c.AdminClientCAPath()
+	if len(path) == 0 {
+		return tc, nil
+	}
+
+	if tc == nil {
+		return nil, errors.New("serve.admin.auth.mtls requires serve.admin.tls to be configured")
+	}
+
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("unable to parse any certificate from %s", path)
+	}
+
+	tc = tc.Clone()
+	tc.ClientCAs = pool
+	tc.ClientAuth = tls.VerifyClientCertIfGiven
+	return tc, nil
+}
@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/healthx"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type adminAuthConfigurationMock struct {
+	keys    []configuration.AdminAPIKey
+	caPath  string
+	clients []configuration.AdminClientCertificate
+}
+
+func (c *adminAuthConfigurationMock) AdminAPIKeys() []configuration.AdminAPIKey {
+	return c.keys
+}
+
+func (c *adminAuthConfigurationMock) AdminClientCAPath() string {
+	return c.caPath
+}
+
+func (c *adminAuthConfigurationMock) AdminClientCertificates() []configuration.AdminClientCertificate {
+	return c.clients
+}
+
+func TestAdminAuth(t *testing.T) {
+	serve := func(c adminAuthConfiguration, r *http.Request) int {
+		rec := httptest.NewRecorder()
+		NewAdminAuth(c, herodot.NewJSONWriter(logrus.New()), logrus.New()).ServeHTTP(rec, r, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		return rec.Code
+	}
+
+	request := func(method, path, key string, cn string) *http.Request {
+		r := httptest.NewRequest(method, "http://kratos"+path, nil)
+		if len(key) > 0 {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		if len(cn) > 0 {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}}}
+		}
+		return r
+	}
+
+	conf := &adminAuthConfigurationMock{
+		keys: []configuration.AdminAPIKey{
+			{ID: "reader", Key: "reader-key", Scopes: []string{AdminScopeRead}},
+			{ID: "support", Key: "support-key", Scopes: []string{AdminScopeRead, AdminScopeSessionsRevoke}},
+			{ID: "auditor", Key: "auditor-key", Scopes: []string{AdminScopeSecretsRead}},
+			{ID: "helpdesk", Key: "helpdesk-key", Scopes: []string{AdminScopeRecovery}},
+		},
+		caPath: "ca.pem",
+		clients: []configuration.AdminClientCertificate{
+			{CommonName: "provisioner", Scopes: []string{AdminScopeIdentitiesWrite}},
+			{CommonName: "mailer", Scopes: []string{AdminScopeTokensWrite}},
+		},
+	}
+
+	for k, tc := range []struct {
+		d      string
+		r      *http.Request
+		expect int
+	}{
+		{d: "no credentials", r: request("GET", "/identities", "", ""), expect: http.StatusUnauthorized},
+		{d: "unknown key", r: request("GET", "/identities", "foo", ""), expect: http.StatusUnauthorized},
+		{d: "unknown client certificate", r: request("GET", "/identities", "", "stranger"), expect: http.StatusUnauthorized},
+		{d: "health checks are public", r: request("GET", healthx.AliveCheckPath, "", ""), expect: http.StatusNoContent},
+		{d: "read with read scope", r: request("GET", "/identities", "reader-key", ""), expect: http.StatusNoContent},
+		{d: "write without write scope", r: request("POST", "/identities", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "revoke without revoke scope", r: request("DELETE", "/identities/1234/sessions", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "revoke with revoke scope", r: request("DELETE", "/identities/1234/sessions", "support-key", ""), expect: http.StatusNoContent},
+		{d: "delete identity with revoke scope", r: request("DELETE", "/identities/1234", "support-key", ""), expect: http.StatusForbidden},
+		{d: "write with client certificate", r: request("PUT", "/identities/1234", "", "provisioner"), expect: http.StatusNoContent},
+		{d: "read with write-only client certificate", r: request("GET", "/identities/1234", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "read provider tokens with read scope", r: request("GET", "/identities/1234/credentials/oidc/tokens", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "read provider tokens with secrets scope", r: request("GET", "/identities/1234/credentials/oidc/tokens", "auditor-key", ""), expect: http.StatusNoContent},
+		{d: "read login request with read scope", r: request("GET", "/self-service/browser/flows/requests/login?request=1234", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "read flow with read scope", r: request("HEAD", "/self-service/flows/login/1234", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "read courier messages with secrets scope", r: request("GET", "/courier/messages", "auditor-key", ""), expect: http.StatusNoContent},
+		{d: "issue action token with write scope", r: request("POST", "/tokens", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "issue action token with tokens scope", r: request("POST", "/tokens", "", "mailer"), expect: http.StatusNoContent},
+		{d: "read action token with read scope", r: request("GET", "/tokens/1234", "reader-key", ""), expect: http.StatusNoContent},
+		{d: "enable maintenance with write scope", r: request("PUT", "/maintenance", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "lock identity with write scope", r: request("PUT", "/identities/1234/write-lock", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "subscribe webhook with write scope", r: request("POST", "/webhooks/subscriptions/", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "read recovery request with read scope", r: request("GET", "/self-service/browser/flows/requests/recovery?request=1234", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "read recovery request with secrets scope", r: request("GET", "/self-service/browser/flows/requests/recovery?request=1234", "auditor-key", ""), expect: http.StatusNoContent},
+		{d: "list recovery tickets with read scope", r: request("GET", "/recovery/tickets", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "read recovery ticket with read scope", r: request("GET", "/recovery/tickets/1234", "reader-key", ""), expect: http.StatusForbidden},
+		{d: "read recovery ticket with recovery scope", r: request("GET", "/recovery/tickets/1234", "helpdesk-key", ""), expect: http.StatusNoContent},
+		{d: "approve recovery ticket with write scope", r: request("POST", "/recovery/tickets/1234/approve", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "approve recovery ticket with recovery scope", r: request("POST", "/recovery/tickets/1234/approve", "helpdesk-key", ""), expect: http.StatusNoContent},
+		{d: "reject recovery ticket with write scope", r: request("POST", "/recovery/tickets/1234/reject", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "create recovery link with write scope", r: request("POST", "/recovery/links", "", "provisioner"), expect: http.StatusForbidden},
+		{d: "create recovery link with recovery scope", r: request("POST", "/recovery/links", "helpdesk-key", ""), expect: http.StatusNoContent},
+		{d: "update identity through unknown route with write scope", r: request("PATCH", "/identities/1234", "", "provisioner"), expect: http.StatusNoContent},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			assert.Equal(t, tc.expect, serve(conf, tc.r), "%d", k)
+		})
+	}
+
+	t.Run("case=passes everything if not configured", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve(new(adminAuthConfigurationMock), request("DELETE", "/identities/1234", "", "")))
+	})
+}
+
+func TestWithClientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratos-ca")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	writeCertificate(t, caPath, keyPath, "ca")
+
+	t.Run("case=not configured", func(t *testing.T) {
+		tc, err := withClientCA(nil, new(adminAuthConfigurationMock))
+		require.NoError(t, err)
+		assert.Nil(t, tc)
+	})
+
+	t.Run("case=requires tls", func(t *testing.T) {
+		_, err := withClientCA(nil, &adminAuthConfigurationMock{caPath: caPath})
+		require.Error(t, err)
+	})
+
+	t.Run("case=rejects invalid ca", func(t *testing.T) {
+		_, err := withClientCA(new(tls.Config), &adminAuthConfigurationMock{caPath: keyPath})
+		require.Error(t, err)
+	})
+
+	t.Run("case=verifies client certificates", func(t *testing.T) {
+		tc, err := withClientCA(new(tls.Config), &adminAuthConfigurationMock{caPath: caPath})
+		require.NoError(t, err)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, tc.ClientAuth)
+		assert.NotNil(t, tc.ClientCAs)
+	})
+}
@@ -0,0 +1,194 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/selfservice/flow/inspect"
+)
+
+// cleanupTask removes data which is no longer needed, for example expired login history entries.
+type cleanupTask func(ctx context.Context) error
+
+// leader decides whether this instance runs a job, see cluster.Elector.
+type leader interface {
+	Lead(ctx context.Context, job string, ttl time.Duration) bool
+	Resign(ctx context.Context, job string) error
+}
+
+// cleaner runs the cleanup tasks in the configured interval until it is shut down.
+type cleaner struct {
+	l        logrus.FieldLogger
+	interval time.Duration
+	tasks    map[string]cleanupTask
+
+	leader leader
+	job    string
+	ttl    time.Duration
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	done     chan struct{}
+}
+
+func newCleaner(l logrus.FieldLogger, interval time.Duration, tasks map[string]cleanupTask) *cleaner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &cleaner{
+		l:        l,
+		interval: interval,
+		tasks:    tasks,
+		ctx:      ctx,
+		shutdown: cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+// electedBy runs the tasks only while this instance leads the job. The lock of the job is valid for at least
+// twice the interval, so the leader keeps it between two runs.
+func (c *cleaner) electedBy(l leader, job string, ttl time.Duration) *cleaner {
+	if ttl < 2*c.interval {
+		ttl = 2 * c.interval
+	}
+	c.leader, c.job, c.ttl = l, job, ttl
+	return c
+}
+
+// Work runs the cleanup tasks once and then in every interval until Shutdown is called.
+func (c *cleaner) Work() error {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.run(c.ctx)
+
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes all tasks. A failing task is logged and does not prevent the other tasks from running.
+func (c *cleaner) run(ctx context.Context) {
+	names := make([]string, 0, len(c.tasks))
+	for name := range c.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// The lock is renewed before every task, so that it does not expire while long tasks are running.
+		if c.leader != nil && !c.leader.Lead(ctx, c.job, c.ttl) {
+			return
+		}
+
+		if err := c.tasks[name](ctx); err != nil {
+			c.l.WithError(err).WithField("task", name).Error("Cleanup task failed")
+			continue
+		}
+		c.l.WithField("task", name).Debug("Cleanup task completed")
+	}
+}
+
+// Shutdown stops the cleaner and waits until the task which is currently running has completed or the
+// context is done.
+func (c *cleaner) Shutdown(ctx context.Context) error {
+	c.shutdown()
+	select {
+	case <-c.done:
+		if c.leader != nil {
+			return c.leader.Resign(ctx, c.job)
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "cleanup did not finish in time")
+	}
+}
+
+func cleanupTasks(d driver.Driver) map[string]cleanupTask {
+	return map[string]cleanupTask{
+		"login_history":      d.Registry().LoginHistory().Prune,
+		"identity_retention": d.Registry().IdentityRetentionEnforcer().Enforce,
+		"self_service_errors": func(ctx context.Context) error {
+			return d.Registry().SelfServiceErrorPersister().Clear(ctx, d.Configuration().SelfServiceErrorRetention(), false)
+		},
+		"self_service_requests": func(ctx context.Context) error {
+			return deleteExpiredRequests(ctx, d)
+		},
+		"idempotency_records": func(ctx context.Context) error {
+			_, err := d.Registry().IdempotencyPersister().DeleteExpiredIdempotencyRecords(ctx, time.Now().UTC().Add(-d.Configuration().AdminIdempotencyRetention()))
+			return err
+		},
+		"trusted_devices": func(ctx context.Context) error {
+			return d.Registry().SessionPersister().DeleteExpiredTrustedDevices(ctx, time.Now().UTC())
+		},
+		"webhook_deliveries": func(ctx context.Context) error {
+			_, err := d.Registry().WebhookPersister().DeleteWebhookDeliveries(ctx, time.Now().UTC().Add(-d.Configuration().WebhooksDeliveryRetention()))
+			return err
+		},
+		"courier_messages": func(ctx context.Context) error {
+			return encryptCourierMessages(ctx, d)
+		},
+		"credential_identifiers": func(ctx context.Context) error {
+			return backfillCredentialIdentifiers(ctx, d)
+		},
+	}
+}
+
+// backfillCredentialIdentifiers fills in the lookup data of credential identifiers which were stored by replicas
+// running the previous release.
+func backfillCredentialIdentifiers(ctx context.Context, d driver.Driver) error {
+	for ctx.Err() == nil {
+		count, err := d.Registry().PrivilegedIdentityPool().BackfillCredentialIdentifiers(ctx, 100)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		d.Logger().WithField("count", count).Debug("Filled in the lookup data of credential identifiers")
+	}
+	return nil
+}
+
+// encryptCourierMessages encrypts the bodies of courier messages which were queued before bodies were encrypted.
+func encryptCourierMessages(ctx context.Context, d driver.Driver) error {
+	for ctx.Err() == nil {
+		count, err := d.Registry().Persister().EncryptMessages(ctx, 100)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		d.Logger().WithField("count", count).Debug("Encrypted the bodies of courier messages")
+	}
+	return nil
+}
+
+// deleteExpiredRequests removes self-service requests which expired longer ago than the configured retention.
+func deleteExpiredRequests(ctx context.Context, d driver.Driver) error {
+	expiredBefore := time.Now().UTC().Add(-d.Configuration().SelfServiceRequestRetention())
+	for _, kind := range inspect.Kinds {
+		count, err := d.Registry().FlowInspectionPersister().DeleteExpiredFlows(ctx, kind, expiredBefore)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			d.Logger().WithField("kind", kind).WithField("count", count).Debug("Deleted expired self-service requests")
+		}
+	}
+	return nil
+}
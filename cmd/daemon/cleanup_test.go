@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleaner(t *testing.T) {
+	var failures int32
+	runs := make(chan struct{}, 10)
+	c := newCleaner(logrus.New(), time.Millisecond*10, map[string]cleanupTask{
+		"a_failing": func(context.Context) error {
+			atomic.AddInt32(&failures, 1)
+			return errors.New("failed")
+		},
+		"b_counting": func(context.Context) error {
+			select {
+			case runs <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+	})
+
+	errs := make(chan error)
+	go func() {
+		errs <- c.Work()
+	}()
+
+	for k := 0; k < 3; k++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("cleanup task ran only %d times", k)
+		}
+	}
+	assert.True(t, atomic.LoadInt32(&failures) >= 3, "a failing task must not stop the other tasks")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, c.Shutdown(ctx))
+	require.NoError(t, <-errs)
+}
+
+func TestCleanerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	c := newCleaner(logrus.New(), time.Hour, map[string]cleanupTask{
+		"slow": func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+	go func() {
+		_ = c.Work()
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	require.Error(t, c.Shutdown(ctx))
+	close(release)
+}
+
+type fakeLeader struct {
+	leading  bool
+	resigned bool
+}
+
+func (l *fakeLeader) Lead(context.Context, string, time.Duration) bool { return l.leading }
+
+func (l *fakeLeader) Resign(context.Context, string) error {
+	l.resigned = true
+	return nil
+}
+
+func TestCleanerElection(t *testing.T) {
+	var runs int32
+	tasks := map[string]cleanupTask{
+		"counting": func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+	}
+
+	follower := &fakeLeader{leading: false}
+	newCleaner(logrus.New(), time.Hour, tasks).electedBy(follower, "cleanup", time.Minute).run(context.Background())
+	assert.EqualValues(t, 0, atomic.LoadInt32(&runs), "tasks must not run on instances which do not lead the job")
+
+	leader := &fakeLeader{leading: true}
+	c := newCleaner(logrus.New(), time.Hour, tasks).electedBy(leader, "cleanup", time.Minute)
+	assert.Equal(t, 2*time.Hour, c.ttl, "the lock must be valid for at least two intervals")
+	c.run(context.Background())
+	assert.EqualValues(t, 1, atomic.LoadInt32(&runs))
+
+	go func() {
+		_ = c.Work()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, c.Shutdown(ctx))
+	assert.True(t, leader.resigned)
+}
@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	socketPrefixUnix    = "unix://"
+	socketPrefixSystemd = "systemd:"
+
+	// systemdListenFDsStart is the first file descriptor passed by systemd socket activation.
+	systemdListenFDsStart = 3
+)
+
+// listen opens the listener for the given socket configuration. If no socket is configured,
+// a TCP listener is opened on addr.
+//
+// Supported sockets are unix domain sockets (unix:///var/run/kratos.sock) and sockets inherited
+// through systemd socket activation, identified by their FileDescriptorName (systemd:kratos-public).
+func listen(addr, socket string) (net.Listener, error) {
+	switch {
+	case len(socket) == 0:
+		l, err := net.Listen("tcp", addr)
+		return l, errors.WithStack(err)
+	case strings.HasPrefix(socket, socketPrefixUnix):
+		return listenUnix(strings.TrimPrefix(socket, socketPrefixUnix))
+	case strings.HasPrefix(socket, socketPrefixSystemd):
+		return listenSystemd(strings.TrimPrefix(socket, socketPrefixSystemd))
+	}
+	return nil, errors.Errorf("unsupported socket %s, expected it to start with %s or %s", socket, socketPrefixUnix, socketPrefixSystemd)
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	// Remove stale sockets left behind by a previous process, but never touch regular files.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return l, nil
+}
+
+func listenSystemd(name string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.Errorf("systemd socket %s was requested but no sockets were passed to this process", name)
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse environment variable LISTEN_FDS")
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for k := 0; k < count && k < len(names); k++ {
+		if names[k] != name {
+			continue
+		}
+
+		f := os.NewFile(uintptr(systemdListenFDsStart+k), name)
+		defer f.Close()
+
+		l, err := net.FileListener(f)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return l, nil
+	}
+
+	return nil, errors.Errorf("systemd did not pass a socket named %s, check FileDescriptorName= of the socket unit", name)
+}
+
+// listenAndServe returns a function that serves HTTP on the configured socket and is compatible with graceful.Graceful.
+// If tlsConfig is not nil, TLS is terminated on the listener.
+func listenAndServe(server *http.Server, socket string, tlsConfig *tls.Config) func() error {
+	return func() error {
+		l, err := listen(server.Addr, socket)
+		if err != nil {
+			return err
+		}
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		return server.Serve(l)
+	}
+}
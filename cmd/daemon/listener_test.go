@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	t.Run("case=tcp", func(t *testing.T) {
+		l, err := listen("127.0.0.1:0", "")
+		require.NoError(t, err)
+		defer l.Close()
+		assert.Equal(t, "tcp", l.Addr().Network())
+	})
+
+	t.Run("case=unix", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "kratos-socket")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "kratos.sock")
+
+		l, err := listen("", "unix://"+path)
+		require.NoError(t, err)
+
+		go func() {
+			_ = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+		}()
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return new(net.Dialer).DialContext(ctx, "unix", path)
+			},
+		}}
+		res, err := client.Get("http://kratos/health/alive")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		require.NoError(t, l.Close())
+
+		// A stale socket from a previous run must not prevent listening again.
+		l, err = net.Listen("unix", path)
+		require.NoError(t, err)
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		require.NoError(t, l.Close())
+
+		l, err = listen("", "unix://"+path)
+		require.NoError(t, err)
+		require.NoError(t, l.Close())
+	})
+
+	t.Run("case=unix does not remove regular files", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "kratos-socket")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		defer os.Remove(f.Name())
+
+		_, err = listen("", "unix://"+f.Name())
+		require.Error(t, err)
+		_, err = os.Stat(f.Name())
+		require.NoError(t, err)
+	})
+
+	t.Run("case=systemd without activation", func(t *testing.T) {
+		require.NoError(t, os.Unsetenv("LISTEN_PID"))
+		_, err := listen("", "systemd:kratos-public")
+		require.Error(t, err)
+	})
+
+	t.Run("case=systemd without matching socket", func(t *testing.T) {
+		require.NoError(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid())))
+		require.NoError(t, os.Setenv("LISTEN_FDS", "1"))
+		require.NoError(t, os.Setenv("LISTEN_FDNAMES", "kratos-admin"))
+		defer func() {
+			for _, k := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+				_ = os.Unsetenv(k)
+			}
+		}()
+
+		_, err := listen("", "systemd:kratos-public")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "kratos-public")
+	})
+
+	t.Run("case=unsupported socket", func(t *testing.T) {
+		_, err := listen("", "tcp://127.0.0.1:4433")
+		require.Error(t, err)
+	})
+}
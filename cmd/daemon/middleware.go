@@ -9,16 +9,19 @@ import (
 
 	"github.com/ory/x/healthx"
 	"github.com/ory/x/reqlog"
+
+	"github.com/ory/kratos/x"
 )
 
 func NewNegroniLoggerMiddleware(l logrus.FieldLogger, name string) *reqlog.Middleware {
 	n := reqlog.NewMiddlewareFromLogger(l.(*logrus.Logger), name).ExcludePaths(healthx.AliveCheckPath, healthx.ReadyCheckPath)
 	n.Before = func(entry *logrus.Entry, req *http.Request, remoteAddr string) *logrus.Entry {
 		return entry.WithFields(logrus.Fields{
-			"name":    name,
-			"request": req.RequestURI,
-			"method":  req.Method,
-			"remote":  remoteAddr,
+			"name":       name,
+			"request":    req.RequestURI,
+			"request_id": req.Header.Get(x.RequestIDHeader),
+			"method":     req.Method,
+			"remote":     remoteAddr,
 		})
 	}
 
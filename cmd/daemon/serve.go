@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	stdctx "context"
 	"net/http"
 	"strings"
 	"sync"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/ory/x/flagx"
 	"github.com/ory/x/healthx"
+	"github.com/ory/x/stringsx"
 
 	"github.com/gorilla/context"
 	"github.com/spf13/cobra"
@@ -18,23 +20,38 @@ import (
 	"github.com/ory/graceful"
 	"github.com/ory/x/metricsx"
 
+	"github.com/ory/kratos/admission"
+	"github.com/ory/kratos/batch"
+	"github.com/ory/kratos/cluster"
 	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/idempotency"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/relationship"
+	"github.com/ory/kratos/report"
+	"github.com/ory/kratos/retention"
 	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/device"
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/logout"
 	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/flow/recovery"
 	"github.com/ory/kratos/selfservice/flow/registration"
 	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/selfservice/strategy/crossdevice"
+	"github.com/ory/kratos/selfservice/strategy/emailcode"
 	"github.com/ory/kratos/selfservice/strategy/oidc"
 	"github.com/ory/kratos/selfservice/strategy/password"
+	"github.com/ory/kratos/selfservice/strategy/push"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/stats"
+	"github.com/ory/kratos/token"
 	"github.com/ory/kratos/x"
 )
 
-func servePublic(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args []string) {
-	defer wg.Done()
-
+// NewPublicHandler returns the handler of the public API with all routes and middlewares of kratos serve.
+// The middlewares are added after the request logger.
+func NewPublicHandler(d driver.Driver, middlewares ...negroni.Handler) http.Handler {
 	c := d.Configuration()
 	l := d.Logger()
 	n := negroni.New()
@@ -45,43 +62,131 @@ func servePublic(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args [
 	r.RegistrationHandler().RegisterPublicRoutes(router)
 	r.LogoutHandler().RegisterPublicRoutes(router)
 	r.ProfileManagementHandler().RegisterPublicRoutes(router)
+	r.UploadHandler().RegisterPublicRoutes(router)
 	r.LoginStrategies().RegisterPublicRoutes(router)
+	r.LoginSecondFactors().RegisterPublicRoutes(router)
 	r.RegistrationStrategies().RegisterPublicRoutes(router)
 	r.SessionHandler().RegisterPublicRoutes(router)
 	r.SelfServiceErrorHandler().RegisterPublicRoutes(router)
 	r.SchemaHandler().RegisterPublicRoutes(router)
 	r.VerificationHandler().RegisterPublicRoutes(router)
-	r.HealthHandler().SetRoutes(router.Router, false)
+	r.RecoveryHandler().RegisterPublicRoutes(router)
+	r.DeviceAuthorizationHandler().RegisterPublicRoutes(router)
+	r.IdentityWebhookHandler().RegisterPublicRoutes(router)
+	r.TokenHandler().RegisterPublicRoutes(router)
+	r.BundledUIHandler().RegisterPublicRoutes(router)
+	r.PublicHealthHandler().SetRoutes(router.Router, false)
 
+	n.Use(x.NewRequestIDMiddleware())
 	n.Use(NewNegroniLoggerMiddleware(l.(*logrus.Logger), "public#"+c.SelfPublicURL().String()))
-	n.Use(sqa(cmd, d))
-
-	r.WithCSRFHandler(x.NewCSRFHandler(
-		router,
-		r.Writer(),
-		l,
-		c.SelfPublicURL().Path,
-		c.SelfPublicURL().Hostname(),
-		!flagx.MustGetBool(cmd, "dev"),
-	))
+	n.Use(report.NewRecoveryMiddleware(r.ErrorReporter()))
+	for _, m := range middlewares {
+		n.Use(m)
+	}
+	n.Use(x.NewForwardedHeaders(c.PublicTrustedProxies(), c.SelfPublicURL().Path))
+	n.Use(x.NewSecurityHeadersMiddleware(c.SecurityHeaders(), r.Writer()))
+	limits := c.RequestLimits()
+	n.Use(x.NewRequestLimitsMiddleware(limits.MaxBodySize, limits.MaxJSONDepth, limits.MaxFormFields, r.Writer()))
+
+	var csrf interface {
+		x.CSRFHandler
+		ExemptPath(path string)
+		ExemptGlob(pattern string)
+	}
+	if c.CSRFMode() == configuration.CSRFModeOrigin {
+		origin := x.NewOriginCSRFHandler(
+			router,
+			r.Writer(),
+			l,
+			c.CSRFCookiePath(),
+			c.CSRFCookieDomain(),
+			c.CSRFCookieSecure(),
+			c.CSRFCookieSameSiteMode(),
+			c.CSRFAllowedOrigins(),
+		)
+		handleCSRFFailures(r, origin)
+		csrf = origin
+	} else {
+		csrf = x.NewCSRFHandler(
+			router,
+			r.Writer(),
+			l,
+			c.CSRFCookiePath(),
+			c.CSRFCookieDomain(),
+			c.CSRFCookieSecure(),
+			c.CSRFCookieSameSiteMode(),
+		)
+	}
+	// Providers such as Apple post the OpenID Connect callback from their own site. The callback is protected by
+	// the state parameter instead.
+	csrf.ExemptGlob(strings.Replace(oidc.CallbackPath, ":provider", "*", 1))
+	// The identity webhook is called by other services, which sign their requests instead.
+	csrf.ExemptPath(identity.WebhookPath)
+	// Devices such as TVs and CLIs are not browsers and prove who they are using the device code instead.
+	csrf.ExemptPath(device.AuthorizationPath)
+	csrf.ExemptPath(device.TokenPath)
+	// Push approvals are sent by an app, which proves that it received the push notification using its secret.
+	csrf.ExemptPath(push.ApprovalPath)
+	// Verification codes and action tokens are redeemed by custom UIs, apps, and other services. The code or the
+	// token proves that the link was received.
+	csrf.ExemptPath(verify.PublicVerificationRedeemPath)
+	csrf.ExemptPath(token.RedeemPath)
+	r.WithCSRFHandler(csrf)
 	n.UseHandler(
 		r.CSRFHandler(),
 	)
+	return context.ClearHandler(n)
+}
+
+// handleCSRFFailures makes submissions of self-service flows, which fail the CSRF check of the origin mode, show
+// the error in the flow they belong to. Browsers are redirected back to the flow's UI instead of seeing JSON.
+func handleCSRFFailures(r driver.Registry, csrf *x.OriginCSRFHandler) {
+	loginErrors := r.LoginRequestErrorHandler()
+	csrf.HandleFailureGlob(password.LoginPath, loginErrors.HandleCSRFFailure(identity.CredentialsTypePassword))
+	csrf.HandleFailureGlob(password.LoginRotationPath, loginErrors.HandleCSRFFailure(identity.CredentialsTypePassword))
+	csrf.HandleFailureGlob(emailcode.BasePath+"/*", loginErrors.HandleCSRFFailure(identity.CredentialsTypeEmailCode))
+	csrf.HandleFailureGlob(push.BasePath+"/*", loginErrors.HandleCSRFFailure(identity.CredentialsTypePush))
+	csrf.HandleFailureGlob(crossdevice.BasePath+"/*", loginErrors.HandleCSRFFailure(identity.CredentialsTypeCrossDevice))
+
+	csrf.HandleFailureGlob(password.RegistrationPath, r.RegistrationRequestErrorHandler().HandleCSRFFailure(identity.CredentialsTypePassword))
+	if s, err := r.RegistrationStrategies().Strategy(identity.CredentialsTypeOIDC); err == nil {
+		if s, ok := s.(*oidc.Strategy); ok {
+			csrf.HandleFailureGlob(strings.Replace(oidc.AuthPath, ":request", "*", 1), s.HandleCSRFFailure)
+		}
+	}
+
+	csrf.HandleFailureGlob(profile.PublicProfileManagementUpdatePath, r.ProfileRequestRequestErrorHandler().HandleCSRFFailure)
+	csrf.HandleFailureGlob(strings.Replace(verify.PublicVerificationCompletePath, ":via", "*", 1), r.VerificationRequestErrorHandler().HandleCSRFFailure)
+	csrf.HandleFailureGlob(strings.Replace(recovery.PublicRecoveryCompletePath, ":method", "*", 1), r.RecoveryRequestErrorHandler().HandleCSRFFailure)
+}
+
+func servePublic(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args []string) {
+	defer wg.Done()
+
+	c := d.Configuration()
+	l := d.Logger()
+	r := d.Registry()
+
 	server := graceful.WithDefaults(&http.Server{
 		Addr:    c.PublicListenOn(),
-		Handler: context.ClearHandler(n),
+		Handler: NewPublicHandler(d, sqa(cmd, d)),
 	})
 
-	l.Printf("Starting the public httpd on: %s", server.Addr)
-	if err := graceful.Graceful(server.ListenAndServe, server.Shutdown); err != nil {
-		l.Fatalln("Failed to gracefully shutdown public httpd")
+	tlsConfig, err := newTLSConfig(c.PublicTLS(), c.SelfPublicURL(), l)
+	if err != nil {
+		l.WithError(err).Fatalln("Unable to load TLS configuration for the public httpd")
+	}
+
+	l.Printf("Starting the public httpd on: %s", stringsx.Coalesce(c.PublicSocket(), server.Addr))
+	if err := graceful.Graceful(listenAndServe(server, c.PublicSocket(), tlsConfig), drainAndShutdown(c, r, l, server.Shutdown)); err != nil {
+		l.WithError(err).Fatalln("Failed to gracefully shutdown public httpd")
 	}
 	l.Println("Public httpd was shutdown gracefully")
 }
 
-func serveAdmin(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args []string) {
-	defer wg.Done()
-
+// NewAdminHandler returns the handler of the admin API with all routes and middlewares of kratos serve.
+// The middlewares are added after the request logger.
+func NewAdminHandler(d driver.Driver, middlewares ...negroni.Handler) http.Handler {
 	c := d.Configuration()
 	l := d.Logger()
 	n := negroni.New()
@@ -92,24 +197,70 @@ func serveAdmin(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args []
 	r.LoginHandler().RegisterAdminRoutes(router)
 	r.SchemaHandler().RegisterAdminRoutes(router)
 	r.VerificationHandler().RegisterAdminRoutes(router)
+	r.RecoveryHandler().RegisterAdminRoutes(router)
 	r.ProfileManagementHandler().RegisterAdminRoutes(router)
 	r.IdentityHandler().RegisterAdminRoutes(router)
 	r.SessionHandler().RegisterAdminRoutes(router)
+	r.StatsHandler().RegisterAdminRoutes(router)
+	r.RetentionHandler().RegisterAdminRoutes(router)
+	r.AdmissionHandler().RegisterAdminRoutes(router)
+	r.RelationshipHandler().RegisterAdminRoutes(router)
+	r.TokenHandler().RegisterAdminRoutes(router)
+	r.ScheduledActionHandler().RegisterAdminRoutes(router)
+	r.MaintenanceHandler().RegisterAdminRoutes(router)
+	r.WebhookHandler().RegisterAdminRoutes(router)
+	r.BatchHandler().RegisterAdminRoutes(router)
+	r.FlowInspectionHandler().RegisterAdminRoutes(router)
+	r.OpenAPIHandler().RegisterAdminRoutes(router)
 	r.HealthHandler().SetRoutes(router.Router, true)
+	router.GET(x.NetworkACLMetricsPath, x.ServeNetworkACLMetrics)
+	router.GET(cluster.MetricsPath, cluster.ServeMetrics)
+	router.GET(registration.BotMetricsPath, registration.ServeBotMetrics)
 	r.SelfServiceErrorHandler().RegisterAdminRoutes(router)
+	r.CourierHandler().RegisterAdminRoutes(router)
+	r.OIDCTokenHandler().RegisterAdminRoutes(router)
 
+	n.Use(x.NewRequestIDMiddleware())
 	n.Use(NewNegroniLoggerMiddleware(l.(*logrus.Logger), "admin#"+c.SelfAdminURL().String()))
-	n.Use(sqa(cmd, d))
+	n.Use(report.NewRecoveryMiddleware(r.ErrorReporter()))
+	for _, m := range middlewares {
+		n.Use(m)
+	}
+	n.Use(x.NewForwardedHeaders(c.AdminTrustedProxies(), c.SelfAdminURL().Path))
+	n.Use(x.NewNetworkACLMiddleware(configuration.NetworkACLGroupAdmin, networkACL(c, configuration.NetworkACLGroupAdmin), func(r *http.Request) bool {
+		return true
+	}, r.Writer(), l))
+	n.Use(NewAdminAuth(c, r.Writer(), l))
+	n.Use(idempotency.NewMiddleware(r))
 
 	n.UseHandler(router)
+	return context.ClearHandler(n)
+}
+
+func serveAdmin(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args []string) {
+	defer wg.Done()
+
+	c := d.Configuration()
+	l := d.Logger()
+	r := d.Registry()
+
 	server := graceful.WithDefaults(&http.Server{
 		Addr:    c.AdminListenOn(),
-		Handler: context.ClearHandler(n),
+		Handler: NewAdminHandler(d, sqa(cmd, d)),
 	})
 
-	l.Printf("Starting the admin httpd on: %s", server.Addr)
-	if err := graceful.Graceful(server.ListenAndServe, server.Shutdown); err != nil {
-		l.Fatalln("Failed to gracefully shutdown admin httpd")
+	tlsConfig, err := newTLSConfig(c.AdminTLS(), c.SelfAdminURL(), l)
+	if err != nil {
+		l.WithError(err).Fatalln("Unable to load TLS configuration for the admin httpd")
+	}
+	tlsConfig, err = withClientCA(tlsConfig, c)
+	if err != nil {
+		l.WithError(err).Fatalln("Unable to load the client CA for the admin httpd")
+	}
+
+	l.Printf("Starting the admin httpd on: %s", stringsx.Coalesce(c.AdminSocket(), server.Addr))
+	if err := graceful.Graceful(listenAndServe(server, c.AdminSocket(), tlsConfig), drainAndShutdown(c, r, l, server.Shutdown)); err != nil {
+		l.WithError(err).Fatalln("Failed to gracefully shutdown admin httpd")
 	}
 	l.Println("Admin httpd was shutdown gracefully")
 }
@@ -138,6 +289,7 @@ func sqa(cmd *cobra.Command, d driver.Driver) *metricsx.Service {
 				"/auth/methods/oidc/",
 				password.RegistrationPath,
 				password.LoginPath,
+				password.LoginRotationPath,
 				oidc.BasePath,
 				login.BrowserLoginPath,
 				login.BrowserLoginRequestsPath,
@@ -145,16 +297,37 @@ func sqa(cmd *cobra.Command, d driver.Driver) *metricsx.Service {
 				registration.BrowserRegistrationPath,
 				registration.BrowserRegistrationRequestsPath,
 				session.SessionsWhoamiPath,
+				session.SessionsLoginHistoryPath,
+				session.SessionsSecurityPath,
+				session.SessionsDelegatePath,
 				identity.IdentitiesPath,
+				identity.IdentitiesStreamPath,
+				identity.IdentitiesDuplicatesPath,
 				profile.PublicProfileManagementPath,
 				profile.AdminBrowserProfileRequestPath,
 				profile.PublicProfileManagementPath,
 				profile.PublicProfileManagementUpdatePath,
+				profile.PublicProfileManagementRevokePath,
 				verify.PublicVerificationCompletePath,
 				strings.ReplaceAll(strings.ReplaceAll(verify.PublicVerificationConfirmPath, ":via", "email"), ":code", ""),
 				strings.ReplaceAll(verify.PublicVerificationInitPath, ":via", "email"),
 				verify.PublicVerificationRequestPath,
+				verify.PublicVerificationRedeemPath,
+				strings.ReplaceAll(recovery.PublicRecoveryCompletePath, ":method", "link"),
+				strings.ReplaceAll(strings.ReplaceAll(recovery.PublicRecoveryConfirmPath, ":method", "link"), ":token", ""),
+				strings.ReplaceAll(recovery.PublicRecoveryInitPath, ":method", "link"),
+				recovery.PublicRecoveryRequestPath,
+				strings.ReplaceAll(recovery.PublicRecoveryRevertPath, ":token", ""),
+				recovery.AdminRecoveryTicketsPath,
 				errorx.ErrorsPath,
+				stats.StatsPath,
+				retention.RetentionPlanPath,
+				admission.InvitationsPath,
+				admission.ApprovalsPath,
+				relationship.RelationshipsPath,
+				token.TokensPath,
+				token.RedeemPath,
+				batch.BatchPath,
 			},
 			BuildVersion: d.Registry().BuildVersion(),
 			BuildHash:    d.Registry().BuildHash(),
@@ -166,22 +339,91 @@ func sqa(cmd *cobra.Command, d driver.Driver) *metricsx.Service {
 	)
 }
 
-func bgTasks(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args []string) {
+// Worker is a background task which runs next to the HTTP servers until it is shut down.
+type Worker struct {
+	Name     string
+	Work     func() error
+	Shutdown graceful.ShutdownFunc
+}
+
+// Workers returns the background workers of kratos serve: the courier, which delivers messages, the cleanup
+// worker, which prunes data which is no longer needed, the scheduler, which executes scheduled identity actions,
+// and the webhooks worker, which sends events to the webhook subscriptions.
+// If several instances share the database, each worker runs on one instance at a time.
+func Workers(d driver.Driver) []Worker {
+	c := newCleaner(d.Logger(), d.Configuration().CleanupInterval(), cleanupTasks(d)).
+		electedBy(d.Registry().ClusterElector(), "cleanup", d.Configuration().ClusterLockTTL())
+	s := newCleaner(d.Logger(), d.Configuration().SchedulerInterval(), map[string]cleanupTask{
+		"identity_scheduled_actions": d.Registry().IdentityScheduler().Run,
+	}).electedBy(d.Registry().ClusterElector(), "scheduler", d.Configuration().ClusterLockTTL())
+	wh := newCleaner(d.Logger(), d.Configuration().WebhooksInterval(), map[string]cleanupTask{
+		"webhook_deliveries": d.Registry().WebhookDispatcher().Deliver,
+	}).electedBy(d.Registry().ClusterElector(), "webhooks", d.Configuration().ClusterLockTTL())
+	return []Worker{
+		{Name: "courier", Work: d.Registry().Courier().Work, Shutdown: d.Registry().Courier().Shutdown},
+		{Name: "cleanup", Work: c.Work, Shutdown: c.Shutdown},
+		{Name: "scheduler", Work: s.Work, Shutdown: s.Shutdown},
+		{Name: "webhooks", Work: wh.Work, Shutdown: wh.Shutdown},
+	}
+}
+
+func runWorker(d driver.Driver, wg *sync.WaitGroup, w Worker) {
 	defer wg.Done()
 
-	if err := graceful.Graceful(d.Registry().Courier().Work, d.Registry().Courier().Shutdown); err != nil {
-		d.Logger().WithError(err).Fatalf("Failed to run courier worker.")
+	if err := graceful.Graceful(w.Work, drainAndShutdown(d.Configuration(), d.Registry(), d.Logger(), w.Shutdown)); err != nil {
+		d.Logger().WithError(err).Fatalf("Failed to run %s worker.", w.Name)
+	}
+	d.Logger().Printf("%s worker was shutdown gracefully", w.Name)
+}
+
+func networkACL(c configuration.Provider, group string) *x.NetworkACL {
+	allow, deny := c.NetworkACL(group)
+	return &x.NetworkACL{Allow: allow, Deny: deny}
+}
+
+// validateCookieConfig stops the process if the cookie configuration would be rejected by browsers.
+func validateCookieConfig(c configuration.Provider, l logrus.FieldLogger) {
+	if c.SessionSameSiteMode() == http.SameSiteNoneMode && !c.SessionCookieSecure() {
+		l.Fatalf("Configuration key %s can only be set to None if %s is true.", configuration.ViperKeySessionSameSite, configuration.ViperKeySessionCookieSecure)
+	}
+	if c.CSRFCookieSameSiteMode() == http.SameSiteNoneMode && !c.CSRFCookieSecure() {
+		l.Fatalf("Configuration key %s can only be set to None if %s is true.", configuration.ViperKeyCSRFCookieSameSite, configuration.ViperKeyCSRFCookieSecure)
+	}
+}
+
+// warnPendingMigrations logs the migrations which have not been applied yet. The server keeps running
+// against the older schema, but features which depend on the pending migrations are disabled.
+func warnPendingMigrations(d driver.Driver) {
+	pending, err := d.Registry().Persister().PendingMigrations(stdctx.Background())
+	if err != nil {
+		d.Logger().WithError(err).Warn("Unable to check for pending SQL migrations.")
+		return
+	}
+
+	if len(pending) > 0 {
+		d.Logger().
+			WithField("pending_migrations", pending).
+			Warn("The database schema is older than this release. Features which depend on pending migrations are disabled until kratos migrate sql is run.")
 	}
-	d.Logger().Println("courier worker was shutdown gracefully")
 }
 
 func ServeAll(d driver.Driver) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
+		validateCookieConfig(d.Configuration(), d.Logger())
+		warnPendingMigrations(d)
+
+		workers := Workers(d)
+
 		var wg sync.WaitGroup
-		wg.Add(3)
+		wg.Add(2 + len(workers))
 		go servePublic(d, &wg, cmd, args)
 		go serveAdmin(d, &wg, cmd, args)
-		go bgTasks(d, &wg, cmd, args)
+		for _, w := range workers {
+			go runWorker(d, &wg, w)
+		}
 		wg.Wait()
+
+		stopStrategies(d)
+		closePersister(d)
 	}
 }
@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/ory/graceful"
+
+	"github.com/ory/kratos/driver"
+)
+
+type (
+	shutdownConfiguration interface {
+		ShutdownDelay() time.Duration
+		ShutdownTimeout() time.Duration
+	}
+	drainer interface {
+		Drain()
+	}
+)
+
+// drainAndShutdown wraps a graceful.ShutdownFunc. It first marks the instance as not ready and waits
+// for the configured delay so that load balancers stop sending new requests to it. It then calls
+// shutdown with a context that expires after the configured timeout, giving in-flight requests and
+// courier deliveries the chance to finish.
+func drainAndShutdown(c shutdownConfiguration, d drainer, l logrus.FieldLogger, shutdown graceful.ShutdownFunc) graceful.ShutdownFunc {
+	return func(context.Context) error {
+		d.Drain()
+
+		if delay := c.ShutdownDelay(); delay > 0 {
+			l.Printf("Draining for %s before shutting down", delay)
+			time.Sleep(delay)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout())
+		defer cancel()
+		return shutdown(ctx)
+	}
+}
+
+// stopStrategies stops custom strategies once all servers have stopped and no request is using them anymore.
+func stopStrategies(d driver.Driver) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.Configuration().ShutdownTimeout())
+	defer cancel()
+	d.Registry().StopStrategies(ctx)
+}
+
+// closePersister closes the database connection pool once all servers and workers have stopped.
+func closePersister(d driver.Driver) {
+	if err := d.Registry().Persister().Close(context.Background()); err != nil {
+		d.Logger().WithError(err).Error("Unable to close the database connection pool")
+		return
+	}
+	d.Logger().Println("Database connection pool was closed")
+}
@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shutdownConfigurationMock struct {
+	delay, timeout time.Duration
+}
+
+func (c *shutdownConfigurationMock) ShutdownDelay() time.Duration {
+	return c.delay
+}
+
+func (c *shutdownConfigurationMock) ShutdownTimeout() time.Duration {
+	return c.timeout
+}
+
+type drainerMock struct {
+	drainedAt time.Time
+}
+
+func (d *drainerMock) Drain() {
+	d.drainedAt = time.Now()
+}
+
+func TestDrainAndShutdown(t *testing.T) {
+	conf := &shutdownConfigurationMock{delay: time.Millisecond * 50, timeout: time.Minute}
+	d := new(drainerMock)
+
+	var shutdownAt time.Time
+	var deadline time.Time
+	err := drainAndShutdown(conf, d, logrus.New(), func(ctx context.Context) error {
+		shutdownAt = time.Now()
+		deadline, _ = ctx.Deadline()
+		return nil
+	})(context.Background())
+	require.NoError(t, err)
+
+	require.False(t, d.drainedAt.IsZero(), "the instance must be marked as draining")
+	assert.True(t, shutdownAt.Sub(d.drainedAt) >= conf.delay, "shutdown must wait for the drain delay")
+	assert.WithinDuration(t, shutdownAt.Add(conf.timeout), deadline, time.Second)
+}
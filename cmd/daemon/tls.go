@@ -0,0 +1,127 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+// certificateReloadInterval is the minimum time between two checks for changed certificate files.
+const certificateReloadInterval = time.Second * 10
+
+// certificateReloader serves a certificate from disk and reloads it when the certificate or key file changes.
+type certificateReloader struct {
+	certPath, keyPath string
+	l                 logrus.FieldLogger
+
+	sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertificateReloader(certPath, keyPath string, l logrus.FieldLogger) (*certificateReloader, error) {
+	c := &certificateReloader{certPath: certPath, keyPath: keyPath, l: l}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certificateReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certPath, c.keyPath} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return latest, errors.WithStack(err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *certificateReloader) reload() error {
+	modTime, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.checkedAt = time.Now()
+	return nil
+}
+
+func (c *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.RLock()
+	cert, modTime, checkedAt := c.cert, c.modTime, c.checkedAt
+	c.RUnlock()
+
+	if time.Since(checkedAt) < certificateReloadInterval {
+		return cert, nil
+	}
+
+	c.Lock()
+	c.checkedAt = time.Now()
+	c.Unlock()
+
+	if latest, err := c.lastModified(); err != nil {
+		c.l.WithError(err).Error("Unable to check TLS certificate for changes, continuing to use the current certificate.")
+	} else if latest.After(modTime) {
+		if err := c.reload(); err != nil {
+			c.l.WithError(err).Error("Unable to reload TLS certificate, continuing to use the current certificate.")
+		} else {
+			c.l.Info("Reloaded TLS certificate.")
+		}
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+	return c.cert, nil
+}
+
+// newTLSConfig returns the TLS configuration for a listener or nil if TLS is disabled.
+func newTLSConfig(conf *configuration.ServeTLSConfig, host *url.URL, l logrus.FieldLogger) (*tls.Config, error) {
+	if !conf.Enabled() {
+		return nil, nil
+	}
+
+	if conf.ACMEEnabled {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(host.Hostname()),
+			Cache:      autocert.DirCache(conf.ACMECacheDir),
+			Email:      conf.ACMEEmail,
+		}
+		tc := m.TLSConfig()
+		tc.MinVersion = tls.VersionTLS12
+		return tc, nil
+	}
+
+	reloader, err := newCertificateReloader(conf.CertPath, conf.KeyPath, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
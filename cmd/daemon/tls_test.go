@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+func writeCertificate(t *testing.T, certPath, keyPath, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func commonName(t *testing.T, c *certificateReloader) string {
+	cert, err := c.GetCertificate(nil)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratos-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCertificate(t, certPath, keyPath, "first")
+
+	c, err := newCertificateReloader(certPath, keyPath, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, c))
+
+	writeCertificate(t, certPath, keyPath, "second")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, later, later))
+	require.NoError(t, os.Chtimes(keyPath, later, later))
+
+	t.Run("case=does not check files too often", func(t *testing.T) {
+		assert.Equal(t, "first", commonName(t, c))
+	})
+
+	t.Run("case=reloads changed files", func(t *testing.T) {
+		c.checkedAt = time.Now().Add(-certificateReloadInterval)
+		assert.Equal(t, "second", commonName(t, c))
+	})
+
+	t.Run("case=keeps the current certificate if the new one is invalid", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(keyPath, []byte("not a key"), 0600))
+		even := later.Add(time.Minute)
+		require.NoError(t, os.Chtimes(keyPath, even, even))
+
+		c.checkedAt = time.Now().Add(-certificateReloadInterval)
+		assert.Equal(t, "second", commonName(t, c))
+	})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	u, err := url.Parse("https://www.example.org/")
+	require.NoError(t, err)
+
+	t.Run("case=disabled", func(t *testing.T) {
+		tc, err := newTLSConfig(new(configuration.ServeTLSConfig), u, logrus.New())
+		require.NoError(t, err)
+		assert.Nil(t, tc)
+	})
+
+	t.Run("case=missing files", func(t *testing.T) {
+		_, err := newTLSConfig(&configuration.ServeTLSConfig{CertPath: "does-not-exist.crt", KeyPath: "does-not-exist.key"}, u, logrus.New())
+		require.Error(t, err)
+	})
+
+	t.Run("case=acme", func(t *testing.T) {
+		tc, err := newTLSConfig(&configuration.ServeTLSConfig{ACMEEnabled: true, ACMECacheDir: os.TempDir()}, u, logrus.New())
+		require.NoError(t, err)
+		require.NotNil(t, tc)
+		assert.NotNil(t, tc.GetCertificate)
+	})
+}
@@ -2,25 +2,19 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/cmd/client"
 )
 
 // identitiesCmd represents the identity command
 var identitiesCmd = &cobra.Command{
-	Use: "identities",
+	Use:   "identities",
+	Short: "Manage identities using the admin API",
 }
 
 func init() {
 	rootCmd.AddCommand(identitiesCmd)
 
 	identitiesCmd.PersistentFlags().String("endpoint", "", "Specifies the Ory Kratos Admin URL. Defaults to KRATOS_URLS_ADMIN")
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// identitiesCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// identitiesCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	identitiesCmd.PersistentFlags().String("format", client.FormatTable, "Set the output format to \"table\" or \"json\"")
 }
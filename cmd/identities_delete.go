@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/cmd/client"
+)
+
+var identitiesDeleteCmd = &cobra.Command{
+	Use:   "delete <id [id-2 [id-3] ...]>",
+	Short: "Delete one or more identities",
+	Long:  `Deletes the given identities and prints the IDs of the deleted identities. This can not be undone.`,
+	Run:   client.NewIdentityClient().Delete,
+}
+
+func init() {
+	identitiesCmd.AddCommand(identitiesDeleteCmd)
+}
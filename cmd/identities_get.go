@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/cmd/client"
+)
+
+var identitiesGetCmd = &cobra.Command{
+	Use:   "get <id [id-2 [id-3] ...]>",
+	Short: "Get one or more identities",
+	Run:   client.NewIdentityClient().Get,
+}
+
+func init() {
+	identitiesCmd.AddCommand(identitiesGetCmd)
+}
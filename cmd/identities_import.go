@@ -8,20 +8,18 @@ import (
 
 // importCmd represents the import command
 var importCmd = &cobra.Command{
-	Use: "import <file.json [file-2.json [file-3.json] ...]>",
+	Use:   "import <file.json [file-2.json [file-3.json] ...]>",
+	Short: "Import identities from files or stdin",
+	Long: `Creates the identities contained in the given files. Use "-" to read from stdin. A file contains a JSON array
+of identities, a single identity, or several identities one after another. The output of
+"kratos identities list --format json" can be imported as-is, IDs are assigned by ORY Kratos.
+
+Identities which fail to import are reported and the remaining identities are imported anyway.`,
+	Example: `kratos identities import users.json
+kratos identities list --format json --endpoint http://old-kratos:4434 | kratos identities import -`,
 	Run: client.NewIdentityClient().Import,
 }
 
 func init() {
 	identitiesCmd.AddCommand(importCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// importCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// importCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
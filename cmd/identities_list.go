@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/cmd/client"
+)
+
+var identitiesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List identities",
+	Long: `Lists a page of identities. Use --limit and --offset to page through all identities, or --identifier to find
+the identity which uses an identifier, for example an email address, to sign in.`,
+	Example: `kratos identities list --limit 50 --offset 100
+kratos identities list --identifier foo@bar.com --format json`,
+	Run: client.NewIdentityClient().List,
+}
+
+func init() {
+	identitiesCmd.AddCommand(identitiesListCmd)
+
+	identitiesListCmd.Flags().Int("limit", 100, "The maximum number of identities to list, at most 500")
+	identitiesListCmd.Flags().Int("offset", 0, "The number of identities to skip")
+	identitiesListCmd.Flags().String("identifier", "", "Only list the identity using this login identifier or verifiable address")
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/cmd/client"
+)
+
+var identitiesPatchCmd = &cobra.Command{
+	Use:   "patch <id> <patch.json>",
+	Short: "Patch an identity",
+	Long: `Applies a JSON merge patch (RFC 7386) to the identity and prints the updated identity. Use "-" to read the
+patch from stdin. Keys set to null are removed, objects are merged, and all other values are replaced.`,
+	Example: `echo '{"traits":{"name":{"last":"Doe"}}}' | kratos identities patch 7d0f3a4c-... -
+echo '{"traits_schema_id":"customer"}' | kratos identities patch 7d0f3a4c-... -`,
+	Run: client.NewIdentityClient().Patch,
+}
+
+func init() {
+	identitiesCmd.AddCommand(identitiesPatchCmd)
+}
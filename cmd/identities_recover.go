@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/cmd/client"
+)
+
+var identitiesRecoverCmd = &cobra.Command{
+	Use:   "recover <id>",
+	Short: "Create a recovery link for an identity",
+	Long: `Creates a link which lets the identity choose a new password, for example after confirming the identity of a
+user in a support conversation. The link is printed and not sent to the identity. It completes the manual recovery
+method, so selfservice.recovery.manual.enabled must be set, and is valid for selfservice.recovery.manual.lifespan.`,
+	Example: `kratos identities recover 7d0f3a4c-...`,
+	Run:     client.NewIdentityClient().Recover,
+}
+
+func init() {
+	identitiesCmd.AddCommand(identitiesRecoverCmd)
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/cmd/client"
+	"github.com/ory/kratos/identity"
+)
+
+var identitiesVerifyAddressCmd = &cobra.Command{
+	Use:   "verify-address <id>",
+	Short: "Mark an address of an identity as verified",
+	Long: `Marks the address of the identity as verified without the identity completing the verification flow, for
+example after confirming the address in a support conversation. Verification links sent out before no longer work.
+Prints the identity including the state of all its addresses.`,
+	Example: `kratos identities verify-address 7d0f3a4c-... --address foo@bar.com`,
+	Run:     client.NewIdentityClient().VerifyAddress,
+}
+
+func init() {
+	identitiesCmd.AddCommand(identitiesVerifyAddressCmd)
+
+	identitiesVerifyAddressCmd.Flags().String("address", "", "The address to mark as verified, for example an email address")
+	identitiesVerifyAddressCmd.Flags().String("via", string(identity.VerifiableAddressTypeEmail), "The type of the address")
+}
@@ -39,6 +39,12 @@ You can read in the database URL using the -e flag, for example:
 ### WARNING ###
 
 Before running this command on an existing database, create a back up!
+
+### Rolling Upgrades ###
+
+New releases can run against the database schema of the previous release, so you can roll them out
+before running this command. Use --plan to print the statements which will be executed, the expected
+lock impact of each statement, and whether the running release requires the migration.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger = viperx.InitializeConfig("kratos", "", logger)
@@ -53,4 +59,6 @@ func init() {
 
 	migrateSqlCmd.Flags().BoolP("read-from-env", "e", false, "If set, reads the database connection string from the environment variable DSN or config file key dsn.")
 	migrateSqlCmd.Flags().BoolP("yes", "y", false, "If set all confirmation requests are accepted without user interaction.")
+	migrateSqlCmd.Flags().String("backup-command", "", "A shell command which is run before migrations are applied, for example to back up the database. No migrations are applied if it fails.")
+	migrateSqlCmd.Flags().Bool("plan", false, "If set, prints the SQL statements of all pending migrations and their expected lock impact without applying them.")
 }
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ory/x/viperx"
+
+	"github.com/ory/kratos/cmd/client"
+)
+
+// migrateSqlDownCmd represents the sql down command
+var migrateSqlDownCmd = &cobra.Command{
+	Use:   "down <database-url>",
+	Short: "Roll back SQL migrations",
+	Long: `Run this command to roll back the database schema after downgrading ORY Kratos.
+
+The statements which will be executed are printed before the rollback starts. Statements which remove data
+or may lose data while converting it are marked as destructive. That data can only be restored from a backup.
+
+You can read in the database URL using the -e flag, for example:
+	export DSN=...
+	kratos migrate sql down -e --steps 2
+
+### WARNING ###
+
+Before running this command, create a back up! You can use --backup-command to run a backup tool
+automatically. The command is run with sh and receives the database URL in the environment variable DSN:
+	kratos migrate sql down -e --backup-command 'pg_dump "$DSN" > kratos-backup.sql'
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger = viperx.InitializeConfig("kratos", "", logger)
+
+		client.NewMigrateHandler().MigrateSQLDown(cmd, args)
+	},
+}
+
+func init() {
+	migrateSqlCmd.AddCommand(migrateSqlDownCmd)
+
+	migrateSqlDownCmd.Flags().BoolP("read-from-env", "e", false, "If set, reads the database connection string from the environment variable DSN or config file key dsn.")
+	migrateSqlDownCmd.Flags().BoolP("yes", "y", false, "If set all confirmation requests are accepted without user interaction.")
+	migrateSqlDownCmd.Flags().Int("steps", 1, "The number of migrations to roll back.")
+	migrateSqlDownCmd.Flags().String("backup-command", "", "A shell command which is run before the rollback, for example to back up the database. The rollback is aborted if it fails.")
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/openapi"
+)
+
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Print the OpenAPI 3.0 specification of the HTTP API",
+	Long: `Prints the OpenAPI 3.0 specification of the public and the admin API, including examples of every state of
+the self-service flows. The admin API serves the same specification at /spec.json, with its own URLs as servers.
+
+The specification is converted from docs/api.swagger.json, which "make sdk" generates from the code.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		spec, err := openapi.Generate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to generate the OpenAPI specification: %+v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), string(spec))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(openapiCmd)
+}
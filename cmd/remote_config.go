@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/fetcher"
+)
+
+// fetchRemoteConfig replaces a remote --config source, for example s3://bucket/kratos.yml, with a local copy which
+// is updated in the background. Viper watches the copy and reloads the configuration when it changes.
+func fetchRemoteConfig(cmd *cobra.Command, _ []string) {
+	flag := cmd.Flags().Lookup("config")
+	if flag == nil || !isRemoteConfig(flag.Value.String()) {
+		return
+	}
+
+	source := flag.Value.String()
+	path, err := writeRemoteConfig(source, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to fetch configuration file %s: %s\n", source, err)
+		os.Exit(1)
+	}
+
+	if err := cmd.Flags().Set("config", path); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to use configuration file %s: %s\n", source, err)
+		os.Exit(1)
+	}
+
+	if fetcher.IsRemote(source) {
+		go refreshRemoteConfig(source, path)
+	}
+}
+
+func isRemoteConfig(source string) bool {
+	return fetcher.IsRemote(source) || strings.HasPrefix(source, "base64://")
+}
+
+// writeRemoteConfig fetches source and writes it to path. If path is empty, a temporary file with the source's
+// file extension is created.
+func writeRemoteConfig(source, path string) (string, error) {
+	body, err := fetcher.Default.Fetch(context.Background(), source)
+	if err != nil {
+		return "", err
+	}
+
+	if len(path) == 0 {
+		f, err := ioutil.TempFile("", "kratos-config-*"+remoteConfigExt(source))
+		if err != nil {
+			return "", err
+		}
+		path = f.Name()
+		if err := f.Close(); err != nil {
+			return "", err
+		}
+	}
+
+	if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, body) {
+		return path, nil
+	}
+	return path, ioutil.WriteFile(path, body, 0600)
+}
+
+func refreshRemoteConfig(source, path string) {
+	for {
+		interval := viper.GetDuration(configuration.ViperKeyFetchRefreshInterval)
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		time.Sleep(interval)
+
+		if _, err := writeRemoteConfig(source, path); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to refresh configuration file %s: %s\n", source, err)
+		}
+	}
+}
+
+// remoteConfigExt returns the file extension of the source which viper uses to detect the configuration format.
+func remoteConfigExt(source string) string {
+	if u, err := url.Parse(source); err == nil && u.Scheme != "base64" {
+		switch ext := strings.ToLower(filepath.Ext(u.Path)); ext {
+		case ".json", ".yaml", ".yml", ".toml":
+			return ext
+		}
+	}
+	return ".yaml"
+}
@@ -6,16 +6,21 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/ory/viper"
+	"github.com/ory/x/stringsx"
 	"github.com/ory/x/viperx"
 
 	"github.com/spf13/cobra"
+
+	"github.com/ory/kratos/driver/configuration"
 )
 
 var logger logrus.FieldLogger
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use: "kratos",
+	Use:              "kratos",
+	PersistentPreRun: fetchRemoteConfig,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -36,5 +41,17 @@ func watchAndValidateViper() {
 	if err != nil {
 		logger.WithError(err).Fatal("Unable to open configuration JSON Schema.")
 	}
+
+	ps, err := configuration.Validate(schema)
+	if err != nil {
+		logger.WithError(err).Fatal("Unable to validate the configuration.")
+	}
+	if len(ps) > 0 {
+		printConfigProblems(os.Stderr, stringsx.Coalesce(viper.ConfigFileUsed(), "the configuration"), ps)
+	}
+	if ps.HasErrors() {
+		logger.Fatal("The configuration is invalid, see the errors above. Use \"kratos validate config <file>\" to check a configuration file without starting ORY Kratos.")
+	}
+
 	viperx.WatchAndValidateViper(logger, schema, "ORY Kratos", []string{"serve", "profiling", "log"})
 }
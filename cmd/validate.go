@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Various validation helpers",
+}
+
+var validateConfigCmd = &cobra.Command{
+	Use:   "config <file>",
+	Short: "Validate a configuration file",
+	Long: `Validates the configuration file against the configuration's JSON schema and checks constraints the schema
+can not express, for example whether the identity schemas can be loaded, whether enabled OpenID Connect providers
+have client credentials, and whether lifespans are greater than zero.
+
+Each problem is printed with the path of the configuration key and, where possible, how to fix it. The command
+exits with status code 1 if the configuration has errors. Warnings do not fail the validation.
+
+The file can also be loaded from a remote source such as s3://bucket/kratos.yml, gs://bucket/kratos.yml,
+https://example.org/kratos.yml, or base64://<encoded configuration>.
+
+The same checks run when ORY Kratos starts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+		if isRemoteConfig(path) {
+			var err error
+			if path, err = writeRemoteConfig(args[0], ""); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to fetch configuration file %s: %s\n", args[0], err)
+				os.Exit(1)
+			}
+			defer os.Remove(path)
+		}
+
+		viper.SetConfigFile(path)
+		if err := viper.ReadInConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read configuration file %s: %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		ps, err := validateConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to validate configuration file %s: %+v\n", args[0], err)
+			os.Exit(1)
+		}
+
+		printConfigProblems(cmd.OutOrStdout(), args[0], ps)
+		if ps.HasErrors() {
+			os.Exit(1)
+		}
+	},
+}
+
+func validateConfig() (configuration.Problems, error) {
+	schema, err := schemas.Find("config.schema.json")
+	if err != nil {
+		return nil, err
+	}
+	return configuration.Validate(schema)
+}
+
+func printConfigProblems(w io.Writer, source string, ps configuration.Problems) {
+	errs, warnings := ps.Count()
+	if errs+warnings == 0 {
+		fmt.Fprintf(w, "%s is valid.\n", source)
+		return
+	}
+
+	fmt.Fprintf(w, "Found %d error(s) and %d warning(s) in %s:\n\n", errs, warnings, source)
+	for _, p := range ps {
+		fmt.Fprintf(w, "  %-8s %s\n", p.Severity, p.Path)
+		fmt.Fprintf(w, "  %-8s %s\n", "", p.Message)
+		if len(p.Fix) > 0 {
+			fmt.Fprintf(w, "  %-8s Fix: %s\n", "", p.Fix)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.AddCommand(validateConfigCmd)
+}
@@ -1,35 +1,58 @@
 package courier
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"fmt"
-	"strconv"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/cenkalti/backoff"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/gomail.v2"
 
 	"github.com/ory/x/errorsx"
 
+	"github.com/ory/kratos/chaos"
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/cluster"
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/egress"
 	"github.com/ory/kratos/x"
 )
 
+const (
+	// clusterJob is the name of the lock held by the instance which delivers messages.
+	clusterJob = "courier"
+
+	// maxAttempts is the number of times a message is tried before it fails for good, which is after
+	// about six hours.
+	maxAttempts = 18
+)
+
 type (
 	smtpDependencies interface {
 		PersistenceProvider
+		cipher.Provider
+		cluster.ElectorProvider
 		x.LoggingProvider
 	}
 	Courier struct {
-		dialer *gomail.Dialer
-		d      smtpDependencies
-		c      configuration.Provider
+		// servers send the emails which are not routed to other servers, the first one is
+		// courier.smtp.connection_uri and the others are the failovers.
+		servers []*smtpServer
+		routes  []smtpRoute
+		client  *http.Client
+		d       smtpDependencies
+		c       configuration.Provider
 		// graceful shutdown handling
 		ctx      context.Context
 		shutdown context.CancelFunc
+		done     chan struct{}
 	}
 	Provider interface {
 		Courier() *Courier
@@ -37,25 +60,23 @@ type (
 )
 
 func NewSMTP(d smtpDependencies, c configuration.Provider) *Courier {
-	uri := c.CourierSMTPURL()
-	sslSkipVerify, _ := strconv.ParseBool(uri.Query().Get("skip_ssl_verify"))
-	password, _ := uri.User.Password()
-	port, _ := strconv.ParseInt(uri.Port(), 10, 64)
+	var routes []smtpRoute
+	for _, r := range c.CourierSMTPRoutes() {
+		if len(r.URLs) > 0 {
+			routes = append(routes, smtpRoute{categories: r.Categories, servers: newSMTPServers(r.URLs)})
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Courier{
 		d:        d,
 		c:        c,
 		ctx:      ctx,
 		shutdown: cancel,
-		dialer: &gomail.Dialer{
-			Host:     uri.Hostname(),
-			Port:     int(port),
-			Username: uri.User.Username(),
-			Password: password,
-			SSL:      uri.Scheme == "smtps",
-			/* #nosec we need to support SMTP servers wihout TLS */
-			TLSConfig: &tls.Config{InsecureSkipVerify: sslSkipVerify},
-		},
+		done:     make(chan struct{}),
+		client:   &http.Client{Timeout: time.Second * 10, Transport: egress.Default},
+		servers:  newSMTPServers(append([]*url.URL{c.CourierSMTPURL()}, c.CourierSMTPFailoverURLs()...)),
+		routes:   routes,
 	}
 }
 
@@ -81,6 +102,8 @@ func (m *Courier) QueueEmail(ctx context.Context, t EmailTemplate) (uuid.UUID, e
 		Body:      body,
 		Subject:   subject,
 		Recipient: recipient,
+		RequestID: x.RequestID(ctx),
+		Category:  t.EmailCategory(),
 	}
 	if err := m.d.CourierPersister().AddMessage(ctx, message); err != nil {
 		return uuid.Nil, err
@@ -88,32 +111,173 @@ func (m *Courier) QueueEmail(ctx context.Context, t EmailTemplate) (uuid.UUID, e
 	return message.ID, nil
 }
 
-func (m *Courier) Work() error {
-	errChan := make(chan error)
-	defer close(errChan)
+// QueueBackChannelLogout queues a logout token for delivery to a back-channel logout endpoint. Delivery is
+// retried until the endpoint acknowledges the token with a 2xx status code.
+func (m *Courier) QueueBackChannelLogout(ctx context.Context, endpoint, logoutToken string) (uuid.UUID, error) {
+	message := &Message{
+		Status:    MessageStatusQueued,
+		Type:      MessageTypeBackChannelLogout,
+		Body:      logoutToken,
+		Recipient: endpoint,
+		RequestID: x.RequestID(ctx),
+	}
+	if err := m.d.CourierPersister().AddMessage(ctx, message); err != nil {
+		return uuid.Nil, err
+	}
+	return message.ID, nil
+}
 
-	go m.watchMessages(m.ctx, errChan)
+// QueueSMS queues a text message. It is delivered to courier.sms.url, which fails until the URL is configured.
+func (m *Courier) QueueSMS(ctx context.Context, t SMSTemplate) (uuid.UUID, error) {
+	body, err := t.SMSBody()
+	if err != nil {
+		return uuid.Nil, err
+	}
 
-	select {
-	case <-m.ctx.Done():
-		if m.ctx.Err() == context.Canceled {
-			return nil
-		}
-		return m.ctx.Err()
-	case err := <-errChan:
+	recipient, err := t.SMSRecipient()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	message := &Message{
+		Status:    MessageStatusQueued,
+		Type:      MessageTypeSMS,
+		Body:      body,
+		Recipient: recipient,
+		RequestID: x.RequestID(ctx),
+	}
+	if err := m.d.CourierPersister().AddMessage(ctx, message); err != nil {
+		return uuid.Nil, err
+	}
+	return message.ID, nil
+}
+
+// send sends the email using the SMTP servers of the category.
+func (m *Courier) send(ctx context.Context, l logrus.FieldLogger, category string, gm *gomail.Message) error {
+	if err := chaos.Inject(ctx, m.c.Chaos().Courier); err != nil {
 		return err
 	}
+	return m.sendSMTP(l, category, gm)
+}
+
+func (m *Courier) deliverBackChannelLogout(ctx context.Context, msg *Message) error {
+	if err := chaos.Inject(ctx, m.c.Chaos().Courier); err != nil {
+		return err
+	}
+
+	body := url.Values{"logout_token": {msg.Body}}.Encode()
+	return m.post(m.outboundHook(msg.Recipient), msg.Recipient, "application/x-www-form-urlencoded", []byte(body), msg.RequestID)
+}
+
+func (m *Courier) deliverSMS(ctx context.Context, msg *Message) error {
+	if err := chaos.Inject(ctx, m.c.Chaos().Courier); err != nil {
+		return err
+	}
+
+	conf := m.c.CourierSMS()
+	if len(conf.URL) == 0 {
+		return errors.Errorf("unable to send the text message because %s is not set", configuration.ViperKeyCourierSMS+".url")
+	}
+
+	body, err := json.Marshal(map[string]string{"to": msg.Recipient, "body": msg.Body})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return m.post(conf.OutboundHook, conf.URL, "application/json", body, msg.RequestID)
+}
+
+// post sends the body to the endpoint, signed and secured as configured by the hook. It returns an error unless
+// the endpoint acknowledged the call.
+func (m *Courier) post(hook configuration.OutboundHook, endpoint, contentType string, body []byte, requestID string) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if len(requestID) > 0 {
+		req.Header.Set(x.RequestIDHeader, requestID)
+	}
+	if len(hook.SigningSecrets) > 0 {
+		req.Header.Set(x.SignatureHeader, x.Sign(body, hook.SigningSecrets, time.Now()))
+	}
+
+	conf, err := hook.TLS.Config()
+	if err != nil {
+		return err
+	}
+	client := egress.Default.HookClient(m.client, conf)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if !hook.Acknowledged(res.StatusCode) {
+		if len(hook.ExpectedStatusCodes) > 0 {
+			return errors.Errorf("expected one of the status codes %v but got %d", hook.ExpectedStatusCodes, res.StatusCode)
+		}
+		return errors.Errorf("expected status code 2xx but got %d", res.StatusCode)
+	}
+	return nil
+}
+
+// outboundHook returns the settings of the back-channel logout client at endpoint. Messages to clients which
+// were removed from the configuration are delivered using the defaults.
+func (m *Courier) outboundHook(endpoint string) configuration.OutboundHook {
+	for _, c := range m.c.SelfServiceLogoutBackChannelClients() {
+		if c.URL == endpoint {
+			return c.OutboundHook
+		}
+	}
+	return configuration.OutboundHook{}
+}
+
+// Work delivers queued messages until Shutdown is called. It returns once the message which is
+// currently being delivered has been sent and marked as such.
+func (m *Courier) Work() error {
+	defer close(m.done)
+	return m.watchMessages(m.ctx)
+}
+
+// Ping checks whether the SMTP server or one of its failovers accepts TCP connections.
+func (m *Courier) Ping() error {
+	var err error
+	for _, s := range m.servers {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", s.address(), time.Second*5)
+		if err == nil {
+			return conn.Close()
+		}
+	}
+	return errors.WithStack(err)
 }
 
+// Shutdown stops the worker from picking up new messages and waits until the message which is
+// currently being delivered has been sent or the context is done.
 func (m *Courier) Shutdown(ctx context.Context) error {
 	m.shutdown()
-	return nil
+	select {
+	case <-m.done:
+		return m.d.ClusterElector().Resign(ctx, clusterJob)
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "courier did not finish delivering messages in time")
+	}
 }
 
-func (m *Courier) watchMessages(ctx context.Context, errChan chan error) {
+func (m *Courier) watchMessages(ctx context.Context) error {
+	// Messages which were handed to the SMTP server must be marked as sent even if the worker is
+	// shutting down, otherwise they would be sent again after a restart.
+	store := context.Background()
+
 	for {
 		if err := backoff.Retry(func() error {
-			messages, err := m.d.CourierPersister().NextMessages(ctx, 10)
+			// Only one instance delivers messages at a time, so that no message is sent twice.
+			if !m.d.ClusterElector().Lead(store, clusterJob, m.c.ClusterLockTTL()) {
+				return nil
+			}
+
+			messages, err := m.d.CourierPersister().NextMessages(store, 10)
 			if err != nil {
 				if errorsx.Cause(err) == ErrQueueEmpty {
 					return nil
@@ -122,52 +286,203 @@ func (m *Courier) watchMessages(ctx context.Context, errChan chan error) {
 			}
 
 			for k := range messages {
+				if ctx.Err() != nil {
+					return nil
+				}
+
 				var msg = messages[k]
+				l := x.ContextLogger(x.WithRequestID(ctx, msg.RequestID), m.d.Logger())
+
+				body, err := msg.PlaintextBody(m.d.Cipher())
+				if err != nil {
+					// The message was encrypted with secrets which are no longer configured, retrying would not help.
+					l.
+						WithError(err).
+						WithField("message_id", msg.ID).
+						Error("Unable to decrypt the message body, the message is not delivered.")
+					if err := m.d.CourierPersister().SetMessageStatus(store, msg.ID, MessageStatusFailed); err != nil {
+						l.
+							WithError(err).
+							WithField("message_id", msg.ID).
+							Error(`Unable to set the message status to "failed".`)
+						return err
+					}
+					continue
+				}
+				msg.Body = body
+
+				// Emails and text messages are captured, back-channel logout tokens are always delivered.
+				if msg.Type != MessageTypeBackChannelLogout && m.c.CourierCapture() {
+					if err := m.d.CourierPersister().SetMessageStatus(store, msg.ID, MessageStatusCaptured); err != nil {
+						l.
+							WithError(err).
+							WithField("message_id", msg.ID).
+							Error(`Unable to set the message status to "captured".`)
+						return err
+					}
+
+					l.
+						WithField("message_id", msg.ID).
+						WithField("message_subject", msg.Subject).
+						Info("Courier captured message instead of sending it, see the admin endpoint /courier/messages/ui.")
+					continue
+				}
 
 				switch msg.Type {
 				case MessageTypeEmail:
-					from := m.c.CourierSMTPFrom()
+					headers := m.c.CourierCategory(msg.Category)
+					from := headers.FromAddress
 					gm := gomail.NewMessage()
 					gm.SetHeader("From", from)
+					if len(headers.ReplyTo) > 0 {
+						gm.SetHeader("Reply-To", headers.ReplyTo)
+					}
+					if len(headers.ListUnsubscribe) > 0 {
+						gm.SetHeader("List-Unsubscribe", headers.ListUnsubscribe)
+					}
 					gm.SetHeader("To", msg.Recipient)
 					gm.SetHeader("Subject", msg.Subject)
 					gm.SetBody("text/plain", msg.Body)
 					gm.AddAlternative("text/html", msg.Body)
 
-					if err := m.dialer.DialAndSend(gm); err != nil {
-						m.d.Logger().
+					if err := m.send(ctx, l, msg.Category, gm); err != nil {
+						l.
 							WithError(err).
-							WithField("smtp_server", fmt.Sprintf("%s:%d", m.dialer.Host, m.dialer.Port)).
-							WithField("smtp_ssl_enabled", m.dialer.SSL).
+							WithField("message_category", msg.Category).
 							// WithField("email_to", msg.Recipient).
 							WithField("message_from", from).
 							Error("Unable to send email using SMTP connection.")
+						if err := m.retry(store, l, &msg); err != nil {
+							return err
+						}
 						continue
 					}
 
-					if err := m.d.CourierPersister().SetMessageStatus(ctx, msg.ID, MessageStatusSent); err != nil {
-						m.d.Logger().
+					if err := m.d.CourierPersister().SetMessageStatus(store, msg.ID, MessageStatusSent); err != nil {
+						l.
 							WithError(err).
 							WithField("message_id", msg.ID).
 							Error(`Unable to set the message status to "sent".`)
 						return err
 					}
 
-					m.d.Logger().
+					l.
 						WithField("message_id", msg.ID).
 						WithField("message_type", msg.Type).
 						WithField("message_subject", msg.Subject).
 						Debug("Courier sent out message.")
+				case MessageTypeBackChannelLogout:
+					if err := m.deliverBackChannelLogout(ctx, &msg); err != nil {
+						l.
+							WithError(err).
+							WithField("message_id", msg.ID).
+							WithField("back_channel_host", backChannelHost(msg.Recipient)).
+							Error("Unable to deliver back-channel logout token.")
+						if err := m.retry(store, l, &msg); err != nil {
+							return err
+						}
+						continue
+					}
+
+					if err := m.d.CourierPersister().SetMessageStatus(store, msg.ID, MessageStatusSent); err != nil {
+						l.
+							WithError(err).
+							WithField("message_id", msg.ID).
+							Error(`Unable to set the message status to "sent".`)
+						return err
+					}
+
+					l.
+						WithField("message_id", msg.ID).
+						WithField("message_type", msg.Type).
+						Debug("Courier delivered back-channel logout token.")
+				case MessageTypeSMS:
+					if err := m.deliverSMS(ctx, &msg); err != nil {
+						l.
+							WithError(err).
+							WithField("message_id", msg.ID).
+							Error("Unable to deliver text message.")
+						if err := m.retry(store, l, &msg); err != nil {
+							return err
+						}
+						continue
+					}
+
+					if err := m.d.CourierPersister().SetMessageStatus(store, msg.ID, MessageStatusSent); err != nil {
+						l.
+							WithError(err).
+							WithField("message_id", msg.ID).
+							Error(`Unable to set the message status to "sent".`)
+						return err
+					}
+
+					l.
+						WithField("message_id", msg.ID).
+						WithField("message_type", msg.Type).
+						Debug("Courier delivered text message.")
 				default:
 					return errors.Errorf("received unexpected message type: %d", msg.Type)
 				}
 			}
 
 			return nil
-		}, backoff.NewExponentialBackOff()); err != nil {
-			errChan <- err
-			return
+		}, backoff.WithContext(backoff.NewExponentialBackOff(), ctx)); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
 		}
-		time.Sleep(time.Second)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// retry records a failed attempt to deliver the message. The message is tried again after retryDelay, until it
+// failed maxAttempts times.
+func (m *Courier) retry(store context.Context, l logrus.FieldLogger, msg *Message) error {
+	attempts := msg.SendCount + 1
+	if attempts >= maxAttempts {
+		l.
+			WithField("message_id", msg.ID).
+			WithField("attempts", attempts).
+			Error("Giving up on delivering the message.")
+		if err := m.d.CourierPersister().SetMessageStatus(store, msg.ID, MessageStatusFailed); err != nil {
+			l.
+				WithError(err).
+				WithField("message_id", msg.ID).
+				Error(`Unable to set the message status to "failed".`)
+			return err
+		}
+		return nil
+	}
+
+	if err := m.d.CourierPersister().SetMessageNextAttempt(store, msg.ID, time.Now().UTC().Add(retryDelay(attempts))); err != nil {
+		l.
+			WithError(err).
+			WithField("message_id", msg.ID).
+			Error("Unable to schedule the next attempt to deliver the message.")
+		return err
+	}
+	return nil
+}
+
+// retryDelay returns the time to wait before the next attempt: one second after the first failed attempt, two
+// after the second, and so on, up to an hour.
+func retryDelay(attempts int) time.Duration {
+	if attempts > 12 {
+		return time.Hour
+	}
+	return time.Second << uint(attempts-1)
+}
+
+func backChannelHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
 	}
+	return u.Host
 }
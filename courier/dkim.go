@@ -0,0 +1,131 @@
+package courier
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dkimSignedHeaders are the headers covered by the DKIM signature, if the email has them.
+var dkimSignedHeaders = []string{
+	"from", "reply-to", "to", "subject", "date", "message-id",
+	"mime-version", "content-type", "content-transfer-encoding", "list-unsubscribe",
+}
+
+// dkimSign signs the email using DKIM (RFC 6376) with relaxed canonicalization and returns it with the
+// DKIM-Signature header prepended. RSA keys sign with rsa-sha256 and Ed25519 keys with ed25519-sha256 (RFC 8463).
+func dkimSign(raw []byte, domain, selector string, key crypto.Signer, now time.Time) ([]byte, error) {
+	split := bytes.Index(raw, []byte("\r\n\r\n"))
+	if split < 0 {
+		return nil, errors.New("unable to sign the email because it has no header section")
+	}
+	headers := dkimHeaders(raw[:split+2])
+	bodyHash := sha256.Sum256(dkimRelaxedBody(raw[split+4:]))
+
+	var algorithm string
+	var opts crypto.SignerOpts
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm, opts = "rsa-sha256", crypto.SHA256
+	case ed25519.PublicKey:
+		algorithm, opts = "ed25519-sha256", crypto.Hash(0)
+	default:
+		return nil, errors.Errorf("unable to sign the email with a key of type %T", key.Public())
+	}
+
+	var signed []string
+	var canonical bytes.Buffer
+	for _, name := range dkimSignedHeaders {
+		if value, ok := headers[name]; ok {
+			signed = append(signed, name)
+			canonical.WriteString(dkimRelaxedHeader(name, value) + "\r\n")
+		}
+	}
+
+	signature := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		algorithm, domain, selector, now.Unix(), strings.Join(signed, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	// The signature covers its own header with an empty b= tag and without the trailing line break.
+	canonical.WriteString(dkimRelaxedHeader("dkim-signature", signature))
+
+	hash := sha256.Sum256(canonical.Bytes())
+	b, err := key.Sign(rand.Reader, hash[:], opts)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return append([]byte("DKIM-Signature: "+signature+base64.StdEncoding.EncodeToString(b)+"\r\n"), raw...), nil
+}
+
+// dkimHeaders returns the unfolded headers by their lower case name. If a header occurs several times, the last
+// one is returned, as it is the one a DKIM signature covers first.
+func dkimHeaders(raw []byte) map[string]string {
+	headers := map[string]string{}
+	var name string
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(name) > 0 {
+			headers[name] += line
+			continue
+		}
+
+		if i := strings.Index(line, ":"); i > 0 {
+			name = strings.ToLower(strings.TrimSpace(line[:i]))
+			headers[name] = line[i+1:]
+		}
+	}
+	return headers
+}
+
+// dkimRelaxedHeader canonicalizes the header using the "relaxed" algorithm of RFC 6376 section 3.4.2.
+func dkimRelaxedHeader(name, value string) string {
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(dkimCompressWhitespace(value))
+}
+
+// dkimRelaxedBody canonicalizes the body using the "relaxed" algorithm of RFC 6376 section 3.4.4.
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for k := range lines {
+		lines[k] = strings.TrimRight(dkimCompressWhitespace(lines[k]), " ")
+	}
+
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func dkimCompressWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteRune(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteRune(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package courier
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/gomail.v2"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+func TestDKIMCanonicalization(t *testing.T) {
+	// The examples of RFC 6376 section 3.4.5.
+	headers := dkimHeaders([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n"))
+	assert.Equal(t, "a:X", dkimRelaxedHeader("A", headers["a"]))
+	assert.Equal(t, "b:Y Z", dkimRelaxedHeader("B", headers["b"]))
+
+	assert.Equal(t, " C\r\nD E\r\n", string(dkimRelaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))))
+	assert.Empty(t, dkimRelaxedBody([]byte("\r\n\r\n")))
+}
+
+func TestDKIMSign(t *testing.T) {
+	gm := gomail.NewMessage()
+	gm.SetHeader("From", "noreply@ory.sh")
+	gm.SetHeader("To", "foo@ory.sh")
+	gm.SetHeader("Subject", "Please verify your email address")
+	gm.SetBody("text/plain", "Hi,  please verify your account.\n")
+
+	var b bytes.Buffer
+	_, err := gm.WriteTo(&b)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for algorithm, key := range map[string]crypto.Signer{"rsa-sha256": rsaKey, "ed25519-sha256": edKey} {
+		t.Run("algorithm="+algorithm, func(t *testing.T) {
+			signed, err := dkimSign(b.Bytes(), "ory.sh", "kratos", key, time.Unix(1600000000, 0))
+			require.NoError(t, err)
+			require.True(t, bytes.HasSuffix(signed, b.Bytes()), "the email must not be changed")
+
+			header := string(signed[:bytes.Index(signed, []byte("\r\n"))])
+			require.True(t, strings.HasPrefix(header, "DKIM-Signature: "), header)
+			tags := map[string]string{}
+			for _, tag := range strings.Split(strings.TrimPrefix(header, "DKIM-Signature: "), "; ") {
+				kv := strings.SplitN(tag, "=", 2)
+				tags[kv[0]] = kv[1]
+			}
+			assert.Equal(t, algorithm, tags["a"])
+			assert.Equal(t, "ory.sh", tags["d"])
+			assert.Equal(t, "kratos", tags["s"])
+			assert.Equal(t, "1600000000", tags["t"])
+			assert.Contains(t, tags["h"], "from:to:subject")
+
+			// Verify the signature like a receiving server would.
+			raw := b.Bytes()
+			split := bytes.Index(raw, []byte("\r\n\r\n"))
+			bodyHash := sha256.Sum256(dkimRelaxedBody(raw[split+4:]))
+			assert.Equal(t, base64.StdEncoding.EncodeToString(bodyHash[:]), tags["bh"])
+
+			headers := dkimHeaders(raw[:split+2])
+			var canonical bytes.Buffer
+			for _, name := range strings.Split(tags["h"], ":") {
+				canonical.WriteString(dkimRelaxedHeader(name, headers[name]) + "\r\n")
+			}
+			unsigned := header[:strings.LastIndex(header, "; b=")+len("; b=")]
+			canonical.WriteString(dkimRelaxedHeader("DKIM-Signature", strings.TrimPrefix(unsigned, "DKIM-Signature:")))
+			hash := sha256.Sum256(canonical.Bytes())
+
+			sig, err := base64.StdEncoding.DecodeString(tags["b"])
+			require.NoError(t, err)
+			switch k := key.Public().(type) {
+			case *rsa.PublicKey:
+				assert.NoError(t, rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig))
+			case ed25519.PublicKey:
+				assert.True(t, ed25519.Verify(k, hash[:], sig))
+			}
+		})
+	}
+}
+
+func TestCourierSign(t *testing.T) {
+	defer viper.Set(configuration.ViperKeyCourierDKIMKeys, nil)
+	m := &Courier{c: configuration.NewViperProvider(logrus.New(), true)}
+
+	gm := gomail.NewMessage()
+	gm.SetHeader("From", "ORY <noreply@ory.sh>")
+	gm.SetHeader("To", "foo@ory.sh")
+	gm.SetBody("text/plain", "body")
+
+	raw, err := m.sign(gm, "noreply@ory.sh")
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "DKIM-Signature", "emails are not signed without keys")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	viper.Set(configuration.ViperKeyCourierDKIMKeys, []map[string]interface{}{{
+		"selector":    "kratos",
+		"private_key": string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}})
+
+	raw, err = m.sign(gm, "noreply@ory.sh")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(raw), "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=ory.sh; s=kratos; "), "%s", raw)
+}
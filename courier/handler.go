@@ -0,0 +1,207 @@
+package courier
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/pagination"
+
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	MessagesPath   = "/courier/messages"
+	MessagesUIPath = "/courier/messages/ui"
+)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		Provider
+		cipher.Provider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		CourierHandler() *Handler
+	}
+	Handler struct {
+		d handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(d handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{d: d, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(MessagesPath, h.list)
+	admin.GET(MessagesUIPath, h.ui)
+	admin.POST(TemplatesPath+"/:type/preview", h.previewTemplate)
+	admin.POST(TemplatesPath+"/:type/send", h.sendTemplate)
+}
+
+// CapturedMessage is an email or a text message which was captured instead of sent. Text messages have no subject.
+//
+// swagger:model capturedMessage
+type CapturedMessage struct {
+	// required: true
+	ID uuid.UUID `json:"id"`
+
+	// required: true
+	Recipient string `json:"recipient"`
+
+	// required: true
+	Subject string `json:"subject"`
+
+	// required: true
+	Body string `json:"body"`
+
+	// Links are the URLs found in the body, for example verification links.
+	//
+	// required: true
+	Links []string `json:"links"`
+
+	// required: true
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var linkPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+func newCapturedMessage(m *Message, body string) CapturedMessage {
+	links := linkPattern.FindAllString(body, -1)
+	if links == nil {
+		links = []string{}
+	}
+	return CapturedMessage{
+		ID:        m.ID,
+		Recipient: m.Recipient,
+		Subject:   m.Subject,
+		Body:      body,
+		Links:     links,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// A list of captured messages.
+// swagger:response capturedMessageList
+// nolint:deadcode,unused
+type capturedMessageListResponse struct {
+	// in: body
+	Body []CapturedMessage
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listCapturedMessages
+type listCapturedMessagesParameters struct {
+	// in: query
+	Limit int `json:"limit"`
+
+	// in: query
+	Offset int `json:"offset"`
+}
+
+// swagger:route GET /courier/messages admin listCapturedMessages
+//
+// List captured messages
+//
+// If `courier.capture` is enabled, emails are not sent but captured for local development. This endpoint lists
+// them, newest first. A page listing the messages with clickable links is served at `/courier/messages/ui`.
+//
+// This endpoint returns 404 if `courier.capture` is disabled.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: capturedMessageList
+//       404: genericError
+//       500: genericError
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	messages, err := h.capturedMessages(r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.d.Writer().Write(w, r, messages)
+}
+
+func (h *Handler) capturedMessages(r *http.Request) ([]CapturedMessage, error) {
+	if !h.c.CourierCapture() {
+		return nil, errors.WithStack(herodot.ErrNotFound.WithReason("Capturing messages is disabled, set courier.capture to true to enable it."))
+	}
+
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	ms, err := h.d.CourierPersister().CapturedMessages(r.Context(), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]CapturedMessage, len(ms))
+	for k := range ms {
+		body, err := ms[k].PlaintextBody(h.d.Cipher())
+		if err != nil {
+			// Happens if the cipher secrets changed, for example because they are generated on every start.
+			x.ContextLogger(r.Context(), h.d.Logger()).
+				WithError(err).
+				WithField("message_id", ms[k].ID).
+				Warn("Unable to decrypt the body of a captured message.")
+		}
+		out[k] = newCapturedMessage(&ms[k], body)
+	}
+	return out, nil
+}
+
+var messagesUI = template.Must(template.New("messages").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Captured messages - ORY Kratos</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; }
+article { border: 1px solid #ddd; border-radius: 4px; margin-bottom: 1em; padding: 0 1em; }
+pre { white-space: pre-wrap; background: #f7f7f7; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>Captured messages</h1>
+{{ range . }}
+<article>
+<h2>{{ .Subject }}</h2>
+<p>To {{ .Recipient }} at {{ .CreatedAt.Format "2006-01-02 15:04:05 MST" }}</p>
+{{ if .Links }}<ul>{{ range .Links }}<li><a href="{{ . }}">{{ . }}</a></li>{{ end }}</ul>{{ end }}
+<details><summary>Body</summary><pre>{{ .Body }}</pre></details>
+</article>
+{{ else }}
+<p>No messages were captured yet.</p>
+{{ end }}
+</body>
+</html>
+`))
+
+func (h *Handler) ui(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	messages, err := h.capturedMessages(r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := messagesUI.Execute(w, messages); err != nil {
+		x.ContextLogger(r.Context(), h.d.Logger()).WithError(err).Error("Unable to render the captured messages.")
+	}
+}
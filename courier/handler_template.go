@@ -0,0 +1,196 @@
+package courier
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+
+	"github.com/ory/kratos/courier/template"
+)
+
+const (
+	TemplatesPath = "/courier/templates"
+
+	// previewRecipient is the recipient of previews which do not set one.
+	previewRecipient = "preview@example.org"
+)
+
+// TemplatePayload is the data a template is rendered with.
+//
+// swagger:model courierTemplatePayload
+type TemplatePayload struct {
+	// To is the recipient of the email. It is required to send the email.
+	To string `json:"to"`
+
+	// Context replaces the sample data the template is rendered with. The keys are the names of the template
+	// variables, for example `{"Code":"654321","Locale":"de"}`. The recipient can only be set using `to`.
+	Context json.RawMessage `json:"context,omitempty"`
+}
+
+// TemplatePreview is a rendered template.
+//
+// swagger:model courierTemplatePreview
+type TemplatePreview struct {
+	// required: true
+	Recipient string `json:"recipient"`
+
+	// required: true
+	Subject string `json:"subject"`
+
+	// required: true
+	Body string `json:"body"`
+
+	// Context is the data the template was rendered with, including the sample data.
+	//
+	// required: true
+	Context interface{} `json:"context"`
+
+	// MessageID is the ID of the queued message. It is only set if the template was sent.
+	MessageID *uuid.UUID `json:"message_id,omitempty"`
+}
+
+// A rendered template.
+//
+// swagger:response courierTemplatePreview
+// nolint:deadcode,unused
+type templatePreviewResponse struct {
+	// in: body
+	Body TemplatePreview
+}
+
+// nolint:deadcode,unused
+// swagger:parameters previewCourierTemplate sendCourierTemplate
+type templateParameters struct {
+	// Type is the template type, for example `verify_valid` or `login_code`.
+	//
+	// required: true
+	// in: path
+	Type string `json:"type"`
+
+	// in: body
+	Body TemplatePayload
+}
+
+// swagger:route POST /courier/templates/{type}/preview admin previewCourierTemplate
+//
+// Render a template
+//
+// Renders the template with sample data, or with the data set in `context`, without sending it. Templates are
+// loaded from `courier.template_override_path` again for every preview, so that changes to them show up right
+// away.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: courierTemplatePreview
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) previewTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	p, err := h.decodeTemplatePayload(r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+	if len(p.To) == 0 {
+		p.To = previewRecipient
+	}
+
+	_, preview, err := h.renderTemplate(ps.ByName("type"), p)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.d.Writer().Write(w, r, preview)
+}
+
+// swagger:route POST /courier/templates/{type}/send admin sendCourierTemplate
+//
+// Send a template to a recipient
+//
+// Renders the template like the preview does and queues the email to `to`, so that it can be checked in email
+// clients. If `courier.capture` is enabled, the email is captured instead.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       202: courierTemplatePreview
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) sendTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	p, err := h.decodeTemplatePayload(r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+	if len(p.To) == 0 {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The recipient must be set.")))
+		return
+	}
+
+	t, preview, err := h.renderTemplate(ps.ByName("type"), p)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	id, err := h.d.Courier().QueueEmail(r.Context(), t)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	preview.MessageID = &id
+	h.d.Writer().WriteCode(w, r, http.StatusAccepted, preview)
+}
+
+func (h *Handler) decodeTemplatePayload(r *http.Request) (*TemplatePayload, error) {
+	var p TemplatePayload
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&p); err == io.EOF {
+		// Previews can be requested without a body.
+		return &p, nil
+	} else if err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err))
+	}
+	return &p, nil
+}
+
+func (h *Handler) renderTemplate(templateType string, p *TemplatePayload) (EmailTemplate, *TemplatePreview, error) {
+	t, model, err := template.NewPreview(h.c, templateType, p.To, p.Context)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subject, err := t.EmailSubject()
+	if err != nil {
+		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to render the subject: %s", err))
+	}
+
+	body, err := t.EmailBody()
+	if err != nil {
+		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to render the body: %s", err))
+	}
+
+	return t, &TemplatePreview{Recipient: p.To, Subject: subject, Body: body, Context: model}, nil
+}
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+
+	"github.com/ory/kratos/cipher"
 )
 
 type MessageStatus int
@@ -11,12 +13,21 @@ type MessageStatus int
 const (
 	MessageStatusQueued MessageStatus = iota + 1
 	MessageStatusSent
+	// MessageStatusCaptured marks emails which were not sent because the courier captures messages, see
+	// configuration key courier.capture.
+	MessageStatusCaptured
+	// MessageStatusFailed marks messages which can not be delivered, for example because their body can not
+	// be decrypted with the configured secrets or every attempt to deliver them failed. They are not retried.
+	MessageStatusFailed
 )
 
 type MessageType int
 
 const (
 	MessageTypeEmail MessageType = iota + 1
+	MessageTypeBackChannelLogout
+	// MessageTypeSMS is a text message, which is delivered to courier.sms.url.
+	MessageTypeSMS
 )
 
 type Message struct {
@@ -27,6 +38,25 @@ type Message struct {
 	Body      string        `json:"-" db:"body"`
 	Subject   string        `json:"-" db:"subject"`
 
+	// RequestID is the ID of the request which queued the message. It correlates the delivery logs and
+	// the request to the back-channel logout endpoint with that request.
+	RequestID string `json:"-" db:"request_id"`
+
+	// Category is the category of the email, see EmailTemplate.EmailCategory. It selects the SMTP servers the
+	// email is sent with.
+	Category string `json:"-" db:"category"`
+
+	// BodyEncrypted is true if Body is encrypted with the cipher secrets. Bodies contain recovery links,
+	// tokens and personal data, so they are encrypted when the message is queued, see PlaintextBody.
+	BodyEncrypted bool `json:"-" faker:"-" db:"body_encrypted"`
+
+	// SendCount is the number of failed attempts to deliver the message.
+	SendCount int `json:"-" faker:"-" db:"send_count"`
+
+	// NextAttemptAt is the time (UTC) before which a message is not delivered again after a failed attempt. It is
+	// empty for messages which were not tried yet.
+	NextAttemptAt *time.Time `json:"-" faker:"-" db:"next_attempt_at"`
+
 	// CreatedAt is a helper struct field for gobuffalo.pop.
 	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
 	// UpdatedAt is a helper struct field for gobuffalo.pop.
@@ -36,3 +66,16 @@ type Message struct {
 func (m Message) TableName() string {
 	return "courier_messages"
 }
+
+// PlaintextBody returns the decrypted body of the message.
+func (m *Message) PlaintextBody(c cipher.Cipher) (string, error) {
+	if !m.BodyEncrypted {
+		return m.Body, nil
+	}
+
+	body, err := c.Decrypt(m.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -18,13 +18,26 @@ var ErrQueueEmpty = errors.New("queue is empty")
 
 type (
 	Persister interface {
+		// AddMessage queues the message. Its body is encrypted with the cipher secrets before it is stored,
+		// so Body and BodyEncrypted of the message change.
 		AddMessage(context.Context, *Message) error
 
 		NextMessages(context.Context, uint8) ([]Message, error)
 
 		SetMessageStatus(context.Context, uuid.UUID, MessageStatus) error
 
+		// SetMessageNextAttempt records a failed attempt to deliver the message. NextMessages does not return the
+		// message before nextAttemptAt.
+		SetMessageNextAttempt(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time) error
+
 		LatestQueuedMessage(ctx context.Context) (*Message, error)
+
+		// CapturedMessages returns the captured messages, newest first.
+		CapturedMessages(ctx context.Context, limit, offset int) ([]Message, error)
+
+		// EncryptMessages encrypts the bodies of up to limit messages which were stored in plaintext and
+		// returns how many it has encrypted.
+		EncryptMessages(ctx context.Context, limit int) (int, error)
 	}
 
 	PersistenceProvider interface {
@@ -47,7 +60,11 @@ func TestPersister(p Persister) func(t *testing.T) {
 		t.Run("case=add messages to the queue", func(t *testing.T) {
 			for k, m := range messages {
 				require.NoError(t, faker.FakeData(&m))
+				m.RequestID = fmt.Sprintf("request-%d", k)
+				body := m.Body
 				require.NoError(t, p.AddMessage(context.Background(), &m))
+				assert.True(t, m.BodyEncrypted)
+				assert.NotEqual(t, body, m.Body, "the body must be encrypted at rest")
 				messages[k] = m
 				time.Sleep(time.Second) // wait a bit so that the timestamp ordering works in MySQL.
 			}
@@ -73,9 +90,11 @@ func TestPersister(p Persister) func(t *testing.T) {
 					assert.Equal(t, expected.ID, actual.ID)
 					assert.Equal(t, expected.Subject, actual.Subject)
 					assert.Equal(t, expected.Body, actual.Body)
+					assert.Equal(t, expected.BodyEncrypted, actual.BodyEncrypted)
 					assert.Equal(t, expected.Status, actual.Status)
 					assert.Equal(t, expected.Type, actual.Type)
 					assert.Equal(t, expected.Recipient, actual.Recipient)
+					assert.Equal(t, expected.RequestID, actual.RequestID)
 
 					require.NoError(t, p.SetMessageStatus(context.Background(), actual.ID, MessageStatusSent))
 				})
@@ -96,5 +115,50 @@ func TestPersister(p Persister) func(t *testing.T) {
 			_, err = p.NextMessages(context.Background(), 1)
 			require.EqualError(t, err, ErrQueueEmpty.Error())
 		})
+
+		t.Run("case=captured messages", func(t *testing.T) {
+			captured, err := p.CapturedMessages(context.Background(), 10, 0)
+			require.NoError(t, err)
+			assert.Len(t, captured, 0)
+
+			require.NoError(t, p.SetMessageStatus(context.Background(), messages[0].ID, MessageStatusCaptured))
+			require.NoError(t, p.SetMessageStatus(context.Background(), messages[1].ID, MessageStatusCaptured))
+
+			captured, err = p.CapturedMessages(context.Background(), 10, 0)
+			require.NoError(t, err)
+			require.Len(t, captured, 2)
+			assert.Equal(t, messages[1].ID, captured[0].ID, "the newest message must be returned first")
+			assert.Equal(t, messages[0].ID, captured[1].ID)
+
+			_, err = p.NextMessages(context.Background(), 1)
+			require.EqualError(t, err, ErrQueueEmpty.Error(), "captured messages must not be delivered")
+		})
+
+		t.Run("case=next attempt", func(t *testing.T) {
+			var m Message
+			require.NoError(t, faker.FakeData(&m))
+			require.NoError(t, p.AddMessage(context.Background(), &m))
+
+			require.NoError(t, p.SetMessageNextAttempt(context.Background(), m.ID, time.Now().Add(time.Hour)))
+			_, err := p.NextMessages(context.Background(), 10)
+			require.EqualError(t, err, ErrQueueEmpty.Error(), "messages are not delivered before their next attempt")
+
+			require.NoError(t, p.SetMessageNextAttempt(context.Background(), m.ID, time.Now().Add(-time.Minute)))
+			ms, err := p.NextMessages(context.Background(), 10)
+			require.NoError(t, err)
+			require.Len(t, ms, 1)
+			assert.Equal(t, m.ID, ms[0].ID)
+			assert.Equal(t, 2, ms[0].SendCount)
+
+			require.NoError(t, p.SetMessageStatus(context.Background(), m.ID, MessageStatusFailed))
+			_, err = p.NextMessages(context.Background(), 10)
+			require.EqualError(t, err, ErrQueueEmpty.Error(), "failed messages are not delivered")
+		})
+
+		t.Run("case=encrypt messages", func(t *testing.T) {
+			count, err := p.EncryptMessages(context.Background(), 10)
+			require.NoError(t, err)
+			assert.Equal(t, 0, count, "messages added to the queue are encrypted already")
+		})
 	}
 }
@@ -0,0 +1,211 @@
+package courier
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/gomail.v2"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	// smtpServer is an SMTP server the courier sends emails with. It keeps track of its failures, so that servers
+	// which fail repeatedly are skipped for a while.
+	smtpServer struct {
+		dialer *gomail.Dialer
+
+		sync.Mutex
+		failures       int
+		unhealthyUntil time.Time
+	}
+
+	// smtpRoute sends the emails of the categories using the servers, which are tried in order.
+	smtpRoute struct {
+		categories []string
+		servers    []*smtpServer
+	}
+)
+
+func newSMTPServer(uri *url.URL) *smtpServer {
+	sslSkipVerify, _ := strconv.ParseBool(uri.Query().Get("skip_ssl_verify"))
+	password, _ := uri.User.Password()
+	port, _ := strconv.ParseInt(uri.Port(), 10, 64)
+	return &smtpServer{
+		dialer: &gomail.Dialer{
+			Host:     uri.Hostname(),
+			Port:     int(port),
+			Username: uri.User.Username(),
+			Password: password,
+			SSL:      uri.Scheme == "smtps",
+			/* #nosec we need to support SMTP servers wihout TLS */
+			TLSConfig: &tls.Config{InsecureSkipVerify: sslSkipVerify},
+		},
+	}
+}
+
+func newSMTPServers(uris []*url.URL) []*smtpServer {
+	servers := make([]*smtpServer, len(uris))
+	for k, uri := range uris {
+		servers[k] = newSMTPServer(uri)
+	}
+	return servers
+}
+
+func (s *smtpServer) address() string {
+	return net.JoinHostPort(s.dialer.Host, strconv.Itoa(s.dialer.Port))
+}
+
+func (s *smtpServer) healthy(now time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+	return !now.Before(s.unhealthyUntil)
+}
+
+// report records whether sending an email succeeded. The server is marked unhealthy once it failed to send
+// UnhealthyAfter emails in a row.
+func (s *smtpServer) report(err error, health *configuration.CourierSMTPHealthConfig) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err == nil {
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if health.UnhealthyAfter > 0 && s.failures >= health.UnhealthyAfter {
+		s.unhealthyUntil = time.Now().Add(health.UnhealthyFor)
+	}
+}
+
+// smtpServers returns the servers which send emails of the category, healthy ones first.
+func (m *Courier) smtpServers(category string) []*smtpServer {
+	servers := m.servers
+	if len(category) > 0 {
+	routes:
+		for _, r := range m.routes {
+			for _, c := range r.categories {
+				if c == category {
+					servers = r.servers
+					break routes
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	ordered := make([]*smtpServer, 0, len(servers))
+	var unhealthy []*smtpServer
+	for _, s := range servers {
+		if s.healthy(now) {
+			ordered = append(ordered, s)
+		} else {
+			unhealthy = append(unhealthy, s)
+		}
+	}
+
+	// Unhealthy servers are still tried if all healthy ones fail, the email might get through after all.
+	return append(ordered, unhealthy...)
+}
+
+// sendSMTP signs the email and sends it using the servers of the category. If a server fails, the next one is
+// tried.
+func (m *Courier) sendSMTP(l logrus.FieldLogger, category string, gm *gomail.Message) error {
+	from, to, err := envelope(gm)
+	if err != nil {
+		return err
+	}
+
+	raw, err := m.sign(gm, from)
+	if err != nil {
+		return err
+	}
+
+	health := m.c.CourierSMTPHealth()
+	for _, s := range m.smtpServers(category) {
+		err = s.send(from, to, raw)
+		s.report(err, health)
+		if err == nil {
+			return nil
+		}
+
+		l.
+			WithError(err).
+			WithField("smtp_server", s.address()).
+			WithField("smtp_ssl_enabled", s.dialer.SSL).
+			WithField("message_category", category).
+			Warn("Unable to send email using SMTP server.")
+	}
+	return err
+}
+
+func (s *smtpServer) send(from string, to []string, raw []byte) error {
+	sc, err := s.dialer.Dial()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := sc.Send(from, to, bytes.NewReader(raw)); err != nil {
+		_ = sc.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(sc.Close())
+}
+
+// sign serializes the email and signs it with the active DKIM key, if one is configured.
+func (m *Courier) sign(gm *gomail.Message, from string) ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := gm.WriteTo(&b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	now := time.Now()
+	c := m.c.CourierDKIM()
+	key := c.ActiveKey(now)
+	if key == nil {
+		return b.Bytes(), nil
+	}
+
+	signer, err := key.Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	domain := c.Domain
+	if len(domain) == 0 {
+		domain = from[strings.LastIndex(from, "@")+1:]
+	}
+	return dkimSign(b.Bytes(), domain, key.Selector, signer, now)
+}
+
+// envelope returns the addresses of the sender and the recipients.
+func envelope(gm *gomail.Message) (from string, to []string, err error) {
+	froms := gm.GetHeader("From")
+	if len(froms) == 0 {
+		return "", nil, errors.New("the email has no sender")
+	}
+
+	sender, err := mail.ParseAddress(froms[0])
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+
+	for _, raw := range gm.GetHeader("To") {
+		recipient, err := mail.ParseAddress(raw)
+		if err != nil {
+			return "", nil, errors.WithStack(err)
+		}
+		to = append(to, recipient.Address)
+	}
+	return sender.Address, to, nil
+}
@@ -0,0 +1,141 @@
+package courier
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/gomail.v2"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+// newFakeSMTPServer starts an SMTP server which accepts all emails and sends their subjects to the channel.
+func newFakeSMTPServer(t *testing.T) (*url.URL, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	subjects := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+				reply("220 fake")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "DATA"):
+						reply("354 go ahead")
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+							if strings.HasPrefix(line, "Subject: ") {
+								subjects <- strings.TrimSpace(strings.TrimPrefix(line, "Subject: "))
+							}
+						}
+						reply("250 queued")
+					case strings.HasPrefix(cmd, "QUIT"):
+						reply("221 bye")
+						return
+					default:
+						reply("250 ok")
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return &url.URL{Scheme: "smtp", Host: l.Addr().String()}, subjects
+}
+
+func newDeadSMTPServer(t *testing.T) *url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	return &url.URL{Scheme: "smtp", Host: l.Addr().String()}
+}
+
+func TestSMTPFailover(t *testing.T) {
+	viper.Set(configuration.ViperKeyCourierSMTPUnhealthyAfter, 1)
+	viper.Set(configuration.ViperKeyCourierSMTPUnhealthyFor, "1h")
+	defer viper.Set(configuration.ViperKeyCourierSMTPUnhealthyAfter, nil)
+	defer viper.Set(configuration.ViperKeyCourierSMTPUnhealthyFor, nil)
+
+	dead := newDeadSMTPServer(t)
+	primary, primarySubjects := newFakeSMTPServer(t)
+	transactional, transactionalSubjects := newFakeSMTPServer(t)
+
+	m := &Courier{
+		c:       configuration.NewViperProvider(logrus.New(), true),
+		servers: newSMTPServers([]*url.URL{dead, primary}),
+		routes:  []smtpRoute{{categories: []string{"verification"}, servers: newSMTPServers([]*url.URL{transactional})}},
+	}
+	l := logrus.New()
+
+	send := func(category, subject string) error {
+		gm := gomail.NewMessage()
+		gm.SetHeader("From", "noreply@ory.sh")
+		gm.SetHeader("To", "foo@ory.sh")
+		gm.SetHeader("Subject", subject)
+		gm.SetBody("text/plain", "body")
+		return m.sendSMTP(l, category, gm)
+	}
+
+	receive := func(t *testing.T, subjects chan string) string {
+		select {
+		case s := <-subjects:
+			return s
+		case <-time.After(5 * time.Second):
+			t.Fatal("the email was not received")
+			return ""
+		}
+	}
+
+	t.Run("case=fails over to the next server", func(t *testing.T) {
+		require.NoError(t, send("", "failover"))
+		assert.Equal(t, "failover", receive(t, primarySubjects))
+
+		servers := m.smtpServers("")
+		require.Len(t, servers, 2)
+		assert.Equal(t, m.servers[1], servers[0], "the failed server is tried last")
+	})
+
+	t.Run("case=routes categories", func(t *testing.T) {
+		require.NoError(t, send("verification", "routed"))
+		assert.Equal(t, "routed", receive(t, transactionalSubjects))
+
+		require.NoError(t, send("notification", "unrouted"))
+		assert.Equal(t, "unrouted", receive(t, primarySubjects))
+	})
+
+	t.Run("case=fails if all servers fail", func(t *testing.T) {
+		m.routes = []smtpRoute{{categories: []string{"verification"}, servers: newSMTPServers([]*url.URL{dead})}}
+		assert.Error(t, send("verification", "lost"))
+	})
+}
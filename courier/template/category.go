@@ -0,0 +1,10 @@
+package template
+
+// The categories of emails. The courier can send each category using other SMTP servers, see
+// courier.smtp.routes.
+const (
+	CategoryVerification = "verification"
+	CategoryCode         = "code"
+	CategoryNotification = "notification"
+	CategoryInvitation   = "invitation"
+)
@@ -0,0 +1,40 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	Invitation struct {
+		c configuration.Provider
+		m *InvitationModel
+	}
+	InvitationModel struct {
+		To        string
+		URL       string
+		ExpiresAt time.Time
+		Locale    string
+	}
+)
+
+func NewInvitation(c configuration.Provider, m *InvitationModel) *Invitation {
+	return &Invitation{c: c, m: m}
+}
+
+func (t *Invitation) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *Invitation) EmailCategory() string {
+	return CategoryInvitation
+}
+
+func (t *Invitation) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "invitation/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *Invitation) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "invitation/email.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,29 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestInvitation(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	tpl := template.NewInvitation(conf, &template.InvitationModel{
+		URL:       "https://www.ory.sh/registration?invitation=token",
+		ExpiresAt: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "https://www.ory.sh/registration?invitation=token")
+	assert.Contains(t, rendered, "2020-03-01")
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+}
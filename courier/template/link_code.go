@@ -0,0 +1,38 @@
+package template
+
+import (
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	LinkCode struct {
+		c configuration.Provider
+		m *LinkCodeModel
+	}
+	LinkCodeModel struct {
+		To       string
+		Code     string
+		Provider string
+		Locale   string
+	}
+)
+
+func NewLinkCode(c configuration.Provider, m *LinkCodeModel) *LinkCode {
+	return &LinkCode{c: c, m: m}
+}
+
+func (t *LinkCode) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *LinkCode) EmailCategory() string {
+	return CategoryCode
+}
+
+func (t *LinkCode) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "link/code/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *LinkCode) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "link/code/email.body.gotmpl"), t.m.Locale), t.m)
+}
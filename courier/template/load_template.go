@@ -2,19 +2,63 @@ package template
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/gobuffalo/packr/v2"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/fetcher"
 )
 
 var box = packr.New("templates", "templates")
 var cache, _ = lru.New(16)
 
+// templatePath returns the path of the template in the override directory root. The root may be a remote URL such
+// as https://config.example.org/kratos/templates.
+func templatePath(root, name string) string {
+	if fetcher.IsRemote(root) {
+		return strings.TrimRight(root, "/") + "/" + name
+	}
+	return filepath.Join(root, name)
+}
+
+// localizedPath returns the path of the template's translation to the locale, for example
+// `verify/valid/email.body.de.gotmpl`. If no such template exists, the translation to the locale's base language
+// is tried and, failing that, the path is returned as is.
+func localizedPath(path, locale string) string {
+	if len(locale) == 0 {
+		return path
+	}
+
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+
+	for _, l := range candidates {
+		localized := strings.TrimSuffix(path, ".gotmpl") + "." + l + ".gotmpl"
+		if box.Has(localized) {
+			return localized
+		}
+		if fetcher.IsRemote(localized) {
+			if _, err := fetcher.Default.Fetch(context.Background(), localized); err == nil {
+				return localized
+			}
+		} else if _, err := os.Stat(localized); err == nil {
+			return localized
+		}
+	}
+
+	return path
+}
+
 func loadTextTemplate(path string, model interface{}) (string, error) {
 	var b bytes.Buffer
 
@@ -26,7 +70,14 @@ func loadTextTemplate(path string, model interface{}) (string, error) {
 		return tb.String(), nil
 	}
 
-	if file, err := box.Open(path); err == nil {
+	remote := fetcher.IsRemote(path)
+	if remote {
+		body, err := fetcher.Default.Fetch(context.Background(), path)
+		if err != nil {
+			return "", err
+		}
+		b.Write(body)
+	} else if file, err := box.Open(path); err == nil {
 		defer file.Close()
 		if _, err := io.Copy(&b, file); err != nil {
 			return "", errors.WithStack(err)
@@ -47,7 +98,10 @@ func loadTextTemplate(path string, model interface{}) (string, error) {
 		return "", errors.WithStack(err)
 	}
 
-	_ = cache.Add(path, t)
+	// Remote templates are not cached here because the fetcher caches them and refreshes them when they change.
+	if !remote {
+		_ = cache.Add(path, t)
+	}
 	var tb bytes.Buffer
 	if err := t.ExecuteTemplate(&tb, path, model); err != nil {
 		return "", errors.WithStack(err)
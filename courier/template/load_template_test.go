@@ -2,6 +2,8 @@ package template
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -33,4 +35,49 @@ func TestLoadTextTemplate(t *testing.T) {
 		require.NoError(t, os.RemoveAll(fp))
 		assert.Contains(t, executeTemplate(t, fp), "cached stub body")
 	})
+
+	t.Run("method=from remote", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/templates/email.body.gotmpl":
+				_, _ = w.Write([]byte("remote stub body {{ .Name }}"))
+			case "/templates/email.body.fr.gotmpl":
+				_, _ = w.Write([]byte("corps"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer ts.Close()
+
+		fp := templatePath(ts.URL+"/templates/", "email.body.gotmpl")
+		assert.Equal(t, ts.URL+"/templates/email.body.gotmpl", fp)
+
+		actual, err := loadTextTemplate(fp, map[string]string{"Name": "foo"})
+		require.NoError(t, err)
+		assert.Equal(t, "remote stub body foo", actual)
+
+		assert.Equal(t, ts.URL+"/templates/email.body.fr.gotmpl", localizedPath(fp, "fr"))
+		assert.Equal(t, fp, localizedPath(fp, "de"))
+	})
+}
+
+func TestLocalizedPath(t *testing.T) {
+	t.Run("method=from bundled", func(t *testing.T) {
+		assert.Equal(t, "verify/valid/email.body.de.gotmpl", localizedPath("verify/valid/email.body.gotmpl", "de"))
+		assert.Equal(t, "verify/valid/email.body.de.gotmpl", localizedPath("verify/valid/email.body.gotmpl", "de-at"))
+		assert.Equal(t, "verify/valid/email.body.gotmpl", localizedPath("verify/valid/email.body.gotmpl", "fr"))
+		assert.Equal(t, "verify/valid/email.body.gotmpl", localizedPath("verify/valid/email.body.gotmpl", ""))
+	})
+
+	t.Run("method=from override path", func(t *testing.T) {
+		dir := filepath.Join(os.TempDir(), x.NewUUID().String())
+		require.NoError(t, os.MkdirAll(dir, 0700))
+		defer os.RemoveAll(dir)
+
+		fp := filepath.Join(dir, "email.body.gotmpl")
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "email.body.fr.gotmpl"), bytes.NewBufferString("corps")))
+
+		assert.Equal(t, filepath.Join(dir, "email.body.fr.gotmpl"), localizedPath(fp, "fr"))
+		assert.Equal(t, fp, localizedPath(fp, "de"))
+	})
 }
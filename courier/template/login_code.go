@@ -0,0 +1,38 @@
+package template
+
+import (
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	LoginCode struct {
+		c configuration.Provider
+		m *LoginCodeModel
+	}
+	LoginCodeModel struct {
+		To               string
+		Code             string
+		ExpiresInMinutes int
+		Locale           string
+	}
+)
+
+func NewLoginCode(c configuration.Provider, m *LoginCodeModel) *LoginCode {
+	return &LoginCode{c: c, m: m}
+}
+
+func (t *LoginCode) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *LoginCode) EmailCategory() string {
+	return CategoryCode
+}
+
+func (t *LoginCode) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "login/code/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *LoginCode) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "login/code/email.body.gotmpl"), t.m.Locale), t.m)
+}
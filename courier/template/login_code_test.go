@@ -0,0 +1,29 @@
+package template_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestLoginCode(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	tpl := template.NewLoginCode(conf, &template.LoginCodeModel{To: "foo@ory.sh", Code: "123456", ExpiresInMinutes: 10})
+
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "123456")
+	assert.Contains(t, rendered, "10 minutes")
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+
+	to, err := tpl.EmailRecipient()
+	require.NoError(t, err)
+	assert.Equal(t, "foo@ory.sh", to)
+}
@@ -0,0 +1,51 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	AccountRecoveredNotification struct {
+		c configuration.Provider
+		m *AccountRecoveredNotificationModel
+	}
+	AccountRecoveredNotificationModel struct {
+		To   string
+		Time time.Time
+
+		// RevertURL undoes the recovery until RevertExpiresAt.
+		RevertURL       string
+		RevertExpiresAt time.Time
+		Locale          string
+	}
+)
+
+func NewAccountRecoveredNotification(c configuration.Provider, m *AccountRecoveredNotificationModel) *AccountRecoveredNotification {
+	return &AccountRecoveredNotification{c: c, m: m}
+}
+
+func (t *AccountRecoveredNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *AccountRecoveredNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *AccountRecoveredNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/account_recovered/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *AccountRecoveredNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/account_recovered/email.body.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *AccountRecoveredNotification) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *AccountRecoveredNotification) SMSBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/account_recovered/sms.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,33 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestAccountRecoveredNotification(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	tpl := template.NewAccountRecoveredNotification(conf, &template.AccountRecoveredNotificationModel{
+		Time:            time.Now(),
+		RevertURL:       "https://www.ory.sh/revert",
+		RevertExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "https://www.ory.sh/revert")
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+
+	rendered, err = tpl.SMSBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "https://www.ory.sh/revert")
+}
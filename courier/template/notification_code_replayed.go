@@ -0,0 +1,49 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	CodeReplayedNotification struct {
+		c configuration.Provider
+		m *CodeReplayedNotificationModel
+	}
+	CodeReplayedNotificationModel struct {
+		To string
+
+		// RedeemedAt, RedeemedIPAddress, and RedeemedUserAgent describe the client which redeemed the code first.
+		RedeemedAt        time.Time
+		RedeemedIPAddress string
+		RedeemedUserAgent string
+
+		// Time, IPAddress, and UserAgent describe the client which redeemed the code again.
+		Time      time.Time
+		IPAddress string
+		UserAgent string
+
+		Locale string
+	}
+)
+
+func NewCodeReplayedNotification(c configuration.Provider, m *CodeReplayedNotificationModel) *CodeReplayedNotification {
+	return &CodeReplayedNotification{c: c, m: m}
+}
+
+func (t *CodeReplayedNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *CodeReplayedNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *CodeReplayedNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/code_replayed/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *CodeReplayedNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/code_replayed/email.body.gotmpl"), t.m.Locale), t.m)
+}
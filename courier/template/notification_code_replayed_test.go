@@ -0,0 +1,34 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestCodeReplayedNotification(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	tpl := template.NewCodeReplayedNotification(conf, &template.CodeReplayedNotificationModel{
+		RedeemedAt:        time.Now().Add(-time.Minute),
+		RedeemedIPAddress: "192.0.2.1",
+		RedeemedUserAgent: "Mozilla/5.0",
+		Time:              time.Now(),
+		IPAddress:         "198.51.100.7",
+		UserAgent:         "curl/7.68.0",
+	})
+
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "192.0.2.1")
+	assert.Contains(t, rendered, "198.51.100.7")
+	assert.Contains(t, rendered, "curl/7.68.0")
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+}
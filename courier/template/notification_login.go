@@ -0,0 +1,41 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	LoginNotification struct {
+		c configuration.Provider
+		m *LoginNotificationModel
+	}
+	LoginNotificationModel struct {
+		To        string
+		IPAddress string
+		UserAgent string
+		Time      time.Time
+		Locale    string
+	}
+)
+
+func NewLoginNotification(c configuration.Provider, m *LoginNotificationModel) *LoginNotification {
+	return &LoginNotification{c: c, m: m}
+}
+
+func (t *LoginNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *LoginNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *LoginNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/login/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *LoginNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/login/email.body.gotmpl"), t.m.Locale), t.m)
+}
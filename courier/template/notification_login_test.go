@@ -0,0 +1,30 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestLoginNotification(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	tpl := template.NewLoginNotification(conf, &template.LoginNotificationModel{
+		IPAddress: "192.0.2.1",
+		UserAgent: "Mozilla/5.0",
+		Time:      time.Now(),
+	})
+
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "192.0.2.1")
+	assert.Contains(t, rendered, "Mozilla/5.0")
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+}
@@ -0,0 +1,39 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	PasswordChangedNotification struct {
+		c configuration.Provider
+		m *PasswordChangedNotificationModel
+	}
+	PasswordChangedNotificationModel struct {
+		To     string
+		Time   time.Time
+		Locale string
+	}
+)
+
+func NewPasswordChangedNotification(c configuration.Provider, m *PasswordChangedNotificationModel) *PasswordChangedNotification {
+	return &PasswordChangedNotification{c: c, m: m}
+}
+
+func (t *PasswordChangedNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *PasswordChangedNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *PasswordChangedNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/password_changed/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *PasswordChangedNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/password_changed/email.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,25 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestPasswordChangedNotification(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	tpl := template.NewPasswordChangedNotification(conf, &template.PasswordChangedNotificationModel{Time: time.Now()})
+
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+}
@@ -0,0 +1,36 @@
+package template
+
+import (
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	RegistrationApprovedNotification struct {
+		c configuration.Provider
+		m *RegistrationApprovedNotificationModel
+	}
+	RegistrationApprovedNotificationModel struct {
+		To     string
+		Locale string
+	}
+)
+
+func NewRegistrationApprovedNotification(c configuration.Provider, m *RegistrationApprovedNotificationModel) *RegistrationApprovedNotification {
+	return &RegistrationApprovedNotification{c: c, m: m}
+}
+
+func (t *RegistrationApprovedNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RegistrationApprovedNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *RegistrationApprovedNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/registration_approved/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *RegistrationApprovedNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/registration_approved/email.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,39 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	RegistrationAttemptNotification struct {
+		c configuration.Provider
+		m *RegistrationAttemptNotificationModel
+	}
+	RegistrationAttemptNotificationModel struct {
+		To     string
+		Time   time.Time
+		Locale string
+	}
+)
+
+func NewRegistrationAttemptNotification(c configuration.Provider, m *RegistrationAttemptNotificationModel) *RegistrationAttemptNotification {
+	return &RegistrationAttemptNotification{c: c, m: m}
+}
+
+func (t *RegistrationAttemptNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RegistrationAttemptNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *RegistrationAttemptNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/registration_attempt/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *RegistrationAttemptNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/registration_attempt/email.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,36 @@
+package template
+
+import (
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	RegistrationRejectedNotification struct {
+		c configuration.Provider
+		m *RegistrationRejectedNotificationModel
+	}
+	RegistrationRejectedNotificationModel struct {
+		To     string
+		Locale string
+	}
+)
+
+func NewRegistrationRejectedNotification(c configuration.Provider, m *RegistrationRejectedNotificationModel) *RegistrationRejectedNotification {
+	return &RegistrationRejectedNotification{c: c, m: m}
+}
+
+func (t *RegistrationRejectedNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RegistrationRejectedNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *RegistrationRejectedNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/registration_rejected/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *RegistrationRejectedNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/registration_rejected/email.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,39 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	ScheduledDeletionNotification struct {
+		c configuration.Provider
+		m *ScheduledDeletionNotificationModel
+	}
+	ScheduledDeletionNotificationModel struct {
+		To       string
+		DeleteAt time.Time
+		Locale   string
+	}
+)
+
+func NewScheduledDeletionNotification(c configuration.Provider, m *ScheduledDeletionNotificationModel) *ScheduledDeletionNotification {
+	return &ScheduledDeletionNotification{c: c, m: m}
+}
+
+func (t *ScheduledDeletionNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *ScheduledDeletionNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *ScheduledDeletionNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/scheduled_deletion/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *ScheduledDeletionNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/scheduled_deletion/email.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,26 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestScheduledDeletionNotification(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	deleteAt := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	tpl := template.NewScheduledDeletionNotification(conf, &template.ScheduledDeletionNotificationModel{DeleteAt: deleteAt})
+
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "2020-03-01")
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+}
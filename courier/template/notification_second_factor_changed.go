@@ -0,0 +1,49 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	SecondFactorChangedNotification struct {
+		c configuration.Provider
+		m *SecondFactorChangedNotificationModel
+	}
+	SecondFactorChangedNotificationModel struct {
+		To string
+
+		// Method is the credentials type of the second factor, for example "push".
+		Method string
+
+		// Name identifies the second factor if the identity can set up several, for example the name of a device.
+		Name string
+
+		// Added is false if the second factor was removed.
+		Added bool
+
+		Time   time.Time
+		Locale string
+	}
+)
+
+func NewSecondFactorChangedNotification(c configuration.Provider, m *SecondFactorChangedNotificationModel) *SecondFactorChangedNotification {
+	return &SecondFactorChangedNotification{c: c, m: m}
+}
+
+func (t *SecondFactorChangedNotification) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *SecondFactorChangedNotification) EmailCategory() string {
+	return CategoryNotification
+}
+
+func (t *SecondFactorChangedNotification) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/second_factor_changed/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *SecondFactorChangedNotification) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "notification/second_factor_changed/email.body.gotmpl"), t.m.Locale), t.m)
+}
@@ -0,0 +1,32 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestSecondFactorChangedNotification(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+
+	tpl := template.NewSecondFactorChangedNotification(conf, &template.SecondFactorChangedNotificationModel{Method: "push", Name: "Work Phone", Added: true, Time: time.Now()})
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "was added")
+	assert.Contains(t, rendered, "Push approval (Work Phone)")
+
+	rendered, err = tpl.EmailSubject()
+	require.NoError(t, err)
+	assert.NotEmpty(t, rendered)
+
+	tpl = template.NewSecondFactorChangedNotification(conf, &template.SecondFactorChangedNotificationModel{Method: "email_code", Time: time.Now(), Locale: "de"})
+	rendered, err = tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "entfernt")
+	assert.Contains(t, rendered, "Codes per E-Mail")
+}
@@ -0,0 +1,191 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	// Email is an email template. It has the methods of courier.EmailTemplate, which can not be imported here.
+	Email interface {
+		EmailSubject() (string, error)
+		EmailBody() (string, error)
+		EmailRecipient() (string, error)
+		EmailCategory() string
+	}
+
+	preview struct {
+		// sample returns the model with sample data.
+		sample func(to string) interface{}
+		new    func(c configuration.Provider, model interface{}) Email
+	}
+)
+
+var sampleTime = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// previews are the template types which can be previewed, by the name used in the admin API.
+var previews = map[string]preview{
+	"invitation": {
+		sample: func(to string) interface{} {
+			return &InvitationModel{To: to, URL: "https://www.ory.sh/invitation?token=sample", ExpiresAt: sampleTime.Add(7 * 24 * time.Hour)}
+		},
+		new: func(c configuration.Provider, m interface{}) Email { return NewInvitation(c, m.(*InvitationModel)) },
+	},
+	"link_code": {
+		sample: func(to string) interface{} { return &LinkCodeModel{To: to, Code: "123456", Provider: "github"} },
+		new:    func(c configuration.Provider, m interface{}) Email { return NewLinkCode(c, m.(*LinkCodeModel)) },
+	},
+	"login_code": {
+		sample: func(to string) interface{} { return &LoginCodeModel{To: to, Code: "123456", ExpiresInMinutes: 10} },
+		new:    func(c configuration.Provider, m interface{}) Email { return NewLoginCode(c, m.(*LoginCodeModel)) },
+	},
+	"notification_account_recovered": {
+		sample: func(to string) interface{} {
+			return &AccountRecoveredNotificationModel{
+				To: to, Time: sampleTime,
+				RevertURL: "https://www.ory.sh/recovery/revert?token=sample", RevertExpiresAt: sampleTime.Add(7 * 24 * time.Hour),
+			}
+		},
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewAccountRecoveredNotification(c, m.(*AccountRecoveredNotificationModel))
+		},
+	},
+	"notification_code_replayed": {
+		sample: func(to string) interface{} {
+			return &CodeReplayedNotificationModel{
+				To:         to,
+				RedeemedAt: sampleTime, RedeemedIPAddress: "192.0.2.1", RedeemedUserAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+				Time: sampleTime.Add(time.Minute), IPAddress: "198.51.100.7", UserAgent: "curl/7.68.0",
+			}
+		},
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewCodeReplayedNotification(c, m.(*CodeReplayedNotificationModel))
+		},
+	},
+	"notification_login": {
+		sample: func(to string) interface{} {
+			return &LoginNotificationModel{To: to, IPAddress: "192.0.2.1", UserAgent: "Mozilla/5.0 (X11; Linux x86_64)", Time: sampleTime}
+		},
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewLoginNotification(c, m.(*LoginNotificationModel))
+		},
+	},
+	"notification_password_changed": {
+		sample: func(to string) interface{} { return &PasswordChangedNotificationModel{To: to, Time: sampleTime} },
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewPasswordChangedNotification(c, m.(*PasswordChangedNotificationModel))
+		},
+	},
+	"notification_second_factor_changed": {
+		sample: func(to string) interface{} {
+			return &SecondFactorChangedNotificationModel{To: to, Method: "push", Name: "Work Phone", Added: true, Time: sampleTime}
+		},
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewSecondFactorChangedNotification(c, m.(*SecondFactorChangedNotificationModel))
+		},
+	},
+	"notification_registration_attempt": {
+		sample: func(to string) interface{} { return &RegistrationAttemptNotificationModel{To: to, Time: sampleTime} },
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewRegistrationAttemptNotification(c, m.(*RegistrationAttemptNotificationModel))
+		},
+	},
+	"notification_registration_approved": {
+		sample: func(to string) interface{} { return &RegistrationApprovedNotificationModel{To: to} },
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewRegistrationApprovedNotification(c, m.(*RegistrationApprovedNotificationModel))
+		},
+	},
+	"notification_registration_rejected": {
+		sample: func(to string) interface{} { return &RegistrationRejectedNotificationModel{To: to} },
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewRegistrationRejectedNotification(c, m.(*RegistrationRejectedNotificationModel))
+		},
+	},
+	"notification_scheduled_deletion": {
+		sample: func(to string) interface{} {
+			return &ScheduledDeletionNotificationModel{To: to, DeleteAt: sampleTime.Add(30 * 24 * time.Hour)}
+		},
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewScheduledDeletionNotification(c, m.(*ScheduledDeletionNotificationModel))
+		},
+	},
+	"recovery_invalid": {
+		sample: func(to string) interface{} { return &RecoveryInvalidModel{To: to} },
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewRecoveryInvalid(c, m.(*RecoveryInvalidModel))
+		},
+	},
+	"recovery_valid": {
+		sample: func(to string) interface{} {
+			return &RecoveryValidModel{To: to, RecoveryURL: "https://www.ory.sh/recovery?token=sample", ExpiresAt: sampleTime.Add(time.Hour)}
+		},
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewRecoveryValid(c, m.(*RecoveryValidModel))
+		},
+	},
+	"verify_invalid": {
+		sample: func(to string) interface{} { return &VerifyInvalidModel{To: to} },
+		new: func(c configuration.Provider, m interface{}) Email {
+			return NewVerifyInvalid(c, m.(*VerifyInvalidModel))
+		},
+	},
+	"verify_valid": {
+		sample: func(to string) interface{} {
+			return &VerifyValidModel{To: to, VerifyURL: "https://www.ory.sh/verify?code=sample"}
+		},
+		new: func(c configuration.Provider, m interface{}) Email { return NewVerifyValid(c, m.(*VerifyValidModel)) },
+	},
+}
+
+// PreviewTypes returns the names of the template types which can be previewed, in alphabetical order.
+func PreviewTypes() []string {
+	types := make([]string, 0, len(previews))
+	for t := range previews {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewPreview returns the template of the type with sample data addressed to the recipient. The values, a JSON
+// object with the names of the template variables as keys, for example `{"Code":"654321","Locale":"de"}`,
+// replace the sample data, except for the recipient. It also returns the model the template is rendered with.
+//
+// Templates are loaded again instead of from the cache, so that changes to the template files show up.
+func NewPreview(c configuration.Provider, templateType, to string, values json.RawMessage) (Email, interface{}, error) {
+	p, ok := previews[templateType]
+	if !ok {
+		return nil, nil, errors.WithStack(herodot.ErrNotFound.WithReasonf(`The template type "%s" does not exist, it must be one of: %s`, templateType, strings.Join(PreviewTypes(), ", ")))
+	}
+
+	model := p.sample(to)
+	if len(values) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(values))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(model); err != nil {
+			return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The template context does not match the variables of the template: %s", err))
+		}
+
+		// The recipient can not be changed by the values.
+		recipient, err := json.Marshal(map[string]string{"To": to})
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		if err := json.Unmarshal(recipient, model); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+	}
+
+	cache.Purge()
+	return p.new(c, model), model, nil
+}
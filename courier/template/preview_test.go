@@ -0,0 +1,48 @@
+package template_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestPreview(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+
+	for _, tt := range template.PreviewTypes() {
+		t.Run("type="+tt, func(t *testing.T) {
+			tpl, _, err := template.NewPreview(conf, tt, "foo@ory.sh", nil)
+			require.NoError(t, err)
+
+			rendered, err := tpl.EmailBody()
+			require.NoError(t, err)
+			assert.NotEmpty(t, rendered)
+
+			rendered, err = tpl.EmailSubject()
+			require.NoError(t, err)
+			assert.NotEmpty(t, rendered)
+
+			to, err := tpl.EmailRecipient()
+			require.NoError(t, err)
+			assert.Equal(t, "foo@ory.sh", to)
+		})
+	}
+
+	tpl, model, err := template.NewPreview(conf, "login_code", "foo@ory.sh", json.RawMessage(`{"Code":"654321","To":"bar@ory.sh","Locale":"de"}`))
+	require.NoError(t, err)
+	assert.Equal(t, &template.LoginCodeModel{To: "foo@ory.sh", Code: "654321", ExpiresInMinutes: 10, Locale: "de"}, model)
+	rendered, err := tpl.EmailBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "654321")
+
+	_, _, err = template.NewPreview(conf, "login_code", "foo@ory.sh", json.RawMessage(`{"Unknown":true}`))
+	assert.Error(t, err)
+
+	_, _, err = template.NewPreview(conf, "test_stub", "foo@ory.sh", nil)
+	assert.Error(t, err)
+}
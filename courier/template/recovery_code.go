@@ -0,0 +1,31 @@
+package template
+
+import (
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	// RecoveryCode is the text message with the code which recovers an account.
+	RecoveryCode struct {
+		c configuration.Provider
+		m *RecoveryCodeModel
+	}
+	RecoveryCodeModel struct {
+		To               string
+		Code             string
+		ExpiresInMinutes int
+		Locale           string
+	}
+)
+
+func NewRecoveryCode(c configuration.Provider, m *RecoveryCodeModel) *RecoveryCode {
+	return &RecoveryCode{c: c, m: m}
+}
+
+func (t *RecoveryCode) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RecoveryCode) SMSBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "recovery/code/sms.body.gotmpl"), t.m.Locale), t.m)
+}
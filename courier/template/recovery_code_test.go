@@ -0,0 +1,25 @@
+package template_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/internal"
+)
+
+func TestRecoveryCode(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	tpl := template.NewRecoveryCode(conf, &template.RecoveryCodeModel{To: "+4917612345678", Code: "123456", ExpiresInMinutes: 15, Locale: "de"})
+
+	rendered, err := tpl.SMSBody()
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "123456")
+	assert.Contains(t, rendered, "15 Minuten")
+
+	to, err := tpl.SMSRecipient()
+	require.NoError(t, err)
+	assert.Equal(t, "+4917612345678", to)
+}
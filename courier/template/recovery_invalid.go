@@ -0,0 +1,36 @@
+package template
+
+import (
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	RecoveryInvalid struct {
+		c configuration.Provider
+		m *RecoveryInvalidModel
+	}
+	RecoveryInvalidModel struct {
+		To     string
+		Locale string
+	}
+)
+
+func NewRecoveryInvalid(c configuration.Provider, m *RecoveryInvalidModel) *RecoveryInvalid {
+	return &RecoveryInvalid{c: c, m: m}
+}
+
+func (t *RecoveryInvalid) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RecoveryInvalid) EmailCategory() string {
+	return CategoryCode
+}
+
+func (t *RecoveryInvalid) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "recovery/invalid/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *RecoveryInvalid) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "recovery/invalid/email.body.gotmpl"), t.m.Locale), t.m)
+}
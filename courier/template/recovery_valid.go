@@ -0,0 +1,48 @@
+package template
+
+import (
+	"time"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+type (
+	RecoveryValid struct {
+		c configuration.Provider
+		m *RecoveryValidModel
+	}
+	RecoveryValidModel struct {
+		To          string
+		RecoveryURL string
+		ExpiresAt   time.Time
+		Locale      string
+	}
+)
+
+func NewRecoveryValid(c configuration.Provider, m *RecoveryValidModel) *RecoveryValid {
+	return &RecoveryValid{c: c, m: m}
+}
+
+func (t *RecoveryValid) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RecoveryValid) EmailCategory() string {
+	return CategoryCode
+}
+
+func (t *RecoveryValid) EmailSubject() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "recovery/valid/email.subject.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *RecoveryValid) EmailBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "recovery/valid/email.body.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *RecoveryValid) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RecoveryValid) SMSBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "recovery/valid/sms.body.gotmpl"), t.m.Locale), t.m)
+}
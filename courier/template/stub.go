@@ -1,8 +1,6 @@
 package template
 
 import (
-	"path/filepath"
-
 	"github.com/ory/kratos/driver/configuration"
 )
 
@@ -15,6 +13,9 @@ type TestStubModel struct {
 	To      string
 	Subject string
 	Body    string
+
+	// Category routes the email like emails of that category.
+	Category string
 }
 
 func NewTestStub(c configuration.Provider, m *TestStubModel) *TestStub {
@@ -25,10 +26,14 @@ func (t *TestStub) EmailRecipient() (string, error) {
 	return t.m.To, nil
 }
 
+func (t *TestStub) EmailCategory() string {
+	return t.m.Category
+}
+
 func (t *TestStub) EmailSubject() (string, error) {
-	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "test_stub/email.subject.gotmpl"), t.m)
+	return loadTextTemplate(templatePath(t.c.CourierTemplatesRoot(), "test_stub/email.subject.gotmpl"), t.m)
 }
 
 func (t *TestStub) EmailBody() (string, error) {
-	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "test_stub/email.body.gotmpl"), t.m)
+	return loadTextTemplate(templatePath(t.c.CourierTemplatesRoot(), "test_stub/email.body.gotmpl"), t.m)
 }
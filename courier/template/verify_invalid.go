@@ -1,8 +1,6 @@
 package template
 
 import (
-	"path/filepath"
-
 	"github.com/ory/kratos/driver/configuration"
 )
 
@@ -12,7 +10,8 @@ type (
 		m *VerifyInvalidModel
 	}
 	VerifyInvalidModel struct {
-		To string
+		To     string
+		Locale string
 	}
 )
 
@@ -24,10 +23,14 @@ func (t *VerifyInvalid) EmailRecipient() (string, error) {
 	return t.m.To, nil
 }
 
+func (t *VerifyInvalid) EmailCategory() string {
+	return CategoryVerification
+}
+
 func (t *VerifyInvalid) EmailSubject() (string, error) {
-	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verify/invalid/email.subject.gotmpl"), t.m)
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "verify/invalid/email.subject.gotmpl"), t.m.Locale), t.m)
 }
 
 func (t *VerifyInvalid) EmailBody() (string, error) {
-	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verify/invalid/email.body.gotmpl"), t.m)
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "verify/invalid/email.body.gotmpl"), t.m.Locale), t.m)
 }
@@ -1,8 +1,6 @@
 package template
 
 import (
-	"path/filepath"
-
 	"github.com/ory/kratos/driver/configuration"
 )
 
@@ -14,6 +12,7 @@ type (
 	VerifyValidModel struct {
 		To        string
 		VerifyURL string
+		Locale    string
 	}
 )
 
@@ -25,10 +24,22 @@ func (t *VerifyValid) EmailRecipient() (string, error) {
 	return t.m.To, nil
 }
 
+func (t *VerifyValid) EmailCategory() string {
+	return CategoryVerification
+}
+
 func (t *VerifyValid) EmailSubject() (string, error) {
-	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verify/valid/email.subject.gotmpl"), t.m)
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "verify/valid/email.subject.gotmpl"), t.m.Locale), t.m)
 }
 
 func (t *VerifyValid) EmailBody() (string, error) {
-	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verify/valid/email.body.gotmpl"), t.m)
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "verify/valid/email.body.gotmpl"), t.m.Locale), t.m)
+}
+
+func (t *VerifyValid) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *VerifyValid) SMSBody() (string, error) {
+	return loadTextTemplate(localizedPath(templatePath(t.c.CourierTemplatesRoot(), "verify/valid/sms.body.gotmpl"), t.m.Locale), t.m)
 }
@@ -4,4 +4,14 @@ type EmailTemplate interface {
 	EmailSubject() (string, error)
 	EmailBody() (string, error)
 	EmailRecipient() (string, error)
+
+	// EmailCategory routes the email to the SMTP servers configured for the category. Emails without a
+	// category are sent using the default servers.
+	EmailCategory() string
+}
+
+// SMSTemplate is the template of a text message. Text messages have no subject and are sent in a single category.
+type SMSTemplate interface {
+	SMSRecipient() (string, error)
+	SMSBody() (string, error)
 }
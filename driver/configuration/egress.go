@@ -0,0 +1,25 @@
+package configuration
+
+import (
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/egress"
+)
+
+func init() {
+	// Outbound calls are sent using the default egress transport. Like the default fetcher, it reads the
+	// configuration on every call, so changes apply without restarting.
+	egress.Default.SetConfig(egressConfig)
+}
+
+func egressConfig() egress.Config {
+	return egress.Config{
+		HTTPProxy:    viper.GetString(ViperKeyEgressProxyHTTP),
+		HTTPSProxy:   viper.GetString(ViperKeyEgressProxyHTTPS),
+		ProxyBypass:  viper.GetStringSlice(ViperKeyEgressProxyBypass),
+		AllowedHosts: viper.GetStringSlice(ViperKeyEgressAllowedHosts),
+
+		BlockPrivateNetworks: viper.GetBool(ViperKeyEgressBlockPrivateNetworks),
+		AllowedPrivateHosts:  viper.GetStringSlice(ViperKeyEgressAllowedPrivateHosts),
+	}
+}
@@ -0,0 +1,33 @@
+package configuration
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/fetcher"
+)
+
+func init() {
+	// Identity schemas and courier templates are loaded using the default fetcher. It reads the configuration on
+	// every fetch, so changes apply without restarting. The JSON schema loaders replace the ones registered by
+	// github.com/ory/jsonschema/v3/httploader, which validate.go imports and which is therefore initialized first.
+	fetcher.Default.SetConfig(fetchConfig)
+	fetcher.RegisterJSONSchemaLoaders(fetcher.Default)
+}
+
+func fetchConfig() fetcher.Config {
+	c := fetcher.Config{RefreshInterval: 5 * time.Minute}
+	if viper.IsSet(ViperKeyFetchRefreshInterval) {
+		if d, err := time.ParseDuration(viper.GetString(ViperKeyFetchRefreshInterval)); err == nil {
+			c.RefreshInterval = d
+		}
+	}
+
+	if raw, err := json.Marshal(viper.Get(ViperKeyFetchHTTPHeaders)); err == nil {
+		// Malformed rules are reported by the configuration validation.
+		_ = json.Unmarshal(raw, &c.Headers)
+	}
+	return c
+}
@@ -1,7 +1,15 @@
 package configuration
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"time"
@@ -19,9 +27,340 @@ type HasherArgon2Config struct {
 	KeyLength   uint32
 }
 
+// IdentityRetentionConfig configures which stale identities are deleted. Policies with a duration of 0 are disabled.
+type IdentityRetentionConfig struct {
+	UnverifiedAfter time.Duration
+	InactiveAfter   time.Duration
+	NotifyBefore    time.Duration
+	DryRun          bool
+}
+
+// IdentityEntitlementsConfig configures how the entitlements of identities are resolved. URL takes precedence
+// over Static. Responses of URL are cached for CacheTTL.
+type IdentityEntitlementsConfig struct {
+	Static   StaticEntitlements
+	URL      string
+	CacheTTL time.Duration
+}
+
+// StaticEntitlements map the value of an identity's trait to entitlements. Default is used if no rule matches.
+type StaticEntitlements struct {
+	Trait   string                   `json:"trait"`
+	Rules   []StaticEntitlementsRule `json:"rules"`
+	Default json.RawMessage          `json:"default"`
+}
+
+type StaticEntitlementsRule struct {
+	Value        string          `json:"value"`
+	Entitlements json.RawMessage `json:"entitlements"`
+}
+
+// IdentityPairwiseConfig configures pairwise subject identifiers. Audiences are the relying parties which may
+// request them, and Enforce requires every whoami request to name one.
+type IdentityPairwiseConfig struct {
+	Secret    []byte
+	Audiences []string
+	Enforce   bool
+}
+
+// IdentityUploadsConfig configures the bucket which identities upload files such as profile pictures to, uploads
+// are disabled if Bucket is empty. Provider is "s3" or "gcs", the latter uses the S3 compatible API of Cloud Storage
+// with HMAC keys. Endpoint overrides the provider's endpoint, for example for MinIO. If PublicURL is set, it is the
+// base URL the uploaded files can be downloaded from. Upload URLs expire after URLLifespan, and files may not be
+// larger than MaxSize bytes.
+type IdentityUploadsConfig struct {
+	Provider        string
+	Bucket          string
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	PublicURL       string
+	URLLifespan     time.Duration
+	MaxSize         int64
+}
+
+// RegistrationAvailabilityConfig configures the public endpoint which checks whether an identifier is still available.
+// RateLimit is the number of checks a client IP address may make per minute.
+type RegistrationAvailabilityConfig struct {
+	Enabled     bool
+	PrivacyMode bool
+	RateLimit   int
+}
+
+// RegistrationBotProtectionConfig configures cheap checks which reject registrations submitted by bots. HoneypotField
+// is the name of a hidden field added to the registration form which humans leave empty, MinSubmitTime is how long
+// it takes at least to fill in the form. Both checks are disabled by their zero value.
+type RegistrationBotProtectionConfig struct {
+	HoneypotField string
+	MinSubmitTime time.Duration
+}
+
+// DeviceAuthorizationConfig configures the flow which signs in devices such as TVs and CLIs. Lifespan is how long
+// the user has to enter the device's code, PollInterval is how often the device may poll for its session, and
+// RateLimit is the number of requests a client IP address may make per minute to each of the flow's endpoints.
+type DeviceAuthorizationConfig struct {
+	Enabled      bool
+	Lifespan     time.Duration
+	PollInterval time.Duration
+	RateLimit    int
+}
+
+// EmailCodeConfig configures the second factor which emails a code to the identity. If FallbackOnly is set, the
+// code is only offered to identities which set up another second factor, for when that one is not at hand.
+// MaxSendsPerIdentity limits the codes sent to one identity per hour and MaxSendsPerHour the codes sent to all
+// identities per hour, the latter is disabled if it is 0.
+type EmailCodeConfig struct {
+	FallbackOnly        bool
+	Length              int
+	Lifespan            time.Duration
+	MaxAttempts         int
+	MaxSendsPerIdentity int
+	MaxSendsPerHour     int
+}
+
+// RecoveryConfig configures account recovery. Each mode is enabled on its own: the link mode emails a recovery
+// link, the SMS mode texts a code to a phone number of the identity, and the manual mode collects evidence for an
+// administrator, whose approval issues a recovery link. MaxSendsPerHour limits the recovery messages sent to one
+// address per hour and MaxSendsPerIPPerHour the messages one client IP address may request per hour.
+type RecoveryConfig struct {
+	RequestLifespan      time.Duration
+	LinkEnabled          bool
+	LinkLifespan         time.Duration
+	SMSEnabled           bool
+	SMSCodeLength        int
+	SMSCodeLifespan      time.Duration
+	SMSMaxAttempts       int
+	ManualEnabled        bool
+	ManualLinkLifespan   time.Duration
+	MaxSendsPerHour      int
+	MaxSendsPerIPPerHour int
+
+	// RevertLifespan is how long the link which undoes a recovery is valid.
+	RevertLifespan time.Duration
+}
+
+// CourierSMTPRoute sends the emails of the categories, for example "verification", using other SMTP servers than
+// courier.smtp.connection_uri. The servers are tried in order.
+type CourierSMTPRoute struct {
+	Categories     []string `json:"categories"`
+	ConnectionURIs []string `json:"connection_uris"`
+
+	// URLs are the parsed ConnectionURIs.
+	URLs []*url.URL `json:"-"`
+}
+
+// CourierSMTPHealthConfig configures when an SMTP server is skipped: after failing to send UnhealthyAfter emails
+// in a row, it is only tried again UnhealthyFor later, unless no other server of the route is healthy.
+type CourierSMTPHealthConfig struct {
+	UnhealthyAfter int
+	UnhealthyFor   time.Duration
+}
+
+// DKIMConfig configures the DKIM signature of outgoing emails. Domain is the signing domain, it defaults to the
+// domain of the From address. Emails are signed with the key which became active last, so that a new key can be
+// published in the DNS before it is used.
+type DKIMConfig struct {
+	Domain string
+	Keys   []DKIMKey
+}
+
+// DKIMKey is a DKIM signing key. PrivateKey is the PEM encoded RSA or Ed25519 key of the DNS record
+// `<Selector>._domainkey.<domain>`.
+type DKIMKey struct {
+	Selector   string    `json:"selector"`
+	PrivateKey string    `json:"private_key"`
+	ActiveFrom time.Time `json:"active_from"`
+}
+
+// Signer parses the private key.
+func (k *DKIMKey) Signer() (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return nil, errors.Errorf("the private key of selector %s is not PEM encoded", k.Selector)
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch signer := key.(type) {
+		case *rsa.PrivateKey, ed25519.PrivateKey:
+			return signer.(crypto.Signer), nil
+		}
+		return nil, errors.Errorf("the private key of selector %s must be an RSA or Ed25519 key", k.Selector)
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse the private key of selector %s", k.Selector)
+	}
+	return key, nil
+}
+
+// ActiveKey returns the key which became active last, or nil if no key is active yet.
+func (c *DKIMConfig) ActiveKey(now time.Time) *DKIMKey {
+	var active *DKIMKey
+	for k := range c.Keys {
+		key := &c.Keys[k]
+		if key.ActiveFrom.After(now) {
+			continue
+		}
+		if active == nil || key.ActiveFrom.After(active.ActiveFrom) {
+			active = key
+		}
+	}
+	return active
+}
+
+// CourierCategoryConfig sets the headers of the emails of a category, for example "notification". FromAddress
+// defaults to courier.smtp.from_address, the other headers are only set if configured.
+type CourierCategoryConfig struct {
+	FromAddress     string `json:"from_address"`
+	ReplyTo         string `json:"reply_to"`
+	ListUnsubscribe string `json:"list_unsubscribe"`
+}
+
+// CourierSMSConfig configures the delivery of text messages. The courier POSTs each message as a JSON object with
+// the keys `to` and `body` to URL, usually an adapter for an SMS provider. Text messages are not sent if URL is
+// empty.
+type CourierSMSConfig struct {
+	URL string `json:"url"`
+
+	OutboundHook
+}
+
+// PrivilegedMethodConfig configures the re-authentication a profile management method requires. If Required is
+// set, the method can only be used by sessions which authenticated less than MaxAge ago and, if SecondFactor is
+// set and the identity set up a second factor, completed it when signing in.
+type PrivilegedMethodConfig struct {
+	Required     bool
+	MaxAge       time.Duration
+	SecondFactor bool
+}
+
+// EmailDomainsConfig restricts the email domains which may be used to register. A domain also matches its
+// subdomains. Denied domains take precedence over allowed ones, and if Allow is empty every domain which is not
+// denied is allowed. If BlockDisposable is set, domains of disposable email providers are denied as well, using the
+// list at DisposableListURL or, if it is empty, a built-in list.
+type EmailDomainsConfig struct {
+	Allow             []string
+	Deny              []string
+	BlockDisposable   bool
+	DisposableListURL string
+}
+
+// LogRedactionConfig configures which personal data and secrets are removed from the log output. Fields and
+// Patterns are redacted in addition to the built-in ones. In strict mode, all fields except a few which never
+// contain personal data are redacted.
+type LogRedactionConfig struct {
+	Enabled  bool
+	Strict   bool
+	Fields   []string
+	Patterns []string
+}
+
+// ErrorReportingConfig configures where server errors and panics are reported to. DSN is the DSN of a Sentry
+// compatible service, error reporting is disabled if it is empty. SampleRate is the share of errors which are
+// reported, between 0 and 1.
+type ErrorReportingConfig struct {
+	DSN         string
+	SampleRate  float64
+	Environment string
+}
+
+// ChaosConfig configures the latency and failures which are injected for resilience testing, see package chaos.
+type ChaosConfig struct {
+	Persister ChaosTarget
+	Courier   ChaosTarget
+}
+
+// Enabled returns true if any latency or failure is injected.
+func (c *ChaosConfig) Enabled() bool {
+	return c.Persister.Enabled() || c.Courier.Enabled()
+}
+
+// ChaosTarget delays operations by Latency with LatencyProbability and fails them with FailureProbability.
+// The probabilities are between 0 and 1.
+type ChaosTarget struct {
+	FailureProbability float64
+	Latency            time.Duration
+	LatencyProbability float64
+}
+
+// Enabled returns true if any latency or failure is injected.
+func (t ChaosTarget) Enabled() bool {
+	return t.FailureProbability > 0 || (t.Latency > 0 && t.LatencyProbability > 0)
+}
+
+// Registration modes, see SelfServiceRegistrationMode.
+const (
+	// RegistrationModeOpen lets everyone register.
+	RegistrationModeOpen = "open"
+	// RegistrationModeDisabled disables registration, existing identities can still sign in.
+	RegistrationModeDisabled = "disabled"
+	// RegistrationModeInviteOnly lets only people register who were invited using the admin API.
+	RegistrationModeInviteOnly = "invite_only"
+	// RegistrationModeApproval requires an administrator to approve new identities before they can sign in.
+	RegistrationModeApproval = "approval"
+)
+
+// CSRF protection modes, see CSRFMode.
+const (
+	// CSRFModeCookie expects the CSRF token of the cookie in the csrf_token form field, which suits UIs rendered on
+	// the server.
+	CSRFModeCookie = "cookie"
+	// CSRFModeOrigin requires the Origin of requests to be allowed and also accepts the value of the csrf_token
+	// cookie in the X-CSRF-Token header, which suits single page apps.
+	CSRFModeOrigin = "origin"
+)
+
+// DefaultContentSecurityPolicy only allows resources of the public URL and inline scripts and styles which carry
+// the nonce of the request. Stylesheets and images may also be loaded over HTTPS, so that the bundled UI can be
+// themed. The placeholder {nonce} is replaced by the nonce of each request.
+const DefaultContentSecurityPolicy = "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' https: 'nonce-{nonce}'; img-src 'self' https: data:; object-src 'none'; base-uri 'none'; frame-ancestors 'none'"
+
+// RequestLimitsConfig limits the request bodies accepted by the public API. Limits below one are disabled.
+type RequestLimitsConfig struct {
+	// MaxBodySize is the maximum size of a request body in bytes.
+	MaxBodySize int64
+	// MaxJSONDepth is the maximum nesting depth of JSON request bodies.
+	MaxJSONDepth int
+	// MaxFormFields is the maximum number of fields of form request bodies.
+	MaxFormFields int
+}
+
+// BundledUIConfig configures the self-service UI which ORY Kratos serves itself. The theme's logo and stylesheet are
+// optional, the stylesheet is loaded after the default styles and can override them.
+type BundledUIConfig struct {
+	Enabled       bool
+	Title         string
+	LogoURL       string
+	StylesheetURL string
+}
+
+// Pages of the bundled self-service UI. If the UI is enabled, the urls.*_ui keys default to these pages.
+const (
+	BundledUILoginPath        = "/self-service/ui/login"
+	BundledUIRegistrationPath = "/self-service/ui/registration"
+	BundledUIProfilePath      = "/self-service/ui/profile"
+	BundledUIVerificationPath = "/self-service/ui/verify"
+	BundledUIRecoveryPath     = "/self-service/ui/recovery"
+	BundledUIErrorPath        = "/self-service/ui/error"
+)
+
 type SelfServiceHook struct {
 	Job    string          `json:"job"`
 	Config json.RawMessage `json:"config"`
+
+	// Timeout, Retries, Critical, and Async configure how the hook is executed, see package resilience.
+	Timeout  string `json:"timeout"`
+	Retries  int    `json:"retries"`
+	Critical *bool  `json:"critical"`
+	Async    bool   `json:"async"`
+}
+
+// HookCircuitBreaker skips non-critical hooks for Cooldown after FailureThreshold consecutive failures.
+type HookCircuitBreaker struct {
+	FailureThreshold int
+	Cooldown         time.Duration
 }
 
 type SelfServiceStrategy struct {
@@ -29,6 +368,34 @@ type SelfServiceStrategy struct {
 	Config  json.RawMessage `json:"config"`
 }
 
+type ServeTLSConfig struct {
+	CertPath string
+	KeyPath  string
+
+	ACMEEnabled  bool
+	ACMEEmail    string
+	ACMECacheDir string
+}
+
+// Enabled returns true if TLS should be terminated by ORY Kratos.
+func (c *ServeTLSConfig) Enabled() bool {
+	return c.ACMEEnabled || (len(c.CertPath) > 0 && len(c.KeyPath) > 0)
+}
+
+// AdminAPIKey authenticates requests to the admin API which carry the key as a bearer token.
+type AdminAPIKey struct {
+	ID     string   `json:"id"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+}
+
+// AdminClientCertificate authorizes requests to the admin API which present a verified client certificate
+// with the given common name.
+type AdminClientCertificate struct {
+	CommonName string   `json:"common_name"`
+	Scopes     []string `json:"scopes"`
+}
+
 type SchemaConfig struct {
 	ID  string `json:"id"`
 	URL string `json:"url"`
@@ -36,6 +403,101 @@ type SchemaConfig struct {
 
 type SchemaConfigs []SchemaConfig
 
+type BackChannelLogoutClient struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+
+	OutboundHook
+}
+
+// IdentityWebhookCaller is an external system which updates identities using the inbound identity webhook.
+type IdentityWebhookCaller struct {
+	// ID identifies the caller in the logs.
+	ID string `json:"id"`
+
+	// Secrets verify the signatures of the caller's requests, see x.SignatureHeader.
+	Secrets []string `json:"secrets"`
+
+	// MapperURL is the URL of the Jsonnet snippet which maps the request body to the identity ID, traits, and
+	// metadata.
+	MapperURL string `json:"mapper_url"`
+
+	// AllowedTraits are the paths of the traits which the caller may change, for example plan or billing.status.
+	AllowedTraits []string `json:"allowed_traits"`
+
+	// AllowedMetadata are the paths of the identity metadata which the caller may change.
+	AllowedMetadata []string `json:"allowed_metadata"`
+}
+
+// OutboundHook secures the calls ORY Kratos makes to a hook of another service, for example a back-channel
+// logout endpoint.
+type OutboundHook struct {
+	// SigningSecrets sign the requests with HMAC SHA-256, see x.SignatureHeader. The first secret is the current
+	// one. Requests are signed with the others as well, so that receivers can rotate secrets without downtime.
+	SigningSecrets []string `json:"signing_secrets"`
+
+	// TLS configures the client certificate for mutual TLS and the certificate authorities which are trusted.
+	TLS OutboundTLS `json:"tls"`
+
+	// ExpectedStatusCodes are the status codes which acknowledge the call. Any 2xx status code does if it is
+	// empty. Redirects are never followed.
+	ExpectedStatusCodes []int `json:"expected_status_codes"`
+}
+
+// OutboundTLS configures TLS for calls to other services. The files are read for every call, so that renewed
+// certificates are picked up without a restart.
+type OutboundTLS struct {
+	// CertPath and KeyPath are the PEM encoded client certificate and key.
+	CertPath string `json:"cert_path"`
+	KeyPath  string `json:"key_path"`
+
+	// CAPath contains the PEM encoded certificate authorities which are trusted instead of the system's.
+	CAPath string `json:"ca_path"`
+}
+
+// Acknowledged returns true if the status code acknowledges the call, see ExpectedStatusCodes.
+func (h OutboundHook) Acknowledged(code int) bool {
+	if len(h.ExpectedStatusCodes) == 0 {
+		return code >= 200 && code <= 299
+	}
+	for _, expected := range h.ExpectedStatusCodes {
+		if code == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// Config loads the certificates. It returns nil if nothing is configured, the default TLS settings apply then.
+func (t OutboundTLS) Config() (*tls.Config, error) {
+	if t == (OutboundTLS{}) {
+		return nil, nil
+	}
+
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(t.CertPath) > 0 || len(t.KeyPath) > 0 {
+		cert, err := tls.LoadX509KeyPair(t.CertPath, t.KeyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load the client certificate")
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(t.CAPath) > 0 {
+		pem, err := ioutil.ReadFile(t.CAPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read the certificate authorities")
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("%s does not contain PEM encoded certificates", t.CAPath)
+		}
+	}
+
+	return c, nil
+}
+
 func (s SchemaConfigs) FindSchemaByID(id string) (*SchemaConfig, error) {
 	for _, sc := range s {
 		if sc.ID == id {
@@ -48,12 +510,43 @@ func (s SchemaConfigs) FindSchemaByID(id string) (*SchemaConfig, error) {
 
 const DefaultIdentityTraitsSchemaID = "default"
 
+// Endpoint groups which can be restricted using NetworkACL.
+const (
+	NetworkACLGroupAdmin        = "admin"
+	NetworkACLGroupRegistration = "registration"
+)
+
 type Provider interface {
 	AdminListenOn() string
 	PublicListenOn() string
+	PublicTrustedProxies() []*net.IPNet
+	AdminTrustedProxies() []*net.IPNet
+	NetworkACL(group string) (allow, deny []*net.IPNet)
+	SecurityAccountEnumerationMitigate() bool
+	AdminSocket() string
+	PublicSocket() string
+	AdminTLS() *ServeTLSConfig
+	AdminAPIKeys() []AdminAPIKey
+	AdminClientCAPath() string
+	AdminClientCertificates() []AdminClientCertificate
+	AdminIdempotencyRetention() time.Duration
+	PublicTLS() *ServeTLSConfig
+	ShutdownDelay() time.Duration
+	ShutdownTimeout() time.Duration
+	CleanupInterval() time.Duration
+	SchedulerInterval() time.Duration
+	WebhooksInterval() time.Duration
+	WebhooksDeliveryRetention() time.Duration
+	ClusterLockTTL() time.Duration
 	DSN() string
+	SlowQueryThreshold() time.Duration
+	LogRedaction() *LogRedactionConfig
+	ErrorReporting() *ErrorReportingConfig
+	Chaos() *ChaosConfig
+	IdentityWebhookCallers() []IdentityWebhookCaller
 
 	SessionSecrets() [][]byte
+	CipherSecrets() [][]byte
 
 	SelfPublicURL() *url.URL
 	SelfAdminURL() *url.URL
@@ -63,35 +556,83 @@ type Provider interface {
 	ProfileURL() *url.URL
 	LoginURL() *url.URL
 	VerificationURL() *url.URL
+	RecoveryURL() *url.URL
 	ErrorURL() *url.URL
 	MultiFactorURL() *url.URL
+	DeviceVerificationURL() *url.URL
 
 	SessionLifespan() time.Duration
 	SelfServiceProfileRequestLifespan() time.Duration
 	SelfServiceVerificationRequestLifespan() time.Duration
 	SelfServiceLoginRequestLifespan() time.Duration
+	SelfServiceLoginRequestLifespanFor(method string) time.Duration
+	SelfServiceLoginRequestMaxLifespan() time.Duration
+	SelfServiceLoginHistoryMaxEntries() int
+	SelfServiceLoginHistoryRetention() time.Duration
+	SelfServiceLoginTrustedDevicesEnabled() bool
+	SelfServiceLoginTrustedDevicesLifespan() time.Duration
 	SelfServiceRegistrationRequestLifespan() time.Duration
+	SelfServiceRegistrationRequestLifespanFor(method string) time.Duration
+	SelfServiceRegistrationRequestMaxLifespan() time.Duration
+	SelfServiceRegistrationAvailability() *RegistrationAvailabilityConfig
+	SelfServiceRegistrationMode(schemaID string) string
+	SelfServiceRegistrationInvitationLifespan() time.Duration
+	SelfServiceRegistrationEmailDomains() *EmailDomainsConfig
+	SelfServiceRegistrationBotProtection() *RegistrationBotProtectionConfig
 
 	SelfServiceStrategy(strategy string) *SelfServiceStrategy
+	SelfServicePasswordMaxAge() time.Duration
 	SelfServiceLoginBeforeHooks() []SelfServiceHook
 	SelfServiceRegistrationBeforeHooks() []SelfServiceHook
 	SelfServiceLoginAfterHooks(strategy string) []SelfServiceHook
 	SelfServiceRegistrationAfterHooks(strategy string) []SelfServiceHook
+	SelfServiceHookRetryBackoff() time.Duration
+	SelfServiceHookCircuitBreaker() *HookCircuitBreaker
 	SelfServiceLogoutRedirectURL() *url.URL
+	SelfServiceLogoutBackChannelClients() []BackChannelLogoutClient
 	SelfServiceVerificationLinkLifespan() time.Duration
 	SelfServicePrivilegedSessionMaxAge() time.Duration
+	SelfServiceProfilePrivilegedMethods() map[string]PrivilegedMethodConfig
 	SelfServiceVerificationReturnTo() *url.URL
+	SelfServiceVerificationLinkURL() string
+	SelfServiceDeviceAuthorization() *DeviceAuthorizationConfig
+	SelfServiceEmailCode() *EmailCodeConfig
+	SelfServiceRecovery() *RecoveryConfig
+	SelfServiceNotificationNewLoginEnabled() bool
+	SelfServiceNotificationPasswordChangedEnabled() bool
+	SelfServiceNotificationSecondFactorChangedEnabled() bool
+	SelfServiceNotificationCodeReplayedEnabled() bool
+	SelfServiceErrorRetention() time.Duration
+	SelfServiceRequestRetention() time.Duration
 
 	CourierSMTPFrom() string
 	CourierSMTPURL() *url.URL
+	CourierSMTPFailoverURLs() []*url.URL
+	CourierSMTPRoutes() []CourierSMTPRoute
+	CourierSMTPHealth() *CourierSMTPHealthConfig
+	CourierSMTPHealthCheck() bool
+	CourierDKIM() *DKIMConfig
+	CourierCategory(category string) *CourierCategoryConfig
+	CourierCapture() bool
 	CourierTemplatesRoot() string
+	CourierSMS() *CourierSMSConfig
+
+	I18nDefaultLocale() string
+	I18nCatalogsPath() string
 
 	DefaultIdentityTraitsSchemaURL() *url.URL
 	IdentityTraitsSchemas() SchemaConfigs
+	IdentityTraitsDerivedMapperURL() string
+	IdentityRelationshipsLoginAs() []string
+	IdentityRetention() *IdentityRetentionConfig
+	IdentityEntitlements() *IdentityEntitlementsConfig
+	IdentityPairwise() *IdentityPairwiseConfig
+	IdentityUploads() *IdentityUploadsConfig
 
 	WhitelistedReturnToDomains() []url.URL
 
 	RegisterURL() *url.URL
+	BundledUI() *BundledUIConfig
 
 	HashersArgon2() *HasherArgon2Config
 
@@ -102,4 +643,18 @@ type Provider interface {
 	IsInsecureDevMode() bool
 
 	SessionSameSiteMode() http.SameSite
+	SessionCookieName() string
+	SessionCookieDomain() string
+	SessionCookiePath() string
+	SessionCookieSecure() bool
+
+	CSRFCookieSameSiteMode() http.SameSite
+	CSRFCookieDomain() string
+	CSRFCookiePath() string
+	CSRFCookieSecure() bool
+	CSRFMode() string
+	CSRFAllowedOrigins() []string
+
+	SecurityHeaders() map[string]string
+	RequestLimits() *RequestLimitsConfig
 }
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,11 +37,44 @@ var _ Provider = new(ViperProvider)
 const (
 	ViperKeyDSN = "dsn"
 
-	ViperKeyCourierSMTPURL       = "courier.smtp.connection_uri"
-	ViperKeyCourierTemplatesPath = "courier.template_override_path"
-	ViperKeyCourierSMTPFrom      = "courier.smtp.from_address"
+	ViperKeySlowQueryThreshold = "log.slow_query_threshold"
 
-	ViperKeySecretsSession = "secrets.session"
+	ViperKeyLogRedactionEnabled  = "log.redaction.enabled"
+	ViperKeyLogRedactionStrict   = "log.redaction.strict"
+	ViperKeyLogRedactionFields   = "log.redaction.fields"
+	ViperKeyLogRedactionPatterns = "log.redaction.patterns"
+
+	ViperKeyErrorReportingDSN         = "error_reporting.dsn"
+	ViperKeyErrorReportingSampleRate  = "error_reporting.sample_rate"
+	ViperKeyErrorReportingEnvironment = "error_reporting.environment"
+
+	ViperKeyChaosPersister = "chaos.persister"
+	ViperKeyChaosCourier   = "chaos.courier"
+
+	ViperKeyHooksIdentityCallers = "hooks.identity.callers"
+
+	ViperKeyCourierSMTPURL         = "courier.smtp.connection_uri"
+	ViperKeyCourierTemplatesPath   = "courier.template_override_path"
+	ViperKeyCourierSMTPFrom        = "courier.smtp.from_address"
+	ViperKeyCourierSMTPHealthCheck = "courier.smtp.health_check"
+	ViperKeyCourierCapture         = "courier.capture"
+
+	ViperKeyCourierSMTPFailoverURLs   = "courier.smtp.failover_connection_uris"
+	ViperKeyCourierSMTPRoutes         = "courier.smtp.routes"
+	ViperKeyCourierSMTPUnhealthyAfter = "courier.smtp.unhealthy_after"
+	ViperKeyCourierSMTPUnhealthyFor   = "courier.smtp.unhealthy_for"
+
+	ViperKeyCourierDKIMDomain = "courier.dkim.domain"
+	ViperKeyCourierDKIMKeys   = "courier.dkim.keys"
+	ViperKeyCourierCategories = "courier.categories"
+	ViperKeyCourierSMS        = "courier.sms"
+
+	ViperKeyI18nDefaultLocale = "i18n.default_locale"
+	ViperKeyI18nCatalogsPath  = "i18n.catalogs_path"
+
+	ViperKeySecretsSession  = "secrets.session"
+	ViperKeySecretsCipher   = "secrets.cipher"
+	ViperKeySecretsPairwise = "secrets.pairwise"
 
 	ViperKeyURLsDefaultReturnTo            = "urls.default_return_to"
 	ViperKeyURLsSelfPublic                 = "urls.self.public"
@@ -47,31 +82,174 @@ const (
 	ViperKeyURLsLogin                      = "urls.login_ui"
 	ViperKeyURLsError                      = "urls.error_ui"
 	ViperKeyURLsVerification               = "urls.verify_ui"
+	ViperKeyURLsRecovery                   = "urls.recovery_ui"
 	ViperKeyURLsProfile                    = "urls.profile_ui"
 	ViperKeyURLsMFA                        = "urls.mfa_ui"
 	ViperKeyURLsRegistration               = "urls.registration_ui"
+	ViperKeyURLsDeviceVerification         = "urls.device_verification_ui"
 	ViperKeyURLsWhitelistedReturnToDomains = "urls.whitelisted_return_to_domains"
 
+	ViperKeyBundledUIEnabled            = "ui.enabled"
+	ViperKeyBundledUIThemeTitle         = "ui.theme.title"
+	ViperKeyBundledUIThemeLogoURL       = "ui.theme.logo_url"
+	ViperKeyBundledUIThemeStylesheetURL = "ui.theme.stylesheet_url"
+
+	ViperKeyFetchRefreshInterval = "fetch.refresh_interval"
+	ViperKeyFetchHTTPHeaders     = "fetch.http.headers"
+
 	ViperKeyLifespanSession = "ttl.session"
 
-	ViperKeySessionSameSite = "security.session.cookie.same_site"
+	ViperKeyPublicTrustedProxies = "serve.public.trusted_proxies"
+	ViperKeyAdminTrustedProxies  = "serve.admin.trusted_proxies"
+	ViperKeyPublicSocket         = "serve.public.socket"
+	ViperKeyAdminSocket          = "serve.admin.socket"
+	ViperKeyPublicTLSCertPath    = "serve.public.tls.cert.path"
+	ViperKeyPublicTLSKeyPath     = "serve.public.tls.key.path"
+	ViperKeyPublicACMEEnabled    = "serve.public.tls.acme.enabled"
+	ViperKeyPublicACMEEmail      = "serve.public.tls.acme.email"
+	ViperKeyPublicACMECacheDir   = "serve.public.tls.acme.cache_dir"
+	ViperKeyAdminTLSCertPath     = "serve.admin.tls.cert.path"
+	ViperKeyAdminTLSKeyPath      = "serve.admin.tls.key.path"
+	ViperKeyAdminAuthAPIKeys     = "serve.admin.auth.api_keys"
+	ViperKeyAdminAuthClientCA    = "serve.admin.auth.mtls.client_ca.path"
+	ViperKeyAdminAuthClients     = "serve.admin.auth.mtls.clients"
+	ViperKeyShutdownDelay        = "serve.shutdown.delay"
+	ViperKeyShutdownTimeout      = "serve.shutdown.timeout"
+	ViperKeyCleanupInterval      = "serve.cleanup.interval"
+	ViperKeySchedulerInterval    = "serve.scheduler.interval"
+
+	ViperKeyWebhooksInterval          = "serve.webhooks.interval"
+	ViperKeyWebhooksDeliveryRetention = "serve.webhooks.delivery_retention"
+
+	ViperKeyAdminIdempotencyRetention = "serve.admin.idempotency.retention"
+
+	ViperKeyClusterLockTTL = "serve.cluster.lock_ttl"
+
+	ViperKeySessionSameSite     = "security.session.cookie.same_site"
+	ViperKeySessionCookieName   = "security.session.cookie.name"
+	ViperKeySessionCookieDomain = "security.session.cookie.domain"
+	ViperKeySessionCookiePath   = "security.session.cookie.path"
+	ViperKeySessionCookieSecure = "security.session.cookie.secure"
+
+	ViperKeyCSRFCookieSameSite = "security.csrf.cookie.same_site"
+	ViperKeyCSRFCookieDomain   = "security.csrf.cookie.domain"
+	ViperKeyCSRFCookiePath     = "security.csrf.cookie.path"
+	ViperKeyCSRFCookieSecure   = "security.csrf.cookie.secure"
+	ViperKeyCSRFMode           = "security.csrf.mode"
+	ViperKeyCSRFAllowedOrigins = "security.csrf.allowed_origins"
+
+	ViperKeySecurityAccountEnumerationMitigate = "security.account_enumeration.mitigate"
+
+	ViperKeySecurityHeaderContentSecurityPolicy   = "security.headers.content_security_policy"
+	ViperKeySecurityHeaderStrictTransportSecurity = "security.headers.strict_transport_security"
+	ViperKeySecurityHeaderFrameOptions            = "security.headers.frame_options"
+	ViperKeySecurityHeaderReferrerPolicy          = "security.headers.referrer_policy"
+	ViperKeySecurityHeaderContentTypeOptions      = "security.headers.content_type_options"
+
+	ViperKeyEgressProxyHTTP            = "security.egress.proxy.http"
+	ViperKeyEgressProxyHTTPS           = "security.egress.proxy.https"
+	ViperKeyEgressProxyBypass          = "security.egress.proxy.bypass"
+	ViperKeyEgressAllowedHosts         = "security.egress.allowed_hosts"
+	ViperKeyEgressBlockPrivateNetworks = "security.egress.block_private_networks"
+	ViperKeyEgressAllowedPrivateHosts  = "security.egress.allowed_private_hosts"
+
+	ViperKeyRequestLimitsMaxBodySize   = "security.request_limits.max_body_size"
+	ViperKeyRequestLimitsMaxJSONDepth  = "security.request_limits.max_json_depth"
+	ViperKeyRequestLimitsMaxFormFields = "security.request_limits.max_form_fields"
 
 	ViperKeySelfServiceStrategyConfig                = "selfservice.strategies"
+	ViperKeySelfServicePasswordMaxAge                = "selfservice.strategies.password.config.max_age"
+	ViperKeySelfServiceEmailCodeFallbackOnly         = "selfservice.strategies.email_code.config.fallback_only"
+	ViperKeySelfServiceEmailCodeLength               = "selfservice.strategies.email_code.config.code_length"
+	ViperKeySelfServiceEmailCodeLifespan             = "selfservice.strategies.email_code.config.lifespan"
+	ViperKeySelfServiceEmailCodeMaxAttempts          = "selfservice.strategies.email_code.config.max_attempts"
+	ViperKeySelfServiceEmailCodeMaxSendsPerIdentity  = "selfservice.strategies.email_code.config.max_sends_per_identity"
+	ViperKeySelfServiceEmailCodeMaxSendsPerHour      = "selfservice.strategies.email_code.config.max_sends_per_hour"
 	ViperKeySelfServiceRegistrationBeforeConfig      = "selfservice.registration.before"
 	ViperKeySelfServiceRegistrationAfterConfig       = "selfservice.registration.after"
 	ViperKeySelfServiceLifespanRegistrationRequest   = "selfservice.registration.request_lifespan"
+	ViperKeySelfServiceLifespanRegistrationMethods   = "selfservice.registration.method_request_lifespans"
+	ViperKeySelfServiceAvailabilityEnabled           = "selfservice.registration.availability.enabled"
+	ViperKeySelfServiceAvailabilityPrivacyMode       = "selfservice.registration.availability.privacy_mode"
+	ViperKeySelfServiceAvailabilityRateLimit         = "selfservice.registration.availability.rate_limit"
+	ViperKeySelfServiceRegistrationMode              = "selfservice.registration.mode"
+	ViperKeySelfServiceRegistrationSchemaModes       = "selfservice.registration.schema_modes"
+	ViperKeySelfServiceLifespanInvitation            = "selfservice.registration.invitation_lifespan"
+	ViperKeySelfServiceEmailDomainsAllow             = "selfservice.registration.email_domains.allow"
+	ViperKeySelfServiceEmailDomainsDeny              = "selfservice.registration.email_domains.deny"
+	ViperKeySelfServiceEmailDomainsBlockDisposable   = "selfservice.registration.email_domains.disposable.block"
+	ViperKeySelfServiceEmailDomainsDisposableListURL = "selfservice.registration.email_domains.disposable.list_url"
+	ViperKeySelfServiceBotProtectionHoneypotField    = "selfservice.registration.bot_protection.honeypot_field"
+	ViperKeySelfServiceBotProtectionMinSubmitTime    = "selfservice.registration.bot_protection.min_submit_time"
+	ViperKeySelfServiceHooksRetryBackoff             = "selfservice.hooks.retry_backoff"
+	ViperKeySelfServiceHooksFailureThreshold         = "selfservice.hooks.circuit_breaker.failure_threshold"
+	ViperKeySelfServiceHooksCooldown                 = "selfservice.hooks.circuit_breaker.cooldown"
 	ViperKeySelfServiceLoginBeforeConfig             = "selfservice.login.before"
 	ViperKeySelfServiceLoginAfterConfig              = "selfservice.login.after"
 	ViperKeySelfServiceLifespanLoginRequest          = "selfservice.login.request_lifespan"
+	ViperKeySelfServiceLifespanLoginMethods          = "selfservice.login.method_request_lifespans"
+	ViperKeySelfServiceLoginHistoryMaxEntries        = "selfservice.login.history.max_entries"
+	ViperKeySelfServiceLoginHistoryRetention         = "selfservice.login.history.retention"
+	ViperKeySelfServiceLoginTrustedDevicesEnabled    = "selfservice.login.trusted_devices.enabled"
+	ViperKeySelfServiceLoginTrustedDevicesLifespan   = "selfservice.login.trusted_devices.lifespan"
 	ViperKeySelfServiceLogoutRedirectURL             = "selfservice.logout.redirect_to"
+	ViperKeySelfServiceLogoutBackChannelClients      = "selfservice.logout.back_channel"
 	ViperKeySelfServiceLifespanProfileRequest        = "selfservice.profile.request_lifespan"
 	ViperKeySelfServicePrivilegedAuthenticationAfter = "selfservice.profile.privileged_session_max_age"
+	ViperKeySelfServiceProfilePrivilegedMethods      = "selfservice.profile.privileged_methods"
 	ViperKeySelfServiceLifespanLink                  = "selfservice.profile.link_lifespan"
 	ViperKeySelfServiceLifespanVerificationRequest   = "selfservice.verify.request_lifespan"
 	ViperKeySelfServiceVerifyReturnTo                = "selfservice.verify.return_to"
+	ViperKeySelfServiceVerifyLinkURL                 = "selfservice.verify.link_url"
+	ViperKeySelfServiceLifespanRecoveryRequest       = "selfservice.recovery.request_lifespan"
+	ViperKeySelfServiceRecoveryLinkEnabled           = "selfservice.recovery.link.enabled"
+	ViperKeySelfServiceRecoveryLinkLifespan          = "selfservice.recovery.link.lifespan"
+	ViperKeySelfServiceRecoverySMSEnabled            = "selfservice.recovery.sms.enabled"
+	ViperKeySelfServiceRecoverySMSCodeLength         = "selfservice.recovery.sms.code_length"
+	ViperKeySelfServiceRecoverySMSLifespan           = "selfservice.recovery.sms.lifespan"
+	ViperKeySelfServiceRecoverySMSMaxAttempts        = "selfservice.recovery.sms.max_attempts"
+	ViperKeySelfServiceRecoveryManualEnabled         = "selfservice.recovery.manual.enabled"
+	ViperKeySelfServiceRecoveryManualLifespan        = "selfservice.recovery.manual.lifespan"
+	ViperKeySelfServiceRecoveryMaxSendsPerHour       = "selfservice.recovery.max_sends_per_hour"
+	ViperKeySelfServiceRecoveryMaxSendsPerIPPerHour  = "selfservice.recovery.max_sends_per_ip_per_hour"
+	ViperKeySelfServiceRecoveryRevertLifespan        = "selfservice.recovery.revert.lifespan"
+	ViperKeySelfServiceDeviceEnabled                 = "selfservice.device.enabled"
+	ViperKeySelfServiceLifespanDeviceAuthorization   = "selfservice.device.request_lifespan"
+	ViperKeySelfServiceDevicePollInterval            = "selfservice.device.poll_interval"
+	ViperKeySelfServiceDeviceRateLimit               = "selfservice.device.rate_limit"
+	ViperKeySelfServiceNotificationNewLogin          = "selfservice.notifications.new_login.enabled"
+	ViperKeySelfServiceNotificationPasswordChanged   = "selfservice.notifications.password_changed.enabled"
+	ViperKeySelfServiceNotificationCodeReplayed      = "selfservice.notifications.code_replayed.enabled"
+	ViperKeySelfServiceNotificationSecondFactor      = "selfservice.notifications.second_factor_changed.enabled"
+	ViperKeySelfServiceErrorRetention                = "selfservice.errors.retention"
+	ViperKeySelfServiceRequestRetention              = "selfservice.requests.retention"
 
 	ViperKeyDefaultIdentityTraitsSchemaURL = "identity.traits.default_schema_url"
 	ViperKeyIdentityTraitsSchemas          = "identity.traits.schemas"
+	ViperKeyIdentityTraitsDerivedMapperURL = "identity.traits.derived_mapper_url"
+	ViperKeyIdentityRelationshipsLoginAs   = "identity.relationships.login_as"
+
+	ViperKeyIdentityEntitlementsStatic   = "identity.entitlements.static"
+	ViperKeyIdentityEntitlementsURL      = "identity.entitlements.url"
+	ViperKeyIdentityEntitlementsCacheTTL = "identity.entitlements.cache_ttl"
+
+	ViperKeyIdentityPairwiseAudiences = "identity.pairwise.audiences"
+	ViperKeyIdentityPairwiseEnforce   = "identity.pairwise.enforce"
+
+	ViperKeyIdentityUploadsProvider        = "identity.uploads.provider"
+	ViperKeyIdentityUploadsBucket          = "identity.uploads.bucket"
+	ViperKeyIdentityUploadsRegion          = "identity.uploads.region"
+	ViperKeyIdentityUploadsEndpoint        = "identity.uploads.endpoint"
+	ViperKeyIdentityUploadsAccessKeyID     = "identity.uploads.access_key_id"
+	ViperKeyIdentityUploadsSecretAccessKey = "identity.uploads.secret_access_key"
+	ViperKeyIdentityUploadsPublicURL       = "identity.uploads.public_url"
+	ViperKeyIdentityUploadsURLLifespan     = "identity.uploads.url_lifespan"
+	ViperKeyIdentityUploadsMaxSize         = "identity.uploads.max_size"
+
+	ViperKeyIdentityRetentionUnverifiedAfter = "identity.retention.unverified_after"
+	ViperKeyIdentityRetentionInactiveAfter   = "identity.retention.inactive_after"
+	ViperKeyIdentityRetentionNotifyBefore    = "identity.retention.notify_before"
+	ViperKeyIdentityRetentionDryRun          = "identity.retention.dry_run"
 
 	ViperKeyHasherArgon2ConfigMemory      = "hashers.argon2.memory"
 	ViperKeyHasherArgon2ConfigIterations  = "hashers.argon2.iterations"
@@ -97,6 +275,65 @@ func (p *ViperProvider) HashersArgon2() *HasherArgon2Config {
 	}
 }
 
+func (p *ViperProvider) IdentityRetention() *IdentityRetentionConfig {
+	return &IdentityRetentionConfig{
+		UnverifiedAfter: viperx.GetDuration(p.l, ViperKeyIdentityRetentionUnverifiedAfter, 0),
+		InactiveAfter:   viperx.GetDuration(p.l, ViperKeyIdentityRetentionInactiveAfter, 0),
+		NotifyBefore:    viperx.GetDuration(p.l, ViperKeyIdentityRetentionNotifyBefore, 0),
+		DryRun:          viper.GetBool(ViperKeyIdentityRetentionDryRun),
+	}
+}
+
+func (p *ViperProvider) IdentityEntitlements() *IdentityEntitlementsConfig {
+	c := &IdentityEntitlementsConfig{
+		URL:      viperx.GetString(p.l, ViperKeyIdentityEntitlementsURL, ""),
+		CacheTTL: viperx.GetDuration(p.l, ViperKeyIdentityEntitlementsCacheTTL, time.Minute),
+	}
+	p.decodeList(ViperKeyIdentityEntitlementsStatic, &c.Static)
+	return c
+}
+
+func (p *ViperProvider) IdentityPairwise() *IdentityPairwiseConfig {
+	return &IdentityPairwiseConfig{
+		Secret:    []byte(viperx.GetString(p.l, ViperKeySecretsPairwise, "")),
+		Audiences: viperx.GetStringSlice(p.l, ViperKeyIdentityPairwiseAudiences, []string{}),
+		Enforce:   viper.GetBool(ViperKeyIdentityPairwiseEnforce),
+	}
+}
+
+func (p *ViperProvider) IdentityUploads() *IdentityUploadsConfig {
+	return &IdentityUploadsConfig{
+		Provider:        viperx.GetString(p.l, ViperKeyIdentityUploadsProvider, "s3"),
+		Bucket:          viperx.GetString(p.l, ViperKeyIdentityUploadsBucket, ""),
+		Region:          viperx.GetString(p.l, ViperKeyIdentityUploadsRegion, ""),
+		Endpoint:        viperx.GetString(p.l, ViperKeyIdentityUploadsEndpoint, ""),
+		AccessKeyID:     viperx.GetString(p.l, ViperKeyIdentityUploadsAccessKeyID, ""),
+		SecretAccessKey: viperx.GetString(p.l, ViperKeyIdentityUploadsSecretAccessKey, ""),
+		PublicURL:       viperx.GetString(p.l, ViperKeyIdentityUploadsPublicURL, ""),
+		URLLifespan:     viperx.GetDuration(p.l, ViperKeyIdentityUploadsURLLifespan, time.Minute*15),
+		MaxSize:         int64(viperx.GetInt(p.l, ViperKeyIdentityUploadsMaxSize, 5<<20)),
+	}
+}
+
+func (p *ViperProvider) SelfServiceRegistrationAvailability() *RegistrationAvailabilityConfig {
+	return &RegistrationAvailabilityConfig{
+		Enabled:     viper.GetBool(ViperKeySelfServiceAvailabilityEnabled),
+		PrivacyMode: viper.GetBool(ViperKeySelfServiceAvailabilityPrivacyMode),
+		RateLimit:   viperx.GetInt(p.l, ViperKeySelfServiceAvailabilityRateLimit, 10),
+	}
+}
+
+func (p *ViperProvider) SelfServiceRegistrationBotProtection() *RegistrationBotProtectionConfig {
+	return &RegistrationBotProtectionConfig{
+		HoneypotField: viperx.GetString(p.l, ViperKeySelfServiceBotProtectionHoneypotField, ""),
+		MinSubmitTime: viperx.GetDuration(p.l, ViperKeySelfServiceBotProtectionMinSubmitTime, 0),
+	}
+}
+
+func (p *ViperProvider) SecurityAccountEnumerationMitigate() bool {
+	return viper.GetBool(ViperKeySecurityAccountEnumerationMitigate)
+}
+
 func (p *ViperProvider) listenOn(key string) string {
 	fb := 4433
 	if key == "admin" {
@@ -111,10 +348,141 @@ func (p *ViperProvider) listenOn(key string) string {
 	return fmt.Sprintf("%s:%d", viper.GetString("serve."+key+".host"), port)
 }
 
+func (p *ViperProvider) PublicSocket() string {
+	return viperx.GetString(p.l, ViperKeyPublicSocket, "")
+}
+
+func (p *ViperProvider) AdminSocket() string {
+	return viperx.GetString(p.l, ViperKeyAdminSocket, "")
+}
+
+func (p *ViperProvider) ShutdownDelay() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeyShutdownDelay, 0)
+}
+
+func (p *ViperProvider) ShutdownTimeout() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeyShutdownTimeout, time.Second*10)
+}
+
+func (p *ViperProvider) CleanupInterval() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeyCleanupInterval, time.Hour)
+}
+
+func (p *ViperProvider) SchedulerInterval() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySchedulerInterval, time.Minute)
+}
+
+func (p *ViperProvider) WebhooksInterval() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeyWebhooksInterval, time.Second*10)
+}
+
+func (p *ViperProvider) WebhooksDeliveryRetention() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeyWebhooksDeliveryRetention, time.Hour*24*30)
+}
+
+func (p *ViperProvider) ClusterLockTTL() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeyClusterLockTTL, time.Minute)
+}
+
+func (p *ViperProvider) AdminIdempotencyRetention() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeyAdminIdempotencyRetention, time.Hour*24)
+}
+
+func (p *ViperProvider) PublicTLS() *ServeTLSConfig {
+	return &ServeTLSConfig{
+		CertPath:     viperx.GetString(p.l, ViperKeyPublicTLSCertPath, ""),
+		KeyPath:      viperx.GetString(p.l, ViperKeyPublicTLSKeyPath, ""),
+		ACMEEnabled:  viper.GetBool(ViperKeyPublicACMEEnabled),
+		ACMEEmail:    viperx.GetString(p.l, ViperKeyPublicACMEEmail, ""),
+		ACMECacheDir: viperx.GetString(p.l, ViperKeyPublicACMECacheDir, "./acme"),
+	}
+}
+
+func (p *ViperProvider) AdminTLS() *ServeTLSConfig {
+	return &ServeTLSConfig{
+		CertPath: viperx.GetString(p.l, ViperKeyAdminTLSCertPath, ""),
+		KeyPath:  viperx.GetString(p.l, ViperKeyAdminTLSKeyPath, ""),
+	}
+}
+
+func (p *ViperProvider) AdminAPIKeys() []AdminAPIKey {
+	var keys []AdminAPIKey
+	p.decodeList(ViperKeyAdminAuthAPIKeys, &keys)
+	return keys
+}
+
+func (p *ViperProvider) AdminClientCAPath() string {
+	return viperx.GetString(p.l, ViperKeyAdminAuthClientCA, "")
+}
+
+func (p *ViperProvider) AdminClientCertificates() []AdminClientCertificate {
+	var clients []AdminClientCertificate
+	p.decodeList(ViperKeyAdminAuthClients, &clients)
+	return clients
+}
+
+// decodeList decodes the list stored at the given key into v.
+func (p *ViperProvider) decodeList(key string, v interface{}) {
+	raw := viper.Get(key)
+	if raw == nil {
+		return
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(raw); err != nil {
+		p.l.WithError(err).Fatalf("Unable to encode values from %s.", key)
+	}
+
+	if err := jsonx.NewStrictDecoder(&b).Decode(v); err != nil {
+		p.l.WithError(err).Fatalf("Unable to decode values from %s.", key)
+	}
+}
+
+func (p *ViperProvider) PublicTrustedProxies() []*net.IPNet {
+	return p.ipNets(ViperKeyPublicTrustedProxies)
+}
+
+func (p *ViperProvider) AdminTrustedProxies() []*net.IPNet {
+	return p.ipNets(ViperKeyAdminTrustedProxies)
+}
+
+func (p *ViperProvider) NetworkACL(group string) (allow, deny []*net.IPNet) {
+	return p.ipNets("security.network." + group + ".allow"), p.ipNets("security.network." + group + ".deny")
+}
+
+// ipNets parses a list of IP addresses and CIDR ranges.
+func (p *ViperProvider) ipNets(key string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, v := range viperx.GetStringSlice(p.l, key, []string{}) {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			p.l.WithError(err).Fatalf("Unable to parse value %s of configuration key %s as an IP address or CIDR range.", v, key)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
 func (p *ViperProvider) DefaultIdentityTraitsSchemaURL() *url.URL {
 	return mustParseURLFromViper(p.l, ViperKeyDefaultIdentityTraitsSchemaURL)
 }
 
+func (p *ViperProvider) IdentityTraitsDerivedMapperURL() string {
+	return viper.GetString(ViperKeyIdentityTraitsDerivedMapperURL)
+}
+
+func (p *ViperProvider) IdentityRelationshipsLoginAs() []string {
+	return viperx.GetStringSlice(p.l, ViperKeyIdentityRelationshipsLoginAs, []string{})
+}
+
 func (p *ViperProvider) IdentityTraitsSchemas() SchemaConfigs {
 	ds := SchemaConfig{
 		ID:  DefaultIdentityTraitsSchemaID,
@@ -162,6 +530,53 @@ func (p *ViperProvider) DSN() string {
 	return ""
 }
 
+// SlowQueryThreshold is the duration after which database operations are logged as slow. Zero disables logging.
+func (p *ViperProvider) SlowQueryThreshold() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySlowQueryThreshold, 0)
+}
+
+func (p *ViperProvider) LogRedaction() *LogRedactionConfig {
+	return &LogRedactionConfig{
+		Enabled:  !viper.IsSet(ViperKeyLogRedactionEnabled) || viper.GetBool(ViperKeyLogRedactionEnabled),
+		Strict:   viper.GetBool(ViperKeyLogRedactionStrict),
+		Fields:   viperx.GetStringSlice(p.l, ViperKeyLogRedactionFields, []string{}),
+		Patterns: viperx.GetStringSlice(p.l, ViperKeyLogRedactionPatterns, []string{}),
+	}
+}
+
+func (p *ViperProvider) ErrorReporting() *ErrorReportingConfig {
+	return &ErrorReportingConfig{
+		DSN:         viperx.GetString(p.l, ViperKeyErrorReportingDSN, ""),
+		SampleRate:  viperx.GetFloat64(p.l, ViperKeyErrorReportingSampleRate, float64(1)),
+		Environment: viperx.GetString(p.l, ViperKeyErrorReportingEnvironment, ""),
+	}
+}
+
+// Chaos returns the faults to inject. Faults are only injected in development mode.
+func (p *ViperProvider) Chaos() *ChaosConfig {
+	if !p.IsInsecureDevMode() {
+		return &ChaosConfig{}
+	}
+	return &ChaosConfig{
+		Persister: p.chaosTarget(ViperKeyChaosPersister),
+		Courier:   p.chaosTarget(ViperKeyChaosCourier),
+	}
+}
+
+func (p *ViperProvider) chaosTarget(key string) ChaosTarget {
+	return ChaosTarget{
+		FailureProbability: viperx.GetFloat64(p.l, key+".failure_probability", 0),
+		Latency:            viperx.GetDuration(p.l, key+".latency", 0),
+		LatencyProbability: viperx.GetFloat64(p.l, key+".latency_probability", float64(1)),
+	}
+}
+
+func (p *ViperProvider) IdentityWebhookCallers() []IdentityWebhookCaller {
+	var cs []IdentityWebhookCaller
+	p.decodeList(ViperKeyHooksIdentityCallers, &cs)
+	return cs
+}
+
 func (p *ViperProvider) SelfServiceLoginBeforeHooks() []SelfServiceHook {
 	return p.selfServiceHooks(ViperKeySelfServiceLoginBeforeConfig)
 }
@@ -204,6 +619,17 @@ func (p *ViperProvider) SelfServiceRegistrationAfterHooks(strategy string) []Sel
 	return p.selfServiceHooks(ViperKeySelfServiceRegistrationAfterConfig + "." + strategy)
 }
 
+func (p *ViperProvider) SelfServiceHookRetryBackoff() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySelfServiceHooksRetryBackoff, time.Millisecond*100)
+}
+
+func (p *ViperProvider) SelfServiceHookCircuitBreaker() *HookCircuitBreaker {
+	return &HookCircuitBreaker{
+		FailureThreshold: viperx.GetInt(p.l, ViperKeySelfServiceHooksFailureThreshold, 5),
+		Cooldown:         viperx.GetDuration(p.l, ViperKeySelfServiceHooksCooldown, time.Minute),
+	}
+}
+
 func (p *ViperProvider) SelfServiceStrategy(strategy string) *SelfServiceStrategy {
 	configs := viper.GetStringMap(ViperKeySelfServiceStrategyConfig)
 	config, ok := configs[strategy]
@@ -244,8 +670,25 @@ func (p *ViperProvider) SessionSecrets() [][]byte {
 	return result
 }
 
+// CipherSecrets returns the secrets used for encrypting data at rest. The first secret encrypts new data, the others
+// are only used for decrypting data which was encrypted before a secret was rotated. If no cipher secrets are
+// configured, the session secrets are used.
+func (p *ViperProvider) CipherSecrets() [][]byte {
+	secrets := viperx.GetStringSlice(p.l, ViperKeySecretsCipher, []string{})
+	if len(secrets) == 0 {
+		return p.SessionSecrets()
+	}
+
+	result := make([][]byte, len(secrets))
+	for k, v := range secrets {
+		result[k] = []byte(v)
+	}
+
+	return result
+}
+
 func (p *ViperProvider) DefaultReturnToURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeyURLsDefaultReturnTo)
+	return p.uiURL(ViperKeyURLsDefaultReturnTo, BundledUIProfilePath)
 }
 
 func (p *ViperProvider) SelfPublicURL() *url.URL {
@@ -261,23 +704,45 @@ func (p *ViperProvider) CourierSMTPURL() *url.URL {
 }
 
 func (p *ViperProvider) LoginURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeyURLsLogin)
+	return p.uiURL(ViperKeyURLsLogin, BundledUILoginPath)
 }
 
 func (p *ViperProvider) ProfileURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeyURLsProfile)
+	return p.uiURL(ViperKeyURLsProfile, BundledUIProfilePath)
 }
 
 func (p *ViperProvider) ErrorURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeyURLsError)
+	return p.uiURL(ViperKeyURLsError, BundledUIErrorPath)
 }
 
 func (p *ViperProvider) MultiFactorURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeyURLsMFA)
+	return p.uiURL(ViperKeyURLsMFA, BundledUILoginPath)
+}
+
+func (p *ViperProvider) DeviceVerificationURL() *url.URL {
+	return mustParseURLFromViper(p.l, ViperKeyURLsDeviceVerification)
 }
 
 func (p *ViperProvider) RegisterURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeyURLsRegistration)
+	return p.uiURL(ViperKeyURLsRegistration, BundledUIRegistrationPath)
+}
+
+// uiURL returns the URL at key. If the key is not set and the bundled UI is enabled, the URL of the bundled UI's
+// page at path is returned instead.
+func (p *ViperProvider) uiURL(key, path string) *url.URL {
+	if len(viper.GetString(key)) == 0 && p.BundledUI().Enabled {
+		return urlx.AppendPaths(p.SelfPublicURL(), path)
+	}
+	return mustParseURLFromViper(p.l, key)
+}
+
+func (p *ViperProvider) BundledUI() *BundledUIConfig {
+	return &BundledUIConfig{
+		Enabled:       viper.GetBool(ViperKeyBundledUIEnabled),
+		Title:         viperx.GetString(p.l, ViperKeyBundledUIThemeTitle, "ORY Kratos"),
+		LogoURL:       viperx.GetString(p.l, ViperKeyBundledUIThemeLogoURL, ""),
+		StylesheetURL: viperx.GetString(p.l, ViperKeyBundledUIThemeStylesheetURL, ""),
+	}
 }
 
 func (p *ViperProvider) SessionLifespan() time.Duration {
@@ -299,6 +764,37 @@ func (p *ViperProvider) SelfServiceLoginRequestLifespan() time.Duration {
 	return viperx.GetDuration(p.l, ViperKeySelfServiceLifespanLoginRequest, time.Hour)
 }
 
+// SelfServiceLoginRequestLifespanFor returns the lifespan of login requests completed with the given method.
+func (p *ViperProvider) SelfServiceLoginRequestLifespanFor(method string) time.Duration {
+	return p.methodLifespan(ViperKeySelfServiceLifespanLoginMethods, method, p.SelfServiceLoginRequestLifespan())
+}
+
+// SelfServiceLoginRequestMaxLifespan returns the longest lifespan of all login methods. Login requests expire after
+// this time.
+func (p *ViperProvider) SelfServiceLoginRequestMaxLifespan() time.Duration {
+	return p.maxMethodLifespan(ViperKeySelfServiceLifespanLoginMethods, p.SelfServiceLoginRequestLifespan())
+}
+
+func (p *ViperProvider) SelfServiceLoginHistoryMaxEntries() int {
+	return viperx.GetInt(p.l, ViperKeySelfServiceLoginHistoryMaxEntries, 50)
+}
+
+func (p *ViperProvider) SelfServiceLoginHistoryRetention() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySelfServiceLoginHistoryRetention, time.Hour*24*90)
+}
+
+func (p *ViperProvider) SelfServiceLoginTrustedDevicesEnabled() bool {
+	return viper.GetBool(ViperKeySelfServiceLoginTrustedDevicesEnabled)
+}
+
+func (p *ViperProvider) SelfServiceLoginTrustedDevicesLifespan() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySelfServiceLoginTrustedDevicesLifespan, time.Hour*24*30)
+}
+
+func (p *ViperProvider) SelfServiceErrorRetention() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySelfServiceErrorRetention, time.Hour*24)
+}
+
 func (p *ViperProvider) SelfServiceProfileRequestLifespan() time.Duration {
 	return viperx.GetDuration(p.l, ViperKeySelfServiceLifespanProfileRequest, time.Hour)
 }
@@ -307,18 +803,162 @@ func (p *ViperProvider) SelfServiceRegistrationRequestLifespan() time.Duration {
 	return viperx.GetDuration(p.l, ViperKeySelfServiceLifespanRegistrationRequest, time.Hour)
 }
 
+// SelfServiceRegistrationRequestLifespanFor returns the lifespan of registration requests completed with the given
+// method.
+func (p *ViperProvider) SelfServiceRegistrationRequestLifespanFor(method string) time.Duration {
+	return p.methodLifespan(ViperKeySelfServiceLifespanRegistrationMethods, method, p.SelfServiceRegistrationRequestLifespan())
+}
+
+// SelfServiceRegistrationRequestMaxLifespan returns the longest lifespan of all registration methods. Registration
+// requests expire after this time.
+func (p *ViperProvider) SelfServiceRegistrationRequestMaxLifespan() time.Duration {
+	return p.maxMethodLifespan(ViperKeySelfServiceLifespanRegistrationMethods, p.SelfServiceRegistrationRequestLifespan())
+}
+
+// SelfServiceRegistrationMode returns the registration mode of identities using the traits schema. Schemas without
+// an entry in selfservice.registration.schema_modes use selfservice.registration.mode.
+func (p *ViperProvider) SelfServiceRegistrationMode(schemaID string) string {
+	if mode, ok := viper.GetStringMapString(ViperKeySelfServiceRegistrationSchemaModes)[schemaID]; ok && len(mode) > 0 {
+		return mode
+	}
+	return viperx.GetString(p.l, ViperKeySelfServiceRegistrationMode, RegistrationModeOpen)
+}
+
+func (p *ViperProvider) SelfServiceRegistrationInvitationLifespan() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySelfServiceLifespanInvitation, time.Hour*24*7)
+}
+
+func (p *ViperProvider) SelfServiceRegistrationEmailDomains() *EmailDomainsConfig {
+	return &EmailDomainsConfig{
+		Allow:             viperx.GetStringSlice(p.l, ViperKeySelfServiceEmailDomainsAllow, []string{}),
+		Deny:              viperx.GetStringSlice(p.l, ViperKeySelfServiceEmailDomainsDeny, []string{}),
+		BlockDisposable:   viper.GetBool(ViperKeySelfServiceEmailDomainsBlockDisposable),
+		DisposableListURL: viper.GetString(ViperKeySelfServiceEmailDomainsDisposableListURL),
+	}
+}
+
+func (p *ViperProvider) SelfServiceRequestRetention() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySelfServiceRequestRetention, time.Hour*24)
+}
+
+// methodLifespans returns the per-method lifespans configured at key. Invalid durations are left out, Validate
+// reports them.
+func (p *ViperProvider) methodLifespans(key string) map[string]time.Duration {
+	lifespans := map[string]time.Duration{}
+	for method, value := range viper.GetStringMapString(key) {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			lifespans[method] = d
+		}
+	}
+	return lifespans
+}
+
+func (p *ViperProvider) methodLifespan(key, method string, fallback time.Duration) time.Duration {
+	if d, ok := p.methodLifespans(key)[method]; ok {
+		return d
+	}
+	return fallback
+}
+
+func (p *ViperProvider) maxMethodLifespan(key string, fallback time.Duration) time.Duration {
+	max := fallback
+	for _, d := range p.methodLifespans(key) {
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
 func (p *ViperProvider) SelfServiceLogoutRedirectURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeySelfServiceLogoutRedirectURL)
+	return p.uiURL(ViperKeySelfServiceLogoutRedirectURL, BundledUILoginPath)
+}
+
+func (p *ViperProvider) SelfServiceLogoutBackChannelClients() []BackChannelLogoutClient {
+	var cs []BackChannelLogoutClient
+	p.decodeList(ViperKeySelfServiceLogoutBackChannelClients, &cs)
+	return cs
 }
 
 func (p *ViperProvider) CourierSMTPFrom() string {
 	return viperx.GetString(p.l, ViperKeyCourierSMTPFrom, "noreply@kratos.ory.sh")
 }
 
+func (p *ViperProvider) CourierSMTPFailoverURLs() []*url.URL {
+	return p.courierSMTPURLs(ViperKeyCourierSMTPFailoverURLs, viperx.GetStringSlice(p.l, ViperKeyCourierSMTPFailoverURLs, []string{}))
+}
+
+func (p *ViperProvider) CourierSMTPRoutes() []CourierSMTPRoute {
+	var rs []CourierSMTPRoute
+	p.decodeList(ViperKeyCourierSMTPRoutes, &rs)
+	for k := range rs {
+		rs[k].URLs = p.courierSMTPURLs(ViperKeyCourierSMTPRoutes, rs[k].ConnectionURIs)
+	}
+	return rs
+}
+
+func (p *ViperProvider) courierSMTPURLs(key string, raw []string) []*url.URL {
+	us := make([]*url.URL, len(raw))
+	for k, r := range raw {
+		u, err := url.ParseRequestURI(r)
+		if err != nil {
+			p.l.WithError(err).Fatalf("Configuration value from key %s is not a valid URL: %s", key, r)
+		}
+		us[k] = u
+	}
+	return us
+}
+
+func (p *ViperProvider) CourierSMTPHealth() *CourierSMTPHealthConfig {
+	return &CourierSMTPHealthConfig{
+		UnhealthyAfter: viperx.GetInt(p.l, ViperKeyCourierSMTPUnhealthyAfter, 3),
+		UnhealthyFor:   viperx.GetDuration(p.l, ViperKeyCourierSMTPUnhealthyFor, time.Minute),
+	}
+}
+
+func (p *ViperProvider) CourierDKIM() *DKIMConfig {
+	c := &DKIMConfig{Domain: viperx.GetString(p.l, ViperKeyCourierDKIMDomain, "")}
+	p.decodeList(ViperKeyCourierDKIMKeys, &c.Keys)
+	return c
+}
+
+func (p *ViperProvider) CourierCategory(category string) *CourierCategoryConfig {
+	var configured map[string]CourierCategoryConfig
+	p.decodeList(ViperKeyCourierCategories, &configured)
+
+	c := configured[category]
+	if len(c.FromAddress) == 0 {
+		c.FromAddress = p.CourierSMTPFrom()
+	}
+	return &c
+}
+
+func (p *ViperProvider) CourierSMTPHealthCheck() bool {
+	return viper.GetBool(ViperKeyCourierSMTPHealthCheck)
+}
+
+func (p *ViperProvider) CourierCapture() bool {
+	return viper.GetBool(ViperKeyCourierCapture)
+}
+
 func (p *ViperProvider) CourierTemplatesRoot() string {
 	return viperx.GetString(p.l, ViperKeyCourierTemplatesPath, "")
 }
 
+func (p *ViperProvider) CourierSMS() *CourierSMSConfig {
+	var c CourierSMSConfig
+	p.decodeList(ViperKeyCourierSMS, &c)
+	return &c
+}
+
+func (p *ViperProvider) I18nDefaultLocale() string {
+	return viperx.GetString(p.l, ViperKeyI18nDefaultLocale, "en")
+}
+
+func (p *ViperProvider) I18nCatalogsPath() string {
+	return viperx.GetString(p.l, ViperKeyI18nCatalogsPath, "")
+}
+
 func mustParseURLFromViper(l logrus.FieldLogger, key string) *url.URL {
 	u, err := url.ParseRequestURI(viper.GetString(key))
 	if err != nil {
@@ -353,7 +993,7 @@ func (p *ViperProvider) IsInsecureDevMode() bool {
 }
 
 func (p *ViperProvider) VerificationURL() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeyURLsVerification)
+	return p.uiURL(ViperKeyURLsVerification, BundledUIVerificationPath)
 }
 
 // SelfServiceVerificationRequestLifespan defines the lifespan of a verification request (the ui interaction). This
@@ -362,20 +1002,203 @@ func (p *ViperProvider) SelfServiceVerificationRequestLifespan() time.Duration {
 	return viperx.GetDuration(p.l, ViperKeySelfServiceLifespanVerificationRequest, time.Hour)
 }
 
+func (p *ViperProvider) RecoveryURL() *url.URL {
+	return p.uiURL(ViperKeyURLsRecovery, BundledUIRecoveryPath)
+}
+
+func (p *ViperProvider) SelfServiceRecovery() *RecoveryConfig {
+	return &RecoveryConfig{
+		RequestLifespan:      viperx.GetDuration(p.l, ViperKeySelfServiceLifespanRecoveryRequest, time.Hour),
+		LinkEnabled:          viper.GetBool(ViperKeySelfServiceRecoveryLinkEnabled),
+		LinkLifespan:         viperx.GetDuration(p.l, ViperKeySelfServiceRecoveryLinkLifespan, time.Hour),
+		SMSEnabled:           viper.GetBool(ViperKeySelfServiceRecoverySMSEnabled),
+		SMSCodeLength:        viperx.GetInt(p.l, ViperKeySelfServiceRecoverySMSCodeLength, 6),
+		SMSCodeLifespan:      viperx.GetDuration(p.l, ViperKeySelfServiceRecoverySMSLifespan, time.Minute*15),
+		SMSMaxAttempts:       viperx.GetInt(p.l, ViperKeySelfServiceRecoverySMSMaxAttempts, 5),
+		ManualEnabled:        viper.GetBool(ViperKeySelfServiceRecoveryManualEnabled),
+		ManualLinkLifespan:   viperx.GetDuration(p.l, ViperKeySelfServiceRecoveryManualLifespan, time.Hour*24),
+		MaxSendsPerHour:      viperx.GetInt(p.l, ViperKeySelfServiceRecoveryMaxSendsPerHour, 3),
+		MaxSendsPerIPPerHour: viperx.GetInt(p.l, ViperKeySelfServiceRecoveryMaxSendsPerIPPerHour, 10),
+		RevertLifespan:       viperx.GetDuration(p.l, ViperKeySelfServiceRecoveryRevertLifespan, time.Hour*24*7),
+	}
+}
+
+func (p *ViperProvider) SelfServiceDeviceAuthorization() *DeviceAuthorizationConfig {
+	return &DeviceAuthorizationConfig{
+		Enabled:      viper.GetBool(ViperKeySelfServiceDeviceEnabled),
+		Lifespan:     viperx.GetDuration(p.l, ViperKeySelfServiceLifespanDeviceAuthorization, time.Minute*10),
+		PollInterval: viperx.GetDuration(p.l, ViperKeySelfServiceDevicePollInterval, time.Second*5),
+		RateLimit:    viperx.GetInt(p.l, ViperKeySelfServiceDeviceRateLimit, 60),
+	}
+}
+
 func (p *ViperProvider) SelfServiceVerificationLinkLifespan() time.Duration {
 	return viperx.GetDuration(p.l, ViperKeySelfServiceLifespanLink, time.Hour*24)
 }
 
 func (p *ViperProvider) SelfServiceVerificationReturnTo() *url.URL {
-	return mustParseURLFromViper(p.l, ViperKeySelfServiceVerifyReturnTo)
+	return p.uiURL(ViperKeySelfServiceVerifyReturnTo, BundledUIProfilePath)
+}
+
+// SelfServiceVerificationLinkURL returns the template of the links in verification emails. It is empty unless the
+// links point somewhere else than the confirm endpoint, for example to a custom UI or a mobile app.
+func (p *ViperProvider) SelfServiceVerificationLinkURL() string {
+	return viper.GetString(ViperKeySelfServiceVerifyLinkURL)
 }
 
 func (p *ViperProvider) SelfServicePrivilegedSessionMaxAge() time.Duration {
 	return viperx.GetDuration(p.l, ViperKeySelfServicePrivilegedAuthenticationAfter, time.Hour)
 }
 
+// defaultPrivilegedMethods lists whether the profile management methods require re-authentication unless they are
+// configured otherwise. Changing write-protected traits or push devices changes how the identity signs in.
+var defaultPrivilegedMethods = map[string]bool{
+	"profile":  true,
+	"sessions": false,
+	"push":     true,
+}
+
+func (p *ViperProvider) SelfServiceProfilePrivilegedMethods() map[string]PrivilegedMethodConfig {
+	maxAge := p.SelfServicePrivilegedSessionMaxAge()
+
+	methods := map[string]PrivilegedMethodConfig{}
+	for method, required := range defaultPrivilegedMethods {
+		methods[method] = PrivilegedMethodConfig{Required: required, MaxAge: maxAge}
+	}
+
+	var configured map[string]struct {
+		Required     *bool  `json:"required"`
+		MaxAge       string `json:"max_age"`
+		SecondFactor bool   `json:"second_factor"`
+	}
+	p.decodeList(ViperKeySelfServiceProfilePrivilegedMethods, &configured)
+	for method, c := range configured {
+		m := PrivilegedMethodConfig{Required: true, MaxAge: maxAge, SecondFactor: c.SecondFactor}
+		if c.Required != nil {
+			m.Required = *c.Required
+		}
+		if d, err := time.ParseDuration(c.MaxAge); err == nil {
+			m.MaxAge = d
+		}
+		methods[method] = m
+	}
+	return methods
+}
+
+func (p *ViperProvider) SelfServicePasswordMaxAge() time.Duration {
+	return viperx.GetDuration(p.l, ViperKeySelfServicePasswordMaxAge, 0)
+}
+
+func (p *ViperProvider) SelfServiceEmailCode() *EmailCodeConfig {
+	return &EmailCodeConfig{
+		FallbackOnly:        viper.GetBool(ViperKeySelfServiceEmailCodeFallbackOnly),
+		Length:              viperx.GetInt(p.l, ViperKeySelfServiceEmailCodeLength, 6),
+		Lifespan:            viperx.GetDuration(p.l, ViperKeySelfServiceEmailCodeLifespan, time.Minute*10),
+		MaxAttempts:         viperx.GetInt(p.l, ViperKeySelfServiceEmailCodeMaxAttempts, 5),
+		MaxSendsPerIdentity: viperx.GetInt(p.l, ViperKeySelfServiceEmailCodeMaxSendsPerIdentity, 5),
+		MaxSendsPerHour:     viperx.GetInt(p.l, ViperKeySelfServiceEmailCodeMaxSendsPerHour, 0),
+	}
+}
+
+func (p *ViperProvider) SelfServiceNotificationNewLoginEnabled() bool {
+	return viper.GetBool(ViperKeySelfServiceNotificationNewLogin)
+}
+
+func (p *ViperProvider) SelfServiceNotificationPasswordChangedEnabled() bool {
+	return viper.GetBool(ViperKeySelfServiceNotificationPasswordChanged)
+}
+
+func (p *ViperProvider) SelfServiceNotificationCodeReplayedEnabled() bool {
+	return viperx.GetBool(p.l, ViperKeySelfServiceNotificationCodeReplayed, true)
+}
+
+func (p *ViperProvider) SelfServiceNotificationSecondFactorChangedEnabled() bool {
+	return viperx.GetBool(p.l, ViperKeySelfServiceNotificationSecondFactor, true)
+}
+
 func (p *ViperProvider) SessionSameSiteMode() http.SameSite {
-	switch viperx.GetString(p.l, ViperKeySessionSameSite, "Lax") {
+	return p.sameSiteMode(ViperKeySessionSameSite)
+}
+
+func (p *ViperProvider) SessionCookieName() string {
+	return viperx.GetString(p.l, ViperKeySessionCookieName, "")
+}
+
+func (p *ViperProvider) SessionCookieDomain() string {
+	return viperx.GetString(p.l, ViperKeySessionCookieDomain, "")
+}
+
+func (p *ViperProvider) SessionCookiePath() string {
+	return viperx.GetString(p.l, ViperKeySessionCookiePath, "")
+}
+
+func (p *ViperProvider) SessionCookieSecure() bool {
+	return p.cookieSecure(ViperKeySessionCookieSecure)
+}
+
+func (p *ViperProvider) CSRFCookieSecure() bool {
+	return p.cookieSecure(ViperKeyCSRFCookieSecure)
+}
+
+func (p *ViperProvider) cookieSecure(key string) bool {
+	if viper.IsSet(key) {
+		return viper.GetBool(key)
+	}
+	return !p.IsInsecureDevMode()
+}
+
+func (p *ViperProvider) CSRFCookieSameSiteMode() http.SameSite {
+	return p.sameSiteMode(ViperKeyCSRFCookieSameSite)
+}
+
+func (p *ViperProvider) CSRFCookieDomain() string {
+	return viperx.GetString(p.l, ViperKeyCSRFCookieDomain, p.SelfPublicURL().Hostname())
+}
+
+func (p *ViperProvider) CSRFCookiePath() string {
+	return viperx.GetString(p.l, ViperKeyCSRFCookiePath, stringsx.Coalesce(p.SelfPublicURL().Path, "/"))
+}
+
+func (p *ViperProvider) CSRFMode() string {
+	return viperx.GetString(p.l, ViperKeyCSRFMode, CSRFModeCookie)
+}
+
+// CSRFAllowedOrigins returns the origins, such as `https://app.example.org`, which may send requests in the
+// "origin" CSRF mode. It defaults to the origin of urls.self.public.
+func (p *ViperProvider) CSRFAllowedOrigins() []string {
+	public := p.SelfPublicURL()
+	return viperx.GetStringSlice(p.l, ViperKeyCSRFAllowedOrigins, []string{public.Scheme + "://" + public.Host})
+}
+
+// SecurityHeaders returns the headers which are set on responses of the public API. Each header can be
+// overridden and is disabled if it is set to an empty string.
+func (p *ViperProvider) SecurityHeaders() map[string]string {
+	header := func(key, fallback string) string {
+		if viper.IsSet(key) {
+			return viper.GetString(key)
+		}
+		return fallback
+	}
+
+	return map[string]string{
+		"Content-Security-Policy":   header(ViperKeySecurityHeaderContentSecurityPolicy, DefaultContentSecurityPolicy),
+		"Strict-Transport-Security": header(ViperKeySecurityHeaderStrictTransportSecurity, "max-age=31536000"),
+		"X-Frame-Options":           header(ViperKeySecurityHeaderFrameOptions, "DENY"),
+		"Referrer-Policy":           header(ViperKeySecurityHeaderReferrerPolicy, "same-origin"),
+		"X-Content-Type-Options":    header(ViperKeySecurityHeaderContentTypeOptions, "nosniff"),
+	}
+}
+
+func (p *ViperProvider) RequestLimits() *RequestLimitsConfig {
+	return &RequestLimitsConfig{
+		MaxBodySize:   int64(viperx.GetInt(p.l, ViperKeyRequestLimitsMaxBodySize, 1024*1024)),
+		MaxJSONDepth:  viperx.GetInt(p.l, ViperKeyRequestLimitsMaxJSONDepth, 32),
+		MaxFormFields: viperx.GetInt(p.l, ViperKeyRequestLimitsMaxFormFields, 256),
+	}
+}
+
+func (p *ViperProvider) sameSiteMode(key string) http.SameSite {
+	switch viperx.GetString(p.l, key, "Lax") {
 	case "Lax":
 		return http.SameSiteLaxMode
 	case "Strict":
@@ -0,0 +1,746 @@
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/jsonschema/v3"
+	_ "github.com/ory/jsonschema/v3/fileloader"
+	_ "github.com/ory/jsonschema/v3/httploader"
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/egress"
+	"github.com/ory/kratos/fetcher"
+	"github.com/ory/kratos/x"
+)
+
+// Severity describes whether a configuration problem prevents ORY Kratos from starting.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is a problem with the configuration value at Path, for example `selfservice.strategies.oidc`.
+// Fix explains how to resolve the problem if that is not obvious from the message.
+type Problem struct {
+	Severity Severity
+	Path     string
+	Message  string
+	Fix      string
+}
+
+// Problems is a list of configuration problems.
+type Problems []Problem
+
+// HasErrors returns true if at least one problem is an error.
+func (ps Problems) HasErrors() bool {
+	for _, p := range ps {
+		if p.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of errors and warnings.
+func (ps Problems) Count() (errs, warnings int) {
+	for _, p := range ps {
+		if p.Severity == SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	return errs, warnings
+}
+
+// Validate checks the configuration loaded into viper against the JSON schema of the configuration and checks
+// the constraints which the JSON schema can not express, for example whether the identity schemas can be loaded.
+func Validate(configSchema []byte) (Problems, error) {
+	ps, err := validateSchema(configSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range []func() Problems{
+		validateLifespans,
+		validateFetch,
+		validateEgress,
+		validateSecrets,
+		validateOIDCProviders,
+		validateCrossDeviceLogin,
+		validateDeviceAuthorization,
+		validatePushApproval,
+		validateEmailCode,
+		validateTrustedDevices,
+		validateIdentitySchemas,
+		validateRegistrationModes,
+		validateEmailDomains,
+		validateLogRedaction,
+		validateErrorReporting,
+		validateBackChannelLogoutClients,
+		validateDKIM,
+		validateEntitlements,
+		validatePairwise,
+	} {
+		ps = append(ps, check()...)
+	}
+
+	sort.SliceStable(ps, func(i, j int) bool {
+		return ps[i].Severity == SeverityError && ps[j].Severity != SeverityError
+	})
+	return ps, nil
+}
+
+func validateSchema(configSchema []byte) (Problems, error) {
+	const ref = "config.schema.json"
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(ref, bytes.NewReader(configSchema)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s, err := c.Compile(ref)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(viper.AllSettings()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := s.Validate(&b); err != nil {
+		e, ok := errors.Cause(err).(*jsonschema.ValidationError)
+		if !ok {
+			return nil, err
+		}
+
+		var ps Problems
+		schemaProblems(e, &ps)
+		return ps, nil
+	}
+
+	return nil, nil
+}
+
+// schemaProblems adds the leaves of the validation error tree, which are the actual violations, to ps.
+func schemaProblems(e *jsonschema.ValidationError, ps *Problems) {
+	if len(e.Causes) > 0 {
+		for _, cause := range e.Causes {
+			schemaProblems(cause, ps)
+		}
+		return
+	}
+
+	p := Problem{Severity: SeverityError, Path: pointerToPath(e.InstancePtr), Message: e.Message}
+	if ctx, ok := e.Context.(*jsonschema.ValidationErrorContextRequired); ok && len(ctx.Missing) > 0 {
+		missing := make([]string, len(ctx.Missing))
+		for k, m := range ctx.Missing {
+			missing[k] = pointerToPath(m)
+		}
+		p.Fix = fmt.Sprintf("Set %s.", strings.Join(missing, ", "))
+	}
+
+	for _, existing := range *ps {
+		if existing == p {
+			return
+		}
+	}
+	*ps = append(*ps, p)
+}
+
+// pointerToPath turns a JSON pointer such as `#/selfservice/strategies/oidc` into `selfservice.strategies.oidc`.
+func pointerToPath(pointer string) string {
+	path := strings.Trim(strings.TrimPrefix(pointer, "#"), "/")
+	if len(path) == 0 {
+		return "(root)"
+	}
+	return strings.ReplaceAll(path, "/", ".")
+}
+
+func validateLifespans() (ps Problems) {
+	keys := []string{
+		ViperKeyLifespanSession,
+		ViperKeySelfServiceLifespanLoginRequest,
+		ViperKeySelfServiceLifespanRegistrationRequest,
+		ViperKeySelfServiceLifespanProfileRequest,
+		ViperKeySelfServiceLifespanLink,
+		ViperKeySelfServiceLifespanVerificationRequest,
+		ViperKeySelfServiceLifespanInvitation,
+	}
+
+	strategies := viper.GetStringMap(ViperKeySelfServiceStrategyConfig)
+	for _, key := range []string{ViperKeySelfServiceLifespanLoginMethods, ViperKeySelfServiceLifespanRegistrationMethods} {
+		var methods []string
+		for method := range viper.GetStringMapString(key) {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			if _, ok := strategies[method]; !ok {
+				ps = append(ps, Problem{
+					Severity: SeverityWarning,
+					Path:     key + "." + method,
+					Message:  fmt.Sprintf("%s is not a self-service method, so this lifespan is never used.", method),
+					Fix:      fmt.Sprintf("Use one of the methods configured in %s, for example password or oidc.", ViperKeySelfServiceStrategyConfig),
+				})
+			}
+			keys = append(keys, key+"."+method)
+		}
+	}
+
+	for _, key := range keys {
+		if !viper.IsSet(key) {
+			continue
+		}
+
+		d, err := time.ParseDuration(viper.GetString(key))
+		if err != nil {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     key,
+				Message:  fmt.Sprintf("%v is not a valid duration.", viper.Get(key)),
+				Fix:      `Use a duration such as "30m" or "24h".`,
+			})
+		} else if d <= 0 {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     key,
+				Message:  "The lifespan must be greater than zero, otherwise everything expires as soon as it is created.",
+				Fix:      `Set a duration such as "1h" or remove the key to use the default.`,
+			})
+		}
+	}
+	return ps
+}
+
+func validateFetch() (ps Problems) {
+	for k, rule := range fetchConfig().Headers {
+		if u, err := url.Parse(rule.URLPrefix); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			ps = append(ps, Problem{
+				Severity: SeverityWarning,
+				Path:     fmt.Sprintf("%s.%d.url_prefix", ViperKeyFetchHTTPHeaders, k),
+				Message:  fmt.Sprintf("%q is not an http:// or https:// URL, so the headers are never sent.", rule.URLPrefix),
+				Fix:      "Use a prefix such as https://config.example.org/.",
+			})
+		}
+	}
+	return ps
+}
+
+func validateEgress() (ps Problems) {
+	for _, key := range []string{ViperKeyEgressProxyHTTP, ViperKeyEgressProxyHTTPS} {
+		raw := viper.GetString(key)
+		if len(raw) == 0 {
+			continue
+		}
+
+		if u, err := url.Parse(raw); err != nil || len(u.Host) == 0 || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     key,
+				Message:  fmt.Sprintf("%q is not a valid proxy URL.", raw),
+				Fix:      "Use an http://, https://, or socks5:// URL such as http://proxy.internal:3128.",
+			})
+		}
+	}
+
+	for _, key := range []string{ViperKeyEgressProxyBypass, ViperKeyEgressAllowedHosts, ViperKeyEgressAllowedPrivateHosts} {
+		for k, pattern := range viper.GetStringSlice(key) {
+			if err := egress.ValidatePattern(pattern); err != nil {
+				ps = append(ps, Problem{
+					Severity: SeverityError,
+					Path:     fmt.Sprintf("%s.%d", key, k),
+					Message:  fmt.Sprintf("%q is not a valid host pattern: %s", pattern, err),
+					Fix:      "Use a host name (login.example.org), subdomains (*.example.org), an IP address or CIDR network (10.0.0.0/8), or * for all hosts.",
+				})
+			}
+		}
+	}
+	return ps
+}
+
+func validateSecrets() (ps Problems) {
+	if len(viper.GetStringSlice(ViperKeySecretsSession)) == 0 {
+		ps = append(ps, Problem{
+			Severity: SeverityWarning,
+			Path:     ViperKeySecretsSession,
+			Message:  "No session secret is set. A random secret is generated at startup, which signs out all users whenever ORY Kratos restarts and breaks running more than one instance.",
+			Fix:      "Set secrets.session to a list containing a random string of at least 16 characters.",
+		})
+	}
+	return ps
+}
+
+func validateOIDCProviders() (ps Problems) {
+	key := ViperKeySelfServiceStrategyConfig + ".oidc"
+	if !viper.GetBool(key + ".enabled") {
+		return nil
+	}
+
+	var providers []map[string]interface{}
+	raw, err := json.Marshal(viper.Get(key + ".config.providers"))
+	if err == nil {
+		err = json.Unmarshal(raw, &providers)
+	}
+	if err != nil || len(providers) == 0 {
+		return Problems{{
+			Severity: SeverityWarning,
+			Path:     key + ".config.providers",
+			Message:  "The oidc strategy is enabled but no providers are configured.",
+			Fix:      "Add a provider or set " + key + ".enabled to false.",
+		}}
+	}
+
+	domains := map[string]string{}
+	for k, p := range providers {
+		path := fmt.Sprintf("%s.config.providers.%d", key, k)
+		required, fix := []string{"client_id", "client_secret"}, "Copy the %s from the OAuth2 client you registered with the provider."
+		if str(p["provider"]) == "apple" {
+			// Apple's client secret is generated from the private key.
+			required, fix = []string{"client_id", "apple_team_id", "apple_private_key_id", "apple_private_key"}, "Copy the %s from your Apple Developer account."
+		}
+
+		for _, r := range required {
+			if len(str(p[r])) == 0 {
+				ps = append(ps, Problem{
+					Severity: SeverityError,
+					Path:     path + "." + r,
+					Message:  fmt.Sprintf("Provider %q has no %s.", str(p["id"]), r),
+					Fix:      fmt.Sprintf(fix, r),
+				})
+			}
+		}
+
+		if str(p["provider"]) == "generic" && len(str(p["issuer_url"])) == 0 {
+			// Without an issuer URL the provider is used as a plain OAuth2 provider.
+			for _, r := range []string{"auth_url", "token_url", "userinfo_url"} {
+				if len(str(p[r])) == 0 {
+					ps = append(ps, Problem{
+						Severity: SeverityError,
+						Path:     path + "." + r,
+						Message:  fmt.Sprintf("Provider %q is a generic provider without issuer_url but has no %s.", str(p["id"]), r),
+						Fix:      fmt.Sprintf("Set issuer_url to the URL which serves /.well-known/openid-configuration or, if the provider does not support OpenID Connect, set %s.", r),
+					})
+				}
+			}
+		}
+
+		if u := str(p["issuer_url"]); len(u) > 0 {
+			ps = append(ps, checkOutboundURL(path+".issuer_url", u)...)
+		}
+
+		if u := str(p["mapper_url"]); len(u) > 0 && !fetcher.IsSupported(u) {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     path + ".mapper_url",
+				Message:  fmt.Sprintf("%q is not a valid URL.", u),
+				Fix:      "Use a file://, base64://, http://, https://, s3://, or gs:// URL.",
+			})
+		} else if len(u) > 0 {
+			ps = append(ps, checkOutboundURL(path+".mapper_url", u)...)
+		}
+
+		if u := str(p["schema_url"]); len(u) > 0 {
+			ps = append(ps, checkSchemaURL(path+".schema_url", u)...)
+		}
+
+		ds, _ := p["domains"].([]interface{})
+		for _, d := range ds {
+			domain := strings.ToLower(str(d))
+			if other, ok := domains[domain]; ok && other != str(p["id"]) {
+				ps = append(ps, Problem{
+					Severity: SeverityError,
+					Path:     path + ".domains",
+					Message:  fmt.Sprintf("Domain %q is configured for providers %q and %q.", domain, other, str(p["id"])),
+					Fix:      "Configure each domain for one provider only, otherwise it is not clear which provider users of the domain sign in with.",
+				})
+				continue
+			}
+			domains[domain] = str(p["id"])
+		}
+	}
+	return ps
+}
+
+func validateCrossDeviceLogin() (ps Problems) {
+	key := ViperKeySelfServiceStrategyConfig + ".cross_device"
+	if viper.GetBool(key+".enabled") && len(viper.GetString(key+".config.approval_ui")) == 0 {
+		ps = append(ps, Problem{
+			Severity: SeverityError,
+			Path:     key + ".config.approval_ui",
+			Message:  "The cross_device strategy is enabled but no approval UI is configured.",
+			Fix:      "Set the URL of the page which lets users approve logins or set " + key + ".enabled to false.",
+		})
+	}
+	return ps
+}
+
+func validateDeviceAuthorization() (ps Problems) {
+	if viper.GetBool(ViperKeySelfServiceDeviceEnabled) && len(viper.GetString(ViperKeyURLsDeviceVerification)) == 0 {
+		ps = append(ps, Problem{
+			Severity: SeverityError,
+			Path:     ViperKeyURLsDeviceVerification,
+			Message:  "The device authorization flow is enabled but no device verification UI is configured.",
+			Fix:      "Set the URL of the page where users enter the code shown by devices or set " + ViperKeySelfServiceDeviceEnabled + " to false.",
+		})
+	}
+	return ps
+}
+
+func validatePushApproval() (ps Problems) {
+	key := ViperKeySelfServiceStrategyConfig + ".push"
+	if !viper.GetBool(key + ".enabled") {
+		return ps
+	}
+
+	if len(viper.GetStringMap(key+".config.webhook")) == 0 &&
+		len(viper.GetStringMap(key+".config.fcm")) == 0 &&
+		len(viper.GetStringMap(key+".config.apns")) == 0 {
+		ps = append(ps, Problem{
+			Severity: SeverityError,
+			Path:     key + ".config",
+			Message:  "The push strategy is enabled but no push provider is configured.",
+			Fix:      "Configure the webhook, fcm, or apns provider or set " + key + ".enabled to false.",
+		})
+	}
+
+	if path := viper.GetString(key + ".config.apns.key_path"); len(path) > 0 {
+		raw, err := ioutil.ReadFile(path)
+		if err == nil {
+			if block, _ := pem.Decode(raw); block == nil {
+				err = errors.New("the file is not PEM encoded")
+			}
+		}
+		if err != nil {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     key + ".config.apns.key_path",
+				Message:  fmt.Sprintf("Unable to load the APNs signing key: %s", err),
+				Fix:      "Make sure the file exists, is readable by ORY Kratos, and is the .p8 file downloaded from the Apple developer account.",
+			})
+		}
+	}
+	return ps
+}
+
+func validateEmailCode() (ps Problems) {
+	key := ViperKeySelfServiceStrategyConfig + ".email_code"
+	if !viper.GetBool(key+".enabled") || !viper.GetBool(ViperKeySelfServiceEmailCodeFallbackOnly) {
+		return ps
+	}
+
+	// Push approval is the only other second factor.
+	if !viper.GetBool(ViperKeySelfServiceStrategyConfig + ".push.enabled") {
+		ps = append(ps, Problem{
+			Severity: SeverityWarning,
+			Path:     ViperKeySelfServiceEmailCodeFallbackOnly,
+			Message:  "The email_code strategy is only offered as a fallback but no other second factor is enabled, so codes are never sent.",
+			Fix:      "Enable another second factor, for example push, or set " + ViperKeySelfServiceEmailCodeFallbackOnly + " to false.",
+		})
+	}
+	return ps
+}
+
+func validateTrustedDevices() (ps Problems) {
+	// The trusted device cookie is signed like all other cookies, and signed cookies are rejected after 30 days.
+	if max := time.Hour * 24 * 30; viper.GetBool(ViperKeySelfServiceLoginTrustedDevicesEnabled) &&
+		viper.GetDuration(ViperKeySelfServiceLoginTrustedDevicesLifespan) > max {
+		ps = append(ps, Problem{
+			Severity: SeverityWarning,
+			Path:     ViperKeySelfServiceLoginTrustedDevicesLifespan,
+			Message:  "Devices are trusted for at most 720h because the trusted device cookie expires after that.",
+			Fix:      "Set " + ViperKeySelfServiceLoginTrustedDevicesLifespan + " to 720h or less.",
+		})
+	}
+	return ps
+}
+
+func validateIdentitySchemas() (ps Problems) {
+	if u := viper.GetString(ViperKeyDefaultIdentityTraitsSchemaURL); len(u) > 0 {
+		ps = append(ps, checkSchemaURL(ViperKeyDefaultIdentityTraitsSchemaURL, u)...)
+	}
+
+	if u := viper.GetString(ViperKeyIdentityTraitsDerivedMapperURL); len(u) > 0 && !fetcher.IsSupported(u) {
+		ps = append(ps, Problem{
+			Severity: SeverityError,
+			Path:     ViperKeyIdentityTraitsDerivedMapperURL,
+			Message:  fmt.Sprintf("%q is not a valid URL.", u),
+			Fix:      "Use a file://, base64://, http://, https://, s3://, or gs:// URL.",
+		})
+	}
+
+	var schemas SchemaConfigs
+	raw, err := json.Marshal(viper.Get(ViperKeyIdentityTraitsSchemas))
+	if err == nil {
+		err = json.Unmarshal(raw, &schemas)
+	}
+	if err != nil {
+		// The JSON schema validation reports malformed schema lists.
+		return ps
+	}
+
+	for k, s := range schemas {
+		if len(s.URL) > 0 {
+			ps = append(ps, checkSchemaURL(fmt.Sprintf("%s.%d.url", ViperKeyIdentityTraitsSchemas, k), s.URL)...)
+		}
+	}
+	return ps
+}
+
+func validateRegistrationModes() (ps Problems) {
+	ids := map[string]bool{DefaultIdentityTraitsSchemaID: true}
+	var schemas SchemaConfigs
+	if raw, err := json.Marshal(viper.Get(ViperKeyIdentityTraitsSchemas)); err == nil && json.Unmarshal(raw, &schemas) == nil {
+		for _, s := range schemas {
+			ids[s.ID] = true
+		}
+	}
+
+	var unknown []string
+	for id := range viper.GetStringMapString(ViperKeySelfServiceRegistrationSchemaModes) {
+		if !ids[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	sort.Strings(unknown)
+
+	for _, id := range unknown {
+		ps = append(ps, Problem{
+			Severity: SeverityWarning,
+			Path:     ViperKeySelfServiceRegistrationSchemaModes + "." + id,
+			Message:  fmt.Sprintf("%s is not the ID of an identity traits schema, so this registration mode is never used.", id),
+			Fix:      fmt.Sprintf("Use %q or one of the IDs configured in %s.", DefaultIdentityTraitsSchemaID, ViperKeyIdentityTraitsSchemas),
+		})
+	}
+	return ps
+}
+
+func validateEmailDomains() (ps Problems) {
+	if u := viper.GetString(ViperKeySelfServiceEmailDomainsDisposableListURL); len(u) > 0 && !fetcher.IsSupported(u) {
+		ps = append(ps, Problem{
+			Severity: SeverityError,
+			Path:     ViperKeySelfServiceEmailDomainsDisposableListURL,
+			Message:  fmt.Sprintf("%q is not a valid URL.", u),
+			Fix:      "Use a file://, base64://, http://, https://, s3://, or gs:// URL.",
+		})
+	}
+
+	denied := map[string]bool{}
+	for _, d := range viper.GetStringSlice(ViperKeySelfServiceEmailDomainsDeny) {
+		denied[strings.ToLower(d)] = true
+	}
+
+	for k, d := range viper.GetStringSlice(ViperKeySelfServiceEmailDomainsAllow) {
+		if denied[strings.ToLower(d)] {
+			ps = append(ps, Problem{
+				Severity: SeverityWarning,
+				Path:     fmt.Sprintf("%s.%d", ViperKeySelfServiceEmailDomainsAllow, k),
+				Message:  fmt.Sprintf("Domain %q is allowed and denied, so it is denied.", d),
+				Fix:      fmt.Sprintf("Remove the domain from %s or %s.", ViperKeySelfServiceEmailDomainsAllow, ViperKeySelfServiceEmailDomainsDeny),
+			})
+		}
+	}
+	return ps
+}
+
+func validateLogRedaction() (ps Problems) {
+	for k, p := range viper.GetStringSlice(ViperKeyLogRedactionPatterns) {
+		if _, err := regexp.Compile(p); err != nil {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     fmt.Sprintf("%s.%d", ViperKeyLogRedactionPatterns, k),
+				Message:  fmt.Sprintf("%q is not a valid regular expression: %s", p, err),
+				Fix:      "Use the RE2 syntax described at https://golang.org/s/re2syntax.",
+			})
+		}
+	}
+	return ps
+}
+
+func validateErrorReporting() (ps Problems) {
+	dsn := viper.GetString(ViperKeyErrorReportingDSN)
+	if len(dsn) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err == nil && u.User != nil && len(u.User.Username()) > 0 && len(strings.Trim(u.Path, "/")) > 0 {
+		return nil
+	}
+
+	return Problems{{
+		Severity: SeverityError,
+		Path:     ViperKeyErrorReportingDSN,
+		Message:  "The error reporting DSN must contain a public key and a project ID.",
+		Fix:      "Copy the DSN from the project settings of the error reporting service, for example https://public@sentry.example.org/1.",
+	}}
+}
+
+func validateBackChannelLogoutClients() (ps Problems) {
+	var b bytes.Buffer
+	var clients []BackChannelLogoutClient
+	if err := json.NewEncoder(&b).Encode(viper.Get(ViperKeySelfServiceLogoutBackChannelClients)); err != nil {
+		return nil
+	}
+	if err := json.NewDecoder(&b).Decode(&clients); err != nil {
+		// The JSON schema reports malformed clients.
+		return nil
+	}
+
+	for k, c := range clients {
+		path := fmt.Sprintf("%s.%d.tls", ViperKeySelfServiceLogoutBackChannelClients, k)
+		if (len(c.TLS.CertPath) == 0) != (len(c.TLS.KeyPath) == 0) {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     path,
+				Message:  "The client certificate requires both cert_path and key_path.",
+			})
+			continue
+		}
+
+		if _, err := c.TLS.Config(); err != nil {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     path,
+				Message:  fmt.Sprintf("Unable to load the TLS settings: %s", err),
+				Fix:      "Make sure the files exist, are readable by ORY Kratos, and contain PEM encoded certificates and keys.",
+			})
+		}
+	}
+	return ps
+}
+
+func validateDKIM() (ps Problems) {
+	var b bytes.Buffer
+	var keys []DKIMKey
+	if err := json.NewEncoder(&b).Encode(viper.Get(ViperKeyCourierDKIMKeys)); err != nil {
+		return nil
+	}
+	if err := json.NewDecoder(&b).Decode(&keys); err != nil || len(keys) == 0 {
+		// The JSON schema reports malformed keys.
+		return nil
+	}
+
+	for k := range keys {
+		if _, err := keys[k].Signer(); err != nil {
+			ps = append(ps, Problem{
+				Severity: SeverityError,
+				Path:     fmt.Sprintf("%s.%d.private_key", ViperKeyCourierDKIMKeys, k),
+				Message:  fmt.Sprintf("Unable to load the DKIM signing key: %s", err),
+				Fix:      "Set the PEM encoded PKCS #1 or PKCS #8 RSA or Ed25519 private key.",
+			})
+		}
+	}
+
+	if (&DKIMConfig{Keys: keys}).ActiveKey(time.Now()) == nil {
+		ps = append(ps, Problem{
+			Severity: SeverityWarning,
+			Path:     ViperKeyCourierDKIMKeys,
+			Message:  "No DKIM signing key is active yet, emails are not signed until the first key becomes active.",
+		})
+	}
+	return ps
+}
+
+func validateEntitlements() (ps Problems) {
+	if len(viper.GetString(ViperKeyIdentityEntitlementsURL)) > 0 && viper.Get(ViperKeyIdentityEntitlementsStatic) != nil {
+		ps = append(ps, Problem{
+			Severity: SeverityWarning,
+			Path:     ViperKeyIdentityEntitlementsStatic,
+			Message:  "The static entitlements are ignored because an entitlement service is configured.",
+			Fix:      fmt.Sprintf("Remove either %s or %s.", ViperKeyIdentityEntitlementsStatic, ViperKeyIdentityEntitlementsURL),
+		})
+	}
+	return ps
+}
+
+func validatePairwise() (ps Problems) {
+	if len(viper.GetStringSlice(ViperKeyIdentityPairwiseAudiences)) > 0 && len(viper.GetString(ViperKeySecretsPairwise)) == 0 {
+		ps = append(ps, Problem{
+			Severity: SeverityError,
+			Path:     ViperKeySecretsPairwise,
+			Message:  "Pairwise subject identifiers require a secret.",
+			Fix:      "Set a random secret of at least 16 characters and never change it, because that changes all pairwise subject identifiers.",
+		})
+	}
+	return ps
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// checkOutboundURL reports http:// and https:// URLs which ORY Kratos may not call because of the egress settings.
+func checkOutboundURL(path, rawURL string) Problems {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil
+	}
+
+	err = egress.Default.CheckURL(context.Background(), u)
+	switch {
+	case errors.Is(err, egress.ErrHostNotAllowed):
+		return Problems{{
+			Severity: SeverityError,
+			Path:     path,
+			Message:  fmt.Sprintf("%s is not an allowed outbound host.", u.Hostname()),
+			Fix:      fmt.Sprintf("Add %s to %s.", u.Hostname(), ViperKeyEgressAllowedHosts),
+		}}
+	case errors.Is(err, x.ErrPrivateAddress):
+		return Problems{{
+			Severity: SeverityError,
+			Path:     path,
+			Message:  fmt.Sprintf("%s resolves to a private network address, which outbound calls may not connect to.", u.Hostname()),
+			Fix:      fmt.Sprintf("Add %s to %s if the service is trusted.", u.Hostname(), ViperKeyEgressAllowedPrivateHosts),
+		}}
+	}
+	// Hosts which can not be resolved where the configuration is validated are reported when they are called.
+	return nil
+}
+
+// checkSchemaURL makes sure the JSON schema at rawURL can be loaded and compiled.
+func checkSchemaURL(path, rawURL string) Problems {
+	problem := func(message, fix string) Problems {
+		return Problems{{Severity: SeverityError, Path: path, Message: message, Fix: fix}}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || len(u.Scheme) == 0 || !fetcher.IsSupported(rawURL) {
+		return problem(fmt.Sprintf("%q is not a valid URL.", rawURL), "Use a file://, base64://, http://, https://, s3://, or gs:// URL.")
+	}
+
+	if fetcher.IsRemote(rawURL) {
+		if ps := checkOutboundURL(path, rawURL); len(ps) > 0 {
+			return ps
+		}
+		if _, err := fetcher.Default.Fetch(context.Background(), rawURL); err != nil {
+			return problem(fmt.Sprintf("Unable to fetch the JSON schema: %s", err), "Make sure the URL is reachable from ORY Kratos and, if it requires authentication, configure the credentials as described in the fetch key of the configuration.")
+		}
+	}
+
+	if _, err := jsonschema.NewCompiler().Compile(rawURL); err != nil {
+		fix := "Make sure the URL points to a valid JSON schema."
+		if u.Scheme == "file" {
+			fix = "Make sure the file exists, is readable, and contains a valid JSON schema. Relative paths are resolved against the working directory."
+		}
+		return problem(fmt.Sprintf("Unable to load the JSON schema: %s", err), fix)
+	}
+
+	return nil
+}
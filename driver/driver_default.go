@@ -7,6 +7,7 @@ import (
 	"github.com/ory/x/logrusx"
 
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/x"
 )
 
 type DefaultDriver struct {
@@ -21,6 +22,18 @@ func NewDefaultDriver(l logrus.FieldLogger, version, build, date string, dev boo
 
 	c := configuration.NewViperProvider(l, dev)
 
+	if rc := c.LogRedaction(); rc.Enabled {
+		redactor, err := x.NewLogRedactor(rc.Fields, rc.Patterns, rc.Strict)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to configure log redaction")
+		}
+		x.RedactLogs(l, redactor)
+	}
+
+	if c.Chaos().Enabled() {
+		l.Warn("Chaos mode is enabled and injects latency and failures. Never enable it in production.")
+	}
+
 	r, err := NewRegistry(c)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to instantiate service registry")
@@ -9,17 +9,34 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/ory/kratos/cipher"
 	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/flow/recovery"
 	"github.com/ory/kratos/selfservice/flow/verify"
 
 	"github.com/ory/x/healthx"
 
+	"github.com/ory/kratos/admission"
+	"github.com/ory/kratos/batch"
+	"github.com/ory/kratos/cluster"
+	"github.com/ory/kratos/idempotency"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/openapi"
 	"github.com/ory/kratos/persistence"
+	"github.com/ory/kratos/relationship"
+	"github.com/ory/kratos/report"
+	"github.com/ory/kratos/resilience"
+	"github.com/ory/kratos/retention"
+	"github.com/ory/kratos/schedule"
+	"github.com/ory/kratos/selfservice/flow/device"
+	"github.com/ory/kratos/selfservice/flow/inspect"
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/logout"
 	"github.com/ory/kratos/selfservice/flow/profile"
 	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/webhook"
 
 	"github.com/ory/kratos/x"
 
@@ -28,8 +45,16 @@ import (
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/selfservice/strategy/emailcode"
+	"github.com/ory/kratos/selfservice/strategy/oidc"
 	password2 "github.com/ory/kratos/selfservice/strategy/password"
+	"github.com/ory/kratos/selfservice/strategy/push"
+	"github.com/ory/kratos/selfservice/ui"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/stats"
+	"github.com/ory/kratos/token"
+	"github.com/ory/kratos/upload"
 )
 
 type Registry interface {
@@ -49,6 +74,9 @@ type Registry interface {
 	WithCSRFTokenGenerator(cg x.CSRFToken)
 
 	HealthHandler() *healthx.Handler
+	PublicHealthHandler() *healthx.Handler
+	Drain()
+	StopStrategies(ctx context.Context)
 	CookieManager() sessions.Store
 
 	x.CSRFProvider
@@ -56,6 +84,10 @@ type Registry interface {
 	x.LoggingProvider
 
 	courier.Provider
+	courier.HandlerProvider
+	ui.HandlerProvider
+
+	i18n.CatalogProvider
 
 	persistence.Provider
 
@@ -68,19 +100,82 @@ type Registry interface {
 	identity.PoolProvider
 	identity.PrivilegedPoolProvider
 	identity.ManagementProvider
+	identity.WriteGuardProvider
+	identity.TraitsDeriverProvider
+	identity.EntitlementResolverProvider
+	identity.PairwiseSubjectsProvider
+	identity.WebhookHandlerProvider
 
 	schema.HandlerProvider
+	schema.PersistenceProvider
 
 	password2.ValidationProvider
 	password2.HashProvider
 
+	cipher.Provider
+
+	oidc.TokenHandlerProvider
+
 	session.HandlerProvider
 	session.ManagementProvider
 	session.PersistenceProvider
+	session.BackChannelLogoutProvider
+	session.LoginHistoryProvider
+	session.LoginCheckerProvider
+
+	stats.HandlerProvider
+	stats.PersistenceProvider
+
+	retention.EnforcerProvider
+	retention.HandlerProvider
+	retention.PersistenceProvider
+
+	admission.AdmitterProvider
+	admission.HandlerProvider
+	admission.PersistenceProvider
+
+	relationship.HandlerProvider
+	relationship.PersistenceProvider
+
+	token.HandlerProvider
+	token.ManagerProvider
+	token.PersistenceProvider
+
+	upload.BucketProvider
+	upload.HandlerProvider
+
+	schedule.SchedulerProvider
+	schedule.HandlerProvider
+	schedule.PersistenceProvider
+
+	maintenance.GuardProvider
+	maintenance.HandlerProvider
+	maintenance.PersistenceProvider
+
+	webhook.DispatcherProvider
+	webhook.HandlerProvider
+	webhook.PersistenceProvider
+
+	batch.ExecutorProvider
+	batch.HandlerProvider
+	idempotency.PersistenceProvider
+
+	cluster.ElectorProvider
+	cluster.PersistenceProvider
+
+	report.Provider
+
+	resilience.ExecutorProvider
+
+	inspect.HandlerProvider
+	inspect.PersistenceProvider
+
+	openapi.HandlerProvider
 
 	profile.HandlerProvider
 	profile.ErrorHandlerProvider
 	profile.RequestPersistenceProvider
+	profile.PrivilegedCheckerProvider
 
 	login.RequestPersistenceProvider
 	login.ErrorHandlerProvider
@@ -88,6 +183,7 @@ type Registry interface {
 	login.HookExecutorProvider
 	login.HandlerProvider
 	login.StrategyProvider
+	login.SecondFactorProvider
 
 	logout.HandlerProvider
 
@@ -95,6 +191,7 @@ type Registry interface {
 	registration.ErrorHandlerProvider
 	registration.HooksProvider
 	registration.HookExecutorProvider
+	registration.EmailDomainPolicyProvider
 	registration.HandlerProvider
 	registration.StrategyProvider
 
@@ -103,7 +200,20 @@ type Registry interface {
 	verify.SenderProvider
 	verify.HandlerProvider
 
+	recovery.PersistenceProvider
+	recovery.ErrorHandlerProvider
+	recovery.HandlerProvider
+
+	device.HandlerProvider
+	device.PersistenceProvider
+
+	push.PersistenceProvider
+	emailcode.PersistenceProvider
+
+	notification.SenderProvider
+
 	x.CSRFTokenGeneratorProvider
+	x.FlowBinderProvider
 }
 
 type selfServiceStrategy interface {
@@ -4,9 +4,11 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/flow/recovery"
 	"github.com/ory/kratos/selfservice/flow/verify"
 	"github.com/ory/kratos/x"
 
@@ -24,22 +26,46 @@ import (
 
 	"github.com/ory/x/logrusx"
 
+	"github.com/ory/kratos/admission"
+	"github.com/ory/kratos/batch"
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/cluster"
 	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/idempotency"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/openapi"
 	"github.com/ory/kratos/persistence"
 	"github.com/ory/kratos/persistence/sql"
+	"github.com/ory/kratos/relationship"
+	"github.com/ory/kratos/report"
+	"github.com/ory/kratos/resilience"
+	"github.com/ory/kratos/retention"
+	"github.com/ory/kratos/schedule"
+	"github.com/ory/kratos/selfservice/flow/device"
+	"github.com/ory/kratos/selfservice/flow/inspect"
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/logout"
 	"github.com/ory/kratos/selfservice/flow/profile"
 	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/strategy/crossdevice"
+	"github.com/ory/kratos/selfservice/strategy/emailcode"
 	"github.com/ory/kratos/selfservice/strategy/oidc"
+	"github.com/ory/kratos/selfservice/strategy/push"
 
 	"github.com/ory/herodot"
 
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/notification"
 	password2 "github.com/ory/kratos/selfservice/strategy/password"
+	"github.com/ory/kratos/selfservice/ui"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/stats"
+	"github.com/ory/kratos/token"
+	"github.com/ory/kratos/upload"
+	"github.com/ory/kratos/webhook"
 )
 
 var _ Registry = new(RegistryDefault)
@@ -54,27 +80,80 @@ type RegistryDefault struct {
 	l logrus.FieldLogger
 	c configuration.Provider
 
-	nosurf         x.CSRFHandler
-	trc            *tracing.Tracer
-	writer         herodot.Writer
-	healthxHandler *healthx.Handler
+	nosurf               x.CSRFHandler
+	trc                  *tracing.Tracer
+	writer               herodot.Writer
+	healthxHandler       *healthx.Handler
+	healthxPublicHandler *healthx.Handler
+	draining             int32
 
-	courier   *courier.Courier
-	persister persistence.Persister
+	courier        *courier.Courier
+	courierHandler *courier.Handler
+	i18nCatalog    *i18n.Catalog
+	persister      persistence.Persister
 
 	identityHandler   *identity.Handler
 	identityValidator *identity.Validator
 	identityManager   *identity.Manager
+	traitsDeriver     *identity.TraitsDeriver
+	identityWebhook   *identity.WebhookHandler
+	entitlements      *identity.EntitlementResolver
+	pairwiseSubjects  *identity.PairwiseSubjects
 
 	schemaHandler *schema.Handler
 
+	// storedSchemaURLs caches the URLs of the versions of stored identity traits schemas, which never change.
+	storedSchemaURLs sync.Map
+
+	statsHandler *stats.Handler
+
+	retentionEnforcer *retention.Enforcer
+	retentionHandler  *retention.Handler
+
+	admitter         *admission.Admitter
+	admissionHandler *admission.Handler
+
+	relationshipHandler *relationship.Handler
+	tokenHandler        *token.Handler
+	tokenManager        *token.Manager
+
+	uploadBucket  *upload.Bucket
+	uploadHandler *upload.Handler
+
+	scheduler              *schedule.Scheduler
+	scheduledActionHandler *schedule.Handler
+
+	maintenanceGuard   *maintenance.Guard
+	maintenanceHandler *maintenance.Handler
+
+	webhookDispatcher *webhook.Dispatcher
+	webhookHandler    *webhook.Handler
+
+	batchExecutor *batch.Executor
+	batchHandler  *batch.Handler
+
+	clusterElector *cluster.Elector
+
+	errorReporter *report.Reporter
+
+	hookResilience *resilience.Executor
+
+	selfserviceFlowInspectionHandler *inspect.Handler
+
+	openAPIHandler *openapi.Handler
+
 	sessionHandler *session.Handler
 	sessionsStore  *sessions.CookieStore
 	sessionManager session.Manager
 
+	sessionBackChannelLogout *session.BackChannelLogout
+	sessionLoginHistory      *session.LoginHistory
+
 	passwordHasher    password2.Hasher
 	passwordValidator password2.Validator
 
+	crypter cipher.Cipher
+
 	errorHandler *errorx.Handler
 	errorManager *errorx.Manager
 
@@ -82,6 +161,7 @@ type RegistryDefault struct {
 	selfserviceRegistrationHandler             *registration.Handler
 	seflserviceRegistrationErrorHandler        *registration.ErrorHandler
 	selfserviceRegistrationRequestErrorHandler *registration.ErrorHandler
+	selfserviceRegistrationEmailDomainPolicy   *registration.EmailDomainPolicy
 
 	selfserviceLoginExecutor            *login.HookExecutor
 	selfserviceLoginHandler             *login.Handler
@@ -89,21 +169,39 @@ type RegistryDefault struct {
 
 	selfserviceProfileManagementHandler          *profile.Handler
 	selfserviceProfileRequestRequestErrorHandler *profile.ErrorHandler
+	selfserviceProfilePrivilegedChecker          *profile.PrivilegedChecker
 
 	selfserviceVerifyErrorHandler *verify.ErrorHandler
 	selfserviceVerifyManager      *identity.Manager
 	selfserviceVerifyHandler      *verify.Handler
 	selfserviceVerifySender       *verify.Sender
 
+	selfserviceRecoveryErrorHandler *recovery.ErrorHandler
+	selfserviceRecoveryHandler      *recovery.Handler
+
+	selfserviceDeviceHandler *device.Handler
+
 	selfserviceLogoutHandler *logout.Handler
 
-	selfserviceStrategies []selfServiceStrategy
+	selfserviceNotificationSender *notification.Sender
+
+	selfserviceBundledUIHandler *ui.Handler
+
+	selfserviceOIDCTokenHandler *oidc.TokenHandler
+
+	selfserviceStrategies                   []selfServiceStrategy
+	selfserviceCrossDeviceStrategy          *crossdevice.Strategy
+	selfservicePushStrategy                 *push.Strategy
+	selfserviceEmailCodeStrategy            *emailcode.Strategy
+	selfserviceCustomLoginStrategies        []login.Strategy
+	selfserviceCustomRegistrationStrategies []registration.Strategy
 
 	buildVersion string
 	buildHash    string
 	buildDate    string
 
 	csrfTokenGenerator x.CSRFToken
+	flowBinder         *x.FlowBinder
 }
 
 func NewRegistryDefault() *RegistryDefault {
@@ -148,6 +246,13 @@ func (m *RegistryDefault) ProfileRequestRequestErrorHandler() *profile.ErrorHand
 	return m.selfserviceProfileRequestRequestErrorHandler
 }
 
+func (m *RegistryDefault) ProfilePrivilegedChecker() *profile.PrivilegedChecker {
+	if m.selfserviceProfilePrivilegedChecker == nil {
+		m.selfserviceProfilePrivilegedChecker = profile.NewPrivilegedChecker(m, m.c)
+	}
+	return m.selfserviceProfilePrivilegedChecker
+}
+
 func (m *RegistryDefault) LogoutHandler() *logout.Handler {
 	if m.selfserviceLogoutHandler == nil {
 		m.selfserviceLogoutHandler = logout.NewHandler(m, m.c)
@@ -155,16 +260,30 @@ func (m *RegistryDefault) LogoutHandler() *logout.Handler {
 	return m.selfserviceLogoutHandler
 }
 
+func (m *RegistryDefault) NotificationSender() *notification.Sender {
+	if m.selfserviceNotificationSender == nil {
+		m.selfserviceNotificationSender = notification.NewSender(m, m.c)
+	}
+
+	return m.selfserviceNotificationSender
+}
+
 func (m *RegistryDefault) HealthHandler() *healthx.Handler {
 	if m.healthxHandler == nil {
-		m.healthxHandler = healthx.NewHandler(m.Writer(), m.BuildVersion(), healthx.ReadyCheckers{
-			"database": m.Ping,
-		})
+		m.healthxHandler = healthx.NewHandler(m.Writer(), m.BuildVersion(), m.readyCheckers(true))
 	}
 
 	return m.healthxHandler
 }
 
+func (m *RegistryDefault) PublicHealthHandler() *healthx.Handler {
+	if m.healthxPublicHandler == nil {
+		m.healthxPublicHandler = healthx.NewHandler(m.Writer(), m.BuildVersion(), m.readyCheckers(false))
+	}
+
+	return m.healthxPublicHandler
+}
+
 func (m *RegistryDefault) WithCSRFHandler(c x.CSRFHandler) {
 	m.nosurf = c
 }
@@ -187,12 +306,52 @@ func (m *RegistryDefault) selfServiceStrategies() []selfServiceStrategy {
 	return m.selfserviceStrategies
 }
 
+func (m *RegistryDefault) OIDCTokenHandler() *oidc.TokenHandler {
+	if m.selfserviceOIDCTokenHandler == nil {
+		m.selfserviceOIDCTokenHandler = oidc.NewTokenHandler(m, m.c)
+	}
+	return m.selfserviceOIDCTokenHandler
+}
+
 func (m *RegistryDefault) RegistrationStrategies() registration.Strategies {
 	strategies := make([]registration.Strategy, len(m.selfServiceStrategies()))
 	for i := range strategies {
 		strategies[i] = m.selfServiceStrategies()[i]
 	}
-	return strategies
+	return append(strategies, m.customRegistrationStrategies()...)
+}
+
+func (m *RegistryDefault) crossDeviceStrategy() *crossdevice.Strategy {
+	if m.selfserviceCrossDeviceStrategy == nil {
+		m.selfserviceCrossDeviceStrategy = crossdevice.NewStrategy(m, m.c)
+	}
+	return m.selfserviceCrossDeviceStrategy
+}
+
+func (m *RegistryDefault) pushStrategy() *push.Strategy {
+	if m.selfservicePushStrategy == nil {
+		m.selfservicePushStrategy = push.NewStrategy(m, m.c)
+	}
+	return m.selfservicePushStrategy
+}
+
+func (m *RegistryDefault) emailCodeStrategy() *emailcode.Strategy {
+	if m.selfserviceEmailCodeStrategy == nil {
+		m.selfserviceEmailCodeStrategy = emailcode.NewStrategy(m, m.c)
+	}
+	return m.selfserviceEmailCodeStrategy
+}
+
+func (m *RegistryDefault) LoginSecondFactors() login.SecondFactors {
+	return login.SecondFactors{m.pushStrategy(), m.emailCodeStrategy()}
+}
+
+func (m *RegistryDefault) PushChallengePersister() push.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) LoginEmailCodePersister() emailcode.Persister {
+	return m.persister
 }
 
 func (m *RegistryDefault) LoginStrategies() login.Strategies {
@@ -200,7 +359,9 @@ func (m *RegistryDefault) LoginStrategies() login.Strategies {
 	for i := range strategies {
 		strategies[i] = m.selfServiceStrategies()[i]
 	}
-	return strategies
+	// The cross-device strategy is login only, so it is not one of the selfServiceStrategies.
+	strategies = append(strategies, m.crossDeviceStrategy())
+	return append(strategies, m.customLoginStrategies()...)
 }
 
 func (m *RegistryDefault) IdentityValidator() *identity.Validator {
@@ -217,8 +378,8 @@ func (m *RegistryDefault) WithConfig(c configuration.Provider) Registry {
 
 func (m *RegistryDefault) Writer() herodot.Writer {
 	if m.writer == nil {
-		h := herodot.NewJSONWriter(m.Logger())
-		m.writer = h
+		h := x.NewVersionedWriter(herodot.NewJSONWriter(m.Logger()))
+		m.writer = report.NewWriter(h, m.ErrorReporter())
 	}
 	return m.writer
 }
@@ -244,9 +405,13 @@ func (m *RegistryDefault) SchemaHandler() *schema.Handler {
 	return m.schemaHandler
 }
 
+func (m *RegistryDefault) IdentitySchemaPersister() schema.Persister {
+	return m.persister
+}
+
 func (m *RegistryDefault) SessionHandler() *session.Handler {
 	if m.sessionHandler == nil {
-		m.sessionHandler = session.NewHandler(m)
+		m.sessionHandler = session.NewHandler(m, m.c)
 	}
 	return m.sessionHandler
 }
@@ -258,6 +423,13 @@ func (m *RegistryDefault) PasswordHasher() password2.Hasher {
 	return m.passwordHasher
 }
 
+func (m *RegistryDefault) Cipher() cipher.Cipher {
+	if m.crypter == nil {
+		m.crypter = cipher.NewAES(m.c)
+	}
+	return m.crypter
+}
+
 func (m *RegistryDefault) PasswordValidator() password2.Validator {
 	if m.passwordValidator == nil {
 		m.passwordValidator = password2.NewDefaultPasswordValidatorStrategy()
@@ -300,6 +472,25 @@ func (m *RegistryDefault) Tracer() *tracing.Tracer {
 	return m.trc
 }
 
+func (m *RegistryDefault) I18nCatalog() *i18n.Catalog {
+	if m.i18nCatalog == nil {
+		c, err := i18n.NewCatalog(m.c.I18nDefaultLocale())
+		if err != nil {
+			m.Logger().WithError(err).Fatalf("Unable to initialize message catalog.")
+		}
+
+		if path := m.c.I18nCatalogsPath(); len(path) > 0 {
+			if err := c.AddDir(path); err != nil {
+				m.Logger().WithError(err).Fatalf("Unable to load message catalogs from %s.", path)
+			}
+		}
+
+		m.i18nCatalog = c
+	}
+
+	return m.i18nCatalog
+}
+
 func (m *RegistryDefault) SessionManager() session.Manager {
 	if m.sessionManager == nil {
 		m.sessionManager = session.NewManagerHTTP(m.c, m)
@@ -334,36 +525,38 @@ func (m *RegistryDefault) Init() error {
 	bc := backoff.NewExponentialBackOff()
 	bc.MaxElapsedTime = time.Minute * 5
 	bc.Reset()
-	return errors.WithStack(
-		backoff.Retry(func() error {
-			pool, idlePool, connMaxLifetime := sqlcon.ParseConnectionOptions(m.l, m.c.DSN())
-			c, err := pop.NewConnection(&pop.ConnectionDetails{
-				URL:             m.c.DSN(),
-				IdlePool:        idlePool,
-				ConnMaxLifetime: connMaxLifetime,
-				Pool:            pool,
-			})
-			if err != nil {
-				m.Logger().WithError(err).Warnf("Unable to connect to database, retrying.")
-				return errors.WithStack(err)
-			}
-			if err := c.Open(); err != nil {
-				m.Logger().WithError(err).Warnf("Unable to open database, retrying.")
-				return errors.WithStack(err)
-			}
-			p, err := sql.NewPersister(m, m.c, c)
-			if err != nil {
-				m.Logger().WithError(err).Warnf("Unable to initialize persister, retrying.")
-				return err
-			}
-			if err := p.Ping(context.Background()); err != nil {
-				m.Logger().WithError(err).Warnf("Unable to ping database, retrying.")
-				return err
-			}
-			m.persister = p
-			return nil
-		}, bc),
-	)
+	if err := backoff.Retry(func() error {
+		pool, idlePool, connMaxLifetime := sqlcon.ParseConnectionOptions(m.l, m.c.DSN())
+		c, err := pop.NewConnection(&pop.ConnectionDetails{
+			URL:             m.c.DSN(),
+			IdlePool:        idlePool,
+			ConnMaxLifetime: connMaxLifetime,
+			Pool:            pool,
+		})
+		if err != nil {
+			m.Logger().WithError(err).Warnf("Unable to connect to database, retrying.")
+			return errors.WithStack(err)
+		}
+		if err := c.Open(); err != nil {
+			m.Logger().WithError(err).Warnf("Unable to open database, retrying.")
+			return errors.WithStack(err)
+		}
+		p, err := sql.NewPersister(m, m.c, c)
+		if err != nil {
+			m.Logger().WithError(err).Warnf("Unable to initialize persister, retrying.")
+			return err
+		}
+		if err := p.Ping(context.Background()); err != nil {
+			m.Logger().WithError(err).Warnf("Unable to ping database, retrying.")
+			return err
+		}
+		m.persister = p
+		return nil
+	}, bc); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return m.startStrategies(context.Background())
 }
 
 func (m *RegistryDefault) Courier() *courier.Courier {
@@ -373,6 +566,20 @@ func (m *RegistryDefault) Courier() *courier.Courier {
 	return m.courier
 }
 
+func (m *RegistryDefault) CourierHandler() *courier.Handler {
+	if m.courierHandler == nil {
+		m.courierHandler = courier.NewHandler(m, m.c)
+	}
+	return m.courierHandler
+}
+
+func (m *RegistryDefault) BundledUIHandler() *ui.Handler {
+	if m.selfserviceBundledUIHandler == nil {
+		m.selfserviceBundledUIHandler = ui.NewHandler(m, m.c)
+	}
+	return m.selfserviceBundledUIHandler
+}
+
 func (m *RegistryDefault) IdentityPool() identity.Pool {
 	return m.persister
 }
@@ -397,10 +604,248 @@ func (m *RegistryDefault) SelfServiceErrorPersister() errorx.Persister {
 	return m.persister
 }
 
+func (m *RegistryDefault) SessionBackChannelLogout() *session.BackChannelLogout {
+	if m.sessionBackChannelLogout == nil {
+		m.sessionBackChannelLogout = session.NewBackChannelLogout(m, m.c)
+	}
+	return m.sessionBackChannelLogout
+}
+
+func (m *RegistryDefault) LoginHistory() *session.LoginHistory {
+	if m.sessionLoginHistory == nil {
+		m.sessionLoginHistory = session.NewLoginHistory(m, m.c)
+	}
+	return m.sessionLoginHistory
+}
+
 func (m *RegistryDefault) SessionPersister() session.Persister {
 	return m.persister
 }
 
+func (m *RegistryDefault) StatsHandler() *stats.Handler {
+	if m.statsHandler == nil {
+		m.statsHandler = stats.NewHandler(m)
+	}
+	return m.statsHandler
+}
+
+func (m *RegistryDefault) StatsPersister() stats.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) IdentityRetentionEnforcer() *retention.Enforcer {
+	if m.retentionEnforcer == nil {
+		m.retentionEnforcer = retention.NewEnforcer(m, m.c)
+	}
+	return m.retentionEnforcer
+}
+
+func (m *RegistryDefault) RetentionHandler() *retention.Handler {
+	if m.retentionHandler == nil {
+		m.retentionHandler = retention.NewHandler(m)
+	}
+	return m.retentionHandler
+}
+
+func (m *RegistryDefault) RetentionPersister() retention.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) RegistrationAdmitter() *admission.Admitter {
+	if m.admitter == nil {
+		m.admitter = admission.NewAdmitter(m, m.c)
+	}
+	return m.admitter
+}
+
+func (m *RegistryDefault) AdmissionHandler() *admission.Handler {
+	if m.admissionHandler == nil {
+		m.admissionHandler = admission.NewHandler(m, m.c)
+	}
+	return m.admissionHandler
+}
+
+func (m *RegistryDefault) AdmissionPersister() admission.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) DeviceAuthorizationHandler() *device.Handler {
+	if m.selfserviceDeviceHandler == nil {
+		m.selfserviceDeviceHandler = device.NewHandler(m, m.c)
+	}
+	return m.selfserviceDeviceHandler
+}
+
+func (m *RegistryDefault) DeviceAuthorizationPersister() device.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) RelationshipHandler() *relationship.Handler {
+	if m.relationshipHandler == nil {
+		m.relationshipHandler = relationship.NewHandler(m, m.c)
+	}
+	return m.relationshipHandler
+}
+
+func (m *RegistryDefault) RelationshipPersister() relationship.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) TokenHandler() *token.Handler {
+	if m.tokenHandler == nil {
+		m.tokenHandler = token.NewHandler(m, m.c)
+	}
+	return m.tokenHandler
+}
+
+func (m *RegistryDefault) TokenManager() *token.Manager {
+	if m.tokenManager == nil {
+		m.tokenManager = token.NewManager(m, m.c)
+	}
+	return m.tokenManager
+}
+
+func (m *RegistryDefault) TokenPersister() token.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) UploadBucket() *upload.Bucket {
+	if m.uploadBucket == nil {
+		m.uploadBucket = upload.NewBucket(m.c)
+	}
+	return m.uploadBucket
+}
+
+func (m *RegistryDefault) UploadHandler() *upload.Handler {
+	if m.uploadHandler == nil {
+		m.uploadHandler = upload.NewHandler(m, m.c)
+	}
+	return m.uploadHandler
+}
+
+func (m *RegistryDefault) SessionLoginCheckers() []session.LoginChecker {
+	return []session.LoginChecker{m.RegistrationAdmitter(), m.IdentityScheduler()}
+}
+
+func (m *RegistryDefault) IdentityScheduler() *schedule.Scheduler {
+	if m.scheduler == nil {
+		m.scheduler = schedule.NewScheduler(m, m.c)
+	}
+	return m.scheduler
+}
+
+func (m *RegistryDefault) ScheduledActionHandler() *schedule.Handler {
+	if m.scheduledActionHandler == nil {
+		m.scheduledActionHandler = schedule.NewHandler(m, m.c)
+	}
+	return m.scheduledActionHandler
+}
+
+func (m *RegistryDefault) ScheduledActionPersister() schedule.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) MaintenanceGuard() *maintenance.Guard {
+	if m.maintenanceGuard == nil {
+		m.maintenanceGuard = maintenance.NewGuard(m)
+	}
+	return m.maintenanceGuard
+}
+
+func (m *RegistryDefault) IdentityWriteGuard() identity.WriteGuard {
+	return m.MaintenanceGuard()
+}
+
+func (m *RegistryDefault) MaintenanceHandler() *maintenance.Handler {
+	if m.maintenanceHandler == nil {
+		m.maintenanceHandler = maintenance.NewHandler(m, m.c)
+	}
+	return m.maintenanceHandler
+}
+
+func (m *RegistryDefault) MaintenancePersister() maintenance.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) WebhookDispatcher() *webhook.Dispatcher {
+	if m.webhookDispatcher == nil {
+		m.webhookDispatcher = webhook.NewDispatcher(m, m.c)
+	}
+	return m.webhookDispatcher
+}
+
+func (m *RegistryDefault) WebhookHandler() *webhook.Handler {
+	if m.webhookHandler == nil {
+		m.webhookHandler = webhook.NewHandler(m, m.c)
+	}
+	return m.webhookHandler
+}
+
+func (m *RegistryDefault) WebhookPersister() webhook.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) BatchExecutor() *batch.Executor {
+	if m.batchExecutor == nil {
+		m.batchExecutor = batch.NewExecutor(m, m.c)
+	}
+	return m.batchExecutor
+}
+
+func (m *RegistryDefault) BatchHandler() *batch.Handler {
+	if m.batchHandler == nil {
+		m.batchHandler = batch.NewHandler(m, m.c)
+	}
+	return m.batchHandler
+}
+
+func (m *RegistryDefault) IdempotencyPersister() idempotency.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) ClusterElector() *cluster.Elector {
+	if m.clusterElector == nil {
+		m.clusterElector = cluster.NewElector(m)
+	}
+	return m.clusterElector
+}
+
+func (m *RegistryDefault) ClusterPersister() cluster.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) ErrorReporter() *report.Reporter {
+	if m.errorReporter == nil {
+		m.errorReporter = report.NewReporter(m, m.c)
+	}
+	return m.errorReporter
+}
+
+func (m *RegistryDefault) HookResilience() *resilience.Executor {
+	if m.hookResilience == nil {
+		m.hookResilience = resilience.NewExecutor(m.c, m)
+	}
+	return m.hookResilience
+}
+
+func (m *RegistryDefault) FlowInspectionHandler() *inspect.Handler {
+	if m.selfserviceFlowInspectionHandler == nil {
+		m.selfserviceFlowInspectionHandler = inspect.NewHandler(m)
+	}
+	return m.selfserviceFlowInspectionHandler
+}
+
+func (m *RegistryDefault) FlowInspectionPersister() inspect.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) OpenAPIHandler() *openapi.Handler {
+	if m.openAPIHandler == nil {
+		m.openAPIHandler = openapi.NewHandler(m, m.c)
+	}
+	return m.openAPIHandler
+}
+
 func (m *RegistryDefault) CourierPersister() courier.Persister {
 	return m.persister
 }
@@ -424,6 +869,41 @@ func (m *RegistryDefault) GenerateCSRFToken(r *http.Request) string {
 	return m.csrfTokenGenerator(r)
 }
 
+func (m *RegistryDefault) FlowBinder() *x.FlowBinder {
+	if m.flowBinder == nil {
+		m.flowBinder = x.NewFlowBinder(m.c.SessionSecrets, m.c.CSRFCookiePath(), m.c.CSRFCookieDomain(), m.c.CSRFCookieSecure(), m.c.CSRFCookieSameSiteMode())
+	}
+	return m.flowBinder
+}
+
+func (m *RegistryDefault) IdentityTraitsDeriver() *identity.TraitsDeriver {
+	if m.traitsDeriver == nil {
+		m.traitsDeriver = identity.NewTraitsDeriver(m.c)
+	}
+	return m.traitsDeriver
+}
+
+func (m *RegistryDefault) IdentityEntitlementResolver() *identity.EntitlementResolver {
+	if m.entitlements == nil {
+		m.entitlements = identity.NewEntitlementResolver(m.c)
+	}
+	return m.entitlements
+}
+
+func (m *RegistryDefault) PairwiseSubjects() *identity.PairwiseSubjects {
+	if m.pairwiseSubjects == nil {
+		m.pairwiseSubjects = identity.NewPairwiseSubjects(m.c, m)
+	}
+	return m.pairwiseSubjects
+}
+
+func (m *RegistryDefault) IdentityWebhookHandler() *identity.WebhookHandler {
+	if m.identityWebhook == nil {
+		m.identityWebhook = identity.NewWebhookHandler(m.c, m)
+	}
+	return m.identityWebhook
+}
+
 func (m *RegistryDefault) IdentityManager() *identity.Manager {
 	if m.identityManager == nil {
 		m.identityManager = identity.NewManager(m, m.c)
@@ -0,0 +1,81 @@
+package driver
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/healthx"
+)
+
+// readyCheckers returns the checks run by the readiness endpoint. If detailed is false, the
+// errors are replaced with a generic message so that the public API does not leak internals.
+func (m *RegistryDefault) readyCheckers(detailed bool) healthx.ReadyCheckers {
+	checks := healthx.ReadyCheckers{
+		"shutdown":         m.checkDraining,
+		"database":         m.Ping,
+		"migrations":       m.checkMigrations,
+		"identity_schemas": m.checkIdentityTraitsSchemas,
+	}
+
+	if m.c.CourierSMTPHealthCheck() {
+		checks["courier"] = func() error {
+			return m.Courier().Ping()
+		}
+	}
+
+	if detailed {
+		return checks
+	}
+
+	for name, check := range checks {
+		check := check
+		checks[name] = func() error {
+			if err := check(); err != nil {
+				return errors.New("check failed, see the admin API for details")
+			}
+			return nil
+		}
+	}
+
+	return checks
+}
+
+// Drain makes the readiness check fail so that load balancers stop sending new requests to this
+// instance before it shuts down.
+func (m *RegistryDefault) Drain() {
+	atomic.StoreInt32(&m.draining, 1)
+}
+
+func (m *RegistryDefault) checkDraining() error {
+	if atomic.LoadInt32(&m.draining) == 1 {
+		return errors.New("the server is shutting down")
+	}
+	return nil
+}
+
+func (m *RegistryDefault) checkMigrations() error {
+	required, err := m.persister.RequiredMigrations(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if len(required) > 0 {
+		return errors.Errorf("%d required migrations have not been applied: %s", len(required), strings.Join(required, ", "))
+	}
+	return nil
+}
+
+func (m *RegistryDefault) checkIdentityTraitsSchemas() error {
+	for _, s := range m.IdentityTraitsSchemas() {
+		f, err := jsonschema.LoadURL(s.RawURL)
+		if err != nil {
+			return errors.Wrapf(err, "unable to load identity traits schema %s", s.ID)
+		}
+		_ = f.Close()
+	}
+	return nil
+}
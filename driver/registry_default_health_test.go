@@ -0,0 +1,79 @@
+package driver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/healthx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+)
+
+func TestRegistryDefault_HealthHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratos-health")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	schemaPath := filepath.Join(dir, "identity.schema.json")
+	require.NoError(t, ioutil.WriteFile(schemaPath, []byte(`{"type":"object"}`), 0600))
+
+	_, reg := internal.NewRegistryDefault(t)
+
+	admin, public := httprouter.New(), httprouter.New()
+	reg.HealthHandler().SetRoutes(admin, true)
+	reg.PublicHealthHandler().SetRoutes(public, false)
+	adminTS, publicTS := httptest.NewServer(admin), httptest.NewServer(public)
+	defer adminTS.Close()
+	defer publicTS.Close()
+
+	ready := func(t *testing.T, ts *httptest.Server) (int, string) {
+		res, err := ts.Client().Get(ts.URL + healthx.ReadyCheckPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	t.Run("case=ready if all checks pass", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://"+schemaPath)
+
+		code, body := ready(t, adminTS)
+		assert.Equal(t, http.StatusOK, code, body)
+		code, body = ready(t, publicTS)
+		assert.Equal(t, http.StatusOK, code, body)
+	})
+
+	t.Run("case=not ready if a schema can not be loaded", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://"+filepath.Join(dir, "does-not-exist.json"))
+
+		code, body := ready(t, adminTS)
+		assert.Equal(t, http.StatusServiceUnavailable, code, body)
+		assert.Contains(t, gjson.Get(body, "errors.identity_schemas").String(), "does-not-exist.json")
+
+		code, body = ready(t, publicTS)
+		assert.Equal(t, http.StatusServiceUnavailable, code, body)
+		assert.True(t, gjson.Get(body, "errors.identity_schemas").Exists(), body)
+		assert.NotContains(t, body, "does-not-exist.json")
+	})
+
+	t.Run("case=not ready while draining", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://"+schemaPath)
+		reg.Drain()
+
+		code, body := ready(t, adminTS)
+		assert.Equal(t, http.StatusServiceUnavailable, code, body)
+		assert.True(t, gjson.Get(body, "errors.shutdown").Exists(), body)
+	})
+}
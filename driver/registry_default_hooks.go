@@ -5,32 +5,42 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/resilience"
 	"github.com/ory/kratos/selfservice/hook"
 )
 
-func (m *RegistryDefault) getHooks(credentialsType identity.CredentialsType, configs []configuration.SelfServiceHook) []interface{} {
-	var i []interface{}
+// configuredHook is a hook and the policy it is executed with.
+type configuredHook struct {
+	hook   interface{}
+	policy resilience.Policy
+}
+
+func (m *RegistryDefault) getHooks(flow string, credentialsType identity.CredentialsType, configs []configuration.SelfServiceHook) []configuredHook {
+	var i []configuredHook
 
 	for _, h := range configs {
+		policy, err := hookPolicy(flow, credentialsType, h)
+		if err != nil {
+			m.l.WithError(err).
+				WithField("type", credentialsType).
+				WithField("hook", h.Job).
+				Errorf("The after hook is misconfigured.")
+			continue
+		}
+
 		switch h.Job {
 		case hook.KeyVerify:
-			i = append(
-				i,
-				hook.NewVerifier(m),
-			)
+			i = append(i, configuredHook{hook: hook.NewVerifier(m), policy: policy})
 		case hook.KeySessionIssuer:
-			i = append(
-				i,
-				hook.NewSessionIssuer(m),
-			)
+			i = append(i, configuredHook{hook: hook.NewSessionIssuer(m), policy: policy})
 		case hook.KeySessionDestroyer:
-			i = append(
-				i,
-				hook.NewSessionDestroyer(m),
-			)
+			i = append(i, configuredHook{hook: hook.NewSessionDestroyer(m), policy: policy})
 		case hook.KeyRedirector:
 			var rc struct {
 				R string `json:"default_redirect_url"`
@@ -56,9 +66,8 @@ func (m *RegistryDefault) getHooks(credentialsType identity.CredentialsType, con
 				continue
 			}
 
-			i = append(
-				i,
-				hook.NewRedirector(
+			i = append(i, configuredHook{
+				hook: hook.NewRedirector(
 					func() *url.URL {
 						return rcr
 					},
@@ -67,7 +76,8 @@ func (m *RegistryDefault) getHooks(credentialsType identity.CredentialsType, con
 						return rc.A
 					},
 				),
-			)
+				policy: policy,
+			})
 		default:
 			m.l.
 				WithField("type", credentialsType).
@@ -78,3 +88,26 @@ func (m *RegistryDefault) getHooks(credentialsType identity.CredentialsType, con
 
 	return i
 }
+
+func hookPolicy(flow string, credentialsType identity.CredentialsType, h configuration.SelfServiceHook) (resilience.Policy, error) {
+	if h.Async && (h.Job == hook.KeySessionIssuer || h.Job == hook.KeyRedirector) {
+		return resilience.Policy{}, errors.Errorf("hook %s writes the response and can therefore not be async", h.Job)
+	}
+
+	p := resilience.Policy{
+		Name:     fmt.Sprintf("%s.after.%s.%s", flow, credentialsType, h.Job),
+		Retries:  h.Retries,
+		Critical: !h.Async && (h.Critical == nil || *h.Critical),
+		Async:    h.Async,
+	}
+
+	if len(h.Timeout) > 0 {
+		timeout, err := time.ParseDuration(h.Timeout)
+		if err != nil {
+			return p, errors.WithStack(err)
+		}
+		p.Timeout = timeout
+	}
+
+	return p, nil
+}
@@ -3,6 +3,7 @@ package driver
 import (
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/hook"
 )
 
 func (m *RegistryDefault) LoginHookExecutor() *login.HookExecutor {
@@ -17,13 +18,13 @@ func (m *RegistryDefault) PreLoginHooks() []login.PreHookExecutor {
 }
 
 func (m *RegistryDefault) PostLoginHooks(credentialsType identity.CredentialsType) []login.PostHookExecutor {
-	a := m.getHooks(credentialsType, m.c.SelfServiceLoginAfterHooks(string(credentialsType)))
+	a := m.getHooks("login", credentialsType, m.c.SelfServiceLoginAfterHooks(string(credentialsType)))
 
 	var b []login.PostHookExecutor
 
 	for _, v := range a {
-		if hook, ok := v.(login.PostHookExecutor); ok {
-			b = append(b, hook)
+		if h, ok := v.hook.(login.PostHookExecutor); ok {
+			b = append(b, hook.NewResilientLoginHook(m.HookResilience(), v.policy, h))
 		}
 	}
 
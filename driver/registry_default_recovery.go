@@ -0,0 +1,25 @@
+package driver
+
+import (
+	"github.com/ory/kratos/selfservice/flow/recovery"
+)
+
+func (m *RegistryDefault) RecoveryPersister() recovery.Persister {
+	return m.persister
+}
+
+func (m *RegistryDefault) RecoveryRequestErrorHandler() *recovery.ErrorHandler {
+	if m.selfserviceRecoveryErrorHandler == nil {
+		m.selfserviceRecoveryErrorHandler = recovery.NewErrorHandler(m, m.c)
+	}
+
+	return m.selfserviceRecoveryErrorHandler
+}
+
+func (m *RegistryDefault) RecoveryHandler() *recovery.Handler {
+	if m.selfserviceRecoveryHandler == nil {
+		m.selfserviceRecoveryHandler = recovery.NewHandler(m, m.c)
+	}
+
+	return m.selfserviceRecoveryHandler
+}
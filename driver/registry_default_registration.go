@@ -3,16 +3,17 @@ package driver
 import (
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/hook"
 )
 
 func (m *RegistryDefault) PostRegistrationHooks(credentialsType identity.CredentialsType) []registration.PostHookExecutor {
-	a := m.getHooks(credentialsType, m.c.SelfServiceRegistrationAfterHooks(string(credentialsType)))
+	a := m.getHooks("registration", credentialsType, m.c.SelfServiceRegistrationAfterHooks(string(credentialsType)))
 
 	var b []registration.PostHookExecutor
 
 	for _, v := range a {
-		if hook, ok := v.(registration.PostHookExecutor); ok {
-			b = append(b, hook)
+		if h, ok := v.hook.(registration.PostHookExecutor); ok {
+			b = append(b, hook.NewResilientRegistrationHook(m.HookResilience(), v.policy, h))
 		}
 	}
 
@@ -58,3 +59,11 @@ func (m *RegistryDefault) RegistrationRequestErrorHandler() *registration.ErrorH
 
 	return m.selfserviceRegistrationRequestErrorHandler
 }
+
+func (m *RegistryDefault) RegistrationEmailDomainPolicy() *registration.EmailDomainPolicy {
+	if m.selfserviceRegistrationEmailDomainPolicy == nil {
+		m.selfserviceRegistrationEmailDomainPolicy = registration.NewEmailDomainPolicy(m, m.c)
+	}
+
+	return m.selfserviceRegistrationEmailDomainPolicy
+}
@@ -1,8 +1,10 @@
 package driver
 
 import (
+	"context"
 	"net/url"
 
+	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/schema"
 )
 
@@ -23,5 +25,78 @@ func (m *RegistryDefault) IdentityTraitsSchemas() schema.Schemas {
 		})
 	}
 
-	return ss
+	stored, def := m.storedIdentityTraitsSchemas()
+	if def != nil {
+		// The stored default replaces the configured one, like changing the configuration would.
+		for k := range ss {
+			if ss[k].ID == configuration.DefaultIdentityTraitsSchemaID {
+				ss[k] = *def
+				ss[k].ID = configuration.DefaultIdentityTraitsSchemaID
+			}
+		}
+	}
+
+	return append(ss, stored...)
+}
+
+// storedIdentityTraitsSchemas returns the schemas stored using the admin API and the one set as default, if any.
+// Every version is available with the ID "<id>@<version>", and the ID of the schema resolves to its latest version.
+func (m *RegistryDefault) storedIdentityTraitsSchemas() (ss schema.Schemas, def *schema.Schema) {
+	if m.persister == nil {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	stored, err := m.persister.ListStoredSchemas(ctx)
+	if err != nil {
+		m.l.WithError(err).Error("Unable to load the identity traits schemas stored in the database.")
+		return nil, nil
+	}
+
+	for _, s := range stored {
+		var latest *schema.Schema
+		for version := 1; version <= s.LatestVersion; version++ {
+			id := schema.VersionID(s.ID, version)
+			raw, err := m.storedSchemaURL(ctx, s.ID, version)
+			if err != nil {
+				m.l.WithError(err).Errorf("Unable to load version %d of the identity traits schema %s.", version, s.ID)
+				continue
+			}
+
+			u, err := url.Parse(raw)
+			if err != nil {
+				m.l.WithError(err).Errorf("Unable to parse the URL of version %d of the identity traits schema %s.", version, s.ID)
+				continue
+			}
+
+			ss = append(ss, schema.Schema{ID: id, URL: u, RawURL: raw, VersionID: id})
+			latest = &ss[len(ss)-1]
+		}
+
+		if latest != nil {
+			alias := *latest
+			alias.ID = s.ID
+			ss = append(ss, alias)
+			if s.IsDefault {
+				def = &alias
+			}
+		}
+	}
+
+	return ss, def
+}
+
+func (m *RegistryDefault) storedSchemaURL(ctx context.Context, schemaID string, version int) (string, error) {
+	id := schema.VersionID(schemaID, version)
+	if u, ok := m.storedSchemaURLs.Load(id); ok {
+		return u.(string), nil
+	}
+
+	v, err := m.persister.GetSchemaVersion(ctx, schemaID, version)
+	if err != nil {
+		return "", err
+	}
+
+	m.storedSchemaURLs.Store(id, v.URL())
+	return v.URL(), nil
 }
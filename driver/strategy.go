@@ -0,0 +1,157 @@
+package driver
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/registration"
+)
+
+type (
+	// LoginStrategyFactory creates a login strategy. The registry provides the strategy's dependencies, and
+	// c.SelfServiceStrategy(id) returns its configuration from `selfservice.strategies.<id>`.
+	LoginStrategyFactory func(r Registry, c configuration.Provider) login.Strategy
+
+	// RegistrationStrategyFactory creates a registration strategy, see LoginStrategyFactory.
+	RegistrationStrategyFactory func(r Registry, c configuration.Provider) registration.Strategy
+
+	// StrategyStarter is implemented by custom strategies which need to set up resources, for example connections
+	// to external services, when the registry is initialized. An error aborts the initialization.
+	StrategyStarter interface {
+		StartStrategy(ctx context.Context) error
+	}
+
+	// StrategyStopper is implemented by custom strategies which need to release resources when the server shuts down.
+	StrategyStopper interface {
+		StopStrategy(ctx context.Context) error
+	}
+)
+
+var (
+	strategyFactoriesLock         sync.RWMutex
+	loginStrategyFactories        []LoginStrategyFactory
+	registrationStrategyFactories []RegistrationStrategyFactory
+)
+
+// RegisterLoginStrategy adds a login strategy to all registries created afterwards. It is meant to be called from
+// the init function of the package implementing the strategy:
+//
+//	func init() {
+//		driver.RegisterLoginStrategy(func(r driver.Registry, c configuration.Provider) login.Strategy {
+//			return NewStrategy(r, c)
+//		})
+//	}
+//
+// The strategy's routes are registered on the public router together with the built-in strategies.
+func RegisterLoginStrategy(f LoginStrategyFactory) {
+	strategyFactoriesLock.Lock()
+	defer strategyFactoriesLock.Unlock()
+	loginStrategyFactories = append(loginStrategyFactories, f)
+}
+
+// RegisterRegistrationStrategy adds a registration strategy to all registries created afterwards, see
+// RegisterLoginStrategy.
+func RegisterRegistrationStrategy(f RegistrationStrategyFactory) {
+	strategyFactoriesLock.Lock()
+	defer strategyFactoriesLock.Unlock()
+	registrationStrategyFactories = append(registrationStrategyFactories, f)
+}
+
+func (m *RegistryDefault) customLoginStrategies() []login.Strategy {
+	if m.selfserviceCustomLoginStrategies == nil {
+		strategyFactoriesLock.RLock()
+		defer strategyFactoriesLock.RUnlock()
+
+		m.selfserviceCustomLoginStrategies = make([]login.Strategy, len(loginStrategyFactories))
+		for k, f := range loginStrategyFactories {
+			m.selfserviceCustomLoginStrategies[k] = f(m, m.c)
+		}
+	}
+	return m.selfserviceCustomLoginStrategies
+}
+
+func (m *RegistryDefault) customRegistrationStrategies() []registration.Strategy {
+	if m.selfserviceCustomRegistrationStrategies == nil {
+		strategyFactoriesLock.RLock()
+		defer strategyFactoriesLock.RUnlock()
+
+		m.selfserviceCustomRegistrationStrategies = make([]registration.Strategy, len(registrationStrategyFactories))
+		for k, f := range registrationStrategyFactories {
+			m.selfserviceCustomRegistrationStrategies[k] = f(m, m.c)
+		}
+	}
+	return m.selfserviceCustomRegistrationStrategies
+}
+
+// customStrategies returns all custom strategies. A strategy which was registered for both login and registration
+// is returned once.
+func (m *RegistryDefault) customStrategies() []interface{} {
+	var strategies []interface{}
+	seen := map[interface{}]bool{}
+	for _, s := range m.customLoginStrategies() {
+		strategies = append(strategies, s)
+		if reflect.TypeOf(s).Comparable() {
+			seen[s] = true
+		}
+	}
+	for _, s := range m.customRegistrationStrategies() {
+		if !reflect.TypeOf(s).Comparable() || !seen[s] {
+			strategies = append(strategies, s)
+		}
+	}
+	return strategies
+}
+
+// validateStrategies returns an error if two strategies of the same flow use the same credentials type.
+func (m *RegistryDefault) validateStrategies() error {
+	seen := map[identity.CredentialsType]bool{}
+	for _, s := range m.LoginStrategies() {
+		if seen[s.LoginStrategyID()] {
+			return errors.Errorf("more than one login strategy was registered for credentials type %s", s.LoginStrategyID())
+		}
+		seen[s.LoginStrategyID()] = true
+	}
+
+	seen = map[identity.CredentialsType]bool{}
+	for _, s := range m.RegistrationStrategies() {
+		if seen[s.RegistrationStrategyID()] {
+			return errors.Errorf("more than one registration strategy was registered for credentials type %s", s.RegistrationStrategyID())
+		}
+		seen[s.RegistrationStrategyID()] = true
+	}
+
+	return nil
+}
+
+func (m *RegistryDefault) startStrategies(ctx context.Context) error {
+	if err := m.validateStrategies(); err != nil {
+		return err
+	}
+
+	for _, s := range m.customStrategies() {
+		if starter, ok := s.(StrategyStarter); ok {
+			if err := starter.StartStrategy(ctx); err != nil {
+				return errors.Wrapf(err, "unable to start strategy %T", s)
+			}
+		}
+	}
+	return nil
+}
+
+// StopStrategies stops all custom strategies implementing StrategyStopper. It is called once all servers have
+// shut down.
+func (m *RegistryDefault) StopStrategies(ctx context.Context) {
+	for _, s := range m.customStrategies() {
+		if stopper, ok := s.(StrategyStopper); ok {
+			if err := stopper.StopStrategy(ctx); err != nil {
+				m.Logger().WithError(err).Errorf("Unable to stop strategy %T.", s)
+			}
+		}
+	}
+}
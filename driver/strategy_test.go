@@ -0,0 +1,70 @@
+package driver_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+const customStrategyID identity.CredentialsType = "custom"
+
+type customStrategy struct {
+	c                configuration.Provider
+	started, stopped int
+}
+
+func (s *customStrategy) LoginStrategyID() identity.CredentialsType               { return customStrategyID }
+func (s *customStrategy) RegisterLoginRoutes(*x.RouterPublic)                     {}
+func (s *customStrategy) PopulateLoginMethod(*http.Request, *login.Request) error { return nil }
+
+func (s *customStrategy) StartStrategy(context.Context) error {
+	s.started++
+	return nil
+}
+
+func (s *customStrategy) StopStrategy(context.Context) error {
+	s.stopped++
+	return nil
+}
+
+var customStrategies []*customStrategy
+
+func init() {
+	driver.RegisterLoginStrategy(func(r driver.Registry, c configuration.Provider) login.Strategy {
+		s := &customStrategy{c: c}
+		customStrategies = append(customStrategies, s)
+		return s
+	})
+}
+
+func TestRegisterLoginStrategy(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	require.NotEmpty(t, customStrategies)
+	s := customStrategies[len(customStrategies)-1]
+
+	strategy, err := reg.LoginStrategies().Strategy(customStrategyID)
+	require.NoError(t, err)
+	assert.Equal(t, s, strategy)
+	assert.Equal(t, 1, s.started, "the strategy must be started when the registry is initialized")
+
+	_, err = reg.LoginStrategies().Strategy(identity.CredentialsTypePassword)
+	require.NoError(t, err, "built-in strategies must still be available")
+
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(customStrategyID), map[string]interface{}{"enabled": true, "config": map[string]interface{}{"foo": "bar"}})
+	assert.JSONEq(t, `{"foo":"bar"}`, string(s.c.SelfServiceStrategy(string(customStrategyID)).Config))
+
+	reg.StopStrategies(context.Background())
+	assert.Equal(t, 1, s.stopped)
+}
@@ -0,0 +1,274 @@
+// Package egress controls the HTTP calls ORY Kratos sends to other services, for example to OpenID Connect
+// providers, webhook subscribers, remote identity schemas, and the Have I Been Pwned API. Calls are sent through
+// the configured proxies, except to the hosts which bypass them, and only to the allowed hosts. Calls to private
+// network addresses can be blocked as well, see Config.BlockPrivateNetworks.
+//
+// Hosts are matched against patterns which are either
+//
+//	a host name such as accounts.example.org, which matches only that host,
+//	a wildcard such as *.example.org, which matches all subdomains of example.org but not example.org itself,
+//	an IP address such as 10.0.0.1 or a network in CIDR notation such as 10.0.0.0/8, which match IP hosts, or
+//	*, which matches all hosts.
+package egress
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/x"
+)
+
+type (
+	// Config configures outbound HTTP calls.
+	Config struct {
+		// HTTPProxy and HTTPSProxy are the URLs of the proxies for http:// and https:// URLs. If both are empty,
+		// the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables are used.
+		HTTPProxy  string
+		HTTPSProxy string
+
+		// ProxyBypass are the patterns of the hosts which are called directly instead of through the proxy.
+		ProxyBypass []string
+
+		// AllowedHosts are the patterns of the hosts which may be called. All hosts may be called if it is empty.
+		AllowedHosts []string
+
+		// BlockPrivateNetworks prevents calls to hosts which resolve to private network addresses, except to the
+		// hosts and addresses matching AllowedPrivateHosts. Proxies are always called. The host of a request sent
+		// through a proxy is resolved before the request is sent, but the proxy resolves it again.
+		BlockPrivateNetworks bool
+		AllowedPrivateHosts  []string
+	}
+
+	// Transport sends HTTP requests according to the configuration, see Config.
+	Transport struct {
+		mu     sync.RWMutex
+		config func() Config
+		base   *http.Transport
+	}
+
+	roundTripperFunc func(*http.Request) (*http.Response, error)
+
+	proxyContextKey struct{}
+)
+
+// ErrHostNotAllowed is returned for requests to hosts which are not allowed, see Config.AllowedHosts.
+var ErrHostNotAllowed = errors.New("the host is not in the list of allowed outbound hosts")
+
+// Default sends the outbound HTTP calls of ORY Kratos. Its configuration is set by the configuration package.
+var Default = NewTransport(func() Config { return Config{} })
+
+// NewTransport returns a transport which calls config for every request, which allows changing the configuration
+// at runtime.
+func NewTransport(config func() Config) *Transport {
+	t := &Transport{config: config}
+	t.base = t.newBase()
+	return t
+}
+
+// SetConfig replaces the function returning the configuration.
+func (t *Transport) SetConfig(config func() Config) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.config = config
+}
+
+func (t *Transport) currentConfig() Config {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.config()
+}
+
+// RoundTrip implements http.RoundTripper. Redirects are checked as well, because the client sends them through
+// the transport too.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.roundTrip(req, t.base)
+}
+
+// WithTLS returns a transport which uses the TLS configuration, for example to present a client certificate. It
+// does not keep connections alive, so it can be created for every call without leaking connections.
+func (t *Transport) WithTLS(conf *tls.Config) http.RoundTripper {
+	base := t.newBase()
+	base.TLSClientConfig = conf
+	base.DisableKeepAlives = true
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return t.roundTrip(req, base)
+	})
+}
+
+// Client returns an HTTP client which sends its requests through the transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// HookClient returns an HTTP client for calls to hooks, for example back-channel logout clients or push
+// gateways. It uses the timeout and transport of c, or a transport using conf if it is set, see WithTLS. It does not
+// follow redirects, so that a hook can not send calls to another service.
+func (t *Transport) HookClient(c *http.Client, conf *tls.Config) *http.Client {
+	hc := &http.Client{
+		Timeout:   c.Timeout,
+		Transport: c.Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if conf != nil {
+		hc.Transport = t.WithTLS(conf)
+	}
+	return hc
+}
+
+func (t *Transport) roundTrip(req *http.Request, base *http.Transport) (*http.Response, error) {
+	closeBody := func() {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+	}
+
+	if err := t.Allowed(req.URL); err != nil {
+		closeBody()
+		return nil, err
+	}
+
+	if t.currentConfig().BlockPrivateNetworks {
+		proxy, err := base.Proxy(req)
+		if err != nil {
+			closeBody()
+			return nil, err
+		}
+
+		if proxy != nil {
+			// The dialer only sees the address of the proxy, which is why the host is checked here.
+			if err := x.CheckHost(req.Context(), req.URL.Hostname(), t.allowAddress); err != nil {
+				closeBody()
+				return nil, err
+			}
+			req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, proxy.Hostname()))
+		}
+	}
+	return base.RoundTrip(req)
+}
+
+// CheckURL returns an error if the URL may not be called, for example because the host is not allowed or because
+// it resolves to a private network address. It reports configured URLs early, because calls fail for the same
+// reasons.
+func (t *Transport) CheckURL(ctx context.Context, u *url.URL) error {
+	if err := t.Allowed(u); err != nil {
+		return err
+	}
+	if !t.currentConfig().BlockPrivateNetworks {
+		return nil
+	}
+	return x.CheckHost(ctx, u.Hostname(), t.allowAddress)
+}
+
+// Allowed returns ErrHostNotAllowed if the host of the URL may not be called.
+func (t *Transport) Allowed(u *url.URL) error {
+	c := t.currentConfig()
+	if len(c.AllowedHosts) == 0 || Match(c.AllowedHosts, u.Hostname()) {
+		return nil
+	}
+	return errors.WithStack(errors.WithMessagef(ErrHostNotAllowed, "calls to %s are not allowed", u.Hostname()))
+}
+
+func (t *Transport) newBase() *http.Transport {
+	base := x.NewSafeTransport(t.allowAddress)
+	base.Proxy = t.proxy
+	return base
+}
+
+// allowAddress decides whether the host may be called at the private IP address.
+func (t *Transport) allowAddress(ctx context.Context, host string, ip net.IP) bool {
+	c := t.currentConfig()
+	if !c.BlockPrivateNetworks {
+		return true
+	}
+	if proxy, ok := ctx.Value(proxyContextKey{}).(string); ok && proxy == host {
+		return true
+	}
+	return Match(c.AllowedPrivateHosts, host) || Match(c.AllowedPrivateHosts, ip.String())
+}
+
+// proxy returns the URL of the proxy for the request, or nil if the request is sent directly.
+func (t *Transport) proxy(req *http.Request) (*url.URL, error) {
+	c := t.currentConfig()
+	if len(c.HTTPProxy) == 0 && len(c.HTTPSProxy) == 0 {
+		return http.ProxyFromEnvironment(req)
+	}
+
+	if Match(c.ProxyBypass, req.URL.Hostname()) {
+		return nil, nil
+	}
+
+	proxy := c.HTTPProxy
+	if req.URL.Scheme == "https" {
+		proxy = c.HTTPSProxy
+	}
+	if len(proxy) == 0 {
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse the proxy URL %s", proxy)
+	}
+	return u, nil
+}
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Match returns true if the host matches one of the patterns.
+func Match(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch {
+		case p == "*":
+			return true
+		case strings.Contains(p, "/"):
+			if _, network, err := net.ParseCIDR(p); err == nil && ip != nil && network.Contains(ip) {
+				return true
+			}
+		case strings.HasPrefix(p, "*."):
+			if strings.HasSuffix(host, p[1:]) {
+				return true
+			}
+		case ip != nil:
+			if pip := net.ParseIP(p); pip != nil && pip.Equal(ip) {
+				return true
+			}
+		case p == host:
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePattern returns an error if the pattern can never match, for example a malformed network.
+func ValidatePattern(p string) error {
+	p = strings.TrimSpace(p)
+	switch {
+	case len(p) == 0:
+		return errors.New("the pattern is empty")
+	case strings.Contains(p, "/"):
+		if _, _, err := net.ParseCIDR(p); err != nil {
+			return errors.Errorf("%s is not a network in CIDR notation", p)
+		}
+	case strings.Contains(p, "://") || strings.Contains(p, ":") && net.ParseIP(p) == nil:
+		return errors.Errorf("%s must be a host without scheme and port", p)
+	case strings.Contains(p[1:], "*"):
+		return errors.Errorf("%s may only contain a wildcard at the beginning, for example *.example.org", p)
+	case strings.HasPrefix(p, "*") && p != "*" && !strings.HasPrefix(p, "*."):
+		return errors.Errorf("%s must be followed by a dot, for example *.example.org", p)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package egress
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/x"
+)
+
+func TestMatch(t *testing.T) {
+	for k, tc := range []struct {
+		patterns []string
+		host     string
+		matches  bool
+	}{
+		{patterns: []string{"*"}, host: "example.org", matches: true},
+		{patterns: []string{"example.org"}, host: "example.org", matches: true},
+		{patterns: []string{"Example.org"}, host: "example.ORG.", matches: true},
+		{patterns: []string{"example.org"}, host: "login.example.org"},
+		{patterns: []string{"*.example.org"}, host: "login.example.org", matches: true},
+		{patterns: []string{"*.example.org"}, host: "a.b.example.org", matches: true},
+		{patterns: []string{"*.example.org"}, host: "example.org"},
+		{patterns: []string{"*.example.org"}, host: "badexample.org"},
+		{patterns: []string{"10.0.0.1"}, host: "10.0.0.1", matches: true},
+		{patterns: []string{"10.0.0.0/8"}, host: "10.1.2.3", matches: true},
+		{patterns: []string{"10.0.0.0/8"}, host: "11.1.2.3"},
+		{patterns: []string{"10.0.0.0/8"}, host: "example.org"},
+		{patterns: []string{"::1"}, host: "::1", matches: true},
+		{patterns: []string{"fd00::/8"}, host: "fd12::1", matches: true},
+		{patterns: []string{"example.com", "example.org"}, host: "example.org", matches: true},
+		{patterns: nil, host: "example.org"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, tc.matches, Match(tc.patterns, tc.host))
+		})
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for _, p := range []string{"*", "example.org", "*.example.org", "10.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"} {
+		assert.NoError(t, ValidatePattern(p), p)
+	}
+	for _, p := range []string{"", "10.0.0.0/33", "https://example.org", "example.org:443", "login.*.example.org", "*example.org"} {
+		assert.Error(t, ValidatePattern(p), p)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var lock sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		// Requests sent through a proxy contain the absolute URL.
+		proxied = append(proxied, r.URL.String())
+		_, _ = w.Write([]byte("proxy"))
+	}))
+	defer proxy.Close()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://internal.example.org/secret", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("target"))
+	}))
+	defer target.Close()
+
+	var config Config
+	tr := NewTransport(func() Config { return config })
+	c := &http.Client{Transport: tr}
+
+	get := func(c *http.Client, u string) (string, error) {
+		res, err := c.Get(u)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		var body [16]byte
+		n, _ := res.Body.Read(body[:])
+		return string(body[:n]), nil
+	}
+
+	t.Run("case=sends requests through the proxy", func(t *testing.T) {
+		config = Config{HTTPProxy: proxy.URL}
+
+		body, err := get(c, "http://login.example.org/.well-known/openid-configuration")
+		require.NoError(t, err)
+		assert.Equal(t, "proxy", body)
+
+		lock.Lock()
+		defer lock.Unlock()
+		assert.Equal(t, []string{"http://login.example.org/.well-known/openid-configuration"}, proxied)
+	})
+
+	t.Run("case=bypasses the proxy", func(t *testing.T) {
+		config = Config{HTTPProxy: proxy.URL, ProxyBypass: []string{"127.0.0.0/8"}}
+
+		body, err := get(c, target.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "target", body)
+	})
+
+	t.Run("case=uses the proxy for the scheme only", func(t *testing.T) {
+		config = Config{HTTPSProxy: proxy.URL}
+
+		body, err := get(c, target.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "target", body, "http:// URLs are not sent through the https:// proxy")
+	})
+
+	t.Run("case=blocks hosts which are not allowed", func(t *testing.T) {
+		config = Config{AllowedHosts: []string{"*.example.org"}}
+
+		_, err := get(c, target.URL)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrHostNotAllowed), "%+v", err)
+
+		_, err = get(&http.Client{Transport: tr.WithTLS(nil)}, target.URL)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrHostNotAllowed), "%+v", err)
+	})
+
+	t.Run("case=blocks redirects to hosts which are not allowed", func(t *testing.T) {
+		config = Config{AllowedHosts: []string{"127.0.0.1"}}
+
+		body, err := get(c, target.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "target", body)
+
+		_, err = get(c, target.URL+"/redirect")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrHostNotAllowed), "%+v", err)
+	})
+
+	t.Run("case=blocks private networks", func(t *testing.T) {
+		// Connections kept alive by the previous cases would not be dialed again.
+		tr.base.CloseIdleConnections()
+		config = Config{BlockPrivateNetworks: true}
+
+		_, err := get(c, target.URL)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, x.ErrPrivateAddress), "%+v", err)
+
+		config = Config{BlockPrivateNetworks: true, AllowedPrivateHosts: []string{"127.0.0.0/8"}}
+		body, err := get(c, target.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "target", body)
+	})
+
+	t.Run("case=checks the host of proxied requests", func(t *testing.T) {
+		config = Config{HTTPProxy: proxy.URL, BlockPrivateNetworks: true}
+
+		body, err := get(c, "http://93.184.216.34/")
+		require.NoError(t, err)
+		assert.Equal(t, "proxy", body, "the proxy is called even though it is in a private network")
+
+		_, err = get(c, "http://10.0.0.1/")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, x.ErrPrivateAddress), "%+v", err)
+	})
+
+	t.Run("method=CheckURL", func(t *testing.T) {
+		config = Config{BlockPrivateNetworks: true, AllowedHosts: []string{"*.example.org", "10.0.0.0/8"}, AllowedPrivateHosts: []string{"10.1.0.0/16"}}
+		assert.True(t, errors.Is(tr.CheckURL(context.Background(), &url.URL{Scheme: "https", Host: "example.com"}), ErrHostNotAllowed))
+		assert.True(t, errors.Is(tr.CheckURL(context.Background(), &url.URL{Scheme: "https", Host: "10.2.0.1"}), x.ErrPrivateAddress))
+		assert.NoError(t, tr.CheckURL(context.Background(), &url.URL{Scheme: "https", Host: "10.1.0.1"}))
+	})
+
+	t.Run("method=HookClient", func(t *testing.T) {
+		config = Config{}
+		hc := tr.HookClient(&http.Client{Timeout: time.Second, Transport: tr}, nil)
+		assert.Equal(t, time.Second, hc.Timeout)
+
+		res, err := hc.Get(target.URL + "/redirect")
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.Equal(t, http.StatusFound, res.StatusCode, "redirects are not followed")
+
+		hc = tr.HookClient(&http.Client{Transport: tr}, &tls.Config{})
+		assert.NotEqual(t, tr, hc.Transport)
+	})
+
+	t.Run("method=Allowed", func(t *testing.T) {
+		config = Config{}
+		assert.NoError(t, tr.Allowed(&url.URL{Scheme: "https", Host: "example.org"}))
+
+		config = Config{AllowedHosts: []string{"example.org"}}
+		assert.NoError(t, tr.Allowed(&url.URL{Scheme: "https", Host: "example.org:443"}))
+		assert.Error(t, tr.Allowed(&url.URL{Scheme: "https", Host: "example.com"}))
+	})
+}
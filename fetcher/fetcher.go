@@ -0,0 +1,303 @@
+// Package fetcher loads files such as identity schemas, courier templates, and the configuration file from local
+// and remote sources. Supported sources are
+//
+//	/path/to/file and file:///path/to/file
+//	base64://<base64 encoded content>
+//	http://... and https://..., user info in the URL is sent as basic auth
+//	s3://bucket/key?region=eu-central-1, signed with AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+//	gs://bucket/object, authorized with GOOGLE_OAUTH_ACCESS_TOKEN or the token of the GCE metadata server
+//
+// Remote files are cached and fetched again once the refresh interval has passed.
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/jsonschema/v3"
+
+	"github.com/ory/kratos/egress"
+)
+
+// maxSize limits the size of remote files.
+const maxSize = 10 << 20
+
+type (
+	// Config configures how remote files are fetched.
+	Config struct {
+		// RefreshInterval is how long a remote file is cached. If zero, remote files are cached until the process
+		// exits.
+		RefreshInterval time.Duration
+
+		// Headers are added to HTTP requests whose URL starts with the rule's prefix, for example to authenticate
+		// using an API token.
+		Headers []HeaderRule
+	}
+
+	// HeaderRule adds headers to HTTP requests for URLs starting with URLPrefix.
+	HeaderRule struct {
+		URLPrefix string            `json:"url_prefix"`
+		Headers   map[string]string `json:"headers"`
+	}
+
+	// Fetcher fetches files from local and remote sources.
+	Fetcher struct {
+		hc     *http.Client
+		config func() Config
+		getenv func(string) string
+		now    func() time.Time
+
+		mu    sync.RWMutex
+		cache map[string]*entry
+
+		gcsToken *token
+	}
+
+	Option func(f *Fetcher)
+
+	entry struct {
+		body      []byte
+		fetchedAt time.Time
+	}
+
+	token struct {
+		value     string
+		expiresAt time.Time
+	}
+)
+
+// Default fetches identity schemas and courier templates.
+var Default = New()
+
+// WithHTTPClient sets the HTTP client used to fetch remote files.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(f *Fetcher) {
+		f.hc = hc
+	}
+}
+
+// WithConfig sets the function returning the configuration. It is called on every fetch, which allows changing
+// the configuration at runtime.
+func WithConfig(config func() Config) Option {
+	return func(f *Fetcher) {
+		f.config = config
+	}
+}
+
+func withEnv(getenv func(string) string) Option {
+	return func(f *Fetcher) {
+		f.getenv = getenv
+	}
+}
+
+func withClock(now func() time.Time) Option {
+	return func(f *Fetcher) {
+		f.now = now
+	}
+}
+
+func New(opts ...Option) *Fetcher {
+	f := &Fetcher{
+		hc:     &http.Client{Timeout: 30 * time.Second, Transport: egress.Default},
+		config: func() Config { return Config{RefreshInterval: 5 * time.Minute} },
+		getenv: os.Getenv,
+		now:    time.Now,
+		cache:  map[string]*entry{},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// SetConfig replaces the function returning the configuration, see WithConfig.
+func (f *Fetcher) SetConfig(config func() Config) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = config
+}
+
+func (f *Fetcher) currentConfig() Config {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.config()
+}
+
+// IsRemote returns true if the source is fetched over the network.
+func IsRemote(source string) bool {
+	switch scheme(source) {
+	case "http", "https", "s3", "gs":
+		return true
+	}
+	return false
+}
+
+// IsSupported returns true if Fetch supports the source.
+func IsSupported(source string) bool {
+	switch scheme(source) {
+	case "", "file", "base64":
+		return true
+	}
+	return IsRemote(source)
+}
+
+func scheme(source string) string {
+	if i := strings.Index(source, "://"); i > 0 {
+		return strings.ToLower(source[:i])
+	}
+	return ""
+}
+
+// Fetch returns the content of the source. If fetching a cached remote file fails, the cached content is returned.
+func (f *Fetcher) Fetch(ctx context.Context, source string) ([]byte, error) {
+	switch scheme(source) {
+	case "":
+		return readFile(source)
+	case "file":
+		return readFile(source[len("file://"):])
+	case "base64":
+		return decodeBase64(source[len("base64://"):])
+	case "http", "https", "s3", "gs":
+		return f.fetchCached(ctx, source)
+	}
+	return nil, errors.Errorf("unsupported source %s, use a path or a file://, base64://, http://, https://, s3://, or gs:// URL", source)
+}
+
+// Load implements the loader of github.com/ory/jsonschema/v3, see RegisterJSONSchemaLoaders.
+func (f *Fetcher) Load(source string) (io.ReadCloser, error) {
+	body, err := f.Fetch(context.Background(), source)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+// RegisterJSONSchemaLoaders makes f load JSON schemas from remote sources. It replaces the loaders of
+// github.com/ory/jsonschema/v3/httploader and must therefore be called after that package was initialized.
+func RegisterJSONSchemaLoaders(f *Fetcher) {
+	for _, s := range []string{"http", "https", "s3", "gs", "base64"} {
+		jsonschema.Loaders[s] = f.Load
+	}
+}
+
+func readFile(path string) ([]byte, error) {
+	body, err := ioutil.ReadFile(path)
+	return body, errors.WithStack(err)
+}
+
+func decodeBase64(data string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if body, err := enc.DecodeString(data); err == nil {
+			return body, nil
+		}
+	}
+	return nil, errors.New("unable to decode base64:// source, the content is not base64 encoded")
+}
+
+func (f *Fetcher) fetchCached(ctx context.Context, source string) ([]byte, error) {
+	c := f.currentConfig()
+
+	f.mu.RLock()
+	cached, ok := f.cache[source]
+	f.mu.RUnlock()
+	if ok && (c.RefreshInterval <= 0 || f.now().Sub(cached.fetchedAt) < c.RefreshInterval) {
+		return cached.body, nil
+	}
+
+	body, err := f.fetchRemote(ctx, source, c)
+	if err != nil {
+		if ok {
+			// The source is temporarily unavailable, keep using what we have.
+			return cached.body, nil
+		}
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.cache[source] = &entry{body: body, fetchedAt: f.now()}
+	f.mu.Unlock()
+	return body, nil
+}
+
+func (f *Fetcher) fetchRemote(ctx context.Context, source string, c Config) ([]byte, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var req *http.Request
+	switch u.Scheme {
+	case "s3":
+		req, err = f.s3Request(ctx, u)
+	case "gs":
+		req, err = f.gcsRequest(ctx, u)
+	default:
+		req, err = http.NewRequest("GET", source, nil)
+		if err == nil {
+			req = req.WithContext(ctx)
+			for _, rule := range c.Headers {
+				if len(rule.URLPrefix) > 0 && strings.HasPrefix(source, rule.URLPrefix) {
+					for k, v := range rule.Headers {
+						req.Header.Set(k, v)
+					}
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	res, err := f.hc.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetching %s returned status code %d", redact(u), res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(body) > maxSize {
+		return nil, errors.Errorf("%s is larger than %d bytes", redact(u), maxSize)
+	}
+	return body, nil
+}
+
+// redact removes the password from the URL so that it can be used in error messages.
+func redact(u *url.URL) string {
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	r := *u
+	r.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return r.String()
+}
+
+func (f *Fetcher) env(keys ...string) string {
+	for _, k := range keys {
+		if v := f.getenv(k); len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+func (t *token) valid(now time.Time) bool {
+	return t != nil && now.Add(time.Minute).Before(t.expiresAt)
+}
@@ -0,0 +1,170 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=local sources", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "fetcher")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "schema.json")
+		require.NoError(t, ioutil.WriteFile(path, []byte(`{"type":"object"}`), 0600))
+
+		f := New()
+		for _, source := range []string{
+			path,
+			"file://" + path,
+			"base64://" + base64.StdEncoding.EncodeToString([]byte(`{"type":"object"}`)),
+			"base64://" + base64.RawURLEncoding.EncodeToString([]byte(`{"type":"object"}`)),
+		} {
+			body, err := f.Fetch(ctx, source)
+			require.NoError(t, err, source)
+			assert.Equal(t, `{"type":"object"}`, string(body), source)
+		}
+
+		_, err = f.Fetch(ctx, "base64://not base64!")
+		require.Error(t, err)
+		_, err = f.Fetch(ctx, "ftp://example.org/schema.json")
+		require.Error(t, err)
+	})
+
+	t.Run("case=http with authentication and caching", func(t *testing.T) {
+		var requests int
+		var status = http.StatusOK
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(status)
+			user, password, _ := r.BasicAuth()
+			_, _ = fmt.Fprintf(w, "%d token=%s basic=%s:%s", requests, r.Header.Get("X-Token"), user, password)
+		}))
+		defer ts.Close()
+
+		now := time.Now()
+		f := New(
+			withClock(func() time.Time { return now }),
+			WithConfig(func() Config {
+				return Config{
+					RefreshInterval: time.Minute,
+					Headers: []HeaderRule{
+						{URLPrefix: ts.URL + "/private/", Headers: map[string]string{"X-Token": "secret"}},
+						{URLPrefix: "", Headers: map[string]string{"X-Token": "never"}},
+					},
+				}
+			}),
+		)
+
+		body, err := f.Fetch(ctx, ts.URL+"/private/schema.json")
+		require.NoError(t, err)
+		assert.Equal(t, "1 token=secret basic=:", string(body))
+
+		u, _ := url.Parse(ts.URL + "/public/schema.json")
+		u.User = url.UserPassword("foo", "bar")
+		body, err = f.Fetch(ctx, u.String())
+		require.NoError(t, err)
+		assert.Equal(t, "2 token= basic=foo:bar", string(body))
+
+		body, err = f.Fetch(ctx, ts.URL+"/private/schema.json")
+		require.NoError(t, err)
+		assert.Equal(t, "1 token=secret basic=:", string(body), "served from the cache")
+
+		now = now.Add(2 * time.Minute)
+		body, err = f.Fetch(ctx, ts.URL+"/private/schema.json")
+		require.NoError(t, err)
+		assert.Equal(t, "3 token=secret basic=:", string(body), "refreshed after the interval")
+
+		status = http.StatusInternalServerError
+		now = now.Add(2 * time.Minute)
+		body, err = f.Fetch(ctx, ts.URL+"/private/schema.json")
+		require.NoError(t, err)
+		assert.Equal(t, "3 token=secret basic=:", string(body), "stale content is used if the source is unavailable")
+
+		_, err = f.Fetch(ctx, ts.URL+"/not-cached.json")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "500")
+	})
+
+	t.Run("case=s3", func(t *testing.T) {
+		var got *http.Request
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			_, _ = w.Write([]byte("config"))
+		}))
+		defer ts.Close()
+
+		env := map[string]string{"AWS_ACCESS_KEY_ID": "AKIDEXAMPLE", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_SESSION_TOKEN": "session"}
+		f := New(withEnv(func(k string) string { return env[k] }))
+
+		body, err := f.Fetch(ctx, "s3://bucket/path/to/kratos%20config.yml?region=eu-central-1&endpoint="+url.QueryEscape(ts.URL))
+		require.NoError(t, err)
+		assert.Equal(t, "config", string(body))
+		assert.Equal(t, "/bucket/path/to/kratos%20config.yml", got.URL.EscapedPath())
+		assert.Equal(t, "session", got.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(got.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), got.Header.Get("Authorization"))
+		assert.Contains(t, got.Header.Get("Authorization"), "/eu-central-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature=")
+
+		req, err := f.s3Request(ctx, &url.URL{Scheme: "s3", Host: "bucket", Path: "/config.yml"})
+		require.NoError(t, err)
+		assert.Equal(t, "https://bucket.s3.us-east-1.amazonaws.com/config.yml", req.URL.String())
+
+		_, err = f.s3Request(ctx, &url.URL{Scheme: "s3", Host: "bucket"})
+		require.Error(t, err)
+	})
+
+	t.Run("case=gs", func(t *testing.T) {
+		var tokenRequests int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenRequests++
+			assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+			_, _ = w.Write([]byte(`{"access_token":"metadata-token","expires_in":3600}`))
+		}))
+		defer ts.Close()
+
+		defaultURL := gcsMetadataTokenURL
+		gcsMetadataTokenURL = ts.URL
+		defer func() { gcsMetadataTokenURL = defaultURL }()
+
+		env := map[string]string{}
+		f := New(withEnv(func(k string) string { return env[k] }))
+
+		for i := 0; i < 2; i++ {
+			req, err := f.gcsRequest(ctx, &url.URL{Scheme: "gs", Host: "bucket", Path: "/path/to/config.yml"})
+			require.NoError(t, err)
+			assert.Equal(t, "https://storage.googleapis.com/bucket/path/to/config.yml", req.URL.String())
+			assert.Equal(t, "Bearer metadata-token", req.Header.Get("Authorization"))
+		}
+		assert.Equal(t, 1, tokenRequests)
+
+		env["GOOGLE_OAUTH_ACCESS_TOKEN"] = "env-token"
+		req, err := f.gcsRequest(ctx, &url.URL{Scheme: "gs", Host: "bucket", Path: "/config.yml"})
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer env-token", req.Header.Get("Authorization"))
+	})
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite.
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	signV4(req, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
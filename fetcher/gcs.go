@@ -0,0 +1,78 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// gcsMetadataTokenURL returns access tokens of the service account on Google Compute Engine and GKE.
+var gcsMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcsRequest returns the request for gs://bucket/object. It is authorized with GOOGLE_OAUTH_ACCESS_TOKEN or, if
+// that is not set, with the token of the GCE metadata server. Without either, the object must be public.
+func (f *Fetcher) gcsRequest(ctx context.Context, u *url.URL) (*http.Request, error) {
+	bucket, object := u.Host, strings.TrimPrefix(u.Path, "/")
+	if len(bucket) == 0 || len(object) == 0 {
+		return nil, errors.Errorf("%s must contain a bucket and an object, for example gs://bucket/path/to/file.yml", u)
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, awsURIEncode(object)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if t := f.gcsAccessToken(ctx); len(t) > 0 {
+		req.Header.Set("Authorization", "Bearer "+t)
+	}
+	return req, nil
+}
+
+func (f *Fetcher) gcsAccessToken(ctx context.Context) string {
+	if t := f.env("GOOGLE_OAUTH_ACCESS_TOKEN"); len(t) > 0 {
+		return t
+	}
+
+	f.mu.RLock()
+	t := f.gcsToken
+	f.mu.RUnlock()
+	if t.valid(f.now()) {
+		return t.value
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", gcsMetadataTokenURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	res, err := f.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		// Not running on Google Cloud.
+		return ""
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&body) != nil {
+		return ""
+	}
+
+	f.mu.Lock()
+	f.gcsToken = &token{value: body.AccessToken, expiresAt: f.now().Add(time.Duration(body.ExpiresIn) * time.Second)}
+	f.mu.Unlock()
+	return body.AccessToken
+}
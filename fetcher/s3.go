@@ -0,0 +1,149 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// emptyPayloadHash is the SHA-256 hash of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Request returns the request for s3://bucket/key. The query parameter `region` sets the bucket's region and
+// `endpoint` the URL of an S3 compatible service such as MinIO. The request is signed if AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY are set.
+func (f *Fetcher) s3Request(ctx context.Context, u *url.URL) (*http.Request, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if len(bucket) == 0 || len(key) == 0 {
+		return nil, errors.Errorf("%s must contain a bucket and a key, for example s3://bucket/path/to/file.yml", u)
+	}
+
+	region := u.Query().Get("region")
+	if len(region) == 0 {
+		region = f.env("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+
+	target := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, awsURIEncode(key))
+	if endpoint := u.Query().Get("endpoint"); len(endpoint) > 0 {
+		target = fmt.Sprintf("%s/%s/%s", strings.TrimRight(endpoint, "/"), bucket, awsURIEncode(key))
+	}
+
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	accessKey, secretKey := f.env("AWS_ACCESS_KEY_ID"), f.env("AWS_SECRET_ACCESS_KEY")
+	if len(accessKey) > 0 && len(secretKey) > 0 {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+		signV4(req, accessKey, secretKey, f.env("AWS_SESSION_TOKEN"), region, "s3", f.now())
+	}
+	return req, nil
+}
+
+// signV4 signs a request without body using AWS Signature Version 4. The signature covers the host and all
+// X-Amz-* headers.
+func signV4(req *http.Request, accessKey, secretKey, sessionToken, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(sessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string{}, q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, strings.ReplaceAll(awsURIEncode(k), "/", "%2F")+"="+strings.ReplaceAll(awsURIEncode(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything except unreserved characters and slashes.
+func awsURIEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,32 @@
+package i18n
+
+import (
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/form"
+)
+
+// builtin contains the translations which ship with ORY Kratos. Operators can override them using AddDir.
+var builtin = map[string]map[string]string{
+	"de": {
+		form.ErrorIDFlowExpired:             "Deine Sitzung ist abgelaufen, bitte versuche es erneut.",
+		form.ErrorIDPasswordExpired:         "Dein Passwort ist abgelaufen, bitte wähle ein neues Passwort.",
+		form.ErrorIDVerificationCodeInvalid: "Der Bestätigungscode ist abgelaufen oder ungültig. Bitte fordere einen neuen Code an.",
+		form.ErrorIDRequired:                "Bitte fülle das Feld {{ .property }} aus.",
+		form.ErrorIDPasswordPolicyViolation: "Das Passwort erfüllt die Passwortrichtlinie nicht: {{ .reason }}",
+		form.ErrorIDInvalidCredentials:      "Die Zugangsdaten sind ungültig. Bitte prüfe Passwort, Benutzername, E-Mail-Adresse oder Telefonnummer auf Tippfehler.",
+		form.ErrorIDDuplicateCredentials:    "Es gibt bereits ein Konto mit dieser Kennung (E-Mail-Adresse, Telefonnummer, Benutzername, ...).",
+		form.ErrorIDRegistrationFailed:      "Die Registrierung konnte nicht abgeschlossen werden. Bitte prüfe deine Eingaben oder melde dich an, falls du bereits ein Konto hast.",
+		form.ErrorIDAccountLinkRequired:     "Es gibt bereits ein Konto mit der E-Mail-Adresse {{ .email }}. Gib das Passwort dieses Kontos oder den Code ein, den wir an diese Adresse gesendet haben, um {{ .provider }} damit zu verknüpfen.",
+		form.ErrorIDRegistrationDisabled:    "Die Registrierung ist deaktiviert. Bitte melde dich an, falls du bereits ein Konto hast.",
+		form.ErrorIDInvitationRequired:      "Die Registrierung ist nur mit einer Einladung möglich. Bitte verwende den Link aus deiner Einladung.",
+		form.ErrorIDApprovalPending:         "Dein Konto muss noch von einem Administrator freigegeben werden. Du erhältst eine E-Mail, sobald das geschehen ist.",
+		form.ErrorIDEmailDomainNotAllowed:   "E-Mail-Adressen der Domain {{ .domain }} können nicht verwendet werden.",
+		form.ErrorIDDisposableEmail:         "Wegwerf-E-Mail-Adressen wie die der Domain {{ .domain }} können nicht verwendet werden.",
+		form.ErrorIDIdentityDeactivated:     "Dein Konto wurde deaktiviert. Bitte wende dich an einen Administrator.",
+		form.ErrorIDMaintenanceMode:         "Wir führen gerade Wartungsarbeiten durch und können keine Änderungen speichern. Bitte versuche es später erneut.",
+		form.ErrorIDIdentityLocked:          "Dein Konto kann derzeit nicht geändert werden. Bitte wende dich an einen Administrator.",
+		form.ErrorIDRecoveryCodeInvalid:     "Der Wiederherstellungscode ist abgelaufen oder ungültig. Bitte fordere einen neuen Code an.",
+		form.ErrorIDRecoveryLinkInvalid:     "Der Wiederherstellungslink ist abgelaufen oder ungültig. Bitte fordere einen neuen Link an.",
+		identity.AlreadyRedeemedErrorID:     "Dieser Code wurde bereits verwendet. Bitte fordere einen neuen Code an.",
+	},
+}
@@ -0,0 +1,154 @@
+package i18n
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	CatalogProvider interface {
+		I18nCatalog() *Catalog
+	}
+
+	// Catalog contains the translations of flow messages. Messages are created in English, a catalog only
+	// needs to contain the messages which differ from that. Each translation is a text/template which is
+	// executed with the message's context, for example `{{ .property }}`.
+	Catalog struct {
+		defaultLocale string
+		messages      map[string]map[string]*template.Template
+	}
+)
+
+// NewCatalog returns a catalog containing the translations which ship with ORY Kratos.
+func NewCatalog(defaultLocale string) (*Catalog, error) {
+	c := &Catalog{
+		defaultLocale: normalize(defaultLocale),
+		messages:      map[string]map[string]*template.Template{},
+	}
+
+	for locale, messages := range builtin {
+		if err := c.Add(locale, messages); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Add adds the messages to the catalog of the locale. Existing translations are overridden.
+func (c *Catalog) Add(locale string, messages map[string]string) error {
+	locale = normalize(locale)
+	if len(locale) == 0 {
+		return errors.New("the locale of a message catalog must not be empty")
+	}
+
+	parsed := make(map[string]*template.Template, len(messages))
+	for id, message := range messages {
+		t, err := template.New(id).Option("missingkey=zero").Parse(message)
+		if err != nil {
+			return errors.Wrapf(err, "unable to parse message %s of locale %s", id, locale)
+		}
+		parsed[id] = t
+	}
+
+	if c.messages[locale] == nil {
+		c.messages[locale] = map[string]*template.Template{}
+	}
+	for id, t := range parsed {
+		c.messages[locale][id] = t
+	}
+
+	return nil
+}
+
+// AddDir adds all catalogs of the directory. Each catalog is a JSON file named after its locale, for example
+// `de.json` or `pt-BR.json`, which maps message IDs to translations.
+func (c *Catalog) AddDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return errors.Wrapf(err, "unable to decode message catalog %s", file)
+		}
+
+		if err := c.Add(strings.TrimSuffix(filepath.Base(file), ".json"), messages); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DefaultLocale returns the locale which is used if no catalog matches the user's preferences.
+func (c *Catalog) DefaultLocale() string {
+	return c.defaultLocale
+}
+
+// Locales returns all locales which can be negotiated, sorted alphabetically.
+func (c *Catalog) Locales() []string {
+	locales := []string{c.defaultLocale}
+	for locale := range c.messages {
+		if locale != c.defaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Translate returns the translation of the message to the locale. If the catalog has no translation for
+// the message, the fallback is returned.
+func (c *Catalog) Translate(locale, id, fallback string, context map[string]interface{}) string {
+	if len(id) == 0 {
+		return fallback
+	}
+
+	t, ok := c.lookup(locale, id)
+	if !ok {
+		return fallback
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, context); err != nil {
+		return fallback
+	}
+	return b.String()
+}
+
+func (c *Catalog) lookup(locale, id string) (*template.Template, bool) {
+	locale = normalize(locale)
+	if len(locale) == 0 {
+		locale = c.defaultLocale
+	}
+
+	for _, l := range []string{locale, base(locale)} {
+		if t, ok := c.messages[l][id]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func base(locale string) string {
+	return strings.SplitN(locale, "-", 2)[0]
+}
@@ -0,0 +1,113 @@
+package i18n
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/selfservice/form"
+)
+
+func TestCatalog(t *testing.T) {
+	c, err := NewCatalog("en")
+	require.NoError(t, err)
+	require.NoError(t, c.Add("fr", map[string]string{"greeting": "Bonjour {{ .name }}"}))
+
+	t.Run("method=Translate", func(t *testing.T) {
+		for k, tc := range []struct {
+			locale, id, expected string
+		}{
+			{locale: "fr", id: "greeting", expected: "Bonjour Alice"},
+			{locale: "fr-CA", id: "greeting", expected: "Bonjour Alice"},
+			{locale: "fr_ca", id: "greeting", expected: "Bonjour Alice"},
+			{locale: "en", id: "greeting", expected: "fallback"},
+			{locale: "", id: "greeting", expected: "fallback"},
+			{locale: "fr", id: "unknown", expected: "fallback"},
+			{locale: "fr", id: "", expected: "fallback"},
+			{locale: "de", id: form.ErrorIDRequired, expected: "Bitte fülle das Feld traits.email aus."},
+		} {
+			t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+				assert.Equal(t, tc.expected, c.Translate(tc.locale, tc.id, "fallback", map[string]interface{}{
+					"name":     "Alice",
+					"property": "traits.email",
+				}))
+			})
+		}
+	})
+
+	t.Run("method=Add", func(t *testing.T) {
+		assert.Error(t, c.Add("", map[string]string{"greeting": "Hello"}))
+		assert.Error(t, c.Add("es", map[string]string{"greeting": "Hola {{ .name"}))
+	})
+
+	t.Run("method=AddDir", func(t *testing.T) {
+		dir, err := ioutil.TempDir(os.TempDir(), "kratos-i18n-")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"greeting":"Hallo {{ .name }}"}`), 0600))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"greeting":"Hello {{ .name }}"}`), 0600))
+
+		c, err := NewCatalog("en")
+		require.NoError(t, err)
+		require.NoError(t, c.AddDir(dir))
+
+		assert.Equal(t, "Hallo Alice", c.Translate("de", "greeting", "", map[string]interface{}{"name": "Alice"}))
+		assert.Equal(t, "Hello Alice", c.Translate("en", "greeting", "", map[string]interface{}{"name": "Alice"}))
+
+		// Built-in translations are kept unless overridden.
+		assert.NotEmpty(t, c.Translate("de", form.ErrorIDFlowExpired, "", nil))
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "es.json"), []byte(`not json`), 0600))
+		assert.Error(t, c.AddDir(dir))
+	})
+
+	t.Run("method=Locales", func(t *testing.T) {
+		assert.Equal(t, []string{"de", "en", "fr"}, c.Locales())
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	c, err := NewCatalog("en")
+	require.NoError(t, err)
+	require.NoError(t, c.Add("pt-br", map[string]string{"greeting": "Olá"}))
+
+	for k, tc := range []struct {
+		query, header, expected string
+	}{
+		{expected: "en"},
+		{header: "de", expected: "de"},
+		{header: "de-AT,de;q=0.9", expected: "de"},
+		{header: "fr,de;q=0.5", expected: "de"},
+		{header: "en;q=0.4,de;q=0.8", expected: "de"},
+		{header: "de;q=0,en", expected: "en"},
+		{header: "pt", expected: "pt-br"},
+		{header: "pt-PT", expected: "pt-br"},
+		{header: "*", expected: "en"},
+		{header: "fr", expected: "en"},
+		{query: "de", header: "en", expected: "de"},
+		{query: "fr", header: "de", expected: "de"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+LocaleQueryParameter+"="+tc.query, nil)
+			if tc.header != "" {
+				r.Header.Set("Accept-Language", tc.header)
+			}
+			assert.Equal(t, tc.expected, c.Negotiate(r))
+		})
+	}
+
+	t.Run("method=WithLocale", func(t *testing.T) {
+		r, err := http.NewRequest("GET", "/", nil)
+		require.NoError(t, err)
+		assert.Empty(t, LocaleFromContext(r.Context()))
+		assert.Equal(t, "de", LocaleFromContext(WithLocale(r.Context(), "de")))
+	})
+}
@@ -0,0 +1,104 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocaleQueryParameter is the query parameter which overrides the Accept-Language header when a flow is
+// initialized.
+const LocaleQueryParameter = "locale"
+
+type contextKey int
+
+const localeContextKey contextKey = iota + 1
+
+// WithLocale returns a context carrying the locale, which is used for example to pick the language of emails.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeContextKey, locale)
+}
+
+// LocaleFromContext returns the locale of the context or an empty string if it has none.
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeContextKey).(string)
+	return locale
+}
+
+// Negotiate returns the locale of the catalog which matches the `locale` query parameter or, if that is not
+// set, the Accept-Language header best. If no locale matches, the default locale is returned.
+func (c *Catalog) Negotiate(r *http.Request) string {
+	preferred := parseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if locale := r.URL.Query().Get(LocaleQueryParameter); len(locale) > 0 {
+		preferred = append([]string{normalize(locale)}, preferred...)
+	}
+
+	supported := c.Locales()
+	for _, p := range preferred {
+		if p == "*" {
+			return c.defaultLocale
+		}
+
+		// Prefer an exact match, then the base language, then any region of the base language.
+		for _, s := range supported {
+			if s == p {
+				return s
+			}
+		}
+		for _, s := range supported {
+			if s == base(p) {
+				return s
+			}
+		}
+		for _, s := range supported {
+			if base(s) == base(p) {
+				return s
+			}
+		}
+	}
+
+	return c.defaultLocale
+}
+
+// parseAcceptLanguage returns the languages of the header ordered by their quality, highest first.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale  string
+		quality float64
+	}
+
+	var ws []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := normalize(fields[0])
+		if len(locale) == 0 {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if quality > 0 {
+			ws = append(ws, weighted{locale: locale, quality: quality})
+		}
+	}
+
+	sort.SliceStable(ws, func(i, j int) bool {
+		return ws[i].quality > ws[j].quality
+	})
+
+	locales := make([]string, len(ws))
+	for k, w := range ws {
+		locales[k] = w.locale
+	}
+	return locales
+}
@@ -0,0 +1,78 @@
+package idempotency
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+// MaxKeyLength is the maximum length of an idempotency key.
+const MaxKeyLength = 255
+
+// maxScopeLength is the maximum length of the scope of a record.
+const maxScopeLength = 128
+
+// Record is the stored result of an operation which was executed with an idempotency key. When the operation is
+// sent with the same key again, the stored result is returned instead of executing the operation again.
+type Record struct {
+	ID uuid.UUID `db:"id"`
+
+	// Scope is what the key applies to, for example "batch" for the operations of batch requests. Keys only need
+	// to be unique within their scope.
+	Scope string `db:"scope"`
+
+	Key string `db:"idempotency_key"`
+
+	// StatusCode is the HTTP status code of the result.
+	StatusCode int `db:"status_code"`
+
+	// Body is the JSON encoded result. It is empty while the request is in progress. Results may contain
+	// secrets, such as issued tokens, so the persister stores them encrypted.
+	Body string `db:"body"`
+
+	// BodyEncrypted is true if Body is stored encrypted. Records are always returned by the persister with the
+	// plaintext body.
+	BodyEncrypted bool `db:"body_encrypted"`
+
+	// RequestHash identifies the request the key was sent with. Sending the key with a different request fails.
+	RequestHash string `db:"request_hash"`
+
+	// Location is the Location header of the response, if any.
+	Location string `db:"location"`
+
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (r Record) TableName() string {
+	return "idempotency_records"
+}
+
+// NewRecord returns a record of the result of the operation with the given key.
+func NewRecord(scope, key string, statusCode int, body []byte) *Record {
+	return &Record{
+		ID:         x.NewUUID(),
+		Scope:      scope,
+		Key:        key,
+		StatusCode: statusCode,
+		Body:       string(body),
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+// InProgress returns true if the request the key was sent with has not been answered yet.
+func (r *Record) InProgress() bool {
+	return r.StatusCode == 0
+}
+
+// ValidateKey returns an error if the key is too long.
+func ValidateKey(key string) error {
+	if len(key) > MaxKeyLength {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The idempotency key must not be longer than %d characters.", MaxKeyLength))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// HeaderName is the request header which carries the idempotency key.
+	HeaderName = "Idempotency-Key"
+
+	// ReplayedHeaderName is set on responses which were stored for the idempotency key of the request.
+	ReplayedHeaderName = "Idempotent-Replayed"
+
+	// scopeAdmin is the scope of the idempotency keys sent to the admin API. If the admin API authenticates its
+	// callers, each caller has its own scope, see scope.
+	scopeAdmin = "admin"
+
+	// abandonAfter is the time after which a request which is still in progress is assumed to have been
+	// aborted, for example because the server was stopped. The key can be used again afterwards.
+	abandonAfter = time.Minute * 10
+)
+
+var (
+	ErrKeyInUse = herodot.DefaultError{
+		CodeField:   http.StatusConflict,
+		StatusField: http.StatusText(http.StatusConflict),
+		ErrorField:  "a request with this idempotency key is in progress",
+		ReasonField: "Wait for the other request to finish and send the request again.",
+	}
+	ErrKeyReused = herodot.DefaultError{
+		CodeField:   http.StatusUnprocessableEntity,
+		StatusField: http.StatusText(http.StatusUnprocessableEntity),
+		ErrorField:  "the idempotency key was used for a different request",
+		ReasonField: "Idempotency keys must be unique per request. Use a new key to send a different request.",
+	}
+)
+
+type (
+	middlewareDependencies interface {
+		PersistenceProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+
+	// Middleware makes the POST, PUT, and DELETE requests to the admin API idempotent if they carry an
+	// Idempotency-Key header. The response to the first request with a key is stored, and requests with the
+	// same key by the same caller receive that response without being executed again. Responses with a status
+	// code of 500 or higher are not stored, so that the request can be retried.
+	Middleware struct {
+		r middlewareDependencies
+	}
+
+	recorder struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+func NewMiddleware(r middlewareDependencies) *Middleware {
+	return &Middleware{r: r}
+}
+
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	key := r.Header.Get(HeaderName)
+	if len(key) == 0 || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete) {
+		next(w, r)
+		return
+	}
+
+	if err := ValidateKey(key); err != nil {
+		m.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		m.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to read the request body: %s", err)))
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	record, err := m.claim(r, key, hashRequest(r, body))
+	if err != nil {
+		m.r.Writer().WriteError(w, r, err)
+		return
+	} else if !record.InProgress() {
+		replay(w, record)
+		return
+	}
+
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	next(rec, r)
+
+	l := x.ContextLogger(r.Context(), m.r.Logger()).WithField("idempotency_key", key).WithField("status_code", rec.status)
+	if rec.status >= http.StatusInternalServerError {
+		if err := m.r.IdempotencyPersister().DeleteIdempotencyRecord(r.Context(), record.ID); err != nil {
+			l.WithError(err).Error("Unable to release the idempotency key of a failed request.")
+		}
+		return
+	}
+
+	record.StatusCode = rec.status
+	record.Body = rec.body.String()
+	record.Location = rec.Header().Get("Location")
+	if err := m.r.IdempotencyPersister().UpdateIdempotencyRecord(r.Context(), record); err != nil {
+		l.WithError(err).Error("Unable to store the response for the idempotency key.")
+	}
+}
+
+// claim stores a record for the key which marks the request as in progress. If the key was claimed before,
+// the stored record is returned instead.
+func (m *Middleware) claim(r *http.Request, key, hash string) (*Record, error) {
+	// The key is claimed again if the other record is deleted in the meantime, but only a few times.
+	scope := scope(r)
+	for attempt := 0; attempt < 3; attempt++ {
+		record := NewRecord(scope, key, 0, nil)
+		record.RequestHash = hash
+		err := m.r.IdempotencyPersister().CreateIdempotencyRecord(r.Context(), record)
+		if err == nil {
+			return record, nil
+		} else if errorsx.Cause(err) != sqlcon.ErrUniqueViolation {
+			return nil, err
+		}
+
+		existing, err := m.r.IdempotencyPersister().GetIdempotencyRecord(r.Context(), scope, key)
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(existing.RequestHash) > 0 && existing.RequestHash != hash {
+			return nil, errors.WithStack(&ErrKeyReused)
+		}
+
+		if existing.InProgress() {
+			if time.Since(existing.CreatedAt) < abandonAfter {
+				return nil, errors.WithStack(&ErrKeyInUse)
+			}
+
+			if err := m.r.IdempotencyPersister().DeleteIdempotencyRecord(r.Context(), existing.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return existing, nil
+	}
+	return nil, errors.WithStack(&ErrKeyInUse)
+}
+
+// scope returns the scope of the idempotency keys of the caller, so that callers can neither replay the responses
+// to each other's requests nor block each other's keys.
+func scope(r *http.Request) string {
+	principal := x.AdminPrincipal(r.Context())
+	if len(principal) == 0 {
+		return scopeAdmin
+	}
+
+	// Scopes are limited in length, while client certificate names are not.
+	if s := scopeAdmin + ":" + principal; len(s) <= maxScopeLength {
+		return s
+	}
+	sum := sha256.Sum256([]byte(principal))
+	return scopeAdmin + ":" + hex.EncodeToString(sum[:])
+}
+
+// hashRequest identifies the request by its method, URL, and body.
+func hashRequest(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, record *Record) {
+	if len(record.Location) > 0 {
+		w.Header().Set("Location", record.Location)
+	}
+	if len(record.Body) > 0 {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.Header().Set(ReplayedHeaderName, "true")
+	w.WriteHeader(record.StatusCode)
+	_, _ = w.Write([]byte(record.Body))
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	_, _ = r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,134 @@
+package idempotency_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/negroni"
+
+	. "github.com/ory/kratos/idempotency"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/x"
+)
+
+func TestMiddleware(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	var calls int
+	status := http.StatusCreated
+	// The admin API authenticates its callers before the middleware runs.
+	n := negroni.New(negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if principal := r.Header.Get("X-Principal"); len(principal) > 0 {
+			r = r.WithContext(x.WithAdminPrincipal(r.Context(), principal))
+		}
+		next(w, r)
+	}), NewMiddleware(reg))
+	n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Location", "http://localhost/identities/1")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	})
+	ts := httptest.NewServer(n)
+	defer ts.Close()
+
+	sendAs := func(t *testing.T, principal, method, key, body string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+"/identities", strings.NewReader(body))
+		require.NoError(t, err)
+		if len(key) > 0 {
+			req.Header.Set(HeaderName, key)
+		}
+		if len(principal) > 0 {
+			req.Header.Set("X-Principal", principal)
+		}
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	send := func(t *testing.T, method, key, body string) *http.Response {
+		return sendAs(t, "", method, key, body)
+	}
+
+	read := func(t *testing.T, res *http.Response) string {
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("case=executes requests with the same key once", func(t *testing.T) {
+		calls = 0
+		first := send(t, "POST", "create-once", `{"traits":{}}`)
+		assert.Equal(t, http.StatusCreated, first.StatusCode)
+		assert.Empty(t, first.Header.Get(ReplayedHeaderName))
+		assert.Equal(t, `{"traits":{}}`, read(t, first))
+
+		second := send(t, "POST", "create-once", `{"traits":{}}`)
+		assert.Equal(t, http.StatusCreated, second.StatusCode)
+		assert.Equal(t, "true", second.Header.Get(ReplayedHeaderName))
+		assert.Equal(t, "http://localhost/identities/1", second.Header.Get("Location"))
+		assert.Equal(t, `{"traits":{}}`, read(t, second))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("case=rejects keys sent with a different request", func(t *testing.T) {
+		read(t, send(t, "POST", "create-different", `{"traits":{}}`))
+
+		res := send(t, "POST", "create-different", `{"traits":{"email":"foo@ory.sh"}}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode, "%s", read(t, res))
+		res = send(t, "DELETE", "create-different", `{"traits":{}}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode, "%s", read(t, res))
+	})
+
+	t.Run("case=scopes keys to the caller", func(t *testing.T) {
+		calls = 0
+		read(t, sendAs(t, "api_key:provisioner", "POST", "create-scoped", `{"traits":{}}`))
+
+		res := sendAs(t, "api_key:other", "POST", "create-scoped", `{"traits":{}}`)
+		assert.Empty(t, res.Header.Get(ReplayedHeaderName), "callers must not receive the responses of other callers")
+		read(t, res)
+
+		res = sendAs(t, "api_key:provisioner", "POST", "create-scoped", `{"traits":{}}`)
+		assert.Equal(t, "true", res.Header.Get(ReplayedHeaderName))
+		read(t, res)
+		assert.Equal(t, 2, calls)
+
+		res = sendAs(t, "client_certificate:"+strings.Repeat("a", 200), "POST", "create-scoped", `{"traits":{}}`)
+		assert.Equal(t, http.StatusCreated, res.StatusCode, "%s", read(t, res))
+	})
+
+	t.Run("case=does not store server errors", func(t *testing.T) {
+		calls = 0
+		status = http.StatusInternalServerError
+		res := send(t, "POST", "create-retry", `{}`)
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "%s", read(t, res))
+
+		status = http.StatusCreated
+		res = send(t, "POST", "create-retry", `{}`)
+		assert.Equal(t, http.StatusCreated, res.StatusCode, "%s", read(t, res))
+		assert.Empty(t, res.Header.Get(ReplayedHeaderName))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("case=ignores requests without key and safe requests", func(t *testing.T) {
+		calls = 0
+		read(t, send(t, "POST", "", `{}`))
+		read(t, send(t, "POST", "", `{}`))
+		read(t, send(t, "GET", "get", ``))
+		read(t, send(t, "GET", "get", ``))
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("case=rejects keys which are too long", func(t *testing.T) {
+		res := send(t, "POST", strings.Repeat("a", MaxKeyLength+1), `{}`)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "%s", read(t, res))
+	})
+}
@@ -0,0 +1,101 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/sqlcon"
+)
+
+type (
+	PersistenceProvider interface {
+		IdempotencyPersister() Persister
+	}
+	Persister interface {
+		// CreateIdempotencyRecord stores the record. It fails with sqlcon.ErrUniqueViolation if a record with the
+		// same scope and key exists.
+		CreateIdempotencyRecord(ctx context.Context, r *Record) error
+
+		// GetIdempotencyRecord returns the record with the given scope and key.
+		GetIdempotencyRecord(ctx context.Context, scope, key string) (*Record, error)
+
+		// UpdateIdempotencyRecord stores the result of the request.
+		UpdateIdempotencyRecord(ctx context.Context, r *Record) error
+
+		// DeleteIdempotencyRecord deletes the record so that the key can be used again.
+		DeleteIdempotencyRecord(ctx context.Context, id uuid.UUID) error
+
+		// DeleteExpiredIdempotencyRecords deletes the records created before the given time and returns their number.
+		DeleteExpiredIdempotencyRecords(ctx context.Context, createdBefore time.Time) (int, error)
+	}
+)
+
+func TestPersister(p Persister) func(t *testing.T) {
+	return func(t *testing.T) {
+		_, err := p.GetIdempotencyRecord(context.Background(), "batch", "does-not-exist")
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+
+		expected := NewRecord("batch", "create-1", 201, []byte(`{"identity":{}}`))
+		require.NoError(t, p.CreateIdempotencyRecord(context.Background(), expected))
+
+		actual, err := p.GetIdempotencyRecord(context.Background(), "batch", "create-1")
+		require.NoError(t, err)
+		assert.Equal(t, expected.ID, actual.ID)
+		assert.Equal(t, 201, actual.StatusCode)
+		assert.JSONEq(t, `{"identity":{}}`, actual.Body)
+
+		_, err = p.GetIdempotencyRecord(context.Background(), "other", "create-1")
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err), "keys are scoped")
+
+		assert.Equal(t, sqlcon.ErrUniqueViolation, errors.Cause(p.CreateIdempotencyRecord(context.Background(), NewRecord("batch", "create-1", 200, []byte(`{}`)))))
+		require.NoError(t, p.CreateIdempotencyRecord(context.Background(), NewRecord("other", "create-1", 200, []byte(`{}`))))
+
+		t.Run("case=stores the result of requests in progress", func(t *testing.T) {
+			r := NewRecord("admin", "in-progress", 0, nil)
+			r.RequestHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+			require.NoError(t, p.CreateIdempotencyRecord(context.Background(), r))
+
+			actual, err := p.GetIdempotencyRecord(context.Background(), "admin", "in-progress")
+			require.NoError(t, err)
+			assert.True(t, actual.InProgress())
+			assert.Equal(t, r.RequestHash, actual.RequestHash)
+
+			r.StatusCode = 201
+			r.Body = `{"id":"foo"}`
+			r.Location = "http://localhost/identities/foo"
+			require.NoError(t, p.UpdateIdempotencyRecord(context.Background(), r))
+
+			actual, err = p.GetIdempotencyRecord(context.Background(), "admin", "in-progress")
+			require.NoError(t, err)
+			assert.False(t, actual.InProgress())
+			assert.JSONEq(t, `{"id":"foo"}`, actual.Body)
+			assert.Equal(t, r.Location, actual.Location)
+
+			require.NoError(t, p.DeleteIdempotencyRecord(context.Background(), r.ID))
+			_, err = p.GetIdempotencyRecord(context.Background(), "admin", "in-progress")
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.UpdateIdempotencyRecord(context.Background(), r)))
+		})
+
+		t.Run("case=deletes expired records", func(t *testing.T) {
+			expired := NewRecord("admin", "expired", 204, nil)
+			expired.CreatedAt = time.Now().UTC().Add(-time.Hour * 48)
+			require.NoError(t, p.CreateIdempotencyRecord(context.Background(), expired))
+
+			count, err := p.DeleteExpiredIdempotencyRecords(context.Background(), time.Now().UTC().Add(-time.Hour*24))
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+
+			_, err = p.GetIdempotencyRecord(context.Background(), "admin", "expired")
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+			_, err = p.GetIdempotencyRecord(context.Background(), "batch", "create-1")
+			require.NoError(t, err)
+		})
+	}
+}
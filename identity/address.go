@@ -1,6 +1,7 @@
 package identity
 
 import (
+	"regexp"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -11,6 +12,9 @@ import (
 
 const (
 	VerifiableAddressTypeEmail VerifiableAddressType = "email"
+	// VerifiableAddressTypeSMS is a phone number in the E.164 format, for example +4917612345678, to which codes
+	// and links are sent by text message.
+	VerifiableAddressTypeSMS VerifiableAddressType = "sms"
 
 	VerifiableAddressStatusPending   VerifiableAddressStatus = "pending"
 	VerifiableAddressStatusCompleted VerifiableAddressStatus = "completed"
@@ -63,10 +67,20 @@ func (v VerifiableAddressType) HTMLFormInputType() string {
 	switch v {
 	case VerifiableAddressTypeEmail:
 		return "email"
+	case VerifiableAddressTypeSMS:
+		return "tel"
 	}
 	return ""
 }
 
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// IsPhoneNumber returns true if the value is a phone number in the E.164 format. Phone numbers have to be stored in
+// this format, so that a number entered to receive a text message matches the stored one.
+func IsPhoneNumber(value string) bool {
+	return phoneNumberPattern.MatchString(value)
+}
+
 func (a VerifiableAddress) TableName() string {
 	return "identity_verifiable_addresses"
 }
@@ -83,6 +97,23 @@ func NewVerifiableEmailAddress(
 	value string,
 	identity uuid.UUID,
 	expiresIn time.Duration,
+) (*VerifiableAddress, error) {
+	return newVerifiableAddress(VerifiableAddressTypeEmail, value, identity, expiresIn)
+}
+
+func NewVerifiableSMSAddress(
+	value string,
+	identity uuid.UUID,
+	expiresIn time.Duration,
+) (*VerifiableAddress, error) {
+	return newVerifiableAddress(VerifiableAddressTypeSMS, value, identity, expiresIn)
+}
+
+func newVerifiableAddress(
+	via VerifiableAddressType,
+	value string,
+	identity uuid.UUID,
+	expiresIn time.Duration,
 ) (*VerifiableAddress, error) {
 	code, err := NewVerifyCode()
 	if err != nil {
@@ -94,7 +125,7 @@ func NewVerifiableEmailAddress(
 		Value:      value,
 		Verified:   false,
 		Status:     VerifiableAddressStatusPending,
-		Via:        VerifiableAddressTypeEmail,
+		Via:        via,
 		ExpiresAt:  time.Now().Add(expiresIn).UTC(),
 		IdentityID: identity,
 	}, nil
@@ -28,3 +28,19 @@ func TestNewVerifiableEmailAddress(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotContains(t, out, a.Code)
 }
+
+func TestIsPhoneNumber(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		valid bool
+	}{
+		{value: "+4917612345678", valid: true},
+		{value: "+15555550100", valid: true},
+		{value: "4917612345678"},
+		{value: "+0917612345678"},
+		{value: "+49 176 12345678"},
+		{value: "+49176123456789012"},
+	} {
+		assert.Equal(t, tc.valid, IsPhoneNumber(tc.value), tc.value)
+	}
+}
@@ -1,8 +1,12 @@
 package identity
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -15,6 +19,21 @@ type CredentialsType string
 const (
 	CredentialsTypePassword CredentialsType = "password"
 	CredentialsTypeOIDC     CredentialsType = "oidc"
+
+	// CredentialsTypeCrossDevice is used for logins which were approved from another device. It has no
+	// credentials of its own.
+	CredentialsTypeCrossDevice CredentialsType = "cross_device"
+
+	// CredentialsTypePush contains the devices which approve logins using push notifications.
+	CredentialsTypePush CredentialsType = "push"
+
+	// CredentialsTypeEmailCode is used for codes which are sent to the verified email addresses of an identity
+	// as a second factor. It has no credentials of its own.
+	CredentialsTypeEmailCode CredentialsType = "email_code"
+
+	// CredentialsTypeDevice is used for devices which were signed in using the device authorization flow. It has
+	// no credentials of its own.
+	CredentialsTypeDevice CredentialsType = "device"
 )
 
 type (
@@ -50,6 +69,13 @@ type (
 		Identifier string    `db:"identifier"`
 		// IdentityCredentialsID is a helper struct field for gobuffalo.pop.
 		IdentityCredentialsID uuid.UUID `json:"-" db:"identity_credential_id"`
+		// IdentityID and CredentialsTypeID are copied from the credentials, so that identifiers are resolved
+		// without joining the credentials.
+		IdentityID        uuid.UUID `json:"-" db:"identity_id"`
+		CredentialsTypeID uuid.UUID `json:"-" db:"identity_credential_type_id"`
+		// NormalizedIdentifier is the identifier in lower case. It is indexed, so that identifiers are looked up
+		// case-insensitively on all databases.
+		NormalizedIdentifier string `json:"-" db:"normalized_identifier"`
 		// CreatedAt is a helper struct field for gobuffalo.pop.
 		CreatedAt time.Time `json:"-" db:"created_at"`
 		// UpdatedAt is a helper struct field for gobuffalo.pop.
@@ -89,6 +115,15 @@ func (c CredentialIdentifier) TableName() string {
 	return "identity_credential_identifiers"
 }
 
+// NormalizeIdentifier returns the identifier as it is stored for the credentials type. Email addresses used as
+// password identifiers are case-insensitive and stored in lower case.
+func NormalizeIdentifier(ct CredentialsType, identifier string) string {
+	if ct == CredentialsTypePassword && strings.Contains(identifier, "@") {
+		return strings.ToLower(identifier)
+	}
+	return identifier
+}
+
 func CredentialsEqual(a, b map[CredentialsType]Credentials) bool {
 	if len(a) != len(b) {
 		return false
@@ -108,10 +143,58 @@ func CredentialsEqual(a, b map[CredentialsType]Credentials) bool {
 			return false
 		}
 
-		if !reflect.DeepEqual(expect.Identifiers, actual.Identifiers) {
+		// The order of the identifiers depends on the order in which the schema was validated.
+		if !reflect.DeepEqual(sortedIdentifiers(expect.Identifiers), sortedIdentifiers(actual.Identifiers)) {
 			return false
 		}
 	}
 
 	return true
 }
+
+func sortedIdentifiers(identifiers []string) []string {
+	sorted := append([]string{}, identifiers...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// CredentialsFingerprint returns a hash of the credentials which changes whenever credentials are added, removed, or
+// changed, for example when the password is changed. The config of OpenID Connect credentials is left out because
+// it contains the tokens of the provider, which change with every login. Their identifiers still name the linked
+// accounts.
+func CredentialsFingerprint(cs map[CredentialsType]Credentials) string {
+	types := make([]string, 0, len(cs))
+	for t := range cs {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	h := sha256.New()
+	for _, t := range types {
+		c := cs[CredentialsType(t)]
+		identifiers := append([]string{}, c.Identifiers...)
+		sort.Strings(identifiers)
+
+		_, _ = h.Write([]byte(t + "\n" + strings.Join(identifiers, "\n") + "\n"))
+		if CredentialsType(t) != CredentialsTypeOIDC {
+			_, _ = h.Write(canonicalJSON(c.Config))
+		}
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// canonicalJSON returns the JSON document with sorted keys and without whitespace, so that documents which were
+// stored by databases which reformat JSON are compared by their content.
+func canonicalJSON(raw json.RawMessage) []byte {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return out
+}
@@ -8,6 +8,12 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func TestNormalizeIdentifier(t *testing.T) {
+	assert.Equal(t, "foo@ory.sh", NormalizeIdentifier(CredentialsTypePassword, "Foo@ORY.sh"))
+	assert.Equal(t, "FooBar", NormalizeIdentifier(CredentialsTypePassword, "FooBar"))
+	assert.Equal(t, "google:Foo@ORY.sh", NormalizeIdentifier(CredentialsTypeOIDC, "google:Foo@ORY.sh"))
+}
+
 func TestCredentialsEqual(t *testing.T) {
 	original := map[CredentialsType]Credentials{
 		"foo": {Type: "foo", Identifiers: []string{"bar"}, Config: json.RawMessage(`{"foo":"bar"}`)},
@@ -17,4 +23,38 @@ func TestCredentialsEqual(t *testing.T) {
 	assert.EqualValues(t, original, derived)
 	derived["foo"].Identifiers[0] = "baz"
 	assert.NotEqual(t, original, derived)
+
+	a := map[CredentialsType]Credentials{"foo": {Identifiers: []string{"bar", "baz"}, Config: json.RawMessage(`{}`)}}
+	b := map[CredentialsType]Credentials{"foo": {Identifiers: []string{"baz", "bar"}, Config: json.RawMessage(`{}`)}}
+	assert.True(t, CredentialsEqual(a, b), "the order of identifiers does not matter")
+	b["foo"] = Credentials{Identifiers: []string{"baz"}, Config: json.RawMessage(`{}`)}
+	assert.False(t, CredentialsEqual(a, b))
+}
+
+func TestCredentialsFingerprint(t *testing.T) {
+	original := map[CredentialsType]Credentials{
+		CredentialsTypePassword: {Type: CredentialsTypePassword, Identifiers: []string{"foo", "bar"}, Config: json.RawMessage(`{"hashed_password":"foo","changed":1}`)},
+		CredentialsTypeOIDC:     {Type: CredentialsTypeOIDC, Identifiers: []string{"google:1"}, Config: json.RawMessage(`[{"provider":"google","id_token":"a"}]`)},
+	}
+	fingerprint := CredentialsFingerprint(original)
+
+	reformatted := deepcopy.Copy(original).(map[CredentialsType]Credentials)
+	reformatted[CredentialsTypePassword] = Credentials{Type: CredentialsTypePassword, Identifiers: []string{"bar", "foo"}, Config: json.RawMessage(`{ "changed": 1, "hashed_password": "foo" }`)}
+	assert.Equal(t, fingerprint, CredentialsFingerprint(reformatted), "the order of identifiers and the JSON formatting do not matter")
+
+	refreshed := deepcopy.Copy(original).(map[CredentialsType]Credentials)
+	refreshed[CredentialsTypeOIDC] = Credentials{Type: CredentialsTypeOIDC, Identifiers: []string{"google:1"}, Config: json.RawMessage(`[{"provider":"google","id_token":"b"}]`)}
+	assert.Equal(t, fingerprint, CredentialsFingerprint(refreshed), "new OpenID Connect tokens do not change the credentials")
+
+	changed := deepcopy.Copy(original).(map[CredentialsType]Credentials)
+	changed[CredentialsTypePassword] = Credentials{Type: CredentialsTypePassword, Identifiers: []string{"foo", "bar"}, Config: json.RawMessage(`{"hashed_password":"bar","changed":1}`)}
+	assert.NotEqual(t, fingerprint, CredentialsFingerprint(changed))
+
+	linked := deepcopy.Copy(original).(map[CredentialsType]Credentials)
+	linked[CredentialsTypeOIDC] = Credentials{Type: CredentialsTypeOIDC, Identifiers: []string{"google:1", "github:2"}, Config: json.RawMessage(`[]`)}
+	assert.NotEqual(t, fingerprint, CredentialsFingerprint(linked))
+
+	removed := deepcopy.Copy(original).(map[CredentialsType]Credentials)
+	delete(removed, CredentialsTypeOIDC)
+	assert.NotEqual(t, fingerprint, CredentialsFingerprint(removed))
 }
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/fetcher"
+)
+
+type (
+	TraitsDeriverProvider interface {
+		IdentityTraitsDeriver() *TraitsDeriver
+	}
+	// TraitsDeriver computes the derived traits of identities using the Jsonnet snippet configured at
+	// identity.traits.derived_mapper_url. The snippet receives the identity without its credentials as
+	// `std.extVar('identity')` and returns an object, for example:
+	//
+	//	local identity = std.extVar('identity');
+	//	{
+	//	  full_name: identity.traits.name.first + ' ' + identity.traits.name.last,
+	//	  email: std.asciiLower(identity.traits.email),
+	//	}
+	//
+	// Derived traits are computed whenever an identity is returned by the API and are never stored.
+	TraitsDeriver struct {
+		c configuration.Provider
+	}
+)
+
+func NewTraitsDeriver(c configuration.Provider) *TraitsDeriver {
+	return &TraitsDeriver{c: c}
+}
+
+// Derive sets the derived traits of the identity. It does nothing if no mapper is configured.
+func (d *TraitsDeriver) Derive(ctx context.Context, i *Identity) error {
+	mapper := d.c.IdentityTraitsDerivedMapperURL()
+	if len(mapper) == 0 {
+		return nil
+	}
+
+	snippet, err := fetcher.Default.Fetch(ctx, mapper)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to load the Jsonnet snippet which derives traits: %s", err))
+	}
+
+	in := i.CopyWithoutCredentials()
+	in.DerivedTraits = nil
+	encoded, err := json.Marshal(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.ExtCode("identity", string(encoded))
+	evaluated, err := vm.EvaluateSnippet(mapper, string(snippet))
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to evaluate the Jsonnet snippet which derives traits: %s", err))
+	}
+
+	var derived map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(evaluated), &derived); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The Jsonnet snippet which derives traits must return an object: %s", err))
+	}
+
+	i.DerivedTraits = json.RawMessage(evaluated)
+	return nil
+}
+
+// DeriveAll sets the derived traits of all identities, see Derive.
+func (d *TraitsDeriver) DeriveAll(ctx context.Context, is []Identity) error {
+	for k := range is {
+		if err := d.Derive(ctx, &is[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package identity_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+)
+
+func TestTraitsDeriver(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	snippet := func(s string) string {
+		return "base64://" + base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	newIdentity := func() *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(`{"name":{"first":"Ada","last":"Lovelace"},"email":"Ada@Example.org"}`)
+		return i
+	}
+
+	t.Run("case=no mapper configured", func(t *testing.T) {
+		i := newIdentity()
+		require.NoError(t, reg.IdentityTraitsDeriver().Derive(context.Background(), i))
+		assert.Nil(t, i.DerivedTraits)
+	})
+
+	t.Run("case=derives traits", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, snippet(`
+local identity = std.extVar('identity');
+{
+  full_name: identity.traits.name.first + ' ' + identity.traits.name.last,
+  email: std.asciiLower(identity.traits.email),
+  schema: identity.traits_schema_id,
+}`))
+		defer viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, "")
+
+		i := newIdentity()
+		require.NoError(t, reg.IdentityTraitsDeriver().Derive(context.Background(), i))
+		assert.JSONEq(t, `{"full_name":"Ada Lovelace","email":"ada@example.org","schema":"default"}`, string(i.DerivedTraits))
+		assert.JSONEq(t, `{"name":{"first":"Ada","last":"Lovelace"},"email":"Ada@Example.org"}`, string(i.Traits), "the traits are not changed")
+	})
+
+	t.Run("case=snippet must return an object", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, snippet(`"not an object"`))
+		defer viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, "")
+
+		assert.Error(t, reg.IdentityTraitsDeriver().Derive(context.Background(), newIdentity()))
+	})
+
+	t.Run("case=invalid snippet", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, snippet(`{ foo: std.extVar('identity').traits.does_not_exist.bar }`))
+		defer viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, "")
+
+		assert.Error(t, reg.IdentityTraitsDeriver().Derive(context.Background(), newIdentity()))
+	})
+}
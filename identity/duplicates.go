@@ -0,0 +1,303 @@
+package identity
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	DuplicateReasonEmail DuplicateReason = "email"
+	DuplicateReasonPhone DuplicateReason = "phone"
+	DuplicateReasonName  DuplicateReason = "name"
+
+	// minPhoneDigits is the number of digits a phone number needs to be compared. Shorter values are more likely
+	// extensions or placeholders than phone numbers.
+	minPhoneDigits = 6
+
+	// minNameWords is the number of words a name needs to be compared. Many people share a first name.
+	minNameWords = 2
+)
+
+type (
+	// DuplicateReason tells which data probable duplicates share.
+	DuplicateReason string
+
+	// DuplicateMatch is data probable duplicates share.
+	//
+	// swagger:model identityDuplicateMatch
+	DuplicateMatch struct {
+		// Reason is `email`, `phone`, or `name`.
+		//
+		// required: true
+		Reason DuplicateReason `json:"reason"`
+
+		// Value is the normalized value the identities share, for example `foo@ory.sh` for `Foo+news@ORY.sh`.
+		//
+		// required: true
+		Value string `json:"value"`
+	}
+
+	// DuplicateMergeSuggestion is a merge which resolves probable duplicates.
+	//
+	// swagger:model identityDuplicateMergeSuggestion
+	DuplicateMergeSuggestion struct {
+		// TargetID is the ID of the identity the other one is merged into.
+		//
+		// required: true
+		TargetID uuid.UUID `json:"target_id"`
+
+		// Payload is the body of the request to `POST /identities/{target_id}/merge`.
+		//
+		// required: true
+		Payload MergePayload `json:"payload"`
+	}
+
+	// Duplicates are identities which probably belong to the same person.
+	//
+	// swagger:model identityDuplicates
+	Duplicates struct {
+		// IdentityIDs are the IDs of the probable duplicates.
+		//
+		// required: true
+		IdentityIDs []uuid.UUID `json:"identity_ids"`
+
+		// Matches is the data all of these identities share.
+		//
+		// required: true
+		Matches []DuplicateMatch `json:"matches"`
+
+		// MergeSuggestions merge all identities into the one with the most verified addresses, or the oldest one.
+		// They use the `fail` conflict policy, so that no data is lost without a decision.
+		//
+		// required: true
+		MergeSuggestions []DuplicateMergeSuggestion `json:"merge_suggestions"`
+	}
+
+	// DuplicateTraits are the paths of the traits which are compared to find duplicates, in GJSON syntax. Empty
+	// paths are not compared.
+	DuplicateTraits struct {
+		Email string
+		Phone string
+		Name  string
+	}
+
+	// DuplicateDetector finds identities which probably belong to the same person. It keeps the normalized values of
+	// all identities added to it in memory, but not the identities.
+	DuplicateDetector struct {
+		traits     DuplicateTraits
+		candidates map[uuid.UUID]duplicateCandidate
+		matches    map[DuplicateMatch][]uuid.UUID
+	}
+
+	duplicateCandidate struct {
+		verified  int
+		createdAt time.Time
+	}
+)
+
+func NewDuplicateDetector(traits DuplicateTraits) *DuplicateDetector {
+	return &DuplicateDetector{
+		traits:     traits,
+		candidates: map[uuid.UUID]duplicateCandidate{},
+		matches:    map[DuplicateMatch][]uuid.UUID{},
+	}
+}
+
+// Add compares the identity to the ones added before. Email addresses are taken from the verifiable addresses and
+// the email trait.
+func (d *DuplicateDetector) Add(i *Identity) {
+	c := duplicateCandidate{createdAt: i.CreatedAt}
+
+	emails := traitStrings(i.Traits, d.traits.Email)
+	for _, a := range i.Addresses {
+		if a.Via == VerifiableAddressTypeEmail {
+			emails = append(emails, a.Value)
+		}
+		if a.Verified {
+			c.verified++
+		}
+	}
+	d.candidates[i.ID] = c
+
+	for _, email := range emails {
+		d.match(i.ID, DuplicateReasonEmail, NormalizeDuplicateEmail(email))
+	}
+
+	for _, phone := range traitStrings(i.Traits, d.traits.Phone) {
+		d.match(i.ID, DuplicateReasonPhone, NormalizeDuplicatePhone(phone))
+	}
+
+	if len(d.traits.Name) > 0 {
+		var parts []string
+		collectStrings(gjson.GetBytes(i.Traits, d.traits.Name), &parts)
+		d.match(i.ID, DuplicateReasonName, NormalizeDuplicateName(strings.Join(parts, " ")))
+	}
+}
+
+func (d *DuplicateDetector) match(id uuid.UUID, reason DuplicateReason, value string) {
+	if len(value) == 0 {
+		return
+	}
+
+	m := DuplicateMatch{Reason: reason, Value: value}
+	for _, existing := range d.matches[m] {
+		if existing == id {
+			return
+		}
+	}
+	d.matches[m] = append(d.matches[m], id)
+}
+
+// Report returns the probable duplicates. Identities which share several values, for example an email address and
+// a name, are reported once with all matches. Duplicates with the most matches come first.
+func (d *DuplicateDetector) Report() []Duplicates {
+	byIDs := map[string]*Duplicates{}
+	for m, ids := range d.matches {
+		if len(ids) < 2 {
+			continue
+		}
+
+		ids = append([]uuid.UUID{}, ids...)
+		sort.Slice(ids, func(a, b int) bool { return ids[a].String() < ids[b].String() })
+		key := joinIDs(ids)
+
+		if dd, ok := byIDs[key]; ok {
+			dd.Matches = append(dd.Matches, m)
+			continue
+		}
+		byIDs[key] = &Duplicates{IdentityIDs: ids, Matches: []DuplicateMatch{m}}
+	}
+
+	report := make([]Duplicates, 0, len(byIDs))
+	for _, dd := range byIDs {
+		sort.Slice(dd.Matches, func(a, b int) bool {
+			if dd.Matches[a].Reason != dd.Matches[b].Reason {
+				return dd.Matches[a].Reason < dd.Matches[b].Reason
+			}
+			return dd.Matches[a].Value < dd.Matches[b].Value
+		})
+		dd.MergeSuggestions = d.suggest(dd.IdentityIDs)
+		report = append(report, *dd)
+	}
+
+	sort.Slice(report, func(a, b int) bool {
+		if len(report[a].Matches) != len(report[b].Matches) {
+			return len(report[a].Matches) > len(report[b].Matches)
+		}
+		return joinIDs(report[a].IdentityIDs) < joinIDs(report[b].IdentityIDs)
+	})
+	return report
+}
+
+func (d *DuplicateDetector) suggest(ids []uuid.UUID) []DuplicateMergeSuggestion {
+	target := ids[0]
+	for _, id := range ids[1:] {
+		t, c := d.candidates[target], d.candidates[id]
+		if c.verified > t.verified || (c.verified == t.verified && c.createdAt.Before(t.createdAt)) {
+			target = id
+		}
+	}
+
+	suggestions := make([]DuplicateMergeSuggestion, 0, len(ids)-1)
+	for _, id := range ids {
+		if id == target {
+			continue
+		}
+		suggestions = append(suggestions, DuplicateMergeSuggestion{
+			TargetID: target,
+			Payload:  MergePayload{SourceID: id, ConflictPolicy: MergeConflictPolicyFail},
+		})
+	}
+	return suggestions
+}
+
+func joinIDs(ids []uuid.UUID) string {
+	s := make([]string, len(ids))
+	for k, id := range ids {
+		s[k] = id.String()
+	}
+	return strings.Join(s, ",")
+}
+
+// NormalizeDuplicateEmail returns the email address in lower case and without the sub-address, so that
+// `Foo+news@ORY.sh` and `foo@ory.sh` match. It returns an empty string if the value is not an email address.
+func NormalizeDuplicateEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		return ""
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	return local + "@" + domain
+}
+
+// NormalizeDuplicatePhone returns the digits of the phone number, without the international call prefix `00`, so
+// that `+49 170 1234567` and `0049-170-1234567` match. It returns an empty string if the number is too short.
+func NormalizeDuplicatePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+
+	normalized := strings.TrimPrefix(digits.String(), "00")
+	if len(normalized) < minPhoneDigits {
+		return ""
+	}
+	return normalized
+}
+
+// NormalizeDuplicateName returns the words of the name in lower case and alphabetical order, so that `Doe, John`
+// and `john doe` match. It returns an empty string if the name has less than two words.
+func NormalizeDuplicateName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < minNameWords {
+		return ""
+	}
+
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+func traitStrings(traits Traits, path string) []string {
+	if len(path) == 0 {
+		return nil
+	}
+
+	var values []string
+	res := gjson.GetBytes(traits, path)
+	if res.IsArray() {
+		for _, v := range res.Array() {
+			if v.Type == gjson.String {
+				values = append(values, v.String())
+			}
+		}
+	} else if res.Type == gjson.String {
+		values = append(values, res.String())
+	}
+	return values
+}
+
+func collectStrings(res gjson.Result, values *[]string) {
+	switch {
+	case res.IsObject() || res.IsArray():
+		res.ForEach(func(_, v gjson.Result) bool {
+			collectStrings(v, values)
+			return true
+		})
+	case res.Type == gjson.String:
+		*values = append(*values, res.String())
+	}
+}
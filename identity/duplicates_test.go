@@ -0,0 +1,73 @@
+package identity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/x"
+)
+
+func TestNormalizeDuplicates(t *testing.T) {
+	assert.Equal(t, "foo@ory.sh", NormalizeDuplicateEmail(" Foo+news@ORY.sh"))
+	assert.Equal(t, "+foo@ory.sh", NormalizeDuplicateEmail("+foo@ory.sh"))
+	assert.Empty(t, NormalizeDuplicateEmail("foo"))
+	assert.Empty(t, NormalizeDuplicateEmail("foo@"))
+
+	assert.Equal(t, "491701234567", NormalizeDuplicatePhone("+49 170 1234567"))
+	assert.Equal(t, "491701234567", NormalizeDuplicatePhone("0049-170-1234567"))
+	assert.Empty(t, NormalizeDuplicatePhone("123"))
+
+	assert.Equal(t, "doe john", NormalizeDuplicateName("Doe, John"))
+	assert.Equal(t, "doe josé", NormalizeDuplicateName("José  DOE"))
+	assert.Empty(t, NormalizeDuplicateName("John"))
+}
+
+func TestDuplicateDetector(t *testing.T) {
+	now := time.Now().UTC()
+	newIdentity := func(traits string, createdAt time.Time, verified ...string) *Identity {
+		i := NewIdentity("default")
+		i.Traits = Traits(traits)
+		i.CreatedAt = createdAt
+		for _, v := range verified {
+			i.Addresses = append(i.Addresses, VerifiableAddress{ID: x.NewUUID(), Value: v, Via: VerifiableAddressTypeEmail, Verified: true})
+		}
+		return i
+	}
+
+	oldest := newIdentity(`{"email":"Foo@ory.sh","name":{"first":"John","last":"Doe"}}`, now.Add(-time.Hour))
+	verified := newIdentity(`{"name":"doe john"}`, now, "foo+kratos@ory.sh")
+	phone := newIdentity(`{"phone":["+49 170 1234567"]}`, now)
+	samePhone := newIdentity(`{"phone":["0049 170 1234567","0049 170 1234567"]}`, now.Add(-time.Minute))
+	unrelated := newIdentity(`{"email":"bar@ory.sh","name":"John"}`, now.Add(-2*time.Hour))
+
+	d := NewDuplicateDetector(DuplicateTraits{Email: "email", Phone: "phone", Name: "name"})
+	for _, i := range []*Identity{oldest, verified, phone, samePhone, unrelated} {
+		d.Add(i)
+	}
+
+	report := d.Report()
+	require.Len(t, report, 2)
+
+	assert.ElementsMatch(t, []uuid.UUID{oldest.ID, verified.ID}, report[0].IdentityIDs)
+	assert.Equal(t, []DuplicateMatch{
+		{Reason: DuplicateReasonEmail, Value: "foo@ory.sh"},
+		{Reason: DuplicateReasonName, Value: "doe john"},
+	}, report[0].Matches)
+	assert.Equal(t, []DuplicateMergeSuggestion{{
+		TargetID: verified.ID,
+		Payload:  MergePayload{SourceID: oldest.ID, ConflictPolicy: MergeConflictPolicyFail},
+	}}, report[0].MergeSuggestions, "the identity with verified addresses is kept")
+
+	assert.ElementsMatch(t, []uuid.UUID{phone.ID, samePhone.ID}, report[1].IdentityIDs)
+	assert.Equal(t, []DuplicateMatch{{Reason: DuplicateReasonPhone, Value: "491701234567"}}, report[1].Matches)
+	assert.Equal(t, []DuplicateMergeSuggestion{{
+		TargetID: samePhone.ID,
+		Payload:  MergePayload{SourceID: phone.ID, ConflictPolicy: MergeConflictPolicyFail},
+	}}, report[1].MergeSuggestions, "the oldest identity is kept")
+
+	assert.Empty(t, NewDuplicateDetector(DuplicateTraits{}).Report())
+}
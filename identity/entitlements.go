@@ -0,0 +1,132 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/egress"
+)
+
+type (
+	EntitlementResolverProvider interface {
+		IdentityEntitlementResolver() *EntitlementResolver
+	}
+
+	// EntitlementResolver resolves the entitlements of identities, for example their plan's feature flags, so
+	// that gateways can authorize requests using the whoami response only. Entitlements are either mapped from a
+	// trait, see configuration key identity.entitlements.static, or requested from an external service, see
+	// identity.entitlements.url. The service receives the identity without its credentials as a JSON POST body and
+	// must respond with a JSON object.
+	EntitlementResolver struct {
+		c      configuration.Provider
+		client *http.Client
+
+		sync.Mutex
+		cache map[uuid.UUID]cachedEntitlements
+	}
+
+	cachedEntitlements struct {
+		entitlements json.RawMessage
+		expiresAt    time.Time
+	}
+)
+
+func NewEntitlementResolver(c configuration.Provider) *EntitlementResolver {
+	return &EntitlementResolver{
+		c:      c,
+		client: &http.Client{Timeout: time.Second * 5, Transport: egress.Default},
+		cache:  map[uuid.UUID]cachedEntitlements{},
+	}
+}
+
+// Resolve returns the entitlements of the identity, or nil if no resolver is configured. If the external service
+// fails, the last entitlements it returned are used even if they expired.
+func (r *EntitlementResolver) Resolve(ctx context.Context, i *Identity) (json.RawMessage, error) {
+	c := r.c.IdentityEntitlements()
+	if len(c.URL) > 0 {
+		return r.fetch(ctx, c, i)
+	}
+	if len(c.Static.Trait) > 0 {
+		return resolveStatic(c.Static, i), nil
+	}
+	return nil, nil
+}
+
+func resolveStatic(c configuration.StaticEntitlements, i *Identity) json.RawMessage {
+	value := gjson.GetBytes(i.Traits, c.Trait)
+	for _, rule := range c.Rules {
+		if value.Exists() && value.String() == rule.Value {
+			return rule.Entitlements
+		}
+	}
+	return c.Default
+}
+
+func (r *EntitlementResolver) fetch(ctx context.Context, c *configuration.IdentityEntitlementsConfig, i *Identity) (json.RawMessage, error) {
+	r.Lock()
+	cached, ok := r.cache[i.ID]
+	r.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.entitlements, nil
+	}
+
+	entitlements, err := r.request(ctx, c.URL, i)
+	if err != nil {
+		if ok {
+			return cached.entitlements, nil
+		}
+		return nil, err
+	}
+
+	r.Lock()
+	r.cache[i.ID] = cachedEntitlements{entitlements: entitlements, expiresAt: time.Now().Add(c.CacheTTL)}
+	r.Unlock()
+	return entitlements, nil
+}
+
+func (r *EntitlementResolver) request(ctx context.Context, u string, i *Identity) (json.RawMessage, error) {
+	body, err := json.Marshal(i.CopyWithoutCredentials())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to resolve the entitlements of the identity: %s", err))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to resolve the entitlements of the identity, the entitlement service responded with status code %d.", res.StatusCode))
+	}
+
+	entitlements, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(entitlements, &object); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to resolve the entitlements of the identity, the entitlement service must respond with a JSON object: %s", err))
+	}
+	return entitlements, nil
+}
@@ -0,0 +1,113 @@
+package identity_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+)
+
+func TestEntitlementResolver(t *testing.T) {
+	conf, _ := internal.NewRegistryDefault(t)
+	newIdentity := func(plan string) *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(`{"email":"entitled@ory.sh","plan":"` + plan + `"}`)
+		return i
+	}
+
+	t.Run("case=no resolver configured", func(t *testing.T) {
+		entitlements, err := identity.NewEntitlementResolver(conf).Resolve(context.Background(), newIdentity("free"))
+		require.NoError(t, err)
+		assert.Nil(t, entitlements)
+	})
+
+	t.Run("case=static", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyIdentityEntitlementsStatic, map[string]interface{}{
+			"trait": "plan",
+			"rules": []map[string]interface{}{
+				{"value": "enterprise", "entitlements": map[string]interface{}{"sso": true, "seats": 100}},
+			},
+			"default": map[string]interface{}{"sso": false},
+		})
+		defer viper.Set(configuration.ViperKeyIdentityEntitlementsStatic, nil)
+
+		r := identity.NewEntitlementResolver(conf)
+		for plan, expected := range map[string]string{
+			"enterprise": `{"sso":true,"seats":100}`,
+			"free":       `{"sso":false}`,
+		} {
+			entitlements, err := r.Resolve(context.Background(), newIdentity(plan))
+			require.NoError(t, err)
+			assert.JSONEq(t, expected, string(entitlements), "%s", plan)
+		}
+	})
+
+	t.Run("case=url", func(t *testing.T) {
+		var calls int32
+		var fail int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if atomic.LoadInt32(&fail) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.False(t, gjson.GetBytes(body, "credentials").Exists(), "%s", body)
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+				"plan": gjson.GetBytes(body, "traits.plan").String(),
+			}))
+		}))
+		defer ts.Close()
+
+		viper.Set(configuration.ViperKeyIdentityEntitlementsURL, ts.URL)
+		defer viper.Set(configuration.ViperKeyIdentityEntitlementsURL, "")
+
+		t.Run("case=caches responses", func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			viper.Set(configuration.ViperKeyIdentityEntitlementsCacheTTL, "1h")
+
+			r := identity.NewEntitlementResolver(conf)
+			i := newIdentity("enterprise")
+			for k := 0; k < 3; k++ {
+				entitlements, err := r.Resolve(context.Background(), i)
+				require.NoError(t, err)
+				assert.JSONEq(t, `{"plan":"enterprise"}`, string(entitlements))
+			}
+			assert.EqualValues(t, 1, calls)
+		})
+
+		t.Run("case=uses expired responses if the service fails", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyIdentityEntitlementsCacheTTL, "0s")
+			atomic.StoreInt32(&fail, 0)
+			defer atomic.StoreInt32(&fail, 0)
+
+			r := identity.NewEntitlementResolver(conf)
+			i := newIdentity("enterprise")
+			_, err := r.Resolve(context.Background(), i)
+			require.NoError(t, err)
+
+			atomic.StoreInt32(&fail, 1)
+			entitlements, err := r.Resolve(context.Background(), i)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"plan":"enterprise"}`, string(entitlements))
+
+			_, err = r.Resolve(context.Background(), newIdentity("free"))
+			require.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package identity
+
+import (
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/jsonschema/v3"
+
+	"github.com/ory/kratos/schema"
+)
+
+// UploadKeyPrefix returns the prefix of the keys of all objects the identity uploaded. The key of an object is
+// the prefix followed by the object's ID.
+func UploadKeyPrefix(id uuid.UUID) string {
+	return "identities/" + id.String() + "/"
+}
+
+// SchemaExtensionUpload makes sure that traits marked as uploads reference objects the identity uploaded itself,
+// so that nobody can show the files of other identities as their own.
+type SchemaExtensionUpload struct {
+	i *Identity
+}
+
+func NewSchemaExtensionUpload(i *Identity) *SchemaExtensionUpload {
+	return &SchemaExtensionUpload{i: i}
+}
+
+func (r *SchemaExtensionUpload) Run(ctx jsonschema.ValidationContext, s schema.ExtensionConfig, value interface{}) error {
+	if s.Upload == nil {
+		return nil
+	}
+
+	key, ok := value.(string)
+	if !ok {
+		return ctx.Error("type", "expected string, but got %T", value)
+	} else if len(key) == 0 {
+		// The identity removed the file.
+		return nil
+	}
+
+	prefix := UploadKeyPrefix(r.i.ID)
+	if !strings.HasPrefix(key, prefix) {
+		return ctx.Error("", "%q is not a file uploaded by this identity", key)
+	}
+
+	if _, err := uuid.FromString(strings.TrimPrefix(key, prefix)); err != nil {
+		return ctx.Error("", "%q is not a file uploaded by this identity", key)
+	}
+	return nil
+}
+
+func (r *SchemaExtensionUpload) Finish() error {
+	return nil
+}
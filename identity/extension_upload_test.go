@@ -0,0 +1,46 @@
+package identity
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/jsonschema/v3"
+	_ "github.com/ory/jsonschema/v3/fileloader"
+
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/x"
+)
+
+func TestSchemaExtensionUpload(t *testing.T) {
+	iid := x.NewUUID()
+	for k, tc := range []struct {
+		doc       string
+		expectErr string
+	}{
+		{doc: `{"avatar":"` + UploadKeyPrefix(iid) + x.NewUUID().String() + `"}`},
+		{doc: `{"avatar":""}`},
+		{doc: `{"website":"https://www.ory.sh/"}`},
+		{doc: `{"avatar":"` + UploadKeyPrefix(x.NewUUID()) + x.NewUUID().String() + `"}`, expectErr: "is not a file uploaded by this identity"},
+		{doc: `{"avatar":"` + UploadKeyPrefix(iid) + `../other"}`, expectErr: "is not a file uploaded by this identity"},
+		{doc: `{"avatar":"https://example.org/picture.png"}`, expectErr: "is not a file uploaded by this identity"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			c := jsonschema.NewCompiler()
+			runner, err := schema.NewExtensionRunner(schema.ExtensionRunnerIdentityMetaSchema)
+			require.NoError(t, err)
+			runner.AddRunner(NewSchemaExtensionUpload(&Identity{ID: iid})).Register(c)
+
+			err = c.MustCompile("file://./stub/extension/upload/schema.json").Validate(bytes.NewBufferString(tc.doc))
+			if len(tc.expectErr) > 0 {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
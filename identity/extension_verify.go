@@ -25,34 +25,42 @@ func (r *SchemaExtensionVerify) Run(ctx jsonschema.ValidationContext, s schema.E
 	r.l.Lock()
 	defer r.l.Unlock()
 
+	var address *VerifiableAddress
+	var err error
 	switch s.Verification.Via {
 	case "email":
 		if !jsonschema.Formats["email"](value) {
 			return ctx.Error("format", "%q is not valid %q", value, "email")
 		}
 
-		address, err := NewVerifiableEmailAddress(fmt.Sprintf("%s", value), r.i.ID, r.lifespan)
-		if err != nil {
-			return err
+		address, err = NewVerifiableEmailAddress(fmt.Sprintf("%s", value), r.i.ID, r.lifespan)
+	case "sms":
+		if v, ok := value.(string); !ok || !IsPhoneNumber(v) {
+			return ctx.Error("format", "%q is not a valid phone number in the E.164 format, for example %q", value, "+4917612345678")
 		}
 
-		if has := r.has(r.i.Addresses, address); has != nil {
-			if r.has(r.v, address) == nil {
-				r.v = append(r.v, *has)
-			}
-			return nil
-		}
+		address, err = NewVerifiableSMSAddress(fmt.Sprintf("%s", value), r.i.ID, r.lifespan)
+	case "":
+		return nil
+	default:
+		return ctx.Error("", "verification.via has unknown value %q", s.Verification.Via)
+	}
+	if err != nil {
+		return err
+	}
 
-		if has := r.has(r.v, address); has == nil {
-			r.v = append(r.v, *address)
+	if has := r.has(r.i.Addresses, address); has != nil {
+		if r.has(r.v, address) == nil {
+			r.v = append(r.v, *has)
 		}
-
-		return nil
-	case "":
 		return nil
 	}
 
-	return ctx.Error("", "verification.via has unknown value %q", s.Verification.Via)
+	if has := r.has(r.v, address); has == nil {
+		r.v = append(r.v, *address)
+	}
+
+	return nil
 }
 
 func (r *SchemaExtensionVerify) has(haystack []VerifiableAddress, needle *VerifiableAddress) *VerifiableAddress {
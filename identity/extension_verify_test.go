@@ -176,6 +176,31 @@ func TestSchemaExtensionVerify(t *testing.T) {
 				},
 			},
 		},
+		{
+			doc:    `{"phone":"+4917612345678","username":"foo@ory.sh"}`,
+			schema: "file://./stub/extension/verify/schema.json",
+			expect: []VerifiableAddress{
+				{
+					Value:      "+4917612345678",
+					Verified:   false,
+					Status:     VerifiableAddressStatusPending,
+					Via:        VerifiableAddressTypeSMS,
+					IdentityID: iid,
+				},
+				{
+					Value:      "foo@ory.sh",
+					Verified:   false,
+					Status:     VerifiableAddressStatusPending,
+					Via:        VerifiableAddressTypeEmail,
+					IdentityID: iid,
+				},
+			},
+		},
+		{
+			doc:       `{"phone":"0176 12345678"}`,
+			schema:    "file://./stub/extension/verify/schema.json",
+			expectErr: errors.New("I[#/phone] S[#/properties/phone/format] \"0176 12345678\" is not a valid phone number in the E.164 format, for example \"+4917612345678\""),
+		},
 	} {
 		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
 			id := &Identity{ID: iid, Addresses: tc.existing}
@@ -2,28 +2,39 @@
 package identity
 
 import (
+	"context"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/ory/herodot"
 
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
+	"github.com/tidwall/sjson"
 
 	"github.com/ory/x/jsonx"
 	"github.com/ory/x/urlx"
 
+	"github.com/ory/x/errorsx"
 	"github.com/ory/x/pagination"
 
 	"github.com/ory/kratos/x"
 )
 
-const IdentitiesPath = "/identities"
+const (
+	IdentitiesPath         = "/identities"
+	IdentitiesValidatePath = IdentitiesPath + "/validate"
+)
 
 type (
 	handlerDependencies interface {
 		PoolProvider
+		PrivilegedPoolProvider
 		ManagementProvider
+		TraitsDeriverProvider
+		PairwiseSubjectsProvider
 		x.WriterProvider
 	}
 	HandlerProvider interface {
@@ -51,7 +62,15 @@ func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 	admin.DELETE(IdentitiesPath+"/:id", h.delete)
 
 	admin.POST(IdentitiesPath, h.create)
+	admin.POST(IdentitiesPath+"/:id", h.validate)
 	admin.PUT(IdentitiesPath+"/:id", h.update)
+	admin.PUT(IdentitiesPath+"/:id/credentials/password/expire", h.expirePassword)
+	admin.PUT(IdentitiesPath+"/:id/addresses/verify", h.verifyAddress)
+	admin.POST(IdentitiesPath+"/:id/merge", h.merge)
+	admin.GET(IdentitiesPath+"/:id/merges", h.listMerges)
+	admin.GET(IdentitiesPath+"/:id/metadata", h.getMetadata)
+	admin.PUT(IdentitiesPath+"/:id/metadata", h.updateMetadata)
+	admin.GET(PairwiseSubjectsPath+"/:subject", h.resolvePairwiseSubject)
 }
 
 // A single identity.
@@ -72,6 +91,26 @@ type identitiesListResponse struct {
 	Body []Identity
 }
 
+// nolint:deadcode,unused
+// swagger:parameters listIdentities
+type listIdentitiesParameters struct {
+	// Limit is the maximum number of identities returned. It defaults to 100 and must not exceed 500.
+	//
+	// in: query
+	Limit int `json:"limit"`
+
+	// Offset is the number of identities to skip.
+	//
+	// in: query
+	Offset int `json:"offset"`
+
+	// Identifier returns only the identity which uses this value as a login identifier, for example as the
+	// identifier of its password credentials, or as a verifiable address.
+	//
+	// in: query
+	Identifier string `json:"identifier"`
+}
+
 // swagger:route GET /identities admin listIdentities
 //
 // List all identities in the system
@@ -91,15 +130,76 @@ type identitiesListResponse struct {
 //       500: genericError
 func (h *Handler) list(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	limit, offset := pagination.Parse(r, 100, 0, 500)
+	if identifier := strings.TrimSpace(r.URL.Query().Get("identifier")); len(identifier) > 0 {
+		is, err := h.findByIdentifier(r.Context(), identifier)
+		if err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+
+		if offset > 0 {
+			is = []Identity{}
+		}
+		if err := h.r.IdentityTraitsDeriver().DeriveAll(r.Context(), is); err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+		h.r.Writer().Write(w, r, is)
+		return
+	}
+
 	is, err := h.r.IdentityPool().ListIdentities(r.Context(), limit, offset)
 	if err != nil {
 		h.r.Writer().WriteError(w, r, err)
 		return
 	}
 
+	if err := h.r.IdentityTraitsDeriver().DeriveAll(r.Context(), is); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
 	h.r.Writer().Write(w, r, is)
 }
 
+// findByIdentifier returns a list containing the identity which uses identifier in its credentials or as a
+// verifiable address, or an empty list if no identity does.
+func (h *Handler) findByIdentifier(ctx context.Context, identifier string) ([]Identity, error) {
+	var id uuid.UUID
+	// The pool normalizes the identifier for each credentials type.
+	for _, ct := range []CredentialsType{CredentialsTypePassword, CredentialsTypeOIDC} {
+		i, _, err := h.r.PrivilegedIdentityPool().FindByCredentialsIdentifier(ctx, ct, identifier)
+		if err == nil {
+			id = i.ID
+			break
+		} else if !isNotFound(err) {
+			return nil, err
+		}
+	}
+
+	if id == uuid.Nil {
+		address, err := h.r.IdentityPool().FindAddressByValue(ctx, VerifiableAddressTypeEmail, strings.ToLower(identifier))
+		if isNotFound(err) {
+			return []Identity{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		id = address.IdentityID
+	}
+
+	// The identity is loaded again because the privileged pool returns the credentials as well.
+	i, err := h.r.IdentityPool().GetIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return []Identity{*i}, nil
+}
+
+func isNotFound(err error) bool {
+	e, ok := errorsx.Cause(err).(interface{ StatusCode() int })
+	return ok && e.StatusCode() == http.StatusNotFound
+}
+
 // swagger:parameters getIdentity
 type getIdentityParameters struct {
 	// ID must be set to the ID of identity you want to get
@@ -126,14 +226,41 @@ type getIdentityParameters struct {
 //     Responses:
 //       200: identityResponse
 //       400: genericError
+//       410: genericError
 //       500: genericError
 func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	i, err := h.r.IdentityPool().GetIdentity(r.Context(), x.ParseUUID(ps.ByName("id")))
+	// The router does not allow registering IdentitiesStreamPath and IdentitiesDuplicatesPath next to the ID
+	// parameter.
+	switch IdentitiesPath + "/" + ps.ByName("id") {
+	case IdentitiesStreamPath:
+		h.stream(w, r, ps)
+		return
+	case IdentitiesDuplicatesPath:
+		h.findDuplicates(w, r, ps)
+		return
+	}
+
+	id := x.ParseUUID(ps.ByName("id"))
+	i, err := h.r.IdentityPool().GetIdentity(r.Context(), id)
+	if isNotFound(err) {
+		// Identities which were merged into another one are gone, point to the identity they live on in.
+		if m, merr := h.r.PrivilegedIdentityPool().FindIdentityMergeBySource(r.Context(), id); merr == nil {
+			h.r.Writer().WriteError(w, r, errors.WithStack(x.ErrGone.
+				WithReasonf("The identity was merged into identity %s.", m.TargetID).
+				WithDetail("merged_into", m.TargetID)))
+			return
+		}
+	}
 	if err != nil {
 		h.r.Writer().WriteError(w, r, err)
 		return
 	}
 
+	if err := h.r.IdentityTraitsDeriver().Derive(r.Context(), i); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
 	h.r.Writer().Write(w, r, i)
 }
 
@@ -144,6 +271,9 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 // This endpoint creates an identity. It is NOT possible to set an identity's credentials (password, ...)
 // using this method! A way to achieve that will be introduced in the future.
 //
+// With `?dry_run=true`, the identity is validated, including the uniqueness of its addresses, but not stored.
+// The response contains the identity as it would have been stored, without an ID.
+//
 // Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
 //
 //     Consumes:
@@ -155,8 +285,10 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 //     Schemes: http, https
 //
 //     Responses:
+//       200: identityResponse
 //       201: identityResponse
 //       400: genericError
+//       409: genericError
 //       500: genericError
 func (h *Handler) create(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var i Identity
@@ -175,6 +307,11 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	// We do not allow setting the ID using this method
 	i.ID = uuid.Nil
 
+	if isDryRun(r) {
+		h.createDryRun(w, r, &i)
+		return
+	}
+
 	err := h.r.IdentityManager().Create(r.Context(), &i)
 	if err != nil {
 		h.r.Writer().WriteError(w, r, err)
@@ -200,6 +337,8 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request, ps httprouter.P
 //
 // The full identity payload (except credentials) is expected. This endpoint does not support patching.
 //
+// With `?dry_run=true`, the identity is validated, including the uniqueness of its addresses, but not updated.
+//
 // Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
 //
 //     Consumes:
@@ -223,7 +362,83 @@ func (h *Handler) update(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	}
 
 	i.ID = x.ParseUUID(ps.ByName("id"))
-	if err := h.r.IdentityManager().Update(r.Context(), &i); err != nil {
+	opts := []ManagerOption{ManagerSkipWriteGuard}
+	if isDryRun(r) {
+		opts = append(opts, ManagerDryRun)
+	}
+
+	if err := h.r.IdentityManager().Update(r.Context(), &i, opts...); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, i)
+}
+
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
+
+func (h *Handler) createDryRun(w http.ResponseWriter, r *http.Request, i *Identity) {
+	if err := h.r.IdentityManager().Create(r.Context(), i, ManagerDryRun); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	// The ID was generated for the dry run only.
+	i.ID = uuid.Nil
+	h.r.Writer().Write(w, r, i)
+}
+
+// swagger:route POST /identities/validate admin validateIdentity
+//
+// Validate an identity
+//
+// Validates the identity like creating or updating it would, including the uniqueness of its addresses, but
+// does not store it. If the ID is set, the identity is validated as an update of that identity, otherwise as a
+// new identity. The response contains the identity as it would have been stored. Use it, for example, to check
+// identities before importing them or to validate forms.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityResponse
+//       400: genericError
+//       404: genericError
+//       409: genericError
+//       500: genericError
+func (h *Handler) validate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// The router does not allow registering IdentitiesValidatePath next to the ID parameter of the merge endpoint.
+	if IdentitiesPath+"/"+ps.ByName("id") != IdentitiesValidatePath {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReasonf("The requested resource could not be found.")))
+		return
+	}
+
+	var i Identity
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&i)); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if i.TraitsSchemaURL != "" {
+		h.r.Writer().WriteError(w, r, herodot.ErrBadRequest.WithReason("Use the traits_schema_id to set a traits schema."))
+		return
+	}
+
+	if x.IsZeroUUID(i.ID) {
+		// Like the create endpoint, credentials can not be set.
+		i.Credentials = nil
+		h.createDryRun(w, r, &i)
+		return
+	}
+
+	if err := h.r.IdentityManager().Update(r.Context(), &i, ManagerDryRun, ManagerSkipWriteGuard); err != nil {
 		h.r.Writer().WriteError(w, r, err)
 		return
 	}
@@ -249,10 +464,301 @@ func (h *Handler) update(w http.ResponseWriter, r *http.Request, ps httprouter.P
 //       404: genericError
 //       500: genericError
 func (h *Handler) delete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	if err := h.r.IdentityPool().(PrivilegedPool).DeleteIdentity(r.Context(), x.ParseUUID(ps.ByName("id"))); err != nil {
+	if err := h.r.IdentityManager().Delete(r.Context(), x.ParseUUID(ps.ByName("id"))); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:parameters expireIdentityPassword
+type expireIdentityPasswordParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route PUT /identities/{id}/credentials/password/expire admin expireIdentityPassword
+//
+// Expire an identity's password
+//
+// This endpoint marks the identity's password as expired. The identity will be asked to choose a new password
+// the next time it signs in using the password strategy.
+//
+// Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) expirePassword(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	i, err := h.r.IdentityPool().(PrivilegedPool).GetIdentityConfidential(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	c, ok := i.GetCredentials(CredentialsTypePassword)
+	if !ok {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("The identity does not have any password credentials.")))
+		return
+	}
+
+	config, err := sjson.SetBytes(c.Config, "force_change", true)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(err))
+		return
+	}
+
+	c.Config = config
+	i.SetCredentials(CredentialsTypePassword, *c)
+	if err := h.r.IdentityPool().(PrivilegedPool).UpdateIdentity(r.Context(), i); err != nil {
 		h.r.Writer().WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// swagger:parameters verifyIdentityAddress
+type verifyIdentityAddressParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	// required: true
+	Body VerifyAddressPayload
+}
+
+// swagger:model verifyIdentityAddressPayload
+type VerifyAddressPayload struct {
+	// Via is the type of the address. It defaults to "email".
+	Via VerifiableAddressType `json:"via"`
+
+	// Value is the address to mark as verified, for example an email address.
+	//
+	// required: true
+	Value string `json:"value"`
+}
+
+// swagger:route PUT /identities/{id}/addresses/verify admin verifyIdentityAddress
+//
+// Mark one of the identity's addresses as verified
+//
+// This endpoint marks the address as verified without the identity completing the verification flow, for example
+// after a support agent confirmed the address by other means. Verification links sent before no longer work.
+//
+// Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityResponse
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) verifyAddress(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p VerifyAddressPayload
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&p)); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if len(p.Via) == 0 {
+		p.Via = VerifiableAddressTypeEmail
+	}
+	p.Value = strings.ToLower(strings.TrimSpace(p.Value))
+	if len(p.Value) == 0 {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The address value must be set.")))
+		return
+	}
+
+	i, err := h.r.IdentityPool().GetIdentity(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	var address *VerifiableAddress
+	for k := range i.Addresses {
+		if i.Addresses[k].Via == p.Via && strings.ToLower(i.Addresses[k].Value) == p.Value {
+			address = &i.Addresses[k]
+			break
+		}
+	}
+	if address == nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReasonf(`The identity does not have the %s address "%s".`, p.Via, p.Value)))
+		return
+	}
+
+	if !address.Verified {
+		// A new code invalidates the verification links which were sent out before.
+		code, err := NewVerifyCode()
+		if err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+
+		now := time.Now().UTC().Round(time.Second)
+		address.Code = code
+		address.Verified = true
+		address.VerifiedAt = &now
+		address.Status = VerifiableAddressStatusCompleted
+		if err := h.r.PrivilegedIdentityPool().UpdateVerifiableAddress(r.Context(), address); err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+	}
+
+	h.r.Writer().Write(w, r, i)
+}
+
+// swagger:parameters mergeIdentity
+type mergeIdentityParameters struct {
+	// ID is the ID of the identity the other identity is merged into.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	// required: true
+	Body MergePayload
+}
+
+// swagger:model mergeIdentityPayload
+type MergePayload struct {
+	// SourceID is the ID of the identity which is merged into this one. It is deleted by the merge.
+	//
+	// required: true
+	SourceID uuid.UUID `json:"source_id"`
+
+	// ConflictPolicy decides what happens if both identities have conflicting data, for example two passwords or
+	// links to different accounts of the same OpenID Connect provider. It is one of `prefer_target`,
+	// `prefer_source`, and `fail`, which is the default.
+	ConflictPolicy MergeConflictPolicy `json:"conflict_policy"`
+}
+
+// The result of a merge.
+//
+// swagger:response identityMerge
+type identityMergeResponse struct {
+	// in: body
+	Body *Merge
+}
+
+// A list of merges.
+//
+// swagger:response identityMerges
+type identityMergesResponse struct {
+	// in: body
+	Body []Merge
+}
+
+// swagger:route POST /identities/{id}/merge admin mergeIdentity
+//
+// Merge another identity into an identity
+//
+// This endpoint merges the source identity into this one, for example if a person registered twice. This identity
+// takes over the credentials, verified addresses, OpenID Connect links, and sessions of the source identity and
+// keeps its own traits. Unverified addresses of the source identity are dropped.
+//
+// If both identities have conflicting data, `conflict_policy` decides whether this identity keeps its data
+// (`prefer_target`), takes the data of the source identity (`prefer_source`), or the merge is aborted (`fail`).
+//
+// The source identity is deleted. The merge is recorded and fetching the source identity returns a 410 error which
+// points to this identity. This can not be undone.
+//
+// Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityMerge
+//       400: genericError
+//       404: genericError
+//       409: genericError
+//       500: genericError
+func (h *Handler) merge(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p MergePayload
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&p)); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if p.SourceID == uuid.Nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The source_id must be set.")))
+		return
+	}
+
+	if len(p.ConflictPolicy) == 0 {
+		p.ConflictPolicy = MergeConflictPolicyFail
+	}
+
+	m, err := h.r.IdentityManager().Merge(r.Context(), x.ParseUUID(ps.ByName("id")), p.SourceID, p.ConflictPolicy)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, m)
+}
+
+// swagger:parameters listIdentityMerges
+type listIdentityMergesParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /identities/{id}/merges admin listIdentityMerges
+//
+// List the identities merged into an identity
+//
+// This endpoint returns the merges into the identity, newest first. They record what was transferred and how
+// conflicts were resolved.
+//
+// Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityMerges
+//       500: genericError
+func (h *Handler) listMerges(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ms, err := h.r.PrivilegedIdentityPool().ListIdentityMerges(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, ms)
+}
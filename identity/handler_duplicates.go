@@ -0,0 +1,105 @@
+package identity
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+const IdentitiesDuplicatesPath = IdentitiesPath + "/duplicates"
+
+// nolint:deadcode,unused
+// swagger:parameters findDuplicateIdentities
+type findDuplicateIdentitiesParameters struct {
+	// EmailTrait is the path of the trait containing email addresses, in GJSON syntax. It defaults to `email`.
+	//
+	// in: query
+	EmailTrait string `json:"email_trait"`
+
+	// PhoneTrait is the path of the trait containing phone numbers, in GJSON syntax. It defaults to `phone`.
+	//
+	// in: query
+	PhoneTrait string `json:"phone_trait"`
+
+	// NameTrait is the path of the trait containing the name, in GJSON syntax. If it is an object, for example
+	// with the keys `first` and `last`, all of its values are compared. It defaults to `name`.
+	//
+	// in: query
+	NameTrait string `json:"name_trait"`
+
+	// TraitsSchemaID compares only identities with this traits schema.
+	//
+	// in: query
+	TraitsSchemaID string `json:"traits_schema_id"`
+}
+
+// A list of probable duplicate identities.
+//
+// swagger:response identityDuplicates
+// nolint:deadcode,unused
+type identityDuplicatesResponse struct {
+	// in: body
+	Body []Duplicates
+}
+
+// swagger:route GET /identities/duplicates admin findDuplicateIdentities
+//
+// Find probable duplicate identities
+//
+// Scans all identities for ones which probably belong to the same person, for example after importing identities
+// from several systems. Identities are probable duplicates if they share an email address, a phone number, or a
+// name. Values are compared case-insensitively: email addresses without sub-addresses (`foo+news@ory.sh`), phone
+// numbers by their digits, and names by their words in any order.
+//
+// Each entry contains merge suggestions which can be sent to the merge endpoint as they are. Names are a weak
+// signal, so review duplicates which only share a name before merging them.
+//
+// The identities are loaded from the database in pages, but the report is only returned once all identities were
+// compared, which can take a while.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityDuplicates
+//       500: genericError
+func (h *Handler) findDuplicates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+	param := func(key, fallback string) string {
+		if _, ok := q[key]; ok {
+			return q.Get(key)
+		}
+		return fallback
+	}
+
+	d := NewDuplicateDetector(DuplicateTraits{
+		Email: param("email_trait", "email"),
+		Phone: param("phone_trait", "phone"),
+		Name:  param("name_trait", "name"),
+	})
+	schemaID := q.Get("traits_schema_id")
+
+	var after uuid.UUID
+	for {
+		is, err := h.r.IdentityPool().ListIdentitiesAfter(r.Context(), after, streamPageSize)
+		if err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		} else if len(is) == 0 {
+			break
+		}
+
+		for k := range is {
+			after = is[k].ID
+			if len(schemaID) > 0 && is[k].TraitsSchemaID != schemaID {
+				continue
+			}
+			d.Add(&is[k])
+		}
+	}
+
+	h.r.Writer().Write(w, r, d.Report())
+}
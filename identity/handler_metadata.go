@@ -0,0 +1,120 @@
+package identity
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+// maxMetadataSize limits the size of the metadata of an identity.
+const maxMetadataSize = 1 << 16
+
+// The metadata of an identity.
+//
+// swagger:response identityMetadata
+type identityMetadataResponse struct {
+	// in: body
+	Body MetadataObject
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getIdentityMetadata
+type getIdentityMetadataParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /identities/{id}/metadata admin getIdentityMetadata
+//
+// Get the metadata of an identity
+//
+// Metadata is data about an identity which operators and integrated systems store along with it, for example its
+// billing plan. Unlike traits, it is not validated against the identity's traits schema and the identity can
+// neither see nor change it. Identities without metadata have an empty object.
+//
+// Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityMetadata
+//       404: genericError
+//       500: genericError
+func (h *Handler) getMetadata(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := x.ParseUUID(ps.ByName("id"))
+	if _, err := h.r.IdentityPool().GetIdentity(r.Context(), id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	m, err := h.r.PrivilegedIdentityPool().GetIdentityMetadata(r.Context(), id)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, m)
+}
+
+// nolint:deadcode,unused
+// swagger:parameters updateIdentityMetadata
+type updateIdentityMetadataParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	// required: true
+	Body MetadataObject
+}
+
+// swagger:route PUT /identities/{id}/metadata admin updateIdentityMetadata
+//
+// Update the metadata of an identity
+//
+// This endpoint replaces the metadata of an identity, which must be a JSON object of at most 64 KiB.
+//
+// Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityMetadata
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) updateMetadata(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxMetadataSize))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to read the request body: %s", err)))
+		return
+	}
+
+	m := MetadataObject(body)
+	if err := h.r.IdentityManager().UpdateMetadata(r.Context(), x.ParseUUID(ps.ByName("id")), m, ManagerSkipWriteGuard); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, m)
+}
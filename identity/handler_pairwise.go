@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+const PairwiseSubjectsPath = "/pairwise-subjects"
+
+// nolint:deadcode,unused
+// swagger:parameters resolvePairwiseSubject
+type resolvePairwiseSubjectParameters struct {
+	// Subject is the pairwise subject identifier.
+	//
+	// required: true
+	// in: path
+	Subject string `json:"subject"`
+
+	// Audience is the relying party the pairwise subject identifier was issued to.
+	//
+	// required: true
+	// in: query
+	Audience string `json:"audience"`
+}
+
+// swagger:route GET /pairwise-subjects/{subject} admin resolvePairwiseSubject
+//
+// Resolve a pairwise subject identifier
+//
+// Returns the identity a relying party knows by the given pairwise subject identifier. Pairwise subject
+// identifiers can not be reversed, so this endpoint checks all identities and is slow for large numbers of
+// identities.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityResponse
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) resolvePairwiseSubject(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	subject := x.ParseUUID(ps.ByName("subject"))
+	if x.IsZeroUUID(subject) {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The pairwise subject identifier must be a UUID.")))
+		return
+	}
+
+	i, err := h.r.PairwiseSubjects().Resolve(r.Context(), r.URL.Query().Get("audience"), subject)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.IdentityTraitsDeriver().Derive(r.Context(), i); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, i)
+}
@@ -0,0 +1,225 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/stringslice"
+)
+
+const (
+	IdentitiesStreamPath = IdentitiesPath + "/stream"
+
+	// streamPageSize is the number of identities loaded from the database at once.
+	streamPageSize = 500
+
+	// streamTraitFilterPrefix prefixes the query parameters which filter the streamed identities by their traits.
+	streamTraitFilterPrefix = "trait."
+)
+
+// streamFields are the fields which can be selected when streaming identities.
+var streamFields = []string{"id", "traits_schema_id", "traits_schema_url", "traits", "derived_traits", "addresses"}
+
+// nolint:deadcode,unused
+// swagger:parameters streamIdentities
+type streamIdentitiesParameters struct {
+	// After is the ID of the last identity received. Only identities with a greater ID are streamed, which allows
+	// to resume an interrupted stream.
+	//
+	// in: query
+	After string `json:"after"`
+
+	// Limit is the maximum number of identities streamed. All identities are streamed if it is not set.
+	//
+	// in: query
+	Limit int `json:"limit"`
+
+	// Fields is a comma separated list of the fields each identity contains, for example `id,traits`. It
+	// defaults to all fields. The ID is always included.
+	//
+	// in: query
+	Fields string `json:"fields"`
+
+	// TraitsSchemaID returns only identities with this traits schema.
+	//
+	// in: query
+	TraitsSchemaID string `json:"traits_schema_id"`
+}
+
+// swagger:route GET /identities/stream admin streamIdentities
+//
+// Stream all identities
+//
+// Streams the identities as newline-delimited JSON, one identity per line, ordered by their ID. The identities are
+// loaded from the database in pages, so that all identities can be exported without paginating and without
+// keeping them in memory.
+//
+// Query parameters starting with `trait.` return only identities with this trait value, for example
+// `trait.address.country=DE` or `trait.emails.0=foo@ory.sh`.
+//
+// If an error occurs after the stream started, the last line is an object with the `error` key. If the
+// connection breaks, send the request again with `after` set to the ID of the last identity received.
+//
+//     Produces:
+//     - application/x-ndjson
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityList
+//       400: genericError
+//       500: genericError
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+
+	var after uuid.UUID
+	if raw := q.Get("after"); len(raw) > 0 {
+		id, err := uuid.FromString(raw)
+		if err != nil {
+			h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The after parameter must be an identity ID: %s", err)))
+			return
+		}
+		after = id
+	}
+
+	var limit int
+	if raw := q.Get("limit"); len(raw) > 0 {
+		l, err := strconv.Atoi(raw)
+		if err != nil || l < 0 {
+			h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The limit parameter must be a positive number.")))
+			return
+		}
+		limit = l
+	}
+
+	fields, err := parseStreamFields(q.Get("fields"))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	filters := map[string]string{}
+	for k := range q {
+		if strings.HasPrefix(k, streamTraitFilterPrefix) {
+			filters[strings.TrimPrefix(k, streamTraitFilterPrefix)] = q.Get(k)
+		}
+	}
+	schemaID := q.Get("traits_schema_id")
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	var streamed int
+	for limit == 0 || streamed < limit {
+		is, err := h.r.IdentityPool().ListIdentitiesAfter(r.Context(), after, streamPageSize)
+		if err != nil {
+			h.writeStreamError(enc, err)
+			return
+		} else if len(is) == 0 {
+			return
+		}
+
+		for k := range is {
+			i := &is[k]
+			after = i.ID
+			if !matchesStreamFilters(i, schemaID, filters) {
+				continue
+			}
+
+			if fields["derived_traits"] {
+				if err := h.r.IdentityTraitsDeriver().Derive(r.Context(), i); err != nil {
+					h.writeStreamError(enc, err)
+					return
+				}
+			}
+
+			line, err := selectStreamFields(i, fields)
+			if err != nil {
+				h.writeStreamError(enc, err)
+				return
+			}
+
+			if err := enc.Encode(line); err != nil {
+				// The client went away.
+				return
+			}
+
+			streamed++
+			if limit > 0 && streamed >= limit {
+				break
+			}
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Handler) writeStreamError(enc *json.Encoder, err error) {
+	_ = enc.Encode(&struct {
+		Error *herodot.DefaultError `json:"error"`
+	}{Error: herodot.ToDefaultError(err, "")})
+}
+
+func parseStreamFields(raw string) (map[string]bool, error) {
+	fields := map[string]bool{"id": true}
+	if len(raw) == 0 {
+		for _, f := range streamFields {
+			fields[f] = true
+		}
+		return fields, nil
+	}
+
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if !stringslice.Has(streamFields, f) {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The field "%s" is unknown, it must be one of: %s`, f, strings.Join(streamFields, ", ")))
+		}
+		fields[f] = true
+	}
+	return fields, nil
+}
+
+func matchesStreamFilters(i *Identity, schemaID string, filters map[string]string) bool {
+	if len(schemaID) > 0 && i.TraitsSchemaID != schemaID {
+		return false
+	}
+
+	for path, value := range filters {
+		if res := gjson.GetBytes(i.Traits, path); !res.Exists() || res.String() != value {
+			return false
+		}
+	}
+	return true
+}
+
+func selectStreamFields(i *Identity, fields map[string]bool) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(i)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	selected := make(map[string]json.RawMessage, len(fields))
+	for f := range fields {
+		if v, ok := all[f]; ok {
+			selected[f] = v
+		}
+	}
+	return selected, nil
+}
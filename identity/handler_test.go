@@ -1,12 +1,17 @@
 package identity_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/ory/x/urlx"
 
@@ -160,6 +165,69 @@ func TestHandler(t *testing.T) {
 		assert.EqualValues(t, "baz", res.Get("0.traits.bar").String(), "%s", res.Raw)
 	})
 
+	t.Run("case=should return derived traits", func(t *testing.T) {
+		snippet := "local identity = std.extVar('identity'); { shout: std.asciiUpper(identity.traits.bar) }"
+		viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, "base64://"+base64.StdEncoding.EncodeToString([]byte(snippet)))
+		defer viper.Set(configuration.ViperKeyIdentityTraitsDerivedMapperURL, "")
+
+		res := get(t, "/identities/"+i.ID.String(), http.StatusOK)
+		assert.EqualValues(t, "BAZ", res.Get("derived_traits.shout").String(), "%s", res.Raw)
+
+		res = get(t, "/identities", http.StatusOK)
+		assert.EqualValues(t, "BAZ", res.Get("0.derived_traits.shout").String(), "%s", res.Raw)
+	})
+
+	t.Run("case=should stream identities", func(t *testing.T) {
+		stream := func(t *testing.T, query string) []gjson.Result {
+			res, err := ts.Client().Get(ts.URL + identity.IdentitiesStreamPath + "?" + query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.EqualValues(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+
+			var lines []gjson.Result
+			s := bufio.NewScanner(res.Body)
+			for s.Scan() {
+				lines = append(lines, gjson.ParseBytes(s.Bytes()))
+			}
+			require.NoError(t, s.Err())
+			return lines
+		}
+
+		existing := len(stream(t, ""))
+		for _, traits := range []string{`{"bar":"stream"}`, `{"bar":"stream"}`, `{"bar":"other"}`} {
+			si := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			si.Traits = identity.Traits(traits)
+			require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), si))
+			defer func() {
+				require.NoError(t, reg.PrivilegedIdentityPool().DeleteIdentity(context.Background(), si.ID))
+			}()
+		}
+
+		all := stream(t, "")
+		require.Len(t, all, existing+3)
+		for k := 1; k < len(all); k++ {
+			assert.True(t, all[k-1].Get("id").String() < all[k].Get("id").String(), "identities must be ordered by their ID")
+		}
+		assert.True(t, all[0].Get("traits_schema_url").Exists(), "%s", all[0].Raw)
+
+		filtered := stream(t, "trait.bar=stream&fields=traits")
+		require.Len(t, filtered, 2)
+		for _, line := range filtered {
+			assert.Equal(t, "stream", line.Get("traits.bar").String(), "%s", line.Raw)
+			assert.True(t, line.Get("id").Exists(), "%s", line.Raw)
+			assert.False(t, line.Get("traits_schema_id").Exists(), "%s", line.Raw)
+		}
+
+		resumed := stream(t, "limit=2&after="+all[0].Get("id").String())
+		require.Len(t, resumed, 2)
+		assert.Equal(t, all[1].Get("id").String(), resumed[0].Get("id").String())
+		assert.Equal(t, all[2].Get("id").String(), resumed[1].Get("id").String())
+
+		_ = get(t, identity.IdentitiesStreamPath+"?fields=credentials", http.StatusBadRequest)
+		_ = get(t, identity.IdentitiesStreamPath+"?after=foo", http.StatusBadRequest)
+	})
+
 	t.Run("case=should not be able to update an identity that does not exist yet", func(t *testing.T) {
 		var i identity.Identity
 		i.ID = x.NewUUID()
@@ -168,6 +236,243 @@ func TestHandler(t *testing.T) {
 		assert.Contains(t, res.Get("error.message").String(), "Unable to locate the resource", "%s", res.Raw)
 	})
 
+	t.Run("case=should not be able to expire the password of an identity without password credentials", func(t *testing.T) {
+		res := send(t, "PUT", "/identities/"+i.ID.String()+"/credentials/password/expire", http.StatusNotFound, nil)
+		assert.Contains(t, res.Get("error.reason").String(), "does not have any password credentials", "%s", res.Raw)
+	})
+
+	t.Run("case=should expire the password of an identity", func(t *testing.T) {
+		pi := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		pi.Traits = identity.Traits(`{"bar":"baz"}`)
+		pi.SetCredentials(identity.CredentialsTypePassword, identity.Credentials{
+			Type:        identity.CredentialsTypePassword,
+			Identifiers: []string{"expire-password@ory.sh"},
+			Config:      json.RawMessage(`{"hashed_password":"foo"}`),
+		})
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), pi))
+
+		_ = send(t, "PUT", "/identities/"+pi.ID.String()+"/credentials/password/expire", http.StatusNoContent, nil)
+
+		actual, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), pi.ID)
+		require.NoError(t, err)
+		c, ok := actual.GetCredentials(identity.CredentialsTypePassword)
+		require.True(t, ok)
+		assert.True(t, gjson.GetBytes(c.Config, "force_change").Bool(), "%s", c.Config)
+		assert.Equal(t, "foo", gjson.GetBytes(c.Config, "hashed_password").String(), "%s", c.Config)
+	})
+
+	t.Run("case=should return 404 when expiring the password of a non-existing identity", func(t *testing.T) {
+		_ = send(t, "PUT", "/identities/"+x.NewUUID().String()+"/credentials/password/expire", http.StatusNotFound, nil)
+	})
+
+	t.Run("case=should find identities by identifier", func(t *testing.T) {
+		pi := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		pi.Traits = identity.Traits(`{"bar":"baz"}`)
+		pi.SetCredentials(identity.CredentialsTypePassword, identity.Credentials{
+			Type:        identity.CredentialsTypePassword,
+			Identifiers: []string{"find-me@ory.sh"},
+			Config:      json.RawMessage(`{"hashed_password":"foo"}`),
+		})
+		address, err := identity.NewVerifiableEmailAddress("find-me-too@ory.sh", pi.ID, time.Hour)
+		require.NoError(t, err)
+		pi.Addresses = []identity.VerifiableAddress{*address}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), pi))
+
+		for _, identifier := range []string{"find-me@ory.sh", "FIND-ME@ory.sh", "find-me-too@ory.sh"} {
+			t.Run("identifier="+identifier, func(t *testing.T) {
+				res := get(t, "/identities?identifier="+url.QueryEscape(identifier), http.StatusOK)
+				require.Len(t, res.Array(), 1, "%s", res.Raw)
+				assert.EqualValues(t, pi.ID.String(), res.Get("0.id").String(), "%s", res.Raw)
+				assert.Empty(t, res.Get("0.credentials").String(), "%s", res.Raw)
+			})
+		}
+
+		res := get(t, "/identities?identifier=does-not-exist@ory.sh", http.StatusOK)
+		require.True(t, res.IsArray(), "%s", res.Raw)
+		assert.Len(t, res.Array(), 0)
+
+		res = get(t, "/identities?offset=1&identifier=find-me@ory.sh", http.StatusOK)
+		assert.Len(t, res.Array(), 0)
+	})
+
+	t.Run("case=should mark an address as verified", func(t *testing.T) {
+		pi := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		pi.Traits = identity.Traits(`{"bar":"baz"}`)
+		address, err := identity.NewVerifiableEmailAddress("verify-me@ory.sh", pi.ID, time.Hour)
+		require.NoError(t, err)
+		pi.Addresses = []identity.VerifiableAddress{*address}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), pi))
+
+		res := send(t, "PUT", "/identities/"+pi.ID.String()+"/addresses/verify", http.StatusNotFound, &identity.VerifyAddressPayload{Value: "does-not-exist@ory.sh"})
+		assert.Contains(t, res.Get("error.reason").String(), "does-not-exist@ory.sh", "%s", res.Raw)
+
+		_ = send(t, "PUT", "/identities/"+pi.ID.String()+"/addresses/verify", http.StatusBadRequest, &identity.VerifyAddressPayload{})
+		_ = send(t, "PUT", "/identities/"+x.NewUUID().String()+"/addresses/verify", http.StatusNotFound, &identity.VerifyAddressPayload{Value: "verify-me@ory.sh"})
+
+		res = send(t, "PUT", "/identities/"+pi.ID.String()+"/addresses/verify", http.StatusOK, &identity.VerifyAddressPayload{Value: "Verify-Me@ory.sh"})
+		assert.True(t, res.Get("addresses.0.verified").Bool(), "%s", res.Raw)
+		assert.NotEmpty(t, res.Get("addresses.0.verified_at").String(), "%s", res.Raw)
+
+		// The code which was sent out before no longer works.
+		_, err = reg.IdentityPool().FindAddressByCode(context.Background(), address.Code)
+		require.Error(t, err)
+
+		actual, err := reg.IdentityPool().GetIdentity(context.Background(), pi.ID)
+		require.NoError(t, err)
+		require.Len(t, actual.Addresses, 1)
+		assert.True(t, actual.Addresses[0].Verified)
+	})
+
+	t.Run("case=should update the metadata of an identity", func(t *testing.T) {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(`{"bar":"baz"}`)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		res := get(t, "/identities/"+i.ID.String()+"/metadata", http.StatusOK)
+		assert.JSONEq(t, `{}`, res.Raw)
+
+		_ = send(t, "PUT", "/identities/"+i.ID.String()+"/metadata", http.StatusBadRequest, []string{"not", "an", "object"})
+		_ = send(t, "PUT", "/identities/"+x.NewUUID().String()+"/metadata", http.StatusNotFound, map[string]string{"plan": "free"})
+		_ = get(t, "/identities/"+x.NewUUID().String()+"/metadata", http.StatusNotFound)
+
+		res = send(t, "PUT", "/identities/"+i.ID.String()+"/metadata", http.StatusOK, map[string]string{"plan": "free"})
+		assert.Equal(t, "free", res.Get("plan").String(), "%s", res.Raw)
+		res = get(t, "/identities/"+i.ID.String()+"/metadata", http.StatusOK)
+		assert.Equal(t, "free", res.Get("plan").String(), "%s", res.Raw)
+
+		// Metadata is not part of the identity.
+		res = get(t, "/identities/"+i.ID.String(), http.StatusOK)
+		assert.False(t, res.Get("metadata").Exists(), "%s", res.Raw)
+	})
+
+	t.Run("case=should merge identities", func(t *testing.T) {
+		create := func(identifier, hash string, verified bool) *identity.Identity {
+			i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			i.Traits = identity.Traits(`{"bar":"baz","emails":["` + identifier + `"]}`)
+			i.SetCredentials(identity.CredentialsTypePassword, identity.Credentials{
+				Type: identity.CredentialsTypePassword, Identifiers: []string{identifier},
+				Config: json.RawMessage(`{"hashed_password":"` + hash + `"}`),
+			})
+			address, err := identity.NewVerifiableEmailAddress(identifier, i.ID, time.Hour)
+			require.NoError(t, err)
+			address.Verified = verified
+			i.Addresses = []identity.VerifiableAddress{*address}
+			require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+			return i
+		}
+
+		target := create("merge-target@ory.sh", "foo", true)
+		source := create("merge-source@ory.sh", "bar", true)
+		href := "/identities/" + target.ID.String() + "/merge"
+
+		_ = send(t, "POST", href, http.StatusBadRequest, &identity.MergePayload{SourceID: target.ID})
+		_ = send(t, "POST", href, http.StatusBadRequest, &identity.MergePayload{SourceID: source.ID, ConflictPolicy: "unknown"})
+		_ = send(t, "POST", href, http.StatusNotFound, &identity.MergePayload{SourceID: x.NewUUID()})
+
+		res := send(t, "POST", href, http.StatusConflict, &identity.MergePayload{SourceID: source.ID})
+		assert.Equal(t, "credentials.password", res.Get("error.details.field").String(), "%s", res.Raw)
+		_ = get(t, "/identities/"+source.ID.String(), http.StatusOK)
+
+		res = send(t, "POST", href, http.StatusOK, &identity.MergePayload{SourceID: source.ID, ConflictPolicy: identity.MergeConflictPolicyPreferTarget})
+		assert.Equal(t, source.ID.String(), res.Get("source_id").String(), "%s", res.Raw)
+		assert.Equal(t, "credentials.password", res.Get("conflicts.0.field").String(), "%s", res.Raw)
+		assert.Equal(t, string(identity.MergeResolutionKeptTarget), res.Get("conflicts.0.resolution").String(), "%s", res.Raw)
+		assert.Equal(t, "merge-source@ory.sh", res.Get("addresses.0").String(), "%s", res.Raw)
+
+		res = get(t, "/identities/"+source.ID.String(), http.StatusGone)
+		assert.Equal(t, target.ID.String(), res.Get("error.details.merged_into").String(), "%s", res.Raw)
+
+		res = get(t, "/identities/"+target.ID.String()+"/merges", http.StatusOK)
+		assert.Len(t, res.Array(), 1, "%s", res.Raw)
+		assert.Equal(t, source.ID.String(), res.Get("0.source_id").String(), "%s", res.Raw)
+
+		actual, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), target.ID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"merge-target@ory.sh", "merge-source@ory.sh"}, actual.Credentials[identity.CredentialsTypePassword].Identifiers)
+		assert.JSONEq(t, `{"hashed_password":"foo"}`, string(actual.Credentials[identity.CredentialsTypePassword].Config))
+		assert.JSONEq(t, `{"bar":"baz","emails":["merge-target@ory.sh","merge-source@ory.sh"]}`, string(actual.Traits))
+		assert.Len(t, actual.Addresses, 2)
+
+		// The transferred addresses and identifiers are backed by the traits, so they survive an update.
+		actual.Traits = identity.Traits(`{"bar":"updated","emails":["merge-target@ory.sh","merge-source@ory.sh"]}`)
+		_ = send(t, "PUT", "/identities/"+target.ID.String(), http.StatusOK, actual)
+		actual, err = reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), target.ID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"merge-target@ory.sh", "merge-source@ory.sh"}, actual.Credentials[identity.CredentialsTypePassword].Identifiers)
+		assert.Len(t, actual.Addresses, 2)
+
+		_ = send(t, "POST", href, http.StatusNotFound, &identity.MergePayload{SourceID: source.ID})
+	})
+
+	t.Run("case=should find duplicate identities", func(t *testing.T) {
+		var ids []string
+		for _, traits := range []string{`{"email":"Duplicate@ory.sh"}`, `{"email":"duplicate+import@ory.sh"}`} {
+			i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			i.Traits = identity.Traits(traits)
+			require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+			ids = append(ids, i.ID.String())
+		}
+
+		find := func(t *testing.T, query string) gjson.Result {
+			for _, d := range get(t, identity.IdentitiesDuplicatesPath+"?"+query, http.StatusOK).Array() {
+				if d.Get("matches.0.value").String() == "duplicate@ory.sh" {
+					return d
+				}
+			}
+			return gjson.Result{}
+		}
+
+		res := find(t, "")
+		require.True(t, res.Exists())
+		assert.ElementsMatch(t, ids, []string{res.Get("identity_ids.0").String(), res.Get("identity_ids.1").String()}, "%s", res.Raw)
+		assert.Equal(t, "email", res.Get("matches.0.reason").String(), "%s", res.Raw)
+		assert.False(t, find(t, "email_trait=").Exists(), "email traits are not compared without a path")
+		assert.False(t, find(t, "traits_schema_id=unknown").Exists())
+
+		suggestion := res.Get("merge_suggestions.0")
+		_ = send(t, "POST", "/identities/"+suggestion.Get("target_id").String()+"/merge", http.StatusOK, json.RawMessage(suggestion.Get("payload").Raw))
+		assert.False(t, find(t, "").Exists(), "merged identities are no longer duplicates")
+
+		remove(t, "/identities/"+suggestion.Get("target_id").String(), http.StatusNoContent)
+	})
+
+	t.Run("case=should validate identities without storing them", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyIdentityTraitsSchemas, []configuration.SchemaConfig{{ID: "verification", URL: "file://./stub/manager.schema.json"}})
+		defer viper.Set(configuration.ViperKeyIdentityTraitsSchemas, []configuration.SchemaConfig{})
+
+		count := func(t *testing.T) int {
+			return len(get(t, "/identities", http.StatusOK).Array())
+		}
+		before := count(t)
+
+		n := identity.Identity{TraitsSchemaID: "verification", Traits: identity.Traits(`{"email":"dry-run@ory.sh"}`)}
+		for _, href := range []string{"/identities?dry_run=true", "/identities/validate"} {
+			res := send(t, "POST", href, http.StatusOK, &n)
+			assert.Equal(t, x.EmptyUUID.String(), res.Get("id").String(), "%s", res.Raw)
+			assert.Equal(t, "dry-run@ory.sh", res.Get("addresses.0.value").String(), "%s", res.Raw)
+		}
+		assert.Equal(t, before, count(t), "dry runs do not store identities")
+
+		res := send(t, "POST", "/identities/validate", http.StatusBadRequest, &identity.Identity{TraitsSchemaID: "verification", Traits: identity.Traits(`{}`)})
+		assert.Contains(t, res.Get("error.reason").String(), "email", "%s", res.Raw)
+
+		_ = send(t, "POST", "/identities", http.StatusCreated, &n)
+		_ = send(t, "POST", "/identities?dry_run=true", http.StatusConflict, &n)
+		_ = send(t, "POST", "/identities/validate", http.StatusConflict, &n)
+
+		u := i
+		u.Traits = identity.Traits(`{"bar":"dry-run"}`)
+		res = send(t, "PUT", "/identities/"+i.ID.String()+"?dry_run=true", http.StatusOK, &u)
+		assert.Equal(t, "dry-run", res.Get("traits.bar").String(), "%s", res.Raw)
+		res = send(t, "POST", "/identities/validate", http.StatusOK, &u)
+		assert.Equal(t, i.ID.String(), res.Get("id").String(), "%s", res.Raw)
+		assert.Equal(t, "baz", get(t, "/identities/"+i.ID.String(), http.StatusOK).Get("traits.bar").String(), "dry runs do not update identities")
+
+		u.ID = x.NewUUID()
+		_ = send(t, "PUT", "/identities/"+u.ID.String()+"?dry_run=true", http.StatusNotFound, &u)
+		_ = send(t, "POST", "/identities/"+u.ID.String(), http.StatusNotFound, &u)
+	})
+
 	t.Run("case=should delete a client and no longer be able to retrieve it", func(t *testing.T) {
 		remove(t, "/identities/"+i.ID.String(), http.StatusNoContent)
 		_ = get(t, "/identities/"+i.ID.String(), http.StatusNotFound)
@@ -53,6 +53,11 @@ type (
 		// required: true
 		Traits Traits `json:"traits" faker:"-" db:"traits"`
 
+		// DerivedTraits are computed from the identity by the Jsonnet snippet configured at
+		// `identity.traits.derived_mapper_url` whenever the identity is returned. They are not stored and can not be
+		// set.
+		DerivedTraits json.RawMessage `json:"derived_traits,omitempty" faker:"-" db:"-"`
+
 		Addresses []VerifiableAddress `json:"addresses,omitempty" faker:"-" has_many:"identity_verifiable_addresses" fk_id:"identity_id"`
 
 		// CredentialsCollection is a helper struct field for gobuffalo.pop.
@@ -16,6 +16,9 @@ import (
 
 	"github.com/ory/kratos/courier"
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/webhook"
+	"github.com/ory/kratos/x"
 )
 
 var ErrProtectedFieldModified = herodot.ErrForbidden.
@@ -24,8 +27,19 @@ var ErrProtectedFieldModified = herodot.ErrForbidden.
 type (
 	managerDependencies interface {
 		PoolProvider
+		WriteGuardProvider
 		courier.Provider
 		ValidationProvider
+		webhook.DispatcherProvider
+		x.LoggingProvider
+	}
+	// WriteGuard rejects changes of an identity, for example while maintenance mode is enabled or the identity is
+	// locked.
+	WriteGuard interface {
+		CheckWrite(ctx context.Context, identityID uuid.UUID) error
+	}
+	WriteGuardProvider interface {
+		IdentityWriteGuard() WriteGuard
 	}
 	ManagementProvider interface {
 		IdentityManager() *Manager
@@ -38,11 +52,22 @@ type (
 	managerOptions struct {
 		ExposeValidationErrors    bool
 		AllowWriteProtectedTraits bool
+		DryRun                    bool
+		SkipEvents                bool
+		SkipWriteGuard            bool
 	}
 
 	ManagerOption func(*managerOptions)
+
+	// transactionalPool is implemented by pools which run functions in a transaction, see ManagerDryRun.
+	transactionalPool interface {
+		InTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	}
 )
 
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("the identity was not stored because of the dry run")
+
 func NewManager(r managerDependencies, c configuration.Provider) *Manager {
 	return &Manager{r: r, c: c}
 }
@@ -55,6 +80,25 @@ func ManagerAllowWriteProtectedTraits(options *managerOptions) {
 	options.AllowWriteProtectedTraits = true
 }
 
+// ManagerDryRun validates and stores the identity in a transaction which is rolled back, so that the identity is
+// checked against the database constraints, for example the uniqueness of its addresses, without changing it. The
+// identity is normalized as if it was stored.
+func ManagerDryRun(options *managerOptions) {
+	options.DryRun = true
+}
+
+// ManagerSkipEvents does not emit the webhook event of the change, for example because the caller emits it once the
+// change is complete.
+func ManagerSkipEvents(options *managerOptions) {
+	options.SkipEvents = true
+}
+
+// ManagerSkipWriteGuard updates the identity even if maintenance mode is enabled or the identity is locked. It must
+// only be used for changes made by administrators.
+func ManagerSkipWriteGuard(options *managerOptions) {
+	options.SkipWriteGuard = true
+}
+
 func newManagerOptions(opts []ManagerOption) *managerOptions {
 	var o managerOptions
 	for _, f := range opts {
@@ -69,20 +113,61 @@ func (m *Manager) Create(ctx context.Context, i *Identity, opts ...ManagerOption
 		return err
 	}
 
-	return m.r.IdentityPool().(PrivilegedPool).CreateIdentity(ctx, i)
+	if err := m.store(ctx, o, func(ctx context.Context) error {
+		return m.r.IdentityPool().(PrivilegedPool).CreateIdentity(ctx, i)
+	}); err != nil {
+		return err
+	}
+
+	m.emit(ctx, o, webhook.EventIdentityCreated, i)
+	return nil
+}
+
+func (m *Manager) store(ctx context.Context, o *managerOptions, fn func(ctx context.Context) error) error {
+	if !o.DryRun {
+		return fn(ctx)
+	}
+
+	pool, ok := m.r.IdentityPool().(transactionalPool)
+	if !ok {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReason("The identity pool does not support dry runs."))
+	}
+
+	err := pool.InTransaction(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		return errors.WithStack(errDryRun)
+	})
+	if errorsx.Cause(err) == errDryRun {
+		return nil
+	}
+	return err
 }
 
 func (m *Manager) Update(ctx context.Context, i *Identity, opts ...ManagerOption) error {
 	o := newManagerOptions(opts)
-	if err := m.validate(i, o); err != nil {
+	if err := m.checkWrite(ctx, i.ID, o); err != nil {
+		return err
+	} else if err := m.validate(i, o); err != nil {
 		return err
 	}
 
-	return m.r.IdentityPool().(PrivilegedPool).UpdateIdentity(ctx, i)
+	if err := m.store(ctx, o, func(ctx context.Context) error {
+		return m.r.IdentityPool().(PrivilegedPool).UpdateIdentity(ctx, i)
+	}); err != nil {
+		return err
+	}
+
+	m.emit(ctx, o, webhook.EventIdentityUpdated, i)
+	return nil
 }
 
 func (m *Manager) UpdateTraits(ctx context.Context, id uuid.UUID, traits Traits, opts ...ManagerOption) error {
 	o := newManagerOptions(opts)
+	if err := m.checkWrite(ctx, id, o); err != nil {
+		return err
+	}
 
 	identity, err := m.r.IdentityPool().(PrivilegedPool).GetIdentityConfidential(ctx, id)
 	if err != nil {
@@ -102,36 +187,158 @@ func (m *Manager) UpdateTraits(ctx context.Context, id uuid.UUID, traits Traits,
 			return errors.WithStack(ErrProtectedFieldModified)
 		}
 
-		if !reflect.DeepEqual(original.Addresses, identity.Addresses) &&
-			/* prevent nil != []string{} */
-			len(original.Addresses)+len(identity.Addresses) != 0 {
+		if !addressesEqual(original.Addresses, identity.Addresses) {
 			// reset the identity
 			*identity = *original
 			return errors.WithStack(ErrProtectedFieldModified)
 		}
 	}
 
-	return m.r.IdentityPool().(PrivilegedPool).UpdateIdentity(ctx, identity)
+	if err := m.store(ctx, o, func(ctx context.Context) error {
+		return m.r.IdentityPool().(PrivilegedPool).UpdateIdentity(ctx, identity)
+	}); err != nil {
+		return err
+	}
+
+	m.emit(ctx, o, webhook.EventIdentityUpdated, identity)
+	return nil
 }
 
-func (m *Manager) RefreshVerifyAddress(ctx context.Context, address *VerifiableAddress) error {
-	code, err := NewVerifyCode()
-	if err != nil {
+// UpdateMetadata replaces the metadata of the identity, which must be a JSON object.
+func (m *Manager) UpdateMetadata(ctx context.Context, id uuid.UUID, metadata MetadataObject, opts ...ManagerOption) error {
+	o := newManagerOptions(opts)
+	if !metadata.IsObject() {
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("The metadata of an identity must be a JSON object."))
+	} else if err := m.checkWrite(ctx, id, o); err != nil {
 		return err
 	}
 
+	return m.store(ctx, o, func(ctx context.Context) error {
+		return m.r.IdentityPool().(PrivilegedPool).UpdateIdentityMetadata(ctx, id, metadata)
+	})
+}
+
+// Delete deletes the identity.
+func (m *Manager) Delete(ctx context.Context, id uuid.UUID, opts ...ManagerOption) error {
+	o := newManagerOptions(opts)
+	if err := m.r.IdentityPool().(PrivilegedPool).DeleteIdentity(ctx, id); err != nil {
+		return err
+	}
+
+	m.emit(ctx, o, webhook.EventIdentityDeleted, &deletedIdentity{ID: id})
+	return nil
+}
+
+// deletedIdentity is the data of the webhook event of a deleted identity.
+type deletedIdentity struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// emit emits the webhook event of a change, unless it was a dry run.
+func (m *Manager) emit(ctx context.Context, o *managerOptions, t webhook.EventType, data interface{}) {
+	if o.DryRun || o.SkipEvents {
+		return
+	}
+	m.r.WebhookDispatcher().Emit(ctx, t, data)
+}
+
+// Merge merges the source identity into the target identity. The target takes over the credentials, verified
+// addresses, OpenID Connect links, and sessions of the source. The trait values of the source are added to the
+// target's, which keeps its own where both differ; addresses and identifiers backed by such a trait value of the
+// source are not transferred. Conflicts are resolved according to the policy. The source is deleted and the returned merge, which is stored as well, records what was
+// transferred.
+func (m *Manager) Merge(ctx context.Context, targetID, sourceID uuid.UUID, policy MergeConflictPolicy) (*Merge, error) {
+	if targetID == sourceID {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("An identity can not be merged into itself."))
+	}
+
+	if !policy.IsValid() {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The conflict policy "%s" is unknown, use one of "%s", "%s", or "%s".`,
+			policy, MergeConflictPolicyPreferTarget, MergeConflictPolicyPreferSource, MergeConflictPolicyFail))
+	}
+
+	pool := m.r.IdentityPool().(PrivilegedPool)
+	target, err := pool.GetIdentityConfidential(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := pool.GetIdentityConfidential(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	o := newManagerOptions(nil)
+	merge, err := newMerger(target, source, policy).merge(func(i *Identity) error {
+		return m.validate(i, o)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pool.MergeIdentity(ctx, target, merge); err != nil {
+		return nil, err
+	}
+
+	m.emit(ctx, o, webhook.EventIdentityUpdated, target)
+	m.emit(ctx, o, webhook.EventIdentityDeleted, &deletedIdentity{ID: source.ID})
+
+	x.ContextLogger(ctx, m.r.Logger()).
+		WithField("audit", "identity_merge").
+		WithField("merge_id", merge.ID).
+		WithField("source_id", merge.SourceID).
+		WithField("target_id", merge.TargetID).
+		WithField("conflict_policy", merge.ConflictPolicy).
+		WithField("conflicts", len(merge.Conflicts)).
+		WithField("sessions_transferred", merge.SessionsTransferred).
+		Info("An identity was merged into another one.")
+	return merge, nil
+}
+
+// RefreshVerifyAddress replaces the code of the address, which invalidates the verification links sent before.
+func (m *Manager) RefreshVerifyAddress(ctx context.Context, address *VerifiableAddress, code string, expiresAt time.Time) error {
 	address.Code = code
-	address.ExpiresAt = time.Now().UTC().Add(m.c.SelfServiceVerificationLinkLifespan())
+	address.ExpiresAt = expiresAt
 	return m.r.IdentityPool().(PrivilegedPool).UpdateVerifiableAddress(ctx, address)
 }
 
+// checkWrite returns an error if the identity must not be changed at the moment, unless the write guard is skipped.
+func (m *Manager) checkWrite(ctx context.Context, id uuid.UUID, o *managerOptions) error {
+	if o.SkipWriteGuard {
+		return nil
+	}
+	return m.r.IdentityWriteGuard().CheckWrite(ctx, id)
+}
+
 func (m *Manager) validate(i *Identity, o *managerOptions) error {
 	if err := m.r.IdentityValidator().Validate(i); err != nil {
-		if _, ok := errorsx.Cause(err).(*jsonschema.ValidationError); ok && !o.ExposeValidationErrors {
-			return errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
+		if e, ok := errorsx.Cause(err).(*jsonschema.ValidationError); ok && !o.ExposeValidationErrors {
+			return errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err).WithDetail("fields", schema.FieldMessages(e)))
 		}
 		return err
 	}
 
 	return nil
 }
+
+// addressesEqual returns true if both have the same addresses, in any order. The order of the addresses depends on
+// the order in which the schema was validated.
+func addressesEqual(a, b []VerifiableAddress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, expect := range a {
+		var found bool
+		for _, actual := range b {
+			if reflect.DeepEqual(expect, actual) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -4,16 +4,24 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 
+	"github.com/ory/herodot"
 	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
 
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/webhook"
+	"github.com/ory/kratos/x"
 )
 
 func TestManager(t *testing.T) {
@@ -70,6 +78,17 @@ func TestManager(t *testing.T) {
 			require.Error(t, err)
 			assert.NotContains(t, err.Error(), "\"not an email\" is not valid \"email\"")
 		})
+
+		t.Run("case=should map validation errors to fields without option", func(t *testing.T) {
+			original := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			original.Traits = identity.Traits(`{"email":"not an email"}`)
+			err := reg.IdentityManager().Create(context.Background(), original)
+			require.Error(t, err)
+
+			e, ok := errors.Cause(err).(*herodot.DefaultError)
+			require.True(t, ok, "%+v", err)
+			assert.Equal(t, map[string][]string{"traits.email": {"\"not an email\" is not valid \"email\""}}, e.DetailsField["fields"])
+		})
 	})
 
 	t.Run("method=Update", func(t *testing.T) {
@@ -138,6 +157,44 @@ func TestManager(t *testing.T) {
 		})
 	})
 
+	t.Run("method=Merge", func(t *testing.T) {
+		t.Run("case=merged identity can update its traits", func(t *testing.T) {
+			target := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			target.Traits = identity.Traits(`{"email":"merge-target@ory.sh"}`)
+			require.NoError(t, reg.IdentityManager().Create(context.Background(), target))
+
+			source := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			source.Traits = identity.Traits(`{"email":"merge-source@ory.sh","email_creds":"merge-login@ory.sh","email_verify":"merge-verified@ory.sh"}`)
+			require.NoError(t, reg.IdentityManager().Create(context.Background(), source))
+			for k := range source.Addresses {
+				source.Addresses[k].Verified = true
+				require.NoError(t, reg.PrivilegedIdentityPool().UpdateVerifiableAddress(context.Background(), &source.Addresses[k]))
+			}
+
+			m, err := reg.IdentityManager().Merge(context.Background(), target.ID, source.ID, identity.MergeConflictPolicyPreferTarget)
+			require.NoError(t, err)
+			assert.Equal(t, identity.MergeValues{"merge-verified@ory.sh"}, m.Addresses,
+				"the address backed by the conflicting email trait is not transferred")
+
+			actual, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), target.ID)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"email":"merge-target@ory.sh","email_creds":"merge-login@ory.sh","email_verify":"merge-verified@ory.sh"}`, string(actual.Traits))
+			assert.ElementsMatch(t, []string{"merge-target@ory.sh", "merge-login@ory.sh"}, actual.Credentials[identity.CredentialsTypePassword].Identifiers)
+			require.Len(t, actual.Addresses, 2)
+			for _, a := range actual.Addresses {
+				assert.Equal(t, a.Value == "merge-verified@ory.sh", a.Verified, "%s", a.Value)
+			}
+
+			require.NoError(t, reg.IdentityManager().UpdateTraits(context.Background(), target.ID,
+				identity.Traits(`{"email":"merge-target@ory.sh","email_creds":"merge-login@ory.sh","email_verify":"merge-verified@ory.sh","unprotected":"foo"}`)))
+
+			actual, err = reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), target.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "foo", gjson.GetBytes(actual.Traits, "unprotected").String())
+			assert.ElementsMatch(t, []string{"merge-target@ory.sh", "merge-login@ory.sh"}, actual.Credentials[identity.CredentialsTypePassword].Identifiers)
+		})
+	})
+
 	t.Run("method=RefreshVerifyAddress", func(t *testing.T) {
 		original := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
 		original.Traits = identity.Traits(`{"email":"verifyme@ory.sh"}`)
@@ -148,7 +205,9 @@ func TestManager(t *testing.T) {
 
 		pc := address.Code
 		ea := address.ExpiresAt
-		require.NoError(t, reg.IdentityManager().RefreshVerifyAddress(context.Background(), address))
+		code, err := identity.NewVerifyCode()
+		require.NoError(t, err)
+		require.NoError(t, reg.IdentityManager().RefreshVerifyAddress(context.Background(), address, code, time.Now().UTC().Add(time.Hour)))
 		assert.NotEqual(t, pc, address.Code)
 		assert.NotEqual(t, ea, address.ExpiresAt)
 
@@ -156,4 +215,55 @@ func TestManager(t *testing.T) {
 		require.NoError(t, err)
 		assert.NotEqual(t, pc, fromStore.Addresses[0].Code)
 	})
+	t.Run("case=guards writes", func(t *testing.T) {
+		original := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		original.Traits = identity.Traits(`{"email":"locked@ory.sh"}`)
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), original))
+		require.NoError(t, reg.MaintenancePersister().SetWriteLock(context.Background(), &maintenance.Lock{IdentityID: original.ID, CreatedAt: time.Now().UTC()}))
+
+		err := reg.IdentityManager().Update(context.Background(), original)
+		assert.Equal(t, form.ErrorIDIdentityLocked, errorsx.Cause(err).(*herodot.DefaultError).Details()["error_id"], "%+v", err)
+		err = reg.IdentityManager().UpdateTraits(context.Background(), original.ID, identity.Traits(`{"email":"locked@ory.sh","unprotected":"foo"}`))
+		assert.Equal(t, form.ErrorIDIdentityLocked, errorsx.Cause(err).(*herodot.DefaultError).Details()["error_id"], "%+v", err)
+
+		actual, err := reg.IdentityPool().GetIdentity(context.Background(), original.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"email":"locked@ory.sh"}`, string(actual.Traits))
+
+		t.Run("case=administrators may change locked identities", func(t *testing.T) {
+			require.NoError(t, reg.IdentityManager().UpdateTraits(context.Background(), original.ID, identity.Traits(`{"email":"locked@ory.sh","unprotected":"foo"}`), identity.ManagerSkipWriteGuard))
+		})
+	})
+
+	t.Run("case=emits webhook events", func(t *testing.T) {
+		sub := &webhook.Subscription{
+			ID:              x.NewUUID(),
+			URL:             "https://example.org/hooks",
+			Events:          webhook.EventTypes{webhook.EventIdentityCreated, webhook.EventIdentityUpdated, webhook.EventIdentityDeleted},
+			Enabled:         true,
+			EncryptedSecret: "encrypted",
+		}
+		require.NoError(t, reg.WebhookPersister().CreateWebhookSubscription(context.Background(), sub))
+
+		dryRun := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		dryRun.Traits = identity.Traits(`{"email":"dry-run@ory.sh"}`)
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), dryRun, identity.ManagerDryRun))
+
+		original := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		original.Traits = identity.Traits(`{"email":"events@ory.sh"}`)
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), original))
+		require.NoError(t, reg.IdentityManager().Update(context.Background(), original, identity.ManagerSkipEvents))
+		require.NoError(t, reg.IdentityManager().UpdateTraits(context.Background(), original.ID, identity.Traits(`{"email":"events@ory.sh","unprotected":"foo"}`)))
+		require.NoError(t, reg.IdentityManager().Delete(context.Background(), original.ID))
+
+		ds, err := reg.WebhookPersister().ListWebhookDeliveries(context.Background(), sub.ID, 100, 0)
+		require.NoError(t, err)
+
+		var events []webhook.EventType
+		for _, d := range ds {
+			events = append(events, d.EventType)
+		}
+		assert.ElementsMatch(t, []webhook.EventType{webhook.EventIdentityCreated, webhook.EventIdentityUpdated, webhook.EventIdentityDeleted}, events,
+			"dry runs and skipped events are not emitted")
+	})
 }
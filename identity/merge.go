@@ -0,0 +1,399 @@
+package identity
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/persistence/aliases"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// MergeConflictPolicyPreferTarget keeps the target's data if both identities have conflicting data.
+	MergeConflictPolicyPreferTarget MergeConflictPolicy = "prefer_target"
+	// MergeConflictPolicyPreferSource replaces the target's data with the source's if both identities have
+	// conflicting data.
+	MergeConflictPolicyPreferSource MergeConflictPolicy = "prefer_source"
+	// MergeConflictPolicyFail aborts the merge if both identities have conflicting data.
+	MergeConflictPolicyFail MergeConflictPolicy = "fail"
+
+	MergeResolutionKeptTarget MergeResolution = "kept_target"
+	MergeResolutionTookSource MergeResolution = "took_source"
+)
+
+var ErrMergeConflict = herodot.DefaultError{
+	CodeField:   http.StatusConflict,
+	StatusField: http.StatusText(http.StatusConflict),
+	ErrorField:  "The identities can not be merged because they have conflicting data.",
+}
+
+type (
+	// MergeConflictPolicy decides what happens if both identities of a merge have conflicting data.
+	MergeConflictPolicy string
+
+	// MergeResolution tells how a conflict was resolved.
+	MergeResolution string
+
+	// MergeConflict is data both identities of a merge had.
+	//
+	// swagger:model identityMergeConflict
+	MergeConflict struct {
+		// Field is the conflicting data, for example `credentials.password` or `credentials.oidc.github`.
+		Field string `json:"field"`
+
+		// Resolution is either `kept_target` or `took_source`.
+		Resolution MergeResolution `json:"resolution"`
+	}
+
+	// swagger:ignore
+	MergeConflicts []MergeConflict
+
+	// swagger:ignore
+	MergeValues []string
+
+	// Merge records that an identity was merged into another one. It is kept when either identity is deleted
+	// and serves as the tombstone of the source identity.
+	//
+	// swagger:model identityMerge
+	Merge struct {
+		// required: true
+		ID uuid.UUID `json:"id" db:"id"`
+
+		// SourceID is the ID of the identity which was merged and no longer exists.
+		//
+		// required: true
+		SourceID uuid.UUID `json:"source_id" db:"source_id"`
+
+		// TargetID is the ID of the identity the source was merged into.
+		//
+		// required: true
+		TargetID uuid.UUID `json:"target_id" db:"target_id"`
+
+		// ConflictPolicy is the policy which was used to resolve conflicts.
+		//
+		// required: true
+		ConflictPolicy MergeConflictPolicy `json:"conflict_policy" db:"conflict_policy"`
+
+		// Credentials are the types of credentials which were transferred.
+		Credentials MergeValues `json:"credentials" db:"credentials"`
+
+		// Addresses are the verified addresses which were transferred.
+		Addresses MergeValues `json:"addresses" db:"addresses"`
+
+		// Conflicts are the data both identities had and how it was resolved.
+		Conflicts MergeConflicts `json:"conflicts" db:"conflicts"`
+
+		// SessionsTransferred is the number of sessions which were transferred.
+		SessionsTransferred int `json:"sessions_transferred" db:"sessions_transferred"`
+
+		// CreatedAt is the time of the merge.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" db:"created_at"`
+	}
+)
+
+func (m Merge) TableName() string {
+	return "identity_merges"
+}
+
+func (c *MergeConflicts) Scan(value interface{}) error {
+	return aliases.JSONScan(c, value)
+}
+
+func (c MergeConflicts) Value() (driver.Value, error) {
+	return aliases.JSONValue(&c)
+}
+
+func (v *MergeValues) Scan(value interface{}) error {
+	return aliases.JSONScan(v, value)
+}
+
+func (v MergeValues) Value() (driver.Value, error) {
+	return aliases.JSONValue(&v)
+}
+
+func (p MergeConflictPolicy) IsValid() bool {
+	switch p {
+	case MergeConflictPolicyPreferTarget, MergeConflictPolicyPreferSource, MergeConflictPolicyFail:
+		return true
+	}
+	return false
+}
+
+// merger merges the credentials, verified addresses, and traits of the source into the target. Where both identities
+// have a different value for a trait which is not an array, the target keeps its own.
+type merger struct {
+	target, source *Identity
+	m              *Merge
+}
+
+func newMerger(target, source *Identity, policy MergeConflictPolicy) *merger {
+	return &merger{target: target, source: source, m: &Merge{
+		ID:             x.NewUUID(),
+		SourceID:       source.ID,
+		TargetID:       target.ID,
+		ConflictPolicy: policy,
+		Credentials:    MergeValues{},
+		Addresses:      MergeValues{},
+		Conflicts:      MergeConflicts{},
+		CreatedAt:      time.Now().UTC().Round(time.Second),
+	}}
+}
+
+// conflict records a conflict and returns true if the source's data should be used.
+func (m *merger) conflict(field string) (bool, error) {
+	switch m.m.ConflictPolicy {
+	case MergeConflictPolicyPreferSource:
+		m.m.Conflicts = append(m.m.Conflicts, MergeConflict{Field: field, Resolution: MergeResolutionTookSource})
+		return true, nil
+	case MergeConflictPolicyPreferTarget:
+		m.m.Conflicts = append(m.m.Conflicts, MergeConflict{Field: field, Resolution: MergeResolutionKeptTarget})
+		return false, nil
+	}
+	return false, errors.WithStack(ErrMergeConflict.WithReasonf(`Both identities have "%s".`, field).WithDetail("field", field))
+}
+
+// merge merges the source into the target. Verifiable addresses and credential identifiers have to be backed by the
+// traits, so validate is called once the traits are merged to rebuild them, before the verified addresses are
+// transferred.
+func (m *merger) merge(validate func(*Identity) error) (*Merge, error) {
+	for ct, source := range m.source.Credentials {
+		target, ok := m.target.GetCredentials(ct)
+		if !ok {
+			source.ID = uuid.Nil
+			m.target.SetCredentials(ct, source)
+			m.m.Credentials = append(m.m.Credentials, string(ct))
+			continue
+		}
+
+		var err error
+		if ct == CredentialsTypeOIDC && isJSONArray(target.Config) && isJSONArray(source.Config) {
+			err = m.mergeOIDC(target, &source)
+		} else {
+			err = m.mergeCredentials(target, &source)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.target.SetCredentials(ct, *target)
+		m.m.Credentials = append(m.m.Credentials, string(ct))
+	}
+
+	sort.Strings(m.m.Credentials)
+	if err := m.mergeTraits(); err != nil {
+		return nil, err
+	}
+
+	if err := validate(m.target); err != nil {
+		return nil, err
+	}
+
+	m.mergeAddresses()
+	return m.m, nil
+}
+
+// mergeCredentials keeps the identifiers of both credentials, so that the source's identifiers can still be used to
+// sign in. Both credentials have their own config, for example the password hash, so that is a conflict.
+func (m *merger) mergeCredentials(target, source *Credentials) error {
+	if !bytes.Equal(target.Config, source.Config) {
+		useSource, err := m.conflict(fmt.Sprintf("credentials.%s", source.Type))
+		if err != nil {
+			return err
+		}
+		if useSource {
+			target.Config = source.Config
+		}
+	}
+
+	target.Identifiers = appendUnique(target.Identifiers, source.Identifiers...)
+	return nil
+}
+
+// mergeOIDC transfers the links to OpenID Connect providers. The config of OpenID Connect credentials is a list of
+// links with the provider and subject, and the identifiers are `provider:subject`. Both identities having a link to
+// the same provider is a conflict.
+func (m *merger) mergeOIDC(target, source *Credentials) error {
+	var targetLinks, sourceLinks []json.RawMessage
+	for _, c := range []struct {
+		raw   json.RawMessage
+		links *[]json.RawMessage
+	}{{raw: target.Config, links: &targetLinks}, {raw: source.Config, links: &sourceLinks}} {
+		if err := json.Unmarshal(c.raw, c.links); err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReason("The OpenID Connect credentials could not be decoded properly").WithDebug(err.Error()))
+		}
+	}
+
+	type link struct {
+		Provider string `json:"provider"`
+		Subject  string `json:"subject"`
+	}
+	parse := func(raw json.RawMessage) (l link) {
+		_ = json.Unmarshal(raw, &l)
+		return
+	}
+
+	for _, sl := range sourceLinks {
+		source := parse(sl)
+		conflicting := -1
+		for k, tl := range targetLinks {
+			if parse(tl).Provider == source.Provider {
+				conflicting = k
+				break
+			}
+		}
+
+		if conflicting < 0 {
+			targetLinks = append(targetLinks, sl)
+			continue
+		}
+
+		target := parse(targetLinks[conflicting])
+		if target.Subject == source.Subject {
+			continue
+		}
+
+		useSource, err := m.conflict(fmt.Sprintf("credentials.oidc.%s", source.Provider))
+		if err != nil {
+			return err
+		} else if useSource {
+			targetLinks[conflicting] = sl
+		}
+	}
+
+	identifiers := make([]string, len(targetLinks))
+	for k, tl := range targetLinks {
+		l := parse(tl)
+		identifiers[k] = fmt.Sprintf("%s:%s", l.Provider, l.Subject)
+	}
+
+	config, err := json.Marshal(targetLinks)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	target.Config = config
+	target.Identifiers = identifiers
+	return nil
+}
+
+// mergeTraits adds the trait values of the source to the target, so that the addresses and identifiers backed by
+// them are kept. Arrays are joined, objects are merged, and other values are taken if the target does not have
+// them.
+func (m *merger) mergeTraits() error {
+	if len(m.source.Traits) == 0 {
+		return nil
+	}
+
+	var target, source interface{}
+	for _, t := range []struct {
+		raw   Traits
+		value *interface{}
+	}{{raw: m.target.Traits, value: &target}, {raw: m.source.Traits, value: &source}} {
+		if len(t.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(t.raw, t.value); err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReason("The traits could not be decoded properly").WithDebug(err.Error()))
+		}
+	}
+
+	traits, err := json.Marshal(mergeTraitValues(target, source))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.target.Traits = traits
+	return nil
+}
+
+func mergeTraitValues(target, source interface{}) interface{} {
+	if target == nil {
+		return source
+	}
+
+	switch t := target.(type) {
+	case map[string]interface{}:
+		if s, ok := source.(map[string]interface{}); ok {
+			for k, v := range s {
+				t[k] = mergeTraitValues(t[k], v)
+			}
+		}
+	case []interface{}:
+		if s, ok := source.([]interface{}); ok {
+			for _, v := range s {
+				var found bool
+				for _, e := range t {
+					if reflect.DeepEqual(e, v) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t = append(t, v)
+				}
+			}
+			return t
+		}
+	}
+	return target
+}
+
+// mergeAddresses transfers the verified state of the source's addresses to the addresses of the target, which were
+// rebuilt from the merged traits. Addresses which are not backed by the target's traits are dropped, as are unverified
+// addresses because nobody proved to own them.
+func (m *merger) mergeAddresses() {
+	for _, source := range m.source.Addresses {
+		if !source.Verified {
+			continue
+		}
+
+		for k := range m.target.Addresses {
+			target := &m.target.Addresses[k]
+			if target.Via != source.Via || !strings.EqualFold(target.Value, source.Value) {
+				continue
+			}
+
+			if !target.Verified {
+				target.Verified = true
+				target.VerifiedAt = source.VerifiedAt
+				target.Status = VerifiableAddressStatusCompleted
+				m.m.Addresses = append(m.m.Addresses, source.Value)
+			}
+			break
+		}
+	}
+}
+
+func isJSONArray(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] == '['
+}
+
+func appendUnique(to []string, values ...string) []string {
+	for _, v := range values {
+		var found bool
+		for _, t := range to {
+			if t == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			to = append(to, v)
+		}
+	}
+	return to
+}
@@ -0,0 +1,147 @@
+package identity
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+func TestMerger(t *testing.T) {
+	noValidate := func(*Identity) error { return nil }
+	oidc := func(i *Identity, config string, identifiers ...string) {
+		i.SetCredentials(CredentialsTypeOIDC, Credentials{Identifiers: identifiers, Config: json.RawMessage(config)})
+	}
+	password := func(i *Identity, hash string, identifiers ...string) {
+		i.SetCredentials(CredentialsTypePassword, Credentials{Identifiers: identifiers, Config: json.RawMessage(`{"hashed_password":"` + hash + `"}`)})
+	}
+	address := func(value string, verified bool) VerifiableAddress {
+		a, err := NewVerifiableEmailAddress(value, x.NewUUID(), time.Hour)
+		require.NoError(t, err)
+		a.Verified = verified
+		return *a
+	}
+
+	t.Run("case=transfers credentials the target does not have", func(t *testing.T) {
+		target, source := NewIdentity(""), NewIdentity("")
+		password(target, "foo", "target@ory.sh")
+		oidc(source, `[{"provider":"github","subject":"1"}]`, "github:1")
+
+		m, err := newMerger(target, source, MergeConflictPolicyFail).merge(noValidate)
+		require.NoError(t, err)
+		assert.Equal(t, MergeValues{"oidc"}, m.Credentials)
+		assert.Empty(t, m.Conflicts)
+		assert.Equal(t, []string{"github:1"}, target.Credentials[CredentialsTypeOIDC].Identifiers)
+		assert.Equal(t, []string{"target@ory.sh"}, target.Credentials[CredentialsTypePassword].Identifiers)
+	})
+
+	t.Run("case=resolves password conflicts", func(t *testing.T) {
+		for _, tc := range []struct {
+			policy   MergeConflictPolicy
+			expected string
+		}{
+			{policy: MergeConflictPolicyPreferTarget, expected: `{"hashed_password":"foo"}`},
+			{policy: MergeConflictPolicyPreferSource, expected: `{"hashed_password":"bar"}`},
+		} {
+			t.Run("policy="+string(tc.policy), func(t *testing.T) {
+				target, source := NewIdentity(""), NewIdentity("")
+				password(target, "foo", "target@ory.sh")
+				password(source, "bar", "source@ory.sh")
+
+				m, err := newMerger(target, source, tc.policy).merge(noValidate)
+				require.NoError(t, err)
+				require.Len(t, m.Conflicts, 1)
+				assert.Equal(t, "credentials.password", m.Conflicts[0].Field)
+				assert.JSONEq(t, tc.expected, string(target.Credentials[CredentialsTypePassword].Config))
+				assert.Equal(t, []string{"target@ory.sh", "source@ory.sh"}, target.Credentials[CredentialsTypePassword].Identifiers)
+			})
+		}
+
+		target, source := NewIdentity(""), NewIdentity("")
+		password(target, "foo", "target@ory.sh")
+		password(source, "bar", "source@ory.sh")
+		_, err := newMerger(target, source, MergeConflictPolicyFail).merge(noValidate)
+		require.Error(t, err)
+		assert.Equal(t, ErrMergeConflict.StatusCode(), errors.Cause(err).(*herodot.DefaultError).StatusCode())
+	})
+
+	t.Run("case=merges OpenID Connect links", func(t *testing.T) {
+		setup := func() (*Identity, *Identity) {
+			target, source := NewIdentity(""), NewIdentity("")
+			oidc(target, `[{"provider":"github","subject":"1"},{"provider":"google","subject":"2"}]`, "github:1", "google:2")
+			oidc(source, `[{"provider":"github","subject":"1"},{"provider":"google","subject":"3"},{"provider":"gitlab","subject":"4"}]`, "github:1", "google:3", "gitlab:4")
+			return target, source
+		}
+
+		target, source := setup()
+		_, err := newMerger(target, source, MergeConflictPolicyFail).merge(noValidate)
+		require.Error(t, err, "both are linked to different google accounts")
+
+		target, source = setup()
+		m, err := newMerger(target, source, MergeConflictPolicyPreferTarget).merge(noValidate)
+		require.NoError(t, err)
+		assert.Equal(t, MergeConflicts{{Field: "credentials.oidc.google", Resolution: MergeResolutionKeptTarget}}, m.Conflicts)
+		assert.Equal(t, []string{"github:1", "google:2", "gitlab:4"}, target.Credentials[CredentialsTypeOIDC].Identifiers)
+
+		target, source = setup()
+		m, err = newMerger(target, source, MergeConflictPolicyPreferSource).merge(noValidate)
+		require.NoError(t, err)
+		assert.Equal(t, MergeConflicts{{Field: "credentials.oidc.google", Resolution: MergeResolutionTookSource}}, m.Conflicts)
+		assert.Equal(t, []string{"github:1", "google:3", "gitlab:4"}, target.Credentials[CredentialsTypeOIDC].Identifiers)
+		assert.JSONEq(t, `[{"provider":"github","subject":"1"},{"provider":"google","subject":"3"},{"provider":"gitlab","subject":"4"}]`,
+			string(target.Credentials[CredentialsTypeOIDC].Config))
+	})
+
+	t.Run("case=transfers verified addresses", func(t *testing.T) {
+		target, source := NewIdentity(""), NewIdentity("")
+		target.Addresses = []VerifiableAddress{address("shared@ory.sh", false)}
+		source.Addresses = []VerifiableAddress{
+			address("Shared@ory.sh", true),
+			address("verified@ory.sh", true),
+			address("unverified@ory.sh", false),
+			address("unbacked@ory.sh", true),
+		}
+
+		// rebuild stands in for the validator, which rebuilds the addresses backed by the merged traits.
+		rebuild := func(i *Identity) error {
+			i.Addresses = append(i.Addresses, address("verified@ory.sh", false), address("unverified@ory.sh", false))
+			return nil
+		}
+
+		m, err := newMerger(target, source, MergeConflictPolicyFail).merge(rebuild)
+		require.NoError(t, err)
+		assert.Equal(t, MergeValues{"Shared@ory.sh", "verified@ory.sh"}, m.Addresses)
+		require.Len(t, target.Addresses, 3, "addresses which are not backed by the traits are dropped")
+		assert.Equal(t, "shared@ory.sh", target.Addresses[0].Value)
+		assert.True(t, target.Addresses[0].Verified)
+		assert.Equal(t, "verified@ory.sh", target.Addresses[1].Value)
+		assert.True(t, target.Addresses[1].Verified)
+		assert.Equal(t, "unverified@ory.sh", target.Addresses[2].Value)
+		assert.False(t, target.Addresses[2].Verified)
+	})
+
+	t.Run("case=merges traits", func(t *testing.T) {
+		target, source := NewIdentity(""), NewIdentity("")
+		target.Traits = Traits(`{"email":"target@ory.sh","emails":["shared@ory.sh"],"name":{"first":"Target"}}`)
+		source.Traits = Traits(`{"email":"source@ory.sh","emails":["shared@ory.sh","source@ory.sh"],"name":{"first":"Source","last":"Doe"},"phone":"+4917612345678"}`)
+
+		_, err := newMerger(target, source, MergeConflictPolicyFail).merge(noValidate)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"email":"target@ory.sh","emails":["shared@ory.sh","source@ory.sh"],"name":{"first":"Target","last":"Doe"},"phone":"+4917612345678"}`, string(target.Traits))
+	})
+
+	t.Run("case=fails if the merged identity is invalid", func(t *testing.T) {
+		target, source := NewIdentity(""), NewIdentity("")
+		_, err := newMerger(target, source, MergeConflictPolicyFail).merge(func(*Identity) error {
+			return errors.New("invalid")
+		})
+		require.Error(t, err)
+	})
+}
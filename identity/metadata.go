@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/persistence/aliases"
+)
+
+type (
+	// Metadata is data about an identity which operators and integrated systems, for example billing systems,
+	// store along with it. Unlike traits, it is not validated against the identity's schema and the identity can
+	// neither see nor change it.
+	Metadata struct {
+		// ID is the ID of the identity.
+		ID uuid.UUID `json:"-" db:"id"`
+
+		Metadata MetadataObject `json:"-" db:"metadata"`
+
+		// CreatedAt is a helper struct field for gobuffalo.pop.
+		CreatedAt time.Time `json:"-" db:"created_at"`
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" db:"updated_at"`
+	}
+
+	// MetadataObject is the JSON object stored as metadata of an identity.
+	//
+	// swagger:model identityMetadata
+	MetadataObject json.RawMessage
+)
+
+func (m Metadata) TableName() string {
+	return "identity_metadata"
+}
+
+// IsObject returns true if the metadata is a JSON object.
+func (m MetadataObject) IsObject() bool {
+	var v map[string]interface{}
+	return json.Unmarshal(m, &v) == nil && v != nil
+}
+
+func (m *MetadataObject) Scan(value interface{}) error {
+	return aliases.JSONScan(m, value)
+}
+
+func (m MetadataObject) Value() (driver.Value, error) {
+	return aliases.JSONValue(&m)
+}
+
+// MarshalJSON returns m as the JSON encoding of m.
+func (m MetadataObject) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return m, nil
+}
+
+// UnmarshalJSON sets *m to a copy of data.
+func (m *MetadataObject) UnmarshalJSON(data []byte) error {
+	if m == nil {
+		return errors.New("json.RawMessage: UnmarshalJSON on nil pointer")
+	}
+	*m = append((*m)[0:0], data...)
+	return nil
+}
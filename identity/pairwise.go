@@ -0,0 +1,98 @@
+package identity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/stringslice"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+// pairwisePageSize is the number of identities loaded from the database at once when resolving a subject.
+const pairwisePageSize = 500
+
+type (
+	pairwiseDependencies interface {
+		PoolProvider
+	}
+	PairwiseSubjectsProvider interface {
+		PairwiseSubjects() *PairwiseSubjects
+	}
+
+	// PairwiseSubjects computes pseudonymous identity IDs which are stable per relying party (the audience) but
+	// differ between relying parties, so that relying parties can not correlate their users. A subject is the
+	// HMAC-SHA256 of the audience and the identity ID, keyed with the secret configured at secrets.pairwise and
+	// formatted as a UUID. Subjects can not be reversed, which is why Resolve has to check every identity.
+	PairwiseSubjects struct {
+		c configuration.Provider
+		r pairwiseDependencies
+	}
+)
+
+var ErrUnknownAudience = herodot.ErrBadRequest.
+	WithReason("The audience is not allowed to request pairwise subject identifiers, see configuration key identity.pairwise.audiences.")
+
+func NewPairwiseSubjects(c configuration.Provider, r pairwiseDependencies) *PairwiseSubjects {
+	return &PairwiseSubjects{c: c, r: r}
+}
+
+// Subject returns the pairwise subject identifier of the identity for the audience.
+func (p *PairwiseSubjects) Subject(audience string, id uuid.UUID) (uuid.UUID, error) {
+	c := p.c.IdentityPairwise()
+	if !stringslice.Has(c.Audiences, audience) {
+		return uuid.Nil, errors.WithStack(ErrUnknownAudience)
+	}
+	if len(c.Secret) == 0 {
+		return uuid.Nil, errors.WithStack(herodot.ErrInternalServerError.
+			WithReason("Pairwise subject identifiers require a secret, see configuration key secrets.pairwise."))
+	}
+	return pairwiseSubject(c.Secret, audience, id), nil
+}
+
+// Resolve returns the identity whose pairwise subject identifier for the audience is subject. It loads all
+// identities in pages, so it is slow for large numbers of identities and only meant for admins.
+func (p *PairwiseSubjects) Resolve(ctx context.Context, audience string, subject uuid.UUID) (*Identity, error) {
+	c := p.c.IdentityPairwise()
+	if _, err := p.Subject(audience, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	after := uuid.Nil
+	for {
+		is, err := p.r.IdentityPool().ListIdentitiesAfter(ctx, after, pairwisePageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for k := range is {
+			if pairwiseSubject(c.Secret, audience, is[k].ID) == subject {
+				return &is[k], nil
+			}
+		}
+
+		if len(is) < pairwisePageSize {
+			return nil, errors.WithStack(sqlcon.ErrNoRows)
+		}
+		after = is[len(is)-1].ID
+	}
+}
+
+func pairwiseSubject(secret []byte, audience string, id uuid.UUID) uuid.UUID {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(audience))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write(id.Bytes())
+
+	var subject uuid.UUID
+	copy(subject[:], mac.Sum(nil))
+	subject.SetVersion(uuid.V5)
+	subject.SetVariant(uuid.VariantRFC4122)
+	return subject
+}
@@ -0,0 +1,74 @@
+package identity_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+)
+
+func TestPairwiseSubjects(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	viper.Set(configuration.ViperKeyIdentityPairwiseAudiences, []string{"billing", "forum"})
+	viper.Set(configuration.ViperKeySecretsPairwise, "pairwise-secret-0123456789")
+
+	var is []*identity.Identity
+	for k := 0; k < 3; k++ {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		is = append(is, i)
+	}
+	p := reg.PairwiseSubjects()
+
+	t.Run("case=subjects are stable per audience", func(t *testing.T) {
+		billing, err := p.Subject("billing", is[0].ID)
+		require.NoError(t, err)
+		again, err := p.Subject("billing", is[0].ID)
+		require.NoError(t, err)
+		forum, err := p.Subject("forum", is[0].ID)
+		require.NoError(t, err)
+		other, err := p.Subject("billing", is[1].ID)
+		require.NoError(t, err)
+
+		assert.Equal(t, billing, again)
+		assert.NotEqual(t, billing, forum)
+		assert.NotEqual(t, billing, other)
+		assert.NotEqual(t, is[0].ID, billing)
+		assert.EqualValues(t, uuid.V5, billing.Version())
+	})
+
+	t.Run("case=rejects unknown audiences", func(t *testing.T) {
+		_, err := p.Subject("tracker", is[0].ID)
+		assert.Equal(t, identity.ErrUnknownAudience, errorsx.Cause(err))
+	})
+
+	t.Run("case=resolves subjects", func(t *testing.T) {
+		for _, i := range is {
+			subject, err := p.Subject("forum", i.ID)
+			require.NoError(t, err)
+
+			actual, err := p.Resolve(context.Background(), "forum", subject)
+			require.NoError(t, err)
+			assert.Equal(t, i.ID, actual.ID)
+		}
+	})
+
+	t.Run("case=does not resolve subjects of other audiences", func(t *testing.T) {
+		subject, err := p.Subject("billing", is[0].ID)
+		require.NoError(t, err)
+
+		_, err = p.Resolve(context.Background(), "forum", subject)
+		assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+	})
+}
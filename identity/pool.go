@@ -30,6 +30,10 @@ type (
 	Pool interface {
 		ListIdentities(ctx context.Context, limit, offset int) ([]Identity, error)
 
+		// ListIdentitiesAfter returns up to limit identities with an ID greater than after, ordered by their ID.
+		// Unlike offsets, the last ID of a page stays a valid cursor while identities are created and deleted.
+		ListIdentitiesAfter(ctx context.Context, after uuid.UUID, limit int) ([]Identity, error)
+
 		// Get returns an identity by its id. Will return an error if the identity does not exist or backend
 		// connectivity is broken.
 		GetIdentity(context.Context, uuid.UUID) (*Identity, error)
@@ -39,6 +43,9 @@ type (
 
 		// FindAddressByValue returns a matching address or sql.ErrNoRows if no address could be found.
 		FindAddressByValue(ctx context.Context, via VerifiableAddressType, address string) (*VerifiableAddress, error)
+
+		// FindRedemption returns the redemption of the code or sqlcon.ErrNoRows if it was not redeemed.
+		FindRedemption(ctx context.Context, kind RedemptionKind, code string) (*Redemption, error)
 	}
 
 	PoolProvider interface {
@@ -55,12 +62,18 @@ type (
 		// FindByCredentialsIdentifier returns an identity by querying for it's credential identifiers.
 		FindByCredentialsIdentifier(ctx context.Context, ct CredentialsType, match string) (*Identity, *Credentials, error)
 
+		// BackfillCredentialIdentifiers fills in the lookup data of up to limit credential identifiers which were
+		// stored by a previous release and returns how many it filled in.
+		BackfillCredentialIdentifiers(ctx context.Context, limit int) (int, error)
+
 		// Delete removes an identity by its id. Will return an error
 		// if identity exists, backend connectivity is broken, or trait validation fails.
 		DeleteIdentity(context.Context, uuid.UUID) error
 
-		// VerifyAddress verifies an address by the given code.
-		VerifyAddress(ctx context.Context, code string) error
+		// VerifyAddress verifies an address by the given code and records who redeemed it. Concurrent calls with
+		// the same code verify the address once. It returns ErrAlreadyRedeemed if the code was redeemed before and
+		// sqlcon.ErrNoRows if the code is unknown or expired.
+		VerifyAddress(ctx context.Context, code string, by Redeemer) error
 
 		// UpdateVerifiableAddress
 		UpdateVerifiableAddress(ctx context.Context, address *VerifiableAddress) error
@@ -74,6 +87,28 @@ type (
 
 		// GetClassified returns the identity including it's raw credentials. This should only be used internally.
 		GetIdentityConfidential(context.Context, uuid.UUID) (*Identity, error)
+
+		// MergeIdentity updates the target of the merge, transfers the sessions of the source to it, deletes the
+		// source and records the merge. It sets the number of transferred sessions.
+		MergeIdentity(ctx context.Context, target *Identity, m *Merge) error
+
+		// ListIdentityMerges returns the merges into the identity, newest first.
+		ListIdentityMerges(ctx context.Context, target uuid.UUID) ([]Merge, error)
+
+		// FindIdentityMergeBySource returns the merge of the identity into another one, or sqlcon.ErrNoRows if it
+		// was not merged.
+		FindIdentityMergeBySource(ctx context.Context, source uuid.UUID) (*Merge, error)
+
+		// GetIdentityMetadata returns the metadata of the identity, which is an empty object if none was set.
+		GetIdentityMetadata(ctx context.Context, id uuid.UUID) (MetadataObject, error)
+
+		// UpdateIdentityMetadata replaces the metadata of the identity. It returns sqlcon.ErrNoRows if the
+		// identity does not exist.
+		UpdateIdentityMetadata(ctx context.Context, id uuid.UUID, metadata MetadataObject) error
+
+		// CreateRedemption records the redemption of a single-use code which is not stored by ORY Kratos, for
+		// example the signature of a webhook call. It returns ErrAlreadyRedeemed if the code was redeemed before.
+		CreateRedemption(ctx context.Context, r *Redemption) error
 	}
 )
 
@@ -339,6 +374,76 @@ func TestPool(p PrivilegedPool) func(t *testing.T) {
 			createdIDs = append(createdIDs, expected.ID)
 		})
 
+		t.Run("case=merge identities", func(t *testing.T) {
+			target := passwordIdentity("", "merge-target@ory.sh")
+			require.NoError(t, p.CreateIdentity(context.Background(), target))
+			createdIDs = append(createdIDs, target.ID)
+
+			source := oidcIdentity("", "merge-source-oidc")
+			require.NoError(t, p.CreateIdentity(context.Background(), source))
+
+			target, err := p.GetIdentityConfidential(context.Background(), target.ID)
+			require.NoError(t, err)
+			target.SetCredentials(CredentialsTypeOIDC, source.Credentials[CredentialsTypeOIDC])
+
+			m := &Merge{
+				ID: x.NewUUID(), SourceID: source.ID, TargetID: target.ID,
+				ConflictPolicy: MergeConflictPolicyFail,
+				Credentials:    MergeValues{string(CredentialsTypeOIDC)},
+				Addresses:      MergeValues{},
+				Conflicts:      MergeConflicts{},
+				CreatedAt:      time.Now().UTC().Round(time.Second),
+			}
+			require.NoError(t, p.MergeIdentity(context.Background(), target, m))
+
+			_, err = p.GetIdentity(context.Background(), source.ID)
+			require.Error(t, err)
+
+			actual, creds, err := p.FindByCredentialsIdentifier(context.Background(), CredentialsTypeOIDC, "merge-source-oidc")
+			require.NoError(t, err)
+			assert.Equal(t, target.ID, actual.ID)
+			assert.Equal(t, []string{"merge-source-oidc"}, creds.Identifiers)
+
+			actual, _, err = p.FindByCredentialsIdentifier(context.Background(), CredentialsTypePassword, "merge-target@ory.sh")
+			require.NoError(t, err)
+			assert.Equal(t, target.ID, actual.ID)
+
+			found, err := p.FindIdentityMergeBySource(context.Background(), source.ID)
+			require.NoError(t, err)
+			assert.Equal(t, target.ID, found.TargetID)
+			assert.Equal(t, MergeValues{string(CredentialsTypeOIDC)}, found.Credentials)
+
+			_, err = p.FindIdentityMergeBySource(context.Background(), target.ID)
+			require.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+
+			ms, err := p.ListIdentityMerges(context.Background(), target.ID)
+			require.NoError(t, err)
+			require.Len(t, ms, 1)
+			assert.Equal(t, m.ID, ms[0].ID)
+
+			m.ID = x.NewUUID()
+			require.Error(t, p.MergeIdentity(context.Background(), target, m), "the source no longer exists")
+		})
+
+		t.Run("case=metadata", func(t *testing.T) {
+			i := passwordIdentity("", "metadata@ory.sh")
+			require.NoError(t, p.CreateIdentity(context.Background(), i))
+			createdIDs = append(createdIDs, i.ID)
+
+			actual, err := p.GetIdentityMetadata(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{}`, string(actual))
+
+			require.NoError(t, p.UpdateIdentityMetadata(context.Background(), i.ID, MetadataObject(`{"plan":"free"}`)))
+			require.NoError(t, p.UpdateIdentityMetadata(context.Background(), i.ID, MetadataObject(`{"plan":"enterprise"}`)))
+			actual, err = p.GetIdentityMetadata(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"plan":"enterprise"}`, string(actual))
+
+			err = p.UpdateIdentityMetadata(context.Background(), x.NewUUID(), MetadataObject(`{}`))
+			require.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
+
 		t.Run("case=list", func(t *testing.T) {
 			is, err := p.ListIdentities(context.Background(), 25, 0)
 			require.NoError(t, err)
@@ -354,6 +459,31 @@ func TestPool(p PrivilegedPool) func(t *testing.T) {
 			}
 		})
 
+		t.Run("case=list after cursor", func(t *testing.T) {
+			var seen []uuid.UUID
+			var after uuid.UUID
+			for {
+				is, err := p.ListIdentitiesAfter(context.Background(), after, 2)
+				require.NoError(t, err)
+				if len(is) == 0 {
+					break
+				}
+
+				assert.True(t, len(is) <= 2)
+				for _, i := range is {
+					assert.True(t, i.ID.String() > after.String(), "%s must come after %s", i.ID, after)
+					assert.NotEmpty(t, i.TraitsSchemaURL)
+					seen = append(seen, i.ID)
+					after = i.ID
+				}
+			}
+
+			assert.Len(t, seen, len(createdIDs))
+			for _, id := range createdIDs {
+				assert.Contains(t, seen, id)
+			}
+		})
+
 		t.Run("case=find identity by its credentials identifier", func(t *testing.T) {
 			expected := passwordIdentity("", "find-credentials-identifier@ory.sh")
 			expected.Traits = Traits(`{}`)
@@ -374,6 +504,39 @@ func TestPool(p PrivilegedPool) func(t *testing.T) {
 			assertEqual(t, expected, actual)
 		})
 
+		t.Run("case=find identity by its credentials identifier regardless of the case of email addresses", func(t *testing.T) {
+			email := passwordIdentity("", "Find-Case-Insensitive@ory.sh")
+			email.Traits = Traits(`{}`)
+			require.NoError(t, p.CreateIdentity(context.Background(), email))
+			createdIDs = append(createdIDs, email.ID)
+
+			actual, _, err := p.FindByCredentialsIdentifier(context.Background(), CredentialsTypePassword, "FIND-case-insensitive@ORY.sh")
+			require.NoError(t, err)
+			assert.Equal(t, email.ID, actual.ID)
+
+			username := passwordIdentity("", "FindCaseSensitive")
+			username.Traits = Traits(`{}`)
+			require.NoError(t, p.CreateIdentity(context.Background(), username))
+			createdIDs = append(createdIDs, username.ID)
+
+			actual, _, err = p.FindByCredentialsIdentifier(context.Background(), CredentialsTypePassword, "FindCaseSensitive")
+			require.NoError(t, err)
+			assert.Equal(t, username.ID, actual.ID)
+
+			_, _, err = p.FindByCredentialsIdentifier(context.Background(), CredentialsTypePassword, "findcasesensitive")
+			require.Error(t, err)
+
+			subject := oidcIdentity("", "google:CaseSensitiveSubject")
+			subject.Traits = Traits(`{}`)
+			require.NoError(t, p.CreateIdentity(context.Background(), subject))
+			createdIDs = append(createdIDs, subject.ID)
+
+			_, _, err = p.FindByCredentialsIdentifier(context.Background(), CredentialsTypeOIDC, "google:casesensitivesubject")
+			require.Error(t, err)
+			_, _, err = p.FindByCredentialsIdentifier(context.Background(), CredentialsTypePassword, "google:CaseSensitiveSubject")
+			require.Error(t, err, "identifiers are resolved per credentials type")
+		})
+
 		t.Run("suite=address", func(t *testing.T) {
 			createIdentityWithAddresses := func(t *testing.T, expiry time.Duration, email string) VerifiableAddress {
 				var i Identity
@@ -433,18 +596,20 @@ func TestPool(p PrivilegedPool) func(t *testing.T) {
 				}
 			})
 
+			by := Redeemer{IPAddress: "192.0.2.1", UserAgent: "verify-test-agent"}
+
 			t.Run("case=verify expired should not work", func(t *testing.T) {
 				address := createIdentityWithAddresses(t, -time.Minute, "verify.TestPersister.VerifyAddress.expired@ory.sh")
-				require.EqualError(t, errorsx.Cause(p.VerifyAddress(context.Background(), address.Code)), sqlcon.ErrNoRows.Error())
+				require.EqualError(t, errorsx.Cause(p.VerifyAddress(context.Background(), address.Code, by)), sqlcon.ErrNoRows.Error())
 			})
 
 			t.Run("case=create and verify", func(t *testing.T) {
-				require.EqualError(t, errorsx.Cause(p.VerifyAddress(context.Background(), "i-do-not-exist")), sqlcon.ErrNoRows.Error())
+				require.EqualError(t, errorsx.Cause(p.VerifyAddress(context.Background(), "i-do-not-exist", by)), sqlcon.ErrNoRows.Error())
 			})
 
 			t.Run("case=create and verify", func(t *testing.T) {
 				address := createIdentityWithAddresses(t, time.Minute, "verify.TestPersister.VerifyAddress.valid@ory.sh")
-				require.NoError(t, p.VerifyAddress(context.Background(), address.Code))
+				require.NoError(t, p.VerifyAddress(context.Background(), address.Code, by))
 
 				actual, err := p.FindAddressByValue(context.Background(), address.Via, address.Value)
 				require.NoError(t, err)
@@ -452,6 +617,27 @@ func TestPool(p PrivilegedPool) func(t *testing.T) {
 				assert.True(t, actual.Verified)
 				assert.EqualValues(t, VerifiableAddressStatusCompleted, actual.Status)
 				assert.NotEmpty(t, actual.VerifiedAt)
+
+				redemption, err := p.FindRedemption(context.Background(), RedemptionKindVerification, address.Code)
+				require.NoError(t, err)
+				assert.Equal(t, address.IdentityID, redemption.IdentityID)
+				assert.Equal(t, "192.0.2.1", redemption.IPAddress)
+				assert.Equal(t, "verify-test-agent", redemption.UserAgent)
+
+				_, err = p.FindRedemption(context.Background(), RedemptionKindActionToken, address.Code)
+				require.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err), "redemptions are looked up per kind")
+			})
+
+			t.Run("case=verifying twice is a replay", func(t *testing.T) {
+				address := createIdentityWithAddresses(t, time.Minute, "verify.TestPersister.VerifyAddress.replay@ory.sh")
+				require.NoError(t, p.VerifyAddress(context.Background(), address.Code, by))
+
+				err := p.VerifyAddress(context.Background(), address.Code, Redeemer{IPAddress: "198.51.100.7"})
+				assert.Equal(t, &ErrAlreadyRedeemed, errorsx.Cause(err))
+
+				redemption, err := p.FindRedemption(context.Background(), RedemptionKindVerification, address.Code)
+				require.NoError(t, err)
+				assert.True(t, redemption.RedeemedBy(by), "the first redemption is kept")
 			})
 
 			t.Run("case=update", func(t *testing.T) {
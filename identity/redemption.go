@@ -0,0 +1,106 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+const (
+	RedemptionKindVerification RedemptionKind = "verification"
+	RedemptionKindActionToken  RedemptionKind = "action_token"
+
+	// AlreadyRedeemedErrorID is set as the "error_id" detail of errors caused by redeeming a code a second time.
+	AlreadyRedeemedErrorID = "code_already_redeemed"
+
+	maxRedeemerUserAgentLength = 255
+)
+
+// ErrAlreadyRedeemed is returned if a single-use code or token was redeemed before. Unlike sqlcon.ErrNoRows,
+// which is returned for unknown and expired codes, it means that the code was valid and might have leaked.
+var ErrAlreadyRedeemed = herodot.DefaultError{
+	CodeField:   http.StatusBadRequest,
+	StatusField: http.StatusText(http.StatusBadRequest),
+	ErrorField:  "This code was already used. Please request another code.",
+	DetailsField: map[string]interface{}{
+		"error_id": AlreadyRedeemedErrorID,
+	},
+}
+
+type (
+	// RedemptionKind is the kind of code that was redeemed. It must not exceed 32 characters as that is the
+	// limitation in the SQL Schema.
+	RedemptionKind string
+
+	// Redeemer is the client which redeems a code.
+	Redeemer struct {
+		IPAddress string
+		UserAgent string
+	}
+
+	// Redemption records that a single-use code of an identity was redeemed and by whom, so that a second
+	// attempt can be told apart from an invalid code and reported to the identity. Only a hash of the code is
+	// stored.
+	Redemption struct {
+		ID         uuid.UUID      `json:"-" faker:"uuid" db:"id"`
+		IdentityID uuid.UUID      `json:"-" faker:"uuid" db:"identity_id"`
+		Kind       RedemptionKind `json:"-" db:"kind"`
+		CodeHash   string         `json:"-" db:"code_hash"`
+		IPAddress  string         `json:"-" db:"ip_address"`
+		UserAgent  string         `json:"-" db:"user_agent"`
+		// CreatedAt is the time (UTC) the code was redeemed.
+		CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+)
+
+// NewRedeemer returns the client which sent the request.
+func NewRedeemer(r *http.Request) Redeemer {
+	var ip string
+	if addr := x.ClientIP(r); addr != nil {
+		ip = addr.String()
+	}
+
+	ua := r.UserAgent()
+	if len(ua) > maxRedeemerUserAgentLength {
+		ua = ua[:maxRedeemerUserAgentLength]
+	}
+
+	return Redeemer{IPAddress: ip, UserAgent: ua}
+}
+
+// NewRedemption records that the redeemer redeemed the code of the identity.
+func NewRedemption(kind RedemptionKind, code string, identityID uuid.UUID, by Redeemer) *Redemption {
+	return &Redemption{
+		ID:         x.NewUUID(),
+		IdentityID: identityID,
+		Kind:       kind,
+		CodeHash:   RedemptionCodeHash(kind, code),
+		IPAddress:  by.IPAddress,
+		UserAgent:  by.UserAgent,
+	}
+}
+
+func (r Redemption) TableName() string {
+	return "identity_redemptions"
+}
+
+// RedeemedBy returns true if the redeemer redeemed the code, for example because the user opened the same link
+// twice.
+func (r *Redemption) RedeemedBy(by Redeemer) bool {
+	return r.IPAddress == by.IPAddress && r.UserAgent == by.UserAgent
+}
+
+// RedemptionCodeHash returns the hash under which the redemption of the code is stored.
+func RedemptionCodeHash(kind RedemptionKind, code string) string {
+	h := sha256.Sum256([]byte(string(kind) + "\n" + code))
+	return hex.EncodeToString(h[:])
+}
@@ -36,7 +36,7 @@ func NewValidator(d validatorDependencies, c configuration.Provider) *Validator
 func (v *Validator) ValidateWithRunner(i *Identity, runners ...schema.Extension) error {
 	runner, err := schema.NewExtensionRunner(
 		schema.ExtensionRunnerIdentityMetaSchema,
-		runners...,
+		append([]schema.Extension{schema.NewFormatExtension()}, runners...)...,
 	)
 	if err != nil {
 		return err
@@ -61,9 +61,12 @@ func (v *Validator) ValidateWithRunner(i *Identity, runners ...schema.Extension)
 	return err
 }
 
-func (v *Validator) Validate(i *Identity) error {
-	return v.ValidateWithRunner(i,
+// Validate validates the identity's traits, including that uploaded files belong to it, and sets its credential
+// identifiers and verifiable addresses. The extensions are run in addition to the ones doing that.
+func (v *Validator) Validate(i *Identity, extensions ...schema.Extension) error {
+	return v.ValidateWithRunner(i, append([]schema.Extension{
 		NewSchemaExtensionCredentials(i),
 		NewSchemaExtensionVerify(i, v.c.SelfServiceVerificationLinkLifespan()),
-	)
+		NewSchemaExtensionUpload(i),
+	}, extensions...)...)
 }
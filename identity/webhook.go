@@ -0,0 +1,235 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/fetcher"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// WebhookPath is the path of the inbound identity webhook on the public API.
+	WebhookPath = "/hooks/identity"
+
+	// webhookSignatureTolerance is how old the signature of a webhook call may be.
+	webhookSignatureTolerance = time.Minute * 5
+
+	// RedemptionKindWebhook records the webhook calls which were processed, so that they can not be replayed.
+	RedemptionKindWebhook RedemptionKind = "identity_webhook"
+
+	// maxWebhookBodySize limits the size of the webhook payload.
+	maxWebhookBodySize = 1 << 20
+)
+
+type (
+	webhookDependencies interface {
+		PoolProvider
+		PrivilegedPoolProvider
+		ManagementProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	WebhookHandlerProvider interface {
+		IdentityWebhookHandler() *WebhookHandler
+	}
+
+	// WebhookHandler lets external systems, for example billing or HR systems, update some traits and metadata of
+	// identities without access to the admin API. Callers sign their requests with their own secrets, see
+	// x.SignatureHeader. The Jsonnet snippet of the caller receives the request body as
+	// `std.extVar('payload')` and returns the ID of the identity and the traits and metadata to set, for example:
+	//
+	//	local payload = std.extVar('payload');
+	//	{
+	//	  identity_id: payload.customer.external_id,
+	//	  traits: { plan: payload.subscription.plan },
+	//	  metadata: { stripe: { customer_id: payload.customer.id } },
+	//	}
+	//
+	// Only the traits and metadata at the caller's allowed paths are changed, all others are ignored. Traits which
+	// are used as credentials identifiers or verifiable addresses can not be changed at all.
+	//
+	// Each signed request is processed once. A request which is sent again with the same signature timestamp
+	// and body is rejected, so callers which retry or send the same change twice must sign the request again.
+	WebhookHandler struct {
+		c configuration.Provider
+		r webhookDependencies
+	}
+
+	// webhookMapping is the result of the Jsonnet snippet of a caller.
+	webhookMapping struct {
+		IdentityID string          `json:"identity_id"`
+		Traits     json.RawMessage `json:"traits"`
+		Metadata   json.RawMessage `json:"metadata"`
+	}
+)
+
+func NewWebhookHandler(c configuration.Provider, r webhookDependencies) *WebhookHandler {
+	return &WebhookHandler{c: c, r: r}
+}
+
+func (h *WebhookHandler) RegisterPublicRoutes(public *x.RouterPublic) {
+	public.POST(WebhookPath, h.update)
+}
+
+func (h *WebhookHandler) update(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to read the request body: %s", err)))
+		return
+	}
+
+	caller, err := h.authenticate(r, body)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	m, err := h.mapPayload(r, caller, body)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	i, err := h.r.IdentityPool().GetIdentity(r.Context(), x.ParseUUID(m.IdentityID))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	pool, ok := h.r.PrivilegedIdentityPool().(transactionalPool)
+	if !ok {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrInternalServerError.WithReason("The identity pool does not support transactions.")))
+		return
+	}
+
+	// The call is recorded in the transaction which applies it, so that calls which fail can be sent again.
+	if err := pool.InTransaction(r.Context(), func(ctx context.Context) error {
+		if err := h.r.PrivilegedIdentityPool().CreateRedemption(ctx, NewRedemption(RedemptionKindWebhook, webhookCallID(caller, r, body), i.ID, NewRedeemer(r))); err != nil {
+			return err
+		}
+		return h.apply(ctx, caller, i, m)
+	}); err != nil {
+		if errorsx.Cause(err) == &ErrAlreadyRedeemed {
+			x.ContextLogger(r.Context(), h.r.Logger()).WithField("caller", caller.ID).Warn("A call of the identity webhook was replayed.")
+			err = errors.WithStack(herodot.ErrUnauthorized.WithReason("The request was processed already."))
+		}
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("caller", caller.ID).
+		WithField("identity_id", i.ID).
+		Info("An identity was updated using the identity webhook.")
+
+	// The identity is not returned because callers must not learn more than they sent.
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apply sets the traits and metadata at the caller's allowed paths.
+func (h *WebhookHandler) apply(ctx context.Context, caller *configuration.IdentityWebhookCaller, i *Identity, m *webhookMapping) error {
+	traits, err := patch(i.Traits, m.Traits, caller.AllowedTraits)
+	if err != nil {
+		return err
+	} else if err := h.r.IdentityManager().UpdateTraits(ctx, i.ID, Traits(traits)); err != nil {
+		return err
+	}
+
+	if len(caller.AllowedMetadata) == 0 {
+		return nil
+	}
+
+	metadata, err := h.r.PrivilegedIdentityPool().GetIdentityMetadata(ctx, i.ID)
+	if err != nil {
+		return err
+	}
+
+	patched, err := patch(metadata, m.Metadata, caller.AllowedMetadata)
+	if err != nil {
+		return err
+	}
+	return h.r.IdentityManager().UpdateMetadata(ctx, i.ID, MetadataObject(patched))
+}
+
+// patch copies the values at the allowed paths from the values returned by the mapper to the stored document.
+func patch(stored, values []byte, allowed []string) ([]byte, error) {
+	patched := stored
+	for _, path := range allowed {
+		value := gjson.GetBytes(values, path)
+		if !value.Exists() {
+			continue
+		}
+
+		var err error
+		if patched, err = sjson.SetRawBytes(patched, path, []byte(value.Raw)); err != nil {
+			return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to set %s: %s", path, err))
+		}
+	}
+	return patched, nil
+}
+
+// webhookCallID identifies a signed call of the identity webhook. The signature is not used because the same
+// call could be signed with several secrets.
+func webhookCallID(caller *configuration.IdentityWebhookCaller, r *http.Request, body []byte) string {
+	h := sha256.Sum256(body)
+	return caller.ID + "\n" + x.SignatureTimestamp(r.Header.Get(x.SignatureHeader)) + "\n" + hex.EncodeToString(h[:])
+}
+
+// authenticate returns the caller whose secrets verify the signature of the request.
+func (h *WebhookHandler) authenticate(r *http.Request, body []byte) (*configuration.IdentityWebhookCaller, error) {
+	signature := r.Header.Get(x.SignatureHeader)
+	if len(signature) == 0 {
+		return nil, errors.WithStack(herodot.ErrUnauthorized.WithReasonf("The request must be signed using the %s header.", x.SignatureHeader))
+	}
+
+	callers := h.c.IdentityWebhookCallers()
+	for k := range callers {
+		if x.VerifySignature(signature, body, callers[k].Secrets, webhookSignatureTolerance, time.Now()) == nil {
+			return &callers[k], nil
+		}
+	}
+	return nil, errors.WithStack(herodot.ErrUnauthorized.WithReason("The signature of the request is invalid or expired."))
+}
+
+func (h *WebhookHandler) mapPayload(r *http.Request, caller *configuration.IdentityWebhookCaller, body []byte) (*webhookMapping, error) {
+	if !json.Valid(body) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The request body must be JSON."))
+	}
+
+	snippet, err := fetcher.Default.Fetch(r.Context(), caller.MapperURL)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to load the Jsonnet mapper of caller %s: %s", caller.ID, err))
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.ExtCode("payload", string(body))
+	evaluated, err := vm.EvaluateSnippet(caller.MapperURL, string(snippet))
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to map the request body: %s", err))
+	}
+
+	var m webhookMapping
+	if err := json.Unmarshal([]byte(evaluated), &m); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The Jsonnet mapper of caller %s must return an object with identity_id and traits: %s", caller.ID, err))
+	}
+	if x.IsZeroUUID(x.ParseUUID(m.IdentityID)) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The request body does not contain a valid identity ID."))
+	}
+	return &m, nil
+}
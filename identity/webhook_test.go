@@ -0,0 +1,140 @@
+package identity_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/x"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/manager.schema.json")
+
+	router := x.NewRouterPublic()
+	reg.IdentityWebhookHandler().RegisterPublicRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	secret := "billing-secret-0123456789"
+	setCaller := func(allowedTraits []string) {
+		viper.Set(configuration.ViperKeyHooksIdentityCallers, []map[string]interface{}{{
+			"id":      "billing",
+			"secrets": []string{secret},
+			"mapper_url": "base64://" + base64.StdEncoding.EncodeToString([]byte(`
+local payload = std.extVar('payload');
+{
+  identity_id: payload.customer,
+  traits: { unprotected: payload.plan, email: payload.email },
+  metadata: { billing: { customer: payload.customer_id, internal: 'ignored' } },
+}`)),
+			"allowed_traits":   allowedTraits,
+			"allowed_metadata": []string{"billing.customer"},
+		}})
+	}
+	setCaller([]string{"unprotected"})
+
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	i.Traits = identity.Traits(`{"email":"webhook@ory.sh","unprotected":"free"}`)
+	require.NoError(t, reg.IdentityManager().Create(context.Background(), i))
+
+	call := func(t *testing.T, signature string, body []byte) (*http.Response, []byte) {
+		req, err := http.NewRequest("POST", ts.URL+identity.WebhookPath, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if len(signature) > 0 {
+			req.Header.Set(x.SignatureHeader, signature)
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, resBody
+	}
+
+	body := []byte(`{"customer":"` + i.ID.String() + `","customer_id":"cus_123","plan":"enterprise","email":"attacker@ory.sh"}`)
+
+	t.Run("case=rejects unsigned requests", func(t *testing.T) {
+		res, resBody := call(t, "", body)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "%s", resBody)
+	})
+
+	t.Run("case=rejects requests signed with an unknown secret", func(t *testing.T) {
+		res, resBody := call(t, x.Sign(body, []string{"unknown-secret-0123456789"}, time.Now()), body)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "%s", resBody)
+	})
+
+	t.Run("case=rejects expired signatures", func(t *testing.T) {
+		res, resBody := call(t, x.Sign(body, []string{secret}, time.Now().Add(-time.Hour)), body)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "%s", resBody)
+	})
+
+	t.Run("case=rejects payloads without identity", func(t *testing.T) {
+		body := []byte(`{"plan":"enterprise"}`)
+		res, resBody := call(t, x.Sign(body, []string{secret}, time.Now()), body)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "%s", resBody)
+	})
+
+	t.Run("case=failed requests can be sent again", func(t *testing.T) {
+		body := []byte(`{"customer":"` + i.ID.String() + `","customer_id":"cus_456","plan":5}`)
+		signature := x.Sign(body, []string{secret}, time.Now())
+
+		res, resBody := call(t, signature, body)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "%s", resBody)
+
+		metadata, err := reg.PrivilegedIdentityPool().GetIdentityMetadata(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.NotContains(t, string(metadata), "cus_456")
+
+		setCaller([]string{})
+		defer setCaller([]string{"unprotected"})
+
+		res, resBody = call(t, signature, body)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode, "%s", resBody)
+
+		metadata, err = reg.PrivilegedIdentityPool().GetIdentityMetadata(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"billing":{"customer":"cus_456"}}`, string(metadata))
+	})
+
+	signature := x.Sign(body, []string{secret}, time.Now())
+
+	t.Run("case=updates only the allowed traits and metadata", func(t *testing.T) {
+		res, resBody := call(t, signature, body)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode, "%s", resBody)
+
+		actual, err := reg.IdentityPool().GetIdentity(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "enterprise", gjson.GetBytes(actual.Traits, "unprotected").String(), "%s", actual.Traits)
+		assert.Equal(t, "webhook@ory.sh", gjson.GetBytes(actual.Traits, "email").String(), "%s", actual.Traits)
+
+		metadata, err := reg.PrivilegedIdentityPool().GetIdentityMetadata(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"billing":{"customer":"cus_123"}}`, string(metadata))
+	})
+
+	t.Run("case=rejects replayed requests", func(t *testing.T) {
+		res, resBody := call(t, signature, body)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "%s", resBody)
+
+		// Adding signatures to the header does not make the request new.
+		res, resBody = call(t, signature+",v1=00", body)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "%s", resBody)
+	})
+}
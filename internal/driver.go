@@ -34,7 +34,7 @@ func NewConfigurationWithDefaults() *configuration.ViperProvider {
 	return configuration.NewViperProvider(logrusx.New(), true)
 }
 
-func NewRegistryDefault(t *testing.T) (*configuration.ViperProvider, *driver.RegistryDefault) {
+func NewRegistryDefault(t testing.TB) (*configuration.ViperProvider, *driver.RegistryDefault) {
 	conf, reg := NewRegistryDefaultWithDSN(t, "")
 	reg.WithCSRFTokenGenerator(x.FakeCSRFTokenGenerator)
 	reg.WithCSRFHandler(x.NewFakeCSRFHandler(""))
@@ -42,7 +42,7 @@ func NewRegistryDefault(t *testing.T) (*configuration.ViperProvider, *driver.Reg
 	return conf, reg
 }
 
-func NewRegistryDefaultWithDSN(t *testing.T, dsn string) (*configuration.ViperProvider, *driver.RegistryDefault) {
+func NewRegistryDefaultWithDSN(t testing.TB, dsn string) (*configuration.ViperProvider, *driver.RegistryDefault) {
 	viper.Reset()
 	resetConfig()
 
@@ -14,6 +14,7 @@ import (
 	"github.com/go-openapi/runtime"
 	cr "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
 )
 
 // NewListIdentitiesParams creates a new ListIdentitiesParams object
@@ -59,6 +60,24 @@ func NewListIdentitiesParamsWithHTTPClient(client *http.Client) *ListIdentitiesP
 for the list identities operation typically these are written to a http.Request
 */
 type ListIdentitiesParams struct {
+
+	/*Identifier
+	  Identifier returns only the identity which uses this value as a login identifier, for example as the
+	identifier of its password credentials, or as a verifiable address.
+
+	*/
+	Identifier *string
+	/*Limit
+	  Limit is the maximum number of identities returned. It defaults to 100 and must not exceed 500.
+
+	*/
+	Limit *int64
+	/*Offset
+	  Offset is the number of identities to skip.
+
+	*/
+	Offset *int64
+
 	timeout    time.Duration
 	Context    context.Context
 	HTTPClient *http.Client
@@ -97,6 +116,39 @@ func (o *ListIdentitiesParams) SetHTTPClient(client *http.Client) {
 	o.HTTPClient = client
 }
 
+// WithIdentifier adds the identifier to the list identities params
+func (o *ListIdentitiesParams) WithIdentifier(identifier *string) *ListIdentitiesParams {
+	o.SetIdentifier(identifier)
+	return o
+}
+
+// SetIdentifier adds the identifier to the list identities params
+func (o *ListIdentitiesParams) SetIdentifier(identifier *string) {
+	o.Identifier = identifier
+}
+
+// WithLimit adds the limit to the list identities params
+func (o *ListIdentitiesParams) WithLimit(limit *int64) *ListIdentitiesParams {
+	o.SetLimit(limit)
+	return o
+}
+
+// SetLimit adds the limit to the list identities params
+func (o *ListIdentitiesParams) SetLimit(limit *int64) {
+	o.Limit = limit
+}
+
+// WithOffset adds the offset to the list identities params
+func (o *ListIdentitiesParams) WithOffset(offset *int64) *ListIdentitiesParams {
+	o.SetOffset(offset)
+	return o
+}
+
+// SetOffset adds the offset to the list identities params
+func (o *ListIdentitiesParams) SetOffset(offset *int64) {
+	o.Offset = offset
+}
+
 // WriteToRequest writes these params to a swagger request
 func (o *ListIdentitiesParams) WriteToRequest(r runtime.ClientRequest, reg strfmt.Registry) error {
 
@@ -105,6 +157,54 @@ func (o *ListIdentitiesParams) WriteToRequest(r runtime.ClientRequest, reg strfm
 	}
 	var res []error
 
+	if o.Identifier != nil {
+
+		// query param identifier
+		var qrIdentifier string
+		if o.Identifier != nil {
+			qrIdentifier = *o.Identifier
+		}
+		qIdentifier := qrIdentifier
+		if qIdentifier != "" {
+			if err := r.SetQueryParam("identifier", qIdentifier); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.Limit != nil {
+
+		// query param limit
+		var qrLimit int64
+		if o.Limit != nil {
+			qrLimit = *o.Limit
+		}
+		qLimit := swag.FormatInt64(qrLimit)
+		if qLimit != "" {
+			if err := r.SetQueryParam("limit", qLimit); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.Offset != nil {
+
+		// query param offset
+		var qrOffset int64
+		if o.Offset != nil {
+			qrOffset = *o.Offset
+		}
+		qOffset := swag.FormatInt64(qrOffset)
+		if qOffset != "" {
+			if err := r.SetQueryParam("offset", qOffset); err != nil {
+				return err
+			}
+		}
+
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -36,6 +36,11 @@ type Session struct {
 	// Format: date-time
 	IssuedAt *strfmt.DateTime `json:"issued_at"`
 
+	// PrivilegedUntil is the time (UTC) until which the session may be used for sensitive operations such as
+	// changing credentials. Afterwards, the user has to authenticate again using a login request with `refresh=true`.
+	// Format: date-time
+	PrivilegedUntil strfmt.DateTime `json:"privileged_until,omitempty"`
+
 	// sid
 	// Required: true
 	// Format: uuid4
@@ -62,6 +67,10 @@ func (m *Session) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validatePrivilegedUntil(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateSid(formats); err != nil {
 		res = append(res, err)
 	}
@@ -129,6 +138,19 @@ func (m *Session) validateIssuedAt(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *Session) validatePrivilegedUntil(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.PrivilegedUntil) { // not required
+		return nil
+	}
+
+	if err := validate.FormatOf("privileged_until", "body", "date-time", m.PrivilegedUntil.String(), formats); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (m *Session) validateSid(formats strfmt.Registry) error {
 
 	if err := m.Sid.Validate(formats); err != nil {
@@ -0,0 +1,182 @@
+// Package kratos runs ORY Kratos inside of another Go program. Instead of starting the kratos serve command, the
+// program creates an instance using New, mounts the public and admin handlers on its own router or server and runs
+// the background workers:
+//
+//	k, err := kratos.New(kratos.Config{
+//		Values: map[string]interface{}{
+//			"dsn": "postgres://...",
+//			"identity.traits.default_schema_url": "file:///etc/kratos/identity.schema.json",
+//		},
+//	})
+//	if err != nil {
+//		// ...
+//	}
+//	defer k.Close(context.Background())
+//
+//	go k.Run(ctx)
+//	mux.Handle("/", k.PublicHandler())
+//
+// The configuration is backed by the process-wide viper instance, which is why only one instance can exist at a
+// time. Call Close before creating another one.
+package kratos
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/logrusx"
+
+	"github.com/ory/kratos/cmd/daemon"
+	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/driver/configuration"
+)
+
+// Config configures an embedded instance.
+type Config struct {
+	// ConfigFile is the path of a configuration file in the format used by kratos serve. It is optional.
+	ConfigFile string
+
+	// Values are configuration values keyed like in the configuration file, for example "dsn" or
+	// "urls.self.public". They take precedence over the values of ConfigFile.
+	Values map[string]interface{}
+
+	// Logger is used for all log messages. A new logger is used if it is nil.
+	Logger *logrus.Logger
+
+	// Dev relaxes security checks in the same way as kratos serve --dev does. It must not be used in production.
+	Dev bool
+
+	// BuildVersion, BuildHash and BuildDate are reported by the version endpoint.
+	BuildVersion, BuildHash, BuildDate string
+}
+
+// Kratos is an embedded instance.
+type Kratos struct {
+	d       driver.Driver
+	public  http.Handler
+	admin   http.Handler
+	workers []daemon.Worker
+
+	runOnce sync.Once
+}
+
+var (
+	instanceLock sync.Mutex
+	instance     *Kratos
+)
+
+// New loads the configuration, connects to the database and returns the instance. It does not apply SQL
+// migrations, use Registry().Persister().MigrateUp for that.
+func New(c Config) (*Kratos, error) {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+
+	if instance != nil {
+		return nil, errors.New("only one instance can exist at a time, close the existing instance first")
+	}
+
+	l := c.Logger
+	if l == nil {
+		l = logrusx.New()
+	}
+
+	viper.Reset()
+	if len(c.ConfigFile) > 0 {
+		viper.SetConfigFile(c.ConfigFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, errors.Wrapf(err, "unable to read configuration file %s", c.ConfigFile)
+		}
+	}
+	for key, value := range c.Values {
+		viper.Set(key, value)
+	}
+
+	d, err := driver.NewDefaultDriver(l, c.BuildVersion, c.BuildHash, c.BuildDate, c.Dev)
+	if err != nil {
+		return nil, err
+	}
+
+	instance = &Kratos{
+		d:       d,
+		public:  daemon.NewPublicHandler(d),
+		admin:   daemon.NewAdminHandler(d),
+		workers: daemon.Workers(d),
+	}
+	return instance, nil
+}
+
+// Registry gives access to all services, for example to manage identities programmatically.
+func (k *Kratos) Registry() driver.Registry {
+	return k.d.Registry()
+}
+
+// Configuration returns the configuration of the instance.
+func (k *Kratos) Configuration() configuration.Provider {
+	return k.d.Configuration()
+}
+
+// PublicHandler serves the public API. It must be reachable at the public URL (urls.self.public).
+func (k *Kratos) PublicHandler() http.Handler {
+	return k.public
+}
+
+// AdminHandler serves the admin API. It must not be exposed to the public.
+func (k *Kratos) AdminHandler() http.Handler {
+	return k.admin
+}
+
+// Run runs the background workers, for example the courier which sends emails, until the context is done or a
+// worker fails. The workers are then shut down within the configured shutdown timeout. Run must not be called
+// more than once.
+func (k *Kratos) Run(ctx context.Context) error {
+	err := errors.New("the background workers of this instance were run before")
+	k.runOnce.Do(func() {
+		err = k.run(ctx)
+	})
+	return err
+}
+
+func (k *Kratos) run(ctx context.Context) error {
+	failed := make(chan error, len(k.workers))
+	for _, w := range k.workers {
+		go func(w daemon.Worker) {
+			if err := w.Work(); err != nil {
+				failed <- errors.Wrapf(err, "%s worker failed", w.Name)
+			}
+		}(w)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-failed:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), k.Configuration().ShutdownTimeout())
+	defer cancel()
+	for _, w := range k.workers {
+		if serr := w.Shutdown(shutdownCtx); serr != nil && err == nil {
+			err = errors.Wrapf(serr, "unable to shut down %s worker", w.Name)
+		}
+	}
+	return err
+}
+
+// Close stops custom strategies and closes the database connection pool. The handlers must not be used
+// afterwards.
+func (k *Kratos) Close(ctx context.Context) error {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+
+	if instance == k {
+		instance = nil
+	}
+
+	k.Registry().StopStrategies(ctx)
+	return k.Registry().Persister().Close(ctx)
+}
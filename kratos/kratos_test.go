@@ -0,0 +1,55 @@
+package kratos_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/healthx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/kratos"
+	"github.com/ory/kratos/x"
+)
+
+func TestNew(t *testing.T) {
+	k, err := kratos.New(kratos.Config{
+		Values: map[string]interface{}{
+			configuration.ViperKeyDSN:                            "sqlite3://" + filepath.Join(os.TempDir(), x.NewUUID().String()) + ".sql?mode=memory&_fk=true",
+			configuration.ViperKeyDefaultIdentityTraitsSchemaURL: "file://../stub/test-identity.schema.json",
+		},
+		Dev: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, k.Registry().Persister().MigrateUp(context.Background()))
+
+	_, err = kratos.New(kratos.Config{})
+	require.Error(t, err, "only one instance may exist at a time")
+
+	public := httptest.NewServer(k.PublicHandler())
+	defer public.Close()
+	admin := httptest.NewServer(k.AdminHandler())
+	defer admin.Close()
+
+	res, err := public.Client().Get(public.URL + healthx.AliveCheckPath)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = admin.Client().Get(admin.URL + identity.IdentitiesPath)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, k.Run(ctx))
+	require.Error(t, k.Run(context.Background()), "workers must only be run once")
+
+	require.NoError(t, k.Close(context.Background()))
+}
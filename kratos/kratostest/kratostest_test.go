@@ -0,0 +1,36 @@
+package kratostest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/kratos/kratostest"
+	"github.com/ory/kratos/sdk"
+)
+
+func TestServer(t *testing.T) {
+	k := kratostest.NewServer(t, kratostest.Config{})
+
+	i := k.CreateIdentity(map[string]interface{}{"email": "alice@example.org"}, "a-secure-password-123")
+	session, cookie := k.Login("alice@example.org", "a-secure-password-123")
+	assert.Equal(t, i.ID.String(), string(session.Identity.ID))
+
+	c, err := sdk.New(sdk.Config{
+		PublicURL:  k.PublicURL,
+		HTTPClient: &http.Client{Transport: &sdk.SessionCookieTransport{Session: cookie.Value, CookieName: cookie.Name}},
+	})
+	require.NoError(t, err)
+	whoami, err := c.Whoami(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, i.ID.String(), string(whoami.Identity.ID))
+
+	identity, err := k.Client.GetIdentity(context.Background(), i.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.org", identity.Traits.(map[string]interface{})["email"])
+
+	assert.Empty(t, k.Messages())
+}
@@ -0,0 +1,359 @@
+package maintenance
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/pagination"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	MaintenancePath = "/maintenance"
+	WriteLocksPath  = MaintenancePath + "/write-locks"
+
+	// WriteLockPath is appended to the path of an identity, see identity.IdentitiesPath.
+	WriteLockPath = "write-lock"
+
+	maxReasonLength = 255
+)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		GuardProvider
+		identity.PoolProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		MaintenanceHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(MaintenancePath, h.getMode)
+	admin.PUT(MaintenancePath, h.enable)
+	admin.DELETE(MaintenancePath, h.disable)
+
+	admin.GET(WriteLocksPath, h.listLocks)
+	admin.GET(identity.IdentitiesPath+"/:id/"+WriteLockPath, h.getLock)
+	admin.PUT(identity.IdentitiesPath+"/:id/"+WriteLockPath, h.lock)
+	admin.DELETE(identity.IdentitiesPath+"/:id/"+WriteLockPath, h.unlock)
+}
+
+// The global maintenance mode.
+//
+// swagger:response maintenanceMode
+// nolint:deadcode,unused
+type modeResponse struct {
+	// in: body
+	Body *Mode
+}
+
+// The write lock of an identity.
+//
+// swagger:response identityWriteLock
+// nolint:deadcode,unused
+type lockResponse struct {
+	// in: body
+	Body *Lock
+}
+
+// A list of identity write locks.
+//
+// swagger:response identityWriteLocks
+// nolint:deadcode,unused
+type locksResponse struct {
+	// in: body
+	Body []Lock
+}
+
+// swagger:model setMaintenanceReason
+type SetReason struct {
+	// Reason is shown to administrators only. It must not exceed 255 characters.
+	Reason string `json:"reason"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters enableMaintenanceMode
+type enableParameters struct {
+	// in: body
+	Body SetReason
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listIdentityWriteLocks
+type listLocksParameters struct {
+	// in: query
+	Page int `json:"page"`
+
+	// in: query
+	PerPage int `json:"per_page"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getIdentityWriteLock unlockIdentity
+type lockParameters struct {
+	// ID is the ID of the identity.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters lockIdentity
+type setLockParameters struct {
+	// ID is the ID of the identity.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	Body SetReason
+}
+
+// swagger:route GET /maintenance admin getMaintenanceMode
+//
+// Get the maintenance mode
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: maintenanceMode
+//       500: genericError
+func (h *Handler) getMode(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	m, err := h.r.MaintenancePersister().GetMaintenanceMode(r.Context())
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.MaintenanceGuard().SetMode(m)
+	h.r.Writer().Write(w, r, m)
+}
+
+// swagger:route PUT /maintenance admin enableMaintenanceMode
+//
+// Enable maintenance mode
+//
+// While maintenance mode is enabled, registration and changes of identities by their owners, for example updating
+// the profile, are rejected with status 503 and the error ID "maintenance_mode". Signing in, checking sessions,
+// signing out, and the admin API keep working. Enabling maintenance mode again updates the reason.
+//
+// Other instances of ORY Kratos pick up the change within a few seconds.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: maintenanceMode
+//       400: genericError
+//       500: genericError
+func (h *Handler) enable(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body, err := h.decodeReason(r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC().Round(time.Second)
+	m := &Mode{Enabled: true, Reason: body.Reason, EnabledAt: &now}
+	if err := h.r.MaintenancePersister().SetMaintenanceMode(r.Context(), m); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.MaintenanceGuard().SetMode(m)
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "maintenance_mode").
+		WithField("reason", m.Reason).
+		Info("Maintenance mode was enabled.")
+	h.r.Writer().Write(w, r, m)
+}
+
+// swagger:route DELETE /maintenance admin disableMaintenanceMode
+//
+// Disable maintenance mode
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       500: genericError
+func (h *Handler) disable(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := h.r.MaintenancePersister().DeleteMaintenanceMode(r.Context()); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.MaintenanceGuard().SetMode(&Mode{})
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "maintenance_mode").
+		Info("Maintenance mode was disabled.")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route GET /maintenance/write-locks admin listIdentityWriteLocks
+//
+// List the locked identities
+//
+// Returns the write locks, the most recently created first.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityWriteLocks
+//       500: genericError
+func (h *Handler) listLocks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	ls, err := h.r.MaintenancePersister().ListWriteLocks(r.Context(), limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, ls)
+}
+
+// swagger:route GET /identities/{id}/write-lock admin getIdentityWriteLock
+//
+// Get the write lock of an identity
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityWriteLock
+//       404: genericError
+//       500: genericError
+func (h *Handler) getLock(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	l, err := h.r.MaintenancePersister().GetWriteLock(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, l)
+}
+
+// swagger:route PUT /identities/{id}/write-lock admin lockIdentity
+//
+// Lock an identity
+//
+// Keeps the owner of the identity from changing it, for example during a fraud investigation. Changes are rejected
+// with status 403 and the error ID "identity_locked". The identity can still sign in, and administrators can still
+// change it. Locking an identity again updates the reason.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityWriteLock
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) lock(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := h.decodeReason(r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	i, err := h.r.IdentityPool().GetIdentity(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	l := &Lock{IdentityID: i.ID, Reason: body.Reason, CreatedAt: time.Now().UTC().Round(time.Second)}
+	if err := h.r.MaintenancePersister().SetWriteLock(r.Context(), l); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "identity_write_lock").
+		WithField("identity_id", l.IdentityID).
+		WithField("reason", l.Reason).
+		Info("An identity was locked.")
+	h.r.Writer().Write(w, r, l)
+}
+
+// swagger:route DELETE /identities/{id}/write-lock admin unlockIdentity
+//
+// Unlock an identity
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := x.ParseUUID(ps.ByName("id"))
+	if err := h.r.MaintenancePersister().DeleteWriteLock(r.Context(), id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "identity_write_lock").
+		WithField("identity_id", id).
+		Info("An identity was unlocked.")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) decodeReason(r *http.Request) (*SetReason, error) {
+	var body SetReason
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&body); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err))
+	}
+
+	if len(body.Reason) > maxReasonLength {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The reason must not exceed %d characters.", maxReasonLength))
+	}
+	return &body, nil
+}
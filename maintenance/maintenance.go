@@ -0,0 +1,151 @@
+package maintenance
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/form"
+)
+
+// modeCacheTTL is the time for which the global maintenance mode is cached. Changes made on another instance
+// take effect on this instance within this time.
+const modeCacheTTL = 5 * time.Second
+
+var (
+	// ErrMaintenance is returned by writes while maintenance mode is enabled.
+	ErrMaintenance = herodot.DefaultError{
+		CodeField:   http.StatusServiceUnavailable,
+		StatusField: http.StatusText(http.StatusServiceUnavailable),
+		ErrorField:  "maintenance mode is enabled",
+		ReasonField: "We are performing maintenance and can not save changes right now. Please try again later.",
+		DetailsField: map[string]interface{}{
+			errorx.DetailErrorID: form.ErrorIDMaintenanceMode,
+		},
+	}
+
+	ErrIdentityLocked = herodot.ErrForbidden.
+				WithError("the identity is locked").
+				WithReason("Your account can not be changed at the moment. Please contact an administrator.").
+				WithDetail(errorx.DetailErrorID, form.ErrorIDIdentityLocked)
+)
+
+type (
+	// Mode is the global maintenance mode. While it is enabled, registration and changes of identities by their
+	// owners are rejected, while signing in and checking sessions keep working.
+	//
+	// swagger:model maintenanceMode
+	Mode struct {
+		// required: true
+		Enabled bool `json:"enabled" db:"-"`
+
+		// Reason is shown to administrators only, for example "Database migration".
+		Reason string `json:"reason" db:"reason"`
+
+		// EnabledAt is the time (UTC) maintenance mode was enabled.
+		EnabledAt *time.Time `json:"enabled_at,omitempty" faker:"-" db:"created_at"`
+	}
+
+	// Lock keeps the owner of an identity from changing it, for example during a fraud investigation. The
+	// identity can still sign in, and administrators can still change it.
+	//
+	// swagger:model identityWriteLock
+	Lock struct {
+		// required: true
+		IdentityID uuid.UUID `json:"identity_id" faker:"uuid" db:"identity_id"`
+
+		// Reason is shown to administrators only, for example the ID of a support ticket.
+		Reason string `json:"reason" db:"reason"`
+
+		// CreatedAt is the time (UTC) the identity was locked.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+	}
+
+	guardDependencies interface {
+		PersistenceProvider
+	}
+	GuardProvider interface {
+		MaintenanceGuard() *Guard
+	}
+	// Guard rejects writes while maintenance mode is enabled or the identity is locked.
+	Guard struct {
+		r guardDependencies
+
+		mu        sync.Mutex
+		mode      *Mode
+		checkedAt time.Time
+	}
+)
+
+func (l Lock) TableName() string {
+	return "identity_write_locks"
+}
+
+func NewGuard(r guardDependencies) *Guard {
+	return &Guard{r: r}
+}
+
+// Mode returns the global maintenance mode, which is cached for modeCacheTTL.
+func (g *Guard) Mode(ctx context.Context) (*Mode, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.mode != nil && time.Since(g.checkedAt) < modeCacheTTL {
+		return g.mode, nil
+	}
+
+	m, err := g.r.MaintenancePersister().GetMaintenanceMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mode, g.checkedAt = m, time.Now()
+	return m, nil
+}
+
+// SetMode updates the cached maintenance mode after it was changed on this instance, so that the change takes
+// effect immediately.
+func (g *Guard) SetMode(m *Mode) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mode, g.checkedAt = m, time.Now()
+}
+
+// CheckRegistration returns ErrMaintenance while maintenance mode is enabled.
+func (g *Guard) CheckRegistration(ctx context.Context) error {
+	m, err := g.Mode(ctx)
+	if err != nil {
+		return err
+	}
+
+	if m.Enabled {
+		return errors.WithStack(&ErrMaintenance)
+	}
+	return nil
+}
+
+// CheckWrite returns ErrMaintenance while maintenance mode is enabled and ErrIdentityLocked if the identity is
+// locked. It must be called before the owner of an identity changes it.
+func (g *Guard) CheckWrite(ctx context.Context, identityID uuid.UUID) error {
+	if err := g.CheckRegistration(ctx); err != nil {
+		return err
+	}
+
+	if _, err := g.r.MaintenancePersister().GetWriteLock(ctx, identityID); err == nil {
+		return errors.WithStack(ErrIdentityLocked)
+	} else if errorsx.Cause(err) != sqlcon.ErrNoRows {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package maintenance_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	router := x.NewRouterAdmin()
+	reg.MaintenanceHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	i.Traits = identity.Traits(`{"email":"suspect@ory.sh"}`)
+	require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+	do := func(t *testing.T, method, path, body string, expectCode int, out interface{}) {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.EqualValues(t, expectCode, res.StatusCode)
+
+		if out != nil {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+		}
+	}
+
+	lockPath := identity.IdentitiesPath + "/" + i.ID.String() + "/" + WriteLockPath
+
+	t.Run("case=maintenance mode", func(t *testing.T) {
+		var m Mode
+		do(t, "GET", MaintenancePath, "", http.StatusOK, &m)
+		assert.False(t, m.Enabled)
+		require.NoError(t, reg.MaintenanceGuard().CheckRegistration(context.Background()))
+
+		do(t, "PUT", MaintenancePath, `{"reason":"database migration"}`, http.StatusOK, &m)
+		assert.True(t, m.Enabled)
+		assert.Equal(t, "database migration", m.Reason)
+		assert.NotNil(t, m.EnabledAt)
+
+		m = Mode{}
+		do(t, "GET", MaintenancePath, "", http.StatusOK, &m)
+		assert.True(t, m.Enabled)
+		assert.Equal(t, "database migration", m.Reason)
+
+		assert.Equal(t, &ErrMaintenance, errors.Cause(reg.MaintenanceGuard().CheckRegistration(context.Background())))
+		assert.Equal(t, &ErrMaintenance, errors.Cause(reg.MaintenanceGuard().CheckWrite(context.Background(), i.ID)))
+
+		do(t, "DELETE", MaintenancePath, "", http.StatusNoContent, nil)
+		do(t, "DELETE", MaintenancePath, "", http.StatusNoContent, nil)
+		do(t, "GET", MaintenancePath, "", http.StatusOK, &m)
+		assert.False(t, m.Enabled)
+
+		require.NoError(t, reg.MaintenanceGuard().CheckRegistration(context.Background()))
+		require.NoError(t, reg.MaintenanceGuard().CheckWrite(context.Background(), i.ID))
+	})
+
+	t.Run("case=write locks", func(t *testing.T) {
+		do(t, "GET", lockPath, "", http.StatusNotFound, nil)
+		do(t, "DELETE", lockPath, "", http.StatusNotFound, nil)
+
+		var l Lock
+		do(t, "PUT", lockPath, `{"reason":"fraud investigation"}`, http.StatusOK, &l)
+		assert.Equal(t, i.ID, l.IdentityID)
+		assert.Equal(t, "fraud investigation", l.Reason)
+
+		l = Lock{}
+		do(t, "GET", lockPath, "", http.StatusOK, &l)
+		assert.Equal(t, "fraud investigation", l.Reason)
+
+		var ls []Lock
+		do(t, "GET", WriteLocksPath, "", http.StatusOK, &ls)
+		require.Len(t, ls, 1)
+		assert.Equal(t, i.ID, ls[0].IdentityID)
+
+		assert.Equal(t, ErrIdentityLocked, errors.Cause(reg.MaintenanceGuard().CheckWrite(context.Background(), i.ID)))
+		require.NoError(t, reg.MaintenanceGuard().CheckWrite(context.Background(), x.NewUUID()), "other identities are not locked")
+		require.NoError(t, reg.MaintenanceGuard().CheckRegistration(context.Background()))
+
+		do(t, "DELETE", lockPath, "", http.StatusNoContent, nil)
+		require.NoError(t, reg.MaintenanceGuard().CheckWrite(context.Background(), i.ID))
+	})
+
+	for _, tc := range []struct {
+		d      string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{d: "locking an unknown identity", method: "PUT", path: identity.IdentitiesPath + "/" + x.NewUUID().String() + "/" + WriteLockPath, body: `{}`, code: http.StatusNotFound},
+		{d: "unknown fields", method: "PUT", path: MaintenancePath, body: `{"enabled":false}`, code: http.StatusBadRequest},
+		{d: "a reason which is too long", method: "PUT", path: lockPath, body: `{"reason":"` + strings.Repeat("a", 256) + `"}`, code: http.StatusBadRequest},
+	} {
+		t.Run("case=rejects "+tc.d, func(t *testing.T) {
+			do(t, tc.method, tc.path, tc.body, tc.code, nil)
+		})
+	}
+}
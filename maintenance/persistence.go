@@ -0,0 +1,123 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		MaintenancePersister() Persister
+	}
+	Persister interface {
+		// GetMaintenanceMode returns the global maintenance mode. It is not an error if maintenance mode is
+		// disabled.
+		GetMaintenanceMode(ctx context.Context) (*Mode, error)
+
+		// SetMaintenanceMode enables maintenance mode, or updates its reason if it is enabled already.
+		SetMaintenanceMode(ctx context.Context, m *Mode) error
+
+		// DeleteMaintenanceMode disables maintenance mode. Disabling it twice is not an error.
+		DeleteMaintenanceMode(ctx context.Context) error
+
+		// GetWriteLock returns the lock of the identity, or sqlcon.ErrNoRows if the identity is not locked.
+		GetWriteLock(ctx context.Context, identityID uuid.UUID) (*Lock, error)
+
+		// ListWriteLocks returns the locked identities, the most recently locked first.
+		ListWriteLocks(ctx context.Context, limit, offset int) ([]Lock, error)
+
+		// SetWriteLock locks the identity, or updates the reason if it is locked already.
+		SetWriteLock(ctx context.Context, l *Lock) error
+
+		// DeleteWriteLock unlocks the identity. It returns sqlcon.ErrNoRows if the identity is not locked.
+		DeleteWriteLock(ctx context.Context, identityID uuid.UUID) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		t.Run("case=maintenance mode", func(t *testing.T) {
+			m, err := p.GetMaintenanceMode(context.Background())
+			require.NoError(t, err)
+			assert.False(t, m.Enabled)
+
+			now := time.Now().UTC().Round(time.Second)
+			require.NoError(t, p.SetMaintenanceMode(context.Background(), &Mode{Reason: "database migration", EnabledAt: &now}))
+			require.NoError(t, p.SetMaintenanceMode(context.Background(), &Mode{Reason: "database upgrade", EnabledAt: &now}))
+
+			m, err = p.GetMaintenanceMode(context.Background())
+			require.NoError(t, err)
+			assert.True(t, m.Enabled)
+			assert.Equal(t, "database upgrade", m.Reason)
+			require.NotNil(t, m.EnabledAt)
+			assert.Equal(t, now, m.EnabledAt.UTC())
+
+			require.NoError(t, p.DeleteMaintenanceMode(context.Background()))
+			require.NoError(t, p.DeleteMaintenanceMode(context.Background()))
+
+			m, err = p.GetMaintenanceMode(context.Background())
+			require.NoError(t, err)
+			assert.False(t, m.Enabled)
+		})
+
+		t.Run("case=write locks", func(t *testing.T) {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+			_, err := p.GetWriteLock(context.Background(), i.ID)
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteWriteLock(context.Background(), i.ID)))
+
+			now := time.Now().UTC().Round(time.Second)
+			require.NoError(t, p.SetWriteLock(context.Background(), &Lock{IdentityID: i.ID, Reason: "ticket 1", CreatedAt: now}))
+			require.NoError(t, p.SetWriteLock(context.Background(), &Lock{IdentityID: i.ID, Reason: "ticket 2", CreatedAt: now}))
+
+			l, err := p.GetWriteLock(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "ticket 2", l.Reason)
+
+			ls, err := p.ListWriteLocks(context.Background(), 100, 0)
+			require.NoError(t, err)
+			require.Len(t, ls, 1)
+			assert.Equal(t, i.ID, ls[0].IdentityID)
+
+			_, err = p.GetWriteLock(context.Background(), x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+
+			require.NoError(t, p.DeleteWriteLock(context.Background(), i.ID))
+			_, err = p.GetWriteLock(context.Background(), i.ID)
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+		})
+
+		t.Run("case=write locks are deleted with the identity", func(t *testing.T) {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+			require.NoError(t, p.SetWriteLock(context.Background(), &Lock{IdentityID: i.ID, CreatedAt: time.Now().UTC()}))
+
+			require.NoError(t, p.DeleteIdentity(context.Background(), i.ID))
+			_, err := p.GetWriteLock(context.Background(), i.ID)
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+		})
+	}
+}
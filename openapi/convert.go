@@ -0,0 +1,417 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type object = map[string]interface{}
+
+// refPrefixes maps the reference prefixes of Swagger 2.0 to their OpenAPI 3.0 counterparts.
+var refPrefixes = [][2]string{
+	{"#/definitions/", "#/components/schemas/"},
+	{"#/responses/", "#/components/responses/"},
+	{"#/parameters/", "#/components/parameters/"},
+}
+
+// parameterSchemaKeys are the properties of Swagger 2.0 parameters and headers which moved into the schema.
+var parameterSchemaKeys = []string{
+	"type", "format", "items", "default", "enum", "multipleOf",
+	"maximum", "exclusiveMaximum", "minimum", "exclusiveMinimum",
+	"maxLength", "minLength", "pattern", "maxItems", "minItems", "uniqueItems",
+}
+
+const (
+	mediaTypeForm      = "application/x-www-form-urlencoded"
+	mediaTypeMultipart = "multipart/form-data"
+)
+
+// Convert converts a Swagger 2.0 specification to OpenAPI 3.0. Body and form parameters become request bodies,
+// response schemas are listed per produced media type, and references point to the components instead of the
+// definitions.
+func Convert(swagger []byte, servers ...Server) (map[string]interface{}, error) {
+	var in object
+	if err := json.Unmarshal(swagger, &in); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if v, _ := in["swagger"].(string); v != "2.0" {
+		return nil, errors.Errorf(`expected a Swagger 2.0 specification but got version "%s"`, v)
+	}
+
+	consumes := stringList(in["consumes"], []string{"application/json"})
+	produces := stringList(in["produces"], []string{"application/json"})
+
+	out := object{"openapi": Version, "info": in["info"]}
+	if len(servers) > 0 {
+		out["servers"] = servers
+	}
+	for k, v := range in {
+		switch {
+		case k == "tags", k == "externalDocs", k == "security", strings.HasPrefix(k, "x-"):
+			out[k] = v
+		}
+	}
+
+	components := object{}
+	if defs, ok := in["definitions"].(object); ok {
+		components["schemas"] = rewrite(defs)
+	}
+
+	if params, ok := in["parameters"].(object); ok {
+		converted := object{}
+		for name, p := range params {
+			p, ok := p.(object)
+			if !ok {
+				return nil, errors.Errorf(`parameter "%s" is not an object`, name)
+			}
+			if p["in"] == "body" || p["in"] == "formData" {
+				return nil, errors.Errorf(`global %s parameter "%s" can not be converted, declare it on the operation instead`, p["in"], name)
+			}
+			converted[name] = convertParameter(p)
+		}
+		components["parameters"] = converted
+	}
+
+	if responses, ok := in["responses"].(object); ok {
+		converted := object{}
+		for name, r := range responses {
+			converted[name] = convertResponse(r, produces)
+		}
+		components["responses"] = converted
+	}
+
+	if schemes, ok := in["securityDefinitions"].(object); ok {
+		converted := object{}
+		for name, s := range schemes {
+			s, ok := s.(object)
+			if !ok {
+				return nil, errors.Errorf(`security definition "%s" is not an object`, name)
+			}
+			converted[name] = convertSecurityScheme(s)
+		}
+		components["securitySchemes"] = converted
+	}
+	out["components"] = components
+
+	paths := object{}
+	if in, ok := in["paths"].(object); ok {
+		for path, item := range in {
+			item, ok := item.(object)
+			if !ok {
+				return nil, errors.Errorf(`path "%s" is not an object`, path)
+			}
+
+			shared, _ := item["parameters"].([]interface{})
+			converted := object{}
+			for method, op := range item {
+				switch {
+				case method == "parameters":
+				case strings.HasPrefix(method, "x-"):
+					converted[method] = op
+				default:
+					op, ok := op.(object)
+					if !ok {
+						return nil, errors.Errorf(`operation "%s %s" is not an object`, method, path)
+					}
+
+					var err error
+					if converted[method], err = convertOperation(op, shared, consumes, produces); err != nil {
+						return nil, errors.WithMessagef(err, `unable to convert operation "%s %s"`, method, path)
+					}
+				}
+			}
+			paths[path] = converted
+		}
+	}
+	out["paths"] = paths
+
+	return out, nil
+}
+
+func convertOperation(op object, shared []interface{}, consumes, produces []string) (object, error) {
+	out := object{}
+	for k, v := range op {
+		switch k {
+		case "parameters", "responses", "consumes", "produces", "schemes":
+		default:
+			out[k] = v
+		}
+	}
+
+	consumes = stringList(op["consumes"], consumes)
+	produces = stringList(op["produces"], produces)
+
+	own, _ := op["parameters"].([]interface{})
+	var params []interface{}
+	formSchema := object{"type": "object", "properties": object{}}
+	var formRequired []interface{}
+	var hasForm, hasFile bool
+
+	for _, p := range append(append([]interface{}{}, shared...), own...) {
+		p, ok := p.(object)
+		if !ok {
+			return nil, errors.New("parameter is not an object")
+		}
+
+		switch p["in"] {
+		case "body":
+			content := object{}
+			for _, mt := range consumes {
+				content[mt] = object{"schema": rewrite(p["schema"])}
+			}
+
+			body := object{"content": content}
+			if required, _ := p["required"].(bool); required {
+				body["required"] = true
+			}
+			if d, ok := p["description"]; ok {
+				body["description"] = d
+			}
+			out["requestBody"] = body
+		case "formData":
+			name, _ := p["name"].(string)
+			formSchema["properties"].(object)[name] = parameterSchema(p)
+			if required, _ := p["required"].(bool); required {
+				formRequired = append(formRequired, name)
+			}
+			if p["type"] == "file" {
+				hasFile = true
+			}
+			hasForm = true
+		default:
+			params = append(params, convertParameter(p))
+		}
+	}
+
+	if hasForm {
+		if len(formRequired) > 0 {
+			formSchema["required"] = formRequired
+		}
+
+		mt := mediaTypeForm
+		if hasFile || (contains(consumes, mediaTypeMultipart) && !contains(consumes, mediaTypeForm)) {
+			mt = mediaTypeMultipart
+		}
+		out["requestBody"] = object{"content": object{mt: object{"schema": formSchema}}}
+	}
+
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	responses := object{}
+	if in, ok := op["responses"].(object); ok {
+		for code, r := range in {
+			responses[code] = convertResponse(r, produces)
+		}
+	}
+	out["responses"] = responses
+
+	return out, nil
+}
+
+func convertParameter(p object) object {
+	if ref, ok := p["$ref"].(string); ok {
+		return object{"$ref": rewriteRef(ref)}
+	}
+
+	out := object{}
+	for k, v := range p {
+		switch k {
+		case "collectionFormat":
+			switch v {
+			case "multi":
+				out["style"], out["explode"] = "form", true
+			case "csv":
+				out["style"], out["explode"] = "form", false
+			case "ssv":
+				out["style"] = "spaceDelimited"
+			case "pipes":
+				out["style"] = "pipeDelimited"
+			}
+		case "name", "in", "description", "required", "allowEmptyValue":
+			out[k] = v
+		default:
+			if strings.HasPrefix(k, "x-") {
+				out[k] = v
+			}
+		}
+	}
+
+	out["schema"] = parameterSchema(p)
+	return out
+}
+
+func convertResponse(r interface{}, produces []string) object {
+	in, _ := r.(object)
+	if ref, ok := in["$ref"].(string); ok {
+		return object{"$ref": rewriteRef(ref)}
+	}
+
+	description, _ := in["description"].(string)
+	out := object{"description": description}
+
+	if schema, ok := in["schema"]; ok {
+		examples, _ := in["examples"].(object)
+		content := object{}
+		for _, mt := range produces {
+			media := object{"schema": rewrite(schema)}
+			if example, ok := examples[mt]; ok {
+				media["example"] = example
+			}
+			content[mt] = media
+		}
+		out["content"] = content
+	}
+
+	if headers, ok := in["headers"].(object); ok {
+		converted := object{}
+		for name, h := range headers {
+			h, _ := h.(object)
+			header := object{"schema": parameterSchema(h)}
+			if d, ok := h["description"]; ok {
+				header["description"] = d
+			}
+			converted[name] = header
+		}
+		out["headers"] = converted
+	}
+
+	for k, v := range in {
+		if strings.HasPrefix(k, "x-") {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+func convertSecurityScheme(s object) object {
+	out := object{}
+	if d, ok := s["description"]; ok {
+		out["description"] = d
+	}
+
+	switch s["type"] {
+	case "basic":
+		out["type"], out["scheme"] = "http", "basic"
+	case "apiKey":
+		out["type"], out["name"], out["in"] = "apiKey", s["name"], s["in"]
+	case "oauth2":
+		flow := object{"scopes": s["scopes"]}
+		if flow["scopes"] == nil {
+			flow["scopes"] = object{}
+		}
+
+		var name string
+		switch s["flow"] {
+		case "implicit":
+			name, flow["authorizationUrl"] = "implicit", s["authorizationUrl"]
+		case "password":
+			name, flow["tokenUrl"] = "password", s["tokenUrl"]
+		case "application":
+			name, flow["tokenUrl"] = "clientCredentials", s["tokenUrl"]
+		case "accessCode":
+			name, flow["authorizationUrl"], flow["tokenUrl"] = "authorizationCode", s["authorizationUrl"], s["tokenUrl"]
+		}
+		out["type"], out["flows"] = "oauth2", object{name: flow}
+	default:
+		out["type"] = s["type"]
+	}
+
+	return out
+}
+
+// parameterSchema returns the schema of a Swagger 2.0 parameter or header.
+func parameterSchema(p object) interface{} {
+	if s, ok := p["schema"]; ok {
+		return rewrite(s)
+	}
+
+	schema := object{}
+	for _, k := range parameterSchemaKeys {
+		if v, ok := p[k]; ok {
+			schema[k] = v
+		}
+	}
+	if nullable, ok := p["x-nullable"]; ok {
+		schema["x-nullable"] = nullable
+	}
+	return rewrite(schema)
+}
+
+// rewrite converts a Swagger 2.0 schema to an OpenAPI 3.0 schema.
+func rewrite(v interface{}) interface{} {
+	switch v := v.(type) {
+	case object:
+		out := make(object, len(v))
+		for k, vv := range v {
+			switch k {
+			case "$ref":
+				if ref, ok := vv.(string); ok {
+					out[k] = rewriteRef(ref)
+					continue
+				}
+			case "x-nullable":
+				out["nullable"] = vv
+				continue
+			case "discriminator":
+				if name, ok := vv.(string); ok {
+					out[k] = object{"propertyName": name}
+					continue
+				}
+			case "type":
+				if vv == "file" {
+					out["type"], out["format"] = "string", "binary"
+					continue
+				}
+			}
+			out[k] = rewrite(vv)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for k, vv := range v {
+			out[k] = rewrite(vv)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func rewriteRef(ref string) string {
+	for _, p := range refPrefixes {
+		if strings.HasPrefix(ref, p[0]) {
+			return p[1] + strings.TrimPrefix(ref, p[0])
+		}
+	}
+	return ref
+}
+
+func stringList(v interface{}, fallback []string) []string {
+	vs, ok := v.([]interface{})
+	if !ok || len(vs) == 0 {
+		return fallback
+	}
+
+	out := make([]string, 0, len(vs))
+	for _, v := range vs {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
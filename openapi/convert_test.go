@@ -0,0 +1,129 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	. "github.com/ory/kratos/openapi"
+)
+
+func TestConvert(t *testing.T) {
+	t.Run("case=rejects other versions", func(t *testing.T) {
+		_, err := Convert([]byte(`{"openapi":"3.0.3"}`))
+		require.Error(t, err)
+	})
+
+	t.Run("case=converts parameters, responses, and references", func(t *testing.T) {
+		spec, err := Convert([]byte(`{
+  "swagger": "2.0",
+  "info": {"title": "test", "version": "1"},
+  "consumes": ["application/json"],
+  "produces": ["application/json"],
+  "securityDefinitions": {"basic": {"type": "basic"}},
+  "paths": {
+    "/things/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "type": "string"}],
+      "put": {
+        "consumes": ["application/json", "application/x-www-form-urlencoded"],
+        "parameters": [
+          {"name": "tags", "in": "query", "type": "array", "items": {"type": "string"}, "collectionFormat": "multi"},
+          {"name": "Body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/thing"}}
+        ],
+        "responses": {
+          "200": {"description": "thing", "schema": {"$ref": "#/definitions/thing"}},
+          "204": {"description": "empty"}
+        }
+      }
+    },
+    "/upload": {
+      "post": {
+        "parameters": [
+          {"name": "file", "in": "formData", "required": true, "type": "file"},
+          {"name": "name", "in": "formData", "type": "string"}
+        ],
+        "responses": {"201": {"description": "created"}}
+      }
+    }
+  },
+  "definitions": {
+    "thing": {
+      "type": "object",
+      "properties": {
+        "parent": {"$ref": "#/definitions/thing"},
+        "note": {"type": "string", "x-nullable": true}
+      }
+    }
+  }
+}`), Server{URL: "https://example.org"})
+		require.NoError(t, err)
+
+		raw, err := json.Marshal(spec)
+		require.NoError(t, err)
+		assert.NotContains(t, string(raw), "#/definitions/")
+
+		doc := gjson.ParseBytes(raw)
+		assert.Equal(t, "3.0.3", doc.Get("openapi").String())
+		assert.Equal(t, "https://example.org", doc.Get("servers.0.url").String())
+		assert.Equal(t, "http", doc.Get("components.securitySchemes.basic.type").String())
+		assert.Equal(t, "#/components/schemas/thing", doc.Get("components.schemas.thing.properties.parent.$ref").String())
+		assert.True(t, doc.Get("components.schemas.thing.properties.note.nullable").Bool())
+
+		put := doc.Get(`paths./things/{id}.put`)
+		assert.Equal(t, "id", put.Get("parameters.0.name").String())
+		assert.Equal(t, "string", put.Get("parameters.0.schema.type").String())
+		assert.Equal(t, "string", put.Get("parameters.1.schema.items.type").String())
+		assert.True(t, put.Get("parameters.1.explode").Bool())
+		assert.False(t, put.Get("parameters.#(in==body)").Exists())
+
+		assert.True(t, put.Get("requestBody.required").Bool())
+		for _, mt := range []string{"application/json", "application/x-www-form-urlencoded"} {
+			assert.Equal(t, "#/components/schemas/thing", put.Get("requestBody.content."+mt+".schema.$ref").String(), mt)
+		}
+
+		assert.Equal(t, "#/components/schemas/thing", put.Get("responses.200.content.application/json.schema.$ref").String())
+		assert.Equal(t, "empty", put.Get("responses.204.description").String())
+		assert.False(t, put.Get("responses.204.content").Exists())
+
+		form := doc.Get(`paths./upload.post.requestBody.content.multipart/form-data.schema`)
+		assert.Equal(t, "binary", form.Get("properties.file.format").String())
+		assert.Equal(t, `["file"]`, form.Get("required").Raw)
+	})
+}
+
+func TestGenerate(t *testing.T) {
+	raw, err := Generate()
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "#/definitions/")
+
+	doc := gjson.ParseBytes(raw)
+	assert.Equal(t, "3.0.3", doc.Get("openapi").String())
+	assert.True(t, doc.Get("components.schemas.loginRequest").Exists())
+
+	login := doc.Get(`paths./self-service/browser/flows/requests/login.get.responses`)
+	examples := login.Get("200.content.application/json.examples")
+	for _, name := range []string{"initialized", "method_errors", "expired"} {
+		assert.True(t, examples.Get(name+".value.methods.password.config.fields").IsArray(), name)
+	}
+	assert.Equal(t, "validation_invalid_credentials", examples.Get("method_errors.value.methods.password.config.errors.0.id").String(), examples.Raw)
+	assert.Equal(t, "self_service_flow_expired", examples.Get("expired.value.methods.password.config.errors.0.id").String(), examples.Raw)
+	assert.Equal(t, "jane@example.org", examples.Get("method_errors.value.methods.password.config.fields.#(name==identifier).value").String())
+
+	assert.Equal(t, int64(410), login.Get("410.content.application/json.examples.expired_flow.value.error.code").Int())
+	assert.Equal(t, "self_service_flow_binding_invalid", login.Get("403.content.application/json.examples.flow_binding_invalid.value.error.details.error_id").String())
+
+	profile := doc.Get(`paths./self-service/browser/flows/requests/profile.get.responses.200.content.application/json.examples`)
+	assert.True(t, profile.Get("update_successful.value.update_successful").Bool())
+
+	var invalid []string
+	profile.Get("validation_errors.value.form.fields").ForEach(func(_, field gjson.Result) bool {
+		if len(field.Get("errors").Array()) > 0 {
+			invalid = append(invalid, field.Get("name").String())
+		}
+		return true
+	})
+	assert.Equal(t, []string{"traits.email"}, invalid)
+}
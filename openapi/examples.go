@@ -0,0 +1,368 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/strategy/password"
+	"github.com/ory/kratos/x"
+)
+
+// Example is a named example of a response, see
+// https://github.com/OAI/OpenAPI-Specification/blob/master/versions/3.0.3.md#example-object
+type Example struct {
+	Summary string      `json:"summary"`
+	Value   interface{} `json:"value"`
+}
+
+// The examples use fixed values so that the specification does not change between runs.
+var (
+	exampleURL       = urlx.ParseOrPanic("http://127.0.0.1:4433/")
+	exampleIssuedAt  = time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	exampleExpiresAt = exampleIssuedAt.Add(time.Hour)
+	exampleRequestID = uuid.Must(uuid.FromString("a8a8c0a9-ad5b-4b5b-8f4e-0c6a3c8ff3b3"))
+	exampleErrorID   = uuid.Must(uuid.FromString("c4b8a0d7-1c3a-4b8e-9d3e-0a7d5c6e2f10"))
+	exampleIdentity  = uuid.Must(uuid.FromString("5f2a1e7c-3b1d-4e7a-8f0c-9d6b2a4c8e31"))
+	exampleCSRFToken = "AQgDCQ8NYfSZ1LHkuE2tG3pe5UP4Xm/SD4ewTGWkTp8="
+)
+
+// AddExamples adds examples to the responses of the specification which use a schema that examples exist for.
+// Error responses get the examples of their status code.
+func AddExamples(spec map[string]interface{}) error {
+	schemas, err := schemaExamples()
+	if err != nil {
+		return err
+	}
+
+	errs, err := errorExamples()
+	if err != nil {
+		return err
+	}
+
+	paths, _ := spec["paths"].(object)
+	for _, item := range paths {
+		item, _ := item.(object)
+		for _, op := range item {
+			op, _ := op.(object)
+			responses, _ := op["responses"].(object)
+			for code, r := range responses {
+				r, _ := r.(object)
+				content, _ := r["content"].(object)
+				for _, media := range content {
+					media, _ := media.(object)
+					s, _ := media["schema"].(object)
+					ref, _ := s["$ref"].(string)
+
+					name := strings.TrimPrefix(ref, "#/components/schemas/")
+					examples := schemas[name]
+					if name == "genericError" {
+						status, _ := strconv.Atoi(code)
+						examples = errs[status]
+					}
+
+					if len(examples) > 0 {
+						media["examples"] = examples
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// schemaExamples returns the examples of the self-service flow requests, per state, by the name of their schema.
+func schemaExamples() (map[string]map[string]Example, error) {
+	out := map[string]map[string]Example{}
+	add := func(schema, name, summary string, v interface{}) error {
+		value, err := exampleValue(v)
+		if err != nil {
+			return err
+		}
+		if out[schema] == nil {
+			out[schema] = map[string]Example{}
+		}
+		out[schema][name] = Example{Summary: summary, Value: value}
+		return nil
+	}
+
+	l := exampleLoginRequest()
+	if err := add("loginRequest", "initialized", "A login request which was just initialized", l); err != nil {
+		return nil, err
+	}
+
+	l = exampleLoginRequest()
+	l.Active = identity.CredentialsTypePassword
+	method := l.Methods[identity.CredentialsTypePassword].Config
+	method.SetValue("identifier", "jane@example.org")
+	if err := method.ParseError(schema.NewInvalidCredentialsError()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := add("loginRequest", "method_errors", "The password method failed because the credentials are invalid", l); err != nil {
+		return nil, err
+	}
+
+	l = exampleLoginRequest()
+	for _, m := range l.Methods {
+		m.Config.AddError(&form.Error{ID: form.ErrorIDFlowExpired, Message: "Your session expired, please try again."})
+	}
+	if err := add("loginRequest", "expired", "The request which replaced an expired login request", l); err != nil {
+		return nil, err
+	}
+
+	rr := exampleRegistrationRequest()
+	if err := add("registrationRequest", "initialized", "A registration request which was just initialized", rr); err != nil {
+		return nil, err
+	}
+
+	rr = exampleRegistrationRequest()
+	rr.Active = identity.CredentialsTypePassword
+	rm := rr.Methods[identity.CredentialsTypePassword].Config
+	rm.SetValue("traits.email", "jane@")
+	for _, err := range []error{
+		schema.NewInvalidFormatError("#/traits/email", "email", "jane@"),
+		schema.NewPasswordPolicyViolationError("#/password", "the password has been found in at least 23 data breaches and must no longer be used."),
+	} {
+		if err := rm.ParseError(err); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err := add("registrationRequest", "method_errors", "The password method failed because the input is invalid", rr); err != nil {
+		return nil, err
+	}
+
+	p := exampleProfileRequest()
+	if err := add("profileManagementRequest", "initialized", "A profile management request which was just initialized", p); err != nil {
+		return nil, err
+	}
+
+	p = exampleProfileRequest()
+	p.UpdateSuccessful = true
+	if err := add("profileManagementRequest", "update_successful", "The profile was updated", p); err != nil {
+		return nil, err
+	}
+
+	p = exampleProfileRequest()
+	p.Form.SetValue("traits.email", "jane@")
+	if err := p.Form.ParseError(schema.NewInvalidFormatError("#/traits/email", "email", "jane@")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := add("profileManagementRequest", "validation_errors", "The profile was not updated because the traits are invalid", p); err != nil {
+		return nil, err
+	}
+
+	v := exampleVerificationRequest()
+	if err := add("verificationRequest", "initialized", "A verification request which was just initialized", v); err != nil {
+		return nil, err
+	}
+
+	v = exampleVerificationRequest()
+	v.Form.SetValue("to_verify", "jane@example.org")
+	v.Success = true
+	if err := add("verificationRequest", "success", "The verification message was sent", v); err != nil {
+		return nil, err
+	}
+
+	for name, e := range map[string]struct {
+		summary string
+		err     *herodot.DefaultError
+	}{
+		"csrf_token_invalid":   {summary: "The anti-CSRF token of a form was missing or invalid", err: x.ErrInvalidCSRFToken},
+		"flow_binding_invalid": {summary: "A flow was submitted by another browser than the one which initiated it", err: x.NewErrFlowBindingInvalid()},
+	} {
+		// The error manager stores the errors with their ID.
+		value, err := exampleValue(e.err)
+		if err != nil {
+			return nil, err
+		}
+		value.(map[string]interface{})["id"] = errorx.ErrorID(e.err)
+
+		errs, err := json.Marshal([]interface{}{value})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := add("errorContainer", name, e.summary, &errorx.ErrorContainer{ID: exampleErrorID, Errors: errs}); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// errorExamples returns the examples of genericError responses by their status code.
+func errorExamples() (map[int]map[string]Example, error) {
+	out := map[int]map[string]Example{}
+	for name, e := range map[string]struct {
+		summary string
+		err     *herodot.DefaultError
+	}{
+		"bad_request": {
+			summary: "The request body could not be decoded",
+			err:     herodot.ErrBadRequest.WithReason("Unable to decode the request body: unexpected EOF"),
+		},
+		"csrf_token_invalid": {
+			summary: "The request was initiated by another browser or the anti-CSRF cookie is missing",
+			err:     x.ErrInvalidCSRFToken,
+		},
+		"flow_binding_invalid": {
+			summary: "The flow was initiated by another browser",
+			err:     x.NewErrFlowBindingInvalid(),
+		},
+		"not_found": {
+			summary: "The requested resource does not exist",
+			err:     herodot.ErrNotFound.WithReason("Unable to locate the resource"),
+		},
+		"expired_flow": {
+			summary: "The self-service request expired and a new one must be initialized",
+			err: x.ErrGone.
+				WithReason("The login request has expired. Redirect the user to the login endpoint to initialize a new session.").
+				WithDetail("redirect_to", urlx.AppendPaths(exampleURL, login.BrowserLoginPath).String()),
+		},
+		"maintenance_mode": {
+			summary: "Changes are rejected because maintenance mode is enabled",
+			err:     &maintenance.ErrMaintenance,
+		},
+		"internal_server_error": {
+			summary: "An unexpected error occurred",
+			err:     herodot.ErrInternalServerError.WithReason("An internal server error occurred, please contact the system administrator"),
+		},
+	} {
+		value, err := exampleValue(map[string]interface{}{"error": e.err})
+		if err != nil {
+			return nil, err
+		}
+
+		code := e.err.StatusCode()
+		if out[code] == nil {
+			out[code] = map[string]Example{}
+		}
+		out[code][name] = Example{Summary: e.summary, Value: value}
+	}
+
+	return out, nil
+}
+
+func exampleLoginRequest() *login.Request {
+	f := &form.HTMLForm{
+		Action: exampleAction(password.LoginPath),
+		Method: "POST",
+		Fields: form.Fields{
+			{Name: "identifier", Type: "text", Required: true},
+			{Name: "password", Type: "password", Required: true},
+		},
+	}
+	f.SetCSRF(exampleCSRFToken)
+
+	return &login.Request{
+		ID:         exampleRequestID,
+		IssuedAt:   exampleIssuedAt,
+		ExpiresAt:  exampleExpiresAt,
+		RequestURL: urlx.AppendPaths(exampleURL, login.BrowserLoginPath).String(),
+		Methods: map[identity.CredentialsType]*login.RequestMethod{
+			identity.CredentialsTypePassword: {
+				Method: identity.CredentialsTypePassword,
+				Config: &login.RequestMethodConfig{RequestMethodConfigurator: &password.RequestMethod{HTMLForm: f}},
+			},
+		},
+		Locale: "en",
+	}
+}
+
+func exampleRegistrationRequest() *registration.Request {
+	f := &form.HTMLForm{
+		Action: exampleAction(password.RegistrationPath),
+		Method: "POST",
+		Fields: form.Fields{
+			{Name: "password", Type: "password", Required: true},
+			{Name: "traits.email", Type: "text"},
+		},
+	}
+	f.SetCSRF(exampleCSRFToken)
+
+	return &registration.Request{
+		ID:         exampleRequestID,
+		IssuedAt:   exampleIssuedAt,
+		ExpiresAt:  exampleExpiresAt,
+		RequestURL: urlx.AppendPaths(exampleURL, registration.BrowserRegistrationPath).String(),
+		Methods: map[identity.CredentialsType]*registration.RequestMethod{
+			identity.CredentialsTypePassword: {
+				Method: identity.CredentialsTypePassword,
+				Config: &registration.RequestMethodConfig{RequestMethodConfigurator: &password.RequestMethod{HTMLForm: f}},
+			},
+		},
+		Locale: "en",
+	}
+}
+
+func exampleProfileRequest() *profile.Request {
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	i.ID = exampleIdentity
+	i.Traits = identity.Traits(`{"email":"jane@example.org"}`)
+
+	f := form.NewHTMLFormFromJSON(exampleAction(profile.PublicProfileManagementUpdatePath), json.RawMessage(i.Traits), "traits")
+	f.SetCSRF(exampleCSRFToken)
+
+	return &profile.Request{
+		ID:         exampleRequestID,
+		IssuedAt:   exampleIssuedAt,
+		ExpiresAt:  exampleExpiresAt,
+		RequestURL: urlx.AppendPaths(exampleURL, profile.PublicProfileManagementPath).String(),
+		Form:       f,
+		Identity:   i,
+		Locale:     "en",
+	}
+}
+
+func exampleVerificationRequest() *verify.Request {
+	via := identity.VerifiableAddressTypeEmail
+	f := form.NewHTMLForm(exampleAction(strings.Replace(verify.PublicVerificationCompletePath, ":via", string(via), 1)))
+	f.SetCSRF(exampleCSRFToken)
+	f.SetField(form.Field{Name: "to_verify", Type: via.HTMLFormInputType(), Required: true})
+
+	return &verify.Request{
+		ID:         exampleRequestID,
+		IssuedAt:   exampleIssuedAt,
+		ExpiresAt:  exampleExpiresAt,
+		RequestURL: urlx.AppendPaths(exampleURL, strings.Replace(verify.PublicVerificationInitPath, ":via", string(via), 1)).String(),
+		Form:       f,
+		Via:        via,
+		Locale:     "en",
+	}
+}
+
+func exampleAction(path string) string {
+	return urlx.CopyWithQuery(urlx.AppendPaths(exampleURL, path), url.Values{"request": {exampleRequestID.String()}}).String()
+}
+
+// exampleValue returns the JSON representation of v, exactly as the API would respond with it.
+func exampleValue(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return value, nil
+}
@@ -0,0 +1,78 @@
+package openapi
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/x"
+)
+
+const SpecPath = "/spec.json"
+
+type (
+	handlerDependencies interface {
+		x.WriterProvider
+	}
+	HandlerProvider interface {
+		OpenAPIHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+
+		once sync.Once
+		spec []byte
+		err  error
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(SpecPath, h.get)
+}
+
+// The OpenAPI 3.0 specification
+//
+// swagger:response openAPISpecification
+// nolint:deadcode,unused
+type specResponse struct {
+	// in: body
+	Body interface{}
+}
+
+// swagger:route GET /spec.json admin getOpenAPISpecification
+//
+// Get the OpenAPI 3.0 specification
+//
+// Returns the OpenAPI 3.0 specification of the public and the admin API, including examples of every state of the
+// self-service flows. Point client generators at this endpoint.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: openAPISpecification
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	h.once.Do(func() {
+		h.spec, h.err = Generate(
+			Server{URL: h.c.SelfPublicURL().String(), Description: "Public API"},
+			Server{URL: h.c.SelfAdminURL().String(), Description: "Admin API"},
+		)
+	})
+	if h.err != nil {
+		h.r.Writer().WriteError(w, r, h.err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(h.spec)
+}
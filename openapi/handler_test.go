@@ -0,0 +1,40 @@
+package openapi_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/openapi"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	conf, reg := internal.NewRegistryDefault(t)
+
+	router := x.NewRouterAdmin()
+	reg.OpenAPIHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL + SpecPath)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.EqualValues(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	doc := gjson.ParseBytes(body)
+	assert.Equal(t, "3.0.3", doc.Get("openapi").String())
+	assert.Equal(t, conf.SelfPublicURL().String(), doc.Get("servers.0.url").String())
+	assert.Equal(t, conf.SelfAdminURL().String(), doc.Get("servers.1.url").String())
+}
@@ -0,0 +1,44 @@
+package openapi
+
+import (
+	"encoding/json"
+
+	"github.com/gobuffalo/packr/v2"
+	"github.com/pkg/errors"
+)
+
+// Version is the OpenAPI version of the specifications returned by Generate and Convert.
+const Version = "3.0.3"
+
+var box = packr.New("openapi", "../docs")
+
+// Server is a server of the HTTP API, see
+// https://github.com/OAI/OpenAPI-Specification/blob/master/versions/3.0.3.md#server-object
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Generate returns the OpenAPI 3.0 specification of the HTTP API, including examples of the self-service flows.
+// It is converted from docs/api.swagger.json, which `make sdk` generates from the swagger annotations in the code.
+func Generate(servers ...Server) ([]byte, error) {
+	swagger, err := box.Find("api.swagger.json")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	spec, err := Convert(swagger, servers...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := AddExamples(spec); err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
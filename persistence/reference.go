@@ -6,14 +6,30 @@ import (
 
 	"github.com/gobuffalo/pop/v5"
 
+	"github.com/ory/kratos/admission"
+	"github.com/ory/kratos/cluster"
 	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/idempotency"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/relationship"
+	"github.com/ory/kratos/retention"
+	"github.com/ory/kratos/schedule"
+	"github.com/ory/kratos/schema"
 	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/device"
+	"github.com/ory/kratos/selfservice/flow/inspect"
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/flow/recovery"
 	"github.com/ory/kratos/selfservice/flow/registration"
 	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/selfservice/strategy/emailcode"
+	"github.com/ory/kratos/selfservice/strategy/push"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/stats"
+	"github.com/ory/kratos/token"
+	"github.com/ory/kratos/webhook"
 )
 
 type Provider interface {
@@ -29,12 +45,54 @@ type Persister interface {
 	session.Persister
 	errorx.Persister
 	verify.Persister
+	recovery.Persister
+	stats.Persister
+	retention.Persister
+	inspect.Persister
+	admission.Persister
+	relationship.Persister
+	token.Persister
+	schedule.Persister
+	schema.Persister
+	idempotency.Persister
+	cluster.Persister
+	device.Persister
+	push.Persister
+	emailcode.Persister
+	maintenance.Persister
+	webhook.Persister
 
 	Close(context.Context) error
 	Ping(context.Context) error
 	MigrationStatus(c context.Context, b io.Writer) error
+	PendingMigrations(c context.Context) ([]string, error)
+	RequiredMigrations(c context.Context) ([]string, error)
+	MigrationPlan(c context.Context) ([]PlannedMigration, error)
+	MigrationDownPlan(c context.Context, steps int) ([]PlannedMigration, error)
 	MigrateDown(c context.Context, steps int) error
 	MigrateUp(c context.Context) error
 	GetConnection(ctx context.Context) *pop.Connection
 	Transaction(ctx context.Context, callback func(connection *pop.Connection) error) error
+	InTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// PlannedMigration is a migration which has not been applied yet.
+type PlannedMigration struct {
+	Version string
+	Name    string
+
+	// Required is false if this release can run against the schema without this migration.
+	Required bool
+
+	Statements []PlannedStatement
+}
+
+// PlannedStatement is a SQL statement of a planned migration and the impact its locks are expected
+// to have on a running system.
+type PlannedStatement struct {
+	SQL        string
+	LockImpact string
+
+	// Destructive is true if the statement removes data or may lose data while converting it.
+	Destructive bool
 }
@@ -1 +1,3 @@
-/* ALTER TABLE identity_credential_identifiers MODIFY COLUMN identifier VARCHAR(255); */
\ No newline at end of file
+-- Identifiers are kept case-sensitive, because reverting to a case-insensitive column fails as soon
+-- as two identifiers differ only in case. This keeps the older release working with all existing data.
+DO 0;
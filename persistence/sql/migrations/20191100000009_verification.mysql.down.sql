@@ -1 +1,3 @@
-/* ALTER TABLE identity_verifiable_addresses MODIFY COLUMN code VARCHAR(255); */
\ No newline at end of file
+-- Verification codes are kept case-sensitive and at their current size, because shrinking the column
+-- would truncate existing codes. This keeps the older release working with all existing data.
+DO 0;
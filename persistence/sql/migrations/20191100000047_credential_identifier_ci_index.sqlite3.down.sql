@@ -0,0 +1 @@
+DROP INDEX identity_credential_identifiers_identifier_ci_idx;
@@ -0,0 +1,2 @@
+-- Finds identifiers regardless of their case, see identifierLookupCondition.
+CREATE INDEX identity_credential_identifiers_identifier_ci_idx ON identity_credential_identifiers (identifier COLLATE NOCASE, identity_credential_type_id);
@@ -8,6 +8,7 @@ import (
 	"github.com/gobuffalo/pop/v5"
 	"github.com/pkg/errors"
 
+	"github.com/ory/kratos/cipher"
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/persistence"
@@ -22,6 +23,7 @@ type (
 	persisterDependencies interface {
 		IdentityTraitsSchemas() schema.Schemas
 		identity.ValidationProvider
+		cipher.Provider
 		x.LoggingProvider
 	}
 	Persister struct {
@@ -29,6 +31,8 @@ type (
 		mb pop.MigrationBox
 		r  persisterDependencies
 		cf configuration.Provider
+
+		compat schemaCompatibility
 	}
 )
 
@@ -45,11 +49,24 @@ func (p *Persister) MigrationStatus(ctx context.Context, w io.Writer) error {
 	return errors.WithStack(p.mb.Status(w))
 }
 
-func (p *Persister) MigrateDown(ctx context.Context, steps int) error {
-	return errors.WithStack(p.mb.Down(steps))
+// PendingMigrations returns the versions of all migrations which have not been applied yet.
+func (p *Persister) PendingMigrations(ctx context.Context) ([]string, error) {
+	var pending []string
+	c := p.GetConnection(ctx)
+	for _, m := range p.dialectMigrations(c, "up") {
+		applied, err := isApplied(c, m)
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			pending = append(pending, m.Version)
+		}
+	}
+	return pending, nil
 }
 
 func (p *Persister) MigrateUp(ctx context.Context) error {
+	defer p.compat.reset()
 	return errors.WithStack(p.mb.Up())
 }
 
@@ -0,0 +1,142 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/admission"
+)
+
+var _ admission.Persister = new(Persister)
+
+const (
+	invitationsTable = "identity_invitations"
+	approvalsTable   = "identity_registration_approvals"
+)
+
+func (p *Persister) CreateInvitation(ctx context.Context, i *admission.Invitation) error {
+	if err := p.requireTable(ctx, invitationsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(i))
+}
+
+func (p *Persister) GetInvitationByToken(ctx context.Context, token string) (*admission.Invitation, error) {
+	if err := p.requireTable(ctx, invitationsTable); err != nil {
+		return nil, err
+	}
+
+	var i admission.Invitation
+	if err := p.GetConnection(ctx).Where("token = ?", token).First(&i); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &i, nil
+}
+
+func (p *Persister) ListInvitations(ctx context.Context, limit, offset int) ([]admission.Invitation, error) {
+	if err := p.requireTable(ctx, invitationsTable); err != nil {
+		return nil, err
+	}
+
+	is := make([]admission.Invitation, 0)
+	if err := p.GetConnection(ctx).
+		RawQuery("SELECT * FROM "+invitationsTable+" ORDER BY created_at DESC LIMIT ? OFFSET ?", limit, offset).
+		All(&is); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return is, nil
+}
+
+func (p *Persister) DeleteInvitation(ctx context.Context, id uuid.UUID) error {
+	if err := p.requireTable(ctx, invitationsTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery("DELETE FROM "+invitationsTable+" WHERE id = ?", id).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) UseInvitation(ctx context.Context, id, identityID uuid.UUID) error {
+	if err := p.requireTable(ctx, invitationsTable); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+invitationsTable+" SET used_at = ?, identity_id = ?, updated_at = ? WHERE id = ? AND used_at IS NULL AND expires_at > ?",
+		now, identityID, now, id, now,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) CreateApproval(ctx context.Context, a *admission.Approval) error {
+	if err := p.requireTable(ctx, approvalsTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).
+		RawQuery("INSERT INTO "+approvalsTable+" (identity_id, created_at) VALUES (?, ?)", a.IdentityID, a.CreatedAt).
+		Exec())
+}
+
+func (p *Persister) ListApprovals(ctx context.Context, limit, offset int) ([]admission.Approval, error) {
+	if err := p.requireTable(ctx, approvalsTable); err != nil {
+		return nil, err
+	}
+
+	as := make([]admission.Approval, 0)
+	if err := p.GetConnection(ctx).
+		RawQuery("SELECT identity_id, created_at FROM "+approvalsTable+" ORDER BY created_at ASC LIMIT ? OFFSET ?", limit, offset).
+		All(&as); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return as, nil
+}
+
+func (p *Persister) IsApprovalPending(ctx context.Context, identityID uuid.UUID) (bool, error) {
+	// Without the migration nobody can have registered while approval was required, so nobody awaits approval.
+	if p.missingTable(ctx, approvalsTable) {
+		return false, nil
+	}
+
+	count, err := p.GetConnection(ctx).Where("identity_id = ?", identityID).Count(new(admission.Approval))
+	if err != nil {
+		return false, sqlcon.HandleError(err)
+	}
+	return count > 0, nil
+}
+
+func (p *Persister) DeleteApproval(ctx context.Context, identityID uuid.UUID) error {
+	if err := p.requireTable(ctx, approvalsTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery("DELETE FROM "+approvalsTable+" WHERE identity_id = ?", identityID).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package sql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bxcodec/faker"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+// The benchmarks measure the queries which are executed on every login and every authenticated request:
+//
+//	go test -run=^$ -bench=. ./persistence/sql/...
+func newBenchmarkRegistry(b *testing.B) (*configuration.ViperProvider, *driver.RegistryDefault) {
+	conf, reg := internal.NewRegistryDefault(b)
+	viper.Set(configuration.ViperKeyURLsSelfPublic, "http://localhost/")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	return conf, reg
+}
+
+func newBenchmarkIdentity(b *testing.B, reg *driver.RegistryDefault) *identity.Identity {
+	email := x.NewUUID().String() + "@ory.sh"
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	i.Traits = identity.Traits(`{"email":"` + email + `"}`)
+	i.Credentials = map[identity.CredentialsType]identity.Credentials{
+		identity.CredentialsTypePassword: {
+			Type:        identity.CredentialsTypePassword,
+			Identifiers: []string{email},
+			Config:      json.RawMessage(`{}`),
+		},
+	}
+	require.NoError(b, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+	return i
+}
+
+func BenchmarkGetLoginRequest(b *testing.B) {
+	_, reg := newBenchmarkRegistry(b)
+
+	var r login.Request
+	require.NoError(b, faker.FakeData(&r))
+	require.NoError(b, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), &r))
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), r.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetSession(b *testing.B) {
+	conf, reg := newBenchmarkRegistry(b)
+
+	i := newBenchmarkIdentity(b, reg)
+	s := session.NewSession(i, new(http.Request), conf)
+	s.IdentityID = i.ID
+	require.NoError(b, reg.SessionPersister().CreateSession(context.Background(), s))
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := reg.SessionPersister().GetSession(context.Background(), s.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindByCredentialsIdentifier(b *testing.B) {
+	_, reg := newBenchmarkRegistry(b)
+
+	i := newBenchmarkIdentity(b, reg)
+	identifier := i.Credentials[identity.CredentialsTypePassword].Identifiers[0]
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypePassword, identifier); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetIdentityConfidential(b *testing.B) {
+	_, reg := newBenchmarkRegistry(b)
+
+	i := newBenchmarkIdentity(b, reg)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), i.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/cluster"
+)
+
+var _ cluster.Persister = new(Persister)
+
+const clusterLocksTable = "cluster_locks"
+
+func (p *Persister) AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if p.missingTable(ctx, clusterLocksTable) {
+		// Without the migration every instance runs the background jobs, as before.
+		return true, nil
+	}
+
+	conn := p.GetConnection(ctx)
+	now := time.Now().UTC()
+	count, err := conn.RawQuery(
+		"UPDATE "+clusterLocksTable+" SET holder = ?, expires_at = ? WHERE name = ? AND (holder = ? OR expires_at < ?)",
+		holder, now.Add(ttl), name, holder, now,
+	).ExecWithCount()
+	if err != nil {
+		return false, sqlcon.HandleError(err)
+	} else if count > 0 {
+		return true, nil
+	}
+
+	err = sqlcon.HandleError(conn.RawQuery(
+		"INSERT INTO "+clusterLocksTable+" (name, holder, expires_at) VALUES (?, ?, ?)",
+		name, holder, now.Add(ttl),
+	).Exec())
+	if err == nil {
+		return true, nil
+	} else if errorsx.Cause(err) != sqlcon.ErrUniqueViolation {
+		return false, err
+	}
+
+	// MySQL reports no affected rows if the holder renews the lock with an unchanged expiry, for example
+	// twice within the same second, so the holder is checked before giving up.
+	var lock struct {
+		Holder string `db:"holder"`
+	}
+	if err := conn.RawQuery("SELECT holder FROM "+clusterLocksTable+" WHERE name = ?", name).First(&lock); err != nil {
+		return false, sqlcon.HandleError(err)
+	}
+	return lock.Holder == holder, nil
+}
+
+func (p *Persister) ReleaseLock(ctx context.Context, name, holder string) error {
+	if p.missingTable(ctx, clusterLocksTable) {
+		return nil
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).
+		RawQuery("DELETE FROM "+clusterLocksTable+" WHERE name = ? AND holder = ?", name, holder).
+		Exec())
+}
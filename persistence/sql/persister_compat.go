@@ -0,0 +1,239 @@
+package sql
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// migrationGatedColumns lists, per table, the columns which were added by a migration the code can run
+// without. Until that migration is applied, these columns are left out of all queries. This allows
+// rolling out a new release before running `kratos migrate sql`.
+//
+// Once a column is listed here, the features depending on it must check missingColumns and degrade
+// gracefully or fail with ErrMigrationPending. The same applies to migrationGatedTables.
+var migrationGatedColumns = map[string]map[string]string{
+	"selfservice_login_requests": {
+		"password_rotation_identity_id": "20191100000013",
+		"locale":                        "20191100000017",
+		"approval_state":                "20191100000028",
+		"approved_identity_id":          "20191100000028",
+		"second_factor_identity_id":     "20191100000030",
+		"first_factor":                  "20191100000030",
+		"browser_binding":               "20191100000038",
+	},
+	"selfservice_registration_requests": {
+		"locale":          "20191100000017",
+		"browser_binding": "20191100000038",
+	},
+	"selfservice_profile_management_requests": {
+		"locale":          "20191100000017",
+		"browser_binding": "20191100000038",
+	},
+	"selfservice_verification_requests": {
+		"locale": "20191100000017",
+	},
+	"selfservice_recovery_requests": {
+		"browser_binding": "20191100000048",
+	},
+	"idempotency_records": {
+		"request_hash":   "20191100000023",
+		"location":       "20191100000023",
+		"body_encrypted": "20191100000044",
+	},
+	"identity_credential_identifiers": {
+		"identity_id":                 "20191100000024",
+		"identity_credential_type_id": "20191100000024",
+		"normalized_identifier":       "20191100000024",
+	},
+	"courier_messages": {
+		"request_id":      "20191100000027",
+		"category":        "20191100000036",
+		"body_encrypted":  "20191100000042",
+		"send_count":      "20191100000043",
+		"next_attempt_at": "20191100000043",
+	},
+	"sessions": {
+		"second_factor_authenticated": "20191100000034",
+	},
+}
+
+// migrationGatedTables lists tables which were added by a migration the code can run without, like
+// migrationGatedColumns does for columns.
+var migrationGatedTables = map[string]string{
+	"identity_login_events":             "20191100000014",
+	"identity_retention_notices":        "20191100000016",
+	"identity_invitations":              "20191100000018",
+	"identity_registration_approvals":   "20191100000018",
+	"identity_merges":                   "20191100000019",
+	"identity_relationships":            "20191100000020",
+	"session_delegations":               "20191100000020",
+	"identity_scheduled_actions":        "20191100000021",
+	"identity_deactivations":            "20191100000021",
+	"idempotency_records":               "20191100000022",
+	"cluster_locks":                     "20191100000026",
+	"selfservice_device_authorizations": "20191100000029",
+	"selfservice_login_push_challenges": "20191100000031",
+	"selfservice_login_email_codes":     "20191100000032",
+	"identity_trusted_devices":          "20191100000033",
+	"identity_schemas":                  "20191100000035",
+	"identity_schema_versions":          "20191100000035",
+	"identity_action_tokens":            "20191100000037",
+	"identity_redemptions":              "20191100000039",
+	"maintenance_mode":                  "20191100000040",
+	"identity_write_locks":              "20191100000040",
+	"webhook_subscriptions":             "20191100000041",
+	"webhook_deliveries":                "20191100000041",
+	"identity_metadata":                 "20191100000045",
+	"selfservice_recovery_requests":     "20191100000046",
+	"selfservice_recovery_codes":        "20191100000046",
+	"selfservice_recovery_tickets":      "20191100000046",
+}
+
+// optionalMigrations lists migrations which only improve performance, for example by adding indexes.
+// The code runs without them.
+var optionalMigrations = map[string]bool{
+	"20191100000015": true,
+	"20191100000025": true,
+	"20191100000047": true,
+}
+
+// schemaCompatibilityCheckInterval is the interval in which the migration status is checked again,
+// so that gated columns are used shortly after the migrations were applied.
+const schemaCompatibilityCheckInterval = time.Minute
+
+// ErrMigrationPending is returned by features which require a migration that has not been applied yet.
+var ErrMigrationPending = herodot.ErrInternalServerError.
+	WithReason("This feature requires a database migration which has not been applied yet. Run kratos migrate sql to apply it.")
+
+type schemaCompatibility struct {
+	sync.Mutex
+	checkedAt time.Time
+	pending   map[string]bool
+}
+
+func (s *schemaCompatibility) reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.checkedAt = time.Time{}
+}
+
+// RequiredMigrations returns the versions of all pending migrations this release can not run without.
+func (p *Persister) RequiredMigrations(ctx context.Context) ([]string, error) {
+	pending, err := p.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gated := map[string]bool{}
+	for version := range optionalMigrations {
+		gated[version] = true
+	}
+	for _, columns := range migrationGatedColumns {
+		for _, version := range columns {
+			gated[version] = true
+		}
+	}
+	for _, version := range migrationGatedTables {
+		gated[version] = true
+	}
+
+	var required []string
+	for _, version := range pending {
+		if !gated[version] {
+			required = append(required, version)
+		}
+	}
+	return required, nil
+}
+
+// isPending returns true if the migration has not been applied yet. The migration status is cached for
+// schemaCompatibilityCheckInterval.
+func (p *Persister) isPending(ctx context.Context, version string) bool {
+	p.compat.Lock()
+	defer p.compat.Unlock()
+
+	if time.Since(p.compat.checkedAt) > schemaCompatibilityCheckInterval {
+		pending, err := p.PendingMigrations(ctx)
+		if err != nil {
+			// Assume that the schema is up to date, which is how ORY Kratos behaved before.
+			p.r.Logger().WithError(err).Warn("Unable to check for pending SQL migrations.")
+			return false
+		}
+
+		p.compat.pending = map[string]bool{}
+		for _, version := range pending {
+			p.compat.pending[version] = true
+		}
+		p.compat.checkedAt = time.Now()
+	}
+
+	return p.compat.pending[version]
+}
+
+// missingColumns returns the columns of the table which are gated by a migration that has not been
+// applied yet.
+func (p *Persister) missingColumns(ctx context.Context, table string) []string {
+	var missing []string
+	for column, version := range migrationGatedColumns[table] {
+		if p.isPending(ctx, version) {
+			missing = append(missing, column)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// missingTable returns true if the table is gated by a migration that has not been applied yet.
+func (p *Persister) missingTable(ctx context.Context, table string) bool {
+	version, ok := migrationGatedTables[table]
+	return ok && p.isPending(ctx, version)
+}
+
+// requireTable returns ErrMigrationPending if the table has not been created yet.
+func (p *Persister) requireTable(ctx context.Context, table string) error {
+	if p.missingTable(ctx, table) {
+		return errors.WithStack(ErrMigrationPending.WithDetail("table", table))
+	}
+	return nil
+}
+
+// requireColumn returns ErrMigrationPending if the column has not been added to the table yet.
+func (p *Persister) requireColumn(ctx context.Context, table, column string) error {
+	for _, missing := range p.missingColumns(ctx, table) {
+		if missing == column {
+			return errors.WithStack(ErrMigrationPending.WithDetail("column", table+"."+column))
+		}
+	}
+	return nil
+}
+
+// selectColumns returns the columns of the model without the missing ones.
+func selectColumns(model interface{}, missing []string) []string {
+	skip := map[string]bool{}
+	for _, column := range missing {
+		skip[column] = true
+	}
+
+	t := reflect.Indirect(reflect.ValueOf(model)).Type()
+	var columns []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("db")
+		if len(tag) == 0 || tag == "-" {
+			continue
+		}
+
+		column := strings.Split(tag, ",")[0]
+		if !skip[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -3,6 +3,7 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
@@ -14,17 +15,35 @@ import (
 
 var _ courier.Persister = new(Persister)
 
+const courierMessagesTable = "courier_messages"
+
 func (p *Persister) AddMessage(ctx context.Context, m *courier.Message) error {
 	m.Status = courier.MessageStatusQueued
-	return sqlcon.HandleError(p.GetConnection(ctx).Create(m)) // do not create eager to avoid identity injection.
+	if !m.BodyEncrypted && p.requireColumn(ctx, courierMessagesTable, "body_encrypted") == nil {
+		body, err := p.r.Cipher().Encrypt([]byte(m.Body))
+		if err != nil {
+			return err
+		}
+		m.Body, m.BodyEncrypted = body, true
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(m, p.missingColumns(ctx, courierMessagesTable)...)) // do not create eager to avoid identity injection.
 }
 
 func (p *Persister) NextMessages(ctx context.Context, limit uint8) ([]courier.Message, error) {
 	var m []courier.Message
-	if err := p.GetConnection(ctx).
-		Eager().
-		Where("status != ?", courier.MessageStatusSent).
-		Order("created_at ASC").Limit(int(limit)).All(&m); err != nil {
+	q := p.GetConnection(ctx).Q().Eager()
+	if missing := p.missingColumns(ctx, courierMessagesTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&courier.Message{}, missing)...)
+	}
+
+	q = q.Where("status = ?", courier.MessageStatusQueued)
+	if p.requireColumn(ctx, courierMessagesTable, "next_attempt_at") == nil {
+		// Messages which failed are skipped until they are due again, so that they do not block the queue.
+		q = q.Where("(next_attempt_at IS NULL OR next_attempt_at <= ?)", time.Now().UTC())
+	}
+
+	if err := q.Order("created_at ASC").Limit(int(limit)).All(&m); err != nil {
 		if errors.Cause(err) == sql.ErrNoRows {
 			return nil, errors.WithStack(courier.ErrQueueEmpty)
 		}
@@ -40,9 +59,13 @@ func (p *Persister) NextMessages(ctx context.Context, limit uint8) ([]courier.Me
 
 func (p *Persister) LatestQueuedMessage(ctx context.Context) (*courier.Message, error) {
 	var m courier.Message
-	if err := p.GetConnection(ctx).
-		Eager().
-		Where("status != ?", courier.MessageStatusSent).
+	q := p.GetConnection(ctx).Q().Eager()
+	if missing := p.missingColumns(ctx, courierMessagesTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&m, missing)...)
+	}
+
+	if err := q.
+		Where("status = ?", courier.MessageStatusQueued).
 		Order("created_at DESC").First(&m); err != nil {
 		if errors.Cause(err) == sql.ErrNoRows {
 			return nil, errors.WithStack(courier.ErrQueueEmpty)
@@ -53,6 +76,16 @@ func (p *Persister) LatestQueuedMessage(ctx context.Context) (*courier.Message,
 	return &m, nil
 }
 
+func (p *Persister) CapturedMessages(ctx context.Context, limit, offset int) ([]courier.Message, error) {
+	m := make([]courier.Message, 0)
+	if err := p.GetConnection(ctx).
+		RawQuery("SELECT * FROM courier_messages WHERE status = ? ORDER BY created_at DESC LIMIT ? OFFSET ?", courier.MessageStatusCaptured, limit, offset).
+		All(&m); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return m, nil
+}
+
 func (p *Persister) SetMessageStatus(ctx context.Context, id uuid.UUID, ms courier.MessageStatus) error {
 	count, err := p.GetConnection(ctx).RawQuery("UPDATE courier_messages SET status = ? WHERE id = ?", ms, id).ExecWithCount()
 	if err != nil {
@@ -65,3 +98,57 @@ func (p *Persister) SetMessageStatus(ctx context.Context, id uuid.UUID, ms couri
 
 	return nil
 }
+
+func (p *Persister) SetMessageNextAttempt(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time) error {
+	if err := p.requireColumn(ctx, courierMessagesTable, "next_attempt_at"); err != nil {
+		// Until the migration has been applied, failed messages are tried again right away.
+		return nil
+	}
+
+	count, err := p.GetConnection(ctx).
+		RawQuery("UPDATE courier_messages SET send_count = send_count + 1, next_attempt_at = ? WHERE id = ?", nextAttemptAt.UTC(), id).
+		ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (p *Persister) EncryptMessages(ctx context.Context, limit int) (int, error) {
+	if err := p.requireColumn(ctx, courierMessagesTable, "body_encrypted"); err != nil {
+		// Until the migration has been applied, all bodies are stored in plaintext.
+		return 0, nil
+	}
+
+	var ms []courier.Message
+	if err := p.GetConnection(ctx).
+		RawQuery("SELECT * FROM courier_messages WHERE body_encrypted = ? LIMIT ?", false, limit).
+		All(&ms); err != nil {
+		return 0, sqlcon.HandleError(err)
+	}
+
+	var encrypted int
+	for k := range ms {
+		body, err := p.r.Cipher().Encrypt([]byte(ms[k].Body))
+		if err != nil {
+			return encrypted, err
+		}
+
+		// The condition on body_encrypted keeps messages from being encrypted twice if several instances
+		// run this at the same time.
+		count, err := p.GetConnection(ctx).
+			RawQuery("UPDATE courier_messages SET body = ?, body_encrypted = ? WHERE id = ? AND body_encrypted = ?", body, true, ms[k].ID, false).
+			ExecWithCount()
+		if err != nil {
+			return encrypted, sqlcon.HandleError(err)
+		}
+		encrypted += count
+	}
+
+	return encrypted, nil
+}
@@ -0,0 +1,84 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/selfservice/flow/device"
+)
+
+var _ device.Persister = new(Persister)
+
+const deviceAuthorizationsTable = "selfservice_device_authorizations"
+
+func (p *Persister) CreateDeviceAuthorization(ctx context.Context, a *device.Authorization) error {
+	if err := p.requireTable(ctx, deviceAuthorizationsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(a))
+}
+
+func (p *Persister) GetDeviceAuthorizationByDeviceCode(ctx context.Context, deviceCodeHash string) (*device.Authorization, error) {
+	return p.getDeviceAuthorization(ctx, "device_code_hash = ?", deviceCodeHash)
+}
+
+func (p *Persister) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*device.Authorization, error) {
+	return p.getDeviceAuthorization(ctx, "user_code = ?", userCode)
+}
+
+func (p *Persister) getDeviceAuthorization(ctx context.Context, where string, args ...interface{}) (*device.Authorization, error) {
+	if err := p.requireTable(ctx, deviceAuthorizationsTable); err != nil {
+		return nil, err
+	}
+
+	var a device.Authorization
+	if err := p.GetConnection(ctx).Where(where, args...).First(&a); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &a, nil
+}
+
+func (p *Persister) UpdateDeviceAuthorizationState(ctx context.Context, id uuid.UUID, from, to device.State, identityID uuid.NullUUID) error {
+	if err := p.requireTable(ctx, deviceAuthorizationsTable); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+deviceAuthorizationsTable+" SET state = ?, identity_id = ?, updated_at = ? WHERE id = ? AND state = ? AND expires_at > ?",
+		to, identityID, now, id, from, now,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) MarkDeviceAuthorizationPolled(ctx context.Context, id uuid.UUID, interval time.Duration) error {
+	if err := p.requireTable(ctx, deviceAuthorizationsTable); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+deviceAuthorizationsTable+" SET last_polled_at = ? WHERE id = ? AND (last_polled_at IS NULL OR last_polled_at <= ?)",
+		now, id, now.Add(-interval),
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
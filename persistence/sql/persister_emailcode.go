@@ -0,0 +1,95 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/selfservice/strategy/emailcode"
+)
+
+var _ emailcode.Persister = new(Persister)
+
+const loginEmailCodesTable = "selfservice_login_email_codes"
+
+func (p *Persister) CreateLoginEmailCode(ctx context.Context, c *emailcode.Code) error {
+	if err := p.requireTable(ctx, loginEmailCodesTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(c))
+}
+
+func (p *Persister) GetLatestLoginEmailCode(ctx context.Context, loginRequestID uuid.UUID) (*emailcode.Code, error) {
+	if err := p.requireTable(ctx, loginEmailCodesTable); err != nil {
+		return nil, err
+	}
+
+	var c emailcode.Code
+	if err := p.GetConnection(ctx).
+		Where("selfservice_login_request_id = ?", loginRequestID).
+		Order("created_at DESC").
+		First(&c); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &c, nil
+}
+
+func (p *Persister) CountLoginEmailCodes(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error) {
+	if err := p.requireTable(ctx, loginEmailCodesTable); err != nil {
+		return 0, err
+	}
+
+	q := p.GetConnection(ctx).Where("created_at > ?", since)
+	if identityID != uuid.Nil {
+		q = q.Where("identity_id = ?", identityID)
+	}
+
+	count, err := q.Count(new(emailcode.Code))
+	if err != nil {
+		return 0, sqlcon.HandleError(err)
+	}
+	return count, nil
+}
+
+func (p *Persister) UseLoginEmailCodeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) error {
+	if err := p.requireTable(ctx, loginEmailCodesTable); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+loginEmailCodesTable+" SET attempts = attempts + 1, updated_at = ? WHERE id = ? AND used = ? AND attempts < ? AND expires_at > ?",
+		now, id, false, maxAttempts, now,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) MarkLoginEmailCodeUsed(ctx context.Context, id uuid.UUID) error {
+	if err := p.requireTable(ctx, loginEmailCodesTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+loginEmailCodesTable+" SET used = ?, updated_at = ? WHERE id = ? AND used = ?",
+		true, time.Now().UTC(), id, false,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	stderr "errors"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -17,12 +18,13 @@ import (
 	"github.com/ory/x/sqlcon"
 
 	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/x"
 )
 
 var _ errorx.Persister = new(Persister)
 
 func (p *Persister) Add(ctx context.Context, csrfToken string, errs ...error) (uuid.UUID, error) {
-	buf, err := p.encodeSelfServiceErrors(errs)
+	buf, err := p.encodeSelfServiceErrors(errs, x.RequestID(ctx))
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -55,7 +57,7 @@ func (p *Persister) Read(ctx context.Context, id uuid.UUID) (*errorx.ErrorContai
 
 func (p *Persister) Clear(ctx context.Context, olderThan time.Duration, force bool) (err error) {
 	if force {
-		err = p.GetConnection(ctx).RawQuery("DELETE FROM selfservice_errors WHERE seen_at < ? AND seen_at IS NOT NULL", olderThan).Exec()
+		err = p.GetConnection(ctx).RawQuery("DELETE FROM selfservice_errors WHERE created_at < ?", time.Now().UTC().Add(-olderThan)).Exec()
 	} else {
 		err = p.GetConnection(ctx).RawQuery("DELETE FROM selfservice_errors WHERE was_seen=true AND seen_at < ? AND seen_at IS NOT NULL", time.Now().UTC().Add(-olderThan)).Exec()
 	}
@@ -63,7 +65,38 @@ func (p *Persister) Clear(ctx context.Context, olderThan time.Duration, force bo
 	return sqlcon.HandleError(err)
 }
 
-func (p *Persister) encodeSelfServiceErrors(errs []error) (*bytes.Buffer, error) {
+func (p *Persister) List(ctx context.Context, filter errorx.ListFilter, limit, offset int) ([]errorx.ErrorContainer, error) {
+	var where []string
+	var args []interface{}
+
+	if filter.Seen != nil {
+		where = append(where, "was_seen = ?")
+		args = append(args, *filter.Seen)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where = append(where, "created_at > ?")
+		args = append(args, filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.CreatedBefore)
+	}
+
+	query := "SELECT * FROM selfservice_errors"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	var ecs []errorx.ErrorContainer
+	if err := p.GetConnection(ctx).RawQuery(query, args...).All(&ecs); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return ecs, nil
+}
+
+func (p *Persister) encodeSelfServiceErrors(errs []error, requestID string) (*bytes.Buffer, error) {
 	es := make([]interface{}, len(errs))
 	for k, e := range errs {
 		e = errorsx.Cause(e)
@@ -74,6 +107,7 @@ func (p *Persister) encodeSelfServiceErrors(errs []error) (*bytes.Buffer, error)
 		if e == nil {
 			return nil, errors.WithStack(herodot.ErrInternalServerError.WithDebug("A nil error was passed to the error manager which is most likely a code bug."))
 		}
+		id := errorx.ErrorID(e)
 
 		// Convert to a default error if the error type is unknown. Helps to properly
 		// pass through system errors.
@@ -84,7 +118,16 @@ func (p *Persister) encodeSelfServiceErrors(errs []error) (*bytes.Buffer, error)
 			e = herodot.ToDefaultError(e, "")
 		}
 
-		es[k] = e
+		encoded, err := withErrorID(e, id)
+		if err != nil {
+			return nil, err
+		}
+
+		// The request ID lets users quote the error to support, like the errors of API responses.
+		if _, ok := encoded["request"]; !ok && len(requestID) > 0 {
+			encoded["request"] = requestID
+		}
+		es[k] = encoded
 	}
 
 	var b bytes.Buffer
@@ -94,3 +137,22 @@ func (p *Persister) encodeSelfServiceErrors(errs []error) (*bytes.Buffer, error)
 
 	return &b, nil
 }
+
+// withErrorID adds the error ID to the JSON representation of the error.
+func withErrorID(e error, id string) (map[string]interface{}, error) {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to encode error messages.").WithDebug(err.Error()))
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to encode error messages.").WithDebug(err.Error()))
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+
+	fields["id"] = id
+	return fields, nil
+}
@@ -0,0 +1,124 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/idempotency"
+)
+
+var _ idempotency.Persister = new(Persister)
+
+const idempotencyRecordsTable = "idempotency_records"
+
+func (p *Persister) CreateIdempotencyRecord(ctx context.Context, r *idempotency.Record) error {
+	if err := p.requireTable(ctx, idempotencyRecordsTable); err != nil {
+		return err
+	}
+
+	stored, err := p.encryptIdempotencyRecord(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(stored, p.missingColumns(ctx, idempotencyRecordsTable)...))
+}
+
+func (p *Persister) GetIdempotencyRecord(ctx context.Context, scope, key string) (*idempotency.Record, error) {
+	if err := p.requireTable(ctx, idempotencyRecordsTable); err != nil {
+		return nil, err
+	}
+
+	var r idempotency.Record
+	q := p.GetConnection(ctx).Where("scope = ? AND idempotency_key = ?", scope, key)
+	if missing := p.missingColumns(ctx, idempotencyRecordsTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&r, missing)...)
+	}
+
+	if err := q.First(&r); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	if r.BodyEncrypted {
+		body, err := p.r.Cipher().Decrypt(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body, r.BodyEncrypted = string(body), false
+	}
+	return &r, nil
+}
+
+func (p *Persister) UpdateIdempotencyRecord(ctx context.Context, r *idempotency.Record) error {
+	if err := p.requireTable(ctx, idempotencyRecordsTable); err != nil {
+		return err
+	}
+
+	stored, err := p.encryptIdempotencyRecord(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	query, args := "UPDATE "+idempotencyRecordsTable+" SET status_code = ?, body = ? WHERE id = ?", []interface{}{stored.StatusCode, stored.Body, stored.ID}
+	if p.requireColumn(ctx, idempotencyRecordsTable, "body_encrypted") == nil {
+		query, args = "UPDATE "+idempotencyRecordsTable+" SET status_code = ?, body = ?, body_encrypted = ?, location = ? WHERE id = ?", []interface{}{stored.StatusCode, stored.Body, stored.BodyEncrypted, stored.Location, stored.ID}
+	} else if p.requireColumn(ctx, idempotencyRecordsTable, "location") == nil {
+		query, args = "UPDATE "+idempotencyRecordsTable+" SET status_code = ?, body = ?, location = ? WHERE id = ?", []interface{}{stored.StatusCode, stored.Body, stored.Location, stored.ID}
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery(query, args...).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+// encryptIdempotencyRecord returns a copy of the record with the encrypted body. Until the migration has been
+// applied, bodies are stored in plaintext.
+func (p *Persister) encryptIdempotencyRecord(ctx context.Context, r *idempotency.Record) (*idempotency.Record, error) {
+	stored := *r
+	if len(r.Body) == 0 || p.requireColumn(ctx, idempotencyRecordsTable, "body_encrypted") != nil {
+		return &stored, nil
+	}
+
+	body, err := p.r.Cipher().Encrypt([]byte(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	stored.Body, stored.BodyEncrypted = body, true
+	return &stored, nil
+}
+
+func (p *Persister) DeleteIdempotencyRecord(ctx context.Context, id uuid.UUID) error {
+	if err := p.requireTable(ctx, idempotencyRecordsTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).
+		RawQuery("DELETE FROM "+idempotencyRecordsTable+" WHERE id = ?", id).
+		Exec())
+}
+
+func (p *Persister) DeleteExpiredIdempotencyRecords(ctx context.Context, createdBefore time.Time) (int, error) {
+	// Without the migration no records could have been stored.
+	if p.missingTable(ctx, idempotencyRecordsTable) {
+		return 0, nil
+	}
+
+	count, err := p.GetConnection(ctx).
+		RawQuery("DELETE FROM "+idempotencyRecordsTable+" WHERE created_at < ?", createdBefore).
+		ExecWithCount()
+	if err != nil {
+		return 0, sqlcon.HandleError(err)
+	}
+	return count, nil
+}
@@ -21,28 +21,59 @@ import (
 	"github.com/ory/x/sqlcon"
 
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/schema"
 )
 
 var _ identity.Pool = new(Persister)
 var _ identity.PrivilegedPool = new(Persister)
 
+const credentialIdentifiersTable = "identity_credential_identifiers"
+
+// credentialIdentifierJoinQuery resolves an identifier through the credentials it belongs to. Unlike the lookup
+// columns of the identifiers, this works for identifiers stored by any release.
+const credentialIdentifierJoinQuery = `SELECT
+    ic.identity_id
+FROM identity_credentials ic
+         INNER JOIN identity_credential_types ict on ic.identity_credential_type_id = ict.id
+         INNER JOIN identity_credential_identifiers ici on ic.id = ici.identity_credential_id
+WHERE ici.identifier = ?
+  AND ict.name = ?`
+
 func (p *Persister) FindByCredentialsIdentifier(ctx context.Context, ct identity.CredentialsType, match string) (*identity.Identity, *identity.Credentials, error) {
-	var cts []identity.CredentialsTypeTable
-	if err := p.GetConnection(ctx).All(&cts); err != nil {
-		return nil, nil, sqlcon.HandleError(err)
+	defer p.observe(ctx, "FindByCredentialsIdentifier", time.Now())
+
+	if err := p.injectFault(ctx); err != nil {
+		return nil, nil, err
 	}
 
+	match = identity.NormalizeIdentifier(ct, match)
+
 	var find struct {
 		IdentityID uuid.UUID `db:"identity_id"`
 	}
 
-	if err := p.GetConnection(ctx).RawQuery(`SELECT
-    ic.identity_id
-FROM identity_credentials ic
-         INNER JOIN identity_credential_types ict on ic.identity_credential_type_id = ict.id
-         INNER JOIN identity_credential_identifiers ici on ic.id = ici.identity_credential_id
-WHERE ici.identifier = ?
-  AND ict.name = ?`, match, ct).First(&find); err != nil {
+	missing := p.missingColumns(ctx, credentialIdentifiersTable)
+	condition, arg := p.identifierLookupCondition(ctx, match)
+	q := p.GetConnection(ctx).RawQuery(`SELECT
+    ici.identity_id
+FROM identity_credential_identifiers ici
+         INNER JOIN identity_credential_types ict on ici.identity_credential_type_id = ict.id
+WHERE `+condition+`
+  AND ici.identifier = ?
+  AND ict.name = ?`, arg, match, ct)
+	if len(missing) > 0 {
+		// Without the lookup columns, the identifier is resolved through the credentials.
+		q = p.GetConnection(ctx).RawQuery(credentialIdentifierJoinQuery, match, ct)
+	}
+
+	err := q.First(&find)
+	if errors.Cause(err) == sql.ErrNoRows && len(missing) == 0 {
+		// Replicas running the previous release do not fill in the lookup columns. Their identifiers are resolved
+		// through the credentials until BackfillCredentialIdentifiers filled them in.
+		err = p.GetConnection(ctx).RawQuery(credentialIdentifierJoinQuery+`
+  AND ici.normalized_identifier = ''`, match, ct).First(&find)
+	}
+	if err != nil {
 		if errors.Cause(err) == sql.ErrNoRows {
 			return nil, nil, herodot.ErrNotFound.WithTrace(err).WithReasonf(`No identity matching credentials identifier "%s" could be found.`, match)
 		}
@@ -63,6 +94,66 @@ WHERE ici.identifier = ?
 	return i.CopyWithoutCredentials(), creds, nil
 }
 
+// credentialIdentifierIndexMigration adds case-insensitive indexes of the identifiers on the dialects which support
+// them.
+const credentialIdentifierIndexMigration = "20191100000047"
+
+// identifierLookupCondition returns the condition, and its argument, which finds the normalized identifier
+// regardless of its case using an index. PostgreSQL and SQLite index the identifier itself, see
+// credentialIdentifierIndexMigration. On other dialects, and until that migration is applied, the lower-case
+// normalized_identifier column is used.
+func (p *Persister) identifierLookupCondition(ctx context.Context, match string) (string, string) {
+	if !p.isPending(ctx, credentialIdentifierIndexMigration) {
+		switch p.GetConnection(ctx).Dialect.Name() {
+		case "postgres":
+			return "LOWER(ici.identifier) = LOWER(?)", match
+		case "sqlite3":
+			return "ici.identifier = ? COLLATE NOCASE", match
+		}
+	}
+	return "ici.normalized_identifier = ?", strings.ToLower(match)
+}
+
+func (p *Persister) BackfillCredentialIdentifiers(ctx context.Context, limit int) (int, error) {
+	if len(p.missingColumns(ctx, credentialIdentifiersTable)) > 0 {
+		// The lookup columns do not exist yet, identifiers are resolved through the credentials.
+		return 0, nil
+	}
+
+	var cs []struct {
+		ID                uuid.UUID                `db:"id"`
+		Identifier        string                   `db:"identifier"`
+		IdentityID        uuid.UUID                `db:"identity_id"`
+		CredentialsTypeID uuid.UUID                `db:"identity_credential_type_id"`
+		TypeName          identity.CredentialsType `db:"type_name"`
+	}
+	if err := p.GetConnection(ctx).RawQuery(`SELECT
+    ici.id, ici.identifier, ic.identity_id, ic.identity_credential_type_id, ict.name AS type_name
+FROM identity_credential_identifiers ici
+         INNER JOIN identity_credentials ic on ic.id = ici.identity_credential_id
+         INNER JOIN identity_credential_types ict on ic.identity_credential_type_id = ict.id
+WHERE ici.normalized_identifier = ''
+LIMIT ?`, limit).All(&cs); err != nil {
+		return 0, sqlcon.HandleError(err)
+	}
+
+	var filled int
+	for _, c := range cs {
+		// The condition on normalized_identifier keeps identifiers from being updated twice if several instances
+		// run this at the same time.
+		count, err := p.GetConnection(ctx).RawQuery(
+			"UPDATE "+credentialIdentifiersTable+" SET identity_id = ?, identity_credential_type_id = ?, normalized_identifier = ? WHERE id = ? AND normalized_identifier = ''",
+			c.IdentityID, c.CredentialsTypeID, strings.ToLower(identity.NormalizeIdentifier(c.TypeName, c.Identifier)), c.ID,
+		).ExecWithCount()
+		if err != nil {
+			return filled, sqlcon.HandleError(err)
+		}
+		filled += count
+	}
+
+	return filled, nil
+}
+
 func findOrCreateIdentityCredentialsType(_ context.Context, tx *pop.Connection, ct identity.CredentialsType) (*identity.CredentialsTypeTable, error) {
 	var m identity.CredentialsTypeTable
 	if err := tx.Where("name = ?", ct).First(&m); err != nil {
@@ -79,7 +170,7 @@ func findOrCreateIdentityCredentialsType(_ context.Context, tx *pop.Connection,
 	return &m, nil
 }
 
-func createIdentityCredentials(ctx context.Context, tx *pop.Connection, i *identity.Identity) error {
+func (p *Persister) createIdentityCredentials(ctx context.Context, tx *pop.Connection, i *identity.Identity) error {
 	for k, cred := range i.Credentials {
 		cred.IdentityID = i.ID
 		if len(cred.Config) == 0 {
@@ -97,11 +188,7 @@ func createIdentityCredentials(ctx context.Context, tx *pop.Connection, i *ident
 		}
 
 		for _, ids := range cred.Identifiers {
-			// Force case-insensitivity for email addresses
-			if strings.Contains(ids, "@") && cred.Type == identity.CredentialsTypePassword {
-				ids = strings.ToLower(ids)
-			}
-
+			ids = identity.NormalizeIdentifier(cred.Type, ids)
 			if len(ids) == 0 {
 				return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to create identity credentials with missing or empty identifier."))
 			}
@@ -109,8 +196,11 @@ func createIdentityCredentials(ctx context.Context, tx *pop.Connection, i *ident
 			ci := &identity.CredentialIdentifier{
 				Identifier:            ids,
 				IdentityCredentialsID: cred.ID,
+				IdentityID:            i.ID,
+				CredentialsTypeID:     ct.ID,
+				NormalizedIdentifier:  strings.ToLower(ids),
 			}
-			if err := tx.Create(ci); err != nil {
+			if err := tx.Create(ci, p.missingColumns(ctx, credentialIdentifiersTable)...); err != nil {
 				return err
 			}
 		}
@@ -132,6 +222,10 @@ func createVerifiableAddresses(ctx context.Context, tx *pop.Connection, i *ident
 }
 
 func (p *Persister) CreateIdentity(ctx context.Context, i *identity.Identity) error {
+	if err := p.injectFault(ctx); err != nil {
+		return err
+	}
+
 	if i.TraitsSchemaID == "" {
 		i.TraitsSchemaID = configuration.DefaultIdentityTraitsSchemaID
 	}
@@ -140,7 +234,9 @@ func (p *Persister) CreateIdentity(ctx context.Context, i *identity.Identity) er
 		i.Traits = identity.Traits("{}")
 	}
 
-	if err := p.injectTraitsSchemaURL(i); err != nil {
+	ss := p.r.IdentityTraitsSchemas()
+	pinTraitsSchema(ss, i)
+	if err := p.injectTraitsSchemaURL(ss, i); err != nil {
 		return err
 	}
 
@@ -148,7 +244,7 @@ func (p *Persister) CreateIdentity(ctx context.Context, i *identity.Identity) er
 		return err
 	}
 
-	return sqlcon.HandleError(p.GetConnection(ctx).Transaction(func(tx *pop.Connection) error {
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
 		if err := tx.Create(i); err != nil {
 			return err
 		}
@@ -157,7 +253,7 @@ func (p *Persister) CreateIdentity(ctx context.Context, i *identity.Identity) er
 			return err
 		}
 
-		return createIdentityCredentials(ctx, tx, i)
+		return p.createIdentityCredentials(ctx, tx, i)
 	}))
 }
 
@@ -171,8 +267,29 @@ func (p *Persister) ListIdentities(ctx context.Context, limit, offset int) ([]id
 		return nil, err
 	}
 
+	ss := p.r.IdentityTraitsSchemas()
+	for i := range is {
+		if err := p.injectTraitsSchemaURL(ss, &(is[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	return is, nil
+}
+
+func (p *Persister) ListIdentitiesAfter(ctx context.Context, after uuid.UUID, limit int) ([]identity.Identity, error) {
+	is := make([]identity.Identity, 0)
+
+	/* #nosec G201 TableName is static */
+	if err := sqlcon.HandleError(p.GetConnection(ctx).
+		RawQuery(fmt.Sprintf("SELECT * FROM %s WHERE id > ? ORDER BY id ASC LIMIT ?", new(identity.Identity).TableName()), after, limit).
+		Eager("Addresses").All(&is)); err != nil {
+		return nil, err
+	}
+
+	ss := p.r.IdentityTraitsSchemas()
 	for i := range is {
-		if err := p.injectTraitsSchemaURL(&(is[i])); err != nil {
+		if err := p.injectTraitsSchemaURL(ss, &(is[i])); err != nil {
 			return nil, err
 		}
 	}
@@ -181,36 +298,145 @@ func (p *Persister) ListIdentities(ctx context.Context, limit, offset int) ([]id
 }
 
 func (p *Persister) UpdateIdentity(ctx context.Context, i *identity.Identity) error {
+	if err := p.injectFault(ctx); err != nil {
+		return err
+	}
+
 	if err := p.validateIdentity(i); err != nil {
 		return err
 	}
 
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		return p.updateIdentity(ctx, tx, i)
+	}))
+}
+
+func (p *Persister) updateIdentity(ctx context.Context, tx *pop.Connection, i *identity.Identity) error {
+	if count, err := tx.Where("id = ?", i.ID).Count(i); err != nil {
+		return err
+	} else if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	/* #nosec G201 TableName is static */
+	if err := tx.RawQuery(fmt.Sprintf(`DELETE FROM %s WHERE identity_id = ?`, new(identity.Credentials).TableName()), i.ID).Exec(); err != nil {
+		return err
+	}
+
+	/* #nosec G201 TableName is static */
+	if err := tx.RawQuery(fmt.Sprintf(`DELETE FROM %s WHERE identity_id = ?`, new(identity.VerifiableAddress).TableName()), i.ID).Exec(); err != nil {
+		return err
+	}
+
+	if err := tx.Update(i); err != nil {
+		return err
+	}
+
+	if err := createVerifiableAddresses(ctx, tx, i); err != nil {
+		return err
+	}
+
+	return p.createIdentityCredentials(ctx, tx, i)
+}
+
+const identityMergesTable = "identity_merges"
+
+func (p *Persister) MergeIdentity(ctx context.Context, target *identity.Identity, m *identity.Merge) error {
+	if err := p.requireTable(ctx, identityMergesTable); err != nil {
+		return err
+	}
+
+	if err := p.validateIdentity(target); err != nil {
+		return err
+	}
+
 	return sqlcon.HandleError(p.GetConnection(ctx).Transaction(func(tx *pop.Connection) error {
-		if count, err := tx.Where("id = ?", i.ID).Count(i); err != nil {
+		sessions, err := tx.RawQuery("UPDATE sessions SET identity_id = ? WHERE identity_id = ?", m.TargetID, m.SourceID).ExecWithCount()
+		if err != nil {
 			return err
-		} else if count == 0 {
-			return sql.ErrNoRows
 		}
+		m.SessionsTransferred = sessions
 
+		// The source is deleted before the target is updated because the target takes over its credential
+		// identifiers, which are unique.
 		/* #nosec G201 TableName is static */
-		if err := tx.RawQuery(fmt.Sprintf(`DELETE FROM %s WHERE identity_id = ?`, new(identity.Credentials).TableName()), i.ID).Exec(); err != nil {
+		if count, err := tx.RawQuery(fmt.Sprintf("DELETE FROM %s WHERE id = ?", new(identity.Identity).TableName()), m.SourceID).ExecWithCount(); err != nil {
 			return err
+		} else if count == 0 {
+			return sql.ErrNoRows
 		}
 
-		/* #nosec G201 TableName is static */
-		if err := tx.RawQuery(fmt.Sprintf(`DELETE FROM %s WHERE identity_id = ?`, new(identity.VerifiableAddress).TableName()), i.ID).Exec(); err != nil {
+		if err := p.updateIdentity(ctx, tx, target); err != nil {
 			return err
 		}
 
-		if err := tx.Update(i); err != nil {
+		return tx.Create(m)
+	}))
+}
+
+func (p *Persister) ListIdentityMerges(ctx context.Context, target uuid.UUID) ([]identity.Merge, error) {
+	if err := p.requireTable(ctx, identityMergesTable); err != nil {
+		return nil, err
+	}
+
+	ms := make([]identity.Merge, 0)
+	if err := p.GetConnection(ctx).Where("target_id = ?", target).Order("created_at DESC").All(&ms); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return ms, nil
+}
+
+func (p *Persister) FindIdentityMergeBySource(ctx context.Context, source uuid.UUID) (*identity.Merge, error) {
+	// Without the migration no identity was merged.
+	if p.missingTable(ctx, identityMergesTable) {
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	var m identity.Merge
+	if err := p.GetConnection(ctx).Where("source_id = ?", source).First(&m); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &m, nil
+}
+
+const identityMetadataTable = "identity_metadata"
+
+func (p *Persister) GetIdentityMetadata(ctx context.Context, id uuid.UUID) (identity.MetadataObject, error) {
+	// Without the migration no metadata was set.
+	if p.missingTable(ctx, identityMetadataTable) {
+		return identity.MetadataObject("{}"), nil
+	}
+
+	var m identity.Metadata
+	if err := p.GetConnection(ctx).Where("id = ?", id).First(&m); errorsx.Cause(err) == sql.ErrNoRows {
+		return identity.MetadataObject("{}"), nil
+	} else if err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return m.Metadata, nil
+}
+
+func (p *Persister) UpdateIdentityMetadata(ctx context.Context, id uuid.UUID, metadata identity.MetadataObject) error {
+	if err := p.requireTable(ctx, identityMetadataTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).Transaction(func(tx *pop.Connection) error {
+		if exists, err := tx.Where("id = ?", id).Exists(new(identity.Identity)); err != nil {
 			return err
+		} else if !exists {
+			return sql.ErrNoRows
 		}
 
-		if err := createVerifiableAddresses(ctx, tx, i); err != nil {
+		var m identity.Metadata
+		if err := tx.Where("id = ?", id).First(&m); errorsx.Cause(err) == sql.ErrNoRows {
+			return tx.Create(&identity.Metadata{ID: id, Metadata: metadata})
+		} else if err != nil {
 			return err
 		}
 
-		return createIdentityCredentials(ctx, tx, i)
+		m.Metadata = metadata
+		return tx.Update(&m)
 	}))
 }
 
@@ -227,12 +453,18 @@ func (p *Persister) DeleteIdentity(ctx context.Context, id uuid.UUID) error {
 }
 
 func (p *Persister) GetIdentity(ctx context.Context, id uuid.UUID) (*identity.Identity, error) {
+	defer p.observe(ctx, "GetIdentity", time.Now())
+
+	if err := p.injectFault(ctx); err != nil {
+		return nil, err
+	}
+
 	var i identity.Identity
 	if err := p.GetConnection(ctx).Eager("Addresses").Find(&i, id); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
 	i.Credentials = nil
-	if err := p.injectTraitsSchemaURL(&i); err != nil {
+	if err := p.injectTraitsSchemaURL(p.r.IdentityTraitsSchemas(), &i); err != nil {
 		return nil, err
 	}
 
@@ -240,43 +472,61 @@ func (p *Persister) GetIdentity(ctx context.Context, id uuid.UUID) (*identity.Id
 }
 
 func (p *Persister) GetIdentityConfidential(ctx context.Context, id uuid.UUID) (*identity.Identity, error) {
+	defer p.observe(ctx, "GetIdentityConfidential", time.Now())
+
+	if err := p.injectFault(ctx); err != nil {
+		return nil, err
+	}
+
 	var i identity.Identity
-	if err := p.GetConnection(ctx).Eager().Find(&i, id); err != nil {
+	if err := p.GetConnection(ctx).Eager("Addresses").Find(&i, id); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
 
-	var cts []identity.CredentialsTypeTable
-	if err := p.GetConnection(ctx).All(&cts); err != nil {
+	// The credentials and their identifiers are loaded with one query each instead of one query per credential.
+	var creds []credentialsWithType
+	if err := p.GetConnection(ctx).RawQuery(`SELECT
+    ic.id, ic.identity_credential_type_id, ic.config, ic.identity_id, ic.created_at, ic.updated_at, ict.name AS type_name
+FROM identity_credentials ic
+INNER JOIN identity_credential_types ict ON ict.id = ic.identity_credential_type_id
+WHERE ic.identity_id = ?`, id).All(&creds); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
 
-	i.Credentials = map[identity.CredentialsType]identity.Credentials{}
-	for _, creds := range i.CredentialsCollection {
-		var cs identity.CredentialIdentifierCollection
-		if err := p.GetConnection(ctx).Where("identity_credential_id = ?", creds.ID).All(&cs); err != nil {
-			return nil, sqlcon.HandleError(err)
-		}
+	var cs identity.CredentialIdentifierCollection
+	if err := p.GetConnection(ctx).RawQuery(`SELECT
+    ici.id, ici.identity_credential_id, ici.identifier
+FROM `+credentialIdentifiersTable+` ici
+INNER JOIN identity_credentials ic ON ic.id = ici.identity_credential_id
+WHERE ic.identity_id = ?`, id).All(&cs); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
 
-		creds.CredentialIdentifierCollection = nil
-		creds.Identifiers = make([]string, len(cs))
-		for k := range cs {
-			for _, ct := range cts {
-				if ct.ID == creds.CredentialTypeID {
-					creds.Type = ct.Name
-				}
+	i.Credentials = make(map[identity.CredentialsType]identity.Credentials, len(creds))
+	for _, c := range creds {
+		c.Credentials.Type = c.TypeName
+		c.Credentials.Identifiers = []string{}
+		for _, ci := range cs {
+			if ci.IdentityCredentialsID == c.ID {
+				c.Credentials.Identifiers = append(c.Credentials.Identifiers, ci.Identifier)
 			}
-			creds.Identifiers[k] = cs[k].Identifier
 		}
-		i.Credentials[creds.Type] = creds
+		i.Credentials[c.TypeName] = c.Credentials
 	}
 	i.CredentialsCollection = nil
-	if err := p.injectTraitsSchemaURL(&i); err != nil {
+	if err := p.injectTraitsSchemaURL(p.r.IdentityTraitsSchemas(), &i); err != nil {
 		return nil, err
 	}
 
 	return &i, nil
 }
 
+// credentialsWithType are credentials joined with the name of their type.
+type credentialsWithType struct {
+	identity.Credentials
+	TypeName identity.CredentialsType `db:"type_name"`
+}
+
 func (p *Persister) FindAddressByCode(ctx context.Context, code string) (*identity.VerifiableAddress, error) {
 	var address identity.VerifiableAddress
 	if err := p.GetConnection(ctx).Where("code = ?", code).First(&address); err != nil {
@@ -295,32 +545,53 @@ func (p *Persister) FindAddressByValue(ctx context.Context, via identity.Verifia
 	return &address, nil
 }
 
-func (p *Persister) VerifyAddress(ctx context.Context, code string) error {
+func (p *Persister) VerifyAddress(ctx context.Context, code string, by identity.Redeemer) error {
 	newCode, err := identity.NewVerifyCode()
 	if err != nil {
 		return err
 	}
 
-	count, err := p.GetConnection(ctx).RawQuery(
-		/* #nosec G201 TableName is static */
-		fmt.Sprintf(
-			"UPDATE %s SET status = ?, verified = true, verified_at = ?, code = ? WHERE code = ? AND expires_at > ?",
-			new(identity.VerifiableAddress).TableName(),
-		),
-		identity.VerifiableAddressStatusCompleted,
-		time.Now().UTC().Round(time.Second),
-		newCode,
-		code,
-		time.Now().UTC(),
-	).ExecWithCount()
-	if err != nil {
-		return sqlcon.HandleError(err)
+	address, err := p.FindAddressByCode(ctx, code)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		return p.unredeemable(ctx, identity.RedemptionKindVerification, code)
+	} else if err != nil {
+		return err
 	}
 
-	if count == 0 {
-		return sqlcon.HandleError(sqlcon.ErrNoRows)
+	var verified bool
+	if err := p.Transaction(ctx, func(tx *pop.Connection) error {
+		// The code is replaced when the address is verified, which is why concurrent requests with the same code
+		// verify the address only once.
+		count, err := tx.RawQuery(
+			/* #nosec G201 TableName is static */
+			fmt.Sprintf(
+				"UPDATE %s SET status = ?, verified = true, verified_at = ?, code = ? WHERE id = ? AND code = ? AND expires_at > ?",
+				new(identity.VerifiableAddress).TableName(),
+			),
+			identity.VerifiableAddressStatusCompleted,
+			time.Now().UTC().Round(time.Second),
+			newCode,
+			address.ID,
+			code,
+			time.Now().UTC(),
+		).ExecWithCount()
+		if err != nil {
+			return sqlcon.HandleError(err)
+		}
+
+		if count == 0 {
+			return nil
+		}
+
+		verified = true
+		return p.createRedemption(ctx, tx, identity.NewRedemption(identity.RedemptionKindVerification, code, address.IdentityID, by))
+	}); err != nil {
+		return err
 	}
 
+	if !verified {
+		return p.unredeemable(ctx, identity.RedemptionKindVerification, code)
+	}
 	return nil
 }
 
@@ -339,8 +610,17 @@ func (p *Persister) validateIdentity(i *identity.Identity) error {
 	return nil
 }
 
-func (p *Persister) injectTraitsSchemaURL(i *identity.Identity) error {
-	s, err := p.r.IdentityTraitsSchemas().GetByID(i.TraitsSchemaID)
+// pinTraitsSchema makes new identities reference the immutable version of the stored schema they are created with,
+// so that uploading a new version does not affect them.
+func pinTraitsSchema(ss schema.Schemas, i *identity.Identity) {
+	// Unknown schemas are reported by injectTraitsSchemaURL.
+	if s, err := ss.GetByID(i.TraitsSchemaID); err == nil && len(s.VersionID) > 0 {
+		i.TraitsSchemaID = s.VersionID
+	}
+}
+
+func (p *Persister) injectTraitsSchemaURL(ss schema.Schemas, i *identity.Identity) error {
+	s, err := ss.GetByID(i.TraitsSchemaID)
 	if err != nil {
 		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf(
 			`The JSON Schema "%s" for this identity's traits could not be found.`, i.TraitsSchemaID))
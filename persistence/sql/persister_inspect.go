@@ -0,0 +1,208 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/selfservice/flow/inspect"
+)
+
+var _ inspect.Persister = new(Persister)
+
+// flowTable describes where a kind of flow is stored. Empty columns do not exist for the kind.
+type flowTable struct {
+	table           string
+	identityColumn  string
+	completedColumn string
+	csrfColumn      string
+
+	// methodsTable stores the flow's methods and references the flow in methodsColumn.
+	methodsTable  string
+	methodsColumn string
+}
+
+var flowTables = map[inspect.Kind]flowTable{
+	inspect.KindLogin: {
+		table:          loginRequestsTable,
+		identityColumn: "password_rotation_identity_id",
+		csrfColumn:     "csrf_token",
+		methodsTable:   "selfservice_login_request_methods",
+		methodsColumn:  "selfservice_login_request_id",
+	},
+	inspect.KindRegistration: {
+		table:         "selfservice_registration_requests",
+		csrfColumn:    "csrf_token",
+		methodsTable:  "selfservice_registration_request_methods",
+		methodsColumn: "selfservice_registration_request_id",
+	},
+	inspect.KindProfile: {
+		table:           "selfservice_profile_management_requests",
+		identityColumn:  "identity_id",
+		completedColumn: "update_successful",
+	},
+	inspect.KindVerification: {
+		table:           "selfservice_verification_requests",
+		completedColumn: "success",
+		csrfColumn:      "csrf_token",
+	},
+}
+
+func (p *Persister) flowTable(ctx context.Context, kind inspect.Kind) (flowTable, error) {
+	ft, ok := flowTables[kind]
+	if !ok {
+		return ft, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unknown flow kind: %s", kind))
+	}
+
+	for _, missing := range p.missingColumns(ctx, ft.table) {
+		if missing == ft.identityColumn {
+			ft.identityColumn = ""
+		}
+	}
+	return ft, nil
+}
+
+func (p *Persister) ListFlows(ctx context.Context, kind inspect.Kind, filter inspect.Filter, limit, offset int) ([]inspect.Flow, error) {
+	ft, err := p.flowTable(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var where []string
+	var args []interface{}
+
+	if filter.IdentityID != uuid.Nil {
+		if ft.identityColumn == "" {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Flows of kind %s can not be filtered by identity.", kind))
+		}
+		where = append(where, ft.identityColumn+" = ?")
+		args = append(args, filter.IdentityID)
+	}
+
+	switch filter.State {
+	case "":
+	case inspect.StateActive, inspect.StateExpired:
+		op := ">"
+		if filter.State == inspect.StateExpired {
+			op = "<="
+		}
+		where = append(where, "expires_at "+op+" ?")
+		args = append(args, now)
+		if ft.completedColumn != "" {
+			where = append(where, ft.completedColumn+" = ?")
+			args = append(args, false)
+		}
+	case inspect.StateCompleted:
+		if ft.completedColumn == "" {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Flows of kind %s do not record whether they were completed.", kind))
+		}
+		where = append(where, ft.completedColumn+" = ?")
+		args = append(args, true)
+	default:
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unknown flow state: %s", filter.State))
+	}
+
+	if !filter.ExpiresBefore.IsZero() {
+		where = append(where, "expires_at < ?")
+		args = append(args, filter.ExpiresBefore)
+	}
+	if !filter.ExpiresAfter.IsZero() {
+		where = append(where, "expires_at > ?")
+		args = append(args, filter.ExpiresAfter)
+	}
+
+	query := "SELECT " + ft.columns() + " FROM " + ft.table
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY issued_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	var fs []inspect.Flow
+	if err := p.GetConnection(ctx).RawQuery(query, args...).All(&fs); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	for k := range fs {
+		fs[k].Resolve(kind, now)
+	}
+	return fs, nil
+}
+
+func (p *Persister) GetFlow(ctx context.Context, kind inspect.Kind, id uuid.UUID) (*inspect.Flow, error) {
+	ft, err := p.flowTable(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var f inspect.Flow
+	if err := p.GetConnection(ctx).RawQuery("SELECT "+ft.columns()+" FROM "+ft.table+" WHERE id = ?", id).First(&f); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	f.Resolve(kind, time.Now().UTC())
+	return &f, nil
+}
+
+func (p *Persister) ExpireFlow(ctx context.Context, kind inspect.Kind, id uuid.UUID) error {
+	ft, err := p.flowTable(ctx, kind)
+	if err != nil {
+		return err
+	}
+
+	// Subtract a second because some databases round timestamps to full seconds.
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+ft.table+" SET expires_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Second), id,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) DeleteExpiredFlows(ctx context.Context, kind inspect.Kind, expiredBefore time.Time) (count int, err error) {
+	ft, err := p.flowTable(ctx, kind)
+	if err != nil {
+		return 0, err
+	}
+
+	// The methods are deleted explicitly because SQLite only cascades if foreign keys are enabled.
+	err = p.Transaction(ctx, func(tx *pop.Connection) error {
+		if ft.methodsTable != "" {
+			if err := tx.RawQuery(
+				"DELETE FROM "+ft.methodsTable+" WHERE "+ft.methodsColumn+" IN (SELECT id FROM "+ft.table+" WHERE expires_at < ?)", expiredBefore,
+			).Exec(); err != nil {
+				return err
+			}
+		}
+
+		count, err = tx.RawQuery("DELETE FROM "+ft.table+" WHERE expires_at < ?", expiredBefore).ExecWithCount()
+		return err
+	})
+	return count, sqlcon.HandleError(err)
+}
+
+func (ft flowTable) columns() string {
+	columns := []string{"id", "issued_at", "expires_at", "request_url"}
+	if ft.identityColumn != "" {
+		columns = append(columns, ft.identityColumn+" AS identity_id")
+	}
+	if ft.completedColumn != "" {
+		columns = append(columns, ft.completedColumn+" AS completed")
+	}
+	if ft.csrfColumn != "" {
+		columns = append(columns, ft.csrfColumn)
+	}
+	return strings.Join(columns, ", ")
+}
@@ -0,0 +1,34 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/ory/kratos/chaos"
+	"github.com/ory/kratos/x"
+)
+
+// observe logs operations which took longer than the configured slow query threshold. It is deferred at the
+// beginning of the operation:
+//
+//	defer p.observe(ctx, "GetSession", time.Now())
+func (p *Persister) observe(ctx context.Context, operation string, start time.Time) {
+	threshold := p.cf.SlowQueryThreshold()
+	if threshold <= 0 {
+		return
+	}
+
+	if took := time.Since(start); took >= threshold {
+		x.ContextLogger(ctx, p.r.Logger()).
+			WithField("operation", operation).
+			WithField("took", took.String()).
+			WithField("threshold", threshold.String()).
+			Warn("A database operation was slower than the slow query threshold.")
+	}
+}
+
+// injectFault injects the latency and failures configured in chaos.persister. It is called at the beginning of
+// the operations used by the self-service flows and sessions.
+func (p *Persister) injectFault(ctx context.Context) error {
+	return chaos.Inject(ctx, p.cf.Chaos().Persister)
+}
@@ -2,27 +2,56 @@ package sql
 
 import (
 	"context"
+	"time"
 
 	"github.com/gobuffalo/pop/v5"
 
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/ory/x/sqlcon"
 
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
 )
 
 var _ login.RequestPersister = new(Persister)
 
+const (
+	loginRequestsTable       = "selfservice_login_requests"
+	loginRequestMethodsTable = "selfservice_login_request_methods"
+)
+
 func (p *Persister) CreateLoginRequest(ctx context.Context, r *login.Request) error {
-	return p.GetConnection(ctx).Eager().Create(r)
+	if err := p.injectFault(ctx); err != nil {
+		return err
+	}
+
+	return p.GetConnection(ctx).Eager().Create(r, p.missingColumns(ctx, loginRequestsTable)...)
 }
 
 func (p *Persister) GetLoginRequest(ctx context.Context, id uuid.UUID) (*login.Request, error) {
+	defer p.observe(ctx, "GetLoginRequest", time.Now())
+
+	if err := p.injectFault(ctx); err != nil {
+		return nil, err
+	}
+
 	conn := p.GetConnection(ctx)
 	var r login.Request
-	if err := conn.Eager().Find(&r, id); err != nil {
+
+	q := conn.Q()
+	if missing := p.missingColumns(ctx, loginRequestsTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&r, missing)...)
+	}
+
+	if err := q.Find(&r, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	// The methods are not loaded eagerly because pop would load the request of every method again.
+	if err := conn.Where("selfservice_login_request_id = ?", id).All(&r.MethodsRaw); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
 
@@ -42,26 +71,117 @@ func (p *Persister) MarkRequestForced(ctx context.Context, id uuid.UUID) error {
 		}
 
 		lr.Forced = true
-		return tx.Save(lr)
+		return tx.Save(lr, p.missingColumns(ctx, loginRequestsTable)...)
 	})
 }
 
-func (p *Persister) UpdateLoginRequestMethod(ctx context.Context, id uuid.UUID, ct identity.CredentialsType, rm *login.RequestMethod) error {
+func (p *Persister) UpdateLoginRequestPasswordRotation(ctx context.Context, id uuid.UUID, identityID uuid.NullUUID) error {
+	if err := p.requireColumn(ctx, loginRequestsTable, "password_rotation_identity_id"); err != nil {
+		return err
+	}
+
 	return p.Transaction(ctx, func(tx *pop.Connection) error {
 		ctx := WithTransaction(ctx, tx)
-		rr, err := p.GetLoginRequest(ctx, id)
+		lr, err := p.GetLoginRequest(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		lr.PasswordRotationIdentityID = identityID
+		return tx.Save(lr)
+	})
+}
+
+func (p *Persister) UpdateLoginRequestApproval(ctx context.Context, id uuid.UUID, from, to login.ApprovalState, identityID uuid.NullUUID) error {
+	if err := p.requireColumn(ctx, loginRequestsTable, "approval_state"); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+loginRequestsTable+" SET approval_state = ?, approved_identity_id = ?, updated_at = ? WHERE id = ? AND approval_state = ?",
+		to, identityID, time.Now().UTC(), id, from,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	} else if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) UpdateLoginRequestSecondFactor(ctx context.Context, id uuid.UUID, firstFactor identity.CredentialsType, identityID uuid.NullUUID, methods login.RequestMethods) error {
+	if err := p.requireColumn(ctx, loginRequestsTable, "second_factor_identity_id"); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		count, err := tx.RawQuery(
+			"UPDATE "+loginRequestsTable+" SET first_factor = ?, second_factor_identity_id = ?, updated_at = ? WHERE id = ?",
+			firstFactor, identityID, time.Now().UTC(), id,
+		).ExecWithCount()
 		if err != nil {
 			return err
+		} else if count == 0 {
+			return errors.WithStack(sqlcon.ErrNoRows)
 		}
 
-		method, ok := rr.Methods[ct]
-		if !ok {
-			rm.RequestID = rr.ID
-			rm.Method = ct
-			return tx.Save(rm)
+		// The methods of the first factor are removed, so that the login UI only shows the second factors.
+		if err := tx.RawQuery("DELETE FROM "+loginRequestMethodsTable+" WHERE selfservice_login_request_id = ?", id).Exec(); err != nil {
+			return err
 		}
 
-		method.Config = rm.Config
-		return tx.Save(method)
-	})
+		return p.UpdateLoginRequestMethods(WithTransaction(ctx, tx), id, methods)
+	}))
+}
+
+func (p *Persister) UpdateLoginRequestMethod(ctx context.Context, id uuid.UUID, ct identity.CredentialsType, rm *login.RequestMethod) error {
+	return p.UpdateLoginRequestMethods(ctx, id, login.RequestMethods{ct: rm})
+}
+
+func (p *Persister) UpdateLoginRequestMethods(ctx context.Context, id uuid.UUID, methods login.RequestMethods) error {
+	if err := p.injectFault(ctx); err != nil {
+		return err
+	}
+
+	if len(methods) == 0 {
+		return nil
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		// Only the IDs of the stored methods are loaded instead of the whole request.
+		var stored login.RequestMethodsRaw
+		if err := tx.Select("id", "method").Where("selfservice_login_request_id = ?", id).All(&stored); err != nil {
+			return err
+		}
+
+		if len(stored) == 0 {
+			count, err := tx.Where("id = ?", id).Count(new(login.Request))
+			if err != nil {
+				return err
+			} else if count == 0 {
+				return errors.WithStack(sqlcon.ErrNoRows)
+			}
+		}
+
+		ids := make(map[identity.CredentialsType]uuid.UUID, len(stored))
+		for _, m := range stored {
+			ids[m.Method] = m.ID
+		}
+
+		rows := make([]flowMethod, 0, len(methods))
+		for ct, m := range methods {
+			m.RequestID = id
+			m.Method = ct
+
+			mid, ok := ids[ct]
+			if !ok {
+				mid = x.NewUUID()
+			}
+			m.ID = mid
+
+			rows = append(rows, flowMethod{ID: mid, Method: ct, Config: m.Config, Stored: ok})
+		}
+
+		return writeFlowMethods(tx, loginRequestMethodsTable, "selfservice_login_request_id", id, rows)
+	}))
 }
@@ -0,0 +1,137 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/maintenance"
+)
+
+var _ maintenance.Persister = new(Persister)
+
+const (
+	maintenanceModeTable = "maintenance_mode"
+	writeLocksTable      = "identity_write_locks"
+
+	// maintenanceModeName is the name of the row of the global maintenance mode.
+	maintenanceModeName = "global"
+)
+
+func (p *Persister) GetMaintenanceMode(ctx context.Context) (*maintenance.Mode, error) {
+	// Without the migration maintenance mode could not have been enabled.
+	if p.missingTable(ctx, maintenanceModeTable) {
+		return &maintenance.Mode{}, nil
+	}
+
+	var m maintenance.Mode
+	if err := p.GetConnection(ctx).
+		RawQuery("SELECT reason, created_at FROM "+maintenanceModeTable+" WHERE name = ?", maintenanceModeName).
+		First(&m); err != nil {
+		if err = sqlcon.HandleError(err); errorsx.Cause(err) == sqlcon.ErrNoRows {
+			return &maintenance.Mode{}, nil
+		}
+		return nil, err
+	}
+
+	m.Enabled = true
+	return &m, nil
+}
+
+func (p *Persister) SetMaintenanceMode(ctx context.Context, m *maintenance.Mode) error {
+	if err := p.requireTable(ctx, maintenanceModeTable); err != nil {
+		return err
+	}
+
+	enabledAt := time.Now().UTC()
+	if m.EnabledAt != nil {
+		enabledAt = *m.EnabledAt
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		if err := tx.RawQuery("DELETE FROM "+maintenanceModeTable+" WHERE name = ?", maintenanceModeName).Exec(); err != nil {
+			return err
+		}
+		return tx.RawQuery(
+			"INSERT INTO "+maintenanceModeTable+" (name, reason, created_at) VALUES (?, ?, ?)",
+			maintenanceModeName, m.Reason, enabledAt,
+		).Exec()
+	}))
+}
+
+func (p *Persister) DeleteMaintenanceMode(ctx context.Context) error {
+	if p.missingTable(ctx, maintenanceModeTable) {
+		return nil
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).
+		RawQuery("DELETE FROM "+maintenanceModeTable+" WHERE name = ?", maintenanceModeName).
+		Exec())
+}
+
+func (p *Persister) GetWriteLock(ctx context.Context, identityID uuid.UUID) (*maintenance.Lock, error) {
+	// Without the migration no identity could have been locked.
+	if p.missingTable(ctx, writeLocksTable) {
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	var l maintenance.Lock
+	if err := p.GetConnection(ctx).Where("identity_id = ?", identityID).First(&l); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &l, nil
+}
+
+func (p *Persister) ListWriteLocks(ctx context.Context, limit, offset int) ([]maintenance.Lock, error) {
+	ls := make([]maintenance.Lock, 0)
+	if p.missingTable(ctx, writeLocksTable) {
+		return ls, nil
+	}
+
+	if err := p.GetConnection(ctx).
+		RawQuery("SELECT * FROM "+writeLocksTable+" ORDER BY created_at DESC, identity_id ASC LIMIT ? OFFSET ?", limit, offset).
+		All(&ls); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return ls, nil
+}
+
+func (p *Persister) SetWriteLock(ctx context.Context, l *maintenance.Lock) error {
+	if err := p.requireTable(ctx, writeLocksTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		if err := tx.RawQuery("DELETE FROM "+writeLocksTable+" WHERE identity_id = ?", l.IdentityID).Exec(); err != nil {
+			return err
+		}
+		return tx.RawQuery(
+			"INSERT INTO "+writeLocksTable+" (identity_id, reason, created_at) VALUES (?, ?, ?)",
+			l.IdentityID, l.Reason, l.CreatedAt,
+		).Exec()
+	}))
+}
+
+func (p *Persister) DeleteWriteLock(ctx context.Context, identityID uuid.UUID) error {
+	if err := p.requireTable(ctx, writeLocksTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).
+		RawQuery("DELETE FROM "+writeLocksTable+" WHERE identity_id = ?", identityID).
+		ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/kratos/identity"
+)
+
+// flowMethod is a row of one of the tables which store the methods of self-service requests.
+type flowMethod struct {
+	ID     uuid.UUID
+	Method identity.CredentialsType
+	Config interface{}
+
+	// Stored is true if the row exists already.
+	Stored bool
+}
+
+// writeFlowMethods writes the methods of a self-service request. All stored methods are updated by a single
+// statement and all new methods are inserted by another one, so that the number of writes does not grow with
+// the number of methods.
+func writeFlowMethods(tx *pop.Connection, table, requestColumn string, requestID uuid.UUID, methods []flowMethod) error {
+	now := time.Now().UTC()
+
+	var (
+		cases, values []string
+		updateArgs    []interface{}
+		ids           []interface{}
+		insertArgs    []interface{}
+	)
+	for _, m := range methods {
+		if m.Stored {
+			cases = append(cases, "WHEN ? THEN "+jsonPlaceholder(tx))
+			updateArgs = append(updateArgs, m.ID, m.Config)
+			ids = append(ids, m.ID)
+			continue
+		}
+
+		values = append(values, "(?, ?, ?, ?, ?, ?)")
+		insertArgs = append(insertArgs, m.ID, m.Method, requestID, m.Config, now, now)
+	}
+
+	if len(cases) > 0 {
+		updateArgs = append(append(updateArgs, now), ids...)
+		if err := tx.RawQuery(
+			"UPDATE "+table+" SET config = CASE id "+strings.Join(cases, " ")+" END, updated_at = ? "+
+				"WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+			updateArgs...,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+
+	if len(values) > 0 {
+		if err := tx.RawQuery(
+			"INSERT INTO "+table+" (id, method, "+requestColumn+", config, created_at, updated_at) VALUES "+strings.Join(values, ", "),
+			insertArgs...,
+		).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jsonPlaceholder returns the placeholder of a JSON value. The value has to be cast explicitly where it is not
+// assigned to the column directly, for example in a CASE expression.
+func jsonPlaceholder(c *pop.Connection) string {
+	switch c.Dialect.Name() {
+	case "postgres", "cockroach":
+		return "CAST(? AS jsonb)"
+	case "mysql":
+		return "CAST(? AS JSON)"
+	}
+	return "?"
+}
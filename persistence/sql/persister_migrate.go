@@ -0,0 +1,111 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/persistence"
+)
+
+// dialectMigrations returns the migrations of the given direction which apply to the connection's
+// dialect, ordered by version.
+func (p *Persister) dialectMigrations(c *pop.Connection, direction string) []pop.Migration {
+	var ms []pop.Migration
+	for _, m := range p.mb.Migrations[direction] {
+		if m.DBType == "all" || m.DBType == c.Dialect.Name() {
+			ms = append(ms, m)
+		}
+	}
+
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Version < ms[j].Version
+	})
+	return ms
+}
+
+func isApplied(c *pop.Connection, m pop.Migration) (bool, error) {
+	exists, err := c.Where("version = ?", m.Version).Exists(c.MigrationTableName())
+	return exists, errors.WithStack(err)
+}
+
+// rollbackMigrations returns the down migrations of the last steps applied migrations, newest first.
+func (p *Persister) rollbackMigrations(c *pop.Connection, steps int) ([]pop.Migration, error) {
+	if steps < 1 {
+		return nil, errors.Errorf("the number of migrations to roll back must be at least 1 but got %d", steps)
+	}
+
+	downs := map[string]pop.Migration{}
+	for _, m := range p.dialectMigrations(c, "down") {
+		downs[m.Version] = m
+	}
+
+	ups := p.dialectMigrations(c, "up")
+	var rollback []pop.Migration
+	for k := len(ups) - 1; k >= 0 && len(rollback) < steps; k-- {
+		applied, err := isApplied(c, ups[k])
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			continue
+		}
+
+		down, ok := downs[ups[k].Version]
+		if !ok {
+			return nil, errors.Errorf("migration %s %s can not be rolled back because it has no down migration", ups[k].Version, ups[k].Name)
+		}
+		rollback = append(rollback, down)
+	}
+
+	return rollback, nil
+}
+
+// MigrateDown rolls back the last steps migrations which were applied to the database. Each migration is
+// rolled back in its own transaction.
+func (p *Persister) MigrateDown(ctx context.Context, steps int) error {
+	defer p.compat.reset()
+
+	c := p.GetConnection(ctx)
+	rollback, err := p.rollbackMigrations(c, steps)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range rollback {
+		m := m
+		if err := c.Transaction(func(tx *pop.Connection) error {
+			if err := m.Run(tx); err != nil {
+				return err
+			}
+			return tx.RawQuery(fmt.Sprintf("DELETE FROM %s WHERE version = ?", c.MigrationTableName()), m.Version).Exec()
+		}); err != nil {
+			return errors.Wrapf(err, "unable to roll back migration %s %s", m.Version, m.Name)
+		}
+		p.r.Logger().WithField("version", m.Version).WithField("name", m.Name).Info("Rolled back SQL migration.")
+	}
+
+	return nil
+}
+
+// MigrationDownPlan returns the statements which MigrateDown would execute for the given number of steps.
+func (p *Persister) MigrationDownPlan(ctx context.Context, steps int) ([]persistence.PlannedMigration, error) {
+	c := p.GetConnection(ctx)
+	rollback, err := p.rollbackMigrations(c, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]persistence.PlannedMigration, 0, len(rollback))
+	for _, m := range rollback {
+		pm, err := p.planMigration(c, m)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, *pm)
+	}
+	return plan, nil
+}
@@ -0,0 +1,136 @@
+package sql
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/persistence"
+)
+
+const (
+	LockImpactNone        = "none: the statement creates a new object"
+	LockImpactShort       = "short: the table is locked exclusively while its metadata is changed"
+	LockImpactBlockWrites = "high: writes to the table are blocked until the statement completes"
+	LockImpactRewrite     = "high: the table is rewritten and locked until the statement completes"
+	LockImpactBreaking    = "breaking: the previous release can not run against the schema after this statement"
+	LockImpactRows        = "medium: the affected rows are locked until the statement completes"
+	LockImpactUnknown     = "unknown: review this statement before applying it"
+)
+
+var (
+	statementSeparator = regexp.MustCompile(`;\s*(\n|$)`)
+	addNotNullColumn   = regexp.MustCompile(`ADD (COLUMN )?.* NOT NULL`)
+	alterColumnType    = regexp.MustCompile(`ALTER COLUMN \S+ (SET DATA )?TYPE `)
+)
+
+// MigrationPlan returns the statements of all migrations which have not been applied yet together with
+// an estimate of their impact on a running system.
+func (p *Persister) MigrationPlan(ctx context.Context) ([]persistence.PlannedMigration, error) {
+	pending, err := p.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := p.RequiredMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := p.GetConnection(ctx)
+	plan := make([]persistence.PlannedMigration, 0, len(pending))
+	for _, m := range p.dialectMigrations(c, "up") {
+		if !contains(pending, m.Version) {
+			continue
+		}
+
+		pm, err := p.planMigration(c, m)
+		if err != nil {
+			return nil, err
+		}
+		pm.Required = contains(required, m.Version)
+		plan = append(plan, *pm)
+	}
+
+	return plan, nil
+}
+
+// planMigration renders the statements of a migration for the connection's dialect.
+func (p *Persister) planMigration(c *pop.Connection, m pop.Migration) (*persistence.PlannedMigration, error) {
+	raw, err := migrations.FindString(m.Path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	content, err := pop.MigrationContent(m, c, strings.NewReader(raw), true)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	pm := persistence.PlannedMigration{Version: m.Version, Name: m.Name, Required: true}
+	for _, stmt := range statementSeparator.Split(content, -1) {
+		if stmt = strings.TrimSpace(stmt); len(stmt) > 0 {
+			pm.Statements = append(pm.Statements, persistence.PlannedStatement{
+				SQL:         stmt + ";",
+				LockImpact:  lockImpact(c.Dialect.Name(), stmt),
+				Destructive: isDestructive(stmt),
+			})
+		}
+	}
+	return &pm, nil
+}
+
+// isDestructive returns true if the statement removes data or may lose data while converting it.
+func isDestructive(stmt string) bool {
+	s := strings.Join(strings.Fields(strings.ToUpper(stmt)), " ")
+	return strings.HasPrefix(s, "DROP TABLE") ||
+		strings.HasPrefix(s, "DELETE") ||
+		strings.HasPrefix(s, "TRUNCATE") ||
+		strings.Contains(s, " DROP COLUMN ") ||
+		strings.Contains(s, " MODIFY COLUMN ") ||
+		alterColumnType.MatchString(s)
+}
+
+// lockImpact estimates how a statement affects a running system. The estimate is a heuristic based on
+// the statement type and errs on the side of caution.
+func lockImpact(dialect, stmt string) string {
+	s := strings.Join(strings.Fields(strings.ToUpper(stmt)), " ")
+
+	switch {
+	case strings.HasPrefix(s, "CREATE TABLE"):
+		return LockImpactNone
+	case strings.HasPrefix(s, "CREATE INDEX"), strings.HasPrefix(s, "CREATE UNIQUE INDEX"):
+		if strings.Contains(s, " CONCURRENTLY ") {
+			return LockImpactShort
+		}
+		return LockImpactBlockWrites
+	case strings.HasPrefix(s, "DROP"),
+		strings.Contains(s, " DROP COLUMN "),
+		strings.Contains(s, " RENAME "):
+		return LockImpactBreaking
+	case strings.HasPrefix(s, "ALTER TABLE"):
+		if strings.Contains(s, " ADD ") && !addNotNullColumn.MatchString(s) {
+			if dialect == "mysql" {
+				// Older MySQL versions copy the table for most ALTER TABLE statements.
+				return LockImpactRewrite
+			}
+			return LockImpactShort
+		}
+		return LockImpactRewrite
+	case strings.HasPrefix(s, "INSERT"), strings.HasPrefix(s, "UPDATE"), strings.HasPrefix(s, "DELETE"):
+		return LockImpactRows
+	}
+	return LockImpactUnknown
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockImpact(t *testing.T) {
+	for k, tc := range []struct {
+		dialect string
+		stmt    string
+		expect  string
+	}{
+		{dialect: "postgres", stmt: `CREATE TABLE "courier_messages" ("id" UUID NOT NULL)`, expect: LockImpactNone},
+		{dialect: "postgres", stmt: `CREATE INDEX "identities_traits_idx" ON "identities" (traits)`, expect: LockImpactBlockWrites},
+		{dialect: "postgres", stmt: `CREATE INDEX CONCURRENTLY "identities_traits_idx" ON "identities" (traits)`, expect: LockImpactShort},
+		{dialect: "postgres", stmt: `ALTER TABLE "selfservice_login_requests" ADD COLUMN "forced" bool`, expect: LockImpactShort},
+		{dialect: "postgres", stmt: `ALTER TABLE "selfservice_login_requests" ADD COLUMN "forced" bool NOT NULL`, expect: LockImpactRewrite},
+		{dialect: "mysql", stmt: "ALTER TABLE `selfservice_login_requests` ADD COLUMN `forced` BOOL", expect: LockImpactRewrite},
+		{dialect: "postgres", stmt: `ALTER TABLE "courier_messages" ALTER COLUMN "body" TYPE TEXT`, expect: LockImpactRewrite},
+		{dialect: "postgres", stmt: `ALTER TABLE "identities" DROP COLUMN "traits"`, expect: LockImpactBreaking},
+		{dialect: "postgres", stmt: `ALTER TABLE "identities" RENAME COLUMN "traits" TO "attributes"`, expect: LockImpactBreaking},
+		{dialect: "postgres", stmt: `DROP TABLE "identities"`, expect: LockImpactBreaking},
+		{dialect: "postgres", stmt: `UPDATE "identities" SET traits_schema_id = 'default'`, expect: LockImpactRows},
+		{dialect: "postgres", stmt: `VACUUM`, expect: LockImpactUnknown},
+	} {
+		assert.Equal(t, tc.expect, lockImpact(tc.dialect, tc.stmt), "%d: %s", k, tc.stmt)
+	}
+}
+
+func TestIsDestructive(t *testing.T) {
+	for k, tc := range []struct {
+		stmt   string
+		expect bool
+	}{
+		{stmt: `DROP TABLE "sessions"`, expect: true},
+		{stmt: `ALTER TABLE "selfservice_login_requests" DROP COLUMN "forced"`, expect: true},
+		{stmt: `ALTER TABLE "courier_messages" ALTER COLUMN "body" TYPE VARCHAR (255)`, expect: true},
+		{stmt: "ALTER TABLE identity_verifiable_addresses MODIFY COLUMN code VARCHAR(32)", expect: true},
+		{stmt: `DELETE FROM "selfservice_errors"`, expect: true},
+		{stmt: `ALTER TABLE "selfservice_errors" ALTER COLUMN "seen_at" SET NOT NULL`, expect: false},
+		{stmt: `UPDATE selfservice_errors SET seen_at = '1980-01-01 00:00:00' WHERE seen_at IS NULL`, expect: false},
+		{stmt: `CREATE TABLE "sessions" ("id" UUID NOT NULL)`, expect: false},
+	} {
+		assert.Equal(t, tc.expect, isDestructive(tc.stmt), "%d: %s", k, tc.stmt)
+	}
+}
@@ -2,8 +2,10 @@ package sql
 
 import (
 	"context"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/ory/x/sqlcon"
 
@@ -12,19 +14,40 @@ import (
 
 var _ profile.RequestPersister = new(Persister)
 
+const profileRequestsTable = "selfservice_profile_management_requests"
+
 func (p *Persister) CreateProfileRequest(ctx context.Context, r *profile.Request) error {
 	r.IdentityID = r.Identity.ID
-	return sqlcon.HandleError(p.GetConnection(ctx).Create(r)) // This must not be eager or identities will be created / updated
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(r, p.missingColumns(ctx, profileRequestsTable)...)) // This must not be eager or identities will be created / updated
 }
 
 func (p *Persister) GetProfileRequest(ctx context.Context, id uuid.UUID) (*profile.Request, error) {
 	var r profile.Request
-	if err := p.GetConnection(ctx).Eager().Find(&r, id); err != nil {
+
+	q := p.GetConnection(ctx).Eager().Q()
+	if missing := p.missingColumns(ctx, profileRequestsTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&r, missing)...)
+	}
+
+	if err := q.Find(&r, id); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
 	return &r, nil
 }
 
 func (p *Persister) UpdateProfileRequest(ctx context.Context, r *profile.Request) error {
-	return sqlcon.HandleError(p.GetConnection(ctx).Update(r)) // This must not be eager or identities will be created / updated
+	return sqlcon.HandleError(p.GetConnection(ctx).Update(r, p.missingColumns(ctx, profileRequestsTable)...)) // This must not be eager or identities will be created / updated
+}
+
+func (p *Persister) UpdateProfileRequestForm(ctx context.Context, r *profile.Request) error {
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+profileRequestsTable+" SET form = ?, update_successful = ?, updated_at = ? WHERE id = ?",
+		r.Form, r.UpdateSuccessful, time.Now().UTC(), r.ID,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	} else if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
 }
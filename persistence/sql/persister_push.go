@@ -0,0 +1,71 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/selfservice/strategy/push"
+)
+
+var _ push.Persister = new(Persister)
+
+const pushChallengesTable = "selfservice_login_push_challenges"
+
+func (p *Persister) CreatePushChallenge(ctx context.Context, c *push.Challenge) error {
+	if err := p.requireTable(ctx, pushChallengesTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(c))
+}
+
+func (p *Persister) GetPushChallenge(ctx context.Context, id uuid.UUID) (*push.Challenge, error) {
+	if err := p.requireTable(ctx, pushChallengesTable); err != nil {
+		return nil, err
+	}
+
+	var c push.Challenge
+	if err := p.GetConnection(ctx).Find(&c, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &c, nil
+}
+
+func (p *Persister) GetLatestPushChallenge(ctx context.Context, loginRequestID uuid.UUID) (*push.Challenge, error) {
+	if err := p.requireTable(ctx, pushChallengesTable); err != nil {
+		return nil, err
+	}
+
+	var c push.Challenge
+	if err := p.GetConnection(ctx).
+		Where("selfservice_login_request_id = ?", loginRequestID).
+		Order("created_at DESC").
+		First(&c); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &c, nil
+}
+
+func (p *Persister) UpdatePushChallengeState(ctx context.Context, id uuid.UUID, from, to push.State) error {
+	if err := p.requireTable(ctx, pushChallengesTable); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+pushChallengesTable+" SET state = ?, updated_at = ? WHERE id = ? AND state = ? AND expires_at > ?",
+		to, now, id, from, now,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/selfservice/flow/recovery"
+)
+
+var _ recovery.Persister = new(Persister)
+
+const (
+	recoveryRequestsTable = "selfservice_recovery_requests"
+	recoveryCodesTable    = "selfservice_recovery_codes"
+	recoveryTicketsTable  = "selfservice_recovery_tickets"
+)
+
+func (p *Persister) CreateRecoveryRequest(ctx context.Context, r *recovery.Request) error {
+	if err := p.requireTable(ctx, recoveryRequestsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(r))
+}
+
+func (p *Persister) GetRecoveryRequest(ctx context.Context, id uuid.UUID) (*recovery.Request, error) {
+	if err := p.requireTable(ctx, recoveryRequestsTable); err != nil {
+		return nil, err
+	}
+
+	var r recovery.Request
+	if err := p.GetConnection(ctx).Find(&r, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &r, nil
+}
+
+func (p *Persister) UpdateRecoveryRequest(ctx context.Context, r *recovery.Request) error {
+	if err := p.requireTable(ctx, recoveryRequestsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Update(r))
+}
+
+func (p *Persister) UpdateRecoveryRequestState(ctx context.Context, id uuid.UUID, from, to recovery.State) error {
+	if err := p.requireTable(ctx, recoveryRequestsTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+recoveryRequestsTable+" SET state = ?, updated_at = ? WHERE id = ? AND state = ?",
+		to, time.Now().UTC(), id, from,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) CreateRecoveryCode(ctx context.Context, c *recovery.Code) error {
+	if err := p.requireTable(ctx, recoveryCodesTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(c))
+}
+
+func (p *Persister) GetLatestRecoveryCode(ctx context.Context, recoveryRequestID uuid.UUID) (*recovery.Code, error) {
+	if err := p.requireTable(ctx, recoveryCodesTable); err != nil {
+		return nil, err
+	}
+
+	var c recovery.Code
+	if err := p.GetConnection(ctx).
+		Where("selfservice_recovery_request_id = ?", recoveryRequestID).
+		Order("created_at DESC").
+		First(&c); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &c, nil
+}
+
+func (p *Persister) UseRecoveryCodeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) error {
+	if err := p.requireTable(ctx, recoveryCodesTable); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+recoveryCodesTable+" SET attempts = attempts + 1, updated_at = ? WHERE id = ? AND used = ? AND attempts < ? AND expires_at > ?",
+		now, id, false, maxAttempts, now,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) MarkRecoveryCodeUsed(ctx context.Context, id uuid.UUID) error {
+	if err := p.requireTable(ctx, recoveryCodesTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+recoveryCodesTable+" SET used = ?, updated_at = ? WHERE id = ? AND used = ?",
+		true, time.Now().UTC(), id, false,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) CreateRecoveryTicket(ctx context.Context, t *recovery.Ticket) error {
+	if err := p.requireTable(ctx, recoveryTicketsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(t))
+}
+
+func (p *Persister) GetRecoveryTicket(ctx context.Context, id uuid.UUID) (*recovery.Ticket, error) {
+	if err := p.requireTable(ctx, recoveryTicketsTable); err != nil {
+		return nil, err
+	}
+
+	var t recovery.Ticket
+	if err := p.GetConnection(ctx).Find(&t, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &t, nil
+}
+
+func (p *Persister) ListRecoveryTickets(ctx context.Context, state recovery.TicketState, limit, offset int) ([]recovery.Ticket, error) {
+	if err := p.requireTable(ctx, recoveryTicketsTable); err != nil {
+		return nil, err
+	}
+
+	query, args := "SELECT * FROM "+recoveryTicketsTable, []interface{}{}
+	if len(state) > 0 {
+		query, args = query+" WHERE state = ?", append(args, state)
+	}
+
+	ts := make([]recovery.Ticket, 0)
+	if err := p.GetConnection(ctx).
+		RawQuery(query+" ORDER BY created_at ASC LIMIT ? OFFSET ?", append(args, limit, offset)...).
+		All(&ts); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return ts, nil
+}
+
+func (p *Persister) ReviewRecoveryTicket(ctx context.Context, id uuid.UUID, state recovery.TicketState, identityID uuid.NullUUID) error {
+	if err := p.requireTable(ctx, recoveryTicketsTable); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+recoveryTicketsTable+" SET state = ?, identity_id = ?, reviewed_at = ?, updated_at = ? WHERE id = ? AND state = ?",
+		state, identityID, now, now, id, recovery.TicketStatePending,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/identity"
+)
+
+const redemptionsTable = "identity_redemptions"
+
+func (p *Persister) FindRedemption(ctx context.Context, kind identity.RedemptionKind, code string) (*identity.Redemption, error) {
+	if p.missingTable(ctx, redemptionsTable) {
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	var r identity.Redemption
+	if err := p.GetConnection(ctx).Where("kind = ? AND code_hash = ?", kind, identity.RedemptionCodeHash(kind, code)).First(&r); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &r, nil
+}
+
+func (p *Persister) CreateRedemption(ctx context.Context, r *identity.Redemption) error {
+	if err := p.requireTable(ctx, redemptionsTable); err != nil {
+		return err
+	}
+
+	if err := sqlcon.HandleError(p.GetConnection(ctx).Create(r)); errorsx.Cause(err) == sqlcon.ErrUniqueViolation {
+		return errors.WithStack(&identity.ErrAlreadyRedeemed)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// createRedemption records the redemption in the transaction which redeemed the code. Until the migration adding
+// the table was applied, redemptions are not recorded and replays are reported as invalid codes.
+func (p *Persister) createRedemption(ctx context.Context, tx *pop.Connection, r *identity.Redemption) error {
+	if p.missingTable(ctx, redemptionsTable) {
+		return nil
+	}
+	return sqlcon.HandleError(tx.Create(r))
+}
+
+// unredeemable returns identity.ErrAlreadyRedeemed if the code which could not be redeemed was redeemed before, and
+// sqlcon.ErrNoRows otherwise.
+func (p *Persister) unredeemable(ctx context.Context, kind identity.RedemptionKind, code string) error {
+	if _, err := p.FindRedemption(ctx, kind, code); err == nil {
+		return errors.WithStack(&identity.ErrAlreadyRedeemed)
+	} else if errorsx.Cause(err) != sqlcon.ErrNoRows {
+		return err
+	}
+	return errors.WithStack(sqlcon.ErrNoRows)
+}
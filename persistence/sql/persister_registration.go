@@ -2,26 +2,57 @@ package sql
 
 import (
 	"context"
+	"time"
 
+	"github.com/gobuffalo/pop/v5"
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/ory/x/sqlcon"
 
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	registrationRequestsTable       = "selfservice_registration_requests"
+	registrationRequestMethodsTable = "selfservice_registration_request_methods"
 )
 
 func (p *Persister) CreateRegistrationRequest(ctx context.Context, r *registration.Request) error {
-	return p.GetConnection(ctx).Eager().Create(r)
+	if err := p.injectFault(ctx); err != nil {
+		return err
+	}
+
+	return p.GetConnection(ctx).Eager().Create(r, p.missingColumns(ctx, registrationRequestsTable)...)
 }
 
 func (p *Persister) GetRegistrationRequest(ctx context.Context, id uuid.UUID) (*registration.Request, error) {
+	defer p.observe(ctx, "GetRegistrationRequest", time.Now())
+
+	if err := p.injectFault(ctx); err != nil {
+		return nil, err
+	}
+
+	conn := p.GetConnection(ctx)
 	var r registration.Request
-	if err := p.GetConnection(ctx).Eager().Find(&r, id); err != nil {
+
+	q := conn.Q()
+	if missing := p.missingColumns(ctx, registrationRequestsTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&r, missing)...)
+	}
+
+	if err := q.Find(&r, id); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
 
-	if err := (&r).AfterFind(p.GetConnection(ctx)); err != nil {
+	// The methods are not loaded eagerly because pop would load the request of every method again.
+	if err := conn.Where("selfservice_registration_request_id = ?", id).All(&r.MethodsRaw); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	if err := (&r).AfterFind(conn); err != nil {
 		return nil, err
 	}
 
@@ -29,18 +60,53 @@ func (p *Persister) GetRegistrationRequest(ctx context.Context, id uuid.UUID) (*
 }
 
 func (p *Persister) UpdateRegistrationRequest(ctx context.Context, id uuid.UUID, ct identity.CredentialsType, rm *registration.RequestMethod) error {
-	rr, err := p.GetRegistrationRequest(ctx, id)
-	if err != nil {
+	return p.UpdateRegistrationRequestMethods(ctx, id, registration.RequestMethods{ct: rm})
+}
+
+func (p *Persister) UpdateRegistrationRequestMethods(ctx context.Context, id uuid.UUID, methods registration.RequestMethods) error {
+	if err := p.injectFault(ctx); err != nil {
 		return err
 	}
 
-	method, ok := rr.Methods[ct]
-	if !ok {
-		rm.RequestID = rr.ID
-		rm.Method = ct
-		return p.GetConnection(ctx).Save(rm)
+	if len(methods) == 0 {
+		return nil
 	}
 
-	method.Config = rm.Config
-	return p.GetConnection(ctx).Save(method)
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		// Only the IDs of the stored methods are loaded instead of the whole request.
+		var stored registration.RequestMethodsRaw
+		if err := tx.Select("id", "method").Where("selfservice_registration_request_id = ?", id).All(&stored); err != nil {
+			return err
+		}
+
+		if len(stored) == 0 {
+			count, err := tx.Where("id = ?", id).Count(new(registration.Request))
+			if err != nil {
+				return err
+			} else if count == 0 {
+				return errors.WithStack(sqlcon.ErrNoRows)
+			}
+		}
+
+		ids := make(map[identity.CredentialsType]uuid.UUID, len(stored))
+		for _, m := range stored {
+			ids[m.Method] = m.ID
+		}
+
+		rows := make([]flowMethod, 0, len(methods))
+		for ct, m := range methods {
+			m.RequestID = id
+			m.Method = ct
+
+			mid, ok := ids[ct]
+			if !ok {
+				mid = x.NewUUID()
+			}
+			m.ID = mid
+
+			rows = append(rows, flowMethod{ID: mid, Method: ct, Config: m.Config, Stored: ok})
+		}
+
+		return writeFlowMethods(tx, registrationRequestMethodsTable, "selfservice_registration_request_id", id, rows)
+	}))
 }
@@ -0,0 +1,105 @@
+package sql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/relationship"
+	"github.com/ory/kratos/x"
+)
+
+var _ relationship.Persister = new(Persister)
+
+const relationshipsTable = "identity_relationships"
+
+func (p *Persister) CreateRelationship(ctx context.Context, r *relationship.Relationship) error {
+	if err := p.requireTable(ctx, relationshipsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(r))
+}
+
+func (p *Persister) GetRelationship(ctx context.Context, id uuid.UUID) (*relationship.Relationship, error) {
+	if err := p.requireTable(ctx, relationshipsTable); err != nil {
+		return nil, err
+	}
+
+	var r relationship.Relationship
+	if err := p.GetConnection(ctx).Find(&r, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &r, nil
+}
+
+func (p *Persister) ListRelationships(ctx context.Context, f relationship.Filter, limit, offset int) ([]relationship.Relationship, error) {
+	if err := p.requireTable(ctx, relationshipsTable); err != nil {
+		return nil, err
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if len(f.Type) > 0 {
+		conditions = append(conditions, "type = ?")
+		args = append(args, f.Type)
+	}
+	if !x.IsZeroUUID(f.IdentityID) {
+		conditions = append(conditions, "identity_id = ?")
+		args = append(args, f.IdentityID)
+	}
+	if !x.IsZeroUUID(f.RelatedID) {
+		conditions = append(conditions, "related_id = ?")
+		args = append(args, f.RelatedID)
+	}
+
+	query := "SELECT * FROM " + relationshipsTable
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rs := make([]relationship.Relationship, 0)
+	if err := p.GetConnection(ctx).
+		RawQuery(query+" ORDER BY created_at ASC, id ASC LIMIT ? OFFSET ?", append(args, limit, offset)...).
+		All(&rs); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return rs, nil
+}
+
+func (p *Persister) ListRelationshipsOf(ctx context.Context, identityID uuid.UUID) ([]relationship.Relationship, error) {
+	rs := make([]relationship.Relationship, 0)
+	if p.missingTable(ctx, relationshipsTable) {
+		// Without the migration no relationships can have been created.
+		return rs, nil
+	}
+
+	if err := p.GetConnection(ctx).
+		Where("identity_id = ? OR related_id = ?", identityID, identityID).
+		Order("created_at ASC, id ASC").
+		All(&rs); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return rs, nil
+}
+
+func (p *Persister) DeleteRelationship(ctx context.Context, id uuid.UUID) error {
+	if err := p.requireTable(ctx, relationshipsTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery("DELETE FROM "+relationshipsTable+" WHERE id = ?", id).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/retention"
+)
+
+var _ retention.Persister = new(Persister)
+
+const retentionNoticesTable = "identity_retention_notices"
+
+func (p *Persister) ListRetentionCandidates(ctx context.Context, policy retention.Policy, cutoff time.Time, limit int) ([]retention.Candidate, error) {
+	if err := p.requireTable(ctx, retentionNoticesTable); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT i.id, n.notified_at FROM identities i LEFT JOIN " + retentionNoticesTable + " n ON n.identity_id = i.id WHERE i.created_at < ?"
+	args := []interface{}{cutoff}
+
+	switch policy {
+	case retention.PolicyUnverified:
+		query += " AND EXISTS (SELECT 1 FROM identity_verifiable_addresses a WHERE a.identity_id = i.id)" +
+			" AND NOT EXISTS (SELECT 1 FROM identity_verifiable_addresses a WHERE a.identity_id = i.id AND a.verified = ?)"
+		args = append(args, true)
+	case retention.PolicyInactive:
+		query += " AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.identity_id = i.id AND s.authenticated_at >= ?)"
+		args = append(args, cutoff)
+		if !p.missingTable(ctx, loginEventsTable) {
+			query += " AND NOT EXISTS (SELECT 1 FROM " + loginEventsTable + " e WHERE e.identity_id = i.id AND e.success = ? AND e.created_at >= ?)"
+			args = append(args, true, cutoff)
+		}
+	default:
+		return nil, errors.Errorf("unknown retention policy: %s", policy)
+	}
+
+	query += " ORDER BY i.created_at ASC LIMIT ?"
+	args = append(args, limit)
+
+	var cs []retention.Candidate
+	if err := p.GetConnection(ctx).RawQuery(query, args...).All(&cs); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return cs, nil
+}
+
+func (p *Persister) MarkRetentionNotified(ctx context.Context, identityID uuid.UUID, at time.Time) error {
+	if err := p.requireTable(ctx, retentionNoticesTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		if err := tx.RawQuery("DELETE FROM "+retentionNoticesTable+" WHERE identity_id = ?", identityID).Exec(); err != nil {
+			return err
+		}
+		return tx.RawQuery("INSERT INTO "+retentionNoticesTable+" (identity_id, notified_at) VALUES (?, ?)", identityID, at).Exec()
+	}))
+}
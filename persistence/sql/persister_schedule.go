@@ -0,0 +1,173 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/schedule"
+)
+
+var _ schedule.Persister = new(Persister)
+
+const (
+	scheduledActionsTable = "identity_scheduled_actions"
+	deactivationsTable    = "identity_deactivations"
+)
+
+func (p *Persister) CreateScheduledAction(ctx context.Context, a *schedule.Action) error {
+	if err := p.requireTable(ctx, scheduledActionsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(a))
+}
+
+func (p *Persister) GetScheduledAction(ctx context.Context, id uuid.UUID) (*schedule.Action, error) {
+	if err := p.requireTable(ctx, scheduledActionsTable); err != nil {
+		return nil, err
+	}
+
+	var a schedule.Action
+	if err := p.GetConnection(ctx).Find(&a, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &a, nil
+}
+
+func (p *Persister) ListScheduledActions(ctx context.Context, identityID uuid.UUID) ([]schedule.Action, error) {
+	as := make([]schedule.Action, 0)
+	// Without the migration no actions could have been scheduled.
+	if p.missingTable(ctx, scheduledActionsTable) {
+		return as, nil
+	}
+
+	if err := p.GetConnection(ctx).
+		Where("identity_id = ?", identityID).
+		Order("execute_at ASC, id ASC").
+		All(&as); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return as, nil
+}
+
+func (p *Persister) DeleteScheduledAction(ctx context.Context, identityID, id uuid.UUID) error {
+	if err := p.requireTable(ctx, scheduledActionsTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery(
+		"DELETE FROM "+scheduledActionsTable+" WHERE id = ? AND identity_id = ? AND state = ?",
+		id, identityID, schedule.StatePending,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) ClaimScheduledActions(ctx context.Context, now, staleBefore time.Time, limit int) ([]schedule.Action, error) {
+	claimed := make([]schedule.Action, 0)
+	if p.missingTable(ctx, scheduledActionsTable) {
+		return claimed, nil
+	}
+
+	var candidates []schedule.Action
+	if err := p.GetConnection(ctx).RawQuery(
+		"SELECT * FROM "+scheduledActionsTable+" WHERE (state = ? AND execute_at <= ?) OR (state = ? AND updated_at <= ?) ORDER BY execute_at ASC, id ASC LIMIT ?",
+		schedule.StatePending, now, schedule.StateRunning, staleBefore, limit,
+	).All(&candidates); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	for _, a := range candidates {
+		// The number of attempts changes with every claim, so only one of several concurrent workers claims the action.
+		claimedAt := time.Now().UTC()
+		count, err := p.GetConnection(ctx).RawQuery(
+			"UPDATE "+scheduledActionsTable+" SET state = ?, attempts = ?, updated_at = ? WHERE id = ? AND state = ? AND attempts = ?",
+			schedule.StateRunning, a.Attempts+1, claimedAt, a.ID, a.State, a.Attempts,
+		).ExecWithCount()
+		if err != nil {
+			return nil, sqlcon.HandleError(err)
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		a.State = schedule.StateRunning
+		a.Attempts++
+		a.UpdatedAt = claimedAt
+		claimed = append(claimed, a)
+	}
+	return claimed, nil
+}
+
+func (p *Persister) UpdateScheduledAction(ctx context.Context, a *schedule.Action) error {
+	if err := p.requireTable(ctx, scheduledActionsTable); err != nil {
+		return err
+	}
+
+	a.UpdatedAt = time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+scheduledActionsTable+" SET state = ?, last_error = ?, execute_at = ?, executed_at = ?, updated_at = ? WHERE id = ?",
+		a.State, a.LastError, a.ExecuteAt, a.ExecutedAt, a.UpdatedAt, a.ID,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) DeactivateIdentity(ctx context.Context, d *schedule.Deactivation) error {
+	if err := p.requireTable(ctx, deactivationsTable); err != nil {
+		return err
+	}
+
+	if err := sqlcon.HandleError(p.GetConnection(ctx).RawQuery(
+		"INSERT INTO "+deactivationsTable+" (identity_id, action_id, created_at) VALUES (?, ?, ?)",
+		d.IdentityID, d.ActionID, d.CreatedAt,
+	).Exec()); err != nil {
+		// The identity is deactivated already.
+		if errorsx.Cause(err) == sqlcon.ErrUniqueViolation {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *Persister) ActivateIdentity(ctx context.Context, identityID uuid.UUID) error {
+	if err := p.requireTable(ctx, deactivationsTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.GetConnection(ctx).
+		RawQuery("DELETE FROM "+deactivationsTable+" WHERE identity_id = ?", identityID).
+		Exec())
+}
+
+func (p *Persister) IsIdentityDeactivated(ctx context.Context, identityID uuid.UUID) (bool, error) {
+	// Without the migration no identity could have been deactivated.
+	if p.missingTable(ctx, deactivationsTable) {
+		return false, nil
+	}
+
+	count, err := p.GetConnection(ctx).Where("identity_id = ?", identityID).Count(new(schedule.Deactivation))
+	if err != nil {
+		return false, sqlcon.HandleError(err)
+	}
+	return count > 0, nil
+}
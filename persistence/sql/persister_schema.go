@@ -0,0 +1,131 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/schema"
+)
+
+var _ schema.Persister = new(Persister)
+
+const (
+	identitySchemasTable        = "identity_schemas"
+	identitySchemaVersionsTable = "identity_schema_versions"
+)
+
+func (p *Persister) CreateSchemaVersion(ctx context.Context, v *schema.StoredSchemaVersion) error {
+	if err := p.requireTable(ctx, identitySchemaVersionsTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		var latest struct {
+			Version int `db:"version"`
+		}
+		if err := tx.RawQuery("SELECT COALESCE(MAX(version), 0) AS version FROM "+identitySchemaVersionsTable+" WHERE schema_id = ?", v.SchemaID).First(&latest); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		if latest.Version == 0 {
+			if err := tx.RawQuery(
+				"INSERT INTO "+identitySchemasTable+" (id, is_default, created_at, updated_at) VALUES (?, ?, ?, ?)",
+				v.SchemaID, false, now, now,
+			).Exec(); err != nil {
+				return err
+			}
+		} else if err := tx.RawQuery("UPDATE "+identitySchemasTable+" SET updated_at = ? WHERE id = ?", now, v.SchemaID).Exec(); err != nil {
+			return err
+		}
+
+		// Concurrent uploads of the same schema violate the unique index on the version instead of overwriting
+		// each other.
+		v.Version = latest.Version + 1
+		return tx.Create(v)
+	}))
+}
+
+func (p *Persister) GetSchemaVersion(ctx context.Context, schemaID string, version int) (*schema.StoredSchemaVersion, error) {
+	if p.missingTable(ctx, identitySchemaVersionsTable) {
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	var v schema.StoredSchemaVersion
+	if err := p.GetConnection(ctx).Where("schema_id = ? AND version = ?", schemaID, version).First(&v); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &v, nil
+}
+
+func (p *Persister) ListSchemaVersions(ctx context.Context, schemaID string) ([]schema.StoredSchemaVersion, error) {
+	vs := make([]schema.StoredSchemaVersion, 0)
+	if p.missingTable(ctx, identitySchemaVersionsTable) {
+		return vs, nil
+	}
+
+	if err := p.GetConnection(ctx).Where("schema_id = ?", schemaID).Order("version ASC").All(&vs); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return vs, nil
+}
+
+func (p *Persister) ListStoredSchemas(ctx context.Context) ([]schema.StoredSchema, error) {
+	ss := make([]schema.StoredSchema, 0)
+	if p.missingTable(ctx, identitySchemasTable) {
+		// Without the migration no schemas can have been stored.
+		return ss, nil
+	}
+
+	conn := p.GetConnection(ctx)
+	if err := conn.Order("id ASC").All(&ss); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	var latest []struct {
+		SchemaID string `db:"schema_id"`
+		Version  int    `db:"version"`
+	}
+	if err := conn.RawQuery("SELECT schema_id, MAX(version) AS version FROM " + identitySchemaVersionsTable + " GROUP BY schema_id").All(&latest); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	versions := make(map[string]int, len(latest))
+	for _, l := range latest {
+		versions[l.SchemaID] = l.Version
+	}
+	for k := range ss {
+		ss[k].LatestVersion = versions[ss[k].ID]
+	}
+	return ss, nil
+}
+
+func (p *Persister) SetDefaultStoredSchema(ctx context.Context, schemaID string) error {
+	if err := p.requireTable(ctx, identitySchemasTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		now := time.Now().UTC()
+		if err := tx.RawQuery("UPDATE "+identitySchemasTable+" SET is_default = ?, updated_at = ? WHERE is_default = ?", false, now, true).Exec(); err != nil {
+			return err
+		}
+
+		if len(schemaID) == 0 {
+			return nil
+		}
+
+		count, err := tx.RawQuery("UPDATE "+identitySchemasTable+" SET is_default = ?, updated_at = ? WHERE id = ?", true, now, schemaID).ExecWithCount()
+		if err != nil {
+			return err
+		} else if count == 0 {
+			return errors.WithStack(sqlcon.ErrNoRows)
+		}
+		return nil
+	}))
+}
@@ -2,21 +2,47 @@ package sql
 
 import (
 	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
 
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/ory/x/sqlcon"
 
+	"github.com/ory/kratos/relationship"
 	"github.com/ory/kratos/session"
 )
 
 var _ session.Persister = new(Persister)
 
+const (
+	sessionsTable           = "sessions"
+	sessionDelegationsTable = "session_delegations"
+)
+
 func (p *Persister) GetSession(ctx context.Context, sid uuid.UUID) (*session.Session, error) {
+	defer p.observe(ctx, "GetSession", time.Now())
+
+	if err := p.injectFault(ctx); err != nil {
+		return nil, err
+	}
+
 	var s session.Session
-	if err := p.GetConnection(ctx).Find(&s, sid); err != nil {
+	q := p.GetConnection(ctx).Q()
+	if missing := p.missingColumns(ctx, sessionsTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&s, missing)...)
+	}
+	if err := q.Find(&s, sid); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
+
+	if err := p.loadSessionDelegation(ctx, &s); err != nil {
+		return nil, err
+	}
+
 	i, err := p.GetIdentity(ctx, s.IdentityID)
 	if err != nil {
 		return nil, err
@@ -25,16 +51,223 @@ func (p *Persister) GetSession(ctx context.Context, sid uuid.UUID) (*session.Ses
 	return &s, nil
 }
 
+// loadSessionDelegation sets the delegation of the session. Delegated sessions whose relationship was deleted are
+// no longer valid, for them sqlcon.ErrNoRows is returned.
+func (p *Persister) loadSessionDelegation(ctx context.Context, s *session.Session) error {
+	if p.missingTable(ctx, sessionDelegationsTable) {
+		return nil
+	}
+
+	// The relationship is joined, so that the delegation and the relationship are checked with a single query.
+	var d struct {
+		session.Delegation
+		Relationship uuid.NullUUID `db:"relationship"`
+	}
+	if err := p.GetConnection(ctx).
+		RawQuery(
+			"SELECT sd.session_id, sd.identity_id, sd.relationship_id, ir.id AS relationship FROM "+sessionDelegationsTable+" sd "+
+				"LEFT JOIN "+new(relationship.Relationship).TableName()+" ir ON ir.id = sd.relationship_id WHERE sd.session_id = ?",
+			s.ID,
+		).
+		First(&d); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil
+		}
+		return sqlcon.HandleError(err)
+	}
+
+	if !d.Relationship.Valid {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	s.Delegation = &d.Delegation
+	return nil
+}
+
 func (p *Persister) CreateSession(ctx context.Context, s *session.Session) error {
-	return p.GetConnection(ctx).Create(s) // This must not be eager or identities will be created / updated
+	if err := p.injectFault(ctx); err != nil {
+		return err
+	}
+
+	missing := p.missingColumns(ctx, sessionsTable)
+	if s.Delegation == nil {
+		return p.GetConnection(ctx).Create(s, missing...) // This must not be eager or identities will be created / updated
+	}
+
+	if err := p.requireTable(ctx, sessionDelegationsTable); err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		if err := tx.Create(s, missing...); err != nil {
+			return err
+		}
+
+		s.Delegation.SessionID = s.ID
+		return tx.RawQuery(
+			"INSERT INTO "+sessionDelegationsTable+" (session_id, identity_id, relationship_id) VALUES (?, ?, ?)",
+			s.Delegation.SessionID, s.Delegation.IdentityID, s.Delegation.RelationshipID,
+		).Exec()
+	}))
 }
 
 func (p *Persister) DeleteSession(ctx context.Context, sid uuid.UUID) error {
 	return p.GetConnection(ctx).Destroy(&session.Session{ID: sid}) // This must not be eager or identities will be created / updated
 }
 
+func (p *Persister) ListSessionsFor(ctx context.Context, identityID uuid.UUID) ([]session.Session, error) {
+	var s []session.Session
+	q := p.GetConnection(ctx).Where("identity_id = ?", identityID)
+	if missing := p.missingColumns(ctx, sessionsTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&session.Session{}, missing)...)
+	}
+	if err := q.All(&s); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return s, nil
+}
+
+// sessionsOfCondition returns the condition which matches the sessions of the identity, including the sessions in
+// which it signed in as a related identity.
+func (p *Persister) sessionsOfCondition(ctx context.Context, identityID uuid.UUID) (string, []interface{}) {
+	if p.missingTable(ctx, sessionDelegationsTable) {
+		return "identity_id = ?", []interface{}{identityID}
+	}
+	return "(identity_id = ? OR id IN (SELECT session_id FROM " + sessionDelegationsTable + " WHERE identity_id = ?))",
+		[]interface{}{identityID, identityID}
+}
+
 func (p *Persister) DeleteSessionsFor(ctx context.Context, sid uuid.UUID) error {
-	if err := p.GetConnection(ctx).RawQuery("DELETE FROM sessions WHERE identity_id =?", sid).Exec(); err != nil {
+	cond, args := p.sessionsOfCondition(ctx, sid)
+	if err := p.GetConnection(ctx).RawQuery("DELETE FROM sessions WHERE "+cond, args...).Exec(); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	return nil
+}
+
+func (p *Persister) DeleteSessionsForExcept(ctx context.Context, identityID, except uuid.UUID) error {
+	cond, args := p.sessionsOfCondition(ctx, identityID)
+	if err := p.GetConnection(ctx).RawQuery("DELETE FROM sessions WHERE "+cond+" AND id != ?", append(args, except)...).Exec(); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	return nil
+}
+
+const loginEventsTable = "identity_login_events"
+
+func (p *Persister) CreateLoginEvent(ctx context.Context, e *session.LoginEvent, max int) error {
+	if p.missingTable(ctx, loginEventsTable) {
+		// The login history is recorded once the migration was applied.
+		return nil
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(tx *pop.Connection) error {
+		if err := tx.Create(e); err != nil {
+			return err
+		}
+
+		// Find the newest event which is too old to be kept and remove it together with all older ones.
+		var cutoff []session.LoginEvent
+		if err := tx.Where("identity_id = ?", e.IdentityID).Order("created_at DESC").Paginate(max+1, 1).All(&cutoff); err != nil {
+			return err
+		}
+		if len(cutoff) == 0 {
+			return nil
+		}
+
+		return tx.RawQuery("DELETE FROM "+loginEventsTable+" WHERE identity_id = ? AND created_at <= ? AND id != ?", e.IdentityID, cutoff[0].CreatedAt, e.ID).Exec()
+	}))
+}
+
+func (p *Persister) ListLoginEvents(ctx context.Context, identityID uuid.UUID) ([]session.LoginEvent, error) {
+	if err := p.requireTable(ctx, loginEventsTable); err != nil {
+		return nil, err
+	}
+
+	var es []session.LoginEvent
+	if err := p.GetConnection(ctx).Where("identity_id = ?", identityID).Order("created_at DESC").All(&es); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return es, nil
+}
+
+func (p *Persister) DeleteLoginEventsBefore(ctx context.Context, before time.Time) error {
+	if p.missingTable(ctx, loginEventsTable) {
+		return nil
+	}
+
+	if err := p.GetConnection(ctx).RawQuery("DELETE FROM "+loginEventsTable+" WHERE created_at < ?", before).Exec(); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	return nil
+}
+
+const trustedDevicesTable = "identity_trusted_devices"
+
+func (p *Persister) CreateTrustedDevice(ctx context.Context, d *session.TrustedDevice) error {
+	if err := p.requireTable(ctx, trustedDevicesTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(d))
+}
+
+func (p *Persister) GetTrustedDevice(ctx context.Context, id uuid.UUID) (*session.TrustedDevice, error) {
+	if p.missingTable(ctx, trustedDevicesTable) {
+		// No device can have been trusted before the migration was applied.
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	var d session.TrustedDevice
+	if err := p.GetConnection(ctx).Find(&d, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &d, nil
+}
+
+func (p *Persister) ListTrustedDevices(ctx context.Context, identityID uuid.UUID) ([]session.TrustedDevice, error) {
+	if err := p.requireTable(ctx, trustedDevicesTable); err != nil {
+		return nil, err
+	}
+
+	var ds []session.TrustedDevice
+	if err := p.GetConnection(ctx).Where("identity_id = ? AND expires_at > ?", identityID, time.Now().UTC()).Order("created_at DESC").All(&ds); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return ds, nil
+}
+
+func (p *Persister) DeleteTrustedDevice(ctx context.Context, identityID, id uuid.UUID) error {
+	if err := p.requireTable(ctx, trustedDevicesTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery("DELETE FROM "+trustedDevicesTable+" WHERE id = ? AND identity_id = ?", id, identityID).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) DeleteTrustedDevices(ctx context.Context, identityID uuid.UUID) error {
+	if p.missingTable(ctx, trustedDevicesTable) {
+		return nil
+	}
+
+	if err := p.GetConnection(ctx).RawQuery("DELETE FROM "+trustedDevicesTable+" WHERE identity_id = ?", identityID).Exec(); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	return nil
+}
+
+func (p *Persister) DeleteExpiredTrustedDevices(ctx context.Context, before time.Time) error {
+	if p.missingTable(ctx, trustedDevicesTable) {
+		return nil
+	}
+
+	if err := p.GetConnection(ctx).RawQuery("DELETE FROM "+trustedDevicesTable+" WHERE expires_at < ?", before).Exec(); err != nil {
 		return sqlcon.HandleError(err)
 	}
 	return nil
@@ -0,0 +1,145 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/stats"
+)
+
+var _ stats.Persister = new(Persister)
+
+// PoolStatistics returns the statistics of the connection pool. They are not available within a transaction.
+func (p *Persister) PoolStatistics(ctx context.Context) (*stats.Pool, error) {
+	db, ok := p.GetConnection(ctx).Store.(interface{ Stats() sql.DBStats })
+	if !ok {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("The connection pool statistics are not available."))
+	}
+
+	s := db.Stats()
+	return &stats.Pool{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDuration:       s.WaitDuration,
+	}, nil
+}
+
+// Statistics aggregates the metrics with one query per metric. The queries use the indexes added by
+// migration 20191100000015 if it was applied.
+func (p *Persister) Statistics(ctx context.Context, from, to time.Time) (*stats.Statistics, error) {
+	c := p.GetConnection(ctx)
+	s := &stats.Statistics{From: from, To: to, Logins: []stats.MethodCount{}}
+
+	var err error
+	if s.Identities, err = c.Count(new(identity.Identity)); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	if s.ActiveSessions, err = c.Where("expires_at > ?", time.Now().UTC()).Count(new(session.Session)); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	if s.CourierQueue, err = c.Where("status = ?", courier.MessageStatusQueued).Count(new(courier.Message)); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	if s.Signups, err = p.dailySignups(c, from, to); err != nil {
+		return nil, err
+	}
+
+	addresses, err := c.Where("created_at >= ? AND created_at < ?", from, to).Count(new(identity.VerifiableAddress))
+	if err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	verified, err := c.Where("created_at >= ? AND created_at < ? AND verified = ?", from, to, true).Count(new(identity.VerifiableAddress))
+	if err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	s.Verification = stats.NewVerificationCount(addresses, verified)
+
+	if !p.missingTable(ctx, loginEventsTable) {
+		if s.Logins, err = p.loginsPerMethod(c, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (p *Persister) dailySignups(c *pop.Connection, from, to time.Time) ([]stats.DailyCount, error) {
+	day := "CAST(created_at AS DATE)"
+	if c.Dialect.Name() == "sqlite3" {
+		day = "DATE(created_at)"
+	}
+
+	var rows []struct {
+		Day   string `db:"day"`
+		Count int    `db:"count"`
+	}
+	if err := c.RawQuery(fmt.Sprintf(
+		"SELECT %[1]s AS day, COUNT(*) AS count FROM identities WHERE created_at >= ? AND created_at < ? GROUP BY %[1]s", day,
+	), from, to).All(&rows); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	counts := map[string]int{}
+	for _, row := range rows {
+		// Depending on the driver, the day is either returned as a date or as a timestamp.
+		if len(row.Day) >= 10 {
+			counts[row.Day[:10]] += row.Count
+		}
+	}
+	return stats.DailyCounts(from, to, counts), nil
+}
+
+func (p *Persister) loginsPerMethod(c *pop.Connection, from, to time.Time) ([]stats.MethodCount, error) {
+	var rows []struct {
+		Method  string `db:"method"`
+		Success bool   `db:"success"`
+		Count   int    `db:"count"`
+	}
+	if err := c.RawQuery(
+		"SELECT method, success, COUNT(*) AS count FROM "+loginEventsTable+" WHERE created_at >= ? AND created_at < ? GROUP BY method, success",
+		from, to,
+	).All(&rows); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	methods := map[string]*stats.MethodCount{}
+	for _, row := range rows {
+		m, ok := methods[row.Method]
+		if !ok {
+			m = &stats.MethodCount{Method: row.Method}
+			methods[row.Method] = m
+		}
+		if row.Success {
+			m.Successful += row.Count
+		} else {
+			m.Failed += row.Count
+		}
+	}
+
+	logins := make([]stats.MethodCount, 0, len(methods))
+	for _, m := range methods {
+		logins = append(logins, *m)
+	}
+	sort.Slice(logins, func(i, j int) bool {
+		return logins[i].Method < logins[j].Method
+	})
+	return logins, nil
+}
@@ -3,16 +3,22 @@ package sql_test
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/bxcodec/faker"
 	"github.com/go-errors/errors"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
 	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/persistence/sql"
 	"github.com/ory/kratos/selfservice/errorx"
@@ -20,6 +26,7 @@ import (
 
 	"github.com/gobuffalo/pop/v5"
 	"github.com/gobuffalo/pop/v5/logging"
+	gofrsuuid "github.com/gofrs/uuid"
 	"github.com/google/uuid"
 
 	"github.com/ory/x/sqlcon/dockertest"
@@ -27,14 +34,31 @@ import (
 	// "github.com/ory/x/sqlcon/dockertest"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ory/kratos/admission"
+	"github.com/ory/kratos/cluster"
 	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/idempotency"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/relationship"
+	"github.com/ory/kratos/retention"
+	"github.com/ory/kratos/schedule"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/flow/device"
+	"github.com/ory/kratos/selfservice/flow/inspect"
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/flow/recovery"
 	"github.com/ory/kratos/selfservice/flow/registration"
 	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/selfservice/strategy/emailcode"
+	"github.com/ory/kratos/selfservice/strategy/push"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/stats"
+	"github.com/ory/kratos/token"
+	"github.com/ory/kratos/webhook"
 )
 
 // Workaround for https://github.com/gobuffalo/pop/pull/481
@@ -122,6 +146,14 @@ func TestPersister(t *testing.T) {
 			require.NoError(t, p.MigrationStatus(context.Background(), os.Stderr))
 			require.NoError(t, p.MigrateUp(context.Background()))
 
+			pending, err := p.PendingMigrations(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, pending)
+
+			plan, err := p.MigrationPlan(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, plan)
+
 			t.Run("contract=identity.TestPool", func(t *testing.T) {
 				pop.SetLogger(pl(t))
 				identity.TestPool(p.(identity.PrivilegedPool))(t)
@@ -154,6 +186,159 @@ func TestPersister(t *testing.T) {
 				pop.SetLogger(pl(t))
 				verify.TestPersister(p)(t)
 			})
+			t.Run("contract=inspect.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				inspect.TestPersister(p)(t)
+			})
+			t.Run("contract=retention.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				retention.TestPersister(p)(t)
+			})
+			t.Run("contract=admission.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				admission.TestPersister(p)(t)
+			})
+			t.Run("contract=relationship.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				relationship.TestPersister(p)(t)
+			})
+			t.Run("contract=schedule.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				schedule.TestPersister(p)(t)
+			})
+			t.Run("contract=schema.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				schema.TestPersister(p)(t)
+			})
+			t.Run("contract=idempotency.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				idempotency.TestPersister(p)(t)
+			})
+			t.Run("contract=cluster.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				cluster.TestPersister(p)(t)
+			})
+			t.Run("contract=device.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				device.TestPersister(p)(t)
+			})
+			t.Run("contract=push.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				push.TestPersister(p)(t)
+			})
+			t.Run("contract=emailcode.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				emailcode.TestPersister(p)(t)
+			})
+			t.Run("contract=recovery.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				recovery.TestPersister(p)(t)
+			})
+			t.Run("contract=token.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				token.TestPersister(p)(t)
+			})
+			t.Run("contract=maintenance.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				maintenance.TestPersister(p)(t)
+			})
+			t.Run("contract=webhook.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				webhook.TestPersister(p)(t)
+			})
+			t.Run("contract=stats.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				stats.TestPersister(p, func(t *testing.T) {
+					var s session.Session
+					require.NoError(t, faker.FakeData(&s))
+					s.ExpiresAt = time.Now().UTC().Add(time.Hour)
+
+					address, err := identity.NewVerifiableEmailAddress("stats.TestPersister@ory.sh", s.Identity.ID, time.Hour)
+					require.NoError(t, err)
+					s.Identity.Addresses = []identity.VerifiableAddress{*address}
+					require.NoError(t, p.CreateIdentity(context.Background(), s.Identity))
+					s.IdentityID = s.Identity.ID
+					require.NoError(t, p.CreateSession(context.Background(), &s))
+
+					var m courier.Message
+					require.NoError(t, faker.FakeData(&m))
+					require.NoError(t, p.AddMessage(context.Background(), &m))
+
+					require.NoError(t, p.CreateLoginEvent(context.Background(), &session.LoginEvent{
+						ID: x.NewUUID(), IdentityID: s.Identity.ID, Method: identity.CredentialsTypePassword, Success: true,
+					}, 10))
+				})(t)
+			})
+			t.Run("case=runs against the schema of the previous release", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+
+				// Roll back all migrations up to and including the one which added a gated column.
+				for {
+					plan, err := p.MigrationDownPlan(context.Background(), 1)
+					require.NoError(t, err)
+					require.Len(t, plan, 1)
+					require.NoError(t, p.MigrateDown(context.Background(), 1))
+					if plan[0].Version == "20191100000013" {
+						break
+					}
+				}
+
+				required, err := p.RequiredMigrations(context.Background())
+				require.NoError(t, err)
+				assert.NotContains(t, required, "20191100000013")
+
+				plan, err := p.MigrationPlan(context.Background())
+				require.NoError(t, err)
+				require.NotEmpty(t, plan)
+				assert.Equal(t, "20191100000013", plan[0].Version)
+				assert.False(t, plan[0].Required)
+				require.NotEmpty(t, plan[0].Statements)
+				assert.Contains(t, plan[0].Statements[0].SQL, "password_rotation_identity_id")
+
+				r := login.NewLoginRequest(time.Hour, "csrf", &http.Request{URL: urlx.ParseOrPanic("http://kratos/"), Host: "kratos"})
+				require.NoError(t, p.CreateLoginRequest(context.Background(), r))
+				actual, err := p.GetLoginRequest(context.Background(), r.ID)
+				require.NoError(t, err)
+				assert.Equal(t, r.ID, actual.ID)
+				require.NoError(t, p.MarkRequestForced(context.Background(), r.ID))
+
+				err = p.UpdateLoginRequestPasswordRotation(context.Background(), r.ID, gofrsuuid.NullUUID{})
+				require.Error(t, err)
+				assert.Equal(t, sql.ErrMigrationPending.Reason(), errorsx.Cause(err).(*herodot.DefaultError).Reason())
+
+				require.NoError(t, p.MigrateUp(context.Background()))
+				require.NoError(t, p.UpdateLoginRequestPasswordRotation(context.Background(), r.ID, gofrsuuid.NullUUID{}))
+			})
+			t.Run("case=all migrations can be rolled back and applied again", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+
+				plan, err := p.MigrationDownPlan(context.Background(), 1)
+				require.NoError(t, err)
+				require.Len(t, plan, 1)
+				require.NotEmpty(t, plan[0].Statements)
+
+				_, err = p.MigrationDownPlan(context.Background(), 0)
+				require.Error(t, err)
+
+				// Roll back one migration after the other to make sure that each down migration works.
+				for {
+					plan, err := p.MigrationDownPlan(context.Background(), 1)
+					require.NoError(t, err)
+					if len(plan) == 0 {
+						break
+					}
+					require.NoError(t, p.MigrateDown(context.Background(), 1), "%s %s", plan[0].Version, plan[0].Name)
+				}
+
+				pending, err := p.PendingMigrations(context.Background())
+				require.NoError(t, err)
+				assert.NotEmpty(t, pending)
+
+				require.NoError(t, p.MigrateUp(context.Background()))
+				pending, err = p.PendingMigrations(context.Background())
+				require.NoError(t, err)
+				assert.Empty(t, pending)
+			})
 		})
 
 		t.Logf("DSN: %s", dsn)
@@ -212,3 +397,89 @@ func TestPersister_Transaction(t *testing.T) {
 		assert.Equal(t, sqlcon.ErrNoRows.Error(), err.Error())
 	})
 }
+
+func TestPersister_EncryptMessages(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	p := reg.Persister()
+
+	// Messages queued before bodies were encrypted are stored in plaintext.
+	m := &courier.Message{ID: x.NewUUID(), Status: courier.MessageStatusQueued, Type: courier.MessageTypeEmail, Recipient: "foo@ory.sh", Body: "plaintext-body"}
+	require.NoError(t, p.GetConnection(context.Background()).Create(m))
+
+	count, err := p.EncryptMessages(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = p.EncryptMessages(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	actual, err := p.LatestQueuedMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, m.ID, actual.ID)
+	assert.True(t, actual.BodyEncrypted)
+	assert.NotContains(t, actual.Body, "plaintext-body")
+
+	body, err := actual.PlaintextBody(reg.Cipher())
+	require.NoError(t, err)
+	assert.Equal(t, "plaintext-body", body)
+}
+
+func TestPersister_BackfillCredentialIdentifiers(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	p := reg.Persister()
+
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	i.SetCredentials(identity.CredentialsTypePassword, identity.Credentials{
+		Type: identity.CredentialsTypePassword, Identifiers: []string{"backfill@ory.sh"}, Config: []byte(`{}`),
+	})
+	require.NoError(t, p.CreateIdentity(context.Background(), i))
+
+	// Replicas running the previous release store identifiers without the lookup columns.
+	require.NoError(t, p.GetConnection(context.Background()).RawQuery(
+		"UPDATE identity_credential_identifiers SET identity_id = NULL, identity_credential_type_id = NULL, normalized_identifier = '' WHERE identifier = ?",
+		"backfill@ory.sh",
+	).Exec())
+
+	actual, _, err := p.FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypePassword, "backfill@ory.sh")
+	require.NoError(t, err)
+	assert.Equal(t, i.ID, actual.ID)
+
+	count, err := p.BackfillCredentialIdentifiers(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = p.BackfillCredentialIdentifiers(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	var ci identity.CredentialIdentifier
+	require.NoError(t, p.GetConnection(context.Background()).Where("identifier = ?", "backfill@ory.sh").First(&ci))
+	assert.Equal(t, i.ID, ci.IdentityID)
+	assert.Equal(t, "backfill@ory.sh", ci.NormalizedIdentifier)
+
+	actual, _, err = p.FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypePassword, "Backfill@ory.sh")
+	require.NoError(t, err)
+	assert.Equal(t, i.ID, actual.ID)
+}
+
+func TestPersister_EncryptsIdempotencyRecords(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	p := reg.Persister()
+
+	r := idempotency.NewRecord("admin", "encrypted", 0, nil)
+	require.NoError(t, p.CreateIdempotencyRecord(context.Background(), r))
+	r.StatusCode, r.Body = 201, `{"token":"secret-token"}`
+	require.NoError(t, p.UpdateIdempotencyRecord(context.Background(), r))
+	assert.Equal(t, `{"token":"secret-token"}`, r.Body, "the record of the caller is not changed")
+
+	var stored idempotency.Record
+	require.NoError(t, p.GetConnection(context.Background()).Find(&stored, r.ID))
+	assert.True(t, stored.BodyEncrypted)
+	assert.NotContains(t, stored.Body, "secret-token")
+
+	actual, err := p.GetIdempotencyRecord(context.Background(), "admin", "encrypted")
+	require.NoError(t, err)
+	assert.Equal(t, `{"token":"secret-token"}`, actual.Body)
+	assert.False(t, actual.BodyEncrypted)
+}
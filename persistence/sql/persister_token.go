@@ -0,0 +1,98 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/token"
+)
+
+var _ token.Persister = new(Persister)
+
+const actionTokensTable = "identity_action_tokens"
+
+func (p *Persister) CreateToken(ctx context.Context, t *token.Token) error {
+	if err := p.requireTable(ctx, actionTokensTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(t))
+}
+
+func (p *Persister) GetToken(ctx context.Context, id uuid.UUID) (*token.Token, error) {
+	if err := p.requireTable(ctx, actionTokensTable); err != nil {
+		return nil, err
+	}
+
+	var t token.Token
+	if err := p.GetConnection(ctx).Find(&t, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &t, nil
+}
+
+func (p *Persister) UseToken(ctx context.Context, id uuid.UUID, purpose string, by identity.Redeemer) (*token.Token, error) {
+	t, err := p.GetToken(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if t.Purpose != purpose {
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	var used bool
+	now := time.Now().UTC()
+	if err := p.Transaction(ctx, func(tx *pop.Connection) error {
+		// The update is conditional so that concurrent requests can not redeem the token twice.
+		count, err := tx.RawQuery(
+			"UPDATE "+actionTokensTable+" SET used_at = ?, updated_at = ? WHERE id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+			now.Round(time.Second), now, id, purpose, now,
+		).ExecWithCount()
+		if err != nil {
+			return sqlcon.HandleError(err)
+		}
+
+		if count == 0 {
+			return nil
+		}
+
+		used = true
+		return p.createRedemption(ctx, tx, identity.NewRedemption(identity.RedemptionKindActionToken, id.String(), t.IdentityID, by))
+	}); err != nil {
+		return nil, err
+	}
+
+	t, err = p.GetToken(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !used {
+		if t.UsedAt != nil {
+			return nil, errors.WithStack(&identity.ErrAlreadyRedeemed)
+		}
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return t, nil
+}
+
+func (p *Persister) DeleteToken(ctx context.Context, id uuid.UUID) error {
+	if err := p.requireTable(ctx, actionTokensTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery("DELETE FROM "+actionTokensTable+" WHERE id = ?", id).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
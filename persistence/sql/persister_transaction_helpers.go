@@ -24,6 +24,14 @@ func (p *Persister) Transaction(ctx context.Context, callback func(connection *p
 	return p.c.Transaction(callback)
 }
 
+// InTransaction calls fn in a transaction which is committed if fn returns no error. Persister methods which are
+// called with the context passed to fn use the transaction.
+func (p *Persister) InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return p.Transaction(ctx, func(tx *pop.Connection) error {
+		return fn(WithTransaction(ctx, tx))
+	})
+}
+
 func (p *Persister) GetConnection(ctx context.Context) *pop.Connection {
 	c := ctx.Value(transactionKey)
 	if c != nil {
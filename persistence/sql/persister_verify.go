@@ -12,20 +12,28 @@ import (
 
 var _ verify.Persister = new(Persister)
 
-func (p Persister) CreateVerifyRequest(ctx context.Context, r *verify.Request) error {
+const verificationRequestsTable = "selfservice_verification_requests"
+
+func (p *Persister) CreateVerifyRequest(ctx context.Context, r *verify.Request) error {
 	// This should not create the request eagerly because otherwise we might accidentally create an address
 	// that isn't supposed to be in the database.
-	return p.GetConnection(ctx).Create(r)
+	return p.GetConnection(ctx).Create(r, p.missingColumns(ctx, verificationRequestsTable)...)
 }
 
-func (p Persister) GetVerifyRequest(ctx context.Context, id uuid.UUID) (*verify.Request, error) {
+func (p *Persister) GetVerifyRequest(ctx context.Context, id uuid.UUID) (*verify.Request, error) {
 	var r verify.Request
-	if err := p.GetConnection(ctx).Find(&r, id); err != nil {
+
+	q := p.GetConnection(ctx).Q()
+	if missing := p.missingColumns(ctx, verificationRequestsTable); len(missing) > 0 {
+		q = q.Select(selectColumns(&r, missing)...)
+	}
+
+	if err := q.Find(&r, id); err != nil {
 		return nil, sqlcon.HandleError(err)
 	}
 	return &r, nil
 }
 
-func (p Persister) UpdateVerifyRequest(ctx context.Context, r *verify.Request) error {
-	return sqlcon.HandleError(p.GetConnection(ctx).Update(r))
+func (p *Persister) UpdateVerifyRequest(ctx context.Context, r *verify.Request) error {
+	return sqlcon.HandleError(p.GetConnection(ctx).Update(r, p.missingColumns(ctx, verificationRequestsTable)...))
 }
@@ -0,0 +1,222 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/webhook"
+)
+
+var _ webhook.Persister = new(Persister)
+
+const (
+	webhookSubscriptionsTable = "webhook_subscriptions"
+	webhookDeliveriesTable    = "webhook_deliveries"
+)
+
+func (p *Persister) CreateWebhookSubscription(ctx context.Context, s *webhook.Subscription) error {
+	if err := p.requireTable(ctx, webhookSubscriptionsTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(s))
+}
+
+func (p *Persister) GetWebhookSubscription(ctx context.Context, id uuid.UUID) (*webhook.Subscription, error) {
+	if err := p.requireTable(ctx, webhookSubscriptionsTable); err != nil {
+		return nil, err
+	}
+
+	var s webhook.Subscription
+	if err := p.GetConnection(ctx).Find(&s, id); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &s, nil
+}
+
+func (p *Persister) ListWebhookSubscriptions(ctx context.Context, limit, offset int) ([]webhook.Subscription, error) {
+	ss := make([]webhook.Subscription, 0)
+	// Without the migration no subscriptions could have been created.
+	if p.missingTable(ctx, webhookSubscriptionsTable) {
+		return ss, nil
+	}
+
+	if err := p.GetConnection(ctx).RawQuery(
+		"SELECT * FROM "+webhookSubscriptionsTable+" ORDER BY created_at ASC, id ASC LIMIT ? OFFSET ?",
+		limit, offset,
+	).All(&ss); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return ss, nil
+}
+
+func (p *Persister) FindWebhookSubscriptions(ctx context.Context, t webhook.EventType) ([]webhook.Subscription, error) {
+	found := make([]webhook.Subscription, 0)
+	if p.missingTable(ctx, webhookSubscriptionsTable) {
+		return found, nil
+	}
+
+	var ss []webhook.Subscription
+	if err := p.GetConnection(ctx).Where("enabled = ?", true).All(&ss); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	// The event types are stored as a JSON array, which can not be queried the same way on all databases.
+	for _, s := range ss {
+		if s.Events.Has(t) {
+			found = append(found, s)
+		}
+	}
+	return found, nil
+}
+
+func (p *Persister) UpdateWebhookSubscription(ctx context.Context, s *webhook.Subscription) error {
+	if err := p.requireTable(ctx, webhookSubscriptionsTable); err != nil {
+		return err
+	}
+
+	events, err := s.Events.Value()
+	if err != nil {
+		return err
+	}
+
+	s.UpdatedAt = time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+webhookSubscriptionsTable+" SET url = ?, events = ?, filter = ?, enabled = ?, secret = ?, updated_at = ? WHERE id = ?",
+		s.URL, events, s.Filter, s.Enabled, s.EncryptedSecret, s.UpdatedAt, s.ID,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) error {
+	if err := p.requireTable(ctx, webhookSubscriptionsTable); err != nil {
+		return err
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery("DELETE FROM "+webhookSubscriptionsTable+" WHERE id = ?", id).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) CreateWebhookDelivery(ctx context.Context, d *webhook.Delivery) error {
+	if err := p.requireTable(ctx, webhookDeliveriesTable); err != nil {
+		return err
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(d))
+}
+
+func (p *Persister) GetWebhookDelivery(ctx context.Context, subscriptionID, id uuid.UUID) (*webhook.Delivery, error) {
+	if err := p.requireTable(ctx, webhookDeliveriesTable); err != nil {
+		return nil, err
+	}
+
+	var d webhook.Delivery
+	if err := p.GetConnection(ctx).Where("id = ? AND subscription_id = ?", id, subscriptionID).First(&d); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &d, nil
+}
+
+func (p *Persister) ListWebhookDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit, offset int) ([]webhook.Delivery, error) {
+	ds := make([]webhook.Delivery, 0)
+	if p.missingTable(ctx, webhookDeliveriesTable) {
+		return ds, nil
+	}
+
+	if err := p.GetConnection(ctx).RawQuery(
+		"SELECT * FROM "+webhookDeliveriesTable+" WHERE subscription_id = ? ORDER BY created_at DESC, id ASC LIMIT ? OFFSET ?",
+		subscriptionID, limit, offset,
+	).All(&ds); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return ds, nil
+}
+
+func (p *Persister) ClaimWebhookDeliveries(ctx context.Context, now, staleBefore time.Time, limit int) ([]webhook.Delivery, error) {
+	claimed := make([]webhook.Delivery, 0)
+	if p.missingTable(ctx, webhookDeliveriesTable) {
+		return claimed, nil
+	}
+
+	var candidates []webhook.Delivery
+	if err := p.GetConnection(ctx).RawQuery(
+		"SELECT * FROM "+webhookDeliveriesTable+" WHERE (state = ? AND next_attempt_at <= ?) OR (state = ? AND updated_at <= ?) ORDER BY next_attempt_at ASC, id ASC LIMIT ?",
+		webhook.StatePending, now, webhook.StateRunning, staleBefore, limit,
+	).All(&candidates); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	for _, d := range candidates {
+		// The number of attempts changes with every claim, so only one of several concurrent workers claims the delivery.
+		claimedAt := time.Now().UTC()
+		count, err := p.GetConnection(ctx).RawQuery(
+			"UPDATE "+webhookDeliveriesTable+" SET state = ?, attempts = ?, updated_at = ? WHERE id = ? AND state = ? AND attempts = ?",
+			webhook.StateRunning, d.Attempts+1, claimedAt, d.ID, d.State, d.Attempts,
+		).ExecWithCount()
+		if err != nil {
+			return nil, sqlcon.HandleError(err)
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		d.State = webhook.StateRunning
+		d.Attempts++
+		d.UpdatedAt = claimedAt
+		claimed = append(claimed, d)
+	}
+	return claimed, nil
+}
+
+func (p *Persister) UpdateWebhookDelivery(ctx context.Context, d *webhook.Delivery) error {
+	if err := p.requireTable(ctx, webhookDeliveriesTable); err != nil {
+		return err
+	}
+
+	d.UpdatedAt = time.Now().UTC()
+	count, err := p.GetConnection(ctx).RawQuery(
+		"UPDATE "+webhookDeliveriesTable+" SET state = ?, next_attempt_at = ?, response_status = ?, response_body = ?, last_error = ?, delivered_at = ?, updated_at = ? WHERE id = ?",
+		d.State, d.NextAttemptAt, d.ResponseStatus, d.ResponseBody, d.LastError, d.DeliveredAt, d.UpdatedAt, d.ID,
+	).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	if count == 0 {
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *Persister) DeleteWebhookDeliveries(ctx context.Context, createdBefore time.Time) (int, error) {
+	if p.missingTable(ctx, webhookDeliveriesTable) {
+		return 0, nil
+	}
+
+	count, err := p.GetConnection(ctx).RawQuery(
+		"DELETE FROM "+webhookDeliveriesTable+" WHERE state IN (?, ?) AND created_at < ?",
+		webhook.StateDelivered, webhook.StateFailed, createdBefore,
+	).ExecWithCount()
+	if err != nil {
+		return 0, sqlcon.HandleError(err)
+	}
+	return count, nil
+}
@@ -0,0 +1,270 @@
+package relationship
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/pagination"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+const RelationshipsPath = "/relationships"
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		identity.PoolProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		RelationshipHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(RelationshipsPath, h.list)
+	admin.POST(RelationshipsPath, h.create)
+	admin.GET(RelationshipsPath+"/:id", h.get)
+	admin.DELETE(RelationshipsPath+"/:id", h.delete)
+}
+
+// A single relationship.
+//
+// swagger:response identityRelationship
+// nolint:deadcode,unused
+type relationshipResponse struct {
+	// in: body
+	Body *Relationship
+}
+
+// A list of relationships.
+//
+// swagger:response identityRelationships
+// nolint:deadcode,unused
+type relationshipsResponse struct {
+	// in: body
+	Body []Relationship
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listIdentityRelationships
+type listParameters struct {
+	// Type returns only relationships of this type.
+	//
+	// in: query
+	Type string `json:"type"`
+
+	// IdentityID returns only relationships the identity has, for example to its children.
+	//
+	// in: query
+	IdentityID string `json:"identity_id"`
+
+	// RelatedID returns only relationships other identities have to the identity, for example to its parents.
+	//
+	// in: query
+	RelatedID string `json:"related_id"`
+
+	// Limit is the maximum number of relationships returned. It defaults to 100 and must not exceed 500.
+	//
+	// in: query
+	Limit int `json:"limit"`
+
+	// Offset is the number of relationships to skip.
+	//
+	// in: query
+	Offset int `json:"offset"`
+}
+
+// swagger:model createIdentityRelationship
+type CreateRelationship struct {
+	// Type describes how the identities are related, for example `parent` or `delegate`.
+	//
+	// required: true
+	Type string `json:"type"`
+
+	// IdentityID is the ID of the identity which has the relationship, for example the parent.
+	//
+	// required: true
+	IdentityID uuid.UUID `json:"identity_id"`
+
+	// RelatedID is the ID of the identity it is related to, for example the child.
+	//
+	// required: true
+	RelatedID uuid.UUID `json:"related_id"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters createIdentityRelationship
+type createParameters struct {
+	// in: body
+	Body CreateRelationship
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getIdentityRelationship deleteIdentityRelationship
+type idParameters struct {
+	// ID is the ID of the relationship.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /relationships admin listIdentityRelationships
+//
+// List relationships between identities
+//
+// Returns the relationships matching the filters, oldest first.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityRelationships
+//       500: genericError
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	q := r.URL.Query()
+	rs, err := h.r.RelationshipPersister().ListRelationships(r.Context(), Filter{
+		Type:       q.Get("type"),
+		IdentityID: x.ParseUUID(q.Get("identity_id")),
+		RelatedID:  x.ParseUUID(q.Get("related_id")),
+	}, limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, rs)
+}
+
+// swagger:route POST /relationships admin createIdentityRelationship
+//
+// Relate two identities
+//
+// Creates a relationship between two identities, for example to let a parent manage the account of a child. The
+// relationships of an identity are returned by `/sessions/whoami`. If the type is listed in
+// `identity.relationships.login_as`, the identity may sign in as the related identity using
+// `/sessions/delegate`.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: identityRelationship
+//       400: genericError
+//       404: genericError
+//       409: genericError
+//       500: genericError
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var body CreateRelationship
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&body)); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	rel, err := NewRelationship(body.Type, body.IdentityID, body.RelatedID)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	for _, id := range []uuid.UUID{rel.IdentityID, rel.RelatedID} {
+		if _, err := h.r.IdentityPool().GetIdentity(r.Context(), id); err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.r.RelationshipPersister().CreateRelationship(r.Context(), rel); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "identity_relationship").
+		WithField("relationship_id", rel.ID).
+		WithField("type", rel.Type).
+		WithField("identity_id", rel.IdentityID).
+		WithField("related_id", rel.RelatedID).
+		Info("A relationship between identities was created.")
+	h.r.Writer().WriteCreated(w, r, urlx.AppendPaths(h.c.SelfAdminURL(), RelationshipsPath, rel.ID.String()).String(), rel)
+}
+
+// swagger:route GET /relationships/{id} admin getIdentityRelationship
+//
+// Get a relationship between identities
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identityRelationship
+//       404: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rel, err := h.r.RelationshipPersister().GetRelationship(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, rel)
+}
+
+// swagger:route DELETE /relationships/{id} admin deleteIdentityRelationship
+//
+// Remove a relationship between identities
+//
+// Deletes the relationship. Sessions in which the identity signed in as the related identity using this
+// relationship are no longer valid.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := x.ParseUUID(ps.ByName("id"))
+	if err := h.r.RelationshipPersister().DeleteRelationship(r.Context(), id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "identity_relationship").
+		WithField("relationship_id", id).
+		Info("A relationship between identities was deleted.")
+	w.WriteHeader(http.StatusNoContent)
+}
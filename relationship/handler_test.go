@@ -0,0 +1,94 @@
+package relationship_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/relationship"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	router := x.NewRouterAdmin()
+	reg.RelationshipHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfAdmin, ts.URL)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	send := func(t *testing.T, method, href string, expectCode int, body interface{}) gjson.Result {
+		var b bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&b).Encode(body))
+		}
+		req, err := http.NewRequest(method, ts.URL+href, &b)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		result, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		require.EqualValues(t, expectCode, res.StatusCode, "%s", result)
+		return gjson.ParseBytes(result)
+	}
+
+	newIdentity := func(t *testing.T) uuid.UUID {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i.ID
+	}
+
+	parent, child := newIdentity(t), newIdentity(t)
+
+	t.Run("case=should reject invalid relationships", func(t *testing.T) {
+		for k, body := range []CreateRelationship{
+			{Type: "Parent", IdentityID: parent, RelatedID: child},
+			{Type: "parent", IdentityID: parent},
+			{Type: "parent", IdentityID: parent, RelatedID: parent},
+		} {
+			t.Logf("case=%d", k)
+			send(t, "POST", RelationshipsPath, http.StatusBadRequest, body)
+		}
+	})
+
+	t.Run("case=should fail if an identity does not exist", func(t *testing.T) {
+		send(t, "POST", RelationshipsPath, http.StatusNotFound, CreateRelationship{Type: "parent", IdentityID: parent, RelatedID: x.NewUUID()})
+	})
+
+	t.Run("case=should create, list, and delete relationships", func(t *testing.T) {
+		created := send(t, "POST", RelationshipsPath, http.StatusCreated, CreateRelationship{Type: "parent", IdentityID: parent, RelatedID: child})
+		id := created.Get("id").String()
+		assert.Equal(t, "parent", created.Get("type").String())
+		assert.Equal(t, child.String(), created.Get("related_id").String())
+
+		send(t, "POST", RelationshipsPath, http.StatusConflict, CreateRelationship{Type: "parent", IdentityID: parent, RelatedID: child})
+
+		assert.Equal(t, parent.String(), send(t, "GET", RelationshipsPath+"/"+id, http.StatusOK, nil).Get("identity_id").String())
+		assert.Equal(t, id, send(t, "GET", RelationshipsPath+"?related_id="+child.String(), http.StatusOK, nil).Get("0.id").String())
+		assert.Len(t, send(t, "GET", RelationshipsPath+"?type=delegate", http.StatusOK, nil).Array(), 0)
+
+		send(t, "DELETE", RelationshipsPath+"/"+id, http.StatusNoContent, nil)
+		send(t, "GET", RelationshipsPath+"/"+id, http.StatusNotFound, nil)
+		send(t, "DELETE", RelationshipsPath+"/"+id, http.StatusNotFound, nil)
+	})
+}
@@ -0,0 +1,116 @@
+package relationship
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		RelationshipPersister() Persister
+	}
+	Persister interface {
+		// CreateRelationship stores the relationship. Identities can only have one relationship of each type to
+		// an identity.
+		CreateRelationship(ctx context.Context, r *Relationship) error
+
+		GetRelationship(ctx context.Context, id uuid.UUID) (*Relationship, error)
+
+		// ListRelationships returns the relationships matching the filter, oldest first.
+		ListRelationships(ctx context.Context, f Filter, limit, offset int) ([]Relationship, error)
+
+		// ListRelationshipsOf returns the relationships the identity has and the ones other identities have to it,
+		// oldest first.
+		ListRelationshipsOf(ctx context.Context, identityID uuid.UUID) ([]Relationship, error)
+
+		// DeleteRelationship removes the relationship. Sessions which were created by signing in as the related
+		// identity using this relationship are no longer valid.
+		DeleteRelationship(ctx context.Context, id uuid.UUID) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		newIdentity := func(t *testing.T) uuid.UUID {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+			return i.ID
+		}
+
+		parent, child, assistant := newIdentity(t), newIdentity(t), newIdentity(t)
+
+		_, err := p.GetRelationship(context.Background(), x.NewUUID())
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+
+		parentOf, err := NewRelationship("parent", parent, child)
+		require.NoError(t, err)
+		require.NoError(t, p.CreateRelationship(context.Background(), parentOf))
+
+		duplicate, err := NewRelationship("parent", parent, child)
+		require.NoError(t, err)
+		require.Error(t, p.CreateRelationship(context.Background(), duplicate))
+
+		delegateOf, err := NewRelationship("delegate", assistant, parent)
+		require.NoError(t, err)
+		require.NoError(t, p.CreateRelationship(context.Background(), delegateOf))
+
+		actual, err := p.GetRelationship(context.Background(), parentOf.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "parent", actual.Type)
+		assert.Equal(t, parent, actual.IdentityID)
+		assert.Equal(t, child, actual.RelatedID)
+
+		ids := func(rs []Relationship) (ids []uuid.UUID) {
+			for _, r := range rs {
+				ids = append(ids, r.ID)
+			}
+			return
+		}
+
+		for k, tc := range []struct {
+			f        Filter
+			expected []uuid.UUID
+		}{
+			{f: Filter{IdentityID: parent}, expected: []uuid.UUID{parentOf.ID}},
+			{f: Filter{RelatedID: parent}, expected: []uuid.UUID{delegateOf.ID}},
+			{f: Filter{Type: "delegate", IdentityID: assistant}, expected: []uuid.UUID{delegateOf.ID}},
+			{f: Filter{Type: "parent", IdentityID: assistant}},
+			{f: Filter{IdentityID: parent, RelatedID: child}, expected: []uuid.UUID{parentOf.ID}},
+		} {
+			rs, err := p.ListRelationships(context.Background(), tc.f, 100, 0)
+			require.NoError(t, err, "%d", k)
+			assert.Equal(t, tc.expected, ids(rs), "%d", k)
+		}
+
+		rs, err := p.ListRelationshipsOf(context.Background(), parent)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{parentOf.ID, delegateOf.ID}, ids(rs))
+
+		require.NoError(t, p.DeleteRelationship(context.Background(), parentOf.ID))
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteRelationship(context.Background(), parentOf.ID)))
+
+		require.NoError(t, p.DeleteIdentity(context.Background(), assistant))
+		rs, err = p.ListRelationshipsOf(context.Background(), parent)
+		require.NoError(t, err)
+		assert.Empty(t, rs, "relationships are deleted with the identities")
+	}
+}
@@ -0,0 +1,96 @@
+package relationship
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+var typePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+type (
+	// Relationship connects two identities, for example a parent who manages the account of a child, or an assistant
+	// who has delegate access to the account of a manager. The identity is the `type` of the related identity, so
+	// the parent or the assistant is the identity, and the child or the manager is the related identity.
+	//
+	// swagger:model identityRelationship
+	Relationship struct {
+		// required: true
+		ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+		// Type describes how the identities are related, for example `parent` or `delegate`. It consists of up to
+		// 64 lower case letters, digits, dashes, and underscores.
+		//
+		// required: true
+		Type string `json:"type" db:"type"`
+
+		// IdentityID is the ID of the identity which has the relationship, for example the parent.
+		//
+		// required: true
+		IdentityID uuid.UUID `json:"identity_id" faker:"uuid" db:"identity_id"`
+
+		// RelatedID is the ID of the identity it is related to, for example the child.
+		//
+		// required: true
+		RelatedID uuid.UUID `json:"related_id" faker:"uuid" db:"related_id"`
+
+		// CreatedAt is the time (UTC) the relationship was created.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+
+	// Filter selects relationships. Empty fields match all relationships.
+	Filter struct {
+		Type       string
+		IdentityID uuid.UUID
+		RelatedID  uuid.UUID
+	}
+)
+
+func (r Relationship) TableName() string {
+	return "identity_relationships"
+}
+
+// NewRelationship returns a relationship of the given type between the identities.
+func NewRelationship(t string, identityID, relatedID uuid.UUID) (*Relationship, error) {
+	if !typePattern.MatchString(t) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The relationship type "%s" is invalid, it must consist of up to 64 lower case letters, digits, dashes, and underscores.`, t))
+	}
+
+	if x.IsZeroUUID(identityID) || x.IsZeroUUID(relatedID) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The identity_id and the related_id must be set."))
+	}
+
+	if identityID == relatedID {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("An identity can not be related to itself."))
+	}
+
+	return &Relationship{
+		ID:         x.NewUUID(),
+		Type:       t,
+		IdentityID: identityID,
+		RelatedID:  relatedID,
+		CreatedAt:  time.Now().UTC().Round(time.Second),
+	}, nil
+}
+
+// AllowsLoginAs returns true if the identity may sign in as the related identity, which is the case if the type is
+// one of loginAsTypes, see configuration.Provider.IdentityRelationshipsLoginAs.
+func (r *Relationship) AllowsLoginAs(loginAsTypes []string) bool {
+	for _, t := range loginAsTypes {
+		if t == r.Type {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/kratos/x"
+)
+
+type (
+	// event is the subset of the Sentry event payload which is sent by the Reporter.
+	event struct {
+		EventID     string            `json:"event_id"`
+		Timestamp   string            `json:"timestamp"`
+		Level       string            `json:"level"`
+		Platform    string            `json:"platform"`
+		Logger      string            `json:"logger"`
+		ServerName  string            `json:"server_name,omitempty"`
+		Release     string            `json:"release,omitempty"`
+		Environment string            `json:"environment,omitempty"`
+		Message     string            `json:"message"`
+		Exception   *exceptions       `json:"exception"`
+		Request     *eventRequest     `json:"request"`
+		Tags        map[string]string `json:"tags,omitempty"`
+	}
+	exceptions struct {
+		Values []exception `json:"values"`
+	}
+	exception struct {
+		Type       string      `json:"type"`
+		Value      string      `json:"value"`
+		Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+	}
+	stacktrace struct {
+		Frames []frame `json:"frames"`
+	}
+	frame struct {
+		Function string `json:"function"`
+		Filename string `json:"filename"`
+		AbsPath  string `json:"abs_path"`
+		Lineno   int    `json:"lineno"`
+		InApp    bool   `json:"in_app"`
+	}
+
+	// eventRequest leaves out the query, the headers, and the body because they may contain personal data
+	// or secrets.
+	eventRequest struct {
+		URL    string `json:"url"`
+		Method string `json:"method"`
+	}
+
+	stackTracer interface {
+		StackTrace() errors.StackTrace
+	}
+)
+
+func newException(err error, redactor *x.LogRedactor) exception {
+	e := exception{
+		Type:  fmt.Sprintf("%T", errorsx.Cause(err)),
+		Value: redactor.Scrub(err.Error()),
+	}
+
+	// The innermost stack trace is the closest to where the error happened.
+	var trace errors.StackTrace
+	for cause := err; cause != nil; {
+		if st, ok := cause.(stackTracer); ok {
+			trace = st.StackTrace()
+		}
+		c, ok := cause.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		cause = c.Cause()
+	}
+
+	if len(trace) > 0 {
+		e.Stacktrace = &stacktrace{Frames: newFrames(trace)}
+	}
+	return e
+}
+
+// newFrames converts the stack trace to Sentry frames, which are ordered from the oldest to the newest call.
+func newFrames(trace errors.StackTrace) []frame {
+	frames := make([]frame, 0, len(trace))
+	for k := len(trace) - 1; k >= 0; k-- {
+		pc := uintptr(trace[k]) - 1
+		fn := runtime.FuncForPC(pc)
+		if fn == nil {
+			continue
+		}
+
+		file, line := fn.FileLine(pc)
+		frames = append(frames, frame{
+			Function: fn.Name(),
+			Filename: filepath.Base(file),
+			AbsPath:  file,
+			Lineno:   line,
+			InApp:    strings.HasPrefix(fn.Name(), "github.com/ory/kratos/"),
+		})
+	}
+	return frames
+}
@@ -0,0 +1,45 @@
+package report
+
+import (
+	"net/http"
+
+	"github.com/ory/herodot"
+)
+
+// Writer reports the server errors written by the embedded herodot.Writer.
+type Writer struct {
+	herodot.Writer
+	r *Reporter
+}
+
+func NewWriter(w herodot.Writer, r *Reporter) *Writer {
+	return &Writer{Writer: w, r: r}
+}
+
+func (w *Writer) WriteError(rw http.ResponseWriter, r *http.Request, err error) {
+	w.Writer.WriteError(rw, r, err)
+	w.r.Report(r, err)
+}
+
+// RecoveryMiddleware reports panics of the next handlers. It panics again afterwards, so that net/http
+// handles the panic like before.
+type RecoveryMiddleware struct {
+	r *Reporter
+}
+
+func NewRecoveryMiddleware(r *Reporter) *RecoveryMiddleware {
+	return &RecoveryMiddleware{r: r}
+}
+
+func (m *RecoveryMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	defer func() {
+		if v := recover(); v != nil {
+			// http.ErrAbortHandler aborts a response on purpose.
+			if v != http.ErrAbortHandler {
+				m.r.ReportPanic(r, v)
+			}
+			panic(v)
+		}
+	}()
+	next(w, r)
+}
@@ -0,0 +1,112 @@
+package report_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/report"
+	"github.com/ory/kratos/x"
+)
+
+func TestReporter(t *testing.T) {
+	type received struct {
+		auth string
+		body []byte
+	}
+	reports := make(chan received, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "/prefix/api/42/store/", r.URL.Path)
+		reports <- received{auth: r.Header.Get("X-Sentry-Auth"), body: body}
+	}))
+	defer ts.Close()
+
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeyErrorReportingDSN, strings.Replace(ts.URL, "://", "://public:secret@", 1)+"/prefix/42")
+	viper.Set(configuration.ViperKeyErrorReportingEnvironment, "testing")
+
+	next := func(t *testing.T) received {
+		select {
+		case r := <-reports:
+			return r
+		case <-time.After(time.Second * 5):
+			t.Fatal("the error was not reported")
+			return received{}
+		}
+	}
+
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest("POST", "/self-service/browser/flows/login/strategies/password?request=b7ba7d2c-a1a9-4b5e-9d1b-6d3f0d7b2f6e&token=secret", nil)
+		return r.WithContext(x.WithRequestID(r.Context(), "some-request-id"))
+	}
+
+	t.Run("case=reports server errors with sanitized flow context", func(t *testing.T) {
+		reg.ErrorReporter().Report(newRequest(), errors.WithStack(errors.New("identifier foo@example.org caused an error")))
+
+		r := next(t)
+		assert.Contains(t, r.auth, "sentry_key=public")
+		assert.Contains(t, r.auth, "sentry_secret=secret")
+
+		body := string(r.body)
+		assert.Equal(t, "identifier [REDACTED] caused an error", gjson.Get(body, "message").String(), body)
+		assert.Equal(t, "testing", gjson.Get(body, "environment").String(), body)
+		assert.Equal(t, "login", gjson.Get(body, "tags.flow").String(), body)
+		assert.Equal(t, "password", gjson.Get(body, "tags.method").String(), body)
+		assert.Equal(t, "b7ba7d2c-a1a9-4b5e-9d1b-6d3f0d7b2f6e", gjson.Get(body, "tags.flow_id").String(), body)
+		assert.Equal(t, "some-request-id", gjson.Get(body, "tags.request_id").String(), body)
+		assert.Equal(t, "/self-service/browser/flows/login/strategies/password", gjson.Get(body, "request.url").String(), body)
+		assert.NotContains(t, body, "token=secret")
+		assert.True(t, gjson.Get(body, "exception.values.0.stacktrace.frames.#").Int() > 0, body)
+	})
+
+	t.Run("case=reports panics", func(t *testing.T) {
+		handler := report.NewRecoveryMiddleware(reg.ErrorReporter())
+		assert.Panics(t, func() {
+			handler.ServeHTTP(httptest.NewRecorder(), newRequest(), func(http.ResponseWriter, *http.Request) {
+				panic("something went wrong")
+			})
+		})
+
+		body := string(next(t).body)
+		assert.Equal(t, "fatal", gjson.Get(body, "level").String(), body)
+		assert.Equal(t, "something went wrong", gjson.Get(body, "message").String(), body)
+	})
+
+	t.Run("case=does not report client errors", func(t *testing.T) {
+		reg.ErrorReporter().Report(newRequest(), errors.WithStack(herodot.ErrBadRequest))
+
+		select {
+		case r := <-reports:
+			t.Fatalf("the error must not be reported: %s", r.body)
+		case <-time.After(time.Millisecond * 500):
+		}
+	})
+
+	t.Run("case=does not report errors which are not sampled", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyErrorReportingSampleRate, 0)
+		defer viper.Set(configuration.ViperKeyErrorReportingSampleRate, 1)
+
+		reg.ErrorReporter().Report(newRequest(), errors.New("some error"))
+
+		select {
+		case r := <-reports:
+			t.Fatalf("the error must not be reported: %s", r.body)
+		case <-time.After(time.Millisecond * 500):
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package resilience
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type contextKey int
+
+const deferredKey contextKey = iota + 1
+
+type deferred struct {
+	sync.Mutex
+	tasks []func()
+}
+
+func (d *deferred) add(task func()) {
+	d.Lock()
+	defer d.Unlock()
+	d.tasks = append(d.tasks, task)
+}
+
+// WithDeferred returns a context which collects the async hooks executed with it, so that they only start when
+// RunDeferred is called after the flow completed.
+func WithDeferred(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deferredKey, new(deferred))
+}
+
+// RunDeferred starts the async hooks collected in the context. They run one after another in the background,
+// in the order in which they were executed. Calling RunDeferred again does nothing.
+func RunDeferred(ctx context.Context) {
+	d, ok := ctx.Value(deferredKey).(*deferred)
+	if !ok {
+		return
+	}
+
+	d.Lock()
+	tasks := d.tasks
+	d.tasks = nil
+	d.Unlock()
+
+	if len(tasks) == 0 {
+		return
+	}
+
+	go func() {
+		for _, task := range tasks {
+			task()
+		}
+	}()
+}
+
+// detachedContext keeps the values of its parent, for example the request ID, but is not canceled when the
+// request completed.
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	if key == deferredKey {
+		return nil
+	}
+	return c.parent.Value(key)
+}
+
+// discardWriter is the response writer of async hooks, the response was sent already when they run.
+type discardWriter struct {
+	h http.Header
+}
+
+func newDiscardWriter() *discardWriter {
+	return &discardWriter{h: http.Header{}}
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.h
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+// trackingWriter remembers whether a hook started writing the response, in which case it must not be retried.
+type trackingWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *trackingWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
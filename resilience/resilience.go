@@ -0,0 +1,185 @@
+// Package resilience runs self-service hooks with timeouts, retries, and circuit breakers. Non-critical hooks
+// are skipped for a while after they failed repeatedly, and asynchronous hooks run after the flow completed so
+// that they do not delay the response.
+package resilience
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	// Policy configures how a hook is executed.
+	Policy struct {
+		// Name identifies the hook in logs and its circuit breaker.
+		Name string
+
+		// Timeout cancels the context of every attempt after this duration. Zero disables the timeout.
+		Timeout time.Duration
+
+		// Retries is the number of additional attempts after a retryable failure.
+		Retries int
+
+		// Critical hooks fail the flow. Failures of other hooks are logged and ignored, and their circuit breaker
+		// skips them after repeated failures.
+		Critical bool
+
+		// Async runs the hook after the flow completed. Async hooks can not write the response.
+		Async bool
+	}
+
+	executorDependencies interface {
+		x.LoggingProvider
+	}
+	ExecutorProvider interface {
+		HookResilience() *Executor
+	}
+	Executor struct {
+		c configuration.Provider
+		d executorDependencies
+
+		sync.Mutex
+		breakers map[string]*breaker
+	}
+
+	// Func executes a hook.
+	Func func(w http.ResponseWriter, r *http.Request) error
+
+	breaker struct {
+		failures  int
+		openUntil time.Time
+	}
+)
+
+func NewExecutor(c configuration.Provider, d executorDependencies) *Executor {
+	return &Executor{c: c, d: d, breakers: map[string]*breaker{}}
+}
+
+// Execute runs the hook according to the policy. Async hooks are deferred until RunDeferred is called for the
+// request's context, or started right away if the context has no deferred hooks, see WithDeferred.
+func (e *Executor) Execute(w http.ResponseWriter, r *http.Request, p Policy, f Func) error {
+	if !p.Async {
+		return e.execute(w, r, p, f)
+	}
+
+	task := func() {
+		ctx := detach(r.Context())
+		_ = e.execute(newDiscardWriter(), r.Clone(ctx), p, f)
+	}
+	if d, ok := r.Context().Value(deferredKey).(*deferred); ok {
+		d.add(task)
+	} else {
+		go task()
+	}
+	return nil
+}
+
+func (e *Executor) execute(w http.ResponseWriter, r *http.Request, p Policy, f Func) error {
+	if !p.Critical && !e.allow(p.Name) {
+		x.ContextLogger(r.Context(), e.d.Logger()).
+			WithField("hook", p.Name).
+			Warn("Skipping a non-critical hook because its circuit breaker is open.")
+		return nil
+	}
+
+	tw := &trackingWriter{ResponseWriter: w}
+	backoff := e.c.SelfServiceHookRetryBackoff()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = e.attempt(tw, r, p, f); err == nil || attempt >= p.Retries || tw.written || !retryable(err) {
+			break
+		}
+
+		x.ContextLogger(r.Context(), e.d.Logger()).
+			WithError(err).
+			WithField("hook", p.Name).
+			WithField("attempt", attempt+1).
+			Warn("A hook failed and will be retried.")
+
+		if !wait(r.Context(), backoff<<uint(attempt)) {
+			err = errors.WithStack(r.Context().Err())
+			break
+		}
+	}
+
+	if p.Critical {
+		return err
+	}
+
+	e.record(p.Name, err)
+	if err != nil {
+		x.ContextLogger(r.Context(), e.d.Logger()).
+			WithError(err).
+			WithField("hook", p.Name).
+			Error("A non-critical hook failed, continuing without it.")
+	}
+	return nil
+}
+
+func (e *Executor) attempt(w http.ResponseWriter, r *http.Request, p Policy, f Func) error {
+	if p.Timeout <= 0 {
+		return f(w, r)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.Timeout)
+	defer cancel()
+	return f(w, r.WithContext(ctx))
+}
+
+func (e *Executor) allow(name string) bool {
+	e.Lock()
+	defer e.Unlock()
+	b, ok := e.breakers[name]
+	return !ok || time.Now().After(b.openUntil)
+}
+
+func (e *Executor) record(name string, err error) {
+	e.Lock()
+	defer e.Unlock()
+
+	if err == nil {
+		delete(e.breakers, name)
+		return
+	}
+
+	b, ok := e.breakers[name]
+	if !ok {
+		b = new(breaker)
+		e.breakers[name] = b
+	}
+
+	cb := e.c.SelfServiceHookCircuitBreaker()
+	b.failures++
+	if b.failures >= cb.FailureThreshold {
+		b.failures = 0
+		b.openUntil = time.Now().Add(cb.Cooldown)
+	}
+}
+
+// wait returns false if the context is done before the delay elapsed.
+func wait(ctx context.Context, delay time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// retryable returns false for errors which will not go away on their own, for example validation errors.
+func retryable(err error) bool {
+	if e, ok := errorsx.Cause(err).(interface{ StatusCode() int }); ok {
+		return e.StatusCode() >= http.StatusInternalServerError
+	}
+	return true
+}
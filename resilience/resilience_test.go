@@ -0,0 +1,134 @@
+package resilience_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/resilience"
+)
+
+func TestExecutor(t *testing.T) {
+	conf, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeySelfServiceHooksRetryBackoff, "1ms")
+	viper.Set(configuration.ViperKeySelfServiceHooksFailureThreshold, 2)
+	viper.Set(configuration.ViperKeySelfServiceHooksCooldown, "1h")
+
+	newRequest := func() *http.Request {
+		return httptest.NewRequest("POST", "/", nil)
+	}
+
+	// failing returns a hook which fails the first n calls with err and counts all calls.
+	failing := func(n int32, err error, calls *int32) resilience.Func {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			if atomic.AddInt32(calls, 1) <= n {
+				return err
+			}
+			return nil
+		}
+	}
+
+	t.Run("case=retries retryable failures", func(t *testing.T) {
+		var calls int32
+		e := resilience.NewExecutor(conf, reg)
+		p := resilience.Policy{Name: "retry", Retries: 2, Critical: true}
+		require.NoError(t, e.Execute(httptest.NewRecorder(), newRequest(), p, failing(2, errors.New("connection reset"), &calls)))
+		assert.EqualValues(t, 3, calls)
+	})
+
+	t.Run("case=fails after the last retry", func(t *testing.T) {
+		var calls int32
+		e := resilience.NewExecutor(conf, reg)
+		p := resilience.Policy{Name: "retry", Retries: 1, Critical: true}
+		require.Error(t, e.Execute(httptest.NewRecorder(), newRequest(), p, failing(5, errors.New("connection reset"), &calls)))
+		assert.EqualValues(t, 2, calls)
+	})
+
+	t.Run("case=does not retry client errors", func(t *testing.T) {
+		var calls int32
+		e := resilience.NewExecutor(conf, reg)
+		p := resilience.Policy{Name: "retry", Retries: 3, Critical: true}
+		require.Error(t, e.Execute(httptest.NewRecorder(), newRequest(), p, failing(5, herodot.ErrBadRequest, &calls)))
+		assert.EqualValues(t, 1, calls)
+	})
+
+	t.Run("case=does not retry hooks which wrote the response", func(t *testing.T) {
+		var calls int32
+		e := resilience.NewExecutor(conf, reg)
+		p := resilience.Policy{Name: "retry", Retries: 3, Critical: true}
+		require.Error(t, e.Execute(httptest.NewRecorder(), newRequest(), p, func(w http.ResponseWriter, r *http.Request) error {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusFound)
+			return errors.New("connection reset")
+		}))
+		assert.EqualValues(t, 1, calls)
+	})
+
+	t.Run("case=cancels slow attempts", func(t *testing.T) {
+		e := resilience.NewExecutor(conf, reg)
+		p := resilience.Policy{Name: "timeout", Timeout: time.Millisecond * 10, Critical: true}
+		err := e.Execute(httptest.NewRecorder(), newRequest(), p, func(w http.ResponseWriter, r *http.Request) error {
+			<-r.Context().Done()
+			return r.Context().Err()
+		})
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("case=opens the circuit breaker of non-critical hooks", func(t *testing.T) {
+		var calls int32
+		e := resilience.NewExecutor(conf, reg)
+		p := resilience.Policy{Name: "breaker"}
+		for k := 0; k < 4; k++ {
+			require.NoError(t, e.Execute(httptest.NewRecorder(), newRequest(), p, failing(5, errors.New("connection reset"), &calls)))
+		}
+		assert.EqualValues(t, 2, calls)
+
+		var other int32
+		require.NoError(t, e.Execute(httptest.NewRecorder(), newRequest(), resilience.Policy{Name: "other"}, failing(0, nil, &other)))
+		assert.EqualValues(t, 1, other)
+	})
+
+	t.Run("case=runs async hooks after the flow completed", func(t *testing.T) {
+		e := resilience.NewExecutor(conf, reg)
+		r := newRequest()
+		ctx, cancel := context.WithCancel(resilience.WithDeferred(r.Context()))
+		r = r.WithContext(ctx)
+
+		done := make(chan error, 1)
+		w := httptest.NewRecorder()
+		require.NoError(t, e.Execute(w, r, resilience.Policy{Name: "async", Async: true}, func(w http.ResponseWriter, r *http.Request) error {
+			w.WriteHeader(http.StatusTeapot)
+			done <- r.Context().Err()
+			return nil
+		}))
+
+		select {
+		case <-done:
+			t.Fatal("the async hook must not run before RunDeferred was called")
+		case <-time.After(time.Millisecond * 50):
+		}
+
+		resilience.RunDeferred(r.Context())
+		cancel()
+
+		select {
+		case err := <-done:
+			assert.NoError(t, err, "the context of async hooks must not be canceled with the request")
+		case <-time.After(time.Second):
+			t.Fatal("the async hook was not executed")
+		}
+		assert.Equal(t, http.StatusOK, w.Code, "async hooks must not write the response")
+	})
+}
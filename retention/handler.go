@@ -0,0 +1,66 @@
+package retention
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/ory/kratos/x"
+)
+
+const RetentionPlanPath = "/retention/plan"
+
+type (
+	handlerDependencies interface {
+		EnforcerProvider
+		x.WriterProvider
+	}
+	HandlerProvider interface {
+		RetentionHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+	}
+)
+
+func NewHandler(r handlerDependencies) *Handler {
+	return &Handler{r: r}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(RetentionPlanPath, h.plan)
+}
+
+// A list of retention actions.
+//
+// swagger:response retentionPlan
+// nolint:deadcode,unused
+type retentionPlanResponse struct {
+	// in: body
+	Body []Action
+}
+
+// swagger:route GET /retention/plan admin getRetentionPlan
+//
+// Get the actions of the next retention run
+//
+// Returns the identities the configured retention policies would notify or delete in the next cleanup run.
+// Nothing is changed, which makes this endpoint useful to review a policy before enabling it.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: retentionPlan
+//       500: genericError
+func (h *Handler) plan(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	actions, err := h.r.IdentityRetentionEnforcer().Plan(r.Context())
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, actions)
+}
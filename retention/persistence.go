@@ -0,0 +1,118 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		RetentionPersister() Persister
+	}
+	Persister interface {
+		// ListRetentionCandidates returns up to limit identities matched by the policy, oldest first. Identities
+		// created after cutoff are never matched. The inactive policy matches identities which did not sign in
+		// since cutoff.
+		ListRetentionCandidates(ctx context.Context, policy Policy, cutoff time.Time, limit int) ([]Candidate, error)
+
+		// MarkRetentionNotified records that the identity was notified about its deletion.
+		MarkRetentionNotified(ctx context.Context, identityID uuid.UUID, at time.Time) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+	session.Persister
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		create := func(t *testing.T, verified ...bool) *identity.Identity {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			for _, v := range verified {
+				a, err := identity.NewVerifiableEmailAddress(x.NewUUID().String()+"@ory.sh", i.ID, time.Hour)
+				require.NoError(t, err)
+				a.ExpiresAt = a.ExpiresAt.Round(time.Minute)
+				if v {
+					a.Verified = true
+					a.Status = identity.VerifiableAddressStatusCompleted
+				}
+				i.Addresses = append(i.Addresses, *a)
+			}
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+			return &i
+		}
+
+		// The cutoff lies in the future so that identities created by this test are old enough.
+		cutoff := time.Now().UTC().Add(time.Hour)
+		candidates := func(t *testing.T, policy Policy) map[uuid.UUID]Candidate {
+			cs, err := p.ListRetentionCandidates(context.Background(), policy, cutoff, 10000)
+			require.NoError(t, err)
+
+			ids := map[uuid.UUID]Candidate{}
+			for _, c := range cs {
+				ids[c.IdentityID] = c
+			}
+			return ids
+		}
+
+		t.Run("policy=unverified", func(t *testing.T) {
+			unverified := create(t, false)
+			verified := create(t, false, true)
+			withoutAddresses := create(t)
+
+			cs := candidates(t, PolicyUnverified)
+			assert.Contains(t, cs, unverified.ID)
+			assert.NotContains(t, cs, verified.ID)
+			assert.NotContains(t, cs, withoutAddresses.ID)
+
+			cs, err := p.ListRetentionCandidates(context.Background(), PolicyUnverified, time.Now().UTC().Add(-time.Hour), 10000)
+			require.NoError(t, err)
+			for _, c := range cs {
+				assert.NotEqual(t, unverified.ID, c.IdentityID, "identities created after the cutoff must not be matched")
+			}
+		})
+
+		t.Run("policy=inactive", func(t *testing.T) {
+			inactive := create(t)
+			active := create(t)
+
+			var s session.Session
+			require.NoError(t, faker.FakeData(&s))
+			s.Identity = active
+			s.IdentityID = active.ID
+			s.AuthenticatedAt = cutoff.Add(time.Minute)
+			require.NoError(t, p.CreateSession(context.Background(), &s))
+
+			cs := candidates(t, PolicyInactive)
+			assert.Contains(t, cs, inactive.ID)
+			assert.NotContains(t, cs, active.ID)
+			assert.False(t, cs[inactive.ID].NotifiedAt.Valid)
+
+			t.Run("case=mark notified", func(t *testing.T) {
+				now := time.Now().UTC().Round(time.Second)
+				require.NoError(t, p.MarkRetentionNotified(context.Background(), inactive.ID, now.Add(-time.Minute)))
+				require.NoError(t, p.MarkRetentionNotified(context.Background(), inactive.ID, now))
+
+				c := candidates(t, PolicyInactive)[inactive.ID]
+				require.True(t, c.NotifiedAt.Valid)
+				assert.Equal(t, now.Unix(), c.NotifiedAt.Time.Unix())
+			})
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/x"
+)
+
+// batchSize is the maximum number of identities each policy handles per run.
+const batchSize = 100
+
+const (
+	// PolicyUnverified deletes identities which have addresses but did not verify any of them.
+	PolicyUnverified Policy = "unverified"
+	// PolicyInactive deletes identities which did not sign in for a long time.
+	PolicyInactive Policy = "inactive"
+
+	ActionNotify ActionType = "notify"
+	ActionDelete ActionType = "delete"
+)
+
+type (
+	// Policy is a rule which decides which identities are stale.
+	Policy string
+
+	// ActionType is what a retention policy does with an identity.
+	ActionType string
+
+	// Candidate is an identity matched by a retention policy.
+	Candidate struct {
+		IdentityID uuid.UUID `db:"id"`
+
+		// NotifiedAt is the time the identity was notified about its deletion.
+		NotifiedAt sql.NullTime `db:"notified_at"`
+	}
+
+	// Action is a step a retention policy takes for an identity.
+	//
+	// swagger:model retentionAction
+	Action struct {
+		// required: true
+		IdentityID uuid.UUID `json:"identity_id"`
+
+		// Policy is the retention policy which matched the identity, either "unverified" or "inactive".
+		//
+		// required: true
+		Policy Policy `json:"policy"`
+
+		// Type is either "notify" or "delete".
+		//
+		// required: true
+		Type ActionType `json:"type"`
+
+		// DeleteAt is the time the identity will be deleted.
+		//
+		// required: true
+		DeleteAt time.Time `json:"delete_at"`
+	}
+
+	enforcerDependencies interface {
+		PersistenceProvider
+		identity.PrivilegedPoolProvider
+		identity.ManagementProvider
+		notification.SenderProvider
+		x.LoggingProvider
+	}
+	EnforcerProvider interface {
+		IdentityRetentionEnforcer() *Enforcer
+	}
+	// Enforcer applies the configured retention policies.
+	Enforcer struct {
+		r enforcerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewEnforcer(r enforcerDependencies, c configuration.Provider) *Enforcer {
+	return &Enforcer{r: r, c: c}
+}
+
+// Plan returns the actions the next run of the retention policies would take.
+func (e *Enforcer) Plan(ctx context.Context) ([]Action, error) {
+	return e.plan(ctx, e.c.IdentityRetention(), time.Now().UTC())
+}
+
+func (e *Enforcer) plan(ctx context.Context, conf *configuration.IdentityRetentionConfig, now time.Time) ([]Action, error) {
+	actions := []Action{}
+	for _, p := range []struct {
+		policy Policy
+		after  time.Duration
+	}{
+		{policy: PolicyUnverified, after: conf.UnverifiedAfter},
+		{policy: PolicyInactive, after: conf.InactiveAfter},
+	} {
+		if p.after <= 0 {
+			continue
+		}
+
+		// Unverified identities have no address they could be notified at.
+		var notifyBefore time.Duration
+		if p.policy == PolicyInactive {
+			notifyBefore = conf.NotifyBefore
+			if notifyBefore >= p.after {
+				return nil, errors.Errorf("the retention notice period %s must be shorter than the %s policy duration %s", notifyBefore, p.policy, p.after)
+			}
+		}
+
+		cutoff := now.Add(-p.after)
+		cs, err := e.r.RetentionPersister().ListRetentionCandidates(ctx, p.policy, cutoff, batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range cs {
+			a := Action{IdentityID: c.IdentityID, Policy: p.policy, Type: ActionDelete, DeleteAt: now}
+			if notifyBefore > 0 {
+				// A notice sent before the cutoff belongs to an earlier period of inactivity.
+				if !c.NotifiedAt.Valid || c.NotifiedAt.Time.Before(cutoff) {
+					a.Type = ActionNotify
+					a.DeleteAt = now.Add(notifyBefore)
+				} else if deleteAt := c.NotifiedAt.Time.Add(notifyBefore); deleteAt.After(now) {
+					// The identity was notified and the notice period has not passed yet.
+					continue
+				}
+			}
+			actions = append(actions, a)
+		}
+	}
+
+	return actions, nil
+}
+
+// Enforce notifies and deletes the identities matched by the retention policies. In dry-run mode, the
+// actions are only logged.
+func (e *Enforcer) Enforce(ctx context.Context) error {
+	conf := e.c.IdentityRetention()
+	now := time.Now().UTC()
+
+	actions, err := e.plan(ctx, conf, now)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range actions {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		l := e.r.Logger().
+			WithField("audit", "identity_retention").
+			WithField("identity_id", a.IdentityID).
+			WithField("policy", a.Policy).
+			WithField("delete_at", a.DeleteAt).
+			WithField("dry_run", conf.DryRun)
+
+		if err := e.execute(ctx, a, conf.DryRun, now, l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Enforcer) execute(ctx context.Context, a Action, dryRun bool, now time.Time, l logrus.FieldLogger) error {
+	switch a.Type {
+	case ActionNotify:
+		if dryRun {
+			l.Info("Would notify identity about its deletion by the retention policy.")
+			return nil
+		}
+
+		i, err := e.r.PrivilegedIdentityPool().GetIdentity(ctx, a.IdentityID)
+		if err != nil {
+			return err
+		}
+		if err := e.r.NotificationSender().NotifyScheduledDeletion(ctx, i, a.DeleteAt); err != nil {
+			return err
+		}
+		if err := e.r.RetentionPersister().MarkRetentionNotified(ctx, a.IdentityID, now); err != nil {
+			return err
+		}
+		l.Info("Notified identity about its deletion by the retention policy.")
+	case ActionDelete:
+		if dryRun {
+			l.Info("Would delete identity because of the retention policy.")
+			return nil
+		}
+
+		if err := e.r.IdentityManager().Delete(ctx, a.IdentityID); err != nil {
+			return err
+		}
+		l.Info("Deleted identity because of the retention policy.")
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package retention_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/driver"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/retention"
+	"github.com/ory/kratos/x"
+)
+
+func TestEnforcer(t *testing.T) {
+	setup := func(t *testing.T) *driver.RegistryDefault {
+		_, reg := internal.NewRegistryDefault(t)
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+		viper.Set(configuration.ViperKeyCourierSMTPURL, "smtp://foo@bar@dev.null/")
+		return reg
+	}
+
+	// create adds an identity with one email address which was created the given duration ago.
+	create := func(t *testing.T, reg *driver.RegistryDefault, age time.Duration, verified bool) *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		a, err := identity.NewVerifiableEmailAddress(x.NewUUID().String()+"@ory.sh", i.ID, time.Hour)
+		require.NoError(t, err)
+		a.Verified = verified
+		i.Addresses = []identity.VerifiableAddress{*a}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		require.NoError(t, reg.Persister().GetConnection(context.Background()).
+			RawQuery("UPDATE identities SET created_at = ? WHERE id = ?", time.Now().UTC().Add(-age), i.ID).Exec())
+		return i
+	}
+
+	exists := func(t *testing.T, reg *driver.RegistryDefault, i *identity.Identity) bool {
+		_, err := reg.PrivilegedIdentityPool().GetIdentity(context.Background(), i.ID)
+		return err == nil
+	}
+
+	queued := func(t *testing.T, reg *driver.RegistryDefault) []courier.Message {
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 10)
+		if errors.Cause(err) == courier.ErrQueueEmpty {
+			return nil
+		}
+		require.NoError(t, err)
+		for _, m := range messages {
+			require.NoError(t, reg.CourierPersister().SetMessageStatus(context.Background(), m.ID, courier.MessageStatusSent))
+		}
+		return messages
+	}
+
+	t.Run("case=does nothing if no policy is configured", func(t *testing.T) {
+		reg := setup(t)
+		i := create(t, reg, time.Hour*24*365*10, false)
+
+		actions, err := reg.IdentityRetentionEnforcer().Plan(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, actions)
+
+		require.NoError(t, reg.IdentityRetentionEnforcer().Enforce(context.Background()))
+		assert.True(t, exists(t, reg, i))
+	})
+
+	t.Run("policy=unverified", func(t *testing.T) {
+		reg := setup(t)
+		viper.Set(configuration.ViperKeyIdentityRetentionUnverifiedAfter, "720h")
+		viper.Set(configuration.ViperKeyIdentityRetentionNotifyBefore, "168h")
+
+		stale := create(t, reg, time.Hour*24*31, false)
+		recent := create(t, reg, time.Hour*24, false)
+		verified := create(t, reg, time.Hour*24*31, true)
+
+		actions, err := reg.IdentityRetentionEnforcer().Plan(context.Background())
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		assert.Equal(t, stale.ID, actions[0].IdentityID)
+		assert.Equal(t, PolicyUnverified, actions[0].Policy)
+		assert.Equal(t, ActionDelete, actions[0].Type, "unverified identities can not be notified")
+
+		t.Run("case=dry run", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyIdentityRetentionDryRun, true)
+			defer viper.Set(configuration.ViperKeyIdentityRetentionDryRun, false)
+
+			require.NoError(t, reg.IdentityRetentionEnforcer().Enforce(context.Background()))
+			assert.True(t, exists(t, reg, stale))
+		})
+
+		require.NoError(t, reg.IdentityRetentionEnforcer().Enforce(context.Background()))
+		assert.False(t, exists(t, reg, stale))
+		assert.True(t, exists(t, reg, recent))
+		assert.True(t, exists(t, reg, verified))
+	})
+
+	t.Run("policy=inactive", func(t *testing.T) {
+		reg := setup(t)
+		viper.Set(configuration.ViperKeyIdentityRetentionInactiveAfter, "24h")
+		viper.Set(configuration.ViperKeyIdentityRetentionNotifyBefore, "1h")
+
+		i := create(t, reg, time.Hour*48, true)
+		setNotifiedAt := func(t *testing.T, ago time.Duration) {
+			require.NoError(t, reg.Persister().GetConnection(context.Background()).
+				RawQuery("UPDATE identity_retention_notices SET notified_at = ? WHERE identity_id = ?", time.Now().UTC().Add(-ago), i.ID).Exec())
+		}
+
+		t.Run("case=notifies before deletion", func(t *testing.T) {
+			actions, err := reg.IdentityRetentionEnforcer().Plan(context.Background())
+			require.NoError(t, err)
+			require.Len(t, actions, 1)
+			assert.Equal(t, ActionNotify, actions[0].Type)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), actions[0].DeleteAt, time.Minute)
+
+			require.NoError(t, reg.IdentityRetentionEnforcer().Enforce(context.Background()))
+			assert.True(t, exists(t, reg, i))
+			messages := queued(t, reg)
+			require.Len(t, messages, 1)
+			assert.Equal(t, i.Addresses[0].Value, messages[0].Recipient)
+		})
+
+		t.Run("case=waits for the notice period", func(t *testing.T) {
+			actions, err := reg.IdentityRetentionEnforcer().Plan(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, actions)
+		})
+
+		t.Run("case=notifies again after a new period of inactivity", func(t *testing.T) {
+			setNotifiedAt(t, time.Hour*25)
+
+			actions, err := reg.IdentityRetentionEnforcer().Plan(context.Background())
+			require.NoError(t, err)
+			require.Len(t, actions, 1)
+			assert.Equal(t, ActionNotify, actions[0].Type)
+		})
+
+		t.Run("case=deletes after the notice period", func(t *testing.T) {
+			setNotifiedAt(t, time.Hour*2)
+
+			require.NoError(t, reg.IdentityRetentionEnforcer().Enforce(context.Background()))
+			assert.False(t, exists(t, reg, i))
+			assert.Empty(t, queued(t, reg))
+		})
+	})
+
+	t.Run("case=rejects a notice period longer than the policy", func(t *testing.T) {
+		reg := setup(t)
+		viper.Set(configuration.ViperKeyIdentityRetentionInactiveAfter, "24h")
+		viper.Set(configuration.ViperKeyIdentityRetentionNotifyBefore, "48h")
+
+		_, err := reg.IdentityRetentionEnforcer().Plan(context.Background())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,267 @@
+package schedule
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+// ScheduledActionsPath is appended to the path of an identity, see identity.IdentitiesPath.
+const ScheduledActionsPath = "scheduled-actions"
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		identity.PoolProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		ScheduledActionHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(identity.IdentitiesPath+"/:id/"+ScheduledActionsPath, h.list)
+	admin.POST(identity.IdentitiesPath+"/:id/"+ScheduledActionsPath, h.create)
+	admin.GET(identity.IdentitiesPath+"/:id/"+ScheduledActionsPath+"/:action_id", h.get)
+	admin.DELETE(identity.IdentitiesPath+"/:id/"+ScheduledActionsPath+"/:action_id", h.delete)
+}
+
+// A single scheduled action.
+//
+// swagger:response scheduledIdentityAction
+// nolint:deadcode,unused
+type actionResponse struct {
+	// in: body
+	Body *Action
+}
+
+// A list of scheduled actions.
+//
+// swagger:response scheduledIdentityActions
+// nolint:deadcode,unused
+type actionsResponse struct {
+	// in: body
+	Body []Action
+}
+
+// swagger:model scheduleIdentityAction
+type ScheduleAction struct {
+	// Type is one of "deactivate", "activate", "set_trait", "remove_trait", and "delete".
+	//
+	// required: true
+	Type ActionType `json:"type"`
+
+	// ExecuteAt is the time the action is executed. Actions which are due are executed in the interval
+	// configured at `serve.scheduler.interval`.
+	//
+	// required: true
+	ExecuteAt time.Time `json:"execute_at"`
+
+	// Trait is the path of the trait which is set or removed, for example `plan` or `address.city`. It is
+	// required by "set_trait" and "remove_trait".
+	Trait string `json:"trait"`
+
+	// Value is the JSON value the trait is set to. It is required by "set_trait".
+	Value json.RawMessage `json:"value"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listScheduledIdentityActions
+type listParameters struct {
+	// ID is the ID of the identity.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters scheduleIdentityAction
+type createParameters struct {
+	// ID is the ID of the identity.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	Body ScheduleAction
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getScheduledIdentityAction cancelScheduledIdentityAction
+type actionParameters struct {
+	// ID is the ID of the identity.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// ActionID is the ID of the scheduled action.
+	//
+	// required: true
+	// in: path
+	ActionID string `json:"action_id"`
+}
+
+// swagger:route GET /identities/{id}/scheduled-actions admin listScheduledIdentityActions
+//
+// List the scheduled actions of an identity
+//
+// Returns pending, completed, and failed actions, the next one first.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: scheduledIdentityActions
+//       500: genericError
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	as, err := h.r.ScheduledActionPersister().ListScheduledActions(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, as)
+}
+
+// swagger:route POST /identities/{id}/scheduled-actions admin scheduleIdentityAction
+//
+// Schedule an action for an identity
+//
+// Schedules a change of the identity, for example to deactivate a contractor at the end of their contract or to
+// remove a trial trait when the trial ends. Deactivated identities can not sign in and their sessions end. The
+// action is executed by a background worker once it is due, and is tried again with an increasing delay if it
+// fails. Every execution is written to the audit log.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: scheduledIdentityAction
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var body ScheduleAction
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&body)); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	i, err := h.r.IdentityPool().GetIdentity(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	a, err := NewAction(i.ID, body.Type, body.ExecuteAt, body.Trait, body.Value)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.ScheduledActionPersister().CreateScheduledAction(r.Context(), a); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "identity_scheduled_action").
+		WithField("action_id", a.ID).
+		WithField("identity_id", a.IdentityID).
+		WithField("type", a.Type).
+		WithField("execute_at", a.ExecuteAt).
+		Info("An identity action was scheduled.")
+	h.r.Writer().WriteCreated(w, r,
+		urlx.AppendPaths(h.c.SelfAdminURL(), identity.IdentitiesPath, i.ID.String(), ScheduledActionsPath, a.ID.String()).String(),
+		a,
+	)
+}
+
+// swagger:route GET /identities/{id}/scheduled-actions/{action_id} admin getScheduledIdentityAction
+//
+// Get a scheduled action of an identity
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: scheduledIdentityAction
+//       404: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	a, err := h.r.ScheduledActionPersister().GetScheduledAction(r.Context(), x.ParseUUID(ps.ByName("action_id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if a.IdentityID != x.ParseUUID(ps.ByName("id")) {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("The scheduled action does not belong to this identity.")))
+		return
+	}
+
+	h.r.Writer().Write(w, r, a)
+}
+
+// swagger:route DELETE /identities/{id}/scheduled-actions/{action_id} admin cancelScheduledIdentityAction
+//
+// Cancel a scheduled action of an identity
+//
+// Only pending actions can be canceled.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	identityID, id := x.ParseUUID(ps.ByName("id")), x.ParseUUID(ps.ByName("action_id"))
+	if err := h.r.ScheduledActionPersister().DeleteScheduledAction(r.Context(), identityID, id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "identity_scheduled_action").
+		WithField("action_id", id).
+		WithField("identity_id", identityID).
+		Info("A scheduled identity action was canceled.")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,171 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		ScheduledActionPersister() Persister
+	}
+	Persister interface {
+		CreateScheduledAction(ctx context.Context, a *Action) error
+
+		GetScheduledAction(ctx context.Context, id uuid.UUID) (*Action, error)
+
+		// ListScheduledActions returns the scheduled actions of the identity, the next one first.
+		ListScheduledActions(ctx context.Context, identityID uuid.UUID) ([]Action, error)
+
+		// DeleteScheduledAction cancels a pending action of the identity.
+		DeleteScheduledAction(ctx context.Context, identityID, id uuid.UUID) error
+
+		// ClaimScheduledActions marks up to limit pending actions which are due at now as running and returns them,
+		// the earliest first. Actions which are running since before staleBefore are claimed again. An action is
+		// only claimed by one caller at a time.
+		ClaimScheduledActions(ctx context.Context, now, staleBefore time.Time, limit int) ([]Action, error)
+
+		// UpdateScheduledAction stores the state, the error, and the times of the action.
+		UpdateScheduledAction(ctx context.Context, a *Action) error
+
+		// DeactivateIdentity marks the identity as deactivated. Deactivating an identity twice is not an error.
+		DeactivateIdentity(ctx context.Context, d *Deactivation) error
+
+		// ActivateIdentity reverts DeactivateIdentity.
+		ActivateIdentity(ctx context.Context, identityID uuid.UUID) error
+
+		IsIdentityDeactivated(ctx context.Context, identityID uuid.UUID) (bool, error)
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		var i identity.Identity
+		require.NoError(t, faker.FakeData(&i))
+		require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+		now := time.Now().UTC().Round(time.Second)
+		schedule := func(t *testing.T, typ ActionType, at time.Time, trait string, value json.RawMessage) *Action {
+			a, err := NewAction(i.ID, typ, at, trait, value)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateScheduledAction(context.Background(), a))
+			return a
+		}
+
+		later := schedule(t, ActionDeactivate, now.Add(time.Hour), "", nil)
+		due := schedule(t, ActionSetTrait, now.Add(-time.Minute), "plan", json.RawMessage(`"free"`))
+
+		t.Run("case=get and list", func(t *testing.T) {
+			_, err := p.GetScheduledAction(context.Background(), x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+
+			actual, err := p.GetScheduledAction(context.Background(), due.ID)
+			require.NoError(t, err)
+			assert.Equal(t, ActionSetTrait, actual.Type)
+			assert.Equal(t, "plan", actual.Trait)
+			assert.JSONEq(t, `"free"`, string(actual.Value))
+			assert.Equal(t, StatePending, actual.State)
+
+			actual, err = p.GetScheduledAction(context.Background(), later.ID)
+			require.NoError(t, err)
+			assert.Empty(t, actual.Value)
+
+			as, err := p.ListScheduledActions(context.Background(), i.ID)
+			require.NoError(t, err)
+			require.Len(t, as, 2)
+			assert.Equal(t, due.ID, as[0].ID)
+			assert.Equal(t, later.ID, as[1].ID)
+		})
+
+		t.Run("case=claim", func(t *testing.T) {
+			claimed, err := p.ClaimScheduledActions(context.Background(), now, now.Add(-time.Hour), 10)
+			require.NoError(t, err)
+			require.Len(t, claimed, 1)
+			assert.Equal(t, due.ID, claimed[0].ID)
+			assert.Equal(t, StateRunning, claimed[0].State)
+			assert.Equal(t, 1, claimed[0].Attempts)
+
+			claimed, err = p.ClaimScheduledActions(context.Background(), now, now.Add(-time.Hour), 10)
+			require.NoError(t, err)
+			assert.Empty(t, claimed, "running actions are not claimed twice")
+
+			claimed, err = p.ClaimScheduledActions(context.Background(), now, now.Add(time.Hour), 10)
+			require.NoError(t, err)
+			require.Len(t, claimed, 1, "stale actions are claimed again")
+			assert.Equal(t, 2, claimed[0].Attempts)
+
+			a := claimed[0]
+			a.State = StateCompleted
+			a.ExecutedAt = &now
+			require.NoError(t, p.UpdateScheduledAction(context.Background(), &a))
+
+			actual, err := p.GetScheduledAction(context.Background(), due.ID)
+			require.NoError(t, err)
+			assert.Equal(t, StateCompleted, actual.State)
+			require.NotNil(t, actual.ExecutedAt)
+
+			claimed, err = p.ClaimScheduledActions(context.Background(), now, now.Add(time.Hour), 10)
+			require.NoError(t, err)
+			assert.Empty(t, claimed)
+		})
+
+		t.Run("case=delete", func(t *testing.T) {
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteScheduledAction(context.Background(), i.ID, due.ID)), "completed actions can not be canceled")
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteScheduledAction(context.Background(), x.NewUUID(), later.ID)))
+			require.NoError(t, p.DeleteScheduledAction(context.Background(), i.ID, later.ID))
+
+			as, err := p.ListScheduledActions(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.Len(t, as, 1)
+		})
+
+		t.Run("case=deactivate", func(t *testing.T) {
+			deactivated, err := p.IsIdentityDeactivated(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.False(t, deactivated)
+
+			for k := 0; k < 2; k++ {
+				require.NoError(t, p.DeactivateIdentity(context.Background(), &Deactivation{IdentityID: i.ID, ActionID: later.ID, CreatedAt: now}))
+			}
+
+			deactivated, err = p.IsIdentityDeactivated(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.True(t, deactivated)
+
+			require.NoError(t, p.ActivateIdentity(context.Background(), i.ID))
+			require.NoError(t, p.ActivateIdentity(context.Background(), i.ID))
+
+			deactivated, err = p.IsIdentityDeactivated(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.False(t, deactivated)
+		})
+
+		t.Run("case=actions are deleted with the identity", func(t *testing.T) {
+			require.NoError(t, p.DeleteIdentity(context.Background(), i.ID))
+
+			as, err := p.ListScheduledActions(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.Empty(t, as)
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package schedule
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/tidwall/sjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/persistence/aliases"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// batchSize is the maximum number of actions claimed at once.
+	batchSize = 100
+
+	// maxAttempts is the number of times an action is tried before it fails for good.
+	maxAttempts = 5
+
+	// lease is the time after which an action which is still running is assumed to belong to a worker which
+	// stopped, and is claimed again.
+	lease = 10 * time.Minute
+)
+
+const (
+	// ActionDeactivate keeps the identity from signing in and ends its sessions.
+	ActionDeactivate ActionType = "deactivate"
+	// ActionActivate reverts ActionDeactivate.
+	ActionActivate ActionType = "activate"
+	// ActionSetTrait sets the trait at the action's path to the action's value.
+	ActionSetTrait ActionType = "set_trait"
+	// ActionRemoveTrait removes the trait at the action's path.
+	ActionRemoveTrait ActionType = "remove_trait"
+	// ActionDelete deletes the identity.
+	ActionDelete ActionType = "delete"
+
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+)
+
+var ErrIdentityDeactivated = herodot.ErrForbidden.
+	WithError("the identity is deactivated").
+	WithReason("Your account has been deactivated. Please contact an administrator.").
+	WithDetail(errorx.DetailErrorID, form.ErrorIDIdentityDeactivated)
+
+type (
+	// ActionType is what a scheduled action does with the identity.
+	ActionType string
+
+	// State is the execution state of a scheduled action.
+	State string
+
+	// TraitValue is the JSON value a scheduled action sets a trait to.
+	TraitValue json.RawMessage
+
+	// Action is a change of an identity which is executed at a given time, for example the deactivation of a
+	// contractor at the end of their contract.
+	//
+	// swagger:model scheduledIdentityAction
+	Action struct {
+		// required: true
+		ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+		// required: true
+		IdentityID uuid.UUID `json:"identity_id" faker:"uuid" db:"identity_id"`
+
+		// Type is one of "deactivate", "activate", "set_trait", "remove_trait", and "delete".
+		//
+		// required: true
+		Type ActionType `json:"type" db:"type"`
+
+		// Trait is the path of the trait which is set or removed, for example `plan` or `address.city`.
+		Trait string `json:"trait,omitempty" db:"trait"`
+
+		// Value is the value the trait is set to.
+		Value TraitValue `json:"value,omitempty" faker:"-" db:"value"`
+
+		// ExecuteAt is the time (UTC) the action is executed. After a failed attempt, it is the time of the next
+		// attempt.
+		//
+		// required: true
+		ExecuteAt time.Time `json:"execute_at" faker:"time_type" db:"execute_at"`
+
+		// State is one of "pending", "running", "completed", and "failed".
+		//
+		// required: true
+		State State `json:"state" db:"state"`
+
+		// Attempts is the number of times the action was tried.
+		//
+		// required: true
+		Attempts int `json:"attempts" db:"attempts"`
+
+		// LastError is the error of the last failed attempt.
+		LastError string `json:"last_error,omitempty" db:"last_error"`
+
+		// ExecutedAt is the time (UTC) the action completed.
+		ExecutedAt *time.Time `json:"executed_at,omitempty" faker:"-" db:"executed_at"`
+
+		// CreatedAt is the time (UTC) the action was scheduled.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+
+	// Deactivation records that an identity is deactivated.
+	Deactivation struct {
+		IdentityID uuid.UUID `db:"identity_id"`
+
+		// ActionID is the ID of the scheduled action which deactivated the identity.
+		ActionID uuid.UUID `db:"action_id"`
+
+		CreatedAt time.Time `db:"created_at"`
+	}
+
+	schedulerDependencies interface {
+		PersistenceProvider
+		identity.PrivilegedPoolProvider
+		identity.ManagementProvider
+		session.PersistenceProvider
+		x.LoggingProvider
+	}
+	SchedulerProvider interface {
+		IdentityScheduler() *Scheduler
+	}
+	// Scheduler executes the scheduled actions which are due and keeps deactivated identities from signing in.
+	Scheduler struct {
+		r schedulerDependencies
+		c configuration.Provider
+	}
+)
+
+func (a Action) TableName() string {
+	return "identity_scheduled_actions"
+}
+
+func (d Deactivation) TableName() string {
+	return "identity_deactivations"
+}
+
+func (v *TraitValue) Scan(value interface{}) error {
+	if err := aliases.JSONScan(v, value); err != nil {
+		return err
+	}
+	if string(*v) == "null" {
+		*v = nil
+	}
+	return nil
+}
+
+func (v *TraitValue) Value() (driver.Value, error) {
+	return aliases.JSONValue(v)
+}
+
+// MarshalJSON returns v as the JSON encoding of v.
+func (v TraitValue) MarshalJSON() ([]byte, error) {
+	if len(v) == 0 {
+		return []byte("null"), nil
+	}
+	return v, nil
+}
+
+// UnmarshalJSON sets *v to a copy of data.
+func (v *TraitValue) UnmarshalJSON(data []byte) error {
+	if v == nil {
+		return errors.New("schedule.TraitValue: UnmarshalJSON on nil pointer")
+	}
+	*v = append((*v)[0:0], data...)
+	return nil
+}
+
+// NewAction returns a pending action of the given type. The trait is required by ActionSetTrait and
+// ActionRemoveTrait, the value only by ActionSetTrait.
+func NewAction(identityID uuid.UUID, t ActionType, executeAt time.Time, trait string, value json.RawMessage) (*Action, error) {
+	switch t {
+	case ActionDeactivate, ActionActivate, ActionDelete:
+		if len(trait) > 0 || len(value) > 0 {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Actions of type "%s" have no trait and no value.`, t))
+		}
+	case ActionSetTrait:
+		if len(value) == 0 || !json.Valid(value) {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The value must be set to the JSON value of the trait."))
+		}
+		fallthrough
+	case ActionRemoveTrait:
+		if len(trait) == 0 || strings.ContainsAny(trait, "*?#|@") {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The trait "%s" is invalid, it must be a path like "plan" or "address.city".`, trait))
+		}
+		if t == ActionRemoveTrait && len(value) > 0 {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReason(`Actions of type "remove_trait" have no value.`))
+		}
+	default:
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The action type "%s" is unknown, it must be one of "deactivate", "activate", "set_trait", "remove_trait", and "delete".`, t))
+	}
+
+	if executeAt.IsZero() {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The time the action is executed at must be set."))
+	}
+
+	now := time.Now().UTC().Round(time.Second)
+	return &Action{
+		ID:         x.NewUUID(),
+		IdentityID: identityID,
+		Type:       t,
+		Trait:      trait,
+		Value:      TraitValue(value),
+		ExecuteAt:  executeAt.UTC(),
+		State:      StatePending,
+		CreatedAt:  now,
+	}, nil
+}
+
+func NewScheduler(r schedulerDependencies, c configuration.Provider) *Scheduler {
+	return &Scheduler{r: r, c: c}
+}
+
+// Run executes the actions which are due. An action which fails is tried again later with an increasing delay
+// until it failed maxAttempts times.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		actions, err := s.r.ScheduledActionPersister().ClaimScheduledActions(ctx, now, now.Add(-lease), batchSize)
+		if err != nil {
+			return err
+		}
+
+		for k := range actions {
+			if err := s.finish(ctx, &actions[k], s.execute(ctx, &actions[k])); err != nil {
+				return err
+			}
+		}
+
+		if len(actions) < batchSize {
+			return nil
+		}
+	}
+}
+
+// CheckLogin returns ErrIdentityDeactivated if the identity is deactivated.
+func (s *Scheduler) CheckLogin(ctx context.Context, i *identity.Identity) error {
+	deactivated, err := s.r.ScheduledActionPersister().IsIdentityDeactivated(ctx, i.ID)
+	if err != nil {
+		return err
+	}
+
+	if deactivated {
+		return errors.WithStack(ErrIdentityDeactivated)
+	}
+	return nil
+}
+
+func (s *Scheduler) execute(ctx context.Context, a *Action) error {
+	switch a.Type {
+	case ActionDeactivate:
+		if err := s.r.ScheduledActionPersister().DeactivateIdentity(ctx, &Deactivation{
+			IdentityID: a.IdentityID,
+			ActionID:   a.ID,
+			CreatedAt:  time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+		return s.r.SessionPersister().DeleteSessionsFor(ctx, a.IdentityID)
+	case ActionActivate:
+		return s.r.ScheduledActionPersister().ActivateIdentity(ctx, a.IdentityID)
+	case ActionSetTrait, ActionRemoveTrait:
+		i, err := s.r.PrivilegedIdentityPool().GetIdentity(ctx, a.IdentityID)
+		if err != nil {
+			return err
+		}
+
+		var traits []byte
+		if a.Type == ActionSetTrait {
+			traits, err = sjson.SetRawBytes(i.Traits, a.Trait, a.Value)
+		} else {
+			traits, err = sjson.DeleteBytes(i.Traits, a.Trait)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return s.r.IdentityManager().UpdateTraits(ctx, a.IdentityID, identity.Traits(traits), identity.ManagerAllowWriteProtectedTraits, identity.ManagerSkipWriteGuard)
+	case ActionDelete:
+		return s.r.IdentityManager().Delete(ctx, a.IdentityID)
+	}
+	return errors.Errorf("unknown scheduled action type: %s", a.Type)
+}
+
+// finish records the outcome of an attempt to execute the action.
+func (s *Scheduler) finish(ctx context.Context, a *Action, err error) error {
+	l := s.r.Logger().
+		WithField("audit", "identity_scheduled_action").
+		WithField("action_id", a.ID).
+		WithField("identity_id", a.IdentityID).
+		WithField("type", a.Type).
+		WithField("attempts", a.Attempts)
+	if len(a.Trait) > 0 {
+		l = l.WithField("trait", a.Trait)
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		a.State = StateCompleted
+		a.LastError = ""
+		a.ExecutedAt = &now
+		l.Info("Executed a scheduled identity action.")
+	case a.Attempts >= maxAttempts:
+		a.State = StateFailed
+		a.LastError = err.Error()
+		l.WithError(err).Error("A scheduled identity action failed and will not be tried again.")
+	default:
+		a.State = StatePending
+		a.LastError = err.Error()
+		a.ExecuteAt = now.Add(backoff(a.Attempts))
+		l.WithError(err).WithField("execute_at", a.ExecuteAt).Warn("A scheduled identity action failed and will be tried again.")
+	}
+
+	if err := s.r.ScheduledActionPersister().UpdateScheduledAction(ctx, a); err != nil {
+		// Deleting an identity deletes its scheduled actions, including the one which deleted it.
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// backoff returns the time to wait before the next attempt: one minute after the first failed attempt, four
+// after the second, and so on.
+func backoff(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * time.Minute
+}
@@ -0,0 +1,134 @@
+package schedule_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/schedule"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+func TestNewAction(t *testing.T) {
+	now := time.Now()
+	for k, tc := range []struct {
+		t     ActionType
+		at    time.Time
+		trait string
+		value string
+		ok    bool
+	}{
+		{t: ActionDeactivate, at: now, ok: true},
+		{t: ActionDeactivate, at: now, trait: "plan"},
+		{t: ActionDeactivate},
+		{t: ActionSetTrait, at: now, trait: "plan", value: `"free"`, ok: true},
+		{t: ActionSetTrait, at: now, trait: "address.city", value: `{"name":"Munich"}`, ok: true},
+		{t: ActionSetTrait, at: now, trait: "plan"},
+		{t: ActionSetTrait, at: now, trait: "plan", value: `{`},
+		{t: ActionSetTrait, at: now, value: `"free"`},
+		{t: ActionSetTrait, at: now, trait: "plans.#", value: `"free"`},
+		{t: ActionRemoveTrait, at: now, trait: "plan", ok: true},
+		{t: ActionRemoveTrait, at: now, trait: "plan", value: `"free"`},
+		{t: "suspend", at: now},
+	} {
+		var value json.RawMessage
+		if len(tc.value) > 0 {
+			value = json.RawMessage(tc.value)
+		}
+
+		a, err := NewAction(x.NewUUID(), tc.t, tc.at, tc.trait, value)
+		if !tc.ok {
+			require.Error(t, err, "%d", k)
+			continue
+		}
+
+		require.NoError(t, err, "%d", k)
+		assert.Equal(t, StatePending, a.State, "%d", k)
+		assert.Equal(t, time.UTC, a.ExecuteAt.Location(), "%d", k)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	conf, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	i.Traits = identity.Traits(`{"email":"contractor@ory.sh","plan":"trial"}`)
+	require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+	require.NoError(t, reg.SessionPersister().CreateSession(context.Background(), session.NewSession(i, httptest.NewRequest("GET", "/", nil), conf)))
+
+	schedule := func(t *testing.T, typ ActionType, at time.Time, trait string, value json.RawMessage) *Action {
+		a, err := NewAction(i.ID, typ, at, trait, value)
+		require.NoError(t, err)
+		require.NoError(t, reg.ScheduledActionPersister().CreateScheduledAction(context.Background(), a))
+		return a
+	}
+
+	get := func(t *testing.T, a *Action) *Action {
+		actual, err := reg.ScheduledActionPersister().GetScheduledAction(context.Background(), a.ID)
+		require.NoError(t, err)
+		return actual
+	}
+
+	now := time.Now().UTC()
+	removeTrial := schedule(t, ActionRemoveTrait, now.Add(-time.Minute), "plan", nil)
+	invalidPlan := schedule(t, ActionSetTrait, now.Add(-time.Minute), "plan", json.RawMessage(`1`))
+	deactivate := schedule(t, ActionDeactivate, now, "", nil)
+	later := schedule(t, ActionDelete, now.Add(time.Hour), "", nil)
+
+	require.NoError(t, reg.IdentityScheduler().Run(context.Background()))
+
+	t.Run("case=changes traits", func(t *testing.T) {
+		assert.Equal(t, StateCompleted, get(t, removeTrial).State)
+
+		actual, err := reg.PrivilegedIdentityPool().GetIdentity(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"email":"contractor@ory.sh"}`, string(actual.Traits))
+	})
+
+	t.Run("case=tries failed actions again later", func(t *testing.T) {
+		actual := get(t, invalidPlan)
+		assert.Equal(t, StatePending, actual.State)
+		assert.Equal(t, 1, actual.Attempts)
+		assert.NotEmpty(t, actual.LastError)
+		assert.True(t, actual.ExecuteAt.After(now), "%s", actual.ExecuteAt)
+	})
+
+	t.Run("case=deactivates identities", func(t *testing.T) {
+		assert.Equal(t, StateCompleted, get(t, deactivate).State)
+		assert.Equal(t, ErrIdentityDeactivated, errors.Cause(reg.IdentityScheduler().CheckLogin(context.Background(), i)))
+
+		sessions, err := reg.SessionPersister().ListSessionsFor(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		schedule(t, ActionActivate, now, "", nil)
+		require.NoError(t, reg.IdentityScheduler().Run(context.Background()))
+		require.NoError(t, reg.IdentityScheduler().CheckLogin(context.Background(), i))
+	})
+
+	t.Run("case=does not execute actions before they are due", func(t *testing.T) {
+		assert.Equal(t, StatePending, get(t, later).State)
+	})
+
+	t.Run("case=deletes identities", func(t *testing.T) {
+		schedule(t, ActionDelete, now, "", nil)
+		require.NoError(t, reg.IdentityScheduler().Run(context.Background()))
+
+		_, err := reg.PrivilegedIdentityPool().GetIdentity(context.Background(), i.ID)
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+	})
+}
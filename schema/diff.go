@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Change is a difference between two versions of a schema.
+//
+// swagger:model identitySchemaChange
+type Change struct {
+	// Op is "add", "remove", or "replace", like in JSON Patch (RFC 6902).
+	//
+	// required: true
+	Op string `json:"op"`
+
+	// Path is the JSON Pointer (RFC 6901) of the value which changed, for example
+	// `/properties/email/format`.
+	//
+	// required: true
+	Path string `json:"path"`
+
+	// From is the value in the old version. It is not set if the value was added.
+	From interface{} `json:"from,omitempty"`
+
+	// To is the value in the new version. It is not set if the value was removed.
+	To interface{} `json:"to,omitempty"`
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Diff returns the changes between two JSON documents. Keys of objects are compared in alphabetical order and
+// items of arrays by their position.
+func Diff(from, to json.RawMessage) ([]Change, error) {
+	var a, b interface{}
+	if err := json.Unmarshal(from, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(to, &b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	changes := make([]Change, 0)
+	diff("", a, b, &changes)
+	return changes, nil
+}
+
+func diff(path string, a, b interface{}, changes *[]Change) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(av)+len(bv))
+			for k := range av {
+				keys = append(keys, k)
+			}
+			for k := range bv {
+				if _, ok := av[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				p := path + "/" + pointerEscaper.Replace(k)
+				x, inA := av[k]
+				y, inB := bv[k]
+				switch {
+				case !inB:
+					*changes = append(*changes, Change{Op: "remove", Path: p, From: x})
+				case !inA:
+					*changes = append(*changes, Change{Op: "add", Path: p, To: y})
+				default:
+					diff(p, x, y, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			for k := 0; k < len(av) || k < len(bv); k++ {
+				p := path + "/" + strconv.Itoa(k)
+				switch {
+				case k >= len(bv):
+					*changes = append(*changes, Change{Op: "remove", Path: p, From: av[k]})
+				case k >= len(av):
+					*changes = append(*changes, Change{Op: "add", Path: p, To: bv[k]})
+				default:
+					diff(p, av[k], bv[k], changes)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Op: "replace", Path: path, From: a, To: b})
+	}
+}
@@ -53,7 +53,7 @@ func NewInvalidCredentialsError() error {
 	return errors.WithStack(&jsonschema.ValidationError{
 		Message:     `the provided credentials are invalid, check for spelling mistakes in your password or username, email address, or phone number`,
 		InstancePtr: "#/",
-		Context:     &ValidationErrorContextPasswordPolicyViolation{},
+		Context:     &ValidationErrorContextInvalidCredentialsError{},
 	})
 }
 
@@ -70,3 +70,31 @@ func NewDuplicateCredentialsError() error {
 		Context:     &ValidationErrorContextDuplicateCredentialsError{},
 	})
 }
+
+// ValidationErrorContextEmailDomainNotAllowed is the context of an email address whose domain may not be used.
+// Disposable is true if the domain belongs to a disposable email provider.
+type ValidationErrorContextEmailDomainNotAllowed struct {
+	Domain     string
+	Disposable bool
+}
+
+func (r *ValidationErrorContextEmailDomainNotAllowed) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextEmailDomainNotAllowed) FinishInstanceContext() {}
+
+// Message returns the message of the validation error.
+func (r *ValidationErrorContextEmailDomainNotAllowed) Message() string {
+	if r.Disposable {
+		return fmt.Sprintf("disposable email addresses such as ones of the domain %q can not be used", r.Domain)
+	}
+	return fmt.Sprintf("email addresses of the domain %q can not be used", r.Domain)
+}
+
+func NewEmailDomainNotAllowedError(instancePtr string, domain string, disposable bool) error {
+	ctx := &ValidationErrorContextEmailDomainNotAllowed{Domain: domain, Disposable: disposable}
+	return errors.WithStack(&jsonschema.ValidationError{
+		Message:     ctx.Message(),
+		InstancePtr: instancePtr,
+		Context:     ctx,
+	})
+}
@@ -3,6 +3,7 @@ package schema
 import (
 	"bytes"
 	"encoding/json"
+	"strings"
 
 	"github.com/gobuffalo/packr/v2"
 	"github.com/pkg/errors"
@@ -29,6 +30,8 @@ type (
 		Verification struct {
 			Via string `json:"via"`
 		} `json:"verification"`
+		Upload   *UploadConfig `json:"upload"`
+		Format   string        `json:"format"`
 		Mappings struct {
 			Identity struct {
 				Traits []struct {
@@ -38,6 +41,14 @@ type (
 		} `json:"mappings"`
 	}
 
+	// UploadConfig marks a string trait as a reference to a file which the identity uploaded, see package upload.
+	// MaxSize is the maximum size of the file in bytes, and ContentTypes are the content types it may have. Any
+	// content type is allowed if ContentTypes is empty.
+	UploadConfig struct {
+		MaxSize      int64    `json:"max_size"`
+		ContentTypes []string `json:"content_types"`
+	}
+
 	Extension interface {
 		Run(ctx jsonschema.ValidationContext, config ExtensionConfig, value interface{}) error
 		Finish() error
@@ -77,6 +88,10 @@ func NewExtensionRunner(meta ExtensionRunnerMetaSchema, runners ...Extension) (*
 				return nil, errors.WithStack(err)
 			}
 
+			if _, ok := getFormat(e.Format); len(e.Format) > 0 && !ok {
+				return nil, errors.Errorf("format %q is not registered, the registered formats are: %s", e.Format, strings.Join(Formats(), ", "))
+			}
+
 			return &e, nil
 		}
 		return nil, nil
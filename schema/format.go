@@ -0,0 +1,220 @@
+package schema
+
+import (
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/jsonschema/v3"
+)
+
+// Format validates the value of a trait, for example the checksum of a national ID. It returns an error which
+// explains what is wrong with the value.
+type Format func(value string) error
+
+var formats = struct {
+	sync.RWMutex
+	m map[string]Format
+}{m: map[string]Format{
+	"iban":      validateIBAN,
+	"luhn":      validateLuhn,
+	"ein":       validateEIN,
+	"eu-vat-id": validateEUVATID,
+}}
+
+// RegisterFormat registers a custom format, replacing the one with the same name. A trait uses it with the
+// `format` keyword of the `ory.sh/kratos` extension, so that it is only validated in the schemas which ask for it:
+//
+//	"vat_id": {
+//	  "type": "string",
+//	  "ory.sh/kratos": {
+//	    "format": "eu-vat-id"
+//	  }
+//	}
+//
+// Formats have to be registered before the schemas which use them are compiled, usually in an init function.
+func RegisterFormat(name string, f Format) {
+	formats.Lock()
+	defer formats.Unlock()
+	formats.m[name] = f
+}
+
+// Formats returns the names of all registered formats.
+func Formats() []string {
+	formats.RLock()
+	defer formats.RUnlock()
+
+	names := make([]string, 0, len(formats.m))
+	for name := range formats.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getFormat(name string) (Format, bool) {
+	formats.RLock()
+	defer formats.RUnlock()
+	f, ok := formats.m[name]
+	return f, ok
+}
+
+// FormatExtension validates traits against the custom formats they ask for, see RegisterFormat.
+type FormatExtension struct{}
+
+func NewFormatExtension() *FormatExtension {
+	return new(FormatExtension)
+}
+
+func (e *FormatExtension) Run(ctx jsonschema.ValidationContext, s ExtensionConfig, value interface{}) error {
+	if len(s.Format) == 0 {
+		return nil
+	}
+
+	f, ok := getFormat(s.Format)
+	if !ok {
+		return ctx.Error("format", "format %q is not registered", s.Format)
+	}
+
+	v, ok := value.(string)
+	if !ok {
+		return ctx.Error("type", "expected string, but got %T", value)
+	}
+
+	if err := f(v); err != nil {
+		return ctx.Error("format", "%q is not valid %q: %s", v, s.Format, err)
+	}
+	return nil
+}
+
+func (e *FormatExtension) Finish() error {
+	return nil
+}
+
+var ibanPattern = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+
+// validateIBAN validates an International Bank Account Number (ISO 13616), which may contain spaces.
+func validateIBAN(value string) error {
+	iban := strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	if !ibanPattern.MatchString(iban) {
+		return errors.New("an IBAN starts with the country code and two check digits followed by up to 30 letters and digits")
+	}
+
+	// Move the country code and check digits to the end and replace letters by numbers, A = 10 to Z = 35.
+	var digits strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' && c <= 'Z' {
+			digits.WriteString(strconv.Itoa(int(c - 'A' + 10)))
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	if new(big.Int).Mod(n, big.NewInt(97)).Int64() != 1 {
+		return errors.New("the check digits are wrong")
+	}
+	return nil
+}
+
+// validateLuhn validates a number with a Luhn check digit, such as a payment card number or the Canadian social
+// insurance number. Spaces and dashes are ignored.
+func validateLuhn(value string) error {
+	number := strings.NewReplacer(" ", "", "-", "").Replace(value)
+	if len(number) < 2 {
+		return errors.New("the number is too short")
+	}
+
+	var sum int
+	for k := range number {
+		c := number[len(number)-1-k]
+		if c < '0' || c > '9' {
+			return errors.New("the number may only contain digits")
+		}
+
+		d := int(c - '0')
+		if k%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	if sum%10 != 0 {
+		return errors.New("the check digit is wrong")
+	}
+	return nil
+}
+
+var einPattern = regexp.MustCompile(`^([0-9]{2})-?[0-9]{7}$`)
+
+// validateEIN validates a US Employer Identification Number such as 12-3456789. EINs have no check digit, but
+// some prefixes are never assigned.
+func validateEIN(value string) error {
+	m := einPattern.FindStringSubmatch(value)
+	if m == nil {
+		return errors.New("an EIN consists of nine digits, for example 12-3456789")
+	}
+
+	switch m[1] {
+	case "00", "07", "08", "09", "17", "18", "19", "28", "29", "49", "69", "70", "78", "79", "89", "96", "97":
+		return errors.Errorf("the prefix %s is never assigned", m[1])
+	}
+	return nil
+}
+
+// euVATIDPatterns are the structures of the VAT identification numbers of the EU member states, without the
+// country code. Greece uses EL instead of GR, and XI is Northern Ireland.
+var euVATIDPatterns = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U[0-9]{8}$`),
+	"BE": regexp.MustCompile(`^[01][0-9]{9}$`),
+	"BG": regexp.MustCompile(`^[0-9]{9,10}$`),
+	"CY": regexp.MustCompile(`^[0-9]{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^[0-9]{8,10}$`),
+	"DE": regexp.MustCompile(`^[0-9]{9}$`),
+	"DK": regexp.MustCompile(`^[0-9]{8}$`),
+	"EE": regexp.MustCompile(`^[0-9]{9}$`),
+	"EL": regexp.MustCompile(`^[0-9]{9}$`),
+	"ES": regexp.MustCompile(`^[0-9A-Z][0-9]{7}[0-9A-Z]$`),
+	"FI": regexp.MustCompile(`^[0-9]{8}$`),
+	"FR": regexp.MustCompile(`^[0-9A-Z]{2}[0-9]{9}$`),
+	"HR": regexp.MustCompile(`^[0-9]{11}$`),
+	"HU": regexp.MustCompile(`^[0-9]{8}$`),
+	"IE": regexp.MustCompile(`^[0-9][0-9A-Z+*][0-9]{5}[A-Z]{1,2}$`),
+	"IT": regexp.MustCompile(`^[0-9]{11}$`),
+	"LT": regexp.MustCompile(`^([0-9]{9}|[0-9]{12})$`),
+	"LU": regexp.MustCompile(`^[0-9]{8}$`),
+	"LV": regexp.MustCompile(`^[0-9]{11}$`),
+	"MT": regexp.MustCompile(`^[0-9]{8}$`),
+	"NL": regexp.MustCompile(`^[0-9]{9}B[0-9]{2}$`),
+	"PL": regexp.MustCompile(`^[0-9]{10}$`),
+	"PT": regexp.MustCompile(`^[0-9]{9}$`),
+	"RO": regexp.MustCompile(`^[0-9]{2,10}$`),
+	"SE": regexp.MustCompile(`^[0-9]{12}$`),
+	"SI": regexp.MustCompile(`^[0-9]{8}$`),
+	"SK": regexp.MustCompile(`^[0-9]{10}$`),
+	"XI": regexp.MustCompile(`^([0-9]{9}|[0-9]{12}|GD[0-9]{3}|HA[0-9]{3})$`),
+}
+
+// validateEUVATID validates the structure of a VAT identification number of an EU member state, such as
+// DE123456789. Whether the number was issued can only be checked with the VIES service of the EU.
+func validateEUVATID(value string) error {
+	id := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", ".", "").Replace(value))
+	if len(id) < 4 {
+		return errors.New("a VAT ID starts with the country code, for example DE123456789")
+	}
+
+	pattern, ok := euVATIDPatterns[id[:2]]
+	if !ok {
+		return errors.Errorf("%s is not the country code of an EU member state", id[:2])
+	} else if !pattern.MatchString(id[2:]) {
+		return errors.Errorf("the number does not match the structure of %s VAT IDs", id[:2])
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/jsonschema/v3"
+	_ "github.com/ory/jsonschema/v3/fileloader"
+)
+
+func TestFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format  string
+		valid   []string
+		invalid []string
+	}{
+		{
+			format:  "iban",
+			valid:   []string{"DE89 3704 0044 0532 0130 00", "GB82WEST12345698765432", "gb82 west 1234 5698 7654 32"},
+			invalid: []string{"DE89 3704 0044 0532 0130 01", "DE89", "not an iban"},
+		},
+		{
+			format:  "luhn",
+			valid:   []string{"4111 1111 1111 1111", "046-454-286"},
+			invalid: []string{"4111 1111 1111 1112", "4111a", "0"},
+		},
+		{
+			format:  "ein",
+			valid:   []string{"12-3456789", "123456789"},
+			invalid: []string{"00-1234567", "97-1234567", "12-345678", "12 3456789"},
+		},
+		{
+			format:  "eu-vat-id",
+			valid:   []string{"DE123456789", "de 123 456 789", "NL123456789B01", "ATU12345678", "EL123456789"},
+			invalid: []string{"GR123456789", "DE12345678", "US123456789", "DE"},
+		},
+	} {
+		t.Run("format="+tc.format, func(t *testing.T) {
+			f, ok := getFormat(tc.format)
+			require.True(t, ok)
+			for _, v := range tc.valid {
+				assert.NoError(t, f(v), "%s", v)
+			}
+			for _, v := range tc.invalid {
+				assert.Error(t, f(v), "%s", v)
+			}
+		})
+	}
+}
+
+func TestFormatExtension(t *testing.T) {
+	RegisterFormat("test-member-id", func(value string) error {
+		if !strings.HasPrefix(value, "M-") {
+			return errors.New("member IDs start with M-")
+		}
+		return nil
+	})
+	assert.Contains(t, Formats(), "test-member-id")
+
+	compile := func(t *testing.T, schema string) (*jsonschema.Schema, error) {
+		c := jsonschema.NewCompiler()
+		runner, err := NewExtensionRunner(ExtensionRunnerIdentityMetaSchema, NewFormatExtension())
+		require.NoError(t, err)
+		runner.Register(c)
+		return c.Compile(schema)
+	}
+
+	s, err := compile(t, "file://./stub/extension/format.schema.json")
+	require.NoError(t, err)
+
+	for k, tc := range []struct {
+		doc       string
+		expectErr string
+	}{
+		{doc: `{"iban":"DE89370400440532013000","member_id":"M-1234"}`},
+		{doc: `{}`},
+		{doc: `{"iban":"DE89370400440532013001"}`, expectErr: `I[#/iban] S[#/properties/iban/format] "DE89370400440532013001" is not valid "iban": the check digits are wrong`},
+		{doc: `{"member_id":"1234"}`, expectErr: `I[#/member_id] S[#/properties/member_id/format] "1234" is not valid "test-member-id": member IDs start with M-`},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			err := s.Validate(bytes.NewBufferString(tc.doc))
+			if len(tc.expectErr) > 0 {
+				require.EqualError(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("case=schemas must not use unregistered formats", func(t *testing.T) {
+		_, err := compile(t, "file://./stub/extension/format.unknown.schema.json")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `format "does-not-exist" is not registered`)
+	})
+}
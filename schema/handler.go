@@ -12,12 +12,16 @@ import (
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
+
+	"github.com/ory/kratos/egress"
 	"github.com/ory/kratos/x"
 )
 
 type (
 	handlerDependencies interface {
 		x.WriterProvider
+		PersistenceProvider
 		IdentityTraitsSchemas() Schemas
 		Logger() logrus.FieldLogger
 	}
@@ -35,7 +39,10 @@ func NewHandler(r handlerDependencies) *Handler {
 	}
 }
 
-const SchemasPath string = "schemas"
+const (
+	SchemasPath       string = "schemas"
+	StoredSchemasPath string = "/identity-schemas"
+)
 
 func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 	public.GET(fmt.Sprintf("/%s/:id", SchemasPath), h.get)
@@ -43,6 +50,14 @@ func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 
 func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 	admin.GET(fmt.Sprintf("/%s/:id", SchemasPath), h.get)
+
+	admin.GET(StoredSchemasPath, h.listStored)
+	admin.POST(StoredSchemasPath, h.createVersion)
+	admin.GET(StoredSchemasPath+"/:id/versions", h.listVersions)
+	admin.GET(StoredSchemasPath+"/:id/versions/:version", h.getVersion)
+	admin.GET(StoredSchemasPath+"/:id/diff", h.diff)
+	admin.PUT(StoredSchemasPath+"/:id/default", h.setDefault)
+	admin.DELETE(StoredSchemasPath+"/:id/default", h.unsetDefault)
 }
 
 // The raw identity traits schema
@@ -92,8 +107,16 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 			return
 		}
 		defer src.Close()
+	} else if s.URL.Scheme == "base64" {
+		// Stored schemas embed their content in the URL.
+		src, err = jsonschema.LoadURL(s.URL.String())
+		if err != nil {
+			h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The JSON Schema could not be decoded.").WithDebugf("%+v", err)))
+			return
+		}
+		defer src.Close()
 	} else {
-		resp, err := http.Get(s.URL.String())
+		resp, err := egress.Default.Client().Get(s.URL.String())
 		if err != nil {
 			h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The file for this JSON Schema ID could not be found or opened. This is a configuration issue.").WithDebugf("%+v", err)))
 			return
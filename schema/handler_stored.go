@@ -0,0 +1,377 @@
+package schema
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+)
+
+// CreateStoredSchemaVersion is a new version of a stored schema.
+//
+// swagger:model createIdentitySchemaVersion
+type CreateStoredSchemaVersion struct {
+	// ID is the ID of the schema. The schema is created if it does not exist yet. It may not be the ID of a
+	// configured schema.
+	//
+	// required: true
+	ID string `json:"id"`
+
+	// Schema is the JSON Schema of the identity traits. It must not reference other files.
+	//
+	// required: true
+	Schema json.RawMessage `json:"schema"`
+}
+
+// A list of stored identity traits schemas.
+//
+// swagger:response storedIdentitySchemas
+// nolint:deadcode,unused
+type storedSchemasResponse struct {
+	// in: body
+	Body []StoredSchema
+}
+
+// A version of a stored identity traits schema.
+//
+// swagger:response identitySchemaVersion
+// nolint:deadcode,unused
+type versionResponse struct {
+	// in: body
+	Body *StoredSchemaVersion
+}
+
+// A list of versions of a stored identity traits schema.
+//
+// swagger:response identitySchemaVersions
+// nolint:deadcode,unused
+type versionsResponse struct {
+	// in: body
+	Body []StoredSchemaVersion
+}
+
+// The changes between two versions of a stored identity traits schema.
+//
+// swagger:response identitySchemaDiff
+// nolint:deadcode,unused
+type diffResponse struct {
+	// in: body
+	Body []Change
+}
+
+// nolint:deadcode,unused
+// swagger:parameters createIdentitySchemaVersion
+type createVersionParameters struct {
+	// in: body
+	Body CreateStoredSchemaVersion
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listIdentitySchemaVersions setDefaultIdentitySchema unsetDefaultIdentitySchema
+type storedSchemaParameters struct {
+	// ID is the ID of the stored schema.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getIdentitySchemaVersion
+type versionParameters struct {
+	// ID is the ID of the stored schema.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// Version is the number of the version.
+	//
+	// required: true
+	// in: path
+	Version int `json:"version"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters diffIdentitySchemaVersions
+type diffParameters struct {
+	// ID is the ID of the stored schema.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// From is the number of the old version. It defaults to the version before `to`.
+	//
+	// in: query
+	From int `json:"from"`
+
+	// To is the number of the new version. It defaults to the latest version.
+	//
+	// in: query
+	To int `json:"to"`
+}
+
+// swagger:route GET /identity-schemas admin listStoredIdentitySchemas
+//
+// List stored identity traits schemas
+//
+// Returns the identity traits schemas stored using the admin API, ordered by their ID. Schemas from the
+// configuration are not included.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: storedIdentitySchemas
+//       500: genericError
+func (h *Handler) listStored(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ss, err := h.r.IdentitySchemaPersister().ListStoredSchemas(r.Context())
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, ss)
+}
+
+// swagger:route POST /identity-schemas admin createIdentitySchemaVersion
+//
+// Store a version of an identity traits schema
+//
+// Stores the JSON Schema as the next version of the identity traits schema, creating the schema if it does not
+// exist yet. Versions are immutable: identities reference the version they were created with by the traits
+// schema ID `<id>@<version>`, so that they are not affected by later versions. Identities created with the traits
+// schema ID `<id>` use the latest version.
+//
+// The schema must not reference other files. It is available at `/schemas/<id>@<version>` like configured
+// schemas.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: identitySchemaVersion
+//       400: genericError
+//       409: genericError
+//       500: genericError
+func (h *Handler) createVersion(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var body CreateStoredSchemaVersion
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&body)); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	if s, err := h.r.IdentityTraitsSchemas().GetByID(body.ID); err == nil && len(s.VersionID) == 0 {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrConflict.WithReasonf("The schema %q is configured and can not be stored.", body.ID)))
+		return
+	}
+
+	v, err := NewStoredSchemaVersion(body.ID, body.Schema)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.IdentitySchemaPersister().CreateSchemaVersion(r.Context(), v); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().WriteCode(w, r, http.StatusCreated, v)
+}
+
+// swagger:route GET /identity-schemas/{id}/versions admin listIdentitySchemaVersions
+//
+// List the versions of a stored identity traits schema
+//
+// Returns the versions of the stored schema, oldest first.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identitySchemaVersions
+//       404: genericError
+//       500: genericError
+func (h *Handler) listVersions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	vs, err := h.r.IdentitySchemaPersister().ListSchemaVersions(r.Context(), ps.ByName("id"))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	} else if len(vs) == 0 {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReasonf("The schema %q is not stored.", ps.ByName("id"))))
+		return
+	}
+
+	h.r.Writer().Write(w, r, vs)
+}
+
+// swagger:route GET /identity-schemas/{id}/versions/{version} admin getIdentitySchemaVersion
+//
+// Get a version of a stored identity traits schema
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identitySchemaVersion
+//       404: genericError
+//       500: genericError
+func (h *Handler) getVersion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	version, err := strconv.Atoi(ps.ByName("version"))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReasonf("The version %q does not exist.", ps.ByName("version"))))
+		return
+	}
+
+	v, err := h.r.IdentitySchemaPersister().GetSchemaVersion(r.Context(), ps.ByName("id"), version)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, v)
+}
+
+// swagger:route GET /identity-schemas/{id}/diff admin diffIdentitySchemaVersions
+//
+// Compare two versions of a stored identity traits schema
+//
+// Returns the changes from one version of the schema to another, for example to review which traits of
+// identities pinned to the old version would become invalid. By default, the latest version is compared to the
+// one before it.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identitySchemaDiff
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) diff(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	vs, err := h.r.IdentitySchemaPersister().ListSchemaVersions(r.Context(), ps.ByName("id"))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	} else if len(vs) == 0 {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReasonf("The schema %q is not stored.", ps.ByName("id"))))
+		return
+	}
+
+	to, err := versionQuery(r, "to", len(vs), len(vs))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	from, err := versionQuery(r, "from", to-1, len(vs))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	// The first version is compared to an empty schema.
+	old := json.RawMessage("{}")
+	if from > 0 {
+		old = vs[from-1].Schema
+	}
+
+	changes, err := Diff(old, vs[to-1].Schema)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, changes)
+}
+
+func versionQuery(r *http.Request, key string, fallback, latest int) (int, error) {
+	raw := r.URL.Query().Get(key)
+	if len(raw) == 0 {
+		return fallback, nil
+	}
+
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 1 || version > latest {
+		return 0, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Query parameter %s must be a version between 1 and %d.", key, latest))
+	}
+	return version, nil
+}
+
+// swagger:route PUT /identity-schemas/{id}/default admin setDefaultIdentitySchema
+//
+// Create new identities with a stored identity traits schema
+//
+// Makes the latest version of the stored schema the default identity traits schema instead of the one
+// configured at `identity.traits.default_schema_url`, like changing the configuration would. New identities are
+// created with the version that is the latest at that time. Identities which reference the traits schema ID
+// `default` are validated against the stored schema from now on.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) setDefault(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := h.r.IdentitySchemaPersister().SetDefaultStoredSchema(r.Context(), ps.ByName("id")); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route DELETE /identity-schemas/{id}/default admin unsetDefaultIdentitySchema
+//
+// Create new identities with the configured identity traits schema again
+//
+// Makes the schema configured at `identity.traits.default_schema_url` the default identity traits schema again.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) unsetDefault(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ss, err := h.r.IdentitySchemaPersister().ListStoredSchemas(r.Context())
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	for _, s := range ss {
+		if s.ID == ps.ByName("id") && s.IsDefault {
+			if err := h.r.IdentitySchemaPersister().SetDefaultStoredSchema(r.Context(), ""); err != nil {
+				h.r.Writer().WriteError(w, r, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReasonf("The schema %q is not the default schema.", ps.ByName("id"))))
+}
@@ -1,6 +1,9 @@
 package schema_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,11 +12,14 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 
 	_ "github.com/ory/jsonschema/v3/fileloader"
 
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
 	"github.com/ory/kratos/schema"
 	"github.com/ory/kratos/x"
@@ -127,3 +133,119 @@ func TestHandler(t *testing.T) {
 		_ = getFromTS("not-existing", http.StatusNotFound)
 	})
 }
+
+func TestStoredSchemaHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	router := x.NewRouterAdmin()
+	reg.SchemaHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	send := func(t *testing.T, method, href string, expectCode int, body interface{}) gjson.Result {
+		var b bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&b).Encode(body))
+		}
+		req, err := http.NewRequest(method, ts.URL+href, &b)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		result, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		require.EqualValues(t, expectCode, res.StatusCode, "%s", result)
+		return gjson.ParseBytes(result)
+	}
+
+	first := json.RawMessage(`{"type":"object","properties":{"email":{"type":"string","format":"email"}}}`)
+	second := json.RawMessage(`{"type":"object","properties":{"email":{"type":"string","format":"email"}},"required":["email"]}`)
+
+	newIdentity := func(t *testing.T, schemaID string, traits string) (*identity.Identity, error) {
+		i := identity.NewIdentity(schemaID)
+		i.Traits = identity.Traits(traits)
+		return i, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i)
+	}
+
+	t.Run("case=configured schemas can not be stored", func(t *testing.T) {
+		send(t, "POST", "/identity-schemas", http.StatusConflict, &schema.CreateStoredSchemaVersion{ID: "default", Schema: first})
+	})
+
+	t.Run("case=invalid schemas are rejected", func(t *testing.T) {
+		send(t, "POST", "/identity-schemas", http.StatusBadRequest, &schema.CreateStoredSchemaVersion{ID: "customer", Schema: json.RawMessage(`{"type":"array"}`)})
+		send(t, "POST", "/identity-schemas", http.StatusBadRequest, &schema.CreateStoredSchemaVersion{ID: "customer@1", Schema: first})
+		send(t, "GET", "/identity-schemas/customer/versions", http.StatusNotFound, nil)
+	})
+
+	t.Run("case=versions are numbered", func(t *testing.T) {
+		res := send(t, "POST", "/identity-schemas", http.StatusCreated, &schema.CreateStoredSchemaVersion{ID: "customer", Schema: first})
+		assert.EqualValues(t, 1, res.Get("version").Int())
+		res = send(t, "POST", "/identity-schemas", http.StatusCreated, &schema.CreateStoredSchemaVersion{ID: "customer", Schema: second})
+		assert.EqualValues(t, 2, res.Get("version").Int())
+
+		res = send(t, "GET", "/identity-schemas", http.StatusOK, nil)
+		assert.Equal(t, "customer", res.Get("0.id").String())
+		assert.EqualValues(t, 2, res.Get("0.latest_version").Int())
+		assert.False(t, res.Get("0.is_default").Bool())
+
+		res = send(t, "GET", "/identity-schemas/customer/versions", http.StatusOK, nil)
+		assert.Len(t, res.Array(), 2)
+
+		res = send(t, "GET", "/identity-schemas/customer/versions/1", http.StatusOK, nil)
+		assert.JSONEq(t, string(first), res.Get("schema").Raw)
+		send(t, "GET", "/identity-schemas/customer/versions/3", http.StatusNotFound, nil)
+
+		res = send(t, "GET", "/schemas/customer@1", http.StatusOK, nil)
+		assert.JSONEq(t, string(first), res.Raw)
+	})
+
+	t.Run("case=versions are compared", func(t *testing.T) {
+		res := send(t, "GET", "/identity-schemas/customer/diff", http.StatusOK, nil)
+		assert.JSONEq(t, `[{"op":"add","path":"/required","to":["email"]}]`, res.Raw)
+
+		res = send(t, "GET", "/identity-schemas/customer/diff?from=2&to=1", http.StatusOK, nil)
+		assert.JSONEq(t, `[{"op":"remove","path":"/required","from":["email"]}]`, res.Raw)
+
+		send(t, "GET", "/identity-schemas/customer/diff?from=3", http.StatusBadRequest, nil)
+		send(t, "GET", "/identity-schemas/unknown/diff", http.StatusNotFound, nil)
+	})
+
+	t.Run("case=identities are pinned to the version they were created with", func(t *testing.T) {
+		i, err := newIdentity(t, "customer", `{"email":"customer@ory.sh"}`)
+		require.NoError(t, err)
+		assert.Equal(t, "customer@2", i.TraitsSchemaID)
+		assert.Equal(t, ts.URL+"/schemas/customer@2", i.TraitsSchemaURL)
+
+		i, err = newIdentity(t, "customer@1", `{}`)
+		require.NoError(t, err)
+		assert.Equal(t, "customer@1", i.TraitsSchemaID)
+
+		_, err = newIdentity(t, "customer", `{}`)
+		require.Error(t, err, "the latest version requires the email")
+	})
+
+	t.Run("case=the default schema can be stored", func(t *testing.T) {
+		send(t, "PUT", "/identity-schemas/unknown/default", http.StatusNotFound, nil)
+		send(t, "DELETE", "/identity-schemas/customer/default", http.StatusNotFound, nil)
+
+		send(t, "PUT", "/identity-schemas/customer/default", http.StatusNoContent, nil)
+		assert.True(t, send(t, "GET", "/identity-schemas", http.StatusOK, nil).Get("0.is_default").Bool())
+
+		i, err := newIdentity(t, configuration.DefaultIdentityTraitsSchemaID, `{"email":"default@ory.sh"}`)
+		require.NoError(t, err)
+		assert.Equal(t, "customer@2", i.TraitsSchemaID)
+
+		res := send(t, "GET", "/schemas/default", http.StatusOK, nil)
+		assert.JSONEq(t, string(second), res.Raw)
+
+		send(t, "DELETE", "/identity-schemas/customer/default", http.StatusNoContent, nil)
+		i, err = newIdentity(t, configuration.DefaultIdentityTraitsSchemaID, `{"email":"default@ory.sh"}`)
+		require.NoError(t, err)
+		assert.Equal(t, configuration.DefaultIdentityTraitsSchemaID, i.TraitsSchemaID)
+	})
+}
@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/jsonschemax"
+)
+
+// overrideMessages replaces the message of each violation with the message defined for the violated keyword
+// in the `ory.sh/kratos` extension of the schema, if there is one. The following schema, for example, replaces
+// the message of an invalid email address:
+//
+//	{
+//	  "type": "string",
+//	  "format": "email",
+//	  "ory.sh/kratos": {
+//	    "messages": {
+//	      "format": "Please enter a valid email address."
+//	    }
+//	  }
+//	}
+//
+// The schema located at href is looked up by its URL and its `$id`, all other schemas are loaded on demand.
+func overrideMessages(href string, raw []byte, err *jsonschema.ValidationError) {
+	documents := map[string][]byte{stripFragment(href): raw}
+	if id := gjson.GetBytes(raw, "$id").String(); len(id) > 0 {
+		documents[stripFragment(id)] = raw
+	}
+
+	var walk func(err *jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		if message, ok := customMessage(documents, err); ok {
+			err.Message = message
+		}
+		for _, cause := range err.Causes {
+			walk(cause)
+		}
+	}
+
+	walk(err)
+}
+
+func customMessage(documents map[string][]byte, err *jsonschema.ValidationError) (string, bool) {
+	href := stripFragment(err.SchemaURL)
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(err.SchemaPtr, "#"), "/"), "/")
+	if len(href) == 0 || len(segments) == 0 || len(segments[0]) == 0 {
+		return "", false
+	}
+
+	document, ok := documents[href]
+	if !ok {
+		resource, err := jsonschema.LoadURL(href)
+		if err != nil {
+			return "", false
+		}
+		defer resource.Close()
+
+		document, err = ioutil.ReadAll(resource)
+		if err != nil {
+			return "", false
+		}
+		documents[href] = document
+	}
+
+	path := make([]string, 0, len(segments)+2)
+	for _, segment := range segments[:len(segments)-1] {
+		path = append(path, escapeGJSONPath(unescapeJSONPointer(segment)))
+	}
+	path = append(path, escapeGJSONPath(extensionName), "messages", escapeGJSONPath(unescapeJSONPointer(segments[len(segments)-1])))
+
+	message := gjson.GetBytes(document, strings.Join(path, "."))
+	if message.Type != gjson.String {
+		return "", false
+	}
+	return message.String(), true
+}
+
+// FieldMessages returns the messages of all violations keyed by the dot-notated path of the field which caused them.
+// Violations which do not belong to a field are keyed by an empty string.
+func FieldMessages(err *jsonschema.ValidationError) map[string][]string {
+	messages := map[string][]string{}
+
+	var walk func(err *jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		if len(err.Causes) > 0 {
+			for _, cause := range err.Causes {
+				walk(cause)
+			}
+			return
+		}
+
+		if ctx, ok := err.Context.(*jsonschema.ValidationErrorContextRequired); ok {
+			for _, missing := range ctx.Missing {
+				field, _ := jsonschemax.JSONPointerToDotNotation(missing)
+				messages[field] = append(messages[field], err.Message)
+			}
+			return
+		}
+
+		field, _ := jsonschemax.JSONPointerToDotNotation(err.InstancePtr)
+		messages[field] = append(messages[field], err.Message)
+	}
+
+	walk(err)
+	return messages
+}
+
+func stripFragment(href string) string {
+	return strings.SplitN(href, "#", 2)[0]
+}
+
+func unescapeJSONPointer(segment string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+}
+
+func escapeGJSONPath(segment string) string {
+	return strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`, "|", `\|`, "#", `\#`, "@", `\@`).Replace(segment)
+}
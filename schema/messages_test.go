@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/errorsx"
+)
+
+func TestMessages(t *testing.T) {
+	router := httprouter.New()
+	fs := http.StripPrefix("/schema", http.FileServer(http.Dir("stub/validator")))
+	router.GET("/schema/:name", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		fs.ServeHTTP(w, r)
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for k, tc := range []struct {
+		i      json.RawMessage
+		expect map[string][]string
+	}{
+		{
+			i:      json.RawMessage(`{"name": {"first": "a"}, "age": 1}`),
+			expect: map[string][]string{"name.first": {"Please enter your full first name."}},
+		},
+		{
+			i:      json.RawMessage(`{"name": {"first": "alice"}}`),
+			expect: map[string][]string{"age": {"Please tell us your age."}},
+		},
+		{
+			i:      json.RawMessage(`{"age": 0}`),
+			expect: map[string][]string{"age": {"must be >= 1 but found 0"}},
+		},
+		{
+			i: json.RawMessage(`{"name": {"first": "a"}, "age": 0}`),
+			expect: map[string][]string{
+				"name.first": {"Please enter your full first name."},
+				"age":        {"must be >= 1 but found 0"},
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			err := NewValidator().Validate(ts.URL+"/schema/messages.schema.json", tc.i)
+			require.Error(t, err)
+
+			e, ok := errorsx.Cause(err).(*jsonschema.ValidationError)
+			require.True(t, ok, "%+v", err)
+			assert.Equal(t, tc.expect, FieldMessages(e))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/sqlcon"
+)
+
+type (
+	PersistenceProvider interface {
+		IdentitySchemaPersister() Persister
+	}
+	Persister interface {
+		// CreateSchemaVersion stores the version and numbers it after the latest version of the schema. The
+		// schema is created with its first version.
+		CreateSchemaVersion(ctx context.Context, v *StoredSchemaVersion) error
+
+		GetSchemaVersion(ctx context.Context, schemaID string, version int) (*StoredSchemaVersion, error)
+
+		// ListSchemaVersions returns the versions of the schema, oldest first.
+		ListSchemaVersions(ctx context.Context, schemaID string) ([]StoredSchemaVersion, error)
+
+		// ListStoredSchemas returns all stored schemas ordered by their ID.
+		ListStoredSchemas(ctx context.Context) ([]StoredSchema, error)
+
+		// SetDefaultStoredSchema makes new identities use the schema instead of the configured default. If the
+		// schema ID is empty, new identities use the configured default again.
+		SetDefaultStoredSchema(ctx context.Context, schemaID string) error
+	}
+)
+
+func TestPersister(p Persister) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx := context.Background()
+
+		newVersion := func(t *testing.T, schemaID, title string) *StoredSchemaVersion {
+			v, err := NewStoredSchemaVersion(schemaID, json.RawMessage(`{"type":"object","title":"`+title+`"}`))
+			require.NoError(t, err)
+			require.NoError(t, p.CreateSchemaVersion(ctx, v))
+			return v
+		}
+
+		_, err := p.GetSchemaVersion(ctx, "customer", 1)
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.SetDefaultStoredSchema(ctx, "customer")))
+
+		first := newVersion(t, "customer", "first")
+		assert.Equal(t, 1, first.Version)
+		second := newVersion(t, "customer", "second")
+		assert.Equal(t, 2, second.Version)
+		other := newVersion(t, "employee", "other")
+		assert.Equal(t, 1, other.Version)
+
+		actual, err := p.GetSchemaVersion(ctx, "customer", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "customer", actual.SchemaID)
+		assert.JSONEq(t, `{"type":"object","title":"first"}`, string(actual.Schema))
+
+		vs, err := p.ListSchemaVersions(ctx, "customer")
+		require.NoError(t, err)
+		require.Len(t, vs, 2)
+		assert.Equal(t, []int{1, 2}, []int{vs[0].Version, vs[1].Version})
+		assert.JSONEq(t, `{"type":"object","title":"second"}`, string(vs[1].Schema))
+
+		vs, err = p.ListSchemaVersions(ctx, "unknown")
+		require.NoError(t, err)
+		assert.Empty(t, vs)
+
+		defaults := func(t *testing.T) map[string]bool {
+			ss, err := p.ListStoredSchemas(ctx)
+			require.NoError(t, err)
+			m := map[string]bool{}
+			for _, s := range ss {
+				m[s.ID] = s.IsDefault
+			}
+			return m
+		}
+
+		ss, err := p.ListStoredSchemas(ctx)
+		require.NoError(t, err)
+		require.Len(t, ss, 2)
+		assert.Equal(t, "customer", ss[0].ID)
+		assert.Equal(t, 2, ss[0].LatestVersion)
+		assert.Equal(t, "employee", ss[1].ID)
+		assert.Equal(t, 1, ss[1].LatestVersion)
+		assert.Equal(t, map[string]bool{"customer": false, "employee": false}, defaults(t))
+
+		require.NoError(t, p.SetDefaultStoredSchema(ctx, "customer"))
+		assert.Equal(t, map[string]bool{"customer": true, "employee": false}, defaults(t))
+
+		require.NoError(t, p.SetDefaultStoredSchema(ctx, "employee"))
+		assert.Equal(t, map[string]bool{"customer": false, "employee": true}, defaults(t), "only one schema is the default")
+
+		require.NoError(t, p.SetDefaultStoredSchema(ctx, ""))
+		assert.Equal(t, map[string]bool{"customer": false, "employee": false}, defaults(t))
+	}
+}
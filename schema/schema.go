@@ -81,6 +81,10 @@ type Schema struct {
 	ID     string   `json:"id"`
 	URL    *url.URL `json:"-"`
 	RawURL string   `json:"url"`
+
+	// VersionID is only set for stored schemas. It is the ID of the immutable version the schema resolves to,
+	// see StoredSchemaVersion.
+	VersionID string `json:"-"`
 }
 
 func (s *Schema) SchemaURL(host *url.URL) *url.URL {
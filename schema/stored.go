@@ -0,0 +1,132 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
+)
+
+var storedSchemaIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type (
+	// StoredSchema is an identity traits schema which is managed using the admin API and stored in the database
+	// instead of the configuration. Its versions are immutable: identities reference the version they were
+	// created with, and uploading the schema again adds a version.
+	//
+	// swagger:model storedIdentitySchema
+	StoredSchema struct {
+		// ID is the ID of the schema. It consists of up to 64 letters, digits, dashes, and underscores.
+		//
+		// required: true
+		ID string `json:"id" db:"id"`
+
+		// IsDefault is true if new identities are created with this schema instead of the configured default.
+		//
+		// required: true
+		IsDefault bool `json:"is_default" db:"is_default"`
+
+		// LatestVersion is the number of the latest version of the schema.
+		//
+		// required: true
+		LatestVersion int `json:"latest_version" db:"-"`
+
+		// CreatedAt is the time (UTC) the first version of the schema was stored.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+
+		// UpdatedAt is the time (UTC) the schema was last changed.
+		//
+		// required: true
+		UpdatedAt time.Time `json:"updated_at" faker:"time_type" db:"updated_at"`
+	}
+
+	// StoredSchemaVersion is an immutable version of a stored schema. Identities reference it with the traits
+	// schema ID `<schema_id>@<version>`, for example `customer@2`.
+	//
+	// swagger:model identitySchemaVersion
+	StoredSchemaVersion struct {
+		ID uuid.UUID `json:"-" faker:"-" db:"id"`
+
+		// SchemaID is the ID of the stored schema.
+		//
+		// required: true
+		SchemaID string `json:"schema_id" db:"schema_id"`
+
+		// Version is the number of the version, starting at 1.
+		//
+		// required: true
+		Version int `json:"version" db:"version"`
+
+		// Schema is the JSON Schema of the identity traits.
+		//
+		// required: true
+		Schema json.RawMessage `json:"schema" faker:"-" db:"body"`
+
+		// CreatedAt is the time (UTC) the version was stored.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+)
+
+func (s StoredSchema) TableName() string {
+	return "identity_schemas"
+}
+
+func (v StoredSchemaVersion) TableName() string {
+	return "identity_schema_versions"
+}
+
+// NewStoredSchemaVersion returns the next version of the stored schema, which is numbered when it is stored. The
+// schema must be a self-contained JSON Schema of an object which may use the `ory.sh/kratos` extension. It must
+// not reference other files.
+func NewStoredSchemaVersion(schemaID string, schema json.RawMessage) (*StoredSchemaVersion, error) {
+	if !storedSchemaIDPattern.MatchString(schemaID) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The schema ID must consist of 1 to 64 letters, digits, dashes, and underscores."))
+	}
+
+	if gjson.GetBytes(schema, "type").String() != "object" {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason(`The identity traits schema must be of "type": "object".`))
+	}
+
+	v := &StoredSchemaVersion{SchemaID: schemaID, Schema: schema}
+	runner, err := NewExtensionRunner(ExtensionRunnerIdentityMetaSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	runner.Register(compiler)
+	if err := compiler.AddResource(v.URL(), bytes.NewReader(schema)); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The identity traits schema is invalid: %s", err))
+	}
+	if _, err := compiler.Compile(v.URL()); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The identity traits schema is invalid: %s", err))
+	}
+
+	return v, nil
+}
+
+// URL returns the URL of the version. It embeds the schema, which works because versions never change.
+func (v *StoredSchemaVersion) URL() string {
+	return "base64://" + base64.RawURLEncoding.EncodeToString(v.Schema)
+}
+
+// VersionID returns the traits schema ID identities use to reference the version of the stored schema.
+func VersionID(schemaID string, version int) string {
+	return fmt.Sprintf("%s@%d", schemaID, version)
+}
@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStoredSchemaVersion(t *testing.T) {
+	for k, tc := range []struct {
+		id        string
+		schema    string
+		expectErr bool
+	}{
+		{id: "customer", schema: `{"type":"object","properties":{"email":{"type":"string","ory.sh/kratos":{"credentials":{"password":{"identifier":true}}}}}}`},
+		{id: "customer_v-2", schema: `{"type":"object"}`},
+		{id: "", schema: `{"type":"object"}`, expectErr: true},
+		{id: "customer@2", schema: `{"type":"object"}`, expectErr: true},
+		{id: "customer", schema: `{"type":"string"}`, expectErr: true},
+		{id: "customer", schema: `{"type":"object","properties":{"email":{"type":"string","ory.sh/kratos":{"unknown":true}}}}`, expectErr: true},
+		{id: "customer", schema: `{"type":"object","properties":{"email":{"$ref":"./email.schema.json"}}}`, expectErr: true},
+	} {
+		v, err := NewStoredSchemaVersion(tc.id, json.RawMessage(tc.schema))
+		if tc.expectErr {
+			require.Error(t, err, "%d", k)
+			continue
+		}
+
+		require.NoError(t, err, "%d", k)
+		assert.Equal(t, tc.id, v.SchemaID, "%d", k)
+	}
+
+	assert.Equal(t, "customer@2", VersionID("customer", 2))
+}
+
+func TestDiff(t *testing.T) {
+	changes, err := Diff(
+		json.RawMessage(`{"type":"object","properties":{"email":{"type":"string"},"name":{"type":"string"},"a/b":{"type":"string"}},"required":["email","name"]}`),
+		json.RawMessage(`{"type":"object","properties":{"email":{"type":"string","format":"email"},"name":{"type":"object"},"a/b":{"type":"string"}},"required":["email"]}`),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Op: "add", Path: "/properties/email/format", To: "email"},
+		{Op: "replace", Path: "/properties/name/type", From: "string", To: "object"},
+		{Op: "remove", Path: "/required/1", From: "name"},
+	}, changes)
+
+	changes, err = Diff(json.RawMessage(`{"properties":{"a/b~c":{}}}`), json.RawMessage(`{"properties":{}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Op: "remove", Path: "/properties/a~1b~0c", From: map[string]interface{}{}}}, changes)
+
+	changes, err = Diff(json.RawMessage(`{"type":"object"}`), json.RawMessage(`{"type":"object"}`))
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = Diff(json.RawMessage(`{`), json.RawMessage(`{}`))
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package schema
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -49,12 +50,18 @@ func (v *Validator) Validate(
 	if err != nil {
 		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to parse validate JSON object against JSON schema.").WithDebugf("%s", err))
 	}
+	defer resource.Close()
+
+	raw, err := ioutil.ReadAll(resource)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to parse validate JSON object against JSON schema.").WithDebugf("%s", err))
+	}
 
 	if o.e != nil {
 		o.e.Register(compiler)
 	}
 
-	if err := compiler.AddResource(href, resource); err != nil {
+	if err := compiler.AddResource(href, bytes.NewReader(raw)); err != nil {
 		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to parse validate JSON object against JSON schema.").WithDebugf("%s", err))
 	}
 
@@ -64,6 +71,9 @@ func (v *Validator) Validate(
 	}
 
 	if err := schema.Validate(bytes.NewBuffer(document)); err != nil {
+		if e, ok := err.(*jsonschema.ValidationError); ok {
+			overrideMessages(href, raw, e)
+		}
 		return errors.WithStack(err)
 	}
 
@@ -0,0 +1,112 @@
+// Package sdk is the Go client of ORY Kratos. It builds on the client generated from the API specification
+// (docs/api.swagger.json) and adds helpers for common tasks, for example logging in with a password, waiting for
+// an address to be verified or iterating over all identities.
+//
+//	c, err := sdk.New(sdk.Config{
+//		PublicURL: "https://auth.example.org",
+//		AdminURL:  "http://kratos-admin:4434",
+//		HTTPClient: &http.Client{
+//			Transport: &sdk.BearerTokenTransport{Token: os.Getenv("KRATOS_ADMIN_API_KEY")},
+//		},
+//	})
+package sdk
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	httptransport "github.com/go-openapi/runtime/client"
+
+	"github.com/ory/kratos/internal/httpclient/client"
+	"github.com/ory/kratos/internal/httpclient/models"
+)
+
+type (
+	// Identity is an identity as returned by the admin API.
+	Identity = models.Identity
+
+	// Session is a session as returned by the whoami endpoint.
+	Session = models.Session
+
+	// LoginRequest is a login request of the browser flow.
+	LoginRequest = models.LoginRequest
+
+	// RegistrationRequest is a registration request of the browser flow.
+	RegistrationRequest = models.RegistrationRequest
+
+	// VerificationRequest is a verification request of the browser flow.
+	VerificationRequest = models.VerificationRequest
+)
+
+// Config configures a Client.
+type Config struct {
+	// PublicURL is the URL of the public API (urls.self.public). It is required.
+	PublicURL string
+
+	// AdminURL is the URL of the admin API (urls.self.admin). Helpers using the admin API return an error if it
+	// is not set.
+	AdminURL string
+
+	// HTTPClient is used for all requests. Use SessionCookieTransport or BearerTokenTransport to authenticate the
+	// requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Client talks to the public and the admin API.
+type Client struct {
+	hc        *http.Client
+	publicURL *url.URL
+	public    *client.OryKratos
+	admin     *client.OryKratos
+}
+
+// New returns a client for the configured APIs.
+func New(c Config) (*Client, error) {
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	publicURL, err := url.ParseRequestURI(c.PublicURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse the public URL %s", c.PublicURL)
+	}
+
+	cl := &Client{hc: hc, publicURL: publicURL, public: newGeneratedClient(publicURL, hc)}
+	if len(c.AdminURL) > 0 {
+		adminURL, err := url.ParseRequestURI(c.AdminURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse the admin URL %s", c.AdminURL)
+		}
+		cl.admin = newGeneratedClient(adminURL, hc)
+	}
+
+	return cl, nil
+}
+
+func newGeneratedClient(u *url.URL, hc *http.Client) *client.OryKratos {
+	basePath := u.Path
+	if len(basePath) == 0 {
+		basePath = "/"
+	}
+	return client.New(httptransport.NewWithClient(u.Host, basePath, []string{u.Scheme}, hc), nil)
+}
+
+// Public returns the generated client of the public API. Use it for calls the helpers do not cover.
+func (c *Client) Public() *client.OryKratos {
+	return c.public
+}
+
+// Admin returns the generated client of the admin API or nil if no admin URL was configured.
+func (c *Client) Admin() *client.OryKratos {
+	return c.admin
+}
+
+func (c *Client) adminClient() (*client.OryKratos, error) {
+	if c.admin == nil {
+		return nil, errors.New("this helper uses the admin API but no admin URL was configured")
+	}
+	return c.admin, nil
+}
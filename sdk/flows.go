@@ -0,0 +1,326 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/internal/httpclient/client/common"
+	"github.com/ory/kratos/internal/httpclient/client/public"
+	"github.com/ory/kratos/internal/httpclient/models"
+)
+
+const (
+	browserLoginPath        = "/self-service/browser/flows/login"
+	browserRegistrationPath = "/self-service/browser/flows/registration"
+	csrfTokenName           = "csrf_token"
+	passwordMethod          = "password"
+)
+
+// FormError is returned if the submitted form was rejected, for example because the password was wrong.
+type FormError struct {
+	// Messages are the errors of the form itself.
+	Messages []string
+
+	// Fields are the errors of the form fields by the name of the field.
+	Fields map[string][]string
+}
+
+func (e *FormError) Error() string {
+	messages := append([]string{}, e.Messages...)
+
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, m := range e.Fields[name] {
+			messages = append(messages, fmt.Sprintf("%s: %s", name, m))
+		}
+	}
+
+	return "the form was rejected: " + strings.Join(messages, "; ")
+}
+
+func newFormError(errs []*models.Error, fields models.FormFields) error {
+	e := &FormError{Fields: map[string][]string{}}
+	for _, m := range errs {
+		e.Messages = append(e.Messages, m.Message)
+	}
+	for _, f := range fields {
+		if f.Name == nil {
+			continue
+		}
+		for _, m := range f.Errors {
+			e.Fields[*f.Name] = append(e.Fields[*f.Name], m.Message)
+		}
+	}
+
+	if len(e.Messages) == 0 && len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// LoginWithPassword runs the browser login flow of the password strategy like a browser would. It returns the
+// session and the cookies which were set, including the session cookie. A FormError is returned if the
+// credentials were rejected.
+func (c *Client) LoginWithPassword(ctx context.Context, identifier, password string) (*Session, []*http.Cookie, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	hc := &http.Client{
+		Jar:       jar,
+		Transport: c.hc.Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	requestID, err := c.initializeFlow(ctx, hc, browserLoginPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lr, err := c.loginRequest(ctx, hc, requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	method, ok := lr.Methods[passwordMethod]
+	if !ok || method.Config == nil || method.Config.Action == nil {
+		return nil, nil, errors.New("the password login method is not enabled")
+	}
+
+	values := url.Values{"identifier": {identifier}, "password": {password}}
+	for _, f := range method.Config.Fields {
+		if f.Name != nil && *f.Name == csrfTokenName {
+			values.Set(csrfTokenName, fmt.Sprintf("%v", f.Value))
+		}
+	}
+
+	if err := c.submitForm(ctx, hc, *method.Config.Action, values); err != nil {
+		return nil, nil, err
+	}
+
+	session, err := c.public.Public.Whoami(public.NewWhoamiParams().WithContext(ctx).WithHTTPClient(hc))
+	if err != nil {
+		// The browser was sent back to the login UI, the login request now contains the reason.
+		if lr, lerr := c.loginRequest(ctx, hc, requestID); lerr == nil {
+			if method, ok := lr.Methods[passwordMethod]; ok && method.Config != nil {
+				if ferr := newFormError(method.Config.Errors, method.Config.Fields); ferr != nil {
+					return nil, nil, ferr
+				}
+			}
+		}
+		return nil, nil, errors.WithStack(err)
+	}
+
+	return session.Payload, jar.Cookies(c.publicURL), nil
+}
+
+// RegisterWithPassword runs the browser registration flow of the password strategy like a browser would. Nested
+// traits are submitted as form fields like traits.name.first. It returns the session and the cookies which were
+// set. The session is nil if the registration hooks do not sign the new identity in. A FormError is returned if
+// the traits or the password were rejected.
+func (c *Client) RegisterWithPassword(ctx context.Context, traits map[string]interface{}, password string) (*Session, []*http.Cookie, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	hc := &http.Client{
+		Jar:       jar,
+		Transport: c.hc.Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	requestID, err := c.initializeFlow(ctx, hc, browserRegistrationPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rr, err := c.registrationRequest(ctx, hc, requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	method, ok := rr.Methods[passwordMethod]
+	if !ok || method.Config == nil || method.Config.Action == nil {
+		return nil, nil, errors.New("the password registration method is not enabled")
+	}
+
+	values := url.Values{"password": {password}}
+	addTraitValues(values, "traits", traits)
+	for _, f := range method.Config.Fields {
+		if f.Name != nil && *f.Name == csrfTokenName {
+			values.Set(csrfTokenName, fmt.Sprintf("%v", f.Value))
+		}
+	}
+
+	if err := c.submitForm(ctx, hc, *method.Config.Action, values); err != nil {
+		return nil, nil, err
+	}
+
+	session, err := c.public.Public.Whoami(public.NewWhoamiParams().WithContext(ctx).WithHTTPClient(hc))
+	if err != nil {
+		// Either the browser was sent back to the registration UI, in which case the registration request now
+		// contains the reason, or the hooks did not create a session.
+		rr, rerr := c.registrationRequest(ctx, hc, requestID)
+		if rerr != nil {
+			return nil, nil, rerr
+		}
+		if method, ok := rr.Methods[passwordMethod]; ok && method.Config != nil {
+			if ferr := newFormError(method.Config.Errors, method.Config.Fields); ferr != nil {
+				return nil, nil, ferr
+			}
+		}
+		return nil, jar.Cookies(c.publicURL), nil
+	}
+
+	return session.Payload, jar.Cookies(c.publicURL), nil
+}
+
+// addTraitValues adds the traits as form fields named like the traits in the identity schema, for example
+// traits.name.first.
+func addTraitValues(values url.Values, prefix string, traits map[string]interface{}) {
+	for key, value := range traits {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			addTraitValues(values, prefix+"."+key, v)
+		case []interface{}:
+			for _, item := range v {
+				values.Add(prefix+"."+key, fmt.Sprintf("%v", item))
+			}
+		default:
+			values.Set(prefix+"."+key, fmt.Sprintf("%v", v))
+		}
+	}
+}
+
+// Whoami returns the session the HTTP client of this client authenticates with, see SessionCookieTransport.
+func (c *Client) Whoami(ctx context.Context) (*Session, error) {
+	res, err := c.public.Public.Whoami(public.NewWhoamiParams().WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Payload, nil
+}
+
+func (c *Client) loginRequest(ctx context.Context, hc *http.Client, requestID string) (*LoginRequest, error) {
+	res, err := c.public.Common.GetSelfServiceBrowserLoginRequest(common.NewGetSelfServiceBrowserLoginRequestParams().
+		WithContext(ctx).WithHTTPClient(hc).WithRequest(requestID))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Payload, nil
+}
+
+func (c *Client) registrationRequest(ctx context.Context, hc *http.Client, requestID string) (*RegistrationRequest, error) {
+	res, err := c.public.Common.GetSelfServiceBrowserRegistrationRequest(common.NewGetSelfServiceBrowserRegistrationRequestParams().
+		WithContext(ctx).WithHTTPClient(hc).WithRequest(requestID))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Payload, nil
+}
+
+// initializeFlow starts a browser flow and returns the ID of its request, which is appended to the URL of the UI
+// the browser is redirected to.
+func (c *Client) initializeFlow(ctx context.Context, hc *http.Client, path string) (string, error) {
+	req, err := http.NewRequest("GET", urlJoin(c.publicURL, path), nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	res, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer drain(res.Body)
+
+	location, err := res.Location()
+	if err != nil {
+		return "", errors.Errorf("expected the flow to redirect to the UI but received status code %d", res.StatusCode)
+	}
+
+	requestID := location.Query().Get("request")
+	if len(requestID) == 0 {
+		return "", errors.Errorf("expected the flow to redirect to the UI but was redirected to %s, is a session active already?", location)
+	}
+	return requestID, nil
+}
+
+func (c *Client) submitForm(ctx context.Context, hc *http.Client, action string, values url.Values) error {
+	req, err := http.NewRequest("POST", action, strings.NewReader(values.Encode()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer drain(res.Body)
+
+	if res.StatusCode >= 400 {
+		return errors.Errorf("submitting the form to %s failed with status code %d", action, res.StatusCode)
+	}
+	return nil
+}
+
+// WaitForVerification polls the verification request using the admin API until the address was verified, the
+// request expired or the context is done.
+func (c *Client) WaitForVerification(ctx context.Context, requestID string, interval time.Duration) (*VerificationRequest, error) {
+	admin, err := c.adminClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		res, err := admin.Common.GetSelfServiceVerificationRequest(common.NewGetSelfServiceVerificationRequestParams().
+			WithContext(ctx).WithRequest(requestID))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		vr := res.Payload
+		if vr.Success {
+			return vr, nil
+		}
+		if time.Time(vr.ExpiresAt).Before(time.Now()) {
+			return vr, errors.Errorf("verification request %s expired before the address was verified", requestID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return vr, errors.WithStack(ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func urlJoin(u *url.URL, path string) string {
+	return strings.TrimRight(u.String(), "/") + path
+}
+
+func drain(body io.ReadCloser) {
+	_, _ = io.Copy(ioutil.Discard, body)
+	_ = body.Close()
+}
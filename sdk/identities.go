@@ -0,0 +1,143 @@
+package sdk
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/internal/httpclient/client/admin"
+)
+
+// DefaultPageSize is the number of identities an IdentityIterator fetches per request unless configured otherwise.
+const DefaultPageSize = 100
+
+// CreateIdentity creates an identity using the admin API.
+func (c *Client) CreateIdentity(ctx context.Context, i *Identity) (*Identity, error) {
+	a, err := c.adminClient()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := a.Admin.CreateIdentity(admin.NewCreateIdentityParams().WithContext(ctx).WithBody(i))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Payload, nil
+}
+
+// GetIdentity returns the identity with the given ID using the admin API.
+func (c *Client) GetIdentity(ctx context.Context, id string) (*Identity, error) {
+	a, err := c.adminClient()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := a.Admin.GetIdentity(admin.NewGetIdentityParams().WithContext(ctx).WithID(id))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Payload, nil
+}
+
+// UpdateIdentity replaces the identity with the given ID using the admin API.
+func (c *Client) UpdateIdentity(ctx context.Context, id string, i *Identity) (*Identity, error) {
+	a, err := c.adminClient()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := a.Admin.UpdateIdentity(admin.NewUpdateIdentityParams().WithContext(ctx).WithID(id).WithBody(i))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res.Payload, nil
+}
+
+// DeleteIdentity deletes the identity with the given ID using the admin API.
+func (c *Client) DeleteIdentity(ctx context.Context, id string) error {
+	a, err := c.adminClient()
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.Admin.DeleteIdentity(admin.NewDeleteIdentityParams().WithContext(ctx).WithID(id)); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Identities returns an iterator over all identities. Pages of pageSize identities are fetched as needed, a
+// pageSize below one uses DefaultPageSize.
+//
+//	it := c.Identities(0)
+//	for it.Next(ctx) {
+//		fmt.Println(it.Identity().ID)
+//	}
+//	if err := it.Err(); err != nil {
+//		// ...
+//	}
+func (c *Client) Identities(pageSize int) *IdentityIterator {
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	return &IdentityIterator{c: c, limit: int64(pageSize)}
+}
+
+// IdentityIterator iterates over all identities, see Client.Identities.
+type IdentityIterator struct {
+	c      *Client
+	limit  int64
+	offset int64
+
+	page    []*Identity
+	current *Identity
+	last    bool
+	err     error
+}
+
+// Next advances to the next identity. It returns false when all identities were returned or an error occurred.
+func (it *IdentityIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if len(it.page) == 0 {
+		if it.last {
+			return false
+		}
+		if it.err = it.fetch(ctx); it.err != nil || len(it.page) == 0 {
+			return false
+		}
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *IdentityIterator) fetch(ctx context.Context) error {
+	a, err := it.c.adminClient()
+	if err != nil {
+		return err
+	}
+
+	limit, offset := it.limit, it.offset
+	res, err := a.Admin.ListIdentities(admin.NewListIdentitiesParams().WithContext(ctx).WithLimit(&limit).WithOffset(&offset))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	it.page = res.Payload
+	it.offset += int64(len(res.Payload))
+	it.last = int64(len(res.Payload)) < it.limit
+	return nil
+}
+
+// Identity returns the identity Next advanced to.
+func (it *IdentityIterator) Identity() *Identity {
+	return it.current
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *IdentityIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,176 @@
+package sdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/sdk"
+	"github.com/ory/kratos/x"
+)
+
+func TestTransports(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie(sdk.DefaultSessionCookieName)
+		if c != nil {
+			_, _ = fmt.Fprintf(w, "cookie=%s ", c.Value)
+		}
+		_, _ = fmt.Fprintf(w, "authorization=%s", r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	for k, tc := range []struct {
+		t      http.RoundTripper
+		expect string
+	}{
+		{t: &sdk.SessionCookieTransport{Session: "foo"}, expect: "cookie=foo authorization="},
+		{t: &sdk.BearerTokenTransport{Token: "bar"}, expect: "authorization=Bearer bar"},
+		{t: &sdk.SessionCookieTransport{Session: "foo", Transport: &sdk.BearerTokenTransport{Token: "bar"}}, expect: "cookie=foo authorization=Bearer bar"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL, nil)
+			require.NoError(t, err)
+			res, err := (&http.Client{Transport: tc.t}).Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			var body [128]byte
+			n, _ := res.Body.Read(body[:])
+			assert.Equal(t, tc.expect, string(body[:n]))
+			assert.Empty(t, req.Header.Get("Authorization"), "the original request must not be modified")
+		})
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	newRequest := func(signature string) *http.Request {
+		r := httptest.NewRequest("POST", "/logout", strings.NewReader("logout_token=foo"))
+		r.Header.Set(sdk.SignatureHeader, signature)
+		return r
+	}
+
+	r := newRequest(x.Sign([]byte("logout_token=foo"), []string{"some-secret"}, time.Now()))
+	body, err := sdk.VerifyRequest(r, []string{"some-secret"}, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "logout_token=foo", string(body))
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "foo", r.PostForm.Get("logout_token"), "the body must be readable again")
+
+	_, err = sdk.VerifyRequest(newRequest(x.Sign([]byte("logout_token=foo"), []string{"other-secret"}, time.Now())), []string{"some-secret"}, time.Minute)
+	require.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	public, admin := x.NewRouterPublic(), x.NewRouterAdmin()
+	reg.LoginHandler().RegisterPublicRoutes(public)
+	reg.LoginStrategies().RegisterPublicRoutes(public)
+	reg.RegistrationHandler().RegisterPublicRoutes(public)
+	reg.RegistrationStrategies().RegisterPublicRoutes(public)
+	reg.SessionHandler().RegisterPublicRoutes(public)
+	reg.IdentityHandler().RegisterAdminRoutes(admin)
+	publicTS, adminTS := httptest.NewServer(public), httptest.NewServer(admin)
+	defer publicTS.Close()
+	defer adminTS.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfPublic, publicTS.URL)
+	viper.Set(configuration.ViperKeyURLsSelfAdmin, adminTS.URL)
+	viper.Set(configuration.ViperKeyURLsLogin, "http://ui.kratos.test/login")
+	viper.Set(configuration.ViperKeyURLsRegistration, "http://ui.kratos.test/registration")
+	viper.Set(configuration.ViperKeyURLsDefaultReturnTo, "http://ui.kratos.test/dashboard")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://../stub/test-identity.schema.json")
+	viper.Set(configuration.ViperKeySecretsSession, []string{"not-a-secure-session-key"})
+	viper.Set(configuration.ViperKeySelfServiceLoginAfterConfig+"."+string(identity.CredentialsTypePassword), []map[string]interface{}{{"job": "session"}})
+	viper.Set(configuration.ViperKeySelfServiceRegistrationAfterConfig+"."+string(identity.CredentialsTypePassword), []map[string]interface{}{{"job": "session"}})
+
+	c, err := sdk.New(sdk.Config{PublicURL: publicTS.URL, AdminURL: adminTS.URL})
+	require.NoError(t, err)
+
+	t.Run("method=identities", func(t *testing.T) {
+		var created []string
+		for i := 0; i < 5; i++ {
+			i, err := c.CreateIdentity(context.Background(), &sdk.Identity{
+				Traits: map[string]interface{}{"foobar": "bar", "username": fmt.Sprintf("user-%d", i)},
+			})
+			require.NoError(t, err)
+			created = append(created, string(i.ID))
+		}
+
+		i, err := c.GetIdentity(context.Background(), created[0])
+		require.NoError(t, err)
+		assert.Equal(t, created[0], string(i.ID))
+
+		var listed []string
+		it := c.Identities(2)
+		for it.Next(context.Background()) {
+			listed = append(listed, string(it.Identity().ID))
+		}
+		require.NoError(t, it.Err())
+		assert.ElementsMatch(t, created, listed)
+
+		require.NoError(t, c.DeleteIdentity(context.Background(), created[0]))
+		_, err = c.GetIdentity(context.Background(), created[0])
+		require.Error(t, err)
+	})
+
+	t.Run("method=LoginWithPassword", func(t *testing.T) {
+		p, err := reg.PasswordHasher().Generate([]byte("a-secure-password-123"))
+		require.NoError(t, err)
+		i := &identity.Identity{
+			ID:     x.NewUUID(),
+			Traits: identity.Traits(`{"foobar":"bar","username":"login-user"}`),
+			Credentials: map[identity.CredentialsType]identity.Credentials{
+				identity.CredentialsTypePassword: {
+					Type:        identity.CredentialsTypePassword,
+					Identifiers: []string{"login-user"},
+					Config:      json.RawMessage(`{"hashed_password":"` + string(p) + `"}`),
+				},
+			},
+		}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		session, cookies, err := c.LoginWithPassword(context.Background(), "login-user", "a-secure-password-123")
+		require.NoError(t, err)
+		assert.Equal(t, i.ID.String(), string(session.Identity.ID))
+		assert.NotEmpty(t, cookies)
+
+		_, _, err = c.LoginWithPassword(context.Background(), "login-user", "not-the-password")
+		require.Error(t, err)
+		_, ok := err.(*sdk.FormError)
+		assert.True(t, ok, "%+v", err)
+	})
+
+	t.Run("method=RegisterWithPassword", func(t *testing.T) {
+		session, cookies, err := c.RegisterWithPassword(context.Background(), map[string]interface{}{"foobar": "bar", "username": "registration-user"}, "a-secure-password-123")
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, "registration-user", session.Identity.Traits.(map[string]interface{})["username"])
+		assert.NotEmpty(t, cookies)
+
+		_, _, err = c.RegisterWithPassword(context.Background(), map[string]interface{}{"foobar": "b", "username": "another-user"}, "a-secure-password-123")
+		require.Error(t, err)
+		_, ok := err.(*sdk.FormError)
+		assert.True(t, ok, "%+v", err)
+	})
+
+	t.Run("case=admin url missing", func(t *testing.T) {
+		c, err := sdk.New(sdk.Config{PublicURL: publicTS.URL})
+		require.NoError(t, err)
+		_, err = c.GetIdentity(context.Background(), x.NewUUID().String())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,37 @@
+package sdk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/x"
+)
+
+// SignatureHeader carries the signatures of the requests ORY Kratos sends to hooks which have signing secrets,
+// for example back-channel logout endpoints.
+const SignatureHeader = x.SignatureHeader
+
+// VerifyRequest checks that a request to a hook was signed by ORY Kratos using one of the secrets at most
+// tolerance ago, and returns the body of the request. The body can be read again afterwards.
+//
+//	body, err := sdk.VerifyRequest(r, []string{os.Getenv("LOGOUT_SIGNING_SECRET")}, 5*time.Minute)
+//	if err != nil {
+//		w.WriteHeader(http.StatusUnauthorized)
+//		return
+//	}
+func VerifyRequest(r *http.Request, secrets []string, tolerance time.Duration) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := x.VerifySignature(r.Header.Get(SignatureHeader), body, secrets, tolerance, time.Now()); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,54 @@
+package sdk
+
+import (
+	"net/http"
+)
+
+// DefaultSessionCookieName is the name of the session cookie unless configured otherwise (security.session.cookie.name).
+const DefaultSessionCookieName = "ory_kratos_session"
+
+// SessionCookieTransport adds a session cookie to every request, for example to call the whoami endpoint on
+// behalf of a user.
+type SessionCookieTransport struct {
+	// Session is the value of the session cookie.
+	Session string
+
+	// CookieName defaults to DefaultSessionCookieName.
+	CookieName string
+
+	// Transport defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+func (t *SessionCookieTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	name := t.CookieName
+	if len(name) == 0 {
+		name = DefaultSessionCookieName
+	}
+
+	r = r.Clone(r.Context())
+	r.AddCookie(&http.Cookie{Name: name, Value: t.Session})
+	return roundTripper(t.Transport).RoundTrip(r)
+}
+
+// BearerTokenTransport sets the bearer token of every request, for example to an admin API key
+// (serve.admin.auth.api_keys).
+type BearerTokenTransport struct {
+	Token string
+
+	// Transport defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+func (t *BearerTokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.Token)
+	return roundTripper(t.Transport).RoundTrip(r)
+}
+
+func roundTripper(t http.RoundTripper) http.RoundTripper {
+	if t == nil {
+		return http.DefaultTransport
+	}
+	return t
+}
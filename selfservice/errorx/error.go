@@ -29,3 +29,28 @@ type ErrorContainer struct {
 func (e ErrorContainer) TableName() string {
 	return "selfservice_errors"
 }
+
+// AdminErrorContainer is an error container including the metadata administrators need to find it.
+//
+// swagger:model adminErrorContainer
+type AdminErrorContainer struct {
+	ID uuid.UUID `json:"id"`
+
+	// Errors contains the errors. Each error has a stable id which user interfaces can branch on.
+	Errors json.RawMessage `json:"errors"`
+
+	// CreatedAt is the time (UTC) the error occurred.
+	CreatedAt time.Time `json:"created_at"`
+
+	// SeenAt is the time (UTC) the error was last fetched by the user interface.
+	SeenAt *time.Time `json:"seen_at,omitempty"`
+}
+
+func NewAdminErrorContainer(e *ErrorContainer) AdminErrorContainer {
+	c := AdminErrorContainer{ID: e.ID, Errors: e.Errors, CreatedAt: e.CreatedAt}
+	if e.WasSeen && e.SeenAt.Valid {
+		seenAt := e.SeenAt.Time
+		c.SeenAt = &seenAt
+	}
+	return c
+}
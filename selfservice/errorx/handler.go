@@ -2,15 +2,23 @@ package errorx
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/nosurf"
 	"github.com/pkg/errors"
 
+	"github.com/ory/herodot"
+	"github.com/ory/x/pagination"
+
 	"github.com/ory/kratos/x"
 )
 
-const ErrorsPath = "/self-service/errors"
+const (
+	ErrorsPath     = "/self-service/errors"
+	ErrorsListPath = "/self-service/errors/list"
+)
 
 type (
 	handlerDependencies interface {
@@ -42,6 +50,7 @@ func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 
 func (h *Handler) RegisterAdminRoutes(public *x.RouterAdmin) {
 	public.GET(ErrorsPath, h.adminFetchError)
+	public.GET(ErrorsListPath, h.adminListErrors)
 }
 
 // User-facing error response
@@ -108,3 +117,104 @@ func (h *Handler) fetchError(w http.ResponseWriter, r *http.Request, mustVerify
 	h.r.Writer().Write(w, r, es)
 	return nil
 }
+
+// swagger:parameters listSelfServiceErrors
+// nolint:deadcode,unused
+type listErrorsParameters struct {
+	// Seen lists only errors which were (true) or were not yet (false) fetched by the user interface.
+	//
+	// in: query
+	Seen string `json:"seen"`
+
+	// CreatedAfter lists only errors which occurred after this time (RFC 3339).
+	//
+	// in: query
+	CreatedAfter string `json:"created_after"`
+
+	// CreatedBefore lists only errors which occurred before this time (RFC 3339).
+	//
+	// in: query
+	CreatedBefore string `json:"created_before"`
+
+	// in: query
+	Page int `json:"page"`
+
+	// in: query
+	PerPage int `json:"per_page"`
+}
+
+// A list of self-service errors.
+//
+// swagger:response errorContainerList
+// nolint:deadcode,unused
+type errorContainerListResponse struct {
+	// in: body
+	Body []AdminErrorContainer
+}
+
+// swagger:route GET /self-service/errors/list admin listSelfServiceErrors
+//
+// List self-service errors
+//
+// Lists the user-facing self-service errors, newest first. Listing errors does not mark them as seen.
+//
+// Each error has a stable `id` such as `self_service_flow_expired` or `validation_failed`, which does not change
+// when the error's message is reworded.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: errorContainerList
+//       400: genericError
+//       500: genericError
+func (h *Handler) adminListErrors(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	filter, err := parseListFilter(r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	ecs, err := h.r.SelfServiceErrorPersister().List(r.Context(), *filter, limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	out := make([]AdminErrorContainer, len(ecs))
+	for k := range ecs {
+		out[k] = NewAdminErrorContainer(&ecs[k])
+	}
+	h.r.Writer().Write(w, r, out)
+}
+
+func parseListFilter(r *http.Request) (*ListFilter, error) {
+	q := r.URL.Query()
+	f := new(ListFilter)
+
+	if v := q.Get("seen"); len(v) > 0 {
+		seen, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The seen query parameter must be true or false."))
+		}
+		f.Seen = &seen
+	}
+
+	for key, target := range map[string]*time.Time{
+		"created_after":  &f.CreatedAfter,
+		"created_before": &f.CreatedBefore,
+	} {
+		if v := q.Get(key); len(v) > 0 {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The %s query parameter must be formatted according to RFC 3339.", key).WithDebug(err.Error()))
+			}
+			*target = t
+		}
+	}
+
+	return f, nil
+}
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/nosurf"
@@ -26,6 +28,13 @@ import (
 	"github.com/ory/kratos/x"
 )
 
+func withID(t *testing.T, err error, id string) map[string]interface{} {
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(x.RequireJSONMarshal(t, err), &fields))
+	fields["id"] = id
+	return fields
+}
+
 func TestHandler(t *testing.T) {
 	_, reg := internal.NewRegistryDefault(t)
 	h := errorx.NewHandler(reg)
@@ -57,7 +66,7 @@ func TestHandler(t *testing.T) {
 			require.NoError(t, err)
 			return body
 		}
-		expectedError := x.MustEncodeJSON(t, []error{herodot.ErrNotFound.WithReason("foobar")})
+		expectedError := x.MustEncodeJSON(t, []interface{}{withID(t, herodot.ErrNotFound.WithReason("foobar"), errorx.ErrorIDNotFound)})
 
 		t.Run("call with valid csrf cookie", func(t *testing.T) {
 			jar, _ := cookiejar.New(nil)
@@ -129,9 +138,9 @@ func TestHandler(t *testing.T) {
 				actual, err := ioutil.ReadAll(res.Body)
 				require.NoError(t, err)
 
-				gg := make([]error, len(tc.gave))
+				gg := make([]interface{}, len(tc.gave))
 				for k, g := range tc.gave {
-					gg[k] = errorsx.Cause(g)
+					gg[k] = withID(t, errorsx.Cause(g), errorx.ErrorIDNotFound)
 				}
 
 				expected, err := json.Marshal(errorx.ErrorContainer{
@@ -147,4 +156,38 @@ func TestHandler(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("case=list", func(t *testing.T) {
+		router := x.NewRouterAdmin()
+		h.RegisterAdminRoutes(router)
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+
+		start := time.Now().UTC().Add(-time.Second)
+		expired, err := reg.SelfServiceErrorPersister().Add(context.Background(), "nosurf",
+			herodot.ErrBadRequest.WithReason("expired").WithDetail(errorx.DetailErrorID, errorx.ErrorIDFlowExpired))
+		require.NoError(t, err)
+
+		get := func(t *testing.T, query string, expectedCode int) string {
+			res, err := ts.Client().Get(ts.URL + errorx.ErrorsListPath + "?" + query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.EqualValues(t, expectedCode, res.StatusCode, "%s", body)
+			return string(body)
+		}
+
+		body := get(t, "seen=false&created_after="+url.QueryEscape(start.Format(time.RFC3339)), http.StatusOK)
+		assert.Equal(t, expired.String(), gjson.Get(body, "0.id").String(), body)
+		assert.Equal(t, errorx.ErrorIDFlowExpired, gjson.Get(body, "0.errors.0.id").String(), body)
+		assert.False(t, gjson.Get(body, "0.seen_at").Exists(), body)
+		assert.False(t, gjson.Get(body, "0.csrf_token").Exists(), body)
+
+		body = get(t, "seen=true&created_after="+url.QueryEscape(start.Format(time.RFC3339)), http.StatusOK)
+		assert.NotContains(t, body, expired.String())
+
+		_ = get(t, "seen=maybe", http.StatusBadRequest)
+		_ = get(t, "created_before=yesterday", http.StatusBadRequest)
+	})
 }
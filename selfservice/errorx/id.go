@@ -0,0 +1,85 @@
+package errorx
+
+import (
+	stderr "errors"
+
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+// DetailErrorID is the detail which carries the ID of an error tagged with WithDetail.
+const DetailErrorID = "error_id"
+
+// The IDs of self-service errors. Unlike the reason of an error, the ID does not change between releases, so user
+// interfaces can use it to decide what to show. Errors which were not tagged with a more specific ID are
+// identified by their status code.
+const (
+	ErrorIDBadRequest          = "bad_request"
+	ErrorIDUnauthorized        = "unauthorized"
+	ErrorIDForbidden           = "forbidden"
+	ErrorIDNotFound            = "not_found"
+	ErrorIDConflict            = "conflict"
+	ErrorIDGone                = "gone"
+	ErrorIDInternalServerError = "internal_server_error"
+
+	ErrorIDValidationFailed = "validation_failed"
+	ErrorIDCSRFTokenInvalid = x.CSRFErrorID
+	ErrorIDFlowExpired      = "self_service_flow_expired"
+	ErrorIDFlowBinding      = x.FlowBindingErrorID
+	ErrorIDAlreadyRedeemed  = identity.AlreadyRedeemedErrorID
+)
+
+// ErrorIDs lists all error IDs.
+var ErrorIDs = []string{
+	ErrorIDBadRequest,
+	ErrorIDUnauthorized,
+	ErrorIDForbidden,
+	ErrorIDNotFound,
+	ErrorIDConflict,
+	ErrorIDGone,
+	ErrorIDInternalServerError,
+	ErrorIDValidationFailed,
+	ErrorIDCSRFTokenInvalid,
+	ErrorIDFlowExpired,
+	ErrorIDFlowBinding,
+	ErrorIDAlreadyRedeemed,
+}
+
+var statusErrorIDs = map[int]string{
+	400: ErrorIDBadRequest,
+	401: ErrorIDUnauthorized,
+	403: ErrorIDForbidden,
+	404: ErrorIDNotFound,
+	409: ErrorIDConflict,
+	410: ErrorIDGone,
+}
+
+// ErrorID returns the ID of an error. Errors tagged with the DetailErrorID detail return that ID, JSON Schema
+// validation errors return ErrorIDValidationFailed, and all other errors are identified by their status code.
+func ErrorID(err error) string {
+	err = errorsx.Cause(err)
+	if u := stderr.Unwrap(err); u != nil {
+		err = u
+	}
+
+	if e, ok := err.(interface{ Details() map[string]interface{} }); ok {
+		if id, ok := e.Details()[DetailErrorID].(string); ok && len(id) > 0 {
+			return id
+		}
+	}
+
+	if _, ok := err.(*jsonschema.ValidationError); ok {
+		return ErrorIDValidationFailed
+	}
+
+	if e, ok := err.(interface{ StatusCode() int }); ok {
+		if id, ok := statusErrorIDs[e.StatusCode()]; ok {
+			return id
+		}
+	}
+
+	return ErrorIDInternalServerError
+}
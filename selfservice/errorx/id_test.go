@@ -0,0 +1,39 @@
+package errorx
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+func TestErrorID(t *testing.T) {
+	for k, tc := range []struct {
+		err    error
+		expect string
+	}{
+		{err: herodot.ErrBadRequest.WithReason("foo"), expect: ErrorIDBadRequest},
+		{err: herodot.ErrUnauthorized.WithReason("foo"), expect: ErrorIDUnauthorized},
+		{err: errors.WithStack(herodot.ErrNotFound.WithReason("foo")), expect: ErrorIDNotFound},
+		{err: &x.ErrGone, expect: ErrorIDGone},
+		{err: herodot.ErrInternalServerError.WithReason("foo"), expect: ErrorIDInternalServerError},
+		{err: errors.New("foo"), expect: ErrorIDInternalServerError},
+		{err: errors.WithStack(x.ErrInvalidCSRFToken), expect: ErrorIDCSRFTokenInvalid},
+		{err: errors.WithStack(x.NewErrFlowBindingInvalid()), expect: ErrorIDFlowBinding},
+		{err: errors.WithStack(&identity.ErrAlreadyRedeemed), expect: ErrorIDAlreadyRedeemed},
+		{err: herodot.ErrBadRequest.WithDetail(DetailErrorID, ErrorIDFlowExpired), expect: ErrorIDFlowExpired},
+		{err: fmt.Errorf("wrapped: %w", herodot.ErrForbidden.WithReason("foo")), expect: ErrorIDForbidden},
+		{err: errors.WithStack(&jsonschema.ValidationError{Message: "foo"}), expect: ErrorIDValidationFailed},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, tc.expect, ErrorID(tc.err))
+		})
+	}
+}
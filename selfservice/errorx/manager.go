@@ -8,6 +8,7 @@ import (
 	"github.com/ory/herodot"
 	"github.com/ory/x/urlx"
 
+	"github.com/ory/kratos/report"
 	"github.com/ory/kratos/x"
 )
 
@@ -17,6 +18,7 @@ type (
 		x.LoggingProvider
 		x.WriterProvider
 		x.CSRFTokenGeneratorProvider
+		report.Provider
 	}
 
 	Manager struct {
@@ -42,7 +44,8 @@ func NewManager(d managerDependencies, c baseManagerConfiguration) *Manager {
 // error url, appending the error ID.
 func (m *Manager) Create(ctx context.Context, w http.ResponseWriter, r *http.Request, errs ...error) (string, error) {
 	for _, err := range errs {
-		herodot.DefaultErrorLogger(m.d.Logger(), err).Errorf("An error occurred and is being forwarded to the error user interface.")
+		herodot.DefaultErrorLogger(x.ContextLogger(r.Context(), m.d.Logger()), err).Errorf("An error occurred and is being forwarded to the error user interface.")
+		m.d.ErrorReporter().Report(r, err)
 	}
 
 	id, emerr := m.d.SelfServiceErrorPersister().Add(ctx, m.d.GenerateCSRFToken(r), errs...)
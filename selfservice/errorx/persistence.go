@@ -28,6 +28,20 @@ type (
 		// Clear clears read containers that are older than a certain amount of time. If force is set to true, unread
 		// errors will be cleared as well.
 		Clear(ctx context.Context, olderThan time.Duration, force bool) error
+
+		// List returns the error containers matching the filter, newest first. Unlike Read, List does not mark
+		// the containers as read.
+		List(ctx context.Context, filter ListFilter, limit, offset int) ([]ErrorContainer, error)
+	}
+
+	// ListFilter narrows down the error containers returned by List.
+	ListFilter struct {
+		// Seen lists only containers which were read (true) or not read yet (false). Nil lists all containers.
+		Seen *bool
+
+		// CreatedAfter and CreatedBefore list only containers which were created in this time range.
+		CreatedAfter  time.Time
+		CreatedBefore time.Time
 	}
 
 	PersistenceProvider interface {
@@ -55,7 +69,7 @@ func TestPersister(p Persister) func(t *testing.T) {
 			actual, err := p.Read(context.Background(), actualID)
 			require.NoError(t, err)
 
-			assert.JSONEq(t, `{"code":404,"status":"Not Found","reason":"foobar","message":"The requested resource could not be found"}`, gjson.Get(toJSON(t, actual), "errors.0").String(), toJSON(t, actual))
+			assert.JSONEq(t, `{"id":"not_found","code":404,"status":"Not Found","reason":"foobar","message":"The requested resource could not be found"}`, gjson.Get(toJSON(t, actual), "errors.0").String(), toJSON(t, actual))
 		})
 
 		t.Run("case=clear", func(t *testing.T) {
@@ -72,5 +86,66 @@ func TestPersister(p Persister) func(t *testing.T) {
 			got, err := p.Read(context.Background(), actualID)
 			require.Error(t, err, "%+v", got)
 		})
+
+		t.Run("case=clear unread containers with force", func(t *testing.T) {
+			actualID, err := p.Add(context.Background(), "nosurf", herodot.ErrNotFound.WithReason("foobar"))
+			require.NoError(t, err)
+
+			require.NoError(t, p.Clear(context.Background(), time.Hour, true))
+			_, err = p.Read(context.Background(), actualID)
+			require.NoError(t, err, "containers younger than olderThan must be kept")
+
+			time.Sleep(time.Second + time.Millisecond*500)
+			require.NoError(t, p.Clear(context.Background(), time.Second, true))
+			_, err = p.Read(context.Background(), actualID)
+			require.Error(t, err)
+		})
+
+		t.Run("case=list", func(t *testing.T) {
+			start := time.Now().UTC().Add(-time.Second)
+
+			seenID, err := p.Add(context.Background(), "nosurf", herodot.ErrNotFound.WithReason("seen"))
+			require.NoError(t, err)
+			_, err = p.Read(context.Background(), seenID)
+			require.NoError(t, err)
+
+			// MySQL stores timestamps with second resolution, so wait for the newest first order to be stable.
+			time.Sleep(time.Second + time.Millisecond*100)
+			unseenID, err := p.Add(context.Background(), "nosurf", herodot.ErrBadRequest.WithReason("unseen"))
+			require.NoError(t, err)
+
+			ids := func(cs []ErrorContainer) []uuid.UUID {
+				var ids []uuid.UUID
+				for _, c := range cs {
+					ids = append(ids, c.ID)
+				}
+				return ids
+			}
+
+			all, err := p.List(context.Background(), ListFilter{CreatedAfter: start}, 100, 0)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{unseenID, seenID}, ids(all))
+			assert.Equal(t, "bad_request", gjson.GetBytes(all[0].Errors, "0.id").String(), "%s", all[0].Errors)
+
+			seen := true
+			actual, err := p.List(context.Background(), ListFilter{Seen: &seen, CreatedAfter: start}, 100, 0)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{seenID}, ids(actual))
+
+			seen = false
+			actual, err = p.List(context.Background(), ListFilter{Seen: &seen, CreatedAfter: start}, 100, 0)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{unseenID}, ids(actual))
+			assert.False(t, actual[0].WasSeen, "listing must not mark containers as read")
+
+			actual, err = p.List(context.Background(), ListFilter{CreatedBefore: start}, 100, 0)
+			require.NoError(t, err)
+			assert.NotContains(t, ids(actual), seenID)
+			assert.NotContains(t, ids(actual), unseenID)
+
+			actual, err = p.List(context.Background(), ListFilter{CreatedAfter: start}, 1, 1)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{seenID}, ids(actual))
+		})
 	}
 }
@@ -0,0 +1,120 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/randx"
+
+	"github.com/ory/kratos/x"
+)
+
+// userCodeAlphabet contains only upper-case consonants without vowels, which are easy to type on a phone and cannot
+// spell words, as recommended by RFC 8628.
+var userCodeAlphabet = []rune("BCDFGHJKLMNPQRSTVWXZ")
+
+const userCodeLength = 8
+
+// State is the state of a device authorization.
+type State string
+
+const (
+	// StatePending is the state of an authorization which has not been approved or denied yet.
+	StatePending State = "pending"
+	// StateApproved is the state of an authorization which was approved but for which the device did not receive
+	// a session yet.
+	StateApproved State = "approved"
+	// StateDenied is the state of an authorization which was denied.
+	StateDenied State = "denied"
+	// StateConsumed is the state of an authorization for which the device received a session.
+	StateConsumed State = "consumed"
+)
+
+// Authorization is a device's request to sign in. The device shows the user code, which the user enters at the
+// verification UI on another device on which they are signed in.
+type Authorization struct {
+	ID uuid.UUID `json:"-" faker:"uuid" db:"id"`
+
+	// DeviceCodeHash is the SHA-256 hash of the device code, which only the device knows.
+	DeviceCodeHash string `json:"-" faker:"-" db:"device_code_hash"`
+
+	// UserCode is the normalized user code, see NormalizeUserCode.
+	UserCode string `json:"-" faker:"-" db:"user_code"`
+
+	State State `json:"-" faker:"-" db:"state"`
+
+	// IdentityID is the identity which approved the authorization.
+	IdentityID uuid.NullUUID `json:"-" faker:"-" db:"identity_id"`
+
+	ExpiresAt time.Time `json:"-" faker:"time_type" db:"expires_at"`
+
+	// LastPolledAt is the time (UTC) the device last polled for a session.
+	LastPolledAt *time.Time `json:"-" faker:"-" db:"last_polled_at"`
+
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (a Authorization) TableName() string {
+	return "selfservice_device_authorizations"
+}
+
+// NewAuthorization returns a pending authorization which expires after the given lifespan and the device code
+// which only the device must know.
+func NewAuthorization(lifespan time.Duration) (*Authorization, string, error) {
+	deviceCode, err := randx.RuneSequence(32, randx.AlphaNum)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	userCode, err := randx.RuneSequence(userCodeLength, userCodeAlphabet)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	return &Authorization{
+		ID:             x.NewUUID(),
+		DeviceCodeHash: HashDeviceCode(string(deviceCode)),
+		UserCode:       string(userCode),
+		State:          StatePending,
+		ExpiresAt:      time.Now().UTC().Add(lifespan),
+	}, string(deviceCode), nil
+}
+
+// IsExpired returns true if the authorization can no longer be approved or exchanged for a session.
+func (a *Authorization) IsExpired() bool {
+	return !a.ExpiresAt.After(time.Now().UTC())
+}
+
+// HashDeviceCode returns the hash of the device code as it is stored. Device codes are stored hashed because they
+// can be exchanged for a session.
+func HashDeviceCode(deviceCode string) string {
+	sum := sha256.Sum256([]byte(deviceCode))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeUserCode upper-cases the user code and removes all characters which can not be part of it, so that
+// "bcdf-ghjk" and "BCDF GHJK" both match "BCDFGHJK".
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		for _, a := range userCodeAlphabet {
+			if r == a {
+				return r
+			}
+		}
+		return -1
+	}, strings.ToUpper(userCode))
+}
+
+// FormatUserCode returns the user code the way it is shown to users, e.g. "BCDF-GHJK".
+func FormatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
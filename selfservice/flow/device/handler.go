@@ -0,0 +1,505 @@
+package device
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// AuthorizationPath and TokenPath are called by the device which signs in.
+	AuthorizationPath = "/self-service/device/authorization"
+	TokenPath         = "/self-service/device/token"
+
+	// VerificationPath is called by the verification UI on the device on which the user is signed in.
+	VerificationPath = "/self-service/browser/flows/device/verification"
+
+	// ActionField is the name of the verification form field which is either ActionApprove or ActionDeny.
+	ActionField   = "action"
+	ActionApprove = "approve"
+	ActionDeny    = "deny"
+)
+
+// The error codes of the token endpoint, see RFC 8628 section 3.5.
+const (
+	ErrorInvalidRequest       = "invalid_request"
+	ErrorInvalidGrant         = "invalid_grant"
+	ErrorAuthorizationPending = "authorization_pending"
+	ErrorSlowDown             = "slow_down"
+	ErrorAccessDenied         = "access_denied"
+	ErrorExpiredToken         = "expired_token"
+)
+
+var _ login.PostHookExecutor = new(Handler)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		errorx.ManagementProvider
+		identity.PrivilegedPoolProvider
+		login.HookExecutorProvider
+		session.ManagementProvider
+		x.CSRFTokenGeneratorProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		DeviceAuthorizationHandler() *Handler
+	}
+	Handler struct {
+		d handlerDependencies
+		c configuration.Provider
+
+		limiter *x.RateLimiter
+	}
+)
+
+// DeviceAuthorization is returned to the device which wants to sign in. The device shows the user code and the
+// verification URI, or the complete verification URI as a QR code, and polls the token endpoint using the device
+// code.
+//
+// swagger:model deviceAuthorization
+type DeviceAuthorization struct {
+	// DeviceCode is the secret the device exchanges for a session at the token endpoint.
+	//
+	// required: true
+	DeviceCode string `json:"device_code"`
+
+	// UserCode is the code the user enters at the verification URI.
+	//
+	// required: true
+	UserCode string `json:"user_code"`
+
+	// VerificationURI is the URL of the page where the user enters the user code.
+	//
+	// required: true
+	VerificationURI string `json:"verification_uri"`
+
+	// VerificationURIComplete is the verification URI which contains the user code already.
+	//
+	// required: true
+	VerificationURIComplete string `json:"verification_uri_complete"`
+
+	// ExpiresIn is the number of seconds after which the device code and the user code expire.
+	//
+	// required: true
+	ExpiresIn int `json:"expires_in"`
+
+	// Interval is the minimum number of seconds the device must wait between polling the token endpoint.
+	//
+	// required: true
+	Interval int `json:"interval"`
+}
+
+// TokenError is returned by the token endpoint while the device can not sign in.
+//
+// swagger:model deviceTokenError
+type TokenError struct {
+	// Error is one of "authorization_pending", "slow_down", "access_denied", "expired_token", "invalid_grant",
+	// or "invalid_request".
+	//
+	// required: true
+	Error string `json:"error"`
+
+	// ErrorDescription is a human-readable description of the error.
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Verification is returned to the verification UI, which lets the user approve or deny the device's sign in by
+// submitting the form.
+//
+// swagger:model deviceVerification
+type Verification struct {
+	// UserCode is the user code of the device.
+	//
+	// required: true
+	UserCode string `json:"user_code"`
+
+	// State is either "pending", "approved", "denied", or "consumed" once the device signed in.
+	//
+	// required: true
+	State State `json:"state"`
+
+	// ExpiresAt is the time (UTC) when the user code expires.
+	//
+	// required: true
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Form approves the device's sign in if it is submitted with the action field set to "approve", and denies it
+	// if the action field is set to "deny".
+	//
+	// required: true
+	Form *form.HTMLForm `json:"form"`
+}
+
+func NewHandler(d handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{
+		d:       d,
+		c:       c,
+		limiter: x.NewRateLimiter(c.SelfServiceDeviceAuthorization().RateLimit, time.Minute),
+	}
+}
+
+func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
+	public.POST(AuthorizationPath, h.authorize)
+	public.POST(TokenPath, h.token)
+	public.GET(VerificationPath, h.fetchVerification)
+	public.POST(VerificationPath, h.submitVerification)
+}
+
+// allow returns an error if the flow is disabled or the client exceeded the rate limit of the endpoint.
+func (h *Handler) allow(r *http.Request, endpoint string) error {
+	if !h.c.SelfServiceDeviceAuthorization().Enabled {
+		return errors.WithStack(herodot.ErrNotFound.WithReason("The device authorization flow is disabled."))
+	}
+
+	if ip := x.ClientIP(r); !h.limiter.Allow(endpoint + " " + ip.String()) {
+		x.ContextLogger(r.Context(), h.d.Logger()).
+			WithField("client_ip", ip.String()).
+			WithField("endpoint", endpoint).
+			Warn("Denied device authorization request because the client exceeded the rate limit.")
+		return errors.WithStack(&x.ErrTooManyRequests)
+	}
+	return nil
+}
+
+// swagger:route POST /self-service/device/authorization public initializeSelfServiceDeviceAuthorization
+//
+// Initialize the sign in of a device
+//
+// This endpoint lets devices with limited input, such as TVs and CLIs, sign in. The device shows the returned user
+// code and asks the user to enter it at the verification URI on another device on which they are signed in. In the
+// meantime, the device polls the token endpoint using the returned device code.
+//
+// This endpoint must be enabled using `selfservice.device.enabled` and is rate limited per client IP address.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: deviceAuthorization
+//       404: genericError
+//       429: genericError
+//       500: genericError
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := h.allow(r, AuthorizationPath); err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	conf := h.c.SelfServiceDeviceAuthorization()
+
+	var a *Authorization
+	var deviceCode string
+	// User codes are short, so they might collide with the code of another device.
+	for k := 0; k < 3; k++ {
+		var err error
+		if a, deviceCode, err = NewAuthorization(conf.Lifespan); err != nil {
+			h.d.Writer().WriteError(w, r, err)
+			return
+		}
+
+		err = h.d.DeviceAuthorizationPersister().CreateDeviceAuthorization(r.Context(), a)
+		if err == nil {
+			break
+		} else if errorsx.Cause(err) != sqlcon.ErrUniqueViolation || k == 2 {
+			h.d.Writer().WriteError(w, r, err)
+			return
+		}
+	}
+
+	userCode := FormatUserCode(a.UserCode)
+	w.Header().Set("Cache-Control", "no-store")
+	h.d.Writer().Write(w, r, &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         h.c.DeviceVerificationURL().String(),
+		VerificationURIComplete: urlx.CopyWithQuery(h.c.DeviceVerificationURL(), url.Values{"user_code": {userCode}}).String(),
+		ExpiresIn:               int(conf.Lifespan.Seconds()),
+		Interval:                int(conf.PollInterval.Seconds()),
+	})
+}
+
+// nolint:deadcode,unused
+// swagger:parameters exchangeSelfServiceDeviceCode
+type exchangeSelfServiceDeviceCodeParameters struct {
+	// DeviceCode is the device code returned by the device authorization endpoint.
+	//
+	// required: true
+	// in: formData
+	DeviceCode string `json:"device_code"`
+}
+
+// swagger:route POST /self-service/device/token public exchangeSelfServiceDeviceCode
+//
+// Exchange a device code for a session
+//
+// The device polls this endpoint until the user approved or denied its sign in. While the sign in has not been
+// approved, this endpoint responds with 400 Bad Request and the error "authorization_pending". If the device
+// polls more often than the interval returned by the device authorization endpoint, the error is "slow_down".
+//
+// Once approved, the session is returned and set as session cookie, which the device sends with subsequent
+// requests. A device code can only be exchanged once.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: session
+//       400: deviceTokenError
+//       404: genericError
+//       429: genericError
+//       500: genericError
+func (h *Handler) token(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := h.allow(r, TokenPath); err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := r.ParseForm(); err != nil {
+		h.writeTokenError(w, r, ErrorInvalidRequest, "Unable to parse the request.")
+		return
+	}
+
+	deviceCode := r.PostForm.Get("device_code")
+	if len(deviceCode) == 0 {
+		h.writeTokenError(w, r, ErrorInvalidRequest, "The device_code field must be set.")
+		return
+	}
+
+	a, err := h.d.DeviceAuthorizationPersister().GetDeviceAuthorizationByDeviceCode(r.Context(), HashDeviceCode(deviceCode))
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		h.writeTokenError(w, r, ErrorInvalidGrant, "The device code is invalid.")
+		return
+	} else if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if a.IsExpired() {
+		h.writeTokenError(w, r, ErrorExpiredToken, "The device code has expired.")
+		return
+	}
+
+	if err := h.d.DeviceAuthorizationPersister().MarkDeviceAuthorizationPolled(r.Context(), a.ID, h.c.SelfServiceDeviceAuthorization().PollInterval); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		h.writeTokenError(w, r, ErrorSlowDown, "The device polled too often.")
+		return
+	} else if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	switch a.State {
+	case StateApproved:
+	case StatePending:
+		h.writeTokenError(w, r, ErrorAuthorizationPending, "The sign in has not been approved yet.")
+		return
+	case StateDenied:
+		h.writeTokenError(w, r, ErrorAccessDenied, "The sign in was denied.")
+		return
+	default:
+		h.writeTokenError(w, r, ErrorInvalidGrant, "The device code was used already.")
+		return
+	}
+
+	// Two requests might poll concurrently, only one of them may receive a session.
+	if err := h.d.DeviceAuthorizationPersister().UpdateDeviceAuthorizationState(r.Context(), a.ID, StateApproved, StateConsumed, a.IdentityID); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		h.writeTokenError(w, r, ErrorInvalidGrant, "The device code was used already.")
+		return
+	} else if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	i, err := h.d.PrivilegedIdentityPool().GetIdentity(r.Context(), a.IdentityID.UUID)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	// The device signs in like any other login, except that it is not asked for a second factor. Its session is
+	// therefore not second factor authenticated, even if the session which approved it was.
+	if err := h.d.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypeDevice, []login.PostHookExecutor{h}, nil, i); err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+}
+
+// ExecuteLoginPostHook issues the session of the device and returns it in the response of the token endpoint.
+func (h *Handler) ExecuteLoginPostHook(w http.ResponseWriter, r *http.Request, _ *login.Request, s *session.Session) error {
+	s.AuthenticatedAt = time.Now().UTC()
+	if err := h.d.SessionManager().IssueToRequest(r.Context(), s, w, r); err != nil {
+		return err
+	}
+
+	h.d.Writer().Write(w, r, s)
+	return nil
+}
+
+func (h *Handler) writeTokenError(w http.ResponseWriter, r *http.Request, code, description string) {
+	h.d.Writer().WriteCode(w, r, http.StatusBadRequest, &TokenError{Error: code, ErrorDescription: description})
+}
+
+// verificationRequest returns the authorization of the `user_code` query parameter and the session of the device
+// on which the user enters it.
+func (h *Handler) verificationRequest(w http.ResponseWriter, r *http.Request) (*Authorization, *session.Session, error) {
+	if err := h.allow(r, VerificationPath); err != nil {
+		return nil, nil, err
+	}
+
+	sess, err := h.d.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userCode := NormalizeUserCode(r.URL.Query().Get("user_code"))
+	if len(userCode) != userCodeLength {
+		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The user_code query parameter is missing or invalid."))
+	}
+
+	a, err := h.d.DeviceAuthorizationPersister().GetDeviceAuthorizationByUserCode(r.Context(), userCode)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		return nil, nil, errors.WithStack(herodot.ErrNotFound.WithReason("The code is invalid or has expired."))
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if a.IsExpired() {
+		return nil, nil, errors.WithStack(herodot.ErrNotFound.WithReason("The code is invalid or has expired."))
+	}
+
+	return a, sess, nil
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getSelfServiceDeviceVerification completeSelfServiceDeviceVerification
+type getSelfServiceDeviceVerificationParameters struct {
+	// UserCode is the code shown by the device.
+	//
+	// required: true
+	// in: query
+	UserCode string `json:"user_code"`
+}
+
+// swagger:route GET /self-service/browser/flows/device/verification public getSelfServiceDeviceVerification
+//
+// Get the sign in of a device
+//
+// The verification UI (`urls.device_verification_ui`) uses this endpoint to look up the user code the user
+// entered. It requires a session, so the verification UI should start the login flow if it receives 401
+// Unauthorized. User codes are short, so this endpoint is rate limited per client IP address.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: deviceVerification
+//       400: genericError
+//       401: genericError
+//       404: genericError
+//       429: genericError
+//       500: genericError
+func (h *Handler) fetchVerification(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	a, _, err := h.verificationRequest(w, r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	userCode := FormatUserCode(a.UserCode)
+	f := form.NewHTMLForm(urlx.CopyWithQuery(
+		urlx.AppendPaths(h.c.SelfPublicURL(), VerificationPath),
+		url.Values{"user_code": {userCode}},
+	).String())
+	f.SetField(form.Field{Name: ActionField, Type: "submit", Required: true})
+	f.SetCSRF(h.d.GenerateCSRFToken(r))
+
+	h.d.Writer().Write(w, r, &Verification{
+		UserCode:  userCode,
+		State:     a.State,
+		ExpiresAt: a.ExpiresAt,
+		Form:      f,
+	})
+}
+
+// swagger:route POST /self-service/browser/flows/device/verification public completeSelfServiceDeviceVerification
+//
+// Approve or deny the sign in of a device
+//
+// The device is signed in as the identity of the current session if the form is submitted with the action field
+// set to "approve". The browser is redirected back to the verification UI afterwards.
+//
+// > This endpoint is NOT INTENDED for API clients and only works with browsers (Chrome, Firefox, ...) and HTML Forms.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       500: genericError
+func (h *Handler) submitVerification(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	a, sess, err := h.verificationRequest(w, r)
+	if err != nil {
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	var to State
+	var iid uuid.NullUUID
+	switch r.PostForm.Get(ActionField) {
+	case ActionApprove:
+		to, iid = StateApproved, uuid.NullUUID{UUID: sess.IdentityID, Valid: true}
+	case ActionDeny:
+		to = StateDenied
+	default:
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The %s field must be either "%s" or "%s".`, ActionField, ActionApprove, ActionDeny)))
+		return
+	}
+
+	if err := h.d.DeviceAuthorizationPersister().UpdateDeviceAuthorizationState(r.Context(), a.ID, StatePending, to, iid); err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			err = errors.WithStack(herodot.ErrBadRequest.WithReason("The sign in of the device was already approved or denied."))
+		}
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(h.c.DeviceVerificationURL(), url.Values{"user_code": {FormatUserCode(a.UserCode)}}).String(),
+		http.StatusFound,
+	)
+}
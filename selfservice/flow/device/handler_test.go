@@ -0,0 +1,233 @@
+package device_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/schedule"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/device"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	conf, reg := internal.NewRegistryDefault(t)
+
+	router := x.NewRouterPublic()
+	router.GET("/mock-session", session.MockSetSession(t, reg))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	errTs := errorx.NewErrorTestServer(t, reg)
+	defer errTs.Close()
+	verificationTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer verificationTs.Close()
+
+	viper.Set(configuration.ViperKeyURLsError, errTs.URL+"/error-ts")
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyURLsDeviceVerification, verificationTs.URL+"/device")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceDevicePollInterval, "0s")
+	viper.Set(configuration.ViperKeySelfServiceDeviceRateLimit, 0)
+
+	reg.DeviceAuthorizationHandler().RegisterPublicRoutes(router)
+
+	authorize := func(t *testing.T) (*http.Response, []byte) {
+		res, err := http.PostForm(ts.URL+device.AuthorizationPath, url.Values{})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	newDevice := func(t *testing.T) (deviceCode, userCode string) {
+		res, body := authorize(t)
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		return gjson.GetBytes(body, "device_code").String(), gjson.GetBytes(body, "user_code").String()
+	}
+
+	poll := func(t *testing.T, c *http.Client, deviceCode string) (*http.Response, []byte) {
+		res, err := c.PostForm(ts.URL+device.TokenPath, url.Values{"device_code": {deviceCode}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	assertTokenError := func(t *testing.T, c *http.Client, deviceCode, expected string) {
+		res, body := poll(t, c, deviceCode)
+		assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+		assert.Equal(t, expected, gjson.GetBytes(body, "error").String(), "%s", body)
+	}
+
+	newPhone := func(t *testing.T) *http.Client {
+		c := session.MockCookieClient(t)
+		session.MockHydrateCookieClient(t, c, ts.URL+"/mock-session")
+		c.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		return c
+	}
+
+	verificationURL := func(userCode string) string {
+		return ts.URL + device.VerificationPath + "?" + url.Values{"user_code": {userCode}}.Encode()
+	}
+
+	submitVerification := func(t *testing.T, c *http.Client, userCode, action string) *http.Response {
+		res, err := c.PostForm(verificationURL(userCode), url.Values{
+			device.ActionField: {action},
+			form.CSRFTokenName: {x.FakeCSRFToken},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return res
+	}
+
+	t.Run("case=disabled", func(t *testing.T) {
+		res, _ := authorize(t)
+		assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	viper.Set(configuration.ViperKeySelfServiceDeviceEnabled, true)
+
+	t.Run("case=approves the device", func(t *testing.T) {
+		res, body := authorize(t)
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		deviceCode, userCode := gjson.GetBytes(body, "device_code").String(), gjson.GetBytes(body, "user_code").String()
+		assert.Len(t, deviceCode, 32)
+		assert.Regexp(t, "^[A-Z]{4}-[A-Z]{4}$", userCode)
+		assert.Equal(t, verificationTs.URL+"/device", gjson.GetBytes(body, "verification_uri").String())
+		assert.Equal(t, verificationTs.URL+"/device?user_code="+userCode, gjson.GetBytes(body, "verification_uri_complete").String())
+		assert.EqualValues(t, 600, gjson.GetBytes(body, "expires_in").Int())
+
+		tv := session.MockCookieClient(t)
+		assertTokenError(t, tv, deviceCode, device.ErrorAuthorizationPending)
+
+		phone := newPhone(t)
+		res, body = x.EasyGet(t, phone, verificationURL(strings.ToLower(userCode)))
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, userCode, gjson.GetBytes(body, "user_code").String())
+		assert.EqualValues(t, device.StatePending, gjson.GetBytes(body, "state").String())
+		assert.Equal(t, verificationURL(userCode), gjson.GetBytes(body, "form.action").String())
+
+		res = submitVerification(t, phone, userCode, device.ActionApprove)
+		require.EqualValues(t, http.StatusFound, res.StatusCode)
+		assert.Equal(t, verificationTs.URL+"/device?user_code="+userCode, res.Header.Get("Location"))
+
+		a, err := reg.DeviceAuthorizationPersister().GetDeviceAuthorizationByUserCode(context.Background(), device.NormalizeUserCode(userCode))
+		require.NoError(t, err)
+		assert.Equal(t, device.StateApproved, a.State)
+
+		res, body = poll(t, tv, deviceCode)
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, a.IdentityID.UUID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+
+		var found bool
+		for _, c := range res.Cookies() {
+			found = found || c.Name == session.DefaultSessionCookieName
+		}
+		assert.True(t, found, "the device receives the session cookie")
+		assert.False(t, gjson.GetBytes(body, "second_factor_authenticated").Bool(), "%s", body)
+
+		events, err := reg.SessionPersister().ListLoginEvents(context.Background(), a.IdentityID.UUID)
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, identity.CredentialsTypeDevice, events[0].Method)
+
+		assertTokenError(t, tv, deviceCode, device.ErrorInvalidGrant)
+
+		res = submitVerification(t, phone, userCode, device.ActionDeny)
+		assert.Contains(t, res.Header.Get("Location"), errTs.URL, "the sign in can not be denied once it was approved")
+	})
+
+	t.Run("case=does not sign in deactivated identities", func(t *testing.T) {
+		deviceCode, userCode := newDevice(t)
+		require.EqualValues(t, http.StatusFound, submitVerification(t, newPhone(t), userCode, device.ActionApprove).StatusCode)
+
+		a, err := reg.DeviceAuthorizationPersister().GetDeviceAuthorizationByUserCode(context.Background(), device.NormalizeUserCode(userCode))
+		require.NoError(t, err)
+		require.NoError(t, reg.ScheduledActionPersister().DeactivateIdentity(context.Background(), &schedule.Deactivation{
+			IdentityID: a.IdentityID.UUID, ActionID: x.NewUUID(), CreatedAt: time.Now().UTC()}))
+
+		res, body := poll(t, session.MockCookieClient(t), deviceCode)
+		assert.EqualValues(t, http.StatusForbidden, res.StatusCode, "%s", body)
+		assert.Empty(t, res.Cookies())
+	})
+
+	t.Run("case=denies the device", func(t *testing.T) {
+		deviceCode, userCode := newDevice(t)
+
+		res := submitVerification(t, newPhone(t), userCode, device.ActionDeny)
+		require.EqualValues(t, http.StatusFound, res.StatusCode)
+
+		assertTokenError(t, session.MockCookieClient(t), deviceCode, device.ErrorAccessDenied)
+	})
+
+	t.Run("case=requires a session to verify the device", func(t *testing.T) {
+		_, userCode := newDevice(t)
+
+		res, _ := x.EasyGet(t, new(http.Client), verificationURL(userCode))
+		assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("case=rejects unknown codes", func(t *testing.T) {
+		res, _ := x.EasyGet(t, newPhone(t), verificationURL("BCDF-GHJK"))
+		assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+
+		res, _ = x.EasyGet(t, newPhone(t), verificationURL("AEIOU"))
+		assert.EqualValues(t, http.StatusBadRequest, res.StatusCode)
+
+		assertTokenError(t, new(http.Client), "does-not-exist", device.ErrorInvalidGrant)
+		assertTokenError(t, new(http.Client), "", device.ErrorInvalidRequest)
+	})
+
+	t.Run("case=tells the device to slow down", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceDevicePollInterval, "1h")
+		defer viper.Set(configuration.ViperKeySelfServiceDevicePollInterval, "0s")
+
+		deviceCode, _ := newDevice(t)
+		assertTokenError(t, new(http.Client), deviceCode, device.ErrorAuthorizationPending)
+		assertTokenError(t, new(http.Client), deviceCode, device.ErrorSlowDown)
+	})
+
+	t.Run("case=rate limits clients", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceDeviceRateLimit, 1)
+		defer viper.Set(configuration.ViperKeySelfServiceDeviceRateLimit, 0)
+
+		limited := x.NewRouterPublic()
+		device.NewHandler(reg, conf).RegisterPublicRoutes(limited)
+		lts := httptest.NewServer(limited)
+		defer lts.Close()
+
+		res, err := http.PostForm(lts.URL+device.AuthorizationPath, url.Values{})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.EqualValues(t, http.StatusOK, res.StatusCode)
+
+		res, err = http.PostForm(lts.URL+device.AuthorizationPath, url.Values{})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.EqualValues(t, http.StatusTooManyRequests, res.StatusCode)
+	})
+}
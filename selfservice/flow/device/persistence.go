@@ -0,0 +1,115 @@
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+)
+
+type (
+	PersistenceProvider interface {
+		DeviceAuthorizationPersister() Persister
+	}
+	Persister interface {
+		CreateDeviceAuthorization(ctx context.Context, a *Authorization) error
+
+		// GetDeviceAuthorizationByDeviceCode returns the authorization with the hashed device code, see HashDeviceCode.
+		GetDeviceAuthorizationByDeviceCode(ctx context.Context, deviceCodeHash string) (*Authorization, error)
+
+		// GetDeviceAuthorizationByUserCode returns the authorization with the normalized user code, see
+		// NormalizeUserCode.
+		GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*Authorization, error)
+
+		// UpdateDeviceAuthorizationState changes the state of the authorization if it is still in state from and
+		// has not expired. It returns sqlcon.ErrNoRows otherwise.
+		UpdateDeviceAuthorizationState(ctx context.Context, id uuid.UUID, from, to State, identityID uuid.NullUUID) error
+
+		// MarkDeviceAuthorizationPolled records that the device polled for a session. It returns sqlcon.ErrNoRows
+		// if the device polled within the interval already.
+		MarkDeviceAuthorizationPolled(ctx context.Context, id uuid.UUID, interval time.Duration) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		t.Run("case=should error when the authorization does not exist", func(t *testing.T) {
+			_, err := p.GetDeviceAuthorizationByDeviceCode(context.Background(), HashDeviceCode("does-not-exist"))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+			_, err = p.GetDeviceAuthorizationByUserCode(context.Background(), "BCDFGHJK")
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
+
+		t.Run("case=should create and fetch an authorization", func(t *testing.T) {
+			expected, deviceCode, err := NewAuthorization(time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateDeviceAuthorization(context.Background(), expected))
+
+			actual, err := p.GetDeviceAuthorizationByDeviceCode(context.Background(), HashDeviceCode(deviceCode))
+			require.NoError(t, err)
+			assert.Equal(t, expected.ID, actual.ID)
+			assert.Equal(t, StatePending, actual.State)
+			assert.False(t, actual.IdentityID.Valid)
+
+			actual, err = p.GetDeviceAuthorizationByUserCode(context.Background(), expected.UserCode)
+			require.NoError(t, err)
+			assert.Equal(t, expected.ID, actual.ID)
+		})
+
+		t.Run("case=should only update the state if it did not change", func(t *testing.T) {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+			a, _, err := NewAuthorization(time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateDeviceAuthorization(context.Background(), a))
+
+			iid := uuid.NullUUID{UUID: i.ID, Valid: true}
+			require.NoError(t, p.UpdateDeviceAuthorizationState(context.Background(), a.ID, StatePending, StateApproved, iid))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UpdateDeviceAuthorizationState(context.Background(), a.ID, StatePending, StateDenied, uuid.NullUUID{})))
+
+			actual, err := p.GetDeviceAuthorizationByUserCode(context.Background(), a.UserCode)
+			require.NoError(t, err)
+			assert.Equal(t, StateApproved, actual.State)
+			assert.Equal(t, iid, actual.IdentityID)
+
+			require.NoError(t, p.UpdateDeviceAuthorizationState(context.Background(), a.ID, StateApproved, StateConsumed, iid))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UpdateDeviceAuthorizationState(context.Background(), a.ID, StateApproved, StateConsumed, iid)))
+		})
+
+		t.Run("case=should not update the state of expired authorizations", func(t *testing.T) {
+			a, _, err := NewAuthorization(-time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateDeviceAuthorization(context.Background(), a))
+
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UpdateDeviceAuthorizationState(context.Background(), a.ID, StatePending, StateDenied, uuid.NullUUID{})))
+		})
+
+		t.Run("case=should enforce the polling interval", func(t *testing.T) {
+			a, _, err := NewAuthorization(time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateDeviceAuthorization(context.Background(), a))
+
+			require.NoError(t, p.MarkDeviceAuthorizationPolled(context.Background(), a.ID, time.Hour))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.MarkDeviceAuthorizationPolled(context.Background(), a.ID, time.Hour)))
+			require.NoError(t, p.MarkDeviceAuthorizationPolled(context.Background(), a.ID, 0))
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package inspect
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	KindLogin        Kind = "login"
+	KindRegistration Kind = "registration"
+	KindProfile      Kind = "profile"
+	KindVerification Kind = "verification"
+
+	// StateActive flows can still be completed.
+	StateActive State = "active"
+	// StateExpired flows have expired before they were completed.
+	StateExpired State = "expired"
+	// StateCompleted flows were completed successfully. Only profile and verification flows record this.
+	StateCompleted State = "completed"
+)
+
+// Kinds lists all kinds of self-service flows which can be inspected.
+var Kinds = []Kind{KindLogin, KindRegistration, KindProfile, KindVerification}
+
+type (
+	// Kind is the type of a self-service flow.
+	Kind string
+
+	// State describes whether a flow can still be completed.
+	State string
+
+	// Flow is the summary of a self-service flow as seen by administrators.
+	//
+	// swagger:model inspectedFlow
+	Flow struct {
+		// required: true
+		ID uuid.UUID `json:"id" db:"id"`
+
+		// Kind is one of login, registration, profile, or verification.
+		//
+		// required: true
+		Kind Kind `json:"kind" db:"-"`
+
+		// State is one of active, expired, or completed.
+		//
+		// required: true
+		State State `json:"state" db:"-"`
+
+		// IdentityID is the identity the flow belongs to, if known. It is set for profile flows and for login
+		// flows which ask for a new password.
+		IdentityID *uuid.UUID `json:"identity_id,omitempty" db:"-"`
+
+		// required: true
+		IssuedAt time.Time `json:"issued_at" db:"issued_at"`
+
+		// required: true
+		ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+
+		// required: true
+		RequestURL string `json:"request_url" db:"request_url"`
+
+		// CSRFToken is the anti-CSRF token the flow expects. Profile flows keep their token in the form.
+		CSRFToken string `json:"csrf_token,omitempty" db:"csrf_token"`
+
+		// NullIdentityID is a helper struct field for gobuffalo.pop.
+		NullIdentityID uuid.NullUUID `json:"-" db:"identity_id"`
+
+		// Completed is a helper struct field for gobuffalo.pop.
+		Completed bool `json:"-" db:"completed"`
+	}
+
+	// Filter narrows down the flows which are listed. Zero values are ignored.
+	Filter struct {
+		IdentityID    uuid.UUID
+		State         State
+		ExpiresBefore time.Time
+		ExpiresAfter  time.Time
+	}
+)
+
+// IsValid returns true if the kind is known.
+func (k Kind) IsValid() bool {
+	for _, kind := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve fills in the fields which are derived from the helper fields.
+func (f *Flow) Resolve(kind Kind, now time.Time) {
+	f.Kind = kind
+	if f.NullIdentityID.Valid {
+		id := f.NullIdentityID.UUID
+		f.IdentityID = &id
+	}
+
+	switch {
+	case f.Completed:
+		f.State = StateCompleted
+	case f.ExpiresAt.After(now):
+		f.State = StateActive
+	default:
+		f.State = StateExpired
+	}
+}
@@ -0,0 +1,289 @@
+package inspect
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/pagination"
+
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	FlowsPath      = "/self-service/flows/:kind"
+	FlowPath       = "/self-service/flows/:kind/:id"
+	FlowExpirePath = "/self-service/flows/:kind/:id/expire"
+)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		login.RequestPersistenceProvider
+		registration.RequestPersistenceProvider
+		profile.RequestPersistenceProvider
+		verify.PersistenceProvider
+		x.WriterProvider
+	}
+	HandlerProvider interface {
+		FlowInspectionHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+	}
+
+	// FlowDetails contains the summary of a flow and the flow itself, including its forms and their errors.
+	//
+	// swagger:model inspectedFlowDetails
+	FlowDetails struct {
+		// required: true
+		Flow *Flow `json:"flow"`
+
+		// Request is the login, registration, profile, or verification request.
+		//
+		// required: true
+		Request interface{} `json:"request"`
+	}
+)
+
+func NewHandler(r handlerDependencies) *Handler {
+	return &Handler{r: r}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(FlowsPath, h.list)
+	admin.GET(FlowPath, h.get)
+	admin.PUT(FlowExpirePath, h.expire)
+}
+
+// swagger:parameters listFlows
+// nolint:deadcode,unused
+type listFlowsParameters struct {
+	// Kind is one of login, registration, profile, or verification.
+	//
+	// required: true
+	// in: path
+	Kind string `json:"kind"`
+
+	// Identity lists only the flows of this identity. Supported by profile and login flows.
+	//
+	// in: query
+	Identity string `json:"identity"`
+
+	// State is one of active, expired, or completed.
+	//
+	// in: query
+	State string `json:"state"`
+
+	// ExpiresBefore lists only flows which expire before this time (RFC 3339).
+	//
+	// in: query
+	ExpiresBefore string `json:"expires_before"`
+
+	// ExpiresAfter lists only flows which expire after this time (RFC 3339).
+	//
+	// in: query
+	ExpiresAfter string `json:"expires_after"`
+
+	// in: query
+	Page int `json:"page"`
+
+	// in: query
+	PerPage int `json:"per_page"`
+}
+
+// A list of flows.
+//
+// swagger:response inspectedFlowList
+// nolint:deadcode,unused
+type inspectedFlowListResponse struct {
+	// in: body
+	Body []Flow
+}
+
+// swagger:route GET /self-service/flows/{kind} admin listFlows
+//
+// List self-service flows
+//
+// Lists the login, registration, profile, or verification flows, newest first. Use the filters to find out
+// why a user is stuck, for example by listing the expired flows of an identity.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: inspectedFlowList
+//       400: genericError
+//       500: genericError
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	kind, err := parseKind(ps)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	fs, err := h.r.FlowInspectionPersister().ListFlows(r.Context(), kind, *filter, limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if fs == nil {
+		fs = []Flow{}
+	}
+	h.r.Writer().Write(w, r, fs)
+}
+
+// swagger:parameters getFlow expireFlow
+// nolint:deadcode,unused
+type flowParameters struct {
+	// Kind is one of login, registration, profile, or verification.
+	//
+	// required: true
+	// in: path
+	Kind string `json:"kind"`
+
+	// ID is the flow's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// The details of a flow.
+//
+// swagger:response inspectedFlowDetails
+// nolint:deadcode,unused
+type inspectedFlowDetailsResponse struct {
+	// in: body
+	Body FlowDetails
+}
+
+// swagger:route GET /self-service/flows/{kind}/{id} admin getFlow
+//
+// Get the details of a self-service flow
+//
+// Returns the state of the flow, its anti-CSRF token, and the flow itself including the errors of its forms.
+// Unlike the public endpoints, this endpoint also returns expired flows.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: inspectedFlowDetails
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	kind, err := parseKind(ps)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	id := x.ParseUUID(ps.ByName("id"))
+	f, err := h.r.FlowInspectionPersister().GetFlow(r.Context(), kind, id)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	var request interface{}
+	switch kind {
+	case KindLogin:
+		request, err = h.r.LoginRequestPersister().GetLoginRequest(r.Context(), id)
+	case KindRegistration:
+		request, err = h.r.RegistrationRequestPersister().GetRegistrationRequest(r.Context(), id)
+	case KindProfile:
+		request, err = h.r.ProfileRequestPersister().GetProfileRequest(r.Context(), id)
+	case KindVerification:
+		request, err = h.r.VerificationPersister().GetVerifyRequest(r.Context(), id)
+	}
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, &FlowDetails{Flow: f, Request: request})
+}
+
+// swagger:route PUT /self-service/flows/{kind}/{id}/expire admin expireFlow
+//
+// Expire a self-service flow
+//
+// Marks the flow as expired so that it can no longer be completed. The user has to start a new flow.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) expire(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	kind, err := parseKind(ps)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.FlowInspectionPersister().ExpireFlow(r.Context(), kind, x.ParseUUID(ps.ByName("id"))); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseKind(ps httprouter.Params) (Kind, error) {
+	kind := Kind(ps.ByName("kind"))
+	if !kind.IsValid() {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unknown flow kind %s, expected one of %v.", kind, Kinds))
+	}
+	return kind, nil
+}
+
+func parseFilter(r *http.Request) (*Filter, error) {
+	q := r.URL.Query()
+	f := &Filter{State: State(q.Get("state"))}
+
+	if id := q.Get("identity"); len(id) > 0 {
+		f.IdentityID = x.ParseUUID(id)
+		if x.IsZeroUUID(f.IdentityID) {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The identity query parameter must be a valid UUID."))
+		}
+	}
+
+	for key, target := range map[string]*time.Time{
+		"expires_before": &f.ExpiresBefore,
+		"expires_after":  &f.ExpiresAfter,
+	} {
+		if v := q.Get(key); len(v) > 0 {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The %s query parameter must be formatted according to RFC 3339.", key).WithDebug(err.Error()))
+			}
+			*target = t
+		}
+	}
+
+	return f, nil
+}
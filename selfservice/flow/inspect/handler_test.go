@@ -0,0 +1,102 @@
+package inspect_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/selfservice/flow/inspect"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+func init() {
+	internal.RegisterFakes()
+}
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	router := x.NewRouterAdmin()
+	reg.FlowInspectionHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var lr login.Request
+	require.NoError(t, faker.FakeData(&lr))
+	lr.ID = uuid.Nil
+	for k := range lr.Methods {
+		lr.Methods[k].ID = uuid.Nil
+	}
+	lr.IssuedAt = time.Now().UTC()
+	lr.ExpiresAt = lr.IssuedAt.Add(time.Hour)
+	require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), &lr))
+
+	path := func(p, kind, id string) string {
+		return ts.URL + strings.NewReplacer(":kind", kind, ":id", id).Replace(p)
+	}
+
+	do := func(t *testing.T, method, url string, expectCode int) string {
+		req, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.EqualValues(t, expectCode, res.StatusCode, "%s", body)
+		return string(body)
+	}
+
+	t.Run("case=list", func(t *testing.T) {
+		body := do(t, "GET", path(FlowsPath, "login", "")+"?state=active", http.StatusOK)
+		assert.Equal(t, lr.ID.String(), gjson.Get(body, "0.id").String(), body)
+		assert.Equal(t, "login", gjson.Get(body, "0.kind").String(), body)
+
+		body = do(t, "GET", path(FlowsPath, "registration", ""), http.StatusOK)
+		assert.Equal(t, "[]", strings.TrimSpace(body))
+	})
+
+	t.Run("case=get", func(t *testing.T) {
+		body := do(t, "GET", path(FlowPath, "login", lr.ID.String()), http.StatusOK)
+		assert.Equal(t, "active", gjson.Get(body, "flow.state").String(), body)
+		assert.Equal(t, lr.CSRFToken, gjson.Get(body, "flow.csrf_token").String(), body)
+		assert.Equal(t, lr.ID.String(), gjson.Get(body, "request.id").String(), body)
+		assert.True(t, gjson.Get(body, "request.methods").Exists(), body)
+
+		do(t, "GET", path(FlowPath, "login", x.NewUUID().String()), http.StatusNotFound)
+	})
+
+	t.Run("case=expire", func(t *testing.T) {
+		do(t, "PUT", path(FlowExpirePath, "login", lr.ID.String()), http.StatusNoContent)
+
+		body := do(t, "GET", path(FlowPath, "login", lr.ID.String()), http.StatusOK)
+		assert.Equal(t, "expired", gjson.Get(body, "flow.state").String(), body)
+
+		do(t, "PUT", path(FlowExpirePath, "login", x.NewUUID().String()), http.StatusNotFound)
+	})
+
+	for _, tc := range []struct {
+		name, url string
+	}{
+		{name: "unknown kind", url: path(FlowsPath, "logout", "")},
+		{name: "invalid identity", url: path(FlowsPath, "profile", "") + "?identity=not-a-uuid"},
+		{name: "invalid expiry", url: path(FlowsPath, "login", "") + "?expires_before=tomorrow"},
+		{name: "unknown state", url: path(FlowsPath, "login", "") + "?state=stuck"},
+		{name: "identity filter on registration", url: path(FlowsPath, "registration", "") + "?identity=" + x.NewUUID().String()},
+	} {
+		t.Run("case=rejects "+tc.name, func(t *testing.T) {
+			do(t, "GET", tc.url, http.StatusBadRequest)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package inspect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		FlowInspectionPersister() Persister
+	}
+	Persister interface {
+		// ListFlows returns the flows of the given kind matching the filter, newest first.
+		ListFlows(ctx context.Context, kind Kind, filter Filter, limit, offset int) ([]Flow, error)
+
+		// GetFlow returns the flow of the given kind.
+		GetFlow(ctx context.Context, kind Kind, id uuid.UUID) (*Flow, error)
+
+		// ExpireFlow marks the flow as expired so that it can no longer be completed.
+		ExpireFlow(ctx context.Context, kind Kind, id uuid.UUID) error
+
+		// DeleteExpiredFlows removes the flows of the given kind which expired before the given time and returns
+		// how many were removed.
+		DeleteExpiredFlows(ctx context.Context, kind Kind, expiredBefore time.Time) (int, error)
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	login.RequestPersister
+	profile.RequestPersister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		newLoginRequest := func(t *testing.T, expiresIn time.Duration) *login.Request {
+			var r login.Request
+			require.NoError(t, faker.FakeData(&r))
+			r.ID = uuid.Nil
+			for k := range r.Methods {
+				r.Methods[k].ID = uuid.Nil
+			}
+			r.IssuedAt = time.Now().UTC().Round(time.Second)
+			r.ExpiresAt = r.IssuedAt.Add(expiresIn)
+			require.NoError(t, p.CreateLoginRequest(context.Background(), &r))
+			return &r
+		}
+
+		ids := func(t *testing.T, kind Kind, filter Filter) []uuid.UUID {
+			fs, err := p.ListFlows(context.Background(), kind, filter, 1000, 0)
+			require.NoError(t, err)
+
+			ids := make([]uuid.UUID, len(fs))
+			for k, f := range fs {
+				assert.Equal(t, kind, f.Kind)
+				ids[k] = f.ID
+			}
+			return ids
+		}
+
+		t.Run("case=get", func(t *testing.T) {
+			r := newLoginRequest(t, time.Hour)
+
+			f, err := p.GetFlow(context.Background(), KindLogin, r.ID)
+			require.NoError(t, err)
+			assert.Equal(t, r.ID, f.ID)
+			assert.Equal(t, StateActive, f.State)
+			assert.Equal(t, r.CSRFToken, f.CSRFToken)
+			assert.Equal(t, r.RequestURL, f.RequestURL)
+			assert.Nil(t, f.IdentityID)
+
+			_, err = p.GetFlow(context.Background(), KindLogin, x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
+
+		t.Run("case=filter by state and expiry", func(t *testing.T) {
+			active := newLoginRequest(t, time.Hour)
+			expired := newLoginRequest(t, -time.Hour)
+
+			got := ids(t, KindLogin, Filter{State: StateActive})
+			assert.Contains(t, got, active.ID)
+			assert.NotContains(t, got, expired.ID)
+
+			got = ids(t, KindLogin, Filter{State: StateExpired})
+			assert.Contains(t, got, expired.ID)
+			assert.NotContains(t, got, active.ID)
+
+			got = ids(t, KindLogin, Filter{ExpiresBefore: time.Now().UTC()})
+			assert.Contains(t, got, expired.ID)
+			assert.NotContains(t, got, active.ID)
+
+			got = ids(t, KindLogin, Filter{ExpiresAfter: time.Now().UTC()})
+			assert.Contains(t, got, active.ID)
+			assert.NotContains(t, got, expired.ID)
+		})
+
+		t.Run("case=filter by identity", func(t *testing.T) {
+			var r profile.Request
+			require.NoError(t, faker.FakeData(&r))
+			r.ID = uuid.Nil
+			r.Identity.ID = uuid.Nil
+			require.NoError(t, p.CreateIdentity(context.Background(), r.Identity))
+			require.NoError(t, p.CreateProfileRequest(context.Background(), &r))
+
+			fs, err := p.ListFlows(context.Background(), KindProfile, Filter{IdentityID: r.Identity.ID}, 1000, 0)
+			require.NoError(t, err)
+			require.Len(t, fs, 1)
+			assert.Equal(t, r.ID, fs[0].ID)
+			require.NotNil(t, fs[0].IdentityID)
+			assert.Equal(t, r.Identity.ID, *fs[0].IdentityID)
+
+			assert.Empty(t, ids(t, KindProfile, Filter{IdentityID: x.NewUUID()}))
+
+			_, err = p.ListFlows(context.Background(), KindRegistration, Filter{IdentityID: r.Identity.ID}, 1000, 0)
+			require.Error(t, err, "registration flows do not belong to an identity")
+		})
+
+		t.Run("case=expire", func(t *testing.T) {
+			r := newLoginRequest(t, time.Hour)
+			require.NoError(t, p.ExpireFlow(context.Background(), KindLogin, r.ID))
+
+			f, err := p.GetFlow(context.Background(), KindLogin, r.ID)
+			require.NoError(t, err)
+			assert.Equal(t, StateExpired, f.State)
+
+			actual, err := p.GetLoginRequest(context.Background(), r.ID)
+			require.NoError(t, err)
+			assert.Error(t, actual.Valid())
+
+			err = p.ExpireFlow(context.Background(), KindLogin, x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
+
+		t.Run("case=delete expired", func(t *testing.T) {
+			active := newLoginRequest(t, time.Hour)
+			recent := newLoginRequest(t, -time.Minute)
+			old := newLoginRequest(t, -time.Hour*48)
+
+			count, err := p.DeleteExpiredFlows(context.Background(), KindLogin, time.Now().UTC().Add(-time.Hour*24))
+			require.NoError(t, err)
+			assert.True(t, count >= 1)
+
+			_, err = p.GetLoginRequest(context.Background(), old.ID)
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+
+			for _, r := range []*login.Request{active, recent} {
+				_, err = p.GetLoginRequest(context.Background(), r.ID)
+				require.NoError(t, err)
+			}
+
+			for _, kind := range Kinds {
+				_, err = p.DeleteExpiredFlows(context.Background(), kind, time.Now().UTC().Add(-time.Hour*24))
+				require.NoError(t, err, kind)
+			}
+		})
+
+		t.Run("case=pagination", func(t *testing.T) {
+			newLoginRequest(t, time.Hour)
+			newLoginRequest(t, time.Hour)
+
+			fs, err := p.ListFlows(context.Background(), KindLogin, Filter{}, 1, 0)
+			require.NoError(t, err)
+			assert.Len(t, fs, 1)
+
+			fs, err = p.ListFlows(context.Background(), KindLogin, Filter{}, 1, 1)
+			require.NoError(t, err)
+			assert.Len(t, fs, 1)
+		})
+	}
+}
@@ -51,7 +51,8 @@ func newRequestExpiredError(since time.Duration) requestExpiredError {
 		herodot.ErrBadRequest.
 			WithError("login request expired").
 			WithReasonf(`The login request has expired. Please restart the flow.`).
-			WithReasonf("The login request expired %.2f minutes ago, please try again.", since.Minutes()),
+			WithReasonf("The login request expired %.2f minutes ago, please try again.", since.Minutes()).
+			WithDetail(errorx.DetailErrorID, errorx.ErrorIDFlowExpired),
 	}
 }
 
@@ -62,6 +63,21 @@ func NewErrorHandler(d errorHandlerDependencies, c configuration.Provider) *Erro
 	}
 }
 
+// HandleCSRFFailure returns a handler for x.OriginCSRFHandler which shows errors of submissions that failed the
+// CSRF check in the login request they belong to.
+func (s *ErrorHandler) HandleCSRFFailure(ct identity.CredentialsType) func(w http.ResponseWriter, r *http.Request, err error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		rr, gerr := s.d.LoginRequestPersister().GetLoginRequest(r.Context(), x.ParseUUID(r.URL.Query().Get("request")))
+		if gerr != nil {
+			rr = nil
+		} else if _, ok := rr.Methods[ct]; !ok {
+			rr = nil
+		}
+
+		s.HandleLoginError(w, r, ct, rr, err)
+	}
+}
+
 func (s *ErrorHandler) HandleLoginError(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -69,7 +85,7 @@ func (s *ErrorHandler) HandleLoginError(
 	rr *Request,
 	err error,
 ) {
-	s.d.Logger().WithError(err).
+	x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).
 		WithField("details", fmt.Sprintf("%+v", err)).
 		WithField("credentials_type", ct).
 		WithField("login_request", rr).
@@ -78,12 +94,12 @@ func (s *ErrorHandler) HandleLoginError(
 	if _, ok := errorsx.Cause(err).(requestExpiredError); ok {
 		// create new request because the old one is not valid
 		if err = s.d.LoginHandler().NewLoginRequest(w, r, func(a *Request) (string, error) {
-			for name, method := range a.Methods {
-				method.Config.AddError(&form.Error{Message: "Your session expired, please try again."})
-				if err := s.d.LoginRequestPersister().UpdateLoginRequestMethod(r.Context(), a.ID, name, method); err != nil {
-					return s.d.SelfServiceErrorManager().Create(r.Context(), w, r, err)
-				}
-				a.Methods[name] = method
+			for _, method := range a.Methods {
+				method.Config.AddError(&form.Error{ID: form.ErrorIDFlowExpired, Message: "Your session expired, please try again."})
+			}
+
+			if err := s.d.LoginRequestPersister().UpdateLoginRequestMethods(r.Context(), a.ID, a.Methods); err != nil {
+				return s.d.SelfServiceErrorManager().Create(r.Context(), w, r, err)
 			}
 
 			return urlx.CopyWithQuery(s.c.LoginURL(), url.Values{"request": {a.ID.String()}}).String(), nil
@@ -118,8 +134,13 @@ func (s *ErrorHandler) HandleLoginError(
 		return
 	}
 
+	ui := s.c.LoginURL()
+	if rr.SecondFactorIdentityID.Valid {
+		ui = s.c.MultiFactorURL()
+	}
+
 	http.Redirect(w, r,
-		urlx.CopyWithQuery(s.c.LoginURL(), url.Values{"request": {rr.ID.String()}}).String(),
+		urlx.CopyWithQuery(ui, url.Values{"request": {rr.ID.String()}}).String(),
 		http.StatusFound,
 	)
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/selfservice/errorx"
 	"github.com/ory/kratos/session"
 	"github.com/ory/kratos/x"
@@ -33,6 +34,8 @@ type (
 		session.ManagementProvider
 		x.WriterProvider
 		x.CSRFTokenGeneratorProvider
+		x.FlowBinderProvider
+		i18n.CatalogProvider
 	}
 	HandlerProvider interface {
 		LoginHandler() *Handler
@@ -57,7 +60,15 @@ func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 }
 
 func (h *Handler) NewLoginRequest(w http.ResponseWriter, r *http.Request, redir func(request *Request) (string, error)) error {
-	a := NewLoginRequest(h.c.SelfServiceLoginRequestLifespan(), h.d.GenerateCSRFToken(r), r)
+	a := NewLoginRequest(h.c.SelfServiceLoginRequestMaxLifespan(), h.d.GenerateCSRFToken(r), r)
+	a.Locale = h.d.I18nCatalog().Negotiate(r)
+
+	binding, err := h.d.FlowBinder().Bind(w, r, a.ID)
+	if err != nil {
+		return err
+	}
+	a.Binding = binding
+
 	for _, s := range h.d.LoginStrategies() {
 		if err := s.PopulateLoginMethod(r, a); err != nil {
 			return err
@@ -94,7 +105,8 @@ func (h *Handler) NewLoginRequest(w http.ResponseWriter, r *http.Request, redir
 //
 // This endpoint initializes a browser-based user login flow. Once initialized, the browser will be redirected to
 // `urls.login_ui` with the request ID set as a query parameter. If a valid user session exists already, the browser will be
-// redirected to `urls.default_redirect_url`.
+// redirected to `urls.default_redirect_url`, unless `refresh=true` is set. In that case the user has to authenticate again,
+// for example because the profile management flow requires a privileged session.
 //
 // > This endpoint is NOT INTENDED for API clients and only works
 // with browsers (Chrome, Firefox, ...).
@@ -109,7 +121,7 @@ func (h *Handler) NewLoginRequest(w http.ResponseWriter, r *http.Request, redir
 func (h *Handler) initLoginRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	if err := h.NewLoginRequest(w, r, func(a *Request) (string, error) {
 		// we assume an error means the user has no session
-		if _, err := h.d.SessionManager().FetchFromRequest(r.Context(), w, r); err == nil && r.URL.Query().Get("prompt") == "login" {
+		if _, err := h.d.SessionManager().FetchFromRequest(r.Context(), w, r); err == nil && isRefreshRequested(r) {
 			if err := h.d.LoginRequestPersister().MarkRequestForced(r.Context(), a.ID); err != nil {
 				return "", err
 			}
@@ -121,6 +133,12 @@ func (h *Handler) initLoginRequest(w http.ResponseWriter, r *http.Request, ps ht
 	}
 }
 
+// isRefreshRequested returns true if the user has to authenticate again even though a session exists. `prompt=login`
+// is supported for compatibility with OpenID Connect.
+func isRefreshRequested(r *http.Request) bool {
+	return r.URL.Query().Get("refresh") == "true" || r.URL.Query().Get("prompt") == "login"
+}
+
 // nolint:deadcode,unused
 // swagger:parameters getSelfServiceBrowserLoginRequest
 type getSelfServiceBrowserLoginRequestParameters struct {
@@ -144,6 +162,11 @@ type getSelfServiceBrowserLoginRequestParameters struct {
 // When accessing this endpoint through ORY Kratos' Public API, ensure that cookies are set as they are required for CSRF to work. To prevent
 // token scanning attacks, the public endpoint does not return 404 status codes to prevent scanning attacks.
 //
+// Single page apps served from a different subdomain obtain the CSRF token from the `csrf_token` field of the
+// request's form and must send this request with credentials (cookies) included. Set `security.csrf.cookie.domain`
+// to the shared parent domain for this to work. If the CSRF check fails, the error contains `csrf_token_invalid`
+// as `details.error_id`; initialize a new flow to obtain a fresh token.
+//
 // More information can be found at [ORY Kratos User Login and User Registration Documentation](https://www.ory.sh/docs/next/kratos/self-service/flows/user-login-user-registration).
 //
 //     Produces:
@@ -192,6 +215,7 @@ func (h *Handler) fetchLoginRequest(w http.ResponseWriter, r *http.Request, isPu
 			WithDetail("redirect_to", urlx.AppendPaths(h.c.SelfPublicURL(), BrowserLoginPath).String()))
 	}
 
+	ar.Localize(h.d.I18nCatalog())
 	h.d.Writer().Write(w, r, ar)
 	return nil
 }
@@ -193,6 +193,29 @@ func TestLoginHandler(t *testing.T) {
 			res, body := x.EasyGet(t, admin.Client(), admin.URL+login.BrowserLoginRequestsPath+"?request="+lr.ID.String())
 			assertExpiredPayload(t, res, body)
 		})
+
+		t.Run("case=api version 2", func(t *testing.T) {
+			req := x.NewTestHTTPRequest(t, "GET", public.URL+login.BrowserLoginPath, nil)
+			lr := login.NewLoginRequest(time.Minute, x.FakeCSRFToken, req)
+			for _, s := range reg.LoginStrategies() {
+				require.NoError(t, s.PopulateLoginMethod(req, lr))
+			}
+			require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+
+			hreq, err := http.NewRequest("GET", admin.URL+login.BrowserLoginRequestsPath+"?request="+lr.ID.String(), nil)
+			require.NoError(t, err)
+			hreq.Header.Set("Accept", x.APIVersion2.MediaType())
+			res, err := admin.Client().Do(hreq)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+			assert.Equal(t, x.APIVersion2.MediaType(), res.Header.Get("Content-Type"))
+			assert.True(t, gjson.GetBytes(body, "methods").IsArray(), "%s", body)
+			assert.Equal(t, "password", gjson.GetBytes(body, "methods.#(method==password).method").String(), "%s", body)
+		})
 	})
 
 	t.Run("daemon=public", func(t *testing.T) {
@@ -217,6 +240,7 @@ func TestLoginHandler(t *testing.T) {
 
 			body := x.EasyGetBody(t, hc, public.URL+login.BrowserLoginPath)
 			assert.Contains(t, gjson.GetBytes(body, "error").String(), "csrf_token", "%s", body)
+			assert.Equal(t, x.CSRFErrorID, gjson.GetBytes(body, "error.details.error_id").String(), "%s", body)
 		})
 
 		t.Run("case=expired", func(t *testing.T) {
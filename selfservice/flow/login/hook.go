@@ -2,10 +2,19 @@ package login
 
 import (
 	"net/http"
+	"net/url"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/resilience"
+	"github.com/ory/kratos/selfservice/notification"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
 )
 
 type (
@@ -24,7 +33,15 @@ type (
 type (
 	loginExecutorDependencies interface {
 		identity.ManagementProvider
+		session.LoginCheckerProvider
+		notification.SenderProvider
+		session.LoginHistoryProvider
+		session.PersistenceProvider
+		identity.PrivilegedPoolProvider
+		RequestPersistenceProvider
+		SecondFactorProvider
 		HooksProvider
+		x.CookieProvider
 	}
 	HookExecutor struct {
 		d loginExecutorDependencies
@@ -39,9 +56,53 @@ func NewHookExecutor(d loginExecutorDependencies, c configuration.Provider) *Hoo
 	return &HookExecutor{d: d, c: c}
 }
 
-func (e *HookExecutor) PostLoginHook(w http.ResponseWriter, r *http.Request, hooks []PostHookExecutor, a *Request, i *identity.Identity) error {
+// PostLoginHook is called once the identity authenticated using a first factor. If the identity has set up a second
+// factor, the login request is updated to ask for it and the browser is redirected to the multi-factor UI instead
+// of issuing a session.
+func (e *HookExecutor) PostLoginHook(w http.ResponseWriter, r *http.Request, ct identity.CredentialsType, hooks []PostHookExecutor, a *Request, i *identity.Identity) error {
+	return e.postLoginHook(w, r, ct, hooks, a, i, true)
+}
+
+// PostSecondFactorHook is called once the identity authenticated using the second factor. It runs the hooks of the
+// first factor the identity authenticated with and trusts the browser if the second factor form asked for it, see
+// TrustDeviceField.
+func (e *HookExecutor) PostSecondFactorHook(w http.ResponseWriter, r *http.Request, a *Request, i *identity.Identity) error {
+	return e.postLoginHook(w, r, a.FirstFactor, e.d.PostLoginHooks(a.FirstFactor), a, i, false)
+}
+
+func (e *HookExecutor) postLoginHook(w http.ResponseWriter, r *http.Request, ct identity.CredentialsType, hooks []PostHookExecutor, a *Request, i *identity.Identity, requireSecondFactor bool) error {
+	// The session manager checks this again when issuing the session. Checking it here already keeps the flow from
+	// asking for the second factor or sending notifications.
+	if err := session.CheckLogin(r.Context(), e.d, i); err != nil {
+		return err
+	}
+
+	if !requireSecondFactor {
+		if err := e.trustDevice(w, r, i); err != nil {
+			return err
+		}
+	} else if a != nil {
+		if required, err := e.requireSecondFactor(w, r, ct, a, i); err != nil {
+			return err
+		} else if required {
+			return nil
+		}
+	}
+
+	// This has to happen before the hooks are executed because one of them might write the response.
+	nr := r
+	if a != nil {
+		nr = r.WithContext(i18n.WithLocale(r.Context(), a.Locale))
+	}
+	if err := e.d.NotificationSender().NotifyLogin(w, nr, i); err != nil {
+		return err
+	}
+
 	s := session.NewSession(i, r, e.c)
+	s.SecondFactorAuthenticated = !requireSecondFactor
 
+	// Async hooks only start once the login completed, see resilience.RunDeferred.
+	r = r.WithContext(resilience.WithDeferred(r.Context()))
 	for _, executor := range hooks {
 		if err := executor.ExecuteLoginPostHook(w, r, a, s); err != nil {
 			return err
@@ -55,9 +116,83 @@ func (e *HookExecutor) PostLoginHook(w http.ResponseWriter, r *http.Request, hoo
 	}
 
 	s.ResetModifiedIdentityFlag()
+	e.d.LoginHistory().Record(r, i.ID, ct, true)
+	resilience.RunDeferred(r.Context())
 	return nil
 }
 
+// requireSecondFactor replaces the methods of the login request by the second factors the identity has set up and
+// redirects to the multi-factor UI. It returns false if the identity has not set up any second factor or trusts
+// this browser.
+func (e *HookExecutor) requireSecondFactor(w http.ResponseWriter, r *http.Request, ct identity.CredentialsType, a *Request, i *identity.Identity) (bool, error) {
+	factors := e.d.LoginSecondFactors()
+	if len(factors) == 0 {
+		return false, nil
+	}
+
+	// The identity passed by the strategies does not always contain the credentials.
+	ci := i
+	if len(i.Credentials) == 0 {
+		var err error
+		if ci, err = e.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), i.ID); err != nil {
+			return false, err
+		}
+	}
+
+	var enrolled, fallbacks SecondFactors
+	for _, factor := range factors {
+		if !factor.IsEnrolled(ci) {
+			continue
+		}
+
+		if f, ok := factor.(FallbackSecondFactor); ok && f.IsFallbackOnly() {
+			fallbacks = append(fallbacks, factor)
+			continue
+		}
+		enrolled = append(enrolled, factor)
+	}
+
+	if len(enrolled) == 0 {
+		return false, nil
+	}
+	enrolled = append(enrolled, fallbacks...)
+
+	// Signing in again for a privileged profile management method always asks for the second factor, see
+	// profile.PrivilegedChecker.
+	if !a.IsForced() {
+		if trusted, err := e.isTrustedDevice(r, ci); err != nil {
+			return false, err
+		} else if trusted {
+			return false, nil
+		}
+	}
+
+	methods := RequestMethods{}
+	for _, factor := range enrolled {
+		if err := factor.PopulateSecondFactorMethod(r, ci, a); err != nil {
+			return false, err
+		}
+
+		if method, ok := a.Methods[factor.SecondFactorID()]; ok {
+			methods[factor.SecondFactorID()] = method
+		}
+	}
+
+	if len(methods) == 0 {
+		return false, nil
+	}
+
+	if err := e.d.LoginRequestPersister().UpdateLoginRequestSecondFactor(r.Context(), a.ID, ct, uuid.NullUUID{UUID: i.ID, Valid: true}, methods); err != nil {
+		return false, err
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(e.c.MultiFactorURL(), url.Values{"request": {a.ID.String()}}).String(),
+		http.StatusFound,
+	)
+	return true, nil
+}
+
 func (e *HookExecutor) PreLoginHook(w http.ResponseWriter, r *http.Request, a *Request) error {
 	for _, executor := range e.d.PreLoginHooks() {
 		if err := executor.ExecuteLoginPreHook(w, r, a); err != nil {
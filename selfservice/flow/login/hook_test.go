@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/bxcodec/faker"
+	"github.com/gorilla/sessions"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
 	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/notification"
 	"github.com/ory/kratos/session"
 )
 
@@ -59,6 +61,38 @@ func (m *loginExecutorDependenciesMock) IdentityManager() *identity.Manager {
 	return nil
 }
 
+func (m *loginExecutorDependenciesMock) SessionLoginCheckers() []session.LoginChecker {
+	return nil
+}
+
+func (m *loginExecutorDependenciesMock) NotificationSender() *notification.Sender {
+	return nil
+}
+
+func (m *loginExecutorDependenciesMock) LoginHistory() *session.LoginHistory {
+	return nil
+}
+
+func (m *loginExecutorDependenciesMock) PrivilegedIdentityPool() identity.PrivilegedPool {
+	return nil
+}
+
+func (m *loginExecutorDependenciesMock) LoginRequestPersister() login.RequestPersister {
+	return nil
+}
+
+func (m *loginExecutorDependenciesMock) LoginSecondFactors() login.SecondFactors {
+	return nil
+}
+
+func (m *loginExecutorDependenciesMock) SessionPersister() session.Persister {
+	return nil
+}
+
+func (m *loginExecutorDependenciesMock) CookieManager() sessions.Store {
+	return nil
+}
+
 func (m *loginExecutorDependenciesMock) PreLoginHooks() []login.PreHookExecutor {
 	hooks := make([]login.PreHookExecutor, len(m.preErr))
 	for k := range hooks {
@@ -102,7 +136,7 @@ func TestLoginExecutor(t *testing.T) {
 				require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.TODO(), &i))
 
 				e := login.NewHookExecutor(reg, conf)
-				err := e.PostLoginHook(nil, &http.Request{}, tc.hooks, nil, &i)
+				err := e.PostLoginHook(nil, &http.Request{}, identity.CredentialsTypePassword, tc.hooks, nil, &i)
 				if tc.expectErr != nil {
 					require.EqualError(t, err, tc.expectErr.Error())
 					return
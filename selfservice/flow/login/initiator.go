@@ -0,0 +1,53 @@
+package login
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+// The helpers in this file are shared by strategies which complete a login in several requests, for example once
+// the user approved it on another device or entered a code which was sent to them.
+
+type initiatorDependencies interface {
+	x.CSRFTokenGeneratorProvider
+	x.FlowBinderProvider
+}
+
+// CheckInitiator returns an error unless the request was sent by the browser which initiated the login request
+// and the request is bound to that browser, see x.FlowBinder. Otherwise, whoever knows the ID of the login
+// request could complete it.
+func CheckInitiator(d initiatorDependencies, r *http.Request, ar *Request) error {
+	if subtle.ConstantTimeCompare(
+		[]byte(x.UnmaskCSRFToken(d.GenerateCSRFToken(r))),
+		[]byte(x.UnmaskCSRFToken(ar.CSRFToken)),
+	) != 1 {
+		return errors.WithStack(x.ErrInvalidCSRFToken.WithDebug("The anti-CSRF cookie does not match the login request."))
+	}
+	return d.FlowBinder().Verify(r, ar.ID, ar.Binding)
+}
+
+// FetchStrategyRequest returns the login request of the `request` query parameter if the strategy is one of its
+// methods.
+func FetchStrategyRequest(d RequestPersistenceProvider, r *http.Request, method identity.CredentialsType) (*Request, error) {
+	rid := x.ParseUUID(r.URL.Query().Get("request"))
+	if x.IsZeroUUID(rid) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The request query parameter is missing or invalid."))
+	}
+
+	ar, err := d.LoginRequestPersister().GetLoginRequest(r.Context(), rid)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ar.Methods[method]; !ok {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The login request does not support the %s method.", method))
+	}
+	return ar, nil
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/form"
 	"github.com/ory/kratos/x"
@@ -19,7 +22,16 @@ type (
 		CreateLoginRequest(context.Context, *Request) error
 		GetLoginRequest(context.Context, uuid.UUID) (*Request, error)
 		UpdateLoginRequestMethod(context.Context, uuid.UUID, identity.CredentialsType, *RequestMethod) error
+		// UpdateLoginRequestMethods writes the methods in one transaction and adds those the request does not have yet.
+		UpdateLoginRequestMethods(context.Context, uuid.UUID, RequestMethods) error
 		MarkRequestForced(ctx context.Context, id uuid.UUID) error
+		UpdateLoginRequestPasswordRotation(ctx context.Context, id uuid.UUID, identityID uuid.NullUUID) error
+		// UpdateLoginRequestApproval sets the approval state and identity if the current approval state is from.
+		// It returns sqlcon.ErrNoRows otherwise, so that concurrent approvals can not overwrite each other.
+		UpdateLoginRequestApproval(ctx context.Context, id uuid.UUID, from, to ApprovalState, identityID uuid.NullUUID) error
+		// UpdateLoginRequestSecondFactor sets the identity which authenticated using the first factor and replaces
+		// the methods of the request by the second factor methods.
+		UpdateLoginRequestSecondFactor(ctx context.Context, id uuid.UUID, firstFactor identity.CredentialsType, identityID uuid.NullUUID, methods RequestMethods) error
 	}
 	RequestPersistenceProvider interface {
 		LoginRequestPersister() RequestPersister
@@ -115,5 +127,98 @@ func TestRequestPersister(p RequestPersister) func(t *testing.T) {
 			assert.Equal(t, string(identity.CredentialsTypePassword), actual.Methods[identity.CredentialsTypePassword].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
 			assert.Equal(t, string(identity.CredentialsTypeOIDC), actual.Methods[identity.CredentialsTypeOIDC].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
 		})
+
+		t.Run("case=should update all methods of a login request at once", func(t *testing.T) {
+			expected := newRequest(t)
+			delete(expected.Methods, identity.CredentialsTypeOIDC)
+			require.NoError(t, p.CreateLoginRequest(context.Background(), expected))
+
+			require.NoError(t, p.UpdateLoginRequestMethods(context.Background(), expected.ID, RequestMethods{
+				identity.CredentialsTypePassword: {
+					Config: &RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("batch-password")},
+				},
+				identity.CredentialsTypeOIDC: {
+					Config: &RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("batch-oidc")},
+				},
+			}))
+
+			actual, err := p.GetLoginRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			require.Len(t, actual.Methods, 2)
+			assert.Equal(t, "batch-password", actual.Methods[identity.CredentialsTypePassword].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
+			assert.Equal(t, "batch-oidc", actual.Methods[identity.CredentialsTypeOIDC].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
+
+			require.Error(t, p.UpdateLoginRequestMethods(context.Background(), x.NewUUID(), RequestMethods{
+				identity.CredentialsTypePassword: {
+					Config: &RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("batch-password")},
+				},
+			}))
+		})
+
+		t.Run("case=should set and clear the password rotation identity", func(t *testing.T) {
+			expected := newRequest(t)
+			require.NoError(t, p.CreateLoginRequest(context.Background(), expected))
+
+			iid := uuid.NullUUID{UUID: x.NewUUID(), Valid: true}
+			require.NoError(t, p.UpdateLoginRequestPasswordRotation(context.Background(), expected.ID, iid))
+
+			actual, err := p.GetLoginRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.Equal(t, iid, actual.PasswordRotationIdentityID)
+			assert.Len(t, actual.Methods, len(expected.Methods))
+
+			require.NoError(t, p.UpdateLoginRequestPasswordRotation(context.Background(), expected.ID, uuid.NullUUID{}))
+
+			actual, err = p.GetLoginRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.False(t, actual.PasswordRotationIdentityID.Valid)
+		})
+
+		t.Run("case=should only update the approval state if it did not change", func(t *testing.T) {
+			expected := newRequest(t)
+			expected.ApprovalState = ApprovalStatePending
+			require.NoError(t, p.CreateLoginRequest(context.Background(), expected))
+
+			iid := uuid.NullUUID{UUID: x.NewUUID(), Valid: true}
+			require.NoError(t, p.UpdateLoginRequestApproval(context.Background(), expected.ID, ApprovalStatePending, ApprovalStateApproved, iid))
+
+			actual, err := p.GetLoginRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.Equal(t, ApprovalStateApproved, actual.ApprovalState)
+			assert.Equal(t, iid, actual.ApprovedIdentityID)
+			assert.Len(t, actual.Methods, len(expected.Methods))
+
+			err = p.UpdateLoginRequestApproval(context.Background(), expected.ID, ApprovalStatePending, ApprovalStateDenied, uuid.NullUUID{})
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+
+			actual, err = p.GetLoginRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.Equal(t, ApprovalStateApproved, actual.ApprovalState)
+			assert.Equal(t, iid, actual.ApprovedIdentityID)
+
+			err = p.UpdateLoginRequestApproval(context.Background(), x.NewUUID(), ApprovalStatePending, ApprovalStateApproved, iid)
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
+
+		t.Run("case=should replace the methods by the second factor", func(t *testing.T) {
+			expected := newRequest(t)
+			require.NoError(t, p.CreateLoginRequest(context.Background(), expected))
+
+			const second identity.CredentialsType = "second"
+			iid := uuid.NullUUID{UUID: x.NewUUID(), Valid: true}
+			require.NoError(t, p.UpdateLoginRequestSecondFactor(context.Background(), expected.ID, identity.CredentialsTypePassword, iid, RequestMethods{
+				second: {Config: &RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("second-factor")}},
+			}))
+
+			actual, err := p.GetLoginRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.Equal(t, iid, actual.SecondFactorIdentityID)
+			assert.Equal(t, identity.CredentialsTypePassword, actual.FirstFactor)
+			require.Len(t, actual.Methods, 1)
+			assert.Equal(t, "second-factor", actual.Methods[second].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
+
+			err = p.UpdateLoginRequestSecondFactor(context.Background(), x.NewUUID(), identity.CredentialsTypePassword, iid, RequestMethods{})
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
 	}
 }
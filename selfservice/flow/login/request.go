@@ -3,6 +3,7 @@ package login
 import (
 	"context"
 	"net/http"
+	"sort"
 	"testing"
 	"time"
 
@@ -13,9 +14,9 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ory/herodot"
-	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/form"
 	"github.com/ory/kratos/x"
 )
 
@@ -68,18 +69,51 @@ type Request struct {
 
 	// Forced stores whether this login request should enforce reauthentication.
 	Forced bool `json:"forced" db:"forced"`
+
+	// PasswordRotationIdentityID is set when an identity authenticated using an expired password. The login
+	// request can only be completed once that identity has chosen a new password.
+	PasswordRotationIdentityID uuid.NullUUID `json:"-" faker:"-" db:"password_rotation_identity_id"`
+
+	// Locale is the language of the request's messages. It is negotiated from the `locale` query parameter or the
+	// Accept-Language header when the request is initialized.
+	Locale string `json:"locale" faker:"-" db:"locale"`
+
+	// Binding binds the request to the browser which initiated it, see x.FlowBinder.
+	Binding string `json:"-" faker:"-" db:"browser_binding"`
+
+	// ApprovalState is the state of a cross-device login, in which the request is approved from another device
+	// on which the user is already signed in. It is empty for all other login requests.
+	ApprovalState ApprovalState `json:"-" faker:"-" db:"approval_state"`
+
+	// ApprovedIdentityID is the identity which approved the cross-device login.
+	ApprovedIdentityID uuid.NullUUID `json:"-" faker:"-" db:"approved_identity_id"`
+
+	// SecondFactorIdentityID is set when an identity authenticated using a first factor and has set up a second
+	// factor. The login request can only be completed once that identity authenticated using the second factor.
+	SecondFactorIdentityID uuid.NullUUID `json:"-" faker:"-" db:"second_factor_identity_id"`
+
+	// FirstFactor is the login method the identity authenticated with before the second factor was required. Its
+	// hooks run once the second factor completed the login.
+	FirstFactor identity.CredentialsType `json:"-" faker:"-" db:"first_factor"`
 }
 
-func NewLoginRequest(exp time.Duration, csrf string, r *http.Request) *Request {
-	source := urlx.Copy(r.URL)
-	source.Host = r.Host
+// ApprovalState is the state of a cross-device login.
+type ApprovalState string
+
+const (
+	// ApprovalStatePending means that the request is waiting to be approved from another device.
+	ApprovalStatePending ApprovalState = "pending"
+	// ApprovalStateScanned means that the other device opened the approval page but did not decide yet.
+	ApprovalStateScanned  ApprovalState = "scanned"
+	ApprovalStateApproved ApprovalState = "approved"
+	ApprovalStateDenied   ApprovalState = "denied"
+	// ApprovalStateCompleted means that the browser which initiated the request has signed in. It prevents the
+	// approval from being used twice.
+	ApprovalStateCompleted ApprovalState = "completed"
+)
 
-	if len(source.Scheme) == 0 {
-		source.Scheme = "http"
-		if r.TLS != nil {
-			source.Scheme = "https"
-		}
-	}
+func NewLoginRequest(exp time.Duration, csrf string, r *http.Request) *Request {
+	source := x.RequestURL(r)
 
 	return &Request{
 		ID:         x.NewUUID(),
@@ -118,6 +152,27 @@ func (r *Request) AfterFind(_ *pop.Connection) error {
 	return nil
 }
 
+// ForAPIVersion implements x.VersionedResponse. Starting with x.APIVersion2, the methods are an array ordered
+// by method.
+func (r *Request) ForAPIVersion(v x.APIVersion) interface{} {
+	if v < x.APIVersion2 {
+		return r
+	}
+
+	methods := make([]*RequestMethod, 0, len(r.Methods))
+	for _, m := range r.Methods {
+		methods = append(methods, m)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+	return &requestV2{Request: r, Methods: methods}
+}
+
+// requestV2 is the shape of the request in x.APIVersion2.
+type requestV2 struct {
+	*Request
+	Methods []*RequestMethod `json:"methods"`
+}
+
 func (r Request) TableName() string {
 	// This must be stay a value receiver, using a pointer receiver will cause issues with pop.
 	return "selfservice_login_requests"
@@ -134,6 +189,30 @@ func (r *Request) Valid() error {
 	return nil
 }
 
+// ValidFor is like Valid but additionally expires the request once lifespan has passed since it was issued. It
+// is used to enforce the lifespan of the login method which completes the request.
+func (r *Request) ValidFor(lifespan time.Duration) error {
+	if err := r.Valid(); err != nil {
+		return err
+	}
+	if expiresAt := r.IssuedAt.Add(lifespan); expiresAt.Before(time.Now()) {
+		return errors.WithStack(newRequestExpiredError(time.Since(expiresAt)))
+	}
+	return nil
+}
+
+// Localize translates the messages of all methods to the request's locale.
+func (r *Request) Localize(t form.Translator) {
+	for _, m := range r.Methods {
+		if m.Config == nil {
+			continue
+		}
+		if l, ok := m.Config.RequestMethodConfigurator.(form.Localizer); ok {
+			l.Localize(t, r.Locale)
+		}
+	}
+}
+
 func (r *Request) GetID() uuid.UUID {
 	return r.ID
 }
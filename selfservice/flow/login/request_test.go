@@ -1,6 +1,7 @@
 package login_test
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -8,7 +9,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
 	"github.com/ory/kratos/x"
 )
 
@@ -51,4 +54,49 @@ func TestRequest(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("case=expired for method", func(t *testing.T) {
+		r := &login.Request{ExpiresAt: time.Now().Add(time.Hour), IssuedAt: time.Now().Add(-time.Minute * 30)}
+		require.NoError(t, r.ValidFor(time.Hour))
+		require.Error(t, r.ValidFor(time.Minute*10))
+
+		r.ExpiresAt = time.Now().Add(-time.Minute)
+		require.Error(t, r.ValidFor(time.Hour), "the request's expiry always applies")
+	})
+}
+
+func TestRequestAPIVersions(t *testing.T) {
+	action := "http://kratos.test/self-service/browser/flows/login/strategies/"
+	r := &login.Request{
+		ID:         x.ParseUUID("a3f39d8e-22ab-4a35-9b5f-2bf1a67c8a3d"),
+		IssuedAt:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:  time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC),
+		RequestURL: "http://kratos.test/self-service/browser/flows/login",
+		Locale:     "en",
+		Methods: map[identity.CredentialsType]*login.RequestMethod{
+			identity.CredentialsTypePassword: {
+				Method: identity.CredentialsTypePassword,
+				Config: &login.RequestMethodConfig{RequestMethodConfigurator: &form.HTMLForm{
+					Action: action + "password",
+					Method: "POST",
+					Fields: form.Fields{
+						{Name: "identifier", Type: "text", Required: true},
+						{Name: "password", Type: "password", Required: true},
+					},
+				}},
+			},
+			identity.CredentialsTypeOIDC: {
+				Method: identity.CredentialsTypeOIDC,
+				Config: &login.RequestMethodConfig{RequestMethodConfigurator: &form.HTMLForm{
+					Action: action + "oidc/auth",
+					Method: "POST",
+					Fields: form.Fields{{Name: "provider", Type: "submit", Value: "github"}},
+				}},
+			},
+		},
+	}
+
+	for _, v := range []x.APIVersion{x.APIVersion1, x.APIVersion2} {
+		x.AssertJSONSnapshot(t, fmt.Sprintf("login_request_v%d", v), []byte(x.MustEncodeJSON(t, r.ForAPIVersion(v))))
+	}
 }
@@ -46,3 +46,34 @@ func (s Strategies) RegisterPublicRoutes(r *x.RouterPublic) {
 type StrategyProvider interface {
 	LoginStrategies() Strategies
 }
+
+// SecondFactor is a login method which is asked for after the identity authenticated using a first factor, e.g. a
+// password, if the identity has set it up.
+type SecondFactor interface {
+	SecondFactorID() identity.CredentialsType
+	RegisterSecondFactorRoutes(*x.RouterPublic)
+
+	// IsEnrolled returns true if the identity, including its credentials, has set up this second factor.
+	IsEnrolled(i *identity.Identity) bool
+
+	// PopulateSecondFactorMethod adds the method for this second factor to the login request.
+	PopulateSecondFactorMethod(r *http.Request, i *identity.Identity, sr *Request) error
+}
+
+// FallbackSecondFactor is implemented by second factors which can be set up to only be offered next to another
+// second factor of the identity, for when that one is not at hand.
+type FallbackSecondFactor interface {
+	IsFallbackOnly() bool
+}
+
+type SecondFactors []SecondFactor
+
+func (s SecondFactors) RegisterPublicRoutes(r *x.RouterPublic) {
+	for _, ss := range s {
+		ss.RegisterSecondFactorRoutes(r)
+	}
+}
+
+type SecondFactorProvider interface {
+	LoginSecondFactors() SecondFactors
+}
@@ -0,0 +1,100 @@
+package login
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// TrustedDeviceCookieName is the name of the cookie which remembers the devices the identities that signed in
+	// using this browser trust.
+	TrustedDeviceCookieName = "ory_kratos_trusted_device"
+
+	// TrustDeviceField is the name of the second factor form field which, if "true", skips the second factor
+	// in this browser for the configured lifespan.
+	TrustDeviceField = "trust_device"
+)
+
+// AddTrustDeviceField adds the TrustDeviceField to the form of a second factor if trusted devices are enabled.
+func AddTrustDeviceField(c configuration.Provider, f *form.HTMLForm) {
+	if !c.SelfServiceLoginTrustedDevicesEnabled() {
+		return
+	}
+	f.SetField(form.Field{Name: TrustDeviceField, Type: "checkbox", Value: "true"})
+}
+
+// isTrustedDevice returns true if the identity, which must include its credentials, trusts this browser. Devices
+// trusted before the credentials changed are removed.
+func (e *HookExecutor) isTrustedDevice(r *http.Request, i *identity.Identity) (bool, error) {
+	if !e.c.SelfServiceLoginTrustedDevicesEnabled() {
+		return false, nil
+	}
+
+	id := x.ParseUUID(x.SessionGetStringOr(r, e.d.CookieManager(), TrustedDeviceCookieName, i.ID.String(), ""))
+	if x.IsZeroUUID(id) {
+		return false, nil
+	}
+
+	d, err := e.d.SessionPersister().GetTrustedDevice(r.Context(), id)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if d.IsTrustedBy(i) {
+		return true, nil
+	}
+
+	if d.IdentityID == i.ID {
+		if err := e.d.SessionPersister().DeleteTrustedDevice(r.Context(), i.ID, d.ID); err != nil && errorsx.Cause(err) != sqlcon.ErrNoRows {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// trustDevice remembers this browser as trusted by the identity if the second factor form asked for it. It sets
+// a cookie and must therefore be called before the response is written.
+func (e *HookExecutor) trustDevice(w http.ResponseWriter, r *http.Request, i *identity.Identity) error {
+	if !e.c.SelfServiceLoginTrustedDevicesEnabled() {
+		return nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return errors.WithStack(err)
+	}
+	if r.PostForm.Get(TrustDeviceField) != "true" {
+		return nil
+	}
+
+	// The identity passed by the strategies does not always contain the credentials.
+	ci := i
+	if len(i.Credentials) == 0 {
+		var err error
+		if ci, err = e.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), i.ID); err != nil {
+			return err
+		}
+	}
+
+	lifespan := e.c.SelfServiceLoginTrustedDevicesLifespan()
+	d := session.NewTrustedDevice(r, ci, lifespan)
+	if err := e.d.SessionPersister().CreateTrustedDevice(r.Context(), d); err != nil {
+		return err
+	}
+
+	cookie, _ := e.d.CookieManager().Get(r, TrustedDeviceCookieName)
+	cookie.Options.MaxAge = int(lifespan.Seconds())
+	cookie.Values[i.ID.String()] = d.ID.String()
+	return errors.WithStack(cookie.Save(r, w))
+}
@@ -19,6 +19,7 @@ type (
 	handlerDependencies interface {
 		x.CSRFProvider
 		session.ManagementProvider
+		session.BackChannelLogoutProvider
 		errorx.ManagementProvider
 	}
 	HandlerProvider interface {
@@ -59,6 +60,13 @@ func (h *Handler) RegisterPublicRoutes(router *x.RouterPublic) {
 func (h *Handler) logout(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	_ = h.d.CSRFHandler().RegenerateToken(w, r)
 
+	if s, err := h.d.SessionManager().FetchFromRequest(r.Context(), w, r); err == nil {
+		if err := h.d.SessionBackChannelLogout().NotifySession(r.Context(), s); err != nil {
+			h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+			return
+		}
+	}
+
 	if err := h.d.SessionManager().PurgeFromRequest(r.Context(), w, r); err != nil {
 		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
@@ -32,7 +32,7 @@ func TestLogoutHandler(t *testing.T) {
 
 	router := x.NewRouterPublic()
 	handler.RegisterPublicRoutes(router)
-	reg.WithCSRFHandler(x.NewCSRFHandler(router, reg.Writer(), logrus.New(), "/", "", false))
+	reg.WithCSRFHandler(x.NewCSRFHandler(router, reg.Writer(), logrus.New(), "/", "", false, http.SameSiteLaxMode))
 	ts := httptest.NewServer(reg.CSRFHandler())
 	defer ts.Close()
 
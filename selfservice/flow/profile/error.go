@@ -6,24 +6,35 @@ import (
 	"net/url"
 
 	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
 	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/session"
 	"github.com/ory/kratos/x"
 )
 
 var (
 	ErrRequestExpired = herodot.ErrBadRequest.
 		WithError("profile management request expired").
-		WithReasonf(`The profile management request has expired. Please restart the flow.`)
+		WithReasonf(`The profile management request has expired. Please restart the flow.`).
+		WithDetail(errorx.DetailErrorID, errorx.ErrorIDFlowExpired)
 )
 
 type (
+	// privilegedSessionRequiredError is returned if a change requires a privileged session, but the user
+	// authenticated too long ago or without the second factor.
+	privilegedSessionRequiredError struct {
+		*herodot.DefaultError
+		loginURL string
+	}
+
 	errorHandlerDependencies interface {
 		errorx.ManagementProvider
 		x.WriterProvider
 		x.LoggingProvider
+		session.ManagementProvider
 
 		RequestPersistenceProvider
 	}
@@ -36,6 +47,23 @@ type (
 	}
 )
 
+func newPrivilegedSessionRequiredError(loginURL string) privilegedSessionRequiredError {
+	return privilegedSessionRequiredError{
+		DefaultError: herodot.ErrForbidden.
+			WithError("privileged session required").
+			WithReason("This change requires a recent login. Please sign in again and retry.").
+			WithDetail("redirect_to", loginURL),
+		loginURL: loginURL,
+	}
+}
+
+// PrivilegedLoginURL returns the URL of the login the user has to complete if err was returned because the session
+// may not use a profile management method, see PrivilegedChecker.
+func PrivilegedLoginURL(err error) (string, bool) {
+	e, ok := errorsx.Cause(err).(privilegedSessionRequiredError)
+	return e.loginURL, ok
+}
+
 func NewErrorHandler(d errorHandlerDependencies, c configuration.Provider) *ErrorHandler {
 	return &ErrorHandler{
 		d: d,
@@ -43,17 +71,36 @@ func NewErrorHandler(d errorHandlerDependencies, c configuration.Provider) *Erro
 	}
 }
 
+// HandleCSRFFailure is a handler for x.OriginCSRFHandler which shows errors of submissions that failed the CSRF
+// check in the profile management request they belong to. The request is only changed if it belongs to the
+// identity of the session.
+func (s *ErrorHandler) HandleCSRFFailure(w http.ResponseWriter, r *http.Request, err error) {
+	var rr *Request
+	if sess, serr := s.d.SessionManager().FetchFromRequest(r.Context(), w, r); serr == nil {
+		if pr, gerr := s.d.ProfileRequestPersister().GetProfileRequest(r.Context(), x.ParseUUID(r.URL.Query().Get("request"))); gerr == nil && pr.IdentityID == sess.Identity.ID {
+			rr = pr
+		}
+	}
+
+	s.HandleProfileManagementError(w, r, rr, err)
+}
+
 func (s *ErrorHandler) HandleProfileManagementError(
 	w http.ResponseWriter,
 	r *http.Request,
 	rr *Request,
 	err error,
 ) {
-	s.d.Logger().WithError(err).
+	x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).
 		WithField("details", fmt.Sprintf("%+v", err)).
 		WithField("profile_request", rr).
 		Warn("Encountered profile management error.")
 
+	if loginURL, ok := PrivilegedLoginURL(err); ok && !x.IsJSONRequest(r) {
+		http.Redirect(w, r, loginURL, http.StatusFound)
+		return
+	}
+
 	if rr == nil {
 		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
@@ -67,7 +114,7 @@ func (s *ErrorHandler) HandleProfileManagementError(
 		return
 	}
 
-	if err := s.d.ProfileRequestPersister().UpdateProfileRequest(r.Context(), rr); err != nil {
+	if err := s.d.ProfileRequestPersister().UpdateProfileRequestForm(r.Context(), rr); err != nil {
 		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
 	}
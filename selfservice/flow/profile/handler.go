@@ -8,6 +8,7 @@ import (
 
 	"github.com/ory/jsonschema/v3"
 
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/schema"
 
 	"github.com/julienschmidt/httprouter"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/ory/herodot"
 	"github.com/ory/x/decoderx"
+	"github.com/ory/x/errorsx"
 	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/driver/configuration"
@@ -32,25 +34,31 @@ const (
 	PublicProfileManagementRequestPath = "/self-service/browser/flows/requests/profile"
 	AdminBrowserProfileRequestPath     = "/self-service/browser/flows/requests/profile"
 	PublicProfileManagementUpdatePath  = "/self-service/browser/flows/profile/update"
+	PublicProfileManagementRevokePath  = "/self-service/browser/flows/profile/sessions/revoke"
 )
 
 type (
 	handlerDependencies interface {
 		x.CSRFProvider
+		x.FlowBinderProvider
 		x.WriterProvider
 		x.LoggingProvider
 
 		session.HandlerProvider
 		session.ManagementProvider
+		session.PersistenceProvider
+		session.BackChannelLogoutProvider
 
 		identity.ValidationProvider
 		identity.ManagementProvider
 		identity.PrivilegedPoolProvider
 
 		errorx.ManagementProvider
+		i18n.CatalogProvider
 
 		ErrorHandlerProvider
 		RequestPersistenceProvider
+		PrivilegedCheckerProvider
 
 		IdentityTraitsSchemas() schema.Schemas
 	}
@@ -73,6 +81,7 @@ func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 	public.GET(PublicProfileManagementPath, h.d.SessionHandler().IsAuthenticated(h.initUpdateProfile, redirect))
 	public.GET(PublicProfileManagementRequestPath, h.d.SessionHandler().IsAuthenticated(h.publicFetchUpdateProfileRequest, redirect))
 	public.POST(PublicProfileManagementUpdatePath, h.d.SessionHandler().IsAuthenticated(h.completeProfileManagementFlow, redirect))
+	public.POST(PublicProfileManagementRevokePath, h.d.SessionHandler().IsAuthenticated(h.revokeOtherSessions, redirect))
 }
 
 func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
@@ -104,13 +113,22 @@ func (h *Handler) initUpdateProfile(w http.ResponseWriter, r *http.Request, ps h
 		return
 	}
 
-	traitsSchema, err := h.c.IdentityTraitsSchemas().FindSchemaByID(s.Identity.TraitsSchemaID)
+	traitsSchema, err := h.d.IdentityTraitsSchemas().GetByID(s.Identity.TraitsSchemaID)
 	if err != nil {
 		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
 	}
 
 	a := NewRequest(h.c.SelfServiceProfileRequestLifespan(), r, s)
+	a.Locale = h.d.I18nCatalog().Negotiate(r)
+
+	binding, err := h.d.FlowBinder().Bind(w, r, a.ID)
+	if err != nil {
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+	a.Binding = binding
+
 	// use a schema compiler that disables identifiers
 	schemaCompiler := jsonschema.NewCompiler()
 	registerNewDisableIdentifiersExtension(schemaCompiler)
@@ -120,7 +138,7 @@ func (h *Handler) initUpdateProfile(w http.ResponseWriter, r *http.Request, ps h
 		url.Values{
 			"request": {a.ID.String()},
 		},
-	).String(), traitsSchema.URL, "traits", schemaCompiler)
+	).String(), traitsSchema.URL.String(), "traits", schemaCompiler)
 	if err != nil {
 		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
@@ -129,7 +147,7 @@ func (h *Handler) initUpdateProfile(w http.ResponseWriter, r *http.Request, ps h
 	a.Form.SetValuesFromJSON(json.RawMessage(s.Identity.Traits), "traits")
 	a.Form.SetCSRF(h.csrf(r))
 
-	if err := a.Form.SortFields(traitsSchema.URL, "traits"); err != nil {
+	if err := a.Form.SortFields(traitsSchema.URL.String(), "traits"); err != nil {
 		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
 	}
@@ -217,6 +235,10 @@ func (h *Handler) fetchUpdateProfileRequest(w http.ResponseWriter, r *http.Reque
 		if pr.IdentityID != sess.Identity.ID {
 			return errors.WithStack(herodot.ErrForbidden.WithReasonf("The request was made for another identity and has been blocked for security reasons."))
 		}
+
+		if pr.Reauthentication, err = h.d.ProfilePrivilegedChecker().Reauthentications(r.Context(), sess); err != nil {
+			return err
+		}
 	}
 
 	if pr.ExpiresAt.Before(time.Now()) {
@@ -225,15 +247,16 @@ func (h *Handler) fetchUpdateProfileRequest(w http.ResponseWriter, r *http.Reque
 			WithDetail("redirect_to", urlx.AppendPaths(h.c.SelfPublicURL(), PublicProfileManagementPath).String()))
 	}
 
-	traitsSchema, err := h.c.IdentityTraitsSchemas().FindSchemaByID(pr.Identity.TraitsSchemaID)
+	traitsSchema, err := h.d.IdentityTraitsSchemas().GetByID(pr.Identity.TraitsSchemaID)
 	if err != nil {
 		return herodot.ErrInternalServerError.WithReason("The traits schema for this identity could not be found. This is an configuration error.").WithDebugf("%s", err).WithTrace(err)
 	}
 
-	if err := pr.Form.SortFields(traitsSchema.URL, "traits"); err != nil {
+	if err := pr.Form.SortFields(traitsSchema.URL.String(), "traits"); err != nil {
 		return herodot.ErrInternalServerError.WithReason("There was an error with sorting the form fields. This is an configuration error.").WithDebugf("%s", err).WithTrace(err)
 	}
 
+	pr.Localize(h.d.I18nCatalog())
 	h.d.Writer().Write(w, r, pr)
 	return nil
 }
@@ -330,6 +353,11 @@ func (h *Handler) completeProfileManagementFlow(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if err := h.d.FlowBinder().Verify(r, ar.ID, ar.Binding); err != nil {
+		h.handleProfileManagementError(w, r, ar, s.Identity.Traits, err)
+		return
+	}
+
 	if len(p.Traits) == 0 {
 		h.handleProfileManagementError(w, r, ar, s.Identity.Traits, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Did not receive any value changes.")))
 		return
@@ -342,11 +370,21 @@ func (h *Handler) completeProfileManagementFlow(w http.ResponseWriter, r *http.R
 				WithDebugf("session.AuthenticatedAt was %fs in the future. This should not happen.", time.Since(s.AuthenticatedAt).Seconds())))
 		return
 	}
+	reauth, err := h.d.ProfilePrivilegedChecker().Reauthentication(r.Context(), s, MethodProfile)
+	if err != nil {
+		h.handleProfileManagementError(w, r, ar, identity.Traits(p.Traits), err)
+		return
+	}
+
 	identityManagerOptions := []identity.ManagerOption{identity.ManagerExposeValidationErrors}
-	if time.Since(s.AuthenticatedAt) < h.c.SelfServicePrivilegedSessionMaxAge() {
+	privileged := reauth.Satisfied()
+	if privileged {
 		identityManagerOptions = append(identityManagerOptions, identity.ManagerAllowWriteProtectedTraits)
 	}
 	if err := h.d.IdentityManager().UpdateTraits(r.Context(), s.Identity.ID, identity.Traits(p.Traits), identityManagerOptions...); err != nil {
+		if !privileged && errorsx.Cause(err) == identity.ErrProtectedFieldModified {
+			err = errors.WithStack(newPrivilegedSessionRequiredError(reauth.RedirectTo))
+		}
 		h.handleProfileManagementError(w, r, ar, identity.Traits(p.Traits), err)
 		return
 	}
@@ -362,18 +400,18 @@ func (h *Handler) completeProfileManagementFlow(w http.ResponseWriter, r *http.R
 	}
 	ar.Form.SetCSRF(nosurf.Token(r))
 
-	traitsSchema, err := h.c.IdentityTraitsSchemas().FindSchemaByID(s.Identity.TraitsSchemaID)
+	traitsSchema, err := h.d.IdentityTraitsSchemas().GetByID(s.Identity.TraitsSchemaID)
 	if err != nil {
 		h.handleProfileManagementError(w, r, ar, identity.Traits(p.Traits), err)
 		return
 	}
 
-	if err = ar.Form.SortFields(traitsSchema.URL, "traits"); err != nil {
+	if err = ar.Form.SortFields(traitsSchema.URL.String(), "traits"); err != nil {
 		h.handleProfileManagementError(w, r, ar, identity.Traits(p.Traits), err)
 		return
 	}
 
-	if err := h.d.ProfileRequestPersister().UpdateProfileRequest(r.Context(), ar); err != nil {
+	if err := h.d.ProfileRequestPersister().UpdateProfileRequestForm(r.Context(), ar); err != nil {
 		h.handleProfileManagementError(w, r, ar, identity.Traits(p.Traits), err)
 		return
 	}
@@ -384,6 +422,84 @@ func (h *Handler) completeProfileManagementFlow(w http.ResponseWriter, r *http.R
 	)
 }
 
+// nolint:deadcode,unused
+// swagger:parameters revokeOtherSelfServiceBrowserSessions
+type revokeOtherSessionsParameters struct {
+	// Request is the request ID.
+	//
+	// required: true
+	// in: query
+	// format: uuid
+	Request string `json:"request"`
+}
+
+// swagger:route POST /self-service/browser/flows/profile/sessions/revoke public revokeOtherSelfServiceBrowserSessions
+//
+// Log out of all other devices
+//
+// This endpoint revokes all sessions of the identity except the session used to make this request. Once done,
+// the browser is redirected to `urls.profile_ui` with the request ID set as a query parameter.
+//
+// > This endpoint is NOT INTENDED for API clients and only works with browsers (Chrome, Firefox, ...) and HTML Forms.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       500: genericError
+func (h *Handler) revokeOtherSessions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.d.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		h.handleProfileManagementError(w, r, nil, nil, err)
+		return
+	}
+
+	rid := r.URL.Query().Get("request")
+	if len(rid) == 0 {
+		h.handleProfileManagementError(w, r, nil, s.Identity.Traits, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The request query parameter is missing.")))
+		return
+	}
+
+	ar, err := h.d.ProfileRequestPersister().GetProfileRequest(r.Context(), x.ParseUUID(rid))
+	if err != nil {
+		h.handleProfileManagementError(w, r, nil, s.Identity.Traits, err)
+		return
+	}
+
+	if err := ar.Valid(s); err != nil {
+		h.handleProfileManagementError(w, r, ar, s.Identity.Traits, err)
+		return
+	}
+
+	if err := h.d.FlowBinder().Verify(r, ar.ID, ar.Binding); err != nil {
+		h.handleProfileManagementError(w, r, ar, s.Identity.Traits, err)
+		return
+	}
+
+	if err := h.d.ProfilePrivilegedChecker().Check(r.Context(), s, MethodSessions); err != nil {
+		h.handleProfileManagementError(w, r, ar, s.Identity.Traits, err)
+		return
+	}
+
+	if err := h.d.SessionBackChannelLogout().NotifyIdentityExcept(r.Context(), s.Identity.ID, s.ID); err != nil {
+		h.handleProfileManagementError(w, r, ar, s.Identity.Traits, err)
+		return
+	}
+
+	if err := h.d.SessionPersister().DeleteSessionsForExcept(r.Context(), s.Identity.ID, s.ID); err != nil {
+		h.handleProfileManagementError(w, r, ar, s.Identity.Traits, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(h.c.ProfileURL(), url.Values{"request": {ar.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
 // handleProfileManagementError is a convenience function for handling all types of errors that may occur (e.g. validation error)
 // during a profile management request.
 func (h *Handler) handleProfileManagementError(w http.ResponseWriter, r *http.Request, rr *Request, traits identity.Traits, err error) {
@@ -404,12 +520,12 @@ func (h *Handler) handleProfileManagementError(w http.ResponseWriter, r *http.Re
 		rr.Form.SetCSRF(nosurf.Token(r))
 
 		// try to sort, might fail if the error before was sorting related
-		traitsSchema, err := h.c.IdentityTraitsSchemas().FindSchemaByID(rr.Identity.TraitsSchemaID)
+		traitsSchema, err := h.d.IdentityTraitsSchemas().GetByID(rr.Identity.TraitsSchemaID)
 		if err != nil {
 			h.d.ProfileRequestRequestErrorHandler().HandleProfileManagementError(w, r, rr, err)
 			return
 		}
-		err = rr.Form.SortFields(traitsSchema.URL, "traits")
+		err = rr.Form.SortFields(traitsSchema.URL.String(), "traits")
 		if err != nil {
 			h.d.ProfileRequestRequestErrorHandler().HandleProfileManagementError(w, r, rr, err)
 			return
@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bxcodec/faker"
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -31,6 +32,7 @@ import (
 	"github.com/ory/kratos/internal/httpclient/client"
 	"github.com/ory/kratos/internal/httpclient/client/common"
 	"github.com/ory/kratos/internal/httpclient/models"
+	"github.com/ory/kratos/maintenance"
 	"github.com/ory/kratos/selfservice/errorx"
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/profile"
@@ -331,6 +333,36 @@ func TestUpdateProfile(t *testing.T) {
 			assert.Equal(t, "length must be >= 25, but got 9", gjson.Get(actual, "form.fields.#(name==traits.should_long_string).errors.0.message").String(), "%s", actual)
 		})
 
+		t.Run("description=should not update the profile in maintenance mode", func(t *testing.T) {
+			m := &maintenance.Mode{Enabled: true, Reason: "database migration"}
+			require.NoError(t, reg.MaintenancePersister().SetMaintenanceMode(context.Background(), m))
+			reg.MaintenanceGuard().SetMode(m)
+			defer func() {
+				require.NoError(t, reg.MaintenancePersister().DeleteMaintenanceMode(context.Background()))
+				reg.MaintenanceGuard().SetMode(&maintenance.Mode{})
+			}()
+
+			before, err := reg.PrivilegedIdentityPool().GetIdentity(context.Background(), primaryIdentity.ID)
+			require.NoError(t, err)
+
+			rs := makeRequest(t)
+			values := fieldsToURLValues(rs.Payload.Form.Fields)
+			values.Set("traits.stringy", "maintenance")
+			res, err := primaryUser.PostForm(pointerx.StringR(rs.Payload.Form.Action), values)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			b, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, errTs.URL, res.Request.URL.Scheme+"://"+res.Request.URL.Host, "%s", b)
+			assert.EqualValues(t, http.StatusServiceUnavailable, gjson.GetBytes(b, "0.code").Int(), "%s", b)
+			assert.Equal(t, form.ErrorIDMaintenanceMode, gjson.GetBytes(b, "0.details.error_id").String(), "%s", b)
+
+			after, err := reg.PrivilegedIdentityPool().GetIdentity(context.Background(), primaryIdentity.ID)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(before.Traits), string(after.Traits))
+		})
+
 		t.Run("description=should update protected field with sudo mode", func(t *testing.T) {
 			viper.Set(configuration.ViperKeySelfServicePrivilegedAuthenticationAfter, "1m")
 			defer viper.Set(configuration.ViperKeySelfServicePrivilegedAuthenticationAfter, "1ns")
@@ -351,20 +383,44 @@ func TestUpdateProfile(t *testing.T) {
 			assert.Equal(t, "foobar", gjson.Get(actual, "form.fields.#(name==traits.stringy).value").String(), "%s", actual) // sanity check if original payload is still here
 		})
 
-		t.Run("description=should come back with form errors if trying to update protected field without sudo mode", func(t *testing.T) {
+		t.Run("description=should ask to login again if trying to update protected field without sudo mode", func(t *testing.T) {
 			rs := makeRequest(t)
 			values := fieldsToURLValues(rs.Payload.Form.Fields)
 			values.Set("traits.email", "not-john-doe")
-			res, err := primaryUser.PostForm(pointerx.StringR(rs.Payload.Form.Action), values)
+
+			c := *primaryUser
+			c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+			res, err := c.PostForm(pointerx.StringR(rs.Payload.Form.Action), values)
 			require.NoError(t, err)
 			defer res.Body.Close()
 
-			assert.Contains(t, res.Request.URL.String(), errTs.URL)
-			assert.EqualValues(t, http.StatusOK, res.StatusCode)
+			assert.EqualValues(t, http.StatusFound, res.StatusCode)
+			location, err := res.Location()
+			require.NoError(t, err)
+			assert.Equal(t, publicTS.URL+login.BrowserLoginPath, location.Scheme+"://"+location.Host+location.Path)
+			assert.Equal(t, "true", location.Query().Get("refresh"))
+			assert.Equal(t, publicTS.URL+profile.PublicProfileManagementPath, location.Query().Get("return_to"))
 
+			i, err := reg.PrivilegedIdentityPool().GetIdentity(context.Background(), primaryIdentity.ID)
+			require.NoError(t, err)
+			assert.NotContains(t, string(i.Traits), "not-john-doe")
+		})
+
+		t.Run("description=should tell which methods require signing in again", func(t *testing.T) {
+			rs := makeRequest(t)
+			res, err := primaryUser.Get(publicTS.URL + profile.PublicProfileManagementRequestPath + "?request=" + string(rs.Payload.ID))
+			require.NoError(t, err)
+			defer res.Body.Close()
 			body, err := ioutil.ReadAll(res.Body)
 			require.NoError(t, err)
-			assert.Contains(t, gjson.Get(string(body), "0.reason").String(), "A field was modified that updates one or more credentials-related settings", "%s", body)
+			require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+
+			assert.True(t, gjson.GetBytes(body, "reauthentication.profile.required").Bool(), "%s", body)
+			assert.False(t, gjson.GetBytes(body, "reauthentication.profile.privileged_until").Exists(), "%s", body)
+			assert.Contains(t, gjson.GetBytes(body, "reauthentication.profile.redirect_to").String(), "refresh=true", "%s", body)
+
+			assert.False(t, gjson.GetBytes(body, "reauthentication.sessions.required").Bool(), "%s", body)
+			assert.False(t, gjson.GetBytes(body, "reauthentication.sessions.redirect_to").Exists(), "%s", body)
 		})
 
 		t.Run("description=should retry with invalid payloads multiple times before succeeding", func(t *testing.T) {
@@ -432,5 +488,70 @@ func TestUpdateProfile(t *testing.T) {
 				assert.False(t, pointerx.BoolR(response.Payload.UpdateSuccessful), "%s", actual)
 			})
 		})
+
+		t.Run("description=should revoke all other sessions but keep the current one", func(t *testing.T) {
+			var other session.Session
+			require.NoError(t, faker.FakeData(&other))
+			other.Identity = primaryIdentity
+			other.IdentityID = primaryIdentity.ID
+			require.NoError(t, reg.SessionPersister().CreateSession(context.Background(), &other))
+
+			rs := makeRequest(t)
+			values := url.Values{}
+			for _, f := range rs.Payload.Form.Fields {
+				if pointerx.StringR(f.Name) == form.CSRFTokenName {
+					values.Set(form.CSRFTokenName, fmt.Sprintf("%v", f.Value))
+				}
+			}
+
+			res, err := primaryUser.PostForm(publicTS.URL+profile.PublicProfileManagementRevokePath+"?request="+string(rs.Payload.ID), values)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.EqualValues(t, http.StatusNoContent, res.StatusCode)
+			assert.Equal(t, "/profile", res.Request.URL.Path, "should end up at the profile URL")
+			assert.Equal(t, string(rs.Payload.ID), res.Request.URL.Query().Get("request"))
+
+			_, err = reg.SessionPersister().GetSession(context.Background(), other.ID)
+			require.Error(t, err)
+
+			// The current session must still be valid.
+			_ = makeRequest(t)
+		})
+
+		t.Run("description=should ask to login again before revoking other sessions if configured", func(t *testing.T) {
+			viper.Set(configuration.ViperKeySelfServiceProfilePrivilegedMethods, map[string]interface{}{
+				"sessions": map[string]interface{}{"max_age": "1ns"},
+			})
+			defer viper.Set(configuration.ViperKeySelfServiceProfilePrivilegedMethods, nil)
+
+			var other session.Session
+			require.NoError(t, faker.FakeData(&other))
+			other.Identity = primaryIdentity
+			other.IdentityID = primaryIdentity.ID
+			require.NoError(t, reg.SessionPersister().CreateSession(context.Background(), &other))
+
+			rs := makeRequest(t)
+			values := url.Values{}
+			for _, f := range rs.Payload.Form.Fields {
+				if pointerx.StringR(f.Name) == form.CSRFTokenName {
+					values.Set(form.CSRFTokenName, fmt.Sprintf("%v", f.Value))
+				}
+			}
+
+			c := *primaryUser
+			c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+			res, err := c.PostForm(publicTS.URL+profile.PublicProfileManagementRevokePath+"?request="+string(rs.Payload.ID), values)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.EqualValues(t, http.StatusFound, res.StatusCode)
+			location, err := res.Location()
+			require.NoError(t, err)
+			assert.Equal(t, publicTS.URL+login.BrowserLoginPath, location.Scheme+"://"+location.Host+location.Path)
+			assert.Equal(t, "true", location.Query().Get("refresh"))
+
+			_, err = reg.SessionPersister().GetSession(context.Background(), other.ID)
+			require.NoError(t, err)
+		})
 	})
 }
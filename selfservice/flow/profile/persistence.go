@@ -22,6 +22,9 @@ type (
 		CreateProfileRequest(context.Context, *Request) error
 		GetProfileRequest(ctx context.Context, id uuid.UUID) (*Request, error)
 		UpdateProfileRequest(context.Context, *Request) error
+
+		// UpdateProfileRequestForm only writes the form and the update state of the request.
+		UpdateProfileRequestForm(context.Context, *Request) error
 	}
 	RequestPersistenceProvider interface {
 		ProfileRequestPersister() RequestPersister
@@ -113,5 +116,24 @@ func TestRequestPersister(p interface {
 			assert.Equal(t, "/new-action", actual.Form.Action)
 			assert.Equal(t, "/new-request-url", actual.RequestURL)
 		})
+
+		t.Run("case=should only update the form of a profile request", func(t *testing.T) {
+			expected := newRequest(t)
+			require.NoError(t, p.CreateProfileRequest(context.Background(), expected))
+
+			expected.Form.Action = "/form-action"
+			expected.UpdateSuccessful = true
+			expected.RequestURL = "/ignored-request-url"
+			require.NoError(t, p.UpdateProfileRequestForm(context.Background(), expected))
+
+			actual, err := p.GetProfileRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "/form-action", actual.Form.Action)
+			assert.True(t, actual.UpdateSuccessful)
+			assert.NotEqual(t, "/ignored-request-url", actual.RequestURL)
+
+			expected.ID = x.NewUUID()
+			require.Error(t, p.UpdateProfileRequestForm(context.Background(), expected))
+		})
 	}
 }
@@ -0,0 +1,167 @@
+package profile
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/session"
+)
+
+// The profile management methods whose re-authentication requirements can be configured, see configuration key
+// selfservice.profile.privileged_methods. Second factors use their credentials type, for example "push".
+const (
+	// MethodProfile changes write-protected traits.
+	MethodProfile = "profile"
+
+	// MethodSessions signs out all other sessions of the identity.
+	MethodSessions = "sessions"
+)
+
+// Reauthentication is the re-authentication a profile management method requires.
+//
+// swagger:model profileManagementReauthentication
+type Reauthentication struct {
+	// Required is true if the method can only be used shortly after signing in.
+	//
+	// required: true
+	Required bool `json:"required"`
+
+	// SecondFactor is true if signing in has to complete the second factor as well, provided the identity set
+	// one up.
+	//
+	// required: true
+	SecondFactor bool `json:"second_factor"`
+
+	// PrivilegedUntil is the time (UTC) until which the current session may use the method. It is not set if the
+	// method is not required or if the user has to sign in again.
+	PrivilegedUntil *time.Time `json:"privileged_until,omitempty"`
+
+	// RedirectTo is the URL of the login which lets the user use the method. It is only set if the user has to
+	// sign in again, so that UIs can ask for it before the form is submitted.
+	RedirectTo string `json:"redirect_to,omitempty"`
+}
+
+// Satisfied returns true if the session may use the method.
+func (r *Reauthentication) Satisfied() bool {
+	return !r.Required || r.PrivilegedUntil != nil
+}
+
+type (
+	privilegedCheckerDependencies interface {
+		identity.PrivilegedPoolProvider
+		login.SecondFactorProvider
+	}
+	PrivilegedCheckerProvider interface {
+		ProfilePrivilegedChecker() *PrivilegedChecker
+	}
+	// PrivilegedChecker decides whether a session may use a profile management method or has to sign in again.
+	PrivilegedChecker struct {
+		d privilegedCheckerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewPrivilegedChecker(d privilegedCheckerDependencies, c configuration.Provider) *PrivilegedChecker {
+	return &PrivilegedChecker{d: d, c: c}
+}
+
+// Reauthentication returns the re-authentication the method requires from the session.
+func (c *PrivilegedChecker) Reauthentication(ctx context.Context, s *session.Session, method string) (*Reauthentication, error) {
+	return c.reauthentication(ctx, s, c.c.SelfServiceProfilePrivilegedMethods()[method])
+}
+
+// Reauthentications returns the re-authentication all configurable methods require from the session.
+func (c *PrivilegedChecker) Reauthentications(ctx context.Context, s *session.Session) (map[string]*Reauthentication, error) {
+	methods := c.c.SelfServiceProfilePrivilegedMethods()
+	rs := make(map[string]*Reauthentication, len(methods))
+	for method, m := range methods {
+		r, err := c.reauthentication(ctx, s, m)
+		if err != nil {
+			return nil, err
+		}
+		rs[method] = r
+	}
+	return rs, nil
+}
+
+// Check returns an error which asks the user to sign in again if the session may not use the method.
+func (c *PrivilegedChecker) Check(ctx context.Context, s *session.Session, method string) error {
+	r, err := c.Reauthentication(ctx, s, method)
+	if err != nil {
+		return err
+	}
+
+	if !r.Satisfied() {
+		return errors.WithStack(newPrivilegedSessionRequiredError(r.RedirectTo))
+	}
+	return nil
+}
+
+func (c *PrivilegedChecker) reauthentication(ctx context.Context, s *session.Session, m configuration.PrivilegedMethodConfig) (*Reauthentication, error) {
+	if !m.Required {
+		return &Reauthentication{}, nil
+	}
+
+	r := &Reauthentication{Required: true, SecondFactor: m.SecondFactor}
+	if s.IsPrivileged(m.MaxAge) {
+		completed := true
+		if m.SecondFactor {
+			var err error
+			if completed, err = c.completedSecondFactor(ctx, s); err != nil {
+				return nil, err
+			}
+		}
+
+		if completed {
+			until := s.AuthenticatedAt.Add(m.MaxAge).UTC()
+			r.PrivilegedUntil = &until
+			return r, nil
+		}
+	}
+
+	r.RedirectTo = c.loginURL().String()
+	return r, nil
+}
+
+// completedSecondFactor returns true if the session completed the second factor or if the identity did not set
+// one up. Second factors which are only offered as a fallback do not count on their own, like when signing in.
+func (c *PrivilegedChecker) completedSecondFactor(ctx context.Context, s *session.Session) (bool, error) {
+	if s.SecondFactorAuthenticated {
+		return true, nil
+	}
+
+	i, err := c.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, s.IdentityID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, factor := range c.d.LoginSecondFactors() {
+		if f, ok := factor.(login.FallbackSecondFactor); ok && f.IsFallbackOnly() {
+			continue
+		}
+		if factor.IsEnrolled(i) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// loginURL returns the URL of a login request which forces the user to authenticate again and then returns to the
+// profile management flow.
+func (c *PrivilegedChecker) loginURL() *url.URL {
+	return urlx.CopyWithQuery(
+		urlx.AppendPaths(c.c.SelfPublicURL(), login.BrowserLoginPath),
+		url.Values{
+			"refresh":   {"true"},
+			"return_to": {urlx.AppendPaths(c.c.SelfPublicURL(), PublicProfileManagementPath).String()},
+		},
+	)
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ory/herodot"
-	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/selfservice/form"
@@ -67,6 +66,18 @@ type Request struct {
 	// required: true
 	UpdateSuccessful bool `json:"update_successful,omitempty" faker:"-" db:"update_successful"`
 
+	// Reauthentication lists, per profile management method, whether the method requires the user to have signed
+	// in recently and whether the current session does. It is only set if the request is fetched using the public
+	// API.
+	Reauthentication map[string]*Reauthentication `json:"reauthentication,omitempty" faker:"-" db:"-"`
+
+	// Locale is the language of the request's messages. It is negotiated from the `locale` query parameter or the
+	// Accept-Language header when the request is initialized.
+	Locale string `json:"locale" faker:"-" db:"locale"`
+
+	// Binding binds the request to the browser which initiated it, see x.FlowBinder.
+	Binding string `json:"-" faker:"-" db:"browser_binding"`
+
 	// IdentityID is a helper struct field for gobuffalo.pop.
 	IdentityID uuid.UUID `json:"-" faker:"-" db:"identity_id"`
 	// CreatedAt is a helper struct field for gobuffalo.pop.
@@ -76,15 +87,7 @@ type Request struct {
 }
 
 func NewRequest(exp time.Duration, r *http.Request, s *session.Session) *Request {
-	source := urlx.Copy(r.URL)
-	source.Host = r.Host
-
-	if len(source.Scheme) == 0 {
-		source.Scheme = "http"
-		if r.TLS != nil {
-			source.Scheme = "https"
-		}
-	}
+	source := x.RequestURL(r)
 
 	return &Request{
 		ID:         x.NewUUID(),
@@ -97,6 +100,13 @@ func NewRequest(exp time.Duration, r *http.Request, s *session.Session) *Request
 	}
 }
 
+// Localize translates the messages of the form to the request's locale.
+func (r *Request) Localize(t form.Translator) {
+	if r.Form != nil {
+		r.Form.Localize(t, r.Locale)
+	}
+}
+
 func (r *Request) TableName() string {
 	return "selfservice_profile_management_requests"
 }
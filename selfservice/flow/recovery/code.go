@@ -0,0 +1,62 @@
+package recovery
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/randx"
+
+	"github.com/ory/kratos/x"
+)
+
+// Code is texted to a phone number of the identity which recovers its account. Only its keyed hash is stored. A
+// code is also stored if the phone number does not belong to an identity, so that entering it fails like entering
+// a wrong code does and does not tell whether the number is known.
+type Code struct {
+	ID uuid.UUID `json:"-" faker:"uuid" db:"id"`
+
+	RecoveryRequestID uuid.UUID `json:"-" faker:"-" db:"selfservice_recovery_request_id"`
+
+	// IdentityID is the identity the phone number belongs to. It is not set if the number is unknown.
+	IdentityID uuid.NullUUID `json:"-" faker:"-" db:"identity_id"`
+
+	// Address is the phone number the code was sent to.
+	Address string `json:"-" faker:"-" db:"address"`
+
+	// CodeHash is the HMAC of the code, see x.HashCode.
+	CodeHash string `json:"-" faker:"-" db:"code_hash"`
+
+	// Attempts is the number of times the code was entered.
+	Attempts int `json:"-" faker:"-" db:"attempts"`
+
+	Used bool `json:"-" faker:"-" db:"used"`
+
+	ExpiresAt time.Time `json:"-" faker:"time_type" db:"expires_at"`
+
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (c Code) TableName() string {
+	return "selfservice_recovery_codes"
+}
+
+// NewCode returns a code of length digits for the recovery request and the code itself, which is hashed with key.
+func NewCode(recoveryRequestID uuid.UUID, identityID uuid.NullUUID, address string, length int, lifespan time.Duration, key []byte) (*Code, string, error) {
+	code, err := randx.RuneSequence(length, randx.Numeric)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	id := x.NewUUID()
+	return &Code{
+		ID:                id,
+		RecoveryRequestID: recoveryRequestID,
+		IdentityID:        identityID,
+		Address:           address,
+		CodeHash:          x.HashCode(key, id, string(code)),
+		ExpiresAt:         time.Now().UTC().Add(lifespan),
+	}, string(code), nil
+}
@@ -0,0 +1,134 @@
+package recovery
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	errorHandlerDependencies interface {
+		errorx.ManagementProvider
+		x.WriterProvider
+		x.LoggingProvider
+		x.CSRFTokenGeneratorProvider
+		x.FlowBinderProvider
+		PersistenceProvider
+	}
+
+	ErrorHandlerProvider interface{ RecoveryRequestErrorHandler() *ErrorHandler }
+
+	ErrorHandler struct {
+		d errorHandlerDependencies
+		c configuration.Provider
+	}
+
+	errRequestExpired struct {
+		*herodot.DefaultError
+	}
+)
+
+func newErrRequestExpired(when float64) error {
+	return errors.WithStack(&errRequestExpired{herodot.ErrBadRequest.
+		WithError("recovery request expired").
+		WithReasonf("The recovery request expired %.2f minutes ago, please try again.", when).
+		WithDetail(errorx.DetailErrorID, errorx.ErrorIDFlowExpired)})
+}
+
+func newInvalidCodeError(reason string) error {
+	return errors.WithStack(herodot.ErrBadRequest.
+		WithReason(reason).
+		WithDetail(errorx.DetailErrorID, form.ErrorIDRecoveryCodeInvalid))
+}
+
+func NewErrorHandler(d errorHandlerDependencies, c configuration.Provider) *ErrorHandler {
+	return &ErrorHandler{
+		d: d,
+		c: c,
+	}
+}
+
+// HandleCSRFFailure is a handler for x.OriginCSRFHandler which shows errors of submissions that failed the CSRF
+// check in the recovery request they belong to.
+func (s *ErrorHandler) HandleCSRFFailure(w http.ResponseWriter, r *http.Request, err error) {
+	rr, gerr := s.d.RecoveryPersister().GetRecoveryRequest(r.Context(), x.ParseUUID(r.URL.Query().Get("request")))
+	if gerr != nil {
+		rr = nil
+	}
+
+	s.HandleRecoveryError(w, r, rr, err)
+}
+
+func (s *ErrorHandler) HandleRecoveryError(
+	w http.ResponseWriter,
+	r *http.Request,
+	rr *Request,
+	err error,
+) {
+	x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).
+		WithField("details", fmt.Sprintf("%+v", err)).
+		WithField("recovery_request", rr).
+		Warn("Encountered self-service recovery error.")
+
+	if rr == nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	} else if x.IsJSONRequest(r) {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if e, ok := errorsx.Cause(err).(*errRequestExpired); ok {
+		a := NewRequest(
+			s.c.SelfServiceRecovery().RequestLifespan, r, rr.Method,
+			urlx.AppendPaths(s.c.SelfPublicURL(), strings.Replace(PublicRecoveryCompletePath, ":method", string(rr.Method), 1)), s.d.GenerateCSRFToken,
+		)
+		a.Locale = rr.Locale
+		a.Form.AddError(&form.Error{ID: form.ErrorIDFlowExpired, Message: e.ReasonField})
+
+		binding, err := s.d.FlowBinder().Bind(w, r, a.ID)
+		if err != nil {
+			s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+			return
+		}
+		a.Binding = binding
+
+		if err := s.d.RecoveryPersister().CreateRecoveryRequest(r.Context(), a); err != nil {
+			s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+			return
+		}
+
+		http.Redirect(w, r,
+			urlx.CopyWithQuery(s.c.RecoveryURL(), url.Values{"request": {a.ID.String()}}).String(),
+			http.StatusFound,
+		)
+		return
+	}
+
+	if err := rr.Form.ParseError(err); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	if err := s.d.RecoveryPersister().UpdateRecoveryRequest(r.Context(), rr); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(s.c.RecoveryURL(), url.Values{"request": {rr.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
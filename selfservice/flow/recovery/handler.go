@@ -0,0 +1,1260 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/nosurf"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/pagination"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/courier"
+	templates "github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/selfservice/strategy/password"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/token"
+	"github.com/ory/kratos/webhook"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	PublicRecoveryInitPath     = "/self-service/browser/flows/recovery/:method"
+	PublicRecoveryCompletePath = "/self-service/browser/flows/recovery/:method/complete"
+	PublicRecoveryRequestPath  = "/self-service/browser/flows/requests/recovery"
+	PublicRecoveryConfirmPath  = "/self-service/browser/flows/recovery/:method/confirm/:token"
+	PublicRecoveryRevertPath   = "/self-service/recovery/revert/:token"
+
+	AdminRecoveryTicketsPath = "/recovery/tickets"
+	AdminRecoveryLinksPath   = "/recovery/links"
+)
+
+type (
+	HandlerProvider interface {
+		RecoveryHandler() *Handler
+	}
+	handlerDependencies interface {
+		errorx.ManagementProvider
+		identity.ManagementProvider
+		identity.PrivilegedPoolProvider
+		courier.Provider
+		notification.SenderProvider
+		session.PersistenceProvider
+		session.BackChannelLogoutProvider
+		token.ManagerProvider
+		webhook.DispatcherProvider
+		password.ValidationProvider
+		password.HashProvider
+		cipher.Provider
+		x.CSRFTokenGeneratorProvider
+		x.FlowBinderProvider
+		x.LoggingProvider
+		x.WriterProvider
+		i18n.CatalogProvider
+
+		PersistenceProvider
+		ErrorHandlerProvider
+	}
+	Handler struct {
+		d handlerDependencies
+		c configuration.Provider
+
+		addressLimiter *x.RateLimiter
+		clientLimiter  *x.RateLimiter
+	}
+)
+
+func NewHandler(d handlerDependencies, c configuration.Provider) *Handler {
+	conf := c.SelfServiceRecovery()
+	return &Handler{
+		c:              c,
+		d:              d,
+		addressLimiter: x.NewRateLimiter(conf.MaxSendsPerHour, time.Hour),
+		clientLimiter:  x.NewRateLimiter(conf.MaxSendsPerIPPerHour, time.Hour),
+	}
+}
+
+func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
+	public.GET(PublicRecoveryInitPath, h.init)
+	public.GET(PublicRecoveryRequestPath, h.publicFetch)
+	public.POST(PublicRecoveryCompletePath, h.complete)
+	public.GET(PublicRecoveryConfirmPath, h.confirm)
+	public.GET(PublicRecoveryRevertPath, h.confirmRevert)
+	public.POST(PublicRecoveryRevertPath, h.revert)
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(PublicRecoveryRequestPath, h.adminFetch)
+	admin.GET(AdminRecoveryTicketsPath, h.listTickets)
+	admin.GET(AdminRecoveryTicketsPath+"/:id", h.getTicket)
+	admin.POST(AdminRecoveryTicketsPath+"/:id/approve", h.approveTicket)
+	admin.POST(AdminRecoveryTicketsPath+"/:id/reject", h.rejectTicket)
+	admin.POST(AdminRecoveryLinksPath, h.createLink)
+}
+
+// nolint:deadcode,unused
+// swagger:parameters initializeSelfServiceBrowserRecoveryFlow
+type initializeSelfServiceBrowserRecoveryFlowParameters struct {
+	// How to recover the account
+	//
+	// Either "link", "sms", or "manual".
+	//
+	// required: true
+	// in: path
+	Method string `json:"method"`
+}
+
+// swagger:route GET /self-service/browser/flows/recovery/{method} public initializeSelfServiceBrowserRecoveryFlow
+//
+// Initialize browser-based account recovery flow
+//
+// This endpoint initializes a browser-based account recovery flow. Once initialized, the browser will be redirected
+// to `urls.recovery_ui` with the request ID set as a query parameter. Each method has to be enabled using
+// `selfservice.recovery.<method>.enabled`, otherwise this endpoint responds with 404 Not Found.
+//
+// > This endpoint is NOT INTENDED for API clients and only works
+// with browsers (Chrome, Firefox, ...).
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) init(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	method, err := h.toMethod(ps)
+	if err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	a, err := h.newRequest(w, r, method)
+	if err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	if err := h.d.RecoveryPersister().CreateRecoveryRequest(r.Context(), a); err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(h.c.RecoveryURL(), url.Values{"request": {a.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
+// newRequest returns a request of the method which is bound to the browser.
+func (h *Handler) newRequest(w http.ResponseWriter, r *http.Request, method Method) (*Request, error) {
+	a := NewRequest(
+		h.c.SelfServiceRecovery().RequestLifespan, r, method,
+		urlx.AppendPaths(h.c.SelfPublicURL(), strings.Replace(PublicRecoveryCompletePath, ":method", string(method), 1)), h.d.GenerateCSRFToken,
+	)
+	a.Locale = h.d.I18nCatalog().Negotiate(r)
+
+	binding, err := h.d.FlowBinder().Bind(w, r, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	a.Binding = binding
+	return a, nil
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getSelfServiceRecoveryRequest
+type getSelfServiceRecoveryRequestParameters struct {
+	// Request is the Request ID
+	//
+	// The value for this parameter comes from `request` URL Query parameter sent to your
+	// application (e.g. `/recovery?request=abcde`).
+	//
+	// required: true
+	// in: query
+	Request string `json:"request"`
+}
+
+// swagger:route GET /self-service/browser/flows/requests/recovery common public admin getSelfServiceRecoveryRequest
+//
+// Get the request context of browser-based account recovery flows
+//
+// When accessing this endpoint through ORY Kratos' Public API, ensure that cookies are set as they are required
+// for checking the auth session. To prevent scanning attacks, the public endpoint does not return 404 status codes
+// but instead 403 or 500.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: recoveryRequest
+//       403: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) publicFetch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := h.fetch(w, r, true); err != nil {
+		h.d.Writer().WriteError(w, r, herodot.ErrForbidden.WithReasonf("Access privileges are missing, invalid, or not sufficient to access this endpoint.").WithTrace(err).WithDebugf("%s", err))
+		return
+	}
+}
+
+func (h *Handler) adminFetch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := h.fetch(w, r, false); err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) fetch(w http.ResponseWriter, r *http.Request, mustVerify bool) error {
+	rid := x.ParseUUID(r.URL.Query().Get("request"))
+	ar, err := h.d.RecoveryPersister().GetRecoveryRequest(r.Context(), rid)
+	if err != nil {
+		return err
+	}
+
+	if mustVerify && !nosurf.VerifyToken(h.d.GenerateCSRFToken(r), ar.CSRFToken) {
+		return errors.WithStack(x.ErrInvalidCSRFToken.WithDebugf("Expected %s but got %s", h.d.GenerateCSRFToken(r), ar.CSRFToken))
+	}
+
+	ar.Localize(h.d.I18nCatalog())
+	h.d.Writer().Write(w, r, ar)
+	return nil
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceBrowserRecoveryFlow
+type completeSelfServiceBrowserRecoveryFlowParameters struct {
+	// Request is the Request ID
+	//
+	// The value for this parameter comes from `request` URL Query parameter sent to your
+	// application (e.g. `/recovery?request=abcde`).
+	//
+	// required: true
+	// in: query
+	Request string `json:"request"`
+
+	// How to recover the account
+	//
+	// Either "link", "sms", or "manual".
+	//
+	// required: true
+	// in: path
+	Method string `json:"method"`
+}
+
+// swagger:route POST /self-service/browser/flows/recovery/{method}/complete public completeSelfServiceBrowserRecoveryFlow
+//
+// Complete a step of the browser-based account recovery flow
+//
+// The fields of the request's form depend on its state. In the state "send", the link method asks for an email
+// address, the sms method for a phone number, and the manual method for a contact address and evidence of the
+// account's ownership. Messages are only sent to addresses which belong to an identity, but the flow continues
+// the same way for unknown addresses. The sms method then asks for the texted code.
+//
+// Once the identity proved that it owns the account, the request asks for a new password. Choosing it revokes all
+// sessions of the identity and redirects the browser to the login flow, where the identity signs in using the new
+// password and, if it set one up, its second factor. Every verified address of the identity is sent a link which
+// undoes the recovery, see revertSelfServiceRecovery.
+//
+// > This endpoint is NOT INTENDED for API clients and only works with browsers (Chrome, Firefox, ...) and HTML Forms.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       404: genericError
+//       429: genericError
+//       500: genericError
+func (h *Handler) complete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	method, err := h.toMethod(ps)
+	if err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.handleError(w, r, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to parse the request: %s", err)))
+		return
+	}
+
+	rid := x.ParseUUID(r.URL.Query().Get("request"))
+	if x.IsZeroUUID(rid) {
+		h.handleError(w, r, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The request query parameter is missing or invalid.")))
+		return
+	}
+
+	rr, err := h.d.RecoveryPersister().GetRecoveryRequest(r.Context(), rid)
+	if err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	if rr.Method != method {
+		h.handleError(w, r, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The recovery request was initialized for the method %s.", rr.Method)))
+		return
+	}
+
+	if err := rr.Valid(); err != nil {
+		h.handleError(w, r, rr, err)
+		return
+	}
+
+	if err := h.d.FlowBinder().Verify(r, rr.ID, rr.Binding); err != nil {
+		h.handleError(w, r, rr, err)
+		return
+	}
+
+	switch {
+	case rr.State == StateSend && rr.Method == MethodLink:
+		err = h.sendLink(r, rr)
+	case rr.State == StateSend && rr.Method == MethodSMS:
+		err = h.sendCode(r, rr)
+	case rr.State == StateSend && rr.Method == MethodManual:
+		err = h.createTicket(r, rr)
+	case rr.State == StateEnterCode:
+		err = h.enterCode(r, rr)
+	case rr.State == StateChoosePassword:
+		err = h.choosePassword(r, rr)
+	default:
+		err = errors.WithStack(herodot.ErrBadRequest.WithReasonf("The request was already completed and can not be retried."))
+	}
+	if err != nil {
+		h.handleError(w, r, rr, err)
+		return
+	}
+
+	if err := h.d.RecoveryPersister().UpdateRecoveryRequest(r.Context(), rr); err != nil {
+		h.handleError(w, r, rr, err)
+		return
+	}
+
+	if rr.State == StateRecovered {
+		http.Redirect(w, r, urlx.AppendPaths(h.c.SelfPublicURL(), login.BrowserLoginPath).String(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(h.c.RecoveryURL(), url.Values{"request": {rr.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
+// sendLink emails a recovery link to the address. Unknown addresses are sent a message which tells that there is
+// no account for the address.
+func (h *Handler) sendLink(r *http.Request, rr *Request) error {
+	to := strings.TrimSpace(r.PostForm.Get(FieldEmail))
+	if len(to) == 0 {
+		return schema.NewRequiredError("#/", FieldEmail)
+	} else if !jsonschema.Formats["email"](to) {
+		return schema.NewInvalidFormatError("#/"+FieldEmail, "email", to)
+	}
+
+	if err := h.allowSend(r, to); err != nil {
+		return err
+	}
+
+	ctx := i18n.WithLocale(r.Context(), rr.Locale)
+	address, err := h.d.PrivilegedIdentityPool().FindAddressByValue(ctx, identity.VerifiableAddressTypeEmail, to)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		if _, err := h.d.Courier().QueueEmail(ctx, templates.NewRecoveryInvalid(h.c, &templates.RecoveryInvalidModel{To: to, Locale: rr.Locale})); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if _, err := h.sendRecoveryLink(ctx, address.IdentityID, to, MethodLink, h.c.SelfServiceRecovery().LinkLifespan); err != nil {
+		return err
+	}
+
+	rr.SetState(StateSent, rr.Form.Action)
+	return nil
+}
+
+// sendCode texts a recovery code to the phone number. Unknown phone numbers are not sent a text message, as text
+// messages cost money, but a code is stored nevertheless, so that the flow continues as if the number was known.
+func (h *Handler) sendCode(r *http.Request, rr *Request) error {
+	to := strings.TrimSpace(r.PostForm.Get(FieldPhone))
+	if len(to) == 0 {
+		return schema.NewRequiredError("#/", FieldPhone)
+	} else if !identity.IsPhoneNumber(to) {
+		return schema.NewInvalidFormatError("#/"+FieldPhone, "tel", to)
+	}
+
+	if err := h.allowSend(r, to); err != nil {
+		return err
+	}
+
+	ctx := i18n.WithLocale(r.Context(), rr.Locale)
+	var identityID uuid.NullUUID
+	if address, err := h.d.PrivilegedIdentityPool().FindAddressByValue(ctx, identity.VerifiableAddressTypeSMS, to); err == nil {
+		identityID = uuid.NullUUID{UUID: address.IdentityID, Valid: true}
+	} else if errorsx.Cause(err) != sqlcon.ErrNoRows {
+		return err
+	}
+
+	conf := h.c.SelfServiceRecovery()
+	c, code, err := NewCode(rr.ID, identityID, to, conf.SMSCodeLength, conf.SMSCodeLifespan, h.key())
+	if err != nil {
+		return err
+	}
+
+	if err := h.d.RecoveryPersister().CreateRecoveryCode(ctx, c); err != nil {
+		return err
+	}
+
+	if identityID.Valid {
+		if _, err := h.d.Courier().QueueSMS(ctx, templates.NewRecoveryCode(h.c, &templates.RecoveryCodeModel{
+			To:               to,
+			Code:             code,
+			ExpiresInMinutes: int(conf.SMSCodeLifespan.Minutes()),
+			Locale:           rr.Locale,
+		})); err != nil {
+			return err
+		}
+	}
+
+	rr.SetState(StateEnterCode, rr.Form.Action)
+	return nil
+}
+
+// enterCode checks the texted code. Once the code expired or was entered incorrectly too often, the request asks
+// for the phone number again, so that a new code can be sent.
+func (h *Handler) enterCode(r *http.Request, rr *Request) error {
+	code := strings.TrimSpace(r.PostForm.Get(FieldCode))
+	if len(code) == 0 {
+		return schema.NewRequiredError("#/", FieldCode)
+	}
+
+	c, err := h.d.RecoveryPersister().GetLatestRecoveryCode(r.Context(), rr.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.d.RecoveryPersister().UseRecoveryCodeAttempt(r.Context(), c.ID, h.c.SelfServiceRecovery().SMSMaxAttempts); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		rr.SetState(StateSend, rr.Form.Action)
+		return newInvalidCodeError("The code has expired or was entered incorrectly too often, please request a new one.")
+	} else if err != nil {
+		return err
+	}
+
+	if !c.IdentityID.Valid || !hmac.Equal([]byte(x.HashCode(h.key(), c.ID, code)), []byte(c.CodeHash)) {
+		x.ContextLogger(r.Context(), h.d.Logger()).
+			WithField("recovery_request_id", rr.ID).
+			WithField("client_ip", x.ClientIP(r).String()).
+			Info("An invalid recovery code was entered.")
+		return newInvalidCodeError("The code is invalid.")
+	}
+
+	if err := h.d.RecoveryPersister().MarkRecoveryCodeUsed(r.Context(), c.ID); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		rr.SetState(StateSend, rr.Form.Action)
+		return newInvalidCodeError("The code was used already, please request a new one.")
+	} else if err != nil {
+		return err
+	}
+
+	rr.IdentityID = c.IdentityID
+	rr.SetState(StateChoosePassword, rr.Form.Action)
+	return nil
+}
+
+// createTicket creates a manual recovery ticket and emits it to the webhook subscriptions, so that an
+// administrator can review it.
+func (h *Handler) createTicket(r *http.Request, rr *Request) error {
+	contact := strings.TrimSpace(r.PostForm.Get(FieldContact))
+	evidence := strings.TrimSpace(r.PostForm.Get(FieldEvidence))
+	if len(contact) == 0 {
+		return schema.NewRequiredError("#/", FieldContact)
+	} else if len(evidence) == 0 {
+		return schema.NewRequiredError("#/", FieldEvidence)
+	} else if !jsonschema.Formats["email"](contact) && !identity.IsPhoneNumber(contact) {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The contact must be an email address or a phone number in the E.164 format, for example %q.", "+4917612345678"))
+	} else if utf8.RuneCountInString(evidence) > maxEvidenceLength {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The evidence must not be longer than %d characters.", maxEvidenceLength))
+	}
+
+	if err := h.allowSend(r, contact); err != nil {
+		return err
+	}
+
+	t := &Ticket{
+		ID:       x.NewUUID(),
+		Contact:  contact,
+		Evidence: evidence,
+		State:    TicketStatePending,
+		Locale:   rr.Locale,
+	}
+	if err := h.d.RecoveryPersister().CreateRecoveryTicket(r.Context(), t); err != nil {
+		return err
+	}
+
+	x.ContextLogger(r.Context(), h.d.Logger()).
+		WithField("audit", "recovery").
+		WithField("recovery_ticket_id", t.ID).
+		WithField("client_ip", x.ClientIP(r).String()).
+		Info("A manual recovery ticket was created.")
+	h.d.WebhookDispatcher().Emit(r.Context(), webhook.EventRecoveryTicketCreated, t)
+
+	rr.SetState(StateSent, rr.Form.Action)
+	return nil
+}
+
+// choosePassword replaces the password of the identity and revokes all of its sessions, as whoever lost access
+// to the account might have lost it to someone else.
+func (h *Handler) choosePassword(r *http.Request, rr *Request) error {
+	pw := r.PostForm.Get(FieldPassword)
+	if len(pw) == 0 {
+		return schema.NewRequiredError("#/", FieldPassword)
+	}
+
+	if !rr.IdentityID.Valid {
+		return errors.WithStack(herodot.ErrInternalServerError.WithDebug("The recovery request asks for a password but is not bound to an identity."))
+	}
+
+	ctx := r.Context()
+	i, err := h.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, rr.IdentityID.UUID)
+	if err != nil {
+		return err
+	}
+
+	c, ok := i.GetCredentials(identity.CredentialsTypePassword)
+	if !ok {
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("Your account does not have a password which could be recovered. Please sign in using another method of your account."))
+	}
+
+	for _, id := range c.Identifiers {
+		if err := h.d.PasswordValidator().Validate(id, pw); err != nil {
+			if _, ok := errorsx.Cause(err).(*herodot.DefaultError); ok {
+				return err
+			}
+			return schema.NewPasswordPolicyViolationError("#/"+FieldPassword, err.Error())
+		}
+	}
+
+	hpw, err := h.d.PasswordHasher().Generate([]byte(pw))
+	if err != nil {
+		return err
+	}
+
+	co, err := json.Marshal(&password.CredentialsConfig{HashedPassword: string(hpw), PasswordChangedAt: time.Now().UTC()})
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err))
+	}
+
+	// Two submissions might arrive concurrently, only one of them may change the password.
+	if err := h.d.RecoveryPersister().UpdateRecoveryRequestState(ctx, rr.ID, StateChoosePassword, StateRecovered); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The request was already completed and can not be retried."))
+	} else if err != nil {
+		return err
+	}
+
+	// The link which undoes the recovery restores the previous password, so it has to be minted before the
+	// password is replaced.
+	revertURL, revertExpiresAt, err := h.mintRevertLink(ctx, i.ID, c.Config)
+	if err != nil {
+		return err
+	}
+
+	c.Config = co
+	i.SetCredentials(identity.CredentialsTypePassword, *c)
+	if err := h.d.IdentityManager().Update(ctx, i); err != nil {
+		return err
+	}
+
+	if err := h.d.SessionBackChannelLogout().NotifyIdentity(ctx, i.ID); err != nil {
+		return err
+	}
+
+	if err := h.d.SessionPersister().DeleteSessionsFor(ctx, i.ID); err != nil {
+		return err
+	}
+
+	x.ContextLogger(ctx, h.d.Logger()).
+		WithField("audit", "recovery").
+		WithField("identity_id", i.ID).
+		WithField("method", rr.Method).
+		WithField("client_ip", x.ClientIP(r).String()).
+		Info("An account was recovered.")
+
+	if err := h.d.NotificationSender().NotifyAccountRecovered(i18n.WithLocale(ctx, rr.Locale), i, revertURL, revertExpiresAt); err != nil {
+		return err
+	}
+
+	rr.SetState(StateRecovered, rr.Form.Action)
+	return nil
+}
+
+// revertPayload is the payload of tokens which undo a recovery.
+type revertPayload struct {
+	// RecoveredAt is the time (UTC) the account was recovered. Sessions issued since then are revoked.
+	RecoveredAt time.Time `json:"recovered_at"`
+
+	// Password is the encrypted configuration of the password credentials before the recovery.
+	Password string `json:"password"`
+}
+
+// mintRevertLink mints the token which restores the previous password configuration and returns the link
+// which redeems it.
+func (h *Handler) mintRevertLink(ctx context.Context, identityID uuid.UUID, previous json.RawMessage) (string, time.Time, error) {
+	encrypted, err := h.d.Cipher().Encrypt(previous)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	payload, err := json.Marshal(&revertPayload{RecoveredAt: time.Now().UTC(), Password: encrypted})
+	if err != nil {
+		return "", time.Time{}, errors.WithStack(err)
+	}
+
+	t, value, err := h.d.TokenManager().Mint(ctx, token.PurposeRecoveryRevert, identityID, h.c.SelfServiceRecovery().RevertLifespan, payload)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return urlx.AppendPaths(h.c.SelfPublicURL(), strings.Replace(PublicRecoveryRevertPath, ":token", value, 1)).String(), t.ExpiresAt, nil
+}
+
+// revertPage asks for a confirmation before the recovery is undone. Mail scanners and link previews open links,
+// so only submitting the form undoes the recovery.
+var revertPage = template.Must(template.New("revert").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Undo the account recovery</title>
+</head>
+<body>
+<p>Your account was recovered recently. If it was not you, undo the recovery to restore your previous password and sign out everyone who signed in since.</p>
+<form method="POST" action="{{.Action}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<button type="submit">Undo the recovery</button>
+</form>
+</body>
+</html>
+`))
+
+// nolint:deadcode,unused
+// swagger:parameters confirmSelfServiceRecoveryRevert revertSelfServiceRecovery
+type revertSelfServiceRecoveryParameters struct {
+	// required: true
+	// in: path
+	Token string `json:"token"`
+}
+
+// swagger:route GET /self-service/recovery/revert/{token} public confirmSelfServiceRecoveryRevert
+//
+// Confirm undoing an account recovery
+//
+// After a recovery, every verified email address and phone number of the identity is sent a link to this endpoint.
+// It renders a form which asks for a confirmation and submits it to `POST /self-service/recovery/revert/{token}`.
+// Opening the link does not undo the recovery.
+//
+// > This endpoint is NOT INTENDED for API clients and only works with browsers (Chrome, Firefox, ...).
+//
+//     Produces:
+//     - text/html
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: emptyResponse
+//       500: genericError
+func (h *Handler) confirmRevert(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := revertPage.Execute(w, &struct {
+		Action    string
+		CSRFToken string
+	}{
+		Action:    urlx.AppendPaths(h.c.SelfPublicURL(), strings.Replace(PublicRecoveryRevertPath, ":token", ps.ByName("token"), 1)).String(),
+		CSRFToken: h.d.GenerateCSRFToken(r),
+	}); err != nil {
+		x.ContextLogger(r.Context(), h.d.Logger()).WithError(err).Error("Unable to render the page which undoes the recovery.")
+	}
+}
+
+// swagger:route POST /self-service/recovery/revert/{token} public revertSelfServiceRecovery
+//
+// Undo an account recovery
+//
+// Restores the password the identity had before the recovery and revokes all sessions which were issued since,
+// which locks out whoever recovered the account without the owner's consent. The form is rendered by
+// `GET /self-service/recovery/revert/{token}` and protected against CSRF. The link is valid for
+// `selfservice.recovery.revert.lifespan` and can only be used once.
+//
+// > This endpoint is NOT INTENDED for API clients and only works with browsers (Chrome, Firefox, ...).
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       500: genericError
+func (h *Handler) revert(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t, err := h.d.TokenManager().Redeem(r, ps.ByName("token"), token.PurposeRecoveryRevert)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The link to undo the recovery has expired or was otherwise invalid.")))
+		return
+	} else if err != nil {
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	if err := h.revertRecovery(r, t); err != nil {
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, urlx.AppendPaths(h.c.SelfPublicURL(), login.BrowserLoginPath).String(), http.StatusFound)
+}
+
+// revertRecovery restores the password of the token's payload and revokes the sessions which were issued since
+// the recovery.
+func (h *Handler) revertRecovery(r *http.Request, t *token.Token) error {
+	var p revertPayload
+	if err := json.NewDecoder(bytes.NewBuffer(t.Payload)).Decode(&p); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the payload of the token: %s", err))
+	}
+
+	previous, err := h.d.Cipher().Decrypt(p.Password)
+	if err != nil {
+		return err
+	}
+
+	ctx := r.Context()
+	i, err := h.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, t.IdentityID)
+	if err != nil {
+		return err
+	}
+
+	c, ok := i.GetCredentials(identity.CredentialsTypePassword)
+	if !ok {
+		c = &identity.Credentials{Type: identity.CredentialsTypePassword}
+	}
+	c.Config = previous
+	i.SetCredentials(identity.CredentialsTypePassword, *c)
+	if err := h.d.IdentityManager().Update(ctx, i); err != nil {
+		return err
+	}
+
+	ss, err := h.d.SessionPersister().ListSessionsFor(ctx, i.ID)
+	if err != nil {
+		return err
+	}
+
+	for k := range ss {
+		if ss[k].IssuedAt.Before(p.RecoveredAt) {
+			continue
+		}
+
+		if err := h.d.SessionBackChannelLogout().NotifySession(ctx, &ss[k]); err != nil {
+			return err
+		}
+
+		if err := h.d.SessionPersister().DeleteSession(ctx, ss[k].ID); err != nil {
+			return err
+		}
+	}
+
+	x.ContextLogger(ctx, h.d.Logger()).
+		WithField("audit", "recovery").
+		WithField("identity_id", i.ID).
+		WithField("recovered_at", p.RecoveredAt).
+		WithField("client_ip", x.ClientIP(r).String()).
+		Warn("An account recovery was undone.")
+	return nil
+}
+
+// nolint:deadcode,unused
+// swagger:parameters selfServiceBrowserRecover
+type selfServiceBrowserRecoverParameters struct {
+	// required: true
+	// in: path
+	Token string `json:"token"`
+
+	// Either "link" or "manual".
+	//
+	// required: true
+	// in: path
+	Method string `json:"method"`
+}
+
+// swagger:route GET /self-service/browser/flows/recovery/{method}/confirm/{token} public selfServiceBrowserRecover
+//
+// Open a recovery link
+//
+// Recovery links are emailed by the link method and issued by approving manual recovery tickets. Opening the link
+// redeems it and initializes a recovery request which asks for the new password. Invalid links initialize a
+// recovery request which shows the error instead.
+//
+// > This endpoint is NOT INTENDED for API clients and only works with browsers (Chrome, Firefox, ...).
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) confirm(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	method, err := h.toMethod(ps)
+	if err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	} else if method == MethodSMS {
+		h.handleError(w, r, nil, errors.WithStack(herodot.ErrNotFound.WithReason("Recovery links are only sent by the link and manual methods.")))
+		return
+	}
+
+	a, err := h.newRequest(w, r, method)
+	if err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	t, err := h.d.TokenManager().Redeem(r, ps.ByName("token"), token.PurposeRecovery)
+	if err == nil && linkMethod(t) != method {
+		err = errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	switch cause := errorsx.Cause(err); {
+	case cause == nil:
+		a.IdentityID = uuid.NullUUID{UUID: t.IdentityID, Valid: true}
+		a.SetState(StateChoosePassword, a.Form.Action)
+	case cause == sqlcon.ErrNoRows:
+		a.Form.AddError(&form.Error{ID: form.ErrorIDRecoveryLinkInvalid, Message: "The recovery link has expired or was otherwise invalid. Please request another link."})
+	case cause == &identity.ErrAlreadyRedeemed:
+		a.Form.AddError(&form.Error{ID: identity.AlreadyRedeemedErrorID, Message: "This recovery link was already used. Please request another link."})
+	default:
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	if err := h.d.RecoveryPersister().CreateRecoveryRequest(r.Context(), a); err != nil {
+		h.handleError(w, r, nil, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(h.c.RecoveryURL(), url.Values{"request": {a.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
+// linkPayload is the payload of recovery tokens.
+type linkPayload struct {
+	Method Method `json:"method"`
+}
+
+func linkMethod(t *token.Token) Method {
+	var p linkPayload
+	_ = json.NewDecoder(bytes.NewBuffer(t.Payload)).Decode(&p)
+	return p.Method
+}
+
+// mintRecoveryLink mints a recovery token for the identity and returns the link which redeems it and its expiry.
+func (h *Handler) mintRecoveryLink(ctx context.Context, identityID uuid.UUID, method Method, lifespan time.Duration) (string, time.Time, error) {
+	payload, err := json.Marshal(&linkPayload{Method: method})
+	if err != nil {
+		return "", time.Time{}, errors.WithStack(err)
+	}
+
+	t, value, err := h.d.TokenManager().Mint(ctx, token.PurposeRecovery, identityID, lifespan, payload)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return urlx.AppendPaths(h.c.SelfPublicURL(),
+		strings.NewReplacer(":method", string(method), ":token", value).Replace(PublicRecoveryConfirmPath)).String(), t.ExpiresAt, nil
+}
+
+// sendRecoveryLink mints a recovery token for the identity and sends the link to the email address or phone
+// number. It returns the link.
+func (h *Handler) sendRecoveryLink(ctx context.Context, identityID uuid.UUID, to string, method Method, lifespan time.Duration) (string, error) {
+	link, expiresAt, err := h.mintRecoveryLink(ctx, identityID, method, lifespan)
+	if err != nil {
+		return "", err
+	}
+
+	tpl := templates.NewRecoveryValid(h.c, &templates.RecoveryValidModel{
+		To:          to,
+		RecoveryURL: link,
+		ExpiresAt:   expiresAt,
+		Locale:      i18n.LocaleFromContext(ctx),
+	})
+
+	if identity.IsPhoneNumber(to) {
+		_, err = h.d.Courier().QueueSMS(ctx, tpl)
+	} else {
+		_, err = h.d.Courier().QueueEmail(ctx, tpl)
+	}
+	if err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// A list of manual recovery tickets.
+//
+// swagger:response recoveryTickets
+// nolint:deadcode,unused
+type recoveryTicketsResponse struct {
+	// in: body
+	Body []Ticket
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listRecoveryTickets
+type listRecoveryTicketsParameters struct {
+	// State is "pending", "approved", or "rejected". If it is not set, tickets of all states are returned.
+	//
+	// in: query
+	State string `json:"state"`
+}
+
+// swagger:route GET /recovery/tickets admin listRecoveryTickets
+//
+// List manual recovery tickets
+//
+// Returns the tickets of the manual recovery method, oldest first.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: recoveryTickets
+//       400: genericError
+//       500: genericError
+func (h *Handler) listTickets(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	state := TicketState(r.URL.Query().Get("state"))
+	switch state {
+	case "", TicketStatePending, TicketStateApproved, TicketStateRejected:
+	default:
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unknown ticket state: %s", state)))
+		return
+	}
+
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	ts, err := h.d.RecoveryPersister().ListRecoveryTickets(r.Context(), state, limit, offset)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.d.Writer().Write(w, r, ts)
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getRecoveryTicket approveRecoveryTicket rejectRecoveryTicket
+type recoveryTicketParameters struct {
+	// ID is the ID of the ticket.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /recovery/tickets/{id} admin getRecoveryTicket
+//
+// Get a manual recovery ticket
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: recoveryTicket
+//       404: genericError
+//       500: genericError
+func (h *Handler) getTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t, err := h.d.RecoveryPersister().GetRecoveryTicket(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.d.Writer().Write(w, r, t)
+}
+
+// ApproveTicket is the body of the request which approves a manual recovery ticket.
+//
+// swagger:model approveRecoveryTicketBody
+type ApproveTicket struct {
+	// IdentityID is the identity the user recovers.
+	//
+	// required: true
+	IdentityID uuid.UUID `json:"identity_id"`
+}
+
+// ApprovedTicket is an approved manual recovery ticket and the recovery link which was issued for it.
+//
+// swagger:model approvedRecoveryTicket
+type ApprovedTicket struct {
+	Ticket
+
+	// RecoveryURL is the recovery link which was sent to the contact address of the ticket.
+	//
+	// required: true
+	RecoveryURL string `json:"recovery_url"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters approveRecoveryTicket
+type approveRecoveryTicketParameters struct {
+	// in: body
+	// required: true
+	Body ApproveTicket
+}
+
+// swagger:route POST /recovery/tickets/{id}/approve admin approveRecoveryTicket
+//
+// Approve a manual recovery ticket
+//
+// Issues a recovery link for the identity and sends it to the contact address of the ticket. The link is valid
+// for `selfservice.recovery.manual.lifespan` and is also returned, so that it can be handed out by other means.
+// Tickets can only be approved or rejected once.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: approvedRecoveryTicket
+//       400: genericError
+//       404: genericError
+//       409: genericError
+//       500: genericError
+func (h *Handler) approveTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !h.c.SelfServiceRecovery().ManualEnabled {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("Manual account recovery is disabled.")))
+		return
+	}
+
+	var body ApproveTicket
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&body); err != nil {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	i, err := h.d.PrivilegedIdentityPool().GetIdentity(r.Context(), body.IdentityID)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The identity %s does not exist.", body.IdentityID)))
+		return
+	} else if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	t, err := h.reviewTicket(r, x.ParseUUID(ps.ByName("id")), TicketStateApproved, uuid.NullUUID{UUID: i.ID, Valid: true})
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	link, err := h.sendRecoveryLink(i18n.WithLocale(r.Context(), t.Locale), i.ID, t.Contact, MethodManual, h.c.SelfServiceRecovery().ManualLinkLifespan)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.d.Writer().Write(w, r, &ApprovedTicket{Ticket: *t, RecoveryURL: link})
+}
+
+// swagger:route POST /recovery/tickets/{id}/reject admin rejectRecoveryTicket
+//
+// Reject a manual recovery ticket
+//
+// The user is not notified. Tickets can only be approved or rejected once.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       409: genericError
+//       500: genericError
+func (h *Handler) rejectTicket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if _, err := h.reviewTicket(r, x.ParseUUID(ps.ByName("id")), TicketStateRejected, uuid.NullUUID{}); err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateRecoveryLink is the body of the request which creates a recovery link for an identity.
+//
+// swagger:model createRecoveryLinkBody
+type CreateRecoveryLink struct {
+	// IdentityID is the identity the link recovers.
+	//
+	// required: true
+	IdentityID uuid.UUID `json:"identity_id"`
+}
+
+// RecoveryLink is a recovery link which was issued by an administrator.
+//
+// swagger:model recoveryLink
+type RecoveryLink struct {
+	// RecoveryURL is the recovery link. It is not sent to the identity.
+	//
+	// required: true
+	RecoveryURL string `json:"recovery_url"`
+
+	// ExpiresAt is the time at which the link expires.
+	//
+	// required: true
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters createRecoveryLink
+type createRecoveryLinkParameters struct {
+	// in: body
+	// required: true
+	Body CreateRecoveryLink
+}
+
+// swagger:route POST /recovery/links admin createRecoveryLink
+//
+// Create a recovery link
+//
+// Issues a recovery link for the identity without sending it anywhere, so that support staff can hand it out by
+// other means. The link completes the manual recovery method and is valid for `selfservice.recovery.manual.lifespan`.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: recoveryLink
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) createLink(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !h.c.SelfServiceRecovery().ManualEnabled {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("Manual account recovery is disabled.")))
+		return
+	}
+
+	var body CreateRecoveryLink
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&body); err != nil {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	i, err := h.d.PrivilegedIdentityPool().GetIdentity(r.Context(), body.IdentityID)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The identity %s does not exist.", body.IdentityID)))
+		return
+	} else if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	link, expiresAt, err := h.mintRecoveryLink(r.Context(), i.ID, MethodManual, h.c.SelfServiceRecovery().ManualLinkLifespan)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.d.Writer().Write(w, r, &RecoveryLink{RecoveryURL: link, ExpiresAt: expiresAt})
+}
+
+// reviewTicket approves or rejects the ticket and returns it.
+func (h *Handler) reviewTicket(r *http.Request, id uuid.UUID, state TicketState, identityID uuid.NullUUID) (*Ticket, error) {
+	if _, err := h.d.RecoveryPersister().GetRecoveryTicket(r.Context(), id); err != nil {
+		return nil, err
+	}
+
+	if err := h.d.RecoveryPersister().ReviewRecoveryTicket(r.Context(), id, state, identityID); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		return nil, errors.WithStack(herodot.ErrConflict.WithReason("The ticket was approved or rejected already."))
+	} else if err != nil {
+		return nil, err
+	}
+
+	x.ContextLogger(r.Context(), h.d.Logger()).
+		WithField("audit", "recovery").
+		WithField("recovery_ticket_id", id).
+		WithField("identity_id", identityID.UUID).
+		WithField("state", state).
+		Info("A manual recovery ticket was reviewed.")
+	return h.d.RecoveryPersister().GetRecoveryTicket(r.Context(), id)
+}
+
+// allowSend returns x.ErrTooManyRequests if the address was sent too many recovery messages or the client asked
+// for too many of them.
+func (h *Handler) allowSend(r *http.Request, address string) error {
+	ip := x.ClientIP(r).String()
+	if !h.clientLimiter.Allow(ip) || !h.addressLimiter.Allow(address) {
+		x.ContextLogger(r.Context(), h.d.Logger()).
+			WithField("client_ip", ip).
+			Warn("Denied recovery message because the address or the client exceeded the rate limit.")
+		return errors.WithStack(&x.ErrTooManyRequests)
+	}
+	return nil
+}
+
+func (h *Handler) key() []byte {
+	if secrets := h.c.SessionSecrets(); len(secrets) > 0 {
+		return secrets[0]
+	}
+	return nil
+}
+
+// handleError is a convenience function for handling all types of errors that may occur (e.g. validation error).
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, rr *Request, err error) {
+	if rr != nil {
+		rr.Form.Reset()
+		rr.Form.SetCSRF(h.d.GenerateCSRFToken(r))
+	}
+
+	h.d.RecoveryRequestErrorHandler().HandleRecoveryError(w, r, rr, err)
+}
+
+func (h *Handler) toMethod(ps httprouter.Params) (Method, error) {
+	conf := h.c.SelfServiceRecovery()
+	switch m := Method(ps.ByName("method")); {
+	case m == MethodLink && conf.LinkEnabled, m == MethodSMS && conf.SMSEnabled, m == MethodManual && conf.ManualEnabled:
+		return m, nil
+	}
+	return "", errors.WithStack(herodot.ErrNotFound.WithReasonf("Account recovery using the method %q is unknown or disabled.", ps.ByName("method")))
+}
@@ -0,0 +1,261 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		RecoveryPersister() Persister
+	}
+	Persister interface {
+		CreateRecoveryRequest(context.Context, *Request) error
+		GetRecoveryRequest(ctx context.Context, id uuid.UUID) (*Request, error)
+		UpdateRecoveryRequest(context.Context, *Request) error
+
+		// UpdateRecoveryRequestState moves the request from one state to another. It returns sqlcon.ErrNoRows if
+		// the request is not in the from state, for example because it was completed concurrently.
+		UpdateRecoveryRequestState(ctx context.Context, id uuid.UUID, from, to State) error
+
+		CreateRecoveryCode(context.Context, *Code) error
+
+		// GetLatestRecoveryCode returns the code which was sent last for the recovery request.
+		GetLatestRecoveryCode(ctx context.Context, recoveryRequestID uuid.UUID) (*Code, error)
+
+		// UseRecoveryCodeAttempt counts an attempt to enter the code. It returns sqlcon.ErrNoRows if the code was
+		// used, has expired, or was entered maxAttempts times already.
+		UseRecoveryCodeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) error
+
+		// MarkRecoveryCodeUsed marks the code as used. It returns sqlcon.ErrNoRows if it was used already.
+		MarkRecoveryCodeUsed(ctx context.Context, id uuid.UUID) error
+
+		CreateRecoveryTicket(context.Context, *Ticket) error
+		GetRecoveryTicket(ctx context.Context, id uuid.UUID) (*Ticket, error)
+
+		// ListRecoveryTickets returns the tickets, oldest first. If state is not empty, only the tickets of the
+		// state are returned.
+		ListRecoveryTickets(ctx context.Context, state TicketState, limit, offset int) ([]Ticket, error)
+
+		// ReviewRecoveryTicket approves or rejects a pending ticket. It returns sqlcon.ErrNoRows if the ticket
+		// does not exist or was reviewed already.
+		ReviewRecoveryTicket(ctx context.Context, id uuid.UUID, state TicketState, identityID uuid.NullUUID) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	return func(t *testing.T) {
+		newRequest := func(t *testing.T) *Request {
+			var r Request
+			require.NoError(t, faker.FakeData(&r))
+			r.ID = uuid.UUID{}
+			r.Method = MethodSMS
+			r.SetState(StateSend, "some/action")
+			require.NoError(t, p.CreateRecoveryRequest(context.Background(), &r))
+			return &r
+		}
+
+		newIdentity := func(t *testing.T) *identity.Identity {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+			return &i
+		}
+
+		key := []byte("0123456789abcdef")
+
+		t.Run("suite=request", func(t *testing.T) {
+			t.Run("case=should error when the request does not exist", func(t *testing.T) {
+				_, err := p.GetRecoveryRequest(context.Background(), x.NewUUID())
+				require.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+			})
+
+			t.Run("case=should create and fetch a request", func(t *testing.T) {
+				expected := newRequest(t)
+				actual, err := p.GetRecoveryRequest(context.Background(), expected.ID)
+				require.NoError(t, err)
+
+				factual, err := json.Marshal(actual.Form)
+				require.NoError(t, err)
+				fexpected, err := json.Marshal(expected.Form)
+				require.NoError(t, err)
+
+				assert.EqualValues(t, expected.ID, actual.ID)
+				assert.JSONEq(t, string(fexpected), string(factual))
+				x.AssertEqualTime(t, expected.IssuedAt, actual.IssuedAt)
+				x.AssertEqualTime(t, expected.ExpiresAt, actual.ExpiresAt)
+				assert.EqualValues(t, expected.RequestURL, actual.RequestURL)
+				assert.EqualValues(t, MethodSMS, actual.Method)
+				assert.EqualValues(t, StateSend, actual.State)
+				assert.EqualValues(t, expected.CSRFToken, actual.CSRFToken)
+				assert.False(t, actual.IdentityID.Valid)
+			})
+
+			t.Run("case=should update a request", func(t *testing.T) {
+				expected := newRequest(t)
+				i := newIdentity(t)
+
+				expected.IdentityID = uuid.NullUUID{UUID: i.ID, Valid: true}
+				expected.SetState(StateChoosePassword, "/new-action")
+				require.NoError(t, p.UpdateRecoveryRequest(context.Background(), expected))
+
+				actual, err := p.GetRecoveryRequest(context.Background(), expected.ID)
+				require.NoError(t, err)
+				assert.Equal(t, "/new-action", actual.Form.Action)
+				assert.EqualValues(t, StateChoosePassword, actual.State)
+				assert.Equal(t, i.ID, actual.IdentityID.UUID)
+			})
+
+			t.Run("case=should only change the state from the expected one", func(t *testing.T) {
+				r := newRequest(t)
+
+				require.NoError(t, p.UpdateRecoveryRequestState(context.Background(), r.ID, StateSend, StateSent))
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UpdateRecoveryRequestState(context.Background(), r.ID, StateSend, StateSent)))
+
+				actual, err := p.GetRecoveryRequest(context.Background(), r.ID)
+				require.NoError(t, err)
+				assert.EqualValues(t, StateSent, actual.State)
+			})
+		})
+
+		t.Run("suite=code", func(t *testing.T) {
+			i := newIdentity(t)
+
+			t.Run("case=should error when no code was sent", func(t *testing.T) {
+				_, err := p.GetLatestRecoveryCode(context.Background(), x.NewUUID())
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+			})
+
+			t.Run("case=should create and fetch the latest code", func(t *testing.T) {
+				r := newRequest(t)
+
+				first, _, err := NewCode(r.ID, uuid.NullUUID{UUID: i.ID, Valid: true}, "+4917612345678", 6, time.Hour, key)
+				require.NoError(t, err)
+				first.CreatedAt = time.Now().UTC().Add(-time.Minute)
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), first))
+
+				second, code, err := NewCode(r.ID, uuid.NullUUID{}, "+4917612345679", 6, time.Hour, key)
+				require.NoError(t, err)
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), second))
+				assert.Len(t, code, 6)
+
+				actual, err := p.GetLatestRecoveryCode(context.Background(), r.ID)
+				require.NoError(t, err)
+				assert.Equal(t, second.ID, actual.ID)
+				assert.Equal(t, x.HashCode(key, second.ID, code), actual.CodeHash)
+				assert.Equal(t, "+4917612345679", actual.Address)
+				assert.False(t, actual.IdentityID.Valid)
+				assert.False(t, actual.Used)
+			})
+
+			t.Run("case=should limit the attempts", func(t *testing.T) {
+				c, _, err := NewCode(newRequest(t).ID, uuid.NullUUID{UUID: i.ID, Valid: true}, "+4917612345678", 6, time.Hour, key)
+				require.NoError(t, err)
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), c))
+
+				require.NoError(t, p.UseRecoveryCodeAttempt(context.Background(), c.ID, 2))
+				require.NoError(t, p.UseRecoveryCodeAttempt(context.Background(), c.ID, 2))
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UseRecoveryCodeAttempt(context.Background(), c.ID, 2)))
+			})
+
+			t.Run("case=should only use a code once", func(t *testing.T) {
+				c, _, err := NewCode(newRequest(t).ID, uuid.NullUUID{UUID: i.ID, Valid: true}, "+4917612345678", 6, time.Hour, key)
+				require.NoError(t, err)
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), c))
+
+				require.NoError(t, p.MarkRecoveryCodeUsed(context.Background(), c.ID))
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.MarkRecoveryCodeUsed(context.Background(), c.ID)))
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UseRecoveryCodeAttempt(context.Background(), c.ID, 5)))
+			})
+
+			t.Run("case=should not count attempts of expired codes", func(t *testing.T) {
+				c, _, err := NewCode(newRequest(t).ID, uuid.NullUUID{UUID: i.ID, Valid: true}, "+4917612345678", 6, -time.Minute, key)
+				require.NoError(t, err)
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), c))
+
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UseRecoveryCodeAttempt(context.Background(), c.ID, 5)))
+			})
+		})
+
+		t.Run("suite=ticket", func(t *testing.T) {
+			newTicket := func(t *testing.T) *Ticket {
+				tk := &Ticket{ID: x.NewUUID(), Contact: "recovery-ticket@ory.sh", Evidence: "I signed up in May.", State: TicketStatePending, Locale: "de"}
+				require.NoError(t, p.CreateRecoveryTicket(context.Background(), tk))
+				return tk
+			}
+
+			t.Run("case=should error when the ticket does not exist", func(t *testing.T) {
+				_, err := p.GetRecoveryTicket(context.Background(), x.NewUUID())
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+			})
+
+			t.Run("case=should create and fetch a ticket", func(t *testing.T) {
+				expected := newTicket(t)
+				actual, err := p.GetRecoveryTicket(context.Background(), expected.ID)
+				require.NoError(t, err)
+				assert.Equal(t, expected.Contact, actual.Contact)
+				assert.Equal(t, expected.Evidence, actual.Evidence)
+				assert.Equal(t, TicketStatePending, actual.State)
+				assert.Equal(t, "de", actual.Locale)
+				assert.Nil(t, actual.ReviewedAt)
+			})
+
+			t.Run("case=should review a ticket once", func(t *testing.T) {
+				tk := newTicket(t)
+				i := newIdentity(t)
+
+				require.NoError(t, p.ReviewRecoveryTicket(context.Background(), tk.ID, TicketStateApproved, uuid.NullUUID{UUID: i.ID, Valid: true}))
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.ReviewRecoveryTicket(context.Background(), tk.ID, TicketStateRejected, uuid.NullUUID{})))
+				assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.ReviewRecoveryTicket(context.Background(), x.NewUUID(), TicketStateRejected, uuid.NullUUID{})))
+
+				actual, err := p.GetRecoveryTicket(context.Background(), tk.ID)
+				require.NoError(t, err)
+				assert.Equal(t, TicketStateApproved, actual.State)
+				assert.Equal(t, i.ID, actual.IdentityID.UUID)
+				assert.NotNil(t, actual.ReviewedAt)
+			})
+
+			t.Run("case=should list the tickets of a state", func(t *testing.T) {
+				pending, rejected := newTicket(t), newTicket(t)
+				require.NoError(t, p.ReviewRecoveryTicket(context.Background(), rejected.ID, TicketStateRejected, uuid.NullUUID{}))
+
+				ids := func(ts []Ticket) []uuid.UUID {
+					ids := make([]uuid.UUID, len(ts))
+					for k := range ts {
+						ids[k] = ts[k].ID
+					}
+					return ids
+				}
+
+				ts, err := p.ListRecoveryTickets(context.Background(), TicketStatePending, 500, 0)
+				require.NoError(t, err)
+				assert.Contains(t, ids(ts), pending.ID)
+				assert.NotContains(t, ids(ts), rejected.ID)
+
+				ts, err = p.ListRecoveryTickets(context.Background(), "", 500, 0)
+				require.NoError(t, err)
+				assert.Contains(t, ids(ts), pending.ID)
+				assert.Contains(t, ids(ts), rejected.ID)
+			})
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package recovery
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+// Method is how the user proves that they own the account they want to recover.
+type Method string
+
+const (
+	// MethodLink emails a recovery link to an email address of the identity.
+	MethodLink Method = "link"
+	// MethodSMS texts a recovery code to a phone number of the identity.
+	MethodSMS Method = "sms"
+	// MethodManual creates a ticket which an administrator reviews. Approving the ticket issues a recovery link.
+	MethodManual Method = "manual"
+)
+
+// State is the step of a recovery request.
+type State string
+
+const (
+	// StateSend asks for the address the recovery message is sent to or, for manual recovery, for the evidence.
+	StateSend State = "send"
+	// StateSent is the state of link and manual recovery requests once the message was sent or the ticket was
+	// created. The user continues using the link they receive.
+	StateSent State = "sent"
+	// StateEnterCode asks for the code which was texted to the user.
+	StateEnterCode State = "enter_code"
+	// StateChoosePassword asks for the new password of the identity.
+	StateChoosePassword State = "choose_password"
+	// StateRecovered is the state of requests which changed the password of the identity.
+	StateRecovered State = "recovered"
+)
+
+// The names of the form fields of recovery requests.
+const (
+	FieldEmail    = "email"
+	FieldPhone    = "phone"
+	FieldCode     = "code"
+	FieldContact  = "contact"
+	FieldEvidence = "evidence"
+	FieldPassword = "password"
+)
+
+// Request presents a recovery request
+//
+// This request is used when an identity lost access to its account, for example because it forgot its password.
+//
+// swagger:model recoveryRequest
+type Request struct {
+	// ID represents the request's unique ID. When performing the recovery flow, this
+	// represents the id in the recovery ui's query parameter: http://<urls.recovery_ui>?request=<id>
+	//
+	// type: string
+	// format: uuid
+	ID uuid.UUID `json:"id" db:"id" faker:"uuid" rw:"r"`
+
+	// ExpiresAt is the time (UTC) when the request expires. If the user still wishes to recover the account,
+	// a new request has to be initiated.
+	ExpiresAt time.Time `json:"expires_at" faker:"time_type" db:"expires_at"`
+
+	// IssuedAt is the time (UTC) when the request occurred.
+	IssuedAt time.Time `json:"issued_at" faker:"time_type" db:"issued_at"`
+
+	// RequestURL is the initial URL that was requested from ORY Kratos. It can be used
+	// to forward information contained in the URL's path or query for example.
+	RequestURL string `json:"request_url" db:"request_url"`
+
+	// Form contains form fields, errors, and so on. Its fields depend on the state of the request.
+	Form *form.HTMLForm `json:"form" faker:"-" db:"form"`
+
+	// Method is either "link", "sms", or "manual".
+	Method Method `json:"method" faker:"-" db:"method"`
+
+	// State is "send", "sent", "enter_code", "choose_password", or "recovered".
+	State State `json:"state" faker:"-" db:"state"`
+
+	// CSRFToken contains the anti-csrf token associated with this request.
+	CSRFToken string `json:"-" db:"csrf_token"`
+
+	// Binding binds the request to the browser which initiated it, see x.FlowBinder.
+	Binding string `json:"-" faker:"-" db:"browser_binding"`
+
+	// IdentityID is the identity which proved that it owns the account and chooses a new password.
+	IdentityID uuid.NullUUID `json:"-" faker:"-" db:"identity_id"`
+
+	// Locale is the language of the request's messages. It is negotiated from the `locale` query parameter or the
+	// Accept-Language header when the request is initialized.
+	Locale string `json:"locale" faker:"-" db:"locale"`
+
+	// CreatedAt is a helper struct field for gobuffalo.pop.
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	// UpdatedAt is a helper struct field for gobuffalo.pop.
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (r Request) TableName() string {
+	return "selfservice_recovery_requests"
+}
+
+func NewRequest(exp time.Duration, r *http.Request, method Method, action *url.URL, generator form.CSRFGenerator) *Request {
+	id := x.NewUUID()
+	rr := &Request{
+		ID:         id,
+		ExpiresAt:  time.Now().UTC().Add(exp),
+		IssuedAt:   time.Now().UTC(),
+		RequestURL: x.RequestURL(r).String(),
+		Method:     method,
+		CSRFToken:  generator(r),
+	}
+	rr.SetState(StateSend, urlx.CopyWithQuery(action, url.Values{"request": {id.String()}}).String())
+	return rr
+}
+
+// SetState moves the request to the state and replaces its form with the fields of the state.
+func (r *Request) SetState(s State, action string) {
+	r.State = s
+
+	f := form.NewHTMLForm(action)
+	f.SetCSRF(r.CSRFToken)
+	switch s {
+	case StateSend:
+		switch r.Method {
+		case MethodLink:
+			f.SetField(form.Field{Name: FieldEmail, Type: "email", Required: true})
+		case MethodSMS:
+			f.SetField(form.Field{Name: FieldPhone, Type: "tel", Required: true})
+		case MethodManual:
+			f.SetField(form.Field{Name: FieldContact, Type: "text", Required: true})
+			f.SetField(form.Field{Name: FieldEvidence, Type: "textarea", Required: true})
+		}
+	case StateEnterCode:
+		f.SetField(form.Field{Name: FieldCode, Type: "text", Pattern: "[0-9]*", Required: true})
+	case StateChoosePassword:
+		f.SetField(form.Field{Name: FieldPassword, Type: "password", Required: true})
+	}
+	r.Form = f
+}
+
+// Localize translates the messages of the form to the request's locale.
+func (r *Request) Localize(t form.Translator) {
+	if r.Form != nil {
+		r.Form.Localize(t, r.Locale)
+	}
+}
+
+func (r *Request) Valid() error {
+	if r.ExpiresAt.Before(time.Now()) {
+		return newErrRequestExpired(time.Since(r.ExpiresAt).Minutes())
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package recovery
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// TicketState is the state of a manual recovery ticket.
+type TicketState string
+
+const (
+	// TicketStatePending is the state of tickets which were neither approved nor rejected yet.
+	TicketStatePending TicketState = "pending"
+	// TicketStateApproved is the state of tickets for which a recovery link was issued.
+	TicketStateApproved TicketState = "approved"
+	// TicketStateRejected is the state of tickets which were rejected.
+	TicketStateRejected TicketState = "rejected"
+)
+
+// maxEvidenceLength is the maximum number of characters of the evidence of a ticket.
+const maxEvidenceLength = 4096
+
+// Ticket is a request for manual account recovery. The user describes why they own the account, an administrator
+// reviews the evidence and, if convinced, approves the ticket for the identity, which issues a recovery link.
+//
+// swagger:model recoveryTicket
+type Ticket struct {
+	// type: string
+	// format: uuid
+	ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+	// Contact is the email address or phone number the recovery link is sent to once the ticket was approved.
+	Contact string `json:"contact" db:"contact"`
+
+	// Evidence is what the user told to prove that they own the account, for example the date they signed up.
+	Evidence string `json:"evidence" db:"evidence"`
+
+	// State is "pending", "approved", or "rejected".
+	State TicketState `json:"state" faker:"-" db:"state"`
+
+	// IdentityID is the identity the ticket was approved for.
+	IdentityID uuid.NullUUID `json:"identity_id,omitempty" faker:"-" db:"identity_id"`
+
+	// ReviewedAt is the time (UTC) the ticket was approved or rejected.
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty" faker:"-" db:"reviewed_at"`
+
+	// Locale is the language of the recovery link's message.
+	Locale string `json:"locale" faker:"-" db:"locale"`
+
+	CreatedAt time.Time `json:"created_at" faker:"-" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" faker:"-" db:"updated_at"`
+}
+
+func (t Ticket) TableName() string {
+	return "selfservice_recovery_tickets"
+}
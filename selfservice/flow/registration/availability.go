@@ -0,0 +1,150 @@
+package registration
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+const AvailabilityPath = "/self-service/registration/availability"
+
+// Availability tells whether an identifier can still be used to sign up.
+//
+// swagger:model identifierAvailability
+type Availability struct {
+	// Identifier is the identifier which was checked, normalized the same way it would be stored.
+	//
+	// required: true
+	Identifier string `json:"identifier"`
+
+	// Available is false if the identifier is used by an identity already.
+	//
+	// required: true
+	Available bool `json:"available"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters checkIdentifierAvailability adminCheckIdentifierAvailability
+type checkIdentifierAvailabilityParameters struct {
+	// Identifier is the identifier (e.g. email address or username) to check.
+	//
+	// required: true
+	// in: query
+	Identifier string `json:"identifier"`
+}
+
+// swagger:route GET /self-service/registration/availability public checkIdentifierAvailability
+//
+// Check whether an identifier is available
+//
+// This endpoint lets registration UIs tell users that an identifier (e.g. an email address or username) is taken
+// before they submit the registration form. It must be enabled using `selfservice.registration.availability.enabled`
+// and is rate limited per client IP address (`selfservice.registration.availability.rate_limit`).
+//
+// Because this endpoint reveals which accounts exist, `selfservice.registration.availability.privacy_mode` can be
+// enabled. In privacy mode every identifier is reported as available and conflicts are only reported when the
+// registration form is submitted. Privacy mode is always enabled if `security.account_enumeration.mitigate` is set.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identifierAvailability
+//       400: genericError
+//       404: genericError
+//       429: genericError
+//       500: genericError
+func (h *Handler) publicCheckAvailability(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	conf := h.c.SelfServiceRegistrationAvailability()
+	if !conf.Enabled {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("Checking the availability of identifiers is disabled.")))
+		return
+	}
+
+	if ip := x.ClientIP(r); !h.availabilityLimiter.Allow(ip.String()) {
+		x.ContextLogger(r.Context(), h.d.Logger()).
+			WithField("client_ip", ip.String()).
+			Warn("Denied identifier availability check because the client exceeded the rate limit.")
+		h.d.Writer().WriteError(w, r, errors.WithStack(&x.ErrTooManyRequests))
+		return
+	}
+
+	identifier, err := availabilityIdentifier(r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if conf.PrivacyMode || h.c.SecurityAccountEnumerationMitigate() {
+		h.d.Writer().Write(w, r, &Availability{Identifier: identifier, Available: true})
+		return
+	}
+
+	h.writeAvailability(w, r, identifier)
+}
+
+// swagger:route GET /self-service/registration/availability admin adminCheckIdentifierAvailability
+//
+// Check whether an identifier is available
+//
+// Unlike the public endpoint, this endpoint is neither rate limited nor affected by privacy mode.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: identifierAvailability
+//       400: genericError
+//       500: genericError
+func (h *Handler) adminCheckAvailability(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	identifier, err := availabilityIdentifier(r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.writeAvailability(w, r, identifier)
+}
+
+func (h *Handler) writeAvailability(w http.ResponseWriter, r *http.Request, identifier string) {
+	available, err := h.isAvailable(r.Context(), identifier)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.d.Writer().Write(w, r, &Availability{Identifier: identifier, Available: available})
+}
+
+func (h *Handler) isAvailable(ctx context.Context, identifier string) (bool, error) {
+	if _, _, err := h.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(ctx, identity.CredentialsTypePassword, identifier); err != nil {
+		if e, ok := errorsx.Cause(err).(interface{ StatusCode() int }); ok && e.StatusCode() == http.StatusNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// availabilityIdentifier returns the identifier of the request, lower-cased as identifiers are when they are stored.
+func availabilityIdentifier(r *http.Request) (string, error) {
+	identifier := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("identifier")))
+	if len(identifier) == 0 {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReason("The identifier query parameter must be set."))
+	}
+	return identifier, nil
+}
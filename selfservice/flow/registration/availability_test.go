@@ -0,0 +1,120 @@
+package registration_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/x"
+)
+
+func TestAvailability(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/registration.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceAvailabilityEnabled, true)
+	viper.Set(configuration.ViperKeySelfServiceAvailabilityRateLimit, 5)
+
+	public, admin := x.NewRouterPublic(), x.NewRouterAdmin()
+	reg.RegistrationHandler().RegisterPublicRoutes(public)
+	reg.RegistrationHandler().RegisterAdminRoutes(admin)
+	publicTS, adminTS := httptest.NewServer(public), httptest.NewServer(admin)
+	defer publicTS.Close()
+	defer adminTS.Close()
+
+	require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), &identity.Identity{
+		ID: x.NewUUID(),
+		Credentials: map[identity.CredentialsType]identity.Credentials{
+			identity.CredentialsTypePassword: {Type: identity.CredentialsTypePassword, Identifiers: []string{"taken@ory.sh"}, Config: json.RawMessage(`{"hashed_password":"foo"}`)},
+		},
+		Traits:         identity.Traits(`{"bar":"taken@ory.sh"}`),
+		TraitsSchemaID: configuration.DefaultIdentityTraitsSchemaID,
+	}))
+
+	check := func(t *testing.T, ts *httptest.Server, identifier string) (int, string) {
+		res, err := ts.Client().Get(ts.URL + registration.AvailabilityPath + "?identifier=" + url.QueryEscape(identifier))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	t.Run("endpoint=admin", func(t *testing.T) {
+		for _, tc := range []struct {
+			identifier string
+			available  bool
+		}{
+			{identifier: "taken@ory.sh", available: false},
+			{identifier: " Taken@ORY.sh ", available: false},
+			{identifier: "free@ory.sh", available: true},
+		} {
+			t.Run("identifier="+tc.identifier, func(t *testing.T) {
+				status, body := check(t, adminTS, tc.identifier)
+				assert.Equal(t, http.StatusOK, status, body)
+				assert.Equal(t, tc.available, gjson.Get(body, "available").Bool(), body)
+			})
+		}
+
+		status, body := check(t, adminTS, "")
+		assert.Equal(t, http.StatusBadRequest, status, body)
+	})
+
+	t.Run("endpoint=public", func(t *testing.T) {
+		status, body := check(t, publicTS, "taken@ory.sh")
+		assert.Equal(t, http.StatusOK, status, body)
+		assert.False(t, gjson.Get(body, "available").Bool(), body)
+
+		t.Run("case=privacy mode", func(t *testing.T) {
+			viper.Set(configuration.ViperKeySelfServiceAvailabilityPrivacyMode, true)
+			defer viper.Set(configuration.ViperKeySelfServiceAvailabilityPrivacyMode, false)
+
+			status, body := check(t, publicTS, "taken@ory.sh")
+			assert.Equal(t, http.StatusOK, status, body)
+			assert.True(t, gjson.Get(body, "available").Bool(), body)
+		})
+
+		t.Run("case=account enumeration mitigation", func(t *testing.T) {
+			viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, true)
+			defer viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, false)
+
+			status, body := check(t, publicTS, "taken@ory.sh")
+			assert.Equal(t, http.StatusOK, status, body)
+			assert.True(t, gjson.Get(body, "available").Bool(), body)
+		})
+
+		t.Run("case=disabled", func(t *testing.T) {
+			viper.Set(configuration.ViperKeySelfServiceAvailabilityEnabled, false)
+			defer viper.Set(configuration.ViperKeySelfServiceAvailabilityEnabled, true)
+
+			status, body := check(t, publicTS, "taken@ory.sh")
+			assert.Equal(t, http.StatusNotFound, status, body)
+		})
+
+		t.Run("case=rate limited", func(t *testing.T) {
+			var status int
+			var body string
+			for i := 0; i < 5; i++ {
+				status, body = check(t, publicTS, "free@ory.sh")
+			}
+			assert.Equal(t, http.StatusTooManyRequests, status, body)
+			assert.Equal(t, x.RateLimitErrorID, gjson.Get(body, "error.details.error_id").String(), body)
+
+			status, body = check(t, adminTS, "free@ory.sh")
+			assert.Equal(t, http.StatusOK, status, "the admin endpoint must not be rate limited: %s", body)
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package registration
+
+import (
+	"expvar"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+// BotMetricsPath serves the number of registrations rejected as bot submissions on the admin API.
+const BotMetricsPath = "/metrics/registration-bots"
+
+// Reasons for rejecting a registration as a bot submission.
+const (
+	BotReasonHoneypot = "honeypot"
+	BotReasonTooFast  = "too_fast"
+)
+
+// BotRejected counts the registrations rejected as bot submissions per reason.
+var BotRejected = expvar.NewMap("kratos_registration_bot_rejected_total")
+
+// CheckBotSubmission rejects the submission of the registration request if it filled the honeypot field or was
+// submitted sooner than humans can fill in the form, see configuration.RegistrationBotProtectionConfig. The honeypot
+// field is read from the parsed form, so it must be called after the form was decoded.
+//
+// The error does not tell why the registration was rejected, so that bots can not learn how to pass the checks.
+func (e *HookExecutor) CheckBotSubmission(r *http.Request, a *Request) error {
+	conf := e.c.SelfServiceRegistrationBotProtection()
+
+	var reason string
+	if len(conf.HoneypotField) > 0 && len(r.PostForm.Get(conf.HoneypotField)) > 0 {
+		reason = BotReasonHoneypot
+	} else if conf.MinSubmitTime > 0 && time.Since(a.IssuedAt) < conf.MinSubmitTime {
+		reason = BotReasonTooFast
+	} else {
+		return nil
+	}
+
+	BotRejected.Add(reason, 1)
+	x.ContextLogger(r.Context(), e.d.Logger()).
+		WithField("registration_request", a.ID).
+		WithField("client_ip", x.ClientIP(r).String()).
+		WithField("reason", reason).
+		Info("Rejected a registration which was likely submitted by a bot.")
+	return errors.WithStack(herodot.ErrBadRequest.
+		WithReason("The registration could not be completed. Please try again.").
+		WithDetail(errorx.DetailErrorID, form.ErrorIDRegistrationFailed))
+}
+
+// ServeBotMetrics writes the number of registrations rejected as bot submissions per reason as JSON.
+func ServeBotMetrics(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(BotRejected.String()))
+}
@@ -0,0 +1,205 @@
+package registration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ory/jsonschema/v3"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/fetcher"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/x"
+)
+
+// builtinDisposableDomains is used to detect disposable email addresses if no list URL is configured. It only
+// contains the most common providers, configure a list URL for a comprehensive list.
+var builtinDisposableDomains = parseDomainList([]byte(`
+10minutemail.com
+20minutemail.com
+33mail.com
+anonbox.net
+burnermail.io
+discard.email
+dispostable.com
+emailondeck.com
+fakeinbox.com
+getairmail.com
+getnada.com
+guerrillamail.biz
+guerrillamail.com
+guerrillamail.de
+guerrillamail.info
+guerrillamail.net
+guerrillamail.org
+guerrillamailblock.com
+harakirimail.com
+incognitomail.org
+jetable.org
+mailcatch.com
+maildrop.cc
+mailinator.com
+mailinator.net
+mailnesia.com
+mintemail.com
+mohmal.com
+mytemp.email
+sharklasers.com
+spamgourmet.com
+temp-mail.org
+tempail.com
+tempmail.net
+tempmailo.com
+tempr.email
+throwawaymail.com
+trashmail.com
+trashmail.de
+yopmail.com
+yopmail.fr
+`))
+
+type (
+	emailDomainPolicyDependencies interface {
+		x.LoggingProvider
+	}
+	EmailDomainPolicyProvider interface {
+		RegistrationEmailDomainPolicy() *EmailDomainPolicy
+	}
+	// EmailDomainPolicy decides which email domains may be used to register, see
+	// configuration.EmailDomainsConfig.
+	EmailDomainPolicy struct {
+		d emailDomainPolicyDependencies
+		c configuration.Provider
+
+		mu         sync.Mutex
+		listURL    string
+		list       []byte
+		disposable map[string]bool
+	}
+)
+
+func NewEmailDomainPolicy(d emailDomainPolicyDependencies, c configuration.Provider) *EmailDomainPolicy {
+	return &EmailDomainPolicy{d: d, c: c}
+}
+
+// Check returns the reason why the email address may not be used to register, or nil if it may be used.
+func (p *EmailDomainPolicy) Check(ctx context.Context, address string) *schema.ValidationErrorContextEmailDomainNotAllowed {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return nil
+	}
+
+	domain := strings.TrimSuffix(strings.ToLower(address[at+1:]), ".")
+	conf := p.c.SelfServiceRegistrationEmailDomains()
+	if matchesDomain(domain, conf.Deny) {
+		return &schema.ValidationErrorContextEmailDomainNotAllowed{Domain: domain}
+	}
+
+	if len(conf.Allow) > 0 && !matchesDomain(domain, conf.Allow) {
+		return &schema.ValidationErrorContextEmailDomainNotAllowed{Domain: domain}
+	}
+
+	if conf.BlockDisposable {
+		disposable := p.disposableDomains(ctx, conf.DisposableListURL)
+		for d := domain; len(d) > 0; {
+			if disposable[d] {
+				return &schema.ValidationErrorContextEmailDomainNotAllowed{Domain: domain, Disposable: true}
+			}
+
+			dot := strings.Index(d, ".")
+			if dot < 0 {
+				break
+			}
+			d = d[dot+1:]
+		}
+	}
+
+	return nil
+}
+
+// SchemaExtension returns an extension for identity.Validator.Validate which rejects email addresses that may not be
+// used to register. Email addresses are the traits which are used for verification or as the password identifier.
+func (p *EmailDomainPolicy) SchemaExtension(ctx context.Context) schema.Extension {
+	return &emailDomainExtension{ctx: ctx, p: p}
+}
+
+// disposableDomains returns the disposable email domains. The list at listURL is fetched using the default fetcher,
+// which caches it, and is only parsed again if it changed. If it can not be fetched, the built-in list is used so that
+// an unreachable list does not prevent registration.
+func (p *EmailDomainPolicy) disposableDomains(ctx context.Context, listURL string) map[string]bool {
+	if len(listURL) == 0 {
+		return builtinDisposableDomains
+	}
+
+	raw, err := fetcher.Default.Fetch(ctx, listURL)
+	if err != nil {
+		x.ContextLogger(ctx, p.d.Logger()).WithError(err).WithField("url", listURL).Error("Unable to fetch the list of disposable email domains, using the built-in list instead.")
+		return builtinDisposableDomains
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listURL != listURL || !bytes.Equal(p.list, raw) {
+		p.listURL = listURL
+		p.list = raw
+		p.disposable = parseDomainList(raw)
+	}
+	return p.disposable
+}
+
+// parseDomainList parses a list of domains with one domain per line. Empty lines and lines starting with # are
+// ignored.
+func parseDomainList(raw []byte) map[string]bool {
+	domains := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = true
+	}
+	return domains
+}
+
+// matchesDomain returns true if domain is one of domains or a subdomain of one of them.
+func matchesDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+type emailDomainExtension struct {
+	ctx context.Context
+	p   *EmailDomainPolicy
+}
+
+func (e *emailDomainExtension) Run(ctx jsonschema.ValidationContext, s schema.ExtensionConfig, value interface{}) error {
+	if s.Verification.Via != "email" && !s.Credentials.Password.Identifier {
+		return nil
+	}
+
+	// Identifiers which are not email addresses, for example usernames, are not restricted.
+	address, ok := value.(string)
+	if !ok || !jsonschema.Formats["email"](address) {
+		return nil
+	}
+
+	if violation := e.p.Check(e.ctx, address); violation != nil {
+		err := ctx.Error("", "%s", violation.Message())
+		err.Context = violation
+		return err
+	}
+	return nil
+}
+
+func (e *emailDomainExtension) Finish() error {
+	return nil
+}
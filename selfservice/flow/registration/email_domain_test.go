@@ -0,0 +1,64 @@
+package registration_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+)
+
+func TestEmailDomainPolicy(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	p := reg.RegistrationEmailDomainPolicy()
+
+	t.Run("case=everything is allowed by default", func(t *testing.T) {
+		assert.Nil(t, p.Check(context.Background(), "foo@mailinator.com"))
+	})
+
+	t.Run("case=allow and deny lists", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceEmailDomainsAllow, []string{"example.org"})
+		viper.Set(configuration.ViperKeySelfServiceEmailDomainsDeny, []string{"legacy.example.org"})
+		defer viper.Set(configuration.ViperKeySelfServiceEmailDomainsAllow, nil)
+		defer viper.Set(configuration.ViperKeySelfServiceEmailDomainsDeny, nil)
+
+		assert.Nil(t, p.Check(context.Background(), "foo@example.org"))
+		assert.Nil(t, p.Check(context.Background(), "foo@Sales.Example.org"), "subdomains are allowed as well")
+
+		v := p.Check(context.Background(), "foo@legacy.example.org")
+		if assert.NotNil(t, v, "denied domains take precedence") {
+			assert.Equal(t, "legacy.example.org", v.Domain)
+			assert.False(t, v.Disposable)
+		}
+
+		assert.NotNil(t, p.Check(context.Background(), "foo@example.com"))
+		assert.NotNil(t, p.Check(context.Background(), "foo@notexample.org"))
+	})
+
+	t.Run("case=disposable addresses", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceEmailDomainsBlockDisposable, true)
+		defer viper.Set(configuration.ViperKeySelfServiceEmailDomainsBlockDisposable, false)
+
+		v := p.Check(context.Background(), "foo@mailinator.com")
+		if assert.NotNil(t, v, "the built-in list is used if no list URL is set") {
+			assert.True(t, v.Disposable)
+		}
+		assert.Nil(t, p.Check(context.Background(), "foo@example.org"))
+
+		list := "# disposable domains\n\nthrowaway.example.org\n"
+		viper.Set(configuration.ViperKeySelfServiceEmailDomainsDisposableListURL, "base64://"+base64.StdEncoding.EncodeToString([]byte(list)))
+		defer viper.Set(configuration.ViperKeySelfServiceEmailDomainsDisposableListURL, "")
+
+		assert.NotNil(t, p.Check(context.Background(), "foo@throwaway.example.org"))
+		assert.NotNil(t, p.Check(context.Background(), "foo@inbox.throwaway.example.org"))
+		assert.Nil(t, p.Check(context.Background(), "foo@mailinator.com"), "the configured list replaces the built-in list")
+
+		viper.Set(configuration.ViperKeySelfServiceEmailDomainsDisposableListURL, "file://./stub/does-not-exist.conf")
+		assert.NotNil(t, p.Check(context.Background(), "foo@mailinator.com"), "the built-in list is used if the list can not be loaded")
+	})
+}
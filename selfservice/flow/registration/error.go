@@ -1,7 +1,6 @@
 package registration
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -13,10 +12,12 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
 	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/schema"
 	"github.com/ory/kratos/selfservice/errorx"
 	"github.com/ory/kratos/x"
 )
@@ -52,7 +53,8 @@ func newRequestExpiredError(since time.Duration) requestExpiredError {
 		herodot.ErrBadRequest.
 			WithError("registration request expired").
 			WithReasonf(`The registration request has expired. Please restart the flow.`).
-			WithReasonf("The registration request expired %.2f minutes ago, please try again.", since.Minutes()),
+			WithReasonf("The registration request expired %.2f minutes ago, please try again.", since.Minutes()).
+			WithDetail(errorx.DetailErrorID, errorx.ErrorIDFlowExpired),
 	}
 }
 
@@ -63,6 +65,21 @@ func NewErrorHandler(d errorHandlerDependencies, c configuration.Provider) *Erro
 	}
 }
 
+// HandleCSRFFailure returns a handler for x.OriginCSRFHandler which shows errors of submissions that failed the
+// CSRF check in the registration request they belong to.
+func (s *ErrorHandler) HandleCSRFFailure(ct identity.CredentialsType) func(w http.ResponseWriter, r *http.Request, err error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		rr, gerr := s.d.RegistrationRequestPersister().GetRegistrationRequest(r.Context(), x.ParseUUID(r.URL.Query().Get("request")))
+		if gerr != nil {
+			rr = nil
+		} else if _, ok := rr.Methods[ct]; !ok {
+			rr = nil
+		}
+
+		s.HandleRegistrationError(w, r, ct, rr, err)
+	}
+}
+
 func (s *ErrorHandler) HandleRegistrationError(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -70,7 +87,7 @@ func (s *ErrorHandler) HandleRegistrationError(
 	rr *Request,
 	err error,
 ) {
-	s.d.Logger().WithError(err).
+	x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).
 		WithField("details", fmt.Sprintf("%+v", err)).
 		WithField("credentials_type", ct).
 		WithField("login_request", rr).
@@ -79,12 +96,12 @@ func (s *ErrorHandler) HandleRegistrationError(
 	if _, ok := errorsx.Cause(err).(requestExpiredError); ok {
 		// create new request because the old one is not valid
 		if err = s.d.RegistrationHandler().NewRegistrationRequest(w, r, func(a *Request) (string, error) {
-			for name, method := range a.Methods {
-				method.Config.AddError(&form.Error{Message: "Your session expired, please try again."})
-				if err := s.d.RegistrationRequestPersister().UpdateRegistrationRequest(context.TODO(), a.ID, name, method); err != nil {
-					return s.d.SelfServiceErrorManager().Create(r.Context(), w, r, err)
-				}
-				a.Methods[name] = method
+			for _, method := range a.Methods {
+				method.Config.AddError(&form.Error{ID: form.ErrorIDFlowExpired, Message: "Your session expired, please try again."})
+			}
+
+			if err := s.d.RegistrationRequestPersister().UpdateRegistrationRequestMethods(r.Context(), a.ID, a.Methods); err != nil {
+				return s.d.SelfServiceErrorManager().Create(r.Context(), w, r, err)
 			}
 
 			return urlx.CopyWithQuery(s.c.RegisterURL(), url.Values{"request": {a.ID.String()}}).String(), nil
@@ -95,6 +112,12 @@ func (s *ErrorHandler) HandleRegistrationError(
 		return
 	}
 
+	if s.c.SecurityAccountEnumerationMitigate() && IsDuplicateCredentialsError(err) {
+		err = errors.WithStack(herodot.ErrBadRequest.
+			WithReason("The registration could not be completed. Please check your input or sign in if you already have an account.").
+			WithDetail(errorx.DetailErrorID, form.ErrorIDRegistrationFailed))
+	}
+
 	if rr == nil {
 		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
@@ -124,3 +147,14 @@ func (s *ErrorHandler) HandleRegistrationError(
 		http.StatusFound,
 	)
 }
+
+// IsDuplicateCredentialsError returns true if the registration failed because an identity uses one of the
+// identifiers already.
+func IsDuplicateCredentialsError(err error) bool {
+	e, ok := errorsx.Cause(err).(*jsonschema.ValidationError)
+	if !ok {
+		return false
+	}
+	_, ok = e.Context.(*schema.ValidationErrorContextDuplicateCredentialsError)
+	return ok
+}
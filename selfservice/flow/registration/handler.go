@@ -12,7 +12,11 @@ import (
 	"github.com/ory/x/errorsx"
 	"github.com/ory/x/urlx"
 
+	"github.com/ory/kratos/admission"
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/maintenance"
 	"github.com/ory/kratos/selfservice/errorx"
 	"github.com/ory/kratos/session"
 	"github.com/ory/kratos/x"
@@ -29,9 +33,15 @@ type (
 		errorx.ManagementProvider
 		session.HandlerProvider
 		x.WriterProvider
+		x.LoggingProvider
 		x.CSRFTokenGeneratorProvider
+		x.FlowBinderProvider
 		HookExecutorProvider
 		RequestPersistenceProvider
+		i18n.CatalogProvider
+		identity.PrivilegedPoolProvider
+		admission.AdmitterProvider
+		maintenance.GuardProvider
 	}
 	HandlerProvider interface {
 		RegistrationHandler() *Handler
@@ -39,24 +49,46 @@ type (
 	Handler struct {
 		d handlerDependencies
 		c configuration.Provider
+
+		availabilityLimiter *x.RateLimiter
 	}
 )
 
 func NewHandler(d handlerDependencies, c configuration.Provider) *Handler {
-	return &Handler{d: d, c: c}
+	return &Handler{
+		d:                   d,
+		c:                   c,
+		availabilityLimiter: x.NewRateLimiter(c.SelfServiceRegistrationAvailability().RateLimit, time.Minute),
+	}
 }
 
 func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 	public.GET(BrowserRegistrationPath, h.d.SessionHandler().IsNotAuthenticated(h.initRegistrationRequest, session.RedirectOnAuthenticated(h.c)))
 	public.GET(BrowserRegistrationRequestsPath, h.publicFetchRegistrationRequest)
+	public.GET(AvailabilityPath, h.publicCheckAvailability)
 }
 
 func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 	admin.GET(BrowserRegistrationRequestsPath, h.adminFetchRegistrationRequest)
+	admin.GET(AvailabilityPath, h.adminCheckAvailability)
 }
 
 func (h *Handler) NewRegistrationRequest(w http.ResponseWriter, r *http.Request, redir func(*Request) (string, error)) error {
-	a := NewRequest(h.c.SelfServiceRegistrationRequestLifespan(), h.d.GenerateCSRFToken(r), r)
+	if err := h.d.MaintenanceGuard().CheckRegistration(r.Context()); err != nil {
+		return err
+	} else if err := h.d.RegistrationAdmitter().CheckRegistrationRequest(r.Context(), r); err != nil {
+		return err
+	}
+
+	a := NewRequest(h.c.SelfServiceRegistrationRequestMaxLifespan(), h.d.GenerateCSRFToken(r), r)
+	a.Locale = h.d.I18nCatalog().Negotiate(r)
+
+	binding, err := h.d.FlowBinder().Bind(w, r, a.ID)
+	if err != nil {
+		return err
+	}
+	a.Binding = binding
+
 	for _, s := range h.d.RegistrationStrategies() {
 		if err := s.PopulateRegistrationMethod(r, a); err != nil {
 			return err
@@ -137,6 +169,11 @@ type getSelfServiceBrowserRegistrationRequestParameters struct {
 // When accessing this endpoint through ORY Kratos' Public API, ensure that cookies are set as they are required for CSRF to work. To prevent
 // token scanning attacks, the public endpoint does not return 404 status codes to prevent scanning attacks.
 //
+// Single page apps served from a different subdomain obtain the CSRF token from the `csrf_token` field of the
+// request's form and must send this request with credentials (cookies) included. Set `security.csrf.cookie.domain`
+// to the shared parent domain for this to work. If the CSRF check fails, the error contains `csrf_token_invalid`
+// as `details.error_id`; initialize a new flow to obtain a fresh token.
+//
 // More information can be found at [ORY Kratos User Login and User Registration Documentation](https://www.ory.sh/docs/next/kratos/self-service/flows/user-login-user-registration).
 //
 //     Produces:
@@ -184,6 +221,7 @@ func (h *Handler) fetchRegistrationRequest(w http.ResponseWriter, r *http.Reques
 			WithDetail("redirect_to", urlx.AppendPaths(h.c.SelfPublicURL(), BrowserRegistrationPath).String()))
 	}
 
+	ar.Localize(h.d.I18nCatalog())
 	h.d.Writer().Write(w, r, ar)
 	return nil
 }
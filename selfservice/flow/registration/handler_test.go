@@ -150,6 +150,7 @@ func TestRegistrationHandler(t *testing.T) {
 
 			body := x.EasyGetBody(t, new(http.Client), public.URL+registration.BrowserRegistrationPath)
 			assert.Contains(t, gjson.GetBytes(body, "error").String(), "csrf_token", "%s", body)
+			assert.Equal(t, x.CSRFErrorID, gjson.GetBytes(body, "error.details.error_id").String(), "%s", body)
 		})
 
 		t.Run("case=expired", func(t *testing.T) {
@@ -1,15 +1,25 @@
 package registration
 
 import (
+	"context"
 	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/ory/x/errorsx"
 	"github.com/ory/x/sqlcon"
 
+	"github.com/ory/kratos/admission"
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/resilience"
 	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/notification"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/webhook"
 	"github.com/ory/kratos/x"
 )
 
@@ -20,6 +30,12 @@ type (
 	PostHookExecutor interface {
 		ExecuteRegistrationPostHook(w http.ResponseWriter, r *http.Request, a *Request, s *session.Session) error
 	}
+	// ConcealingPostHookExecutor is implemented by post hooks which respond to a registration without relying on
+	// the identity, for example by redirecting. When account enumeration mitigation is enabled they are executed
+	// for registrations of already existing accounts so that the response matches a successful registration.
+	ConcealingPostHookExecutor interface {
+		ConcealRegistration(w http.ResponseWriter, r *http.Request, a *Request) error
+	}
 	HooksProvider interface {
 		PreRegistrationHooks() []PreHookExecutor
 		PostRegistrationHooks(credentialsType identity.CredentialsType) []PostHookExecutor
@@ -30,12 +46,21 @@ type (
 	registrationExecutorDependencies interface {
 		identity.ManagementProvider
 		identity.ValidationProvider
+		identity.PrivilegedPoolProvider
+		admission.AdmitterProvider
+		maintenance.GuardProvider
+		notification.SenderProvider
+		EmailDomainPolicyProvider
 		HooksProvider
+		webhook.DispatcherProvider
 		x.LoggingProvider
 	}
 	HookExecutor struct {
 		d registrationExecutorDependencies
 		c configuration.Provider
+
+		// attempts limits how often the owner of an account is told about attempts to register it again.
+		attempts *x.RateLimiter
 	}
 	HookExecutorProvider interface {
 		RegistrationExecutor() *HookExecutor
@@ -47,31 +72,63 @@ func NewHookExecutor(
 	c configuration.Provider,
 ) *HookExecutor {
 	return &HookExecutor{
-		d: d,
-		c: c,
+		d:        d,
+		c:        c,
+		attempts: x.NewRateLimiter(1, time.Hour),
 	}
 }
 
 func (e *HookExecutor) PostRegistrationHook(w http.ResponseWriter, r *http.Request, hooks []PostHookExecutor, a *Request, i *identity.Identity) error {
+	if err := e.checkNetwork(r); err != nil {
+		return err
+	}
+
 	s := session.NewSession(i, r, e.c)
 
-	// We need to make sure that the identity has a valid schema before passing it down to the identity pool.
-	if err := e.d.IdentityValidator().Validate(s.Identity); err != nil {
+	var requestURL string
+	if a != nil {
+		requestURL = a.RequestURL
+	}
+
+	// We need to make sure that the identity has a valid schema before passing it down to the identity pool. Unlike
+	// identities created using the admin API, self-service registrations must also use an allowed email domain.
+	if err := e.d.IdentityValidator().Validate(s.Identity, e.d.RegistrationEmailDomainPolicy().SchemaExtension(r.Context())); err != nil {
+		return err
+	} else if err := e.d.MaintenanceGuard().CheckRegistration(r.Context()); err != nil {
+		return err
+	} else if err := e.d.RegistrationAdmitter().CheckRegistration(r.Context(), requestURL, s.Identity); err != nil {
 		return err
 		// We're now creating the identity because any of the hooks could trigger a "redirect" or a "session" which
-		// would imply that the identity has to exist already.
-	} else if err := e.d.IdentityManager().Create(r.Context(), s.Identity); err != nil {
+		// would imply that the identity has to exist already. The identity.created webhook event is emitted once the
+		// identity was admitted and the hooks completed.
+	} else if err := e.d.IdentityManager().Create(r.Context(), s.Identity, identity.ManagerSkipEvents); err != nil {
 		if errorsx.Cause(err) == sqlcon.ErrUniqueViolation {
+			if a != nil && e.c.SecurityAccountEnumerationMitigate() {
+				return e.ConcealDuplicate(w, r, hooks, a, identifiers(s.Identity))
+			}
 			return schema.NewDuplicateCredentialsError()
 		}
 		return err
 	}
 
-	e.d.Logger().
+	if pending, err := e.d.RegistrationAdmitter().Admit(r.Context(), requestURL, s.Identity); err != nil {
+		if derr := e.d.PrivilegedIdentityPool().DeleteIdentity(r.Context(), s.Identity.ID); derr != nil {
+			x.ContextLogger(r.Context(), e.d.Logger()).WithError(derr).WithField("identity_id", i.ID).Error("Unable to delete an identity which was not admitted.")
+		}
+		return err
+	} else if pending {
+		// The identity must not be signed in before it was approved, which is why no hooks are executed.
+		e.d.WebhookDispatcher().Emit(r.Context(), webhook.EventIdentityCreated, s.Identity)
+		return errors.WithStack(admission.ErrApprovalPending)
+	}
+
+	x.ContextLogger(r.Context(), e.d.Logger()).
 		WithField("identity_id", i.ID).
 		Debug("A new identity has registered using self-service registration. Running post execution hooks.")
 
-	// Now we execute the post-registration hooks!
+	// Now we execute the post-registration hooks! Async hooks only start once the registration completed, see
+	// resilience.RunDeferred.
+	r = r.WithContext(resilience.WithDeferred(r.Context()))
 	for _, executor := range hooks {
 		if err := executor.ExecuteRegistrationPostHook(w, r, a, s); err != nil {
 			// TODO https://github.com/ory/kratos/issues/51 #51
@@ -84,18 +141,25 @@ func (e *HookExecutor) PostRegistrationHook(w http.ResponseWriter, r *http.Reque
 		return err
 		// We're now creating the identity because any of the hooks could trigger a "redirect" or a "session" which
 		// would imply that the identity has to exist already.
-	} else if err := e.d.IdentityManager().Update(r.Context(), s.Identity); err != nil {
+	} else if err := e.d.IdentityManager().Update(r.Context(), s.Identity, identity.ManagerSkipEvents); err != nil {
 		return err
 	}
 
-	e.d.Logger().
+	e.d.WebhookDispatcher().Emit(r.Context(), webhook.EventIdentityCreated, s.Identity)
+
+	x.ContextLogger(r.Context(), e.d.Logger()).
 		WithField("identity_id", i.ID).
 		Debug("Post registration execution hooks completed successfully.")
 
+	resilience.RunDeferred(r.Context())
 	return nil
 }
 
 func (e *HookExecutor) PreRegistrationHook(w http.ResponseWriter, r *http.Request, a *Request) error {
+	if err := e.checkNetwork(r); err != nil {
+		return err
+	}
+
 	for _, executor := range e.d.PreRegistrationHooks() {
 		if err := executor.ExecuteRegistrationPreHook(w, r, a); err != nil {
 			return err
@@ -104,3 +168,70 @@ func (e *HookExecutor) PreRegistrationHook(w http.ResponseWriter, r *http.Reques
 
 	return nil
 }
+
+// checkNetwork enforces the registration network ACL. Every registration strategy starts and completes its
+// flow through the hook executor, including OIDC which shares its endpoints with the login flow, so the ACL
+// applies to the registration flow and not to individual paths.
+func (e *HookExecutor) checkNetwork(r *http.Request) error {
+	allow, deny := e.c.NetworkACL(configuration.NetworkACLGroupRegistration)
+	return (&x.NetworkACL{Allow: allow, Deny: deny}).Check(configuration.NetworkACLGroupRegistration, r, x.ContextLogger(r.Context(), e.d.Logger()))
+}
+
+// ConcealDuplicate responds to the registration of an already existing account as if the registration had
+// succeeded and notifies the owners of the accounts using one of the identifiers instead, so that the response
+// does not reveal whether an account exists.
+func (e *HookExecutor) ConcealDuplicate(w http.ResponseWriter, r *http.Request, hooks []PostHookExecutor, a *Request, identifiers []string) error {
+	ctx := r.Context()
+	l := x.ContextLogger(ctx, e.d.Logger())
+	l.Debug("A registration conflicts with an existing account, concealing the conflict.")
+
+	notified := map[uuid.UUID]bool{}
+	for _, identifier := range identifiers {
+		owner, err := e.findOwner(ctx, identifier)
+		if err != nil {
+			// The conflict was caused by another identifier.
+			continue
+		} else if notified[owner.ID] || !e.attempts.Allow(owner.ID.String()) {
+			continue
+		}
+		notified[owner.ID] = true
+
+		if err := e.d.NotificationSender().NotifyRegistrationAttempt(ctx, owner); err != nil {
+			l.WithError(err).WithField("identity_id", owner.ID).Warn("Unable to notify an identity about a registration attempt.")
+		}
+	}
+
+	for _, executor := range hooks {
+		if c, ok := executor.(ConcealingPostHookExecutor); ok {
+			if err := c.ConcealRegistration(w, r, a); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// findOwner returns the identity which uses the identifier as email address or password identifier.
+func (e *HookExecutor) findOwner(ctx context.Context, identifier string) (*identity.Identity, error) {
+	if address, err := e.d.PrivilegedIdentityPool().FindAddressByValue(ctx, identity.VerifiableAddressTypeEmail, identifier); err == nil {
+		return e.d.PrivilegedIdentityPool().GetIdentity(ctx, address.IdentityID)
+	}
+
+	i, _, err := e.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(ctx, identity.CredentialsTypePassword, identifier)
+	return i, err
+}
+
+// identifiers returns the email addresses and password identifiers of the identity.
+func identifiers(i *identity.Identity) []string {
+	var ids []string
+	for _, address := range i.Addresses {
+		if address.Via == identity.VerifiableAddressTypeEmail {
+			ids = append(ids, address.Value)
+		}
+	}
+	if c, ok := i.GetCredentials(identity.CredentialsTypePassword); ok {
+		ids = append(ids, c.Identifiers...)
+	}
+	return ids
+}
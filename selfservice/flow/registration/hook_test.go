@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/bxcodec/faker"
@@ -12,13 +13,21 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ory/herodot"
 	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
 
+	"github.com/ory/kratos/admission"
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/maintenance"
 	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/selfservice/strategy/oidc"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/webhook"
+	"github.com/ory/kratos/x"
 )
 
 type registrationPostHookMock struct {
@@ -35,6 +44,16 @@ func (m *registrationPostHookMock) ExecuteRegistrationPostHook(w http.ResponseWr
 	return m.err
 }
 
+type registrationConcealingHookMock struct {
+	registrationPostHookMock
+	concealed int
+}
+
+func (m *registrationConcealingHookMock) ConcealRegistration(w http.ResponseWriter, r *http.Request, a *registration.Request) error {
+	m.concealed++
+	return nil
+}
+
 type registrationPreHookMock struct {
 	err error
 }
@@ -63,6 +82,26 @@ func (m *registrationExecutorDependenciesMock) IdentityValidator() *identity.Val
 	return nil
 }
 
+func (m *registrationExecutorDependenciesMock) RegistrationAdmitter() *admission.Admitter {
+	return nil
+}
+
+func (m *registrationExecutorDependenciesMock) MaintenanceGuard() *maintenance.Guard {
+	return nil
+}
+
+func (m *registrationExecutorDependenciesMock) RegistrationEmailDomainPolicy() *registration.EmailDomainPolicy {
+	return nil
+}
+
+func (m *registrationExecutorDependenciesMock) NotificationSender() *notification.Sender {
+	return nil
+}
+
+func (m *registrationExecutorDependenciesMock) WebhookDispatcher() *webhook.Dispatcher {
+	return nil
+}
+
 func (m *registrationExecutorDependenciesMock) Logger() logrus.FieldLogger {
 	return logrus.New()
 }
@@ -141,11 +180,84 @@ func TestRegistrationExecutor(t *testing.T) {
 				conf, _ := internal.NewRegistryDefault(t)
 				e := registration.NewHookExecutor(tc.reg, conf)
 				if tc.expectErr == nil {
-					require.NoError(t, e.PreRegistrationHook(nil, nil, nil))
+					require.NoError(t, e.PreRegistrationHook(nil, &http.Request{}, nil))
 				} else {
-					require.EqualError(t, e.PreRegistrationHook(nil, nil, nil), tc.expectErr.Error())
+					require.EqualError(t, e.PreRegistrationHook(nil, &http.Request{}, nil), tc.expectErr.Error())
 				}
 			})
 		}
 	})
+
+	t.Run("case=enforces the registration network acl", func(t *testing.T) {
+		conf, reg := internal.NewRegistryDefault(t)
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://stub/registration.schema.json")
+		viper.Set(configuration.ViperKeyURLsSelfPublic, "http://example.com")
+		viper.Set("security.network.registration.deny", []string{"10.0.0.0/8"})
+		t.Cleanup(func() {
+			viper.Set("security.network.registration.deny", []string{})
+		})
+
+		// The OIDC strategy serves login and registration on the same paths, so the flow and not the path
+		// decides whether the ACL applies.
+		r := httptest.NewRequest("POST", "http://example.com"+oidc.BasePath+"/auth/github", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+
+		e := registration.NewHookExecutor(reg, conf)
+		err := e.PreRegistrationHook(nil, r, nil)
+		require.Error(t, err)
+		assert.Equal(t, x.NetworkACLErrorID, errorsx.Cause(err).(*herodot.DefaultError).Details()["error_id"])
+
+		i := identity.NewIdentity("")
+		err = e.PostRegistrationHook(nil, r, nil, nil, i)
+		require.Error(t, err)
+		assert.Equal(t, x.NetworkACLErrorID, errorsx.Cause(err).(*herodot.DefaultError).Details()["error_id"])
+		_, err = reg.IdentityPool().GetIdentity(context.Background(), i.ID)
+		require.Error(t, err, "the identity must not be created")
+
+		r.RemoteAddr = "1.2.3.4:1234"
+		require.NoError(t, e.PreRegistrationHook(nil, r, nil))
+	})
+
+	t.Run("case=conceals duplicate registrations when mitigating account enumeration", func(t *testing.T) {
+		conf, reg := internal.NewRegistryDefault(t)
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://../../../identity/stub/manager.schema.json")
+		viper.Set(configuration.ViperKeyURLsSelfPublic, "http://example.com")
+		viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, true)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, false)
+		})
+
+		existing := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		existing.Traits = identity.Traits(`{"email":"conceal@ory.sh"}`)
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), existing))
+		address := existing.Addresses[0]
+		address.Verified = true
+		require.NoError(t, reg.PrivilegedIdentityPool().UpdateVerifiableAddress(context.Background(), &address))
+
+		e := registration.NewHookExecutor(reg, conf)
+		a := &registration.Request{ID: x.NewUUID(), RequestURL: "http://example.com/registration"}
+		register := func() *registrationConcealingHookMock {
+			hook := new(registrationConcealingHookMock)
+			i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			i.Traits = identity.Traits(`{"email":"conceal@ory.sh"}`)
+			require.NoError(t, e.PostRegistrationHook(nil, &http.Request{}, []registration.PostHookExecutor{hook}, a, i))
+			_, err := reg.IdentityPool().GetIdentity(context.Background(), i.ID)
+			require.Error(t, err, "the identity must not be created")
+			return hook
+		}
+
+		hook := register()
+		assert.Equal(t, 1, hook.concealed)
+		m, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "conceal@ory.sh", m.Recipient)
+		assert.Equal(t, "Someone tried to sign up with your email address", m.Subject)
+
+		// The owner is told about repeated attempts at most once per hour.
+		hook = register()
+		assert.Equal(t, 1, hook.concealed)
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 10)
+		require.NoError(t, err)
+		assert.Len(t, messages, 1)
+	})
 }
@@ -19,6 +19,7 @@ type RequestPersister interface {
 	CreateRegistrationRequest(context.Context, *Request) error
 	GetRegistrationRequest(context.Context, uuid.UUID) (*Request, error)
 	UpdateRegistrationRequest(context.Context, uuid.UUID, identity.CredentialsType, *RequestMethod) error
+	UpdateRegistrationRequestMethods(context.Context, uuid.UUID, RequestMethods) error
 }
 
 type RequestPersistenceProvider interface {
@@ -115,5 +116,32 @@ func TestRequestPersister(p RequestPersister) func(t *testing.T) {
 			assert.Equal(t, string(identity.CredentialsTypePassword), actual.Methods[identity.CredentialsTypePassword].Config.RequestMethodConfigurator.(*form.HTMLForm).Action, "%s", js)
 			assert.Equal(t, string(identity.CredentialsTypeOIDC), actual.Methods[identity.CredentialsTypeOIDC].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
 		})
+
+		t.Run("case=should update all methods of a registration request at once", func(t *testing.T) {
+			expected := newRequest(t)
+			delete(expected.Methods, identity.CredentialsTypeOIDC)
+			require.NoError(t, p.CreateRegistrationRequest(context.Background(), expected))
+
+			require.NoError(t, p.UpdateRegistrationRequestMethods(context.Background(), expected.ID, RequestMethods{
+				identity.CredentialsTypePassword: {
+					Config: &RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("batch-password")},
+				},
+				identity.CredentialsTypeOIDC: {
+					Config: &RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("batch-oidc")},
+				},
+			}))
+
+			actual, err := p.GetRegistrationRequest(context.Background(), expected.ID)
+			require.NoError(t, err)
+			require.Len(t, actual.Methods, 2)
+			assert.Equal(t, "batch-password", actual.Methods[identity.CredentialsTypePassword].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
+			assert.Equal(t, "batch-oidc", actual.Methods[identity.CredentialsTypeOIDC].Config.RequestMethodConfigurator.(*form.HTMLForm).Action)
+
+			require.Error(t, p.UpdateRegistrationRequestMethods(context.Background(), x.NewUUID(), RequestMethods{
+				identity.CredentialsTypePassword: {
+					Config: &RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("batch-password")},
+				},
+			}))
+		})
 	}
 }
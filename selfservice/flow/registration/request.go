@@ -2,6 +2,7 @@ package registration
 
 import (
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/gobuffalo/pop/v5"
@@ -9,9 +10,9 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ory/herodot"
-	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/form"
 	"github.com/ory/kratos/x"
 )
 
@@ -63,18 +64,17 @@ type Request struct {
 
 	// CSRFToken contains the anti-csrf token associated with this request.
 	CSRFToken string `json:"-" db:"csrf_token"`
+
+	// Locale is the language of the request's messages. It is negotiated from the `locale` query parameter or the
+	// Accept-Language header when the request is initialized.
+	Locale string `json:"locale" faker:"-" db:"locale"`
+
+	// Binding binds the request to the browser which initiated it, see x.FlowBinder.
+	Binding string `json:"-" faker:"-" db:"browser_binding"`
 }
 
 func NewRequest(exp time.Duration, csrf string, r *http.Request) *Request {
-	source := urlx.Copy(r.URL)
-	source.Host = r.Host
-
-	if len(source.Scheme) == 0 {
-		source.Scheme = "http"
-		if r.TLS != nil {
-			source.Scheme = "https"
-		}
-	}
+	source := x.RequestURL(r)
 
 	return &Request{
 		ID:         x.NewUUID(),
@@ -113,6 +113,27 @@ func (r *Request) AfterFind(_ *pop.Connection) error {
 	return nil
 }
 
+// ForAPIVersion implements x.VersionedResponse. Starting with x.APIVersion2, the methods are an array ordered
+// by method.
+func (r *Request) ForAPIVersion(v x.APIVersion) interface{} {
+	if v < x.APIVersion2 {
+		return r
+	}
+
+	methods := make([]*RequestMethod, 0, len(r.Methods))
+	for _, m := range r.Methods {
+		methods = append(methods, m)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+	return &requestV2{Request: r, Methods: methods}
+}
+
+// requestV2 is the shape of the request in x.APIVersion2.
+type requestV2 struct {
+	*Request
+	Methods []*RequestMethod `json:"methods"`
+}
+
 func (r Request) TableName() string {
 	// This must be stay a value receiver, using a pointer receiver will cause issues with pop.
 	return "selfservice_registration_requests"
@@ -135,3 +156,27 @@ func (r *Request) Valid() error {
 	}
 	return nil
 }
+
+// ValidFor is like Valid but additionally expires the request once lifespan has passed since it was issued. It
+// is used to enforce the lifespan of the registration method which completes the request.
+func (r *Request) ValidFor(lifespan time.Duration) error {
+	if err := r.Valid(); err != nil {
+		return err
+	}
+	if expiresAt := r.IssuedAt.Add(lifespan); expiresAt.Before(time.Now()) {
+		return errors.WithStack(newRequestExpiredError(time.Since(expiresAt)))
+	}
+	return nil
+}
+
+// Localize translates the messages of all methods to the request's locale.
+func (r *Request) Localize(t form.Translator) {
+	for _, m := range r.Methods {
+		if m.Config == nil {
+			continue
+		}
+		if l, ok := m.Config.RequestMethodConfigurator.(form.Localizer); ok {
+			l.Localize(t, r.Locale)
+		}
+	}
+}
@@ -41,7 +41,8 @@ type (
 func newErrRequestRequired(when float64) error {
 	return errors.WithStack(&errRequestExpired{herodot.ErrBadRequest.
 		WithError("verify request expired").
-		WithReasonf("The verification request expired %.2f minutes ago, please try again.", when)})
+		WithReasonf("The verification request expired %.2f minutes ago, please try again.", when).
+		WithDetail(errorx.DetailErrorID, errorx.ErrorIDFlowExpired)})
 }
 
 func NewErrorHandler(d errorHandlerDependencies, c configuration.Provider) *ErrorHandler {
@@ -51,13 +52,24 @@ func NewErrorHandler(d errorHandlerDependencies, c configuration.Provider) *Erro
 	}
 }
 
+// HandleCSRFFailure is a handler for x.OriginCSRFHandler which shows errors of submissions that failed the CSRF
+// check in the verification request they belong to.
+func (s *ErrorHandler) HandleCSRFFailure(w http.ResponseWriter, r *http.Request, err error) {
+	rr, gerr := s.d.VerificationPersister().GetVerifyRequest(r.Context(), x.ParseUUID(r.URL.Query().Get("request")))
+	if gerr != nil {
+		rr = nil
+	}
+
+	s.HandleVerificationError(w, r, rr, err)
+}
+
 func (s *ErrorHandler) HandleVerificationError(
 	w http.ResponseWriter,
 	r *http.Request,
 	rr *Request,
 	err error,
 ) {
-	s.d.Logger().WithError(err).
+	x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).
 		WithField("details", fmt.Sprintf("%+v", err)).
 		WithField("verify_request", rr).
 		Warn("Encountered self-service verification error.")
@@ -72,10 +84,11 @@ func (s *ErrorHandler) HandleVerificationError(
 
 	if e, ok := errorsx.Cause(err).(*errRequestExpired); ok {
 		a := NewRequest(
-			s.c.SelfServiceProfileRequestLifespan(), r, rr.Via,
+			s.c.SelfServiceVerificationRequestLifespan(), r, rr.Via,
 			urlx.AppendPaths(s.c.SelfPublicURL(), PublicVerificationRequestPath), s.d.GenerateCSRFToken,
 		)
-		a.Form.AddError(&form.Error{Message: e.ReasonField})
+		a.Locale = rr.Locale
+		a.Form.AddError(&form.Error{ID: form.ErrorIDFlowExpired, Message: e.ReasonField})
 
 		if err := s.d.VerificationPersister().CreateVerifyRequest(r.Context(), a); err != nil {
 			s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
@@ -14,13 +14,18 @@ import (
 
 	"github.com/ory/herodot"
 	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/jsonx"
 	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/schema"
 	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/token"
 	"github.com/ory/kratos/x"
 )
 
@@ -29,6 +34,7 @@ const (
 	PublicVerificationCompletePath = "/self-service/browser/flows/verification/:via/complete"
 	PublicVerificationRequestPath  = "/self-service/browser/flows/requests/verification"
 	PublicVerificationConfirmPath  = "/self-service/browser/flows/verification/:via/confirm/:code"
+	PublicVerificationRedeemPath   = "/self-service/verification/redeem"
 )
 
 type (
@@ -39,9 +45,14 @@ type (
 		errorx.ManagementProvider
 		identity.ManagementProvider
 		identity.PrivilegedPoolProvider
+		notification.SenderProvider
+		login.SecondFactorProvider
+		token.ManagerProvider
 		SenderProvider
 		x.CSRFTokenGeneratorProvider
+		x.LoggingProvider
 		x.WriterProvider
+		i18n.CatalogProvider
 
 		PersistenceProvider
 		ErrorHandlerProvider
@@ -61,6 +72,7 @@ func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 	public.GET(PublicVerificationRequestPath, h.publicFetch)
 	public.POST(PublicVerificationCompletePath, h.complete)
 	public.GET(PublicVerificationConfirmPath, h.verify)
+	public.POST(PublicVerificationRedeemPath, h.redeem)
 }
 
 func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
@@ -72,7 +84,7 @@ func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 type initializeSelfServiceVerificationFlowParameters struct {
 	// What to verify
 	//
-	// Currently only "email" is supported.
+	// Either "email" or "sms".
 	//
 	// required: true
 	// in: path
@@ -105,9 +117,10 @@ func (h *Handler) init(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	}
 
 	a := NewRequest(
-		h.c.SelfServiceProfileRequestLifespan(), r, via,
+		h.c.SelfServiceVerificationRequestLifespan(), r, via,
 		urlx.AppendPaths(h.c.SelfPublicURL(), strings.ReplaceAll(PublicVerificationCompletePath, ":via", string(via))), h.d.GenerateCSRFToken,
 	)
+	a.Locale = h.d.I18nCatalog().Negotiate(r)
 
 	if err := h.d.VerificationPersister().CreateVerifyRequest(r.Context(), a); err != nil {
 		h.handleError(w, r, nil, err)
@@ -178,6 +191,7 @@ func (h *Handler) fetch(w http.ResponseWriter, r *http.Request, mustVerify bool)
 		return errors.WithStack(x.ErrInvalidCSRFToken.WithDebugf("Expected %s but got %s", h.d.GenerateCSRFToken(r), ar.CSRFToken))
 	}
 
+	ar.Localize(h.d.I18nCatalog())
 	h.d.Writer().Write(w, r, ar)
 	return nil
 }
@@ -196,7 +210,7 @@ type completeSelfServiceBrowserVerificationFlowParameters struct {
 
 	// What to verify
 	//
-	// Currently only "email" is supported.
+	// Either "email" or "sms".
 	//
 	// required: true
 	// in: path
@@ -260,23 +274,24 @@ func (h *Handler) complete(w http.ResponseWriter, r *http.Request, ps httprouter
 		return
 	}
 
+	to := r.PostForm.Get("to_verify")
 	switch vr.Via {
 	case identity.VerifiableAddressTypeEmail:
-		h.completeViaEmail(w, r, vr)
-		return
-	}
-
-	h.handleError(w, r, vr, errors.WithStack(herodot.ErrInternalServerError.WithDebugf("Ended up with an invalid VerifyRequest.VerifiableAddressType: %s", vr.Via)))
-}
-
-func (h *Handler) completeViaEmail(w http.ResponseWriter, r *http.Request, vr *Request) {
-	to := r.PostForm.Get("to_verify")
-	if !jsonschema.Formats["email"](to) {
-		h.handleError(w, r, vr, errors.WithStack(schema.NewInvalidFormatError("#/to_verify", "email", to)))
+		if !jsonschema.Formats["email"](to) {
+			h.handleError(w, r, vr, errors.WithStack(schema.NewInvalidFormatError("#/to_verify", "email", to)))
+			return
+		}
+	case identity.VerifiableAddressTypeSMS:
+		if !identity.IsPhoneNumber(to) {
+			h.handleError(w, r, vr, errors.WithStack(schema.NewInvalidFormatError("#/to_verify", "tel", to)))
+			return
+		}
+	default:
+		h.handleError(w, r, vr, errors.WithStack(herodot.ErrInternalServerError.WithDebugf("Ended up with an invalid VerifyRequest.VerifiableAddressType: %s", vr.Via)))
 		return
 	}
 
-	if _, err := h.d.VerificationSender().SendCode(r.Context(), identity.VerifiableAddressTypeEmail, to); err != nil {
+	if _, err := h.d.VerificationSender().SendCode(i18n.WithLocale(r.Context(), vr.Locale), vr.Via, to); err != nil {
 		if errorsx.Cause(err) != ErrUnknownAddress {
 			h.handleError(w, r, vr, err)
 			return
@@ -302,7 +317,7 @@ type selfServiceBrowserVerifyParameters struct {
 
 	// What to verify
 	//
-	// Currently only "email" is supported.
+	// Either "email" or "sms".
 	//
 	// required: true
 	// in: path
@@ -335,13 +350,19 @@ func (h *Handler) verify(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
-	if err := h.d.PrivilegedIdentityPool().VerifyAddress(r.Context(), ps.ByName("code")); err != nil {
-		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+	code := ps.ByName("code")
+	if err := h.verifyAddress(r, code); err != nil {
+		if cause := errorsx.Cause(err); cause == sqlcon.ErrNoRows || cause == &identity.ErrAlreadyRedeemed {
 			a := NewRequest(
-				h.c.SelfServiceProfileRequestLifespan(), r, via,
+				h.c.SelfServiceVerificationRequestLifespan(), r, via,
 				urlx.AppendPaths(h.c.SelfPublicURL(), strings.ReplaceAll(PublicVerificationCompletePath, ":via", string(via))), h.d.GenerateCSRFToken,
 			)
-			a.Form.AddError(&form.Error{Message: "The verification code has expired or was otherwise invalid. Please request another code."})
+			a.Locale = h.d.I18nCatalog().Negotiate(r)
+			if cause == sqlcon.ErrNoRows {
+				a.Form.AddError(&form.Error{ID: form.ErrorIDVerificationCodeInvalid, Message: "The verification code has expired or was otherwise invalid. Please request another code."})
+			} else {
+				a.Form.AddError(&form.Error{ID: identity.AlreadyRedeemedErrorID, Message: "This verification link was already used. Please request another code."})
+			}
 
 			if err := h.d.VerificationPersister().CreateVerifyRequest(r.Context(), a); err != nil {
 				h.handleError(w, r, nil, err)
@@ -352,6 +373,7 @@ func (h *Handler) verify(w http.ResponseWriter, r *http.Request, ps httprouter.P
 				urlx.CopyWithQuery(h.c.VerificationURL(), url.Values{"request": {a.ID.String()}}).String(),
 				http.StatusFound,
 			)
+			return
 		}
 
 		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
@@ -361,6 +383,140 @@ func (h *Handler) verify(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	http.Redirect(w, r, h.c.SelfServiceVerificationReturnTo().String(), http.StatusFound)
 }
 
+// RedeemPayload is the code of a verification link.
+//
+// swagger:model redeemVerificationCodePayload
+type RedeemPayload struct {
+	// Code is the `code` parameter of the verification link.
+	//
+	// required: true
+	Code string `json:"code"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters redeemVerificationCode
+type redeemVerificationCodeParameters struct {
+	// in: body
+	// required: true
+	Body RedeemPayload
+}
+
+// swagger:route POST /self-service/verification/redeem public redeemVerificationCode
+//
+// Redeem the code of a verification link
+//
+// If `selfservice.verify.link_url` is set, verification links point to the operator's UI or to a mobile app
+// instead of ORY Kratos. The page or app calls this endpoint with the code of the link to verify the address. The
+// code is the proof, which is why this endpoint does not need a CSRF token.
+//
+// Redeeming a code again fails with the error ID `code_already_redeemed`. Unless the same client redeemed it before,
+// the identity is notified, as the code might have leaked.
+//
+// More information can be found at [ORY Kratos Email and Phone Verification Documentation](https://www.ory.sh/docs/kratos/selfservice/flows/verify-email-account-activation).
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       400: genericError
+//       500: genericError
+func (h *Handler) redeem(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var p RedeemPayload
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&p); err != nil {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	if len(p.Code) == 0 {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The code must be set.")))
+		return
+	}
+
+	if err := h.verifyAddress(r, p.Code); err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+				WithReason("The verification code has expired or was otherwise invalid. Please request another code.")))
+			return
+		}
+
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyAddress verifies the address of the code. A verified address can set up a second factor, for example email
+// codes, which is why the identity is notified about the second factors it enrolled in by verifying the address.
+//
+// Verification links carry a token, which is redeemed first. The address refers to the token of its latest link,
+// see Sender.SendCode. Links sent before verification used tokens carry the code of the address instead.
+func (h *Handler) verifyAddress(r *http.Request, code string) error {
+	ctx := r.Context()
+	pool := h.d.PrivilegedIdentityPool()
+
+	if token.IsSigned(code) {
+		t, err := h.d.TokenManager().Redeem(r, code, token.PurposeVerification)
+		if err != nil {
+			return err
+		}
+		code = tokenCode(t.ID)
+	} else if isTokenCode(code) {
+		// The code of a token must not be used to skip redeeming the token.
+		return errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	var before *identity.Identity
+	if address, err := pool.FindAddressByCode(ctx, code); err == nil {
+		if before, err = pool.GetIdentityConfidential(ctx, address.IdentityID); err != nil {
+			return err
+		}
+	}
+
+	if err := pool.VerifyAddress(ctx, code, identity.NewRedeemer(r)); err != nil {
+		if errorsx.Cause(err) == &identity.ErrAlreadyRedeemed {
+			h.reportReplay(r, code)
+		}
+		return err
+	} else if before == nil {
+		return nil
+	}
+
+	after, err := pool.GetIdentityConfidential(ctx, before.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx = i18n.WithLocale(ctx, h.d.I18nCatalog().Negotiate(r))
+	for _, f := range h.d.LoginSecondFactors() {
+		if f.IsEnrolled(before) || !f.IsEnrolled(after) {
+			continue
+		}
+
+		if err := h.d.NotificationSender().NotifySecondFactorChanged(ctx, after, f.SecondFactorID(), "", true); err != nil {
+			x.ContextLogger(ctx, h.d.Logger()).WithError(err).WithField("identity_id", after.ID).Warn("Unable to send the notification about the added second factor.")
+		}
+	}
+	return nil
+}
+
+// reportReplay logs that a verification code was redeemed again and notifies the identity, as the code might have
+// leaked.
+func (h *Handler) reportReplay(r *http.Request, code string) {
+	x.ContextLogger(r.Context(), h.d.Logger()).
+		WithField("client_ip", x.ClientIP(r).String()).
+		Warn("A verification code which was already redeemed was redeemed again.")
+	if err := h.d.NotificationSender().NotifyCodeReplayed(r, identity.RedemptionKindVerification, code); err != nil {
+		x.ContextLogger(r.Context(), h.d.Logger()).WithError(err).Warn("Unable to send the notification about the replayed verification code.")
+	}
+}
+
 // handleError is a convenience function for handling all types of errors that may occur (e.g. validation error).
 func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, rr *Request, err error) {
 	if rr != nil {
@@ -373,9 +529,9 @@ func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, rr *Reques
 
 func (h *Handler) toVia(ps httprouter.Params) (identity.VerifiableAddressType, error) {
 	v := ps.ByName("via")
-	switch identity.VerifiableAddressType(v) {
-	case identity.VerifiableAddressTypeEmail:
-		return identity.VerifiableAddressTypeEmail, nil
+	switch via := identity.VerifiableAddressType(v); via {
+	case identity.VerifiableAddressTypeEmail, identity.VerifiableAddressTypeSMS:
+		return via, nil
 	}
-	return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf("Verification only works for email but got: %s", v))
+	return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf("Verification only works for email and sms but got: %s", v))
 }
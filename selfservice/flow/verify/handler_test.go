@@ -43,7 +43,9 @@ func TestHandler(t *testing.T) {
 		admin := x.NewRouterAdmin()
 		reg.VerificationHandler().RegisterPublicRoutes(public)
 		reg.VerificationHandler().RegisterAdminRoutes(admin)
-		return httptest.NewServer(x.NewTestCSRFHandler(public, reg)), httptest.NewServer(admin)
+		csrf := x.NewTestCSRFHandler(public, reg)
+		csrf.ExemptPath(verify.PublicVerificationRedeemPath)
+		return httptest.NewServer(csrf), httptest.NewServer(admin)
 	}()
 	defer publicTS.Close()
 	defer adminTS.Close()
@@ -200,15 +202,86 @@ func TestHandler(t *testing.T) {
 		require.NoError(t, err)
 		m, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
 		require.NoError(t, err)
+		body, err := m.PlaintextBody(reg.Cipher())
+		require.NoError(t, err)
 
-		match := regexp.MustCompile(`<a href="([^"]+)">`).FindStringSubmatch(m.Body)
+		match := regexp.MustCompile(`<a href="([^"]+)">`).FindStringSubmatch(body)
 		require.Len(t, match, 2)
 
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeEmailCode)+".enabled", true)
+		defer viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeEmailCode)+".enabled", false)
+
 		res, err := hc.Get(match[1])
 		require.NoError(t, err)
 
 		assert.Equal(t, redirTS.URL, res.Request.URL.String())
 		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		latest, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "exists@ory.sh", latest.Recipient)
+		assert.Equal(t, "A second factor was added to your account", latest.Subject,
+			"verifying the first email address sets up email codes as a second factor")
+	})
+
+	t.Run("case=redeem code of custom link", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceVerifyLinkURL, "myapp://verify?token={code}")
+		defer viper.Set(configuration.ViperKeySelfServiceVerifyLinkURL, nil)
+
+		hc := &http.Client{Jar: x.EasyCookieJar(t, nil)}
+		svr, err := publicClient.Common.GetSelfServiceVerificationRequest(common.
+			NewGetSelfServiceVerificationRequestParams().WithHTTPClient(hc).
+			WithRequest(string(x.EasyGetBody(t, hc, initURL))))
+		require.NoError(t, err)
+
+		_, err = hc.PostForm(genForm(t, svr, "exists@ory.sh"))
+		require.NoError(t, err)
+		m, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		body, err := m.PlaintextBody(reg.Cipher())
+		require.NoError(t, err)
+
+		match := regexp.MustCompile(`<a href="myapp://verify\?token=([^"]+)">`).FindStringSubmatch(body)
+		require.Len(t, match, 2, "%s", body)
+
+		redeem := func(code, userAgent string) (int, string) {
+			req, err := http.NewRequest("POST", publicTS.URL+verify.PublicVerificationRedeemPath,
+				strings.NewReader(fmt.Sprintf(`{"code":%q}`, code)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", userAgent)
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			return res.StatusCode, gjson.GetBytes(x.MustReadAll(res.Body), "error.details.error_id").String()
+		}
+
+		status, _ := redeem(strings.ReplaceAll(strings.Split(match[1], ".")[0], "-", ""), "verify-test-agent")
+		assert.Equal(t, http.StatusBadRequest, status, "the code of the address can not be used instead of the token")
+
+		status, _ = redeem(match[1], "verify-test-agent")
+		assert.Equal(t, http.StatusNoContent, status)
+
+		status, errorID := redeem(match[1], "verify-test-agent")
+		assert.Equal(t, http.StatusBadRequest, status, "codes can only be redeemed once")
+		assert.Equal(t, identity.AlreadyRedeemedErrorID, errorID)
+		latest, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, m.ID, latest.ID, "replays of the same client are not reported")
+
+		status, errorID = redeem(match[1], "another-agent")
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, identity.AlreadyRedeemedErrorID, errorID)
+		latest, err = reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "exists@ory.sh", latest.Recipient)
+		body, err = latest.PlaintextBody(reg.Cipher())
+		require.NoError(t, err)
+		assert.Contains(t, body, "another-agent", "replays of other clients are reported")
+
+		status, _ = redeem("", "verify-test-agent")
+		assert.Equal(t, http.StatusBadRequest, status)
 	})
 
 	t.Run("case=verify unknown code", func(t *testing.T) {
@@ -52,6 +52,10 @@ type Request struct {
 	// Success, if true, implies that the request was completed successfully.
 	Success bool `json:"success" db:"success"`
 
+	// Locale is the language of the request's messages. It is negotiated from the `locale` query parameter or the
+	// Accept-Language header when the request is initialized.
+	Locale string `json:"locale" faker:"-" db:"locale"`
+
 	// CreatedAt is a helper struct field for gobuffalo.pop.
 	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
 	// UpdatedAt is a helper struct field for gobuffalo.pop.
@@ -64,15 +68,7 @@ func (r Request) TableName() string {
 
 func NewRequest(
 	exp time.Duration, r *http.Request, via identity.VerifiableAddressType, action *url.URL, generator form.CSRFGenerator) *Request {
-	source := urlx.Copy(r.URL)
-	source.Host = r.Host
-
-	if len(source.Scheme) == 0 {
-		source.Scheme = "http"
-		if r.TLS != nil {
-			source.Scheme = "https"
-		}
-	}
+	source := x.RequestURL(r)
 
 	id := x.NewUUID()
 	csrf := generator(r)
@@ -96,6 +92,13 @@ func NewRequest(
 	}
 }
 
+// Localize translates the messages of the form to the request's locale.
+func (r *Request) Localize(t form.Translator) {
+	if r.Form != nil {
+		r.Form.Localize(t, r.Locale)
+	}
+}
+
 func (r *Request) Valid() error {
 	if r.ExpiresAt.Before(time.Now()) {
 		return newErrRequestRequired(time.Since(r.ExpiresAt).Minutes())
@@ -2,18 +2,24 @@ package verify
 
 import (
 	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
 	"strings"
 
+	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
 
-	"github.com/ory/go-convenience/urlx"
 	"github.com/ory/x/errorsx"
 	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
 
 	"github.com/ory/kratos/courier"
 	templates "github.com/ory/kratos/courier/template"
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/token"
 	"github.com/ory/kratos/x"
 )
 
@@ -24,6 +30,7 @@ type (
 		courier.Provider
 		identity.PoolProvider
 		identity.ManagementProvider
+		token.ManagerProvider
 		x.LoggingProvider
 	}
 	SenderProvider interface {
@@ -41,14 +48,14 @@ func NewSender(r senderDependencies, c configuration.Provider) *Sender {
 
 // SendCode sends a code to the specified address. If the address does not exist in the store, an email is
 // still being sent to prevent account enumeration attacks. In that case, this function returns the ErrUnknownAddress
-// error.
+// error. Unknown phone numbers are not sent a text message, as text messages cost money.
 func (m *Sender) SendCode(ctx context.Context, via identity.VerifiableAddressType, value string) (*identity.VerifiableAddress, error) {
-	m.r.Logger().WithField("via", via).Debug("Sending out verification code.")
+	x.ContextLogger(ctx, m.r.Logger()).WithField("via", via).Debug("Sending out verification code.")
 
 	address, err := m.r.IdentityPool().FindAddressByValue(ctx, via, value)
 	if err != nil {
 		if errorsx.Cause(err) == sqlcon.ErrNoRows {
-			if err := m.sendToUnknownAddress(ctx, identity.VerifiableAddressTypeEmail, value); err != nil {
+			if err := m.sendToUnknownAddress(ctx, via, value); err != nil {
 				return nil, err
 			}
 			return nil, errors.Cause(ErrUnknownAddress)
@@ -56,47 +63,110 @@ func (m *Sender) SendCode(ctx context.Context, via identity.VerifiableAddressTyp
 		return nil, err
 	}
 
-	if err := m.r.IdentityManager().RefreshVerifyAddress(ctx, address); err != nil {
+	t, value, err := m.r.TokenManager().Mint(ctx, token.PurposeVerification, address.IdentityID,
+		m.c.SelfServiceVerificationLinkLifespan(), verificationPayload(address))
+	if err != nil {
+		return nil, err
+	}
+
+	// The address refers to the token of the latest link, so that sending a link invalidates the ones sent before.
+	if err := m.r.IdentityManager().RefreshVerifyAddress(ctx, address, tokenCode(t.ID), t.ExpiresAt); err != nil {
 		return nil, err
 	}
 
-	if err := m.sendCodeToKnownAddress(ctx, address); err != nil {
+	if err := m.sendCodeToKnownAddress(ctx, address, value); err != nil {
 		return nil, err
 	}
 	return address, nil
 }
 
+// verificationPayload returns the payload of verification tokens, which tells integrators inspecting the token
+// which address it verifies.
+func verificationPayload(address *identity.VerifiableAddress) json.RawMessage {
+	payload, _ := json.Marshal(map[string]interface{}{"address_id": address.ID, "via": address.Via})
+	return payload
+}
+
+// tokenCode returns the code under which an address refers to the token of its latest verification link. The code
+// column holds 32 characters, which is why the dashes of the ID are removed.
+func tokenCode(id uuid.UUID) string {
+	return strings.ReplaceAll(id.String(), "-", "")
+}
+
+var tokenCodePattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// isTokenCode returns true if the code refers to a token. Codes generated before verification used tokens are
+// alphanumeric and mixed case.
+func isTokenCode(code string) bool {
+	return tokenCodePattern.MatchString(code)
+}
+
 func (m *Sender) sendToUnknownAddress(ctx context.Context, via identity.VerifiableAddressType, address string) error {
-	m.r.Logger().WithField("via", via).Debug("Sending out invalid verification email because address is unknown.")
+	x.ContextLogger(ctx, m.r.Logger()).WithField("via", via).Debug("Sending out invalid verification email because address is unknown.")
 	return m.run(via, func() error {
 		_, err := m.r.Courier().QueueEmail(ctx,
-			templates.NewVerifyInvalid(m.c, &templates.VerifyInvalidModel{To: address}))
+			templates.NewVerifyInvalid(m.c, &templates.VerifyInvalidModel{To: address, Locale: i18n.LocaleFromContext(ctx)}))
 		return err
+	}, func() error {
+		return nil
 	})
 }
 
-func (m *Sender) sendCodeToKnownAddress(ctx context.Context, address *identity.VerifiableAddress) error {
-	m.r.Logger().WithField("via", address.Via).Debug("Sending out verification email.")
+func (m *Sender) sendCodeToKnownAddress(ctx context.Context, address *identity.VerifiableAddress, code string) error {
+	x.ContextLogger(ctx, m.r.Logger()).WithField("via", address.Via).Debug("Sending out verification email.")
+	verifyURL, err := m.verifyURL(address, code)
+	if err != nil {
+		return err
+	}
+
+	t := templates.NewVerifyValid(m.c, &templates.VerifyValidModel{
+		To:        address.Value,
+		VerifyURL: verifyURL,
+		Locale:    i18n.LocaleFromContext(ctx),
+	})
 	return m.run(address.Via, func() error {
-		_, err := m.r.Courier().QueueEmail(ctx, templates.NewVerifyValid(m.c,
-			&templates.VerifyValidModel{
-				To: address.Value,
-				VerifyURL: urlx.AppendPaths(
-					m.c.SelfPublicURL(),
-					strings.ReplaceAll(
-						strings.ReplaceAll(PublicVerificationConfirmPath, ":via", string(address.Via)),
-						":code", address.Code)).
-					String(),
-			},
-		))
+		_, err := m.r.Courier().QueueEmail(ctx, t)
+		return err
+	}, func() error {
+		_, err := m.r.Courier().QueueSMS(ctx, t)
 		return err
 	})
 }
 
-func (m *Sender) run(via identity.VerifiableAddressType, emailFunc func() error) error {
+// verifyURL returns the link of the verification email. Unless `selfservice.verify.link_url` is set, it points to
+// the confirm endpoint. Otherwise `{code}` and `{via}` in the link are replaced, or added as the `code` and `via`
+// query parameters if the link has no `{code}`. The page the link opens redeems the code using the redeem endpoint.
+func (m *Sender) verifyURL(address *identity.VerifiableAddress, code string) (string, error) {
+	link := m.c.SelfServiceVerificationLinkURL()
+	if len(link) == 0 {
+		return urlx.AppendPaths(
+			m.c.SelfPublicURL(),
+			strings.ReplaceAll(
+				strings.ReplaceAll(PublicVerificationConfirmPath, ":via", string(address.Via)),
+				":code", code)).
+			String(), nil
+	}
+
+	if strings.Contains(link, "{code}") {
+		return strings.NewReplacer(
+			"{code}", url.QueryEscape(code),
+			"{via}", url.QueryEscape(string(address.Via)),
+		).Replace(link), nil
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to parse %s", configuration.ViperKeySelfServiceVerifyLinkURL)
+	}
+	return urlx.CopyWithQuery(u, url.Values{"code": {code}, "via": {string(address.Via)}}).String(), nil
+}
+
+func (m *Sender) run(via identity.VerifiableAddressType, emailFunc, smsFunc func() error) error {
 	switch via {
 	case identity.VerifiableAddressTypeEmail:
 		return emailFunc()
+	case identity.VerifiableAddressTypeSMS:
+		return smsFunc()
 	default:
 		return errors.Errorf("received unexpected via type: %s", via)
 	}
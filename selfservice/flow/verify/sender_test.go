@@ -2,6 +2,9 @@ package verify_test
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,14 +13,18 @@ import (
 
 	"github.com/ory/viper"
 
+	"github.com/ory/kratos/courier"
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
 	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/token"
 )
 
+var tokenValuePattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f-]{27}\.[A-Za-z0-9_-]+`)
+
 func TestManager(t *testing.T) {
-	_, reg := internal.NewRegistryDefault(t)
+	conf, reg := internal.NewRegistryDefault(t)
 	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/extension/schema.json")
 	viper.Set(configuration.ViperKeyURLsSelfPublic, "https://www.ory.sh/")
 	viper.Set(configuration.ViperKeyCourierSMTPURL, "smtp://foo@bar@dev.null/")
@@ -45,12 +52,73 @@ func TestManager(t *testing.T) {
 		assert.EqualValues(t, address.Value, messages[0].Recipient)
 		assert.Contains(t, messages[0].Subject, "Please verify")
 
-		assert.Contains(t, messages[0].Body, address.Code)
+		body, err := messages[0].PlaintextBody(reg.Cipher())
+		require.NoError(t, err)
+		value := tokenValuePattern.FindString(body)
+		require.NotEmpty(t, value, "%s", body)
+		id, err := token.Parse(value, token.PurposeVerification, conf.SessionSecrets())
+		require.NoError(t, err)
+
 		fromStore, err := reg.Persister().GetIdentity(context.Background(), i.ID)
 		require.NoError(t, err)
-		assert.Contains(t, messages[0].Body, fromStore.Addresses[0].Code)
+		assert.Equal(t, strings.ReplaceAll(id.String(), "-", ""), fromStore.Addresses[0].Code)
+		assert.Equal(t, address.Code, fromStore.Addresses[0].Code)
 
 		assert.EqualValues(t, "not-tracked@ory.sh", messages[1].Recipient)
 		assert.Contains(t, messages[1].Subject, "tried to verify")
 	})
+	t.Run("method=SendCode via sms", func(t *testing.T) {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		address, err := identity.NewVerifiableSMSAddress("+4917612345678", i.ID, time.Minute)
+		require.NoError(t, err)
+		i.Addresses = []identity.VerifiableAddress{*address}
+		i.Traits = identity.Traits("{}")
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		_, err = reg.VerificationSender().SendCode(context.Background(), address.Via, address.Value)
+		require.NoError(t, err)
+
+		m, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, courier.MessageTypeSMS, m.Type)
+		assert.Equal(t, "+4917612345678", m.Recipient)
+		body, err := m.PlaintextBody(reg.Cipher())
+		require.NoError(t, err)
+		assert.Contains(t, body, "/self-service/browser/flows/verification/sms/confirm/")
+
+		_, err = reg.VerificationSender().SendCode(context.Background(), address.Via, "+4917600000000")
+		require.EqualError(t, err, verify.ErrUnknownAddress.Error())
+
+		latest, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, m.ID, latest.ID, "unknown phone numbers are not sent a text message")
+	})
+	t.Run("method=SendCode with link_url", func(t *testing.T) {
+		defer viper.Set(configuration.ViperKeySelfServiceVerifyLinkURL, nil)
+
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		address, err := identity.NewVerifiableEmailAddress("linked@ory.sh", i.ID, time.Minute)
+		require.NoError(t, err)
+		i.Addresses = []identity.VerifiableAddress{*address}
+		i.Traits = identity.Traits("{}")
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		for link, expected := range map[string]string{
+			"https://app.ory.sh/verify?lang=de": "https://app.ory.sh/verify?code=%s&lang=de&via=email",
+			"myapp://verify/{via}/{code}":       "myapp://verify/email/%s",
+		} {
+			viper.Set(configuration.ViperKeySelfServiceVerifyLinkURL, link)
+
+			address, err = reg.VerificationSender().SendCode(context.Background(), address.Via, address.Value)
+			require.NoError(t, err)
+
+			m, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+			require.NoError(t, err)
+			body, err := m.PlaintextBody(reg.Cipher())
+			require.NoError(t, err)
+			value := tokenValuePattern.FindString(body)
+			require.NotEmpty(t, value, "%s", body)
+			assert.Contains(t, body, fmt.Sprintf(expected, value))
+		}
+	})
 }
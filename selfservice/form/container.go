@@ -33,6 +33,11 @@ type Resetter interface {
 	Reset()
 }
 
+type Localizer interface {
+	// Localize translates the messages of the form to the locale.
+	Localize(t Translator, locale string)
+}
+
 type FieldSorter interface {
 	SortFields(schemaRef string, prefix string) error
 }
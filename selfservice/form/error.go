@@ -1,15 +1,57 @@
 package form
 
+// The IDs of form errors. Unlike the message, the ID of an error does not change when the message is reworded or
+// translated.
+const (
+	ErrorIDFlowExpired             = "self_service_flow_expired"
+	ErrorIDPasswordExpired         = "password_expired"
+	ErrorIDVerificationCodeInvalid = "verification_code_invalid"
+	ErrorIDRequired                = "validation_required"
+	ErrorIDPasswordPolicyViolation = "validation_password_policy_violation"
+	ErrorIDInvalidCredentials      = "validation_invalid_credentials"
+	ErrorIDDuplicateCredentials    = "validation_duplicate_credentials"
+	ErrorIDRegistrationFailed      = "registration_failed"
+	ErrorIDAccountLinkRequired     = "account_link_required"
+	ErrorIDRegistrationDisabled    = "registration_disabled"
+	ErrorIDInvitationRequired      = "registration_invitation_required"
+	ErrorIDApprovalPending         = "registration_approval_pending"
+	ErrorIDEmailDomainNotAllowed   = "validation_email_domain_not_allowed"
+	ErrorIDDisposableEmail         = "validation_disposable_email"
+	ErrorIDIdentityDeactivated     = "identity_deactivated"
+	ErrorIDPushDeliveryFailed      = "push_delivery_failed"
+	ErrorIDLoginCodeInvalid        = "login_code_invalid"
+	ErrorIDLoginCodeSendLimit      = "login_code_send_limit"
+	ErrorIDMaintenanceMode         = "maintenance_mode"
+	ErrorIDIdentityLocked          = "identity_locked"
+	ErrorIDRecoveryCodeInvalid     = "recovery_code_invalid"
+	ErrorIDRecoveryLinkInvalid     = "recovery_link_invalid"
+)
+
 type (
 	richError interface {
 		StatusCode() int
 		Reason() string
 	}
 
+	// Translator translates the messages of form errors, see HTMLForm.Localize.
+	Translator interface {
+		Translate(locale, id, fallback string, context map[string]interface{}) string
+	}
+
 	// swagger:model formError
 	Error struct {
-		// Code    FormErrorCode `json:"id,omitempty"`
+		// ID identifies the message, for example "validation_required". It is not set for all errors.
+		ID string `json:"id,omitempty"`
+
 		Message string `json:"message"`
-		// FieldName string `json:"field_name,omitempty"`
+
+		// Context contains the values the message was rendered with, for example the name of a missing
+		// property.
+		Context map[string]interface{} `json:"context,omitempty"`
 	}
 )
+
+// Localize translates the message to the locale. Errors without an ID are not changed.
+func (e *Error) Localize(t Translator, locale string) {
+	e.Message = t.Translate(locale, e.ID, e.Message, e.Context)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/ory/x/stringslice"
 
 	"github.com/ory/kratos/persistence/aliases"
+	"github.com/ory/kratos/schema"
 )
 
 var (
@@ -139,37 +140,95 @@ func (c *HTMLForm) ParseError(err error) error {
 	switch e := errorsx.Cause(err).(type) {
 	case richError:
 		if e.StatusCode() == http.StatusBadRequest {
-			c.AddError(&Error{Message: e.Reason()})
+			if fields := richErrorFields(e); len(fields) > 0 {
+				names := make([]string, 0, len(fields))
+				for name := range fields {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					for _, message := range fields[name] {
+						c.AddError(&Error{Message: message}, name)
+					}
+				}
+				return nil
+			}
+			c.AddError(&Error{ID: richErrorID(e), Message: e.Reason()})
 			return nil
 		}
 		return err
 	case *jsonschema.ValidationError:
-		for _, err := range append([]*jsonschema.ValidationError{e}, e.Causes...) {
-			pointer, _ := jsonschemax.JSONPointerToDotNotation(err.InstancePtr)
-			if err.Context == nil {
-				// The pointer can be ignored because if there is an error, we'll just use
-				// the empty field (global error).
-				c.AddError(&Error{Message: err.Message}, pointer)
-				continue
-			}
-			switch ctx := err.Context.(type) {
-			case *jsonschema.ValidationErrorContextRequired:
-				for _, required := range ctx.Missing {
-					// The pointer can be ignored because if there is an error, we'll just use
-					// the empty field (global error).
-					pointer, _ := jsonschemax.JSONPointerToDotNotation(required)
-					c.AddError(&Error{Message: err.Message}, pointer)
-				}
-			default:
-				c.AddError(&Error{Message: err.Message}, pointer)
-				continue
-			}
-		}
+		c.parseValidationError(e)
 		return nil
 	}
 	return err
 }
 
+// parseValidationError adds the violations of the validation error to the fields they belong to. Errors which
+// only wrap other violations are skipped because their message (e.g. "validation failed") does not tell the
+// user what to fix.
+func (c *HTMLForm) parseValidationError(err *jsonschema.ValidationError) {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			c.parseValidationError(cause)
+		}
+		return
+	}
+
+	// The pointer can be ignored because if there is an error, we'll just use
+	// the empty field (global error).
+	pointer, _ := jsonschemax.JSONPointerToDotNotation(err.InstancePtr)
+	switch ctx := err.Context.(type) {
+	case *jsonschema.ValidationErrorContextRequired:
+		for _, required := range ctx.Missing {
+			pointer, _ := jsonschemax.JSONPointerToDotNotation(required)
+			c.AddError(&Error{
+				ID:      ErrorIDRequired,
+				Message: err.Message,
+				Context: map[string]interface{}{"property": pointer},
+			}, pointer)
+		}
+	case *schema.ValidationErrorContextPasswordPolicyViolation:
+		c.AddError(&Error{
+			ID:      ErrorIDPasswordPolicyViolation,
+			Message: err.Message,
+			Context: map[string]interface{}{"reason": ctx.Reason},
+		}, pointer)
+	case *schema.ValidationErrorContextInvalidCredentialsError:
+		c.AddError(&Error{ID: ErrorIDInvalidCredentials, Message: err.Message}, pointer)
+	case *schema.ValidationErrorContextDuplicateCredentialsError:
+		c.AddError(&Error{ID: ErrorIDDuplicateCredentials, Message: err.Message}, pointer)
+	case *schema.ValidationErrorContextEmailDomainNotAllowed:
+		id := ErrorIDEmailDomainNotAllowed
+		if ctx.Disposable {
+			id = ErrorIDDisposableEmail
+		}
+		c.AddError(&Error{ID: id, Message: err.Message, Context: map[string]interface{}{"domain": ctx.Domain}}, pointer)
+	default:
+		c.AddError(&Error{Message: err.Message}, pointer)
+	}
+}
+
+// richErrorID returns the error_id detail of the error, if it has one.
+func richErrorID(err richError) string {
+	if e, ok := err.(interface{ Details() map[string]interface{} }); ok {
+		id, _ := e.Details()["error_id"].(string)
+		return id
+	}
+	return ""
+}
+
+// richErrorFields returns the fields detail of the error, which maps field names to the messages of their
+// violations, if it has one.
+func richErrorFields(err richError) map[string][]string {
+	if e, ok := err.(interface{ Details() map[string]interface{} }); ok {
+		fields, _ := e.Details()["fields"].(map[string][]string)
+		return fields
+	}
+	return nil
+}
+
 // SetValues sets the container's fields to the provided values.
 func (c *HTMLForm) SetValues(values map[string]interface{}) {
 	c.defaults()
@@ -301,6 +360,22 @@ func (c *HTMLForm) AddError(err *Error, names ...string) {
 	}
 }
 
+// Localize translates the messages of the form's errors and of its fields' errors to the locale.
+func (c *HTMLForm) Localize(t Translator, locale string) {
+	c.defaults()
+	c.Lock()
+	defer c.Unlock()
+
+	for k := range c.Errors {
+		c.Errors[k].Localize(t, locale)
+	}
+	for k := range c.Fields {
+		for j := range c.Fields[k].Errors {
+			c.Fields[k].Errors[j].Localize(t, locale)
+		}
+	}
+}
+
 func (c *HTMLForm) Scan(value interface{}) error {
 	return aliases.JSONScan(c, value)
 }
@@ -36,6 +36,12 @@ func newFormRequest(t *testing.T, values url.Values) *http.Request {
 	return req
 }
 
+type translatorFunc func(locale, id, fallback string, context map[string]interface{}) string
+
+func (f translatorFunc) Translate(locale, id, fallback string, context map[string]interface{}) string {
+	return f(locale, id, fallback, context)
+}
+
 func TestContainer(t *testing.T) {
 	t.Run("method=NewHTMLFormFromJSON", func(t *testing.T) {
 		for k, tc := range []struct {
@@ -203,9 +209,26 @@ func TestContainer(t *testing.T) {
 			{err: errors.New("foo"), expectErr: true},
 			{err: &herodot.ErrNotFound, expectErr: true},
 			{err: herodot.ErrBadRequest.WithReason("tests"), expect: HTMLForm{Fields: Fields{}, Errors: []Error{{Message: "tests"}}}},
-			{err: schema.NewInvalidCredentialsError(), expect: HTMLForm{Fields: Fields{}, Errors: []Error{{Message: "the provided credentials are invalid, check for spelling mistakes in your password or username, email address, or phone number"}}}},
+			{err: schema.NewInvalidCredentialsError(), expect: HTMLForm{Fields: Fields{}, Errors: []Error{{ID: ErrorIDInvalidCredentials, Message: "the provided credentials are invalid, check for spelling mistakes in your password or username, email address, or phone number"}}}},
 			{err: &jsonschema.ValidationError{Message: "test", InstancePtr: "#/foo/bar/baz"}, expect: HTMLForm{Fields: Fields{Field{Name: "foo.bar.baz", Type: "", Errors: []Error{{Message: "test"}}}}}},
 			{err: &jsonschema.ValidationError{Message: "test", InstancePtr: ""}, expect: HTMLForm{Fields: Fields{}, Errors: []Error{{Message: "test"}}}},
+			{err: schema.NewRequiredError("#/", "password"), expect: HTMLForm{Fields: Fields{Field{Name: "password", Errors: []Error{{ID: ErrorIDRequired, Message: "missing properties: password", Context: map[string]interface{}{"property": "password"}}}}}}},
+			{err: schema.NewPasswordPolicyViolationError("#/password", "too short"), expect: HTMLForm{Fields: Fields{Field{Name: "password", Errors: []Error{{ID: ErrorIDPasswordPolicyViolation, Message: "the password does not fulfill the password policy because: too short", Context: map[string]interface{}{"reason": "too short"}}}}}}},
+			{err: schema.NewEmailDomainNotAllowedError("#/email", "mailinator.com", true), expect: HTMLForm{Fields: Fields{Field{Name: "email", Errors: []Error{{ID: ErrorIDDisposableEmail, Message: `disposable email addresses such as ones of the domain "mailinator.com" can not be used`, Context: map[string]interface{}{"domain": "mailinator.com"}}}}}}},
+			{err: herodot.ErrBadRequest.WithReason("expired").WithDetail("error_id", ErrorIDFlowExpired), expect: HTMLForm{Fields: Fields{}, Errors: []Error{{ID: ErrorIDFlowExpired, Message: "expired"}}}},
+			{err: &jsonschema.ValidationError{Message: "validation failed", InstancePtr: "#", Causes: []*jsonschema.ValidationError{
+				{Message: "validation failed", InstancePtr: "#/traits", Causes: []*jsonschema.ValidationError{
+					{Message: "too short", InstancePtr: "#/traits/name/first"},
+					{Message: "not an email", InstancePtr: "#/traits/email"},
+				}},
+			}}, expect: HTMLForm{Fields: Fields{
+				Field{Name: "traits.name.first", Errors: []Error{{Message: "too short"}}},
+				Field{Name: "traits.email", Errors: []Error{{Message: "not an email"}}},
+			}}},
+			{err: herodot.ErrBadRequest.WithReason("invalid").WithDetail("fields", map[string][]string{"traits.email": {"not an email"}, "": {"global"}}), expect: HTMLForm{
+				Fields: Fields{Field{Name: "traits.email", Errors: []Error{{Message: "not an email"}}}},
+				Errors: []Error{{Message: "global"}},
+			}},
 		} {
 			t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
 				for _, in := range []error{tc.err, errors.WithStack(tc.err)} {
@@ -223,6 +246,24 @@ func TestContainer(t *testing.T) {
 		}
 	})
 
+	t.Run("method=Localize", func(t *testing.T) {
+		c := NewHTMLForm("")
+		c.AddError(&Error{ID: ErrorIDInvalidCredentials, Message: "invalid"})
+		c.AddError(&Error{Message: "no id"})
+		c.AddError(&Error{ID: ErrorIDRequired, Message: "missing", Context: map[string]interface{}{"property": "email"}}, "email")
+
+		c.Localize(translatorFunc(func(locale, id, fallback string, context map[string]interface{}) string {
+			if len(id) == 0 {
+				return fallback
+			}
+			return fmt.Sprintf("%s:%s:%v", locale, id, context["property"])
+		}), "de")
+
+		assert.Equal(t, "de:validation_invalid_credentials:<nil>", c.Errors[0].Message)
+		assert.Equal(t, "no id", c.Errors[1].Message)
+		assert.Equal(t, "de:validation_required:email", c.getField("email").Errors[0].Message)
+	})
+
 	t.Run("method=SetValue", func(t *testing.T) {
 		c := HTMLForm{
 			Fields: Fields{
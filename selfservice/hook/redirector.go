@@ -15,6 +15,8 @@ import (
 var (
 	_ login.PostHookExecutor        = new(Redirector)
 	_ registration.PostHookExecutor = new(Redirector)
+
+	_ registration.ConcealingPostHookExecutor = new(Redirector)
 )
 
 type Redirector struct {
@@ -39,6 +41,10 @@ func (e *Redirector) ExecuteRegistrationPostHook(w http.ResponseWriter, r *http.
 	return e.do(w, r, sr.RequestURL)
 }
 
+func (e *Redirector) ConcealRegistration(w http.ResponseWriter, r *http.Request, sr *registration.Request) error {
+	return e.do(w, r, sr.RequestURL)
+}
+
 func (e *Redirector) ExecuteLoginPostHook(w http.ResponseWriter, r *http.Request, sr *login.Request, _ *session.Session) error {
 	return e.do(w, r, sr.RequestURL)
 }
@@ -0,0 +1,66 @@
+package hook
+
+import (
+	"net/http"
+
+	"github.com/ory/kratos/resilience"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/session"
+)
+
+var (
+	_ login.PostHookExecutor        = new(ResilientLoginHook)
+	_ registration.PostHookExecutor = new(ResilientRegistrationHook)
+
+	_ registration.ConcealingPostHookExecutor = new(ResilientRegistrationHook)
+)
+
+type (
+	// ResilientLoginHook executes a login hook according to a resilience policy.
+	ResilientLoginHook struct {
+		e *resilience.Executor
+		p resilience.Policy
+		h login.PostHookExecutor
+	}
+
+	// ResilientRegistrationHook executes a registration hook according to a resilience policy.
+	ResilientRegistrationHook struct {
+		e *resilience.Executor
+		p resilience.Policy
+		h registration.PostHookExecutor
+	}
+)
+
+func NewResilientLoginHook(e *resilience.Executor, p resilience.Policy, h login.PostHookExecutor) *ResilientLoginHook {
+	return &ResilientLoginHook{e: e, p: p, h: h}
+}
+
+func (e *ResilientLoginHook) ExecuteLoginPostHook(w http.ResponseWriter, r *http.Request, a *login.Request, s *session.Session) error {
+	return e.e.Execute(w, r, e.p, func(w http.ResponseWriter, r *http.Request) error {
+		return e.h.ExecuteLoginPostHook(w, r, a, s)
+	})
+}
+
+func NewResilientRegistrationHook(e *resilience.Executor, p resilience.Policy, h registration.PostHookExecutor) *ResilientRegistrationHook {
+	return &ResilientRegistrationHook{e: e, p: p, h: h}
+}
+
+func (e *ResilientRegistrationHook) ExecuteRegistrationPostHook(w http.ResponseWriter, r *http.Request, a *registration.Request, s *session.Session) error {
+	return e.e.Execute(w, r, e.p, func(w http.ResponseWriter, r *http.Request) error {
+		return e.h.ExecuteRegistrationPostHook(w, r, a, s)
+	})
+}
+
+// ConcealRegistration executes the wrapped hook if it responds to concealed registrations and does nothing
+// otherwise.
+func (e *ResilientRegistrationHook) ConcealRegistration(w http.ResponseWriter, r *http.Request, a *registration.Request) error {
+	h, ok := e.h.(registration.ConcealingPostHookExecutor)
+	if !ok {
+		return nil
+	}
+
+	return e.e.Execute(w, r, e.p, func(w http.ResponseWriter, r *http.Request) error {
+		return h.ConcealRegistration(w, r, a)
+	})
+}
@@ -13,6 +13,7 @@ type (
 	sessionDestroyerDependencies interface {
 		session.ManagementProvider
 		session.PersistenceProvider
+		session.BackChannelLogoutProvider
 	}
 	SessionDestroyer struct {
 		r sessionDestroyerDependencies
@@ -24,6 +25,9 @@ func NewSessionDestroyer(r sessionDestroyerDependencies) *SessionDestroyer {
 }
 
 func (e *SessionDestroyer) ExecuteLoginPostHook(_ http.ResponseWriter, r *http.Request, _ *login.Request, s *session.Session) error {
+	if err := e.r.SessionBackChannelLogout().NotifyIdentityExcept(r.Context(), s.Identity.ID, s.ID); err != nil {
+		return err
+	}
 	if err := e.r.SessionPersister().DeleteSessionsFor(r.Context(), s.Identity.ID); err != nil {
 		return err
 	}
@@ -7,6 +7,7 @@ import (
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/registration"
 	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/webhook"
 )
 
 var (
@@ -17,7 +18,7 @@ var (
 type (
 	sessionIssuerDependencies interface {
 		session.ManagementProvider
-		session.PersistenceProvider
+		webhook.DispatcherProvider
 	}
 	SessionIssuer struct {
 		r sessionIssuerDependencies
@@ -29,17 +30,19 @@ func NewSessionIssuer(r sessionIssuerDependencies) *SessionIssuer {
 }
 
 func (e *SessionIssuer) ExecuteRegistrationPostHook(w http.ResponseWriter, r *http.Request, a *registration.Request, s *session.Session) error {
-	s.AuthenticatedAt = time.Now().UTC()
-	if err := e.r.SessionPersister().CreateSession(r.Context(), s); err != nil {
-		return err
-	}
-	return e.r.SessionManager().SaveToRequest(r.Context(), s, w, r)
+	return e.issue(w, r, s)
 }
 
 func (e *SessionIssuer) ExecuteLoginPostHook(w http.ResponseWriter, r *http.Request, a *login.Request, s *session.Session) error {
+	return e.issue(w, r, s)
+}
+
+func (e *SessionIssuer) issue(w http.ResponseWriter, r *http.Request, s *session.Session) error {
 	s.AuthenticatedAt = time.Now().UTC()
-	if err := e.r.SessionPersister().CreateSession(r.Context(), s); err != nil {
+	if err := e.r.SessionManager().IssueToRequest(r.Context(), s, w, r); err != nil {
 		return err
 	}
-	return e.r.SessionManager().SaveToRequest(r.Context(), s, w, r)
+
+	e.r.WebhookDispatcher().Emit(r.Context(), webhook.EventSessionCreated, s)
+	return nil
 }
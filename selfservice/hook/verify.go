@@ -3,6 +3,7 @@ package hook
 import (
 	"net/http"
 
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/selfservice/flow/registration"
 	"github.com/ory/kratos/selfservice/flow/verify"
 	"github.com/ory/kratos/session"
@@ -23,12 +24,16 @@ func NewVerifier(r verifierDependencies) *Verifier {
 	return &Verifier{r: r}
 }
 
-func (e *Verifier) ExecuteRegistrationPostHook(w http.ResponseWriter, r *http.Request, _ *registration.Request, s *session.Session) error {
+func (e *Verifier) ExecuteRegistrationPostHook(w http.ResponseWriter, r *http.Request, a *registration.Request, s *session.Session) error {
 	// Ths is called after the identity has been created so we can safely assume that all addresses are available
 	// already.
+	ctx := r.Context()
+	if a != nil {
+		ctx = i18n.WithLocale(ctx, a.Locale)
+	}
 
 	for k, address := range s.Identity.Addresses {
-		sent, err := e.r.VerificationSender().SendCode(r.Context(), address.Via, address.Value)
+		sent, err := e.r.VerificationSender().SendCode(ctx, address.Via, address.Value)
 		if err != nil {
 			return err
 		}
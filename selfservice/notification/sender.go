@@ -0,0 +1,265 @@
+package notification
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/courier"
+	templates "github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+// KnownDevicesCookieName is the name of the cookie which remembers the identities that signed in using
+// this browser.
+const KnownDevicesCookieName = "ory_kratos_known_devices"
+
+type (
+	senderDependencies interface {
+		courier.Provider
+		identity.PoolProvider
+		x.CookieProvider
+		x.LoggingProvider
+	}
+	SenderProvider interface {
+		NotificationSender() *Sender
+	}
+	Sender struct {
+		r senderDependencies
+		c configuration.Provider
+	}
+)
+
+func NewSender(r senderDependencies, c configuration.Provider) *Sender {
+	return &Sender{r: r, c: c}
+}
+
+// NotifyLogin sends a security notification to the identity's verified email addresses if the identity
+// signed in using a browser that it has not used before. The browser is remembered using a signed cookie,
+// which is why this method must be called before the response is written.
+func (m *Sender) NotifyLogin(w http.ResponseWriter, r *http.Request, i *identity.Identity) error {
+	if !m.c.SelfServiceNotificationNewLoginEnabled() {
+		return nil
+	}
+
+	cookie, _ := m.r.CookieManager().Get(r, KnownDevicesCookieName)
+	key := deviceKey(i)
+	if _, known := cookie.Values[key]; known {
+		return nil
+	}
+
+	cookie.Values[key] = time.Now().UTC().Unix()
+	if err := cookie.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return m.send(r.Context(), i, true, func(to string) courier.EmailTemplate {
+		return templates.NewLoginNotification(m.c, &templates.LoginNotificationModel{
+			To:        to,
+			IPAddress: ip,
+			UserAgent: r.UserAgent(),
+			Time:      time.Now().UTC(),
+			Locale:    i18n.LocaleFromContext(r.Context()),
+		})
+	})
+}
+
+// NotifyPasswordChanged sends a security notification to the identity's verified email addresses after
+// its password was changed.
+func (m *Sender) NotifyPasswordChanged(ctx context.Context, i *identity.Identity) error {
+	if !m.c.SelfServiceNotificationPasswordChangedEnabled() {
+		return nil
+	}
+
+	return m.send(ctx, i, true, func(to string) courier.EmailTemplate {
+		return templates.NewPasswordChangedNotification(m.c, &templates.PasswordChangedNotificationModel{
+			To:     to,
+			Time:   time.Now().UTC(),
+			Locale: i18n.LocaleFromContext(ctx),
+		})
+	})
+}
+
+// NotifyAccountRecovered tells every verified email address and phone number of the identity that its account was
+// recovered and sends the link which undoes the recovery. Unlike the other notifications it can not be disabled, as
+// it is the only way to notice that someone else recovered the account.
+func (m *Sender) NotifyAccountRecovered(ctx context.Context, i *identity.Identity, revertURL string, revertExpiresAt time.Time) error {
+	for _, address := range i.Addresses {
+		if !address.Verified {
+			continue
+		}
+
+		tpl := templates.NewAccountRecoveredNotification(m.c, &templates.AccountRecoveredNotificationModel{
+			To:              address.Value,
+			Time:            time.Now().UTC(),
+			RevertURL:       revertURL,
+			RevertExpiresAt: revertExpiresAt,
+			Locale:          i18n.LocaleFromContext(ctx),
+		})
+
+		var err error
+		switch address.Via {
+		case identity.VerifiableAddressTypeEmail:
+			_, err = m.r.Courier().QueueEmail(ctx, tpl)
+		case identity.VerifiableAddressTypeSMS:
+			_, err = m.r.Courier().QueueSMS(ctx, tpl)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NotifySecondFactorChanged sends a security notification to the identity's verified email addresses after a
+// second factor was added or removed. The name identifies the second factor if the identity can set up several of
+// the same method, for example the name of a device.
+func (m *Sender) NotifySecondFactorChanged(ctx context.Context, i *identity.Identity, method identity.CredentialsType, name string, added bool) error {
+	if !m.c.SelfServiceNotificationSecondFactorChangedEnabled() {
+		return nil
+	}
+
+	return m.send(ctx, i, true, func(to string) courier.EmailTemplate {
+		return templates.NewSecondFactorChangedNotification(m.c, &templates.SecondFactorChangedNotificationModel{
+			To:     to,
+			Method: string(method),
+			Name:   name,
+			Added:  added,
+			Time:   time.Now().UTC(),
+			Locale: i18n.LocaleFromContext(ctx),
+		})
+	})
+}
+
+// NotifyCodeReplayed sends a security notification to the verified email addresses of the identity whose code was
+// redeemed again, as rejected with identity.ErrAlreadyRedeemed, because the code might have leaked. Nothing is sent
+// if the client which sent the request redeemed the code itself, for example by opening the same link twice.
+func (m *Sender) NotifyCodeReplayed(r *http.Request, kind identity.RedemptionKind, code string) error {
+	if !m.c.SelfServiceNotificationCodeReplayedEnabled() {
+		return nil
+	}
+
+	ctx := r.Context()
+	redemption, err := m.r.IdentityPool().FindRedemption(ctx, kind, code)
+	if err != nil {
+		return err
+	}
+
+	by := identity.NewRedeemer(r)
+	if redemption.RedeemedBy(by) {
+		return nil
+	}
+
+	i, err := m.r.IdentityPool().GetIdentity(ctx, redemption.IdentityID)
+	if err != nil {
+		return err
+	}
+
+	return m.send(ctx, i, true, func(to string) courier.EmailTemplate {
+		return templates.NewCodeReplayedNotification(m.c, &templates.CodeReplayedNotificationModel{
+			To:                to,
+			RedeemedAt:        redemption.CreatedAt.UTC(),
+			RedeemedIPAddress: redemption.IPAddress,
+			RedeemedUserAgent: redemption.UserAgent,
+			Time:              time.Now().UTC(),
+			IPAddress:         by.IPAddress,
+			UserAgent:         by.UserAgent,
+			Locale:            i18n.LocaleFromContext(ctx),
+		})
+	})
+}
+
+// NotifyScheduledDeletion sends a notification to the identity's verified email addresses that the identity will be
+// deleted by a retention policy at the given time.
+func (m *Sender) NotifyScheduledDeletion(ctx context.Context, i *identity.Identity, deleteAt time.Time) error {
+	return m.send(ctx, i, true, func(to string) courier.EmailTemplate {
+		return templates.NewScheduledDeletionNotification(m.c, &templates.ScheduledDeletionNotificationModel{
+			To:       to,
+			DeleteAt: deleteAt,
+			Locale:   i18n.LocaleFromContext(ctx),
+		})
+	})
+}
+
+// NotifyInvitation sends an invitation to register to the email address.
+func (m *Sender) NotifyInvitation(ctx context.Context, to, url string, expiresAt time.Time) error {
+	_, err := m.r.Courier().QueueEmail(ctx, templates.NewInvitation(m.c, &templates.InvitationModel{
+		To:        to,
+		URL:       url,
+		ExpiresAt: expiresAt,
+		Locale:    i18n.LocaleFromContext(ctx),
+	}))
+	return err
+}
+
+// NotifyRegistrationAttempt tells the identity that someone tried to sign up using its email address. It is sent
+// instead of revealing that the address is taken, see configuration key security.account_enumeration.mitigate.
+func (m *Sender) NotifyRegistrationAttempt(ctx context.Context, i *identity.Identity) error {
+	return m.send(ctx, i, true, func(to string) courier.EmailTemplate {
+		return templates.NewRegistrationAttemptNotification(m.c, &templates.RegistrationAttemptNotificationModel{
+			To:     to,
+			Time:   time.Now().UTC(),
+			Locale: i18n.LocaleFromContext(ctx),
+		})
+	})
+}
+
+// NotifyRegistrationApproved tells the identity that an administrator approved its registration. Unverified email
+// addresses are notified as well because identities awaiting approval usually did not verify their address yet.
+func (m *Sender) NotifyRegistrationApproved(ctx context.Context, i *identity.Identity) error {
+	return m.send(ctx, i, false, func(to string) courier.EmailTemplate {
+		return templates.NewRegistrationApprovedNotification(m.c, &templates.RegistrationApprovedNotificationModel{
+			To:     to,
+			Locale: i18n.LocaleFromContext(ctx),
+		})
+	})
+}
+
+// NotifyRegistrationRejected tells the identity that an administrator rejected its registration. Like
+// NotifyRegistrationApproved, unverified email addresses are notified as well.
+func (m *Sender) NotifyRegistrationRejected(ctx context.Context, i *identity.Identity) error {
+	return m.send(ctx, i, false, func(to string) courier.EmailTemplate {
+		return templates.NewRegistrationRejectedNotification(m.c, &templates.RegistrationRejectedNotificationModel{
+			To:     to,
+			Locale: i18n.LocaleFromContext(ctx),
+		})
+	})
+}
+
+// send queues a message for every email address. If verifiedOnly is set, unverified addresses are skipped as they
+// might not belong to the identity.
+func (m *Sender) send(ctx context.Context, i *identity.Identity, verifiedOnly bool, tpl func(to string) courier.EmailTemplate) error {
+	for _, address := range i.Addresses {
+		if address.Via != identity.VerifiableAddressTypeEmail || (verifiedOnly && !address.Verified) {
+			continue
+		}
+
+		x.ContextLogger(ctx, m.r.Logger()).WithField("identity_id", i.ID).Debug("Sending out security notification.")
+		if _, err := m.r.Courier().QueueEmail(ctx, tpl(address.Value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deviceKey(i *identity.Identity) string {
+	h := sha256.Sum256(i.ID.Bytes())
+	return hex.EncodeToString(h[:16])
+}
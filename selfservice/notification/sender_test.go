@@ -0,0 +1,176 @@
+package notification_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/x"
+)
+
+func TestSender(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeySecretsSession, []string{"not-a-secure-session-key"})
+	viper.Set(configuration.ViperKeyCourierSMTPURL, "smtp://foo@bar@dev.null/")
+
+	newIdentity := func(verified bool) *identity.Identity {
+		return &identity.Identity{
+			ID: x.NewUUID(),
+			Addresses: []identity.VerifiableAddress{
+				{Value: "foo@ory.sh", Via: identity.VerifiableAddressTypeEmail, Verified: verified},
+			},
+		}
+	}
+
+	queued := func(t *testing.T) []courier.Message {
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 10)
+		if errors.Cause(err) == courier.ErrQueueEmpty {
+			return nil
+		}
+		require.NoError(t, err)
+
+		// Mark the messages as sent so that they are not returned by subsequent calls.
+		for k, m := range messages {
+			require.NoError(t, reg.CourierPersister().SetMessageStatus(context.Background(), m.ID, courier.MessageStatusSent))
+
+			body, err := m.PlaintextBody(reg.Cipher())
+			require.NoError(t, err)
+			messages[k].Body = body
+		}
+		return messages
+	}
+
+	t.Run("method=NotifyLogin", func(t *testing.T) {
+		t.Run("case=should not send anything when disabled", func(t *testing.T) {
+			viper.Set(configuration.ViperKeySelfServiceNotificationNewLogin, false)
+			r := httptest.NewRequest("POST", "/", nil)
+			require.NoError(t, reg.NotificationSender().NotifyLogin(httptest.NewRecorder(), r, newIdentity(true)))
+			assert.Len(t, queued(t), 0)
+		})
+
+		viper.Set(configuration.ViperKeySelfServiceNotificationNewLogin, true)
+
+		t.Run("case=should notify only once per device", func(t *testing.T) {
+			i := newIdentity(true)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("User-Agent", "notification-test-agent")
+			require.NoError(t, reg.NotificationSender().NotifyLogin(w, r, i))
+
+			messages := queued(t)
+			require.Len(t, messages, 1)
+			assert.Equal(t, "foo@ory.sh", messages[0].Recipient)
+			assert.Contains(t, messages[0].Body, "notification-test-agent")
+
+			r = httptest.NewRequest("POST", "/", nil)
+			for _, c := range w.Result().Cookies() {
+				r.AddCookie(c)
+			}
+			require.NoError(t, reg.NotificationSender().NotifyLogin(httptest.NewRecorder(), r, i))
+			assert.Len(t, queued(t), 0)
+		})
+
+		t.Run("case=should not notify unverified addresses", func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			require.NoError(t, reg.NotificationSender().NotifyLogin(httptest.NewRecorder(), r, newIdentity(false)))
+			assert.Len(t, queued(t), 0)
+		})
+	})
+
+	t.Run("method=NotifyPasswordChanged", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceNotificationPasswordChanged, false)
+		require.NoError(t, reg.NotificationSender().NotifyPasswordChanged(context.Background(), newIdentity(true)))
+		assert.Len(t, queued(t), 0)
+
+		viper.Set(configuration.ViperKeySelfServiceNotificationPasswordChanged, true)
+		require.NoError(t, reg.NotificationSender().NotifyPasswordChanged(context.Background(), newIdentity(true)))
+		messages := queued(t)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "foo@ory.sh", messages[0].Recipient)
+	})
+
+	t.Run("method=NotifyAccountRecovered", func(t *testing.T) {
+		i := newIdentity(true)
+		i.Addresses = append(i.Addresses,
+			identity.VerifiableAddress{Value: "+4917612345678", Via: identity.VerifiableAddressTypeSMS, Verified: true},
+			identity.VerifiableAddress{Value: "unverified@ory.sh", Via: identity.VerifiableAddressTypeEmail, Verified: false},
+		)
+
+		require.NoError(t, reg.NotificationSender().NotifyAccountRecovered(context.Background(), i, "https://www.ory.sh/revert", time.Now().Add(time.Hour)))
+		messages := queued(t)
+		require.Len(t, messages, 2)
+		for _, m := range messages {
+			assert.Contains(t, m.Body, "https://www.ory.sh/revert")
+			switch m.Type {
+			case courier.MessageTypeEmail:
+				assert.Equal(t, "foo@ory.sh", m.Recipient)
+			case courier.MessageTypeSMS:
+				assert.Equal(t, "+4917612345678", m.Recipient)
+			default:
+				t.Errorf("unexpected message type %d", m.Type)
+			}
+		}
+	})
+
+	t.Run("method=NotifySecondFactorChanged", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceNotificationSecondFactor, false)
+		require.NoError(t, reg.NotificationSender().NotifySecondFactorChanged(context.Background(), newIdentity(true), identity.CredentialsTypePush, "Work Phone", true))
+		assert.Len(t, queued(t), 0)
+
+		viper.Set(configuration.ViperKeySelfServiceNotificationSecondFactor, true)
+		require.NoError(t, reg.NotificationSender().NotifySecondFactorChanged(context.Background(), newIdentity(true), identity.CredentialsTypePush, "Work Phone", false))
+		messages := queued(t)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "foo@ory.sh", messages[0].Recipient)
+		assert.Contains(t, messages[0].Body, "Work Phone")
+
+		require.NoError(t, reg.NotificationSender().NotifySecondFactorChanged(context.Background(), newIdentity(false), identity.CredentialsTypePush, "Work Phone", true))
+		assert.Len(t, queued(t), 0)
+	})
+
+	t.Run("method=NotifyScheduledDeletion", func(t *testing.T) {
+		deleteAt := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, reg.NotificationSender().NotifyScheduledDeletion(context.Background(), newIdentity(true), deleteAt))
+		messages := queued(t)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "foo@ory.sh", messages[0].Recipient)
+		assert.Contains(t, messages[0].Body, "2020-03-01")
+
+		require.NoError(t, reg.NotificationSender().NotifyScheduledDeletion(context.Background(), newIdentity(false), deleteAt))
+		assert.Len(t, queued(t), 0)
+	})
+
+	t.Run("method=NotifyInvitation", func(t *testing.T) {
+		require.NoError(t, reg.NotificationSender().NotifyInvitation(context.Background(), "invited@ory.sh", "https://www.ory.sh/?invitation=token", time.Now().Add(time.Hour)))
+		messages := queued(t)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "invited@ory.sh", messages[0].Recipient)
+		assert.Contains(t, messages[0].Body, "https://www.ory.sh/?invitation=token")
+	})
+
+	t.Run("method=NotifyRegistrationApproved", func(t *testing.T) {
+		require.NoError(t, reg.NotificationSender().NotifyRegistrationApproved(context.Background(), newIdentity(false)))
+		messages := queued(t)
+		require.Len(t, messages, 1, "unverified addresses are notified as well")
+		assert.Equal(t, "foo@ory.sh", messages[0].Recipient)
+	})
+
+	t.Run("method=NotifyRegistrationRejected", func(t *testing.T) {
+		require.NoError(t, reg.NotificationSender().NotifyRegistrationRejected(context.Background(), newIdentity(false)))
+		messages := queued(t)
+		require.Len(t, messages, 1, "unverified addresses are notified as well")
+		assert.Equal(t, "foo@ory.sh", messages[0].Recipient)
+	})
+}
@@ -0,0 +1,156 @@
+package crossdevice
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/session"
+)
+
+const (
+	// ActionField is the name of the approval form field which is either ActionApprove or ActionDeny.
+	ActionField   = "action"
+	ActionApprove = "approve"
+	ActionDeny    = "deny"
+)
+
+// Approval is returned to the approval UI, which shows where and when the login was initiated and lets the user
+// approve or deny it by submitting the form.
+//
+// swagger:model crossDeviceApproval
+type Approval struct {
+	// RequestID is the ID of the login request.
+	RequestID uuid.UUID `json:"request"`
+
+	// State is the approval state of the login request.
+	State login.ApprovalState `json:"state"`
+
+	// RequestURL is the URL with which the browser initiated the login request.
+	RequestURL string `json:"request_url"`
+
+	// IssuedAt is the time (UTC) when the login request was initiated.
+	IssuedAt time.Time `json:"issued_at"`
+
+	// ExpiresAt is the time (UTC) when the login request expires.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Form approves the login request if it is submitted with the action field set to "approve", and denies it if
+	// the action field is set to "deny".
+	Form *form.HTMLForm `json:"form"`
+}
+
+// approvalRequest returns the login request which the approving device wants to approve and the session of that
+// device.
+func (s *Strategy) approvalRequest(w http.ResponseWriter, r *http.Request) (*login.Request, *session.Session, error) {
+	sess, err := s.d.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !s.verifyCode(ar.ID, r.URL.Query().Get("code")) {
+		return nil, nil, errors.WithStack(herodot.ErrForbidden.WithReason("The approval code is invalid."))
+	}
+
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		return nil, nil, err
+	}
+
+	return ar, sess, nil
+}
+
+func (s *Strategy) fetchApproval(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, _, err := s.approvalRequest(w, r)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if ar.ApprovalState == login.ApprovalStatePending {
+		// Tells the browser that the QR code was scanned, so that it can ask the user to continue on the other
+		// device.
+		if err := s.d.LoginRequestPersister().UpdateLoginRequestApproval(r.Context(), ar.ID, login.ApprovalStatePending, login.ApprovalStateScanned, uuid.NullUUID{}); err == nil {
+			ar.ApprovalState = login.ApprovalStateScanned
+		} else if errorsx.Cause(err) != sqlcon.ErrNoRows {
+			s.d.Writer().WriteError(w, r, err)
+			return
+		} else if ar, err = s.d.LoginRequestPersister().GetLoginRequest(r.Context(), ar.ID); err != nil {
+			s.d.Writer().WriteError(w, r, err)
+			return
+		}
+	}
+
+	f := form.NewHTMLForm(urlx.CopyWithQuery(
+		urlx.AppendPaths(s.c.SelfPublicURL(), ApprovalPath),
+		url.Values{"request": {ar.ID.String()}, "code": {r.URL.Query().Get("code")}},
+	).String())
+	f.SetField(form.Field{Name: ActionField, Type: "submit", Required: true})
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	s.d.Writer().Write(w, r, &Approval{
+		RequestID:  ar.ID,
+		State:      ar.ApprovalState,
+		RequestURL: ar.RequestURL,
+		IssuedAt:   ar.IssuedAt,
+		ExpiresAt:  ar.ExpiresAt,
+		Form:       f,
+	})
+}
+
+func (s *Strategy) submitApproval(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, sess, err := s.approvalRequest(w, r)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	var to login.ApprovalState
+	var iid uuid.NullUUID
+	switch r.PostForm.Get(ActionField) {
+	case ActionApprove:
+		to, iid = login.ApprovalStateApproved, uuid.NullUUID{UUID: sess.IdentityID, Valid: true}
+	case ActionDeny:
+		to = login.ApprovalStateDenied
+	default:
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The %s field must be either "%s" or "%s".`, ActionField, ActionApprove, ActionDeny)))
+		return
+	}
+
+	// A login request can only be approved or denied once, and only after the approval page was opened.
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestApproval(r.Context(), ar.ID, login.ApprovalStateScanned, to, iid); err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			err = errors.WithStack(herodot.ErrBadRequest.WithReason("The login request was already approved or denied."))
+		}
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	u, err := s.approvalURL(ar.ID)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, u, http.StatusFound)
+}
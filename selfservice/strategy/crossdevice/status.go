@@ -0,0 +1,181 @@
+package crossdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+// statusPollInterval is the interval in which the event stream checks whether the approval state changed.
+const statusPollInterval = time.Second
+
+// Status is the approval state of a cross-device login request.
+//
+// swagger:model crossDeviceStatus
+type Status struct {
+	// State is the approval state. The browser submits the login form once it is "approved".
+	State login.ApprovalState `json:"state"`
+
+	// ExpiresAt is the time (UTC) when the login request expires.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newStatus(ar *login.Request) *Status {
+	return &Status{State: ar.ApprovalState, ExpiresAt: ar.ExpiresAt}
+}
+
+// isFinal returns true if the approval state will not change anymore.
+func isFinal(state login.ApprovalState) bool {
+	return state == login.ApprovalStateApproved ||
+		state == login.ApprovalStateDenied ||
+		state == login.ApprovalStateCompleted
+}
+
+// fetchStatus returns the approval state of the login request. If the browser accepts `text/event-stream`, the
+// state is sent as a server-sent event whenever it changes until it is final or the request expired.
+func (s *Strategy) fetchStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := login.CheckInitiator(s.d, r, ar); err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.d.Writer().Write(w, r, newStatus(ar))
+		return
+	}
+
+	s.streamStatus(w, r, ar)
+}
+
+func (s *Strategy) streamStatus(w http.ResponseWriter, r *http.Request, ar *login.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrInternalServerError.WithReason("The response writer does not support server-sent events.")))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	var last login.ApprovalState
+	for {
+		if ar.ApprovalState != last {
+			status, err := json.Marshal(newStatus(ar))
+			if err != nil {
+				x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).Error("Unable to encode the cross-device login status.")
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", status); err != nil {
+				return
+			}
+			flusher.Flush()
+			last = ar.ApprovalState
+		}
+
+		if isFinal(ar.ApprovalState) || ar.Valid() != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		var err error
+		if ar, err = s.d.LoginRequestPersister().GetLoginRequest(r.Context(), ar.ID); err != nil {
+			x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).Warn("Unable to load the cross-device login request.")
+			return
+		}
+	}
+}
+
+func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, ar *login.Request, err error) {
+	if ar != nil {
+		if method, ok := ar.Methods[s.ID()]; ok {
+			if approval, aerr := s.approvalURL(ar.ID); aerr == nil {
+				method.Config.Reset()
+				method.Config.SetValue(ApprovalURLField, approval)
+				method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+				ar.Methods[s.ID()] = method
+			}
+		}
+	}
+
+	s.d.LoginRequestErrorHandler().HandleLoginError(w, r, s.ID(), ar, err)
+}
+
+// complete signs in the browser which initiated the login request once the request was approved.
+func (s *Strategy) complete(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	// The approval is bound to the browser which displayed the QR code. Otherwise, whoever tricked the user into
+	// scanning a QR code could sign in as that user.
+	if err := login.CheckInitiator(s.d, r, ar); err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	switch ar.ApprovalState {
+	case login.ApprovalStateApproved:
+	case login.ApprovalStateDenied:
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The login was denied on the other device.")))
+		return
+	case login.ApprovalStateCompleted:
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The login request was already completed.")))
+		return
+	default:
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The login has not been approved on the other device yet.")))
+		return
+	}
+
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestApproval(r.Context(), ar.ID, login.ApprovalStateApproved, login.ApprovalStateCompleted, ar.ApprovedIdentityID); err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			err = errors.WithStack(herodot.ErrBadRequest.WithReason("The login request was already completed."))
+		}
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ar.ApprovedIdentityID.UUID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, s.ID(), s.d.PostLoginHooks(s.ID()), ar, i); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+}
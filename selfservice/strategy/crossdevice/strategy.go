@@ -0,0 +1,211 @@
+package crossdevice
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	BasePath = "/self-service/browser/flows/login/strategies/cross-device"
+
+	// ApprovalPath is called by the device which approves the login.
+	ApprovalPath = BasePath + "/approval"
+
+	// StatusPath and CompletePath are called by the browser which initiated the login.
+	StatusPath   = BasePath + "/status"
+	CompletePath = BasePath + "/complete"
+
+	// ApprovalURLField is the name of the login form field which contains the URL the browser displays as a QR
+	// code.
+	ApprovalURLField = "approval_url"
+)
+
+var _ login.Strategy = new(Strategy)
+
+type dependencies interface {
+	errorx.ManagementProvider
+
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.FlowBinderProvider
+
+	identity.PrivilegedPoolProvider
+
+	session.ManagementProvider
+
+	login.HookExecutorProvider
+	login.RequestPersistenceProvider
+	login.HooksProvider
+	login.ErrorHandlerProvider
+}
+
+// Strategy implements login.Strategy. It signs a browser in once the login request was approved from another
+// device, usually a phone, on which the user is already signed in:
+//
+// 1. The login form contains the approval URL, which the login UI displays as a QR code. The URL points to the
+// approval UI and contains the login request ID and a code which is derived from the request ID.
+// 2. The approval UI fetches the request from ApprovalPath and lets the user approve or deny it.
+// 3. The browser polls StatusPath, or subscribes to it as a server-sent event stream, until the request was
+// approved and then submits the login form to CompletePath, which issues the session.
+type Strategy struct {
+	c configuration.Provider
+	d dependencies
+}
+
+// Configuration is the configuration of the strategy at `selfservice.strategies.cross_device.config`.
+type Configuration struct {
+	// ApprovalUI is the URL of the page which lets the user approve the login on the other device.
+	ApprovalUI string `json:"approval_ui"`
+}
+
+func NewStrategy(d dependencies, c configuration.Provider) *Strategy {
+	return &Strategy{c: c, d: d}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeCrossDevice
+}
+
+func (s *Strategy) LoginStrategyID() identity.CredentialsType {
+	return s.ID()
+}
+
+func (s *Strategy) RegisterLoginRoutes(r *x.RouterPublic) {
+	r.GET(ApprovalPath, s.fetchApproval)
+	r.POST(ApprovalPath, s.submitApproval)
+	r.GET(StatusPath, s.fetchStatus)
+	r.POST(CompletePath, s.complete)
+}
+
+func (s *Strategy) enabled() bool {
+	return s.c.SelfServiceStrategy(string(s.ID())).Enabled
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	var c Configuration
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(s.c.SelfServiceStrategy(string(s.ID())).Config)).
+		Decode(&c); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the cross-device login configuration: %s", err))
+	}
+
+	if len(c.ApprovalUI) == 0 {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The cross-device login requires an approval UI, see configuration key selfservice.strategies.%s.config.approval_ui.", s.ID()))
+	}
+	return &c, nil
+}
+
+func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Request) error {
+	if !s.enabled() {
+		return nil
+	}
+
+	f, err := s.loginForm(r, sr.ID)
+	if err != nil {
+		return err
+	}
+
+	sr.ApprovalState = login.ApprovalStatePending
+	sr.Methods[s.ID()] = &login.RequestMethod{
+		Method: s.ID(),
+		Config: &login.RequestMethodConfig{RequestMethodConfigurator: f},
+	}
+	return nil
+}
+
+// loginForm returns the form which the browser submits once the login was approved.
+func (s *Strategy) loginForm(r *http.Request, rid uuid.UUID) (*form.HTMLForm, error) {
+	approval, err := s.approvalURL(rid)
+	if err != nil {
+		return nil, err
+	}
+
+	f := form.NewHTMLForm(urlx.CopyWithQuery(
+		urlx.AppendPaths(s.c.SelfPublicURL(), CompletePath),
+		url.Values{"request": {rid.String()}},
+	).String())
+	f.SetField(form.Field{Name: ApprovalURLField, Type: "hidden", Value: approval})
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	return f, nil
+}
+
+func (s *Strategy) approvalURL(rid uuid.UUID) (string, error) {
+	c, err := s.Config()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(c.ApprovalUI)
+	if err != nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to parse the cross-device approval UI URL: %s", err))
+	}
+
+	return urlx.CopyWithQuery(u, url.Values{
+		"request": {rid.String()},
+		"code":    {s.code(rid)},
+	}).String(), nil
+}
+
+// code returns the code which proves that the approving device scanned the QR code. The request ID alone is not
+// enough because it appears in the URL of the login UI, while the code is only known to the browser which
+// initiated the request. The code is derived from the request ID so that it does not have to be stored.
+func (s *Strategy) code(rid uuid.UUID) string {
+	var key []byte
+	if secrets := s.c.SessionSecrets(); len(secrets) > 0 {
+		key = secrets[0]
+	}
+	return codeMAC(key, rid)
+}
+
+func (s *Strategy) verifyCode(rid uuid.UUID, code string) bool {
+	for _, key := range s.c.SessionSecrets() {
+		if hmac.Equal([]byte(code), []byte(codeMAC(key, rid))) {
+			return true
+		}
+	}
+	return false
+}
+
+func codeMAC(key []byte, rid uuid.UUID) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(strings.Join([]string{"cross_device", rid.String()}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// fetchLoginRequest returns the login request of the `request` query parameter if this strategy is enabled.
+func (s *Strategy) fetchLoginRequest(r *http.Request) (*login.Request, error) {
+	if !s.enabled() {
+		return nil, errors.WithStack(herodot.ErrNotFound.WithReason("The cross-device login is disabled."))
+	}
+
+	ar, err := login.FetchStrategyRequest(s.d, r, s.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ar.ApprovalState) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The login request does not support the cross-device login."))
+	}
+	return ar, nil
+}
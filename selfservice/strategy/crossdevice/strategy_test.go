@@ -0,0 +1,286 @@
+package crossdevice_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/strategy/crossdevice"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+func TestStrategy(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	router := x.NewRouterPublic()
+	reg.LoginStrategies().RegisterPublicRoutes(router)
+	router.GET("/mock-session", session.MockSetSession(t, reg))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	errTs, uiTs := errorx.NewErrorTestServer(t, reg), httptest.NewServer(login.TestRequestHandler(t, reg))
+	defer errTs.Close()
+	defer uiTs.Close()
+	returnTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := reg.SessionManager().FetchFromRequest(r.Context(), w, r)
+		require.NoError(t, err)
+		reg.Writer().Write(w, r, sess)
+	}))
+	defer returnTs.Close()
+	approvalTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer approvalTs.Close()
+
+	viper.Set(configuration.ViperKeyURLsError, errTs.URL+"/error-ts")
+	viper.Set(configuration.ViperKeyURLsLogin, uiTs.URL+"/login-ts")
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyURLsDefaultReturnTo, returnTs.URL+"/return-ts")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	viper.Set(configuration.ViperKeySecretsSession, []string{"not-a-secure-session-key"})
+	viper.Set(configuration.ViperKeySelfServiceLoginAfterConfig+"."+string(identity.CredentialsTypeCrossDevice), []map[string]interface{}{
+		{"job": "session"},
+		{"job": "redirect", "config": map[string]interface{}{"default_redirect_url": returnTs.URL + "/return-ts"}},
+	})
+
+	strategyKey := configuration.ViperKeySelfServiceStrategyConfig + "." + string(identity.CredentialsTypeCrossDevice)
+	strategy := reg.LoginStrategies().MustStrategy(identity.CredentialsTypeCrossDevice)
+
+	newLoginRequest := func(t *testing.T) (*login.Request, string) {
+		req := x.NewTestHTTPRequest(t, "GET", ts.URL+login.BrowserLoginPath, nil)
+		lr := login.NewLoginRequest(time.Minute, x.FakeCSRFToken, req)
+		require.NoError(t, strategy.PopulateLoginMethod(req, lr))
+		require.Contains(t, lr.Methods, identity.CredentialsTypeCrossDevice)
+
+		var approval string
+		for _, f := range lr.Methods[identity.CredentialsTypeCrossDevice].Config.RequestMethodConfigurator.(*form.HTMLForm).Fields {
+			if f.Name == crossdevice.ApprovalURLField {
+				approval = fmt.Sprintf("%s", f.Value)
+			}
+		}
+		require.True(t, strings.HasPrefix(approval, approvalTs.URL), "%s", approval)
+
+		require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+		return lr, urlx.ParseOrPanic(approval).Query().Get("code")
+	}
+
+	noRedirects := func(c *http.Client) *http.Client {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		return c
+	}
+
+	newPhone := func(t *testing.T) *http.Client {
+		c := session.MockCookieClient(t)
+		session.MockHydrateCookieClient(t, c, ts.URL+"/mock-session")
+		return noRedirects(c)
+	}
+
+	approvalURL := func(lr *login.Request, code string) string {
+		return ts.URL + crossdevice.ApprovalPath + "?" + url.Values{"request": {lr.ID.String()}, "code": {code}}.Encode()
+	}
+
+	fetchApproval := func(t *testing.T, c *http.Client, lr *login.Request, code string) (*http.Response, []byte) {
+		return x.EasyGet(t, c, approvalURL(lr, code))
+	}
+
+	submitApproval := func(t *testing.T, c *http.Client, lr *login.Request, code, action string) *http.Response {
+		res, err := c.PostForm(approvalURL(lr, code), url.Values{
+			crossdevice.ActionField: {action},
+			form.CSRFTokenName:      {x.FakeCSRFToken},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return res
+	}
+
+	fetchStatus := func(t *testing.T, lr *login.Request) (*http.Response, []byte) {
+		return x.EasyGet(t, new(http.Client), ts.URL+crossdevice.StatusPath+"?request="+lr.ID.String())
+	}
+
+	complete := func(t *testing.T, c *http.Client, lr *login.Request) (*http.Response, []byte) {
+		res, err := c.PostForm(ts.URL+crossdevice.CompletePath+"?request="+lr.ID.String(), url.Values{
+			form.CSRFTokenName: {x.FakeCSRFToken},
+		})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	t.Run("case=disabled", func(t *testing.T) {
+		req := x.NewTestHTTPRequest(t, "GET", ts.URL+login.BrowserLoginPath, nil)
+		lr := login.NewLoginRequest(time.Minute, x.FakeCSRFToken, req)
+		require.NoError(t, strategy.PopulateLoginMethod(req, lr))
+		assert.NotContains(t, lr.Methods, identity.CredentialsTypeCrossDevice)
+		assert.Empty(t, lr.ApprovalState)
+
+		res, _ := fetchStatus(t, lr)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	viper.Set(strategyKey, map[string]interface{}{
+		"enabled": true,
+		"config":  map[string]interface{}{"approval_ui": approvalTs.URL + "/approve"},
+	})
+
+	t.Run("case=approves the login", func(t *testing.T) {
+		lr, code := newLoginRequest(t)
+		phone := newPhone(t)
+
+		_, body := fetchStatus(t, lr)
+		assert.Equal(t, string(login.ApprovalStatePending), gjson.GetBytes(body, "state").String(), "%s", body)
+
+		res, body := fetchApproval(t, phone, lr, code)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, string(login.ApprovalStateScanned), gjson.GetBytes(body, "state").String(), "%s", body)
+		assert.Equal(t, lr.RequestURL, gjson.GetBytes(body, "request_url").String(), "%s", body)
+		assert.Equal(t, approvalURL(lr, code), gjson.GetBytes(body, "form.action").String(), "%s", body)
+
+		_, body = fetchStatus(t, lr)
+		assert.Equal(t, string(login.ApprovalStateScanned), gjson.GetBytes(body, "state").String(), "%s", body)
+
+		res, body = complete(t, new(http.Client), lr)
+		assert.Contains(t, res.Request.URL.String(), uiTs.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.cross_device.config.errors.0.message").String(), "not been approved", "%s", body)
+
+		res = submitApproval(t, phone, lr, code, crossdevice.ActionApprove)
+		require.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Contains(t, res.Header.Get("Location"), approvalTs.URL+"/approve?")
+
+		res = submitApproval(t, phone, lr, code, crossdevice.ActionDeny)
+		require.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Contains(t, res.Header.Get("Location"), errTs.URL)
+
+		browser := session.MockCookieClient(t)
+		res, body = complete(t, browser, lr)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Contains(t, res.Request.URL.String(), returnTs.URL, "%s", body)
+
+		actual, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), lr.ID)
+		require.NoError(t, err)
+		assert.Equal(t, login.ApprovalStateCompleted, actual.ApprovalState)
+		assert.Equal(t, actual.ApprovedIdentityID.UUID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+
+		res, body = complete(t, browser, lr)
+		assert.Contains(t, res.Request.URL.String(), uiTs.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.cross_device.config.errors.0.message").String(), "already completed", "%s", body)
+	})
+
+	t.Run("case=streams the approval state", func(t *testing.T) {
+		lr, code := newLoginRequest(t)
+		phone := newPhone(t)
+		res, _ := fetchApproval(t, phone, lr, code)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		req := x.NewTestHTTPRequest(t, "GET", ts.URL+crossdevice.StatusPath+"?request="+lr.ID.String(), nil)
+		req.Header.Set("Accept", "text/event-stream")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+		events := make(chan string)
+		go func() {
+			defer close(events)
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+					events <- gjson.Get(data, "state").String()
+				}
+			}
+		}()
+
+		next := func(t *testing.T) string {
+			select {
+			case e := <-events:
+				return e
+			case <-time.After(time.Second * 5):
+				t.Fatal("no event received")
+				return ""
+			}
+		}
+
+		assert.Equal(t, string(login.ApprovalStateScanned), next(t))
+		submitApproval(t, phone, lr, code, crossdevice.ActionApprove)
+		assert.Equal(t, string(login.ApprovalStateApproved), next(t))
+		assert.Empty(t, next(t), "the stream must end once the state is final")
+	})
+
+	t.Run("case=denies the login", func(t *testing.T) {
+		lr, code := newLoginRequest(t)
+		phone := newPhone(t)
+		fetchApproval(t, phone, lr, code)
+		res := submitApproval(t, phone, lr, code, crossdevice.ActionDeny)
+		require.Equal(t, http.StatusFound, res.StatusCode)
+
+		_, body := fetchStatus(t, lr)
+		assert.Equal(t, string(login.ApprovalStateDenied), gjson.GetBytes(body, "state").String(), "%s", body)
+
+		res, body = complete(t, session.MockCookieClient(t), lr)
+		assert.Contains(t, res.Request.URL.String(), uiTs.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.cross_device.config.errors.0.message").String(), "denied", "%s", body)
+	})
+
+	t.Run("case=requires the approval page to be opened", func(t *testing.T) {
+		lr, code := newLoginRequest(t)
+		res := submitApproval(t, newPhone(t), lr, code, crossdevice.ActionApprove)
+		require.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Contains(t, res.Header.Get("Location"), errTs.URL)
+	})
+
+	t.Run("case=rejects invalid codes", func(t *testing.T) {
+		lr, _ := newLoginRequest(t)
+		res, body := fetchApproval(t, newPhone(t), lr, "invalid")
+		assert.Equal(t, http.StatusForbidden, res.StatusCode, "%s", body)
+	})
+
+	t.Run("case=requires a session on the approving device", func(t *testing.T) {
+		lr, code := newLoginRequest(t)
+		res, body := fetchApproval(t, new(http.Client), lr, code)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "%s", body)
+	})
+
+	t.Run("case=only the initiating browser completes the login", func(t *testing.T) {
+		lr, code := newLoginRequest(t)
+		phone := newPhone(t)
+		fetchApproval(t, phone, lr, code)
+		submitApproval(t, phone, lr, code, crossdevice.ActionApprove)
+
+		reg.WithCSRFTokenGenerator(x.FakeCSRFTokenGeneratorWithToken("another-browser"))
+		defer reg.WithCSRFTokenGenerator(x.FakeCSRFTokenGenerator)
+
+		res, body := fetchStatus(t, lr)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode, "%s", body)
+
+		res, body = complete(t, session.MockCookieClient(t), lr)
+		assert.Contains(t, res.Request.URL.String(), errTs.URL, "%s", body)
+
+		actual, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), lr.ID)
+		require.NoError(t, err)
+		assert.Equal(t, login.ApprovalStateApproved, actual.ApprovalState)
+	})
+}
@@ -0,0 +1,65 @@
+package emailcode
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/randx"
+
+	"github.com/ory/kratos/x"
+)
+
+// Code is emailed to a verified address of the identity which is signing in. Only its keyed hash is stored, a six
+// digit code could otherwise be recovered from a plain hash in no time.
+type Code struct {
+	ID uuid.UUID `json:"-" faker:"uuid" db:"id"`
+
+	LoginRequestID uuid.UUID `json:"-" faker:"-" db:"selfservice_login_request_id"`
+
+	IdentityID uuid.UUID `json:"-" faker:"-" db:"identity_id"`
+
+	// Address is the email address the code was sent to.
+	Address string `json:"-" faker:"-" db:"address"`
+
+	// CodeHash is the HMAC of the code, see x.HashCode.
+	CodeHash string `json:"-" faker:"-" db:"code_hash"`
+
+	// Attempts is the number of times the code was entered.
+	Attempts int `json:"-" faker:"-" db:"attempts"`
+
+	Used bool `json:"-" faker:"-" db:"used"`
+
+	ExpiresAt time.Time `json:"-" faker:"time_type" db:"expires_at"`
+
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (c Code) TableName() string {
+	return "selfservice_login_email_codes"
+}
+
+// NewCode returns a code of length digits for the login request and the code itself, which is hashed with key.
+func NewCode(loginRequestID, identityID uuid.UUID, address string, length int, lifespan time.Duration, key []byte) (*Code, string, error) {
+	code, err := randx.RuneSequence(length, randx.Numeric)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	id := x.NewUUID()
+	return &Code{
+		ID:             id,
+		LoginRequestID: loginRequestID,
+		IdentityID:     identityID,
+		Address:        address,
+		CodeHash:       x.HashCode(key, id, string(code)),
+		ExpiresAt:      time.Now().UTC().Add(lifespan),
+	}, string(code), nil
+}
+
+// IsExpired returns true if the code can no longer be entered.
+func (c *Code) IsExpired() bool {
+	return !c.ExpiresAt.After(time.Now().UTC())
+}
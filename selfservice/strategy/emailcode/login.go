@@ -0,0 +1,172 @@
+package emailcode
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+func newInvalidCodeError(reason string) error {
+	return errors.WithStack(herodot.ErrBadRequest.
+		WithReason(reason).
+		WithDetail(errorx.DetailErrorID, form.ErrorIDLoginCodeInvalid))
+}
+
+// send emails another code, for example because the last one did not arrive or because the strategy is configured
+// as a fallback and no code was sent yet.
+func (s *Strategy) send(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	if err := login.CheckInitiator(s.d, r, ar); err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if last, err := s.d.LoginEmailCodePersister().GetLatestLoginEmailCode(r.Context(), ar.ID); err == nil {
+		if time.Since(last.CreatedAt) < resendInterval {
+			s.handleLoginError(w, r, ar, errors.WithStack(x.ErrTooManyRequests.WithReasonf("Please wait %.0f seconds before requesting another code.", (resendInterval-time.Since(last.CreatedAt)).Seconds())))
+			return
+		}
+	} else if errorsx.Cause(err) != sqlcon.ErrNoRows {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ar.SecondFactorIdentityID.UUID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if len(address(i)) == 0 {
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The identity has no verified email address.")))
+		return
+	}
+
+	f, err := s.sendCode(r, i, ar.ID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	method := &login.RequestMethod{
+		Method: s.ID(),
+		Config: &login.RequestMethodConfig{RequestMethodConfigurator: f},
+	}
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestMethod(r.Context(), ar.ID, s.ID(), method); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(s.c.MultiFactorURL(), url.Values{"request": {ar.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
+// verify checks the code which was sent last for the login request and completes the login. Every attempt is
+// counted before the code is compared, so that the code can not be guessed.
+func (s *Strategy) verify(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	// Otherwise, whoever knows the login request ID and the code could complete the login.
+	if err := login.CheckInitiator(s.d, r, ar); err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	code := strings.TrimSpace(r.PostForm.Get(CodeField))
+	if len(code) == 0 {
+		s.handleLoginError(w, r, ar, schema.NewRequiredError("#/", CodeField))
+		return
+	}
+
+	c, err := s.d.LoginEmailCodePersister().GetLatestLoginEmailCode(r.Context(), ar.ID)
+	if errorsx.Cause(err) == sqlcon.ErrNoRows {
+		s.handleLoginError(w, r, ar, newInvalidCodeError("No code was sent yet, please request one."))
+		return
+	} else if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if c.IdentityID != ar.SecondFactorIdentityID.UUID {
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The code was sent to another identity.")))
+		return
+	}
+
+	if err := s.d.LoginEmailCodePersister().UseLoginEmailCodeAttempt(r.Context(), c.ID, s.c.SelfServiceEmailCode().MaxAttempts); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		s.handleLoginError(w, r, ar, newInvalidCodeError("The code has expired or was entered incorrectly too often, please request a new one."))
+		return
+	} else if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if !hmac.Equal([]byte(x.HashCode(s.key(), c.ID, code)), []byte(c.CodeHash)) {
+		x.ContextLogger(r.Context(), s.d.Logger()).
+			WithField("identity_id", c.IdentityID).
+			WithField("login_request_id", c.LoginRequestID).
+			Info("An invalid login code was entered.")
+		s.handleLoginError(w, r, ar, newInvalidCodeError("The code is invalid."))
+		return
+	}
+
+	if err := s.d.LoginEmailCodePersister().MarkLoginEmailCodeUsed(r.Context(), c.ID); errorsx.Cause(err) == sqlcon.ErrNoRows {
+		s.handleLoginError(w, r, ar, newInvalidCodeError("The code was used already, please request a new one."))
+		return
+	} else if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ar.SecondFactorIdentityID.UUID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostSecondFactorHook(w, r, ar, i); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+}
@@ -0,0 +1,159 @@
+package emailcode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		LoginEmailCodePersister() Persister
+	}
+	Persister interface {
+		CreateLoginEmailCode(ctx context.Context, c *Code) error
+
+		// GetLatestLoginEmailCode returns the code which was sent last for the login request.
+		GetLatestLoginEmailCode(ctx context.Context, loginRequestID uuid.UUID) (*Code, error)
+
+		// CountLoginEmailCodes returns the number of codes which were sent since the given time. If identityID is
+		// not uuid.Nil, only the codes sent to that identity are counted.
+		CountLoginEmailCodes(ctx context.Context, identityID uuid.UUID, since time.Time) (int, error)
+
+		// UseLoginEmailCodeAttempt counts an attempt to enter the code. It returns sqlcon.ErrNoRows if the code
+		// was used, has expired, or was entered maxAttempts times already.
+		UseLoginEmailCodeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) error
+
+		// MarkLoginEmailCodeUsed marks the code as used. It returns sqlcon.ErrNoRows if it was used already.
+		MarkLoginEmailCodeUsed(ctx context.Context, id uuid.UUID) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	login.RequestPersister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		newIdentity := func(t *testing.T) *identity.Identity {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+			return &i
+		}
+
+		newLoginRequest := func(t *testing.T) *login.Request {
+			var r login.Request
+			require.NoError(t, faker.FakeData(&r))
+			require.NoError(t, p.CreateLoginRequest(context.Background(), &r))
+			return &r
+		}
+
+		key := []byte("0123456789abcdef")
+		i := newIdentity(t)
+
+		t.Run("case=should error when no code was sent", func(t *testing.T) {
+			_, err := p.GetLatestLoginEmailCode(context.Background(), x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
+
+		t.Run("case=should create and fetch the latest code", func(t *testing.T) {
+			r := newLoginRequest(t)
+
+			first, _, err := NewCode(r.ID, i.ID, "foo@ory.sh", 6, time.Hour, key)
+			require.NoError(t, err)
+			first.CreatedAt = time.Now().UTC().Add(-time.Minute)
+			require.NoError(t, p.CreateLoginEmailCode(context.Background(), first))
+
+			second, code, err := NewCode(r.ID, i.ID, "foo@ory.sh", 6, time.Hour, key)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateLoginEmailCode(context.Background(), second))
+			assert.Len(t, code, 6)
+
+			actual, err := p.GetLatestLoginEmailCode(context.Background(), r.ID)
+			require.NoError(t, err)
+			assert.Equal(t, second.ID, actual.ID)
+			assert.Equal(t, x.HashCode(key, second.ID, code), actual.CodeHash)
+			assert.Equal(t, "foo@ory.sh", actual.Address)
+			assert.Equal(t, 0, actual.Attempts)
+			assert.False(t, actual.Used)
+		})
+
+		t.Run("case=should count the codes sent since", func(t *testing.T) {
+			other := newIdentity(t)
+			since := time.Now().UTC().Add(-time.Minute)
+
+			before, err := p.CountLoginEmailCodes(context.Background(), uuid.Nil, since)
+			require.NoError(t, err)
+
+			old, _, err := NewCode(newLoginRequest(t).ID, other.ID, "bar@ory.sh", 6, time.Hour, key)
+			require.NoError(t, err)
+			old.CreatedAt = time.Now().UTC().Add(-time.Hour)
+			require.NoError(t, p.CreateLoginEmailCode(context.Background(), old))
+
+			for k := 0; k < 2; k++ {
+				c, _, err := NewCode(newLoginRequest(t).ID, other.ID, "bar@ory.sh", 6, time.Hour, key)
+				require.NoError(t, err)
+				require.NoError(t, p.CreateLoginEmailCode(context.Background(), c))
+			}
+
+			count, err := p.CountLoginEmailCodes(context.Background(), other.ID, since)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			count, err = p.CountLoginEmailCodes(context.Background(), uuid.Nil, since)
+			require.NoError(t, err)
+			assert.Equal(t, before+2, count)
+		})
+
+		t.Run("case=should limit the attempts", func(t *testing.T) {
+			c, _, err := NewCode(newLoginRequest(t).ID, i.ID, "foo@ory.sh", 6, time.Hour, key)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateLoginEmailCode(context.Background(), c))
+
+			require.NoError(t, p.UseLoginEmailCodeAttempt(context.Background(), c.ID, 2))
+			require.NoError(t, p.UseLoginEmailCodeAttempt(context.Background(), c.ID, 2))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UseLoginEmailCodeAttempt(context.Background(), c.ID, 2)))
+		})
+
+		t.Run("case=should only use a code once", func(t *testing.T) {
+			r := newLoginRequest(t)
+			c, _, err := NewCode(r.ID, i.ID, "foo@ory.sh", 6, time.Hour, key)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateLoginEmailCode(context.Background(), c))
+
+			require.NoError(t, p.MarkLoginEmailCodeUsed(context.Background(), c.ID))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.MarkLoginEmailCodeUsed(context.Background(), c.ID)))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UseLoginEmailCodeAttempt(context.Background(), c.ID, 5)))
+
+			actual, err := p.GetLatestLoginEmailCode(context.Background(), r.ID)
+			require.NoError(t, err)
+			assert.True(t, actual.Used)
+		})
+
+		t.Run("case=should not count attempts of expired codes", func(t *testing.T) {
+			c, _, err := NewCode(newLoginRequest(t).ID, i.ID, "foo@ory.sh", 6, -time.Minute, key)
+			require.NoError(t, err)
+			require.NoError(t, p.CreateLoginEmailCode(context.Background(), c))
+
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UseLoginEmailCodeAttempt(context.Background(), c.ID, 5)))
+		})
+	}
+}
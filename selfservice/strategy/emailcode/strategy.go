@@ -0,0 +1,252 @@
+package emailcode
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/courier"
+	templates "github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	BasePath = "/self-service/browser/flows/login/strategies/email-code"
+
+	// SendPath sends another code, VerifyPath checks the code and completes the login.
+	SendPath   = BasePath + "/send"
+	VerifyPath = BasePath + "/verify"
+
+	// CodeField is the name of the login form field which contains the code.
+	CodeField = "code"
+
+	// resendInterval is the time after which the browser may ask for another code.
+	resendInterval = 30 * time.Second
+)
+
+var (
+	_ login.SecondFactor         = new(Strategy)
+	_ login.FallbackSecondFactor = new(Strategy)
+)
+
+type dependencies interface {
+	errorx.ManagementProvider
+
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.FlowBinderProvider
+
+	identity.PrivilegedPoolProvider
+
+	courier.Provider
+
+	login.HookExecutorProvider
+	login.RequestPersistenceProvider
+	login.ErrorHandlerProvider
+
+	PersistenceProvider
+}
+
+// Strategy implements login.SecondFactor. Once the identity authenticated using a first factor, a numeric code is
+// emailed to one of its verified email addresses and the login completes once the code was entered at VerifyPath.
+//
+// If the strategy is configured as a fallback, the code is only offered to identities which set up another second
+// factor, and it is only sent once the user asks for it at SendPath.
+type Strategy struct {
+	c configuration.Provider
+	d dependencies
+}
+
+func NewStrategy(d dependencies, c configuration.Provider) *Strategy {
+	return &Strategy{c: c, d: d}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeEmailCode
+}
+
+func (s *Strategy) SecondFactorID() identity.CredentialsType {
+	return s.ID()
+}
+
+func (s *Strategy) RegisterSecondFactorRoutes(r *x.RouterPublic) {
+	r.POST(SendPath, s.send)
+	r.POST(VerifyPath, s.verify)
+}
+
+func (s *Strategy) enabled() bool {
+	return s.c.SelfServiceStrategy(string(s.ID())).Enabled
+}
+
+func (s *Strategy) IsFallbackOnly() bool {
+	return s.c.SelfServiceEmailCode().FallbackOnly
+}
+
+func (s *Strategy) IsEnrolled(i *identity.Identity) bool {
+	return s.enabled() && len(address(i)) > 0
+}
+
+// address returns the first verified email address of the identity.
+func address(i *identity.Identity) string {
+	for _, a := range i.Addresses {
+		if a.Via == identity.VerifiableAddressTypeEmail && a.Verified {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (s *Strategy) PopulateSecondFactorMethod(r *http.Request, i *identity.Identity, sr *login.Request) error {
+	f := s.sendForm(r, sr.ID)
+	if !s.IsFallbackOnly() {
+		var err error
+		if f, err = s.sendCode(r, i, sr.ID); err != nil {
+			return err
+		}
+	}
+
+	sr.Methods[s.ID()] = &login.RequestMethod{
+		Method: s.ID(),
+		Config: &login.RequestMethodConfig{RequestMethodConfigurator: f},
+	}
+	return nil
+}
+
+// sendCode emails a code to the identity and returns the form the code is entered in. If too many codes were sent
+// within the last hour, no code is sent and the form contains an error instead.
+func (s *Strategy) sendCode(r *http.Request, i *identity.Identity, rid uuid.UUID) (*form.HTMLForm, error) {
+	conf := s.c.SelfServiceEmailCode()
+	f := s.verifyForm(r, rid)
+
+	if limited, err := s.sendLimitReached(r, i.ID, conf); err != nil {
+		return nil, err
+	} else if limited {
+		x.ContextLogger(r.Context(), s.d.Logger()).
+			WithField("identity_id", i.ID).
+			Warn("Not sending a login code because the send limit was reached.")
+		f.AddError(&form.Error{ID: form.ErrorIDLoginCodeSendLimit, Message: "Too many codes were sent, please try again later."})
+		return f, nil
+	}
+
+	to := address(i)
+	c, code, err := NewCode(rid, i.ID, to, conf.Length, conf.Lifespan, s.key())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.d.LoginEmailCodePersister().CreateLoginEmailCode(r.Context(), c); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.d.Courier().QueueEmail(r.Context(), templates.NewLoginCode(s.c, &templates.LoginCodeModel{
+		To:               to,
+		Code:             code,
+		ExpiresInMinutes: int(conf.Lifespan.Minutes()),
+		Locale:           i18n.LocaleFromContext(r.Context()),
+	})); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// sendLimitReached returns true if the identity, or all identities together, were sent as many codes within the
+// last hour as they may be.
+func (s *Strategy) sendLimitReached(r *http.Request, identityID uuid.UUID, conf *configuration.EmailCodeConfig) (bool, error) {
+	since := time.Now().UTC().Add(-time.Hour)
+	for _, l := range []struct {
+		identityID uuid.UUID
+		max        int
+	}{
+		{identityID: identityID, max: conf.MaxSendsPerIdentity},
+		{identityID: uuid.Nil, max: conf.MaxSendsPerHour},
+	} {
+		if l.max <= 0 {
+			continue
+		}
+
+		count, err := s.d.LoginEmailCodePersister().CountLoginEmailCodes(r.Context(), l.identityID, since)
+		if err != nil {
+			return false, err
+		}
+
+		if count >= l.max {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// key returns the key the codes are hashed with. Like the session cookies, codes which were sent before the secret
+// was rotated become invalid.
+func (s *Strategy) key() []byte {
+	if secrets := s.c.SessionSecrets(); len(secrets) > 0 {
+		return secrets[0]
+	}
+	return nil
+}
+
+// sendForm returns the form which asks for a code to be sent.
+func (s *Strategy) sendForm(r *http.Request, rid uuid.UUID) *form.HTMLForm {
+	f := form.NewHTMLForm(s.requestURL(SendPath, rid))
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	return f
+}
+
+// verifyForm returns the form the code is entered in.
+func (s *Strategy) verifyForm(r *http.Request, rid uuid.UUID) *form.HTMLForm {
+	f := form.NewHTMLForm(s.requestURL(VerifyPath, rid))
+	f.SetField(form.Field{Name: CodeField, Type: "text", Required: true})
+	login.AddTrustDeviceField(s.c, f)
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	return f
+}
+
+func (s *Strategy) requestURL(path string, rid uuid.UUID) string {
+	return urlx.CopyWithQuery(
+		urlx.AppendPaths(s.c.SelfPublicURL(), path),
+		url.Values{"request": {rid.String()}},
+	).String()
+}
+
+// fetchLoginRequest returns the login request of the `request` query parameter if it waits for an email code.
+func (s *Strategy) fetchLoginRequest(r *http.Request) (*login.Request, error) {
+	if !s.enabled() {
+		return nil, errors.WithStack(herodot.ErrNotFound.WithReason("Login codes sent by email are disabled."))
+	}
+
+	ar, err := login.FetchStrategyRequest(s.d, r, s.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	if !ar.SecondFactorIdentityID.Valid {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The login request does not wait for a code sent by email."))
+	}
+	return ar, nil
+}
+
+func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, ar *login.Request, err error) {
+	if ar != nil {
+		if method, ok := ar.Methods[s.ID()]; ok {
+			method.Config.Reset()
+			method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+			ar.Methods[s.ID()] = method
+		}
+	}
+
+	s.d.LoginRequestErrorHandler().HandleLoginError(w, r, s.ID(), ar, err)
+}
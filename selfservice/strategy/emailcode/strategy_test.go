@@ -0,0 +1,319 @@
+package emailcode_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/strategy/emailcode"
+	"github.com/ory/kratos/selfservice/strategy/push"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+func TestStrategy(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	router := x.NewRouterPublic()
+	reg.LoginSecondFactors().RegisterPublicRoutes(router)
+	// The first factor is mocked, it only runs the login hooks for the identity of the query parameter.
+	router.POST("/first-factor", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ar, err := reg.LoginRequestPersister().GetLoginRequest(r.Context(), x.ParseUUID(r.URL.Query().Get("request")))
+		require.NoError(t, err)
+		i, err := reg.PrivilegedIdentityPool().GetIdentity(r.Context(), x.ParseUUID(r.URL.Query().Get("identity")))
+		require.NoError(t, err)
+		require.NoError(t, reg.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypePassword, reg.PostLoginHooks(identity.CredentialsTypePassword), ar, i))
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	errTs, uiTs := errorx.NewErrorTestServer(t, reg), httptest.NewServer(login.TestRequestHandler(t, reg))
+	defer errTs.Close()
+	defer uiTs.Close()
+	returnTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := reg.SessionManager().FetchFromRequest(r.Context(), w, r)
+		require.NoError(t, err)
+		reg.Writer().Write(w, r, sess)
+	}))
+	defer returnTs.Close()
+	webhookTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookTs.Close()
+
+	viper.Set(configuration.ViperKeyURLsError, errTs.URL+"/error-ts")
+	viper.Set(configuration.ViperKeyURLsLogin, uiTs.URL+"/login-ts")
+	viper.Set(configuration.ViperKeyURLsMFA, uiTs.URL+"/mfa-ts")
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyURLsDefaultReturnTo, returnTs.URL+"/return-ts")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceLoginAfterConfig+"."+string(identity.CredentialsTypePassword), []map[string]interface{}{
+		{"job": "session"},
+		{"job": "redirect", "config": map[string]interface{}{"default_redirect_url": returnTs.URL + "/return-ts"}},
+	})
+
+	strategyKey := configuration.ViperKeySelfServiceStrategyConfig + "." + string(identity.CredentialsTypeEmailCode)
+
+	newIdentity := func(t *testing.T, verified bool) *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		a, err := identity.NewVerifiableEmailAddress(x.NewUUID().String()+"@ory.sh", i.ID, time.Hour)
+		require.NoError(t, err)
+		if verified {
+			now := time.Now().UTC()
+			a.Verified, a.VerifiedAt, a.Status = true, &now, identity.VerifiableAddressStatusCompleted
+		}
+		i.Addresses = []identity.VerifiableAddress{*a}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i
+	}
+
+	noRedirects := func(c *http.Client) *http.Client {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		return c
+	}
+
+	// firstFactorIn authenticates the identity in the browser of the client using the mocked first factor and
+	// returns the login request.
+	firstFactorIn := func(t *testing.T, c *http.Client, i *identity.Identity) (*login.Request, *http.Response) {
+		req := x.NewTestHTTPRequest(t, "GET", ts.URL+login.BrowserLoginPath, nil)
+		lr := login.NewLoginRequest(time.Minute, x.FakeCSRFToken, req)
+		require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+
+		res, err := noRedirects(&http.Client{Jar: c.Jar}).PostForm(ts.URL+"/first-factor?"+url.Values{
+			"request":  {lr.ID.String()},
+			"identity": {i.ID.String()},
+		}.Encode(), url.Values{})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return lr, res
+	}
+
+	// firstFactor authenticates the identity in a new browser.
+	firstFactor := func(t *testing.T, i *identity.Identity) (*login.Request, *http.Response) {
+		return firstFactorIn(t, session.MockCookieClient(t), i)
+	}
+
+	// lastCode returns the code of the email which was sent last to the identity.
+	lastCode := func(t *testing.T, i *identity.Identity) string {
+		m, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, i.Addresses[0].Value, m.Recipient)
+		body, err := m.PlaintextBody(reg.Cipher())
+		require.NoError(t, err)
+		code := regexp.MustCompile(`\b[0-9]{6}\b`).FindString(body)
+		require.NotEmpty(t, code, "%s", body)
+		return code
+	}
+
+	postIn := func(t *testing.T, c *http.Client, path string, lr *login.Request, values url.Values) (*http.Response, []byte) {
+		values.Set(form.CSRFTokenName, x.FakeCSRFToken)
+		res, err := c.PostForm(ts.URL+path+"?request="+lr.ID.String(), values)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	post := func(t *testing.T, path string, lr *login.Request, code string) (*http.Response, []byte) {
+		return postIn(t, session.MockCookieClient(t), path, lr, url.Values{emailcode.CodeField: {code}})
+	}
+
+	t.Run("case=disabled", func(t *testing.T) {
+		_, res := firstFactor(t, newIdentity(t, true))
+		assert.Contains(t, res.Header.Get("Location"), returnTs.URL, "the session is issued without a second factor")
+	})
+
+	viper.Set(strategyKey+".enabled", true)
+
+	t.Run("case=does not require a code without a verified email address", func(t *testing.T) {
+		_, res := firstFactor(t, newIdentity(t, false))
+		assert.Contains(t, res.Header.Get("Location"), returnTs.URL)
+	})
+
+	t.Run("case=completes the login with the code", func(t *testing.T) {
+		i := newIdentity(t, true)
+		lr, res := firstFactor(t, i)
+		require.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Equal(t, uiTs.URL+"/mfa-ts?request="+lr.ID.String(), res.Header.Get("Location"))
+		code := lastCode(t, i)
+
+		res, body := post(t, emailcode.VerifyPath, lr, "invalid")
+		assert.Contains(t, res.Request.URL.String(), uiTs.URL+"/mfa-ts", "%s", body)
+		assert.Equal(t, form.ErrorIDLoginCodeInvalid, gjson.GetBytes(body, "methods.email_code.config.errors.0.id").String(), "%s", body)
+
+		res, body = post(t, emailcode.VerifyPath, lr, code)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Contains(t, res.Request.URL.String(), returnTs.URL, "%s", body)
+		assert.Equal(t, i.ID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+
+		res, body = post(t, emailcode.VerifyPath, lr, code)
+		assert.Equal(t, form.ErrorIDLoginCodeInvalid, gjson.GetBytes(body, "methods.email_code.config.errors.0.id").String(), "a code can only be used once: %s", body)
+	})
+
+	t.Run("case=rejects the code from another browser", func(t *testing.T) {
+		i := newIdentity(t, true)
+		req := x.NewTestHTTPRequest(t, "GET", ts.URL+login.BrowserLoginPath, nil)
+		lr := login.NewLoginRequest(time.Minute, x.FakeCSRFToken, req)
+		lr.Binding = "bound-to-another-browser"
+		require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+
+		res, err := noRedirects(session.MockCookieClient(t)).PostForm(ts.URL+"/first-factor?"+url.Values{
+			"request":  {lr.ID.String()},
+			"identity": {i.ID.String()},
+		}.Encode(), url.Values{})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		res, body := post(t, emailcode.VerifyPath, lr, lastCode(t, i))
+		assert.Contains(t, res.Request.URL.String(), errTs.URL+"/error-ts", "%s", body)
+		assert.Equal(t, x.FlowBindingErrorID, gjson.GetBytes(body, "0.details.error_id").String(), "%s", body)
+	})
+
+	t.Run("case=rejects the code after too many attempts", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceEmailCodeMaxAttempts, 2)
+		defer viper.Set(configuration.ViperKeySelfServiceEmailCodeMaxAttempts, nil)
+
+		i := newIdentity(t, true)
+		lr, _ := firstFactor(t, i)
+		code := lastCode(t, i)
+
+		for k := 0; k < 2; k++ {
+			post(t, emailcode.VerifyPath, lr, "invalid")
+		}
+
+		res, body := post(t, emailcode.VerifyPath, lr, code)
+		assert.Contains(t, res.Request.URL.String(), uiTs.URL+"/mfa-ts", "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.email_code.config.errors.0.message").String(), "too often", "%s", body)
+	})
+
+	t.Run("case=stops sending codes once the limit is reached", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceEmailCodeMaxSendsPerIdentity, 1)
+		defer viper.Set(configuration.ViperKeySelfServiceEmailCodeMaxSendsPerIdentity, nil)
+
+		i := newIdentity(t, true)
+		firstFactor(t, i)
+		code := lastCode(t, i)
+
+		lr, _ := firstFactor(t, i)
+		assert.Equal(t, code, lastCode(t, i), "no other code was sent")
+
+		actual, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), lr.ID)
+		require.NoError(t, err)
+		require.Contains(t, actual.Methods, identity.CredentialsTypeEmailCode)
+		errs := actual.Methods[identity.CredentialsTypeEmailCode].Config.RequestMethodConfigurator.(*form.HTMLForm).Errors
+		require.Len(t, errs, 1)
+		assert.Equal(t, form.ErrorIDLoginCodeSendLimit, errs[0].ID)
+	})
+
+	t.Run("case=is only offered next to another second factor as a fallback", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceEmailCodeFallbackOnly, true)
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePush), map[string]interface{}{
+			"enabled": true,
+			"config":  map[string]interface{}{"webhook": map[string]interface{}{"url": webhookTs.URL}},
+		})
+		defer viper.Set(configuration.ViperKeySelfServiceEmailCodeFallbackOnly, nil)
+		defer viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePush), nil)
+
+		_, res := firstFactor(t, newIdentity(t, true))
+		assert.Contains(t, res.Header.Get("Location"), returnTs.URL, "the identity did not set up another second factor")
+
+		i := newIdentity(t, true)
+		did := x.NewUUID()
+		co, err := json.Marshal(&push.CredentialsConfig{Devices: []push.Device{
+			{ID: did, Name: "Phone", Provider: push.ProviderWebhook, Token: "token", CreatedAt: time.Now().UTC()},
+		}})
+		require.NoError(t, err)
+		i.Credentials = map[identity.CredentialsType]identity.Credentials{
+			identity.CredentialsTypePush: {Type: identity.CredentialsTypePush, Identifiers: []string{did.String()}, Config: co},
+		}
+		require.NoError(t, reg.PrivilegedIdentityPool().UpdateIdentity(context.Background(), i))
+
+		lr, res := firstFactor(t, i)
+		assert.Equal(t, uiTs.URL+"/mfa-ts?request="+lr.ID.String(), res.Header.Get("Location"))
+
+		actual, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), lr.ID)
+		require.NoError(t, err)
+		assert.Len(t, actual.Methods, 2)
+		assert.Contains(t, actual.Methods, identity.CredentialsTypeEmailCode)
+
+		_, err = reg.LoginEmailCodePersister().GetLatestLoginEmailCode(context.Background(), lr.ID)
+		assert.Error(t, err, "the code is only sent once the user asks for it")
+
+		res, body := post(t, emailcode.SendPath, lr, "")
+		assert.Contains(t, res.Request.URL.String(), uiTs.URL+"/mfa-ts", "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.email_code.config.action").String(), emailcode.VerifyPath, "%s", body)
+
+		res, body = post(t, emailcode.VerifyPath, lr, lastCode(t, i))
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, i.ID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+	})
+
+	t.Run("case=does not ask for the code again in a trusted browser", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceLoginTrustedDevicesEnabled, true)
+		defer viper.Set(configuration.ViperKeySelfServiceLoginTrustedDevicesEnabled, nil)
+
+		i := newIdentity(t, true)
+		browser := session.MockCookieClient(t)
+
+		lr, res := firstFactorIn(t, browser, i)
+		assert.Equal(t, uiTs.URL+"/mfa-ts?request="+lr.ID.String(), res.Header.Get("Location"))
+
+		actual, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), lr.ID)
+		require.NoError(t, err)
+		var names []string
+		for _, f := range actual.Methods[identity.CredentialsTypeEmailCode].Config.RequestMethodConfigurator.(*form.HTMLForm).Fields {
+			names = append(names, f.Name)
+		}
+		assert.Contains(t, names, login.TrustDeviceField)
+
+		res, body := postIn(t, browser, emailcode.VerifyPath, lr, url.Values{
+			emailcode.CodeField:    {lastCode(t, i)},
+			login.TrustDeviceField: {"true"},
+		})
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+
+		ds, err := reg.SessionPersister().ListTrustedDevices(context.Background(), i.ID)
+		require.NoError(t, err)
+		require.Len(t, ds, 1)
+
+		_, res = firstFactorIn(t, browser, i)
+		assert.Contains(t, res.Header.Get("Location"), returnTs.URL, "the browser is trusted")
+
+		_, res = firstFactor(t, i)
+		assert.Contains(t, res.Header.Get("Location"), uiTs.URL+"/mfa-ts", "other browsers are not trusted")
+
+		i.Credentials = map[identity.CredentialsType]identity.Credentials{
+			identity.CredentialsTypePassword: {Type: identity.CredentialsTypePassword, Identifiers: []string{i.ID.String()}, Config: []byte(`{"hashed_password":"changed"}`)},
+		}
+		require.NoError(t, reg.PrivilegedIdentityPool().UpdateIdentity(context.Background(), i))
+
+		_, res = firstFactorIn(t, browser, i)
+		assert.Contains(t, res.Header.Get("Location"), uiTs.URL+"/mfa-ts", "the browser is no longer trusted once the credentials changed")
+
+		ds, err = reg.SessionPersister().ListTrustedDevices(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.Len(t, ds, 0)
+	})
+}
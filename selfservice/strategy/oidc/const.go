@@ -5,4 +5,12 @@ const (
 	sessionRequestID = "request_id"
 	sessionKeyState  = "state"
 	sessionFormState = "form"
+
+	sessionKeyCodeVerifier = "code_verifier"
+	sessionKeyNonce        = "nonce"
+
+	sessionLinkIdentity = "link_identity"
+	sessionLinkProvider = "link_provider"
+	sessionLinkSubject  = "link_subject"
+	sessionLinkCode     = "link_code"
 )
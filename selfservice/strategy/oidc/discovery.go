@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+// DiscoveryPath is the endpoint of home realm discovery. It expects the email address of the user and starts the
+// flow of the provider configured for the domain of the email address, or falls back to password login.
+const DiscoveryPath = BasePath + "/discover/:request"
+
+func (s *Strategy) discoveryURL(request uuid.UUID) string {
+	return urlx.AppendPaths(
+		urlx.Copy(s.c.SelfPublicURL()),
+		strings.Replace(DiscoveryPath, ":request", request.String(), 1),
+	).String()
+}
+
+// discoveryForm returns the form which asks for the email address used for home realm discovery.
+func (s *Strategy) discoveryForm(r *http.Request, request uuid.UUID) *form.HTMLForm {
+	f := form.NewHTMLForm(s.discoveryURL(request))
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.SetField(form.Field{Name: "email", Type: "email", Required: true})
+	return f
+}
+
+func (s *Strategy) handleDiscovery(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rid := x.ParseUUID(ps.ByName("request"))
+
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, rid, nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	ar, err := s.validateRequest(r.Context(), rid)
+	if err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	lr, ok := ar.(*login.Request)
+	if !ok {
+		s.handleError(w, r, rid, nil, errors.WithStack(herodot.ErrBadRequest.WithReason("Home realm discovery is only available for login requests.")))
+		return
+	}
+
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+	if email == "" {
+		s.handleError(w, r, rid, nil, schema.NewRequiredError("#/", "email"))
+		return
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		s.handleError(w, r, rid, nil, schema.NewInvalidFormatError("#/email", "email", email))
+		return
+	}
+	domain := email[at+1:]
+
+	conf, err := s.Config()
+	if err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	if c, ok := conf.ProviderForDomain(domain); ok {
+		provider, err := s.provider(c.ID)
+		if err != nil {
+			s.handleError(w, r, rid, nil, err)
+			return
+		}
+
+		s.redirectToProvider(w, r, lr, provider, "", oauth2.SetAuthURLParam("login_hint", email))
+		return
+	}
+
+	// Everyone else signs in using the password, with the identifier already filled in.
+	method, ok := lr.Methods[identity.CredentialsTypePassword]
+	if !ok {
+		s.handleError(w, r, rid, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`No sign in method is available for email addresses of domain "%s".`, domain)))
+		return
+	}
+
+	method.Config.SetValue("identifier", email)
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestMethod(r.Context(), lr.ID, identity.CredentialsTypePassword, method); err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	http.Redirect(w, r, urlx.CopyWithQuery(s.c.LoginURL(), url.Values{"request": {lr.ID.String()}}).String(), http.StatusFound)
+}
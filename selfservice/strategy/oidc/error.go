@@ -10,4 +10,8 @@ var (
 	ErrIDTokenMissing = herodot.ErrBadRequest.
 				WithError("authentication failed because id_token is missing").
 				WithReasonf(`Authentication failed because no id_token was returned. Please accept the "openid" permission and try again.`)
+
+	ErrTenantNotAllowed = herodot.ErrForbidden.
+				WithError("authentication failed because the tenant is not allowed").
+				WithReasonf(`Authentication failed because your organization is not allowed to sign in. Please sign in using a different account.`)
 )
@@ -0,0 +1,308 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/randx"
+	"github.com/ory/x/urlx"
+
+	templates "github.com/ory/kratos/courier/template"
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/strategy/password"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	LinkPath = BasePath + "/link/:request"
+
+	// linkCodeLength is the number of characters of the code which is sent to the address of the account
+	// that is being linked.
+	linkCodeLength = 8
+
+	// linkMaxAttempts is the number of times the password or code of an account can be entered to link it
+	// within linkAttemptWindow.
+	linkMaxAttempts   = 5
+	linkAttemptWindow = 15 * time.Minute
+)
+
+// findLinkableIdentity returns the identity which has verified the email address returned by the OpenID Provider.
+// It returns nil if no identity uses the email address, and a duplicate credentials error if an identity uses it
+// but can not be linked.
+//
+// The OpenID Provider and the existing identity must both have verified the email address. Otherwise anyone could
+// create an account at the provider using someone else's email address and take over their account here. Or they
+// could sign up here with someone else's email address first, and have that person's OpenID Connect login linked
+// to their account later.
+func (s *Strategy) findLinkableIdentity(ctx context.Context, claims *Claims) (*identity.Identity, error) {
+	if claims.Email == "" {
+		return nil, nil
+	}
+
+	isNotFound := func(err error) bool {
+		e, ok := errorsx.Cause(err).(interface{ StatusCode() int })
+		return ok && e.StatusCode() == http.StatusNotFound
+	}
+
+	email := strings.ToLower(claims.Email)
+	address, err := s.d.PrivilegedIdentityPool().FindAddressByValue(ctx, identity.VerifiableAddressTypeEmail, email)
+	if err == nil {
+		if !address.Verified || !claims.EmailVerified {
+			return nil, schema.NewDuplicateCredentialsError()
+		}
+		return s.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, address.IdentityID)
+	} else if !isNotFound(err) {
+		return nil, err
+	}
+
+	if _, _, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(ctx, identity.CredentialsTypePassword, email); err == nil {
+		return nil, schema.NewDuplicateCredentialsError()
+	} else if !isNotFound(err) {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// startLink begins the account linking sub-flow. The pending link is stored in the signed session cookie and a
+// code is sent to the email address. The registration request is then updated to show a form where the user
+// proves that they own the existing account, either by entering its password or the code.
+func (s *Strategy) startLink(w http.ResponseWriter, r *http.Request, a *registration.Request, i *identity.Identity, claims *Claims, provider Provider) {
+	code, err := randx.RuneSequence(linkCodeLength, randx.AlphaNum)
+	if err != nil {
+		s.handleError(w, r, a.GetID(), nil, errors.WithStack(err))
+		return
+	}
+
+	pid := provider.Config().ID
+	if err := x.SessionPersistValues(w, r, s.d.CookieManager(), sessionName, map[string]interface{}{
+		sessionRequestID:    a.ID.String(),
+		sessionLinkIdentity: i.ID.String(),
+		sessionLinkProvider: pid,
+		sessionLinkSubject:  claims.Subject,
+		sessionLinkCode:     s.linkCodeHash(a.ID, i.ID, pid, claims.Subject, string(code)),
+	}); err != nil {
+		s.handleError(w, r, a.GetID(), nil, err)
+		return
+	}
+
+	if _, err := s.d.Courier().QueueEmail(r.Context(), templates.NewLinkCode(s.c, &templates.LinkCodeModel{
+		To:       claims.Email,
+		Code:     string(code),
+		Provider: pid,
+		Locale:   i18n.LocaleFromContext(r.Context()),
+	})); err != nil {
+		s.handleError(w, r, a.GetID(), nil, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), s.d.Logger()).WithField("provider", pid).WithField("identity_id", i.ID).Debug("OpenID Connect sign up uses the email address of an existing identity, asking the user to link the accounts.")
+
+	method := s.linkMethod(r, a.ID, i)
+	method.Config.AddError(&form.Error{
+		ID:      form.ErrorIDAccountLinkRequired,
+		Message: "An account with this email address exists already. Enter its password or the code we sent to the address to link it.",
+		Context: map[string]interface{}{"email": claims.Email, "provider": pid},
+	})
+
+	if err := s.d.RegistrationRequestPersister().UpdateRegistrationRequest(r.Context(), a.ID, s.ID(), method); err != nil {
+		s.handleError(w, r, a.GetID(), nil, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(s.c.RegisterURL(), url.Values{"request": {a.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
+func (s *Strategy) handleLink(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rid := x.ParseUUID(ps.ByName("request"))
+
+	ar, err := s.validateRequest(r.Context(), rid)
+	if err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	rr, ok := ar.(*registration.Request)
+	if !ok || rid.String() != x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionRequestID, "") {
+		s.handleError(w, r, rid, nil, errors.WithStack(herodot.ErrBadRequest.WithReason("No account linking is in progress for this request. Please restart the flow.")))
+		return
+	}
+
+	var (
+		iid     = x.ParseUUID(x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionLinkIdentity, ""))
+		pid     = x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionLinkProvider, "")
+		subject = x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionLinkSubject, "")
+	)
+	if x.IsZeroUUID(iid) || pid == "" || subject == "" {
+		s.handleError(w, r, rid, nil, errors.WithStack(herodot.ErrBadRequest.WithReason("No account linking is in progress for this request. Please restart the flow.")))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, rid, nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), iid)
+	if err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	// Attempts are counted per identity, so that restarting the flow does not allow more guesses.
+	if !s.linkLimiter.Allow(i.ID.String()) {
+		s.handleError(w, r, rid, nil, errors.WithStack(x.ErrTooManyRequests.WithReason("Too many attempts to link the accounts were made, please try again later.")))
+		return
+	}
+
+	if err := s.verifyLink(r, rr.ID, i, pid, subject); err != nil {
+		rr.Methods[s.ID()] = s.linkMethod(r, rr.ID, i)
+		s.d.RegistrationRequestErrorHandler().HandleRegistrationError(w, r, s.ID(), rr, err)
+		return
+	}
+
+	if err := addCredentials(i, pid, subject); err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	if err := s.d.IdentityManager().Update(r.Context(), i); err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	if err := x.SessionPersistValues(w, r, s.d.CookieManager(), sessionName, map[string]interface{}{
+		sessionLinkIdentity: "",
+		sessionLinkProvider: "",
+		sessionLinkSubject:  "",
+		sessionLinkCode:     "",
+	}); err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	// The accounts are linked now, so signing in with the OpenID Provider again runs the login flow and its hooks.
+	x.ContextLogger(r.Context(), s.d.Logger()).WithField("provider", pid).WithField("identity_id", i.ID).Debug("Linked OpenID Connect credentials to an existing identity. Re-initializing login flow now.")
+	if err := s.d.LoginHandler().NewLoginRequest(w, r, func(aa *login.Request) (string, error) {
+		return s.authURL(aa.ID, pid), nil
+	}); err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+}
+
+// verifyLink checks that the user owns the identity which is being linked, either by the password of the
+// identity or by the code which was sent to its email address.
+func (s *Strategy) verifyLink(r *http.Request, rid uuid.UUID, i *identity.Identity, pid, subject string) error {
+	if p := r.PostForm.Get("password"); p != "" {
+		c, ok := i.GetCredentials(identity.CredentialsTypePassword)
+		if !ok {
+			return schema.NewInvalidCredentialsError()
+		}
+
+		var o password.CredentialsConfig
+		if err := json.NewDecoder(bytes.NewBuffer(c.Config)).Decode(&o); err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReason("The password credentials could not be decoded properly").WithDebug(err.Error()))
+		}
+
+		if err := s.d.PasswordHasher().Compare([]byte(p), []byte(o.HashedPassword)); err != nil {
+			return schema.NewInvalidCredentialsError()
+		}
+		return nil
+	}
+
+	if code := r.PostForm.Get("code"); code != "" {
+		expected := x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionLinkCode, "")
+		if expected == "" || !hmac.Equal([]byte(expected), []byte(s.linkCodeHash(rid, i.ID, pid, subject, code))) {
+			return schema.NewInvalidCredentialsError()
+		}
+		return nil
+	}
+
+	return schema.NewRequiredError("#/", "code")
+}
+
+// linkCodeHash returns the keyed hash of the code which is stored in the session cookie. The cookie is only signed,
+// so storing the code itself would reveal it. The hash is bound to the request and the accounts being linked.
+func (s *Strategy) linkCodeHash(rid, iid uuid.UUID, pid, subject, code string) string {
+	var key []byte
+	if secrets := s.c.SessionSecrets(); len(secrets) > 0 {
+		key = secrets[0]
+	}
+
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(strings.Join([]string{rid.String(), iid.String(), pid, subject, code}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Strategy) linkURL(request uuid.UUID) string {
+	return urlx.AppendPaths(
+		urlx.Copy(s.c.SelfPublicURL()),
+		strings.Replace(LinkPath, ":request", request.String(), 1),
+	).String()
+}
+
+func (s *Strategy) linkMethod(r *http.Request, request uuid.UUID, i *identity.Identity) *registration.RequestMethod {
+	f := form.NewHTMLForm(s.linkURL(request))
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	if _, ok := i.GetCredentials(identity.CredentialsTypePassword); ok {
+		f.SetField(form.Field{Name: "password", Type: "password"})
+	}
+	f.SetField(form.Field{Name: "code", Type: "text"})
+
+	return &registration.RequestMethod{
+		Method: s.ID(),
+		Config: &registration.RequestMethodConfig{RequestMethodConfigurator: NewRequestMethodConfig(f)},
+	}
+}
+
+// addCredentials adds the subject of the provider to the OpenID Connect credentials of the identity, keeping
+// the ones of other providers.
+func addCredentials(i *identity.Identity, provider, subject string) error {
+	var (
+		o           []CredentialsConfig
+		identifiers []string
+	)
+	if c, ok := i.GetCredentials(identity.CredentialsTypeOIDC); ok {
+		identifiers = c.Identifiers
+		if len(c.Config) > 0 {
+			if err := json.NewDecoder(bytes.NewBuffer(c.Config)).Decode(&o); err != nil {
+				return errors.WithStack(herodot.ErrInternalServerError.WithReason("The OpenID Connect credentials could not be decoded properly").WithDebug(err.Error()))
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(append(o, CredentialsConfig{Subject: subject, Provider: provider})); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode OpenID Connect options to JSON: %s", err))
+	}
+
+	i.SetCredentials(identity.CredentialsTypeOIDC, identity.Credentials{
+		Type:        identity.CredentialsTypeOIDC,
+		Identifiers: append(identifiers, uid(provider, subject)),
+		Config:      b.Bytes(),
+	})
+	return nil
+}
@@ -0,0 +1,53 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/fetcher"
+)
+
+// mapUserinfo maps the userinfo JSON returned by a provider to claims. If mapper is set, it is the URL of a Jsonnet
+// snippet which receives the userinfo as `std.extVar('userinfo')` and returns the claims, for example:
+//
+//	local user = std.extVar('userinfo');
+//	{
+//	  sub: std.toString(user.id),
+//	  email: user.email,
+//	  name: user.name,
+//	}
+//
+// Otherwise the userinfo is expected to contain the standard OpenID Connect claims.
+func mapUserinfo(ctx context.Context, mapper string, userinfo []byte) (*Claims, error) {
+	if len(mapper) > 0 {
+		snippet, err := fetcher.Default.Fetch(ctx, mapper)
+		if err != nil {
+			return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to load the Jsonnet mapper: %s", err))
+		}
+
+		vm := jsonnet.MakeVM()
+		vm.ExtCode("userinfo", string(userinfo))
+		evaluated, err := vm.EvaluateSnippet(mapper, string(snippet))
+		if err != nil {
+			return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to evaluate the Jsonnet mapper: %s", err))
+		}
+		userinfo = []byte(evaluated)
+	}
+
+	var claims Claims
+	if err := json.NewDecoder(bytes.NewReader(userinfo)).Decode(&claims); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the claims: %s", err))
+	}
+
+	if len(claims.Subject) == 0 {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason(`The claims do not contain a subject. If the provider's userinfo does not contain a "sub" field, configure a mapper_url which sets it.`))
+	}
+
+	return &claims, nil
+}
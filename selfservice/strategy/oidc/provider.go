@@ -2,8 +2,17 @@ package oidc
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
 
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/egress"
 )
 
 type Provider interface {
@@ -13,6 +22,18 @@ type Provider interface {
 	AuthCodeURLOptions(r request) []oauth2.AuthCodeOption
 }
 
+// TokenExchanger is implemented by providers whose token endpoint does not follow the OAuth2 specification, for
+// example because it expects extra parameters or responds with a non-standard content type. The query is the query
+// of the callback request.
+type TokenExchanger interface {
+	Exchange(ctx context.Context, query url.Values) (*oauth2.Token, error)
+}
+
+// QueryClaimsDecoder is implemented by providers which send claims along with the callback instead of the ID token.
+type QueryClaimsDecoder interface {
+	DecodeQuery(query url.Values, claims *Claims)
+}
+
 type Claims struct {
 	Issuer              string `json:"iss,omitempty"`
 	Subject             string `json:"sub,omitempty"`
@@ -35,4 +56,33 @@ type Claims struct {
 	PhoneNumber         string `json:"phone_number,omitempty"`
 	PhoneNumberVerified bool   `json:"phone_number_verified,omitempty"`
 	UpdatedAt           int64  `json:"updated_at,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`
+
+	// Groups contains the IDs of the groups the user is a member of, if the provider sends them.
+	Groups []string `json:"groups,omitempty"`
+}
+
+// outboundContext makes the OAuth2 and OpenID Connect clients send their requests through the egress transport,
+// which applies the outbound proxy and allow-list.
+func outboundContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: egress.Default})
+}
+
+// fetchJSON sends the request and decodes the JSON response into v. Unlike most clients it does not check the
+// content type, because several providers respond with JSON labeled as text/plain or text/html.
+func fetchJSON(ctx context.Context, req *http.Request, v interface{}) error {
+	res, err := oauth2.NewClient(ctx, nil).Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to send request to %s: %s", req.URL.Host, err))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Expected status code %d from %s but got %d.", http.StatusOK, req.URL.Host, res.StatusCode))
+	}
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxUserinfoSize)).Decode(v); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the response from %s: %s", req.URL.Host, err))
+	}
+	return nil
 }
@@ -0,0 +1,246 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+)
+
+// These are variables so that tests are able to replace them.
+var (
+	alipayAuthURL    = "https://openauth.alipay.com/oauth2/publicAppAuthorize.htm"
+	alipayGatewayURL = "https://openapi.alipay.com/gateway.do"
+)
+
+// alipayLocation is the time zone Alipay expects the timestamp of requests in.
+var alipayLocation = time.FixedZone("CST", 8*60*60)
+
+var (
+	_ Provider       = new(ProviderAlipay)
+	_ TokenExchanger = new(ProviderAlipay)
+)
+
+// ProviderAlipay implements Alipay (Alibaba) login. Alipay does not implement the OAuth2 token endpoint but an API
+// gateway which expects every request to be signed with the application's RSA private key. The `client_id` is the
+// Alipay app ID and the `client_secret` is the PEM encoded application private key.
+type ProviderAlipay struct {
+	config *Configuration
+	public *url.URL
+}
+
+func NewProviderAlipay(
+	config *Configuration,
+	public *url.URL,
+) *ProviderAlipay {
+	return &ProviderAlipay{
+		config: config,
+		public: public,
+	}
+}
+
+func (g *ProviderAlipay) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderAlipay) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	scope := g.config.Scope
+	if len(scope) == 0 {
+		scope = []string{"auth_user"}
+	}
+
+	return &oauth2.Config{
+		ClientID: g.config.ClientID,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  alipayAuthURL,
+			TokenURL: alipayGatewayURL,
+		},
+		Scopes:      scope,
+		RedirectURL: g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderAlipay) AuthCodeURLOptions(r request) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("app_id", g.config.ClientID),
+	}
+}
+
+type alipayError struct {
+	Code       string `json:"code"`
+	Message    string `json:"msg"`
+	SubCode    string `json:"sub_code"`
+	SubMessage string `json:"sub_msg"`
+}
+
+func (e *alipayError) err() error {
+	if e == nil || e.Code == "" || e.Code == "10000" {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Alipay responded with error %s (%s): %s %s", e.Code, e.SubCode, e.Message, e.SubMessage))
+}
+
+func (g *ProviderAlipay) Exchange(ctx context.Context, query url.Values) (*oauth2.Token, error) {
+	// Alipay sends the code as `auth_code`.
+	code := query.Get("auth_code")
+	if code == "" {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the auth_code query parameter.`))
+	}
+
+	var res struct {
+		Response *struct {
+			alipayError
+			UserID       string `json:"user_id"`
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresIn    int64  `json:"expires_in"`
+		} `json:"alipay_system_oauth_token_response"`
+		Error *alipayError `json:"error_response"`
+	}
+	if err := g.call(ctx, "alipay.system.oauth.token", url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {code},
+	}, &res); err != nil {
+		return nil, err
+	}
+
+	if err := res.Error.err(); err != nil {
+		return nil, err
+	}
+	if res.Response == nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Alipay did not return an access token."))
+	}
+	if err := res.Response.err(); err != nil {
+		return nil, err
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  res.Response.AccessToken,
+		RefreshToken: res.Response.RefreshToken,
+		TokenType:    "Bearer",
+	}
+	if res.Response.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(res.Response.ExpiresIn) * time.Second)
+	}
+
+	return token.WithExtra(map[string]interface{}{
+		"user_id": res.Response.UserID,
+	}), nil
+}
+
+func (g *ProviderAlipay) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	var res struct {
+		Response *struct {
+			alipayError
+			UserID   string `json:"user_id"`
+			NickName string `json:"nick_name"`
+			Avatar   string `json:"avatar"`
+		} `json:"alipay_user_info_share_response"`
+		Error *alipayError `json:"error_response"`
+	}
+	if err := g.call(ctx, "alipay.user.info.share", url.Values{
+		"auth_token": {exchange.AccessToken},
+	}, &res); err != nil {
+		return nil, err
+	}
+
+	if err := res.Error.err(); err != nil {
+		return nil, err
+	}
+	if res.Response == nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Alipay did not return the user."))
+	}
+	if err := res.Response.err(); err != nil {
+		return nil, err
+	}
+
+	subject := res.Response.UserID
+	if subject == "" {
+		subject, _ = exchange.Extra("user_id").(string)
+	}
+
+	return &Claims{
+		Issuer:   alipayGatewayURL,
+		Subject:  subject,
+		Name:     res.Response.NickName,
+		Nickname: res.Response.NickName,
+		Picture:  res.Response.Avatar,
+	}, nil
+}
+
+// call calls a method of the Alipay API gateway.
+func (g *ProviderAlipay) call(ctx context.Context, method string, params url.Values, v interface{}) error {
+	params.Set("app_id", g.config.ClientID)
+	params.Set("method", method)
+	params.Set("charset", "utf-8")
+	params.Set("sign_type", "RSA2")
+	params.Set("timestamp", time.Now().In(alipayLocation).Format("2006-01-02 15:04:05"))
+	params.Set("version", "1.0")
+
+	signature, err := g.sign(params)
+	if err != nil {
+		return err
+	}
+	params.Set("sign", signature)
+
+	req, err := http.NewRequest("POST", alipayGatewayURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=utf-8")
+
+	return fetchJSON(ctx, req, v)
+}
+
+// sign returns the RSA2 (SHA256 with RSA) signature of the parameters sorted by key.
+func (g *ProviderAlipay) sign(params url.Values) (string, error) {
+	block, _ := pem.Decode([]byte(g.config.ClientSecret))
+	if block == nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`The client secret of Alipay provider "%s" must be the PEM encoded application private key.`, g.config.ID))
+	}
+
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		key, _ = parsed.(*rsa.PrivateKey)
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`Unable to parse the private key of Alipay provider "%s": %s`, g.config.ID, err))
+	}
+	if key == nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`The private key of Alipay provider "%s" must be an RSA key.`, g.config.ID))
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "sign" && params.Get(k) != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + params.Get(k)
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,117 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+)
+
+func TestProviderAlipay(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	verify := func(t *testing.T, form url.Values) {
+		keys := make([]string, 0, len(form))
+		for k := range form {
+			if k != "sign" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + "=" + form.Get(k)
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(form.Get("sign"))
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		verify(t, r.PostForm)
+		assert.Equal(t, "2021000000000000", r.PostForm.Get("app_id"))
+		assert.Equal(t, "RSA2", r.PostForm.Get("sign_type"))
+
+		// Alipay labels its JSON responses as text/html.
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+		switch r.PostForm.Get("method") {
+		case "alipay.system.oauth.token":
+			if r.PostForm.Get("code") != "valid-code" {
+				_, _ = w.Write([]byte(`{"error_response":{"code":"40002","msg":"Invalid Arguments","sub_code":"isv.code-invalid","sub_msg":"invalid auth_code"},"sign":"signature"}`))
+				return
+			}
+			assert.Equal(t, "authorization_code", r.PostForm.Get("grant_type"))
+			_, _ = w.Write([]byte(`{"alipay_system_oauth_token_response":{"user_id":"2088000000000000","access_token":"access-token","expires_in":1296000,"refresh_token":"refresh-token","re_expires_in":2592000},"sign":"signature"}`))
+		case "alipay.user.info.share":
+			assert.Equal(t, "access-token", r.PostForm.Get("auth_token"))
+			_, _ = w.Write([]byte(`{"alipay_user_info_share_response":{"code":"10000","msg":"Success","user_id":"2088000000000000","nick_name":"Jane","avatar":"https://example.org/jane.png"},"sign":"signature"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	gatewayURL := alipayGatewayURL
+	alipayGatewayURL = ts.URL
+	defer func() {
+		alipayGatewayURL = gatewayURL
+	}()
+
+	public, err := url.Parse("https://ory.sh")
+	require.NoError(t, err)
+	p := NewProviderAlipay(&Configuration{
+		Provider:     "alipay",
+		ID:           "alipay",
+		ClientID:     "2021000000000000",
+		ClientSecret: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}, public)
+
+	t.Run("case=exchanges the auth code and fetches the user info", func(t *testing.T) {
+		token, err := p.Exchange(context.Background(), url.Values{"auth_code": {"valid-code"}})
+		require.NoError(t, err)
+		assert.Equal(t, "access-token", token.AccessToken)
+		assert.Equal(t, "refresh-token", token.RefreshToken)
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "2088000000000000", claims.Subject)
+		assert.Equal(t, "Jane", claims.Nickname)
+	})
+
+	t.Run("case=returns the alipay error", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), url.Values{"auth_code": {"invalid-code"}})
+		require.Error(t, err)
+		assert.Contains(t, errorsx.Cause(err).(*herodot.DefaultError).Reason(), "isv.code-invalid")
+	})
+
+	t.Run("case=requires the auth code", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), url.Values{"code": {"valid-code"}})
+		require.Error(t, err)
+	})
+
+	t.Run("case=fails without a private key", func(t *testing.T) {
+		p := NewProviderAlipay(&Configuration{Provider: "alipay", ID: "alipay", ClientID: "2021000000000000", ClientSecret: "secret"}, public)
+		_, err := p.Exchange(context.Background(), url.Values{"auth_code": {"valid-code"}})
+		require.Error(t, err)
+	})
+}
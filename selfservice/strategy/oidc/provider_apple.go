@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/stringslice"
+)
+
+const (
+	appleIssuerURL = "https://appleid.apple.com"
+
+	// appleClientSecretLifespan is how long a generated client secret is valid. Apple allows up to six months but
+	// a new secret is generated whenever one is needed.
+	appleClientSecretLifespan = 5 * time.Minute
+)
+
+var _ Provider = new(ProviderApple)
+
+// ProviderApple implements Sign in with Apple. Apple is an OpenID Connect provider, but it requires a client
+// secret which is a JWT signed by the developer's private key, posts the callback when the name or email is
+// requested, and sends the user's name only on the first authorization.
+type ProviderApple struct {
+	*ProviderGenericOIDC
+}
+
+func NewProviderApple(
+	config *Configuration,
+	public *url.URL,
+) *ProviderApple {
+	if config.IssuerURL == "" {
+		config.IssuerURL = appleIssuerURL
+	}
+
+	return &ProviderApple{
+		ProviderGenericOIDC: NewProviderGenericOIDC(config, public),
+	}
+}
+
+func (a *ProviderApple) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	c, err := a.ProviderGenericOIDC.OAuth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := a.newClientSecret(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	c.ClientSecret = secret
+	return c, nil
+}
+
+func (a *ProviderApple) AuthCodeURLOptions(r request) []oauth2.AuthCodeOption {
+	var options []oauth2.AuthCodeOption
+	if r.IsForced() {
+		options = append(options, oauth2.SetAuthURLParam("prompt", "login"))
+	}
+
+	// Apple requires the callback to be posted if the name or email is requested.
+	if stringslice.Has(a.config.Scope, "name") || stringslice.Has(a.config.Scope, "email") {
+		options = append(options, oauth2.SetAuthURLParam("response_mode", "form_post"))
+	}
+
+	return options
+}
+
+// appleBool decodes booleans which Apple sends as strings, for example `"email_verified": "true"`.
+type appleBool bool
+
+func (b *appleBool) UnmarshalJSON(raw []byte) error {
+	switch strings.Trim(string(raw), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return errors.Errorf("unable to decode %s as a boolean", raw)
+	}
+	return nil
+}
+
+func (a *ProviderApple) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	token, err := a.verifiedIDToken(ctx, exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		Issuer        string    `json:"iss"`
+		Subject       string    `json:"sub"`
+		Email         string    `json:"email"`
+		EmailVerified appleBool `json:"email_verified"`
+		Nonce         string    `json:"nonce"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
+	}
+
+	return &Claims{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Nonce:         claims.Nonce,
+	}, nil
+}
+
+// DecodeQuery adds the name from the `user` parameter which Apple sends along with the callback on the first
+// authorization only. The parameter is not signed, which is why the email address is always taken from the
+// ID token.
+func (a *ProviderApple) DecodeQuery(query url.Values, claims *Claims) {
+	var user struct {
+		Name struct {
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+		} `json:"name"`
+	}
+
+	if err := json.Unmarshal([]byte(query.Get("user")), &user); err != nil {
+		return
+	}
+
+	if claims.GivenName == "" {
+		claims.GivenName = user.Name.FirstName
+	}
+	if claims.FamilyName == "" {
+		claims.FamilyName = user.Name.LastName
+	}
+	if claims.Name == "" {
+		claims.Name = strings.TrimSpace(user.Name.FirstName + " " + user.Name.LastName)
+	}
+}
+
+// newClientSecret returns the client secret, which Apple expects to be a JWT signed with ES256 by the private key
+// of the developer account.
+func (a *ProviderApple) newClientSecret(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(a.config.ApplePrivateKey))
+	if block == nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`The private key of Apple provider "%s" is not PEM encoded.`, a.config.ID))
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`Unable to parse the private key of Apple provider "%s": %s`, a.config.ID, err))
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`The private key of Apple provider "%s" must be an ECDSA key using the P-256 curve.`, a.config.ID))
+	}
+
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": "ES256",
+		"kid": a.config.ApplePrivateKeyID,
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": a.config.AppleTeamID,
+		"iat": now.Unix(),
+		"exp": now.Add(appleClientSecretLifespan).Unix(),
+		"aud": appleIssuerURL,
+		"sub": a.config.ClientID,
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// JWS expects the signature to be the concatenation of R and S, each padded to 32 bytes.
+	signature := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(signature[32-len(rb):32], rb)
+	copy(signature[64-len(sb):], sb)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,132 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+func newTestProviderApple(t *testing.T, scope ...string) (*ProviderApple, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	public, err := url.Parse("https://ory.sh")
+	require.NoError(t, err)
+	return NewProviderApple(&Configuration{
+		Provider:          "apple",
+		ID:                "apple",
+		ClientID:          "com.example.app",
+		AppleTeamID:       "TEAMID1234",
+		ApplePrivateKeyID: "KEYID12345",
+		ApplePrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		Scope:             scope,
+	}, public), key
+}
+
+func TestProviderApple(t *testing.T) {
+	t.Run("case=defaults to the apple issuer", func(t *testing.T) {
+		p, _ := newTestProviderApple(t)
+		assert.Equal(t, "https://appleid.apple.com", p.Config().IssuerURL)
+	})
+
+	t.Run("case=generates a client secret signed by the private key", func(t *testing.T) {
+		p, key := newTestProviderApple(t)
+		now := time.Now()
+
+		secret, err := p.newClientSecret(now)
+		require.NoError(t, err)
+
+		parts := strings.Split(secret, ".")
+		require.Len(t, parts, 3)
+
+		decode := func(part string) map[string]interface{} {
+			raw, err := base64.RawURLEncoding.DecodeString(part)
+			require.NoError(t, err)
+			var v map[string]interface{}
+			require.NoError(t, json.Unmarshal(raw, &v))
+			return v
+		}
+
+		header := decode(parts[0])
+		assert.Equal(t, "ES256", header["alg"])
+		assert.Equal(t, "KEYID12345", header["kid"])
+
+		claims := decode(parts[1])
+		assert.Equal(t, "TEAMID1234", claims["iss"])
+		assert.Equal(t, "com.example.app", claims["sub"])
+		assert.Equal(t, "https://appleid.apple.com", claims["aud"])
+		assert.EqualValues(t, now.Unix(), claims["iat"])
+		assert.EqualValues(t, now.Add(appleClientSecretLifespan).Unix(), claims["exp"])
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		require.Len(t, signature, 64)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.True(t, ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])))
+	})
+
+	t.Run("case=fails on an invalid private key", func(t *testing.T) {
+		p, _ := newTestProviderApple(t)
+		p.config.ApplePrivateKey = "not-a-key"
+		_, err := p.newClientSecret(time.Now())
+		require.Error(t, err)
+	})
+
+	t.Run("case=posts the callback if the name or email is requested", func(t *testing.T) {
+		authCodeURL := func(p *ProviderApple) string {
+			c := &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://appleid.apple.com/auth/authorize"}}
+			return c.AuthCodeURL("state", p.AuthCodeURLOptions(&login.Request{ID: x.NewUUID()})...)
+		}
+
+		p, _ := newTestProviderApple(t, "name", "email")
+		assert.Contains(t, authCodeURL(p), "response_mode=form_post")
+
+		p, _ = newTestProviderApple(t)
+		assert.NotContains(t, authCodeURL(p), "response_mode")
+	})
+
+	t.Run("case=decodes the name sent on the first authorization", func(t *testing.T) {
+		p, _ := newTestProviderApple(t)
+
+		claims := &Claims{Subject: "apple-subject", Email: "verified@example.org"}
+		p.DecodeQuery(url.Values{"user": {`{"name":{"firstName":"Jane","lastName":"Doe"},"email":"spoofed@example.org"}`}}, claims)
+		assert.Equal(t, "Jane", claims.GivenName)
+		assert.Equal(t, "Doe", claims.FamilyName)
+		assert.Equal(t, "Jane Doe", claims.Name)
+		assert.Equal(t, "verified@example.org", claims.Email, "the email must only be taken from the ID token")
+
+		claims = &Claims{Subject: "apple-subject"}
+		p.DecodeQuery(url.Values{}, claims)
+		assert.Empty(t, claims.Name)
+	})
+
+	t.Run("case=decodes booleans sent as strings", func(t *testing.T) {
+		for raw, expected := range map[string]bool{`"true"`: true, `true`: true, `"false"`: false, `false`: false} {
+			var b appleBool
+			require.NoError(t, json.Unmarshal([]byte(raw), &b))
+			assert.Equal(t, expected, bool(b), raw)
+		}
+
+		var b appleBool
+		require.Error(t, json.Unmarshal([]byte(`"yes"`), &b))
+	})
+}
@@ -18,16 +18,25 @@ type Configuration struct {
 	// Provider is either "generic" for a generic OAuth 2.0 / OpenID Connect Provider or one of:
 	// - generic
 	// - google
+	// - github
+	// - gitlab
+	// - apple
+	// - microsoft
+	// - wechat
+	// - alipay
+	// - vk
 	Provider string `json:"provider"`
 
 	// ClientID is the application's RequestID.
 	ClientID string `json:"client_id"`
 
-	// ClientSecret is the application's secret.
+	// ClientSecret is the application's secret. If `provider` is set to `alipay`, it is the PEM encoded application
+	// private key.
 	ClientSecret string `json:"client_secret"`
 
 	// IssuerURL is the OpenID Connect Server URL. You can leave this empty if `provider` is not set to `generic`.
-	// If set, neither `auth_url` nor `token_url` are required.
+	// If set, neither `auth_url` nor `token_url` are required. If `provider` is set to `gitlab`, it is the URL of
+	// the GitLab instance and defaults to https://gitlab.com.
 	IssuerURL string `json:"issuer_url"`
 
 	// AuthURL is the authorize url, typically something like: https://example.org/oauth2/auth
@@ -40,9 +49,50 @@ type Configuration struct {
 	// `provider` is set to `generic`.
 	TokenURL string `json:"token_url"`
 
+	// UserinfoURL is the userinfo url, typically something like: https://example.org/api/user
+	// The claims are taken from it if `provider` is set to `generic` and `issuer_url` is not set, which is the
+	// case for OAuth2 servers which do not support OpenID Connect.
+	UserinfoURL string `json:"userinfo_url"`
+
+	// MapperURL is the URL of a Jsonnet snippet which maps the userinfo to the claims, for providers which take the
+	// claims from the userinfo url. It is not needed if the userinfo already contains OpenID Connect claims.
+	MapperURL string `json:"mapper_url"`
+
 	// Scope specifies optional requested permissions.
 	Scope []string `json:"scope"`
 
+	// AppleTeamID is the ID of the Apple Developer Team. It is required if `provider` is set to `apple`.
+	AppleTeamID string `json:"apple_team_id"`
+
+	// ApplePrivateKeyID is the ID of the private key which signs the client secret. It is required if `provider`
+	// is set to `apple`.
+	ApplePrivateKeyID string `json:"apple_private_key_id"`
+
+	// ApplePrivateKey is the PEM encoded private key (the contents of the .p8 file) which signs the client secret.
+	// It is required if `provider` is set to `apple`.
+	ApplePrivateKey string `json:"apple_private_key"`
+
+	// MicrosoftTenant is the Azure AD tenant users sign in with. It is either `common` (default), `organizations`,
+	// `consumers`, or the ID or domain of a tenant. Only used if `provider` is set to `microsoft`.
+	MicrosoftTenant string `json:"microsoft_tenant"`
+
+	// MicrosoftAllowedTenants restricts sign in to users of these tenant IDs. All tenants are allowed if it is empty.
+	// Only used if `provider` is set to `microsoft`.
+	MicrosoftAllowedTenants []string `json:"microsoft_allowed_tenants"`
+
+	// PKCE configures whether the authorization code is protected using PKCE (S256). It is either `auto` (default),
+	// which uses PKCE if the provider supports it, `force`, or `never`.
+	PKCE string `json:"pkce"`
+
+	// Nonce configures whether a nonce is sent along with the authorization request and compared to the nonce of
+	// the ID token. It is either `auto` (default), which uses a nonce if the provider issues ID tokens, `force`, or
+	// `never`.
+	Nonce string `json:"nonce"`
+
+	// Domains are the email domains of users who sign in using this provider. If set, users who enter an email
+	// address of one of these domains in the home realm discovery form of the login flow are sent to this provider.
+	Domains []string `json:"domains"`
+
 	SchemaURL string `json:"schema_url"`
 }
 
@@ -61,14 +111,51 @@ func (c ConfigurationCollection) Provider(id string, public *url.URL) (Provider,
 		if p.ID == id {
 			switch p.Provider {
 			case "generic":
+				if p.IssuerURL == "" {
+					return NewProviderGenericOAuth2(&p, public), nil
+				}
 				return NewProviderGenericOIDC(&p, public), nil
 			case "google":
 				return NewProviderGoogle(&p, public), nil
 			case "github":
 				return NewProviderGitHub(&p, public), nil
+			case "gitlab":
+				return NewProviderGitLab(&p, public), nil
+			case "apple":
+				return NewProviderApple(&p, public), nil
+			case "microsoft":
+				return NewProviderMicrosoft(&p, public), nil
+			case "wechat":
+				return NewProviderWeChat(&p, public), nil
+			case "alipay":
+				return NewProviderAlipay(&p, public), nil
+			case "vk":
+				return NewProviderVK(&p, public), nil
 			}
-			return nil, errors.Errorf("provider type %s is not supported, supported are: %v", p.Provider, []string{"google"})
+			return nil, errors.Errorf("provider type %s is not supported, supported are: %v", p.Provider, []string{"generic", "google", "github", "gitlab", "apple", "microsoft", "wechat", "alipay", "vk"})
 		}
 	}
 	return nil, errors.WithStack(herodot.ErrNotFound.WithReasonf(`OpenID Connect Provider "%s" is unknown or has not been configured`, id))
 }
+
+// ProviderForDomain returns the configuration of the provider users of the email domain sign in with, if any.
+func (c ConfigurationCollection) ProviderForDomain(domain string) (Configuration, bool) {
+	for _, p := range c.Providers {
+		for _, d := range p.Domains {
+			if strings.EqualFold(d, domain) {
+				return p, true
+			}
+		}
+	}
+	return Configuration{}, false
+}
+
+// HasDomains returns true if at least one provider is configured for an email domain.
+func (c ConfigurationCollection) HasDomains() bool {
+	for _, p := range c.Providers {
+		if len(p.Domains) > 0 {
+			return true
+		}
+	}
+	return false
+}
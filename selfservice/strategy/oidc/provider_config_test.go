@@ -27,3 +27,20 @@ func TestConfig(t *testing.T) {
 	require.Len(t, collection.Providers, 1)
 	assert.Equal(t, "generic", collection.Providers[0].Provider)
 }
+
+func TestProviderForDomain(t *testing.T) {
+	collection := oidc.ConfigurationCollection{Providers: []oidc.Configuration{
+		{ID: "corp", Provider: "microsoft", Domains: []string{"example.org", "example.net"}},
+		{ID: "social", Provider: "google"},
+	}}
+	assert.True(t, collection.HasDomains())
+
+	p, ok := collection.ProviderForDomain("EXAMPLE.net")
+	require.True(t, ok)
+	assert.Equal(t, "corp", p.ID)
+
+	_, ok = collection.ProviderForDomain("example.com")
+	assert.False(t, ok)
+
+	assert.False(t, oidc.ConfigurationCollection{Providers: collection.Providers[1:]}.HasDomains())
+}
@@ -0,0 +1,87 @@
+package oidc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+)
+
+// maxUserinfoSize limits the size of userinfo responses.
+const maxUserinfoSize = 1 << 20
+
+var _ Provider = new(ProviderGenericOAuth2)
+
+// ProviderGenericOAuth2 implements OAuth2 providers which do not support OpenID Connect. Instead of an ID token,
+// the claims are taken from the userinfo endpoint, optionally mapped using a Jsonnet snippet.
+type ProviderGenericOAuth2 struct {
+	config *Configuration
+	public *url.URL
+}
+
+func NewProviderGenericOAuth2(
+	config *Configuration,
+	public *url.URL,
+) *ProviderGenericOAuth2 {
+	return &ProviderGenericOAuth2{
+		config: config,
+		public: public,
+	}
+}
+
+func (g *ProviderGenericOAuth2) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderGenericOAuth2) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  g.config.AuthURL,
+			TokenURL: g.config.TokenURL,
+		},
+		Scopes:      g.config.Scope,
+		RedirectURL: g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderGenericOAuth2) AuthCodeURLOptions(r request) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{}
+}
+
+func (g *ProviderGenericOAuth2) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	conf, err := g.OAuth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", g.config.UserinfoURL, nil)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to create the userinfo request: %s", err))
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := conf.Client(ctx, exchange).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to fetch the userinfo: %s", err))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to fetch the userinfo because the provider responded with status code %d.", res.StatusCode))
+	}
+
+	userinfo, err := ioutil.ReadAll(io.LimitReader(res.Body, maxUserinfoSize))
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to read the userinfo: %s", err))
+	}
+
+	return mapUserinfo(ctx, g.config.MapperURL, userinfo)
+}
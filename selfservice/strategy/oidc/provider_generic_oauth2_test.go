@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestProviderGenericOAuth2(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/user":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":    1234,
+				"login": "jane",
+				"name":  "Jane Doe",
+				"mail":  "jane@example.org",
+			})
+		case "/oauth/userinfo":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"sub":            "5678",
+				"nickname":       "jane",
+				"email":          "jane@example.org",
+				"email_verified": true,
+				"groups":         []string{"ory", "ory/kratos"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	public, err := url.Parse("https://ory.sh")
+	require.NoError(t, err)
+	token := &oauth2.Token{AccessToken: "access-token", TokenType: "Bearer"}
+
+	mapper := "base64://" + base64.StdEncoding.EncodeToString([]byte(`local user = std.extVar('userinfo');
+{
+  sub: std.toString(user.id),
+  preferred_username: user.login,
+  name: user.name,
+  email: user.mail,
+}`))
+
+	newProvider := func(c Configuration) Provider {
+		c.ID, c.ClientID, c.ClientSecret = "oauth2", "client", "secret"
+		p, err := ConfigurationCollection{Providers: []Configuration{c}}.Provider("oauth2", public)
+		require.NoError(t, err)
+		return p
+	}
+
+	t.Run("case=maps the userinfo using jsonnet", func(t *testing.T) {
+		p := newProvider(Configuration{
+			Provider:    "generic",
+			AuthURL:     ts.URL + "/oauth/authorize",
+			TokenURL:    ts.URL + "/oauth/token",
+			UserinfoURL: ts.URL + "/api/user",
+			MapperURL:   mapper,
+		})
+		require.IsType(t, new(ProviderGenericOAuth2), p)
+
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+"/oauth/authorize", c.Endpoint.AuthURL)
+		assert.Equal(t, ts.URL+"/oauth/token", c.Endpoint.TokenURL)
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "1234", claims.Subject)
+		assert.Equal(t, "jane", claims.PreferredUsername)
+		assert.Equal(t, "Jane Doe", claims.Name)
+		assert.Equal(t, "jane@example.org", claims.Email)
+		assert.False(t, claims.EmailVerified)
+	})
+
+	t.Run("case=fails without a subject", func(t *testing.T) {
+		p := newProvider(Configuration{
+			Provider:    "generic",
+			AuthURL:     ts.URL + "/oauth/authorize",
+			TokenURL:    ts.URL + "/oauth/token",
+			UserinfoURL: ts.URL + "/api/user",
+		})
+
+		_, err := p.Claims(context.Background(), token)
+		require.Error(t, err)
+	})
+
+	t.Run("case=fails on an invalid mapper", func(t *testing.T) {
+		p := newProvider(Configuration{
+			Provider:    "generic",
+			AuthURL:     ts.URL + "/oauth/authorize",
+			TokenURL:    ts.URL + "/oauth/token",
+			UserinfoURL: ts.URL + "/api/user",
+			MapperURL:   "base64://" + base64.StdEncoding.EncodeToString([]byte(`{ sub: std.extVar('userinfo').does_not_exist }`)),
+		})
+
+		_, err := p.Claims(context.Background(), token)
+		require.Error(t, err)
+	})
+
+	t.Run("case=fails if the userinfo request is rejected", func(t *testing.T) {
+		p := newProvider(Configuration{
+			Provider:    "generic",
+			AuthURL:     ts.URL + "/oauth/authorize",
+			TokenURL:    ts.URL + "/oauth/token",
+			UserinfoURL: ts.URL + "/api/user",
+			MapperURL:   mapper,
+		})
+
+		_, err := p.Claims(context.Background(), &oauth2.Token{AccessToken: "invalid", TokenType: "Bearer"})
+		require.Error(t, err)
+	})
+
+	t.Run("case=gitlab uses the userinfo of the instance", func(t *testing.T) {
+		p := newProvider(Configuration{
+			Provider:  "gitlab",
+			IssuerURL: ts.URL,
+		})
+		require.IsType(t, new(ProviderGitLab), p)
+
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+"/oauth/authorize", c.Endpoint.AuthURL)
+		assert.Equal(t, ts.URL+"/oauth/token", c.Endpoint.TokenURL)
+		assert.Contains(t, c.Scopes, "openid")
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "5678", claims.Subject)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, []string{"ory", "ory/kratos"}, claims.Groups)
+	})
+
+	t.Run("case=gitlab defaults to gitlab.com", func(t *testing.T) {
+		c, err := newProvider(Configuration{Provider: "gitlab"}).OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "https://gitlab.com/oauth/authorize", c.Endpoint.AuthURL)
+	})
+}
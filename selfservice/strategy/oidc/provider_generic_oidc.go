@@ -37,7 +37,7 @@ func (g *ProviderGenericOIDC) Config() *Configuration {
 
 func (g *ProviderGenericOIDC) provider(ctx context.Context) (*gooidc.Provider, error) {
 	if g.p == nil {
-		p, err := gooidc.NewProvider(context.Background(), g.config.IssuerURL)
+		p, err := gooidc.NewProvider(outboundContext(context.Background()), g.config.IssuerURL)
 		if err != nil {
 			return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to initialize OpenID Connect Provider: %s", err))
 		}
@@ -77,7 +77,28 @@ func (g *ProviderGenericOIDC) AuthCodeURLOptions(r request) []oauth2.AuthCodeOpt
 	return []oauth2.AuthCodeOption{}
 }
 
-func (g *ProviderGenericOIDC) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+func (g *ProviderGenericOIDC) SupportsPKCE(ctx context.Context) bool {
+	p, err := g.provider(ctx)
+	if err != nil {
+		return false
+	}
+
+	var discovery struct {
+		CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+	}
+	if err := p.Claims(&discovery); err != nil {
+		return false
+	}
+
+	return stringslice.Has(discovery.CodeChallengeMethodsSupported, "S256")
+}
+
+func (g *ProviderGenericOIDC) SupportsNonce() bool {
+	return true
+}
+
+// verifiedIDToken returns the ID token of the exchange after verifying its signature, issuer, and audience.
+func (g *ProviderGenericOIDC) verifiedIDToken(ctx context.Context, exchange *oauth2.Token) (*gooidc.IDToken, error) {
 	raw, ok := exchange.Extra("id_token").(string)
 	if !ok || len(raw) == 0 {
 		return nil, errors.WithStack(ErrIDTokenMissing)
@@ -97,6 +118,15 @@ func (g *ProviderGenericOIDC) Claims(ctx context.Context, exchange *oauth2.Token
 		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
 	}
 
+	return token, nil
+}
+
+func (g *ProviderGenericOIDC) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	token, err := g.verifiedIDToken(ctx, exchange)
+	if err != nil {
+		return nil, err
+	}
+
 	var claims Claims
 	if err := token.Claims(&claims); err != nil {
 		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
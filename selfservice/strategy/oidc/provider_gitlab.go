@@ -0,0 +1,60 @@
+package oidc
+
+import (
+	"context"
+	"net/url"
+
+	"golang.org/x/oauth2"
+
+	"github.com/ory/x/stringslice"
+	"github.com/ory/x/urlx"
+
+	gooidc "github.com/coreos/go-oidc"
+)
+
+const gitlabURL = "https://gitlab.com"
+
+var _ Provider = new(ProviderGitLab)
+
+// ProviderGitLab implements GitLab.com and self-managed GitLab instances. Set `issuer_url` to the URL of the
+// instance if it is self-managed. The claims are taken from the userinfo endpoint, which includes the groups.
+type ProviderGitLab struct {
+	*ProviderGenericOAuth2
+}
+
+func NewProviderGitLab(
+	config *Configuration,
+	public *url.URL,
+) *ProviderGitLab {
+	if config.IssuerURL == "" {
+		config.IssuerURL = gitlabURL
+	}
+
+	base := urlx.ParseOrPanic(config.IssuerURL)
+	config.AuthURL = urlx.AppendPaths(base, "/oauth/authorize").String()
+	config.TokenURL = urlx.AppendPaths(base, "/oauth/token").String()
+	if config.UserinfoURL == "" {
+		config.UserinfoURL = urlx.AppendPaths(base, "/oauth/userinfo").String()
+	}
+
+	return &ProviderGitLab{
+		ProviderGenericOAuth2: NewProviderGenericOAuth2(config, public),
+	}
+}
+
+func (g *ProviderGitLab) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	c, err := g.ProviderGenericOAuth2.OAuth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The userinfo endpoint requires the openid scope.
+	if !stringslice.Has(c.Scopes, gooidc.ScopeOpenID) {
+		c.Scopes = append(c.Scopes, gooidc.ScopeOpenID)
+	}
+	return c, nil
+}
+
+func (g *ProviderGitLab) SupportsPKCE(ctx context.Context) bool {
+	return true
+}
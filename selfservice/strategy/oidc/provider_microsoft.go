@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/stringslice"
+	"github.com/ory/x/urlx"
+
+	gooidc "github.com/coreos/go-oidc"
+)
+
+// These are variables so that tests are able to replace them.
+var (
+	microsoftLoginURL = "https://login.microsoftonline.com"
+	microsoftGraphURL = "https://graph.microsoft.com"
+)
+
+var _ Provider = new(ProviderMicrosoft)
+
+// ProviderMicrosoft implements Microsoft Azure AD (Microsoft identity platform v2.0). Because the `common` and
+// `organizations` endpoints accept users of any tenant, the ID token is verified against the issuer of the tenant
+// which signed it, and the tenant is checked against `microsoft_allowed_tenants`.
+type ProviderMicrosoft struct {
+	config *Configuration
+	public *url.URL
+}
+
+func NewProviderMicrosoft(
+	config *Configuration,
+	public *url.URL,
+) *ProviderMicrosoft {
+	if config.MicrosoftTenant == "" {
+		config.MicrosoftTenant = "common"
+	}
+
+	return &ProviderMicrosoft{
+		config: config,
+		public: public,
+	}
+}
+
+func (m *ProviderMicrosoft) Config() *Configuration {
+	return m.config
+}
+
+func (m *ProviderMicrosoft) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	scope := m.config.Scope
+	if !stringslice.Has(scope, gooidc.ScopeOpenID) {
+		scope = append(scope, gooidc.ScopeOpenID)
+	}
+
+	prefix := urlx.AppendPaths(urlx.ParseOrPanic(microsoftLoginURL), m.config.MicrosoftTenant).String()
+	return &oauth2.Config{
+		ClientID:     m.config.ClientID,
+		ClientSecret: m.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  prefix + "/oauth2/v2.0/authorize",
+			TokenURL: prefix + "/oauth2/v2.0/token",
+		},
+		Scopes:      scope,
+		RedirectURL: m.config.Redir(m.public),
+	}, nil
+}
+
+func (m *ProviderMicrosoft) AuthCodeURLOptions(r request) []oauth2.AuthCodeOption {
+	if r.IsForced() {
+		return []oauth2.AuthCodeOption{
+			oauth2.SetAuthURLParam("prompt", "login"),
+		}
+	}
+	return []oauth2.AuthCodeOption{}
+}
+
+func (m *ProviderMicrosoft) SupportsPKCE(ctx context.Context) bool {
+	return true
+}
+
+func (m *ProviderMicrosoft) SupportsNonce() bool {
+	return true
+}
+
+type microsoftClaims struct {
+	Claims
+	TenantID string `json:"tid"`
+
+	// ClaimNames is set instead of the groups claim if the user is a member of too many groups to fit them into
+	// the token.
+	ClaimNames map[string]string `json:"_claim_names"`
+}
+
+func (m *ProviderMicrosoft) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	raw, ok := exchange.Extra("id_token").(string)
+	if !ok || len(raw) == 0 {
+		return nil, errors.WithStack(ErrIDTokenMissing)
+	}
+
+	// The tenant is read from the unverified token only to find the issuer the token is then verified against.
+	tenant, err := m.unverifiedTenantID(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := gooidc.NewProvider(ctx, urlx.AppendPaths(urlx.ParseOrPanic(microsoftLoginURL), tenant, "v2.0").String())
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to initialize OpenID Connect Provider: %s", err))
+	}
+
+	token, err := p.Verifier(&gooidc.Config{ClientID: m.config.ClientID}).Verify(ctx, raw)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
+	}
+
+	var claims microsoftClaims
+	if err := token.Claims(&claims); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
+	}
+
+	if len(m.config.MicrosoftAllowedTenants) > 0 && !stringslice.Has(m.config.MicrosoftAllowedTenants, claims.TenantID) {
+		return nil, errors.WithStack(ErrTenantNotAllowed.WithDebugf(`Tenant "%s" is not in the list of allowed tenants.`, claims.TenantID))
+	}
+
+	if _, ok := claims.ClaimNames["groups"]; ok {
+		if claims.Groups, err = m.memberGroups(ctx, exchange); err != nil {
+			return nil, err
+		}
+	}
+
+	return &claims.Claims, nil
+}
+
+// unverifiedTenantID returns the `tid` claim of the ID token without verifying the token.
+func (m *ProviderMicrosoft) unverifiedTenantID(raw string) (string, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReason("The ID token is malformed."))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the ID token: %s", err))
+	}
+
+	var claims struct {
+		TenantID string `json:"tid"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the ID token: %s", err))
+	}
+
+	// The tenant ID becomes part of the issuer URL and must therefore not contain anything but a tenant ID.
+	if claims.TenantID == "" || strings.ContainsAny(claims.TenantID, "/?#.%") {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The ID token contains an invalid tenant ID "%s".`, claims.TenantID))
+	}
+
+	return claims.TenantID, nil
+}
+
+// memberGroups fetches the IDs of the groups the user is a member of from the Microsoft Graph API. This is needed
+// if the user is a member of too many groups to include them in the ID token. The `User.Read` scope is required.
+func (m *ProviderMicrosoft) memberGroups(ctx context.Context, exchange *oauth2.Token) ([]string, error) {
+	conf, err := m.OAuth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", urlx.AppendPaths(urlx.ParseOrPanic(microsoftGraphURL), "/v1.0/me/getMemberGroups").String(),
+		bytes.NewBufferString(`{"securityEnabledOnly":false}`))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := conf.Client(ctx, exchange).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to fetch the groups from the Microsoft Graph API: %s", err))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to fetch the groups from the Microsoft Graph API because it responded with status code %d. Please make sure the \"User.Read\" scope is requested.", res.StatusCode))
+	}
+
+	var groups struct {
+		Value []string `json:"value"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&groups); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the groups from the Microsoft Graph API: %s", err))
+	}
+
+	return groups.Value, nil
+}
@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestProviderMicrosoft(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/v2.0/.well-known/openid-configuration"):
+			tenant := strings.Split(r.URL.Path, "/")[1]
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":                                server.URL + "/" + tenant + "/v2.0",
+				"authorization_endpoint":                server.URL + "/" + tenant + "/oauth2/v2.0/authorize",
+				"token_endpoint":                        server.URL + "/" + tenant + "/oauth2/v2.0/token",
+				"jwks_uri":                              server.URL + "/keys",
+				"response_types_supported":              []string{"code"},
+				"subject_types_supported":               []string{"pairwise"},
+				"id_token_signing_alg_values_supported": []string{"RS256"},
+			})
+		case r.URL.Path == "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]interface{}{{
+					"kty": "RSA",
+					"kid": "key",
+					"use": "sig",
+					"alg": "RS256",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				}},
+			})
+		case r.URL.Path == "/v1.0/me/getMemberGroups":
+			assert.Equal(t, "POST", r.Method)
+			assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": []string{"group-1", "group-2"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	loginURL, graphURL := microsoftLoginURL, microsoftGraphURL
+	microsoftLoginURL, microsoftGraphURL = server.URL, server.URL
+	defer func() {
+		microsoftLoginURL, microsoftGraphURL = loginURL, graphURL
+	}()
+
+	const tenant = "8eaef023-2b34-4da1-9baa-8bc8c9d6a490"
+	sign := func(t *testing.T, claims map[string]interface{}) *oauth2.Token {
+		header, err := json.Marshal(map[string]interface{}{"alg": "RS256", "kid": "key", "typ": "JWT"})
+		require.NoError(t, err)
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+
+		return (&oauth2.Token{AccessToken: "access-token", TokenType: "Bearer"}).WithExtra(map[string]interface{}{
+			"id_token": signed + "." + base64.RawURLEncoding.EncodeToString(signature),
+		})
+	}
+
+	idToken := func(tid string, extra map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":   server.URL + "/" + tid + "/v2.0",
+			"aud":   "client",
+			"sub":   "microsoft-subject",
+			"tid":   tid,
+			"name":  "Jane Doe",
+			"email": "jane@example.org",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	newProvider := func(allowed ...string) *ProviderMicrosoft {
+		public, err := url.Parse("https://ory.sh")
+		require.NoError(t, err)
+		return NewProviderMicrosoft(&Configuration{
+			Provider:                "microsoft",
+			ID:                      "microsoft",
+			ClientID:                "client",
+			ClientSecret:            "secret",
+			MicrosoftAllowedTenants: allowed,
+		}, public)
+	}
+
+	t.Run("case=uses the common endpoint by default", func(t *testing.T) {
+		c, err := newProvider().OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/common/oauth2/v2.0/authorize", c.Endpoint.AuthURL)
+		assert.Equal(t, server.URL+"/common/oauth2/v2.0/token", c.Endpoint.TokenURL)
+		assert.Contains(t, c.Scopes, "openid")
+	})
+
+	t.Run("case=verifies the token against the issuer of the tenant", func(t *testing.T) {
+		claims, err := newProvider().Claims(context.Background(), sign(t, idToken(tenant, map[string]interface{}{
+			"groups": []string{"group-a"},
+		})))
+		require.NoError(t, err)
+		assert.Equal(t, "microsoft-subject", claims.Subject)
+		assert.Equal(t, "jane@example.org", claims.Email)
+		assert.False(t, claims.EmailVerified)
+		assert.Equal(t, []string{"group-a"}, claims.Groups)
+	})
+
+	t.Run("case=rejects a token issued by another tenant", func(t *testing.T) {
+		c := idToken(tenant, nil)
+		c["iss"] = server.URL + "/other-tenant/v2.0"
+		_, err := newProvider().Claims(context.Background(), sign(t, c))
+		require.Error(t, err)
+	})
+
+	t.Run("case=rejects an invalid tenant ID", func(t *testing.T) {
+		_, err := newProvider().Claims(context.Background(), sign(t, idToken("../common", nil)))
+		require.Error(t, err)
+	})
+
+	t.Run("case=restricts the tenants", func(t *testing.T) {
+		_, err := newProvider("some-other-tenant").Claims(context.Background(), sign(t, idToken(tenant, nil)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), ErrTenantNotAllowed.Error())
+
+		_, err = newProvider("some-other-tenant", tenant).Claims(context.Background(), sign(t, idToken(tenant, nil)))
+		require.NoError(t, err)
+	})
+
+	t.Run("case=fetches the groups from the graph api if they overflow", func(t *testing.T) {
+		claims, err := newProvider().Claims(context.Background(), sign(t, idToken(tenant, map[string]interface{}{
+			"_claim_names":   map[string]string{"groups": "src1"},
+			"_claim_sources": map[string]interface{}{"src1": map[string]string{"endpoint": "https://graph.windows.net/" + tenant + "/users/subject/getMemberObjects"}},
+		})))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"group-1", "group-2"}, claims.Groups)
+	})
+}
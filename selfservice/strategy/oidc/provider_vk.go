@@ -0,0 +1,111 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/vk"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+)
+
+const vkAPIVersion = "5.103"
+
+// This is a variable so that tests are able to replace it.
+var vkAPIURL = "https://api.vk.com"
+
+var _ Provider = new(ProviderVK)
+
+// ProviderVK implements VK (VKontakte). VK does not support OpenID Connect and returns the email address along with
+// the access token instead of from its API.
+type ProviderVK struct {
+	config *Configuration
+	public *url.URL
+}
+
+func NewProviderVK(
+	config *Configuration,
+	public *url.URL,
+) *ProviderVK {
+	return &ProviderVK{
+		config: config,
+		public: public,
+	}
+}
+
+func (g *ProviderVK) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderVK) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint:     vk.Endpoint,
+		Scopes:       g.config.Scope,
+		RedirectURL:  g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderVK) AuthCodeURLOptions(r request) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("v", vkAPIVersion),
+	}
+}
+
+func (g *ProviderVK) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	u := urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(vkAPIURL), "/method/users.get"), url.Values{
+		"fields":       {"photo_200,nickname,screen_name"},
+		"access_token": {exchange.AccessToken},
+		"v":            {vkAPIVersion},
+	})
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var res struct {
+		Error *struct {
+			Code    int    `json:"error_code"`
+			Message string `json:"error_msg"`
+		} `json:"error"`
+		Response []struct {
+			ID         int64  `json:"id"`
+			FirstName  string `json:"first_name"`
+			LastName   string `json:"last_name"`
+			Nickname   string `json:"nickname"`
+			ScreenName string `json:"screen_name"`
+			Photo      string `json:"photo_200"`
+		} `json:"response"`
+	}
+	if err := fetchJSON(ctx, req, &res); err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("VK responded with error %d: %s", res.Error.Code, res.Error.Message))
+	}
+	if len(res.Response) == 0 {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("VK did not return the user."))
+	}
+
+	user := res.Response[0]
+	email, _ := exchange.Extra("email").(string)
+	return &Claims{
+		Issuer:            vk.Endpoint.TokenURL,
+		Subject:           fmt.Sprintf("%d", user.ID),
+		Name:              strings.TrimSpace(user.FirstName + " " + user.LastName),
+		GivenName:         user.FirstName,
+		FamilyName:        user.LastName,
+		Nickname:          user.Nickname,
+		PreferredUsername: user.ScreenName,
+		Picture:           user.Photo,
+		Email:             email,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestProviderVK(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		assert.Equal(t, "/method/users.get", r.URL.Path)
+		assert.Equal(t, vkAPIVersion, r.URL.Query().Get("v"))
+		if r.URL.Query().Get("access_token") != "access-token" {
+			_, _ = w.Write([]byte(`{"error":{"error_code":5,"error_msg":"User authorization failed: invalid access_token."}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"response":[{"id":1234,"first_name":"Jane","last_name":"Doe","screen_name":"jane","photo_200":"https://example.org/jane.png"}]}`))
+	}))
+	defer ts.Close()
+
+	apiURL := vkAPIURL
+	vkAPIURL = ts.URL
+	defer func() {
+		vkAPIURL = apiURL
+	}()
+
+	public, err := url.Parse("https://ory.sh")
+	require.NoError(t, err)
+	p := NewProviderVK(&Configuration{Provider: "vk", ID: "vk", ClientID: "client", ClientSecret: "secret"}, public)
+
+	t.Run("case=takes the email from the token", func(t *testing.T) {
+		token := (&oauth2.Token{AccessToken: "access-token"}).WithExtra(map[string]interface{}{
+			"user_id": 1234,
+			"email":   "jane@example.org",
+		})
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "1234", claims.Subject)
+		assert.Equal(t, "Jane Doe", claims.Name)
+		assert.Equal(t, "jane", claims.PreferredUsername)
+		assert.Equal(t, "jane@example.org", claims.Email)
+		assert.False(t, claims.EmailVerified)
+	})
+
+	t.Run("case=returns the vk error", func(t *testing.T) {
+		_, err := p.Claims(context.Background(), &oauth2.Token{AccessToken: "invalid"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+)
+
+// These are variables so that tests are able to replace them.
+var (
+	wechatAuthURL = "https://open.weixin.qq.com/connect/qrconnect"
+	wechatAPIURL  = "https://api.weixin.qq.com"
+)
+
+var (
+	_ Provider       = new(ProviderWeChat)
+	_ TokenExchanger = new(ProviderWeChat)
+)
+
+// ProviderWeChat implements WeChat website login. WeChat identifies the application using `appid` and `secret`
+// instead of the OAuth2 client credentials, responds to the token request with JSON labeled as text/plain, and
+// requires the `openid` returned along with the access token to fetch the user info.
+type ProviderWeChat struct {
+	config *Configuration
+	public *url.URL
+}
+
+func NewProviderWeChat(
+	config *Configuration,
+	public *url.URL,
+) *ProviderWeChat {
+	return &ProviderWeChat{
+		config: config,
+		public: public,
+	}
+}
+
+func (g *ProviderWeChat) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderWeChat) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	scope := g.config.Scope
+	if len(scope) == 0 {
+		scope = []string{"snsapi_login"}
+	}
+
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  wechatAuthURL,
+			TokenURL: urlx.AppendPaths(urlx.ParseOrPanic(wechatAPIURL), "/sns/oauth2/access_token").String(),
+		},
+		Scopes:      scope,
+		RedirectURL: g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderWeChat) AuthCodeURLOptions(r request) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("appid", g.config.ClientID),
+	}
+}
+
+type wechatError struct {
+	Code    int    `json:"errcode"`
+	Message string `json:"errmsg"`
+}
+
+func (e wechatError) err() error {
+	if e.Code == 0 {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("WeChat responded with error %d: %s", e.Code, e.Message))
+}
+
+func (g *ProviderWeChat) Exchange(ctx context.Context, query url.Values) (*oauth2.Token, error) {
+	code := query.Get("code")
+	if code == "" {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the code query parameter.`))
+	}
+
+	u := urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(wechatAPIURL), "/sns/oauth2/access_token"), url.Values{
+		"appid":      {g.config.ClientID},
+		"secret":     {g.config.ClientSecret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	})
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var res struct {
+		wechatError
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		OpenID       string `json:"openid"`
+		UnionID      string `json:"unionid"`
+	}
+	if err := fetchJSON(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	if err := res.err(); err != nil {
+		return nil, err
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  res.AccessToken,
+		RefreshToken: res.RefreshToken,
+		TokenType:    "Bearer",
+	}
+	if res.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+
+	return token.WithExtra(map[string]interface{}{
+		"openid":  res.OpenID,
+		"unionid": res.UnionID,
+	}), nil
+}
+
+func (g *ProviderWeChat) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	openID, _ := exchange.Extra("openid").(string)
+	if openID == "" {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("WeChat did not return the openid along with the access token."))
+	}
+
+	u := urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(wechatAPIURL), "/sns/userinfo"), url.Values{
+		"access_token": {exchange.AccessToken},
+		"openid":       {openID},
+		"lang":         {"en"},
+	})
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var user struct {
+		wechatError
+		OpenID     string `json:"openid"`
+		UnionID    string `json:"unionid"`
+		Nickname   string `json:"nickname"`
+		HeadImgURL string `json:"headimgurl"`
+	}
+	if err := fetchJSON(ctx, req, &user); err != nil {
+		return nil, err
+	}
+	if err := user.err(); err != nil {
+		return nil, err
+	}
+
+	// The union ID identifies the user across all applications of the developer account, the open ID only within
+	// this application.
+	subject := user.UnionID
+	if subject == "" {
+		subject = user.OpenID
+	}
+
+	return &Claims{
+		Issuer:   wechatAPIURL,
+		Subject:  subject,
+		Name:     user.Nickname,
+		Nickname: user.Nickname,
+		Picture:  user.HeadImgURL,
+	}, nil
+}
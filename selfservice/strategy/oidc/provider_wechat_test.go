@@ -0,0 +1,96 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+func TestProviderWeChat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// WeChat labels its JSON responses as text/plain.
+		w.Header().Set("Content-Type", "text/plain")
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/sns/oauth2/access_token":
+			if q.Get("code") != "valid-code" {
+				_, _ = w.Write([]byte(`{"errcode":40029,"errmsg":"invalid code"}`))
+				return
+			}
+			assert.Equal(t, "wx-app", q.Get("appid"))
+			assert.Equal(t, "wx-secret", q.Get("secret"))
+			assert.Equal(t, "authorization_code", q.Get("grant_type"))
+			_, _ = w.Write([]byte(`{"access_token":"access-token","expires_in":7200,"refresh_token":"refresh-token","openid":"open-id","scope":"snsapi_login"}`))
+		case "/sns/userinfo":
+			assert.Equal(t, "access-token", q.Get("access_token"))
+			assert.Equal(t, "open-id", q.Get("openid"))
+			assert.Equal(t, "en", q.Get("lang"))
+			_, _ = w.Write([]byte(`{"openid":"open-id","unionid":"union-id","nickname":"Jane","headimgurl":"https://example.org/jane.png"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	apiURL := wechatAPIURL
+	wechatAPIURL = ts.URL
+	defer func() {
+		wechatAPIURL = apiURL
+	}()
+
+	public, err := url.Parse("https://ory.sh")
+	require.NoError(t, err)
+	p := NewProviderWeChat(&Configuration{
+		Provider:     "wechat",
+		ID:           "wechat",
+		ClientID:     "wx-app",
+		ClientSecret: "wx-secret",
+	}, public)
+
+	t.Run("case=sends the app id", func(t *testing.T) {
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+		u := c.AuthCodeURL("state", p.AuthCodeURLOptions(&login.Request{ID: x.NewUUID()})...)
+		assert.Contains(t, u, "appid=wx-app")
+		assert.Contains(t, u, "scope=snsapi_login")
+	})
+
+	t.Run("case=exchanges the code and fetches the user info", func(t *testing.T) {
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+
+		token, err := exchange(context.Background(), p, c, url.Values{"code": {"valid-code"}}, "")
+		require.NoError(t, err)
+		assert.Equal(t, "access-token", token.AccessToken)
+		assert.Equal(t, "refresh-token", token.RefreshToken)
+		assert.True(t, token.Valid())
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "union-id", claims.Subject)
+		assert.Equal(t, "Jane", claims.Nickname)
+		assert.Equal(t, "https://example.org/jane.png", claims.Picture)
+	})
+
+	t.Run("case=returns the wechat error", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), url.Values{"code": {"invalid-code"}})
+		require.Error(t, err)
+		assert.Contains(t, errorsx.Cause(err).(*herodot.DefaultError).Reason(), "invalid code")
+	})
+
+	t.Run("case=requires the code", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), url.Values{})
+		require.Error(t, err)
+	})
+}
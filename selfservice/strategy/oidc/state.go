@@ -0,0 +1,128 @@
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/randx"
+
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// UsageAuto uses PKCE or nonces if the provider supports them.
+	UsageAuto = "auto"
+	// UsageForce always uses PKCE or nonces and fails if the provider does not support them.
+	UsageForce = "force"
+	// UsageNever never uses PKCE or nonces.
+	UsageNever = "never"
+)
+
+type (
+	// PKCESupporter is implemented by providers which are able to tell whether they support PKCE with S256.
+	PKCESupporter interface {
+		SupportsPKCE(ctx context.Context) bool
+	}
+
+	// NonceSupporter is implemented by providers which issue ID tokens containing the nonce sent along with the
+	// authorization request.
+	NonceSupporter interface {
+		SupportsNonce() bool
+	}
+)
+
+var (
+	codeVerifierRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-._~")
+
+	ErrStateMismatch = herodot.ErrBadRequest.
+				WithError("the state parameter does not belong to this flow").
+				WithReasonf(`Unable to complete OpenID Connect flow because the state parameter does not belong to this flow. Please try again.`)
+
+	ErrNonceMismatch = herodot.ErrBadRequest.
+				WithError("the nonce of the ID token does not match").
+				WithReasonf(`Unable to complete OpenID Connect flow because the ID token does not contain the expected nonce. Please try again.`)
+)
+
+func usePKCE(ctx context.Context, p Provider) bool {
+	switch p.Config().PKCE {
+	case UsageForce:
+		return true
+	case UsageNever:
+		return false
+	}
+
+	s, ok := p.(PKCESupporter)
+	return ok && s.SupportsPKCE(ctx)
+}
+
+func useNonce(p Provider) bool {
+	switch p.Config().Nonce {
+	case UsageForce:
+		return true
+	case UsageNever:
+		return false
+	}
+
+	s, ok := p.(NonceSupporter)
+	return ok && s.SupportsNonce()
+}
+
+// newCodeVerifier returns a PKCE code verifier and the options which send its S256 challenge.
+func newCodeVerifier() (string, []oauth2.AuthCodeOption, error) {
+	verifier, err := randx.RuneSequence(64, codeVerifierRunes)
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+
+	challenge := sha256.Sum256([]byte(string(verifier)))
+	return string(verifier), []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}, nil
+}
+
+// newState returns the state parameter. It contains the flow ID and is bound to the browser's CSRF token, so that a
+// state issued for one flow or browser is not accepted by another.
+func (s *Strategy) newState(r *http.Request, rid uuid.UUID) (string, error) {
+	random, err := randx.RuneSequence(32, randx.AlphaNum)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return rid.String() + "." + string(random) + "." + s.stateMAC(r, rid.String(), string(random)), nil
+}
+
+// verifyState returns the flow ID of the state parameter if the state is bound to the browser's CSRF token.
+func (s *Strategy) verifyState(r *http.Request, state string) (uuid.UUID, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 {
+		return uuid.Nil, errors.WithStack(ErrStateMismatch.WithDebug("The state parameter is malformed."))
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(s.stateMAC(r, parts[0], parts[1]))) {
+		return uuid.Nil, errors.WithStack(ErrStateMismatch.WithDebug("The state parameter is not bound to the CSRF token of this browser."))
+	}
+
+	return x.ParseUUID(parts[0]), nil
+}
+
+func (s *Strategy) stateMAC(r *http.Request, rid, random string) string {
+	var key []byte
+	if secrets := s.c.SessionSecrets(); len(secrets) > 0 {
+		key = secrets[0]
+	}
+
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(strings.Join([]string{"state", rid, random, x.UnmaskCSRFToken(s.d.GenerateCSRFToken(r))}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -3,19 +3,23 @@ package oidc
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
 
 	"github.com/ory/x/errorsx"
 
 	"github.com/ory/x/jsonx"
+	"github.com/ory/x/randx"
 
 	"github.com/ory/herodot"
 	"github.com/ory/x/stringsx"
@@ -24,7 +28,10 @@ import (
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/registration"
 	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/strategy/password"
 
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/courier"
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/schema"
@@ -58,9 +65,15 @@ type dependencies interface {
 	x.LoggingProvider
 	x.CookieProvider
 	x.CSRFTokenGeneratorProvider
+	x.FlowBinderProvider
+
+	cipher.Provider
+	courier.Provider
+	password.HashProvider
 
 	identity.ValidationProvider
 	identity.PrivilegedPoolProvider
+	identity.ManagementProvider
 
 	session.ManagementProvider
 	session.HandlerProvider
@@ -78,14 +91,17 @@ type dependencies interface {
 	registration.StrategyProvider
 	registration.HandlerProvider
 	registration.ErrorHandlerProvider
+
+	IdentityTraitsSchemas() schema.Schemas
 }
 
 // Strategy implements selfservice.LoginStrategy, selfservice.RegistrationStrategy. It supports both login
 // and registration via OpenID Providers.
 type Strategy struct {
-	c         configuration.Provider
-	d         dependencies
-	validator *schema.Validator
+	c           configuration.Provider
+	d           dependencies
+	validator   *schema.Validator
+	linkLimiter *x.RateLimiter
 }
 
 func (s *Strategy) RegisterLoginRoutes(r *x.RouterPublic) {
@@ -101,6 +117,10 @@ func (s *Strategy) setRoutes(r *x.RouterPublic) {
 		r.GET(CallbackPath, s.handleCallback)
 	}
 
+	if handle, _, _ := r.Lookup("POST", CallbackPath); handle == nil {
+		r.POST(CallbackPath, s.handleCallbackFormPost)
+	}
+
 	if handle, _, _ := r.Lookup("POST", AuthPath); handle == nil {
 		r.POST(AuthPath, s.handleAuth)
 	}
@@ -108,6 +128,14 @@ func (s *Strategy) setRoutes(r *x.RouterPublic) {
 	if handle, _, _ := r.Lookup("GET", AuthPath); handle == nil {
 		r.GET(AuthPath, s.handleAuth)
 	}
+
+	if handle, _, _ := r.Lookup("POST", DiscoveryPath); handle == nil {
+		r.POST(DiscoveryPath, s.handleDiscovery)
+	}
+
+	if handle, _, _ := r.Lookup("POST", LinkPath); handle == nil {
+		r.POST(LinkPath, s.handleLink)
+	}
 }
 
 func NewStrategy(
@@ -115,9 +143,10 @@ func NewStrategy(
 	c configuration.Provider,
 ) *Strategy {
 	return &Strategy{
-		c:         c,
-		d:         d,
-		validator: schema.NewValidator(),
+		c:           c,
+		d:           d,
+		validator:   schema.NewValidator(),
+		linkLimiter: x.NewRateLimiter(linkMaxAttempts, linkAttemptWindow),
 	}
 }
 
@@ -156,14 +185,20 @@ func (s *Strategy) handleAuth(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	config, err := provider.OAuth2(r.Context())
+	ar, err := s.validateRequest(r.Context(), rid)
 	if err != nil {
 		s.handleError(w, r, rid, nil, err)
 		return
 	}
 
-	ar, err := s.validateRequest(r.Context(), rid)
-	if err != nil {
+	var binding string
+	switch a := ar.(type) {
+	case *login.Request:
+		binding = a.Binding
+	case *registration.Request:
+		binding = a.Binding
+	}
+	if err := s.d.FlowBinder().Verify(r, rid, binding); err != nil {
 		s.handleError(w, r, rid, nil, err)
 		return
 	}
@@ -176,18 +211,61 @@ func (s *Strategy) handleAuth(w http.ResponseWriter, r *http.Request, ps httprou
 		}
 	}
 
-	state := x.NewUUID().String()
 	// Any data that is posted to this endpoint will be used to fill out missing data from the oidc provider.
-	if err := x.SessionPersistValues(w, r, s.d.CookieManager(), sessionName, map[string]interface{}{
-		sessionKeyState:  state,
-		sessionRequestID: rid.String(),
-		sessionFormState: r.PostForm.Encode(),
-	}); err != nil {
+	s.redirectToProvider(w, r, ar, provider, r.PostForm.Encode())
+}
+
+// redirectToProvider starts the authorization code flow with the provider. The form state is merged with the claims
+// when the identity is registered.
+func (s *Strategy) redirectToProvider(w http.ResponseWriter, r *http.Request, ar request, provider Provider, formState string, options ...oauth2.AuthCodeOption) {
+	rid := ar.GetID()
+	config, err := provider.OAuth2(outboundContext(r.Context()))
+	if err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	state, err := s.newState(r, rid)
+	if err != nil {
 		s.handleError(w, r, rid, nil, err)
 		return
 	}
 
-	http.Redirect(w, r, config.AuthCodeURL(state, provider.AuthCodeURLOptions(ar)...), http.StatusFound)
+	values := map[string]interface{}{
+		sessionKeyState:        state,
+		sessionRequestID:       rid.String(),
+		sessionFormState:       formState,
+		sessionKeyCodeVerifier: "",
+		sessionKeyNonce:        "",
+	}
+
+	options = append(options, provider.AuthCodeURLOptions(ar)...)
+	if _, ok := provider.(TokenExchanger); !ok && usePKCE(r.Context(), provider) {
+		verifier, challenge, err := newCodeVerifier()
+		if err != nil {
+			s.handleError(w, r, rid, nil, err)
+			return
+		}
+		values[sessionKeyCodeVerifier] = verifier
+		options = append(options, challenge...)
+	}
+
+	if useNonce(provider) {
+		nonce, err := randx.RuneSequence(32, randx.AlphaNum)
+		if err != nil {
+			s.handleError(w, r, rid, nil, errors.WithStack(err))
+			return
+		}
+		values[sessionKeyNonce] = string(nonce)
+		options = append(options, oauth2.SetAuthURLParam("nonce", string(nonce)))
+	}
+
+	if err := x.SessionPersistValues(w, r, s.d.CookieManager(), sessionName, values); err != nil {
+		s.handleError(w, r, rid, nil, err)
+		return
+	}
+
+	http.Redirect(w, r, config.AuthCodeURL(state, options...), http.StatusFound)
 }
 
 func (s *Strategy) validateRequest(ctx context.Context, rid uuid.UUID) (request, error) {
@@ -196,7 +274,7 @@ func (s *Strategy) validateRequest(ctx context.Context, rid uuid.UUID) (request,
 	}
 
 	if ar, err := s.d.RegistrationRequestPersister().GetRegistrationRequest(ctx, rid); err == nil {
-		if err := ar.Valid(); err != nil {
+		if err := ar.ValidFor(s.c.SelfServiceRegistrationRequestLifespanFor(string(s.ID()))); err != nil {
 			return ar, err
 		}
 		return ar, nil
@@ -207,7 +285,7 @@ func (s *Strategy) validateRequest(ctx context.Context, rid uuid.UUID) (request,
 		return nil, err
 	}
 
-	if err := ar.Valid(); err != nil {
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
 		return ar, err
 	}
 
@@ -215,36 +293,34 @@ func (s *Strategy) validateRequest(ctx context.Context, rid uuid.UUID) (request,
 }
 
 func (s *Strategy) validateCallback(r *http.Request) (request, error) {
-	var (
-		code = r.URL.Query().Get("code")
-	)
-	if state := r.URL.Query().Get("state"); state == "" {
+	state := r.URL.Query().Get("state")
+	if state == "" {
 		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the state query parameter.`))
 	} else if state != x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionKeyState, "") {
 		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the query state parameter does not match the state parameter from the session cookie.`))
 	}
 
-	ar, err := s.validateRequest(r.Context(), x.ParseUUID(x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionRequestID, "")))
+	rid, err := s.verifyState(r, state)
 	if err != nil {
 		return nil, err
+	} else if rid.String() != x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionRequestID, "") {
+		return nil, errors.WithStack(ErrStateMismatch.WithDebug("The state parameter was issued for a different flow."))
 	}
 
-	if r.URL.Query().Get("error") != "" {
-		return ar, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider returned error "%s": %s`, r.URL.Query().Get("error"), r.URL.Query().Get("error_description")))
+	ar, err := s.validateRequest(r.Context(), rid)
+	if err != nil {
+		return nil, err
 	}
 
-	if code == "" {
-		return ar, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the code query parameter.`))
+	if r.URL.Query().Get("error") != "" {
+		return ar, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider returned error "%s": %s`, r.URL.Query().Get("error"), r.URL.Query().Get("error_description")))
 	}
 
 	return ar, nil
 }
 
 func (s *Strategy) handleCallback(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	var (
-		code = r.URL.Query().Get("code")
-		pid  = ps.ByName("provider")
-	)
+	pid := ps.ByName("provider")
 
 	ar, err := s.validateCallback(r)
 	if err != nil {
@@ -270,36 +346,80 @@ func (s *Strategy) handleCallback(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	config, err := provider.OAuth2(context.Background())
+	config, err := provider.OAuth2(outboundContext(context.Background()))
 	if err != nil {
 		s.handleError(w, r, ar.GetID(), nil, err)
 		return
 	}
 
-	token, err := config.Exchange(r.Context(), code)
+	token, err := exchange(outboundContext(r.Context()), provider, config, r.URL.Query(), x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionKeyCodeVerifier, ""))
 	if err != nil {
 		s.handleError(w, r, ar.GetID(), nil, err)
 		return
 	}
 
-	claims, err := provider.Claims(r.Context(), token)
+	claims, err := provider.Claims(outboundContext(r.Context()), token)
 	if err != nil {
 		s.handleError(w, r, ar.GetID(), nil, err)
 		return
 	}
 
+	if nonce := x.SessionGetStringOr(r, s.d.CookieManager(), sessionName, sessionKeyNonce, ""); nonce != "" &&
+		subtle.ConstantTimeCompare([]byte(nonce), []byte(claims.Nonce)) != 1 {
+		s.handleError(w, r, ar.GetID(), nil, errors.WithStack(ErrNonceMismatch))
+		return
+	}
+
+	if d, ok := provider.(QueryClaimsDecoder); ok {
+		d.DecodeQuery(r.URL.Query(), claims)
+	}
+
 	switch a := ar.(type) {
 	case *login.Request:
-		s.processLogin(w, r, a, claims, provider)
+		s.processLogin(w, r, a, token, claims, provider)
 		return
 	case *registration.Request:
-		s.processRegistration(w, r, a, claims, provider)
+		s.processRegistration(w, r, a, token, claims, provider)
 		return
 	default:
 		panic(fmt.Sprintf("unexpected type: %T", a))
 	}
 }
 
+// handleCallbackFormPost handles providers which post the callback (response_mode=form_post), such as Apple. The
+// session cookie is not sent along with cross-site POST requests if it uses SameSite=Lax, so the browser is
+// redirected to the callback using GET instead.
+func (s *Strategy) handleCallbackFormPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, x.EmptyUUID, nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	http.Redirect(w, r, urlx.CopyWithQuery(
+		urlx.AppendPaths(urlx.Copy(s.c.SelfPublicURL()), strings.Replace(CallbackPath, ":provider", ps.ByName("provider"), 1)),
+		r.PostForm,
+	).String(), http.StatusSeeOther)
+}
+
+// exchange exchanges the authorization code for the provider's tokens. The code verifier is sent if PKCE was used.
+func exchange(ctx context.Context, provider Provider, config *oauth2.Config, query url.Values, verifier string) (*oauth2.Token, error) {
+	if e, ok := provider.(TokenExchanger); ok {
+		return e.Exchange(ctx, query)
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the code query parameter.`))
+	}
+
+	var options []oauth2.AuthCodeOption
+	if verifier != "" {
+		options = append(options, oauth2.SetAuthURLParam("code_verifier", verifier))
+	}
+
+	return config.Exchange(ctx, code, options...)
+}
+
 func uid(provider, subject string) string {
 	return fmt.Sprintf("%s:%s", provider, subject)
 }
@@ -319,7 +439,7 @@ func (s *Strategy) authURL(request uuid.UUID, provider string) string {
 	return u.String()
 }
 
-func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login.Request, claims *Claims, provider Provider) {
+func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login.Request, token *oauth2.Token, claims *Claims, provider Provider) {
 	i, c, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), identity.CredentialsTypeOIDC, uid(provider.Config().ID, claims.Subject))
 	if err != nil {
 		if errorsx.Cause(err).Error() == herodot.ErrNotFound.Error() {
@@ -334,7 +454,7 @@ func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login
 
 			// This is kinda hacky but the only way to ensure seamless login/registration flows when using OIDC.
 
-			s.d.Logger().WithField("provider", provider.Config().ID).WithField("subject", claims.Subject).Debug("Received successful OpenID Connect callback but user is not registered. Re-initializing registration flow now.")
+			x.ContextLogger(r.Context(), s.d.Logger()).WithField("provider", provider.Config().ID).WithField("subject", claims.Subject).Debug("Received successful OpenID Connect callback but user is not registered. Re-initializing registration flow now.")
 			if err := s.d.RegistrationHandler().NewRegistrationRequest(w, r, func(aa *registration.Request) (string, error) {
 				return s.authURL(aa.ID, provider.Config().ID), nil
 			}); err != nil {
@@ -353,9 +473,11 @@ func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login
 		return
 	}
 
-	for _, c := range o {
+	for k, c := range o {
 		if c.Subject == claims.Subject && c.Provider == provider.Config().ID {
-			if err = s.d.LoginHookExecutor().PostLoginHook(w, r, s.d.PostLoginHooks(identity.CredentialsTypeOIDC), a, i); err != nil {
+			s.updateTokens(r.Context(), i.ID, o, k, token)
+
+			if err = s.d.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypeOIDC, s.d.PostLoginHooks(identity.CredentialsTypeOIDC), a, i); err != nil {
 				s.handleError(w, r, a.GetID(), nil, err)
 				return
 			}
@@ -366,7 +488,7 @@ func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login
 	s.handleError(w, r, a.GetID(), nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to find matching OpenID Connect Credentials.").WithDebugf(`Unable to find credentials that match the given provider "%s" and subject "%s".`, provider.Config().ID, claims.Subject)))
 }
 
-func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a *registration.Request, claims *Claims, provider Provider) {
+func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a *registration.Request, token *oauth2.Token, claims *Claims, provider Provider) {
 	if _, _, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), identity.CredentialsTypeOIDC, uid(provider.Config().ID, claims.Subject)); err == nil {
 		// If the identity already exists, we should perform the login flow instead.
 
@@ -377,7 +499,7 @@ func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a
 		// not need additional consent/login.
 
 		// This is kinda hacky but the only way to ensure seamless login/registration flows when using OIDC.
-		s.d.Logger().WithField("provider", provider.Config().ID).WithField("subject", claims.Subject).Debug("Received successful OpenID Connect callback but user is already registered. Re-initializing login flow now.")
+		x.ContextLogger(r.Context(), s.d.Logger()).WithField("provider", provider.Config().ID).WithField("subject", claims.Subject).Debug("Received successful OpenID Connect callback but user is already registered. Re-initializing login flow now.")
 		if err := s.d.LoginHandler().NewLoginRequest(w, r, func(aa *login.Request) (string, error) {
 			return s.authURL(aa.ID, provider.Config().ID), nil
 		}); err != nil {
@@ -408,7 +530,7 @@ func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a
 		doc.Bytes(),
 		schema.WithExtensionRunner(runner),
 	); err != nil {
-		s.d.Logger().
+		x.ContextLogger(r.Context(), s.d.Logger()).
 			WithField("provider", provider.Config().ID).
 			WithField("schema_url", provider.Config().SchemaURL).
 			WithField("claims", fmt.Sprintf("%+v", claims)).
@@ -418,7 +540,7 @@ func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a
 		return
 	}
 
-	option, err := decoderRegistration(s.c.DefaultIdentityTraitsSchemaURL().String())
+	option, err := decoderRegistration(s.traitsSchemaURL())
 	if err != nil {
 		s.handleError(w, r, a.GetID(), nil, err)
 		return
@@ -441,13 +563,34 @@ func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a
 		return
 	}
 
+	// If the email address is used by an existing identity already, ask the user to link the accounts instead of
+	// failing with a duplicate credentials error. Both would reveal that the email address is registered, which is
+	// why the registration is concealed instead if account enumeration mitigation is enabled.
+	linkable, err := s.findLinkableIdentity(r.Context(), claims)
+	if s.c.SecurityAccountEnumerationMitigate() && (linkable != nil || registration.IsDuplicateCredentialsError(err)) {
+		if err := s.d.RegistrationExecutor().ConcealDuplicate(w, r, s.d.PostRegistrationHooks(identity.CredentialsTypeOIDC), a, []string{strings.ToLower(claims.Email)}); err != nil {
+			s.handleError(w, r, a.GetID(), traits, err)
+		}
+		return
+	} else if err != nil {
+		s.handleError(w, r, a.GetID(), traits, err)
+		return
+	} else if linkable != nil {
+		s.startLink(w, r, a, linkable, claims, provider)
+		return
+	}
+
+	cc := CredentialsConfig{
+		Subject:  claims.Subject,
+		Provider: provider.Config().ID,
+	}
+	if err := encryptTokens(s.d.Cipher(), &cc, token); err != nil {
+		s.handleError(w, r, a.GetID(), traits, err)
+		return
+	}
+
 	var b bytes.Buffer
-	if err := json.NewEncoder(&b).Encode([]CredentialsConfig{
-		{
-			Subject:  claims.Subject,
-			Provider: provider.Config().ID,
-		},
-	}); err != nil {
+	if err := json.NewEncoder(&b).Encode([]CredentialsConfig{cc}); err != nil {
 		s.handleError(w, r, a.GetID(), traits, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err)))
 		return
 	}
@@ -498,6 +641,13 @@ func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Request) error
 	if err != nil {
 		return err
 	}
+
+	if conf, err := s.Config(); err != nil {
+		return err
+	} else if conf.HasDomains() {
+		config.Discovery = s.discoveryForm(r, sr.ID)
+	}
+
 	sr.Methods[identity.CredentialsTypeOIDC] = &login.RequestMethod{
 		Method: identity.CredentialsTypeOIDC,
 		Config: &login.RequestMethodConfig{RequestMethodConfigurator: config},
@@ -518,29 +668,52 @@ func (s *Strategy) PopulateRegistrationMethod(r *http.Request, sr *registration.
 }
 
 func (s *Strategy) Config() (*ConfigurationCollection, error) {
-	var c ConfigurationCollection
+	return decodeConfig(s.c)
+}
+
+func (s *Strategy) provider(id string) (Provider, error) {
+	return findProvider(s.c, id)
+}
+
+func decodeConfig(c configuration.Provider) (*ConfigurationCollection, error) {
+	var cc ConfigurationCollection
 
 	if err := jsonx.
 		NewStrictDecoder(
-			bytes.NewBuffer(s.c.SelfServiceStrategy(string(identity.CredentialsTypeOIDC)).Config),
+			bytes.NewBuffer(c.SelfServiceStrategy(string(identity.CredentialsTypeOIDC)).Config),
 		).
-		Decode(&c); err != nil {
+		Decode(&cc); err != nil {
 		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode OpenID Connect Provider configuration: %s", err))
 	}
 
-	return &c, nil
+	return &cc, nil
 }
 
-func (s *Strategy) provider(id string) (Provider, error) {
-	if c, err := s.Config(); err != nil {
+func findProvider(c configuration.Provider, id string) (Provider, error) {
+	if cc, err := decodeConfig(c); err != nil {
 		return nil, err
-	} else if provider, err := c.Provider(id, s.c.SelfPublicURL()); err != nil {
+	} else if provider, err := cc.Provider(id, c.SelfPublicURL()); err != nil {
 		return nil, err
 	} else {
 		return provider, nil
 	}
 }
 
+// traitsSchemaURL returns the URL of the identity traits schema new identities are created with. It is the schema
+// set as default using the admin API or, if there is none, the configured default.
+func (s *Strategy) traitsSchemaURL() string {
+	if ts, err := s.d.IdentityTraitsSchemas().GetByID(configuration.DefaultIdentityTraitsSchemaID); err == nil {
+		return ts.URL.String()
+	}
+	return s.c.DefaultIdentityTraitsSchemaURL().String()
+}
+
+// HandleCSRFFailure is a handler for x.OriginCSRFHandler which shows errors of submissions to AuthPath that failed
+// the CSRF check in the login or registration request they belong to.
+func (s *Strategy) HandleCSRFFailure(w http.ResponseWriter, r *http.Request, err error) {
+	s.handleError(w, r, x.ParseUUID(path.Base(r.URL.Path)), nil, err)
+}
+
 func (s *Strategy) handleError(w http.ResponseWriter, r *http.Request, rid uuid.UUID, traits json.RawMessage, err error) {
 	if x.IsZeroUUID(rid) {
 		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
@@ -561,7 +734,7 @@ func (s *Strategy) handleError(w http.ResponseWriter, r *http.Request, rid uuid.
 			}
 
 			method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
-			if errSec := method.Config.SortFields(s.c.DefaultIdentityTraitsSchemaURL().String(), "traits"); errSec != nil {
+			if errSec := method.Config.SortFields(s.traitsSchemaURL(), "traits"); errSec != nil {
 				s.d.RegistrationRequestErrorHandler().HandleRegistrationError(w, r, identity.CredentialsTypeOIDC, rr, errors.Wrap(err, errSec.Error()))
 				return
 			}
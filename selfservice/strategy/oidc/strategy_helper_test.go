@@ -68,12 +68,17 @@ func createClient(t *testing.T, remote string, redir string) {
 	}))
 }
 
-func newHydraIntegration(t *testing.T, remote *string, subject *string, scope *[]string, addr string) (*http.Server, string) {
+func newHydraIntegration(t *testing.T, remote *string, subject *string, scope *[]string, idToken *map[string]interface{}, addr string) (*http.Server, string) {
 	router := httprouter.New()
 
+	type session struct {
+		IDToken map[string]interface{} `json:"id_token,omitempty"`
+	}
+
 	type p struct {
 		Subject    string   `json:"subject,omitempty"`
 		GrantScope []string `json:"grant_scope,omitempty"`
+		Session    *session `json:"session,omitempty"`
 	}
 
 	var do = func(w http.ResponseWriter, r *http.Request, href string, payload io.Reader) {
@@ -118,7 +123,7 @@ func newHydraIntegration(t *testing.T, remote *string, subject *string, scope *[
 		require.NotEmpty(t, challenge)
 
 		var b bytes.Buffer
-		require.NoError(t, json.NewEncoder(&b).Encode(&p{GrantScope: *scope}))
+		require.NoError(t, json.NewEncoder(&b).Encode(&p{GrantScope: *scope, Session: &session{IDToken: *idToken}}))
 		href := urlx.MustJoin(*remote, "/oauth2/auth/requests/consent/accept") + "?consent_challenge=" + challenge
 		do(w, r, href, &b)
 	})
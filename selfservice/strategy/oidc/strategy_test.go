@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -72,11 +73,12 @@ func TestStrategy(t *testing.T) {
 	var (
 		subject      string
 		scope        []string
+		idToken      map[string]interface{}
 		remoteAdmin  = os.Getenv("TEST_SELFSERVICE_OIDC_HYDRA_ADMIN")
 		remotePublic = os.Getenv("TEST_SELFSERVICE_OIDC_HYDRA_PUBLIC")
 	)
 
-	hydraIntegrationTS, hydraIntegrationTSURL := newHydraIntegration(t, &remoteAdmin, &subject, &scope, os.Getenv("TEST_SELFSERVICE_OIDC_HYDRA_INTEGRATION_ADDR"))
+	hydraIntegrationTS, hydraIntegrationTSURL := newHydraIntegration(t, &remoteAdmin, &subject, &scope, &idToken, os.Getenv("TEST_SELFSERVICE_OIDC_HYDRA_INTEGRATION_ADDR"))
 	defer hydraIntegrationTS.Close()
 
 	if testing.Short() {
@@ -453,6 +455,280 @@ func TestStrategy(t *testing.T) {
 		})
 	})
 
+	t.Run("case=should link to an existing account if the email is verified", func(t *testing.T) {
+		scope = []string{"openid"}
+		defer func() { idToken = nil }()
+
+		var createIdentityWithAddress = func(t *testing.T, email, pw string, verified bool) *identity.Identity {
+			hashed, err := reg.PasswordHasher().Generate([]byte(pw))
+			require.NoError(t, err)
+
+			i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+			i.SetCredentials(identity.CredentialsTypePassword, identity.Credentials{
+				Identifiers: []string{email},
+				Config:      []byte(`{"hashed_password":"` + string(hashed) + `"}`),
+			})
+			i.Traits = identity.Traits(`{"subject":"` + email + `"}`)
+
+			address, err := identity.NewVerifiableEmailAddress(email, i.ID, time.Hour)
+			require.NoError(t, err)
+			if verified {
+				now := time.Now().UTC()
+				address.Verified, address.VerifiedAt = true, &now
+			}
+			i.Addresses = []identity.VerifiableAddress{*address}
+			require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+			return i
+		}
+
+		// start registration and return the form which asks to link the accounts
+		var startLink = func(t *testing.T, jar *cookiejar.Jar) string {
+			r := nrr(t, returnTS.URL, time.Minute)
+			res, body := mrj(t, "valid", r.ID, url.Values{}, jar)
+			require.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+			assert.Equal(t, form.ErrorIDAccountLinkRequired, gjson.GetBytes(body, "methods.oidc.config.errors.0.id").String(), "%s", body)
+			assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.action").String(), "/link/"+r.ID.String(), "%s", body)
+			return gjson.GetBytes(body, "methods.oidc.config.action").String()
+		}
+
+		var submitLink = func(t *testing.T, jar *cookiejar.Jar, action string, fv url.Values) (*http.Response, []byte) {
+			res, err := newClient(t, jar).PostForm(action, fv)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			return res, x.MustReadAll(res.Body)
+		}
+
+		var credentialIdentifiers = func(t *testing.T, id uuid.UUID) []string {
+			i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id)
+			require.NoError(t, err)
+			c, ok := i.GetCredentials(identity.CredentialsTypeOIDC)
+			if !ok {
+				return nil
+			}
+			return c.Identifiers
+		}
+
+		var createIdentity = func(t *testing.T, email, pw string) *identity.Identity {
+			return createIdentityWithAddress(t, email, pw, true)
+		}
+
+		t.Run("case=should not link if the email is not verified", func(t *testing.T) {
+			subject = "link-unverified@ory.sh"
+			idToken = map[string]interface{}{"email": subject, "email_verified": false}
+			i := createIdentity(t, subject, "some-password-123")
+
+			r := nrr(t, returnTS.URL, time.Minute)
+			res, body := mr(t, "valid", r.ID, url.Values{})
+			aue(t, res, body, "an account with the same identifier (email, phone, username, ...) exists already")
+			assert.Empty(t, credentialIdentifiers(t, i.ID))
+		})
+
+		t.Run("case=should not link if the email of the existing account is not verified", func(t *testing.T) {
+			subject = "link-unverified-account@ory.sh"
+			idToken = map[string]interface{}{"email": subject, "email_verified": true}
+			i := createIdentityWithAddress(t, subject, "some-password-123", false)
+
+			r := nrr(t, returnTS.URL, time.Minute)
+			res, body := mr(t, "valid", r.ID, url.Values{})
+			aue(t, res, body, "an account with the same identifier (email, phone, username, ...) exists already")
+			assert.Empty(t, credentialIdentifiers(t, i.ID))
+		})
+
+		t.Run("case=should limit the attempts to link", func(t *testing.T) {
+			subject = "link-limit@ory.sh"
+			idToken = map[string]interface{}{"email": subject, "email_verified": true}
+			i := createIdentity(t, subject, "some-password-123")
+
+			jar, _ := cookiejar.New(nil)
+			action := startLink(t, jar)
+			for k := 0; k < 5; k++ {
+				res, body := submitLink(t, jar, action, url.Values{"password": {"not-the-password"}})
+				require.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+				assert.Equal(t, form.ErrorIDInvalidCredentials, gjson.GetBytes(body, "methods.oidc.config.errors.0.id").String(), "%s", body)
+			}
+
+			// Restarting the flow does not reset the attempts.
+			jar, _ = cookiejar.New(nil)
+			action = startLink(t, jar)
+			res, body := submitLink(t, jar, action, url.Values{"password": {"some-password-123"}})
+			aue(t, res, body, "Too many attempts to link the accounts were made")
+			assert.Empty(t, credentialIdentifiers(t, i.ID))
+		})
+
+		t.Run("case=should link using the password", func(t *testing.T) {
+			subject = "link-password@ory.sh"
+			idToken = map[string]interface{}{"email": subject, "email_verified": true}
+			i := createIdentity(t, subject, "some-password-123")
+
+			jar, _ := cookiejar.New(nil)
+			action := startLink(t, jar)
+
+			res, body := submitLink(t, jar, action, url.Values{"password": {"not-the-password"}})
+			require.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+			assert.Equal(t, form.ErrorIDInvalidCredentials, gjson.GetBytes(body, "methods.oidc.config.errors.0.id").String(), "%s", body)
+			assert.Empty(t, credentialIdentifiers(t, i.ID))
+
+			res, body = submitLink(t, jar, action, url.Values{"password": {"some-password-123"}})
+			ai(t, res, body)
+			assert.Equal(t, i.ID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+			assert.Equal(t, []string{"valid:" + subject}, credentialIdentifiers(t, i.ID))
+		})
+
+		t.Run("case=should link using the code sent by email", func(t *testing.T) {
+			subject = "link-code@ory.sh"
+			idToken = map[string]interface{}{"email": subject, "email_verified": true}
+			i := createIdentity(t, subject, "some-password-123")
+
+			jar, _ := cookiejar.New(nil)
+			action := startLink(t, jar)
+
+			message, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, subject, message.Recipient)
+			messageBody, err := message.PlaintextBody(reg.Cipher())
+			require.NoError(t, err)
+			code := regexp.MustCompile(`(?m)^([a-zA-Z0-9]{8})$`).FindStringSubmatch(messageBody)
+			require.Len(t, code, 2, "%s", messageBody)
+
+			res, body := submitLink(t, jar, action, url.Values{"code": {"00000000"}})
+			require.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+			assert.Equal(t, form.ErrorIDInvalidCredentials, gjson.GetBytes(body, "methods.oidc.config.errors.0.id").String(), "%s", body)
+
+			res, body = submitLink(t, jar, action, url.Values{"code": {code[1]}})
+			ai(t, res, body)
+			assert.Equal(t, i.ID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+			assert.Equal(t, []string{"valid:" + subject}, credentialIdentifiers(t, i.ID))
+		})
+
+		t.Run("case=should not link without an account linking in progress", func(t *testing.T) {
+			r := nrr(t, returnTS.URL, time.Minute)
+			res, body := submitLink(t, nil, ts.URL+strings.Replace(oidc.LinkPath, ":request", r.ID.String(), 1), url.Values{"code": {"00000000"}})
+			aue(t, res, body, "No account linking is in progress")
+		})
+
+		t.Run("case=should not offer to link when mitigating account enumeration", func(t *testing.T) {
+			viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, true)
+			defer viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, false)
+
+			// Registrations only look alike if they do not sign in, which is why only the redirect hook is used.
+			key := configuration.ViperKeySelfServiceRegistrationAfterConfig + "." + string(identity.CredentialsTypeOIDC)
+			viper.Set(key, []map[string]interface{}{
+				{"job": "redirect", "config": map[string]interface{}{"default_redirect_url": uiTS.URL + "/welcome"}},
+			})
+			defer viper.Set(key, hookConfig(returnTS.URL))
+
+			for subject, verified := range map[string]bool{"link-mitigate@ory.sh": true, "link-mitigate-unverified@ory.sh": false} {
+				idToken = map[string]interface{}{"email": subject, "email_verified": verified}
+				i := createIdentity(t, subject, "some-password-123")
+
+				r := nrr(t, returnTS.URL, time.Minute)
+				res, body := mr(t, "valid", r.ID, url.Values{})
+				assert.Equal(t, "/welcome", res.Request.URL.Path, "%s", body)
+				assert.Empty(t, credentialIdentifiers(t, i.ID))
+
+				message, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+				require.NoError(t, err)
+				assert.Equal(t, subject, message.Recipient)
+				assert.Equal(t, "Someone tried to sign up with your email address", message.Subject)
+			}
+		})
+	})
+
+	t.Run("case=should pass registration with PKCE and a nonce", func(t *testing.T) {
+		key := configuration.ViperKeySelfServiceStrategyConfig + "." + string(identity.CredentialsTypeOIDC)
+		providers := append([]oidc.Configuration{}, cb["config"].(*oidc.ConfigurationCollection).Providers...)
+		providers[0].PKCE, providers[0].Nonce = oidc.UsageForce, oidc.UsageForce
+		viper.Set(key, map[string]interface{}{"config": &oidc.ConfigurationCollection{Providers: providers}})
+		defer viper.Set(key, cb)
+
+		subject = "pkce@ory.sh"
+		scope = []string{"openid"}
+
+		r := nrr(t, returnTS.URL, time.Minute)
+		res, body := mr(t, "valid", r.ID, url.Values{"traits.name": {"valid-name"}})
+		ai(t, res, body)
+	})
+
+	t.Run("case=should fail if the state was issued to another browser", func(t *testing.T) {
+		subject = "state@ory.sh"
+		scope = []string{"openid"}
+
+		jar, _ := cookiejar.New(nil)
+		c := newClient(t, jar)
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if strings.HasPrefix(req.URL.String(), remotePublic) {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}
+
+		r := nlr(t, returnTS.URL, time.Minute)
+		res, err := c.PostForm(ts.URL+oidc.BasePath+"/auth/"+r.ID.String(), url.Values{"provider": {"valid"}})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		require.Equal(t, http.StatusFound, res.StatusCode)
+
+		// The browser which completes the flow has a different CSRF token than the one which started it.
+		reg.WithCSRFTokenGenerator(x.FakeCSRFTokenGeneratorWithToken("another-browser"))
+		defer reg.WithCSRFTokenGenerator(x.FakeCSRFTokenGenerator)
+
+		res, err = newClient(t, jar).Get(res.Header.Get("Location"))
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, res.Body.Close())
+		require.NoError(t, err)
+		ase(t, res, body, http.StatusBadRequest, "state parameter does not belong to this flow")
+	})
+
+	t.Run("case=home realm discovery", func(t *testing.T) {
+		key := configuration.ViperKeySelfServiceStrategyConfig + "." + string(identity.CredentialsTypeOIDC)
+		providers := append([]oidc.Configuration{}, cb["config"].(*oidc.ConfigurationCollection).Providers...)
+		providers[0].Domains = []string{"ory.sh"}
+		viper.Set(key, map[string]interface{}{"config": &oidc.ConfigurationCollection{Providers: providers}})
+		defer viper.Set(key, cb)
+
+		discover := func(t *testing.T, r *login.Request, email string) (*http.Response, []byte) {
+			res, err := newClient(t, nil).PostForm(ts.URL+oidc.BasePath+"/discover/"+r.ID.String(), url.Values{"email": {email}})
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, res.Body.Close())
+			require.NoError(t, err)
+			return res, body
+		}
+
+		t.Run("case=should sign in using the provider of the domain", func(t *testing.T) {
+			subject = "discovery@ory.sh"
+			scope = []string{"openid"}
+
+			res, body := discover(t, nlr(t, returnTS.URL, time.Minute), "discovery@ORY.sh")
+			ai(t, res, body)
+		})
+
+		t.Run("case=should fall back to the password method", func(t *testing.T) {
+			r := nlr(t, returnTS.URL, time.Minute)
+			r.Methods[identity.CredentialsTypePassword] = &login.RequestMethod{
+				Method: identity.CredentialsTypePassword,
+				Config: &login.RequestMethodConfig{RequestMethodConfigurator: form.NewHTMLForm("")},
+			}
+			require.NoError(t, reg.LoginRequestPersister().UpdateLoginRequestMethod(context.Background(), r.ID, identity.CredentialsTypePassword, r.Methods[identity.CredentialsTypePassword]))
+
+			res, body := discover(t, r, "someone@example.org")
+			require.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+			assert.Equal(t, "someone@example.org", gjson.GetBytes(body, `methods.password.config.fields.#(name=="identifier").value`).String(), "%s", body)
+		})
+
+		t.Run("case=should fail without a method for the domain", func(t *testing.T) {
+			res, body := discover(t, nlr(t, returnTS.URL, time.Minute), "someone@example.org")
+			ase(t, res, body, http.StatusBadRequest, "No sign in method is available")
+		})
+
+		t.Run("case=should fail without an email address", func(t *testing.T) {
+			res, body := discover(t, nlr(t, returnTS.URL, time.Minute), "not-an-email")
+			require.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+			assert.Contains(t, gjson.GetBytes(body, `methods.oidc.config.fields.#(name=="email").errors.0.message`).String(), "not-an-email", "%s", body)
+		})
+	})
+
 	t.Run("case=should redirect to default return ts when sending authenticated login request without forced flag", func(t *testing.T) {
 		subject = "no-reauth-login@ory.sh"
 		scope = []string{"openid"}
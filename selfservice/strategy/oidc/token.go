@@ -0,0 +1,327 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+const TokensPath = "/identities/:id/credentials/oidc/tokens"
+
+type (
+	tokenHandlerDependencies interface {
+		identity.PrivilegedPoolProvider
+		cipher.Provider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	TokenHandlerProvider interface {
+		OIDCTokenHandler() *TokenHandler
+	}
+	TokenHandler struct {
+		d tokenHandlerDependencies
+		c configuration.Provider
+	}
+
+	// ProviderTokens are the tokens an OpenID Connect provider issued for an identity.
+	//
+	// swagger:model oidcProviderTokens
+	ProviderTokens struct {
+		// required: true
+		Provider string `json:"provider"`
+
+		// required: true
+		Subject string `json:"subject"`
+
+		// required: true
+		AccessToken string `json:"access_token"`
+
+		RefreshToken string `json:"refresh_token,omitempty"`
+
+		IDToken string `json:"id_token,omitempty"`
+
+		// ExpiresAt is the time the access token expires at. It is not set if the provider did not tell.
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+)
+
+func NewTokenHandler(d tokenHandlerDependencies, c configuration.Provider) *TokenHandler {
+	return &TokenHandler{d: d, c: c}
+}
+
+func (h *TokenHandler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(TokensPath, h.tokens)
+}
+
+// A list of OpenID Connect provider tokens.
+//
+// swagger:response oidcProviderTokens
+// nolint:deadcode,unused
+type oidcProviderTokensResponse struct {
+	// in: body
+	Body []ProviderTokens
+}
+
+// swagger:parameters getIdentityOIDCTokens
+// nolint:deadcode,unused
+type getIdentityOIDCTokensParameters struct {
+	// ID must be set to the ID of the identity.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// Refresh, if true, refreshes the tokens even if the access token has not expired yet.
+	//
+	// in: query
+	Refresh bool `json:"refresh"`
+}
+
+// swagger:route GET /identities/{id}/credentials/oidc/tokens admin getIdentityOIDCTokens
+//
+// Get the OpenID Connect provider tokens of an identity
+//
+// Returns the tokens the OpenID Connect providers issued when the identity signed in, so that backends can call
+// provider APIs on behalf of the user. Access tokens which have expired are refreshed using the refresh token.
+//
+// This endpoint returns secrets and must only be exposed to trusted backends.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: oidcProviderTokens
+//       404: genericError
+//       500: genericError
+func (h *TokenHandler) tokens(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	i, err := h.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	c, ok := i.GetCredentials(identity.CredentialsTypeOIDC)
+	if !ok {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("The identity has no OpenID Connect credentials.")))
+		return
+	}
+
+	var o []CredentialsConfig
+	if err := json.NewDecoder(bytes.NewBuffer(c.Config)).Decode(&o); err != nil {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrInternalServerError.WithReason("The OpenID Connect credentials could not be decoded properly").WithDebug(err.Error())))
+		return
+	}
+
+	var (
+		force   = r.URL.Query().Get("refresh") == "true"
+		changed bool
+		result  = make([]ProviderTokens, 0, len(o))
+	)
+	for k := range o {
+		if o[k].AccessToken == "" {
+			// The credentials were created before tokens were stored.
+			continue
+		}
+
+		token, err := decryptTokens(h.d.Cipher(), o[k])
+		if err != nil {
+			h.d.Writer().WriteError(w, r, err)
+			return
+		}
+
+		if token.RefreshToken != "" && (force || !token.Valid()) {
+			if token, err = h.refresh(r.Context(), o[k].Provider, token, force); err != nil {
+				h.d.Writer().WriteError(w, r, err)
+				return
+			}
+
+			if err := encryptTokens(h.d.Cipher(), &o[k], token); err != nil {
+				h.d.Writer().WriteError(w, r, err)
+				return
+			}
+			changed = true
+		}
+
+		idToken, _ := token.Extra("id_token").(string)
+		result = append(result, ProviderTokens{
+			Provider:     o[k].Provider,
+			Subject:      o[k].Subject,
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			IDToken:      idToken,
+			ExpiresAt:    o[k].ExpiresAt,
+		})
+	}
+
+	if changed {
+		if err := storeCredentialsConfig(r.Context(), h.d.PrivilegedIdentityPool(), i.ID, o); err != nil {
+			h.d.Writer().WriteError(w, r, err)
+			return
+		}
+	}
+
+	h.d.Writer().Write(w, r, result)
+}
+
+func (h *TokenHandler) refresh(ctx context.Context, pid string, token *oauth2.Token, force bool) (*oauth2.Token, error) {
+	ctx = outboundContext(ctx)
+	provider, err := findProvider(h.c, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := provider.(TokenExchanger); ok {
+		// Providers with a non-standard token endpoint do not support refreshing tokens using the OAuth2 flow.
+		return token, nil
+	}
+
+	conf, err := provider.OAuth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken := token.Extra("id_token")
+	if force {
+		// The token source only refreshes tokens which are no longer valid.
+		token.AccessToken = ""
+	}
+
+	refreshed, err := conf.TokenSource(ctx, token).Token()
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`Unable to refresh the tokens of OpenID Connect Provider "%s".`, pid).WithDebug(err.Error()))
+	}
+
+	x.ContextLogger(ctx, h.d.Logger()).WithField("provider", pid).Debug("Refreshed OpenID Connect provider tokens.")
+
+	if _, ok := refreshed.Extra("id_token").(string); !ok && idToken != nil {
+		// Providers do not always return an ID token when refreshing, so the previous one is kept.
+		refreshed = refreshed.WithExtra(map[string]interface{}{"id_token": idToken})
+	}
+	return refreshed, nil
+}
+
+// updateTokens stores the tokens the provider issued when the identity signed in. Failing to store them does not
+// fail the sign in because the tokens are not needed for it.
+func (s *Strategy) updateTokens(ctx context.Context, iid uuid.UUID, o []CredentialsConfig, k int, token *oauth2.Token) {
+	err := encryptTokens(s.d.Cipher(), &o[k], token)
+	if err == nil {
+		err = storeCredentialsConfig(ctx, s.d.PrivilegedIdentityPool(), iid, o)
+	}
+
+	if err != nil {
+		x.ContextLogger(ctx, s.d.Logger()).WithError(err).WithField("provider", o[k].Provider).Warn("Unable to store the tokens issued by the OpenID Connect provider.")
+	}
+}
+
+// storeCredentialsConfig replaces the config of the OpenID Connect credentials of the identity.
+func storeCredentialsConfig(ctx context.Context, pool identity.PrivilegedPool, iid uuid.UUID, o []CredentialsConfig) error {
+	i, err := pool.GetIdentityConfidential(ctx, iid)
+	if err != nil {
+		return err
+	}
+
+	c, ok := i.GetCredentials(identity.CredentialsTypeOIDC)
+	if !ok {
+		return errors.WithStack(herodot.ErrNotFound.WithReason("The identity has no OpenID Connect credentials."))
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(o); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode OpenID Connect options to JSON: %s", err))
+	}
+
+	c.Config = b.Bytes()
+	i.SetCredentials(identity.CredentialsTypeOIDC, *c)
+	return pool.UpdateIdentity(ctx, i)
+}
+
+// encryptTokens sets the encrypted tokens on the credentials config. The ID token is kept if the token does not
+// contain one.
+func encryptTokens(c cipher.Cipher, o *CredentialsConfig, token *oauth2.Token) error {
+	if token == nil {
+		return nil
+	}
+
+	encrypt := func(plaintext string) (string, error) {
+		if plaintext == "" {
+			return "", nil
+		}
+		return c.Encrypt([]byte(plaintext))
+	}
+
+	var err error
+	if o.AccessToken, err = encrypt(token.AccessToken); err != nil {
+		return err
+	}
+
+	if o.RefreshToken, err = encrypt(token.RefreshToken); err != nil {
+		return err
+	}
+
+	if idToken, ok := token.Extra("id_token").(string); ok && idToken != "" {
+		if o.IDToken, err = encrypt(idToken); err != nil {
+			return err
+		}
+	}
+
+	o.ExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		expiry := token.Expiry.UTC()
+		o.ExpiresAt = &expiry
+	}
+
+	return nil
+}
+
+// decryptTokens returns the tokens stored in the credentials config.
+func decryptTokens(c cipher.Cipher, o CredentialsConfig) (*oauth2.Token, error) {
+	decrypt := func(ciphertext string) (string, error) {
+		if ciphertext == "" {
+			return "", nil
+		}
+		plaintext, err := c.Decrypt(ciphertext)
+		return string(plaintext), err
+	}
+
+	var (
+		token = new(oauth2.Token)
+		err   error
+	)
+	if token.AccessToken, err = decrypt(o.AccessToken); err != nil {
+		return nil, err
+	}
+
+	if token.RefreshToken, err = decrypt(o.RefreshToken); err != nil {
+		return nil, err
+	}
+
+	if o.ExpiresAt != nil {
+		token.Expiry = *o.ExpiresAt
+	}
+
+	if o.IDToken != "" {
+		idToken, err := decrypt(o.IDToken)
+		if err != nil {
+			return nil, err
+		}
+		token = token.WithExtra(map[string]interface{}{"id_token": idToken})
+	}
+
+	return token, nil
+}
@@ -0,0 +1,188 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/strategy/oidc"
+	"github.com/ory/kratos/x"
+)
+
+func TestTokenHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	var refreshed int32
+	mux := http.NewServeMux()
+	provider := httptest.NewServer(mux)
+	defer provider.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                provider.URL,
+			"authorization_endpoint":                provider.URL + "/auth",
+			"token_endpoint":                        provider.URL + "/token",
+			"jwks_uri":                              provider.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "refresh-token-1", r.PostForm.Get("refresh_token"))
+		atomic.AddInt32(&refreshed, 1)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token-2",
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/registration.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeOIDC), map[string]interface{}{
+		"config": &oidc.ConfigurationCollection{
+			Providers: []oidc.Configuration{
+				{
+					Provider:     "generic",
+					ID:           "valid",
+					ClientID:     "client",
+					ClientSecret: "secret",
+					IssuerURL:    provider.URL,
+					SchemaURL:    "file://./stub/hydra.schema.json",
+				},
+			},
+		},
+	})
+
+	admin := x.NewRouterAdmin()
+	reg.OIDCTokenHandler().RegisterAdminRoutes(admin)
+	ts := httptest.NewServer(admin)
+	defer ts.Close()
+
+	encrypt := func(t *testing.T, plaintext string) string {
+		ciphertext, err := reg.Cipher().Encrypt([]byte(plaintext))
+		require.NoError(t, err)
+		return ciphertext
+	}
+
+	createIdentity := func(t *testing.T, expiresAt time.Time) *identity.Identity {
+		subject := x.NewUUID().String()
+		config, err := json.Marshal([]oidc.CredentialsConfig{
+			{
+				Subject:      subject,
+				Provider:     "valid",
+				AccessToken:  encrypt(t, "access-token-1"),
+				RefreshToken: encrypt(t, "refresh-token-1"),
+				IDToken:      encrypt(t, "id-token-1"),
+				ExpiresAt:    &expiresAt,
+			},
+			// Credentials which were created before tokens were stored.
+			{Subject: subject, Provider: "legacy"},
+		})
+		require.NoError(t, err)
+
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(`{"subject":"` + subject + `@ory.sh"}`)
+		i.SetCredentials(identity.CredentialsTypeOIDC, identity.Credentials{
+			Type:        identity.CredentialsTypeOIDC,
+			Identifiers: []string{"valid:" + subject, "legacy:" + subject},
+			Config:      config,
+		})
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i
+	}
+
+	get := func(t *testing.T, id uuid.UUID, query string) (int, []byte) {
+		res, err := ts.Client().Get(ts.URL + strings.Replace(oidc.TokensPath, ":id", id.String(), 1) + query)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, body
+	}
+
+	storedConfig := func(t *testing.T, id uuid.UUID) string {
+		i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id)
+		require.NoError(t, err)
+		c, ok := i.GetCredentials(identity.CredentialsTypeOIDC)
+		require.True(t, ok)
+		return string(c.Config)
+	}
+
+	t.Run("case=returns the decrypted tokens", func(t *testing.T) {
+		i := createIdentity(t, time.Now().Add(time.Hour))
+
+		status, body := get(t, i.ID, "")
+		require.Equal(t, http.StatusOK, status, "%s", body)
+		assert.Len(t, gjson.ParseBytes(body).Array(), 1, "%s", body)
+		assert.Equal(t, "valid", gjson.GetBytes(body, "0.provider").String(), "%s", body)
+		assert.Equal(t, "access-token-1", gjson.GetBytes(body, "0.access_token").String(), "%s", body)
+		assert.Equal(t, "refresh-token-1", gjson.GetBytes(body, "0.refresh_token").String(), "%s", body)
+		assert.Equal(t, "id-token-1", gjson.GetBytes(body, "0.id_token").String(), "%s", body)
+		assert.EqualValues(t, 0, atomic.LoadInt32(&refreshed))
+	})
+
+	t.Run("case=refreshes expired tokens", func(t *testing.T) {
+		atomic.StoreInt32(&refreshed, 0)
+		i := createIdentity(t, time.Now().Add(-time.Hour))
+
+		status, body := get(t, i.ID, "")
+		require.Equal(t, http.StatusOK, status, "%s", body)
+		assert.Equal(t, "access-token-2", gjson.GetBytes(body, "0.access_token").String(), "%s", body)
+		assert.Equal(t, "refresh-token-1", gjson.GetBytes(body, "0.refresh_token").String(), "the refresh token must be kept: %s", body)
+		assert.Equal(t, "id-token-1", gjson.GetBytes(body, "0.id_token").String(), "the id token must be kept: %s", body)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&refreshed))
+
+		config := storedConfig(t, i.ID)
+		assert.NotContains(t, config, "access-token", "tokens must be stored encrypted")
+
+		status, body = get(t, i.ID, "")
+		require.Equal(t, http.StatusOK, status, "%s", body)
+		assert.Equal(t, "access-token-2", gjson.GetBytes(body, "0.access_token").String(), "%s", body)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&refreshed), "the refreshed tokens must have been stored")
+	})
+
+	t.Run("case=refreshes when forced", func(t *testing.T) {
+		atomic.StoreInt32(&refreshed, 0)
+		i := createIdentity(t, time.Now().Add(time.Hour))
+
+		status, body := get(t, i.ID, "?refresh=true")
+		require.Equal(t, http.StatusOK, status, "%s", body)
+		assert.Equal(t, "access-token-2", gjson.GetBytes(body, "0.access_token").String(), "%s", body)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&refreshed))
+	})
+
+	t.Run("case=identity without OpenID Connect credentials", func(t *testing.T) {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(`{"subject":"no-oidc@ory.sh"}`)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		status, body := get(t, i.ID, "")
+		assert.Equal(t, http.StatusNotFound, status, "%s", body)
+	})
+
+	t.Run("case=unknown identity", func(t *testing.T) {
+		status, body := get(t, x.NewUUID(), "")
+		assert.Equal(t, http.StatusNotFound, status, "%s", body)
+	})
+}
@@ -1,6 +1,8 @@
 package oidc
 
 import (
+	"time"
+
 	"github.com/gofrs/uuid"
 
 	"github.com/ory/kratos/selfservice/form"
@@ -10,12 +12,25 @@ import (
 type CredentialsConfig struct {
 	Subject  string `json:"subject"`
 	Provider string `json:"provider"`
+
+	// AccessToken, RefreshToken, and IDToken are the tokens issued by the provider. They are encrypted with the
+	// cipher secrets and empty for credentials which were created before tokens were stored.
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	// ExpiresAt is the time the access token expires at. It is not set if the provider did not tell.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // swagger:model oidcRequestMethodConfig
 type RequestMethod struct {
 	*form.HTMLForm
 	Providers []form.Field `json:"providers"`
+
+	// Discovery is the home realm discovery form. It is only set for login requests if at least one provider is
+	// configured for an email domain.
+	Discovery *form.HTMLForm `json:"discovery,omitempty"`
 }
 
 func (r *RequestMethod) AddProviders(providers []Configuration) *RequestMethod {
@@ -5,13 +5,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
 
 	"github.com/ory/herodot"
 	"github.com/ory/x/urlx"
 
+	"github.com/ory/kratos/i18n"
 	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/schema"
 	"github.com/ory/kratos/selfservice/flow/login"
@@ -20,11 +23,13 @@ import (
 )
 
 const (
-	LoginPath = "/self-service/browser/flows/login/strategies/password"
+	LoginPath         = "/self-service/browser/flows/login/strategies/password"
+	LoginRotationPath = "/self-service/browser/flows/login/strategies/password/rotate"
 )
 
 func (s *Strategy) RegisterLoginRoutes(r *x.RouterPublic) {
 	r.POST(LoginPath, s.handleLogin)
+	r.POST(LoginRotationPath, s.handleLoginRotation)
 }
 
 func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, rr *login.Request, err error) {
@@ -79,13 +84,21 @@ func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprou
 		return
 	}
 
-	if err := ar.Valid(); err != nil {
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.FlowBinder().Verify(r, ar.ID, ar.Binding); err != nil {
 		s.handleLoginError(w, r, ar, err)
 		return
 	}
 
 	i, c, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), s.ID(), p.Identifier)
 	if err != nil {
+		if s.c.SecurityAccountEnumerationMitigate() {
+			s.compareDummyPassword(p.Password)
+		}
 		s.handleLoginError(w, r, ar, errors.WithStack(schema.NewInvalidCredentialsError()))
 		return
 	}
@@ -98,17 +111,180 @@ func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprou
 	}
 
 	if err := s.d.PasswordHasher().Compare([]byte(p.Password), []byte(o.HashedPassword)); err != nil {
+		s.d.LoginHistory().Record(r, i.ID, identity.CredentialsTypePassword, false)
 		s.handleLoginError(w, r, ar, errors.WithStack(schema.NewInvalidCredentialsError()))
 		return
 	}
 
-	if err := s.d.LoginHookExecutor().PostLoginHook(w, r,
+	if o.Expired(s.c.SelfServicePasswordMaxAge()) {
+		s.requirePasswordRotation(w, r, ar, i)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypePassword,
 		s.d.PostLoginHooks(identity.CredentialsTypePassword), ar, i); err != nil {
 		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
 	}
 }
 
+// requirePasswordRotation is called when the identity authenticated successfully but the password has expired. Instead
+// of issuing a session, the login request's password form is replaced by a form which asks for a new password.
+func (s *Strategy) requirePasswordRotation(w http.ResponseWriter, r *http.Request, ar *login.Request, i *identity.Identity) {
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestPasswordRotation(r.Context(), ar.ID, uuid.NullUUID{UUID: i.ID, Valid: true}); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	action := urlx.CopyWithQuery(
+		urlx.AppendPaths(s.c.SelfPublicURL(), LoginRotationPath),
+		url.Values{"request": {ar.ID.String()}},
+	)
+
+	f := &form.HTMLForm{
+		Action: action.String(),
+		Method: "POST",
+		Fields: form.Fields{
+			{
+				Name:     "password",
+				Type:     "password",
+				Required: true,
+			},
+		},
+	}
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.AddError(&form.Error{ID: form.ErrorIDPasswordExpired, Message: "Your password has expired, please choose a new password."})
+
+	method := &login.RequestMethod{
+		Method: identity.CredentialsTypePassword,
+		Config: &login.RequestMethodConfig{RequestMethodConfigurator: &RequestMethod{HTMLForm: f}},
+	}
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestMethod(r.Context(), ar.ID, identity.CredentialsTypePassword, method); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(s.c.LoginURL(), url.Values{"request": {ar.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
+func (s *Strategy) handleLoginRotationError(w http.ResponseWriter, r *http.Request, rr *login.Request, err error) {
+	if rr != nil {
+		if method, ok := rr.Methods[identity.CredentialsTypePassword]; ok {
+			method.Config.Reset()
+			method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+			rr.Methods[identity.CredentialsTypePassword] = method
+		}
+	}
+
+	s.d.LoginRequestErrorHandler().HandleLoginError(w, r, identity.CredentialsTypePassword, rr, err)
+}
+
+func (s *Strategy) handleLoginRotation(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rid := x.ParseUUID(r.URL.Query().Get("request"))
+	if x.IsZeroUUID(rid) {
+		s.handleLoginRotationError(w, r, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The request query parameter is missing or invalid.")))
+		return
+	}
+
+	ar, err := s.d.LoginRequestPersister().GetLoginRequest(r.Context(), rid)
+	if err != nil {
+		s.handleLoginRotationError(w, r, nil, err)
+		return
+	}
+
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.FlowBinder().Verify(r, ar.ID, ar.Binding); err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	if !ar.PasswordRotationIdentityID.Valid {
+		s.handleLoginRotationError(w, r, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The login request does not require a new password.")))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.handleLoginRotationError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	pw := r.PostForm.Get("password")
+	if len(pw) == 0 {
+		s.handleLoginRotationError(w, r, ar, schema.NewRequiredError("#/", "password"))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ar.PasswordRotationIdentityID.UUID)
+	if err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	c, ok := i.GetCredentials(s.ID())
+	if !ok {
+		s.handleLoginRotationError(w, r, ar, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The identity does not have any password credentials.")))
+		return
+	}
+
+	var o CredentialsConfig
+	if err := json.NewDecoder(bytes.NewBuffer(c.Config)).Decode(&o); err != nil {
+		s.handleLoginRotationError(w, r, ar, errors.WithStack(herodot.ErrInternalServerError.WithReason("The password credentials could not be decoded properly").WithDebug(err.Error())))
+		return
+	}
+
+	if err := s.d.PasswordHasher().Compare([]byte(pw), []byte(o.HashedPassword)); err == nil {
+		s.handleLoginRotationError(w, r, ar, schema.NewPasswordPolicyViolationError("#/password", "the new password must be different from the expired password"))
+		return
+	}
+
+	if err := s.validatePassword(c.Identifiers, pw); err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	hpw, err := s.d.PasswordHasher().Generate([]byte(pw))
+	if err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	co, err := json.Marshal(&CredentialsConfig{HashedPassword: string(hpw), PasswordChangedAt: time.Now().UTC()})
+	if err != nil {
+		s.handleLoginRotationError(w, r, ar, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err)))
+		return
+	}
+
+	c.Config = co
+	i.SetCredentials(s.ID(), *c)
+	if err := s.d.IdentityManager().Update(r.Context(), i); err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestPasswordRotation(r.Context(), ar.ID, uuid.NullUUID{}); err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.NotificationSender().NotifyPasswordChanged(i18n.WithLocale(r.Context(), ar.Locale), i); err != nil {
+		s.handleLoginRotationError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypePassword,
+		s.d.PostLoginHooks(identity.CredentialsTypePassword), ar, i.CopyWithoutCredentials()); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+}
+
 func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Request) error {
 	if err := r.ParseForm(); err != nil {
 		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode POST body: %s", err))
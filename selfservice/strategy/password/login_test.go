@@ -192,6 +192,34 @@ func TestLoginNew(t *testing.T) {
 		assert.Contains(t, gjson.GetBytes(body, "methods.password.config.errors.0").String(), "expired", "%s", body)
 	})
 
+	t.Run("should show the error in the login request because the origin csrf check failed", func(t *testing.T) {
+		csrf := x.NewOriginCSRFHandler(router, reg.Writer(), reg.Logger(), "/", "", false, http.SameSiteLaxMode, []string{uiTs.URL})
+		csrf.HandleFailureGlob(password.LoginPath, reg.LoginRequestErrorHandler().HandleCSRFFailure(identity.CredentialsTypePassword))
+		csrfTs := httptest.NewServer(csrf)
+		defer csrfTs.Close()
+
+		lr := nlr(time.Hour)
+		require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+
+		req, err := http.NewRequest("POST", csrfTs.URL+password.LoginPath+"?request="+lr.ID.String(), strings.NewReader(url.Values{
+			"identifier": {"identifier"},
+			"password":   {"password"},
+		}.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", "https://evil.ory.sh")
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		require.Contains(t, res.Request.URL.Path, "login-ts", "%s", body)
+		assert.Equal(t, lr.ID.String(), gjson.GetBytes(body, "id").String(), "%s", body)
+		assert.Equal(t, x.CSRFErrorID, gjson.GetBytes(body, "methods.password.config.errors.0.id").String(), "%s", body)
+	})
+
 	t.Run("should return an error because the credentials are invalid (user does not exist)", func(t *testing.T) {
 		lr := nlr(time.Hour)
 		res, body := makeRequest(lr, url.Values{
@@ -205,6 +233,20 @@ func TestLoginNew(t *testing.T) {
 		assert.Equal(t, `the provided credentials are invalid, check for spelling mistakes in your password or username, email address, or phone number`, gjson.GetBytes(body, "methods.password.config.errors.0.message").String())
 	})
 
+	t.Run("should return the same error for unknown users when mitigating account enumeration", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, true)
+		defer viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, false)
+
+		lr := nlr(time.Hour)
+		res, body := makeRequest(lr, url.Values{
+			"identifier": {"identifier"},
+			"password":   {"password"},
+		}.Encode(), nil, nil)
+
+		require.Contains(t, res.Request.URL.Path, "login-ts")
+		assert.Equal(t, form.ErrorIDInvalidCredentials, gjson.GetBytes(body, "methods.password.config.errors.0.id").String(), "%s", body)
+	})
+
 	t.Run("should return an error because no identifier is set", func(t *testing.T) {
 		lr := nlr(time.Hour)
 		res, body := makeRequest(lr, url.Values{
@@ -374,3 +416,119 @@ func TestLoginNew(t *testing.T) {
 		assert.Equal(t, gjson.GetBytes(body1, "sid").String(), gjson.GetBytes(body2, "sid").String(), "%s\n\n%s\n", body1, body2)
 	})
 }
+
+func TestLoginPasswordRotation(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	router := x.NewRouterPublic()
+	reg.LoginStrategies().MustStrategy(identity.CredentialsTypePassword).(*password.Strategy).RegisterLoginRoutes(router)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	errTs, uiTs, returnTs := errorx.NewErrorTestServer(t, reg), httptest.NewServer(login.TestRequestHandler(t, reg)), newReturnTs(t, reg)
+	defer errTs.Close()
+	defer uiTs.Close()
+	defer returnTs.Close()
+
+	viper.Set(configuration.ViperKeyURLsError, errTs.URL+"/error-ts")
+	viper.Set(configuration.ViperKeyURLsLogin, uiTs.URL+"/login-ts")
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeySelfServiceLoginAfterConfig+"."+string(identity.CredentialsTypePassword), hookConfig(returnTs.URL+"/return-ts"))
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/login.schema.json")
+	viper.Set(configuration.ViperKeySecretsSession, []string{"not-a-secure-session-key"})
+	viper.Set(configuration.ViperKeyURLsDefaultReturnTo, returnTs.URL+"/return-ts")
+	viper.Set(configuration.ViperKeySelfServicePasswordMaxAge, "1h")
+
+	createIdentity := func(t *testing.T, identifier, pwd string, config string) {
+		p, _ := reg.PasswordHasher().Generate([]byte(pwd))
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), &identity.Identity{
+			ID:     x.NewUUID(),
+			Traits: identity.Traits(fmt.Sprintf(`{"subject":"%s"}`, identifier)),
+			Credentials: map[identity.CredentialsType]identity.Credentials{
+				identity.CredentialsTypePassword: {
+					Type:        identity.CredentialsTypePassword,
+					Identifiers: []string{identifier},
+					Config:      json.RawMessage(`{"hashed_password":"` + string(p) + `",` + config + `}`),
+				},
+			},
+		}))
+	}
+
+	post := func(t *testing.T, c *http.Client, href string, values url.Values) (*http.Response, []byte) {
+		res, err := c.PostForm(href, values)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		return res, body
+	}
+
+	doLogin := func(t *testing.T, identifier, pwd string) (*http.Client, *login.Request, *http.Response, []byte) {
+		lr := nlr(time.Hour)
+		lr.RequestURL = ts.URL
+		require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+
+		c := ts.Client()
+		c.Jar, _ = cookiejar.New(&cookiejar.Options{})
+		res, body := post(t, c, ts.URL+password.LoginPath+"?request="+lr.ID.String(), url.Values{
+			"identifier": {identifier},
+			"password":   {pwd},
+		})
+		return c, lr, res, body
+	}
+
+	t.Run("case=should issue a session because the password is not expired", func(t *testing.T) {
+		identifier, pwd := "rotation-identifier-1", "password"
+		createIdentity(t, identifier, pwd, fmt.Sprintf(`"password_changed_at":"%s"`, time.Now().UTC().Format(time.RFC3339)))
+
+		_, _, res, body := doLogin(t, identifier, pwd)
+		require.Contains(t, res.Request.URL.Path, "return-ts", "%s", body)
+		assert.Equal(t, identifier, gjson.GetBytes(body, "identity.traits.subject").String(), "%s", body)
+	})
+
+	for k, tc := range []struct {
+		d      string
+		config string
+	}{
+		{d: "password is too old", config: fmt.Sprintf(`"password_changed_at":"%s"`, time.Now().UTC().Add(-2*time.Hour).Format(time.RFC3339))},
+		{d: "password was expired by an administrator", config: `"force_change":true`},
+	} {
+		t.Run(fmt.Sprintf("case=%d/description=should require a new password because the %s", k, tc.d), func(t *testing.T) {
+			identifier, pwd := fmt.Sprintf("rotation-identifier-expired-%d", k), "password"
+			createIdentity(t, identifier, pwd, tc.config)
+
+			c, lr, res, body := doLogin(t, identifier, pwd)
+			require.Contains(t, res.Request.URL.Path, "login-ts", "%s", body)
+			assert.Equal(t, lr.ID.String(), gjson.GetBytes(body, "id").String(), "%s", body)
+			assert.Contains(t, gjson.GetBytes(body, "methods.password.config.errors.0.message").String(), "expired", "%s", body)
+			action := gjson.GetBytes(body, "methods.password.config.action").String()
+			assert.Contains(t, action, password.LoginRotationPath, "%s", body)
+
+			t.Run("case=should not accept the old password", func(t *testing.T) {
+				res, body := post(t, c, action, url.Values{"password": {pwd}})
+				require.Contains(t, res.Request.URL.Path, "login-ts", "%s", body)
+				assert.Contains(t, gjson.GetBytes(body, "methods.password.config.errors.0.message").String(), "must be different", "%s", body)
+			})
+
+			t.Run("case=should issue a session after choosing a new password", func(t *testing.T) {
+				res, body := post(t, c, action, url.Values{"password": {"a-new-Secure-Password-81934"}})
+				require.Contains(t, res.Request.URL.Path, "return-ts", "%s", body)
+				assert.Equal(t, identifier, gjson.GetBytes(body, "identity.traits.subject").String(), "%s", body)
+
+				i, creds, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypePassword, identifier)
+				require.NoError(t, err)
+				assert.NotEmpty(t, i.ID)
+				assert.False(t, gjson.GetBytes(creds.Config, "force_change").Bool(), "%s", creds.Config)
+				assert.WithinDuration(t, time.Now(), gjson.GetBytes(creds.Config, "password_changed_at").Time(), time.Minute)
+			})
+
+			t.Run("case=should not allow reusing the rotation request", func(t *testing.T) {
+				res, body := post(t, c, action, url.Values{"password": {"another-Secure-Password-81934"}})
+				require.Contains(t, res.Request.URL.Path, "error-ts", "%s", body)
+				assert.Contains(t, gjson.GetBytes(body, "0.reason").String(), "does not require a new password", "%s", body)
+			})
+		})
+	}
+}
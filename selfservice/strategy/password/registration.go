@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/ory/kratos/driver/configuration"
 
@@ -69,7 +70,7 @@ func (s *Strategy) handleRegistrationError(w http.ResponseWriter, r *http.Reques
 
 			method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
 			rr.Methods[identity.CredentialsTypePassword] = method
-			if errSec := method.Config.SortFields(s.c.DefaultIdentityTraitsSchemaURL().String(), "traits"); errSec != nil {
+			if errSec := method.Config.SortFields(s.traitsSchemaURL(), "traits"); errSec != nil {
 				s.d.RegistrationRequestErrorHandler().HandleRegistrationError(w, r, identity.CredentialsTypePassword, rr, errors.Wrap(err, errSec.Error()))
 				return
 			}
@@ -79,8 +80,17 @@ func (s *Strategy) handleRegistrationError(w http.ResponseWriter, r *http.Reques
 	s.d.RegistrationRequestErrorHandler().HandleRegistrationError(w, r, identity.CredentialsTypePassword, rr, err)
 }
 
+// traitsSchemaURL returns the URL of the identity traits schema new identities are created with. It is the schema
+// set as default using the admin API or, if there is none, the configured default.
+func (s *Strategy) traitsSchemaURL() string {
+	if ts, err := s.d.IdentityTraitsSchemas().GetByID(configuration.DefaultIdentityTraitsSchemaID); err == nil {
+		return ts.URL.String()
+	}
+	return s.c.DefaultIdentityTraitsSchemaURL().String()
+}
+
 func (s *Strategy) decoderRegistration() (decoderx.HTTPDecoderOption, error) {
-	raw, err := sjson.SetBytes([]byte(registrationFormPayloadSchema), "properties.traits.$ref", s.c.DefaultIdentityTraitsSchemaURL().String())
+	raw, err := sjson.SetBytes([]byte(registrationFormPayloadSchema), "properties.traits.$ref", s.traitsSchemaURL())
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -106,7 +116,12 @@ func (s *Strategy) handleRegistration(w http.ResponseWriter, r *http.Request, _
 		return
 	}
 
-	if err := ar.Valid(); err != nil {
+	if err := ar.ValidFor(s.c.SelfServiceRegistrationRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleRegistrationError(w, r, ar, nil, err)
+		return
+	}
+
+	if err := s.d.FlowBinder().Verify(r, ar.ID, ar.Binding); err != nil {
 		s.handleRegistrationError(w, r, ar, nil, err)
 		return
 	}
@@ -128,6 +143,11 @@ func (s *Strategy) handleRegistration(w http.ResponseWriter, r *http.Request, _
 		return
 	}
 
+	if err := s.d.RegistrationExecutor().CheckBotSubmission(r, ar); err != nil {
+		s.handleRegistrationError(w, r, ar, &p, err)
+		return
+	}
+
 	if len(p.Password) == 0 {
 		s.handleRegistrationError(w, r, ar, &p, schema.NewRequiredError("#/", "password"))
 		return
@@ -143,7 +163,7 @@ func (s *Strategy) handleRegistration(w http.ResponseWriter, r *http.Request, _
 		return
 	}
 
-	co, err := json.Marshal(&CredentialsConfig{HashedPassword: string(hpw)})
+	co, err := json.Marshal(&CredentialsConfig{HashedPassword: string(hpw), PasswordChangedAt: time.Now().UTC()})
 	if err != nil {
 		s.handleRegistrationError(w, r, ar, &p, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err)))
 		return
@@ -187,7 +207,11 @@ func (s *Strategy) validateCredentials(i *identity.Identity, pw string) error {
 		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("No login identifiers (e.g. email, phone number, username) were set. Contact an administrator, the identity schema is misconfigured."))
 	}
 
-	for _, id := range c.Identifiers {
+	return s.validatePassword(c.Identifiers, pw)
+}
+
+func (s *Strategy) validatePassword(identifiers []string, pw string) error {
+	for _, id := range identifiers {
 		if err := s.d.PasswordValidator().Validate(id, pw); err != nil {
 			if _, ok := errorsx.Cause(err).(*herodot.DefaultError); ok {
 				return err
@@ -205,7 +229,7 @@ func (s *Strategy) PopulateRegistrationMethod(r *http.Request, sr *registration.
 		url.Values{"request": {sr.ID.String()}},
 	)
 
-	htmlf, err := form.NewHTMLFormFromJSONSchema(action.String(), s.c.DefaultIdentityTraitsSchemaURL().String(), "traits", nil)
+	htmlf, err := form.NewHTMLFormFromJSONSchema(action.String(), s.traitsSchemaURL(), "traits", nil)
 	if err != nil {
 		return err
 	}
@@ -213,8 +237,11 @@ func (s *Strategy) PopulateRegistrationMethod(r *http.Request, sr *registration.
 	htmlf.Method = "POST"
 	htmlf.SetCSRF(s.d.GenerateCSRFToken(r))
 	htmlf.SetField(form.Field{Name: "password", Type: "password", Required: true})
+	if field := s.c.SelfServiceRegistrationBotProtection().HoneypotField; len(field) > 0 {
+		htmlf.SetField(form.Field{Name: field, Type: "hidden"})
+	}
 
-	if err := htmlf.SortFields(s.c.DefaultIdentityTraitsSchemaURL().String(), "traits"); err != nil {
+	if err := htmlf.SortFields(s.traitsSchemaURL(), "traits"); err != nil {
 		return err
 	}
 
@@ -2,6 +2,7 @@ package password_test
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -229,6 +230,92 @@ func TestRegistration(t *testing.T) {
 			assert.Contains(t, gjson.GetBytes(body, "methods.password.config.errors.0.message").String(), "an account with the same identifier (email, phone, username, ...) exists already", "%s", body)
 		})
 
+		t.Run("case=should return an error because the email domain is denied", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/registration.schema.json")
+			viper.Set(configuration.ViperKeySelfServiceEmailDomainsDeny, []string{"example.org"})
+			defer viper.Set(configuration.ViperKeySelfServiceEmailDomainsDeny, nil)
+
+			rr := newRegistrationRequest(t, time.Minute)
+			body, res := makeRequest(t, rr.ID, url.Values{
+				"traits.username": {"registration-identifier@sub.example.org"},
+				"password":        {x.NewUUID().String()},
+				"traits.foobar":   {"bar"},
+			}.Encode(), http.StatusOK)
+			assert.Contains(t, res.Request.URL.Path, "signup-ts")
+			assert.Equal(t, form.ErrorIDEmailDomainNotAllowed, gjson.GetBytes(body, "methods.password.config.fields.#(name==traits.username).errors.0.id").String(), "%s", body)
+			assert.Equal(t, "sub.example.org", gjson.GetBytes(body, "methods.password.config.fields.#(name==traits.username).errors.0.context.domain").String(), "%s", body)
+		})
+
+		t.Run("case=should not reveal that the user exists when mitigating account enumeration", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/registration.schema.json")
+			viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, true)
+			defer viper.Set(configuration.ViperKeySecurityAccountEnumerationMitigate, false)
+
+			// Registrations only look alike if they do not sign in, which is why only the redirect hook is used.
+			welcomeTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("welcome"))
+			}))
+			defer welcomeTs.Close()
+			viper.Set(configuration.ViperKeySelfServiceRegistrationAfterConfig+"."+string(identity.CredentialsTypePassword), []map[string]interface{}{
+				{"job": "redirect", "config": map[string]interface{}{"default_redirect_url": welcomeTs.URL + "/welcome"}},
+			})
+			defer viper.Set(configuration.ViperKeySelfServiceRegistrationAfterConfig+"."+string(identity.CredentialsTypePassword), hookConfig(returnTs.URL+"/return-ts"))
+
+			for _, username := range []string{"registration-identifier-mitigate", "registration-identifier-8"} {
+				t.Run("username="+username, func(t *testing.T) {
+					rr := newRegistrationRequest(t, time.Minute)
+					body, res := makeRequest(t, rr.ID, url.Values{
+						"traits.username": {username},
+						"password":        {x.NewUUID().String()},
+						"traits.foobar":   {"bar"},
+					}.Encode(), http.StatusOK)
+					assert.Equal(t, "/welcome", res.Request.URL.Path)
+					assert.Equal(t, "welcome", string(body))
+				})
+			}
+
+			_, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypePassword, "registration-identifier-mitigate")
+			require.NoError(t, err, "the new account was created")
+		})
+
+		t.Run("case=should reject bot submissions", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/registration.schema.json")
+			viper.Set(configuration.ViperKeySelfServiceBotProtectionHoneypotField, "website")
+			defer viper.Set(configuration.ViperKeySelfServiceBotProtectionHoneypotField, "")
+
+			for reason, tc := range map[string]struct {
+				minSubmitTime string
+				website       string
+			}{
+				registration.BotReasonHoneypot: {website: "https://spam.example.org"},
+				registration.BotReasonTooFast:  {minSubmitTime: "1h"},
+			} {
+				t.Run("reason="+reason, func(t *testing.T) {
+					viper.Set(configuration.ViperKeySelfServiceBotProtectionMinSubmitTime, tc.minSubmitTime)
+					defer viper.Set(configuration.ViperKeySelfServiceBotProtectionMinSubmitTime, "")
+					rejected := func() int64 {
+						if v, ok := registration.BotRejected.Get(reason).(*expvar.Int); ok {
+							return v.Value()
+						}
+						return 0
+					}
+					before := rejected()
+
+					rr := newRegistrationRequest(t, time.Minute)
+					body, res := makeRequest(t, rr.ID, url.Values{
+						"traits.username": {"registration-identifier-bot"},
+						"password":        {x.NewUUID().String()},
+						"traits.foobar":   {"bar"},
+						"website":         {tc.website},
+					}.Encode(), http.StatusOK)
+					assert.Contains(t, res.Request.URL.Path, "signup-ts")
+					assert.Equal(t, form.ErrorIDRegistrationFailed, gjson.GetBytes(body, "methods.password.config.errors.0.id").String(), "%s", body)
+					assert.NotContains(t, string(body), reason, "the reason is not revealed")
+					assert.Equal(t, before+1, rejected())
+				})
+			}
+		})
+
 		t.Run("case=should return an error because not passing validation and reset previous errors and values", func(t *testing.T) {
 			viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/registration.schema.json")
 
@@ -1,13 +1,17 @@
 package password
 
 import (
+	"sync"
+
 	"gopkg.in/go-playground/validator.v9"
 
 	"github.com/ory/kratos/driver/configuration"
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/schema"
 	"github.com/ory/kratos/selfservice/errorx"
 	"github.com/ory/kratos/selfservice/flow/login"
 	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/notification"
 	"github.com/ory/kratos/session"
 	"github.com/ory/kratos/x"
 )
@@ -19,6 +23,7 @@ type registrationStrategyDependencies interface {
 	x.LoggingProvider
 	x.WriterProvider
 	x.CSRFTokenGeneratorProvider
+	x.FlowBinderProvider
 
 	errorx.ManagementProvider
 	ValidationProvider
@@ -37,16 +42,25 @@ type registrationStrategyDependencies interface {
 	login.HandlerProvider
 
 	identity.PrivilegedPoolProvider
+	identity.ManagementProvider
 	identity.ValidationProvider
 
 	session.HandlerProvider
 	session.ManagementProvider
+	session.LoginHistoryProvider
+
+	notification.SenderProvider
+
+	IdentityTraitsSchemas() schema.Schemas
 }
 
 type Strategy struct {
 	c configuration.Provider
 	d registrationStrategyDependencies
 	v *validator.Validate
+
+	dummyHash     []byte
+	dummyHashOnce sync.Once
 }
 
 func NewStrategy(
@@ -60,6 +74,24 @@ func NewStrategy(
 	}
 }
 
+// compareDummyPassword compares the password to the hash of a random password. It is used when no identity matches
+// the identifier of a login, so that the login takes as long as a login using a wrong password and does not reveal
+// whether the account exists.
+func (s *Strategy) compareDummyPassword(password string) {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.d.PasswordHasher().Generate([]byte(x.NewUUID().String()))
+		if err != nil {
+			s.d.Logger().WithError(err).Error("Unable to generate the password hash used to mitigate account enumeration.")
+			return
+		}
+		s.dummyHash = hash
+	})
+
+	if s.dummyHash != nil {
+		_ = s.d.PasswordHasher().Compare([]byte(password), s.dummyHash)
+	}
+}
+
 func (s *Strategy) ID() identity.CredentialsType {
 	return identity.CredentialsTypePassword
 }
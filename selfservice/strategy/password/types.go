@@ -1,12 +1,24 @@
 package password
 
-import "github.com/ory/kratos/selfservice/form"
+import (
+	"time"
+
+	"github.com/ory/kratos/selfservice/form"
+)
 
 type (
 	// CredentialsConfig is the struct that is being used as part of the identity credentials.
 	CredentialsConfig struct {
 		// HashedPassword is a hash-representation of the password.
 		HashedPassword string `json:"hashed_password"`
+
+		// PasswordChangedAt is the time (UTC) when the password was last set. It is zero for credentials
+		// which were created before this field was introduced.
+		PasswordChangedAt time.Time `json:"password_changed_at"`
+
+		// ForceChange, if true, requires the identity to choose a new password on its next login. It is set
+		// by administrators through the admin API.
+		ForceChange bool `json:"force_change,omitempty"`
 	}
 
 	// LoginFormPayload is used to decode the login form payload.
@@ -16,6 +28,20 @@ type (
 	}
 )
 
+// Expired returns true if the password must be changed before a session can be issued. A maxAge of zero
+// or less disables age-based expiry. Passwords without a known change date never expire by age.
+func (c *CredentialsConfig) Expired(maxAge time.Duration) bool {
+	if c.ForceChange {
+		return true
+	}
+
+	if maxAge <= 0 || c.PasswordChangedAt.IsZero() {
+		return false
+	}
+
+	return c.PasswordChangedAt.Add(maxAge).Before(time.Now().UTC())
+}
+
 // RequestMethod contains the configuration for this selfservice strategy.
 type RequestMethod struct {
 	*form.HTMLForm
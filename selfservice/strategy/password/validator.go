@@ -18,6 +18,8 @@ import (
 
 	"github.com/ory/herodot"
 	"github.com/ory/x/stringsx"
+
+	"github.com/ory/kratos/egress"
 )
 
 // Validator implements a validation strategy for passwords. One example is that the password
@@ -58,7 +60,7 @@ type DefaultPasswordValidator struct {
 
 func NewDefaultPasswordValidatorStrategy() *DefaultPasswordValidator {
 	return &DefaultPasswordValidator{
-		c:                           httpx.NewResilientClientLatencyToleranceMedium(nil),
+		c:                           httpx.NewResilientClientLatencyToleranceMedium(egress.Default),
 		maxBreachesThreshold:        0,
 		hashes:                      map[string]int64{},
 		ignoreNetworkErrors:         true,
@@ -0,0 +1,136 @@
+package push
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/randx"
+
+	"github.com/ory/kratos/x"
+)
+
+// State is the state of a push challenge.
+type State string
+
+const (
+	// StatePending is the state of a challenge which has not been answered on the device yet.
+	StatePending State = "pending"
+	// StateApproved is the state of a challenge which was approved on the device but for which the browser did not
+	// complete the login yet.
+	StateApproved State = "approved"
+	// StateDenied is the state of a challenge which was denied on the device or answered with the wrong number.
+	StateDenied State = "denied"
+	// StateCompleted is the state of a challenge for which the browser completed the login.
+	StateCompleted State = "completed"
+)
+
+const (
+	// challengeLifespan is the time the user has to answer a push notification.
+	challengeLifespan = 5 * time.Minute
+
+	// numberChoices is the number of numbers the device offers, of which only one is shown on the login screen.
+	numberChoices = 3
+)
+
+// Challenge is sent to the devices of an identity as a push notification. The login screen shows a number, and the
+// login is only approved if the user picks the same number on the device. Someone who knows the password and sends
+// push notifications until the user gives in does therefore not see the number the user would have to pick.
+type Challenge struct {
+	ID uuid.UUID `json:"-" faker:"uuid" db:"id"`
+
+	LoginRequestID uuid.UUID `json:"-" faker:"-" db:"selfservice_login_request_id"`
+
+	IdentityID uuid.UUID `json:"-" faker:"-" db:"identity_id"`
+
+	// SecretHash is the SHA-256 hash of the secret which is only sent to the devices.
+	SecretHash string `json:"-" faker:"-" db:"secret_hash"`
+
+	// Number is the number shown on the login screen.
+	Number int `json:"-" faker:"-" db:"number"`
+
+	State State `json:"-" faker:"-" db:"state"`
+
+	ExpiresAt time.Time `json:"-" faker:"time_type" db:"expires_at"`
+
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (c Challenge) TableName() string {
+	return "selfservice_login_push_challenges"
+}
+
+// NewChallenge returns a pending challenge for the login request, the secret which only the devices must know, and
+// the numbers the devices offer, one of which is the challenge's number.
+func NewChallenge(loginRequestID, identityID uuid.UUID, lifespan time.Duration) (*Challenge, string, []int, error) {
+	secret, err := randx.RuneSequence(32, randx.AlphaNum)
+	if err != nil {
+		return nil, "", nil, errors.WithStack(err)
+	}
+
+	choices, err := randomNumbers(numberChoices)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	number, err := randomInt(len(choices))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return &Challenge{
+		ID:             x.NewUUID(),
+		LoginRequestID: loginRequestID,
+		IdentityID:     identityID,
+		SecretHash:     HashSecret(string(secret)),
+		Number:         choices[number],
+		State:          StatePending,
+		ExpiresAt:      time.Now().UTC().Add(lifespan),
+	}, string(secret), choices, nil
+}
+
+// IsExpired returns true if the challenge can no longer be answered.
+func (c *Challenge) IsExpired() bool {
+	return !c.ExpiresAt.After(time.Now().UTC())
+}
+
+// HashSecret returns the hash of the secret as it is stored.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomNumbers returns n distinct two-digit numbers in random order.
+func randomNumbers(n int) ([]int, error) {
+	numbers := make([]int, 0, n)
+	for len(numbers) < n {
+		v, err := randomInt(90)
+		if err != nil {
+			return nil, err
+		}
+
+		v += 10
+		var taken bool
+		for _, number := range numbers {
+			taken = taken || number == v
+		}
+		if !taken {
+			numbers = append(numbers, v)
+		}
+	}
+	return numbers, nil
+}
+
+func randomInt(max int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(v.Int64()), nil
+}
@@ -0,0 +1,71 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/identity"
+)
+
+// CredentialsConfig is the configuration of the push credentials of an identity.
+type CredentialsConfig struct {
+	Devices []Device `json:"devices"`
+}
+
+// Device is a device which receives push notifications to approve logins.
+//
+// swagger:model pushDevice
+type Device struct {
+	ID uuid.UUID `json:"id"`
+
+	// Name is the name the user gave the device, for example "Work Phone".
+	Name string `json:"name"`
+
+	// Provider is the provider which delivers the notifications, one of "webhook", "fcm", or "apns".
+	Provider string `json:"provider"`
+
+	// Token is the token the provider addresses the device with. It is not returned when devices are listed.
+	Token string `json:"token,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// devices returns the devices of the identity, which must include its credentials.
+func devices(i *identity.Identity) ([]Device, error) {
+	c, ok := i.GetCredentials(identity.CredentialsTypePush)
+	if !ok || len(c.Config) == 0 {
+		return nil, nil
+	}
+
+	var o CredentialsConfig
+	if err := json.NewDecoder(bytes.NewBuffer(c.Config)).Decode(&o); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("The push credentials could not be decoded properly").WithDebug(err.Error()))
+	}
+	return o.Devices, nil
+}
+
+// setDevices replaces the devices of the identity. The device IDs are the identifiers of the credentials.
+func setDevices(i *identity.Identity, devices []Device) error {
+	co, err := json.Marshal(&CredentialsConfig{Devices: devices})
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode push credentials to JSON: %s", err))
+	}
+
+	identifiers := make([]string, len(devices))
+	for k, d := range devices {
+		identifiers[k] = d.ID.String()
+	}
+
+	i.SetCredentials(identity.CredentialsTypePush, identity.Credentials{
+		Type:        identity.CredentialsTypePush,
+		Identifiers: identifiers,
+		Config:      co,
+	})
+	return nil
+}
@@ -0,0 +1,243 @@
+package push
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// ActionField is the name of the approval form field which is either ActionApprove or ActionDeny.
+	ActionField   = "action"
+	ActionApprove = "approve"
+	ActionDeny    = "deny"
+)
+
+// Status is the state of the push notification which was sent last for a login request.
+//
+// swagger:model pushStatus
+type Status struct {
+	// State is the state of the challenge. The browser submits the login form once it is "approved".
+	State State `json:"state"`
+
+	// ExpiresAt is the time (UTC) when the push notification can no longer be answered.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newStatus(c *Challenge) *Status {
+	return &Status{State: c.State, ExpiresAt: c.ExpiresAt}
+}
+
+// fetchStatus returns the state of the push notification which was sent last for the login request.
+func (s *Strategy) fetchStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := login.CheckInitiator(s.d, r, ar); err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	challenge, err := s.d.PushChallengePersister().GetLatestPushChallenge(r.Context(), ar.ID)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s.d.Writer().Write(w, r, newStatus(challenge))
+}
+
+// resend sends another push notification, for example because the last one was not delivered. The number shown
+// on the login screen changes.
+func (s *Strategy) resend(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	if err := login.CheckInitiator(s.d, r, ar); err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if last, err := s.d.PushChallengePersister().GetLatestPushChallenge(r.Context(), ar.ID); err == nil {
+		if last.State == StatePending && !last.IsExpired() && time.Since(last.CreatedAt) < resendInterval {
+			s.handleLoginError(w, r, ar, errors.WithStack(x.ErrTooManyRequests.WithReasonf("Please wait %.0f seconds before sending another push notification.", (resendInterval-time.Since(last.CreatedAt)).Seconds())))
+			return
+		}
+	} else if errorsx.Cause(err) != sqlcon.ErrNoRows {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ar.SecondFactorIdentityID.UUID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	f, err := s.sendChallenge(r, i, ar.ID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	method := &login.RequestMethod{
+		Method: s.ID(),
+		Config: &login.RequestMethodConfig{RequestMethodConfigurator: f},
+	}
+	if err := s.d.LoginRequestPersister().UpdateLoginRequestMethod(r.Context(), ar.ID, s.ID(), method); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	http.Redirect(w, r,
+		urlx.CopyWithQuery(s.c.MultiFactorURL(), url.Values{"request": {ar.ID.String()}}).String(),
+		http.StatusFound,
+	)
+}
+
+// submitApproval is called by the app with the challenge ID and secret from the push notification and the number
+// the user picked. Picking the wrong number denies the challenge, so that guessing does not help.
+func (s *Strategy) submitApproval(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !s.enabled() {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("The push approval is disabled.")))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	cid := x.ParseUUID(r.PostForm.Get("challenge_id"))
+	if x.IsZeroUUID(cid) {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The challenge_id field is missing or invalid.")))
+		return
+	}
+
+	challenge, err := s.d.PushChallengePersister().GetPushChallenge(r.Context(), cid)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashSecret(r.PostForm.Get("secret"))), []byte(challenge.SecretHash)) != 1 {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrForbidden.WithReason("The push challenge secret is invalid.")))
+		return
+	}
+
+	var to State
+	switch r.PostForm.Get(ActionField) {
+	case ActionApprove:
+		to = StateApproved
+		if number, err := strconv.Atoi(r.PostForm.Get(NumberField)); err != nil || number != challenge.Number {
+			x.ContextLogger(r.Context(), s.d.Logger()).
+				WithField("identity_id", challenge.IdentityID).
+				WithField("login_request_id", challenge.LoginRequestID).
+				Warn("A push notification was answered with the wrong number and has been denied. Someone else might know the identity's first factor.")
+			to = StateDenied
+		}
+	case ActionDeny:
+		to = StateDenied
+	default:
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The %s field must be "%s" or "%s".`, ActionField, ActionApprove, ActionDeny)))
+		return
+	}
+
+	if err := s.d.PushChallengePersister().UpdatePushChallengeState(r.Context(), challenge.ID, StatePending, to); err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			err = errors.WithStack(herodot.ErrBadRequest.WithReason("The push notification was already answered or has expired."))
+		}
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	challenge.State = to
+	s.d.Writer().Write(w, r, newStatus(challenge))
+}
+
+// complete signs in the browser which initiated the login request once the push notification was approved.
+func (s *Strategy) complete(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.fetchLoginRequest(r)
+	if err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	// Otherwise, whoever knows the login request ID could complete the login once the user approved it.
+	if err := login.CheckInitiator(s.d, r, ar); err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	if err := ar.ValidFor(s.c.SelfServiceLoginRequestLifespanFor(string(s.ID()))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	challenge, err := s.d.PushChallengePersister().GetLatestPushChallenge(r.Context(), ar.ID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if challenge.IdentityID != ar.SecondFactorIdentityID.UUID {
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The push notification was sent to another identity.")))
+		return
+	}
+
+	switch challenge.State {
+	case StateApproved:
+	case StateDenied:
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The login was denied on your device.")))
+		return
+	case StateCompleted:
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The login request was already completed.")))
+		return
+	default:
+		s.handleLoginError(w, r, ar, errors.WithStack(herodot.ErrBadRequest.WithReason("The login has not been approved on your device yet.")))
+		return
+	}
+
+	if err := s.d.PushChallengePersister().UpdatePushChallengeState(r.Context(), challenge.ID, StateApproved, StateCompleted); err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			err = errors.WithStack(herodot.ErrBadRequest.WithReason("The login request was already completed."))
+		}
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ar.SecondFactorIdentityID.UUID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostSecondFactorHook(w, r, ar, i); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+}
@@ -0,0 +1,114 @@
+package push
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		PushChallengePersister() Persister
+	}
+	Persister interface {
+		CreatePushChallenge(ctx context.Context, c *Challenge) error
+		GetPushChallenge(ctx context.Context, id uuid.UUID) (*Challenge, error)
+
+		// GetLatestPushChallenge returns the challenge which was sent last for the login request.
+		GetLatestPushChallenge(ctx context.Context, loginRequestID uuid.UUID) (*Challenge, error)
+
+		// UpdatePushChallengeState changes the state of the challenge if it is still in state from and has not
+		// expired. It returns sqlcon.ErrNoRows otherwise.
+		UpdatePushChallengeState(ctx context.Context, id uuid.UUID, from, to State) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	login.RequestPersister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		var i identity.Identity
+		require.NoError(t, faker.FakeData(&i))
+		require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+		newLoginRequest := func(t *testing.T) *login.Request {
+			var r login.Request
+			require.NoError(t, faker.FakeData(&r))
+			require.NoError(t, p.CreateLoginRequest(context.Background(), &r))
+			return &r
+		}
+
+		t.Run("case=should error when the challenge does not exist", func(t *testing.T) {
+			_, err := p.GetPushChallenge(context.Background(), x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+			_, err = p.GetLatestPushChallenge(context.Background(), x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(err))
+		})
+
+		t.Run("case=should create and fetch the latest challenge", func(t *testing.T) {
+			r := newLoginRequest(t)
+
+			first, _, _, err := NewChallenge(r.ID, i.ID, time.Hour)
+			require.NoError(t, err)
+			first.CreatedAt = time.Now().UTC().Add(-time.Minute)
+			require.NoError(t, p.CreatePushChallenge(context.Background(), first))
+
+			second, secret, choices, err := NewChallenge(r.ID, i.ID, time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, p.CreatePushChallenge(context.Background(), second))
+			assert.Len(t, choices, numberChoices)
+			assert.Contains(t, choices, second.Number)
+
+			actual, err := p.GetPushChallenge(context.Background(), first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, first.SecretHash, actual.SecretHash)
+
+			actual, err = p.GetLatestPushChallenge(context.Background(), r.ID)
+			require.NoError(t, err)
+			assert.Equal(t, second.ID, actual.ID)
+			assert.Equal(t, HashSecret(secret), actual.SecretHash)
+			assert.Equal(t, second.Number, actual.Number)
+			assert.Equal(t, StatePending, actual.State)
+		})
+
+		t.Run("case=should only update the state if it did not change", func(t *testing.T) {
+			c, _, _, err := NewChallenge(newLoginRequest(t).ID, i.ID, time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, p.CreatePushChallenge(context.Background(), c))
+
+			require.NoError(t, p.UpdatePushChallengeState(context.Background(), c.ID, StatePending, StateApproved))
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UpdatePushChallengeState(context.Background(), c.ID, StatePending, StateDenied)))
+
+			actual, err := p.GetPushChallenge(context.Background(), c.ID)
+			require.NoError(t, err)
+			assert.Equal(t, StateApproved, actual.State)
+		})
+
+		t.Run("case=should not update the state of expired challenges", func(t *testing.T) {
+			c, _, _, err := NewChallenge(newLoginRequest(t).ID, i.ID, -time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, p.CreatePushChallenge(context.Background(), c))
+
+			assert.Equal(t, sqlcon.ErrNoRows, errorsx.Cause(p.UpdatePushChallengeState(context.Background(), c.ID, StatePending, StateApproved)))
+		})
+	}
+}
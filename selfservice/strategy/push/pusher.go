@@ -0,0 +1,343 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/egress"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	ProviderWebhook = "webhook"
+	ProviderFCM     = "fcm"
+	ProviderAPNs    = "apns"
+
+	defaultFCMURL  = "https://fcm.googleapis.com/fcm/send"
+	defaultAPNsURL = "https://api.push.apple.com"
+
+	// apnsTokenLifespan is the time an APNs provider token is reused. APNs rejects tokens which are older than an
+	// hour as well as tokens which are renewed more often than every 20 minutes.
+	apnsTokenLifespan = 40 * time.Minute
+
+	notificationTitle = "Sign-in request"
+	notificationBody  = "Pick the number shown on the sign-in screen to approve the sign-in."
+)
+
+type (
+	// WebhookConfiguration sends the notifications to the operator's app backend, which delivers them to the app.
+	WebhookConfiguration struct {
+		URL string `json:"url"`
+		configuration.OutboundHook
+	}
+
+	// FCMConfiguration sends the notifications using the legacy HTTP API of Firebase Cloud Messaging.
+	FCMConfiguration struct {
+		ServerKey string `json:"server_key"`
+		URL       string `json:"url"`
+	}
+
+	// APNsConfiguration sends the notifications using the Apple Push Notification service and a token-based
+	// connection.
+	APNsConfiguration struct {
+		KeyID string `json:"key_id"`
+		// TeamID is the ID of the Apple developer team which issued the key.
+		TeamID string `json:"team_id"`
+		// KeyPath is the path to the PKCS #8 encoded key (.p8 file).
+		KeyPath string `json:"key_path"`
+		// Topic is the bundle ID of the app.
+		Topic string `json:"topic"`
+		URL   string `json:"url"`
+	}
+
+	// Notification is delivered to the devices. The app shows the choices and sends the one the user picked, along
+	// with the challenge ID and the secret, to the approval URL.
+	//
+	// swagger:model pushNotification
+	Notification struct {
+		ChallengeID uuid.UUID `json:"challenge_id"`
+		Secret      string    `json:"secret"`
+		Choices     []int     `json:"choices"`
+		ApprovalURL string    `json:"approval_url"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+
+	// webhookPayload is the body of the calls to the webhook.
+	webhookPayload struct {
+		IdentityID   uuid.UUID     `json:"identity_id"`
+		Device       Device        `json:"device"`
+		Notification *Notification `json:"notification"`
+	}
+
+	apnsToken struct {
+		sync.Mutex
+		keyID    string
+		token    string
+		issuedAt time.Time
+	}
+)
+
+func (n *Notification) data() map[string]string {
+	choices := make([]string, len(n.Choices))
+	for k, c := range n.Choices {
+		choices[k] = strconv.Itoa(c)
+	}
+
+	return map[string]string{
+		"challenge_id": n.ChallengeID.String(),
+		"secret":       n.Secret,
+		"choices":      strings.Join(choices, ","),
+		"approval_url": n.ApprovalURL,
+		"expires_at":   n.ExpiresAt.Format(time.RFC3339),
+	}
+}
+
+// push delivers the notification to the device using the device's provider.
+func (s *Strategy) push(ctx context.Context, c *Configuration, identityID uuid.UUID, d Device, n *Notification) error {
+	switch d.Provider {
+	case ProviderWebhook:
+		if c.Webhook != nil {
+			return s.pushWebhook(ctx, c.Webhook, identityID, d, n)
+		}
+	case ProviderFCM:
+		if c.FCM != nil {
+			return s.pushFCM(ctx, c.FCM, d, n)
+		}
+	case ProviderAPNs:
+		if c.APNs != nil {
+			return s.pushAPNs(ctx, c.APNs, d, n)
+		}
+	}
+	return errors.Errorf("push provider %s is not configured", d.Provider)
+}
+
+func (s *Strategy) pushWebhook(ctx context.Context, c *WebhookConfiguration, identityID uuid.UUID, d Device, n *Notification) error {
+	body, err := json.Marshal(&webhookPayload{IdentityID: identityID, Device: d, Notification: n})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := x.RequestID(ctx); len(id) > 0 {
+		req.Header.Set(x.RequestIDHeader, id)
+	}
+	if len(c.SigningSecrets) > 0 {
+		req.Header.Set(x.SignatureHeader, x.Sign(body, c.SigningSecrets, time.Now()))
+	}
+
+	conf, err := c.TLS.Config()
+	if err != nil {
+		return err
+	}
+	client := egress.Default.HookClient(s.client, conf)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if !c.Acknowledged(res.StatusCode) {
+		return errors.Errorf("push webhook responded with unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (s *Strategy) pushFCM(ctx context.Context, c *FCMConfiguration, d Device, n *Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"to":       d.Token,
+		"priority": "high",
+		"notification": map[string]string{
+			"title": notificationTitle,
+			"body":  notificationBody,
+		},
+		"data":         n.data(),
+		"time_to_live": int(time.Until(n.ExpiresAt).Seconds()),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	u := c.URL
+	if len(u) == 0 {
+		u = defaultFCMURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "key="+c.ServerKey)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("FCM responded with unexpected status code %d", res.StatusCode)
+	}
+
+	var result struct {
+		Failure int `json:"failure"`
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if result.Failure > 0 {
+		var reasons []string
+		for _, r := range result.Results {
+			if len(r.Error) > 0 {
+				reasons = append(reasons, r.Error)
+			}
+		}
+		return errors.Errorf("FCM was unable to deliver the notification: %s", strings.Join(reasons, ", "))
+	}
+	return nil
+}
+
+func (s *Strategy) pushAPNs(ctx context.Context, c *APNsConfiguration, d Device, n *Notification) error {
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": notificationTitle,
+				"body":  notificationBody,
+			},
+		},
+	}
+	for k, v := range n.data() {
+		payload[k] = v
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	token, err := s.apnsToken.get(c, time.Now())
+	if err != nil {
+		return err
+	}
+
+	u := c.URL
+	if len(u) == 0 {
+		u = defaultAPNsURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(u, "/")+"/3/device/"+d.Token, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", c.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	req.Header.Set("apns-expiration", strconv.FormatInt(n.ExpiresAt.Unix(), 10))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		reason, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("APNs responded with unexpected status code %d: %s", res.StatusCode, reason)
+	}
+	return nil
+}
+
+// get returns the provider token which authenticates the calls to APNs. Tokens are reused until they are about to
+// expire.
+func (t *apnsToken) get(c *APNsConfiguration, now time.Time) (string, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.keyID == c.KeyID && now.Sub(t.issuedAt) < apnsTokenLifespan {
+		return t.token, nil
+	}
+
+	token, err := newAPNsToken(c, now)
+	if err != nil {
+		return "", err
+	}
+
+	t.keyID, t.token, t.issuedAt = c.KeyID, token, now
+	return token, nil
+}
+
+// newAPNsToken returns a JSON Web Token which is signed with ES256 using the key at KeyPath.
+func newAPNsToken(c *APNsConfiguration, now time.Time) (string, error) {
+	raw, err := ioutil.ReadFile(c.KeyPath)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return "", errors.Errorf("the APNs key at %s is not PEM encoded", c.KeyPath)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", errors.Errorf("the APNs key at %s is not an ECDSA key", c.KeyPath)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": c.KeyID})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{"iss": c.TeamID, "iat": now.Unix()})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sig, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// ES256 signatures are the concatenation of R and S, each padded to 32 bytes.
+	signature := make([]byte, 64)
+	rb, sb := r.Bytes(), sig.Bytes()
+	copy(signature[32-len(rb):32], rb)
+	copy(signature[64-len(sb):], sb)
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,233 @@
+package push
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/x"
+)
+
+// Devices lists the devices of the signed in identity and contains the form which registers another one.
+//
+// swagger:model pushDevices
+type Devices struct {
+	Devices []Device `json:"devices"`
+
+	// Form registers a device. It requires the fields "name", "provider", and "token".
+	Form *form.HTMLForm `json:"form"`
+}
+
+// deviceIdentity returns the identity of the session, including its credentials. Adding or removing a second
+// factor requires a privileged session by default, otherwise a stolen session could be used to take over the
+// second factor. See configuration key selfservice.profile.privileged_methods.
+func (s *Strategy) deviceIdentity(w http.ResponseWriter, r *http.Request, privileged bool) (*identity.Identity, error) {
+	if !s.enabled() {
+		return nil, errors.WithStack(herodot.ErrNotFound.WithReason("The push approval is disabled."))
+	}
+
+	sess, err := s.d.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if privileged {
+		if err := s.d.ProfilePrivilegedChecker().Check(r.Context(), sess, string(s.ID())); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), sess.IdentityID)
+}
+
+func (s *Strategy) handleDeviceError(w http.ResponseWriter, r *http.Request, err error) {
+	if x.IsJSONRequest(r) {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if loginURL, ok := profile.PrivilegedLoginURL(err); ok {
+		http.Redirect(w, r, loginURL, http.StatusFound)
+		return
+	}
+	s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+}
+
+// listDevices returns the devices of the signed in identity without their push tokens.
+func (s *Strategy) listDevices(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	i, err := s.deviceIdentity(w, r, false)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	ds, err := devices(i)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	for k := range ds {
+		ds[k].Token = ""
+	}
+	if ds == nil {
+		ds = []Device{}
+	}
+
+	f := form.NewHTMLForm(urlx.AppendPaths(s.c.SelfPublicURL(), DevicesPath).String())
+	f.SetField(form.Field{Name: "name", Type: "text", Required: true})
+	f.SetField(form.Field{Name: "provider", Type: "text", Required: true})
+	f.SetField(form.Field{Name: "token", Type: "text", Required: true})
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	s.d.Writer().Write(w, r, &Devices{Devices: ds, Form: f})
+}
+
+// registerDevice adds a device to the signed in identity. Registering a push token again renames the device
+// instead of adding it twice.
+func (s *Strategy) registerDevice(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	i, err := s.deviceIdentity(w, r, true)
+	if err != nil {
+		s.handleDeviceError(w, r, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.handleDeviceError(w, r, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	d := Device{
+		ID:        x.NewUUID(),
+		Name:      strings.TrimSpace(r.PostForm.Get("name")),
+		Provider:  r.PostForm.Get("provider"),
+		Token:     r.PostForm.Get("token"),
+		CreatedAt: time.Now().UTC(),
+	}
+	if len(d.Name) == 0 || len(d.Token) == 0 {
+		s.handleDeviceError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The fields name and token are required.")))
+		return
+	}
+
+	c, err := s.Config()
+	if err != nil {
+		s.handleDeviceError(w, r, err)
+		return
+	}
+
+	if !c.configured(d.Provider) {
+		s.handleDeviceError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The push provider %q is not configured.", d.Provider)))
+		return
+	}
+
+	ds, err := devices(i)
+	if err != nil {
+		s.handleDeviceError(w, r, err)
+		return
+	}
+
+	var found bool
+	for k := range ds {
+		if ds[k].Provider == d.Provider && ds[k].Token == d.Token {
+			ds[k].Name = d.Name
+			d, found = ds[k], true
+		}
+	}
+	if !found {
+		ds = append(ds, d)
+	}
+
+	if err := s.updateDevices(r, i, ds); err != nil {
+		s.handleDeviceError(w, r, err)
+		return
+	}
+
+	if !found {
+		s.notifyDevicesChanged(r, i, d, true)
+	}
+
+	if x.IsJSONRequest(r) {
+		d.Token = ""
+		s.d.Writer().WriteCode(w, r, http.StatusCreated, d)
+		return
+	}
+
+	http.Redirect(w, r, s.c.ProfileURL().String(), http.StatusFound)
+}
+
+// removeDevice removes the device of the `device_id` field from the signed in identity.
+func (s *Strategy) removeDevice(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	i, err := s.deviceIdentity(w, r, true)
+	if err != nil {
+		s.handleDeviceError(w, r, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.handleDeviceError(w, r, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	id := x.ParseUUID(r.PostForm.Get("device_id"))
+	ds, err := devices(i)
+	if err != nil {
+		s.handleDeviceError(w, r, err)
+		return
+	}
+
+	var removed Device
+	remaining := make([]Device, 0, len(ds))
+	for _, d := range ds {
+		if d.ID != id {
+			remaining = append(remaining, d)
+		} else {
+			removed = d
+		}
+	}
+
+	if len(remaining) == len(ds) {
+		s.handleDeviceError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("The device does not exist.")))
+		return
+	}
+
+	if err := s.updateDevices(r, i, remaining); err != nil {
+		s.handleDeviceError(w, r, err)
+		return
+	}
+
+	s.notifyDevicesChanged(r, i, removed, false)
+
+	if x.IsJSONRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	http.Redirect(w, r, s.c.ProfileURL().String(), http.StatusFound)
+}
+
+// updateDevices stores the devices of the identity unless it must not be changed by its owner at the moment.
+func (s *Strategy) updateDevices(r *http.Request, i *identity.Identity, ds []Device) error {
+	if err := setDevices(i, ds); err != nil {
+		return err
+	}
+	return s.d.IdentityManager().Update(r.Context(), i)
+}
+
+// notifyDevicesChanged tells the identity that a device was added or removed. The change is already stored, which is
+// why failures are only logged.
+func (s *Strategy) notifyDevicesChanged(r *http.Request, i *identity.Identity, d Device, added bool) {
+	ctx := i18n.WithLocale(r.Context(), s.d.I18nCatalog().Negotiate(r))
+	if err := s.d.NotificationSender().NotifySecondFactorChanged(ctx, i, s.ID(), d.Name, added); err != nil {
+		x.ContextLogger(r.Context(), s.d.Logger()).WithError(err).WithField("identity_id", i.ID).Warn("Unable to send the notification about the changed push devices.")
+	}
+}
@@ -0,0 +1,275 @@
+package push
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/egress"
+	"github.com/ory/kratos/i18n"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	BasePath = "/self-service/browser/flows/login/strategies/push"
+
+	// SendPath, StatusPath, and CompletePath are called by the browser which initiated the login.
+	SendPath     = BasePath + "/send"
+	StatusPath   = BasePath + "/status"
+	CompletePath = BasePath + "/complete"
+
+	// ApprovalPath is called by the app on the device which received the push notification.
+	ApprovalPath = BasePath + "/approval"
+
+	// DevicesPath lists and registers the devices of the signed in identity, DeviceRemovePath removes one.
+	DevicesPath      = "/self-service/browser/flows/profile/strategies/push/devices"
+	DeviceRemovePath = DevicesPath + "/remove"
+
+	// NumberField is the name of the login form field which contains the number the user has to pick on the
+	// device.
+	NumberField = "number"
+
+	// resendInterval is the time after which the browser may send another notification while the last one was not
+	// answered yet.
+	resendInterval = 30 * time.Second
+)
+
+var _ login.SecondFactor = new(Strategy)
+
+type dependencies interface {
+	errorx.ManagementProvider
+
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.FlowBinderProvider
+
+	identity.PrivilegedPoolProvider
+	identity.ManagementProvider
+
+	session.ManagementProvider
+
+	login.HookExecutorProvider
+	login.RequestPersistenceProvider
+	login.ErrorHandlerProvider
+
+	profile.PrivilegedCheckerProvider
+
+	notification.SenderProvider
+	i18n.CatalogProvider
+
+	PersistenceProvider
+}
+
+// Strategy implements login.SecondFactor. Once the identity authenticated using a first factor, a push
+// notification is sent to all devices the identity registered:
+//
+// 1. The login form shows a number, and the app on the device asks the user to pick the same number out of
+// several. The app sends the answer to ApprovalPath.
+// 2. The browser polls StatusPath until the challenge was approved and then submits the login form to
+// CompletePath, which issues the session.
+//
+// Devices are registered at DevicesPath, usually by the app itself, which then knows its push token.
+type Strategy struct {
+	c configuration.Provider
+	d dependencies
+
+	client    *http.Client
+	apnsToken *apnsToken
+}
+
+// Configuration is the configuration of the strategy at `selfservice.strategies.push.config`. Devices can only be
+// registered with the providers which are configured.
+type Configuration struct {
+	Webhook *WebhookConfiguration `json:"webhook"`
+	FCM     *FCMConfiguration     `json:"fcm"`
+	APNs    *APNsConfiguration    `json:"apns"`
+}
+
+func NewStrategy(d dependencies, c configuration.Provider) *Strategy {
+	return &Strategy{
+		c:         c,
+		d:         d,
+		client:    &http.Client{Timeout: time.Second * 10, Transport: egress.Default},
+		apnsToken: new(apnsToken),
+	}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypePush
+}
+
+func (s *Strategy) SecondFactorID() identity.CredentialsType {
+	return s.ID()
+}
+
+func (s *Strategy) RegisterSecondFactorRoutes(r *x.RouterPublic) {
+	r.POST(SendPath, s.resend)
+	r.GET(StatusPath, s.fetchStatus)
+	r.POST(ApprovalPath, s.submitApproval)
+	r.POST(CompletePath, s.complete)
+
+	r.GET(DevicesPath, s.listDevices)
+	r.POST(DevicesPath, s.registerDevice)
+	r.POST(DeviceRemovePath, s.removeDevice)
+}
+
+func (s *Strategy) enabled() bool {
+	return s.c.SelfServiceStrategy(string(s.ID())).Enabled
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	var c Configuration
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(s.c.SelfServiceStrategy(string(s.ID())).Config)).
+		Decode(&c); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the push configuration: %s", err))
+	}
+	return &c, nil
+}
+
+// configured returns true if the provider can deliver notifications.
+func (c *Configuration) configured(provider string) bool {
+	switch provider {
+	case ProviderWebhook:
+		return c.Webhook != nil
+	case ProviderFCM:
+		return c.FCM != nil
+	case ProviderAPNs:
+		return c.APNs != nil
+	}
+	return false
+}
+
+func (s *Strategy) IsEnrolled(i *identity.Identity) bool {
+	if !s.enabled() {
+		return false
+	}
+
+	ds, err := devices(i)
+	return err == nil && len(ds) > 0
+}
+
+func (s *Strategy) PopulateSecondFactorMethod(r *http.Request, i *identity.Identity, sr *login.Request) error {
+	f, err := s.sendChallenge(r, i, sr.ID)
+	if err != nil {
+		return err
+	}
+
+	sr.Methods[s.ID()] = &login.RequestMethod{
+		Method: s.ID(),
+		Config: &login.RequestMethodConfig{RequestMethodConfigurator: f},
+	}
+	return nil
+}
+
+// sendChallenge creates a challenge, sends it to all devices of the identity, and returns the login form which
+// shows the challenge's number. If the notification could not be delivered to any device, the form contains an
+// error, the user can then ask for another notification.
+func (s *Strategy) sendChallenge(r *http.Request, i *identity.Identity, rid uuid.UUID) (*form.HTMLForm, error) {
+	c, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := devices(i)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, secret, choices, err := NewChallenge(rid, i.ID, challengeLifespan)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.d.PushChallengePersister().CreatePushChallenge(r.Context(), challenge); err != nil {
+		return nil, err
+	}
+
+	n := &Notification{
+		ChallengeID: challenge.ID,
+		Secret:      secret,
+		Choices:     choices,
+		ApprovalURL: urlx.AppendPaths(s.c.SelfPublicURL(), ApprovalPath).String(),
+		ExpiresAt:   challenge.ExpiresAt,
+	}
+
+	var delivered int
+	for _, d := range ds {
+		if err := s.push(r.Context(), c, i.ID, d, n); err != nil {
+			x.ContextLogger(r.Context(), s.d.Logger()).
+				WithError(err).
+				WithField("identity_id", i.ID).
+				WithField("device_id", d.ID).
+				Warn("Unable to send the push notification.")
+			continue
+		}
+		delivered++
+	}
+
+	f := s.loginForm(r, rid, challenge.Number)
+	if delivered == 0 {
+		f.AddError(&form.Error{ID: form.ErrorIDPushDeliveryFailed, Message: "The push notification could not be delivered to any of your devices, please try again."})
+	}
+	return f, nil
+}
+
+// loginForm returns the form which the browser submits once the challenge was approved.
+func (s *Strategy) loginForm(r *http.Request, rid uuid.UUID, number int) *form.HTMLForm {
+	f := form.NewHTMLForm(urlx.CopyWithQuery(
+		urlx.AppendPaths(s.c.SelfPublicURL(), CompletePath),
+		url.Values{"request": {rid.String()}},
+	).String())
+	f.SetField(form.Field{Name: NumberField, Type: "hidden", Value: number})
+	login.AddTrustDeviceField(s.c, f)
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	return f
+}
+
+// fetchLoginRequest returns the login request of the `request` query parameter if it waits for a push approval.
+func (s *Strategy) fetchLoginRequest(r *http.Request) (*login.Request, error) {
+	if !s.enabled() {
+		return nil, errors.WithStack(herodot.ErrNotFound.WithReason("The push approval is disabled."))
+	}
+
+	ar, err := login.FetchStrategyRequest(s.d, r, s.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	if !ar.SecondFactorIdentityID.Valid {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The login request does not wait for a push approval."))
+	}
+	return ar, nil
+}
+
+func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, ar *login.Request, err error) {
+	if ar != nil {
+		if method, ok := ar.Methods[s.ID()]; ok {
+			if challenge, cerr := s.d.PushChallengePersister().GetLatestPushChallenge(r.Context(), ar.ID); cerr == nil {
+				method.Config.Reset()
+				method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+				method.Config.SetValue(NumberField, challenge.Number)
+				ar.Methods[s.ID()] = method
+			}
+		}
+	}
+
+	s.d.LoginRequestErrorHandler().HandleLoginError(w, r, s.ID(), ar, err)
+}
@@ -0,0 +1,322 @@
+package push_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/form"
+	"github.com/ory/kratos/selfservice/strategy/push"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+func TestStrategy(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+
+	router := x.NewRouterPublic()
+	reg.LoginSecondFactors().RegisterPublicRoutes(router)
+	router.GET("/mock-session", session.MockSetSession(t, reg))
+	// The first factor is mocked, it only runs the login hooks for the identity of the query parameter.
+	router.POST("/first-factor", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ar, err := reg.LoginRequestPersister().GetLoginRequest(r.Context(), x.ParseUUID(r.URL.Query().Get("request")))
+		require.NoError(t, err)
+		i, err := reg.PrivilegedIdentityPool().GetIdentity(r.Context(), x.ParseUUID(r.URL.Query().Get("identity")))
+		require.NoError(t, err)
+		require.NoError(t, reg.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypePassword, reg.PostLoginHooks(identity.CredentialsTypePassword), ar, i))
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	errTs, uiTs := errorx.NewErrorTestServer(t, reg), httptest.NewServer(login.TestRequestHandler(t, reg))
+	defer errTs.Close()
+	defer uiTs.Close()
+	returnTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := reg.SessionManager().FetchFromRequest(r.Context(), w, r)
+		require.NoError(t, err)
+		reg.Writer().Write(w, r, sess)
+	}))
+	defer returnTs.Close()
+
+	var lock sync.Mutex
+	var notifications []gjson.Result
+	webhookTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		lock.Lock()
+		notifications = append(notifications, gjson.ParseBytes(body))
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookTs.Close()
+
+	viper.Set(configuration.ViperKeyURLsError, errTs.URL+"/error-ts")
+	viper.Set(configuration.ViperKeyURLsLogin, uiTs.URL+"/login-ts")
+	viper.Set(configuration.ViperKeyURLsMFA, uiTs.URL+"/mfa-ts")
+	viper.Set(configuration.ViperKeyURLsProfile, uiTs.URL+"/profile-ts")
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyURLsDefaultReturnTo, returnTs.URL+"/return-ts")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceLoginAfterConfig+"."+string(identity.CredentialsTypePassword), []map[string]interface{}{
+		{"job": "session"},
+		{"job": "redirect", "config": map[string]interface{}{"default_redirect_url": returnTs.URL + "/return-ts"}},
+	})
+
+	strategyKey := configuration.ViperKeySelfServiceStrategyConfig + "." + string(identity.CredentialsTypePush)
+
+	lastNotification := func(t *testing.T) gjson.Result {
+		lock.Lock()
+		defer lock.Unlock()
+		require.NotEmpty(t, notifications)
+		return notifications[len(notifications)-1]
+	}
+
+	newIdentity := func(t *testing.T) *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		did := x.NewUUID()
+		co, err := json.Marshal(&push.CredentialsConfig{Devices: []push.Device{
+			{ID: did, Name: "Phone", Provider: push.ProviderWebhook, Token: "token-" + did.String(), CreatedAt: time.Now().UTC()},
+		}})
+		require.NoError(t, err)
+		i.Credentials = map[identity.CredentialsType]identity.Credentials{
+			identity.CredentialsTypePush: {Type: identity.CredentialsTypePush, Identifiers: []string{did.String()}, Config: co},
+		}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i
+	}
+
+	noRedirects := func(c *http.Client) *http.Client {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		return c
+	}
+
+	// firstFactor authenticates the identity using the mocked first factor and returns the login request.
+	firstFactor := func(t *testing.T, i *identity.Identity) (*login.Request, *http.Response) {
+		req := x.NewTestHTTPRequest(t, "GET", ts.URL+login.BrowserLoginPath, nil)
+		lr := login.NewLoginRequest(time.Minute, x.FakeCSRFToken, req)
+		require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+
+		res, err := noRedirects(session.MockCookieClient(t)).PostForm(ts.URL+"/first-factor?"+url.Values{
+			"request":  {lr.ID.String()},
+			"identity": {i.ID.String()},
+		}.Encode(), url.Values{})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return lr, res
+	}
+
+	number := func(t *testing.T, lr *login.Request) int {
+		actual, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), lr.ID)
+		require.NoError(t, err)
+		require.Contains(t, actual.Methods, identity.CredentialsTypePush)
+		for _, f := range actual.Methods[identity.CredentialsTypePush].Config.RequestMethodConfigurator.(*form.HTMLForm).Fields {
+			if f.Name == push.NumberField {
+				n, err := strconv.Atoi(fmt.Sprintf("%v", f.Value))
+				require.NoError(t, err)
+				return n
+			}
+		}
+		t.Fatal("the login form does not contain the number")
+		return 0
+	}
+
+	approve := func(t *testing.T, n gjson.Result, action string, number int) (*http.Response, []byte) {
+		res, err := http.PostForm(n.Get("notification.approval_url").String(), url.Values{
+			"challenge_id":   {n.Get("notification.challenge_id").String()},
+			"secret":         {n.Get("notification.secret").String()},
+			push.ActionField: {action},
+			push.NumberField: {strconv.Itoa(number)},
+		})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	complete := func(t *testing.T, lr *login.Request) (*http.Response, []byte) {
+		res, err := session.MockCookieClient(t).PostForm(ts.URL+push.CompletePath+"?request="+lr.ID.String(), url.Values{
+			form.CSRFTokenName: {x.FakeCSRFToken},
+		})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	fetchStatus := func(t *testing.T, lr *login.Request) string {
+		_, body := x.EasyGet(t, new(http.Client), ts.URL+push.StatusPath+"?request="+lr.ID.String())
+		return gjson.GetBytes(body, "state").String()
+	}
+
+	t.Run("case=disabled", func(t *testing.T) {
+		_, res := firstFactor(t, newIdentity(t))
+		assert.Contains(t, res.Header.Get("Location"), returnTs.URL, "the session is issued without a second factor")
+	})
+
+	viper.Set(strategyKey, map[string]interface{}{
+		"enabled": true,
+		"config":  map[string]interface{}{"webhook": map[string]interface{}{"url": webhookTs.URL}},
+	})
+
+	t.Run("case=does not require a second factor without devices", func(t *testing.T) {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		_, res := firstFactor(t, i)
+		assert.Contains(t, res.Header.Get("Location"), returnTs.URL)
+	})
+
+	t.Run("case=approves the login with the matching number", func(t *testing.T) {
+		i := newIdentity(t)
+		lr, res := firstFactor(t, i)
+		require.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Equal(t, uiTs.URL+"/mfa-ts?request="+lr.ID.String(), res.Header.Get("Location"))
+
+		actual, err := reg.LoginRequestPersister().GetLoginRequest(context.Background(), lr.ID)
+		require.NoError(t, err)
+		assert.Len(t, actual.Methods, 1, "only the second factor is left")
+		assert.Equal(t, i.ID, actual.SecondFactorIdentityID.UUID)
+		assert.Equal(t, identity.CredentialsTypePassword, actual.FirstFactor)
+
+		n := lastNotification(t)
+		assert.Equal(t, i.ID.String(), n.Get("identity_id").String())
+		assert.Equal(t, "Phone", n.Get("device.name").String(), "%s", n)
+		assert.Len(t, n.Get("notification.choices").Array(), 3)
+		assert.Contains(t, n.Get("notification.choices").String(), strconv.Itoa(number(t, lr)))
+		assert.Equal(t, string(push.StatePending), fetchStatus(t, lr))
+
+		res, body := complete(t, lr)
+		assert.Contains(t, res.Request.URL.String(), errTs.URL, "%s", body)
+
+		res, body = approve(t, n, push.ActionApprove, number(t, lr))
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, string(push.StateApproved), gjson.GetBytes(body, "state").String())
+		assert.Equal(t, string(push.StateApproved), fetchStatus(t, lr))
+
+		res, body = complete(t, lr)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Contains(t, res.Request.URL.String(), returnTs.URL, "%s", body)
+		assert.Equal(t, i.ID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+
+		res, body = complete(t, lr)
+		assert.Contains(t, res.Request.URL.String(), errTs.URL, "the login can only be completed once: %s", body)
+	})
+
+	t.Run("case=denies the login if the wrong number was picked", func(t *testing.T) {
+		lr, _ := firstFactor(t, newIdentity(t))
+		n := lastNotification(t)
+
+		var wrong int
+		for _, c := range n.Get("notification.choices").Array() {
+			if int(c.Int()) != number(t, lr) {
+				wrong = int(c.Int())
+			}
+		}
+
+		res, body := approve(t, n, push.ActionApprove, wrong)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, string(push.StateDenied), gjson.GetBytes(body, "state").String())
+
+		res, body = approve(t, n, push.ActionApprove, number(t, lr))
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "guessing again is not possible: %s", body)
+
+		res, body = complete(t, lr)
+		assert.Contains(t, res.Request.URL.String(), errTs.URL, "%s", body)
+	})
+
+	t.Run("case=rejects an invalid secret", func(t *testing.T) {
+		lr, _ := firstFactor(t, newIdentity(t))
+		n := lastNotification(t)
+
+		res, err := http.PostForm(ts.URL+push.ApprovalPath, url.Values{
+			"challenge_id":   {n.Get("notification.challenge_id").String()},
+			"secret":         {"invalid"},
+			push.ActionField: {push.ActionApprove},
+			push.NumberField: {strconv.Itoa(number(t, lr))},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		assert.Equal(t, string(push.StatePending), fetchStatus(t, lr))
+	})
+
+	t.Run("case=registers and removes devices", func(t *testing.T) {
+		c := session.MockCookieClient(t)
+		session.MockHydrateCookieClient(t, c, ts.URL+"/mock-session")
+		c = noRedirects(c)
+
+		register := func(t *testing.T, provider string) (*http.Response, []byte) {
+			req := x.NewTestHTTPRequest(t, "POST", ts.URL+push.DevicesPath, strings.NewReader(url.Values{
+				"name":             {"Work Phone"},
+				"provider":         {provider},
+				"token":            {"device-token"},
+				form.CSRFTokenName: {x.FakeCSRFToken},
+			}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Accept", "application/json")
+			res, err := c.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			return res, body
+		}
+
+		res, body := register(t, push.ProviderFCM)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "fcm is not configured: %s", body)
+
+		res, body = register(t, push.ProviderWebhook)
+		require.Equal(t, http.StatusCreated, res.StatusCode, "%s", body)
+		assert.Empty(t, gjson.GetBytes(body, "token").String())
+		id := gjson.GetBytes(body, "id").String()
+
+		res, body = register(t, push.ProviderWebhook)
+		require.Equal(t, http.StatusCreated, res.StatusCode, "%s", body)
+		assert.Equal(t, id, gjson.GetBytes(body, "id").String(), "registering the same token again does not add a device")
+
+		res, body = x.EasyGet(t, c, ts.URL+push.DevicesPath)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Len(t, gjson.GetBytes(body, "devices").Array(), 1, "%s", body)
+		assert.Equal(t, "Work Phone", gjson.GetBytes(body, "devices.0.name").String(), "%s", body)
+		assert.False(t, gjson.GetBytes(body, "devices.0.token").Exists(), "%s", body)
+
+		res, err := c.PostForm(ts.URL+push.DeviceRemovePath, url.Values{"device_id": {id}, form.CSRFTokenName: {x.FakeCSRFToken}})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Equal(t, uiTs.URL+"/profile-ts", res.Header.Get("Location"))
+
+		_, body = x.EasyGet(t, c, ts.URL+push.DevicesPath)
+		assert.Empty(t, gjson.GetBytes(body, "devices").Array(), "%s", body)
+	})
+
+	t.Run("case=requires a session to register devices", func(t *testing.T) {
+		res, _ := x.EasyGet(t, new(http.Client), ts.URL+push.DevicesPath)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
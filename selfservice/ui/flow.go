@@ -0,0 +1,156 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ory/kratos/identity"
+)
+
+// The types in this file are decoded from the same JSON which the public API returns to custom UIs. They only
+// contain what the pages need.
+type (
+	message struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+
+	field struct {
+		Name     string      `json:"name"`
+		Type     string      `json:"type"`
+		Pattern  string      `json:"pattern"`
+		Disabled bool        `json:"disabled"`
+		Required bool        `json:"required"`
+		Value    interface{} `json:"value"`
+		Errors   []message   `json:"errors"`
+	}
+
+	htmlForm struct {
+		Action string    `json:"action"`
+		Method string    `json:"method"`
+		Fields []field   `json:"fields"`
+		Errors []message `json:"errors"`
+
+		// Providers is set for the "oidc" method of login and registration requests.
+		Providers []field `json:"providers"`
+
+		// Submit is the label of the submit button.
+		Submit string `json:"-"`
+	}
+
+	method struct {
+		Method identity.CredentialsType `json:"method"`
+		Config *htmlForm                `json:"config"`
+	}
+
+	// authFlow is a login or registration request.
+	authFlow struct {
+		ID        string                               `json:"id"`
+		ExpiresAt time.Time                            `json:"expires_at"`
+		Active    identity.CredentialsType             `json:"active"`
+		Methods   map[identity.CredentialsType]*method `json:"methods"`
+		Forced    bool                                 `json:"forced"`
+	}
+
+	profileFlow struct {
+		ID               string    `json:"id"`
+		ExpiresAt        time.Time `json:"expires_at"`
+		Form             *htmlForm `json:"form"`
+		UpdateSuccessful bool      `json:"update_successful"`
+	}
+
+	verificationFlow struct {
+		ID        string    `json:"id"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Form      *htmlForm `json:"form"`
+		Success   bool      `json:"success"`
+	}
+
+	recoveryFlow struct {
+		ID        string    `json:"id"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Form      *htmlForm `json:"form"`
+		Method    string    `json:"method"`
+		State     string    `json:"state"`
+	}
+
+	apiError struct {
+		Code    int                    `json:"code"`
+		Status  string                 `json:"status"`
+		Reason  string                 `json:"reason"`
+		Message string                 `json:"message"`
+		Details map[string]interface{} `json:"details"`
+	}
+
+	errorContainer struct {
+		ID     string     `json:"id"`
+		Errors []apiError `json:"errors"`
+	}
+)
+
+// SortedMethods returns the password method first, followed by all other methods in alphabetical order.
+func (f *authFlow) SortedMethods() []*method {
+	ms := make([]*method, 0, len(f.Methods))
+	for _, m := range f.Methods {
+		if m != nil && m.Config != nil {
+			ms = append(ms, m)
+		}
+	}
+
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Method == identity.CredentialsTypePassword || ms[j].Method == identity.CredentialsTypePassword {
+			return ms[i].Method == identity.CredentialsTypePassword
+		}
+		return ms[i].Method < ms[j].Method
+	})
+	return ms
+}
+
+func (f *authFlow) setSubmit(label string) {
+	for _, m := range f.Methods {
+		if m != nil && m.Config != nil {
+			m.Config.Submit = label
+		}
+	}
+}
+
+// RedirectTo returns the redirect_to detail of the error if set.
+func (e *apiError) RedirectTo() string {
+	if to, ok := e.Details["redirect_to"].(string); ok {
+		return to
+	}
+	return ""
+}
+
+// Label turns a field name such as `traits.first_name` into `First name`.
+func (f field) Label() string {
+	name := f.Name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ReplaceAll(name, "_", " ")
+	if len(name) == 0 {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// InputValue returns the value as it is set in the input's value attribute.
+func (f field) InputValue() string {
+	switch v := f.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Checked returns true for checkboxes whose value is true.
+func (f field) Checked() bool {
+	v, ok := f.Value.(bool)
+	return ok && v
+}
@@ -0,0 +1,326 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gobuffalo/packr/v2"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/selfservice/errorx"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/logout"
+	"github.com/ory/kratos/selfservice/flow/profile"
+	"github.com/ory/kratos/selfservice/flow/recovery"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/flow/verify"
+	"github.com/ory/kratos/x"
+)
+
+var box = packr.New("ui", "templates")
+
+type (
+	handlerDependencies interface {
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		BundledUIHandler() *Handler
+	}
+	// Handler serves the bundled self-service UI. The pages fetch their flows from the public API exactly like a
+	// custom UI would, which is why the handler needs to know the public router.
+	Handler struct {
+		d   handlerDependencies
+		c   configuration.Provider
+		api http.Handler
+
+		once  sync.Once
+		pages map[string]*template.Template
+		err   error
+	}
+
+	page struct {
+		Theme *configuration.BundledUIConfig
+		Title string
+		Links links
+		Flow  interface{}
+
+		// Nonce allows the inline styles and scripts of the page in the content security policy.
+		Nonce string
+	}
+
+	links struct {
+		Login        string
+		Registration string
+		Profile      string
+		Verification string
+		Logout       string
+
+		// Recovery is empty if no recovery method is enabled.
+		Recovery string
+	}
+)
+
+func NewHandler(d handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{d: d, c: c}
+}
+
+func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
+	h.api = public
+	public.GET(configuration.BundledUILoginPath, h.login)
+	public.GET(configuration.BundledUIRegistrationPath, h.registration)
+	public.GET(configuration.BundledUIProfilePath, h.profile)
+	public.GET(configuration.BundledUIVerificationPath, h.verification)
+	public.GET(configuration.BundledUIRecoveryPath, h.recovery)
+	public.GET(configuration.BundledUIErrorPath, h.selfServiceError)
+}
+
+func (h *Handler) login(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var f authFlow
+	if h.fetchFlow(w, r, login.BrowserLoginRequestsPath, login.BrowserLoginPath, &f) {
+		f.setSubmit("Sign in")
+		h.render(w, r, "login", "Sign in", &f)
+	}
+}
+
+func (h *Handler) registration(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var f authFlow
+	if h.fetchFlow(w, r, registration.BrowserRegistrationRequestsPath, registration.BrowserRegistrationPath, &f) {
+		f.setSubmit("Sign up")
+		h.render(w, r, "registration", "Sign up", &f)
+	}
+}
+
+func (h *Handler) profile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var f profileFlow
+	if h.fetchFlow(w, r, profile.PublicProfileManagementRequestPath, profile.PublicProfileManagementPath, &f) {
+		if f.Form != nil {
+			f.Form.Submit = "Save"
+		}
+		h.render(w, r, "profile", "Profile", &f)
+	}
+}
+
+func (h *Handler) verification(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var f verificationFlow
+	if h.fetchFlow(w, r, verify.PublicVerificationRequestPath, verificationInitPath, &f) {
+		if f.Form != nil {
+			f.Form.Submit = "Send verification link"
+		}
+		h.render(w, r, "verify", "Verify your email address", &f)
+	}
+}
+
+func (h *Handler) recovery(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var f recoveryFlow
+	if h.fetchFlow(w, r, recovery.PublicRecoveryRequestPath, h.recoveryInitPath(), &f) {
+		if f.Form != nil {
+			f.Form.Submit = "Continue"
+		}
+		h.render(w, r, "recovery", "Recover your account", &f)
+	}
+}
+
+// recoveryInitPath returns the path which initializes the first enabled recovery method, or an empty string.
+func (h *Handler) recoveryInitPath() string {
+	conf := h.c.SelfServiceRecovery()
+	for _, m := range []struct {
+		method  recovery.Method
+		enabled bool
+	}{
+		{method: recovery.MethodLink, enabled: conf.LinkEnabled},
+		{method: recovery.MethodSMS, enabled: conf.SMSEnabled},
+		{method: recovery.MethodManual, enabled: conf.ManualEnabled},
+	} {
+		if m.enabled {
+			return strings.ReplaceAll(recovery.PublicRecoveryInitPath, ":method", string(m.method))
+		}
+	}
+	return ""
+}
+
+func (h *Handler) selfServiceError(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !h.enabled(w, r) {
+		return
+	}
+
+	var c errorContainer
+	if e := h.fetch(w, r, errorx.ErrorsPath, url.Values{"error": {r.URL.Query().Get("error")}}, &c); e != nil {
+		c.Errors = []apiError{*e}
+	}
+	h.render(w, r, "error", "An error occurred", &c)
+}
+
+var verificationInitPath = strings.ReplaceAll(verify.PublicVerificationInitPath, ":via", "email")
+
+// fetchFlow fetches the flow whose ID is set in the `request` query parameter. If the request parameter is missing
+// or the flow can not be completed any more, a new flow is initialized. It returns false if a response was written.
+func (h *Handler) fetchFlow(w http.ResponseWriter, r *http.Request, requestPath, initPath string, flow interface{}) bool {
+	if !h.enabled(w, r) {
+		return false
+	}
+
+	initURL := urlx.AppendPaths(h.c.SelfPublicURL(), initPath).String()
+	rid := r.URL.Query().Get("request")
+	if len(rid) == 0 {
+		http.Redirect(w, r, initURL, http.StatusFound)
+		return false
+	}
+
+	e := h.fetch(w, r, requestPath, url.Values{"request": {rid}}, flow)
+	if e == nil {
+		return true
+	}
+
+	switch {
+	case len(e.RedirectTo()) > 0:
+		http.Redirect(w, r, e.RedirectTo(), http.StatusFound)
+	case e.Code == http.StatusForbidden || e.Code == http.StatusNotFound:
+		// The request belongs to another browser or identity, or does not exist at all.
+		http.Redirect(w, r, initURL, http.StatusFound)
+	default:
+		h.render(w, r, "error", "An error occurred", &errorContainer{Errors: []apiError{*e}})
+	}
+	return false
+}
+
+// fetch performs a GET request against the public API without leaving the process. The cookies of the original
+// request are forwarded and cookies set by the API are passed on to the browser. If the API responds with an error,
+// the error is returned.
+func (h *Handler) fetch(w http.ResponseWriter, r *http.Request, apiPath string, query url.Values, v interface{}) *apiError {
+	req := r.Clone(r.Context())
+	req.Method = http.MethodGet
+	req.URL = &url.URL{Path: apiPath, RawQuery: query.Encode()}
+	req.RequestURI = req.URL.RequestURI()
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	req.Header.Set("Accept", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.api.ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		http.SetCookie(w, c)
+	}
+
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			return &apiError{
+				Code:    http.StatusInternalServerError,
+				Status:  http.StatusText(http.StatusInternalServerError),
+				Message: "Unable to decode the response of the public API.",
+				Reason:  err.Error(),
+			}
+		}
+		return nil
+	}
+
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code == 0 {
+		body.Error = apiError{Code: rec.Code, Status: http.StatusText(rec.Code), Message: http.StatusText(rec.Code)}
+	}
+	return &body.Error
+}
+
+func (h *Handler) enabled(w http.ResponseWriter, r *http.Request) bool {
+	if !h.c.BundledUI().Enabled {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("The bundled self-service UI is disabled, set ui.enabled to true to enable it.")))
+		return false
+	}
+	return true
+}
+
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, name, title string, flow interface{}) {
+	h.once.Do(func() {
+		h.pages, h.err = loadPages()
+	})
+	if h.err != nil {
+		h.d.Writer().WriteError(w, r, h.err)
+		return
+	}
+
+	public := h.c.SelfPublicURL()
+	var recoveryURL string
+	if path := h.recoveryInitPath(); len(path) > 0 {
+		recoveryURL = urlx.AppendPaths(public, path).String()
+	}
+
+	p := &page{
+		Theme: h.c.BundledUI(),
+		Title: title,
+		Flow:  flow,
+		Nonce: x.CSPNonce(r),
+		Links: links{
+			Login:        urlx.AppendPaths(public, login.BrowserLoginPath).String(),
+			Registration: urlx.AppendPaths(public, registration.BrowserRegistrationPath).String(),
+			Profile:      urlx.AppendPaths(public, profile.PublicProfileManagementPath).String(),
+			Verification: urlx.AppendPaths(public, verificationInitPath).String(),
+			Logout:       urlx.AppendPaths(public, logout.BrowserLogoutPath).String(),
+			Recovery:     recoveryURL,
+		},
+	}
+
+	var b bytes.Buffer
+	if err := h.pages[name].ExecuteTemplate(&b, "layout", p); err != nil {
+		h.d.Writer().WriteError(w, r, errors.WithStack(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := b.WriteTo(w); err != nil {
+		x.ContextLogger(r.Context(), h.d.Logger()).WithError(err).Error("Unable to write the self-service UI page.")
+	}
+}
+
+// loadPages parses each page in the templates box together with the layout and the shared partials, which are
+// all templates whose names start with an underscore.
+func loadPages() (map[string]*template.Template, error) {
+	base := template.New("ui")
+	var names []string
+	for _, name := range box.List() {
+		if !strings.HasPrefix(path.Base(name), "_") {
+			names = append(names, name)
+			continue
+		}
+
+		src, err := box.FindString(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if _, err := base.New(name).Parse(src); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		src, err := box.FindString(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		t, err := base.Clone()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if _, err := t.New(name).Parse(src); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		pages[strings.TrimSuffix(name, path.Ext(name))] = t
+	}
+	return pages, nil
+}
@@ -0,0 +1,114 @@
+package ui_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/selfservice/flow/login"
+	"github.com/ory/kratos/selfservice/flow/recovery"
+	"github.com/ory/kratos/selfservice/flow/registration"
+	"github.com/ory/kratos/selfservice/strategy/password"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	conf, reg := internal.NewRegistryDefault(t)
+	reg.WithCSRFTokenGenerator(x.FakeCSRFTokenGenerator)
+
+	router := x.NewRouterPublic()
+	reg.LoginHandler().RegisterPublicRoutes(router)
+	reg.SelfServiceErrorHandler().RegisterPublicRoutes(router)
+	reg.BundledUIHandler().RegisterPublicRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword), map[string]interface{}{"enabled": true})
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(t *testing.T, path string) (*http.Response, string) {
+		res, err := client.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body)
+	}
+
+	t.Run("case=disabled", func(t *testing.T) {
+		res, _ := get(t, configuration.BundledUILoginPath)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	viper.Set(configuration.ViperKeyBundledUIEnabled, true)
+	viper.Set(configuration.ViperKeyURLsLogin, "")
+	viper.Set(configuration.ViperKeyURLsRegistration, "https://www.ory.sh/register")
+
+	t.Run("case=ui urls default to the bundled pages", func(t *testing.T) {
+		assert.Equal(t, ts.URL+configuration.BundledUILoginPath, conf.LoginURL().String())
+		assert.Equal(t, "https://www.ory.sh/register", conf.RegisterURL().String())
+	})
+
+	t.Run("case=initializes a flow if the request is missing", func(t *testing.T) {
+		res, _ := get(t, configuration.BundledUILoginPath)
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Equal(t, ts.URL+login.BrowserLoginPath, res.Header.Get("Location"))
+
+		res, _ = get(t, configuration.BundledUILoginPath+"?request="+x.NewUUID().String())
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Equal(t, ts.URL+login.BrowserLoginPath, res.Header.Get("Location"))
+	})
+
+	t.Run("case=renders the login flow", func(t *testing.T) {
+		req := x.NewTestHTTPRequest(t, "GET", ts.URL+login.BrowserLoginPath, nil)
+		lr := login.NewLoginRequest(time.Minute, x.FakeCSRFToken, req)
+		for _, s := range reg.LoginStrategies() {
+			require.NoError(t, s.PopulateLoginMethod(req, lr))
+		}
+		require.NoError(t, reg.LoginRequestPersister().CreateLoginRequest(context.Background(), lr))
+
+		res, body := get(t, configuration.BundledUILoginPath+"?request="+lr.ID.String())
+		require.Equal(t, http.StatusOK, res.StatusCode, body)
+		assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+		assert.Contains(t, body, `action="`+ts.URL+password.LoginPath+`?request=`+lr.ID.String()+`"`)
+		assert.Contains(t, body, `name="identifier"`)
+		assert.Contains(t, body, `type="password"`)
+		assert.Contains(t, body, `name="csrf_token" value="`+x.FakeCSRFToken+`"`)
+		assert.Contains(t, body, ts.URL+registration.BrowserRegistrationPath)
+		assert.NotContains(t, body, "Forgot your password?")
+
+		viper.Set(configuration.ViperKeySelfServiceRecoverySMSEnabled, true)
+		defer viper.Set(configuration.ViperKeySelfServiceRecoverySMSEnabled, false)
+
+		_, body = get(t, configuration.BundledUILoginPath+"?request="+lr.ID.String())
+		assert.Contains(t, body, `href="`+ts.URL+strings.ReplaceAll(recovery.PublicRecoveryInitPath, ":method", "sms")+`">Forgot your password?`)
+	})
+
+	t.Run("case=applies the theme", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyBundledUIThemeTitle, "Acme Inc")
+		viper.Set(configuration.ViperKeyBundledUIThemeStylesheetURL, "https://www.ory.sh/acme.css")
+		defer viper.Set(configuration.ViperKeyBundledUIThemeTitle, "")
+		defer viper.Set(configuration.ViperKeyBundledUIThemeStylesheetURL, "")
+
+		res, body := get(t, configuration.BundledUIErrorPath+"?error="+x.NewUUID().String())
+		require.Equal(t, http.StatusOK, res.StatusCode, body)
+		assert.Contains(t, body, "<title>An error occurred - Acme Inc</title>")
+		assert.Contains(t, body, `<link rel="stylesheet" href="https://www.ory.sh/acme.css">`)
+	})
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/x"
+)
+
+// BackChannelLogoutEvent is the event member of a logout token as defined by OpenID Connect Back-Channel Logout 1.0.
+const BackChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+type (
+	backChannelDependencies interface {
+		courier.Provider
+		PersistenceProvider
+	}
+	BackChannelLogoutProvider interface {
+		SessionBackChannelLogout() *BackChannelLogout
+	}
+	// BackChannelLogout notifies the configured back-channel logout clients about revoked sessions.
+	BackChannelLogout struct {
+		r backChannelDependencies
+		c configuration.Provider
+	}
+
+	// LogoutTokenClaims are the claims of a back-channel logout token.
+	LogoutTokenClaims struct {
+		Issuer    string                         `json:"iss"`
+		Audience  string                         `json:"aud"`
+		IssuedAt  int64                          `json:"iat"`
+		ID        string                         `json:"jti"`
+		Subject   string                         `json:"sub"`
+		SessionID string                         `json:"sid,omitempty"`
+		Events    map[string]map[string]struct{} `json:"events"`
+	}
+)
+
+func NewBackChannelLogout(r backChannelDependencies, c configuration.Provider) *BackChannelLogout {
+	return &BackChannelLogout{r: r, c: c}
+}
+
+// NotifySession queues a logout token for the given session at every back-channel logout client.
+func (b *BackChannelLogout) NotifySession(ctx context.Context, s *Session) error {
+	return b.notify(ctx, s.IdentityID, s.ID)
+}
+
+// NotifyIdentity queues a logout token for every session of the given identity at every back-channel logout client.
+func (b *BackChannelLogout) NotifyIdentity(ctx context.Context, identityID uuid.UUID) error {
+	return b.notify(ctx, identityID, uuid.Nil)
+}
+
+// NotifyIdentityExcept queues a logout token for every session of the given identity except the given one. It
+// must be called before the sessions are removed from the store.
+func (b *BackChannelLogout) NotifyIdentityExcept(ctx context.Context, identityID, except uuid.UUID) error {
+	if len(b.c.SelfServiceLogoutBackChannelClients()) == 0 {
+		return nil
+	}
+
+	ss, err := b.r.SessionPersister().ListSessionsFor(ctx, identityID)
+	if err != nil {
+		return err
+	}
+
+	for k := range ss {
+		if ss[k].ID == except {
+			continue
+		}
+		if err := b.notify(ctx, identityID, ss[k].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BackChannelLogout) notify(ctx context.Context, identityID, sid uuid.UUID) error {
+	for _, client := range b.c.SelfServiceLogoutBackChannelClients() {
+		token, err := NewLogoutToken([]byte(client.Secret), &LogoutTokenClaims{
+			Issuer:    b.c.SelfPublicURL().String(),
+			Audience:  client.ID,
+			IssuedAt:  time.Now().UTC().Unix(),
+			ID:        x.NewUUID().String(),
+			Subject:   identityID.String(),
+			SessionID: sessionIDClaim(sid),
+			Events:    map[string]map[string]struct{}{BackChannelLogoutEvent: {}},
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := b.r.Courier().QueueBackChannelLogout(ctx, client.URL, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sessionIDClaim(sid uuid.UUID) string {
+	if sid == uuid.Nil {
+		return ""
+	}
+	return sid.String()
+}
+
+// NewLogoutToken encodes the claims as a JSON Web Token signed with HMAC SHA-256.
+func NewLogoutToken(secret []byte, claims *LogoutTokenClaims) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "logout+jwt"})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
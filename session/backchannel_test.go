@@ -0,0 +1,153 @@
+package session_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bxcodec/faker"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/courier"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+func decodeLogoutToken(t *testing.T, secret, token string) *LogoutTokenClaims {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	require.True(t, hmac.Equal(mac.Sum(nil), signature), "signature of logout token is invalid")
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+
+	var claims LogoutTokenClaims
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	return &claims
+}
+
+func TestBackChannelLogout(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeyURLsSelfPublic, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	queued := func(t *testing.T) []courier.Message {
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 255)
+		if errors.Cause(err) == courier.ErrQueueEmpty {
+			return nil
+		}
+		require.NoError(t, err)
+		for k, m := range messages {
+			require.NoError(t, reg.CourierPersister().SetMessageStatus(context.Background(), m.ID, courier.MessageStatusSent))
+
+			body, err := m.PlaintextBody(reg.Cipher())
+			require.NoError(t, err)
+			messages[k].Body = body
+		}
+		return messages
+	}
+
+	var s1, s2 Session
+	require.NoError(t, faker.FakeData(&s1))
+	require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), s1.Identity))
+	require.NoError(t, reg.SessionPersister().CreateSession(context.Background(), &s1))
+	require.NoError(t, faker.FakeData(&s2))
+	s2.Identity = s1.Identity
+	s2.IdentityID = s1.IdentityID
+	require.NoError(t, reg.SessionPersister().CreateSession(context.Background(), &s2))
+
+	t.Run("case=does nothing without clients", func(t *testing.T) {
+		require.NoError(t, reg.SessionBackChannelLogout().NotifySession(context.Background(), &s1))
+		require.NoError(t, reg.SessionBackChannelLogout().NotifyIdentityExcept(context.Background(), s1.IdentityID, s1.ID))
+		assert.Empty(t, queued(t))
+	})
+
+	viper.Set(configuration.ViperKeySelfServiceLogoutBackChannelClients, []map[string]interface{}{
+		{"id": "app-a", "url": "https://app-a.example.org/logout", "secret": "app-a-secret-0123456789"},
+		{"id": "app-b", "url": "https://app-b.example.org/logout", "secret": "app-b-secret-0123456789"},
+	})
+
+	t.Run("case=notifies every client about a session", func(t *testing.T) {
+		require.NoError(t, reg.SessionBackChannelLogout().NotifySession(context.Background(), &s1))
+
+		messages := queued(t)
+		require.Len(t, messages, 2)
+		for _, m := range messages {
+			assert.Equal(t, courier.MessageTypeBackChannelLogout, m.Type)
+
+			var secret, audience string
+			switch m.Recipient {
+			case "https://app-a.example.org/logout":
+				secret, audience = "app-a-secret-0123456789", "app-a"
+			case "https://app-b.example.org/logout":
+				secret, audience = "app-b-secret-0123456789", "app-b"
+			default:
+				t.Fatalf("unexpected recipient: %s", m.Recipient)
+			}
+
+			claims := decodeLogoutToken(t, secret, m.Body)
+			assert.Equal(t, audience, claims.Audience)
+			assert.Equal(t, "https://www.ory.sh/", claims.Issuer)
+			assert.Equal(t, s1.IdentityID.String(), claims.Subject)
+			assert.Equal(t, s1.ID.String(), claims.SessionID)
+			assert.NotEmpty(t, claims.ID)
+			assert.NotZero(t, claims.IssuedAt)
+			assert.Contains(t, claims.Events, BackChannelLogoutEvent)
+		}
+	})
+
+	t.Run("case=notifies about all sessions of an identity", func(t *testing.T) {
+		require.NoError(t, reg.SessionBackChannelLogout().NotifyIdentity(context.Background(), s1.IdentityID))
+
+		messages := queued(t)
+		require.Len(t, messages, 2)
+		claims := decodeLogoutToken(t, "app-a-secret-0123456789", messages[0].Body)
+		if messages[0].Recipient != "https://app-a.example.org/logout" {
+			claims = decodeLogoutToken(t, "app-b-secret-0123456789", messages[0].Body)
+		}
+		assert.Equal(t, s1.IdentityID.String(), claims.Subject)
+		assert.Empty(t, claims.SessionID)
+	})
+
+	t.Run("case=skips the excepted session", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceLogoutBackChannelClients, []map[string]interface{}{
+			{"id": "app-a", "url": "https://app-a.example.org/logout", "secret": "app-a-secret-0123456789"},
+		})
+
+		require.NoError(t, reg.SessionBackChannelLogout().NotifyIdentityExcept(context.Background(), s1.IdentityID, s1.ID))
+
+		messages := queued(t)
+		require.Len(t, messages, 1)
+		claims := decodeLogoutToken(t, "app-a-secret-0123456789", messages[0].Body)
+		assert.Equal(t, s2.ID.String(), claims.SessionID)
+	})
+
+	t.Run("case=token is signed", func(t *testing.T) {
+		token, err := NewLogoutToken([]byte("secret"), &LogoutTokenClaims{Subject: x.NewUUID().String()})
+		require.NoError(t, err)
+		parts := strings.Split(token, ".")
+		require.Len(t, parts, 3)
+
+		tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"foo"}`)) + "." + parts[2]
+		mac := hmac.New(sha256.New, []byte("secret"))
+		_, _ = mac.Write([]byte(strings.Join(strings.Split(tampered, ".")[:2], ".")))
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		assert.False(t, hmac.Equal(mac.Sum(nil), signature))
+	})
+}
@@ -3,6 +3,7 @@ package session
 import (
 	"net/http"
 
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
 
@@ -11,33 +12,56 @@ import (
 	"github.com/ory/herodot"
 
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/relationship"
 	"github.com/ory/kratos/x"
 )
 
 type (
 	handlerDependencies interface {
+		identity.PrivilegedPoolProvider
 		ManagementProvider
+		PersistenceProvider
+		BackChannelLogoutProvider
+		identity.TraitsDeriverProvider
+		identity.EntitlementResolverProvider
+		identity.PairwiseSubjectsProvider
+		relationship.PersistenceProvider
 		x.WriterProvider
+		x.LoggingProvider
 	}
 	HandlerProvider interface {
 		SessionHandler() *Handler
 	}
 	Handler struct {
 		r handlerDependencies
+		c configuration.Provider
 	}
 )
 
 func NewHandler(
 	r handlerDependencies,
+	c configuration.Provider,
 ) *Handler {
 	return &Handler{
 		r: r,
+		c: c,
 	}
 }
 
 const (
 	SessionsWhoamiPath = "/sessions/whoami"
 	// SessionsWhoisPath  = "/sessions/whois"
+
+	SessionsLoginHistoryPath = "/sessions/logins"
+	SessionsSecurityPath     = "/sessions/security"
+	SessionsDelegatePath     = "/sessions/delegate"
+
+	SessionsTrustedDevicesPath       = "/sessions/trusted-devices"
+	SessionsRevokeTrustedDevicesPath = "/sessions/trusted-devices/revoke"
+
+	IdentitySessionsPath     = "/identities/:id/sessions"
+	IdentityLoginHistoryPath = "/identities/:id/logins"
 )
 
 func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
@@ -45,10 +69,28 @@ func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace} {
 		public.Handle(m, SessionsWhoamiPath, h.whoami)
 	}
+	public.GET(SessionsLoginHistoryPath, h.recentLogins)
+	public.GET(SessionsSecurityPath, h.securityOverview)
+	public.POST(SessionsDelegatePath, h.delegate)
+	public.GET(SessionsTrustedDevicesPath, h.listTrustedDevices)
+	public.POST(SessionsRevokeTrustedDevicesPath, h.revokeTrustedDevices)
 }
 
 func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 	// admin.GET(SessionsWhoisPath, h.fromPath)
+	admin.DELETE(IdentitySessionsPath, h.revokeIdentitySessions)
+	admin.GET(IdentityLoginHistoryPath, h.identityLogins)
+}
+
+// nolint:deadcode,unused
+// swagger:parameters whoami
+type whoamiParameters struct {
+	// Audience is the relying party asking. If set, the identity's ID is replaced by a pairwise subject
+	// identifier which is stable for this audience but differs between audiences, and the relationships and the
+	// delegation of the session are omitted.
+	//
+	// in: query
+	Audience string `json:"audience"`
 }
 
 // swagger:route GET /sessions/whoami public whoami
@@ -60,6 +102,9 @@ func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 //
 // This endpoint is useful for reverse proxies and API Gateways.
 //
+// If pairwise subject identifiers are enforced, see configuration key identity.pairwise.enforce, the audience is
+// required.
+//
 //     Produces:
 //     - application/json
 //
@@ -67,6 +112,7 @@ func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 //
 //     Responses:
 //       200: session
+//       400: genericError
 //       403: genericError
 //       500: genericError
 func (h *Handler) whoami(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -80,10 +126,281 @@ func (h *Handler) whoami(w http.ResponseWriter, r *http.Request, ps httprouter.P
 
 	// s.Devices = nil
 	s.Identity = s.Identity.CopyWithoutCredentials()
+	s.SetPrivilegedUntil(h.c.SelfServicePrivilegedSessionMaxAge())
+	if err := h.r.IdentityTraitsDeriver().Derive(r.Context(), s.Identity); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if s.Relationships, err = h.r.RelationshipPersister().ListRelationshipsOf(r.Context(), s.Identity.ID); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	// Without entitlements, gateways deny access to entitled features, so an unavailable resolver must not
+	// prevent users from using the rest of the application.
+	if s.Entitlements, err = h.r.IdentityEntitlementResolver().Resolve(r.Context(), s.Identity); err != nil {
+		x.ContextLogger(r.Context(), h.r.Logger()).
+			WithError(err).
+			WithField("identity_id", s.Identity.ID).
+			Warn("Unable to resolve the entitlements of the identity, the session is returned without entitlements.")
+	}
+
+	if audience := r.URL.Query().Get("audience"); len(audience) > 0 || h.c.IdentityPairwise().Enforce {
+		subject, err := h.r.PairwiseSubjects().Subject(audience, s.Identity.ID)
+		if err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+
+		// Relationships and delegations contain the IDs of other identities which would allow to correlate users.
+		s.Identity.ID = subject
+		s.Relationships = nil
+		s.Delegation = nil
+	}
 
 	h.r.Writer().Write(w, r, s)
 }
 
+// nolint:deadcode,unused
+// swagger:parameters delegateSession
+type delegateSessionParameters struct {
+	// IdentityID is the ID of the identity to sign in as.
+	//
+	// required: true
+	// in: formData
+	IdentityID string `json:"identity_id"`
+}
+
+// swagger:route POST /sessions/delegate public delegateSession
+//
+// Sign in as a related identity
+//
+// Replaces the current HTTP session with a session of the identity given by `identity_id`, for example to let a
+// parent act on behalf of a child. This requires a relationship from the current identity to that identity whose
+// type is listed in `identity.relationships.login_as`. The new session records who signed in in its `delegation`
+// field and ends when the relationship is deleted. Signing out ends it as well. The request must carry the CSRF token
+// like the other browser forms.
+//
+// Redirects to the default return URL.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       400: genericError
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (h *Handler) delegate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r,
+			errors.WithStack(herodot.ErrUnauthorized.WithReasonf("No valid session cookie found.").WithDebugf("%+v", err)),
+		)
+		return
+	}
+
+	if s.Delegation != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrForbidden.WithReason("You already signed in as another identity. Sign out first.")))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	// The relationship filter ignores a nil ID, so a missing ID would otherwise match any related identity.
+	relatedID, err := uuid.FromString(r.PostForm.Get("identity_id"))
+	if err != nil || relatedID == uuid.Nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The identity_id field must be the ID of the identity to sign in as.")))
+		return
+	}
+
+	rs, err := h.r.RelationshipPersister().ListRelationships(r.Context(), relationship.Filter{
+		IdentityID: s.Identity.ID,
+		RelatedID:  relatedID,
+	}, 100, 0)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	var allowed *relationship.Relationship
+	for k := range rs {
+		if rs[k].AllowsLoginAs(h.c.IdentityRelationshipsLoginAs()) {
+			allowed = &rs[k]
+			break
+		}
+	}
+	if allowed == nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrForbidden.WithReason("You are not allowed to sign in as this identity.")))
+		return
+	}
+
+	i, err := h.r.PrivilegedIdentityPool().GetIdentity(r.Context(), allowed.RelatedID)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	delegated := NewSession(i, r, h.c)
+	delegated.AuthenticatedAt = s.AuthenticatedAt
+	delegated.Delegation = &Delegation{IdentityID: s.Identity.ID, RelationshipID: allowed.ID}
+	if err := h.r.SessionManager().IssueToRequest(r.Context(), delegated, w, r); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	// The cookie now refers to the delegated session, so the previous one is no longer needed.
+	if err := h.r.SessionPersister().DeleteSession(r.Context(), s.ID); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "session_delegation").
+		WithField("identity_id", s.Identity.ID).
+		WithField("related_id", i.ID).
+		WithField("relationship_id", allowed.ID).
+		WithField("relationship_type", allowed.Type).
+		Info("An identity signed in as a related identity.")
+	http.Redirect(w, r, h.c.DefaultReturnToURL().String(), http.StatusFound)
+}
+
+// swagger:parameters revokeIdentitySessions
+// nolint:deadcode,unused
+type revokeIdentitySessionsParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route DELETE /identities/{id}/sessions admin revokeIdentitySessions
+//
+// Revoke all sessions of an identity
+//
+// This endpoint invalidates all sessions of the identity, effectively signing it out on every device. Configured
+// back-channel logout clients are notified about the revocation.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       400: genericError
+//       500: genericError
+func (h *Handler) revokeIdentitySessions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	iid := x.ParseUUID(ps.ByName("id"))
+	if x.IsZeroUUID(iid) {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The identity ID is missing or invalid.")))
+		return
+	}
+
+	if err := h.r.SessionBackChannelLogout().NotifyIdentity(r.Context(), iid); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.SessionPersister().DeleteSessionsFor(r.Context(), iid); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// A list of login attempts.
+//
+// swagger:response loginEvents
+// nolint:deadcode,unused
+type loginEventsResponse struct {
+	// in: body
+	Body []LoginEvent
+}
+
+// swagger:route GET /sessions/logins public recentLogins
+//
+// Get the recent login attempts of the current user
+//
+// Returns the successful and failed login attempts of the identity the current HTTP session belongs to, newest
+// first. Use this endpoint to show users the recent activity on their account.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: loginEvents
+//       401: genericError
+//       500: genericError
+func (h *Handler) recentLogins(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r,
+			errors.WithStack(herodot.ErrUnauthorized.WithReasonf("No valid session cookie found.").WithDebugf("%+v", err)),
+		)
+		return
+	}
+
+	h.writeLoginEvents(w, r, s.Identity.ID)
+}
+
+// swagger:parameters identityLogins
+// nolint:deadcode,unused
+type identityLoginsParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /identities/{id}/logins admin identityLogins
+//
+// Get the login history of an identity
+//
+// Returns the successful and failed login attempts of the identity, newest first. The number of attempts
+// kept per identity and their retention can be configured.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: loginEvents
+//       400: genericError
+//       500: genericError
+func (h *Handler) identityLogins(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	iid := x.ParseUUID(ps.ByName("id"))
+	if x.IsZeroUUID(iid) {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The identity ID is missing or invalid.")))
+		return
+	}
+
+	h.writeLoginEvents(w, r, iid)
+}
+
+func (h *Handler) writeLoginEvents(w http.ResponseWriter, r *http.Request, identityID uuid.UUID) {
+	es, err := h.r.SessionPersister().ListLoginEvents(r.Context(), identityID)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if es == nil {
+		es = []LoginEvent{}
+	}
+	h.r.Writer().Write(w, r, es)
+}
+
 // func (h *Handler) fromPath(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 // 	w.WriteHeader(505)
 // }
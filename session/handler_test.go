@@ -1,12 +1,17 @@
 package session_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,7 +21,9 @@ import (
 	"github.com/ory/viper"
 
 	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/relationship"
 	. "github.com/ory/kratos/session"
 	"github.com/ory/kratos/x"
 )
@@ -33,16 +40,16 @@ func send(code int) httprouter.Handle {
 
 func TestHandler(t *testing.T) {
 	t.Run("public", func(t *testing.T) {
-		_, reg := internal.NewRegistryDefault(t)
+		conf, reg := internal.NewRegistryDefault(t)
 		r := x.NewRouterPublic()
 		reg.WithCSRFHandler(new(x.FakeCSRFHandler))
 
 		// set this intermediate because kratos needs some valid url for CRUDE operations
 		viper.Set(configuration.ViperKeyURLsSelfPublic, "http://example.com")
-		h, _ := MockSessionCreateHandler(t, reg)
+		h, sess := MockSessionCreateHandler(t, reg)
 		r.GET("/set", h)
 
-		NewHandler(reg).RegisterPublicRoutes(r)
+		NewHandler(reg, conf).RegisterPublicRoutes(r)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 
@@ -62,6 +69,334 @@ func TestHandler(t *testing.T) {
 		res, err = client.Get(ts.URL + SessionsWhoamiPath)
 		require.NoError(t, err)
 		assert.EqualValues(t, http.StatusOK, res.StatusCode)
+
+		t.Run("case=should expose the end of the privileged session window", func(t *testing.T) {
+			res, err := client.Get(ts.URL + SessionsWhoamiPath)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			var actual Session
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&actual))
+			require.NotNil(t, actual.PrivilegedUntil)
+			x.AssertEqualTime(t, sess.AuthenticatedAt.Add(conf.SelfServicePrivilegedSessionMaxAge()), *actual.PrivilegedUntil)
+		})
+
+		t.Run("case=should expose the entitlements of the identity", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyIdentityEntitlementsStatic, map[string]interface{}{
+				"trait":   "plan",
+				"default": map[string]interface{}{"beta": true},
+			})
+			defer viper.Set(configuration.ViperKeyIdentityEntitlementsStatic, nil)
+
+			res, err := client.Get(ts.URL + SessionsWhoamiPath)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			var actual Session
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&actual))
+			assert.JSONEq(t, `{"beta":true}`, string(actual.Entitlements))
+		})
+
+		t.Run("case=should replace the identity ID by a pairwise subject identifier", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyIdentityPairwiseAudiences, []string{"forum"})
+			viper.Set(configuration.ViperKeySecretsPairwise, "pairwise-secret-0123456789")
+			defer viper.Set(configuration.ViperKeyIdentityPairwiseAudiences, []string{})
+			defer viper.Set(configuration.ViperKeyIdentityPairwiseEnforce, false)
+
+			whoami := func(t *testing.T, query string) (*http.Response, Session) {
+				res, err := client.Get(ts.URL + SessionsWhoamiPath + query)
+				require.NoError(t, err)
+				defer res.Body.Close()
+
+				var actual Session
+				if res.StatusCode == http.StatusOK {
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&actual))
+				}
+				return res, actual
+			}
+
+			expected, err := reg.PairwiseSubjects().Subject("forum", sess.Identity.ID)
+			require.NoError(t, err)
+
+			res, actual := whoami(t, "?audience=forum")
+			require.EqualValues(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, expected, actual.Identity.ID)
+
+			res, _ = whoami(t, "?audience=tracker")
+			assert.EqualValues(t, http.StatusBadRequest, res.StatusCode)
+
+			res, actual = whoami(t, "")
+			require.EqualValues(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, sess.Identity.ID, actual.Identity.ID)
+
+			viper.Set(configuration.ViperKeyIdentityPairwiseEnforce, true)
+			res, _ = whoami(t, "")
+			assert.EqualValues(t, http.StatusBadRequest, res.StatusCode)
+		})
+
+		t.Run("case=should list the recent logins of the current identity", func(t *testing.T) {
+			require.NoError(t, reg.SessionPersister().CreateLoginEvent(context.Background(), &LoginEvent{
+				ID: x.NewUUID(), IdentityID: sess.Identity.ID, Method: identity.CredentialsTypePassword, Success: true,
+			}, 10))
+
+			res, err := http.Get(ts.URL + SessionsLoginHistoryPath)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+			assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+
+			res, err = client.Get(ts.URL + SessionsLoginHistoryPath)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.EqualValues(t, http.StatusOK, res.StatusCode)
+
+			var events []LoginEvent
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&events))
+			require.Len(t, events, 1)
+			assert.Equal(t, sess.Identity.ID, events[0].IdentityID)
+			assert.True(t, events[0].Success)
+		})
+
+		t.Run("case=should show the security overview of the current identity", func(t *testing.T) {
+			res, err := http.Get(ts.URL + SessionsSecurityPath)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+			assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+
+			res, err = client.Get(ts.URL + SessionsSecurityPath)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.EqualValues(t, http.StatusOK, res.StatusCode)
+
+			var o SecurityOverview
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&o))
+			require.Len(t, o.Sessions, 1)
+			assert.Equal(t, sess.ID, o.Sessions[0].ID)
+			assert.True(t, o.Sessions[0].Current)
+			require.Len(t, o.RecentLogins, 1)
+			assert.True(t, o.RecentLogins[0].Success)
+			assert.Empty(t, o.OIDCProviders)
+			assert.NotNil(t, o.Methods)
+			assert.NotNil(t, o.TrustedDevices)
+		})
+
+		t.Run("case=should list and revoke trusted devices", func(t *testing.T) {
+			i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), sess.Identity.ID)
+			require.NoError(t, err)
+
+			trust := func() *TrustedDevice {
+				d := NewTrustedDevice(httptest.NewRequest("GET", "/", nil), i, time.Hour)
+				require.NoError(t, reg.SessionPersister().CreateTrustedDevice(context.Background(), d))
+				return d
+			}
+			first, second := trust(), trust()
+
+			stale := NewTrustedDevice(httptest.NewRequest("GET", "/", nil), i, time.Hour)
+			stale.CredentialsHash = "changed"
+			require.NoError(t, reg.SessionPersister().CreateTrustedDevice(context.Background(), stale))
+
+			list := func(t *testing.T) []TrustedDevice {
+				res, err := client.Get(ts.URL + SessionsTrustedDevicesPath)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.EqualValues(t, http.StatusOK, res.StatusCode)
+
+				var ds []TrustedDevice
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&ds))
+				return ds
+			}
+
+			revoke := func(t *testing.T, id string) *http.Response {
+				req, err := http.NewRequest("POST", ts.URL+SessionsRevokeTrustedDevicesPath, strings.NewReader(url.Values{"device_id": {id}}.Encode()))
+				require.NoError(t, err)
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set("Accept", "application/json")
+				res, err := client.Do(req)
+				require.NoError(t, err)
+				require.NoError(t, res.Body.Close())
+				return res
+			}
+
+			res, err := http.Get(ts.URL + SessionsTrustedDevicesPath)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+			assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+
+			ds := list(t)
+			require.Len(t, ds, 2, "devices trusted before the credentials changed must not be listed")
+			assert.ElementsMatch(t, []uuid.UUID{first.ID, second.ID}, []uuid.UUID{ds[0].ID, ds[1].ID})
+
+			assert.EqualValues(t, http.StatusNoContent, revoke(t, first.ID.String()).StatusCode)
+			assert.EqualValues(t, http.StatusNotFound, revoke(t, first.ID.String()).StatusCode)
+			for _, d := range list(t) {
+				assert.NotEqual(t, first.ID, d.ID)
+			}
+
+			assert.EqualValues(t, http.StatusNoContent, revoke(t, "").StatusCode)
+			assert.Len(t, list(t), 0)
+			_, err = reg.SessionPersister().GetTrustedDevice(context.Background(), second.ID)
+			require.Error(t, err)
+		})
+	})
+
+	t.Run("delegate", func(t *testing.T) {
+		conf, reg := internal.NewRegistryDefault(t)
+		r := x.NewRouterPublic()
+		reg.WithCSRFHandler(new(x.FakeCSRFHandler))
+
+		viper.Set(configuration.ViperKeyURLsSelfPublic, "http://example.com")
+		h, parent := MockSessionCreateHandler(t, reg)
+		r.GET("/set", h)
+
+		NewHandler(reg, conf).RegisterPublicRoutes(r)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+
+		viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+		viper.Set(configuration.ViperKeyURLsDefaultReturnTo, ts.URL+SessionsWhoamiPath)
+		viper.Set(configuration.ViperKeyIdentityRelationshipsLoginAs, []string{"parent"})
+		defer viper.Set(configuration.ViperKeyIdentityRelationshipsLoginAs, []string{})
+
+		child := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), child))
+		friend := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), friend))
+
+		for _, rel := range []struct {
+			t  string
+			id uuid.UUID
+		}{{t: "parent", id: child.ID}, {t: "friend", id: friend.ID}} {
+			r, err := relationship.NewRelationship(rel.t, parent.Identity.ID, rel.id)
+			require.NoError(t, err)
+			require.NoError(t, reg.RelationshipPersister().CreateRelationship(context.Background(), r))
+		}
+
+		client := MockCookieClient(t)
+		MockHydrateCookieClient(t, client, ts.URL+"/set")
+
+		delegate := func(c *http.Client, id string) *http.Response {
+			res, err := c.PostForm(ts.URL+SessionsDelegatePath, url.Values{"identity_id": {id}})
+			require.NoError(t, err)
+			return res
+		}
+
+		res, err := client.Get(ts.URL + SessionsDelegatePath + "?identity_id=" + child.ID.String())
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.EqualValues(t, http.StatusMethodNotAllowed, res.StatusCode, "only forms protected against CSRF may sign in as another identity")
+
+		res = delegate(http.DefaultClient, child.ID.String())
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+
+		res = delegate(client, friend.ID.String())
+		require.NoError(t, res.Body.Close())
+		assert.EqualValues(t, http.StatusForbidden, res.StatusCode, "friends may not sign in as each other")
+
+		for _, id := range []string{"", "not-an-id", uuid.Nil.String()} {
+			res = delegate(client, id)
+			require.NoError(t, res.Body.Close())
+			assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%q must not match any related identity", id)
+		}
+
+		res, err = client.Get(ts.URL + SessionsWhoamiPath)
+		require.NoError(t, err)
+		var actual Session
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&actual))
+		require.NoError(t, res.Body.Close())
+		assert.Len(t, actual.Relationships, 2)
+
+		res = delegate(client, child.ID.String())
+		require.EqualValues(t, http.StatusOK, res.StatusCode)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&actual))
+		require.NoError(t, res.Body.Close())
+		assert.Equal(t, child.ID, actual.Identity.ID)
+		require.NotNil(t, actual.Delegation)
+		assert.Equal(t, parent.Identity.ID, actual.Delegation.IdentityID)
+
+		_, err = reg.SessionPersister().GetSession(context.Background(), parent.ID)
+		require.Error(t, err, "the parent's session was replaced")
+
+		res = delegate(client, child.ID.String())
+		require.NoError(t, res.Body.Close())
+		assert.EqualValues(t, http.StatusForbidden, res.StatusCode, "delegated sessions can not be delegated again")
+
+		rs, err := reg.RelationshipPersister().ListRelationships(context.Background(), relationship.Filter{Type: "parent"}, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, rs, 1)
+		require.NoError(t, reg.RelationshipPersister().DeleteRelationship(context.Background(), rs[0].ID))
+
+		res, err = client.Get(ts.URL + SessionsWhoamiPath)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode, "the session ends with the relationship")
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		conf, reg := internal.NewRegistryDefault(t)
+		r := x.NewRouterAdmin()
+		NewHandler(reg, conf).RegisterAdminRoutes(r)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+
+		viper.Set(configuration.ViperKeyURLsSelfPublic, "http://example.com")
+		_, s := MockSessionCreateHandler(t, reg)
+
+		var revoke = func(t *testing.T, id string, expectCode int) {
+			req, err := http.NewRequest("DELETE", ts.URL+strings.Replace(IdentitySessionsPath, ":id", id, 1), nil)
+			require.NoError(t, err)
+			res, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+			assert.EqualValues(t, expectCode, res.StatusCode)
+		}
+
+		t.Run("case=should fail on invalid identity id", func(t *testing.T) {
+			revoke(t, "not-a-uuid", http.StatusBadRequest)
+		})
+
+		var logins = func(t *testing.T, id string, expectCode int) []LoginEvent {
+			res, err := ts.Client().Get(ts.URL + strings.Replace(IdentityLoginHistoryPath, ":id", id, 1))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.EqualValues(t, expectCode, res.StatusCode)
+
+			var events []LoginEvent
+			if expectCode == http.StatusOK {
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&events))
+			}
+			return events
+		}
+
+		t.Run("case=should fail to list logins on invalid identity id", func(t *testing.T) {
+			logins(t, "not-a-uuid", http.StatusBadRequest)
+		})
+
+		t.Run("case=should list the login history of the identity", func(t *testing.T) {
+			assert.Len(t, logins(t, s.Identity.ID.String(), http.StatusOK), 0)
+
+			for _, success := range []bool{false, true} {
+				require.NoError(t, reg.SessionPersister().CreateLoginEvent(context.Background(), &LoginEvent{
+					ID: x.NewUUID(), IdentityID: s.Identity.ID, Method: identity.CredentialsTypePassword, Success: success,
+				}, 10))
+				time.Sleep(time.Second)
+			}
+
+			events := logins(t, s.Identity.ID.String(), http.StatusOK)
+			require.Len(t, events, 2)
+			assert.True(t, events[0].Success, "the newest login must be listed first")
+			assert.False(t, events[1].Success)
+		})
+
+		t.Run("case=should revoke all sessions of the identity", func(t *testing.T) {
+			_, err := reg.SessionPersister().GetSession(context.Background(), s.ID)
+			require.NoError(t, err)
+
+			revoke(t, s.Identity.ID.String(), http.StatusNoContent)
+
+			_, err = reg.SessionPersister().GetSession(context.Background(), s.ID)
+			require.Error(t, err)
+		})
 	})
 }
 
@@ -0,0 +1,115 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+// maxUserAgentLength is the size of the user_agent column.
+const maxUserAgentLength = 255
+
+// LoginEvent is an entry in the login history of an identity.
+//
+// swagger:model loginEvent
+type LoginEvent struct {
+	// required: true
+	ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+	// IdentityID is the ID of the identity which tried to log in.
+	//
+	// required: true
+	IdentityID uuid.UUID `json:"identity_id" faker:"-" db:"identity_id"`
+
+	// Method is the credentials type which was used, for example "password" or "oidc".
+	//
+	// required: true
+	Method identity.CredentialsType `json:"method" db:"method"`
+
+	// Success is true if the login attempt was successful.
+	//
+	// required: true
+	Success bool `json:"success" db:"success"`
+
+	// IPAddress is the address of the client which tried to log in.
+	IPAddress string `json:"ip_address" db:"ip_address"`
+
+	// UserAgent is the user agent of the client which tried to log in.
+	UserAgent string `json:"user_agent" db:"user_agent"`
+
+	// CreatedAt is the time (UTC) of the login attempt.
+	//
+	// required: true
+	CreatedAt time.Time `json:"created_at" faker:"time_type" db:"created_at"`
+
+	// UpdatedAt is a helper struct field for gobuffalo.pop.
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (e LoginEvent) TableName() string {
+	return "identity_login_events"
+}
+
+type (
+	loginHistoryDependencies interface {
+		PersistenceProvider
+		x.LoggingProvider
+	}
+	LoginHistoryProvider interface {
+		LoginHistory() *LoginHistory
+	}
+	// LoginHistory records successful and failed login attempts of identities.
+	LoginHistory struct {
+		r loginHistoryDependencies
+		c configuration.Provider
+	}
+)
+
+func NewLoginHistory(r loginHistoryDependencies, c configuration.Provider) *LoginHistory {
+	return &LoginHistory{r: r, c: c}
+}
+
+// Record adds a login attempt to the identity's login history. Errors are logged but not returned
+// because a failure to record the attempt must not fail the login.
+func (h *LoginHistory) Record(r *http.Request, identityID uuid.UUID, method identity.CredentialsType, success bool) {
+	max := h.c.SelfServiceLoginHistoryMaxEntries()
+	if max < 1 {
+		return
+	}
+
+	var ip string
+	if addr := x.ClientIP(r); addr != nil {
+		ip = addr.String()
+	}
+
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+
+	e := &LoginEvent{
+		ID:         x.NewUUID(),
+		IdentityID: identityID,
+		Method:     method,
+		Success:    success,
+		IPAddress:  ip,
+		UserAgent:  ua,
+	}
+	if err := h.r.SessionPersister().CreateLoginEvent(r.Context(), e, max); err != nil {
+		x.ContextLogger(r.Context(), h.r.Logger()).
+			WithError(err).
+			WithField("identity_id", identityID).
+			Warn("Unable to record login attempt in the login history.")
+	}
+}
+
+// Prune removes all login events which are older than the configured retention.
+func (h *LoginHistory) Prune(ctx context.Context) error {
+	return h.r.SessionPersister().DeleteLoginEventsBefore(ctx, time.Now().UTC().Add(-h.c.SelfServiceLoginHistoryRetention()))
+}
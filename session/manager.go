@@ -21,6 +21,10 @@ var (
 type Manager interface {
 	CreateToRequest(context.Context, *identity.Identity, http.ResponseWriter, *http.Request) (*Session, error)
 
+	// IssueToRequest stores the session and creates an HTTP session for it using cookies. It fails if one of the
+	// LoginChecker rejects the identity. Every session is issued through it, so no flow can skip the checks.
+	IssueToRequest(context.Context, *Session, http.ResponseWriter, *http.Request) error
+
 	// SaveToRequest creates an HTTP session using cookies.
 	SaveToRequest(context.Context, *Session, http.ResponseWriter, *http.Request) error
 
@@ -34,3 +38,23 @@ type Manager interface {
 type ManagementProvider interface {
 	SessionManager() Manager
 }
+
+// LoginChecker decides whether an identity may be signed in, for example because it was deactivated or its
+// registration still awaits approval.
+type LoginChecker interface {
+	CheckLogin(ctx context.Context, i *identity.Identity) error
+}
+
+type LoginCheckerProvider interface {
+	SessionLoginCheckers() []LoginChecker
+}
+
+// CheckLogin returns the error of the first LoginChecker which rejects the identity.
+func CheckLogin(ctx context.Context, d LoginCheckerProvider, i *identity.Identity) error {
+	for _, c := range d.SessionLoginCheckers() {
+		if err := c.CheckLogin(ctx, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
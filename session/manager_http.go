@@ -6,9 +6,11 @@ import (
 	"time"
 
 	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
 	"github.com/pkg/errors"
 
 	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/stringsx"
 
 	"github.com/ory/herodot"
 
@@ -21,16 +23,21 @@ type (
 		PersistenceProvider
 		x.CookieProvider
 		identity.PoolProvider
+		LoginCheckerProvider
 		x.CSRFProvider
 	}
 	managerHTTPConfiguration interface {
 		SessionLifespan() time.Duration
 		SessionSecrets() [][]byte
+		SessionSameSiteMode() http.SameSite
+		SessionCookieName() string
+		SessionCookieDomain() string
+		SessionCookiePath() string
+		SessionCookieSecure() bool
 	}
 	ManagerHTTP struct {
-		c          managerHTTPConfiguration
-		cookieName string
-		r          managerHTTPDependencies
+		c managerHTTPConfiguration
+		r managerHTTPDependencies
 	}
 )
 
@@ -39,28 +46,57 @@ func NewManagerHTTP(
 	r managerHTTPDependencies,
 ) *ManagerHTTP {
 	return &ManagerHTTP{
-		c:          c,
-		r:          r,
-		cookieName: DefaultSessionCookieName,
+		c: c,
+		r: r,
 	}
 }
 
-func (s *ManagerHTTP) CreateToRequest(ctx context.Context, i *identity.Identity, w http.ResponseWriter, r *http.Request) (*Session, error) {
-	p := NewSession(i, r, s.c)
-	if err := s.r.SessionPersister().CreateSession(ctx, p); err != nil {
+func (s *ManagerHTTP) cookieName() string {
+	return stringsx.Coalesce(s.c.SessionCookieName(), DefaultSessionCookieName)
+}
+
+// getCookie loads the session cookie and applies the configured cookie attributes to it.
+func (s *ManagerHTTP) getCookie(r *http.Request) (*sessions.Session, error) {
+	cookie, err := s.r.CookieManager().Get(r, s.cookieName())
+	if cookie == nil {
 		return nil, err
 	}
 
-	if err := s.SaveToRequest(ctx, p, w, r); err != nil {
+	if domain := s.c.SessionCookieDomain(); len(domain) > 0 {
+		cookie.Options.Domain = domain
+	}
+	if path := s.c.SessionCookiePath(); len(path) > 0 {
+		cookie.Options.Path = path
+	}
+	cookie.Options.Secure = s.c.SessionCookieSecure()
+	cookie.Options.SameSite = s.c.SessionSameSiteMode()
+	return cookie, err
+}
+
+func (s *ManagerHTTP) CreateToRequest(ctx context.Context, i *identity.Identity, w http.ResponseWriter, r *http.Request) (*Session, error) {
+	p := NewSession(i, r, s.c)
+	if err := s.IssueToRequest(ctx, p, w, r); err != nil {
 		return nil, err
 	}
 
 	return p, nil
 }
 
+func (s *ManagerHTTP) IssueToRequest(ctx context.Context, session *Session, w http.ResponseWriter, r *http.Request) error {
+	if err := CheckLogin(ctx, s.r, session.Identity); err != nil {
+		return err
+	}
+
+	if err := s.r.SessionPersister().CreateSession(ctx, session); err != nil {
+		return err
+	}
+
+	return s.SaveToRequest(ctx, session, w, r)
+}
+
 func (s *ManagerHTTP) SaveToRequest(ctx context.Context, session *Session, w http.ResponseWriter, r *http.Request) error {
 	_ = s.r.CSRFHandler().RegenerateToken(w, r)
-	cookie, _ := s.r.CookieManager().Get(r, s.cookieName)
+	cookie, _ := s.getCookie(r)
 	cookie.Values["sid"] = session.ID.String()
 	if err := cookie.Save(r, w); err != nil {
 		return errors.WithStack(err)
@@ -69,7 +105,7 @@ func (s *ManagerHTTP) SaveToRequest(ctx context.Context, session *Session, w htt
 }
 
 func (s *ManagerHTTP) FetchFromRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) (*Session, error) {
-	cookie, err := s.r.CookieManager().Get(r, s.cookieName)
+	cookie, err := s.getCookie(r)
 	if err != nil {
 		if _, ok := err.(securecookie.Error); ok {
 			// If securecookie returns an error, the HMAC is probably invalid. In that case, we really want
@@ -101,7 +137,7 @@ func (s *ManagerHTTP) FetchFromRequest(ctx context.Context, w http.ResponseWrite
 }
 
 func (s *ManagerHTTP) PurgeFromRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	cookie, _ := s.r.CookieManager().Get(r, s.cookieName)
+	cookie, _ := s.getCookie(r)
 	cookie.Options.MaxAge = -1
 	if err := cookie.Save(r, w); err != nil {
 		return errors.WithStack(err)
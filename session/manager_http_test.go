@@ -5,11 +5,19 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
 	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/schedule"
 	"github.com/ory/kratos/session"
 	"github.com/ory/kratos/x"
 )
@@ -36,4 +44,45 @@ func TestManagerHTTP(t *testing.T) {
 		require.NoError(t, reg.SessionManager().SaveToRequest(context.Background(), new(session.Session), httptest.NewRecorder(), new(http.Request)))
 		assert.Equal(t, 1, mock.c)
 	})
+
+	t.Run("method=SaveToRequest/case=applies cookie configuration", func(t *testing.T) {
+		_, reg := internal.NewRegistryDefault(t)
+		reg.WithCSRFHandler(new(mockCSRFHandler))
+
+		viper.Set(configuration.ViperKeySessionCookieName, "my_session")
+		viper.Set(configuration.ViperKeySessionCookieDomain, "example.org")
+		viper.Set(configuration.ViperKeySessionCookiePath, "/app")
+		viper.Set(configuration.ViperKeySessionCookieSecure, true)
+		viper.Set(configuration.ViperKeySessionSameSite, "Strict")
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, reg.SessionManager().SaveToRequest(context.Background(), new(session.Session), rec, new(http.Request)))
+
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "my_session", cookies[0].Name)
+		assert.Equal(t, "example.org", cookies[0].Domain)
+		assert.Equal(t, "/app", cookies[0].Path)
+		assert.True(t, cookies[0].Secure)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+	})
+	t.Run("method=IssueToRequest/case=rejects identities which may not sign in", func(t *testing.T) {
+		conf, reg := internal.NewRegistryDefault(t)
+		reg.WithCSRFHandler(new(mockCSRFHandler))
+
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		require.NoError(t, reg.ScheduledActionPersister().DeactivateIdentity(context.Background(), &schedule.Deactivation{
+			IdentityID: i.ID, ActionID: x.NewUUID(), CreatedAt: time.Now().UTC()}))
+
+		rec := httptest.NewRecorder()
+		err := reg.SessionManager().IssueToRequest(context.Background(), session.NewSession(i, new(http.Request), conf), rec, new(http.Request))
+		assert.Equal(t, schedule.ErrIdentityDeactivated, errors.Cause(err))
+		assert.Empty(t, rec.Result().Cookies())
+
+		sessions, err := reg.SessionPersister().ListSessionsFor(context.Background(), i.ID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
 }
@@ -3,6 +3,7 @@ package session
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/bxcodec/faker"
 	"github.com/gofrs/uuid"
@@ -30,8 +31,45 @@ type Persister interface {
 	// Delete removes a session from the store
 	DeleteSession(ctx context.Context, sid uuid.UUID) error
 
-	// DeleteSessionsFor removes all active session from the store for the given identity.
+	// ListSessionsFor returns all sessions of the given identity. The sessions' identities are not loaded.
+	ListSessionsFor(ctx context.Context, identityID uuid.UUID) ([]Session, error)
+
+	// DeleteSessionsFor removes all active session from the store for the given identity, including the sessions in
+	// which it signed in as a related identity.
 	DeleteSessionsFor(ctx context.Context, sid uuid.UUID) error
+
+	// DeleteSessionsForExcept removes all active session from the store for the given identity except
+	// the session with the given ID.
+	DeleteSessionsForExcept(ctx context.Context, identityID, except uuid.UUID) error
+
+	// CreateLoginEvent adds an event to the login history of an identity and removes its oldest events
+	// so that at most max events remain.
+	CreateLoginEvent(ctx context.Context, e *LoginEvent, max int) error
+
+	// ListLoginEvents returns the login history of an identity, newest first.
+	ListLoginEvents(ctx context.Context, identityID uuid.UUID) ([]LoginEvent, error)
+
+	// DeleteLoginEventsBefore removes all login events which happened before the given time.
+	DeleteLoginEventsBefore(ctx context.Context, before time.Time) error
+
+	// CreateTrustedDevice adds a trusted device to the store.
+	CreateTrustedDevice(ctx context.Context, d *TrustedDevice) error
+
+	// GetTrustedDevice retrieves a trusted device from the store.
+	GetTrustedDevice(ctx context.Context, id uuid.UUID) (*TrustedDevice, error)
+
+	// ListTrustedDevices returns the unexpired trusted devices of an identity, newest first.
+	ListTrustedDevices(ctx context.Context, identityID uuid.UUID) ([]TrustedDevice, error)
+
+	// DeleteTrustedDevice removes a trusted device of an identity. It returns sqlcon.ErrNoRows if the identity
+	// has no such device.
+	DeleteTrustedDevice(ctx context.Context, identityID, id uuid.UUID) error
+
+	// DeleteTrustedDevices removes all trusted devices of an identity.
+	DeleteTrustedDevices(ctx context.Context, identityID uuid.UUID) error
+
+	// DeleteExpiredTrustedDevices removes all trusted devices which expired before the given time.
+	DeleteExpiredTrustedDevices(ctx context.Context, before time.Time) error
 }
 
 func TestPersister(p interface {
@@ -81,6 +119,31 @@ func TestPersister(p interface {
 			require.Error(t, err)
 		})
 
+		t.Run("case=list sessions for", func(t *testing.T) {
+			var expected1 Session
+			var expected2 Session
+			require.NoError(t, faker.FakeData(&expected1))
+			require.NoError(t, p.CreateIdentity(context.Background(), expected1.Identity))
+			require.NoError(t, p.CreateSession(context.Background(), &expected1))
+
+			require.NoError(t, faker.FakeData(&expected2))
+			expected2.Identity = expected1.Identity
+			expected2.IdentityID = expected1.IdentityID
+			require.NoError(t, p.CreateSession(context.Background(), &expected2))
+
+			actual, err := p.ListSessionsFor(context.Background(), expected1.IdentityID)
+			require.NoError(t, err)
+			require.Len(t, actual, 2)
+
+			ids := []uuid.UUID{actual[0].ID, actual[1].ID}
+			assert.Contains(t, ids, expected1.ID)
+			assert.Contains(t, ids, expected2.ID)
+
+			actual, err = p.ListSessionsFor(context.Background(), x.NewUUID())
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+		})
+
 		t.Run("case=delete session for", func(t *testing.T) {
 			var expected1 Session
 			var expected2 Session
@@ -100,5 +163,154 @@ func TestPersister(p interface {
 			_, err = p.GetSession(context.Background(), expected2.ID)
 			require.Error(t, err)
 		})
+
+		t.Run("case=delete session for except one", func(t *testing.T) {
+			var expected1 Session
+			var expected2 Session
+			require.NoError(t, faker.FakeData(&expected1))
+			require.NoError(t, p.CreateIdentity(context.Background(), expected1.Identity))
+
+			require.NoError(t, p.CreateSession(context.Background(), &expected1))
+
+			require.NoError(t, faker.FakeData(&expected2))
+			expected2.Identity = expected1.Identity
+			expected2.IdentityID = expected1.IdentityID
+			require.NoError(t, p.CreateSession(context.Background(), &expected2))
+
+			require.NoError(t, p.DeleteSessionsForExcept(context.Background(), expected2.IdentityID, expected2.ID))
+			_, err := p.GetSession(context.Background(), expected1.ID)
+			require.Error(t, err)
+			_, err = p.GetSession(context.Background(), expected2.ID)
+			require.NoError(t, err)
+		})
+
+		t.Run("case=delete sessions for deletes delegated sessions", func(t *testing.T) {
+			var delegator Session
+			require.NoError(t, faker.FakeData(&delegator))
+			require.NoError(t, p.CreateIdentity(context.Background(), delegator.Identity))
+			require.NoError(t, p.CreateSession(context.Background(), &delegator))
+
+			var related identity.Identity
+			require.NoError(t, faker.FakeData(&related))
+			require.NoError(t, p.CreateIdentity(context.Background(), &related))
+
+			delegate := func(t *testing.T) {
+				var delegated Session
+				require.NoError(t, faker.FakeData(&delegated))
+				delegated.Identity = &related
+				delegated.IdentityID = related.ID
+				delegated.Delegation = &Delegation{IdentityID: delegator.IdentityID, RelationshipID: x.NewUUID()}
+				require.NoError(t, p.CreateSession(context.Background(), &delegated))
+			}
+
+			delegate(t)
+			require.NoError(t, p.DeleteSessionsForExcept(context.Background(), delegator.IdentityID, delegator.ID))
+			actual, err := p.ListSessionsFor(context.Background(), related.ID)
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+			_, err = p.GetSession(context.Background(), delegator.ID)
+			require.NoError(t, err)
+
+			delegate(t)
+			require.NoError(t, p.DeleteSessionsFor(context.Background(), delegator.IdentityID))
+			actual, err = p.ListSessionsFor(context.Background(), related.ID)
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+		})
+
+		t.Run("case=login history", func(t *testing.T) {
+			var s Session
+			require.NoError(t, faker.FakeData(&s))
+			require.NoError(t, p.CreateIdentity(context.Background(), s.Identity))
+
+			for k := 0; k < 4; k++ {
+				require.NoError(t, p.CreateLoginEvent(context.Background(), &LoginEvent{
+					ID:         x.NewUUID(),
+					IdentityID: s.Identity.ID,
+					Method:     identity.CredentialsTypePassword,
+					Success:    k%2 == 0,
+					IPAddress:  "127.0.0.1",
+					UserAgent:  "test",
+					CreatedAt:  time.Now().UTC().Add(time.Duration(k-10) * time.Hour),
+				}, 3))
+			}
+
+			actual, err := p.ListLoginEvents(context.Background(), s.Identity.ID)
+			require.NoError(t, err)
+			require.Len(t, actual, 3, "only the newest events must be kept")
+			assert.True(t, actual[0].CreatedAt.After(actual[1].CreatedAt), "events must be ordered newest first")
+			assert.False(t, actual[0].Success)
+			assert.Equal(t, identity.CredentialsTypePassword, actual[0].Method)
+			assert.Equal(t, "127.0.0.1", actual[0].IPAddress)
+
+			require.NoError(t, p.DeleteLoginEventsBefore(context.Background(), time.Now().UTC().Add(-8*time.Hour-30*time.Minute)))
+			actual, err = p.ListLoginEvents(context.Background(), s.Identity.ID)
+			require.NoError(t, err)
+			assert.Len(t, actual, 2)
+
+			actual, err = p.ListLoginEvents(context.Background(), x.NewUUID())
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+		})
+
+		t.Run("case=trusted devices", func(t *testing.T) {
+			var s Session
+			require.NoError(t, faker.FakeData(&s))
+			require.NoError(t, p.CreateIdentity(context.Background(), s.Identity))
+
+			newDevice := func(expiresIn time.Duration) *TrustedDevice {
+				d := &TrustedDevice{
+					ID:              x.NewUUID(),
+					IdentityID:      s.Identity.ID,
+					CredentialsHash: identity.CredentialsFingerprint(s.Identity.Credentials),
+					IPAddress:       "127.0.0.1",
+					UserAgent:       "test",
+					ExpiresAt:       time.Now().UTC().Add(expiresIn),
+					CreatedAt:       time.Now().UTC().Add(expiresIn - 3*time.Hour),
+				}
+				require.NoError(t, p.CreateTrustedDevice(context.Background(), d))
+				return d
+			}
+
+			expired := newDevice(-time.Hour)
+			first := newDevice(time.Hour)
+			second := newDevice(2 * time.Hour)
+
+			actual, err := p.GetTrustedDevice(context.Background(), first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, first.IdentityID, actual.IdentityID)
+			assert.Equal(t, first.CredentialsHash, actual.CredentialsHash)
+			assert.Equal(t, "127.0.0.1", actual.IPAddress)
+			assert.EqualValues(t, first.ExpiresAt.Unix(), actual.ExpiresAt.Unix())
+
+			_, err = p.GetTrustedDevice(context.Background(), x.NewUUID())
+			require.Error(t, err)
+
+			ds, err := p.ListTrustedDevices(context.Background(), s.Identity.ID)
+			require.NoError(t, err)
+			require.Len(t, ds, 2, "expired devices must not be listed")
+			assert.Equal(t, second.ID, ds[0].ID, "devices must be ordered newest first")
+			assert.Equal(t, first.ID, ds[1].ID)
+
+			ds, err = p.ListTrustedDevices(context.Background(), x.NewUUID())
+			require.NoError(t, err)
+			assert.Len(t, ds, 0)
+
+			require.Error(t, p.DeleteTrustedDevice(context.Background(), x.NewUUID(), first.ID), "devices of other identities must not be deleted")
+			require.NoError(t, p.DeleteTrustedDevice(context.Background(), s.Identity.ID, first.ID))
+			_, err = p.GetTrustedDevice(context.Background(), first.ID)
+			require.Error(t, err)
+
+			require.NoError(t, p.DeleteExpiredTrustedDevices(context.Background(), time.Now().UTC()))
+			_, err = p.GetTrustedDevice(context.Background(), expired.ID)
+			require.Error(t, err)
+			_, err = p.GetTrustedDevice(context.Background(), second.ID)
+			require.NoError(t, err)
+
+			require.NoError(t, p.DeleteTrustedDevices(context.Background(), s.Identity.ID))
+			ds, err = p.ListTrustedDevices(context.Background(), s.Identity.ID)
+			require.NoError(t, err)
+			assert.Len(t, ds, 0)
+		})
 	}
 }
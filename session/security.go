@@ -0,0 +1,183 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/identity"
+)
+
+// securityOverviewRecentLogins is the number of login attempts included in the security overview.
+const securityOverviewRecentLogins = 10
+
+type (
+	// SecurityOverview aggregates everything a user needs to review the security of their account.
+	//
+	// swagger:model securityOverview
+	SecurityOverview struct {
+		// Sessions are the active sessions of the identity.
+		//
+		// required: true
+		Sessions []ActiveSession `json:"sessions"`
+
+		// Methods are the credential types the identity can sign in with, for example "password".
+		//
+		// required: true
+		Methods []identity.CredentialsType `json:"methods"`
+
+		// OIDCProviders are the IDs of the OpenID Connect providers linked to the identity.
+		//
+		// required: true
+		OIDCProviders []string `json:"oidc_providers"`
+
+		// RecentLogins are the most recent successful and failed login attempts, newest first.
+		//
+		// required: true
+		RecentLogins []LoginEvent `json:"recent_logins"`
+
+		// UnverifiedAddresses are the addresses of the identity which have not been verified yet.
+		//
+		// required: true
+		UnverifiedAddresses []identity.VerifiableAddress `json:"unverified_addresses"`
+
+		// TrustedDevices are the browsers which do not have to complete the second factor when signing in.
+		//
+		// required: true
+		TrustedDevices []TrustedDevice `json:"trusted_devices"`
+	}
+
+	// ActiveSession is a session as shown in the security overview.
+	//
+	// swagger:model activeSession
+	ActiveSession struct {
+		// required: true
+		ID uuid.UUID `json:"sid"`
+
+		// required: true
+		AuthenticatedAt time.Time `json:"authenticated_at"`
+
+		// required: true
+		IssuedAt time.Time `json:"issued_at"`
+
+		// required: true
+		ExpiresAt time.Time `json:"expires_at"`
+
+		// Current is true for the session which was used to request the overview.
+		//
+		// required: true
+		Current bool `json:"current"`
+	}
+)
+
+// swagger:route GET /sessions/security public securityOverview
+//
+// Get the security overview of the current user
+//
+// Returns the active sessions, sign in methods, linked OpenID Connect providers, recent login attempts,
+// unverified addresses, and trusted devices of the identity the current HTTP session belongs to. Use this endpoint
+// to render an "account security" page with a single request.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: securityOverview
+//       401: genericError
+//       500: genericError
+func (h *Handler) securityOverview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r,
+			errors.WithStack(herodot.ErrUnauthorized.WithReasonf("No valid session cookie found.").WithDebugf("%+v", err)),
+		)
+		return
+	}
+
+	o, err := h.newSecurityOverview(r.Context(), s)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, o)
+}
+
+func (h *Handler) newSecurityOverview(ctx context.Context, current *Session) (*SecurityOverview, error) {
+	i, err := h.r.PrivilegedIdentityPool().GetIdentityConfidential(ctx, current.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	ss, err := h.r.SessionPersister().ListSessionsFor(ctx, i.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	es, err := h.r.SessionPersister().ListLoginEvents(ctx, i.ID)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := h.trustedDevices(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(es) > securityOverviewRecentLogins {
+		es = es[:securityOverviewRecentLogins]
+	}
+
+	o := &SecurityOverview{
+		Sessions:            []ActiveSession{},
+		Methods:             []identity.CredentialsType{},
+		OIDCProviders:       []string{},
+		RecentLogins:        append([]LoginEvent{}, es...),
+		UnverifiedAddresses: []identity.VerifiableAddress{},
+		TrustedDevices:      append([]TrustedDevice{}, ds...),
+	}
+
+	now := time.Now()
+	for _, s := range ss {
+		if s.ExpiresAt.Before(now) {
+			continue
+		}
+		o.Sessions = append(o.Sessions, ActiveSession{
+			ID:              s.ID,
+			AuthenticatedAt: s.AuthenticatedAt,
+			IssuedAt:        s.IssuedAt,
+			ExpiresAt:       s.ExpiresAt,
+			Current:         s.ID == current.ID,
+		})
+	}
+
+	for t, c := range i.Credentials {
+		o.Methods = append(o.Methods, t)
+		if t == identity.CredentialsTypeOIDC {
+			for _, p := range gjson.GetBytes(c.Config, "#.provider").Array() {
+				o.OIDCProviders = append(o.OIDCProviders, p.String())
+			}
+		}
+	}
+	sort.Slice(o.Methods, func(i, j int) bool {
+		return o.Methods[i] < o.Methods[j]
+	})
+	sort.Strings(o.OIDCProviders)
+
+	for _, a := range i.Addresses {
+		if !a.Verified {
+			o.UnverifiedAddresses = append(o.UnverifiedAddresses, a)
+		}
+	}
+
+	return o, nil
+}
@@ -1,12 +1,14 @@
 package session
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/gofrs/uuid"
 
 	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/relationship"
 	"github.com/ory/kratos/x"
 )
 
@@ -24,9 +26,28 @@ type Session struct {
 	// required: true
 	IssuedAt time.Time `json:"issued_at" db:"issued_at" faker:"time_type"`
 
+	// SecondFactorAuthenticated is true if the identity completed a second factor when signing in. Sessions of
+	// browsers which the identity trusts do not complete it.
+	SecondFactorAuthenticated bool `json:"second_factor_authenticated" db:"second_factor_authenticated" faker:"-"`
+
+	// PrivilegedUntil is the time (UTC) until which the session may be used for sensitive operations such as
+	// changing credentials. Afterwards, the user has to authenticate again using a login request with `refresh=true`.
+	PrivilegedUntil *time.Time `json:"privileged_until,omitempty" db:"-" faker:"-"`
+
 	// required: true
 	Identity *identity.Identity `json:"identity" faker:"identity" db:"-" belongs_to:"identities" fk_id:"IdentityID"`
 
+	// Delegation is set if another identity signed in as this session's identity, see Delegation.
+	Delegation *Delegation `json:"delegation,omitempty" db:"-" faker:"-"`
+
+	// Relationships are the relationships the identity has to other identities, and the ones other identities
+	// have to it.
+	Relationships []relationship.Relationship `json:"relationships,omitempty" db:"-" faker:"-"`
+
+	// Entitlements are the entitlements of the identity, for example the feature flags of its plan. They are only
+	// set by the whoami endpoint and only if an entitlement resolver is configured, see identity.entitlements.
+	Entitlements json.RawMessage `json:"entitlements,omitempty" db:"-" faker:"-"`
+
 	// IdentityID is a helper struct field for gobuffalo.pop.
 	IdentityID uuid.UUID `json:"-" faker:"-" db:"identity_id"`
 	// CreatedAt is a helper struct field for gobuffalo.pop.
@@ -37,10 +58,33 @@ type Session struct {
 	modifiedIdentity bool `faker:"-" db:"-"`
 }
 
+// Delegation records that the identity of a session signed in as a related identity, for example a parent as a
+// child. The session belongs to the related identity and is only valid as long as the relationship exists.
+//
+// swagger:model sessionDelegation
+type Delegation struct {
+	// SessionID is a helper struct field for gobuffalo.pop.
+	SessionID uuid.UUID `json:"-" faker:"-" db:"session_id"`
+
+	// IdentityID is the ID of the identity which signed in as the session's identity.
+	//
+	// required: true
+	IdentityID uuid.UUID `json:"identity_id" db:"identity_id"`
+
+	// RelationshipID is the ID of the relationship which allowed it.
+	//
+	// required: true
+	RelationshipID uuid.UUID `json:"relationship_id" db:"relationship_id"`
+}
+
 func (s Session) TableName() string {
 	return "sessions"
 }
 
+func (d Delegation) TableName() string {
+	return "session_delegations"
+}
+
 func NewSession(i *identity.Identity, r *http.Request, c interface {
 	SessionLifespan() time.Duration
 }) *Session {
@@ -67,6 +111,18 @@ func (s *Session) GetIdentity() *identity.Identity {
 	return s.Identity
 }
 
+// IsPrivileged returns true if the session was authenticated less than maxAge ago.
+func (s *Session) IsPrivileged(maxAge time.Duration) bool {
+	return time.Since(s.AuthenticatedAt) < maxAge
+}
+
+// SetPrivilegedUntil sets PrivilegedUntil to the end of the privileged session window.
+func (s *Session) SetPrivilegedUntil(maxAge time.Duration) *Session {
+	until := s.AuthenticatedAt.Add(maxAge).UTC()
+	s.PrivilegedUntil = &until
+	return s
+}
+
 func (s *Session) WasIdentityModified() bool {
 	return s.modifiedIdentity
 }
@@ -0,0 +1,213 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+// TrustedDevice is a browser in which the identity completed a second factor and asked not to be asked for it
+// again. The browser knows the device's ID from a signed cookie.
+//
+// swagger:model trustedDevice
+type TrustedDevice struct {
+	// required: true
+	ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+	// IdentityID is the ID of the identity which trusts the device.
+	IdentityID uuid.UUID `json:"-" faker:"-" db:"identity_id"`
+
+	// CredentialsHash is the fingerprint of the identity's credentials when the device was trusted, see
+	// identity.CredentialsFingerprint. The device is no longer trusted once the credentials changed.
+	CredentialsHash string `json:"-" faker:"-" db:"credentials_hash"`
+
+	// IPAddress is the address of the client which trusted the device.
+	IPAddress string `json:"ip_address" db:"ip_address"`
+
+	// UserAgent is the user agent of the browser.
+	UserAgent string `json:"user_agent" db:"user_agent"`
+
+	// ExpiresAt is the time (UTC) after which the second factor is asked for again.
+	//
+	// required: true
+	ExpiresAt time.Time `json:"expires_at" faker:"time_type" db:"expires_at"`
+
+	// CreatedAt is the time (UTC) when the device was trusted.
+	//
+	// required: true
+	CreatedAt time.Time `json:"created_at" faker:"-" db:"created_at"`
+
+	// UpdatedAt is a helper struct field for gobuffalo.pop.
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (d TrustedDevice) TableName() string {
+	return "identity_trusted_devices"
+}
+
+// NewTrustedDevice returns the browser of the request as a device the identity, including its credentials,
+// trusts for lifespan.
+func NewTrustedDevice(r *http.Request, i *identity.Identity, lifespan time.Duration) *TrustedDevice {
+	var ip string
+	if addr := x.ClientIP(r); addr != nil {
+		ip = addr.String()
+	}
+
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+
+	return &TrustedDevice{
+		ID:              x.NewUUID(),
+		IdentityID:      i.ID,
+		CredentialsHash: identity.CredentialsFingerprint(i.Credentials),
+		IPAddress:       ip,
+		UserAgent:       ua,
+		ExpiresAt:       time.Now().UTC().Add(lifespan),
+	}
+}
+
+// IsTrustedBy returns true if the identity, including its credentials, still trusts the device.
+func (d *TrustedDevice) IsTrustedBy(i *identity.Identity) bool {
+	return d.IdentityID == i.ID &&
+		d.ExpiresAt.After(time.Now().UTC()) &&
+		d.CredentialsHash == identity.CredentialsFingerprint(i.Credentials)
+}
+
+// swagger:route GET /sessions/trusted-devices public listTrustedDevices
+//
+// List the trusted devices of the current user
+//
+// Returns the browsers in which the identity the current HTTP session belongs to does not have to complete its
+// second factor, see configuration key selfservice.login.trusted_devices.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: trustedDevices
+//       401: genericError
+//       500: genericError
+func (h *Handler) listTrustedDevices(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r,
+			errors.WithStack(herodot.ErrUnauthorized.WithReasonf("No valid session cookie found.").WithDebugf("%+v", err)),
+		)
+		return
+	}
+
+	i, err := h.r.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), s.IdentityID)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	ds, err := h.trustedDevices(r.Context(), i)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, ds)
+}
+
+// A list of trusted devices.
+// swagger:response trustedDevices
+// nolint:deadcode,unused
+type trustedDevicesResponse struct {
+	// in: body
+	Body []TrustedDevice
+}
+
+// nolint:deadcode,unused
+// swagger:parameters revokeTrustedDevices
+type revokeTrustedDevicesParameters struct {
+	// DeviceID is the ID of the device which is no longer trusted. If it is empty, all devices are revoked.
+	//
+	// in: formData
+	DeviceID string `json:"device_id"`
+}
+
+// trustedDevices returns the devices the identity, which must include its credentials, still trusts. Devices
+// trusted before the credentials changed are kept until they expire but are not returned.
+func (h *Handler) trustedDevices(ctx context.Context, i *identity.Identity) ([]TrustedDevice, error) {
+	ds, err := h.r.SessionPersister().ListTrustedDevices(ctx, i.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	trusted := make([]TrustedDevice, 0, len(ds))
+	for k := range ds {
+		if ds[k].IsTrustedBy(i) {
+			trusted = append(trusted, ds[k])
+		}
+	}
+	return trusted, nil
+}
+
+// swagger:route POST /sessions/trusted-devices/revoke public revokeTrustedDevices
+//
+// Revoke trusted devices of the current user
+//
+// The second factor is asked for again in the revoked browsers. Browsers are redirected to the profile UI.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       302: emptyResponse
+//       401: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) revokeTrustedDevices(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r,
+			errors.WithStack(herodot.ErrUnauthorized.WithReasonf("No valid session cookie found.").WithDebugf("%+v", err)),
+		)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	if id := r.PostForm.Get("device_id"); len(id) > 0 {
+		err = h.r.SessionPersister().DeleteTrustedDevice(r.Context(), s.IdentityID, x.ParseUUID(id))
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			err = errors.WithStack(herodot.ErrNotFound.WithReason("The trusted device does not exist."))
+		}
+	} else {
+		err = h.r.SessionPersister().DeleteTrustedDevices(r.Context(), s.IdentityID)
+	}
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if x.IsJSONRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	http.Redirect(w, r, h.c.ProfileURL().String(), http.StatusFound)
+}
@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+const (
+	StatsPath = "/stats"
+
+	// DatabaseMetricsPath serves the connection pool statistics of the database on the admin API.
+	DatabaseMetricsPath = "/metrics/database"
+
+	// defaultRange is the time range covered if the request does not specify one.
+	defaultRange = time.Hour * 24 * 30
+	// maxRange limits the number of days the time-based metrics are aggregated for.
+	maxRange = time.Hour * 24 * 366
+)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		x.WriterProvider
+	}
+	HandlerProvider interface {
+		StatsHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+	}
+)
+
+func NewHandler(r handlerDependencies) *Handler {
+	return &Handler{r: r}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(StatsPath, h.get)
+	admin.GET(DatabaseMetricsPath, h.pool)
+}
+
+// swagger:parameters getStatistics
+// nolint:deadcode,unused
+type getStatisticsParameters struct {
+	// From is the start of the time range in RFC 3339 format. Defaults to 30 days before to.
+	//
+	// in: query
+	From string `json:"from"`
+
+	// To is the end of the time range in RFC 3339 format. Defaults to now.
+	//
+	// in: query
+	To string `json:"to"`
+}
+
+// Aggregate metrics
+//
+// swagger:response statistics
+// nolint:deadcode,unused
+type statisticsResponse struct {
+	// in: body
+	Body Statistics
+}
+
+// swagger:route GET /stats admin getStatistics
+//
+// Get aggregate metrics
+//
+// Returns the number of identities, signups per day, login attempts per method, the verification rate,
+// the number of active sessions, and the size of the courier queue. Time-based metrics cover the given
+// time range, which may span at most 366 days.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: statistics
+//       400: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	from, to, err := parseRange(r, time.Now().UTC())
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s, err := h.r.StatsPersister().Statistics(r.Context(), from, to)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, s)
+}
+
+// pool writes the connection pool statistics of the database, see Pool.
+func (h *Handler) pool(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	p, err := h.r.StatsPersister().PoolStatistics(r.Context())
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, p)
+}
+
+func parseRange(r *http.Request, now time.Time) (from, to time.Time, err error) {
+	to, err = parseTime(r, "to", now)
+	if err != nil {
+		return
+	}
+
+	from, err = parseTime(r, "from", to.Add(-defaultRange))
+	if err != nil {
+		return
+	}
+
+	if !from.Before(to) {
+		err = errors.WithStack(herodot.ErrBadRequest.WithReason("The from query parameter must be before the to query parameter."))
+	} else if to.Sub(from) > maxRange {
+		err = errors.WithStack(herodot.ErrBadRequest.WithReasonf("The time range must not exceed %d days.", int(maxRange.Hours()/24)))
+	}
+	return from.UTC(), to.UTC(), err
+}
+
+func parseTime(r *http.Request, key string, fallback time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if len(v) == 0 {
+		return fallback, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The %s query parameter must be formatted according to RFC 3339.", key).WithDebug(err.Error()))
+	}
+	return t, nil
+}
@@ -0,0 +1,76 @@
+package stats_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/stats"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	router := x.NewRouterAdmin()
+	reg.StatsHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	get := func(t *testing.T, query url.Values, expectCode int) *Statistics {
+		res, err := ts.Client().Get(ts.URL + StatsPath + "?" + query.Encode())
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.EqualValues(t, expectCode, res.StatusCode)
+
+		var s Statistics
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&s))
+		return &s
+	}
+
+	t.Run("case=defaults to the last 30 days", func(t *testing.T) {
+		s := get(t, url.Values{}, http.StatusOK)
+		assert.WithinDuration(t, time.Now().UTC(), s.To, time.Minute)
+		assert.Equal(t, time.Hour*24*30, s.To.Sub(s.From))
+		assert.Len(t, s.Signups, 31)
+		assert.NotNil(t, s.Logins)
+	})
+
+	t.Run("case=uses the given time range", func(t *testing.T) {
+		s := get(t, url.Values{"from": {"2020-01-01T00:00:00Z"}, "to": {"2020-01-08T00:00:00Z"}}, http.StatusOK)
+		require.Len(t, s.Signups, 7)
+		assert.Equal(t, "2020-01-01", s.Signups[0].Day)
+		assert.Equal(t, "2020-01-07", s.Signups[6].Day)
+	})
+
+	t.Run("case=database connection pool", func(t *testing.T) {
+		res, err := ts.Client().Get(ts.URL + DatabaseMetricsPath)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.EqualValues(t, http.StatusOK, res.StatusCode)
+
+		var p Pool
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&p))
+		assert.True(t, p.OpenConnections > 0)
+	})
+
+	for _, tc := range []struct {
+		name  string
+		query url.Values
+	}{
+		{name: "invalid from", query: url.Values{"from": {"yesterday"}}},
+		{name: "invalid to", query: url.Values{"to": {"2020-01-01"}}},
+		{name: "from after to", query: url.Values{"from": {"2020-01-02T00:00:00Z"}, "to": {"2020-01-01T00:00:00Z"}}},
+		{name: "range too long", query: url.Values{"from": {"2018-01-01T00:00:00Z"}, "to": {"2020-01-01T00:00:00Z"}}},
+	} {
+		t.Run("case=rejects "+tc.name, func(t *testing.T) {
+			get(t, tc.query, http.StatusBadRequest)
+		})
+	}
+}
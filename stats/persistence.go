@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	PersistenceProvider interface {
+		StatsPersister() Persister
+	}
+	Persister interface {
+		// Statistics aggregates the metrics of this installation. Time-based metrics cover the range
+		// from (inclusive) to to (exclusive).
+		Statistics(ctx context.Context, from, to time.Time) (*Statistics, error)
+
+		// PoolStatistics returns the current state of the database connection pool.
+		PoolStatistics(ctx context.Context) (*Pool, error)
+	}
+)
+
+// TestPersister checks the statistics against the changes made by setup. The database may contain
+// other data, so only differences are compared.
+func TestPersister(p Persister, setup func(t *testing.T)) func(t *testing.T) {
+	return func(t *testing.T) {
+		to := time.Now().UTC().Add(time.Hour)
+		from := to.Add(-time.Hour * 72)
+
+		before, err := p.Statistics(context.Background(), from, to)
+		require.NoError(t, err)
+		assert.Len(t, before.Signups, 4)
+
+		setup(t)
+
+		after, err := p.Statistics(context.Background(), from, to)
+		require.NoError(t, err)
+
+		assert.Equal(t, before.Identities+1, after.Identities)
+		assert.Equal(t, before.ActiveSessions+1, after.ActiveSessions)
+		assert.Equal(t, before.CourierQueue+1, after.CourierQueue)
+		assert.Equal(t, total(before.Signups)+1, total(after.Signups))
+		assert.Equal(t, before.Verification.Addresses+1, after.Verification.Addresses)
+		assert.Equal(t, before.Verification.Verified, after.Verification.Verified)
+		assert.Equal(t, successful(before.Logins)+1, successful(after.Logins))
+
+		t.Run("case=connection pool", func(t *testing.T) {
+			pool, err := p.PoolStatistics(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, pool.InUse+pool.Idle, pool.OpenConnections)
+		})
+
+		t.Run("case=empty time range", func(t *testing.T) {
+			s, err := p.Statistics(context.Background(), to.Add(time.Hour*24*365), to.Add(time.Hour*24*366))
+			require.NoError(t, err)
+			assert.Equal(t, 0, total(s.Signups))
+			assert.Equal(t, 0, s.Verification.Addresses)
+			assert.Equal(t, float64(0), s.Verification.Rate)
+			assert.Empty(t, s.Logins)
+			assert.Equal(t, after.Identities, s.Identities)
+		})
+	}
+}
+
+func total(daily []DailyCount) (n int) {
+	for _, d := range daily {
+		n += d.Count
+	}
+	return n
+}
+
+func successful(logins []MethodCount) (n int) {
+	for _, l := range logins {
+		n += l.Successful
+	}
+	return n
+}
@@ -0,0 +1,145 @@
+package stats
+
+import (
+	"time"
+)
+
+// dayFormat is the format of the days in daily statistics.
+const dayFormat = "2006-01-02"
+
+type (
+	// Statistics are aggregate metrics of this ORY Kratos installation.
+	//
+	// swagger:model statistics
+	Statistics struct {
+		// From is the start of the time range (inclusive) the time-based metrics cover.
+		//
+		// required: true
+		From time.Time `json:"from"`
+
+		// To is the end of the time range (exclusive) the time-based metrics cover.
+		//
+		// required: true
+		To time.Time `json:"to"`
+
+		// Identities is the total number of identities.
+		//
+		// required: true
+		Identities int `json:"identities"`
+
+		// Signups is the number of identities created per day (UTC) in the time range.
+		//
+		// required: true
+		Signups []DailyCount `json:"signups"`
+
+		// Logins is the number of login attempts per method in the time range. Login attempts are
+		// counted from the login history and are therefore subject to its retention.
+		//
+		// required: true
+		Logins []MethodCount `json:"logins"`
+
+		// Verification covers the addresses which were added in the time range.
+		//
+		// required: true
+		Verification VerificationCount `json:"verification"`
+
+		// ActiveSessions is the number of sessions which have not expired yet.
+		//
+		// required: true
+		ActiveSessions int `json:"active_sessions"`
+
+		// CourierQueue is the number of messages waiting to be sent.
+		//
+		// required: true
+		CourierQueue int `json:"courier_queue"`
+	}
+
+	// DailyCount is a number of events which happened on a day.
+	//
+	// swagger:model statisticsDailyCount
+	DailyCount struct {
+		// Day formatted as YYYY-MM-DD.
+		//
+		// required: true
+		Day string `json:"day"`
+
+		// required: true
+		Count int `json:"count"`
+	}
+
+	// MethodCount is the number of login attempts of a method.
+	//
+	// swagger:model statisticsMethodCount
+	MethodCount struct {
+		// required: true
+		Method string `json:"method"`
+
+		// required: true
+		Successful int `json:"successful"`
+
+		// required: true
+		Failed int `json:"failed"`
+	}
+
+	// VerificationCount is the number of added and verified addresses.
+	//
+	// swagger:model statisticsVerificationCount
+	VerificationCount struct {
+		// required: true
+		Addresses int `json:"addresses"`
+
+		// required: true
+		Verified int `json:"verified"`
+
+		// Rate is the share of verified addresses, from 0 to 1.
+		//
+		// required: true
+		Rate float64 `json:"rate"`
+	}
+
+	// Pool describes the connection pool of the database, for example to find out whether it is saturated
+	// under load.
+	Pool struct {
+		// MaxOpenConnections is the maximum number of open connections, 0 means unlimited.
+		MaxOpenConnections int `json:"max_open_connections"`
+
+		// OpenConnections is the number of connections in use and idle.
+		OpenConnections int `json:"open_connections"`
+
+		// InUse is the number of connections in use.
+		InUse int `json:"in_use"`
+
+		// Idle is the number of idle connections.
+		Idle int `json:"idle"`
+
+		// WaitCount is the total number of times an operation waited for a connection.
+		WaitCount int64 `json:"wait_count"`
+
+		// WaitDuration is the total time operations waited for a connection.
+		WaitDuration time.Duration `json:"wait_duration"`
+	}
+)
+
+// NewVerificationCount computes the verification rate of the addresses.
+func NewVerificationCount(addresses, verified int) VerificationCount {
+	c := VerificationCount{Addresses: addresses, Verified: verified}
+	if addresses > 0 {
+		c.Rate = float64(verified) / float64(addresses)
+	}
+	return c
+}
+
+// DailyCounts returns a count for every day (UTC) which overlaps the range from (inclusive) to to
+// (exclusive), using zero for days which are not in counts. The keys of counts are formatted as YYYY-MM-DD.
+func DailyCounts(from, to time.Time, counts map[string]int) []DailyCount {
+	from, to = from.UTC(), to.UTC()
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+
+	var daily []DailyCount
+	for day.Before(to) {
+		d := day.Format(dayFormat)
+		daily = append(daily, DailyCount{Day: d, Count: counts[d]})
+		day = day.AddDate(0, 0, 1)
+	}
+	return daily
+}
@@ -0,0 +1,52 @@
+package stats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailyCounts(t *testing.T) {
+	day := time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC)
+
+	for k, tc := range []struct {
+		from, to time.Time
+		counts   map[string]int
+		expected []DailyCount
+	}{
+		{
+			from:     day,
+			to:       day.Add(time.Hour),
+			expected: []DailyCount{{Day: "2020-02-28"}},
+		},
+		{
+			from:     day.Add(time.Hour * 23),
+			to:       day.Add(time.Hour * 49),
+			counts:   map[string]int{"2020-02-29": 3, "2020-03-02": 7},
+			expected: []DailyCount{{Day: "2020-02-28"}, {Day: "2020-02-29", Count: 3}, {Day: "2020-03-01"}},
+		},
+		{
+			// to is exclusive, so the day starting at to is not included.
+			from:     day,
+			to:       day.AddDate(0, 0, 2),
+			counts:   map[string]int{"2020-02-28": 1},
+			expected: []DailyCount{{Day: "2020-02-28", Count: 1}, {Day: "2020-02-29"}},
+		},
+		{
+			from:     day.In(time.FixedZone("UTC+2", 7200)),
+			to:       day.Add(time.Minute),
+			expected: []DailyCount{{Day: "2020-02-28"}},
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, tc.expected, DailyCounts(tc.from, tc.to, tc.counts))
+		})
+	}
+}
+
+func TestNewVerificationCount(t *testing.T) {
+	assert.Equal(t, VerificationCount{}, NewVerificationCount(0, 0))
+	assert.Equal(t, VerificationCount{Addresses: 4, Verified: 1, Rate: 0.25}, NewVerificationCount(4, 1))
+}
@@ -0,0 +1,312 @@
+package token
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	TokensPath = "/tokens"
+	RedeemPath = "/self-service/tokens/redeem"
+
+	defaultLifespan = time.Hour
+	maxLifespan     = time.Hour * 24 * 30
+)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		ManagerProvider
+		identity.PoolProvider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		TokenHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
+	public.POST(RedeemPath, h.redeem)
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.POST(TokensPath, h.create)
+	admin.GET(TokensPath+"/:id", h.get)
+	admin.DELETE(TokensPath+"/:id", h.delete)
+}
+
+// MintedToken is a token and its value.
+//
+// swagger:model mintedActionToken
+type MintedToken struct {
+	*Token
+
+	// Token is the value of the token, which is sent to the identity and redeemed. It is only returned when the
+	// token is minted.
+	//
+	// required: true
+	Value string `json:"token"`
+}
+
+// A minted token.
+//
+// swagger:response mintedActionToken
+// nolint:deadcode,unused
+type mintedTokenResponse struct {
+	// in: body
+	Body MintedToken
+}
+
+// A single token.
+//
+// swagger:response actionToken
+// nolint:deadcode,unused
+type tokenResponse struct {
+	// in: body
+	Body *Token
+}
+
+// swagger:model mintActionToken
+type MintToken struct {
+	// Purpose is what the token may be redeemed for, for example `unsubscribe` or `approve-invite`. The purposes
+	// of self-service flows, such as `verification`, are reserved.
+	//
+	// required: true
+	Purpose string `json:"purpose"`
+
+	// IdentityID is the ID of the identity the token is minted for.
+	//
+	// required: true
+	IdentityID uuid.UUID `json:"identity_id"`
+
+	// Lifespan is how long the token can be redeemed, for example `15m`. It defaults to one hour and must not
+	// exceed 30 days.
+	Lifespan string `json:"lifespan"`
+
+	// Payload is returned when the token is redeemed, for example the ID of the invite.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters mintActionToken
+type mintParameters struct {
+	// in: body
+	Body MintToken
+}
+
+// swagger:model redeemActionToken
+type RedeemToken struct {
+	// Token is the value of the token.
+	//
+	// required: true
+	Token string `json:"token"`
+
+	// Purpose must be the purpose the token was minted for.
+	//
+	// required: true
+	Purpose string `json:"purpose"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters redeemActionToken
+type redeemParameters struct {
+	// in: body
+	Body RedeemToken
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getActionToken revokeActionToken
+type idParameters struct {
+	// ID is the ID of the token.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route POST /tokens admin mintActionToken
+//
+// Mint a token
+//
+// Mints a token which can be redeemed once, for the purpose it was minted for, until it expires. Send the token to
+// the identity, for example as part of an unsubscribe link, and redeem it using
+// `/self-service/tokens/redeem` when the link is opened.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: mintedActionToken
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var body MintToken
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&body); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	lifespan := defaultLifespan
+	if len(body.Lifespan) > 0 {
+		var err error
+		if lifespan, err = time.ParseDuration(body.Lifespan); err != nil || lifespan <= 0 || lifespan > maxLifespan {
+			h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The lifespan "%s" is invalid, it must be positive and must not exceed 30 days.`, body.Lifespan)))
+			return
+		}
+	}
+
+	if IsReserved(body.Purpose) {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The purpose "%s" is reserved for tokens of self-service flows.`, body.Purpose)))
+		return
+	}
+
+	// The token is validated before the identity is looked up, so that invalid purposes are reported first.
+	if _, err := NewToken(body.Purpose, body.IdentityID, lifespan, body.Payload); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if _, err := h.r.IdentityPool().GetIdentity(r.Context(), body.IdentityID); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	t, value, err := h.r.TokenManager().Mint(r.Context(), body.Purpose, body.IdentityID, lifespan, body.Payload)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().WriteCreated(w, r, urlx.AppendPaths(h.c.SelfAdminURL(), TokensPath, t.ID.String()).String(), &MintedToken{Token: t, Value: value})
+}
+
+// swagger:route GET /tokens/{id} admin getActionToken
+//
+// Get a token
+//
+// Returns the token without its value, for example to check whether it was redeemed.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: actionToken
+//       404: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t, err := h.r.TokenPersister().GetToken(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, t)
+}
+
+// swagger:route DELETE /tokens/{id} admin revokeActionToken
+//
+// Revoke a token
+//
+// Deletes the token, so that it can no longer be redeemed.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := x.ParseUUID(ps.ByName("id"))
+	if err := h.r.TokenPersister().DeleteToken(r.Context(), id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "action_token").
+		WithField("token_id", id).
+		Info("A token was revoked.")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route POST /self-service/tokens/redeem public redeemActionToken
+//
+// Redeem a token
+//
+// Redeems a token minted using `/tokens` and returns it, including the identity and the payload it was minted
+// with. Each token can only be redeemed once, for the purpose it was minted for, and until it expires. The token
+// is the proof, which is why this endpoint does not need a CSRF token.
+//
+// Redeeming a token again fails with the error ID `code_already_redeemed`. Unless the same client redeemed it
+// before, the identity is notified, as the token might have leaked.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: actionToken
+//       400: genericError
+//       500: genericError
+func (h *Handler) redeem(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var body RedeemToken
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&body); err != nil {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	invalid := errors.WithStack(herodot.ErrBadRequest.WithReason("The token is invalid, has expired, or was already redeemed."))
+	if IsReserved(body.Purpose) {
+		h.r.Writer().WriteError(w, r, invalid)
+		return
+	}
+
+	t, err := h.r.TokenManager().Redeem(r, body.Token, body.Purpose)
+	if errors.Cause(err) == sqlcon.ErrNoRows {
+		h.r.Writer().WriteError(w, r, invalid)
+		return
+	} else if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, t)
+}
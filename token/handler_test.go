@@ -0,0 +1,112 @@
+package token_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/token"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	public, admin := x.NewRouterPublic(), x.NewRouterAdmin()
+	reg.TokenHandler().RegisterPublicRoutes(public)
+	reg.TokenHandler().RegisterAdminRoutes(admin)
+	publicTS, adminTS := httptest.NewServer(public), httptest.NewServer(admin)
+	defer publicTS.Close()
+	defer adminTS.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfAdmin, adminTS.URL)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	send := func(t *testing.T, method, href string, expectCode int, body interface{}) gjson.Result {
+		var b bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&b).Encode(body))
+		}
+		req, err := http.NewRequest(method, href, &b)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		result, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		require.EqualValues(t, expectCode, res.StatusCode, "%s", result)
+		return gjson.ParseBytes(result)
+	}
+
+	newIdentity := func(t *testing.T) uuid.UUID {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i.ID
+	}
+
+	id := newIdentity(t)
+
+	t.Run("case=should reject invalid tokens", func(t *testing.T) {
+		for k, body := range []MintToken{
+			{Purpose: "Unsubscribe", IdentityID: id},
+			{Purpose: "unsubscribe"},
+			{Purpose: "unsubscribe", IdentityID: id, Lifespan: "1y"},
+			{Purpose: "unsubscribe", IdentityID: id, Lifespan: "-1h"},
+			{Purpose: "unsubscribe", IdentityID: id, Lifespan: "1000h"},
+		} {
+			t.Logf("case=%d", k)
+			send(t, "POST", adminTS.URL+TokensPath, http.StatusBadRequest, body)
+		}
+		send(t, "POST", adminTS.URL+TokensPath, http.StatusNotFound, MintToken{Purpose: "unsubscribe", IdentityID: x.NewUUID()})
+	})
+
+	t.Run("case=should mint, redeem, and revoke tokens", func(t *testing.T) {
+		minted := send(t, "POST", adminTS.URL+TokensPath, http.StatusCreated, MintToken{
+			Purpose: "approve-invite", IdentityID: id, Lifespan: "15m", Payload: json.RawMessage(`{"invite":"abc"}`)})
+		value := minted.Get("token").String()
+		require.NotEmpty(t, value)
+		assert.Equal(t, id.String(), minted.Get("identity_id").String())
+
+		send(t, "POST", publicTS.URL+RedeemPath, http.StatusBadRequest, RedeemToken{Token: value, Purpose: "unsubscribe"})
+		send(t, "POST", publicTS.URL+RedeemPath, http.StatusBadRequest, RedeemToken{Token: value + "x", Purpose: "approve-invite"})
+
+		redeemed := send(t, "POST", publicTS.URL+RedeemPath, http.StatusOK, RedeemToken{Token: value, Purpose: "approve-invite"})
+		assert.Equal(t, id.String(), redeemed.Get("identity_id").String())
+		assert.Equal(t, "abc", redeemed.Get("payload.invite").String())
+		assert.False(t, redeemed.Get("token").Exists(), "the value is only returned when the token is minted")
+
+		replayed := send(t, "POST", publicTS.URL+RedeemPath, http.StatusBadRequest, RedeemToken{Token: value, Purpose: "approve-invite"})
+		assert.Equal(t, identity.AlreadyRedeemedErrorID, replayed.Get("error.details.error_id").String(), "%s", replayed.Raw)
+		assert.True(t, send(t, "GET", adminTS.URL+TokensPath+"/"+minted.Get("id").String(), http.StatusOK, nil).Get("used_at").Exists())
+
+		revoked := send(t, "POST", adminTS.URL+TokensPath, http.StatusCreated, MintToken{Purpose: "unsubscribe", IdentityID: id})
+		send(t, "DELETE", adminTS.URL+TokensPath+"/"+revoked.Get("id").String(), http.StatusNoContent, nil)
+		send(t, "POST", publicTS.URL+RedeemPath, http.StatusBadRequest, RedeemToken{Token: revoked.Get("token").String(), Purpose: "unsubscribe"})
+		send(t, "DELETE", adminTS.URL+TokensPath+"/"+revoked.Get("id").String(), http.StatusNotFound, nil)
+	})
+
+	t.Run("case=should not mint or redeem tokens of self-service flows", func(t *testing.T) {
+		send(t, "POST", adminTS.URL+TokensPath, http.StatusBadRequest, MintToken{Purpose: PurposeVerification, IdentityID: id})
+
+		_, value, err := reg.TokenManager().Mint(context.Background(), PurposeVerification, id, time.Hour, nil)
+		require.NoError(t, err)
+		send(t, "POST", publicTS.URL+RedeemPath, http.StatusBadRequest, RedeemToken{Token: value, Purpose: PurposeVerification})
+	})
+}
@@ -0,0 +1,93 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/selfservice/notification"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	managerDependencies interface {
+		PersistenceProvider
+		notification.SenderProvider
+		x.LoggingProvider
+	}
+	ManagerProvider interface {
+		TokenManager() *Manager
+	}
+
+	// Manager mints and redeems tokens. It is used by the admin API as well as by self-service flows which send
+	// links to identities, such as verification.
+	Manager struct {
+		r managerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewManager(r managerDependencies, c configuration.Provider) *Manager {
+	return &Manager{r: r, c: c}
+}
+
+// Mint stores a new token and returns it together with its value, which is sent to the identity.
+func (m *Manager) Mint(ctx context.Context, purpose string, identityID uuid.UUID, lifespan time.Duration, payload json.RawMessage) (*Token, string, error) {
+	t, err := NewToken(purpose, identityID, lifespan, payload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := m.r.TokenPersister().CreateToken(ctx, t); err != nil {
+		return nil, "", err
+	}
+
+	x.ContextLogger(ctx, m.r.Logger()).
+		WithField("audit", "action_token").
+		WithField("token_id", t.ID).
+		WithField("purpose", t.Purpose).
+		WithField("identity_id", t.IdentityID).
+		Info("A token was minted.")
+	return t, t.Sign(m.c.SessionSecrets()[0]), nil
+}
+
+// Redeem uses the token of the value for the purpose and returns it. It returns sqlcon.ErrNoRows if the value is
+// invalid, the token was minted for another purpose, or it expired. If the token was redeemed before,
+// identity.ErrAlreadyRedeemed is returned and the identity is notified, as the token might have leaked.
+func (m *Manager) Redeem(r *http.Request, value, purpose string) (*Token, error) {
+	id, err := Parse(value, purpose, m.c.SessionSecrets())
+	if err != nil {
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	t, err := m.r.TokenPersister().UseToken(r.Context(), id, purpose, identity.NewRedeemer(r))
+	if errors.Cause(err) == &identity.ErrAlreadyRedeemed {
+		x.ContextLogger(r.Context(), m.r.Logger()).
+			WithField("audit", "action_token").
+			WithField("token_id", id).
+			WithField("client_ip", x.ClientIP(r).String()).
+			Warn("A token which was already redeemed was redeemed again.")
+		if err := m.r.NotificationSender().NotifyCodeReplayed(r, identity.RedemptionKindActionToken, id.String()); err != nil {
+			x.ContextLogger(r.Context(), m.r.Logger()).WithError(err).WithField("token_id", id).Warn("Unable to send the notification about the replayed token.")
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	x.ContextLogger(r.Context(), m.r.Logger()).
+		WithField("audit", "action_token").
+		WithField("token_id", t.ID).
+		WithField("purpose", t.Purpose).
+		WithField("identity_id", t.IdentityID).
+		Info("A token was redeemed.")
+	return t, nil
+}
@@ -0,0 +1,95 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		TokenPersister() Persister
+	}
+	Persister interface {
+		CreateToken(ctx context.Context, t *Token) error
+
+		GetToken(ctx context.Context, id uuid.UUID) (*Token, error)
+
+		// UseToken marks the token as used, records who used it, and returns it. Concurrent calls use the token
+		// once. It returns identity.ErrAlreadyRedeemed if the token was used before and sqlcon.ErrNoRows if it was
+		// minted for another purpose or expired.
+		UseToken(ctx context.Context, id uuid.UUID, purpose string, by identity.Redeemer) (*Token, error)
+
+		// DeleteToken revokes the token.
+		DeleteToken(ctx context.Context, id uuid.UUID) error
+	}
+)
+
+func TestPersister(p interface {
+	Persister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	return func(t *testing.T) {
+		viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+		var i identity.Identity
+		require.NoError(t, faker.FakeData(&i))
+		require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+		_, err := p.GetToken(context.Background(), x.NewUUID())
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+
+		tok, err := NewToken("unsubscribe", i.ID, time.Hour, []byte(`{"list":"news"}`))
+		require.NoError(t, err)
+		require.NoError(t, p.CreateToken(context.Background(), tok))
+
+		actual, err := p.GetToken(context.Background(), tok.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "unsubscribe", actual.Purpose)
+		assert.Equal(t, i.ID, actual.IdentityID)
+		assert.JSONEq(t, `{"list":"news"}`, string(actual.Payload))
+		assert.Nil(t, actual.UsedAt)
+
+		by := identity.Redeemer{IPAddress: "192.0.2.1", UserAgent: "token-test-agent"}
+		_, err = p.UseToken(context.Background(), tok.ID, "approve-invite", by)
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err), "tokens can not be used for another purpose")
+
+		used, err := p.UseToken(context.Background(), tok.ID, "unsubscribe", by)
+		require.NoError(t, err)
+		require.NotNil(t, used.UsedAt)
+
+		redemption, err := p.FindRedemption(context.Background(), identity.RedemptionKindActionToken, tok.ID.String())
+		require.NoError(t, err)
+		assert.Equal(t, i.ID, redemption.IdentityID)
+		assert.True(t, redemption.RedeemedBy(by))
+
+		_, err = p.UseToken(context.Background(), tok.ID, "unsubscribe", by)
+		assert.Equal(t, &identity.ErrAlreadyRedeemed, errors.Cause(err), "tokens can only be used once")
+
+		expired, err := NewToken("unsubscribe", i.ID, -time.Minute, nil)
+		require.NoError(t, err)
+		require.NoError(t, p.CreateToken(context.Background(), expired))
+		_, err = p.UseToken(context.Background(), expired.ID, "unsubscribe", by)
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err), "expired tokens can not be used")
+
+		require.NoError(t, p.DeleteToken(context.Background(), expired.ID))
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteToken(context.Background(), expired.ID)))
+
+		require.NoError(t, p.DeleteIdentity(context.Background(), i.ID))
+		_, err = p.GetToken(context.Background(), tok.ID)
+		assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err), "tokens are deleted with the identity")
+	}
+}
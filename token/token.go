@@ -0,0 +1,153 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/kratos/x"
+)
+
+var purposePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// PurposeVerification is the purpose of the tokens in verification links.
+const PurposeVerification = "verification"
+
+// PurposeRecovery is the purpose of the tokens in recovery links.
+const PurposeRecovery = "recovery"
+
+// PurposeRecoveryRevert is the purpose of the tokens in links which undo a recovery.
+const PurposeRecoveryRevert = "recovery_revert"
+
+// reservedPurposes are the purposes of tokens which self-service flows mint and redeem themselves. Tokens of these
+// purposes can neither be minted using the admin API nor redeemed using the public redeem endpoint.
+var reservedPurposes = map[string]bool{
+	PurposeVerification:   true,
+	PurposeRecovery:       true,
+	PurposeRecoveryRevert: true,
+}
+
+// ErrInvalid is returned if a token is malformed, was not signed by ORY Kratos, or was minted for another purpose.
+var ErrInvalid = errors.New("the token is invalid")
+
+// Token can be redeemed once, for the purpose it was minted for, until it expires. It is bound to an identity, for
+// example to unsubscribe the identity from a newsletter or to let it accept an invite. Integrators send the token
+// to the identity, usually as part of a link, and redeem it when the link is opened.
+//
+// swagger:model actionToken
+type Token struct {
+	// required: true
+	ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+	// Purpose is what the token may be redeemed for, for example `unsubscribe`. It consists of up to 64 lower case
+	// letters, digits, dashes, and underscores.
+	//
+	// required: true
+	Purpose string `json:"purpose" db:"purpose"`
+
+	// IdentityID is the ID of the identity the token was minted for.
+	//
+	// required: true
+	IdentityID uuid.UUID `json:"identity_id" faker:"uuid" db:"identity_id"`
+
+	// Payload is the data the token was minted with, for example the ID of the invite.
+	//
+	// required: true
+	Payload json.RawMessage `json:"payload" faker:"-" db:"payload"`
+
+	// ExpiresAt is the time (UTC) after which the token can no longer be redeemed.
+	//
+	// required: true
+	ExpiresAt time.Time `json:"expires_at" faker:"time_type" db:"expires_at"`
+
+	// UsedAt is the time (UTC) the token was redeemed.
+	UsedAt *time.Time `json:"used_at,omitempty" faker:"-" db:"used_at"`
+
+	// CreatedAt is the time (UTC) the token was minted.
+	//
+	// required: true
+	CreatedAt time.Time `json:"created_at" faker:"-" db:"created_at"`
+
+	// UpdatedAt is a helper struct field for gobuffalo.pop.
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+}
+
+func (t Token) TableName() string {
+	return "identity_action_tokens"
+}
+
+// NewToken returns a token of the purpose for the identity. The payload defaults to an empty object.
+func NewToken(purpose string, identityID uuid.UUID, lifespan time.Duration, payload json.RawMessage) (*Token, error) {
+	if !purposePattern.MatchString(purpose) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The purpose "%s" is invalid, it must consist of up to 64 lower case letters, digits, dashes, and underscores.`, purpose))
+	}
+
+	if x.IsZeroUUID(identityID) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The identity_id must be set."))
+	}
+
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+
+	now := time.Now().UTC().Round(time.Second)
+	return &Token{
+		ID:         x.NewUUID(),
+		Purpose:    purpose,
+		IdentityID: identityID,
+		Payload:    payload,
+		ExpiresAt:  now.Add(lifespan),
+		CreatedAt:  now,
+	}, nil
+}
+
+// Sign returns the value of the token, which is sent to the identity. It consists of the ID of the token and an
+// HMAC of the ID and the purpose, so that tokens can not be guessed or redeemed for another purpose.
+func (t *Token) Sign(key []byte) string {
+	return t.ID.String() + "." + signature(key, t.ID, t.Purpose)
+}
+
+// IsReserved returns true if tokens of the purpose are minted and redeemed by a self-service flow.
+func IsReserved(purpose string) bool {
+	return reservedPurposes[purpose]
+}
+
+// IsSigned returns true if the value has the format of a signed token. It does not verify the signature.
+func IsSigned(value string) bool {
+	return strings.Contains(value, ".")
+}
+
+// Parse returns the ID of the token if its value was signed with one of the keys for the purpose.
+func Parse(value, purpose string, keys [][]byte) (uuid.UUID, error) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return uuid.Nil, errors.WithStack(ErrInvalid)
+	}
+
+	id, err := uuid.FromString(parts[0])
+	if err != nil {
+		return uuid.Nil, errors.WithStack(ErrInvalid)
+	}
+
+	for _, key := range keys {
+		if hmac.Equal([]byte(signature(key, id, purpose)), []byte(parts[1])) {
+			return id, nil
+		}
+	}
+	return uuid.Nil, errors.WithStack(ErrInvalid)
+}
+
+func signature(key []byte, id uuid.UUID, purpose string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(id.String() + "\n" + purpose))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
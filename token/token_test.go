@@ -0,0 +1,45 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/kratos/x"
+)
+
+func TestToken(t *testing.T) {
+	_, err := NewToken("Unsubscribe", x.NewUUID(), time.Hour, nil)
+	require.Error(t, err)
+	_, err = NewToken("unsubscribe", x.NewUUID(), time.Hour, nil)
+	require.NoError(t, err)
+
+	tok, err := NewToken("unsubscribe", x.NewUUID(), time.Hour, nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, "{}", string(tok.Payload))
+
+	oldKey, newKey := []byte("old-secret-old-secret"), []byte("new-secret-new-secret")
+	value := tok.Sign(oldKey)
+
+	id, err := Parse(value, "unsubscribe", [][]byte{newKey, oldKey})
+	require.NoError(t, err, "tokens signed with rotated keys are accepted")
+	assert.Equal(t, tok.ID, id)
+
+	for k, tc := range []struct {
+		value, purpose string
+		keys           [][]byte
+	}{
+		{value: value, purpose: "approve-invite", keys: [][]byte{oldKey}},
+		{value: value, purpose: "unsubscribe", keys: [][]byte{newKey}},
+		{value: x.NewUUID().String() + value[strings.Index(value, "."):], purpose: "unsubscribe", keys: [][]byte{oldKey}},
+		{value: tok.ID.String(), purpose: "unsubscribe", keys: [][]byte{oldKey}},
+		{value: "not-a-uuid.signature", purpose: "unsubscribe", keys: [][]byte{oldKey}},
+	} {
+		_, err := Parse(tc.value, tc.purpose, tc.keys)
+		assert.Equal(t, ErrInvalid, errors.Cause(err), "%d", k)
+	}
+}
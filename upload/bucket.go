@@ -0,0 +1,199 @@
+// Package upload lets identities upload small files such as profile pictures directly to an object storage bucket.
+// Traits which reference uploaded files are marked in the identity traits schema:
+//
+//	"avatar": {
+//	  "type": "string",
+//	  "ory.sh/kratos": {
+//	    "upload": {
+//	      "max_size": 1048576,
+//	      "content_types": ["image/png", "image/jpeg"]
+//	    }
+//	  }
+//	}
+//
+// The UI asks for a pre-signed upload URL at UploadsPath, uploads the file to it, and then sets the trait to the
+// key of the uploaded object in the profile management flow. Kratos never receives the file itself.
+package upload
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/kratos/driver/configuration"
+)
+
+// Bucket issues pre-signed URLs for the bucket configured at identity.uploads. URLs are signed with AWS Signature
+// Version 4, which S3, MinIO, and the S3 compatible API of Google Cloud Storage accept.
+type (
+	BucketProvider interface {
+		UploadBucket() *Bucket
+	}
+	Bucket struct {
+		c   configuration.Provider
+		now func() time.Time
+	}
+)
+
+func NewBucket(c configuration.Provider) *Bucket {
+	return &Bucket{c: c, now: time.Now}
+}
+
+// Enabled returns true if a bucket is configured.
+func (b *Bucket) Enabled() bool {
+	return len(b.c.IdentityUploads().Bucket) > 0
+}
+
+// PresignPut returns a URL which uploads the object with a PUT request and the headers the request has to send.
+// The signature covers the content type and length, so that the uploaded file can not be of another type or size.
+func (b *Bucket) PresignPut(key, contentType string, size int64) (*url.URL, http.Header, error) {
+	c := b.c.IdentityUploads()
+	u, err := objectURL(c, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
+	return presign(c, "PUT", u, headers, b.now()), headers, nil
+}
+
+// PublicURL returns the URL the object can be downloaded from, or an empty string if identity.uploads.public_url
+// is not set.
+func (b *Bucket) PublicURL(key string) string {
+	public := b.c.IdentityUploads().PublicURL
+	if len(public) == 0 {
+		return ""
+	}
+	return strings.TrimRight(public, "/") + "/" + awsURIEncode(key)
+}
+
+func region(c *configuration.IdentityUploadsConfig) string {
+	if len(c.Region) > 0 {
+		return c.Region
+	} else if c.Provider == "gcs" {
+		return "auto"
+	}
+	return "us-east-1"
+}
+
+func objectURL(c *configuration.IdentityUploadsConfig, key string) (*url.URL, error) {
+	var target string
+	switch {
+	case len(c.Endpoint) > 0:
+		target = fmt.Sprintf("%s/%s/%s", strings.TrimRight(c.Endpoint, "/"), c.Bucket, awsURIEncode(key))
+	case c.Provider == "gcs":
+		target = fmt.Sprintf("https://storage.googleapis.com/%s/%s", c.Bucket, awsURIEncode(key))
+	default:
+		target = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.Bucket, region(c), awsURIEncode(key))
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return u, nil
+}
+
+// presign returns u with the query parameters of a pre-signed request. The signature covers the host and the
+// given headers, and the request may be sent until identity.uploads.url_lifespan has passed.
+func presign(c *configuration.IdentityUploadsConfig, method string, u *url.URL, headers http.Header, now time.Time) *url.URL {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := strings.Join([]string{now.Format("20060102"), region(c), "s3", "aws4_request"}, "/")
+
+	canonical := map[string]string{"host": u.Host}
+	for k, v := range headers {
+		canonical[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(canonical))
+	for k := range canonical {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + canonical[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", c.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(c.URLLifespan.Seconds())))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), now.Format("20060102"))
+	for _, part := range []string{region(c), "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signed := *u
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return &signed
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string{}, q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, strings.ReplaceAll(awsURIEncode(k), "/", "%2F")+"="+strings.ReplaceAll(awsURIEncode(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything except unreserved characters and slashes.
+func awsURIEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
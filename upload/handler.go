@@ -0,0 +1,226 @@
+package upload
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/stringslice"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/identity"
+	"github.com/ory/kratos/maintenance"
+	"github.com/ory/kratos/schema"
+	"github.com/ory/kratos/session"
+	"github.com/ory/kratos/x"
+)
+
+const UploadsPath = "/self-service/browser/flows/profile/uploads"
+
+type (
+	handlerDependencies interface {
+		BucketProvider
+		maintenance.GuardProvider
+		session.ManagementProvider
+		x.WriterProvider
+		IdentityTraitsSchemas() schema.Schemas
+	}
+	HandlerProvider interface {
+		UploadHandler() *Handler
+	}
+	Handler struct {
+		d handlerDependencies
+		c configuration.Provider
+	}
+)
+
+// Upload is a pre-signed URL which uploads a file for a trait.
+//
+// swagger:model traitUpload
+type Upload struct {
+	// Key is the key of the uploaded object. Once the file was uploaded, it is the value of the trait.
+	//
+	// required: true
+	Key string `json:"key"`
+
+	// URL is the pre-signed URL the file is uploaded to.
+	//
+	// required: true
+	URL string `json:"url"`
+
+	// Method is the HTTP method of the upload, it is always "PUT".
+	//
+	// required: true
+	Method string `json:"method"`
+
+	// Headers must be sent with the upload. Browsers set Content-Length themselves.
+	//
+	// required: true
+	Headers map[string]string `json:"headers"`
+
+	// ExpiresAt is the time (UTC) after which the URL can no longer be used.
+	//
+	// required: true
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// PublicURL is the URL the file can be downloaded from once it was uploaded. It is only set if
+	// identity.uploads.public_url is configured.
+	PublicURL string `json:"public_url,omitempty"`
+}
+
+// CreateUpload is the file the identity wants to upload.
+type CreateUpload struct {
+	// Trait is the path of the trait, for example "avatar" or "traits.avatar".
+	//
+	// required: true
+	Trait string `json:"trait"`
+
+	// ContentType is the content type of the file, for example "image/png".
+	//
+	// required: true
+	ContentType string `json:"content_type"`
+
+	// Size is the size of the file in bytes.
+	//
+	// required: true
+	Size int64 `json:"size"`
+}
+
+// A pre-signed upload URL.
+//
+// swagger:response traitUpload
+// nolint:deadcode,unused
+type uploadResponse struct {
+	// in: body
+	Body *Upload
+}
+
+// nolint:deadcode,unused
+// swagger:parameters createSelfServiceBrowserTraitUpload
+type createParameters struct {
+	// in: body
+	Body CreateUpload
+}
+
+func NewHandler(d handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{d: d, c: c}
+}
+
+func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
+	public.POST(UploadsPath, h.create)
+}
+
+// swagger:route POST /self-service/browser/flows/profile/uploads public createSelfServiceBrowserTraitUpload
+//
+// Upload a file for a trait
+//
+// Returns a pre-signed URL which uploads a file, such as a profile picture, to the bucket configured at
+// `identity.uploads`. The trait must be marked with the `upload` keyword in the identity traits schema, and the
+// content type and size of the file must match its constraints. Once the file was uploaded, the returned key is
+// set as the value of the trait using the profile management flow.
+//
+// The request requires a session and the anti-CSRF token, for example in the `X-CSRF-Token` header.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: traitUpload
+//       400: genericError
+//       401: genericError
+//       403: genericError
+//       404: genericError
+//       500: genericError
+//       503: genericError
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !h.d.UploadBucket().Enabled() {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrNotFound.WithReason("File uploads are not configured.")))
+		return
+	}
+
+	s, err := h.d.SessionManager().FetchFromRequest(r.Context(), w, r)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.d.MaintenanceGuard().CheckWrite(r.Context(), s.IdentityID); err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	var body CreateUpload
+	if err := errors.WithStack(jsonx.NewStrictDecoder(r.Body).Decode(&body)); err != nil {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err)))
+		return
+	}
+
+	ts, err := h.d.IdentityTraitsSchemas().GetByID(s.Identity.TraitsSchemaID)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	traits, err := uploadTraits(ts.URL.String())
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	trait := strings.TrimPrefix(body.Trait, "traits.")
+	c, ok := traits[trait]
+	if !ok {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The trait %q does not accept uploaded files.", body.Trait)))
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(body.ContentType)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The content type %q is invalid.", body.ContentType)))
+		return
+	} else if len(c.ContentTypes) > 0 && !stringslice.Has(c.ContentTypes, contentType) {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The trait %q only accepts files of type %s.", trait, strings.Join(c.ContentTypes, ", "))))
+		return
+	}
+
+	maxSize := h.c.IdentityUploads().MaxSize
+	if c.MaxSize > 0 && c.MaxSize < maxSize {
+		maxSize = c.MaxSize
+	}
+	if body.Size <= 0 || body.Size > maxSize {
+		h.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The file must not be empty or larger than %d bytes.", maxSize)))
+		return
+	}
+
+	key := identity.UploadKeyPrefix(s.IdentityID) + x.NewUUID().String()
+	u, headers, err := h.d.UploadBucket().PresignPut(key, contentType, body.Size)
+	if err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	upload := &Upload{
+		Key:       key,
+		URL:       u.String(),
+		Method:    "PUT",
+		Headers:   make(map[string]string, len(headers)),
+		ExpiresAt: time.Now().UTC().Add(h.c.IdentityUploads().URLLifespan),
+		PublicURL: h.d.UploadBucket().PublicURL(key),
+	}
+	for k := range headers {
+		upload.Headers[k] = headers.Get(k)
+	}
+
+	h.d.Writer().WriteCode(w, r, http.StatusCreated, upload)
+}
@@ -0,0 +1,99 @@
+package upload_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+	"github.com/ory/kratos/session"
+	. "github.com/ory/kratos/upload"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	router := x.NewRouterPublic()
+	reg.UploadHandler().RegisterPublicRoutes(router)
+	router.GET("/setSession", session.MockSetSession(t, reg))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	viper.Set(configuration.ViperKeyURLsSelfPublic, ts.URL)
+	viper.Set(configuration.ViperKeyDefaultIdentityTraitsSchemaURL, "file://./stub/identity.schema.json")
+
+	client := session.MockCookieClient(t)
+	session.MockHydrateCookieClient(t, client, ts.URL+"/setSession")
+
+	send := func(t *testing.T, c *http.Client, expectCode int, body interface{}) gjson.Result {
+		var b bytes.Buffer
+		require.NoError(t, json.NewEncoder(&b).Encode(body))
+		res, err := c.Post(ts.URL+UploadsPath, "application/json", &b)
+		require.NoError(t, err)
+		result, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		require.EqualValues(t, expectCode, res.StatusCode, "%s", result)
+		return gjson.ParseBytes(result)
+	}
+
+	avatar := CreateUpload{Trait: "traits.avatar", ContentType: "image/png", Size: 1024}
+
+	t.Run("case=returns 404 if uploads are not configured", func(t *testing.T) {
+		send(t, client, http.StatusNotFound, avatar)
+	})
+
+	viper.Set(configuration.ViperKeyIdentityUploadsBucket, "uploads")
+	viper.Set(configuration.ViperKeyIdentityUploadsRegion, "eu-central-1")
+	viper.Set(configuration.ViperKeyIdentityUploadsAccessKeyID, "access-key")
+	viper.Set(configuration.ViperKeyIdentityUploadsSecretAccessKey, "secret-key")
+	viper.Set(configuration.ViperKeyIdentityUploadsPublicURL, "https://cdn.example.org/")
+	defer viper.Set(configuration.ViperKeyIdentityUploadsBucket, "")
+
+	t.Run("case=requires a session", func(t *testing.T) {
+		send(t, http.DefaultClient, http.StatusUnauthorized, avatar)
+	})
+
+	t.Run("case=rejects files the trait does not accept", func(t *testing.T) {
+		for _, body := range []CreateUpload{
+			{Trait: "traits.name", ContentType: "image/png", Size: 1024},
+			{Trait: "traits.avatar", ContentType: "application/pdf", Size: 1024},
+			{Trait: "traits.avatar", ContentType: "image/png", Size: 2 << 20},
+			{Trait: "traits.avatar", ContentType: "image/png", Size: 0},
+		} {
+			send(t, client, http.StatusBadRequest, body)
+		}
+	})
+
+	t.Run("case=returns a pre-signed upload URL", func(t *testing.T) {
+		actual := send(t, client, http.StatusCreated, CreateUpload{Trait: "avatar", ContentType: "image/PNG; charset=binary", Size: 1024})
+
+		key := actual.Get("key").String()
+		assert.True(t, strings.HasPrefix(key, "identities/"), "%s", actual.Raw)
+		assert.Equal(t, "PUT", actual.Get("method").String())
+		assert.Equal(t, "image/png", actual.Get("headers.Content-Type").String(), "%s", actual.Raw)
+		assert.Equal(t, "1024", actual.Get("headers.Content-Length").String(), "%s", actual.Raw)
+		assert.Equal(t, "https://cdn.example.org/"+key, actual.Get("public_url").String())
+
+		u, err := url.Parse(actual.Get("url").String())
+		require.NoError(t, err)
+		assert.Equal(t, "uploads.s3.eu-central-1.amazonaws.com", u.Host)
+		assert.Equal(t, "/"+key, u.Path)
+		assert.Equal(t, "content-length;content-type;host", u.Query().Get("X-Amz-SignedHeaders"))
+		assert.Equal(t, "900", u.Query().Get("X-Amz-Expires"))
+		assert.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+	})
+}
@@ -0,0 +1,77 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/jsonschemax"
+
+	"github.com/ory/kratos/schema"
+)
+
+const (
+	extensionName  = "uploadExtension"
+	extensionKey   = "ory.sh/kratos"
+	uploadProperty = "upload"
+)
+
+type uploadExtConfig struct {
+	upload *schema.UploadConfig
+}
+
+// EnhancePath adds the upload configuration of the trait to the path.
+func (ec *uploadExtConfig) EnhancePath(_ jsonschemax.Path) map[string]interface{} {
+	if ec.upload == nil {
+		return nil
+	}
+	return map[string]interface{}{uploadProperty: ec.upload}
+}
+
+func compile(_ jsonschema.CompilerContext, m map[string]interface{}) (interface{}, error) {
+	raw, ok := m[extensionKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(raw); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var e uploadExtConfig
+	if c := gjson.GetBytes(b.Bytes(), "upload"); c.Exists() {
+		e.upload = new(schema.UploadConfig)
+		if err := json.Unmarshal([]byte(c.Raw), e.upload); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return &e, nil
+}
+
+// uploadTraits returns the upload configuration of all traits which reference uploaded files, keyed by the
+// path of the trait, for example "avatar" or "name.picture".
+func uploadTraits(schemaURL string) (map[string]schema.UploadConfig, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Extensions[extensionName] = jsonschema.Extension{
+		// The identity meta schema is validated by the identity validator already.
+		Meta:    nil,
+		Compile: compile,
+	}
+
+	paths, err := jsonschemax.ListPaths(schemaURL, compiler)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	traits := map[string]schema.UploadConfig{}
+	for _, p := range paths {
+		if c, ok := p.CustomProperties[uploadProperty].(*schema.UploadConfig); ok {
+			traits[p.Name] = *c
+		}
+	}
+	return traits, nil
+}
@@ -0,0 +1,555 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/pagination"
+	"github.com/ory/x/randx"
+	"github.com/ory/x/urlx"
+
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/egress"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	WebhooksPath      = "/webhooks"
+	EventsPath        = WebhooksPath + "/events"
+	SubscriptionsPath = WebhooksPath + "/subscriptions"
+
+	// DeliveriesPath is appended to the path of a subscription.
+	DeliveriesPath = "deliveries"
+
+	generatedSecretLength = 32
+)
+
+type (
+	handlerDependencies interface {
+		PersistenceProvider
+		cipher.Provider
+		x.WriterProvider
+		x.LoggingProvider
+	}
+	HandlerProvider interface {
+		WebhookHandler() *Handler
+	}
+	Handler struct {
+		r handlerDependencies
+		c configuration.Provider
+	}
+)
+
+func NewHandler(r handlerDependencies, c configuration.Provider) *Handler {
+	return &Handler{r: r, c: c}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(EventsPath, h.listEvents)
+
+	admin.GET(SubscriptionsPath, h.list)
+	admin.POST(SubscriptionsPath, h.create)
+	admin.GET(SubscriptionsPath+"/:id", h.get)
+	admin.PUT(SubscriptionsPath+"/:id", h.update)
+	admin.DELETE(SubscriptionsPath+"/:id", h.delete)
+
+	admin.GET(SubscriptionsPath+"/:id/"+DeliveriesPath, h.listDeliveries)
+	admin.GET(SubscriptionsPath+"/:id/"+DeliveriesPath+"/:delivery_id", h.getDelivery)
+	admin.POST(SubscriptionsPath+"/:id/"+DeliveriesPath+"/:delivery_id/redeliver", h.redeliver)
+}
+
+// The catalog of webhook event types.
+//
+// swagger:response webhookEvents
+// nolint:deadcode,unused
+type eventsResponse struct {
+	// in: body
+	Body []EventDescription
+}
+
+// A webhook subscription.
+//
+// swagger:response webhookSubscription
+// nolint:deadcode,unused
+type subscriptionResponse struct {
+	// in: body
+	Body *Subscription
+}
+
+// A list of webhook subscriptions.
+//
+// swagger:response webhookSubscriptions
+// nolint:deadcode,unused
+type subscriptionsResponse struct {
+	// in: body
+	Body []Subscription
+}
+
+// A webhook delivery.
+//
+// swagger:response webhookDelivery
+// nolint:deadcode,unused
+type deliveryResponse struct {
+	// in: body
+	Body *Delivery
+}
+
+// A list of webhook deliveries.
+//
+// swagger:response webhookDeliveries
+// nolint:deadcode,unused
+type deliveriesResponse struct {
+	// in: body
+	Body []Delivery
+}
+
+// swagger:model setWebhookSubscription
+type SetSubscription struct {
+	// URL receives the events as POST requests. It must be an absolute http or https URL.
+	//
+	// required: true
+	URL string `json:"url"`
+
+	// Events are the types of events sent to the URL, see GET /webhooks/events.
+	//
+	// required: true
+	Events EventTypes `json:"events"`
+
+	// Filter is a Jsonnet expression which must evaluate to true for an event to be sent. The event is
+	// available as `std.extVar('event')`. All events are sent if it is empty.
+	Filter string `json:"filter"`
+
+	// Enabled subscriptions receive events. Defaults to true when the subscription is created and to the
+	// current state when it is updated.
+	Enabled *bool `json:"enabled"`
+
+	// Secret signs the requests sent to the URL. It must have at least 16 characters. A secret is generated
+	// when the subscription is created without one, and the secret is kept when the subscription is updated
+	// without one.
+	Secret string `json:"secret"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listWebhookSubscriptions
+type listParameters struct {
+	// in: query
+	Page int `json:"page"`
+
+	// in: query
+	PerPage int `json:"per_page"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters createWebhookSubscription
+type createParameters struct {
+	// in: body
+	Body SetSubscription
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getWebhookSubscription deleteWebhookSubscription
+type subscriptionParameters struct {
+	// ID is the ID of the subscription.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters updateWebhookSubscription
+type updateParameters struct {
+	// ID is the ID of the subscription.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	Body SetSubscription
+}
+
+// nolint:deadcode,unused
+// swagger:parameters listWebhookDeliveries
+type listDeliveriesParameters struct {
+	// ID is the ID of the subscription.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: query
+	Page int `json:"page"`
+
+	// in: query
+	PerPage int `json:"per_page"`
+}
+
+// nolint:deadcode,unused
+// swagger:parameters getWebhookDelivery redeliverWebhookDelivery
+type deliveryParameters struct {
+	// ID is the ID of the subscription.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// DeliveryID is the ID of the delivery.
+	//
+	// required: true
+	// in: path
+	DeliveryID string `json:"delivery_id"`
+}
+
+// swagger:route GET /webhooks/events admin listWebhookEvents
+//
+// List the webhook event types
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: webhookEvents
+func (h *Handler) listEvents(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	h.r.Writer().Write(w, r, Events)
+}
+
+// swagger:route GET /webhooks/subscriptions admin listWebhookSubscriptions
+//
+// List the webhook subscriptions
+//
+// Returns the subscriptions, the oldest first. Secrets are not returned.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: webhookSubscriptions
+//       500: genericError
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	ss, err := h.r.WebhookPersister().ListWebhookSubscriptions(r.Context(), limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, ss)
+}
+
+// swagger:route POST /webhooks/subscriptions admin createWebhookSubscription
+//
+// Create a webhook subscription
+//
+// Events of the subscribed types are sent to the URL as signed POST requests, see the `X-Kratos-Signature`
+// header. Deliveries which fail are tried again with an increasing delay. Subscriptions are stored in the
+// database, so they take effect on all instances of ORY Kratos without a restart.
+//
+// The secret is only returned in this response.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: webhookSubscription
+//       400: genericError
+//       500: genericError
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body, err := h.decode(r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if len(body.Secret) == 0 {
+		secret, err := randx.RuneSequence(generatedSecretLength, randx.AlphaNum)
+		if err != nil {
+			h.r.Writer().WriteError(w, r, errors.WithStack(err))
+			return
+		}
+		body.Secret = string(secret)
+	}
+
+	s := &Subscription{ID: x.NewUUID(), Enabled: true}
+	if err := h.apply(r.Context(), s, body); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.WebhookPersister().CreateWebhookSubscription(r.Context(), s); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "webhook_subscription").
+		WithField("subscription_id", s.ID).
+		WithField("url", s.URL).
+		WithField("events", s.Events).
+		Info("A webhook subscription was created.")
+	h.r.Writer().WriteCreated(w, r, urlx.AppendPaths(h.c.SelfAdminURL(), SubscriptionsPath, s.ID.String()).String(), s)
+}
+
+// swagger:route GET /webhooks/subscriptions/{id} admin getWebhookSubscription
+//
+// Get a webhook subscription
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: webhookSubscription
+//       404: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.WebhookPersister().GetWebhookSubscription(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, s)
+}
+
+// swagger:route PUT /webhooks/subscriptions/{id} admin updateWebhookSubscription
+//
+// Update a webhook subscription
+//
+// Replaces the URL, the event types, and the filter of the subscription. The state and the secret are only
+// changed if they are set. Pending deliveries are sent to the new URL.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: webhookSubscription
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := h.decode(r)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s, err := h.r.WebhookPersister().GetWebhookSubscription(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.apply(r.Context(), s, body); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.WebhookPersister().UpdateWebhookSubscription(r.Context(), s); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "webhook_subscription").
+		WithField("subscription_id", s.ID).
+		WithField("url", s.URL).
+		WithField("events", s.Events).
+		WithField("enabled", s.Enabled).
+		WithField("secret_changed", len(body.Secret) > 0).
+		Info("A webhook subscription was updated.")
+
+	s.Secret = ""
+	h.r.Writer().Write(w, r, s)
+}
+
+// swagger:route DELETE /webhooks/subscriptions/{id} admin deleteWebhookSubscription
+//
+// Delete a webhook subscription
+//
+// Deletes the subscription and its delivery log. Pending deliveries are not sent.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := x.ParseUUID(ps.ByName("id"))
+	if err := h.r.WebhookPersister().DeleteWebhookSubscription(r.Context(), id); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "webhook_subscription").
+		WithField("subscription_id", id).
+		Info("A webhook subscription was deleted.")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route GET /webhooks/subscriptions/{id}/deliveries admin listWebhookDeliveries
+//
+// List the deliveries of a webhook subscription
+//
+// Returns the delivery log of the subscription, the most recent delivery first. Delivered and failed deliveries
+// are deleted after the time configured at `serve.webhooks.delivery_retention`.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: webhookDeliveries
+//       404: genericError
+//       500: genericError
+func (h *Handler) listDeliveries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.WebhookPersister().GetWebhookSubscription(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	limit, offset := pagination.Parse(r, 100, 0, 500)
+	ds, err := h.r.WebhookPersister().ListWebhookDeliveries(r.Context(), s.ID, limit, offset)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, ds)
+}
+
+// swagger:route GET /webhooks/subscriptions/{id}/deliveries/{delivery_id} admin getWebhookDelivery
+//
+// Get a delivery of a webhook subscription
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: webhookDelivery
+//       404: genericError
+//       500: genericError
+func (h *Handler) getDelivery(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	d, err := h.r.WebhookPersister().GetWebhookDelivery(r.Context(), x.ParseUUID(ps.ByName("id")), x.ParseUUID(ps.ByName("delivery_id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, d)
+}
+
+// swagger:route POST /webhooks/subscriptions/{id}/deliveries/{delivery_id}/redeliver admin redeliverWebhookDelivery
+//
+// Redeliver an event to a webhook subscription
+//
+// Queues a new delivery of the event of the given delivery, for example after the subscriber recovered from an
+// outage. The new delivery has the same event ID, so subscribers can detect duplicates.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: webhookDelivery
+//       404: genericError
+//       500: genericError
+func (h *Handler) redeliver(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	original, err := h.r.WebhookPersister().GetWebhookDelivery(r.Context(), x.ParseUUID(ps.ByName("id")), x.ParseUUID(ps.ByName("delivery_id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	d := original.Redeliver()
+	if err := h.r.WebhookPersister().CreateWebhookDelivery(r.Context(), d); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	x.ContextLogger(r.Context(), h.r.Logger()).
+		WithField("audit", "webhook_subscription").
+		WithField("subscription_id", d.SubscriptionID).
+		WithField("delivery_id", d.ID).
+		WithField("event_id", d.EventID).
+		WithField("redelivery_of", original.ID).
+		Info("A webhook event was queued for redelivery.")
+	h.r.Writer().WriteCreated(w, r,
+		urlx.AppendPaths(h.c.SelfAdminURL(), SubscriptionsPath, d.SubscriptionID.String(), DeliveriesPath, d.ID.String()).String(),
+		d,
+	)
+}
+
+func (h *Handler) decode(r *http.Request) (*SetSubscription, error) {
+	var body SetSubscription
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&body); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the request body: %s", err))
+	}
+
+	if len(body.Secret) > 0 && len(body.Secret) < minSecretLength {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The secret must have at least %d characters.", minSecretLength))
+	}
+	return &body, nil
+}
+
+// apply validates the payload and sets the fields of the subscription.
+func (h *Handler) apply(ctx context.Context, s *Subscription, body *SetSubscription) error {
+	s.URL = body.URL
+	s.Events = body.Events
+	s.Filter = body.Filter
+	if body.Enabled != nil {
+		s.Enabled = *body.Enabled
+	}
+
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	// Deliveries to such URLs would fail, see package egress. Other errors, for example hosts which can not be
+	// resolved yet, are reported by the deliveries.
+	u, _ := url.Parse(s.URL)
+	if err := egress.Default.CheckURL(ctx, u); errors.Is(err, egress.ErrHostNotAllowed) || errors.Is(err, x.ErrPrivateAddress) {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Events can not be delivered to the URL: %s", err))
+	}
+
+	if len(body.Secret) > 0 {
+		encrypted, err := h.r.Cipher().Encrypt([]byte(body.Secret))
+		if err != nil {
+			return err
+		}
+		s.Secret, s.EncryptedSecret = body.Secret, encrypted
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/webhook"
+	"github.com/ory/kratos/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeySecretsCipher, []string{"secret-thirty-two-characters-abc"})
+
+	router := x.NewRouterAdmin()
+	reg.WebhookHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string, expectCode int, out interface{}) {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.EqualValues(t, expectCode, res.StatusCode)
+
+		if out != nil {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(out))
+		}
+	}
+
+	t.Run("case=lists the event types", func(t *testing.T) {
+		var es []EventDescription
+		do(t, "GET", EventsPath, "", http.StatusOK, &es)
+		assert.Len(t, es, len(Events))
+	})
+
+	t.Run("case=rejects invalid subscriptions", func(t *testing.T) {
+		for k, body := range []string{
+			`{"url":"/hooks","events":["identity.created"]}`,
+			`{"url":"https://example.org/hooks","events":[]}`,
+			`{"url":"https://example.org/hooks","events":["identity.exploded"]}`,
+			`{"url":"https://example.org/hooks","events":["identity.created"],"filter":"true =="}`,
+			`{"url":"https://example.org/hooks","events":["identity.created"],"secret":"short"}`,
+			`{"url":"https://example.org/hooks","events":["identity.created"],"unknown":true}`,
+		} {
+			t.Run("case="+string(rune('a'+k)), func(t *testing.T) {
+				do(t, "POST", SubscriptionsPath, body, http.StatusBadRequest, nil)
+			})
+		}
+	})
+
+	t.Run("case=rejects urls in private networks", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyEgressBlockPrivateNetworks, true)
+		defer viper.Set(configuration.ViperKeyEgressBlockPrivateNetworks, false)
+
+		do(t, "POST", SubscriptionsPath, `{"url":"http://169.254.169.254/latest/meta-data","events":["identity.created"]}`, http.StatusBadRequest, nil)
+		do(t, "POST", SubscriptionsPath, `{"url":"http://127.0.0.1:4455/hooks","events":["identity.created"]}`, http.StatusBadRequest, nil)
+	})
+
+	var s Subscription
+	t.Run("case=creates a subscription", func(t *testing.T) {
+		do(t, "POST", SubscriptionsPath, `{"url":"https://example.org/hooks","events":["identity.created"]}`, http.StatusCreated, &s)
+		assert.Equal(t, "https://example.org/hooks", s.URL)
+		assert.Equal(t, EventTypes{EventIdentityCreated}, s.Events)
+		assert.True(t, s.Enabled)
+		assert.Len(t, s.Secret, 32, "a secret is generated")
+
+		stored, err := reg.WebhookPersister().GetWebhookSubscription(context.Background(), s.ID)
+		require.NoError(t, err)
+		assert.NotContains(t, stored.EncryptedSecret, s.Secret)
+		secret, err := reg.Cipher().Decrypt(stored.EncryptedSecret)
+		require.NoError(t, err)
+		assert.Equal(t, s.Secret, string(secret))
+
+		var actual Subscription
+		do(t, "GET", SubscriptionsPath+"/"+s.ID.String(), "", http.StatusOK, &actual)
+		assert.Equal(t, s.ID, actual.ID)
+		assert.Empty(t, actual.Secret, "the secret is only returned on creation")
+
+		var ss []Subscription
+		do(t, "GET", SubscriptionsPath, "", http.StatusOK, &ss)
+		require.Len(t, ss, 1)
+		assert.Empty(t, ss[0].Secret)
+	})
+
+	t.Run("case=updates a subscription", func(t *testing.T) {
+		var actual Subscription
+		do(t, "PUT", SubscriptionsPath+"/"+s.ID.String(),
+			`{"url":"https://example.org/v2/hooks","events":["identity.created","identity.deleted"],"filter":"true","enabled":false}`,
+			http.StatusOK, &actual)
+		assert.Equal(t, "https://example.org/v2/hooks", actual.URL)
+		assert.Equal(t, EventTypes{EventIdentityCreated, EventIdentityDeleted}, actual.Events)
+		assert.Equal(t, "true", actual.Filter)
+		assert.False(t, actual.Enabled)
+		assert.Empty(t, actual.Secret)
+
+		stored, err := reg.WebhookPersister().GetWebhookSubscription(context.Background(), s.ID)
+		require.NoError(t, err)
+		secret, err := reg.Cipher().Decrypt(stored.EncryptedSecret)
+		require.NoError(t, err)
+		assert.Equal(t, s.Secret, string(secret), "the secret is kept")
+
+		do(t, "PUT", SubscriptionsPath+"/"+s.ID.String(),
+			`{"url":"https://example.org/v2/hooks","events":["identity.created"],"secret":"a-new-secret-of-many-characters"}`,
+			http.StatusOK, &actual)
+		assert.False(t, actual.Enabled, "the state is kept")
+
+		stored, err = reg.WebhookPersister().GetWebhookSubscription(context.Background(), s.ID)
+		require.NoError(t, err)
+		secret, err = reg.Cipher().Decrypt(stored.EncryptedSecret)
+		require.NoError(t, err)
+		assert.Equal(t, "a-new-secret-of-many-characters", string(secret))
+
+		do(t, "PUT", SubscriptionsPath+"/"+x.NewUUID().String(), `{"url":"https://example.org/hooks","events":["identity.created"]}`, http.StatusNotFound, nil)
+	})
+
+	t.Run("case=lists and redelivers deliveries", func(t *testing.T) {
+		original := NewDelivery(s.ID, &Event{ID: x.NewUUID(), Type: EventIdentityCreated}, []byte(`{"id":"a"}`))
+		original.State = StateFailed
+		require.NoError(t, reg.WebhookPersister().CreateWebhookDelivery(context.Background(), original))
+
+		var ds []Delivery
+		do(t, "GET", SubscriptionsPath+"/"+s.ID.String()+"/"+DeliveriesPath, "", http.StatusOK, &ds)
+		require.Len(t, ds, 1)
+		assert.Equal(t, original.ID, ds[0].ID)
+		assert.Equal(t, StateFailed, ds[0].State)
+		assert.JSONEq(t, `{"id":"a"}`, string(ds[0].Payload))
+
+		var d Delivery
+		do(t, "POST", SubscriptionsPath+"/"+s.ID.String()+"/"+DeliveriesPath+"/"+original.ID.String()+"/redeliver", "", http.StatusCreated, &d)
+		assert.NotEqual(t, original.ID, d.ID)
+		assert.Equal(t, original.EventID, d.EventID)
+		assert.Equal(t, StatePending, d.State)
+
+		var actual Delivery
+		do(t, "GET", SubscriptionsPath+"/"+s.ID.String()+"/"+DeliveriesPath+"/"+d.ID.String(), "", http.StatusOK, &actual)
+		assert.Equal(t, d.ID, actual.ID)
+
+		do(t, "GET", SubscriptionsPath+"/"+s.ID.String()+"/"+DeliveriesPath, "", http.StatusOK, &ds)
+		assert.Len(t, ds, 2)
+
+		do(t, "POST", SubscriptionsPath+"/"+x.NewUUID().String()+"/"+DeliveriesPath+"/"+original.ID.String()+"/redeliver", "", http.StatusNotFound, nil)
+		do(t, "GET", SubscriptionsPath+"/"+x.NewUUID().String()+"/"+DeliveriesPath, "", http.StatusNotFound, nil)
+	})
+
+	t.Run("case=deletes a subscription", func(t *testing.T) {
+		do(t, "DELETE", SubscriptionsPath+"/"+s.ID.String(), "", http.StatusNoContent, nil)
+		do(t, "DELETE", SubscriptionsPath+"/"+s.ID.String(), "", http.StatusNotFound, nil)
+		do(t, "GET", SubscriptionsPath+"/"+s.ID.String(), "", http.StatusNotFound, nil)
+	})
+}
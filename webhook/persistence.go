@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/x"
+)
+
+type (
+	PersistenceProvider interface {
+		WebhookPersister() Persister
+	}
+	Persister interface {
+		CreateWebhookSubscription(ctx context.Context, s *Subscription) error
+
+		GetWebhookSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+
+		// ListWebhookSubscriptions returns the subscriptions, the oldest first.
+		ListWebhookSubscriptions(ctx context.Context, limit, offset int) ([]Subscription, error)
+
+		// FindWebhookSubscriptions returns the enabled subscriptions to the event type.
+		FindWebhookSubscriptions(ctx context.Context, t EventType) ([]Subscription, error)
+
+		// UpdateWebhookSubscription stores the URL, the events, the filter, the state, and the secret of the
+		// subscription.
+		UpdateWebhookSubscription(ctx context.Context, s *Subscription) error
+
+		// DeleteWebhookSubscription deletes the subscription and its deliveries.
+		DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) error
+
+		CreateWebhookDelivery(ctx context.Context, d *Delivery) error
+
+		// GetWebhookDelivery returns the delivery of the subscription.
+		GetWebhookDelivery(ctx context.Context, subscriptionID, id uuid.UUID) (*Delivery, error)
+
+		// ListWebhookDeliveries returns the deliveries of the subscription, the most recent first.
+		ListWebhookDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit, offset int) ([]Delivery, error)
+
+		// ClaimWebhookDeliveries marks up to limit pending deliveries which are due at now as running and returns
+		// them, the earliest first. Deliveries which are running since before staleBefore are claimed again. A
+		// delivery is only claimed by one caller at a time.
+		ClaimWebhookDeliveries(ctx context.Context, now, staleBefore time.Time, limit int) ([]Delivery, error)
+
+		// UpdateWebhookDelivery stores the state, the response, the error, and the times of the delivery.
+		UpdateWebhookDelivery(ctx context.Context, d *Delivery) error
+
+		// DeleteWebhookDeliveries deletes the delivered and failed deliveries which were created before the given
+		// time.
+		DeleteWebhookDeliveries(ctx context.Context, createdBefore time.Time) (int, error)
+	}
+)
+
+func TestPersister(p Persister) func(t *testing.T) {
+	return func(t *testing.T) {
+		newSubscription := func(t *testing.T, enabled bool, events ...EventType) *Subscription {
+			s := &Subscription{
+				ID:              x.NewUUID(),
+				URL:             "https://example.org/hooks",
+				Events:          events,
+				Enabled:         enabled,
+				EncryptedSecret: "encrypted",
+			}
+			require.NoError(t, p.CreateWebhookSubscription(context.Background(), s))
+			return s
+		}
+
+		created := newSubscription(t, true, EventIdentityCreated, EventIdentityDeleted)
+		disabled := newSubscription(t, false, EventIdentityCreated)
+		sessions := newSubscription(t, true, EventSessionCreated)
+
+		t.Run("case=subscriptions", func(t *testing.T) {
+			_, err := p.GetWebhookSubscription(context.Background(), x.NewUUID())
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+
+			actual, err := p.GetWebhookSubscription(context.Background(), created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, created.URL, actual.URL)
+			assert.Equal(t, created.Events, actual.Events)
+			assert.Equal(t, "encrypted", actual.EncryptedSecret)
+
+			ss, err := p.ListWebhookSubscriptions(context.Background(), 100, 0)
+			require.NoError(t, err)
+			assert.Len(t, ss, 3)
+
+			ss, err = p.FindWebhookSubscriptions(context.Background(), EventIdentityCreated)
+			require.NoError(t, err)
+			require.Len(t, ss, 1, "disabled subscriptions are not returned")
+			assert.Equal(t, created.ID, ss[0].ID)
+
+			ss, err = p.FindWebhookSubscriptions(context.Background(), EventIdentityUpdated)
+			require.NoError(t, err)
+			assert.Len(t, ss, 0)
+
+			disabled.Enabled = true
+			disabled.Filter = "true"
+			disabled.Events = EventTypes{EventIdentityUpdated}
+			require.NoError(t, p.UpdateWebhookSubscription(context.Background(), disabled))
+
+			ss, err = p.FindWebhookSubscriptions(context.Background(), EventIdentityUpdated)
+			require.NoError(t, err)
+			require.Len(t, ss, 1)
+			assert.Equal(t, "true", ss[0].Filter)
+
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.UpdateWebhookSubscription(context.Background(), &Subscription{ID: x.NewUUID()})))
+		})
+
+		t.Run("case=deliveries", func(t *testing.T) {
+			e := &Event{ID: x.NewUUID(), Type: EventIdentityCreated}
+			now := time.Now().UTC().Round(time.Second)
+
+			due := NewDelivery(created.ID, e, []byte(`{"id":"a"}`))
+			due.NextAttemptAt = now.Add(-time.Minute)
+			require.NoError(t, p.CreateWebhookDelivery(context.Background(), due))
+
+			later := NewDelivery(created.ID, e, []byte(`{"id":"b"}`))
+			later.NextAttemptAt = now.Add(time.Hour)
+			require.NoError(t, p.CreateWebhookDelivery(context.Background(), later))
+
+			other := NewDelivery(sessions.ID, e, []byte(`{}`))
+			other.NextAttemptAt = now.Add(time.Hour)
+			require.NoError(t, p.CreateWebhookDelivery(context.Background(), other))
+
+			_, err := p.GetWebhookDelivery(context.Background(), sessions.ID, due.ID)
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err), "deliveries of other subscriptions are not returned")
+
+			actual, err := p.GetWebhookDelivery(context.Background(), created.ID, due.ID)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"id":"a"}`, string(actual.Payload))
+			assert.Equal(t, StatePending, actual.State)
+
+			ds, err := p.ListWebhookDeliveries(context.Background(), created.ID, 100, 0)
+			require.NoError(t, err)
+			assert.Len(t, ds, 2)
+
+			claimed, err := p.ClaimWebhookDeliveries(context.Background(), now, now.Add(-lease), 10)
+			require.NoError(t, err)
+			require.Len(t, claimed, 1)
+			assert.Equal(t, due.ID, claimed[0].ID)
+			assert.Equal(t, StateRunning, claimed[0].State)
+			assert.Equal(t, 1, claimed[0].Attempts)
+
+			claimed, err = p.ClaimWebhookDeliveries(context.Background(), now, now.Add(-lease), 10)
+			require.NoError(t, err)
+			assert.Len(t, claimed, 0, "running deliveries are not claimed twice")
+
+			claimed, err = p.ClaimWebhookDeliveries(context.Background(), now, now.Add(time.Minute), 10)
+			require.NoError(t, err)
+			require.Len(t, claimed, 1, "stale deliveries are claimed again")
+			assert.Equal(t, 2, claimed[0].Attempts)
+
+			delivered := claimed[0]
+			delivered.State = StateDelivered
+			delivered.ResponseStatus = 204
+			delivered.DeliveredAt = &now
+			require.NoError(t, p.UpdateWebhookDelivery(context.Background(), &delivered))
+
+			actual, err = p.GetWebhookDelivery(context.Background(), created.ID, due.ID)
+			require.NoError(t, err)
+			assert.Equal(t, StateDelivered, actual.State)
+			assert.Equal(t, 204, actual.ResponseStatus)
+			require.NotNil(t, actual.DeliveredAt)
+
+			count, err := p.DeleteWebhookDeliveries(context.Background(), time.Now().UTC().Add(time.Minute))
+			require.NoError(t, err)
+			assert.Equal(t, 1, count, "only delivered and failed deliveries are deleted")
+
+			_, err = p.GetWebhookDelivery(context.Background(), created.ID, due.ID)
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+		})
+
+		t.Run("case=deleting a subscription deletes its deliveries", func(t *testing.T) {
+			d := NewDelivery(sessions.ID, &Event{ID: x.NewUUID(), Type: EventSessionCreated}, []byte(`{}`))
+			require.NoError(t, p.CreateWebhookDelivery(context.Background(), d))
+
+			require.NoError(t, p.DeleteWebhookSubscription(context.Background(), sessions.ID))
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(p.DeleteWebhookSubscription(context.Background(), sessions.ID)))
+
+			_, err := p.GetWebhookDelivery(context.Background(), sessions.ID, d.ID)
+			assert.Equal(t, sqlcon.ErrNoRows, errors.Cause(err))
+		})
+	}
+}
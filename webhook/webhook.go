@@ -0,0 +1,562 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/ory/kratos/cipher"
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/egress"
+	"github.com/ory/kratos/persistence/aliases"
+	"github.com/ory/kratos/x"
+)
+
+const (
+	// EventIdentityCreated is emitted when an identity was created, using the admin API or self-service
+	// registration. The data is the identity.
+	EventIdentityCreated EventType = "identity.created"
+	// EventIdentityUpdated is emitted when the traits of an identity changed. The data is the identity.
+	EventIdentityUpdated EventType = "identity.updated"
+	// EventIdentityDeleted is emitted when an identity was deleted. The data contains the ID of the identity.
+	EventIdentityDeleted EventType = "identity.deleted"
+	// EventSessionCreated is emitted when an identity signed in or was signed in after registration. The data is
+	// the session.
+	EventSessionCreated EventType = "session.created"
+	// EventRecoveryTicketCreated is emitted when a user asked for manual account recovery. The data is the
+	// ticket, which an administrator approves or rejects using the admin API.
+	EventRecoveryTicketCreated EventType = "recovery.ticket.created"
+
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateDelivered State = "delivered"
+	StateFailed    State = "failed"
+)
+
+const (
+	// EventTypeHeader carries the type of the event of a delivery.
+	EventTypeHeader = "X-Kratos-Event-Type"
+	// DeliveryHeader carries the ID of a delivery.
+	DeliveryHeader = "X-Kratos-Delivery"
+
+	// batchSize is the maximum number of deliveries claimed at once.
+	batchSize = 100
+
+	// maxAttempts is the number of times a delivery is tried before it fails for good.
+	maxAttempts = 6
+
+	// lease is the time after which a delivery which is still running is assumed to belong to a worker which
+	// stopped, and is claimed again.
+	lease = 5 * time.Minute
+
+	// timeout limits the time a subscriber has to respond.
+	timeout = 10 * time.Second
+
+	// maxResponseLength is the number of bytes of the response of a subscriber which is kept in the delivery log.
+	maxResponseLength = 1024
+
+	minSecretLength = 16
+	maxURLLength    = 2048
+)
+
+// Events is the catalog of the events webhook subscriptions can subscribe to.
+var Events = []EventDescription{
+	{Type: EventIdentityCreated, Description: "An identity was created using the admin API or self-service registration. The data is the identity."},
+	{Type: EventIdentityUpdated, Description: "An identity was updated, for example its traits using the profile management flow. The data is the identity."},
+	{Type: EventIdentityDeleted, Description: "An identity was deleted. The data contains the ID of the identity."},
+	{Type: EventSessionCreated, Description: "An identity signed in, or was signed in after registration. The data is the session."},
+	{Type: EventRecoveryTicketCreated, Description: "A user asked for manual account recovery. The data is the recovery ticket, which has to be approved or rejected using the admin API."},
+}
+
+type (
+	// EventType identifies what happened, for example "identity.created".
+	EventType string
+
+	// EventTypes are the event types a subscription subscribes to.
+	EventTypes []EventType
+
+	// State is the state of a delivery.
+	State string
+
+	// Payload is the JSON encoded event of a delivery.
+	Payload json.RawMessage
+
+	// An event type of the catalog.
+	//
+	// swagger:model webhookEventDescription
+	EventDescription struct {
+		// required: true
+		Type EventType `json:"type"`
+
+		// required: true
+		Description string `json:"description"`
+	}
+
+	// Event is the body of the requests sent to the subscribers. The request is signed using the secret of the
+	// subscription, see x.SignatureHeader.
+	//
+	// swagger:model webhookEvent
+	Event struct {
+		// ID identifies the event. Redeliveries of an event have the same ID.
+		//
+		// required: true
+		ID uuid.UUID `json:"id"`
+
+		// required: true
+		Type EventType `json:"type"`
+
+		// required: true
+		CreatedAt time.Time `json:"created_at"`
+
+		// required: true
+		Data json.RawMessage `json:"data"`
+	}
+
+	// Subscription sends the events of the subscribed types to a URL.
+	//
+	// swagger:model webhookSubscription
+	Subscription struct {
+		// required: true
+		ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+		// URL receives the events as POST requests.
+		//
+		// required: true
+		URL string `json:"url" db:"url"`
+
+		// Events are the types of events sent to the URL, see GET /webhooks/events.
+		//
+		// required: true
+		Events EventTypes `json:"events" faker:"-" db:"events"`
+
+		// Filter is a Jsonnet expression which must evaluate to true for an event to be sent. The event is
+		// available as `std.extVar('event')`, for example
+		// `std.extVar('event').data.traits_schema_id == 'customer'`. All events are sent if it is empty.
+		Filter string `json:"filter,omitempty" db:"filter"`
+
+		// Enabled subscriptions receive events. Events which occur while a subscription is disabled are not sent.
+		//
+		// required: true
+		Enabled bool `json:"enabled" db:"enabled"`
+
+		// Secret signs the requests sent to the URL. It is only returned when the subscription is created.
+		Secret string `json:"secret,omitempty" faker:"-" db:"-"`
+
+		// EncryptedSecret is the secret, encrypted using the cipher secrets.
+		EncryptedSecret string `json:"-" faker:"-" db:"secret"`
+
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"-" db:"created_at"`
+
+		// required: true
+		UpdatedAt time.Time `json:"updated_at" faker:"-" db:"updated_at"`
+	}
+
+	// Delivery is the attempt to send an event to a subscription.
+	//
+	// swagger:model webhookDelivery
+	Delivery struct {
+		// required: true
+		ID uuid.UUID `json:"id" faker:"uuid" db:"id"`
+
+		// required: true
+		SubscriptionID uuid.UUID `json:"subscription_id" faker:"uuid" db:"subscription_id"`
+
+		// EventID is the ID of the event. Redeliveries have the same event ID as the original delivery.
+		//
+		// required: true
+		EventID uuid.UUID `json:"event_id" faker:"uuid" db:"event_id"`
+
+		// required: true
+		EventType EventType `json:"event_type" db:"event_type"`
+
+		// Payload is the event which is sent.
+		//
+		// required: true
+		Payload Payload `json:"payload" faker:"-" db:"payload"`
+
+		// State is one of "pending", "running", "delivered", and "failed".
+		//
+		// required: true
+		State State `json:"state" db:"state"`
+
+		// Attempts is the number of times the delivery was tried.
+		//
+		// required: true
+		Attempts int `json:"attempts" db:"attempts"`
+
+		// NextAttemptAt is the time (UTC) of the next attempt of a pending delivery.
+		//
+		// required: true
+		NextAttemptAt time.Time `json:"next_attempt_at" faker:"time_type" db:"next_attempt_at"`
+
+		// ResponseStatus is the status code the subscriber responded with to the last attempt.
+		ResponseStatus int `json:"response_status,omitempty" db:"response_status"`
+
+		// ResponseBody is the beginning of the body the subscriber responded with to the last attempt.
+		ResponseBody string `json:"response_body,omitempty" db:"response_body"`
+
+		// LastError is the error of the last failed attempt.
+		LastError string `json:"last_error,omitempty" db:"last_error"`
+
+		// DeliveredAt is the time (UTC) the subscriber acknowledged the event.
+		DeliveredAt *time.Time `json:"delivered_at,omitempty" faker:"-" db:"delivered_at"`
+
+		// required: true
+		CreatedAt time.Time `json:"created_at" faker:"-" db:"created_at"`
+
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+
+	dispatcherDependencies interface {
+		PersistenceProvider
+		cipher.Provider
+		x.LoggingProvider
+	}
+	DispatcherProvider interface {
+		WebhookDispatcher() *Dispatcher
+	}
+	// Dispatcher queues the events for the subscriptions and delivers them.
+	Dispatcher struct {
+		r      dispatcherDependencies
+		c      configuration.Provider
+		client *http.Client
+	}
+)
+
+func (s Subscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+func (d Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+func (e *EventTypes) Scan(value interface{}) error {
+	return aliases.JSONScan(e, value)
+}
+
+func (e EventTypes) Value() (driver.Value, error) {
+	return aliases.JSONValue(&e)
+}
+
+func (p *Payload) Scan(value interface{}) error {
+	return aliases.JSONScan(p, value)
+}
+
+func (p *Payload) Value() (driver.Value, error) {
+	return aliases.JSONValue(p)
+}
+
+// MarshalJSON returns p as the JSON encoding of p.
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// UnmarshalJSON sets *p to a copy of data.
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	if p == nil {
+		return errors.New("webhook.Payload: UnmarshalJSON on nil pointer")
+	}
+	*p = append((*p)[0:0], data...)
+	return nil
+}
+
+// IsKnown returns true if the event type is part of the catalog.
+func (t EventType) IsKnown() bool {
+	for _, e := range Events {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Has returns true if the subscription subscribes to the event type.
+func (e EventTypes) Has(t EventType) bool {
+	for _, s := range e {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the URL, the event types, and the filter of the subscription.
+func (s *Subscription) Validate() error {
+	u, err := url.ParseRequestURI(s.URL)
+	if err != nil || len(s.URL) > maxURLLength || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The URL must be an absolute http or https URL of at most %d characters.", maxURLLength))
+	}
+
+	if len(s.Events) == 0 {
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("The subscription must subscribe to at least one event type."))
+	}
+	for _, t := range s.Events {
+		if !t.IsKnown() {
+			return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The event type "%s" is unknown, see GET /webhooks/events.`, t))
+		}
+	}
+
+	if len(s.Filter) > 0 {
+		// Unused locals are not evaluated, so this only checks the syntax of the filter.
+		if _, err := newFilterVM([]byte(`{}`)).EvaluateSnippet("filter", "local filter = (\n"+s.Filter+"\n);\ntrue"); err != nil {
+			return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The filter is not a valid Jsonnet expression: %s", err))
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the filter of the subscription evaluates to true for the JSON encoded event.
+func (s *Subscription) Matches(event []byte) (bool, error) {
+	if len(s.Filter) == 0 {
+		return true, nil
+	}
+
+	out, err := newFilterVM(event).EvaluateSnippet("filter", s.Filter)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	switch strings.TrimSpace(out) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, errors.Errorf("the filter must evaluate to true or false but evaluated to %s", strings.TrimSpace(out))
+}
+
+func newFilterVM(event []byte) *jsonnet.VM {
+	vm := jsonnet.MakeVM()
+	vm.ExtCode("event", string(event))
+	return vm
+}
+
+// NewDelivery returns a pending delivery of the JSON encoded event to the subscription.
+func NewDelivery(subscriptionID uuid.UUID, e *Event, payload []byte) *Delivery {
+	now := time.Now().UTC()
+	return &Delivery{
+		ID:             x.NewUUID(),
+		SubscriptionID: subscriptionID,
+		EventID:        e.ID,
+		EventType:      e.Type,
+		Payload:        Payload(payload),
+		State:          StatePending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+	}
+}
+
+// Redeliver returns a pending copy of the delivery, which sends the same event again.
+func (d *Delivery) Redeliver() *Delivery {
+	now := time.Now().UTC()
+	return &Delivery{
+		ID:             x.NewUUID(),
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        append(Payload{}, d.Payload...),
+		State:          StatePending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+	}
+}
+
+func NewDispatcher(r dispatcherDependencies, c configuration.Provider) *Dispatcher {
+	return &Dispatcher{
+		r: r,
+		c: c,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: egress.Default,
+			// A subscriber must not redirect the events to another service.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Emit queues a delivery of the event for every enabled subscription to its type whose filter matches. Errors are
+// logged instead of returned, because the change the event is about happened already.
+//
+// If the context carries a transaction, the deliveries are only queued if the transaction is committed.
+func (d *Dispatcher) Emit(ctx context.Context, t EventType, data interface{}) {
+	if err := d.emit(ctx, t, data); err != nil {
+		x.ContextLogger(ctx, d.r.Logger()).
+			WithError(err).
+			WithField("event_type", t).
+			Error("Unable to queue the webhook deliveries of an event.")
+	}
+}
+
+func (d *Dispatcher) emit(ctx context.Context, t EventType, data interface{}) error {
+	subscriptions, err := d.r.WebhookPersister().FindWebhookSubscriptions(ctx, t)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	e := &Event{ID: x.NewUUID(), Type: t, CreatedAt: time.Now().UTC(), Data: raw}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for k := range subscriptions {
+		s := &subscriptions[k]
+		if ok, err := s.Matches(payload); err != nil {
+			// A broken filter must not keep the event from the other subscriptions.
+			x.ContextLogger(ctx, d.r.Logger()).
+				WithError(err).
+				WithField("subscription_id", s.ID).
+				WithField("event_type", t).
+				Warn("Unable to evaluate the filter of a webhook subscription, the event is not sent to it.")
+			continue
+		} else if !ok {
+			continue
+		}
+
+		if err := d.r.WebhookPersister().CreateWebhookDelivery(ctx, NewDelivery(s.ID, e, payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deliver sends the deliveries which are due. A delivery which fails is tried again later with an increasing
+// delay until it failed maxAttempts times.
+func (d *Dispatcher) Deliver(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		deliveries, err := d.r.WebhookPersister().ClaimWebhookDeliveries(ctx, now, now.Add(-lease), batchSize)
+		if err != nil {
+			return err
+		}
+
+		for k := range deliveries {
+			status, body, err := d.send(ctx, &deliveries[k])
+			if err := d.finish(ctx, &deliveries[k], status, body, err); err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+}
+
+// send posts the event to the URL of the subscription and returns the status code and the beginning of the body
+// of the response.
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) (int, string, error) {
+	s, err := d.r.WebhookPersister().GetWebhookSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return 0, "", err
+	}
+	if !s.Enabled {
+		return 0, "", errors.New("the subscription is disabled")
+	}
+
+	secret, err := d.r.Cipher().Decrypt(s.EncryptedSecret)
+	if err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTypeHeader, string(delivery.EventType))
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(x.SignatureHeader, x.Sign(delivery.Payload, []string{string(secret)}, time.Now()))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseLength))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, string(body), errors.Errorf("expected status code 2xx but got %d", res.StatusCode)
+	}
+	return res.StatusCode, string(body), nil
+}
+
+// finish records the outcome of an attempt to send the delivery.
+func (d *Dispatcher) finish(ctx context.Context, delivery *Delivery, status int, body string, err error) error {
+	l := d.r.Logger().
+		WithField("delivery_id", delivery.ID).
+		WithField("subscription_id", delivery.SubscriptionID).
+		WithField("event_type", delivery.EventType).
+		WithField("attempts", delivery.Attempts)
+
+	now := time.Now().UTC()
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	switch {
+	case err == nil:
+		delivery.State = StateDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		l.Debug("Delivered a webhook event.")
+	case delivery.Attempts >= maxAttempts:
+		delivery.State = StateFailed
+		delivery.LastError = err.Error()
+		l.WithError(err).Error("A webhook delivery failed and will not be tried again.")
+	default:
+		delivery.State = StatePending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts))
+		l.WithError(err).WithField("next_attempt_at", delivery.NextAttemptAt).Warn("A webhook delivery failed and will be tried again.")
+	}
+
+	if err := d.r.WebhookPersister().UpdateWebhookDelivery(ctx, delivery); err != nil {
+		// Deleting a subscription deletes its deliveries.
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// backoff returns the time to wait before the next attempt: one minute after the first failed attempt, four
+// after the second, and so on.
+func backoff(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * time.Minute
+}
@@ -0,0 +1,205 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/ory/kratos/driver/configuration"
+	"github.com/ory/kratos/internal"
+	. "github.com/ory/kratos/webhook"
+	"github.com/ory/kratos/x"
+)
+
+func TestSubscription(t *testing.T) {
+	t.Run("method=Validate", func(t *testing.T) {
+		for k, tc := range []struct {
+			s       Subscription
+			invalid bool
+		}{
+			{s: Subscription{URL: "https://example.org/hooks", Events: EventTypes{EventIdentityCreated}}},
+			{s: Subscription{URL: "http://localhost:4455/hooks", Events: EventTypes{EventIdentityCreated, EventSessionCreated}, Filter: "std.extVar('event').type == 'identity.created'"}},
+			{s: Subscription{URL: "/hooks", Events: EventTypes{EventIdentityCreated}}, invalid: true},
+			{s: Subscription{URL: "ftp://example.org/hooks", Events: EventTypes{EventIdentityCreated}}, invalid: true},
+			{s: Subscription{URL: "https://example.org/hooks"}, invalid: true},
+			{s: Subscription{URL: "https://example.org/hooks", Events: EventTypes{"identity.exploded"}}, invalid: true},
+			{s: Subscription{URL: "https://example.org/hooks", Events: EventTypes{EventIdentityCreated}, Filter: "std.extVar('event').type =="}, invalid: true},
+		} {
+			err := tc.s.Validate()
+			if tc.invalid {
+				assert.Error(t, err, "%d", k)
+			} else {
+				assert.NoError(t, err, "%d", k)
+			}
+		}
+	})
+
+	t.Run("method=Matches", func(t *testing.T) {
+		event := []byte(`{"type":"identity.created","data":{"traits_schema_id":"customer"}}`)
+		for k, tc := range []struct {
+			filter  string
+			matches bool
+			err     bool
+		}{
+			{filter: "", matches: true},
+			{filter: "std.extVar('event').data.traits_schema_id == 'customer'", matches: true},
+			{filter: "std.extVar('event').data.traits_schema_id == 'employee'", matches: false},
+			{filter: "std.extVar('event').data.traits_schema_id", err: true},
+			{filter: "error 'broken'", err: true},
+		} {
+			s := Subscription{Filter: tc.filter}
+			matches, err := s.Matches(event)
+			if tc.err {
+				assert.Error(t, err, "%d", k)
+				continue
+			}
+			require.NoError(t, err, "%d", k)
+			assert.Equal(t, tc.matches, matches, "%d", k)
+		}
+	})
+}
+
+func TestDelivery(t *testing.T) {
+	d := NewDelivery(x.NewUUID(), &Event{ID: x.NewUUID(), Type: EventIdentityCreated}, []byte(`{"id":"a"}`))
+	d.State, d.Attempts, d.LastError = StateFailed, 6, "connection refused"
+
+	r := d.Redeliver()
+	assert.NotEqual(t, d.ID, r.ID)
+	assert.Equal(t, d.EventID, r.EventID)
+	assert.Equal(t, d.SubscriptionID, r.SubscriptionID)
+	assert.Equal(t, d.Payload, r.Payload)
+	assert.Equal(t, StatePending, r.State)
+	assert.Equal(t, 0, r.Attempts)
+	assert.Empty(t, r.LastError)
+}
+
+func TestDispatcher(t *testing.T) {
+	_, reg := internal.NewRegistryDefault(t)
+	viper.Set(configuration.ViperKeySecretsCipher, []string{"secret-thirty-two-characters-abc"})
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+
+	var lock sync.Mutex
+	var requests []request
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, request{header: r.Header, body: body})
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("thanks"))
+	}))
+	defer ts.Close()
+
+	received := func() []request {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]request{}, requests...)
+	}
+	respondWith := func(code int) {
+		lock.Lock()
+		defer lock.Unlock()
+		status = code
+	}
+
+	subscribe := func(t *testing.T, filter string, events ...EventType) *Subscription {
+		secret, err := reg.Cipher().Encrypt([]byte("subscription-secret"))
+		require.NoError(t, err)
+
+		s := &Subscription{ID: x.NewUUID(), URL: ts.URL, Events: events, Filter: filter, Enabled: true, EncryptedSecret: secret}
+		require.NoError(t, reg.WebhookPersister().CreateWebhookSubscription(context.Background(), s))
+		return s
+	}
+
+	all := subscribe(t, "", EventIdentityCreated)
+	customers := subscribe(t, "std.extVar('event').data.kind == 'customer'", EventIdentityCreated)
+	broken := subscribe(t, "std.extVar('event').data.kind", EventIdentityCreated)
+	sessions := subscribe(t, "", EventSessionCreated)
+
+	reg.WebhookDispatcher().Emit(context.Background(), EventIdentityCreated, map[string]string{"kind": "employee"})
+
+	count := func(t *testing.T, s *Subscription) int {
+		ds, err := reg.WebhookPersister().ListWebhookDeliveries(context.Background(), s.ID, 100, 0)
+		require.NoError(t, err)
+		return len(ds)
+	}
+	assert.Equal(t, 1, count(t, all))
+	assert.Equal(t, 0, count(t, customers), "the filter does not match")
+	assert.Equal(t, 0, count(t, broken), "the filter is broken")
+	assert.Equal(t, 0, count(t, sessions), "the event type is not subscribed to")
+
+	t.Run("case=delivers the event", func(t *testing.T) {
+		require.NoError(t, reg.WebhookDispatcher().Deliver(context.Background()))
+
+		require.Len(t, received(), 1)
+		req := received()[0]
+		assert.Equal(t, string(EventIdentityCreated), req.header.Get(EventTypeHeader))
+		require.NoError(t, x.VerifySignature(req.header.Get(x.SignatureHeader), req.body, []string{"subscription-secret"}, time.Minute, time.Now()))
+
+		var e Event
+		require.NoError(t, json.Unmarshal(req.body, &e))
+		assert.Equal(t, EventIdentityCreated, e.Type)
+		assert.JSONEq(t, `{"kind":"employee"}`, string(e.Data))
+
+		ds, err := reg.WebhookPersister().ListWebhookDeliveries(context.Background(), all.ID, 100, 0)
+		require.NoError(t, err)
+		require.Len(t, ds, 1)
+		assert.Equal(t, req.header.Get(DeliveryHeader), ds[0].ID.String())
+		assert.Equal(t, StateDelivered, ds[0].State)
+		assert.Equal(t, http.StatusNoContent, ds[0].ResponseStatus)
+		assert.NotNil(t, ds[0].DeliveredAt)
+	})
+
+	t.Run("case=retries a failed delivery later", func(t *testing.T) {
+		respondWith(http.StatusServiceUnavailable)
+		defer respondWith(http.StatusNoContent)
+
+		reg.WebhookDispatcher().Emit(context.Background(), EventSessionCreated, map[string]string{"id": "session"})
+		require.NoError(t, reg.WebhookDispatcher().Deliver(context.Background()))
+		require.Len(t, received(), 2)
+
+		ds, err := reg.WebhookPersister().ListWebhookDeliveries(context.Background(), sessions.ID, 100, 0)
+		require.NoError(t, err)
+		require.Len(t, ds, 1)
+		assert.Equal(t, StatePending, ds[0].State)
+		assert.Equal(t, 1, ds[0].Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, ds[0].ResponseStatus)
+		assert.Equal(t, "thanks", ds[0].ResponseBody)
+		assert.NotEmpty(t, ds[0].LastError)
+		assert.True(t, ds[0].NextAttemptAt.After(time.Now()))
+
+		require.NoError(t, reg.WebhookDispatcher().Deliver(context.Background()))
+		assert.Len(t, received(), 2, "the delivery is not due yet")
+	})
+
+	t.Run("case=does not deliver to disabled subscriptions", func(t *testing.T) {
+		reg.WebhookDispatcher().Emit(context.Background(), EventIdentityCreated, map[string]string{"kind": "customer"})
+		assert.Equal(t, 1, count(t, customers))
+
+		customers.Enabled = false
+		require.NoError(t, reg.WebhookPersister().UpdateWebhookSubscription(context.Background(), customers))
+
+		require.NoError(t, reg.WebhookDispatcher().Deliver(context.Background()))
+		ds, err := reg.WebhookPersister().ListWebhookDeliveries(context.Background(), customers.ID, 100, 0)
+		require.NoError(t, err)
+		require.Len(t, ds, 1)
+		assert.Equal(t, StatePending, ds[0].State)
+		assert.Contains(t, ds[0].LastError, "disabled")
+	})
+}
@@ -0,0 +1,106 @@
+package x
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/ory/herodot"
+)
+
+// NetworkACLMetricsPath serves the number of denied requests per endpoint group on the admin API.
+const NetworkACLMetricsPath = "/metrics/network-acl"
+
+// NetworkACLErrorID is set as the "error_id" detail of errors caused by a denied client IP address.
+const NetworkACLErrorID = "ip_address_denied"
+
+// NetworkACLDenied counts the requests denied by network ACLs per endpoint group.
+var NetworkACLDenied = expvar.NewMap("kratos_network_acl_denied_total")
+
+// NetworkACL restricts access to an endpoint group by client IP address. Denied networks take
+// precedence over allowed networks. If no allowed networks are set, all addresses which are not
+// denied are allowed.
+type NetworkACL struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+func (a *NetworkACL) IsAllowed(ip net.IP) bool {
+	if ip == nil {
+		return len(a.Allow) == 0 && len(a.Deny) == 0
+	}
+
+	for _, n := range a.Deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(a.Allow) == 0 {
+		return true
+	}
+
+	for _, n := range a.Allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkACLMiddleware enforces a NetworkACL on all requests matched by the given function. The client
+// IP address is determined using ClientIP.
+type NetworkACLMiddleware struct {
+	group   string
+	acl     *NetworkACL
+	matches func(r *http.Request) bool
+	w       herodot.Writer
+	l       logrus.FieldLogger
+}
+
+func NewNetworkACLMiddleware(group string, acl *NetworkACL, matches func(r *http.Request) bool, w herodot.Writer, l logrus.FieldLogger) *NetworkACLMiddleware {
+	return &NetworkACLMiddleware{group: group, acl: acl, matches: matches, w: w, l: l}
+}
+
+func (m *NetworkACLMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !m.matches(r) {
+		next(w, r)
+		return
+	}
+
+	if err := m.acl.Check(m.group, r, m.l); err != nil {
+		m.w.WriteError(w, r, err)
+		return
+	}
+
+	next(w, r)
+}
+
+// Check returns a forbidden error if the client IP address of the request is not allowed. Denied requests are
+// logged and counted for the endpoint group.
+func (a *NetworkACL) Check(group string, r *http.Request, l logrus.FieldLogger) error {
+	ip := ClientIP(r)
+	if a.IsAllowed(ip) {
+		return nil
+	}
+
+	NetworkACLDenied.Add(group, 1)
+	l.
+		WithField("acl_group", group).
+		WithField("client_ip", ip.String()).
+		WithField("path", r.URL.Path).
+		Warn("Denied request because the client IP address is not allowed.")
+	return errors.WithStack(herodot.ErrForbidden.
+		WithReason("Access from your network is not allowed.").
+		WithDetail("error_id", NetworkACLErrorID))
+}
+
+// ServeNetworkACLMetrics writes the number of denied requests per endpoint group as JSON.
+func ServeNetworkACLMetrics(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(NetworkACLDenied.String()))
+}
@@ -0,0 +1,94 @@
+package x
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+)
+
+func mustCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return n
+}
+
+func TestNetworkACL(t *testing.T) {
+	for k, tc := range []struct {
+		acl    NetworkACL
+		ip     string
+		expect bool
+	}{
+		{acl: NetworkACL{}, ip: "1.2.3.4", expect: true},
+		{acl: NetworkACL{Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")}}, ip: "10.1.2.3", expect: true},
+		{acl: NetworkACL{Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")}}, ip: "1.2.3.4", expect: false},
+		{acl: NetworkACL{Deny: []*net.IPNet{mustCIDR(t, "1.2.3.0/24")}}, ip: "1.2.3.4", expect: false},
+		{acl: NetworkACL{Deny: []*net.IPNet{mustCIDR(t, "1.2.3.0/24")}}, ip: "1.2.4.4", expect: true},
+		{acl: NetworkACL{Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")}, Deny: []*net.IPNet{mustCIDR(t, "10.0.0.1/32")}}, ip: "10.0.0.1", expect: false},
+	} {
+		assert.Equal(t, tc.expect, tc.acl.IsAllowed(net.ParseIP(tc.ip)), "%d", k)
+	}
+
+	assert.True(t, new(NetworkACL).IsAllowed(nil))
+	assert.False(t, (&NetworkACL{Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")}}).IsAllowed(nil))
+}
+
+func TestNetworkACLMiddleware(t *testing.T) {
+	m := NewNetworkACLMiddleware("test-group", &NetworkACL{Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")}}, func(r *http.Request) bool {
+		return r.URL.Path == "/restricted"
+	}, herodot.NewJSONWriter(logrus.New()), logrus.New())
+	proxies := NewForwardedHeaders([]*net.IPNet{mustCIDR(t, "192.168.0.0/16")}, "")
+
+	serve := func(path, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "http://kratos"+path, nil)
+		r.RemoteAddr = remoteAddr
+		if len(forwardedFor) > 0 {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		rec := httptest.NewRecorder()
+		proxies.ServeHTTP(rec, r, func(w http.ResponseWriter, r *http.Request) {
+			m.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+		})
+		return rec
+	}
+
+	before := NetworkACLDenied.Get("test-group")
+
+	assert.Equal(t, http.StatusNoContent, serve("/unrestricted", "1.2.3.4:1234", "").Code)
+	assert.Equal(t, http.StatusNoContent, serve("/restricted", "10.0.0.1:1234", "").Code)
+
+	rec := serve("/restricted", "1.2.3.4:1234", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, NetworkACLErrorID, gjson.Get(rec.Body.String(), "error.details.error_id").String(), "%s", rec.Body.String())
+
+	t.Run("case=uses the client address reported by trusted proxies", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve("/restricted", "192.168.0.1:1234", "1.2.3.4, 10.0.0.1, 192.168.0.2").Code)
+		assert.Equal(t, http.StatusForbidden, serve("/restricted", "192.168.0.1:1234", "10.0.0.1, 1.2.3.4").Code)
+	})
+
+	t.Run("case=ignores the header of untrusted clients", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve("/restricted", "1.2.3.4:1234", "10.0.0.1").Code)
+	})
+
+	t.Run("case=counts denied requests", func(t *testing.T) {
+		var prev int64
+		if before != nil {
+			prev = before.(interface{ Value() int64 }).Value()
+		}
+		assert.EqualValues(t, prev+3, NetworkACLDenied.Get("test-group").(interface{ Value() int64 }).Value())
+
+		rec := httptest.NewRecorder()
+		ServeNetworkACLMetrics(rec, nil, nil)
+		assert.True(t, gjson.Get(rec.Body.String(), "test-group").Exists(), "%s", rec.Body.String())
+	})
+}
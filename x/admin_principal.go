@@ -0,0 +1,18 @@
+package x
+
+import "context"
+
+type adminPrincipalContextKey struct{}
+
+// WithAdminPrincipal returns a context which carries the authenticated caller of the admin API, for example
+// "api_key:provisioner".
+func WithAdminPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, adminPrincipalContextKey{}, principal)
+}
+
+// AdminPrincipal returns the authenticated caller of the admin API or an empty string if the request was not
+// authenticated, for example because admin authentication is not configured.
+func AdminPrincipal(ctx context.Context) string {
+	principal, _ := ctx.Value(adminPrincipalContextKey{}).(string)
+	return principal
+}
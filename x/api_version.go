@@ -0,0 +1,174 @@
+package x
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// APIVersion is the version of the shape of API responses. Clients request a version using a vendor media type
+// in the Accept header, for example:
+//
+//	Accept: application/vnd.ory.kratos.v2+json
+//
+// Responses to requests without a vendor media type, for example with Accept: application/json, use
+// APIVersion1, which is the shape all responses had before versions were introduced. Existing UIs therefore
+// keep working while the shape of newer versions evolves.
+type APIVersion int
+
+const (
+	// APIVersion1 is the original shape of all responses.
+	APIVersion1 APIVersion = iota + 1
+
+	// APIVersion2 lists the methods of self-service requests as an array ordered by method instead of an object
+	// keyed by method, so that UIs render them in a stable order.
+	APIVersion2
+
+	// LatestAPIVersion is the newest version.
+	LatestAPIVersion = APIVersion2
+)
+
+const (
+	apiMediaTypePrefix = "application/vnd.ory.kratos.v"
+	apiMediaTypeSuffix = "+json"
+)
+
+var ErrNotAcceptable = herodot.DefaultError{
+	CodeField:   http.StatusNotAcceptable,
+	StatusField: http.StatusText(http.StatusNotAcceptable),
+	ErrorField:  "The requested API version is not supported.",
+}
+
+// VersionedResponse is implemented by responses whose shape differs between API versions. ForAPIVersion returns
+// the value which is encoded as the response of the given version.
+type VersionedResponse interface {
+	ForAPIVersion(v APIVersion) interface{}
+}
+
+// MediaType returns the vendor media type of the version, for example application/vnd.ory.kratos.v1+json.
+func (v APIVersion) MediaType() string {
+	return fmt.Sprintf("%s%d%s", apiMediaTypePrefix, v, apiMediaTypeSuffix)
+}
+
+// NegotiateAPIVersion returns the version requested by the Accept header and whether a version was requested at
+// all. If several versions are acceptable, the one with the highest quality wins, and the newer one on ties.
+// ErrNotAcceptable is returned if the header accepts vendor media types only, but none of a known version.
+func NegotiateAPIVersion(r *http.Request) (APIVersion, bool, error) {
+	var (
+		version      APIVersion
+		quality      float64
+		acceptsOther bool
+		unknown      bool
+	)
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if len(strings.TrimSpace(accepted)) == 0 {
+			continue
+		}
+
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		if !strings.HasPrefix(mediaType, apiMediaTypePrefix) || !strings.HasSuffix(mediaType, apiMediaTypeSuffix) {
+			acceptsOther = true
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(mediaType, apiMediaTypePrefix), apiMediaTypeSuffix))
+		if err != nil || n < int(APIVersion1) || n > int(LatestAPIVersion) {
+			unknown = true
+			continue
+		}
+
+		if v := APIVersion(n); q > quality || (q == quality && v > version) {
+			version, quality = v, q
+		}
+	}
+
+	if version > 0 {
+		return version, true, nil
+	}
+	if unknown && !acceptsOther {
+		return 0, false, errors.WithStack(ErrNotAcceptable.WithReasonf(
+			"Request one of the media types %s to %s, or application/json.", APIVersion1.MediaType(), LatestAPIVersion.MediaType()))
+	}
+	return APIVersion1, false, nil
+}
+
+// VersionedWriter encodes responses which implement VersionedResponse in the API version negotiated from the
+// Accept header, see NegotiateAPIVersion. If a version was requested, the response has the vendor media type of
+// the version. Errors are written as they are.
+type VersionedWriter struct {
+	herodot.Writer
+}
+
+func NewVersionedWriter(w herodot.Writer) *VersionedWriter {
+	return &VersionedWriter{Writer: w}
+}
+
+func (w *VersionedWriter) Write(rw http.ResponseWriter, r *http.Request, e interface{}) {
+	w.WriteCode(rw, r, http.StatusOK, e)
+}
+
+func (w *VersionedWriter) WriteCreated(rw http.ResponseWriter, r *http.Request, location string, e interface{}) {
+	rw.Header().Set("Location", location)
+	w.WriteCode(rw, r, http.StatusCreated, e)
+}
+
+func (w *VersionedWriter) WriteCode(rw http.ResponseWriter, r *http.Request, code int, e interface{}) {
+	v, requested, err := NegotiateAPIVersion(r)
+	if err != nil {
+		w.Writer.WriteError(rw, r, err)
+		return
+	}
+
+	if vr, ok := e.(VersionedResponse); ok {
+		e = vr.ForAPIVersion(v)
+	}
+
+	rw.Header().Add("Vary", "Accept")
+	if requested {
+		rw = &mediaTypeWriter{ResponseWriter: rw, mediaType: v.MediaType()}
+	}
+	w.Writer.WriteCode(rw, r, code, e)
+}
+
+// mediaTypeWriter replaces the Content-Type set by the herodot.Writer before the header is written.
+type mediaTypeWriter struct {
+	http.ResponseWriter
+	mediaType   string
+	wroteHeader bool
+}
+
+func (w *mediaTypeWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Content-Type", w.mediaType)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *mediaTypeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,84 @@
+package x
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/logrusx"
+)
+
+type versionedPayload struct {
+	Version APIVersion `json:"version"`
+}
+
+func (p *versionedPayload) ForAPIVersion(v APIVersion) interface{} {
+	return &versionedPayload{Version: v}
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	for k, tc := range []struct {
+		accept        string
+		expect        APIVersion
+		expectRequest bool
+		expectErr     bool
+	}{
+		{accept: "", expect: APIVersion1},
+		{accept: "application/json", expect: APIVersion1},
+		{accept: "*/*", expect: APIVersion1},
+		{accept: "application/vnd.ory.kratos.v1+json", expect: APIVersion1, expectRequest: true},
+		{accept: "application/vnd.ory.kratos.v2+json", expect: APIVersion2, expectRequest: true},
+		{accept: "application/json, application/vnd.ory.kratos.v2+json", expect: APIVersion2, expectRequest: true},
+		{accept: "application/vnd.ory.kratos.v1+json, application/vnd.ory.kratos.v2+json", expect: APIVersion2, expectRequest: true},
+		{accept: "application/vnd.ory.kratos.v1+json, application/vnd.ory.kratos.v2+json;q=0.5", expect: APIVersion1, expectRequest: true},
+		{accept: "application/vnd.ory.kratos.v2+json;q=0, application/json", expect: APIVersion1},
+		{accept: "application/vnd.ory.kratos.v99+json, application/json", expect: APIVersion1},
+		{accept: "application/vnd.ory.kratos.v99+json", expectErr: true},
+		{accept: "application/vnd.ory.kratos.vfoo+json", expectErr: true},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tc.accept)
+
+		v, requested, err := NegotiateAPIVersion(r)
+		if tc.expectErr {
+			require.Error(t, err, "%d", k)
+			continue
+		}
+		require.NoError(t, err, "%d", k)
+		assert.Equal(t, tc.expect, v, "%d", k)
+		assert.Equal(t, tc.expectRequest, requested, "%d", k)
+	}
+}
+
+func TestVersionedWriter(t *testing.T) {
+	w := NewVersionedWriter(herodot.NewJSONWriter(logrusx.New()))
+
+	for k, tc := range []struct {
+		accept            string
+		expectCode        int
+		expectContentType string
+		expectBody        string
+	}{
+		{accept: "application/json", expectCode: http.StatusOK, expectContentType: "application/json", expectBody: `{"version":1}`},
+		{accept: APIVersion1.MediaType(), expectCode: http.StatusOK, expectContentType: APIVersion1.MediaType(), expectBody: `{"version":1}`},
+		{accept: APIVersion2.MediaType(), expectCode: http.StatusOK, expectContentType: APIVersion2.MediaType(), expectBody: `{"version":2}`},
+		{accept: "application/vnd.ory.kratos.v99+json", expectCode: http.StatusNotAcceptable, expectContentType: "application/json"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tc.accept)
+		rec := httptest.NewRecorder()
+
+		w.Write(rec, r, new(versionedPayload))
+
+		assert.Equal(t, tc.expectCode, rec.Code, "%d: %s", k, rec.Body.String())
+		assert.Contains(t, rec.Header().Get("Content-Type"), tc.expectContentType, "%d", k)
+		if len(tc.expectBody) > 0 {
+			assert.JSONEq(t, tc.expectBody, rec.Body.String(), "%d", k)
+			assert.Equal(t, "Accept", rec.Header().Get("Vary"), "%d", k)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package x
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/gofrs/uuid"
+)
+
+// HashCode returns the HMAC of a short code, for example one which was emailed or texted, which is bound to the ID
+// it was sent with. A six digit code could be recovered from a plain hash in no time, which is why only keyed
+// hashes of codes are stored.
+func HashCode(key []byte, id uuid.UUID, code string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(id.String() + "\n" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,117 @@
+package x
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/randx"
+)
+
+// FlowBindingCookieName is the name of the cookie which identifies the browser that initiated a self-service flow.
+const FlowBindingCookieName = "ory_kratos_flow_binding"
+
+// FlowBindingErrorID is set as the "error_id" detail of errors caused by a flow which was initiated by another
+// browser.
+const FlowBindingErrorID = "self_service_flow_binding_invalid"
+
+// NewErrFlowBindingInvalid returns the error of a flow which was initiated by another browser. Every call returns
+// a new error because error handlers add details, for example the flow to redirect to.
+func NewErrFlowBindingInvalid() *herodot.DefaultError {
+	return &herodot.DefaultError{
+		CodeField:   http.StatusForbidden,
+		StatusField: http.StatusText(http.StatusForbidden),
+		ErrorField:  "This flow was started in another browser, please start again.",
+		DetailsField: map[string]interface{}{
+			"error_id": FlowBindingErrorID,
+		},
+	}
+}
+
+type FlowBinderProvider interface {
+	FlowBinder() *FlowBinder
+}
+
+// FlowBinder binds self-service flows to the browser which initiated them, so that an attacker can not initiate a
+// flow and trick a victim into completing it. Each browser gets a random nonce cookie, and the ID of every flow it
+// initiates is signed together with that nonce. The signature is stored with the flow and checked when the flow
+// is submitted.
+type FlowBinder struct {
+	keys   func() [][]byte
+	cookie http.Cookie
+}
+
+// NewFlowBinder returns a FlowBinder which signs using the first of the keys and verifies using all of them, so
+// that keys can be rotated.
+func NewFlowBinder(keys func() [][]byte, path, domain string, secure bool, sameSite http.SameSite) *FlowBinder {
+	return &FlowBinder{
+		keys: keys,
+		cookie: http.Cookie{
+			Name:     FlowBindingCookieName,
+			Path:     path,
+			Domain:   domain,
+			Secure:   secure,
+			SameSite: sameSite,
+			HttpOnly: true,
+		},
+	}
+}
+
+// Bind returns the signature which binds the flow to the browser that sent the request. It sets the nonce cookie
+// if the browser has none yet.
+func (b *FlowBinder) Bind(w http.ResponseWriter, r *http.Request, id uuid.UUID) (string, error) {
+	nonce := b.nonce(r)
+	if len(nonce) == 0 {
+		n, err := randx.RuneSequence(32, randx.AlphaNum)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		nonce = string(n)
+		cookie := b.cookie
+		cookie.Value = nonce
+		http.SetCookie(w, &cookie)
+
+		// Flows initiated later while handling the same request, for example after the previous one expired,
+		// must use the same nonce.
+		r.AddCookie(&http.Cookie{Name: FlowBindingCookieName, Value: nonce})
+	}
+
+	return flowSignature(b.keys()[0], id, nonce), nil
+}
+
+// Verify returns NewErrFlowBindingInvalid unless the request was sent by the browser the flow is bound to. Flows
+// without a binding, such as flows initiated before binding was introduced, are not checked.
+func (b *FlowBinder) Verify(r *http.Request, id uuid.UUID, binding string) error {
+	if len(binding) == 0 {
+		return nil
+	}
+
+	if nonce := b.nonce(r); len(nonce) > 0 {
+		for _, key := range b.keys() {
+			if hmac.Equal([]byte(flowSignature(key, id, nonce)), []byte(binding)) {
+				return nil
+			}
+		}
+	}
+	return errors.WithStack(NewErrFlowBindingInvalid())
+}
+
+func (b *FlowBinder) nonce(r *http.Request) string {
+	cookie, err := r.Cookie(FlowBindingCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func flowSignature(key []byte, id uuid.UUID, nonce string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(id.String() + "\n" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,88 @@
+package x
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowBinder(t *testing.T) {
+	keys := [][]byte{[]byte("current-secret-current-secret")}
+	b := NewFlowBinder(func() [][]byte { return keys }, "/", "", true, http.SameSiteLaxMode)
+	id := NewUUID()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	binding, err := b.Bind(w, r, id)
+	require.NoError(t, err)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, FlowBindingCookieName, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.True(t, cookies[0].Secure)
+
+	w = httptest.NewRecorder()
+	again, err := b.Bind(w, r, NewUUID())
+	require.NoError(t, err)
+	assert.NotEqual(t, binding, again, "the binding depends on the flow ID")
+	assert.Empty(t, w.Result().Cookies(), "the nonce of the browser is reused")
+
+	browser := func(nonce string) *http.Request {
+		r := httptest.NewRequest("POST", "/", nil)
+		if len(nonce) > 0 {
+			r.AddCookie(&http.Cookie{Name: FlowBindingCookieName, Value: nonce})
+		}
+		return r
+	}
+
+	t.Run("case=passes for the initiating browser", func(t *testing.T) {
+		assert.NoError(t, b.Verify(browser(cookies[0].Value), id, binding))
+	})
+
+	t.Run("case=passes after the key was rotated", func(t *testing.T) {
+		keys = [][]byte{[]byte("new-secret-new-secret-new-secret"), keys[0]}
+		defer func() { keys = keys[1:] }()
+		assert.NoError(t, b.Verify(browser(cookies[0].Value), id, binding))
+	})
+
+	t.Run("case=passes for flows without binding", func(t *testing.T) {
+		assert.NoError(t, b.Verify(browser(""), id, ""))
+	})
+
+	for k, tc := range []struct {
+		d       string
+		nonce   string
+		id      string
+		binding string
+	}{
+		{d: "another browser", nonce: "another-browser"},
+		{d: "a browser without nonce"},
+		{d: "another flow", nonce: cookies[0].Value, id: NewUUID().String()},
+		{d: "a forged binding", nonce: cookies[0].Value, binding: "forged"},
+	} {
+		t.Run("case=fails for "+tc.d, func(t *testing.T) {
+			flow, expected := id, binding
+			if len(tc.id) > 0 {
+				flow = ParseUUID(tc.id)
+			}
+			if len(tc.binding) > 0 {
+				expected = tc.binding
+			}
+
+			err := b.Verify(browser(tc.nonce), flow, expected)
+			require.Error(t, err, "%d", k)
+			assert.Equal(t, NewErrFlowBindingInvalid(), errors.Cause(err), "%d", k)
+		})
+	}
+}
+
+func TestNewErrFlowBindingInvalid(t *testing.T) {
+	err := NewErrFlowBindingInvalid().WithDetail("redirect_to", "https://www.ory.sh/")
+	assert.Equal(t, "https://www.ory.sh/", err.Details()["redirect_to"])
+	assert.NotContains(t, NewErrFlowBindingInvalid().Details(), "redirect_to", "errors do not share their details")
+}
@@ -1,7 +1,13 @@
 package x
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
 
 	"github.com/justinas/nosurf"
 	"github.com/pkg/errors"
@@ -12,9 +18,15 @@ import (
 	"github.com/ory/herodot"
 )
 
+// CSRFErrorID is set as the "error_id" detail of every error caused by a missing or invalid CSRF token. API clients
+// such as single page apps use it to tell CSRF failures apart from other client errors and to start a new flow.
+const CSRFErrorID = "csrf_token_invalid"
+
 var (
-	ErrInvalidCSRFToken = herodot.ErrForbidden.WithReasonf("A request failed due to a missing or invalid csrf_token value.")
-	ErrGone             = herodot.DefaultError{
+	ErrInvalidCSRFToken = herodot.ErrForbidden.
+				WithReasonf("A request failed due to a missing or invalid csrf_token value.").
+				WithDetail("error_id", CSRFErrorID)
+	ErrGone = herodot.DefaultError{
 		CodeField:    http.StatusGone,
 		StatusField:  http.StatusText(http.StatusGone),
 		ReasonField:  "",
@@ -34,6 +46,23 @@ func DefaultCSRFToken(r *http.Request) string {
 	return nosurf.Token(r)
 }
 
+// UnmaskCSRFToken returns the CSRF token without the one-time pad nosurf masks it with. The masked token differs on
+// every request, so only the unmasked token is able to bind values to a browser. Tokens which are not masked, such
+// as the fake tokens used in tests, are returned as is.
+func UnmaskCSRFToken(token string) string {
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil || len(raw) != 2*32 {
+		return token
+	}
+
+	key, masked := raw[:32], raw[32:]
+	unmasked := make([]byte, len(masked))
+	for i := range masked {
+		unmasked[i] = masked[i] ^ key[i]
+	}
+	return base64.StdEncoding.EncodeToString(unmasked)
+}
+
 const FakeCSRFToken = "nosurf"
 
 func FakeCSRFTokenGenerator(r *http.Request) string {
@@ -77,15 +106,10 @@ func NewCSRFHandler(
 	path string,
 	domain string,
 	secure bool,
+	sameSite http.SameSite,
 ) *nosurf.CSRFHandler {
 	n := nosurf.New(router)
-	n.SetBaseCookie(http.Cookie{
-		MaxAge:   nosurf.MaxAge,
-		Path:     path,
-		Domain:   domain,
-		HttpOnly: true,
-		Secure:   secure,
-	})
+	n.SetBaseCookie(csrfCookie(path, domain, secure, sameSite, true))
 	n.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.
 			WithField("expected_token", nosurf.Token(r)).
@@ -93,11 +117,166 @@ func NewCSRFHandler(
 			WithField("received_token_form", r.PostForm.Get("csrf_token")).
 			Warn("A request failed due to a missing or invalid csrf_token value")
 
-		writer.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("CSRF token is missing or invalid.")))
+		writer.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf("CSRF token is missing or invalid.").
+			WithDetail("error_id", CSRFErrorID)))
 	}))
 	return n
 }
 
+func csrfCookie(path, domain string, secure bool, sameSite http.SameSite, httpOnly bool) http.Cookie {
+	return http.Cookie{
+		MaxAge:   nosurf.MaxAge,
+		Path:     path,
+		Domain:   domain,
+		HttpOnly: httpOnly,
+		Secure:   secure,
+		SameSite: sameSite,
+	}
+}
+
+type csrfContextKey int
+
+const csrfDoubleSubmitVerified csrfContextKey = iota
+
+// OriginCSRFHandler protects single page apps against cross-site request forgery. Requests which change state must
+// come from one of the allowed origins, which browsers prove with the Origin header, or the Referer header if they
+// send no Origin. In addition, they must carry the value of the csrf_token cookie in the X-CSRF-Token header, or
+// the csrf_token form field like with NewCSRFHandler. The cookie is readable by JavaScript for this reason.
+type OriginCSRFHandler struct {
+	*nosurf.CSRFHandler
+
+	writer   herodot.Writer
+	logger   logrus.FieldLogger
+	origins  map[string]bool
+	failures []csrfFailureHandler
+}
+
+type csrfFailureHandler struct {
+	pattern string
+	handle  func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+func NewOriginCSRFHandler(
+	router http.Handler,
+	writer herodot.Writer,
+	logger logrus.FieldLogger,
+	path string,
+	domain string,
+	secure bool,
+	sameSite http.SameSite,
+	origins []string,
+) *OriginCSRFHandler {
+	n := NewCSRFHandler(router, writer, logger, path, domain, secure, sameSite)
+	n.SetBaseCookie(csrfCookie(path, domain, secure, sameSite, false))
+	n.ExemptFunc(func(r *http.Request) bool {
+		verified, _ := r.Context().Value(csrfDoubleSubmitVerified).(bool)
+		return verified
+	})
+
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+	}
+
+	h := &OriginCSRFHandler{CSRFHandler: n, writer: writer, logger: logger, origins: allowed}
+	n.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.fail(w, r, herodot.ErrBadRequest.
+			WithReasonf("CSRF token is missing or invalid.").
+			WithDetail("csrf_check", "token"))
+	}))
+	return h
+}
+
+// HandleFailureGlob makes requests to paths matching the pattern, which fail the CSRF check, be handled by handle
+// instead of writing the error as JSON. Self-service flows use it to show the error in the flow the request
+// belongs to, which redirects browsers back to the flow's UI. The pattern uses the syntax of path.Match.
+func (h *OriginCSRFHandler) HandleFailureGlob(pattern string, handle func(w http.ResponseWriter, r *http.Request, err error)) {
+	h.failures = append(h.failures, csrfFailureHandler{pattern: pattern, handle: handle})
+}
+
+func (h *OriginCSRFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		h.CSRFHandler.ServeHTTP(w, r)
+		return
+	}
+
+	if h.IsExempt(r) {
+		h.CSRFHandler.ServeHTTP(w, r)
+		return
+	}
+
+	if err := h.checkOrigin(r); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	if sent := r.Header.Get(nosurf.HeaderName); len(sent) > 0 {
+		if !h.verifyDoubleSubmit(r, sent) {
+			h.fail(w, r, herodot.ErrBadRequest.
+				WithReasonf("The %s header does not match the %s cookie. Send the current value of the cookie in the header.", nosurf.HeaderName, nosurf.CookieName).
+				WithDetail("csrf_check", "double_submit"))
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), csrfDoubleSubmitVerified, true))
+	}
+
+	// Requests without the header are checked by nosurf, which expects the csrf_token form field.
+	h.CSRFHandler.ServeHTTP(w, r)
+}
+
+func (h *OriginCSRFHandler) checkOrigin(r *http.Request) *herodot.DefaultError {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 || origin == "null" {
+		if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && len(referer.Host) > 0 {
+			origin = referer.Scheme + "://" + referer.Host
+		}
+	}
+
+	if len(origin) == 0 || origin == "null" {
+		return herodot.ErrBadRequest.
+			WithReason("The request has neither an Origin nor a Referer header, which are required to protect against cross-site request forgery.").
+			WithDetail("csrf_check", "origin")
+	}
+
+	if !h.origins[strings.ToLower(origin)] {
+		return herodot.ErrBadRequest.
+			WithReasonf("Requests from origin %s are not allowed. Add it to security.csrf.allowed_origins if it hosts your UI.", origin).
+			WithDetail("csrf_check", "origin")
+	}
+	return nil
+}
+
+func (h *OriginCSRFHandler) verifyDoubleSubmit(r *http.Request, sent string) bool {
+	cookie, err := r.Cookie(nosurf.CookieName)
+	if err != nil {
+		return false
+	}
+
+	if raw, err := base64.StdEncoding.DecodeString(cookie.Value); err != nil || len(raw) != 32 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(UnmaskCSRFToken(sent))) == 1
+}
+
+func (h *OriginCSRFHandler) fail(w http.ResponseWriter, r *http.Request, err *herodot.DefaultError) {
+	h.logger.
+		WithField("origin", r.Header.Get("Origin")).
+		WithField("referer", r.Header.Get("Referer")).
+		WithField("path", r.URL.Path).
+		Warn("A request failed the CSRF check of the origin mode")
+
+	e := errors.WithStack(err.WithDetail("error_id", CSRFErrorID))
+	for _, f := range h.failures {
+		if matched, _ := path.Match(f.pattern, r.URL.Path); matched {
+			f.handle(w, r, e)
+			return
+		}
+	}
+	h.writer.WriteError(w, r, e)
+}
+
 func NewTestCSRFHandler(router http.Handler, reg interface {
 	WithCSRFHandler(CSRFHandler)
 	WithCSRFTokenGenerator(CSRFToken)
@@ -0,0 +1,146 @@
+package x
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/justinas/nosurf"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+)
+
+func TestUnmaskCSRFToken(t *testing.T) {
+	ts := httptest.NewServer(nosurf.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(nosurf.Token(r)))
+	})))
+	defer ts.Close()
+
+	cj, err := cookiejar.New(&cookiejar.Options{})
+	require.NoError(t, err)
+	c := http.Client{Jar: cj}
+
+	token := func(t *testing.T) string {
+		res, err := c.Get(ts.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	first, second := token(t), token(t)
+	assert.NotEqual(t, first, second, "nosurf masks the token differently on every request")
+	assert.Equal(t, UnmaskCSRFToken(first), UnmaskCSRFToken(second))
+	assert.True(t, nosurf.VerifyToken(UnmaskCSRFToken(first), second))
+
+	assert.Equal(t, FakeCSRFToken, UnmaskCSRFToken(FakeCSRFToken))
+}
+
+func TestOriginCSRFHandler(t *testing.T) {
+	l := logrus.New()
+	h := NewOriginCSRFHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(nosurf.Token(r)))
+	}), herodot.NewJSONWriter(l), l, "/", "", false, http.SameSiteLaxMode, []string{"https://app.ory.sh"})
+	h.ExemptPath("/exempt")
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	masked, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Len(t, res.Cookies(), 1)
+	cookie := res.Cookies()[0]
+	assert.False(t, cookie.HttpOnly, "single page apps must be able to read the cookie")
+
+	for k, tc := range []struct {
+		path, origin, referer, header, form string
+		expectCheck                         string
+	}{
+		{origin: "https://app.ory.sh", header: cookie.Value},
+		{origin: "https://app.ory.sh", header: string(masked)},
+		{referer: "https://app.ory.sh/login?request=1", header: cookie.Value},
+		{origin: "https://app.ory.sh", form: string(masked)},
+		{origin: "https://evil.ory.sh", header: cookie.Value, expectCheck: "origin"},
+		{origin: "null", header: cookie.Value, expectCheck: "origin"},
+		{header: cookie.Value, expectCheck: "origin"},
+		{origin: "https://app.ory.sh", header: "not-the-cookie", expectCheck: "double_submit"},
+		{origin: "https://app.ory.sh", expectCheck: "token"},
+		{path: "/exempt", origin: "https://evil.ory.sh"},
+	} {
+		req, err := http.NewRequest("POST", ts.URL+tc.path, strings.NewReader(url.Values{"csrf_token": {tc.form}}.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		for name, value := range map[string]string{"Origin": tc.origin, "Referer": tc.referer, "X-CSRF-Token": tc.header} {
+			if len(value) > 0 {
+				req.Header.Set(name, value)
+			}
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		if len(tc.expectCheck) == 0 {
+			assert.Equal(t, http.StatusOK, res.StatusCode, "%d: %s", k, body)
+			continue
+		}
+
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "%d: %s", k, body)
+		assert.Equal(t, CSRFErrorID, gjson.GetBytes(body, "error.details.error_id").String(), "%d: %s", k, body)
+		assert.Equal(t, tc.expectCheck, gjson.GetBytes(body, "error.details.csrf_check").String(), "%d: %s", k, body)
+	}
+
+	t.Run("case=failures are handled by the flow", func(t *testing.T) {
+		var handled error
+		h.HandleFailureGlob("/flows/*", func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			http.Redirect(w, r, "https://app.ory.sh/flow", http.StatusFound)
+		})
+
+		for _, tc := range []struct {
+			path, origin string
+			expectCheck  string
+		}{
+			{path: "/flows/login", origin: "https://evil.ory.sh", expectCheck: "origin"},
+			{path: "/flows/login", origin: "https://app.ory.sh", expectCheck: "token"},
+		} {
+			handled = nil
+			req, err := http.NewRequest("POST", ts.URL+tc.path, strings.NewReader(""))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Origin", tc.origin)
+			req.AddCookie(cookie)
+
+			res, err := (&http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}).Do(req)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+
+			assert.Equal(t, http.StatusFound, res.StatusCode)
+			assert.Equal(t, "https://app.ory.sh/flow", res.Header.Get("Location"))
+			require.Error(t, handled)
+			assert.Equal(t, tc.expectCheck, errors.Cause(handled).(*herodot.DefaultError).Details()["csrf_check"])
+		}
+
+		res, err := http.Post(ts.URL+"/other", "application/x-www-form-urlencoded", strings.NewReader(""))
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "other paths still receive the JSON error")
+	})
+}
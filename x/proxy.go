@@ -0,0 +1,131 @@
+package x
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ory/x/urlx"
+)
+
+type (
+	forwardedPrefixContextKey struct{}
+	clientIPContextKey        struct{}
+)
+
+// ForwardedHeaders is a middleware which rewrites the request according to the X-Forwarded-For,
+// X-Forwarded-Proto, X-Forwarded-Host, and X-Forwarded-Prefix headers if the request was sent by a
+// trusted proxy. It also strips the base path from requests which reach ORY Kratos with the path
+// prefix still in place.
+//
+// Use RequestURL to get the URL the client originally requested and ClientIP to get its address.
+type ForwardedHeaders struct {
+	trusted  []*net.IPNet
+	basePath string
+}
+
+func NewForwardedHeaders(trusted []*net.IPNet, basePath string) *ForwardedHeaders {
+	return &ForwardedHeaders{trusted: trusted, basePath: strings.TrimRight(basePath, "/")}
+}
+
+func (f *ForwardedHeaders) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	var prefix string
+	if f.isTrusted(remoteIP(r)) {
+		if ip := f.forwardedFor(r); ip != nil {
+			r = r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip))
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+		if host := r.Header.Get("X-Forwarded-Host"); len(host) > 0 {
+			r.Host = host
+		}
+		prefix = strings.TrimRight(r.Header.Get("X-Forwarded-Prefix"), "/")
+	}
+
+	if len(f.basePath) > 0 && strings.HasPrefix(r.URL.Path, f.basePath+"/") {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, f.basePath)
+		r.URL.RawPath = ""
+		if len(prefix) == 0 {
+			prefix = f.basePath
+		}
+	}
+
+	if len(prefix) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), forwardedPrefixContextKey{}, prefix))
+	}
+
+	next(w, r)
+}
+
+// forwardedFor returns the right-most address in X-Forwarded-For which does not belong to a trusted proxy.
+func (f *ForwardedHeaders) forwardedFor(r *http.Request) net.IP {
+	var hops []string
+	for _, h := range r.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+
+	var ip net.IP
+	for k := len(hops) - 1; k >= 0; k-- {
+		ip = net.ParseIP(strings.TrimSpace(hops[k]))
+		if ip == nil {
+			return nil
+		}
+		if !f.isTrusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+func (f *ForwardedHeaders) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range f.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ClientIP returns the address of the client which made the request, as reported by trusted proxies.
+func ClientIP(r *http.Request) net.IP {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(net.IP); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// RequestURL returns the URL the client used to make the request, including the scheme, host, and path
+// prefix set by trusted proxies.
+func RequestURL(r *http.Request) *url.URL {
+	source := urlx.Copy(r.URL)
+	source.Host = r.Host
+
+	if len(source.Scheme) == 0 {
+		source.Scheme = "http"
+		if r.TLS != nil {
+			source.Scheme = "https"
+		}
+	}
+
+	if prefix, ok := r.Context().Value(forwardedPrefixContextKey{}).(string); ok {
+		source.Path = prefix + source.Path
+		source.RawPath = ""
+	}
+
+	return source
+}
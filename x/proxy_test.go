@@ -0,0 +1,83 @@
+package x
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	for k, tc := range []struct {
+		d          string
+		remoteAddr string
+		basePath   string
+		path       string
+		headers    map[string]string
+		expectURL  string
+		expectPath string
+	}{
+		{
+			d:          "ignores headers without trusted proxies",
+			remoteAddr: "192.168.0.1:1234",
+			path:       "/self-service/browser/flows/login",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.org", "X-Forwarded-Prefix": "/evil"},
+			expectURL:  "http://kratos.internal/self-service/browser/flows/login",
+			expectPath: "/self-service/browser/flows/login",
+		},
+		{
+			d:          "honors headers of trusted proxies",
+			remoteAddr: "10.1.2.3:1234",
+			path:       "/self-service/browser/flows/login",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "www.example.org", "X-Forwarded-Prefix": "/.ory/kratos/"},
+			expectURL:  "https://www.example.org/.ory/kratos/self-service/browser/flows/login",
+			expectPath: "/self-service/browser/flows/login",
+		},
+		{
+			d:          "ignores unknown protocols",
+			remoteAddr: "10.1.2.3:1234",
+			path:       "/self-service/browser/flows/login",
+			headers:    map[string]string{"X-Forwarded-Proto": "gopher"},
+			expectURL:  "http://kratos.internal/self-service/browser/flows/login",
+			expectPath: "/self-service/browser/flows/login",
+		},
+		{
+			d:          "strips the base path",
+			remoteAddr: "192.168.0.1:1234",
+			basePath:   "/.ory/kratos/",
+			path:       "/.ory/kratos/self-service/browser/flows/login",
+			expectURL:  "http://kratos.internal/.ory/kratos/self-service/browser/flows/login",
+			expectPath: "/self-service/browser/flows/login",
+		},
+		{
+			d:          "leaves paths without the base path untouched",
+			remoteAddr: "192.168.0.1:1234",
+			basePath:   "/.ory/kratos",
+			path:       "/self-service/browser/flows/login",
+			expectURL:  "http://kratos.internal/self-service/browser/flows/login",
+			expectPath: "/self-service/browser/flows/login",
+		},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://kratos.internal"+tc.path+"?request=1234", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+
+			var called bool
+			NewForwardedHeaders([]*net.IPNet{trusted}, tc.basePath).ServeHTTP(httptest.NewRecorder(), r, func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				assert.Equal(t, tc.expectPath, r.URL.Path, "%d", k)
+				assert.Equal(t, tc.expectURL+"?request=1234", RequestURL(r).String(), "%d", k)
+			})
+			assert.True(t, called)
+		})
+	}
+}
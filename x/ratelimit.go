@@ -0,0 +1,85 @@
+package x
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ory/herodot"
+)
+
+// RateLimitErrorID is set as the "error_id" detail of errors caused by a client exceeding a rate limit.
+const RateLimitErrorID = "rate_limit_exceeded"
+
+var ErrTooManyRequests = herodot.DefaultError{
+	CodeField:   http.StatusTooManyRequests,
+	StatusField: http.StatusText(http.StatusTooManyRequests),
+	ErrorField:  "Too many requests were made, please try again later.",
+	DetailsField: map[string]interface{}{
+		"error_id": RateLimitErrorID,
+	},
+}
+
+// RateLimiter allows a fixed number of events per key (e.g. a client IP address) within a window of time.
+type RateLimiter struct {
+	sync.Mutex
+
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	windows   map[string]*rateLimitWindow
+	lastSweep time.Time
+}
+
+type rateLimitWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter returns a RateLimiter which allows limit events per key within window. A limit below one
+// disables rate limiting.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		windows: map[string]*rateLimitWindow{},
+	}
+}
+
+// Allow records an event for the key and returns false if the key has exceeded the limit of its window.
+func (l *RateLimiter) Allow(key string) bool {
+	if l.limit < 1 {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateLimitWindow{start: now}
+		l.windows[key] = w
+	}
+
+	w.count++
+	return w.count <= l.limit
+}
+
+// sweep removes expired windows so that the memory used does not grow with the number of keys ever seen.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,30 @@
+package x
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.Allow("a"))
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"), "keys must be limited independently")
+
+	now = now.Add(time.Minute)
+	assert.True(t, l.Allow("a"), "the limit must be reset after the window passed")
+	assert.Len(t, l.windows, 1, "expired windows must be removed")
+
+	t.Run("case=disabled", func(t *testing.T) {
+		l := NewRateLimiter(0, time.Minute)
+		for i := 0; i < 10; i++ {
+			assert.True(t, l.Allow("a"))
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package x
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces values which were removed from the log output.
+const Redacted = "[REDACTED]"
+
+var (
+	// DefaultRedactedFields are always redacted by the LogRedactor, see NewLogRedactor.
+	DefaultRedactedFields = []string{"email", "phone", "traits", "token", "identifier", "password", "secret", "recipient", "address"}
+
+	// DefaultRedactedPatterns match email addresses, phone numbers in international format, and JSON Web Tokens.
+	// They are always applied by the LogRedactor, see NewLogRedactor.
+	DefaultRedactedPatterns = []string{
+		`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`,
+		`\+[1-9][0-9 ()-]{6,}[0-9]`,
+		`eyJ[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]*`,
+	}
+
+	// strictAllowedFields are the fields which are logged in strict mode. They are set by ORY Kratos itself and
+	// never contain personal data.
+	strictAllowedFields = map[string]bool{
+		logrus.ErrorKey:   true,
+		"request_id":      true,
+		"method":          true,
+		"status":          true,
+		"text_status":     true,
+		"took":            true,
+		"threshold":       true,
+		"operation":       true,
+		"job":             true,
+		"holder":          true,
+		"message_id":      true,
+		"message_type":    true,
+		"service_name":    true,
+		"service_version": true,
+		"audience":        true,
+	}
+)
+
+// LogRedactor is a logrus hook which removes personal data and secrets from log entries before they are
+// written. It replaces the values of fields whose name contains one of the redacted field names, and matches of
+// the redacted patterns in the message and in string and error values. In strict mode, it replaces the values of
+// all fields except a few which ORY Kratos sets itself.
+//
+// Patterns are applied to error values, too, so that identifiers do not leak through errors returned by the
+// persister or the strategies.
+type LogRedactor struct {
+	fields   []string
+	patterns []*regexp.Regexp
+	strict   bool
+}
+
+var _ logrus.Hook = new(LogRedactor)
+
+// NewLogRedactor returns a LogRedactor which redacts the given fields and patterns in addition to
+// DefaultRedactedFields and DefaultRedactedPatterns. Field names are matched case-insensitively.
+func NewLogRedactor(fields, patterns []string, strict bool) (*LogRedactor, error) {
+	r := &LogRedactor{strict: strict}
+	for _, f := range append(append([]string{}, DefaultRedactedFields...), fields...) {
+		if f = strings.ToLower(strings.TrimSpace(f)); len(f) > 0 {
+			r.fields = append(r.fields, f)
+		}
+	}
+
+	for _, p := range append(append([]string{}, DefaultRedactedPatterns...), patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to compile log redaction pattern %q", p)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// RedactLogs adds the LogRedactor to the logger. Loggers other than *logrus.Logger and *logrus.Entry are left
+// unchanged.
+func RedactLogs(l logrus.FieldLogger, r *LogRedactor) {
+	switch ll := l.(type) {
+	case *logrus.Logger:
+		ll.AddHook(r)
+	case *logrus.Entry:
+		ll.Logger.AddHook(r)
+	}
+}
+
+func (r *LogRedactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (r *LogRedactor) Fire(e *logrus.Entry) error {
+	e.Message = r.Scrub(e.Message)
+
+	// The fields may be shared with other entries, so they are replaced instead of modified.
+	data := make(logrus.Fields, len(e.Data))
+	for key, value := range e.Data {
+		data[key] = r.redact(key, value)
+	}
+	e.Data = data
+	return nil
+}
+
+func (r *LogRedactor) redact(key string, value interface{}) interface{} {
+	if r.strict && !strictAllowedFields[key] {
+		return Redacted
+	}
+
+	lower := strings.ToLower(key)
+	for _, f := range r.fields {
+		if strings.Contains(lower, f) {
+			return Redacted
+		}
+	}
+
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		return value
+	}
+
+	// Values without personal data are kept as they are, for example errors with stack traces.
+	if scrubbed := r.Scrub(s); scrubbed != s {
+		return scrubbed
+	}
+	return value
+}
+
+// Scrub replaces the matches of the redacted patterns in s.
+func (r *LogRedactor) Scrub(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package x
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogRedactor(t *testing.T) {
+	for k, tc := range []struct {
+		d        string
+		fields   []string
+		patterns []string
+		strict   bool
+		log      func(l logrus.FieldLogger)
+		expect   map[string]interface{}
+	}{
+		{
+			d: "redacts fields by name",
+			log: func(l logrus.FieldLogger) {
+				l.WithField("credentials_identifier", "foo").WithField("request_id", "some-id").Info("hello")
+			},
+			expect: map[string]interface{}{"msg": "hello", "credentials_identifier": Redacted, "request_id": "some-id"},
+		},
+		{
+			d:      "redacts configured fields",
+			fields: []string{"Customer_Number"},
+			log: func(l logrus.FieldLogger) {
+				l.WithField("customer_number", 1234).Info("hello")
+			},
+			expect: map[string]interface{}{"msg": "hello", "customer_number": Redacted},
+		},
+		{
+			d: "redacts emails and phone numbers from messages and errors",
+			log: func(l logrus.FieldLogger) {
+				l.WithError(errors.New("identifier foo@example.org exists")).Infof("calling +49 170 1234567")
+			},
+			expect: map[string]interface{}{"msg": "calling " + Redacted, "error": "identifier " + Redacted + " exists"},
+		},
+		{
+			d:        "redacts configured patterns",
+			patterns: []string{`[0-9]{3}-[0-9]{2}-[0-9]{4}`},
+			log: func(l logrus.FieldLogger) {
+				l.WithField("note", "ssn 123-45-6789").Info("hello")
+			},
+			expect: map[string]interface{}{"msg": "hello", "note": "ssn " + Redacted},
+		},
+		{
+			d:      "redacts all fields except known ones in strict mode",
+			strict: true,
+			log: func(l logrus.FieldLogger) {
+				l.WithField("note", "something").WithField("request_id", "some-id").Info("hello")
+			},
+			expect: map[string]interface{}{"msg": "hello", "note": Redacted, "request_id": "some-id"},
+		},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			r, err := NewLogRedactor(tc.fields, tc.patterns, tc.strict)
+			require.NoError(t, err)
+
+			var b bytes.Buffer
+			l := logrus.New()
+			l.Out = &b
+			l.Formatter = new(logrus.JSONFormatter)
+			RedactLogs(l, r)
+
+			tc.log(l)
+
+			var actual map[string]interface{}
+			require.NoError(t, json.Unmarshal(b.Bytes(), &actual), "%d: %s", k, b.String())
+			for key, value := range tc.expect {
+				assert.EqualValues(t, value, actual[key], "%d: %s", k, key)
+			}
+		})
+	}
+
+	t.Run("case=invalid pattern", func(t *testing.T) {
+		_, err := NewLogRedactor(nil, []string{"("}, false)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,60 @@
+package x
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the ID which correlates the logs, errors, and messages caused by a request.
+const RequestIDHeader = "X-Request-Id"
+
+// validRequestID limits the request IDs accepted from clients, so that they can be logged and stored safely.
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+type requestIDContextKey struct{}
+
+// RequestIDMiddleware assigns an ID to every request. It keeps the ID of the X-Request-Id header if the
+// client or a proxy sent one, otherwise it generates a new ID. The ID is returned in the X-Request-Id response
+// header and in the "request" field of error responses, so that users can quote it to support.
+//
+// Use RequestID to get the ID of a request and ContextLogger to log it.
+type RequestIDMiddleware struct{}
+
+func NewRequestIDMiddleware() *RequestIDMiddleware {
+	return &RequestIDMiddleware{}
+}
+
+func (m *RequestIDMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = NewUUID().String()
+	}
+
+	// herodot reads the ID from the request header when it writes error responses.
+	r.Header.Set(RequestIDHeader, id)
+	w.Header().Set(RequestIDHeader, id)
+	next(w, r.WithContext(WithRequestID(r.Context(), id)))
+}
+
+// WithRequestID returns a context which carries the request ID, for example to correlate work done in the
+// background with the request which caused it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the request ID of the context or an empty string if it has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// ContextLogger adds the request ID of the context to the logger.
+func ContextLogger(ctx context.Context, l logrus.FieldLogger) logrus.FieldLogger {
+	if id := RequestID(ctx); len(id) > 0 {
+		return l.WithField("request_id", id)
+	}
+	return l
+}
@@ -0,0 +1,46 @@
+package x
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	for k, tc := range []struct {
+		d        string
+		header   string
+		expectID string
+	}{
+		{d: "keeps the request ID sent by the client", header: "3f1e6c2a-proxy.1", expectID: "3f1e6c2a-proxy.1"},
+		{d: "generates a request ID if none is sent"},
+		{d: "replaces request IDs with unsafe characters", header: "foo\nbar"},
+		{d: "replaces request IDs which are too long", header: strings.Repeat("a", 129)},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if len(tc.header) > 0 {
+				r.Header.Set(RequestIDHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+
+			var inContext, inHeader string
+			NewRequestIDMiddleware().ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+				inContext = RequestID(r.Context())
+				inHeader = r.Header.Get(RequestIDHeader)
+			})
+
+			if len(tc.expectID) > 0 {
+				assert.Equal(t, tc.expectID, inContext, "%d", k)
+			} else {
+				assert.NotEqual(t, tc.header, inContext, "%d", k)
+				assert.False(t, IsZeroUUID(ParseUUID(inContext)), "%d: %s", k, inContext)
+			}
+			assert.Equal(t, inContext, inHeader, "%d", k)
+			assert.Equal(t, inContext, w.Header().Get(RequestIDHeader), "%d", k)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package x
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// Error IDs set as the "error_id" detail of errors caused by a request exceeding the request limits.
+const (
+	RequestBodyTooLargeErrorID = "request_body_too_large"
+	JSONTooDeepErrorID         = "json_too_deep"
+	TooManyFormFieldsErrorID   = "too_many_form_fields"
+)
+
+var ErrRequestEntityTooLarge = herodot.DefaultError{
+	CodeField:   http.StatusRequestEntityTooLarge,
+	StatusField: http.StatusText(http.StatusRequestEntityTooLarge),
+	ErrorField:  "The request body is too large.",
+	DetailsField: map[string]interface{}{
+		"error_id": RequestBodyTooLargeErrorID,
+	},
+}
+
+// RequestLimitsMiddleware rejects request bodies which are too large, JSON bodies which are nested too deeply,
+// and form bodies with too many fields, before they reach the decoders and the database. Limits below one are
+// disabled.
+//
+// The body is read into memory, which the size limit bounds, and handed to the next handler unchanged. Bodies
+// which can not be parsed are left to the next handler, which returns the usual decoding error.
+type RequestLimitsMiddleware struct {
+	maxBodySize   int64
+	maxJSONDepth  int
+	maxFormFields int
+	w             herodot.Writer
+}
+
+func NewRequestLimitsMiddleware(maxBodySize int64, maxJSONDepth, maxFormFields int, w herodot.Writer) *RequestLimitsMiddleware {
+	return &RequestLimitsMiddleware{maxBodySize: maxBodySize, maxJSONDepth: maxJSONDepth, maxFormFields: maxFormFields, w: w}
+}
+
+func (m *RequestLimitsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.Body == nil || r.Body == http.NoBody {
+		next(w, r)
+		return
+	}
+
+	if m.maxBodySize > 0 && r.ContentLength > m.maxBodySize {
+		m.w.WriteError(w, r, errors.WithStack(&ErrRequestEntityTooLarge))
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if m.maxBodySize > 0 {
+		body = io.LimitReader(r.Body, m.maxBodySize+1)
+	}
+
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		m.w.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to read the request body: %s", err)))
+		return
+	}
+	_ = r.Body.Close()
+
+	if m.maxBodySize > 0 && int64(len(raw)) > m.maxBodySize {
+		m.w.WriteError(w, r, errors.WithStack(&ErrRequestEntityTooLarge))
+		return
+	}
+
+	if err := m.check(r.Header.Get("Content-Type"), raw); err != nil {
+		m.w.WriteError(w, r, err)
+		return
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	next(w, r)
+}
+
+func (m *RequestLimitsMiddleware) check(contentType string, raw []byte) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if m.maxJSONDepth > 0 && jsonDepthExceeds(raw, m.maxJSONDepth) {
+			return errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf("The JSON request body must not be nested deeper than %d levels.", m.maxJSONDepth).
+				WithDetail("error_id", JSONTooDeepErrorID))
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if m.maxFormFields > 0 && formFieldsExceed(raw, m.maxFormFields) {
+			return m.tooManyFormFields()
+		}
+	case mediaType == "multipart/form-data":
+		if m.maxFormFields > 0 && multipartFieldsExceed(raw, params["boundary"], m.maxFormFields) {
+			return m.tooManyFormFields()
+		}
+	}
+	return nil
+}
+
+func (m *RequestLimitsMiddleware) tooManyFormFields() error {
+	return errors.WithStack(herodot.ErrBadRequest.
+		WithReasonf("The request body must not contain more than %d form fields.", m.maxFormFields).
+		WithDetail("error_id", TooManyFormFieldsErrorID))
+}
+
+// jsonDepthExceeds scans the tokens of the document without decoding it. Invalid documents are not reported.
+func jsonDepthExceeds(raw []byte, max int) bool {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	var depth int
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return false
+		}
+
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > max {
+				return true
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// formFieldsExceed counts the fields the way url.ParseQuery separates them.
+func formFieldsExceed(raw []byte, max int) bool {
+	fields := strings.FieldsFunc(string(raw), func(r rune) bool { return r == '&' || r == ';' })
+	return len(fields) > max
+}
+
+func multipartFieldsExceed(raw []byte, boundary string, max int) bool {
+	if len(boundary) == 0 {
+		return false
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(raw), boundary)
+	for fields := 0; ; fields++ {
+		if fields > max {
+			return true
+		}
+
+		p, err := mr.NextPart()
+		if err != nil {
+			return false
+		}
+		_ = p.Close()
+	}
+}
@@ -0,0 +1,80 @@
+package x
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+)
+
+func TestRequestLimitsMiddleware(t *testing.T) {
+	m := NewRequestLimitsMiddleware(512, 3, 2, herodot.NewJSONWriter(logrus.New()))
+
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, mw.WriteField(name, "1"))
+	}
+	require.NoError(t, mw.Close())
+
+	for k, tc := range []struct {
+		d           string
+		contentType string
+		body        string
+		chunked     bool
+		expectCode  int
+		expectID    string
+	}{
+		{d: "accepts small bodies", contentType: "application/json", body: `{"a":{"b":[1]}}`, expectCode: http.StatusOK},
+		{d: "rejects large bodies", contentType: "application/json", body: `"` + strings.Repeat("a", 512) + `"`, expectCode: http.StatusRequestEntityTooLarge, expectID: RequestBodyTooLargeErrorID},
+		{d: "rejects large bodies without content length", contentType: "text/plain", body: strings.Repeat("a", 513), chunked: true, expectCode: http.StatusRequestEntityTooLarge, expectID: RequestBodyTooLargeErrorID},
+		{d: "rejects deeply nested JSON", contentType: "application/json; charset=utf-8", body: `{"a":{"b":[[1]]}}`, expectCode: http.StatusBadRequest, expectID: JSONTooDeepErrorID},
+		{d: "leaves invalid JSON to the handler", contentType: "application/json", body: `{"a":`, expectCode: http.StatusOK},
+		{d: "accepts forms with few fields", contentType: "application/x-www-form-urlencoded", body: "a=1&b=2", expectCode: http.StatusOK},
+		{d: "rejects forms with too many fields", contentType: "application/x-www-form-urlencoded", body: "a=1&b=2;c=3", expectCode: http.StatusBadRequest, expectID: TooManyFormFieldsErrorID},
+		{d: "rejects multipart forms with too many fields", contentType: mw.FormDataContentType(), body: multipartBody.String(), expectCode: http.StatusBadRequest, expectID: TooManyFormFieldsErrorID},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			if tc.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+
+			var received string
+			m.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+				received = string(MustReadAll(r.Body))
+			})
+
+			assert.Equal(t, tc.expectCode, w.Code, "%d: %s", k, w.Body.String())
+			if tc.expectCode == http.StatusOK {
+				assert.Equal(t, tc.body, received, "%d: the next handler receives the body unchanged", k)
+			} else {
+				assert.Equal(t, tc.expectID, gjson.Get(w.Body.String(), "error.details.error_id").String(), "%d: %s", k, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("case=limits below one are disabled", func(t *testing.T) {
+		body := `{"a":[[[[` + strings.Repeat("1,", 64) + `1]]]]}`
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		var called bool
+		NewRequestLimitsMiddleware(0, 0, 0, herodot.NewJSONWriter(logrus.New())).ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+		assert.True(t, called)
+	})
+}
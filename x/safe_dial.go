@@ -0,0 +1,124 @@
+package x
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPrivateAddress is returned when an outbound call would connect to an address which is not publicly routable,
+// for example a loopback, private, or link-local address such as the metadata service of a cloud provider.
+var ErrPrivateAddress = errors.New("outbound calls may not connect to private network addresses")
+
+// privateNetworks are the networks which are not publicly routable, see RFC 6890.
+var privateNetworks = func() (networks []*net.IPNet) {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// AllowAddress returns true if the host may be called at the private IP address it resolved to.
+type AllowAddress func(ctx context.Context, host string, ip net.IP) bool
+
+// SafeDialer connects to public addresses only, unless Allow permits the private address. The address is checked
+// after the host was resolved, right before connecting, so a host can not resolve to a public address when it is
+// checked and to a private one when it is called (DNS rebinding).
+type SafeDialer struct {
+	net.Dialer
+	Allow AllowAddress
+}
+
+// IsPrivateIP returns true if the IP address is not publicly routable. IPv4 addresses mapped to IPv6 are treated as
+// IPv4 addresses.
+func IsPrivateIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// DialContext connects to the address like net.Dialer does, but returns ErrPrivateAddress instead of connecting to
+// a private address which is not allowed.
+func (d *SafeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dialer := d.Dialer
+	dialer.Control = func(_, resolved string, _ syscall.RawConn) error {
+		ip, _, err := net.SplitHostPort(resolved)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return checkAddress(ctx, host, net.ParseIP(ip), d.Allow)
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// CheckHost resolves the host and returns ErrPrivateAddress if one of its addresses is private and not allowed. It
+// reports configured URLs early, the address is checked again when connecting, see SafeDialer.
+func CheckHost(ctx context.Context, host string, allow AllowAddress) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, addr := range addrs {
+		if err := checkAddress(ctx, host, addr.IP, allow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewSafeTransport returns a copy of http.DefaultTransport which connects using a SafeDialer.
+func NewSafeTransport(allow AllowAddress) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&SafeDialer{
+		Dialer: net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		Allow:  allow,
+	}).DialContext
+	return t
+}
+
+func checkAddress(ctx context.Context, host string, ip net.IP, allow AllowAddress) error {
+	if ip != nil && !IsPrivateIP(ip) {
+		return nil
+	}
+	if ip != nil && allow != nil && allow(ctx, host, ip) {
+		return nil
+	}
+	return errors.WithStack(errors.WithMessagef(ErrPrivateAddress, "%s resolves to %s", host, ip))
+}
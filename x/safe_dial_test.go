@@ -0,0 +1,59 @@
+package x
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "::", "fd12::1", "fe80::1", "::ffff:127.0.0.1", "::ffff:10.0.0.1"} {
+		assert.True(t, IsPrivateIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "172.32.0.1", "2001:4860:4860::8888", "::ffff:8.8.8.8"} {
+		assert.False(t, IsPrivateIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestSafeDialer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	t.Run("case=blocks private addresses", func(t *testing.T) {
+		c := &http.Client{Transport: NewSafeTransport(nil)}
+		_, err := c.Get(ts.URL)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrPrivateAddress), "%+v", err)
+	})
+
+	t.Run("case=allows private addresses which are allowed", func(t *testing.T) {
+		var hosts []string
+		c := &http.Client{Transport: NewSafeTransport(func(_ context.Context, host string, ip net.IP) bool {
+			hosts = append(hosts, host)
+			return ip.IsLoopback()
+		})}
+
+		res, err := c.Get(ts.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{"127.0.0.1"}, hosts)
+	})
+
+	t.Run("method=CheckHost", func(t *testing.T) {
+		err := CheckHost(context.Background(), "127.0.0.1", nil)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrPrivateAddress), "%+v", err)
+
+		assert.NoError(t, CheckHost(context.Background(), "127.0.0.1", func(context.Context, string, net.IP) bool { return true }))
+		assert.NoError(t, CheckHost(context.Background(), "8.8.8.8", nil))
+	})
+}
@@ -0,0 +1,58 @@
+package x
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/randx"
+)
+
+// CSPNoncePlaceholder is replaced by the nonce of the request in the values of security headers.
+const CSPNoncePlaceholder = "{nonce}"
+
+type cspNonceContextKey struct{}
+
+// SecurityHeadersMiddleware sets security headers, such as Content-Security-Policy or X-Frame-Options, on all
+// responses. Every request gets a new nonce which replaces CSPNoncePlaceholder in the header values, so that
+// inline scripts and styles rendered for the request can be allowed using CSPNonce.
+//
+// Strict-Transport-Security is only sent over HTTPS, as browsers ignore it otherwise.
+type SecurityHeadersMiddleware struct {
+	headers map[string]string
+	w       herodot.Writer
+}
+
+// NewSecurityHeadersMiddleware returns a middleware which sets the headers. Headers with an empty value are
+// not sent.
+func NewSecurityHeadersMiddleware(headers map[string]string, w herodot.Writer) *SecurityHeadersMiddleware {
+	return &SecurityHeadersMiddleware{headers: headers, w: w}
+}
+
+func (m *SecurityHeadersMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	nonce, err := randx.RuneSequence(32, randx.AlphaNum)
+	if err != nil {
+		m.w.WriteError(w, r, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to generate the nonce of the content security policy: %s", err)))
+		return
+	}
+
+	secure := r.TLS != nil || r.URL.Scheme == "https"
+	for name, value := range m.headers {
+		if len(value) == 0 || (http.CanonicalHeaderKey(name) == "Strict-Transport-Security" && !secure) {
+			continue
+		}
+		w.Header().Set(name, strings.Replace(value, CSPNoncePlaceholder, string(nonce), -1))
+	}
+
+	next(w, r.WithContext(context.WithValue(r.Context(), cspNonceContextKey{}, string(nonce))))
+}
+
+// CSPNonce returns the nonce of the request which inline scripts and styles must carry in their nonce attribute.
+// It returns an empty string if the request was not handled by SecurityHeadersMiddleware.
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey{}).(string)
+	return nonce
+}
@@ -0,0 +1,55 @@
+package x
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	m := NewSecurityHeadersMiddleware(map[string]string{
+		"Content-Security-Policy":   "script-src 'nonce-{nonce}'",
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "",
+	}, herodot.NewJSONWriter(logrus.New()))
+
+	serve := func(r *http.Request) (*httptest.ResponseRecorder, string) {
+		w := httptest.NewRecorder()
+		var nonce string
+		m.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+			nonce = CSPNonce(r)
+		})
+		return w, nonce
+	}
+
+	w, nonce := serve(httptest.NewRequest("GET", "/", nil))
+	require.NotEmpty(t, nonce)
+	assert.Equal(t, "script-src 'nonce-"+nonce+"'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	_, ok := w.Header()["Referrer-Policy"]
+	assert.False(t, ok, "headers with an empty value are not sent")
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"), "HSTS is only sent over HTTPS")
+
+	_, other := serve(httptest.NewRequest("GET", "/", nil))
+	assert.NotEqual(t, nonce, other, "each request gets a new nonce")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = new(tls.ConnectionState)
+	w, _ = serve(r)
+	assert.Equal(t, "max-age=31536000", w.Header().Get("Strict-Transport-Security"))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.URL.Scheme = "https"
+	w, _ = serve(r)
+	assert.Equal(t, "max-age=31536000", w.Header().Get("Strict-Transport-Security"), "the scheme forwarded by trusted proxies counts")
+
+	assert.Empty(t, CSPNonce(httptest.NewRequest("GET", "/", nil)))
+}
@@ -0,0 +1,91 @@
+package x
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader carries the HMAC signatures of the requests ORY Kratos sends to the hooks of other services.
+// Its value looks like
+//
+//	t=1577836800,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd
+//
+// where t is the time of signing in seconds since the Unix epoch and v1 is the hex encoded HMAC SHA-256 of the
+// time, a dot, and the request body. The header contains one v1 signature per configured secret.
+const SignatureHeader = "X-Kratos-Signature"
+
+const signatureScheme = "v1"
+
+// Sign returns the value of the SignatureHeader for the payload, signed with every secret.
+func Sign(payload []byte, secrets []string, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	parts := []string{"t=" + ts}
+	for _, secret := range secrets {
+		parts = append(parts, signatureScheme+"="+hex.EncodeToString(computeSignature(secret, ts, payload)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// SignatureTimestamp returns the time of signing contained in the header, or an empty string if it has none.
+func SignatureTimestamp(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		if kv := strings.SplitN(strings.TrimSpace(part), "=", 2); len(kv) == 2 && kv[0] == "t" {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+// VerifySignature returns nil if the header contains a signature of the payload made with one of the secrets
+// which is at most tolerance old. A tolerance of zero does not check the age.
+func VerifySignature(header string, payload []byte, secrets []string, tolerance time.Duration, now time.Time) error {
+	var (
+		ts         string
+		signatures [][]byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case signatureScheme:
+			if sig, err := hex.DecodeString(kv[1]); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	signedAt, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.Errorf("the %s header does not contain a valid timestamp", SignatureHeader)
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return errors.Errorf("the signature was made %s ago which exceeds the tolerance of %s", age, tolerance)
+	}
+
+	for _, secret := range secrets {
+		expected := computeSignature(secret, ts, payload)
+		for _, sig := range signatures {
+			if hmac.Equal(expected, sig) {
+				return nil
+			}
+		}
+	}
+	return errors.Errorf("none of the signatures in the %s header matches", SignatureHeader)
+}
+
+func computeSignature(secret, ts string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(ts + "."))
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)
+}
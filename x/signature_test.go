@@ -0,0 +1,45 @@
+package x
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	now := time.Unix(1577836800, 0)
+	payload := []byte("logout_token=foo")
+	header := Sign(payload, []string{"current-secret", "previous-secret"}, now)
+
+	assert.Regexp(t, `^t=1577836800,v1=[0-9a-f]{64},v1=[0-9a-f]{64}$`, header)
+	assert.Equal(t, "1577836800", SignatureTimestamp(header))
+	assert.Equal(t, "", SignatureTimestamp("v1=abc"))
+
+	for k, tc := range []struct {
+		header    string
+		payload   []byte
+		secrets   []string
+		now       time.Time
+		tolerance time.Duration
+		expectErr bool
+	}{
+		{header: header, payload: payload, secrets: []string{"current-secret"}, now: now, tolerance: time.Minute},
+		{header: header, payload: payload, secrets: []string{"previous-secret"}, now: now, tolerance: time.Minute},
+		{header: header, payload: payload, secrets: []string{"other-secret", "previous-secret"}, now: now, tolerance: time.Minute},
+		{header: header, payload: payload, secrets: []string{"current-secret"}, now: now.Add(time.Hour)},
+		{header: header, payload: payload, secrets: []string{"other-secret"}, now: now, tolerance: time.Minute, expectErr: true},
+		{header: header, payload: []byte("logout_token=bar"), secrets: []string{"current-secret"}, now: now, tolerance: time.Minute, expectErr: true},
+		{header: header, payload: payload, secrets: []string{"current-secret"}, now: now.Add(time.Hour), tolerance: time.Minute, expectErr: true},
+		{header: "v1=abc", payload: payload, secrets: []string{"current-secret"}, now: now, expectErr: true},
+		{header: "", payload: payload, secrets: []string{"current-secret"}, now: now, expectErr: true},
+	} {
+		err := VerifySignature(tc.header, tc.payload, tc.secrets, tc.tolerance, tc.now)
+		if tc.expectErr {
+			require.Error(t, err, "%d", k)
+		} else {
+			require.NoError(t, err, "%d", k)
+		}
+	}
+}
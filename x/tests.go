@@ -3,13 +3,47 @@ package x
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/sjson"
 )
 
+// snapshotDir contains the snapshots of AssertJSONSnapshot, relative to the package of the test.
+const snapshotDir = ".snapshots"
+
 func MustEncodeJSON(t *testing.T, in interface{}) string {
 	var b bytes.Buffer
 	require.NoError(t, json.NewEncoder(&b).Encode(in))
 	return b.String()
 }
+
+// AssertJSONSnapshot compares actual with the snapshot called name, so that changes of the JSON returned by the
+// API are noticed. Values at the ignored paths (sjson syntax), for example IDs or timestamps, are removed before
+// comparing. Run the tests with UPDATE_SNAPSHOTS=true to create or update the snapshots after an intended change.
+func AssertJSONSnapshot(t *testing.T, name string, actual []byte, ignore ...string) {
+	var err error
+	for _, path := range ignore {
+		actual, err = sjson.DeleteBytes(actual, path)
+		require.NoError(t, err)
+	}
+
+	var indented bytes.Buffer
+	require.NoError(t, json.Indent(&indented, actual, "", "  "), "%s", actual)
+	indented.WriteString("\n")
+
+	path := filepath.Join(snapshotDir, name+".json")
+	if os.Getenv("UPDATE_SNAPSHOTS") == "true" {
+		require.NoError(t, os.MkdirAll(snapshotDir, 0755))
+		require.NoError(t, ioutil.WriteFile(path, indented.Bytes(), 0644))
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	require.NoError(t, err, "The snapshot %s does not exist, run the tests with UPDATE_SNAPSHOTS=true to create it.", path)
+	assert.JSONEq(t, string(expected), indented.String(), "The JSON does not match snapshot %s. If the change is intended, run the tests with UPDATE_SNAPSHOTS=true to update it.", path)
+}